@@ -14,6 +14,7 @@ import (
 	"github.com/dublyo/mailat/api/internal/router"
 	"github.com/dublyo/mailat/api/internal/service"
 	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
 )
 
 // @title mailat.co API
@@ -102,6 +103,11 @@ func main() {
 	}
 	fmt.Println("Database schema initialized")
 
+	// Suppressions stored before addresses were normalized get their canonical form
+	if err := emailaddr.BackfillNormalized(context.Background(), db); err != nil {
+		fmt.Printf("Warning: failed to normalize suppressed addresses: %v\n", err)
+	}
+
 	// Connect to Redis
 	redis, err := database.ConnectRedis(cfg)
 	if err != nil {
@@ -116,6 +122,15 @@ func main() {
 	var sched *worker.Scheduler
 	if cfg.WorkerEnabled {
 		w = worker.NewWorker(db, cfg)
+		// Batch entries go through the same checks as single sends
+		w.SetBatchProcessor(service.NewTransactionalService(db, cfg, redis))
+		// Emails held for undo send go out the way unheld ones do
+		identityService := service.NewIdentityService(db, cfg, redis)
+		composeService := service.NewComposeService(db, cfg, identityService)
+		w.SetComposeSender(composeService)
+		// Filter runs act on emails the way filters do on arrival
+		w.SetFilterRunner(service.NewInboxFilterEngine(db, composeService))
+		w.SetInboxBulkRunner(service.NewInboxService(db, cfg, identityService))
 		go func() {
 			if err := w.Start(); err != nil {
 				fmt.Printf("Worker failed: %v\n", err)
@@ -164,6 +179,11 @@ func main() {
 	s.SetPort(cfg.Port)
 	s.SetDumpRouterMap(false)
 
+	// Leave room for attachment uploads plus multipart overhead (GoFrame defaults to 8MB)
+	if maxBody := int64(cfg.AttachmentMaxSizeMB+1) * 1024 * 1024; maxBody > 8*1024*1024 {
+		s.SetClientMaxBodySize(maxBody)
+	}
+
 	// Setup routes
 	router.Setup(s, cfg)
 
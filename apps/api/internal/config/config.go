@@ -30,6 +30,15 @@ type Config struct {
 	// Stalwart
 	StalwartURL        string
 	StalwartAdminToken string
+	// Stalwart master user: when set, JMAP signs in to every identity's account
+	// as "<identity>%<master user>" instead of with the identity's own password
+	StalwartMasterUser     string
+	StalwartMasterPassword string
+	// Where mail apps reach Stalwart's IMAP and SMTP submission, both TLS from
+	// the start (defaults to mail.<app domain>, 993 and 465)
+	MailHostname   string
+	IMAPPort       int
+	SubmissionPort int
 
 	// JWT
 	JWTSecret    string
@@ -66,11 +75,52 @@ type Config struct {
 	MicrosoftClientID     string
 	MicrosoftClientSecret string
 
+	// CRM sync apps orgs connect their HubSpot or Salesforce account through
+	HubSpotClientID        string
+	HubSpotClientSecret    string
+	SalesforceClientID     string
+	SalesforceClientSecret string
+	SalesforceLoginURL     string
+
 	// Organization Limits (configurable defaults per org)
 	DefaultMaxDomains        int
 	DefaultMonthlyEmailLimit int
 	DefaultMaxIdentities     int
 	DefaultMaxContacts       int
+
+	// Domain probation: the first sends from a newly verified domain are
+	// content-checked and held for review when flagged (0 disables)
+	DomainProbationSends        int
+	DomainProbationManualReview bool
+
+	// Pre-uploaded transactional attachments (S3, uses the AWS credentials above)
+	AttachmentsBucket   string
+	AttachmentMaxSizeMB int
+
+	// Encrypted per-org backups of contacts, lists and consent history (S3, uses
+	// the AWS credentials above). Archives are encrypted with BackupEncryptionKey,
+	// or EncryptionKey when it is not set.
+	BackupsBucket       string
+	BackupEncryptionKey string
+
+	// Delivery event exports offered for download (S3, uses the AWS credentials
+	// above). A lifecycle rule on the bucket should remove them after a week.
+	ExportsBucket string
+
+	// MJML template compilation: an MJML render API (mjml.io or compatible, with
+	// optional basic auth) or else the mjml CLI
+	MJMLBinary    string
+	MJMLAPIURL    string
+	MJMLAppID     string
+	MJMLSecretKey string
+
+	// Send-time content guard spam scoring: an rspamd controller URL or a
+	// SpamAssassin spamd host:port (rspamd wins when both are set)
+	RspamdURL string
+	SpamdAddr string
+
+	// ClamAV clamd host:port attachments of received emails are scanned with
+	ClamAVAddr string
 }
 
 var Cfg *Config
@@ -81,6 +131,9 @@ func Load() (*Config, error) {
 
 	port, _ := strconv.Atoi(getEnv("PORT", "3001"))
 	smtpPort, _ := strconv.Atoi(getEnv("SMTP_PORT", "587"))
+	imapPort, _ := strconv.Atoi(getEnv("IMAP_PORT", "993"))
+	submissionPort, _ := strconv.Atoi(getEnv("SUBMISSION_PORT", "465"))
+	appDomain := getEnv("APP_DOMAIN", "localhost")
 	smtpTLS, _ := strconv.ParseBool(getEnv("SMTP_TLS", "true"))
 
 	workerEnabled, _ := strconv.ParseBool(getEnv("WORKER_ENABLED", "false"))
@@ -91,13 +144,20 @@ func Load() (*Config, error) {
 	defaultMaxIdentities, _ := strconv.Atoi(getEnv("DEFAULT_MAX_IDENTITIES", "50"))
 	defaultMaxContacts, _ := strconv.Atoi(getEnv("DEFAULT_MAX_CONTACTS", "10000"))
 
+	// Domain probation
+	domainProbationSends, _ := strconv.Atoi(getEnv("DOMAIN_PROBATION_SENDS", "25"))
+	domainProbationManualReview, _ := strconv.ParseBool(getEnv("DOMAIN_PROBATION_MANUAL_REVIEW", "false"))
+
+	// Attachments
+	attachmentMaxSizeMB, _ := strconv.Atoi(getEnv("ATTACHMENT_MAX_SIZE_MB", "10"))
+
 	Cfg = &Config{
 		// Server
 		Port:      port,
 		Env:       getEnv("NODE_ENV", "development"),
 		APIUrl:    getEnv("API_URL", "http://localhost:3001"),
 		WebUrl:    getEnv("WEB_URL", "http://localhost:3000"),
-		AppDomain: getEnv("APP_DOMAIN", "localhost"),
+		AppDomain: appDomain,
 		AppName:   getEnv("APP_NAME", "Mailat"),
 
 		// Database
@@ -114,6 +174,11 @@ func Load() (*Config, error) {
 		// Stalwart
 		StalwartURL:        getEnv("STALWART_URL", "http://localhost:8080"),
 		StalwartAdminToken: getEnv("STALWART_ADMIN_TOKEN", ""),
+		StalwartMasterUser:     getEnv("STALWART_MASTER_USER", ""),
+		StalwartMasterPassword: getEnv("STALWART_MASTER_PASSWORD", ""),
+		MailHostname:           getEnv("MAIL_HOSTNAME", "mail."+appDomain),
+		IMAPPort:               imapPort,
+		SubmissionPort:         submissionPort,
 
 		// JWT
 		JWTSecret:    getEnv("JWT_SECRET", ""),
@@ -150,11 +215,46 @@ func Load() (*Config, error) {
 		MicrosoftClientID:     getEnv("MICROSOFT_CLIENT_ID", ""),
 		MicrosoftClientSecret: getEnv("MICROSOFT_CLIENT_SECRET", ""),
 
+		// CRM Sync
+		HubSpotClientID:        getEnv("HUBSPOT_CLIENT_ID", ""),
+		HubSpotClientSecret:    getEnv("HUBSPOT_CLIENT_SECRET", ""),
+		SalesforceClientID:     getEnv("SALESFORCE_CLIENT_ID", ""),
+		SalesforceClientSecret: getEnv("SALESFORCE_CLIENT_SECRET", ""),
+		SalesforceLoginURL:     getEnv("SALESFORCE_LOGIN_URL", "https://login.salesforce.com"),
+
 		// Organization Limits
 		DefaultMaxDomains:        defaultMaxDomains,
 		DefaultMonthlyEmailLimit: defaultMonthlyEmailLimit,
 		DefaultMaxIdentities:     defaultMaxIdentities,
 		DefaultMaxContacts:       defaultMaxContacts,
+
+		// Domain Probation
+		DomainProbationSends:        domainProbationSends,
+		DomainProbationManualReview: domainProbationManualReview,
+
+		// Attachments
+		AttachmentsBucket:   getEnv("ATTACHMENTS_BUCKET", ""),
+		AttachmentMaxSizeMB: attachmentMaxSizeMB,
+
+		// Backups
+		BackupsBucket:       getEnv("BACKUPS_BUCKET", ""),
+		BackupEncryptionKey: getEnv("BACKUP_ENCRYPTION_KEY", ""),
+
+		// Exports
+		ExportsBucket: getEnv("EXPORTS_BUCKET", ""),
+
+		// MJML
+		MJMLBinary:    getEnv("MJML_BINARY", "mjml"),
+		MJMLAPIURL:    getEnv("MJML_API_URL", ""),
+		MJMLAppID:     getEnv("MJML_APP_ID", ""),
+		MJMLSecretKey: getEnv("MJML_SECRET_KEY", ""),
+
+		// Content Guard
+		RspamdURL: getEnv("RSPAMD_URL", ""),
+		SpamdAddr: getEnv("SPAMD_ADDR", ""),
+
+		// Virus scanning
+		ClamAVAddr: getEnv("CLAMAV_ADDR", ""),
 	}
 
 	return Cfg, nil
@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"io"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type AttachmentController struct {
+	attachmentService *service.AttachmentService
+}
+
+func NewAttachmentController(attachmentService *service.AttachmentService) *AttachmentController {
+	return &AttachmentController{attachmentService: attachmentService}
+}
+
+// Upload stores a file once so transactional sends can reference it by ID
+// POST /api/v1/attachments (multipart: file, optional checksum as SHA-256 hex)
+func (c *AttachmentController) Upload(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	file := r.GetUploadFile("file")
+	if file == nil {
+		response.BadRequest(r, "File required")
+		return
+	}
+
+	f, err := file.Open()
+	if err != nil {
+		response.BadRequest(r, "Failed to read file")
+		return
+	}
+	defer f.Close()
+
+	// Read one byte past the limit so oversized files are rejected by the service
+	data, err := io.ReadAll(io.LimitReader(f, c.attachmentService.MaxSize()+1))
+	if err != nil {
+		response.BadRequest(r, "Failed to read file data")
+		return
+	}
+
+	filename := r.Get("filename", file.Filename).String()
+	checksum := r.Get("checksum").String()
+
+	result, err := c.attachmentService.Upload(r.Context(), claims.OrgID, filename, file.Header.Get("Content-Type"), checksum, data)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, result)
+}
@@ -119,9 +119,15 @@ func (c *AuthController) CreateAPIKey(r *ghttp.Request) {
 		return
 	}
 
+	// A restricted key could otherwise replace itself with an unrestricted one
+	if c.authService.IsScopedAPIKey(r.Context(), claims.APIKeyID) {
+		response.Forbidden(r, "Restricted API keys cannot manage API keys")
+		return
+	}
+
 	var req model.CreateApiKeyRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -152,6 +158,36 @@ func (c *AuthController) ListAPIKeys(r *ghttp.Request) {
 	response.Success(r, keys)
 }
 
+// UpdateAPIKeyScope changes the sending domains, tag prefixes and daily limit of an API key
+// PUT /api/v1/api-keys/:uuid/scope
+func (c *AuthController) UpdateAPIKeyScope(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	// A restricted key could otherwise replace itself with an unrestricted one
+	if c.authService.IsScopedAPIKey(r.Context(), claims.APIKeyID) {
+		response.Forbidden(r, "Restricted API keys cannot manage API keys")
+		return
+	}
+
+	var req model.UpdateApiKeyScopeRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	key, err := c.authService.UpdateAPIKeyScope(r.Context(), claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "API key restrictions updated", key)
+}
+
 // DeleteAPIKey revokes an API key
 // DELETE /api/v1/api-keys/:uuid
 func (c *AuthController) DeleteAPIKey(r *ghttp.Request) {
@@ -161,6 +197,12 @@ func (c *AuthController) DeleteAPIKey(r *ghttp.Request) {
 		return
 	}
 
+	// A restricted key could otherwise replace itself with an unrestricted one
+	if c.authService.IsScopedAPIKey(r.Context(), claims.APIKeyID) {
+		response.Forbidden(r, "Restricted API keys cannot manage API keys")
+		return
+	}
+
 	keyUUID := r.Get("uuid").String()
 	if keyUUID == "" {
 		response.BadRequest(r, "API key UUID required")
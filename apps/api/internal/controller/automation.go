@@ -28,7 +28,7 @@ func (c *AutomationController) Create(r *ghttp.Request) {
 
 	var req model.CreateAutomationRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -104,7 +104,7 @@ func (c *AutomationController) Update(r *ghttp.Request) {
 
 	var req model.UpdateAutomationRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -213,9 +213,127 @@ func (c *AutomationController) GetStats(r *ghttp.Request) {
 	response.Success(r, stats)
 }
 
-// EnrollContact enrolls a contact in an automation
+// ListVersions lists the versions of an automation's workflow
+// GET /api/v1/automations/:uuid/versions
+func (c *AutomationController) ListVersions(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	automationUUID := r.Get("uuid").String()
+	if automationUUID == "" {
+		response.BadRequest(r, "Automation UUID required")
+		return
+	}
+
+	versions, err := c.automationService.ListVersions(r.Context(), claims.OrgID, automationUUID)
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, versions)
+}
+
+// Simulate walks a contact through an automation's workflow without sending or
+// changing anything
+// POST /api/v1/automations/:uuid/simulate
+func (c *AutomationController) Simulate(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	automationUUID := r.Get("uuid").String()
+	if automationUUID == "" {
+		response.BadRequest(r, "Automation UUID required")
+		return
+	}
+
+	var req model.SimulateAutomationRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	simulation, err := c.automationService.SimulateAutomation(r.Context(), claims.OrgID, automationUUID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, simulation)
+}
+
+// EnrollContacts enrolls contacts in an automation, by UUID or as the members
+// of a segment
 // POST /api/v1/automations/:uuid/enroll
-func (c *AutomationController) EnrollContact(r *ghttp.Request) {
+func (c *AutomationController) EnrollContacts(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	automationUUID := r.Get("uuid").String()
+	if automationUUID == "" {
+		response.BadRequest(r, "Automation UUID required")
+		return
+	}
+
+	var req model.EnrollContactsRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.automationService.EnrollContacts(r.Context(), claims.OrgID, automationUUID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Contacts enrolled in automation", result)
+}
+
+// UnenrollContacts takes contacts out of an automation, by UUID or as the
+// members of a segment
+// DELETE /api/v1/automations/:uuid/enroll
+func (c *AutomationController) UnenrollContacts(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	automationUUID := r.Get("uuid").String()
+	if automationUUID == "" {
+		response.BadRequest(r, "Automation UUID required")
+		return
+	}
+
+	var req model.EnrollContactsRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.automationService.UnenrollContacts(r.Context(), claims.OrgID, automationUUID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Contacts unenrolled from automation", result)
+}
+
+// ListFailedEnrollments lists an automation's enrollments that stopped in error
+// or were paused at a node that failed
+// GET /api/v1/automations/:uuid/failed
+func (c *AutomationController) ListFailedEnrollments(r *ghttp.Request) {
 	claims := middleware.GetClaims(r)
 	if claims == nil {
 		response.Unauthorized(r, "Not authenticated")
@@ -228,19 +346,88 @@ func (c *AutomationController) EnrollContact(r *ghttp.Request) {
 		return
 	}
 
-	var req struct {
-		ContactUUID string `json:"contactUuid" v:"required"`
+	page := r.GetQuery("page", 1).Int()
+	pageSize := r.GetQuery("pageSize", 20).Int()
+
+	result, err := c.automationService.ListFailedEnrollments(r.Context(), claims.OrgID, automationUUID, page, pageSize)
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// RetryFailedEnrollments puts failed enrollments back in the workflow at the
+// node that failed
+// POST /api/v1/automations/:uuid/failed/retry
+func (c *AutomationController) RetryFailedEnrollments(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	automationUUID := r.Get("uuid").String()
+	if automationUUID == "" {
+		response.BadRequest(r, "Automation UUID required")
+		return
 	}
+
+	var req model.RetryEnrollmentsRequest
 	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.automationService.RetryFailedEnrollments(r.Context(), claims.OrgID, automationUUID, &req)
+	if err != nil {
 		response.BadRequest(r, err.Error())
 		return
 	}
 
-	err := c.automationService.EnrollContact(r.Context(), claims.OrgID, automationUUID, req.ContactUUID)
+	response.SuccessWithMessage(r, "Enrollments retried", result)
+}
+
+// RotateTriggerSecret gives a webhook automation a new signing secret
+// POST /api/v1/automations/:uuid/trigger-secret
+func (c *AutomationController) RotateTriggerSecret(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	automationUUID := r.Get("uuid").String()
+	if automationUUID == "" {
+		response.BadRequest(r, "Automation UUID required")
+		return
+	}
+
+	automation, err := c.automationService.RotateTriggerSecret(r.Context(), claims.OrgID, automationUUID)
 	if err != nil {
 		response.BadRequest(r, err.Error())
 		return
 	}
 
-	response.SuccessWithMessage(r, "Contact enrolled in automation", nil)
+	response.SuccessWithMessage(r, "Trigger secret rotated", automation)
+}
+
+// Trigger enrolls the contact of a signed request posted by an external system
+// to a webhook automation's trigger URL
+// POST /api/v1/automations/:uuid/trigger
+func (c *AutomationController) Trigger(r *ghttp.Request) {
+	result, err := c.automationService.TriggerWebhook(
+		r.Context(),
+		r.Get("uuid").String(),
+		r.Header.Get("X-Webhook-Timestamp"),
+		r.Header.Get("X-Webhook-Signature"),
+		r.GetBody(),
+	)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Automation triggered", result)
 }
@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type BackupController struct {
+	backupService *service.BackupService
+}
+
+func NewBackupController(backupService *service.BackupService) *BackupController {
+	return &BackupController{backupService: backupService}
+}
+
+// List returns the organization's contact backups
+// GET /api/v1/backups
+func (c *BackupController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	backups, err := c.backupService.List(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, backups)
+}
+
+// Get returns a contact backup
+// GET /api/v1/backups/:uuid
+func (c *BackupController) Get(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	backup, err := c.backupService.Get(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, backup)
+}
+
+// Create queues a backup of the organization's contacts, lists and consent history
+// POST /api/v1/backups
+func (c *BackupController) Create(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can take backups")
+		return
+	}
+
+	backup, err := c.backupService.Create(r.Context(), claims.OrgID)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, backup)
+}
+
+// Restore brings back the contacts, lists and consent records deleted since a backup was taken
+// POST /api/v1/backups/:uuid/restore
+func (c *BackupController) Restore(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can restore backups")
+		return
+	}
+
+	var req model.RestoreBackupRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.backupService.Restore(r.Context(), claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	if req.DryRun {
+		response.Success(r, result)
+		return
+	}
+	response.SuccessWithMessage(r, "Backup restored", result)
+}
@@ -1,6 +1,11 @@
 package controller
 
 import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"strings"
+
 	"github.com/gogf/gf/v2/net/ghttp"
 
 	"github.com/dublyo/mailat/api/internal/middleware"
@@ -28,7 +33,7 @@ func (c *CampaignController) Create(r *ghttp.Request) {
 
 	var req model.CreateCampaignRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -77,8 +82,9 @@ func (c *CampaignController) List(r *ghttp.Request) {
 	page := r.GetQuery("page", 1).Int()
 	pageSize := r.GetQuery("pageSize", 20).Int()
 	status := r.GetQuery("status", "").String()
+	archived := r.GetQuery("archived", false).Bool()
 
-	result, err := c.campaignService.ListCampaigns(r.Context(), claims.OrgID, page, pageSize, status)
+	result, err := c.campaignService.ListCampaigns(r.Context(), claims.OrgID, page, pageSize, status, archived)
 	if err != nil {
 		response.InternalError(r, err.Error())
 		return
@@ -104,7 +110,7 @@ func (c *CampaignController) Update(r *ghttp.Request) {
 
 	var req model.UpdateCampaignRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -158,7 +164,7 @@ func (c *CampaignController) Schedule(r *ghttp.Request) {
 
 	var req model.ScheduleCampaignRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -195,6 +201,131 @@ func (c *CampaignController) SendNow(r *ghttp.Request) {
 	response.SuccessWithMessage(r, "Campaign sending started", campaign)
 }
 
+// Resend clones a sent campaign targeted at recipients who did not open or click
+// POST /api/v1/campaigns/:uuid/resend
+func (c *CampaignController) Resend(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	var req model.ResendCampaignRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	campaign, err := c.campaignService.ResendCampaign(r.Context(), claims.OrgID, campaignUUID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Created(r, campaign)
+}
+
+// ResendUnopened creates a follow-up campaign to the recipients who didn't open a
+// sent campaign
+// POST /api/v1/campaigns/:uuid/resend-unopened
+func (c *CampaignController) ResendUnopened(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	var req model.ResendUnopenedRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	campaign, err := c.campaignService.ResendUnopened(r.Context(), claims.OrgID, campaignUUID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Created(r, campaign)
+}
+
+// Duplicate copies a campaign into a new draft
+// POST /api/v1/campaigns/:uuid/duplicate
+func (c *CampaignController) Duplicate(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	var req model.DuplicateCampaignRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	campaign, err := c.campaignService.DuplicateCampaign(r.Context(), claims.OrgID, campaignUUID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, campaign)
+}
+
+// Archive hides a campaign from the default listing
+// POST /api/v1/campaigns/:uuid/archive
+func (c *CampaignController) Archive(r *ghttp.Request) {
+	c.setArchived(r, true)
+}
+
+// Unarchive brings an archived campaign back into the default listing
+// POST /api/v1/campaigns/:uuid/unarchive
+func (c *CampaignController) Unarchive(r *ghttp.Request) {
+	c.setArchived(r, false)
+}
+
+func (c *CampaignController) setArchived(r *ghttp.Request, archived bool) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	campaign, err := c.campaignService.SetCampaignArchived(r.Context(), claims.OrgID, campaignUUID, archived)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, campaign)
+}
+
 // Pause pauses a sending campaign
 // POST /api/v1/campaigns/:uuid/pause
 func (c *CampaignController) Pause(r *ghttp.Request) {
@@ -291,7 +422,99 @@ func (c *CampaignController) GetStats(r *ghttp.Request) {
 	response.Success(r, stats)
 }
 
-// Preview renders a campaign preview
+// GetLinks reports a campaign's clicks per link, most clicked first
+// GET /api/v1/campaigns/:uuid/links
+func (c *CampaignController) GetLinks(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	report, err := c.campaignService.GetCampaignLinks(r.Context(), claims.OrgID, campaignUUID, r.Get("limit").Int())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, report)
+}
+
+// ListRecipients returns a campaign's recipients with the status of their email
+// GET /api/v1/campaigns/:uuid/recipients
+func (c *CampaignController) ListRecipients(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	query := parseCampaignRecipientQuery(r)
+	query.Page = r.GetQuery("page", 1).Int()
+	query.PageSize = r.GetQuery("pageSize", 50).Int()
+
+	result, err := c.campaignService.ListCampaignRecipients(r.Context(), claims.OrgID, campaignUUID, query)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// ExportRecipients returns a campaign's recipients, filtered like ListRecipients, as CSV
+// GET /api/v1/campaigns/:uuid/recipients/export
+func (c *CampaignController) ExportRecipients(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	result, err := c.campaignService.ListCampaignRecipients(r.Context(), claims.OrgID, campaignUUID, parseCampaignRecipientQuery(r))
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	var buf strings.Builder
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(service.CampaignRecipientsCSV(result.Recipients)); err != nil {
+		response.InternalError(r, "Failed to build CSV export")
+		return
+	}
+
+	r.Response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"campaign-%s-recipients.csv\"", campaignUUID))
+	r.Response.Write(buf.String())
+}
+
+func parseCampaignRecipientQuery(r *ghttp.Request) *model.CampaignRecipientQuery {
+	return &model.CampaignRecipientQuery{
+		Status: r.GetQuery("status", "").String(),
+		Email:  r.GetQuery("email", "").String(),
+	}
+}
+
+// Preview renders a campaign for a sample contact
 // POST /api/v1/campaigns/:uuid/preview
 func (c *CampaignController) Preview(r *ghttp.Request) {
 	claims := middleware.GetClaims(r)
@@ -306,16 +529,52 @@ func (c *CampaignController) Preview(r *ghttp.Request) {
 		return
 	}
 
-	preview, err := c.campaignService.PreviewCampaign(r.Context(), claims.OrgID, campaignUUID)
+	var req model.CampaignPreviewRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	preview, err := c.campaignService.PreviewCampaign(r.Context(), claims.OrgID, campaignUUID, &req)
 	if err != nil {
-		response.NotFound(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
 	response.Success(r, preview)
 }
 
-// SendTest sends a test email for a campaign
+// Lint reports merge tags of a campaign that won't render
+// POST /api/v1/campaigns/:uuid/lint
+func (c *CampaignController) Lint(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	var req model.CampaignLintRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.campaignService.LintCampaign(r.Context(), claims.OrgID, campaignUUID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// SendTest sends a campaign, rendered for a sample contact, to allowlisted addresses
 // POST /api/v1/campaigns/:uuid/test
 func (c *CampaignController) SendTest(r *ghttp.Request) {
 	claims := middleware.GetClaims(r)
@@ -330,19 +589,200 @@ func (c *CampaignController) SendTest(r *ghttp.Request) {
 		return
 	}
 
-	var req struct {
-		Email string `json:"email" v:"required|email"`
+	var req model.CampaignTestSendRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.campaignService.SendTestEmail(r.Context(), claims.OrgID, claims.APIKeyID, campaignUUID, &req)
+	if err != nil {
+		var supErr *service.SuppressedRecipientError
+		if errors.As(err, &supErr) {
+			response.FailWithData(r, err, map[string]any{
+				"suppressions": supErr.Suppressions,
+			})
+			return
+		}
+		var contentErr *service.ContentBlockedError
+		if errors.As(err, &contentErr) {
+			response.FailWithData(r, err, map[string]any{
+				"contentFindings": contentErr.Findings,
+			})
+			return
+		}
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// ListPreviews returns a campaign's inbox previews
+// GET /api/v1/campaigns/:uuid/previews
+func (c *CampaignController) ListPreviews(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	previews, err := c.campaignService.ListCampaignPreviews(r.Context(), claims.OrgID, campaignUUID)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, previews)
+}
+
+// ListSnapshots returns the content snapshots a campaign was scheduled or sent with
+// GET /api/v1/campaigns/:uuid/snapshots
+func (c *CampaignController) ListSnapshots(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	snapshots, err := c.campaignService.ListCampaignSnapshots(r.Context(), claims.OrgID, campaignUUID)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, snapshots)
+}
+
+// GetSnapshot returns a content snapshot of a campaign with its content
+// GET /api/v1/campaigns/:uuid/snapshots/:id
+func (c *CampaignController) GetSnapshot(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	snapshotID := r.Get("id").Int64()
+	if campaignUUID == "" || snapshotID <= 0 {
+		response.BadRequest(r, "Campaign UUID and snapshot ID required")
+		return
+	}
+
+	snapshot, err := c.campaignService.GetCampaignSnapshot(r.Context(), claims.OrgID, campaignUUID, snapshotID)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, snapshot)
+}
+
+// RecordConversion records a conversion of a campaign's recipient, such as an order
+// placed after clicking through
+// POST /api/v1/campaigns/:uuid/conversions
+func (c *CampaignController) RecordConversion(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	var req model.RecordConversionRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	conversion, err := c.campaignService.RecordConversion(r.Context(), claims.OrgID, campaignUUID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	if conversion.Duplicate {
+		response.SuccessWithMessage(r, "Order already recorded", conversion)
+		return
+	}
+	response.Created(r, conversion)
+}
+
+// RenderPreviews renders a campaign's inbox previews through the org's preview service
+// POST /api/v1/campaigns/:uuid/previews
+func (c *CampaignController) RenderPreviews(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
 	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	var req model.RenderCampaignPreviewsRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
-	err := c.campaignService.SendTestEmail(r.Context(), claims.OrgID, campaignUUID, req.Email)
+	previews, err := c.campaignService.RenderCampaignPreviews(r.Context(), claims.OrgID, campaignUUID, &req)
 	if err != nil {
-		response.InternalError(r, err.Error())
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Inbox previews rendered", previews)
+}
+
+// PreviewImage serves the image of a campaign's inbox preview in one client, or
+// redirects to it when the preview service hosts it
+// GET /api/v1/campaigns/:uuid/previews/:client/image
+func (c *CampaignController) PreviewImage(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	campaignUUID := r.Get("uuid").String()
+	if campaignUUID == "" {
+		response.BadRequest(r, "Campaign UUID required")
+		return
+	}
+
+	data, contentType, imageURL, err := c.campaignService.GetCampaignPreviewImage(r.Context(), claims.OrgID, campaignUUID, r.Get("client").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+	if data == nil {
+		r.Response.RedirectTo(imageURL)
 		return
 	}
 
-	response.SuccessWithMessage(r, "Test email queued", nil)
+	r.Response.Header().Set("Content-Type", contentType)
+	r.Response.Header().Set("Cache-Control", "private, max-age=300")
+	r.Response.Write(data)
 }
@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"fmt"
+	"net/http"
+
 	"github.com/gogf/gf/v2/net/ghttp"
 
 	"github.com/dublyo/mailat/api/internal/middleware"
@@ -10,10 +13,11 @@ import (
 
 type ComplianceController struct {
 	complianceService *service.ComplianceService
+	auditLogService   *service.AuditLogService
 }
 
-func NewComplianceController(complianceService *service.ComplianceService) *ComplianceController {
-	return &ComplianceController{complianceService: complianceService}
+func NewComplianceController(complianceService *service.ComplianceService, auditLogService *service.AuditLogService) *ComplianceController {
+	return &ComplianceController{complianceService: complianceService, auditLogService: auditLogService}
 }
 
 // OneClickUnsubscribe handles RFC 8058 one-click unsubscribe (POST only)
@@ -28,6 +32,18 @@ func (c *ComplianceController) OneClickUnsubscribe(r *ghttp.Request) {
 	ipAddress := r.GetClientIp()
 	userAgent := r.Header.Get("User-Agent")
 
+	// The hosted unsubscribe page posts its form here too
+	if r.Get("source").String() == "page" {
+		all := r.Get("all").Bool()
+		err := c.complianceService.ConfirmUnsubscribe(r.Context(), token, r.Get("reason").String(), all, ipAddress, userAgent)
+		if err != nil {
+			renderHostedPage(r, http.StatusBadRequest, errorPage, &hostedPageView{Error: "This unsubscribe link is invalid."})
+			return
+		}
+		c.renderUnsubscribePage(r, token, unsubscribedPage, !all)
+		return
+	}
+
 	err := c.complianceService.ProcessOneClickUnsubscribe(r.Context(), token, ipAddress, userAgent)
 	if err != nil {
 		response.BadRequest(r, err.Error())
@@ -37,7 +53,8 @@ func (c *ComplianceController) OneClickUnsubscribe(r *ghttp.Request) {
 	response.SuccessWithMessage(r, "Successfully unsubscribed", nil)
 }
 
-// GetUnsubscribePage returns data for the unsubscribe landing page
+// GetUnsubscribePage returns data for the unsubscribe landing page, or the
+// hosted page to browsers
 // GET /api/v1/unsubscribe/:token
 func (c *ComplianceController) GetUnsubscribePage(r *ghttp.Request) {
 	token := r.Get("token").String()
@@ -46,6 +63,11 @@ func (c *ComplianceController) GetUnsubscribePage(r *ghttp.Request) {
 		return
 	}
 
+	if wantsHTML(r) {
+		c.renderUnsubscribePage(r, token, unsubscribePage, true)
+		return
+	}
+
 	data, err := c.complianceService.GetUnsubscribePage(r.Context(), token)
 	if err != nil {
 		response.BadRequest(r, err.Error())
@@ -66,13 +88,14 @@ func (c *ComplianceController) ConfirmUnsubscribe(r *ghttp.Request) {
 
 	var req struct {
 		Reason string `json:"reason"`
+		All    bool   `json:"all"` // Unsubscribe from everything, not only the email's topic
 	}
 	r.Parse(&req)
 
 	ipAddress := r.GetClientIp()
 	userAgent := r.Header.Get("User-Agent")
 
-	err := c.complianceService.ConfirmUnsubscribe(r.Context(), token, req.Reason, ipAddress, userAgent)
+	err := c.complianceService.ConfirmUnsubscribe(r.Context(), token, req.Reason, req.All, ipAddress, userAgent)
 	if err != nil {
 		response.BadRequest(r, err.Error())
 		return
@@ -81,7 +104,8 @@ func (c *ComplianceController) ConfirmUnsubscribe(r *ghttp.Request) {
 	response.SuccessWithMessage(r, "Successfully unsubscribed", nil)
 }
 
-// GetPreferences returns preference center data
+// GetPreferences returns preference center data, or the hosted preference
+// center to browsers
 // GET /api/v1/preferences/:token
 func (c *ComplianceController) GetPreferences(r *ghttp.Request) {
 	token := r.Get("token").String()
@@ -90,6 +114,11 @@ func (c *ComplianceController) GetPreferences(r *ghttp.Request) {
 		return
 	}
 
+	if wantsHTML(r) {
+		c.renderPreferencesPage(r, token, http.StatusOK, "", "")
+		return
+	}
+
 	data, err := c.complianceService.GetPreferenceCenter(r.Context(), token)
 	if err != nil {
 		response.BadRequest(r, err.Error())
@@ -109,17 +138,24 @@ func (c *ComplianceController) UpdatePreferences(r *ghttp.Request) {
 	}
 
 	var req struct {
-		ListIDs []int `json:"listIds"`
+		ListIDs  []int          `json:"listIds"`
+		TopicIDs *[]int         `json:"topicIds"` // Topics to keep getting; omit to leave topics unchanged
+		Profile  map[string]any `json:"profile"`  // Profile fields to change, by key
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
 	ipAddress := r.GetClientIp()
 	userAgent := r.Header.Get("User-Agent")
 
-	err := c.complianceService.UpdatePreferences(r.Context(), token, req.ListIDs, ipAddress, userAgent)
+	if err := c.complianceService.UpdateProfile(r.Context(), token, req.Profile, ipAddress, userAgent); err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	err := c.complianceService.UpdatePreferences(r.Context(), token, req.ListIDs, req.TopicIDs, ipAddress, userAgent)
 	if err != nil {
 		response.BadRequest(r, err.Error())
 		return
@@ -197,6 +233,92 @@ func (c *ComplianceController) DeleteContactData(r *ghttp.Request) {
 	response.SuccessWithMessage(r, "Contact data deleted", nil)
 }
 
+// ExportContactArchive downloads everything stored about a contact as a zip
+// archive (GDPR access and portability)
+// POST /api/v1/contacts/:uuid/gdpr-export
+func (c *ComplianceController) ExportContactArchive(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can export a contact's data")
+		return
+	}
+
+	contactUUID := r.Get("uuid").String()
+	archive, summary, err := c.complianceService.ExportContactArchive(r.Context(), claims.OrgID, contactUUID)
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	records := map[string]any{}
+	for kind, count := range summary.Records {
+		records[kind] = count
+	}
+	c.auditLogService.LogAsync(&service.AuditLogInput{
+		OrgID:       claims.OrgID,
+		UserID:      &claims.UserID,
+		Action:      service.AuditActionGDPRExport,
+		Resource:    "contact",
+		ResourceID:  contactUUID,
+		Description: "Exported the contact's personal data",
+		IPAddress:   r.GetClientIp(),
+		UserAgent:   r.UserAgent(),
+		NewValues:   records,
+	})
+
+	r.Response.Header().Set("Content-Type", "application/zip")
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"contact-%s-data.zip\"", contactUUID))
+	r.Response.Write(archive)
+}
+
+// EraseContactData anonymizes a contact and redacts the emails that name them
+// (GDPR erasure)
+// POST /api/v1/contacts/:uuid/gdpr-erase
+func (c *ComplianceController) EraseContactData(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can erase a contact's data")
+		return
+	}
+
+	contactUUID := r.Get("uuid").String()
+	result, err := c.complianceService.EraseContactData(r.Context(), claims.OrgID, contactUUID)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	c.auditLogService.LogAsync(&service.AuditLogInput{
+		OrgID:       claims.OrgID,
+		UserID:      &claims.UserID,
+		Action:      service.AuditActionGDPRErase,
+		Resource:    "contact",
+		ResourceID:  contactUUID,
+		Description: "Erased the contact's personal data",
+		IPAddress:   r.GetClientIp(),
+		UserAgent:   r.UserAgent(),
+		NewValues: map[string]any{
+			"listMemberships":     result.ListMemberships,
+			"emails":              result.Emails,
+			"campaignRecipients":  result.CampaignRecipients,
+			"transactionalEmails": result.TransactionalEmails,
+			"receivedEmails":      result.ReceivedEmails,
+		},
+	})
+
+	response.SuccessWithMessage(r, "Contact data erased", result)
+}
+
 // GetConsentAuditTrail retrieves consent audit trail for a contact
 // GET /api/v1/contacts/:uuid/consent-audit
 func (c *ComplianceController) GetConsentAuditTrail(r *ghttp.Request) {
@@ -1,6 +1,10 @@
 package controller
 
 import (
+	"errors"
+	"io"
+	"time"
+
 	"github.com/gogf/gf/v2/net/ghttp"
 
 	"github.com/dublyo/mailat/api/internal/middleware"
@@ -28,7 +32,7 @@ func (c *ComposeController) SendEmail(r *ghttp.Request) {
 
 	var req model.ComposeEmailRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -37,14 +41,71 @@ func (c *ComposeController) SendEmail(r *ghttp.Request) {
 		return
 	}
 
-	// Convert request to service model
+	email := composeEmailFromRequest(&req)
+
+	if req.SendAt != nil && *req.SendAt != "" {
+		sendAt, err := time.Parse(time.RFC3339, *req.SendAt)
+		if err != nil {
+			response.BadRequest(r, "sendAt must be an RFC3339 timestamp")
+			return
+		}
+		result, err := c.composeService.ScheduleEmail(r.Context(), claims.UserID, email, sendAt)
+		if err != nil {
+			failCompose(r, err)
+			return
+		}
+		response.SuccessWithMessage(r, "Email scheduled", result)
+		return
+	}
+
+	result, err := c.composeService.SendEmail(r.Context(), claims.UserID, email)
+	if err != nil {
+		var ruleErr *service.OutboundRuleError
+		if errors.As(err, &ruleErr) {
+			failCompose(r, err)
+			return
+		}
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	if result.Status == service.ComposeSendPending {
+		response.SuccessWithMessage(r, "Email will be sent; it can be undone until then", result)
+		return
+	}
+	response.SuccessWithMessage(r, "Email sent", result)
+}
+
+// failCompose answers a failed send, with what the outbound rules found when
+// they stopped it and which recipients are away
+func failCompose(r *ghttp.Request, err error) {
+	var ruleErr *service.OutboundRuleError
+	if errors.As(err, &ruleErr) {
+		data := map[string]any{
+			"outboundRules": ruleErr.Result,
+		}
+		if len(ruleErr.AwayRecipients) > 0 {
+			data["awayRecipients"] = ruleErr.AwayRecipients
+		}
+		response.FailWithData(r, err, data)
+		return
+	}
+	response.Fail(r, err)
+}
+
+// composeEmailFromRequest converts a compose request to the service model
+func composeEmailFromRequest(req *model.ComposeEmailRequest) *service.ComposeEmail {
 	email := &service.ComposeEmail{
-		IdentityID: req.IdentityID,
-		Subject:    req.Subject,
-		TextBody:   req.TextBody,
-		HTMLBody:   req.HTMLBody,
-		InReplyTo:  req.InReplyTo,
-		References: req.References,
+		IdentityID:  req.IdentityID,
+		Subject:     req.Subject,
+		TextBody:    req.TextBody,
+		HTMLBody:    req.HTMLBody,
+		InReplyTo:   req.InReplyTo,
+		References:  req.References,
+		NoSignature: req.NoSignature,
+		Confirmed:   req.Confirmed,
+		TrackOpens:  req.TrackOpens,
+		TrackClicks: req.TrackClicks,
 	}
 
 	// Convert addresses
@@ -72,14 +133,119 @@ func (c *ComposeController) SendEmail(r *ghttp.Request) {
 			CID:         att.CID,
 		})
 	}
+	return email
+}
 
-	result, err := c.composeService.SendEmail(r.Context(), claims.UserID, email)
+// ListScheduled returns the emails in the Scheduled folder, soonest first
+// GET /api/v1/compose/scheduled?identityId=
+func (c *ComposeController) ListScheduled(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	sends, err := c.composeService.ListScheduled(r.Context(), claims.UserID, r.Get("identityId").Int64())
 	if err != nil {
-		response.BadRequest(r, err.Error())
+		response.InternalError(r, err.Error())
 		return
 	}
 
-	response.SuccessWithMessage(r, "Email sent", result)
+	response.Success(r, sends)
+}
+
+// SuggestRecipients completes the address being typed in the composer from
+// the user's email history and the org's contacts
+// GET /api/v1/compose/recipients/suggest
+func (c *ComposeController) SuggestRecipients(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	suggestions, err := c.composeService.SuggestRecipients(r.Context(), claims.UserID, claims.OrgID, r.Get("q").String(), r.Get("limit").Int())
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, suggestions)
+}
+
+// UpdateScheduledSend edits a scheduled email and when it's sent
+// PUT /api/v1/compose/sends/:id
+func (c *ComposeController) UpdateScheduledSend(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.ComposeEmailRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	if len(req.To) == 0 {
+		response.BadRequest(r, "At least one recipient required")
+		return
+	}
+	if req.SendAt == nil || *req.SendAt == "" {
+		response.BadRequest(r, "sendAt is required")
+		return
+	}
+	sendAt, err := time.Parse(time.RFC3339, *req.SendAt)
+	if err != nil {
+		response.BadRequest(r, "sendAt must be an RFC3339 timestamp")
+		return
+	}
+
+	send, err := c.composeService.UpdateScheduledSend(r.Context(), claims.UserID, r.Get("id").String(), composeEmailFromRequest(&req), sendAt)
+	if err != nil {
+		failCompose(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Scheduled email updated", send)
+}
+
+// GetSend returns the status of an email held for undo send
+// GET /api/v1/compose/sends/:id
+func (c *ComposeController) GetSend(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	send, err := c.composeService.GetSend(r.Context(), claims.UserID, r.Get("id").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, send)
+}
+
+// CancelSend undoes sending an email held for undo send, returning the email
+// so it can be edited again
+// POST /api/v1/compose/sends/:id/cancel
+func (c *ComposeController) CancelSend(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	send, err := c.composeService.CancelSend(r.Context(), claims.UserID, r.Get("id").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Sending cancelled", send)
 }
 
 // SaveDraft saves an email as a draft
@@ -93,7 +259,7 @@ func (c *ComposeController) SaveDraft(r *ghttp.Request) {
 
 	var req model.SaveDraftRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -156,7 +322,7 @@ func (c *ComposeController) UpdateDraft(r *ghttp.Request) {
 
 	var req model.SaveDraftRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -305,21 +471,17 @@ func (c *ComposeController) UploadAttachment(r *ghttp.Request) {
 	}
 	defer f.Close()
 
-	data := make([]byte, file.Size)
-	_, err = f.Read(data)
+	// Read one byte past the limit so oversized files are rejected by the service
+	data, err := io.ReadAll(io.LimitReader(f, c.composeService.MaxAttachmentSize()+1))
 	if err != nil {
 		response.BadRequest(r, "Failed to read file data")
 		return
 	}
 
-	contentType := file.Header.Get("Content-Type")
-	if contentType == "" {
-		contentType = "application/octet-stream"
-	}
-
-	result, err := c.composeService.UploadAttachment(r.Context(), claims.UserID, identityID, data, file.Filename, contentType)
+	// The content type is checked against the content, and sniffed when missing
+	result, err := c.composeService.UploadAttachment(r.Context(), claims.UserID, identityID, data, file.Filename, file.Header.Get("Content-Type"))
 	if err != nil {
-		response.InternalError(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -28,13 +28,13 @@ func (c *ContactController) Create(r *ghttp.Request) {
 
 	var req model.CreateContactRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
 	contact, err := c.contactService.CreateContact(r.Context(), claims.OrgID, &req)
 	if err != nil {
-		response.BadRequest(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -76,7 +76,7 @@ func (c *ContactController) List(r *ghttp.Request) {
 
 	var req model.ContactSearchRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -106,13 +106,13 @@ func (c *ContactController) Update(r *ghttp.Request) {
 
 	var req model.UpdateContactRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
-	contact, err := c.contactService.UpdateContact(r.Context(), claims.OrgID, contactUUID, &req)
+	contact, err := c.contactService.UpdateContact(r.Context(), claims.OrgID, claims.UserID, contactUUID, &req)
 	if err != nil {
-		response.BadRequest(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -154,7 +154,7 @@ func (c *ContactController) Import(r *ghttp.Request) {
 
 	var req model.ImportContactsRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -163,7 +163,7 @@ func (c *ContactController) Import(r *ghttp.Request) {
 		return
 	}
 
-	result, err := c.contactService.ImportContacts(r.Context(), claims.OrgID, &req)
+	result, err := c.contactService.ImportContacts(r.Context(), claims.OrgID, claims.UserID, &req)
 	if err != nil {
 		response.InternalError(r, err.Error())
 		return
@@ -185,7 +185,7 @@ func (c *ContactController) Unsubscribe(r *ghttp.Request) {
 		Email string `json:"email" v:"required|email"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -198,26 +198,144 @@ func (c *ContactController) Unsubscribe(r *ghttp.Request) {
 	response.SuccessWithMessage(r, "Contact unsubscribed", nil)
 }
 
-// ExportContacts exports contacts as JSON
-// POST /api/v1/contacts/export
-func (c *ContactController) Export(r *ghttp.Request) {
+// GetEngagement returns a contact's engagement score and its history over the
+// last ?days= (a year by default)
+// GET /api/v1/contacts/:uuid/engagement
+func (c *ContactController) GetEngagement(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	result, err := c.contactService.GetContactEngagement(r.Context(), claims.OrgID, r.Get("uuid").String(), r.GetQuery("days", 0).Int())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// ListChanges returns a contact's most recent field and attribute changes,
+// optionally only those of ?field=, and those before the change ?before= to
+// page back through them
+// GET /api/v1/contacts/:uuid/changes
+func (c *ContactController) ListChanges(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	changes, err := c.contactService.ListContactChanges(r.Context(), claims.OrgID, r.Get("uuid").String(),
+		r.GetQuery("field").String(), r.GetQuery("before", 0).Int64(), r.GetQuery("limit", 100).Int())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, changes)
+}
+
+// ListFields returns the organization's custom contact fields, with the segment
+// operators each one takes
+// GET /api/v1/contact-fields
+func (c *ContactController) ListFields(r *ghttp.Request) {
 	claims := middleware.GetClaims(r)
 	if claims == nil {
 		response.Unauthorized(r, "Not authenticated")
 		return
 	}
 
-	var req model.ExportContactsRequest
+	fields, err := c.contactService.ListContactFields(r.Context(), claims.OrgID)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, fields)
+}
+
+// GetField returns a custom contact field
+// GET /api/v1/contact-fields/:uuid
+func (c *ContactController) GetField(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	field, err := c.contactService.GetContactField(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, field)
+}
+
+// CreateField defines a custom contact field
+// POST /api/v1/contact-fields
+func (c *ContactController) CreateField(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.CreateContactFieldRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
-	contacts, err := c.contactService.ExportContacts(r.Context(), claims.OrgID, &req)
+	field, err := c.contactService.CreateContactField(r.Context(), claims.OrgID, &req)
 	if err != nil {
-		response.InternalError(r, err.Error())
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Contact field created", field)
+}
+
+// UpdateField updates a custom contact field
+// PUT /api/v1/contact-fields/:uuid
+func (c *ContactController) UpdateField(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.UpdateContactFieldRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	field, err := c.contactService.UpdateContactField(r.Context(), claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Contact field updated", field)
+}
+
+// DeleteField deletes a custom contact field
+// DELETE /api/v1/contact-fields/:uuid
+func (c *ContactController) DeleteField(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if err := c.contactService.DeleteContactField(r.Context(), claims.OrgID, r.Get("uuid").String()); err != nil {
+		response.Fail(r, err)
 		return
 	}
 
-	response.Success(r, contacts)
+	response.SuccessWithMessage(r, "Contact field deleted", nil)
 }
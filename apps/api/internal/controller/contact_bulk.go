@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/contactbulk"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type ContactBulkController struct {
+	bulkService     *service.ContactBulkService
+	auditLogService *service.AuditLogService
+}
+
+func NewContactBulkController(bulkService *service.ContactBulkService, auditLogService *service.AuditLogService) *ContactBulkController {
+	return &ContactBulkController{bulkService: bulkService, auditLogService: auditLogService}
+}
+
+// Create starts a bulk operation on every contact of a segment or filter
+// POST /api/v1/contacts/bulk
+func (c *ContactBulkController) Create(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.BulkContactRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	if req.Operation == contactbulk.OpDelete && claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can delete contacts in bulk")
+		return
+	}
+
+	job, err := c.bulkService.Create(r.Context(), claims.OrgID, claims.UserID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	c.auditLogService.LogAsync(&service.AuditLogInput{
+		OrgID:       claims.OrgID,
+		UserID:      &claims.UserID,
+		Action:      service.AuditActionContactBulk,
+		Resource:    "contact_bulk_job",
+		ResourceID:  job.ID,
+		Description: fmt.Sprintf("Started bulk %s of %d contacts", job.Operation, job.Total),
+		IPAddress:   r.GetClientIp(),
+		UserAgent:   r.UserAgent(),
+		NewValues: map[string]any{
+			"operation": req.Operation,
+			"target":    req.Target,
+			"total":     job.Total,
+		},
+	})
+
+	response.Created(r, job)
+}
+
+// List returns the organization's contact bulk jobs
+// GET /api/v1/contacts/bulk/jobs
+func (c *ContactBulkController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	jobs, err := c.bulkService.List(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, jobs)
+}
+
+// Get returns a contact bulk job and its progress
+// GET /api/v1/contacts/bulk/jobs/:uuid
+func (c *ContactBulkController) Get(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	job, err := c.bulkService.Get(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, job)
+}
+
+// Cancel stops a contact bulk job after its current batch
+// POST /api/v1/contacts/bulk/jobs/:uuid/cancel
+func (c *ContactBulkController) Cancel(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	job, err := c.bulkService.Cancel(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Bulk job cancelled", job)
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type ContactEventController struct {
+	eventService *service.ContactEventService
+}
+
+func NewContactEventController(eventService *service.ContactEventService) *ContactEventController {
+	return &ContactEventController{eventService: eventService}
+}
+
+// Track records a custom event, like a purchase or a login, against a contact
+// POST /api/v1/events
+func (c *ContactEventController) Track(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.TrackContactEventRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	event, err := c.eventService.Track(r.Context(), claims.OrgID, claims.APIKeyID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, event)
+}
+
+// List returns a contact's most recent custom events, optionally only those
+// named ?event=
+// GET /api/v1/contacts/:uuid/events
+func (c *ContactEventController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	events, err := c.eventService.ListForContact(r.Context(), claims.OrgID, r.Get("uuid").String(),
+		r.GetQuery("event").String(), r.GetQuery("limit", 100).Int())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, events)
+}
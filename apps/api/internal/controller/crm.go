@@ -0,0 +1,191 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type CRMController struct {
+	crmService *service.CRMService
+	cfg        *config.Config
+}
+
+func NewCRMController(crmService *service.CRMService, cfg *config.Config) *CRMController {
+	return &CRMController{crmService: crmService, cfg: cfg}
+}
+
+// List returns the organization's CRM connections
+// GET /api/v1/crm/connections
+func (c *CRMController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	connections, err := c.crmService.ListConnections(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, connections)
+}
+
+// Connect returns the URL that authorizes a CRM account for the organization
+// POST /api/v1/crm/:provider/connect
+func (c *CRMController) Connect(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can connect a CRM")
+		return
+	}
+
+	result, err := c.crmService.Connect(r.Context(), claims.OrgID, claims.UserID, r.Get("provider").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// Callback stores the CRM account the user authorized and sends them back to
+// the app's integration settings
+// GET /api/v1/crm/:provider/callback
+func (c *CRMController) Callback(r *ghttp.Request) {
+	provider := r.Get("provider").String()
+	redirect := fmt.Sprintf("%s/settings/integrations?crm=%s", c.cfg.WebUrl, url.QueryEscape(provider))
+
+	if errorParam := r.Get("error").String(); errorParam != "" {
+		r.Response.RedirectTo(redirect + "&error=" + url.QueryEscape(errorParam))
+		return
+	}
+	if r.Get("code").String() == "" {
+		r.Response.RedirectTo(redirect + "&error=" + url.QueryEscape("Authorization code not provided"))
+		return
+	}
+
+	if _, err := c.crmService.CompleteConnect(r.Context(), provider, r.Get("code").String(), r.Get("state").String()); err != nil {
+		r.Response.RedirectTo(redirect + "&error=" + url.QueryEscape(err.Error()))
+		return
+	}
+
+	r.Response.RedirectTo(redirect + "&connected=true")
+}
+
+// Get returns a CRM connection
+// GET /api/v1/crm/connections/:uuid
+func (c *CRMController) Get(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	connection, err := c.crmService.GetConnection(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, connection)
+}
+
+// Update changes a CRM connection's field mappings or whether it pushes and
+// pulls
+// PUT /api/v1/crm/connections/:uuid
+func (c *CRMController) Update(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change CRM sync")
+		return
+	}
+
+	var req model.UpdateCRMConnectionRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	connection, err := c.crmService.UpdateConnection(r.Context(), claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "CRM connection updated", connection)
+}
+
+// Delete disconnects a CRM account
+// DELETE /api/v1/crm/connections/:uuid
+func (c *CRMController) Delete(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can disconnect a CRM")
+		return
+	}
+
+	if err := c.crmService.DeleteConnection(r.Context(), claims.OrgID, r.Get("uuid").String()); err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "CRM disconnected", nil)
+}
+
+// Sync queues a sync of a CRM connection
+// POST /api/v1/crm/connections/:uuid/sync
+func (c *CRMController) Sync(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	run, err := c.crmService.Sync(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "CRM sync queued", run)
+}
+
+// ListRuns returns a CRM connection's most recent sync runs
+// GET /api/v1/crm/connections/:uuid/runs
+func (c *CRMController) ListRuns(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	runs, err := c.crmService.ListRuns(r.Context(), claims.OrgID, r.Get("uuid").String(), r.GetQuery("limit", 20).Int())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, runs)
+}
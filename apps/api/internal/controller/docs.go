@@ -0,0 +1,356 @@
+package controller
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+)
+
+// DocsController serves machine-readable API documentation generated from the live route table
+type DocsController struct {
+	server   *ghttp.Server
+	cfg      *config.Config
+	examples map[string]any
+}
+
+// NewDocsController creates a new docs controller
+func NewDocsController(server *ghttp.Server, cfg *config.Config) *DocsController {
+	return &DocsController{
+		server:   server,
+		cfg:      cfg,
+		examples: requestExamples(),
+	}
+}
+
+// requestExamples maps "METHOD /route" to the request DTO used by that endpoint.
+// Bodies are generated from the DTO's JSON tags so they stay in sync with the models.
+func requestExamples() map[string]any {
+	return map[string]any{
+		"POST /api/v1/auth/register":                   model.RegisterRequest{},
+		"POST /api/v1/auth/login":                      model.LoginRequest{},
+		"PUT /api/v1/settings":                         service.UpdateSettingsRequest{},
+		"PUT /api/v1/settings/address-normalization":   service.UpdateAddressNormalizationRequest{},
+		"PUT /api/v1/settings/retention":               service.UpdateRetentionPolicyRequest{},
+		"PUT /api/v1/settings/sender-rotation":         service.UpdateSenderRotationRequest{},
+		"PUT /api/v1/settings/content-guard":           service.UpdateContentGuardRequest{},
+		"PUT /api/v1/settings/backups":                 service.UpdateBackupPolicyRequest{},
+		"PUT /api/v1/settings/list-hygiene":            service.UpdateListHygieneRequest{},
+		"PUT /api/v1/settings/sending-window":          service.UpdateSendingWindowRequest{},
+		"PUT /api/v1/settings/campaign-send-rate":      service.UpdateCampaignSendRateRequest{},
+		"PUT /api/v1/settings/domain-warmup":           service.UpdateDomainWarmupRequest{},
+		"PUT /api/v1/settings/campaign-utm":            service.UpdateCampaignUTMRequest{},
+		"PUT /api/v1/settings/inbox-preview":           service.UpdateInboxPreviewRequest{},
+		"PUT /api/v1/settings/event-export":            service.UpdateEventExportBucketRequest{},
+		"PUT /api/v1/settings/mail-assist":             service.UpdateMailAssistRequest{},
+		"PUT /api/v1/settings/test-recipients":         service.UpdateTestRecipientsRequest{},
+		"PUT /api/v1/settings/preference-center":       service.UpdatePreferenceCenterRequest{},
+		"PUT /api/v1/settings/automation-limits":       service.UpdateAutomationLimitsRequest{},
+		"POST /api/v1/backups/:uuid/restore":           model.RestoreBackupRequest{},
+		"POST /api/v1/exports/events":                  model.CreateEventExportRequest{},
+		"POST /api/v1/suppressions/check":              model.SuppressionCheckRequest{},
+		"POST /api/v1/auth/change-password":            service.ChangePasswordRequest{},
+		"POST /api/v1/api-keys":                        model.CreateApiKeyRequest{},
+		"PUT /api/v1/api-keys/:uuid/scope":             model.UpdateApiKeyScopeRequest{},
+		"POST /api/v1/domains":                         model.CreateDomainRequest{},
+		"POST /api/v1/identities":                      model.CreateIdentityRequest{},
+		"POST /api/v1/inbox/mark-read":                 model.MarkReadRequest{},
+		"POST /api/v1/inbox/toggle-flag":               model.FlagEmailRequest{},
+		"POST /api/v1/inbox/move":                      model.MoveEmailRequest{},
+		"POST /api/v1/inbox/delete":                    model.DeleteEmailRequest{},
+		"POST /api/v1/inbox/received/mark":             model.MarkEmailsRequest{},
+		"POST /api/v1/inbox/received/star":             model.StarEmailsRequest{},
+		"POST /api/v1/inbox/received/move":             model.MoveEmailsRequest{},
+		"POST /api/v1/inbox/received/trash":            model.TrashEmailsRequest{},
+		"POST /api/v1/inbox/emails/:uuid/summarize":    model.SummarizeEmailRequest{},
+		"POST /api/v1/inbox/emails/:uuid/translate":    model.TranslateEmailRequest{},
+		"POST /api/v1/inbox/setup":                     model.SetupReceivingRequest{},
+		"POST /api/v1/compose/send":                    model.ComposeEmailRequest{},
+		"POST /api/v1/compose/drafts":                  model.SaveDraftRequest{},
+		"PUT /api/v1/compose/drafts/:id":               model.SaveDraftRequest{},
+		"POST /api/v1/emails":                          model.SendEmailRequest{},
+		"POST /api/v1/emails/batch":                    model.BatchSendRequest{},
+		"POST /api/v1/emails/:id/reject":               model.RejectEmailRequest{},
+		"POST /api/v1/templates":                       model.CreateTemplateRequest{},
+		"PUT /api/v1/templates/:uuid":                  model.UpdateTemplateRequest{},
+		"POST /api/v1/templates/:uuid/preview":         model.PreviewTemplateRequest{},
+		"POST /api/v1/templates/render-design":         model.RenderDesignRequest{},
+		"POST /api/v1/templates/export":                model.ExportTemplatesRequest{},
+		"POST /api/v1/templates/import":                model.ImportTemplatesRequest{},
+		"POST /api/v1/templates/:uuid/test-send":       model.TestSendTemplateRequest{},
+		"POST /api/v1/template-partials":               model.CreateTemplatePartialRequest{},
+		"POST /api/v1/contact-fields":                  model.CreateContactFieldRequest{},
+		"PUT /api/v1/contact-fields/:uuid":             model.UpdateContactFieldRequest{},
+		"PUT /api/v1/template-partials/:uuid":          model.UpdateTemplatePartialRequest{},
+		"POST /api/v1/webhooks":                        model.CreateWebhookRequest{},
+		"PUT /api/v1/webhooks/:uuid":                   model.UpdateWebhookRequest{},
+		"POST /api/v1/contacts":                        model.CreateContactRequest{},
+		"PUT /api/v1/contacts/:uuid":                   model.UpdateContactRequest{},
+		"POST /api/v1/contacts/import":                 model.ImportContactsRequest{},
+		"POST /api/v1/contacts/export":                 model.ExportContactsRequest{},
+		"POST /api/v1/exports/contacts":                model.ExportContactsRequest{},
+		"POST /api/v1/contacts/bulk":                   model.BulkContactRequest{},
+		"POST /api/v1/events":                          model.TrackContactEventRequest{},
+		"POST /api/v1/forms":                           model.CreateSignupFormRequest{},
+		"PUT /api/v1/forms/:uuid":                      model.UpdateSignupFormRequest{},
+		"POST /api/v1/topics":                          model.CreateSubscriptionTopicRequest{},
+		"PUT /api/v1/topics/:uuid":                     model.UpdateSubscriptionTopicRequest{},
+		"PUT /api/v1/contacts/:uuid/topics":            model.UpdateContactTopicsRequest{},
+		"PUT /api/v1/crm/connections/:uuid":            model.UpdateCRMConnectionRequest{},
+		"POST /api/v1/lists":                           model.CreateListRequest{},
+		"POST /api/v1/lists/segment-preview":           model.PreviewSegmentRequest{},
+		"PUT /api/v1/lists/:uuid":                      model.UpdateListRequest{},
+		"POST /api/v1/lists/:uuid/contacts":            model.AddContactsToListRequest{},
+		"DELETE /api/v1/lists/:uuid/contacts":          model.RemoveContactsFromListRequest{},
+		"POST /api/v1/lists/:uuid/contacts/import":     model.ImportContactsToListRequest{},
+		"POST /api/v1/lists/:uuid/contacts/manual":     model.ManualAddContactToListRequest{},
+		"POST /api/v1/campaigns":                       model.CreateCampaignRequest{},
+		"PUT /api/v1/campaigns/:uuid":                  model.UpdateCampaignRequest{},
+		"POST /api/v1/campaigns/:uuid/schedule":        model.ScheduleCampaignRequest{},
+		"POST /api/v1/campaigns/:uuid/previews":        model.RenderCampaignPreviewsRequest{},
+		"POST /api/v1/campaigns/:uuid/conversions":     model.RecordConversionRequest{},
+		"POST /api/v1/campaigns/:uuid/resend":          model.ResendCampaignRequest{},
+		"POST /api/v1/campaigns/:uuid/resend-unopened": model.ResendUnopenedRequest{},
+		"POST /api/v1/campaigns/:uuid/duplicate":       model.DuplicateCampaignRequest{},
+		"POST /api/v1/campaigns/:uuid/preview":         model.CampaignPreviewRequest{},
+		"POST /api/v1/campaigns/:uuid/lint":            model.CampaignLintRequest{},
+		"POST /api/v1/campaigns/:uuid/test":            model.CampaignTestSendRequest{},
+		"POST /api/v1/automations":                     model.CreateAutomationRequest{},
+		"PUT /api/v1/automations/:uuid":                model.UpdateAutomationRequest{},
+		"POST /api/v1/automations/:uuid/simulate":      model.SimulateAutomationRequest{},
+		"POST /api/v1/automations/:uuid/enroll":        model.EnrollContactsRequest{},
+		"DELETE /api/v1/automations/:uuid/enroll":      model.EnrollContactsRequest{},
+		"POST /api/v1/automations/:uuid/failed/retry":  model.RetryEnrollmentsRequest{},
+	}
+}
+
+// PostmanCollection returns a Postman v2.1 collection (also importable by Insomnia)
+// generated from the registered routes
+// GET /docs/postman.json
+func (c *DocsController) PostmanCollection(r *ghttp.Request) {
+	baseURL := c.cfg.APIUrl
+	if baseURL == "" {
+		baseURL = "http://localhost:3001"
+	}
+
+	folders := map[string][]map[string]any{}
+	for _, route := range c.server.GetRoutes() {
+		if route.Type != ghttp.HandlerTypeHandler || route.Method == "ALL" {
+			continue
+		}
+		if !strings.HasPrefix(route.Route, "/api/v1/") {
+			continue
+		}
+
+		folder := routeFolder(route.Route)
+		folders[folder] = append(folders[folder], c.postmanItem(route))
+	}
+
+	names := make([]string, 0, len(folders))
+	for name := range folders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]map[string]any, 0, len(names))
+	for _, name := range names {
+		requests := folders[name]
+		sort.Slice(requests, func(i, j int) bool {
+			return requests[i]["name"].(string) < requests[j]["name"].(string)
+		})
+		items = append(items, map[string]any{
+			"name": name,
+			"item": requests,
+		})
+	}
+
+	appName := c.cfg.AppName
+	if appName == "" {
+		appName = "Mailat"
+	}
+
+	r.Response.Header().Set("Access-Control-Allow-Origin", "*")
+	r.Response.WriteJson(map[string]any{
+		"info": map[string]any{
+			"name":        appName + " API",
+			"description": "Generated from the live route table. Set the apiKey variable to an API key (ue_...) or a JWT.",
+			"schema":      "https://schema.getpostman.com/json/collection/v2.1.0/collection.json",
+		},
+		"auth": map[string]any{
+			"type": "bearer",
+			"bearer": []map[string]string{
+				{"key": "token", "value": "{{apiKey}}", "type": "string"},
+			},
+		},
+		"variable": []map[string]string{
+			{"key": "baseUrl", "value": strings.TrimRight(baseURL, "/"), "type": "string"},
+			{"key": "apiKey", "value": "", "type": "string"},
+		},
+		"item": items,
+	})
+}
+
+// postmanItem builds a single Postman request item for a route
+func (c *DocsController) postmanItem(route ghttp.RouterItem) map[string]any {
+	pathSegments := []string{}
+	variables := []map[string]string{}
+	for _, segment := range strings.Split(strings.Trim(route.Route, "/"), "/") {
+		if strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "{") {
+			name := strings.Trim(segment, ":{}")
+			variables = append(variables, map[string]string{"key": name, "value": ""})
+			segment = ":" + name
+		}
+		pathSegments = append(pathSegments, segment)
+	}
+
+	raw := "{{baseUrl}}/" + strings.Join(pathSegments, "/")
+	request := map[string]any{
+		"method": route.Method,
+		"header": []map[string]string{
+			{"key": "Content-Type", "value": "application/json"},
+		},
+		"url": map[string]any{
+			"raw":      raw,
+			"host":     []string{"{{baseUrl}}"},
+			"path":     pathSegments,
+			"variable": variables,
+		},
+	}
+
+	if !strings.Contains(route.Middleware, "middleware.Auth") {
+		request["auth"] = map[string]string{"type": "noauth"}
+	}
+
+	if example, ok := c.examples[route.Method+" "+route.Route]; ok {
+		request["body"] = map[string]any{
+			"mode":    "raw",
+			"raw":     prettyJSON(exampleValue(reflect.TypeOf(example), "", 0)),
+			"options": map[string]any{"raw": map[string]string{"language": "json"}},
+		}
+	}
+
+	return map[string]any{
+		"name":    handlerDisplayName(route),
+		"request": request,
+	}
+}
+
+// routeFolder groups a route under its first path segment after /api/v1
+func routeFolder(route string) string {
+	parts := strings.Split(strings.TrimPrefix(route, "/api/v1/"), "/")
+	if len(parts) == 0 || parts[0] == "" || strings.HasPrefix(parts[0], ":") {
+		return "General"
+	}
+	folder := strings.ReplaceAll(parts[0], "-", " ")
+	return strings.ToUpper(folder[:1]) + folder[1:]
+}
+
+var handlerNamePattern = regexp.MustCompile(`\)\.([A-Za-z0-9_]+)(-fm)?$`)
+
+// handlerDisplayName derives a readable request name from the handler func name
+func handlerDisplayName(route ghttp.RouterItem) string {
+	if route.Handler != nil {
+		if m := handlerNamePattern.FindStringSubmatch(route.Handler.Name); len(m) > 1 {
+			var words []string
+			start := 0
+			name := m[1]
+			for i, ch := range name {
+				if i > 0 && unicode.IsUpper(ch) && !unicode.IsUpper(rune(name[i-1])) {
+					words = append(words, name[start:i])
+					start = i
+				}
+			}
+			words = append(words, name[start:])
+			return strings.Join(words, " ")
+		}
+	}
+	return route.Method + " " + route.Route
+}
+
+// exampleValue builds an example value for a type from its JSON tags
+func exampleValue(t reflect.Type, fieldName string, depth int) any {
+	if depth > 4 {
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return time.Now().UTC().Add(time.Hour).Truncate(time.Minute).Format(time.RFC3339)
+	}
+
+	lower := strings.ToLower(fieldName)
+	switch t.Kind() {
+	case reflect.String:
+		switch {
+		case strings.Contains(lower, "email") || lower == "from" || lower == "to" || lower == "cc" || lower == "bcc" || lower == "replyto":
+			return "user@example.com"
+		case strings.Contains(lower, "url"):
+			return "https://example.com/webhook"
+		case strings.Contains(lower, "password"):
+			return "change-me-please"
+		case strings.HasSuffix(lower, "uuid") || strings.HasSuffix(lower, "id"):
+			return "00000000-0000-0000-0000-000000000000"
+		case strings.Contains(lower, "scheduled") || strings.HasSuffix(lower, "at"):
+			return time.Now().UTC().Add(time.Hour).Truncate(time.Minute).Format(time.RFC3339)
+		case strings.Contains(lower, "html"):
+			return "<p>Hello {{name}}</p>"
+		case strings.Contains(lower, "subject"):
+			return "Hello {{name}}"
+		}
+		return "string"
+	case reflect.Bool:
+		return false
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return 0
+	case reflect.Float32, reflect.Float64:
+		return 0.0
+	case reflect.Slice, reflect.Array:
+		singular := strings.TrimSuffix(fieldName, "s")
+		return []any{exampleValue(t.Elem(), singular, depth+1)}
+	case reflect.Map:
+		if t.Key().Kind() == reflect.String {
+			return map[string]any{"key": exampleValue(t.Elem(), "", depth+1)}
+		}
+		return map[string]any{}
+	case reflect.Interface:
+		return "value"
+	case reflect.Struct:
+		result := map[string]any{}
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			if !field.IsExported() {
+				continue
+			}
+			name := strings.Split(field.Tag.Get("json"), ",")[0]
+			if name == "-" {
+				continue
+			}
+			if name == "" {
+				name = field.Name
+			}
+			result[name] = exampleValue(field.Type, name, depth+1)
+		}
+		return result
+	}
+	return nil
+}
+
+// prettyJSON renders an example body with indentation for the request editor
+func prettyJSON(v any) string {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return "{}"
+	}
+	return string(data)
+}
@@ -28,7 +28,7 @@ func (c *DomainController) Create(r *ghttp.Request) {
 
 	var req model.CreateDomainRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -277,7 +277,7 @@ func (c *DomainController) AddDNSToCloudflare(r *ghttp.Request) {
 		ZoneID   string `json:"zoneId"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -317,7 +317,7 @@ func (c *DomainController) GetCloudflareZones(r *ghttp.Request) {
 		APIToken string `json:"apiToken"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -37,7 +37,7 @@ func (c *EmailRulesController) CreateRule(r *ghttp.Request) {
 
 	var req service.CreateEmailRuleInput
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -111,7 +111,7 @@ func (c *EmailRulesController) UpdateRule(r *ghttp.Request) {
 
 	var req service.UpdateEmailRuleInput
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -160,7 +160,7 @@ func (c *EmailRulesController) ReorderRules(r *ghttp.Request) {
 		RuleIDs []int `json:"ruleIds"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -189,7 +189,7 @@ func (c *EmailRulesController) TestRule(r *ghttp.Request) {
 
 	var req service.EmailForTestInput
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -220,7 +220,7 @@ func (c *EmailRulesController) CreateAutoReply(r *ghttp.Request) {
 
 	var req service.CreateAutoReplyInput
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -292,7 +292,7 @@ func (c *EmailRulesController) UpdateAutoReply(r *ghttp.Request) {
 
 	var req service.UpdateAutoReplyInput
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -343,7 +343,7 @@ func (c *EmailRulesController) CreateEmailForward(r *ghttp.Request) {
 
 	var req service.CreateEmailForwardInput
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -369,7 +369,7 @@ func (c *EmailRulesController) VerifyEmailForward(r *ghttp.Request) {
 		Token string `json:"token"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -0,0 +1,214 @@
+package controller
+
+import (
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type ExportController struct {
+	exportService *service.ExportService
+}
+
+func NewExportController(exportService *service.ExportService) *ExportController {
+	return &ExportController{exportService: exportService}
+}
+
+// ListEventExports returns the organization's delivery event exports
+// GET /api/v1/exports/events
+func (c *ExportController) ListEventExports(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	exports, err := c.exportService.List(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, exports)
+}
+
+// GetEventExport returns a delivery event export, with a download URL once it is ready
+// GET /api/v1/exports/events/:uuid
+func (c *ExportController) GetEventExport(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	export, err := c.exportService.Get(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, export)
+}
+
+// CreateEventExport queues an export of delivery events for a date range
+// POST /api/v1/exports/events
+func (c *ExportController) CreateEventExport(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can export delivery events")
+		return
+	}
+
+	var req model.CreateEventExportRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	export, err := c.exportService.CreateEventExport(r.Context(), claims.OrgID, claims.UserID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, export)
+}
+
+// ListContactExports returns the organization's contact exports
+// GET /api/v1/exports/contacts
+func (c *ExportController) ListContactExports(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	exports, err := c.exportService.ListContactExports(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, exports)
+}
+
+// GetContactExport returns a contact export, with a download URL once it is ready
+// GET /api/v1/exports/contacts/:uuid
+func (c *ExportController) GetContactExport(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	export, err := c.exportService.GetContactExport(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, export)
+}
+
+// CreateContactExport queues a CSV or JSON export of the contacts matching
+// lists, statuses and segment rules
+// POST /api/v1/exports/contacts
+func (c *ExportController) CreateContactExport(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can export contacts")
+		return
+	}
+
+	var req model.ExportContactsRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	export, err := c.exportService.CreateContactExport(r.Context(), claims.OrgID, claims.UserID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, export)
+}
+
+// ListMailboxExports returns the mailbox exports the user requested, or the
+// organization's for admins
+// GET /api/v1/exports/mailboxes
+func (c *ExportController) ListMailboxExports(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	isAdmin := claims.Role == "admin" || claims.Role == "owner"
+	exports, err := c.exportService.ListMailboxExports(r.Context(), claims.OrgID, claims.UserID, isAdmin)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, exports)
+}
+
+// GetMailboxExport returns a mailbox export, with a download URL once it is ready
+// GET /api/v1/exports/mailboxes/:uuid
+func (c *ExportController) GetMailboxExport(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	isAdmin := claims.Role == "admin" || claims.Role == "owner"
+	export, err := c.exportService.GetMailboxExport(r.Context(), claims.OrgID, claims.UserID, isAdmin, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, export)
+}
+
+// CreateMailboxExport queues an export of an identity's emails as MBOX or a
+// zip of EML files. Admins can export any identity of the organization.
+// POST /api/v1/exports/mailboxes
+func (c *ExportController) CreateMailboxExport(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.CreateMailboxExportRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	isAdmin := claims.Role == "admin" || claims.Role == "owner"
+	export, err := c.exportService.CreateMailboxExport(r.Context(), claims.OrgID, claims.UserID, isAdmin, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, export)
+}
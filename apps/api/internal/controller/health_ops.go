@@ -118,7 +118,7 @@ func (c *HealthOpsController) StartWarmup(r *ghttp.Request) {
 		ScheduleName string `json:"scheduleName" d:"conservative"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -173,6 +173,24 @@ func (c *HealthOpsController) GetQuotaStatus(r *ghttp.Request) {
 	response.Success(r, status)
 }
 
+// GetQueueStatus returns worker queue sizes and task failures by class
+// GET /api/v1/health/queues
+func (c *HealthOpsController) GetQueueStatus(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	status, err := c.healthService.GetQueueStatus(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, status)
+}
+
 // GetAlerts returns system alerts
 // GET /api/v1/health/alerts
 func (c *HealthOpsController) GetAlerts(r *ghttp.Request) {
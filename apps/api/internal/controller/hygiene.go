@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type HygieneController struct {
+	hygieneService *service.HygieneService
+}
+
+func NewHygieneController(hygieneService *service.HygieneService) *HygieneController {
+	return &HygieneController{hygieneService: hygieneService}
+}
+
+// List returns the organization's list hygiene runs
+// GET /api/v1/hygiene/runs
+func (c *HygieneController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	runs, err := c.hygieneService.List(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, runs)
+}
+
+// Get returns a list hygiene run's report
+// GET /api/v1/hygiene/runs/:uuid
+func (c *HygieneController) Get(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	run, err := c.hygieneService.Get(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, run)
+}
+
+// Start queues a re-verification of the organization's stale contacts
+// POST /api/v1/hygiene/runs
+func (c *HygieneController) Start(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can start list hygiene runs")
+		return
+	}
+
+	run, err := c.hygieneService.Start(r.Context(), claims.OrgID)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, run)
+}
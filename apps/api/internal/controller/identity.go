@@ -3,6 +3,8 @@ package controller
 import (
 	"encoding/json"
 	"fmt"
+	"net"
+	"strings"
 
 	"github.com/gogf/gf/v2/net/ghttp"
 
@@ -128,7 +130,7 @@ func (c *IdentityController) UpdatePassword(r *ghttp.Request) {
 		Password string `json:"password" v:"required|min-length:8"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -164,3 +166,172 @@ func (c *IdentityController) Delete(r *ghttp.Request) {
 
 	response.SuccessWithMessage(r, "Identity deleted", nil)
 }
+
+// ListAppPasswords returns an identity's app passwords, without the passwords
+// GET /api/v1/identities/:uuid/app-passwords
+func (c *IdentityController) ListAppPasswords(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	passwords, err := c.identityService.ListAppPasswords(r.Context(), claims.UserID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, passwords)
+}
+
+// CreateAppPassword generates an app password for a mail app on a device;
+// the password is only shown in this response
+// POST /api/v1/identities/:uuid/app-passwords
+func (c *IdentityController) CreateAppPassword(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.CreateAppPasswordRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	password, err := c.identityService.CreateAppPassword(r.Context(), claims.UserID, r.Get("uuid").String(), req.Name)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, password)
+}
+
+// RevokeAppPassword stops a device signing in with its app password
+// DELETE /api/v1/identities/:uuid/app-passwords/:passwordUuid
+func (c *IdentityController) RevokeAppPassword(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	err := c.identityService.RevokeAppPassword(r.Context(), claims.UserID, r.Get("uuid").String(), r.Get("passwordUuid").String())
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "App password revoked", nil)
+}
+
+// GetSignature returns an identity's signature
+// GET /api/v1/identities/:uuid/signature
+func (c *IdentityController) GetSignature(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	sig, err := c.identityService.GetSignature(r.Context(), claims.UserID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, sig)
+}
+
+// UpdateSignature sets an identity's signature and where it goes in replies
+// PUT /api/v1/identities/:uuid/signature
+func (c *IdentityController) UpdateSignature(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.UpdateSignatureRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	sig, err := c.identityService.UpdateSignature(r.Context(), claims.UserID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Signature updated", sig)
+}
+
+// DeleteSignature removes an identity's signature
+// DELETE /api/v1/identities/:uuid/signature
+func (c *IdentityController) DeleteSignature(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if err := c.identityService.DeleteSignature(r.Context(), claims.UserID, r.Get("uuid").String()); err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Signature deleted", nil)
+}
+
+// MailSettings returns the IMAP and SMTP settings to add an identity to a
+// mail app with
+// GET /api/v1/identities/:uuid/mail-settings
+func (c *IdentityController) MailSettings(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	settings, err := c.identityService.MailSettings(r.Context(), claims.UserID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, settings)
+}
+
+// Autoconfig serves the autoconfig document mail apps such as Thunderbird
+// fetch when an address on a hosted domain is added
+// GET /mail/config-v1.1.xml?emailaddress=
+// GET /.well-known/autoconfig/mail/config-v1.1.xml?emailaddress=
+// Without an address, the domain is the host asked, less "autoconfig."
+func (c *IdentityController) Autoconfig(r *ghttp.Request) {
+	domain := r.Host
+	if email := r.Get("emailaddress").String(); email != "" {
+		_, domain, _ = strings.Cut(email, "@")
+	} else {
+		if host, _, err := net.SplitHostPort(domain); err == nil {
+			domain = host
+		}
+		domain = strings.TrimPrefix(domain, "autoconfig.")
+	}
+	if domain == "" {
+		response.BadRequest(r, "emailaddress is required")
+		return
+	}
+
+	doc, err := c.identityService.MailAutoconfig(r.Context(), domain)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	r.Response.Header().Set("Content-Type", "application/xml; charset=utf-8")
+	r.Response.Write(doc)
+}
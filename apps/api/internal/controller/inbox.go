@@ -46,14 +46,11 @@ func (c *InboxController) GetInbox(r *ghttp.Request) {
 
 	var req model.UnifiedInboxRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
 	// Set defaults
-	if req.Page <= 0 {
-		req.Page = 1
-	}
 	if req.PageSize <= 0 {
 		req.PageSize = 50
 	}
@@ -63,7 +60,7 @@ func (c *InboxController) GetInbox(r *ghttp.Request) {
 
 	inbox, err := c.inboxService.GetUnifiedInbox(r.Context(), claims.UserID, &req)
 	if err != nil {
-		response.InternalError(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -129,7 +126,7 @@ func (c *InboxController) MarkRead(r *ghttp.Request) {
 
 	var req model.MarkReadRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -158,7 +155,7 @@ func (c *InboxController) ToggleFlag(r *ghttp.Request) {
 
 	var req model.FlagEmailRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -187,7 +184,7 @@ func (c *InboxController) MoveEmails(r *ghttp.Request) {
 
 	var req model.MoveEmailRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -216,7 +213,7 @@ func (c *InboxController) DeleteEmails(r *ghttp.Request) {
 
 	var req model.DeleteEmailRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -249,10 +246,6 @@ func (c *InboxController) Search(r *ghttp.Request) {
 		return
 	}
 
-	page := r.Get("page").Int()
-	if page <= 0 {
-		page = 1
-	}
 	pageSize := r.Get("pageSize").Int()
 	if pageSize <= 0 {
 		pageSize = 50
@@ -262,14 +255,14 @@ func (c *InboxController) Search(r *ghttp.Request) {
 	}
 
 	req := &model.UnifiedInboxRequest{
-		Page:     page,
+		Cursor:   r.Get("cursor").String(),
 		PageSize: pageSize,
 		Search:   query,
 	}
 
 	inbox, err := c.inboxService.GetUnifiedInbox(r.Context(), claims.UserID, req)
 	if err != nil {
-		response.InternalError(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
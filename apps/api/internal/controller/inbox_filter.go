@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+// InboxFilterController manages the filters received emails are sorted with
+type InboxFilterController struct {
+	inboxService *service.InboxService
+}
+
+// NewInboxFilterController creates a new inbox filter controller
+func NewInboxFilterController(inboxService *service.InboxService) *InboxFilterController {
+	return &InboxFilterController{inboxService: inboxService}
+}
+
+// List returns the user's inbox filters in the order they're applied
+// GET /api/v1/inbox/filters
+func (c *InboxFilterController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	filters, err := c.inboxService.ListFilters(r.Context(), claims.UserID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, filters)
+}
+
+// Create adds an inbox filter
+// POST /api/v1/inbox/filters
+func (c *InboxFilterController) Create(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.CreateFilterRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	filter, err := c.inboxService.CreateFilter(r.Context(), claims.UserID, claims.OrgID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Created(r, filter)
+}
+
+// Update changes an inbox filter
+// PUT /api/v1/inbox/filters/:uuid
+func (c *InboxFilterController) Update(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.UpdateFilterRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	filter, err := c.inboxService.UpdateFilter(r.Context(), claims.UserID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Filter updated", filter)
+}
+
+// Delete removes an inbox filter
+// DELETE /api/v1/inbox/filters/:uuid
+func (c *InboxFilterController) Delete(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if err := c.inboxService.DeleteFilter(r.Context(), claims.UserID, r.Get("uuid").String()); err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Filter deleted", nil)
+}
+
+// Run applies an inbox filter to emails already received, optionally only
+// those in a folder or date range, in the background
+// POST /api/v1/inbox/filters/:uuid/run
+func (c *InboxFilterController) Run(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.RunFilterRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	run, err := c.inboxService.RunFilter(r.Context(), claims.UserID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Created(r, run)
+}
+
+// GetRun returns a filter run with its progress
+// GET /api/v1/inbox/filter-runs/:uuid
+func (c *InboxFilterController) GetRun(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	run, err := c.inboxService.GetFilterRun(r.Context(), claims.UserID, r.Get("uuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, run)
+}
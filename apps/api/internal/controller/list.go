@@ -28,7 +28,7 @@ func (c *ListController) Create(r *ghttp.Request) {
 
 	var req model.CreateListRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -100,7 +100,7 @@ func (c *ListController) Update(r *ghttp.Request) {
 
 	var req model.UpdateListRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -113,6 +113,54 @@ func (c *ListController) Update(r *ghttp.Request) {
 	response.SuccessWithMessage(r, "List updated", list)
 }
 
+// RefreshSegment materializes the members of a dynamic list from its segment rules
+// POST /api/v1/lists/:uuid/refresh
+func (c *ListController) RefreshSegment(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	listUUID := r.Get("uuid").String()
+	if listUUID == "" {
+		response.BadRequest(r, "List UUID required")
+		return
+	}
+
+	list, err := c.listService.RefreshSegment(r.Context(), claims.OrgID, listUUID)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Segment refreshed", list)
+}
+
+// PreviewSegment counts the contacts segment rules select, before they're saved
+// POST /api/v1/lists/segment-preview
+func (c *ListController) PreviewSegment(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.PreviewSegmentRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	preview, err := c.listService.PreviewSegment(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, preview)
+}
+
 // DeleteList deletes a list
 // DELETE /api/v1/lists/:uuid
 func (c *ListController) Delete(r *ghttp.Request) {
@@ -154,7 +202,7 @@ func (c *ListController) AddContacts(r *ghttp.Request) {
 
 	var req model.AddContactsToListRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -184,7 +232,7 @@ func (c *ListController) RemoveContacts(r *ghttp.Request) {
 
 	var req model.RemoveContactsFromListRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -224,6 +272,37 @@ func (c *ListController) GetListContacts(r *ghttp.Request) {
 	response.Success(r, result)
 }
 
+// GetStats returns how a list grew and churned by day, and the sources its
+// contacts joined from
+// GET /api/v1/lists/:uuid/stats
+func (c *ListController) GetStats(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	listUUID := r.Get("uuid").String()
+	if listUUID == "" {
+		response.BadRequest(r, "List UUID required")
+		return
+	}
+
+	query := &model.ListStatsQuery{
+		From: r.GetQuery("from", "").String(),
+		To:   r.GetQuery("to", "").String(),
+		Days: r.GetQuery("days", 30).Int(),
+	}
+
+	stats, err := c.listService.GetListStats(r.Context(), claims.OrgID, listUUID, query)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, stats)
+}
+
 // ImportContactsToList imports contacts directly to a list
 // POST /api/v1/lists/:uuid/contacts/import
 func (c *ListController) ImportContactsToList(r *ghttp.Request) {
@@ -241,11 +320,11 @@ func (c *ListController) ImportContactsToList(r *ghttp.Request) {
 
 	var req model.ImportContactsToListRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
-	result, err := c.listService.ImportContactsToList(r.Context(), claims.OrgID, listUUID, &req)
+	result, err := c.listService.ImportContactsToList(r.Context(), claims.OrgID, claims.UserID, listUUID, &req)
 	if err != nil {
 		response.BadRequest(r, err.Error())
 		return
@@ -271,7 +350,7 @@ func (c *ListController) ManualAddContactToList(r *ghttp.Request) {
 
 	var req model.ManualAddContactToListRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
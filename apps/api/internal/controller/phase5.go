@@ -78,7 +78,7 @@ func (c *Phase5Controller) FinishWebAuthnRegistration(r *ghttp.Request) {
 		Response *service.RegistrationResponse `json:"response"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -135,7 +135,7 @@ func (c *Phase5Controller) FinishWebAuthnAuthentication(r *ghttp.Request) {
 
 	var req service.AuthenticationResponse
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -210,7 +210,7 @@ func (c *Phase5Controller) CreateSharedMailbox(r *ghttp.Request) {
 
 	var input service.CreateSharedMailboxInput
 	if err := r.Parse(&input); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -297,7 +297,7 @@ func (c *Phase5Controller) AddSharedMailboxMember(r *ghttp.Request) {
 
 	var input service.AddMemberInput
 	if err := r.Parse(&input); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -351,6 +351,157 @@ func (c *Phase5Controller) RemoveSharedMailboxMember(r *ghttp.Request) {
 	response.SuccessWithMessage(r, "Member removed", nil)
 }
 
+// ListMySharedMailboxes lists the shared mailboxes the user is a member of
+// GET /api/v1/inbox/shared-mailboxes
+func (c *Phase5Controller) ListMySharedMailboxes(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	mailboxes, err := c.sharedMailboxService.ListForUser(r.Context(), claims.UserID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, mailboxes)
+}
+
+// ListSharedMailboxMessages lists the emails of a shared mailbox with their
+// status and assignee
+// GET /api/v1/shared-mailboxes/:id/messages
+func (c *Phase5Controller) ListSharedMailboxMessages(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var input service.ListSharedMessagesInput
+	if err := r.Parse(&input); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	list, err := c.sharedMailboxService.ListMessages(r.Context(), claims.UserID, r.Get("id").Int(), &input)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, list)
+}
+
+// AssignSharedMailboxMessage assigns an email of a shared mailbox to a member
+// PUT /api/v1/shared-mailboxes/:id/messages/:emailId/assign
+func (c *Phase5Controller) AssignSharedMailboxMessage(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var input service.AssignMessageInput
+	if err := r.Parse(&input); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	message, err := c.sharedMailboxService.AssignMessage(r.Context(), claims.UserID, r.Get("id").Int(), r.Get("emailId").String(), &input)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, message)
+}
+
+// SetSharedMailboxMessageStatus closes or reopens an email of a shared mailbox
+// PUT /api/v1/shared-mailboxes/:id/messages/:emailId/status
+func (c *Phase5Controller) SetSharedMailboxMessageStatus(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var input service.SetMessageStatusInput
+	if err := r.Parse(&input); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	message, err := c.sharedMailboxService.SetMessageStatus(r.Context(), claims.UserID, r.Get("id").Int(), r.Get("emailId").String(), &input)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, message)
+}
+
+// ListSharedMailboxNotes lists the internal notes on an email of a shared mailbox
+// GET /api/v1/shared-mailboxes/:id/messages/:emailId/notes
+func (c *Phase5Controller) ListSharedMailboxNotes(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	notes, err := c.sharedMailboxService.ListNotes(r.Context(), claims.UserID, r.Get("id").Int(), r.Get("emailId").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, notes)
+}
+
+// AddSharedMailboxNote adds an internal note to an email of a shared mailbox
+// POST /api/v1/shared-mailboxes/:id/messages/:emailId/notes
+func (c *Phase5Controller) AddSharedMailboxNote(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var input service.AddNoteInput
+	if err := r.Parse(&input); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	note, err := c.sharedMailboxService.AddNote(r.Context(), claims.UserID, r.Get("id").Int(), r.Get("emailId").String(), &input)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Created(r, note)
+}
+
+// DeleteSharedMailboxNote removes an internal note from an email of a shared mailbox
+// DELETE /api/v1/shared-mailboxes/:id/messages/:emailId/notes/:noteId
+func (c *Phase5Controller) DeleteSharedMailboxNote(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	err := c.sharedMailboxService.DeleteNote(r.Context(), claims.UserID, r.Get("id").Int(), r.Get("emailId").String(), r.Get("noteId").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Note deleted", nil)
+}
+
 // ====================
 // SIEVE SCRIPT ENDPOINTS
 // ====================
@@ -366,7 +517,7 @@ func (c *Phase5Controller) CreateSieveScript(r *ghttp.Request) {
 
 	var input service.CreateSieveScriptInput
 	if err := r.Parse(&input); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -433,7 +584,7 @@ func (c *Phase5Controller) UpdateSieveScript(r *ghttp.Request) {
 		Active *bool   `json:"active,omitempty"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -472,7 +623,7 @@ func (c *Phase5Controller) ValidateSieveScript(r *ghttp.Request) {
 		Script string `json:"script"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -498,7 +649,7 @@ func (c *Phase5Controller) CreateWebhookTrigger(r *ghttp.Request) {
 
 	var input service.CreateWebhookTriggerInput
 	if err := r.Parse(&input); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -615,7 +766,7 @@ func (c *Phase5Controller) SubscribePush(r *ghttp.Request) {
 
 	var input service.CreatePushSubscriptionInput
 	if err := r.Parse(&input); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -641,7 +792,7 @@ func (c *Phase5Controller) UnsubscribePush(r *ghttp.Request) {
 		Endpoint string `json:"endpoint"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -689,7 +840,7 @@ func (c *Phase5Controller) UpdatePushPreferences(r *ghttp.Request) {
 		NotifyMentions  *bool `json:"notifyMentions,omitempty"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -740,7 +891,7 @@ func (c *Phase5Controller) UpdateBranding(r *ghttp.Request) {
 
 	var input service.UpdateBrandingInput
 	if err := r.Parse(&input); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
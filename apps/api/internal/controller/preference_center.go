@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/service"
+)
+
+// The unsubscribe and preference endpoints answer browsers, which follow the
+// links of emails asking for HTML, with hosted pages, and API clients with
+// JSON. The pages post back to the same endpoints as forms.
+
+// profileFieldPrefix names the form inputs of profile fields
+const profileFieldPrefix = "profile."
+
+// hostedPageView is what the hosted page templates are executed with
+type hostedPageView struct {
+	Branding    *service.PageBranding
+	Token       string
+	Email       string
+	Topic       string // Of the email the unsubscribe link is from
+	Notice      string
+	Error       string
+	Preferences *service.PreferenceData
+}
+
+var hostedPages = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .Branding.OrgName}}{{.Branding.OrgName}} - {{end}}Email preferences</title>
+<style>
+body { margin: 0; background: #f4f4f5; color: #18181b; font: 15px/1.5 -apple-system, BlinkMacSystemFont, "Segoe UI", Roboto, sans-serif; }
+main { max-width: 560px; margin: 40px auto; padding: 32px; background: #fff; border-radius: 8px; border-top: 4px solid {{.Branding.PrimaryColor}}; }
+header { margin-bottom: 24px; }
+header img { max-height: 48px; max-width: 240px; }
+h1 { font-size: 22px; margin: 0 0 8px; }
+h2 { font-size: 16px; margin: 24px 0 8px; }
+label { display: block; margin: 8px 0; }
+input[type=text], select { width: 100%; box-sizing: border-box; padding: 8px; margin-top: 4px; border: 1px solid #d4d4d8; border-radius: 4px; font: inherit; }
+.list { display: flex; gap: 8px; align-items: flex-start; }
+.list small { display: block; color: #71717a; }
+.notice { padding: 12px; border-radius: 4px; background: #ecfdf5; border-left: 4px solid {{.Branding.AccentColor}}; }
+.error { padding: 12px; border-radius: 4px; background: #fef2f2; border-left: 4px solid #dc2626; }
+.actions { display: flex; gap: 12px; flex-wrap: wrap; margin-top: 24px; }
+button { padding: 10px 16px; border: 0; border-radius: 4px; background: {{.Branding.PrimaryColor}}; color: #fff; font: inherit; cursor: pointer; }
+button.secondary { background: #e4e4e7; color: #18181b; }
+footer { max-width: 560px; margin: 0 auto 40px; text-align: center; color: #a1a1aa; font-size: 12px; }
+</style>
+</head>
+<body>
+<main>
+<header>{{if .Branding.LogoURL}}<img src="{{.Branding.LogoURL}}" alt="{{.Branding.OrgName}}">{{else}}<strong>{{.Branding.OrgName}}</strong>{{end}}</header>
+{{if .Notice}}<p class="notice">{{.Notice}}</p>{{end}}
+{{if .Error}}<p class="error">{{.Error}}</p>{{end}}
+{{template "content" .}}
+</main>
+{{if not .Branding.HidePoweredBy}}<footer>Powered by Mailat</footer>{{end}}
+</body>
+</html>
+`))
+
+var errorPage = template.Must(template.Must(hostedPages.Clone()).Parse(`{{define "content"}}{{end}}`))
+
+var unsubscribePage = template.Must(template.Must(hostedPages.Clone()).Parse(`{{define "content"}}
+<h1>Unsubscribe</h1>
+<p>Stop {{if .Topic}}emails about {{.Topic}}{{else}}emails{{end}} from {{.Branding.OrgName}} to <strong>{{.Email}}</strong>?</p>
+<form method="post">
+<input type="hidden" name="source" value="page">
+{{if .Topic}}<label class="list"><input type="checkbox" name="all" value="true"> <span>Unsubscribe from all emails instead</span></label>{{end}}
+<label>Reason (optional)
+<input type="text" name="reason" maxlength="500">
+</label>
+<div class="actions">
+<button type="submit">Unsubscribe</button>
+</div>
+</form>
+<p><a href="../preferences/{{.Token}}">Manage your preferences instead</a></p>
+{{end}}`))
+
+var unsubscribedPage = template.Must(template.Must(hostedPages.Clone()).Parse(`{{define "content"}}
+<h1>You're unsubscribed</h1>
+<p><strong>{{.Email}}</strong> won't get {{if .Topic}}emails about {{.Topic}}{{else}}emails{{end}} from {{.Branding.OrgName}} anymore.</p>
+<p><a href="../preferences/{{.Token}}">Manage your preferences</a></p>
+{{end}}`))
+
+var preferencesPage = template.Must(template.Must(hostedPages.Clone()).Parse(`{{define "content"}}
+<h1>Email preferences</h1>
+{{with .Preferences}}
+<p>For <strong>{{.Email}}</strong>{{if eq .Status "unsubscribed"}}, currently unsubscribed from all emails{{end}}.</p>
+<form method="post">
+{{if .AllLists}}
+<h2>Subscriptions</h2>
+{{range .AllLists}}
+<label class="list"><input type="checkbox" name="lists" value="{{.ID}}"{{if .Subscribed}} checked{{end}}>
+<span>{{.Name}}{{if .Description}}<small>{{.Description}}</small>{{end}}</span></label>
+{{end}}
+{{end}}
+{{if .Topics}}
+<h2>Topics</h2>
+{{range .Topics}}
+<label class="list"><input type="checkbox" name="topics" value="{{.ID}}"{{if .Subscribed}} checked{{end}}>
+<span>{{.Name}}{{if .Description}}<small>{{.Description}}</small>{{end}}</span></label>
+{{end}}
+{{end}}
+{{if .Profile}}
+<h2>Your details</h2>
+{{range .Profile}}
+<label>{{.Label}}{{if .Required}} *{{end}}
+{{if .Options}}<select name="profile.{{.Key}}">{{$value := .Value}}{{if not .Required}}<option value=""></option>{{end}}{{range .Options}}<option{{if eq . $value}} selected{{end}}>{{.}}</option>{{end}}</select>
+{{else if eq .Type "boolean"}}<select name="profile.{{.Key}}"><option value=""></option><option value="true"{{if eq .Value "true"}} selected{{end}}>Yes</option><option value="false"{{if eq .Value "false"}} selected{{end}}>No</option></select>
+{{else}}<input type="text" name="profile.{{.Key}}" value="{{.Value}}"{{if eq .Type "date"}} placeholder="YYYY-MM-DD"{{end}}>
+{{end}}
+</label>
+{{end}}
+{{end}}
+<div class="actions">
+<button type="submit" name="action" value="save">Save preferences</button>
+<button type="submit" name="action" value="unsubscribe_all" class="secondary">Unsubscribe from all emails</button>
+</div>
+</form>
+{{end}}
+{{end}}`))
+
+// wantsHTML reports whether the request comes from a browser rather than an
+// API client
+func wantsHTML(r *ghttp.Request) bool {
+	return strings.Contains(r.Header.Get("Accept"), "text/html")
+}
+
+// renderHostedPage writes a hosted page, or a bare error when it can't be drawn
+func renderHostedPage(r *ghttp.Request, status int, page *template.Template, view *hostedPageView) {
+	if view.Branding == nil {
+		view.Branding = &service.PageBranding{PrimaryColor: "#4F46E5", AccentColor: "#10B981"}
+	}
+
+	var buf bytes.Buffer
+	if err := page.ExecuteTemplate(&buf, "layout", view); err != nil {
+		r.Response.WriteStatus(http.StatusInternalServerError, "Failed to render page")
+		return
+	}
+	r.Response.Header().Set("Content-Type", "text/html; charset=utf-8")
+	r.Response.Header().Set("Cache-Control", "no-store")
+	r.Response.WriteStatus(status, buf.Bytes())
+}
+
+// renderUnsubscribePage draws the hosted unsubscribe page, or its confirmation
+// once the contact is unsubscribed. The email's topic is left out when the
+// contact unsubscribed from everything.
+func (c *ComplianceController) renderUnsubscribePage(r *ghttp.Request, token string, page *template.Template, withTopic bool) {
+	branding, err := c.complianceService.PageBranding(r.Context(), token)
+	if err != nil {
+		renderHostedPage(r, http.StatusBadRequest, errorPage, &hostedPageView{Error: "This unsubscribe link is invalid."})
+		return
+	}
+
+	data, err := c.complianceService.GetUnsubscribePage(r.Context(), token)
+	if err != nil {
+		renderHostedPage(r, http.StatusBadRequest, errorPage, &hostedPageView{Branding: branding, Error: "This unsubscribe link is invalid."})
+		return
+	}
+
+	view := &hostedPageView{Branding: branding, Token: token}
+	view.Email, _ = data["email"].(string)
+	if withTopic {
+		view.Topic, _ = data["topic"].(string)
+	}
+	renderHostedPage(r, http.StatusOK, page, view)
+}
+
+// renderPreferencesPage draws the hosted preference center
+func (c *ComplianceController) renderPreferencesPage(r *ghttp.Request, token string, status int, notice string, failure string) {
+	branding, err := c.complianceService.PageBranding(r.Context(), token)
+	if err != nil {
+		renderHostedPage(r, http.StatusBadRequest, errorPage, &hostedPageView{Error: "This preferences link is invalid."})
+		return
+	}
+
+	data, err := c.complianceService.GetPreferenceCenter(r.Context(), token)
+	if err != nil {
+		renderHostedPage(r, http.StatusBadRequest, errorPage, &hostedPageView{Branding: branding, Error: "This preferences link is invalid."})
+		return
+	}
+
+	renderHostedPage(r, status, preferencesPage, &hostedPageView{
+		Branding:    branding,
+		Token:       token,
+		Email:       data.Email,
+		Notice:      notice,
+		Error:       failure,
+		Preferences: data,
+	})
+}
+
+// SubmitPreferencesPage saves the form of the hosted preference center
+// POST /api/v1/preferences/:token
+func (c *ComplianceController) SubmitPreferencesPage(r *ghttp.Request) {
+	token := r.Get("token").String()
+	if token == "" {
+		renderHostedPage(r, http.StatusBadRequest, errorPage, &hostedPageView{Error: "This preferences link is invalid."})
+		return
+	}
+
+	ipAddress := r.GetClientIp()
+	userAgent := r.Header.Get("User-Agent")
+
+	if err := r.Request.ParseForm(); err != nil {
+		c.renderPreferencesPage(r, token, http.StatusBadRequest, "", "The form could not be read.")
+		return
+	}
+	form := r.Request.PostForm
+
+	if form.Get("action") == "unsubscribe_all" {
+		if err := c.complianceService.UnsubscribeFromAll(r.Context(), token, ipAddress, userAgent); err != nil {
+			c.renderPreferencesPage(r, token, http.StatusBadRequest, "", err.Error())
+			return
+		}
+		c.renderPreferencesPage(r, token, http.StatusOK, "You're unsubscribed from all emails.", "")
+		return
+	}
+
+	profile := map[string]any{}
+	for name, values := range form {
+		if key, ok := strings.CutPrefix(name, profileFieldPrefix); ok && len(values) > 0 {
+			profile[key] = values[0]
+		}
+	}
+	if err := c.complianceService.UpdateProfile(r.Context(), token, profile, ipAddress, userAgent); err != nil {
+		c.renderPreferencesPage(r, token, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	listIDs := []int{}
+	for _, value := range form["lists"] {
+		if id, err := strconv.Atoi(value); err == nil {
+			listIDs = append(listIDs, id)
+		}
+	}
+	topicIDs := []int{}
+	for _, value := range form["topics"] {
+		if id, err := strconv.Atoi(value); err == nil {
+			topicIDs = append(topicIDs, id)
+		}
+	}
+	if err := c.complianceService.UpdatePreferences(r.Context(), token, listIDs, &topicIDs, ipAddress, userAgent); err != nil {
+		c.renderPreferencesPage(r, token, http.StatusBadRequest, "", err.Error())
+		return
+	}
+
+	c.renderPreferencesPage(r, token, http.StatusOK, "Your preferences are saved.", "")
+}
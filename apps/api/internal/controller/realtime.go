@@ -0,0 +1,110 @@
+package controller
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gogf/gf/v2/frame/g"
+	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gorilla/websocket"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+const (
+	// realtimePingInterval is how often connections are pinged; one that
+	// doesn't answer two pings in a row is closed
+	realtimePingInterval = 30 * time.Second
+	realtimeWriteTimeout = 10 * time.Second
+)
+
+// realtimeUpgrader accepts connections from any origin, as the API's CORS
+// policy does; clients authenticate with their token rather than cookies
+var realtimeUpgrader = websocket.Upgrader{
+	ReadBufferSize:  1024,
+	WriteBufferSize: 4096,
+	CheckOrigin:     func(*http.Request) bool { return true },
+}
+
+// RealtimeController pushes inbox changes to clients over WebSocket
+type RealtimeController struct {
+	hub *service.RealtimeHub
+}
+
+// NewRealtimeController creates a new realtime controller
+func NewRealtimeController(hub *service.RealtimeHub) *RealtimeController {
+	return &RealtimeController{hub: hub}
+}
+
+// Connect upgrades to a WebSocket that receives the user's inbox changes as
+// JSON events: new_email, email_update, email_deleted and mailbox_change
+// GET /api/v1/realtime/ws
+// Browsers can't set headers on WebSockets, so the token may be passed as ?token=
+func (c *RealtimeController) Connect(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	conn, err := realtimeUpgrader.Upgrade(r.Response.Writer, r.Request, nil)
+	if err != nil {
+		// The upgrader has already answered the request
+		return
+	}
+	defer conn.Close()
+
+	client := c.hub.Subscribe(claims.UserID)
+	defer c.hub.Unsubscribe(client)
+
+	g.Log().Infof(r.Context(), "WebSocket client connected: user=%d", claims.UserID)
+	defer g.Log().Infof(r.Context(), "WebSocket client disconnected: user=%d", claims.UserID)
+
+	// Clients have nothing to send; reading is how pongs and closes arrive
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		conn.SetReadLimit(1024)
+		conn.SetReadDeadline(time.Now().Add(2 * realtimePingInterval))
+		conn.SetPongHandler(func(string) error {
+			return conn.SetReadDeadline(time.Now().Add(2 * realtimePingInterval))
+		})
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	write := func(event *service.RealtimeEvent) error {
+		conn.SetWriteDeadline(time.Now().Add(realtimeWriteTimeout))
+		return conn.WriteJSON(event)
+	}
+
+	if err := write(&service.RealtimeEvent{
+		Type: service.RealtimeConnected,
+		Data: map[string]interface{}{"timestamp": time.Now().Format(time.RFC3339)},
+	}); err != nil {
+		return
+	}
+
+	ping := time.NewTicker(realtimePingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case event := <-client.Events:
+			if err := write(event); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(realtimeWriteTimeout)); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
@@ -37,7 +37,7 @@ func (c *ReceivedInboxController) ListEmails(r *ghttp.Request) {
 
 	var req model.InboxListRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -51,6 +51,56 @@ func (c *ReceivedInboxController) ListEmails(r *ghttp.Request) {
 	response.Success(r, result)
 }
 
+// ListThreads returns a paginated list of received email conversations, each
+// shown by its latest message
+// GET /api/v1/inbox/threads
+// Takes the filters of ListEmails; identityId 0 or omitted lists all the user's identities
+func (c *ReceivedInboxController) ListThreads(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.InboxListRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.inboxService.ListReceivedThreads(r.Context(), claims.UserID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// GetThread returns the received and sent messages of a conversation
+// GET /api/v1/inbox/received/threads/:threadId
+func (c *ReceivedInboxController) GetThread(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	threadID := r.Get("threadId").String()
+	if threadID == "" {
+		response.BadRequest(r, "Thread ID is required")
+		return
+	}
+
+	emails, err := c.inboxService.GetReceivedThread(r.Context(), claims.UserID, threadID)
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, emails)
+}
+
 // GetEmail returns a single received email
 // GET /api/v1/inbox/received/:uuid
 func (c *ReceivedInboxController) GetEmail(r *ghttp.Request) {
@@ -75,6 +125,105 @@ func (c *ReceivedInboxController) GetEmail(r *ghttp.Request) {
 	response.Success(r, email)
 }
 
+// GetAttachment returns a short-lived URL an attachment of a received email
+// can be downloaded from, or shown inline with ?inline=true
+// GET /api/v1/inbox/received/:uuid/attachments/:attachmentUuid
+func (c *ReceivedInboxController) GetAttachment(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	link, err := c.inboxService.GetReceivedAttachment(r.Context(), claims.UserID, r.Get("uuid").String(), r.Get("attachmentUuid").String(), r.Get("inline").Bool())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, link)
+}
+
+// GetAttachmentThumbnail returns a short-lived URL of the JPEG thumbnail of an
+// image or PDF attachment of a received email
+// GET /api/v1/inbox/received/:uuid/attachments/:attachmentUuid/thumbnail
+func (c *ReceivedInboxController) GetAttachmentThumbnail(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	link, err := c.inboxService.GetAttachmentThumbnail(r.Context(), claims.UserID, r.Get("uuid").String(), r.Get("attachmentUuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, link)
+}
+
+// BulkAction applies an action to every email matching a filter, such as
+// archiving all spam older than 30 days, in the background
+// POST /api/v1/inbox/received/bulk
+func (c *ReceivedInboxController) BulkAction(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.InboxBulkRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	job, err := c.inboxService.StartInboxBulk(r.Context(), claims.UserID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Created(r, job)
+}
+
+// GetBulkJob returns a bulk operation with its progress
+// GET /api/v1/inbox/bulk-jobs/:uuid
+func (c *ReceivedInboxController) GetBulkJob(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	job, err := c.inboxService.GetInboxBulk(r.Context(), claims.UserID, r.Get("uuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, job)
+}
+
+// GetTracking returns the opens and clicks recorded for a tracked sent email
+// GET /api/v1/inbox/received/:uuid/tracking
+func (c *ReceivedInboxController) GetTracking(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	tracking, err := c.inboxService.GetSentTracking(r.Context(), claims.UserID, r.Get("uuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, tracking)
+}
+
 // MarkEmails marks emails as read or unread
 // POST /api/v1/inbox/received/mark
 func (c *ReceivedInboxController) MarkEmails(r *ghttp.Request) {
@@ -86,7 +235,7 @@ func (c *ReceivedInboxController) MarkEmails(r *ghttp.Request) {
 
 	var req model.MarkEmailsRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -115,7 +264,7 @@ func (c *ReceivedInboxController) StarEmails(r *ghttp.Request) {
 
 	var req model.StarEmailsRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -144,7 +293,7 @@ func (c *ReceivedInboxController) MoveEmails(r *ghttp.Request) {
 
 	var req model.MoveEmailsRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -178,7 +327,7 @@ func (c *ReceivedInboxController) TrashEmails(r *ghttp.Request) {
 
 	var req model.TrashEmailsRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -230,6 +379,95 @@ func (c *ReceivedInboxController) GetCounts(r *ghttp.Request) {
 	response.Success(r, counts)
 }
 
+// ReportSpam marks emails as spam, moving them to the spam folder and
+// training the spam filters with them
+// POST /api/v1/inbox/received/spam
+func (c *ReceivedInboxController) ReportSpam(r *ghttp.Request) {
+	c.spamFeedback(r, true)
+}
+
+// ReportNotSpam marks emails as not spam, moving them to the inbox and
+// training the spam filters with them
+// POST /api/v1/inbox/received/not-spam
+func (c *ReceivedInboxController) ReportNotSpam(r *ghttp.Request) {
+	c.spamFeedback(r, false)
+}
+
+func (c *ReceivedInboxController) spamFeedback(r *ghttp.Request, spam bool) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.SpamFeedbackRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	if len(req.EmailUUIDs) == 0 {
+		response.BadRequest(r, "Email UUIDs are required")
+		return
+	}
+
+	result, err := c.inboxService.ReportSpam(r.Context(), claims.UserID, req.EmailUUIDs, spam)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// SummarizeEmail summarizes the conversation of an email with the org's provider
+// POST /api/v1/inbox/emails/:uuid/summarize
+func (c *ReceivedInboxController) SummarizeEmail(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.SummarizeEmailRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	summary, err := c.inboxService.SummarizeEmail(r.Context(), claims.UserID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, summary)
+}
+
+// TranslateEmail translates the body of an email with the org's provider
+// POST /api/v1/inbox/emails/:uuid/translate
+func (c *ReceivedInboxController) TranslateEmail(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.TranslateEmailRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	translation, err := c.inboxService.TranslateEmail(r.Context(), claims.UserID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, translation)
+}
+
 // SetupReceiving sets up email receiving for a domain
 // POST /api/v1/inbox/setup
 func (c *ReceivedInboxController) SetupReceiving(r *ghttp.Request) {
@@ -243,7 +481,7 @@ func (c *ReceivedInboxController) SetupReceiving(r *ghttp.Request) {
 		DomainID int64 `json:"domainId" v:"required"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -275,7 +513,7 @@ func (c *ReceivedInboxController) SetCatchAll(r *ghttp.Request) {
 		IsCatchAll bool `json:"isCatchAll"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
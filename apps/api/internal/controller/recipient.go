@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"encoding/csv"
+	"fmt"
+	"strings"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type RecipientController struct {
+	recipientService *service.RecipientService
+}
+
+func NewRecipientController(recipientService *service.RecipientService) *RecipientController {
+	return &RecipientController{recipientService: recipientService}
+}
+
+// GetHistory returns all sends, delivery events, suppressions and replies involving an address
+// GET /api/v1/recipients/:email/history
+func (c *RecipientController) GetHistory(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	history, err := c.recipientService.GetHistory(r.Context(), claims.OrgID, r.Get("email").String(), parseRecipientHistoryQuery(r))
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, history)
+}
+
+// ExportHistory returns the recipient history as a CSV timeline
+// GET /api/v1/recipients/:email/history/export
+func (c *RecipientController) ExportHistory(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	history, err := c.recipientService.GetHistory(r.Context(), claims.OrgID, r.Get("email").String(), parseRecipientHistoryQuery(r))
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	var buf strings.Builder
+	writer := csv.NewWriter(&buf)
+	if err := writer.WriteAll(service.HistoryCSV(history)); err != nil {
+		response.InternalError(r, "Failed to build CSV export")
+		return
+	}
+
+	filename := strings.NewReplacer("@", "_at_", "/", "_", "\"", "").Replace(history.Email)
+	r.Response.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	r.Response.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"history-%s.csv\"", filename))
+	r.Response.Write(buf.String())
+}
+
+func parseRecipientHistoryQuery(r *ghttp.Request) *model.RecipientHistoryQuery {
+	return &model.RecipientHistoryQuery{
+		From:  r.GetQuery("from", "").String(),
+		To:    r.GetQuery("to", "").String(),
+		Limit: r.GetQuery("limit", 100).Int(),
+	}
+}
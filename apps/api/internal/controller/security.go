@@ -72,7 +72,7 @@ func (c *SecurityController) Verify2FA(r *ghttp.Request) {
 		Code string `json:"code"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -128,7 +128,7 @@ func (c *SecurityController) Disable2FA(r *ghttp.Request) {
 		Code     string `json:"code"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -187,7 +187,7 @@ func (c *SecurityController) RegenerateBackupCodes(r *ghttp.Request) {
 		Code     string `json:"code"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -361,7 +361,7 @@ func (c *SecurityController) ChangePassword(r *ghttp.Request) {
 		NewPassword     string `json:"newPassword" v:"required|min-length:8"`
 	}
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -24,13 +24,15 @@ import (
 type SESWebhookController struct {
 	receivingService      *service.ReceivingService
 	webhookTriggerService *service.WebhookTriggerService
+	bounceService         *service.BounceService
 }
 
 // NewSESWebhookController creates a new SES webhook controller
-func NewSESWebhookController(receivingService *service.ReceivingService, webhookTriggerService *service.WebhookTriggerService) *SESWebhookController {
+func NewSESWebhookController(receivingService *service.ReceivingService, webhookTriggerService *service.WebhookTriggerService, bounceService *service.BounceService) *SESWebhookController {
 	return &SESWebhookController{
 		receivingService:      receivingService,
 		webhookTriggerService: webhookTriggerService,
+		bounceService:         bounceService,
 	}
 }
 
@@ -147,20 +149,33 @@ func (c *SESWebhookController) handleBounce(ctx g.Ctx, notification *model.SESNo
 	bounce := notification.Bounce
 	g.Log().Infof(ctx, "Processing bounce: type=%s, subType=%s", bounce.BounceType, bounce.BounceSubType)
 
+	// Classify recipients and apply the per-class suppression policy
+	var classified []service.BouncedRecipient
+	if c.bounceService != nil {
+		var err error
+		classified, err = c.bounceService.ProcessSESBounce(ctx, notification)
+		if err != nil {
+			g.Log().Errorf(ctx, "Failed to process bounce: %v", err)
+		}
+	}
+
 	// Collect bounced recipients
 	recipients := make([]string, 0, len(bounce.BouncedRecipients))
+	classes := make(map[string]string, len(classified))
+	for _, recipient := range classified {
+		classes[recipient.Email] = string(recipient.Class)
+	}
 	for _, recipient := range bounce.BouncedRecipients {
-		g.Log().Infof(ctx, "Bounced recipient: %s, action=%s, status=%s",
-			recipient.EmailAddress, recipient.Action, recipient.Status)
+		g.Log().Infof(ctx, "Bounced recipient: %s, action=%s, status=%s, class=%s",
+			recipient.EmailAddress, recipient.Action, recipient.Status, classes[recipient.EmailAddress])
 		recipients = append(recipients, recipient.EmailAddress)
-
-		// TODO: Add to suppression list and update transactional emails
 	}
 
 	// Fire webhook trigger
 	c.fireForSESEvent(ctx, notification, service.TriggerBounceReceived, map[string]interface{}{
 		"bounce_type":    bounce.BounceType,
 		"bounce_subtype": bounce.BounceSubType,
+		"bounce_classes": classes,
 		"recipients":     recipients,
 		"message_id":     notification.Mail.MessageId,
 	})
@@ -1,10 +1,13 @@
 package controller
 
 import (
+	"errors"
+
 	"github.com/gogf/gf/v2/net/ghttp"
 
 	"github.com/dublyo/mailat/api/internal/middleware"
 	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/apierror"
 	"github.com/dublyo/mailat/api/pkg/response"
 )
 
@@ -57,15 +60,818 @@ func (c *SettingsController) UpdateSettings(r *ghttp.Request) {
 
 	var req service.UpdateSettingsRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
 	settings, err := c.settingsService.UpdateSettings(r.Context(), claims.UserID, &req)
 	if err != nil {
+		var validationErr *apierror.ValidationError
+		if errors.As(err, &validationErr) {
+			response.Fail(r, err)
+			return
+		}
 		response.InternalError(r, err.Error())
 		return
 	}
 
 	response.SuccessWithMessage(r, "Settings updated successfully", settings)
 }
+
+// GetAddressNormalization returns the organization's address normalization rules
+// GET /api/v1/settings/address-normalization
+func (c *SettingsController) GetAddressNormalization(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	rules, err := c.settingsService.GetAddressNormalization(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, rules)
+}
+
+// UpdateAddressNormalization updates the organization's address normalization rules
+// PUT /api/v1/settings/address-normalization
+func (c *SettingsController) UpdateAddressNormalization(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req service.UpdateAddressNormalizationRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	rules, err := c.settingsService.UpdateAddressNormalization(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Address normalization updated", rules)
+}
+
+// GetRetentionPolicy returns the organization's transactional email retention policy
+// GET /api/v1/settings/retention
+func (c *SettingsController) GetRetentionPolicy(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	settings, err := c.settingsService.GetRetentionPolicy(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, settings)
+}
+
+// UpdateRetentionPolicy updates the organization's transactional email retention policy
+// PUT /api/v1/settings/retention
+func (c *SettingsController) UpdateRetentionPolicy(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	// Retention permanently removes data, so only admins and owners can change it
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the retention policy")
+		return
+	}
+
+	var req service.UpdateRetentionPolicyRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	settings, err := c.settingsService.UpdateRetentionPolicy(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Retention policy updated", settings)
+}
+
+// GetSenderRotation returns the organization's sender rotation pools and today's volume per identity
+// GET /api/v1/settings/sender-rotation
+func (c *SettingsController) GetSenderRotation(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	settings, err := c.settingsService.GetSenderRotation(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, settings)
+}
+
+// UpdateSenderRotation replaces the organization's sender rotation pools
+// PUT /api/v1/settings/sender-rotation
+func (c *SettingsController) UpdateSenderRotation(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change sender rotation")
+		return
+	}
+
+	var req service.UpdateSenderRotationRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	settings, err := c.settingsService.UpdateSenderRotation(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Sender rotation updated", settings)
+}
+
+// GetContentGuard returns the organization's send-time content guard policy
+// GET /api/v1/settings/content-guard
+func (c *SettingsController) GetContentGuard(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	policy, err := c.settingsService.GetContentGuard(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, policy)
+}
+
+// UpdateContentGuard updates the organization's send-time content guard policy
+// PUT /api/v1/settings/content-guard
+func (c *SettingsController) UpdateContentGuard(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the content guard")
+		return
+	}
+
+	var req service.UpdateContentGuardRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	policy, err := c.settingsService.UpdateContentGuard(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Content guard updated", policy)
+}
+
+// GetOutboundRules returns the organization's rules for emails composed in
+// the inbox
+// GET /api/v1/settings/outbound-rules
+func (c *SettingsController) GetOutboundRules(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	policy, err := c.settingsService.GetOutboundRules(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, policy)
+}
+
+// UpdateOutboundRules updates the organization's rules for emails composed in
+// the inbox
+// PUT /api/v1/settings/outbound-rules
+func (c *SettingsController) UpdateOutboundRules(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the outbound rules")
+		return
+	}
+
+	var req service.UpdateOutboundRulesRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	policy, err := c.settingsService.UpdateOutboundRules(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Outbound rules updated", policy)
+}
+
+// GetBackupPolicy returns the organization's scheduled contact backup policy
+// GET /api/v1/settings/backups
+func (c *SettingsController) GetBackupPolicy(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	policy, err := c.settingsService.GetBackupPolicy(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, policy)
+}
+
+// UpdateBackupPolicy updates the organization's scheduled contact backup policy
+// PUT /api/v1/settings/backups
+func (c *SettingsController) UpdateBackupPolicy(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the backup policy")
+		return
+	}
+
+	var req service.UpdateBackupPolicyRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	policy, err := c.settingsService.UpdateBackupPolicy(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Backup policy updated", policy)
+}
+
+// GetListHygiene returns the organization's list hygiene policy
+// GET /api/v1/settings/list-hygiene
+func (c *SettingsController) GetListHygiene(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	policy, err := c.settingsService.GetListHygiene(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, policy)
+}
+
+// UpdateListHygiene updates the organization's list hygiene policy
+// PUT /api/v1/settings/list-hygiene
+func (c *SettingsController) UpdateListHygiene(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the list hygiene policy")
+		return
+	}
+
+	var req service.UpdateListHygieneRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	policy, err := c.settingsService.UpdateListHygiene(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "List hygiene policy updated", policy)
+}
+
+// GetSendingWindow returns the organization's sending window
+// GET /api/v1/settings/sending-window
+func (c *SettingsController) GetSendingWindow(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	policy, err := c.settingsService.GetSendingWindow(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, policy)
+}
+
+// UpdateSendingWindow updates the organization's sending window
+// PUT /api/v1/settings/sending-window
+func (c *SettingsController) UpdateSendingWindow(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the sending window")
+		return
+	}
+
+	var req service.UpdateSendingWindowRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	policy, err := c.settingsService.UpdateSendingWindow(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Sending window updated", policy)
+}
+
+// GetCampaignSendRate returns the organization's campaign send rate
+// GET /api/v1/settings/campaign-send-rate
+func (c *SettingsController) GetCampaignSendRate(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	policy, err := c.settingsService.GetCampaignSendRate(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, policy)
+}
+
+// UpdateCampaignSendRate updates the organization's campaign send rate
+// PUT /api/v1/settings/campaign-send-rate
+func (c *SettingsController) UpdateCampaignSendRate(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the campaign send rate")
+		return
+	}
+
+	var req service.UpdateCampaignSendRateRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	policy, err := c.settingsService.UpdateCampaignSendRate(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Campaign send rate updated", policy)
+}
+
+// GetDomainWarmup returns the organization's warmup of new sending domains
+// GET /api/v1/settings/domain-warmup
+func (c *SettingsController) GetDomainWarmup(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	policy, err := c.settingsService.GetDomainWarmup(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, policy)
+}
+
+// UpdateDomainWarmup updates the organization's warmup of new sending domains
+// PUT /api/v1/settings/domain-warmup
+func (c *SettingsController) UpdateDomainWarmup(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the domain warmup")
+		return
+	}
+
+	var req service.UpdateDomainWarmupRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	policy, err := c.settingsService.UpdateDomainWarmup(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Domain warmup updated", policy)
+}
+
+// GetCampaignUTM returns the organization's UTM tagging of campaign links
+// GET /api/v1/settings/campaign-utm
+func (c *SettingsController) GetCampaignUTM(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	policy, err := c.settingsService.GetCampaignUTM(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, policy)
+}
+
+// UpdateCampaignUTM updates the organization's UTM tagging of campaign links
+// PUT /api/v1/settings/campaign-utm
+func (c *SettingsController) UpdateCampaignUTM(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change UTM tagging")
+		return
+	}
+
+	var req service.UpdateCampaignUTMRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	policy, err := c.settingsService.UpdateCampaignUTM(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "UTM tagging updated", policy)
+}
+
+// GetInboxPreview returns the organization's campaign inbox preview service
+// GET /api/v1/settings/inbox-preview
+func (c *SettingsController) GetInboxPreview(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	previewService, err := c.settingsService.GetInboxPreview(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, previewService)
+}
+
+// UpdateInboxPreview updates the organization's campaign inbox preview service
+// PUT /api/v1/settings/inbox-preview
+func (c *SettingsController) UpdateInboxPreview(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	// Campaign content is posted to the service, so only admins and owners pick it
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the inbox preview service")
+		return
+	}
+
+	var req service.UpdateInboxPreviewRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	previewService, err := c.settingsService.UpdateInboxPreview(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Inbox preview service updated", previewService)
+}
+
+// GetEventExportBucket returns the organization's bucket for delivery event exports
+// GET /api/v1/settings/event-export
+func (c *SettingsController) GetEventExportBucket(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	bucket, err := c.settingsService.GetEventExportBucket(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, bucket)
+}
+
+// UpdateEventExportBucket updates the organization's bucket for delivery event exports
+// PUT /api/v1/settings/event-export
+func (c *SettingsController) UpdateEventExportBucket(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the export bucket")
+		return
+	}
+
+	var req service.UpdateEventExportBucketRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	bucket, err := c.settingsService.UpdateEventExportBucket(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Export bucket updated", bucket)
+}
+
+// GetMailAssist returns the organization's provider for email summaries and translations
+// GET /api/v1/settings/mail-assist
+func (c *SettingsController) GetMailAssist(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	config, err := c.settingsService.GetMailAssist(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, config)
+}
+
+// UpdateMailAssist updates the organization's provider for email summaries and translations
+// PUT /api/v1/settings/mail-assist
+func (c *SettingsController) UpdateMailAssist(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the summary and translation provider")
+		return
+	}
+
+	var req service.UpdateMailAssistRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	config, err := c.settingsService.UpdateMailAssist(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Summary and translation provider updated", config)
+}
+
+// GetTestRecipients returns the addresses template test sends may go to
+// GET /api/v1/settings/test-recipients
+func (c *SettingsController) GetTestRecipients(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	recipients, err := c.settingsService.GetTestRecipients(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, recipients)
+}
+
+// UpdateTestRecipients replaces the addresses template test sends may go to
+// PUT /api/v1/settings/test-recipients
+func (c *SettingsController) UpdateTestRecipients(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change test recipients")
+		return
+	}
+
+	var req service.UpdateTestRecipientsRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	recipients, err := c.settingsService.UpdateTestRecipients(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Test recipients updated", recipients)
+}
+
+// GetPreferenceCenter returns the organization's preference center settings
+// GET /api/v1/settings/preference-center
+func (c *SettingsController) GetPreferenceCenter(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	settings, err := c.settingsService.GetPreferenceCenter(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, settings)
+}
+
+// UpdatePreferenceCenter updates the organization's preference center settings
+// PUT /api/v1/settings/preference-center
+func (c *SettingsController) UpdatePreferenceCenter(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change the preference center")
+		return
+	}
+
+	var req service.UpdatePreferenceCenterRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	settings, err := c.settingsService.UpdatePreferenceCenter(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Preference center updated", settings)
+}
+
+// GetAutomationLimits returns the organization's limits on automations
+// GET /api/v1/settings/automation-limits
+func (c *SettingsController) GetAutomationLimits(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	limits, err := c.settingsService.GetAutomationLimits(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, limits)
+}
+
+// UpdateAutomationLimits updates the organization's limits on automations
+// PUT /api/v1/settings/automation-limits
+func (c *SettingsController) UpdateAutomationLimits(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can change automation limits")
+		return
+	}
+
+	var req service.UpdateAutomationLimitsRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	limits, err := c.settingsService.UpdateAutomationLimits(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Automation limits updated", limits)
+}
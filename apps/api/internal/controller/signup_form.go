@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type SignupFormController struct {
+	formService *service.SignupFormService
+}
+
+func NewSignupFormController(formService *service.SignupFormService) *SignupFormController {
+	return &SignupFormController{formService: formService}
+}
+
+// List returns the organization's signup forms
+// GET /api/v1/forms
+func (c *SignupFormController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	forms, err := c.formService.List(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, forms)
+}
+
+// Get returns a signup form
+// GET /api/v1/forms/:uuid
+func (c *SignupFormController) Get(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	form, err := c.formService.Get(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, form)
+}
+
+// Create creates a signup form
+// POST /api/v1/forms
+func (c *SignupFormController) Create(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.CreateSignupFormRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	form, err := c.formService.Create(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Created(r, form)
+}
+
+// Update changes a signup form's settings
+// PUT /api/v1/forms/:uuid
+func (c *SignupFormController) Update(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.UpdateSignupFormRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	form, err := c.formService.Update(r.Context(), claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, form)
+}
+
+// Delete deletes a signup form
+// DELETE /api/v1/forms/:uuid
+func (c *SignupFormController) Delete(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if err := c.formService.Delete(r.Context(), claims.OrgID, r.Get("uuid").String()); err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Form deleted", nil)
+}
+
+// Submit takes a submission of a signup form, posted by an HTML form or as
+// JSON. HTML forms are redirected to the form's redirect URL when it has one.
+// POST /api/v1/forms/:uuid/submit
+func (c *SignupFormController) Submit(r *ghttp.Request) {
+	values := r.GetRequestMap()
+	delete(values, "uuid")
+
+	result, err := c.formService.Submit(r.Context(), r.Get("uuid").String(), &service.SignupSubmission{
+		Values:    values,
+		Origin:    r.Header.Get("Origin"),
+		IPAddress: r.GetClientIp(),
+		UserAgent: r.UserAgent(),
+	})
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	if result.RedirectURL != "" && !wantsJSON(r) {
+		r.Response.RedirectTo(result.RedirectURL, http.StatusSeeOther)
+		return
+	}
+	response.SuccessWithMessage(r, result.Message, result)
+}
+
+// wantsJSON reports whether a request was sent by a script rather than by a
+// browser submitting an HTML form
+func wantsJSON(r *ghttp.Request) bool {
+	return strings.Contains(r.Header.Get("Content-Type"), "json") ||
+		strings.Contains(r.Header.Get("Accept"), "application/json")
+}
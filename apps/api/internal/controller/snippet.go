@@ -0,0 +1,150 @@
+package controller
+
+import (
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+// SnippetController manages the canned responses inserted into emails being
+// composed
+type SnippetController struct {
+	snippetService *service.SnippetService
+}
+
+// NewSnippetController creates a new snippet controller
+func NewSnippetController(snippetService *service.SnippetService) *SnippetController {
+	return &SnippetController{snippetService: snippetService}
+}
+
+// List returns the user's and the org's snippets, most used first, optionally
+// only those whose name or shortcut starts with q
+// GET /api/v1/compose/snippets
+func (c *SnippetController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	snippets, err := c.snippetService.ListSnippets(r.Context(), claims.UserID, claims.OrgID, r.Get("q").String())
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, snippets)
+}
+
+// Get returns a snippet
+// GET /api/v1/compose/snippets/:uuid
+func (c *SnippetController) Get(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	snippet, err := c.snippetService.GetSnippet(r.Context(), claims.UserID, claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, snippet)
+}
+
+// Create adds a snippet
+// POST /api/v1/compose/snippets
+func (c *SnippetController) Create(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.CreateSnippetRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	snippet, err := c.snippetService.CreateSnippet(r.Context(), claims.UserID, claims.OrgID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Created(r, snippet)
+}
+
+// Update changes a snippet
+// PUT /api/v1/compose/snippets/:uuid
+func (c *SnippetController) Update(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.UpdateSnippetRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	isAdmin := claims.Role == "admin" || claims.Role == "owner"
+	snippet, err := c.snippetService.UpdateSnippet(r.Context(), claims.UserID, claims.OrgID, isAdmin, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Snippet updated", snippet)
+}
+
+// Delete removes a snippet
+// DELETE /api/v1/compose/snippets/:uuid
+func (c *SnippetController) Delete(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	isAdmin := claims.Role == "admin" || claims.Role == "owner"
+	if err := c.snippetService.DeleteSnippet(r.Context(), claims.UserID, claims.OrgID, isAdmin, r.Get("uuid").String()); err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Snippet deleted", nil)
+}
+
+// Render fills in a snippet's variables for the email being composed, ready
+// to insert
+// POST /api/v1/compose/snippets/:uuid/render
+func (c *SnippetController) Render(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.RenderSnippetRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	rendered, err := c.snippetService.RenderSnippet(r.Context(), claims.UserID, claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, rendered)
+}
@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type SubscriptionTopicController struct {
+	topicService *service.SubscriptionTopicService
+}
+
+func NewSubscriptionTopicController(topicService *service.SubscriptionTopicService) *SubscriptionTopicController {
+	return &SubscriptionTopicController{topicService: topicService}
+}
+
+// List returns the organization's subscription topics
+// GET /api/v1/topics
+func (c *SubscriptionTopicController) List(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	topics, err := c.topicService.List(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, topics)
+}
+
+// Get returns a subscription topic
+// GET /api/v1/topics/:uuid
+func (c *SubscriptionTopicController) Get(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	topic, err := c.topicService.Get(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, topic)
+}
+
+// Create creates a subscription topic
+// POST /api/v1/topics
+func (c *SubscriptionTopicController) Create(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.CreateSubscriptionTopicRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	topic, err := c.topicService.Create(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Created(r, topic)
+}
+
+// Update changes a subscription topic's name or description
+// PUT /api/v1/topics/:uuid
+func (c *SubscriptionTopicController) Update(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.UpdateSubscriptionTopicRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	topic, err := c.topicService.Update(r.Context(), claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, topic)
+}
+
+// Delete deletes a subscription topic and its opt-outs
+// DELETE /api/v1/topics/:uuid
+func (c *SubscriptionTopicController) Delete(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if err := c.topicService.Delete(r.Context(), claims.OrgID, r.Get("uuid").String()); err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Topic deleted", nil)
+}
+
+// ContactTopics returns whether a contact gets each subscription topic
+// GET /api/v1/contacts/:uuid/topics
+func (c *SubscriptionTopicController) ContactTopics(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	topics, err := c.topicService.ContactTopics(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.NotFound(r, err.Error())
+		return
+	}
+
+	response.Success(r, topics)
+}
+
+// UpdateContactTopics replaces the subscription topics a contact opted out of
+// PUT /api/v1/contacts/:uuid/topics
+func (c *SubscriptionTopicController) UpdateContactTopics(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.UpdateContactTopicsRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	topics, err := c.topicService.UpdateContactTopics(r.Context(), claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, topics)
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"github.com/gogf/gf/v2/net/ghttp"
+
+	"github.com/dublyo/mailat/api/internal/middleware"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/service"
+	"github.com/dublyo/mailat/api/pkg/response"
+)
+
+type SuppressionController struct {
+	suppressionService *service.SuppressionService
+}
+
+func NewSuppressionController(suppressionService *service.SuppressionService) *SuppressionController {
+	return &SuppressionController{suppressionService: suppressionService}
+}
+
+// Check reports which recipients of a planned send are suppressed and why
+// POST /api/v1/suppressions/check
+func (c *SuppressionController) Check(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.SuppressionCheckRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.suppressionService.Check(r.Context(), claims.OrgID, req.Emails)
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// Remove lifts the suppression of an address so it can be sent to again
+// DELETE /api/v1/suppressions/:email
+func (c *SuppressionController) Remove(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can remove suppressions")
+		return
+	}
+
+	removed, err := c.suppressionService.Remove(r.Context(), claims.OrgID, r.Get("email").String())
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+	if removed == 0 {
+		response.NotFound(r, "Address is not suppressed")
+		return
+	}
+
+	response.SuccessWithMessage(r, "Suppression removed", map[string]any{"removed": removed})
+}
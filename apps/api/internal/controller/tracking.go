@@ -2,9 +2,11 @@ package controller
 
 import (
 	"encoding/base64"
+	"strings"
 
 	"github.com/gogf/gf/v2/net/ghttp"
 
+	"github.com/dublyo/mailat/api/internal/model"
 	"github.com/dublyo/mailat/api/internal/service"
 )
 
@@ -38,7 +40,30 @@ func (c *TrackingController) TrackOpen(r *ghttp.Request) {
 	// Process the open event (fire and forget)
 	go c.trackingService.ProcessOpenEvent(r.Context(), token, ipAddress, userAgent)
 
-	// Return transparent 1x1 GIF
+	writeTrackingPixel(r)
+}
+
+// TrackConversion records a conversion reported by a campaign's conversion pixel
+// GET /api/v1/tracking/conversion/:token.gif?email=&value=&currency=&orderId=
+func (c *TrackingController) TrackConversion(r *ghttp.Request) {
+	token := strings.TrimSuffix(r.Get("token").String(), ".gif")
+	req := &model.RecordConversionRequest{
+		Email:    r.Get("email").String(),
+		Value:    r.Get("value").Float64(),
+		Currency: r.Get("currency").String(),
+		OrderID:  r.Get("orderId").String(),
+	}
+
+	// The pixel is loaded by the customer's browser, which has no use for errors
+	if req.Email != "" {
+		c.trackingService.RecordPixelConversion(r.Context(), token, req)
+	}
+
+	writeTrackingPixel(r)
+}
+
+// writeTrackingPixel returns a transparent 1x1 GIF that isn't cached
+func writeTrackingPixel(r *ghttp.Request) {
 	r.Response.Header().Set("Content-Type", "image/gif")
 	r.Response.Header().Set("Cache-Control", "no-store, no-cache, must-revalidate, proxy-revalidate")
 	r.Response.Header().Set("Pragma", "no-cache")
@@ -1,6 +1,9 @@
 package controller
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/gogf/gf/v2/net/ghttp"
 
 	"github.com/dublyo/mailat/api/internal/middleware"
@@ -28,7 +31,7 @@ func (c *TransactionalController) SendEmail(r *ghttp.Request) {
 
 	var req model.SendEmailRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -37,26 +40,58 @@ func (c *TransactionalController) SendEmail(r *ghttp.Request) {
 
 	// Validate at least one recipient
 	if len(req.To) == 0 {
-		response.BadRequest(r, "At least one recipient required")
+		response.FieldRequired(r, "to", "At least one recipient required")
 		return
 	}
 
 	// Validate body or template
 	if req.HTML == "" && req.Text == "" && req.TemplateID == "" {
-		response.BadRequest(r, "Email body or templateId required")
+		response.FieldRequired(r, "html", "Email body or templateId required")
 		return
 	}
 
-	result, err := c.transactionalService.SendEmail(r.Context(), claims.OrgID, &req)
+	result, err := c.transactionalService.SendEmail(r.Context(), claims.OrgID, claims.APIKeyID, &req)
 	if err != nil {
-		response.BadRequest(r, err.Error())
-		return
+		var supErr *service.SuppressedRecipientError
+		if errors.As(err, &supErr) {
+			response.FailWithData(r, err, map[string]any{
+				"suppressions": supErr.Suppressions,
+			})
+			return
+		}
+		var contentErr *service.ContentBlockedError
+		if errors.As(err, &contentErr) {
+			response.FailWithData(r, err, map[string]any{
+				"contentFindings": contentErr.Findings,
+			})
+			return
+		}
+		var dupErr *service.DuplicateSendError
+		if errors.As(err, &dupErr) {
+			response.FailWithData(r, err, map[string]any{
+				"duplicateRecipients": dupErr.Recipients,
+				"previousEmailId":     dupErr.EmailID,
+			})
+			return
+		}
+		response.Fail(r, err)
+		return
+	}
+
+	// Content guard findings of an org that only warns
+	if len(result.ContentWarnings) > 0 {
+		checks := make([]string, len(result.ContentWarnings))
+		for i, f := range result.ContentWarnings {
+			checks[i] = f.Check
+		}
+		r.Response.Header().Set("X-Content-Warnings", strings.Join(checks, ","))
 	}
 
 	response.SuccessWithMessage(r, "Email queued", result)
 }
 
-// BatchSendEmail sends multiple emails in batch
+// BatchSendEmail validates a batch of up to 1,000 emails and queues it for sending.
+// Results are polled with GetBatch.
 // POST /api/v1/emails/batch
 func (c *TransactionalController) BatchSendEmail(r *ghttp.Request) {
 	claims := middleware.GetClaims(r)
@@ -67,18 +102,42 @@ func (c *TransactionalController) BatchSendEmail(r *ghttp.Request) {
 
 	var req model.BatchSendRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
 	if len(req.Emails) == 0 {
-		response.BadRequest(r, "At least one email required")
+		response.FieldRequired(r, "emails", "At least one email required")
 		return
 	}
 
-	result, err := c.transactionalService.BatchSendEmail(r.Context(), claims.OrgID, &req)
+	result, err := c.transactionalService.BatchSendEmail(r.Context(), claims.OrgID, claims.APIKeyID, &req)
 	if err != nil {
-		response.BadRequest(r, err.Error())
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Batch queued", result)
+}
+
+// GetBatch returns the progress of a batch and a result per email
+// GET /api/v1/emails/batches/:id
+func (c *TransactionalController) GetBatch(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	batchID := r.Get("id").String()
+	if batchID == "" {
+		response.BadRequest(r, "Batch ID required")
+		return
+	}
+
+	result, err := c.transactionalService.GetBatch(r.Context(), claims.OrgID, batchID)
+	if err != nil {
+		response.Fail(r, err)
 		return
 	}
 
@@ -102,7 +161,7 @@ func (c *TransactionalController) GetEmailStatus(r *ghttp.Request) {
 
 	result, err := c.transactionalService.GetEmailStatus(r.Context(), claims.OrgID, emailID)
 	if err != nil {
-		response.NotFound(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -126,13 +185,99 @@ func (c *TransactionalController) CancelEmail(r *ghttp.Request) {
 
 	err := c.transactionalService.CancelEmail(r.Context(), claims.OrgID, emailID)
 	if err != nil {
-		response.BadRequest(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
 	response.SuccessWithMessage(r, "Email cancelled", nil)
 }
 
+// ListHeldEmails lists emails held for review while their sender domain is on probation
+// GET /api/v1/emails/held
+func (c *TransactionalController) ListHeldEmails(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	// Only admins and owners can review held emails
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can review held emails")
+		return
+	}
+
+	emails, err := c.transactionalService.ListHeldEmails(r.Context(), claims.OrgID)
+	if err != nil {
+		response.InternalError(r, err.Error())
+		return
+	}
+
+	response.Success(r, emails)
+}
+
+// ApproveHeldEmail releases a held email for delivery
+// POST /api/v1/emails/:id/approve
+func (c *TransactionalController) ApproveHeldEmail(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can review held emails")
+		return
+	}
+
+	emailID := r.Get("id").String()
+	if emailID == "" {
+		response.BadRequest(r, "Email ID required")
+		return
+	}
+
+	if err := c.transactionalService.ApproveHeldEmail(r.Context(), claims.OrgID, claims.UserID, emailID); err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Email approved for delivery", nil)
+}
+
+// RejectHeldEmail rejects a held email so it is never sent
+// POST /api/v1/emails/:id/reject
+func (c *TransactionalController) RejectHeldEmail(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if claims.Role != "admin" && claims.Role != "owner" {
+		response.Forbidden(r, "Only admins can review held emails")
+		return
+	}
+
+	emailID := r.Get("id").String()
+	if emailID == "" {
+		response.BadRequest(r, "Email ID required")
+		return
+	}
+
+	var req model.RejectEmailRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	if err := c.transactionalService.RejectHeldEmail(r.Context(), claims.OrgID, claims.UserID, emailID, req.Reason); err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.SuccessWithMessage(r, "Email rejected", nil)
+}
+
 // Template endpoints
 
 // CreateTemplate creates a new email template
@@ -146,13 +291,13 @@ func (c *TransactionalController) CreateTemplate(r *ghttp.Request) {
 
 	var req model.CreateTemplateRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
 	template, err := c.transactionalService.CreateTemplate(r.Context(), claims.OrgID, &req)
 	if err != nil {
-		response.BadRequest(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -176,7 +321,7 @@ func (c *TransactionalController) GetTemplate(r *ghttp.Request) {
 
 	template, err := c.transactionalService.GetTemplate(r.Context(), claims.OrgID, templateUUID)
 	if err != nil {
-		response.NotFound(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -218,13 +363,13 @@ func (c *TransactionalController) UpdateTemplate(r *ghttp.Request) {
 
 	var req model.UpdateTemplateRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
 	template, err := c.transactionalService.UpdateTemplate(r.Context(), claims.OrgID, templateUUID, &req)
 	if err != nil {
-		response.BadRequest(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -248,7 +393,7 @@ func (c *TransactionalController) DeleteTemplate(r *ghttp.Request) {
 
 	err := c.transactionalService.DeleteTemplate(r.Context(), claims.OrgID, templateUUID)
 	if err != nil {
-		response.NotFound(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
@@ -272,15 +417,322 @@ func (c *TransactionalController) PreviewTemplate(r *ghttp.Request) {
 
 	var req model.PreviewTemplateRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
 	preview, err := c.transactionalService.PreviewTemplate(r.Context(), claims.OrgID, templateUUID, req.Variables)
 	if err != nil {
-		response.NotFound(r, err.Error())
+		response.Fail(r, err)
 		return
 	}
 
 	response.Success(r, preview)
 }
+
+// RenderDesign renders a drag-and-drop block design to the HTML body a template saved
+// with it would get
+// POST /api/v1/templates/render-design
+func (c *TransactionalController) RenderDesign(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.RenderDesignRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.transactionalService.RenderDesign(req.Design)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// ExportTemplates bundles templates and the partials they include for import into
+// another organization or environment
+// POST /api/v1/templates/export
+func (c *TransactionalController) ExportTemplates(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.ExportTemplatesRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	bundle, err := c.transactionalService.ExportTemplates(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, bundle)
+}
+
+// ImportTemplates imports a template bundle, handling names that are taken as the
+// request asks
+// POST /api/v1/templates/import
+func (c *TransactionalController) ImportTemplates(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.ImportTemplatesRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.transactionalService.ImportTemplates(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	if req.DryRun {
+		response.Success(r, result)
+		return
+	}
+	response.SuccessWithMessage(r, "Templates imported", result)
+}
+
+// ListPartials returns the template partials of the organization, built-in ones included
+// GET /api/v1/template-partials
+func (c *TransactionalController) ListPartials(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	partials, err := c.transactionalService.ListPartials(r.Context(), claims.OrgID)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, partials)
+}
+
+// GetPartial returns a template partial
+// GET /api/v1/template-partials/:uuid
+func (c *TransactionalController) GetPartial(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	partial, err := c.transactionalService.GetPartial(r.Context(), claims.OrgID, r.Get("uuid").String())
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, partial)
+}
+
+// CreatePartial creates a template partial
+// POST /api/v1/template-partials
+func (c *TransactionalController) CreatePartial(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.CreateTemplatePartialRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	partial, err := c.transactionalService.CreatePartial(r.Context(), claims.OrgID, &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Partial created", partial)
+}
+
+// UpdatePartial updates a template partial
+// PUT /api/v1/template-partials/:uuid
+func (c *TransactionalController) UpdatePartial(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	var req model.UpdateTemplatePartialRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	partial, err := c.transactionalService.UpdatePartial(r.Context(), claims.OrgID, r.Get("uuid").String(), &req)
+	if err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Partial updated", partial)
+}
+
+// DeletePartial deletes a template partial
+// DELETE /api/v1/template-partials/:uuid
+func (c *TransactionalController) DeletePartial(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	if err := c.transactionalService.DeletePartial(r.Context(), claims.OrgID, r.Get("uuid").String()); err != nil {
+		response.Fail(r, err)
+		return
+	}
+
+	response.SuccessWithMessage(r, "Partial deleted", nil)
+}
+
+// TestSendTemplate sends a template to allowlisted addresses as test traffic
+// POST /api/v1/templates/:uuid/test-send
+func (c *TransactionalController) TestSendTemplate(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	templateUUID := r.Get("uuid").String()
+	if templateUUID == "" {
+		response.BadRequest(r, "Template UUID required")
+		return
+	}
+
+	var req model.TestSendTemplateRequest
+	if err := r.Parse(&req); err != nil {
+		response.ValidationFailed(r, err)
+		return
+	}
+
+	result, err := c.transactionalService.TestSendTemplate(r.Context(), claims.OrgID, claims.APIKeyID, templateUUID, &req)
+	if err != nil {
+		var supErr *service.SuppressedRecipientError
+		if errors.As(err, &supErr) {
+			response.FailWithData(r, err, map[string]any{
+				"suppressions": supErr.Suppressions,
+			})
+			return
+		}
+		var contentErr *service.ContentBlockedError
+		if errors.As(err, &contentErr) {
+			response.FailWithData(r, err, map[string]any{
+				"contentFindings": contentErr.Findings,
+			})
+			return
+		}
+		response.Fail(r, err)
+		return
+	}
+
+	response.Success(r, result)
+}
+
+// GetStatsByTag returns delivery/engagement rates grouped by tag
+// GET /api/v1/emails/stats/tags
+func (c *TransactionalController) GetStatsByTag(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	stats, err := c.transactionalService.GetStatsByTag(r.Context(), claims.OrgID, parseEmailStatsQuery(r))
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, stats)
+}
+
+// GetStatsByTemplate returns delivery/engagement rates grouped by template
+// GET /api/v1/emails/stats/templates
+func (c *TransactionalController) GetStatsByTemplate(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	stats, err := c.transactionalService.GetStatsByTemplate(r.Context(), claims.OrgID, parseEmailStatsQuery(r))
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, stats)
+}
+
+// GetStatsBySender returns volume and delivery rates per sending identity
+// GET /api/v1/emails/stats/senders?key=pool-name
+func (c *TransactionalController) GetStatsBySender(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	stats, err := c.transactionalService.GetStatsBySender(r.Context(), claims.OrgID, parseEmailStatsQuery(r))
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, stats)
+}
+
+// GetStatsByMetadata returns delivery/engagement rates grouped by the values of a metadata key
+// GET /api/v1/emails/stats/metadata?key=plan
+func (c *TransactionalController) GetStatsByMetadata(r *ghttp.Request) {
+	claims := middleware.GetClaims(r)
+	if claims == nil {
+		response.Unauthorized(r, "Not authenticated")
+		return
+	}
+
+	stats, err := c.transactionalService.GetStatsByMetadata(r.Context(), claims.OrgID, parseEmailStatsQuery(r))
+	if err != nil {
+		response.BadRequest(r, err.Error())
+		return
+	}
+
+	response.Success(r, stats)
+}
+
+// parseEmailStatsQuery reads the shared time window and grouping query parameters
+func parseEmailStatsQuery(r *ghttp.Request) *model.EmailStatsQuery {
+	return &model.EmailStatsQuery{
+		From:     r.GetQuery("from", "").String(),
+		To:       r.GetQuery("to", "").String(),
+		Interval: r.GetQuery("interval", "").String(),
+		Key:      r.GetQuery("key", "").String(),
+		Limit:    r.GetQuery("limit", 50).Int(),
+	}
+}
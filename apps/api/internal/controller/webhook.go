@@ -30,7 +30,7 @@ func (c *WebhookController) CreateWebhook(r *ghttp.Request) {
 
 	var req model.CreateWebhookRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -43,6 +43,9 @@ func (c *WebhookController) CreateWebhook(r *ghttp.Request) {
 		"email.opened":     true,
 		"email.clicked":    true,
 		"email.failed":     true,
+		"email.held":       true,
+		"email.released":   true,
+		"email.rejected":   true,
 	}
 
 	for _, event := range req.Events {
@@ -120,7 +123,7 @@ func (c *WebhookController) UpdateWebhook(r *ghttp.Request) {
 
 	var req model.UpdateWebhookRequest
 	if err := r.Parse(&req); err != nil {
-		response.BadRequest(r, err.Error())
+		response.ValidationFailed(r, err)
 		return
 	}
 
@@ -74,6 +74,9 @@ CREATE TABLE IF NOT EXISTS api_keys (
 	key_hash VARCHAR(255) NOT NULL,
 	permissions TEXT[] DEFAULT '{}',
 	rate_limit INT DEFAULT 100,
+	allowed_domains TEXT[] DEFAULT '{}',
+	required_tag_prefixes TEXT[] DEFAULT '{}',
+	daily_send_limit INT DEFAULT 0,
 	last_used_at TIMESTAMPTZ(6),
 	expires_at TIMESTAMPTZ(6),
 	created_at TIMESTAMPTZ(6) DEFAULT NOW()
@@ -112,6 +115,8 @@ CREATE TABLE IF NOT EXISTS domains (
 	receiving_rule_set_name VARCHAR(255),
 	receiving_rule_name VARCHAR(255),
 	receiving_setup_at TIMESTAMPTZ(6),
+	probation_sent_count INT DEFAULT 0,
+	probation_cleared_at TIMESTAMPTZ(6),
 	UNIQUE(org_id, name)
 );
 
@@ -138,6 +143,7 @@ CREATE TABLE IF NOT EXISTS identities (
 	display_name VARCHAR(255),
 	signature_html TEXT,
 	signature_text TEXT,
+	signature_position VARCHAR(20) DEFAULT 'below_reply',
 	is_default BOOLEAN DEFAULT false,
 	can_send BOOLEAN DEFAULT true,
 	can_receive BOOLEAN DEFAULT true,
@@ -154,6 +160,89 @@ CREATE TABLE IF NOT EXISTS identities (
 CREATE INDEX IF NOT EXISTS idx_identities_stalwart ON identities(stalwart_account_id);
 CREATE INDEX IF NOT EXISTS idx_identities_domain_catchall ON identities(domain_id, is_catch_all);
 
+-- Identity App Passwords: what mail apps sign in to an identity's IMAP and
+-- SMTP with, one per device so each can be revoked on its own
+CREATE TABLE IF NOT EXISTS identity_app_passwords (
+	id SERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	identity_id INT NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	password_prefix VARCHAR(10) NOT NULL,
+	encrypted_secret TEXT NOT NULL,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	revoked_at TIMESTAMPTZ(6)
+);
+CREATE INDEX IF NOT EXISTS idx_identity_app_passwords_identity ON identity_app_passwords(identity_id);
+
+-- Compose Sends: emails held for the sender's undo send delay before they go
+-- out, so they can still be cancelled, or scheduled to be sent later
+CREATE TABLE IF NOT EXISTS compose_sends (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	user_id INT NOT NULL,
+	identity_id INT NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+	email JSONB NOT NULL,
+	status VARCHAR(20) DEFAULT 'pending',
+	scheduled BOOLEAN DEFAULT false,
+	send_at TIMESTAMPTZ(6) NOT NULL,
+	result JSONB,
+	error TEXT,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_compose_sends_user ON compose_sends(user_id);
+CREATE INDEX IF NOT EXISTS idx_compose_sends_identity ON compose_sends(identity_id);
+
+-- Recent Recipients: whom each user has sent to, for address suggestions
+CREATE TABLE IF NOT EXISTS recent_recipients (
+	id BIGSERIAL PRIMARY KEY,
+	user_id INT NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	name VARCHAR(255),
+	send_count INT NOT NULL DEFAULT 0,
+	last_sent_at TIMESTAMPTZ(6) NOT NULL DEFAULT NOW(),
+	UNIQUE(user_id, email)
+);
+
+-- Compose Snippets: canned responses inserted into emails being composed.
+-- Personal ones are their author's, org ones shared with the organization.
+CREATE TABLE IF NOT EXISTS compose_snippets (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	user_id INT NOT NULL,
+	scope VARCHAR(20) NOT NULL DEFAULT 'personal',
+	name VARCHAR(100) NOT NULL,
+	shortcut VARCHAR(50),
+	subject VARCHAR(998),
+	text_body TEXT,
+	html_body TEXT,
+	use_count INT NOT NULL DEFAULT 0,
+	last_used_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_compose_snippets_user ON compose_snippets(user_id);
+CREATE INDEX IF NOT EXISTS idx_compose_snippets_org ON compose_snippets(org_id, scope);
+
+-- Compose Attachments: files uploaded for an identity's emails, by checksum so
+-- the same file isn't uploaded twice. blob_id is the Stalwart blob, or the
+-- attachments bucket key when sending through SES.
+CREATE TABLE IF NOT EXISTS compose_attachments (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	user_id INT NOT NULL,
+	identity_id INT NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+	storage VARCHAR(10) NOT NULL,
+	checksum VARCHAR(64) NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	content_type VARCHAR(255) NOT NULL,
+	size INT NOT NULL,
+	blob_id VARCHAR(500) NOT NULL,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_compose_attachments_checksum ON compose_attachments(identity_id, storage, checksum, created_at DESC);
+
 -- Contacts
 CREATE TABLE IF NOT EXISTS contacts (
 	id BIGSERIAL PRIMARY KEY,
@@ -170,11 +259,180 @@ CREATE TABLE IF NOT EXISTS contacts (
 	consent_user_agent TEXT,
 	last_engaged_at TIMESTAMPTZ(6),
 	engagement_score DOUBLE PRECISION DEFAULT 0,
+	verification_status VARCHAR(20),
+	verification_reasons TEXT[],
+	verified_at TIMESTAMPTZ(6),
+	tags TEXT[] DEFAULT '{}',
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	UNIQUE(org_id, email)
 );
 CREATE INDEX IF NOT EXISTS idx_contacts_org_status ON contacts(org_id, status);
+CREATE INDEX IF NOT EXISTS idx_contacts_tags ON contacts USING GIN(tags);
+
+-- Contact Bulk Jobs (operations on every contact of a segment or filter)
+CREATE TABLE IF NOT EXISTS contact_bulk_jobs (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	requested_by INT,
+	operation VARCHAR(30) NOT NULL,
+	spec JSONB NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	total INT DEFAULT 0,
+	processed INT DEFAULT 0,
+	affected INT DEFAULT 0,
+	last_contact_id BIGINT DEFAULT 0,
+	error TEXT,
+	started_at TIMESTAMPTZ(6),
+	completed_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_contact_bulk_jobs_org ON contact_bulk_jobs(org_id, created_at DESC);
+
+-- Contact Events (custom events like a purchase or a login, recorded through the API)
+CREATE TABLE IF NOT EXISTS contact_events (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	contact_id BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	properties JSONB DEFAULT '{}',
+	api_key_id INT,
+	occurred_at TIMESTAMPTZ(6) NOT NULL DEFAULT NOW(),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_contact_events_contact ON contact_events(contact_id, name, occurred_at DESC);
+CREATE INDEX IF NOT EXISTS idx_contact_events_org ON contact_events(org_id, name, occurred_at DESC);
+
+-- Contact Changes (history of changes to contacts' fields and attributes, and what made them)
+CREATE TABLE IF NOT EXISTS contact_changes (
+	id BIGSERIAL PRIMARY KEY,
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	contact_id BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+	field VARCHAR(255) NOT NULL,
+	old_value JSONB,
+	new_value JSONB,
+	source VARCHAR(30) NOT NULL,
+	source_id VARCHAR(100),
+	user_id INT,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_contact_changes_contact ON contact_changes(contact_id, created_at DESC);
+
+-- CRM Connections (an org's HubSpot or Salesforce account, which its contacts sync with)
+CREATE TABLE IF NOT EXISTS crm_connections (
+	id SERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	provider VARCHAR(20) NOT NULL,
+	account_id VARCHAR(100),
+	instance_url VARCHAR(500),
+	access_token TEXT NOT NULL,
+	refresh_token TEXT NOT NULL,
+	token_expires_at TIMESTAMPTZ(6),
+	field_mappings JSONB NOT NULL DEFAULT '[]',
+	push_enabled BOOLEAN NOT NULL DEFAULT true,
+	pull_enabled BOOLEAN NOT NULL DEFAULT true,
+	status VARCHAR(20) NOT NULL DEFAULT 'active',
+	last_error TEXT,
+	pushed_until TIMESTAMPTZ(6),
+	pulled_until TIMESTAMPTZ(6),
+	last_synced_at TIMESTAMPTZ(6),
+	connected_by INT,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(org_id, provider)
+);
+
+-- CRM Sync Runs (each push and pull of a CRM connection)
+CREATE TABLE IF NOT EXISTS crm_sync_runs (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	connection_id INT NOT NULL REFERENCES crm_connections(id) ON DELETE CASCADE,
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	trigger VARCHAR(20) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	pushed INT NOT NULL DEFAULT 0,
+	pulled INT NOT NULL DEFAULT 0,
+	failed INT NOT NULL DEFAULT 0,
+	error TEXT,
+	started_at TIMESTAMPTZ(6),
+	completed_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_crm_sync_runs_connection ON crm_sync_runs(connection_id, created_at DESC);
+
+-- Signup Forms (public forms that subscribe contacts to lists)
+CREATE TABLE IF NOT EXISTS signup_forms (
+	id SERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	name VARCHAR(255) NOT NULL,
+	list_ids INT[] NOT NULL DEFAULT '{}',
+	fields TEXT[] DEFAULT '{}',
+	allowed_origins TEXT[] DEFAULT '{}',
+	honeypot_field VARCHAR(100),
+	turnstile_secret TEXT,
+	redirect_url TEXT,
+	success_message TEXT,
+	rate_limit INT DEFAULT 10,
+	active BOOLEAN DEFAULT true,
+	submission_count INT DEFAULT 0,
+	last_submitted_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_signup_forms_org ON signup_forms(org_id);
+
+-- Subscription Topics (kinds of email contacts can opt out of one by one)
+CREATE TABLE IF NOT EXISTS subscription_topics (
+	id SERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(org_id, name)
+);
+
+-- Contact Topic Opt-outs (contacts get every topic they haven't opted out of)
+CREATE TABLE IF NOT EXISTS contact_topic_optouts (
+	contact_id BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+	topic_id INT NOT NULL REFERENCES subscription_topics(id) ON DELETE CASCADE,
+	source VARCHAR(50),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	PRIMARY KEY (contact_id, topic_id)
+);
+CREATE INDEX IF NOT EXISTS idx_contact_topic_optouts_topic ON contact_topic_optouts(topic_id);
+
+-- Contact Engagement Scores (a contact's score each time it changed)
+CREATE TABLE IF NOT EXISTS contact_engagement_scores (
+	id BIGSERIAL PRIMARY KEY,
+	contact_id BIGINT NOT NULL REFERENCES contacts(id) ON DELETE CASCADE,
+	org_id INT NOT NULL,
+	score DOUBLE PRECISION NOT NULL,
+	computed_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_contact_engagement_scores ON contact_engagement_scores(contact_id, computed_at DESC);
+CREATE INDEX IF NOT EXISTS idx_contact_engagement_scores_org ON contact_engagement_scores(org_id, computed_at);
+
+-- Contact Fields (typed custom attributes of an org's contacts)
+CREATE TABLE IF NOT EXISTS contact_fields (
+	id SERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	key VARCHAR(100) NOT NULL,
+	label VARCHAR(255) NOT NULL,
+	type VARCHAR(20) NOT NULL,
+	options TEXT[],
+	required BOOLEAN NOT NULL DEFAULT false,
+	description TEXT,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(org_id, key)
+);
 
 -- Lists
 CREATE TABLE IF NOT EXISTS lists (
@@ -185,7 +443,9 @@ CREATE TABLE IF NOT EXISTS lists (
 	description TEXT,
 	type VARCHAR(50) DEFAULT 'static',
 	segment_rules JSONB,
+	segment_refreshed_at TIMESTAMPTZ(6),
 	contact_count INT DEFAULT 0,
+	settings JSONB DEFAULT '{}',
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
 );
@@ -199,6 +459,19 @@ CREATE TABLE IF NOT EXISTS list_contacts (
 	UNIQUE(list_id, contact_id)
 );
 
+-- List Events (contacts joining and leaving lists, and members churning, with what caused it)
+CREATE TABLE IF NOT EXISTS list_events (
+	id BIGSERIAL PRIMARY KEY,
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	list_id INT NOT NULL REFERENCES lists(id) ON DELETE CASCADE,
+	contact_id BIGINT REFERENCES contacts(id) ON DELETE SET NULL,
+	event VARCHAR(20) NOT NULL,
+	source VARCHAR(30) NOT NULL,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_list_events_list ON list_events(list_id, created_at);
+CREATE INDEX IF NOT EXISTS idx_list_events_contact ON list_events(contact_id);
+
 -- Campaigns
 CREATE TABLE IF NOT EXISTS campaigns (
 	id SERIAL PRIMARY KEY,
@@ -215,6 +488,7 @@ CREATE TABLE IF NOT EXISTS campaigns (
 	list_id INT NOT NULL,
 	status VARCHAR(50) DEFAULT 'draft',
 	scheduled_at TIMESTAMPTZ(6),
+	scheduled_local_at TIMESTAMP(6),
 	started_at TIMESTAMPTZ(6),
 	completed_at TIMESTAMPTZ(6),
 	total_recipients INT DEFAULT 0,
@@ -225,11 +499,94 @@ CREATE TABLE IF NOT EXISTS campaigns (
 	bounce_count INT DEFAULT 0,
 	unsubscribe_count INT DEFAULT 0,
 	complaint_count INT DEFAULT 0,
+	failed_count INT DEFAULT 0,
 	is_ab_test BOOLEAN DEFAULT false,
 	ab_test_settings JSONB,
+	parent_campaign_id INT REFERENCES campaigns(id) ON DELETE SET NULL,
+	resend_settings JSONB,
+	throttle_settings JSONB,
+	ignore_sending_window BOOLEAN DEFAULT false,
+	send_time_settings JSONB,
+	audience JSONB,
+	utm_settings JSONB,
+	suppression_settings JSONB,
+	archived_at TIMESTAMPTZ(6),
+	snapshot_at TIMESTAMPTZ(6),
+	dispatch_run UUID,
+	dispatch_due_at TIMESTAMPTZ(6),
+	content_snapshot_id BIGINT,
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
 );
+CREATE INDEX IF NOT EXISTS idx_campaigns_parent ON campaigns(parent_campaign_id);
+
+-- Campaign Recipients (snapshot of who a campaign goes to, taken when it starts sending)
+CREATE TABLE IF NOT EXISTS campaign_recipients (
+	id BIGSERIAL PRIMARY KEY,
+	campaign_id INT NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+	org_id INT NOT NULL,
+	contact_id BIGINT NOT NULL,
+	email VARCHAR(255) NOT NULL,
+	domain VARCHAR(255) NOT NULL,
+	status VARCHAR(20) DEFAULT 'pending',
+	email_id BIGINT,
+	error TEXT,
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	sent_at TIMESTAMPTZ(6),
+	send_after TIMESTAMPTZ(6),
+	UNIQUE(campaign_id, contact_id)
+);
+CREATE INDEX IF NOT EXISTS idx_campaign_recipients_status ON campaign_recipients(campaign_id, status);
+CREATE INDEX IF NOT EXISTS idx_campaign_recipients_org ON campaign_recipients(org_id, status, sent_at);
+
+-- Campaign inbox previews, one per campaign and email client
+CREATE TABLE IF NOT EXISTS campaign_previews (
+	id BIGSERIAL PRIMARY KEY,
+	campaign_id INT NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+	client VARCHAR(50) NOT NULL,
+	status VARCHAR(20) NOT NULL,
+	image_url TEXT,
+	image_data BYTEA,
+	content_type VARCHAR(100),
+	error TEXT,
+	content_hash VARCHAR(64) NOT NULL,
+	rendered_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(campaign_id, client)
+);
+
+-- Content of a campaign as it was when scheduled or sent, kept for audits
+CREATE TABLE IF NOT EXISTS campaign_snapshots (
+	id BIGSERIAL PRIMARY KEY,
+	campaign_id INT NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+	reason VARCHAR(20) NOT NULL,
+	subject VARCHAR(500) NOT NULL,
+	html_content TEXT,
+	text_content TEXT,
+	from_name VARCHAR(255) NOT NULL,
+	from_email VARCHAR(255) NOT NULL,
+	reply_to VARCHAR(255),
+	template_id INT,
+	template_name VARCHAR(255),
+	template_updated_at TIMESTAMPTZ(6),
+	content_hash VARCHAR(64) NOT NULL,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_campaign_snapshots_campaign ON campaign_snapshots(campaign_id, created_at DESC);
+
+-- Campaign conversions reported by the org, attributed to a recipient of the campaign
+CREATE TABLE IF NOT EXISTS campaign_conversions (
+	id BIGSERIAL PRIMARY KEY,
+	campaign_id INT NOT NULL REFERENCES campaigns(id) ON DELETE CASCADE,
+	contact_id BIGINT NOT NULL,
+	email_id BIGINT,
+	value NUMERIC(14,2) NOT NULL DEFAULT 0,
+	currency VARCHAR(3),
+	order_id VARCHAR(255),
+	source VARCHAR(20) NOT NULL,
+	occurred_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(campaign_id, order_id)
+);
+CREATE INDEX IF NOT EXISTS idx_campaign_conversions_contact ON campaign_conversions(campaign_id, contact_id);
 
 -- Templates
 CREATE TABLE IF NOT EXISTS templates (
@@ -261,6 +618,7 @@ CREATE TABLE IF NOT EXISTS transactional_emails (
 	subject VARCHAR(500) NOT NULL,
 	html_body TEXT,
 	text_body TEXT,
+	amp_body TEXT,
 	template_id INT,
 	tags TEXT,
 	metadata TEXT,
@@ -272,7 +630,15 @@ CREATE TABLE IF NOT EXISTS transactional_emails (
 	clicked_at TIMESTAMPTZ(6),
 	bounced_at TIMESTAMPTZ(6),
 	bounce_type VARCHAR(20),
+	bounce_class VARCHAR(20),
 	bounce_reason TEXT,
+	hold_reason TEXT,
+	reviewed_at TIMESTAMPTZ(6),
+	reviewed_by INT,
+	content_archived_at TIMESTAMPTZ(6),
+	sender_pool VARCHAR(100),
+	api_key_id INT,
+	is_test BOOLEAN NOT NULL DEFAULT false,
 	idempotency_key VARCHAR(255),
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
@@ -283,6 +649,78 @@ CREATE INDEX IF NOT EXISTS idx_trans_emails_org ON transactional_emails(org_id,
 CREATE INDEX IF NOT EXISTS idx_trans_emails_status ON transactional_emails(status);
 CREATE INDEX IF NOT EXISTS idx_trans_emails_idempotency ON transactional_emails(idempotency_key);
 CREATE INDEX IF NOT EXISTS idx_trans_emails_provider ON transactional_emails(provider_message_id);
+CREATE INDEX IF NOT EXISTS idx_trans_emails_from_sent ON transactional_emails(org_id, from_address, sent_at);
+CREATE INDEX IF NOT EXISTS idx_trans_emails_template ON transactional_emails(org_id, template_id);
+CREATE INDEX IF NOT EXISTS idx_trans_emails_api_key ON transactional_emails(api_key_id, created_at);
+
+-- Transactional Email Recipients (per-recipient delivery state)
+CREATE TABLE IF NOT EXISTS transactional_email_recipients (
+	id BIGSERIAL PRIMARY KEY,
+	email_id BIGINT NOT NULL REFERENCES transactional_emails(id) ON DELETE CASCADE,
+	email VARCHAR(255) NOT NULL,
+	type VARCHAR(10) NOT NULL DEFAULT 'to',
+	status VARCHAR(50) DEFAULT 'queued',
+	delivered_at TIMESTAMPTZ(6),
+	opened_at TIMESTAMPTZ(6),
+	clicked_at TIMESTAMPTZ(6),
+	bounced_at TIMESTAMPTZ(6),
+	bounce_class VARCHAR(20),
+	bounce_reason TEXT,
+	complained_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(email_id, email, type)
+);
+CREATE INDEX IF NOT EXISTS idx_trans_recipients_email ON transactional_email_recipients(email);
+
+-- Transactional Attachments (pre-uploaded to S3, reusable across sends)
+CREATE TABLE IF NOT EXISTS transactional_attachments (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL,
+	filename VARCHAR(255) NOT NULL,
+	content_type VARCHAR(255) NOT NULL,
+	size INT NOT NULL,
+	checksum VARCHAR(64) NOT NULL,
+	storage_key VARCHAR(500) NOT NULL,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(org_id, checksum, filename, content_type)
+);
+
+CREATE TABLE IF NOT EXISTS transactional_email_attachments (
+	id BIGSERIAL PRIMARY KEY,
+	email_id BIGINT NOT NULL REFERENCES transactional_emails(id) ON DELETE CASCADE,
+	attachment_id BIGINT NOT NULL REFERENCES transactional_attachments(id),
+	position INT NOT NULL DEFAULT 0,
+	content_id VARCHAR(255),
+	UNIQUE(email_id, attachment_id)
+);
+CREATE INDEX IF NOT EXISTS idx_trans_email_attachments_attachment ON transactional_email_attachments(attachment_id);
+
+-- Transactional Batches (entries are sent by a worker job and polled for results)
+CREATE TABLE IF NOT EXISTS transactional_batches (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL,
+	api_key_id INT,
+	status VARCHAR(20) DEFAULT 'queued',
+	total INT NOT NULL DEFAULT 0,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	started_at TIMESTAMPTZ(6),
+	completed_at TIMESTAMPTZ(6)
+);
+CREATE INDEX IF NOT EXISTS idx_trans_batches_org ON transactional_batches(org_id, created_at DESC);
+
+CREATE TABLE IF NOT EXISTS transactional_batch_items (
+	id BIGSERIAL PRIMARY KEY,
+	batch_id BIGINT NOT NULL REFERENCES transactional_batches(id) ON DELETE CASCADE,
+	position INT NOT NULL,
+	request JSONB,
+	status VARCHAR(20) DEFAULT 'pending',
+	result JSONB,
+	processed_at TIMESTAMPTZ(6),
+	UNIQUE(batch_id, position)
+);
 
 -- Transactional Templates
 CREATE TABLE IF NOT EXISTS email_templates (
@@ -294,13 +732,31 @@ CREATE TABLE IF NOT EXISTS email_templates (
 	subject VARCHAR(500) NOT NULL,
 	html_body TEXT NOT NULL,
 	text_body TEXT,
+	amp_body TEXT,
+	mjml_source TEXT,
+	design JSONB,
 	variables TEXT,
+	variable_schema JSONB,
+	use_layout BOOLEAN NOT NULL DEFAULT true,
 	is_active BOOLEAN DEFAULT true,
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
 );
 CREATE INDEX IF NOT EXISTS idx_email_templates_org ON email_templates(org_id);
 
+-- Template Partials
+CREATE TABLE IF NOT EXISTS template_partials (
+	id SERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	name VARCHAR(100) NOT NULL,
+	description TEXT,
+	content TEXT NOT NULL,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(org_id, name)
+);
+
 -- Transactional Delivery Events
 CREATE TABLE IF NOT EXISTS transactional_delivery_events (
 	id BIGSERIAL PRIMARY KEY,
@@ -312,6 +768,7 @@ CREATE TABLE IF NOT EXISTS transactional_delivery_events (
 	created_at TIMESTAMPTZ(6) DEFAULT NOW()
 );
 CREATE INDEX IF NOT EXISTS idx_trans_delivery_email ON transactional_delivery_events(email_id, created_at DESC);
+CREATE INDEX IF NOT EXISTS idx_trans_delivery_created ON transactional_delivery_events(created_at);
 
 -- Emails (marketing/campaign)
 CREATE TABLE IF NOT EXISTS emails (
@@ -332,6 +789,7 @@ CREATE TABLE IF NOT EXISTS emails (
 	source VARCHAR(50) DEFAULT 'api',
 	domain_id INT NOT NULL,
 	campaign_id INT,
+	automation_id INT,
 	template_id INT,
 	contact_id BIGINT,
 	tags TEXT[] DEFAULT '{}',
@@ -353,6 +811,8 @@ CREATE INDEX IF NOT EXISTS idx_emails_org ON emails(org_id, created_at DESC);
 CREATE INDEX IF NOT EXISTS idx_emails_status ON emails(status);
 CREATE INDEX IF NOT EXISTS idx_emails_message ON emails(message_id);
 CREATE INDEX IF NOT EXISTS idx_emails_provider ON emails(provider_message_id);
+CREATE INDEX IF NOT EXISTS idx_emails_contact ON emails(contact_id);
+CREATE INDEX IF NOT EXISTS idx_emails_automation ON emails(automation_id, contact_id);
 
 -- Delivery Events
 CREATE TABLE IF NOT EXISTS delivery_events (
@@ -409,10 +869,12 @@ CREATE TABLE IF NOT EXISTS suppressions (
 	reason VARCHAR(50) NOT NULL,
 	source_type VARCHAR(50) NOT NULL,
 	source_id VARCHAR(255),
+	normalized_email VARCHAR(255),
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	UNIQUE(org_id, email)
 );
 CREATE INDEX IF NOT EXISTS idx_suppressions ON suppressions(org_id, email);
+CREATE INDEX IF NOT EXISTS idx_suppressions_normalized ON suppressions(org_id, normalized_email);
 
 -- Suppression List
 CREATE TABLE IF NOT EXISTS suppression_list (
@@ -421,10 +883,12 @@ CREATE TABLE IF NOT EXISTS suppression_list (
 	email VARCHAR(255) NOT NULL,
 	reason TEXT,
 	source VARCHAR(50) DEFAULT 'manual',
+	normalized_email VARCHAR(255),
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	UNIQUE(org_id, email)
 );
 CREATE INDEX IF NOT EXISTS idx_suppression_list ON suppression_list(org_id, email);
+CREATE INDEX IF NOT EXISTS idx_suppression_list_normalized ON suppression_list(org_id, normalized_email);
 
 -- Audit Logs
 CREATE TABLE IF NOT EXISTS audit_logs (
@@ -488,6 +952,7 @@ CREATE TABLE IF NOT EXISTS user_settings (
 	theme VARCHAR(20) DEFAULT 'light',
 	density VARCHAR(20) DEFAULT 'comfortable',
 	inbox_layout VARCHAR(20) DEFAULT 'default',
+	undo_send_seconds INT DEFAULT 0,
 	two_factor_enabled BOOLEAN DEFAULT false,
 	two_factor_method VARCHAR(20),
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
@@ -537,6 +1002,7 @@ CREATE TABLE IF NOT EXISTS received_emails (
 	in_reply_to VARCHAR(500),
 	"references" TEXT[] DEFAULT '{}',
 	thread_id VARCHAR(100),
+	thread_subject VARCHAR(1000),
 	from_email VARCHAR(255) NOT NULL,
 	from_name VARCHAR(255),
 	to_emails TEXT[] NOT NULL,
@@ -560,12 +1026,17 @@ CREATE TABLE IF NOT EXISTS received_emails (
 	labels TEXT[] DEFAULT '{}',
 	spam_score DOUBLE PRECISION,
 	spam_verdict VARCHAR(20),
+	spam_feedback VARCHAR(10),
 	virus_verdict VARCHAR(20),
 	spf_verdict VARCHAR(20),
 	dkim_verdict VARCHAR(20),
 	dmarc_verdict VARCHAR(20),
 	ses_message_id VARCHAR(255),
 	sns_notification_id VARCHAR(255),
+	tracked BOOLEAN DEFAULT false,
+	open_count INT DEFAULT 0,
+	click_count INT DEFAULT 0,
+	seen_at TIMESTAMPTZ(6),
 	received_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	read_at TIMESTAMPTZ(6),
 	trashed_at TIMESTAMPTZ(6),
@@ -575,6 +1046,21 @@ CREATE TABLE IF NOT EXISTS received_emails (
 CREATE INDEX IF NOT EXISTS idx_recv_emails_folder ON received_emails(org_id, identity_id, folder, received_at DESC);
 CREATE INDEX IF NOT EXISTS idx_recv_emails_read ON received_emails(org_id, identity_id, is_read);
 CREATE INDEX IF NOT EXISTS idx_recv_emails_thread ON received_emails(thread_id);
+CREATE INDEX IF NOT EXISTS idx_recv_emails_thread_subject ON received_emails(identity_id, thread_subject);
+
+-- Sent Email Events: opens and clicks of tracked emails composed in the inbox,
+-- recorded against their sent copy
+CREATE TABLE IF NOT EXISTS sent_email_events (
+	id BIGSERIAL PRIMARY KEY,
+	received_email_id BIGINT NOT NULL REFERENCES received_emails(id) ON DELETE CASCADE,
+	event_type VARCHAR(20) NOT NULL,
+	link_id VARCHAR(50),
+	url TEXT,
+	ip_address VARCHAR(45),
+	user_agent TEXT,
+	occurred_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_sent_email_events_email ON sent_email_events(received_email_id, occurred_at DESC);
 
 -- Email Attachments
 CREATE TABLE IF NOT EXISTS email_attachments (
@@ -589,6 +1075,9 @@ CREATE TABLE IF NOT EXISTS email_attachments (
 	content_id VARCHAR(255),
 	is_inline BOOLEAN DEFAULT false,
 	checksum VARCHAR(64),
+	thumbnail_s3_key VARCHAR(500),
+	virus_verdict VARCHAR(20),
+	virus_name VARCHAR(255),
 	created_at TIMESTAMPTZ(6) DEFAULT NOW()
 );
 CREATE INDEX IF NOT EXISTS idx_email_attachments ON email_attachments(received_email_id);
@@ -637,17 +1126,37 @@ CREATE TABLE IF NOT EXISTS automations (
 	description TEXT,
 	trigger_type VARCHAR(50) NOT NULL,
 	trigger_config JSONB DEFAULT '{}',
+	webhook_secret VARCHAR(255),
 	workflow JSONB DEFAULT '{"edges": [], "nodes": []}',
+	version INT DEFAULT 1,
+	topic_id INT REFERENCES subscription_topics(id) ON DELETE SET NULL,
+	allow_reenrollment BOOLEAN DEFAULT false,
+	reenroll_cooldown_hours INT DEFAULT 0,
+	error_policy JSONB,
 	status VARCHAR(50) DEFAULT 'draft',
 	enrolled_count INT DEFAULT 0,
 	completed_count INT DEFAULT 0,
 	in_progress_count INT DEFAULT 0,
 	error_count INT DEFAULT 0,
+	goal JSONB,
+	converted_count INT DEFAULT 0,
+	trigger_checked_at TIMESTAMPTZ(6),
 	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
 );
 CREATE INDEX IF NOT EXISTS idx_automations ON automations(org_id, status);
 
+-- Automation Versions: the workflows an automation had, which enrollments
+-- started on them finish
+CREATE TABLE IF NOT EXISTS automation_versions (
+	id SERIAL PRIMARY KEY,
+	automation_id INT NOT NULL REFERENCES automations(id) ON DELETE CASCADE,
+	version INT NOT NULL,
+	workflow JSONB NOT NULL,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	UNIQUE(automation_id, version)
+);
+
 -- Automation Enrollments
 CREATE TABLE IF NOT EXISTS automation_enrollments (
 	id BIGSERIAL PRIMARY KEY,
@@ -657,11 +1166,15 @@ CREATE TABLE IF NOT EXISTS automation_enrollments (
 	org_id INT NOT NULL,
 	status VARCHAR(50) DEFAULT 'active',
 	step_index INT DEFAULT 0,
+	current_node_id VARCHAR(100),
+	workflow_version INT,
 	step_data JSONB DEFAULT '{}',
 	next_run_at TIMESTAMPTZ(6),
 	completed_at TIMESTAMPTZ(6),
+	converted_at TIMESTAMPTZ(6),
 	error_message TEXT,
 	retry_count INT DEFAULT 0,
+	enrollment_count INT DEFAULT 1,
 	enrolled_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
 	UNIQUE(automation_id, contact_id)
@@ -683,6 +1196,20 @@ CREATE TABLE IF NOT EXISTS automation_logs (
 );
 CREATE INDEX IF NOT EXISTS idx_auto_logs_enroll ON automation_logs(enrollment_id, created_at DESC);
 
+-- Automation Node Stats: how often each node of a workflow ran and failed
+CREATE TABLE IF NOT EXISTS automation_node_stats (
+	automation_id INT NOT NULL REFERENCES automations(id) ON DELETE CASCADE,
+	node_id VARCHAR(100) NOT NULL,
+	node_type VARCHAR(50) NOT NULL,
+	success_count INT DEFAULT 0,
+	error_count INT DEFAULT 0,
+	yes_count INT DEFAULT 0,
+	no_count INT DEFAULT 0,
+	last_error TEXT,
+	last_run_at TIMESTAMPTZ(6),
+	PRIMARY KEY (automation_id, node_id)
+);
+
 -- Warmup Progress
 CREATE TABLE IF NOT EXISTS warmup_progress (
 	id SERIAL PRIMARY KEY,
@@ -791,6 +1318,111 @@ CREATE TABLE IF NOT EXISTS consent_audit (
 );
 CREATE INDEX IF NOT EXISTS idx_consent_contact ON consent_audit(contact_id, created_at DESC);
 
+-- Org Backups (encrypted logical backups of contacts, lists and consent history)
+CREATE TABLE IF NOT EXISTS org_backups (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	trigger VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	storage_key VARCHAR(500),
+	size BIGINT DEFAULT 0,
+	checksum VARCHAR(64),
+	contact_count INT DEFAULT 0,
+	list_count INT DEFAULT 0,
+	membership_count INT DEFAULT 0,
+	consent_count INT DEFAULT 0,
+	error TEXT,
+	verified_at TIMESTAMPTZ(6),
+	completed_at TIMESTAMPTZ(6),
+	last_restored_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_org_backups_org ON org_backups(org_id, created_at DESC);
+
+-- List hygiene runs (re-verification of stale contacts' addresses)
+CREATE TABLE IF NOT EXISTS list_hygiene_runs (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	trigger VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	checked_count INT DEFAULT 0,
+	valid_count INT DEFAULT 0,
+	risky_count INT DEFAULT 0,
+	undeliverable_count INT DEFAULT 0,
+	unknown_count INT DEFAULT 0,
+	quarantined_count INT DEFAULT 0,
+	reasons JSONB DEFAULT '{}',
+	flagged JSONB DEFAULT '[]',
+	error TEXT,
+	started_at TIMESTAMPTZ(6),
+	completed_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_list_hygiene_runs_org ON list_hygiene_runs(org_id, created_at DESC);
+
+-- Delivery event exports (CSV/NDJSON, for BI pipelines and compliance)
+CREATE TABLE IF NOT EXISTS event_exports (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	requested_by INT,
+	format VARCHAR(10) NOT NULL DEFAULT 'csv',
+	destination VARCHAR(20) NOT NULL DEFAULT 'download',
+	date_from TIMESTAMPTZ(6) NOT NULL,
+	date_to TIMESTAMPTZ(6) NOT NULL,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	storage_key VARCHAR(500),
+	row_count INT DEFAULT 0,
+	size BIGINT DEFAULT 0,
+	error TEXT,
+	completed_at TIMESTAMPTZ(6),
+	expires_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_event_exports_org ON event_exports(org_id, created_at DESC);
+
+-- Contact Exports (contacts of lists, statuses or segment rules as CSV or JSON)
+CREATE TABLE IF NOT EXISTS contact_exports (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	requested_by INT,
+	format VARCHAR(10) NOT NULL DEFAULT 'csv',
+	destination VARCHAR(20) NOT NULL DEFAULT 'download',
+	filters JSONB NOT NULL DEFAULT '{}',
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	storage_key VARCHAR(500),
+	row_count INT DEFAULT 0,
+	size BIGINT DEFAULT 0,
+	error TEXT,
+	completed_at TIMESTAMPTZ(6),
+	expires_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_contact_exports_org ON contact_exports(org_id, created_at DESC);
+
+-- Mailbox Exports (an identity's emails as MBOX or a zip of EML files)
+CREATE TABLE IF NOT EXISTS mailbox_exports (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	org_id INT NOT NULL REFERENCES organizations(id) ON DELETE CASCADE,
+	identity_id INT NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+	requested_by INT,
+	format VARCHAR(10) NOT NULL DEFAULT 'mbox',
+	destination VARCHAR(20) NOT NULL DEFAULT 'download',
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	storage_key VARCHAR(500),
+	email_count INT DEFAULT 0,
+	size BIGINT DEFAULT 0,
+	error TEXT,
+	completed_at TIMESTAMPTZ(6),
+	expires_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_mailbox_exports_org ON mailbox_exports(org_id, created_at DESC);
+
 -- Inbox Filters
 CREATE TABLE IF NOT EXISTS inbox_filters (
 	id SERIAL PRIMARY KEY,
@@ -817,6 +1449,79 @@ CREATE TABLE IF NOT EXISTS inbox_filters (
 );
 CREATE INDEX IF NOT EXISTS idx_inbox_filters ON inbox_filters(user_id, active, priority);
 
+-- Inbox Filter Runs (a filter applied to emails already received, in the background)
+CREATE TABLE IF NOT EXISTS inbox_filter_runs (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	filter_id INT NOT NULL REFERENCES inbox_filters(id) ON DELETE CASCADE,
+	user_id INT NOT NULL,
+	folder VARCHAR(50),
+	received_after TIMESTAMPTZ(6),
+	received_before TIMESTAMPTZ(6),
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	total INT DEFAULT 0,
+	processed INT DEFAULT 0,
+	matched INT DEFAULT 0,
+	last_email_id BIGINT DEFAULT 0,
+	error TEXT,
+	started_at TIMESTAMPTZ(6),
+	completed_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_inbox_filter_runs_filter ON inbox_filter_runs(filter_id, created_at DESC);
+
+-- Inbox Bulk Jobs: an action applied to every received email matching a
+-- filter, in the background. max_email_id bounds them to the emails there were
+-- when the job was created.
+CREATE TABLE IF NOT EXISTS inbox_bulk_jobs (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	user_id INT NOT NULL,
+	action VARCHAR(20) NOT NULL,
+	folder VARCHAR(50),
+	criteria JSONB NOT NULL DEFAULT '{}',
+	max_email_id BIGINT DEFAULT 0,
+	status VARCHAR(20) NOT NULL DEFAULT 'pending',
+	total INT DEFAULT 0,
+	processed INT DEFAULT 0,
+	last_email_id BIGINT DEFAULT 0,
+	error TEXT,
+	started_at TIMESTAMPTZ(6),
+	completed_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_inbox_bulk_jobs_user ON inbox_bulk_jobs(user_id, created_at DESC);
+
+-- Spam Filter (each identity's Bayesian filter, trained by marking emails as spam or not)
+CREATE TABLE IF NOT EXISTS spam_filter_totals (
+	identity_id INT PRIMARY KEY REFERENCES identities(id) ON DELETE CASCADE,
+	spam_count INT NOT NULL DEFAULT 0,
+	ham_count INT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS spam_filter_tokens (
+	identity_id INT NOT NULL REFERENCES identities(id) ON DELETE CASCADE,
+	token VARCHAR(300) NOT NULL,
+	spam_count INT NOT NULL DEFAULT 0,
+	ham_count INT NOT NULL DEFAULT 0,
+	PRIMARY KEY (identity_id, token)
+);
+
+-- Received Email Counts (kept up to date by a trigger on received_emails)
+CREATE TABLE IF NOT EXISTS received_email_counts (
+	identity_id INT PRIMARY KEY REFERENCES identities(id) ON DELETE CASCADE,
+	inbox INT NOT NULL DEFAULT 0,
+	unread INT NOT NULL DEFAULT 0,
+	starred INT NOT NULL DEFAULT 0,
+	sent INT NOT NULL DEFAULT 0,
+	drafts INT NOT NULL DEFAULT 0,
+	spam INT NOT NULL DEFAULT 0,
+	trash INT NOT NULL DEFAULT 0,
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	reconciled_at TIMESTAMPTZ(6)
+);
+
 -- Auto Replies
 CREATE TABLE IF NOT EXISTS auto_replies (
 	id SERIAL PRIMARY KEY,
@@ -894,6 +1599,37 @@ CREATE TABLE IF NOT EXISTS shared_mailbox_members (
 	UNIQUE(shared_mailbox_id, user_id)
 );
 
+-- Shared Mailbox Messages: the help desk state of an email received at a shared
+-- mailbox's address. Emails without a row are open and unassigned.
+CREATE TABLE IF NOT EXISTS shared_mailbox_messages (
+	id BIGSERIAL PRIMARY KEY,
+	shared_mailbox_id INT NOT NULL REFERENCES shared_mailboxes(id) ON DELETE CASCADE,
+	received_email_id BIGINT UNIQUE NOT NULL REFERENCES received_emails(id) ON DELETE CASCADE,
+	status VARCHAR(20) NOT NULL DEFAULT 'open',
+	assigned_to INT,
+	assigned_by INT,
+	assigned_at TIMESTAMPTZ(6),
+	closed_by INT,
+	closed_at TIMESTAMPTZ(6),
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_shared_mailbox_messages ON shared_mailbox_messages(shared_mailbox_id, status, assigned_to);
+
+-- Shared Mailbox Notes: internal comments members leave on an email, never
+-- sent to its sender
+CREATE TABLE IF NOT EXISTS shared_mailbox_notes (
+	id BIGSERIAL PRIMARY KEY,
+	uuid UUID UNIQUE DEFAULT gen_random_uuid(),
+	shared_mailbox_id INT NOT NULL REFERENCES shared_mailboxes(id) ON DELETE CASCADE,
+	received_email_id BIGINT NOT NULL REFERENCES received_emails(id) ON DELETE CASCADE,
+	user_id INT NOT NULL,
+	body TEXT NOT NULL,
+	created_at TIMESTAMPTZ(6) DEFAULT NOW(),
+	updated_at TIMESTAMPTZ(6) DEFAULT NOW()
+);
+CREATE INDEX IF NOT EXISTS idx_shared_mailbox_notes ON shared_mailbox_notes(received_email_id, created_at);
+
 -- Sieve Scripts
 CREATE TABLE IF NOT EXISTS sieve_scripts (
 	id SERIAL PRIMARY KEY,
@@ -13,7 +13,11 @@ import (
 	"strings"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/pkg/bounce"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
 )
 
 // SNSMessage represents an SNS notification message
@@ -317,28 +321,50 @@ func (h *SNSWebhookHandler) processSESNotification(ctx context.Context, message
 }
 
 // handleBounce processes bounce notifications
-func (h *SNSWebhookHandler) handleBounce(ctx context.Context, emailID, orgID int64, bounce *SESBounce) error {
-	if bounce == nil {
+func (h *SNSWebhookHandler) handleBounce(ctx context.Context, emailID, orgID int64, b *SESBounce) error {
+	if b == nil {
 		return nil
 	}
 
-	// Update email status
+	// Classify each recipient and record the bounce against that recipient only;
+	// the email records the class of the first one
+	classes := make([]bounce.Class, len(b.BouncedRecipients))
+	for i, recipient := range b.BouncedRecipients {
+		classes[i] = bounce.ClassifySES(b.BounceType, b.BounceSubType, recipient.Status, recipient.DiagnosticCode)
+		_, err := h.db.ExecContext(ctx, `
+			UPDATE transactional_email_recipients
+			SET status = 'bounced', bounced_at = NOW(), bounce_class = $3, bounce_reason = $4, updated_at = NOW()
+			WHERE email_id = $1 AND email = $2
+		`, emailID, strings.ToLower(recipient.EmailAddress), string(classes[i]), recipient.DiagnosticCode)
+		if err != nil {
+			fmt.Printf("Warning: failed to record recipient bounce: %v\n", err)
+		}
+	}
+	emailClass := bounce.ClassifySES(b.BounceType, b.BounceSubType, "", "")
+	if len(classes) > 0 {
+		emailClass = classes[0]
+	}
+
+	// Update email status; it is only 'bounced' once every recipient has bounced
 	bounceType := "soft"
-	if bounce.BounceType == "Permanent" {
+	if b.BounceType == "Permanent" {
 		bounceType = "hard"
 	}
 
 	_, err := h.db.ExecContext(ctx, `
 		UPDATE transactional_emails
-		SET status = 'bounced', bounced_at = NOW(), bounce_type = $2, bounce_reason = $3, updated_at = NOW()
+		SET status = CASE WHEN EXISTS (
+				SELECT 1 FROM transactional_email_recipients r WHERE r.email_id = $1 AND r.bounced_at IS NULL
+			) THEN status ELSE 'bounced' END,
+			bounced_at = NOW(), bounce_type = $2, bounce_class = $3, bounce_reason = $4, updated_at = NOW()
 		WHERE id = $1
-	`, emailID, bounceType, bounce.BounceSubType)
+	`, emailID, bounceType, string(emailClass), b.BounceSubType)
 	if err != nil {
 		return err
 	}
 
 	// Record delivery event
-	details := fmt.Sprintf("Bounce: %s/%s", bounce.BounceType, bounce.BounceSubType)
+	details := fmt.Sprintf("Bounce [%s]: %s/%s", emailClass, b.BounceType, b.BounceSubType)
 	_, err = h.db.ExecContext(ctx, `
 		INSERT INTO transactional_delivery_events (email_id, event_type, details)
 		VALUES ($1, 'bounced', $2)
@@ -347,17 +373,19 @@ func (h *SNSWebhookHandler) handleBounce(ctx context.Context, emailID, orgID int
 		fmt.Printf("Warning: failed to record bounce event: %v\n", err)
 	}
 
-	// Add bounced recipients to suppression list for hard bounces
-	if bounce.BounceType == "Permanent" {
-		for _, recipient := range bounce.BouncedRecipients {
-			_, err = h.db.ExecContext(ctx, `
-				INSERT INTO suppression_list (org_id, email, reason, source)
-				VALUES ($1, $2, $3, 'bounce')
-				ON CONFLICT (org_id, email) DO NOTHING
-			`, orgID, strings.ToLower(recipient.EmailAddress), recipient.DiagnosticCode)
-			if err != nil {
-				fmt.Printf("Warning: failed to add to suppression list: %v\n", err)
-			}
+	// Add bounced recipients to suppression list when their class calls for it
+	rules := emailaddr.LoadRules(ctx, h.db, orgID)
+	for i, recipient := range b.BouncedRecipients {
+		if !bounce.PolicyFor(classes[i]).Suppress {
+			continue
+		}
+		_, err = h.db.ExecContext(ctx, `
+			INSERT INTO suppression_list (org_id, email, reason, source, normalized_email)
+			VALUES ($1, $2, $3, 'bounce', $4)
+			ON CONFLICT (org_id, email) DO NOTHING
+		`, orgID, strings.ToLower(recipient.EmailAddress), recipient.DiagnosticCode, emailaddr.Normalize(recipient.EmailAddress, rules))
+		if err != nil {
+			fmt.Printf("Warning: failed to add to suppression list: %v\n", err)
 		}
 	}
 
@@ -380,6 +408,19 @@ func (h *SNSWebhookHandler) handleComplaint(ctx context.Context, emailID, orgID
 		return err
 	}
 
+	complained := make([]string, 0, len(complaint.ComplainedRecipients))
+	for _, recipient := range complaint.ComplainedRecipients {
+		complained = append(complained, strings.ToLower(recipient.EmailAddress))
+	}
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE transactional_email_recipients
+		SET status = 'complained', complained_at = NOW(), updated_at = NOW()
+		WHERE email_id = $1 AND email = ANY($2)
+	`, emailID, pq.Array(complained))
+	if err != nil {
+		fmt.Printf("Warning: failed to record recipient complaint: %v\n", err)
+	}
+
 	// Record delivery event
 	details := fmt.Sprintf("Complaint: %s", complaint.ComplaintFeedbackType)
 	_, err = h.db.ExecContext(ctx, `
@@ -391,12 +432,13 @@ func (h *SNSWebhookHandler) handleComplaint(ctx context.Context, emailID, orgID
 	}
 
 	// Add complained recipients to suppression list
+	rules := emailaddr.LoadRules(ctx, h.db, orgID)
 	for _, recipient := range complaint.ComplainedRecipients {
 		_, err = h.db.ExecContext(ctx, `
-			INSERT INTO suppression_list (org_id, email, reason, source)
-			VALUES ($1, $2, $3, 'complaint')
+			INSERT INTO suppression_list (org_id, email, reason, source, normalized_email)
+			VALUES ($1, $2, $3, 'complaint', $4)
 			ON CONFLICT (org_id, email) DO NOTHING
-		`, orgID, strings.ToLower(recipient.EmailAddress), complaint.ComplaintFeedbackType)
+		`, orgID, strings.ToLower(recipient.EmailAddress), complaint.ComplaintFeedbackType, emailaddr.Normalize(recipient.EmailAddress, rules))
 		if err != nil {
 			fmt.Printf("Warning: failed to add to suppression list: %v\n", err)
 		}
@@ -421,6 +463,20 @@ func (h *SNSWebhookHandler) handleDelivery(ctx context.Context, emailID int64, d
 		return err
 	}
 
+	delivered := make([]string, 0, len(delivery.Recipients))
+	for _, recipient := range delivery.Recipients {
+		delivered = append(delivered, strings.ToLower(recipient))
+	}
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE transactional_email_recipients
+		SET status = CASE WHEN status IN ('queued', 'sent') THEN 'delivered' ELSE status END,
+			delivered_at = COALESCE(delivered_at, NOW()), updated_at = NOW()
+		WHERE email_id = $1 AND email = ANY($2)
+	`, emailID, pq.Array(delivered))
+	if err != nil {
+		fmt.Printf("Warning: failed to record recipient delivery: %v\n", err)
+	}
+
 	// Record delivery event
 	details := fmt.Sprintf("Delivered to %s in %dms", strings.Join(delivery.Recipients, ", "), delivery.ProcessingTimeMillis)
 	_, err = h.db.ExecContext(ctx, `
@@ -489,6 +545,13 @@ func (h *SNSWebhookHandler) handleOpen(ctx context.Context, emailID int64, open
 		return err
 	}
 
+	// SES open events don't say which recipient opened, so only single-recipient emails are attributed
+	h.db.ExecContext(ctx, `
+		UPDATE transactional_email_recipients
+		SET opened_at = COALESCE(opened_at, NOW()), updated_at = NOW()
+		WHERE email_id = $1 AND (SELECT COUNT(*) FROM transactional_email_recipients WHERE email_id = $1) = 1
+	`, emailID)
+
 	// Record delivery event
 	_, err = h.db.ExecContext(ctx, `
 		INSERT INTO transactional_delivery_events (email_id, event_type, details, ip_address, user_agent)
@@ -517,6 +580,12 @@ func (h *SNSWebhookHandler) handleClick(ctx context.Context, emailID int64, clic
 		return err
 	}
 
+	h.db.ExecContext(ctx, `
+		UPDATE transactional_email_recipients
+		SET clicked_at = COALESCE(clicked_at, NOW()), updated_at = NOW()
+		WHERE email_id = $1 AND (SELECT COUNT(*) FROM transactional_email_recipients WHERE email_id = $1) = 1
+	`, emailID)
+
 	// Record delivery event
 	details := fmt.Sprintf("Link clicked: %s", click.Link)
 	_, err = h.db.ExecContext(ctx, `
@@ -104,15 +104,15 @@ func validateAPIKey(r *ghttp.Request, apiKey string) {
 	keyHash := hex.EncodeToString(hash[:])
 
 	// Lookup in database
-	var orgID int64
+	var keyID, orgID int64
 	var userID sql.NullInt64
 	var expiresAt sql.NullTime
 
 	err := database.DB.QueryRowContext(r.Context(), `
-		SELECT org_id, user_id, expires_at
+		SELECT id, org_id, user_id, expires_at
 		FROM api_keys
 		WHERE key_hash = $1
-	`, keyHash).Scan(&orgID, &userID, &expiresAt)
+	`, keyHash).Scan(&keyID, &orgID, &userID, &expiresAt)
 
 	if err == sql.ErrNoRows {
 		response.Unauthorized(r, "Invalid API key")
@@ -137,8 +137,9 @@ func validateAPIKey(r *ghttp.Request, apiKey string) {
 
 	// Create claims for API key auth
 	claims := &model.JWTClaims{
-		OrgID: orgID,
-		Role:  "api",
+		OrgID:    orgID,
+		Role:     "api",
+		APIKeyID: keyID,
 	}
 	if userID.Valid {
 		claims.UserID = userID.Int64
@@ -1,6 +1,7 @@
 package model
 
 import (
+	"encoding/json"
 	"time"
 )
 
@@ -120,12 +121,51 @@ type Identity struct {
 	UpdatedAt         time.Time  `json:"updatedAt"`
 }
 
+// IdentityAppPassword is a password a mail app signs in to an identity's IMAP
+// and SMTP with
+type IdentityAppPassword struct {
+	UUID           string     `json:"uuid"`
+	Name           string     `json:"name"`           // The device it's for
+	PasswordPrefix string     `json:"passwordPrefix"` // Tells the passwords apart
+	CreatedAt      time.Time  `json:"createdAt"`
+	RevokedAt      *time.Time `json:"revokedAt,omitempty"`
+}
+
+// CreateAppPasswordRequest names the device an app password is for
+type CreateAppPasswordRequest struct {
+	Name string `json:"name" v:"required|max-length:100"`
+}
+
+// CreatedAppPassword is a new app password; this is the only time the
+// password itself is shown
+type CreatedAppPassword struct {
+	IdentityAppPassword
+	Password string `json:"password"`
+}
+
+// IdentitySignature is what's added to the emails an identity sends. It may
+// use {{displayName}}, {{email}} and {{domain}}.
+type IdentitySignature struct {
+	HTML     string `json:"html"`
+	Text     string `json:"text"`
+	Position string `json:"position"` // below_reply or bottom, in replies and forwards
+}
+
+// UpdateSignatureRequest changes an identity's signature; omitted fields are
+// kept
+type UpdateSignatureRequest struct {
+	HTML     *string `json:"html"`
+	Text     *string `json:"text"`
+	Position *string `json:"position"`
+}
+
 // JWT Claims
 type JWTClaims struct {
-	UserID int64  `json:"userId"`
-	OrgID  int64  `json:"orgId"`
-	Email  string `json:"email"`
-	Role   string `json:"role"`
+	UserID   int64  `json:"userId"`
+	OrgID    int64  `json:"orgId"`
+	Email    string `json:"email"`
+	Role     string `json:"role"`
+	APIKeyID int64  `json:"apiKeyId,omitempty"` // Set when authenticated with an API key
 }
 
 // Request/Response DTOs
@@ -162,29 +202,42 @@ type CreateIdentityRequest struct {
 }
 
 type CreateApiKeyRequest struct {
-	Name        string   `json:"name" v:"required|min-length:2"`
-	Permissions []string `json:"permissions"`
-	RateLimit   int      `json:"rateLimit"` // Requests per minute (default: 100)
-	ExpiresAt   *string  `json:"expiresAt"` // RFC3339 format or null for no expiry
+	Name                string   `json:"name" v:"required|min-length:2"`
+	Permissions         []string `json:"permissions"`
+	RateLimit           int      `json:"rateLimit"`           // Requests per minute (default: 100)
+	ExpiresAt           *string  `json:"expiresAt"`           // RFC3339 format or null for no expiry
+	AllowedDomains      []string `json:"allowedDomains"`      // Sender domains the key may send from, empty for any
+	RequiredTagPrefixes []string `json:"requiredTagPrefixes"` // Every tag must start with one of these, empty for no restriction
+	DailySendLimit      int      `json:"dailySendLimit"`      // Transactional emails per day (UTC), 0 for no limit
+}
+
+// UpdateApiKeyScopeRequest for changing the sending restrictions of an API key
+type UpdateApiKeyScopeRequest struct {
+	AllowedDomains      *[]string `json:"allowedDomains"`
+	RequiredTagPrefixes *[]string `json:"requiredTagPrefixes"`
+	DailySendLimit      *int      `json:"dailySendLimit"`
 }
 
 type ApiKeyResponse struct {
-	ID          int64      `json:"id"`
-	UUID        string     `json:"uuid"`
-	Name        string     `json:"name"`
-	Key         string     `json:"key,omitempty"` // Only shown on creation
-	KeyPrefix   string     `json:"keyPrefix"`
-	Permissions []string   `json:"permissions"`
-	RateLimit   int        `json:"rateLimit"`
-	LastUsedAt  *time.Time `json:"lastUsedAt,omitempty"`
-	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
-	CreatedAt   time.Time  `json:"createdAt"`
+	ID                  int64      `json:"id"`
+	UUID                string     `json:"uuid"`
+	Name                string     `json:"name"`
+	Key                 string     `json:"key,omitempty"` // Only shown on creation
+	KeyPrefix           string     `json:"keyPrefix"`
+	Permissions         []string   `json:"permissions"`
+	RateLimit           int        `json:"rateLimit"`
+	AllowedDomains      []string   `json:"allowedDomains"`
+	RequiredTagPrefixes []string   `json:"requiredTagPrefixes"`
+	DailySendLimit      int        `json:"dailySendLimit"`
+	LastUsedAt          *time.Time `json:"lastUsedAt,omitempty"`
+	ExpiresAt           *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt           time.Time  `json:"createdAt"`
 }
 
 // Unified Inbox Request/Response DTOs
 
 type UnifiedInboxRequest struct {
-	Page       int    `json:"page" d:"1"`
+	Cursor     string `json:"cursor"` // nextCursor of the previous page; the newest emails when empty
 	PageSize   int    `json:"pageSize" d:"50"`
 	MailboxID  string `json:"mailboxId"`
 	IdentityID int64  `json:"identityId"`
@@ -231,6 +284,11 @@ type ComposeEmailRequest struct {
 	InReplyTo   string             `json:"inReplyTo"`
 	References  []string           `json:"references"`
 	Attachments []AttachmentDTO    `json:"attachments"`
+	SendAt      *string            `json:"sendAt"`      // RFC3339; sends later, from the Scheduled folder
+	NoSignature bool               `json:"noSignature"` // Don't add the identity's signature
+	Confirmed   bool               `json:"confirmed"`   // Send despite the outbound rules' confirmation prompts
+	TrackOpens  bool               `json:"trackOpens"`  // Record when the recipients open the email
+	TrackClicks bool               `json:"trackClicks"` // Record the links the recipients click
 }
 
 type EmailAddressDTO struct {
@@ -297,7 +355,8 @@ type TransactionalEmail struct {
 	OpenedAt        *time.Time         `json:"openedAt,omitempty"`
 	ClickedAt       *time.Time         `json:"clickedAt,omitempty"`
 	BouncedAt       *time.Time         `json:"bouncedAt,omitempty"`
-	BounceType      string             `json:"bounceType,omitempty"` // hard, soft
+	BounceType      string             `json:"bounceType,omitempty"`  // hard, soft
+	BounceClass     string             `json:"bounceClass,omitempty"` // hard, soft, block, reputation, full_mailbox
 	BounceReason    string             `json:"bounceReason,omitempty"`
 	IdempotencyKey  string             `json:"idempotencyKey,omitempty"`
 	CreatedAt       time.Time          `json:"createdAt"`
@@ -306,18 +365,35 @@ type TransactionalEmail struct {
 
 // EmailTemplate represents a reusable email template
 type EmailTemplate struct {
-	ID          int64             `json:"id"`
-	UUID        string            `json:"uuid"`
-	OrgID       int64             `json:"orgId"`
-	Name        string            `json:"name"`
-	Description string            `json:"description,omitempty"`
-	Subject     string            `json:"subject"`
-	HTMLBody    string            `json:"htmlBody"`
-	TextBody    string            `json:"textBody,omitempty"`
-	Variables   []string          `json:"variables,omitempty"` // List of variable names
-	IsActive    bool              `json:"isActive"`
-	CreatedAt   time.Time         `json:"createdAt"`
-	UpdatedAt   time.Time         `json:"updatedAt"`
+	ID             int64           `json:"id"`
+	UUID           string          `json:"uuid"`
+	OrgID          int64           `json:"orgId"`
+	Name           string          `json:"name"`
+	Description    string          `json:"description,omitempty"`
+	Subject        string          `json:"subject"`
+	HTMLBody       string          `json:"htmlBody"`
+	TextBody       string          `json:"textBody,omitempty"`
+	AMPBody        string          `json:"amp,omitempty"`            // AMP for Email part
+	MJML           string          `json:"mjml,omitempty"`           // Source the HTML body is compiled from
+	Design         json.RawMessage `json:"design,omitempty"`         // Block design the HTML body is rendered from
+	Variables      []string        `json:"variables,omitempty"`      // List of variable names
+	VariableSchema json.RawMessage `json:"variableSchema,omitempty"` // JSON schema sends' variables must match
+	UseLayout      bool            `json:"useLayout"`                // HTML body is wrapped in the org's header and footer
+	IsActive       bool            `json:"isActive"`
+	CreatedAt      time.Time       `json:"createdAt"`
+	UpdatedAt      time.Time       `json:"updatedAt"`
+}
+
+// TemplatePartial is a reusable snippet templates include with {{> name}}. Built-in
+// partials come from the org's branding and have no UUID.
+type TemplatePartial struct {
+	UUID        string     `json:"uuid,omitempty"`
+	Name        string     `json:"name"`
+	Description string     `json:"description,omitempty"`
+	Content     string     `json:"content"`
+	BuiltIn     bool       `json:"builtIn"`
+	CreatedAt   *time.Time `json:"createdAt,omitempty"`
+	UpdatedAt   *time.Time `json:"updatedAt,omitempty"`
 }
 
 // DeliveryEvent represents a delivery event for tracking
@@ -347,86 +423,407 @@ type Webhook struct {
 // Transactional API Request DTOs
 
 type SendEmailRequest struct {
-	From           string            `json:"from" v:"required|email"`
-	To             []string          `json:"to" v:"required"`
-	Cc             []string          `json:"cc"`
-	Bcc            []string          `json:"bcc"`
-	ReplyTo        string            `json:"replyTo"`
-	Subject        string            `json:"subject" v:"required"`
-	HTML           string            `json:"html"`
-	Text           string            `json:"text"`
-	TemplateID     string            `json:"templateId"`
-	Variables      map[string]string `json:"variables"`
-	Attachments    []AttachmentDTO   `json:"attachments"`
-	Tags           []string          `json:"tags"`
-	Metadata       map[string]string `json:"metadata"`
-	ScheduledFor   *string           `json:"scheduledFor"` // RFC3339 timestamp
-	IdempotencyKey string            `json:"-"`            // Set from header
+	From              string            `json:"from" v:"required|email"`
+	To                []string          `json:"to" v:"required"`
+	Cc                []string          `json:"cc"`
+	Bcc               []string          `json:"bcc"`
+	ReplyTo           string            `json:"replyTo"`
+	Subject           string            `json:"subject" v:"required"`
+	HTML              string            `json:"html"`
+	Text              string            `json:"text"`
+	TemplateID        string            `json:"templateId"`
+	Variables         map[string]any    `json:"variables"` // Template data: strings, numbers, booleans, lists and objects
+	Attachments       []AttachmentDTO   `json:"attachments"`
+	AttachmentIDs     []string          `json:"attachmentIds"` // IDs returned by POST /api/v1/attachments
+	InlineImages      []InlineImageRef  `json:"inlineImages"`  // Pre-uploaded images embedded in the HTML as cid:<cid>
+	SenderPool        string            `json:"senderPool"`    // Rotation pool the worker picks the sender from
+	Tags              []string          `json:"tags"`
+	Metadata          map[string]string `json:"metadata"`
+	ScheduledFor      *string           `json:"scheduledFor"`        // RFC3339 timestamp
+	IgnoreSendWindow  bool              `json:"ignoreSendingWindow"` // Send a scheduled email outside the org's sending window
+	DedupeWindowHours int               `json:"dedupeWindowHours"`   // Reject recipients sent the same template (or subject) within this many hours, 0 to allow
+	IdempotencyKey    string            `json:"-"`                   // Set from header
+}
+
+// InlineImageRef embeds a pre-uploaded image in the HTML body, where it is
+// referenced as <img src="cid:CID">
+type InlineImageRef struct {
+	ID  string `json:"id" v:"required"`
+	CID string `json:"cid" v:"required"`
+}
+
+// TransactionalAttachment is a pre-uploaded attachment that sends reference by ID
+type TransactionalAttachment struct {
+	ID          string    `json:"id"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	Size        int       `json:"size"`
+	Checksum    string    `json:"checksum"` // SHA-256, hex
+	CreatedAt   time.Time `json:"createdAt"`
 }
 
 type SendEmailResponse struct {
-	ID         string     `json:"id"`
-	MessageID  string     `json:"messageId"`
-	Status     string     `json:"status"`
-	AcceptedAt time.Time  `json:"acceptedAt"`
+	ID              string           `json:"id"`
+	MessageID       string           `json:"messageId"`
+	Status          string           `json:"status"`
+	AcceptedAt      time.Time        `json:"acceptedAt"`
+	ContentWarnings []ContentFinding `json:"contentWarnings,omitempty"` // Content guard findings when the org policy only warns
+}
+
+// ContentFinding is a content guard check that an email failed
+type ContentFinding struct {
+	Check  string `json:"check"` // spam_score, broken_link, missing_unsubscribe, image_ratio
+	Detail string `json:"detail"`
 }
 
 type BatchSendRequest struct {
 	Emails []SendEmailRequest `json:"emails" v:"required"`
 }
 
+// BatchSendResponse is returned when a batch is accepted; poll the batch for results
 type BatchSendResponse struct {
-	Results []BatchEmailResult `json:"results"`
+	BatchID string `json:"batchId"`
+	Status  string `json:"status"`
+	Total   int    `json:"total"`
+}
+
+// BatchStatusResponse is the progress of a batch with a result per entry.
+// Entries not yet sent have status pending.
+type BatchStatusResponse struct {
+	BatchID     string             `json:"batchId"`
+	Status      string             `json:"status"` // queued, processing, completed
+	Total       int                `json:"total"`
+	Accepted    int                `json:"accepted"`
+	Failed      int                `json:"failed"`
+	Pending     int                `json:"pending"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	CompletedAt *time.Time         `json:"completedAt,omitempty"`
+	Results     []BatchEmailResult `json:"results"`
 }
 
 type BatchEmailResult struct {
-	Index     int    `json:"index"`
-	ID        string `json:"id,omitempty"`
-	MessageID string `json:"messageId,omitempty"`
-	Status    string `json:"status"`
-	Error     string `json:"error,omitempty"`
+	Index        int                 `json:"index"`
+	ID           string              `json:"id,omitempty"`
+	MessageID    string              `json:"messageId,omitempty"`
+	Status       string              `json:"status"`
+	Error        string              `json:"error,omitempty"`
+	ErrorCode    string              `json:"errorCode,omitempty"`    // Machine-readable code of Error
+	Suppressions []SuppressionDetail `json:"suppressions,omitempty"` // Set when the send was rejected for suppressed recipients
+	Content      []ContentFinding    `json:"contentFindings,omitempty"` // Content guard findings, whether the send was blocked or only warned
 }
 
 type GetEmailStatusResponse struct {
-	ID          string     `json:"id"`
-	MessageID   string     `json:"messageId"`
-	From        string     `json:"from"`
-	To          []string   `json:"to"`
-	Subject     string     `json:"subject"`
-	Status      string     `json:"status"`
-	Events      []DeliveryEvent `json:"events"`
-	CreatedAt   time.Time  `json:"createdAt"`
-	SentAt      *time.Time `json:"sentAt,omitempty"`
-	DeliveredAt *time.Time `json:"deliveredAt,omitempty"`
+	ID           string                 `json:"id"`
+	MessageID    string                 `json:"messageId"`
+	From         string                 `json:"from"`
+	To           []string               `json:"to"`
+	Cc           []string               `json:"cc,omitempty"`
+	Bcc          []string               `json:"bcc,omitempty"`
+	Subject      string                 `json:"subject"`
+	Status       string                 `json:"status"`
+	Recipients   []EmailRecipientStatus `json:"recipients"`
+	Events       []DeliveryEvent        `json:"events"`
+	CreatedAt    time.Time              `json:"createdAt"`
+	SentAt       *time.Time             `json:"sentAt,omitempty"`
+	DeliveredAt  *time.Time             `json:"deliveredAt,omitempty"`
+	BounceClass  string                 `json:"bounceClass,omitempty"`
+	BounceReason string                 `json:"bounceReason,omitempty"`
+	HoldReason   string                 `json:"holdReason,omitempty"`
+}
+
+// EmailRecipientStatus is the delivery state of one recipient of a transactional email
+type EmailRecipientStatus struct {
+	Email        string     `json:"email"`
+	Type         string     `json:"type"` // to, cc, bcc
+	Status       string     `json:"status"`
+	DeliveredAt  *time.Time `json:"deliveredAt,omitempty"`
+	OpenedAt     *time.Time `json:"openedAt,omitempty"`
+	ClickedAt    *time.Time `json:"clickedAt,omitempty"`
+	BouncedAt    *time.Time `json:"bouncedAt,omitempty"`
+	BounceClass  string     `json:"bounceClass,omitempty"`
+	BounceReason string     `json:"bounceReason,omitempty"`
+	ComplainedAt *time.Time `json:"complainedAt,omitempty"`
+}
+
+// Domain probation review DTOs
+
+// HeldEmail is a transactional email held for review while its sender domain is on probation
+type HeldEmail struct {
+	ID         string    `json:"id"`
+	MessageID  string    `json:"messageId"`
+	From       string    `json:"from"`
+	To         []string  `json:"to"`
+	Subject    string    `json:"subject"`
+	Domain     string    `json:"domain"`
+	HoldReason string    `json:"holdReason"`
+	CreatedAt  time.Time `json:"createdAt"`
+}
+
+type RejectEmailRequest struct {
+	Reason string `json:"reason" v:"required|max-length:500"`
+}
+
+// Email stats DTOs
+
+type EmailStatsQuery struct {
+	From     string `json:"from"`     // RFC3339, defaults to 30 days ago
+	To       string `json:"to"`       // RFC3339, defaults to now
+	Interval string `json:"interval"` // hour, day, week, month; omit for totals only
+	Key      string `json:"key"`      // Metadata key when grouping by metadata, rotation pool when grouping by sender
+	Limit    int    `json:"limit"`
+}
+
+type EmailStatsCounts struct {
+	Sent         int     `json:"sent"`
+	Delivered    int     `json:"delivered"`
+	Opened       int     `json:"opened"`
+	Clicked      int     `json:"clicked"`
+	Bounced      int     `json:"bounced"`
+	Complained   int     `json:"complained"`
+	DeliveryRate float64 `json:"deliveryRate"`
+	OpenRate     float64 `json:"openRate"`
+	ClickRate    float64 `json:"clickRate"`
+	BounceRate   float64 `json:"bounceRate"`
+}
+
+type EmailStatsBucket struct {
+	Bucket time.Time `json:"bucket"`
+	EmailStatsCounts
+}
+
+type EmailStatsGroup struct {
+	Key   string `json:"key"`
+	Label string `json:"label,omitempty"`
+	EmailStatsCounts
+	Series []EmailStatsBucket `json:"series,omitempty"`
+}
+
+type EmailStatsResponse struct {
+	GroupBy  string            `json:"groupBy"` // tag, template, metadata
+	Key      string            `json:"key,omitempty"`
+	From     time.Time         `json:"from"`
+	To       time.Time         `json:"to"`
+	Interval string            `json:"interval,omitempty"`
+	Groups   []EmailStatsGroup `json:"groups"`
+}
+
+// Recipient history DTOs
+
+type RecipientHistoryQuery struct {
+	From  string `json:"from"` // RFC3339, defaults to the full retained history
+	To    string `json:"to"`   // RFC3339, defaults to now
+	Limit int    `json:"limit"`
+}
+
+type RecipientEvent struct {
+	Type      string    `json:"type"`
+	Details   string    `json:"details,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+type RecipientSend struct {
+	ID              string           `json:"id"`
+	Type            string           `json:"type"` // transactional, campaign
+	MessageID       string           `json:"messageId"`
+	From            string           `json:"from"`
+	Subject         string           `json:"subject"`
+	Status          string           `json:"status"`
+	CampaignID      string           `json:"campaignId,omitempty"`
+	CampaignName    string           `json:"campaignName,omitempty"`
+	BounceClass     string           `json:"bounceClass,omitempty"`
+	BounceReason    string           `json:"bounceReason,omitempty"`
+	ContentArchived bool             `json:"contentArchived,omitempty"` // Body removed by the retention policy
+	CreatedAt       time.Time        `json:"createdAt"`
+	SentAt          *time.Time       `json:"sentAt,omitempty"`
+	Events          []RecipientEvent `json:"events"`
+}
+
+type RecipientSuppression struct {
+	Email     string    `json:"email"`
+	Reason    string    `json:"reason"`
+	Source    string    `json:"source"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type RecipientReply struct {
+	ID         string    `json:"id"`
+	MessageID  string    `json:"messageId"`
+	InReplyTo  string    `json:"inReplyTo,omitempty"`
+	Subject    string    `json:"subject"`
+	Snippet    string    `json:"snippet,omitempty"`
+	ReceivedAt time.Time `json:"receivedAt"`
+}
+
+type RecipientRetention struct {
+	StripContentAfterDays int        `json:"stripContentAfterDays"`
+	DeleteAfterDays       int        `json:"deleteAfterDays"`
+	HistoryAvailableFrom  *time.Time `json:"historyAvailableFrom,omitempty"` // Older sends have been deleted
+}
+
+type RecipientHistoryResponse struct {
+	Email           string                 `json:"email"`
+	NormalizedEmail string                 `json:"normalizedEmail"`
+	Suppressed      bool                   `json:"suppressed"`
+	Sends           []RecipientSend        `json:"sends"`
+	Suppressions    []RecipientSuppression `json:"suppressions"`
+	Replies         []RecipientReply       `json:"replies"`
+	Retention       RecipientRetention     `json:"retention"`
+}
+
+// Suppression DTOs
+
+// SuppressionDetail explains why a recipient cannot be sent to
+type SuppressionDetail struct {
+	Email           string    `json:"email"`           // Address as given by the caller
+	SuppressedEmail string    `json:"suppressedEmail"` // Address on the suppression list, may be an alias of Email
+	Reason          string    `json:"reason"`
+	Source          string    `json:"source"` // bounce, complaint, manual, unsubscribe
+	SuppressedAt    time.Time `json:"suppressedAt"`
+	RemoveEndpoint  string    `json:"removeEndpoint,omitempty"` // Call to lift the suppression, absent for erased contacts
+}
+
+type SuppressionCheckRequest struct {
+	Emails []string `json:"emails" v:"required"`
+}
+
+type SuppressionCheckResult struct {
+	Email       string             `json:"email"`
+	Suppressed  bool               `json:"suppressed"`
+	Suppression *SuppressionDetail `json:"suppression,omitempty"`
+}
+
+type SuppressionCheckResponse struct {
+	Results         []SuppressionCheckResult `json:"results"`
+	SuppressedCount int                      `json:"suppressedCount"`
 }
 
 // Template API Request DTOs
 
 type CreateTemplateRequest struct {
-	Name        string `json:"name" v:"required|min-length:2"`
-	Description string `json:"description"`
-	Subject     string `json:"subject" v:"required"`
-	HTML        string `json:"html" v:"required"`
-	Text        string `json:"text"`
+	Name           string         `json:"name" v:"required|min-length:2"`
+	Description    string         `json:"description"`
+	Subject        string         `json:"subject" v:"required"`
+	HTML           string         `json:"html"`   // HTML body, or
+	MJML           string         `json:"mjml"`   // MJML source compiled to the HTML body, or
+	Design         map[string]any `json:"design"` // Block design rendered to the HTML body
+	Text           string         `json:"text"`
+	AMP            string         `json:"amp"`            // AMP for Email part, sent alongside the HTML body
+	UseLayout      *bool          `json:"useLayout"`      // Wrap the HTML body in the org's header and footer, default true
+	VariableSchema map[string]any `json:"variableSchema"` // JSON schema of the variables sends must pass
 }
 
 type UpdateTemplateRequest struct {
-	Name        string `json:"name"`
-	Description string `json:"description"`
-	Subject     string `json:"subject"`
-	HTML        string `json:"html"`
-	Text        string `json:"text"`
-	IsActive    *bool  `json:"isActive"`
+	Name           string         `json:"name"`
+	Description    string         `json:"description"`
+	Subject        string         `json:"subject"`
+	HTML           string         `json:"html"`   // Replaces the body, an MJML or design template becomes plain HTML
+	MJML           string         `json:"mjml"`   // Replaces the MJML source and recompiles the body
+	Design         map[string]any `json:"design"` // Replaces the block design and rerenders the body
+	Text           string         `json:"text"`
+	AMP            *string        `json:"amp"` // Replaces the AMP part, "" removes it
+	UseLayout      *bool          `json:"useLayout"`
+	VariableSchema map[string]any `json:"variableSchema"` // Replaces the schema, {} removes it
+	IsActive       *bool          `json:"isActive"`
 }
 
 type PreviewTemplateRequest struct {
-	Variables map[string]string `json:"variables"`
+	Variables map[string]any `json:"variables"`
 }
 
 type PreviewTemplateResponse struct {
 	Subject string `json:"subject"`
 	HTML    string `json:"html"`
 	Text    string `json:"text"`
+	AMP     string `json:"amp,omitempty"`
+}
+
+type RenderDesignRequest struct {
+	Design map[string]any `json:"design" v:"required"`
+}
+
+type RenderDesignResponse struct {
+	HTML string `json:"html"` // HTML body a template saved with the design gets
+}
+
+type CreateTemplatePartialRequest struct {
+	Name        string `json:"name" v:"required"`
+	Description string `json:"description"`
+	Content     string `json:"content" v:"required"`
+}
+
+type UpdateTemplatePartialRequest struct {
+	Name        string  `json:"name"`
+	Description *string `json:"description"`
+	Content     string  `json:"content"`
+}
+
+// TestSendTemplateRequest sends a rendered template to members of the org or its
+// allowlisted test addresses
+type TestSendTemplateRequest struct {
+	From      string         `json:"from" v:"required|email"`
+	To        []string       `json:"to" v:"required"`
+	Variables map[string]any `json:"variables"`
+}
+
+// TemplateBundle is a portable copy of templates and the partials they include, for
+// moving them between organizations or environments
+type TemplateBundle struct {
+	Version    int                      `json:"version"`
+	ExportedAt time.Time                `json:"exportedAt"`
+	Templates  []TemplateBundleTemplate `json:"templates"`
+	Partials   []TemplateBundlePartial  `json:"partials"`
+	Assets     []TemplateBundleAsset    `json:"assets"` // Images the templates load, by URL
+}
+
+type TemplateBundleTemplate struct {
+	Name           string         `json:"name"`
+	Description    string         `json:"description,omitempty"`
+	Subject        string         `json:"subject"`
+	HTML           string         `json:"html"`
+	Text           string         `json:"text,omitempty"`
+	AMP            string         `json:"amp,omitempty"`
+	MJML           string         `json:"mjml,omitempty"`
+	Design         map[string]any `json:"design,omitempty"`
+	VariableSchema map[string]any `json:"variableSchema,omitempty"`
+	UseLayout      bool           `json:"useLayout"`
+	IsActive       bool           `json:"isActive"`
+}
+
+type TemplateBundlePartial struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Content     string `json:"content"`
+}
+
+// TemplateBundleAsset is an image the bundled templates reference. Assets are
+// listed so they can be checked from the target environment, not copied.
+type TemplateBundleAsset struct {
+	URL    string   `json:"url"`
+	UsedBy []string `json:"usedBy"` // Names of the templates and partials that load it
+}
+
+type ExportTemplatesRequest struct {
+	TemplateIDs []string `json:"templateIds"` // Template UUIDs, all templates when empty
+}
+
+type ImportTemplatesRequest struct {
+	Bundle     TemplateBundle `json:"bundle"`
+	OnConflict string         `json:"onConflict"` // skip (default), overwrite or rename when the name is taken
+	DryRun     bool           `json:"dryRun"`     // Report what would be imported without changing anything
+}
+
+type ImportTemplatesResponse struct {
+	DryRun    bool                 `json:"dryRun"`
+	Templates []TemplateImportItem `json:"templates"`
+	Partials  []TemplateImportItem `json:"partials"`
+}
+
+// TemplateImportItem is what happened to one template or partial of an imported bundle
+type TemplateImportItem struct {
+	Name         string `json:"name"`                   // Name in the organization
+	OriginalName string `json:"originalName,omitempty"` // Name in the bundle, when renamed
+	UUID         string `json:"uuid,omitempty"`
+	Action       string `json:"action"` // created, updated, renamed, skipped or unchanged
 }
 
 // Webhook API Request/Response DTOs
@@ -492,7 +889,7 @@ type Contact struct {
 	FirstName        string            `json:"firstName,omitempty"`
 	LastName         string            `json:"lastName,omitempty"`
 	Attributes       map[string]any    `json:"attributes,omitempty"`
-	Status           string            `json:"status"` // active, unsubscribed, bounced, complained
+	Status           string            `json:"status"` // active, unsubscribed, bounced, complained, quarantined, erased
 	ConsentSource    string            `json:"consentSource,omitempty"`
 	ConsentTimestamp *time.Time        `json:"consentTimestamp,omitempty"`
 	ConsentIP        string            `json:"consentIp,omitempty"`
@@ -501,6 +898,52 @@ type Contact struct {
 	CreatedAt        time.Time         `json:"createdAt"`
 	UpdatedAt        time.Time         `json:"updatedAt"`
 	Lists            []ListMembership  `json:"lists,omitempty"`
+	Tags             []string          `json:"tags,omitempty"`
+
+	// Verification is the last list hygiene check of the contact's address
+	Verification *ContactVerification `json:"verification,omitempty"`
+}
+
+// BulkContactRequest for applying an operation to every contact of a segment or filter
+type BulkContactRequest struct {
+	Operation  string            `json:"operation" v:"required"` // add_tag, remove_tag, set_status, add_to_list, remove_from_list, move_to_list, delete
+	Tag        string            `json:"tag"`                    // add_tag, remove_tag
+	Status     string            `json:"status"`                 // set_status
+	ListID     string            `json:"listId"`                 // UUID of the static list added to, removed from or moved to
+	FromListID string            `json:"fromListId"`             // UUID of the static list moved out of
+	Target     BulkContactTarget `json:"target"`
+}
+
+// BulkContactTarget selects the contacts of a bulk operation. Its filters
+// combine with AND; All targets every contact and can't be combined with them.
+type BulkContactTarget struct {
+	All       bool     `json:"all"`
+	SegmentID string   `json:"segmentId"` // UUID of a list or segment whose members are targeted
+	Rules     any      `json:"rules"`     // Segment rules, as for dynamic lists
+	Query     string   `json:"query"`     // Email or name contains
+	Status    []string `json:"status"`
+}
+
+// ContactBulkJob is a bulk operation running in the background, and its progress
+type ContactBulkJob struct {
+	ID          string     `json:"id"`
+	Operation   string     `json:"operation"`
+	Status      string     `json:"status"`    // pending, running, completed, failed, cancelled
+	Total       int        `json:"total"`     // Contacts targeted when the job was created
+	Processed   int        `json:"processed"` // Contacts worked through so far
+	Affected    int        `json:"affected"`  // Contacts the operation changed
+	Progress    int        `json:"progress"`  // Percent
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// ContactVerification is the outcome of re-verifying a contact's address
+type ContactVerification struct {
+	Status     string    `json:"status"` // valid, risky, undeliverable, unknown
+	Reasons    []string  `json:"reasons,omitempty"`
+	VerifiedAt time.Time `json:"verifiedAt"`
 }
 
 // ListMembership represents a contact's membership in a list
@@ -512,16 +955,102 @@ type ListMembership struct {
 
 // List represents a contact list
 type List struct {
-	ID           int       `json:"id"`
-	UUID         string    `json:"uuid"`
-	OrgID        int64     `json:"orgId"`
-	Name         string    `json:"name"`
-	Description  string    `json:"description,omitempty"`
-	Type         string    `json:"type"` // static, dynamic
-	SegmentRules any       `json:"segmentRules,omitempty"`
-	ContactCount int       `json:"contactCount"`
-	CreatedAt    time.Time `json:"createdAt"`
-	UpdatedAt    time.Time `json:"updatedAt"`
+	ID                 int          `json:"id"`
+	UUID               string       `json:"uuid"`
+	OrgID              int64        `json:"orgId"`
+	Name               string       `json:"name"`
+	Description        string       `json:"description,omitempty"`
+	Type               string       `json:"type"` // static, dynamic
+	SegmentRules       any          `json:"segmentRules,omitempty"`
+	SegmentRefreshedAt *time.Time   `json:"segmentRefreshedAt,omitempty"` // When a dynamic list's members were last materialized
+	ContactCount       int          `json:"contactCount"`
+	Settings           ListSettings `json:"settings"`
+	CreatedAt          time.Time    `json:"createdAt"`
+	UpdatedAt          time.Time    `json:"updatedAt"`
+}
+
+// ListSettings are how a list treats contacts who join it through signup forms
+// and imports
+type ListSettings struct {
+	FromIdentityID      string `json:"fromIdentityId,omitempty"`      // Identity confirmation emails are sent from
+	DoubleOptIn         bool   `json:"doubleOptIn"`                   // Contacts join once they confirm by email
+	WelcomeAutomationID string `json:"welcomeAutomationId,omitempty"` // Automation contacts are enrolled in when they join
+	Language            string `json:"language,omitempty"`            // Language of confirmation emails, like en or pt-BR
+}
+
+type ListStatsQuery struct {
+	From string `json:"from"` // 2006-01-02, defaults to Days before To
+	To   string `json:"to"`   // 2006-01-02, defaults to today
+	Days int    `json:"days"` // Length of the range when From isn't given, 30 by default
+}
+
+// ListStats is how a list grew and churned over a range of days
+type ListStats struct {
+	ListID       string            `json:"listId"`
+	From         string            `json:"from"`
+	To           string            `json:"to"`
+	MemberCount  int               `json:"memberCount"` // Active members now
+	Subscribed   int               `json:"subscribed"`
+	Unsubscribed int               `json:"unsubscribed"`
+	Bounced      int               `json:"bounced"`
+	Complained   int               `json:"complained"`
+	Removed      int               `json:"removed"`
+	NetGrowth    int               `json:"netGrowth"` // Subscribed less every member lost
+	ChurnRate    float64           `json:"churnRate"` // Members lost over members at the start of the range, in percent
+	Sources      []ListStatsSource `json:"sources"`
+	Days         []ListStatsDay    `json:"days"`
+}
+
+// ListStatsSource is how many contacts joined a list from a source, like form,
+// import or api
+type ListStatsSource struct {
+	Source     string `json:"source"`
+	Subscribed int    `json:"subscribed"`
+}
+
+type ListStatsDay struct {
+	Date         string `json:"date"`
+	Subscribed   int    `json:"subscribed"`
+	Unsubscribed int    `json:"unsubscribed"`
+	Bounced      int    `json:"bounced"`
+	Complained   int    `json:"complained"`
+	Removed      int    `json:"removed"`
+	Net          int    `json:"net"`
+}
+
+// SubscriptionTopic is a kind of email, like a newsletter or billing notices,
+// contacts can opt out of without unsubscribing from everything
+type SubscriptionTopic struct {
+	ID          int       `json:"id"`
+	UUID        string    `json:"uuid"`
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	OptOutCount int       `json:"optOutCount"` // Contacts opted out of the topic
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type CreateSubscriptionTopicRequest struct {
+	Name        string `json:"name" v:"required"`
+	Description string `json:"description"`
+}
+
+type UpdateSubscriptionTopicRequest struct {
+	Name        *string `json:"name"`
+	Description *string `json:"description"`
+}
+
+// ContactTopic is whether a contact gets the emails of a topic
+type ContactTopic struct {
+	ID          int    `json:"id"`
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Subscribed  bool   `json:"subscribed"`
+}
+
+// UpdateContactTopicsRequest replaces the topics a contact opted out of
+type UpdateContactTopicsRequest struct {
+	OptedOutTopicIDs []int `json:"optedOutTopicIds"`
 }
 
 // Contact API Request DTOs
@@ -567,17 +1096,230 @@ type ImportContactRow struct {
 	Attributes map[string]any `json:"attributes"`
 }
 
+// GDPRExportSummary describes a data subject export: how many records of each
+// kind the archive holds
+type GDPRExportSummary struct {
+	ContactUUID string         `json:"contactUuid"`
+	Records     map[string]int `json:"records"`
+	ExportedAt  time.Time      `json:"exportedAt"`
+}
+
+// GDPRErasureResult counts what erasing a contact's personal data changed
+type GDPRErasureResult struct {
+	ContactUUID         string    `json:"contactUuid"`
+	ListMemberships     int       `json:"listMemberships"`
+	Emails              int       `json:"emails"`
+	CampaignRecipients  int       `json:"campaignRecipients"`
+	TransactionalEmails int       `json:"transactionalEmails"`
+	ReceivedEmails      int       `json:"receivedEmails"`
+	ContactEvents       int       `json:"contactEvents"`
+	ContactChanges      int       `json:"contactChanges"`
+	StoredFiles         int       `json:"storedFiles"`               // Raw messages, attachments and thumbnails deleted from storage
+	StorageFailures     []string  `json:"storageFailures,omitempty"` // Stored files that could not be deleted
+	ErasedAt            time.Time `json:"erasedAt"`
+}
+
+// ContactEngagement is a contact's engagement score with how it changed
+type ContactEngagement struct {
+	Score         float64                `json:"score"` // 0 to 100
+	LastEngagedAt *time.Time             `json:"lastEngagedAt,omitempty"`
+	History       []EngagementScorePoint `json:"history"` // Oldest first
+}
+
+// EngagementScorePoint is a contact's score from when it was computed
+type EngagementScorePoint struct {
+	Score      float64   `json:"score"`
+	ComputedAt time.Time `json:"computedAt"`
+}
+
+// SignupForm is a public form that subscribes the contacts who submit it to
+// lists. HTML forms post straight to its submit URL.
+type SignupForm struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	ListIDs          []string   `json:"listIds"`
+	Fields           []string   `json:"fields"`         // Attributes the form may set
+	AllowedOrigins   []string   `json:"allowedOrigins"` // Empty for any
+	HoneypotField    string     `json:"honeypotField,omitempty"`
+	TurnstileEnabled bool       `json:"turnstileEnabled"`
+	RedirectURL      string     `json:"redirectUrl,omitempty"`
+	SuccessMessage   string     `json:"successMessage,omitempty"`
+	RateLimit        int        `json:"rateLimit"` // Submissions per IP per hour
+	Active           bool       `json:"active"`
+	SubmissionCount  int        `json:"submissionCount"`
+	LastSubmittedAt  *time.Time `json:"lastSubmittedAt,omitempty"`
+	SubmitURL        string     `json:"submitUrl"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        time.Time  `json:"updatedAt"`
+}
+
+// CreateSignupFormRequest creates a signup form. Its lists must be static.
+type CreateSignupFormRequest struct {
+	Name            string   `json:"name" v:"required"`
+	ListIDs         []string `json:"listIds" v:"required"`
+	Fields          []string `json:"fields"`
+	AllowedOrigins  []string `json:"allowedOrigins"`
+	HoneypotField   string   `json:"honeypotField"`
+	TurnstileSecret string   `json:"turnstileSecret"` // Cloudflare Turnstile secret key
+	RedirectURL     string   `json:"redirectUrl"`
+	SuccessMessage  string   `json:"successMessage"`
+	RateLimit       int      `json:"rateLimit"`
+	Active          *bool    `json:"active"`
+}
+
+// UpdateSignupFormRequest changes the settings it sets. An empty turnstileSecret
+// turns the check off.
+type UpdateSignupFormRequest struct {
+	Name            *string   `json:"name"`
+	ListIDs         *[]string `json:"listIds"`
+	Fields          *[]string `json:"fields"`
+	AllowedOrigins  *[]string `json:"allowedOrigins"`
+	HoneypotField   *string   `json:"honeypotField"`
+	TurnstileSecret *string   `json:"turnstileSecret"`
+	RedirectURL     *string   `json:"redirectUrl"`
+	SuccessMessage  *string   `json:"successMessage"`
+	RateLimit       *int      `json:"rateLimit"`
+	Active          *bool     `json:"active"`
+}
+
+// SignupFormResult is the response to a form submission
+type SignupFormResult struct {
+	Message              string `json:"message"`
+	RedirectURL          string `json:"redirectUrl,omitempty"`
+	ConfirmationRequired bool   `json:"confirmationRequired"` // The contact was emailed to confirm a double opt-in list
+}
+
+// TrackContactEventRequest records a custom event against a contact, found by
+// its UUID or its email
+type TrackContactEventRequest struct {
+	Event      string         `json:"event" v:"required"` // purchase, login, ...
+	ContactID  string         `json:"contactId"`          // The contact's UUID
+	Email      string         `json:"email"`
+	Properties map[string]any `json:"properties"`
+	OccurredAt *time.Time     `json:"occurredAt"` // Now by default
+}
+
+// ContactEvent is a custom event recorded against a contact
+type ContactEvent struct {
+	ID         string         `json:"id"`
+	ContactID  string         `json:"contactId"`
+	Event      string         `json:"event"`
+	Properties map[string]any `json:"properties"`
+	OccurredAt time.Time      `json:"occurredAt"`
+	CreatedAt  time.Time      `json:"createdAt"`
+	Enrolled   int            `json:"enrolled,omitempty"` // Automations recording it enrolled the contact in
+}
+
+// ContactChange is a change to one of a contact's fields or custom attributes,
+// with what made it
+type ContactChange struct {
+	ID        int64     `json:"id"`
+	Field     string    `json:"field"`              // email, firstName, lastName, status or attributes.<key>
+	OldValue  any       `json:"oldValue"`           // Null when the attribute was added
+	NewValue  any       `json:"newValue"`           // Null when the attribute was removed
+	Source    string    `json:"source"`             // api, import, form, bulk or crm
+	SourceID  string    `json:"sourceId,omitempty"` // The list, form, bulk job or CRM connection it came from
+	UserID    *int64    `json:"userId,omitempty"`   // The user who made it, if any
+	UserEmail string    `json:"userEmail,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// CRMFieldMapping maps a contact field to a property of the CRM's contacts
+type CRMFieldMapping struct {
+	Field     string `json:"field"`     // firstName, lastName, status, engagementScore, lastEngagedAt or attributes.<key>
+	CRMField  string `json:"crmField"`  // The CRM property
+	Direction string `json:"direction"` // push, pull or both
+}
+
+// CRMConnection is an org's HubSpot or Salesforce account its contacts sync
+// with
+type CRMConnection struct {
+	ID            string            `json:"id"`
+	Provider      string            `json:"provider"` // hubspot or salesforce
+	AccountID     string            `json:"accountId,omitempty"`
+	FieldMappings []CRMFieldMapping `json:"fieldMappings"`
+	PushEnabled   bool              `json:"pushEnabled"` // Contacts' status and engagement go to the CRM
+	PullEnabled   bool              `json:"pullEnabled"` // The CRM's changes come to contacts
+	Status        string            `json:"status"`      // active or error
+	LastError     string            `json:"lastError,omitempty"`
+	LastSyncedAt  *time.Time        `json:"lastSyncedAt,omitempty"`
+	CreatedAt     time.Time         `json:"createdAt"`
+	UpdatedAt     time.Time         `json:"updatedAt"`
+}
+
+// UpdateCRMConnectionRequest changes how a CRM connection syncs
+type UpdateCRMConnectionRequest struct {
+	FieldMappings *[]CRMFieldMapping `json:"fieldMappings"`
+	PushEnabled   *bool              `json:"pushEnabled"`
+	PullEnabled   *bool              `json:"pullEnabled"`
+}
+
+// CRMConnectResult is where to send the user to connect their CRM account
+type CRMConnectResult struct {
+	AuthURL string `json:"authUrl"`
+}
+
+// CRMSyncRun is one sync of a CRM connection
+type CRMSyncRun struct {
+	ID          string     `json:"id"`
+	Trigger     string     `json:"trigger"` // scheduled or manual
+	Status      string     `json:"status"`  // pending, running, completed or failed
+	Pushed      int        `json:"pushed"`  // Contacts sent to the CRM
+	Pulled      int        `json:"pulled"`  // Contacts the CRM's changes updated
+	Failed      int        `json:"failed"`  // Contacts the CRM didn't take
+	Error       string     `json:"error,omitempty"`
+	StartedAt   *time.Time `json:"startedAt,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// ContactField is a typed custom attribute of the org's contacts, with the
+// segment operators conditions on it can use
+type ContactField struct {
+	UUID        string    `json:"uuid"`
+	Key         string    `json:"key"` // Key in the contact's attributes
+	Label       string    `json:"label"`
+	Type        string    `json:"type"`              // string, number, date, boolean, enum
+	Options     []string  `json:"options,omitempty"` // enum fields
+	Required    bool      `json:"required"`
+	Description string    `json:"description,omitempty"`
+	Operators   []string  `json:"operators"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+type CreateContactFieldRequest struct {
+	Key         string   `json:"key" v:"required"`
+	Label       string   `json:"label" v:"required"`
+	Type        string   `json:"type" v:"required|in:string,number,date,boolean,enum"`
+	Options     []string `json:"options"`
+	Required    bool     `json:"required"`
+	Description string   `json:"description"`
+}
+
+// UpdateContactFieldRequest changes a field. Its key and type are fixed, as
+// contacts already hold values under them.
+type UpdateContactFieldRequest struct {
+	Label       string   `json:"label"`
+	Options     []string `json:"options"`
+	Required    *bool    `json:"required"`
+	Description *string  `json:"description"`
+}
+
 type ImportContactsResponse struct {
 	Imported    int      `json:"imported"`
 	Updated     int      `json:"updated"`
 	Skipped     int      `json:"skipped"`
+	Pending     int      `json:"pending"` // Contacts emailed to confirm a double opt-in list
 	Errors      []string `json:"errors,omitempty"`
 }
 
 type ExportContactsRequest struct {
-	ListIDs []int    `json:"listIds"`
-	Status  []string `json:"status"` // active, unsubscribed, etc.
-	Format  string   `json:"format"` // csv, json
+	ListIDs     []int    `json:"listIds"`     // Members of any of the lists or segments
+	Status      []string `json:"status"`      // active, unsubscribed, etc.
+	Rules       any      `json:"rules"`       // Segment rules the contacts match
+	Format      string   `json:"format"`      // csv (default) or json
+	Destination string   `json:"destination"` // download (default) or s3
 }
 
 type ContactSearchRequest struct {
@@ -593,16 +1335,29 @@ type ContactSearchRequest struct {
 // List API Request DTOs
 
 type CreateListRequest struct {
-	Name         string `json:"name" v:"required|min-length:2"`
-	Description  string `json:"description"`
-	Type         string `json:"type" d:"static"` // static, dynamic
-	SegmentRules any    `json:"segmentRules"`
+	Name         string        `json:"name" v:"required|min-length:2"`
+	Description  string        `json:"description"`
+	Type         string        `json:"type" d:"static"` // static, dynamic
+	SegmentRules any           `json:"segmentRules"`
+	Settings     *ListSettings `json:"settings"`
 }
 
 type UpdateListRequest struct {
-	Name         string `json:"name"`
-	Description  string `json:"description"`
-	SegmentRules any    `json:"segmentRules"`
+	Name         string        `json:"name"`
+	Description  string        `json:"description"`
+	SegmentRules any           `json:"segmentRules"`
+	Settings     *ListSettings `json:"settings"` // Replaces all of the list's settings
+}
+
+// PreviewSegmentRequest counts the contacts segment rules select, before they're
+// saved on a dynamic list
+type PreviewSegmentRequest struct {
+	SegmentRules any `json:"segmentRules" v:"required"`
+}
+
+type SegmentPreview struct {
+	Count  int      `json:"count"`
+	Sample []string `json:"sample"` // Emails of the newest matching contacts
 }
 
 type AddContactsToListRequest struct {
@@ -615,9 +1370,10 @@ type RemoveContactsFromListRequest struct {
 
 // ImportContactsToListRequest for bulk importing contacts directly to a list
 type ImportContactsToListRequest struct {
-	Contacts       []ImportContactRow `json:"contacts" v:"required"`
-	UpdateExisting bool               `json:"updateExisting"`
-	ConsentSource  string             `json:"consentSource"`
+	Contacts         []ImportContactRow `json:"contacts" v:"required"`
+	UpdateExisting   bool               `json:"updateExisting"`
+	ConsentSource    string             `json:"consentSource"`
+	SkipConfirmation bool               `json:"skipConfirmation"` // Add contacts to a double opt-in list without confirmation
 }
 
 // ImportContactsToListResponse returns the result of importing contacts to a list
@@ -625,6 +1381,7 @@ type ImportContactsToListResponse struct {
 	Imported int      `json:"imported"`
 	Updated  int      `json:"updated"`
 	Skipped  int      `json:"skipped"`
+	Pending  int      `json:"pending"` // Contacts emailed to confirm the list's double opt-in
 	Errors   []string `json:"errors,omitempty"`
 }
 
@@ -636,41 +1393,237 @@ type ManualAddContactToListRequest struct {
 	Attributes map[string]interface{} `json:"attributes"`
 }
 
+// OrgBackup is an encrypted backup of the organization's contacts, lists and consent history
+type OrgBackup struct {
+	ID              string     `json:"id"`
+	Trigger         string     `json:"trigger"` // scheduled, manual
+	Status          string     `json:"status"`  // pending, running, completed, failed, expired
+	Size            int64      `json:"size"`
+	Checksum        string     `json:"checksum,omitempty"` // SHA-256 of the encrypted archive, hex
+	ContactCount    int        `json:"contactCount"`
+	ListCount       int        `json:"listCount"`
+	MembershipCount int        `json:"membershipCount"`
+	ConsentCount    int        `json:"consentCount"`
+	Error           string     `json:"error,omitempty"`
+	VerifiedAt      *time.Time `json:"verifiedAt,omitempty"`
+	CompletedAt     *time.Time `json:"completedAt,omitempty"`
+	LastRestoredAt  *time.Time `json:"lastRestoredAt,omitempty"`
+	CreatedAt       time.Time  `json:"createdAt"`
+}
+
+// ListHygieneRun is a re-verification of the organization's stale contacts
+// and its report
+type ListHygieneRun struct {
+	ID            string               `json:"id"`
+	Trigger       string               `json:"trigger"` // scheduled, manual
+	Status        string               `json:"status"`  // pending, running, completed, failed
+	Checked       int                  `json:"checked"`
+	Valid         int                  `json:"valid"`
+	Risky         int                  `json:"risky"`
+	Undeliverable int                  `json:"undeliverable"`
+	Unknown       int                  `json:"unknown"` // Left to be checked again next run
+	Quarantined   int                  `json:"quarantined"`
+	Reasons       map[string]int       `json:"reasons"`           // Flagged contacts per reason
+	Flagged       []ListHygieneFlagged `json:"flagged,omitempty"` // The first flagged contacts, in the run's report only
+	Error         string               `json:"error,omitempty"`
+	StartedAt     *time.Time           `json:"startedAt,omitempty"`
+	CompletedAt   *time.Time           `json:"completedAt,omitempty"`
+	CreatedAt     time.Time            `json:"createdAt"`
+}
+
+// ListHygieneFlagged is a contact a list hygiene run flagged
+type ListHygieneFlagged struct {
+	ContactUUID string   `json:"contactUuid"`
+	Email       string   `json:"email"`
+	Verdict     string   `json:"verdict"` // risky, undeliverable
+	Reasons     []string `json:"reasons"`
+	Quarantined bool     `json:"quarantined"`
+}
+
+// EventExport is an export of the organization's delivery events for a date range
+type EventExport struct {
+	ID          string     `json:"id"`
+	Format      string     `json:"format"`      // csv, ndjson
+	Destination string     `json:"destination"` // download, s3
+	From        time.Time  `json:"from"`
+	To          time.Time  `json:"to"`
+	Status      string     `json:"status"` // pending, running, completed, failed
+	RowCount    int        `json:"rowCount"`
+	Size        int64      `json:"size"`
+	Location    string     `json:"location,omitempty"`    // s3://bucket/key for exports to the org's bucket
+	DownloadURL string     `json:"downloadUrl,omitempty"` // Presigned, valid for an hour
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// ContactExport is an export of the organization's contacts
+type ContactExport struct {
+	ID          string     `json:"id"`
+	Format      string     `json:"format"`      // csv, json
+	Destination string     `json:"destination"` // download, s3
+	Filters     any        `json:"filters"`
+	Status      string     `json:"status"` // pending, running, completed, failed
+	RowCount    int        `json:"rowCount"`
+	Size        int64      `json:"size"`
+	Location    string     `json:"location,omitempty"`    // s3://bucket/key for exports to the org's bucket
+	DownloadURL string     `json:"downloadUrl,omitempty"` // Presigned, valid for an hour
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// MailboxExport is an export of an identity's emails, for offboarding and
+// legal discovery
+type MailboxExport struct {
+	ID          string     `json:"id"`
+	IdentityID  int64      `json:"identityId"`
+	Email       string     `json:"email"`       // The identity's address
+	Format      string     `json:"format"`      // mbox, eml
+	Destination string     `json:"destination"` // download, s3
+	Status      string     `json:"status"`      // pending, running, completed, failed
+	EmailCount  int        `json:"emailCount"`
+	Size        int64      `json:"size"`
+	Location    string     `json:"location,omitempty"`    // s3://bucket/key for exports to the org's bucket
+	DownloadURL string     `json:"downloadUrl,omitempty"` // Presigned, valid for an hour
+	Error       string     `json:"error,omitempty"`
+	CompletedAt *time.Time `json:"completedAt,omitempty"`
+	ExpiresAt   *time.Time `json:"expiresAt,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+}
+
+// CreateMailboxExportRequest for exporting an identity's emails
+type CreateMailboxExportRequest struct {
+	IdentityID  int64  `json:"identityId" v:"required"`
+	Format      string `json:"format"`      // mbox (default), or eml for a zip of EML files
+	Destination string `json:"destination"` // download (default) or s3
+}
+
+// CreateEventExportRequest for exporting delivery events
+type CreateEventExportRequest struct {
+	From        string `json:"from" v:"required"` // RFC 3339 time or YYYY-MM-DD
+	To          string `json:"to" v:"required"`   // RFC 3339 time or YYYY-MM-DD, a date includes the whole day
+	Format      string `json:"format"`            // csv (default) or ndjson
+	Destination string `json:"destination"`       // download (default) or s3
+}
+
+// RestoreBackupRequest for restoring the rows a backup has that were deleted since
+type RestoreBackupRequest struct {
+	DryRun bool `json:"dryRun"` // Report what would be restored without changing anything
+}
+
+// BackupRestoreResult counts the rows restored from a backup
+type BackupRestoreResult struct {
+	DryRun          bool `json:"dryRun"`
+	Contacts        int  `json:"contacts"`
+	Lists           int  `json:"lists"`
+	Memberships     int  `json:"memberships"`
+	Consent         int  `json:"consent"`
+	SkippedExisting int  `json:"skippedExisting"` // Deleted contacts whose email has been added again since
+	SkippedErased   int  `json:"skippedErased"`   // Contacts erased on request, which are never restored
+}
+
 // ===================
 // PHASE 3: CAMPAIGNS
 // ===================
 
 // Campaign represents an email campaign
 type Campaign struct {
-	ID               int        `json:"id"`
-	UUID             string     `json:"uuid"`
-	OrgID            int64      `json:"orgId"`
-	Name             string     `json:"name"`
-	Subject          string     `json:"subject"`
-	HTMLContent      string     `json:"htmlContent,omitempty"`
-	TextContent      string     `json:"textContent,omitempty"`
-	TemplateID       *int       `json:"templateId,omitempty"`
-	FromName         string     `json:"fromName"`
-	FromEmail        string     `json:"fromEmail"`
-	ReplyTo          string     `json:"replyTo,omitempty"`
-	ListID           int        `json:"listId"`
-	ListName         string     `json:"listName,omitempty"`
-	Status           string     `json:"status"` // draft, scheduled, sending, sent, paused, cancelled
-	ScheduledAt      *time.Time `json:"scheduledAt,omitempty"`
-	StartedAt        *time.Time `json:"startedAt,omitempty"`
-	CompletedAt      *time.Time `json:"completedAt,omitempty"`
-	TotalRecipients  int        `json:"totalRecipients"`
-	SentCount        int        `json:"sentCount"`
-	DeliveredCount   int        `json:"deliveredCount"`
-	OpenCount        int        `json:"openCount"`
-	ClickCount       int        `json:"clickCount"`
-	BounceCount      int        `json:"bounceCount"`
-	UnsubscribeCount int        `json:"unsubscribeCount"`
-	ComplaintCount   int        `json:"complaintCount"`
-	IsAbTest         bool       `json:"isAbTest"`
-	AbTestSettings   any        `json:"abTestSettings,omitempty"`
-	CreatedAt        time.Time  `json:"createdAt"`
-	UpdatedAt        time.Time  `json:"updatedAt"`
+	ID                int                     `json:"id"`
+	UUID              string                  `json:"uuid"`
+	OrgID             int64                   `json:"orgId"`
+	Name              string                  `json:"name"`
+	Subject           string                  `json:"subject"`
+	HTMLContent       string                  `json:"htmlContent,omitempty"`
+	TextContent       string                  `json:"textContent,omitempty"`
+	TemplateID        *int                    `json:"templateId,omitempty"`
+	FromName          string                  `json:"fromName"`
+	FromEmail         string                  `json:"fromEmail"`
+	ReplyTo           string                  `json:"replyTo,omitempty"`
+	ListID            int                     `json:"listId"`
+	ListName          string                  `json:"listName,omitempty"`
+	Audience          *CampaignAudience       `json:"audience,omitempty"` // Set when the campaign targets more than its list
+	Status            string                  `json:"status"`             // draft, scheduled, sending, sent, paused, cancelled
+	ScheduledAt       *time.Time              `json:"scheduledAt,omitempty"`
+	ScheduledLocal    string                  `json:"scheduledLocalTime,omitempty"` // Local date and time each recipient is sent at, for recipient local time schedules
+	StartedAt         *time.Time              `json:"startedAt,omitempty"`
+	CompletedAt       *time.Time              `json:"completedAt,omitempty"`
+	TotalRecipients   int                     `json:"totalRecipients"`
+	SentCount         int                     `json:"sentCount"`
+	DeliveredCount    int                     `json:"deliveredCount"`
+	OpenCount         int                     `json:"openCount"`
+	ClickCount        int                     `json:"clickCount"`
+	BounceCount       int                     `json:"bounceCount"`
+	UnsubscribeCount  int                     `json:"unsubscribeCount"`
+	ComplaintCount    int                     `json:"complaintCount"`
+	FailedCount       int                     `json:"failedCount"`
+	IsAbTest          bool                    `json:"isAbTest"`
+	AbTestSettings    any                     `json:"abTestSettings,omitempty"`
+	ParentCampaignID  *int                    `json:"parentCampaignId,omitempty"`
+	ParentUUID        string                  `json:"parentCampaignUuid,omitempty"`
+	ResendSettings    *CampaignResendSettings `json:"resendSettings,omitempty"`
+	Throttle          *CampaignThrottle       `json:"throttle,omitempty"`
+	IgnoreSendWindow  bool                    `json:"ignoreSendingWindow"` // Sent regardless of the org's sending window
+	SendTime          *CampaignSendTime       `json:"sendTimeOptimization,omitempty"`
+	UTM               *CampaignUTM            `json:"utm,omitempty"` // Overrides the org's UTM tagging
+	Suppression       *CampaignSuppression    `json:"suppression,omitempty"`
+	ContentSnapshotID *int64                  `json:"contentSnapshotId,omitempty"` // Content the campaign sends, frozen when it was scheduled or sent
+	ArchivedAt        *time.Time              `json:"archivedAt,omitempty"`        // Archived campaigns are left out of the default listing
+	CreatedAt         time.Time               `json:"createdAt"`
+	UpdatedAt         time.Time               `json:"updatedAt"`
+}
+
+// CampaignResendSettings describes which recipients of the parent campaign a resend targets
+type CampaignResendSettings struct {
+	Criteria   string `json:"criteria"`   // not_opened, not_clicked
+	WindowDays int    `json:"windowDays"` // engagement window after the parent send
+}
+
+// CampaignThrottle is a campaign's own send rate profile. It applies on top of org-wide
+// limits such as IP warmup, so a cold-list campaign can be drip-sent over days.
+type CampaignThrottle struct {
+	MessagesPerHour int    `json:"messagesPerHour"`        // rate once any ramp has completed
+	Ramp            string `json:"ramp,omitempty"`         // none, linear, exponential
+	StartPerHour    int    `json:"startPerHour,omitempty"` // rate when sending starts (ramped profiles)
+	RampHours       int    `json:"rampHours,omitempty"`    // hours to climb from startPerHour to messagesPerHour
+}
+
+// CampaignAudience targets a campaign at several lists and saved segments at
+// once. Contacts on more than one of them get the campaign once, and contacts on
+// an excluded list or segment don't get it at all.
+type CampaignAudience struct {
+	ListIDs        []int `json:"listIds,omitempty"`
+	SegmentIDs     []int `json:"segmentIds,omitempty"`     // Dynamic lists
+	ExcludeListIDs []int `json:"excludeListIds,omitempty"` // Lists or segments
+}
+
+// CampaignSuppression holds contacts back from a campaign when its recipients
+// are snapshotted: those sent any other campaign within the frequency cap, the
+// members of the suppression segments, and those opted out of its topic. The
+// campaign's unsubscribe links opt out of its topic only.
+type CampaignSuppression struct {
+	FrequencyCapDays int   `json:"frequencyCapDays,omitempty"` // 0 for no cap
+	SegmentIDs       []int `json:"segmentIds,omitempty"`       // Dynamic lists
+	TopicID          int   `json:"topicId,omitempty"`          // Subscription topic; contacts opted out of it are left out
+}
+
+// CampaignSendTime spreads a campaign over a window after it starts, sending
+// each recipient at the hour they have opened email the most. Recipients without
+// opens to go by, or whose hour falls outside the window, are sent right away.
+type CampaignSendTime struct {
+	WindowHours int `json:"windowHours"` // 1 to 72
+}
+
+// CampaignUTM overrides the org's UTM tagging of links for one campaign. Empty
+// values keep the org's.
+type CampaignUTM struct {
+	Enabled  *bool  `json:"enabled,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Content  string `json:"content,omitempty"`
 }
 
 // Campaign API Request DTOs
@@ -684,7 +1637,14 @@ type CreateCampaignRequest struct {
 	FromName    string `json:"fromName" v:"required"`
 	FromEmail   string `json:"fromEmail" v:"required|email"`
 	ReplyTo     string `json:"replyTo"`
-	ListID      int    `json:"listId" v:"required"`
+	ListID      int    `json:"listId"` // Required unless the audience has a list or segment
+
+	Audience         *CampaignAudience    `json:"audience"`             // Optional lists, segments and exclusions to target
+	Throttle         *CampaignThrottle    `json:"throttle"`             // Optional per-campaign send rate profile
+	IgnoreSendWindow bool                 `json:"ignoreSendingWindow"`  // Send outside the org's sending window
+	SendTime         *CampaignSendTime    `json:"sendTimeOptimization"` // Optional per-recipient send time optimization
+	UTM              *CampaignUTM         `json:"utm"`                  // Optional override of the org's UTM tagging
+	Suppression      *CampaignSuppression `json:"suppression"`          // Optional frequency cap and suppression segments
 }
 
 type UpdateCampaignRequest struct {
@@ -697,22 +1657,225 @@ type UpdateCampaignRequest struct {
 	FromEmail   string `json:"fromEmail"`
 	ReplyTo     string `json:"replyTo"`
 	ListID      *int   `json:"listId"`
+
+	Audience         *CampaignAudience    `json:"audience"`             // Replaces the audience; with neither it nor listId the audience is kept
+	Throttle         *CampaignThrottle    `json:"throttle"`             // Replaces the send rate profile; messagesPerHour 0 removes it
+	IgnoreSendWindow *bool                `json:"ignoreSendingWindow"`  // Send outside the org's sending window
+	SendTime         *CampaignSendTime    `json:"sendTimeOptimization"` // Replaces send time optimization; windowHours 0 turns it off
+	UTM              *CampaignUTM         `json:"utm"`                  // Replaces the UTM override; an empty one removes it
+	Suppression      *CampaignSuppression `json:"suppression"`          // Replaces the suppression settings; an empty one removes them
 }
 
+type ResendCampaignRequest struct {
+	Criteria   string `json:"criteria" d:"not_opened"` // not_opened, not_clicked
+	WindowDays int    `json:"windowDays" v:"required|between:1,30"`
+	Subject    string `json:"subject"` // Optional alternate subject line
+	Name       string `json:"name"`
+}
+
+// ResendUnopenedRequest creates a follow-up campaign to the recipients who didn't
+// open a campaign
+type ResendUnopenedRequest struct {
+	WindowDays int    `json:"windowDays" v:"required|between:1,30"` // Days after the send an open counts
+	Subject    string `json:"subject"`                              // Optional new subject line
+	Name       string `json:"name"`
+}
+
+type DuplicateCampaignRequest struct {
+	Name string `json:"name"` // Defaults to the original's name with " (copy)"
+}
+
+// ScheduleCampaignRequest schedules a campaign. With recipientLocalTime, the
+// wall clock time of scheduledAt is when each recipient gets the campaign in
+// their own timezone, such as 9am wherever they are.
 type ScheduleCampaignRequest struct {
-	ScheduledAt string `json:"scheduledAt" v:"required"` // RFC3339 timestamp
-	Timezone    string `json:"timezone" d:"UTC"`
+	ScheduledAt        string `json:"scheduledAt" v:"required"` // RFC3339 timestamp, or a local date and time in the timezone
+	Timezone           string `json:"timezone" d:"UTC"`         // IANA zone of a scheduledAt without a UTC offset
+	RecipientLocalTime bool   `json:"recipientLocalTime"`       // Send at scheduledAt's time of day in each recipient's timezone
+}
+
+// CampaignPreviewRequest picks the contact a campaign is rendered for. Without
+// one, the first active contact of the campaign's list is used.
+type CampaignPreviewRequest struct {
+	ContactID string `json:"contactId"` // Contact UUID
+}
+
+// CampaignTestSendRequest sends a campaign, rendered for a sample contact, to
+// members of the org or its allowlisted test addresses
+type CampaignTestSendRequest struct {
+	To        []string `json:"to"`
+	Email     string   `json:"email"`     // Single recipient, for clients that predate to
+	ContactID string   `json:"contactId"` // Contact UUID to render for, like in previews
+}
+
+// CampaignLintRequest lints unsaved content of a campaign. Parts left empty are
+// taken from the saved campaign.
+type CampaignLintRequest struct {
+	Subject     string `json:"subject"`
+	HTMLContent string `json:"htmlContent"`
+	TextContent string `json:"textContent"`
+}
+
+// CampaignLintResponse reports the merge tags of a campaign that won't render
+type CampaignLintResponse struct {
+	Valid         bool                `json:"valid"`         // No errors and no unknown tags
+	Errors        []CampaignLintIssue `json:"errors"`        // Syntax errors, which keep the campaign from being sent
+	UnknownTags   []CampaignLintIssue `json:"unknownTags"`   // Tags no contact of the list fills, which render their fallback or nothing
+	AvailableTags []string            `json:"availableTags"` // Contact fields and the attributes of the list's contacts
+}
+
+type CampaignLintIssue struct {
+	Field   string `json:"field"` // subject, htmlContent or textContent
+	Tag     string `json:"tag,omitempty"`
+	Message string `json:"message"`
+}
+
+// CampaignPreviewResponse is a campaign rendered for a contact
+type CampaignPreviewResponse struct {
+	Subject string                  `json:"subject"`
+	HTML    string                  `json:"html"`
+	Text    string                  `json:"text"`
+	Contact *CampaignPreviewContact `json:"contact,omitempty"` // Unset when the audience has no contacts
+}
+
+type CampaignPreviewContact struct {
+	UUID      string `json:"uuid"`
+	Email     string `json:"email"`
+	FirstName string `json:"firstName"`
+	LastName  string `json:"lastName"`
+}
+
+// RenderCampaignPreviewsRequest picks the email clients a campaign's inbox
+// previews are rendered for. Without any, the org's default clients are used.
+type RenderCampaignPreviewsRequest struct {
+	Clients []string `json:"clients"` // gmail, outlook, apple_mail
+}
+
+// CampaignInboxPreview is a screenshot of a campaign in one email client
+type CampaignInboxPreview struct {
+	Client     string    `json:"client"`
+	Status     string    `json:"status"` // ready, failed
+	ImageURL   string    `json:"imageUrl,omitempty"`
+	Error      string    `json:"error,omitempty"`
+	Stale      bool      `json:"stale"` // The campaign changed since it was rendered
+	RenderedAt time.Time `json:"renderedAt"`
+}
+
+// CampaignInboxPreviewsResponse lists a campaign's inbox previews
+type CampaignInboxPreviewsResponse struct {
+	Configured bool                   `json:"configured"` // An inbox preview service is set up
+	Previews   []CampaignInboxPreview `json:"previews"`
 }
 
 type CampaignStatsResponse struct {
-	Campaign         *Campaign `json:"campaign"`
-	OpenRate         float64   `json:"openRate"`
-	ClickRate        float64   `json:"clickRate"`
-	BounceRate       float64   `json:"bounceRate"`
-	UnsubscribeRate  float64   `json:"unsubscribeRate"`
-	ComplaintRate    float64   `json:"complaintRate"`
-	ClicksByLink     map[string]int `json:"clicksByLink,omitempty"`
-	OpensByHour      map[int]int    `json:"opensByHour,omitempty"`
+	Campaign          *Campaign          `json:"campaign"`
+	OpenRate          float64            `json:"openRate"`
+	ClickRate         float64            `json:"clickRate"`
+	BounceRate        float64            `json:"bounceRate"`
+	UnsubscribeRate   float64            `json:"unsubscribeRate"`
+	ComplaintRate     float64            `json:"complaintRate"`
+	ClicksByLink      map[string]int     `json:"clicksByLink,omitempty"`
+	OpensByHour       map[int]int        `json:"opensByHour,omitempty"`
+	ParentCampaign    *Campaign          `json:"parentCampaign,omitempty"` // Set for a resend
+	Resends           []Campaign         `json:"resends,omitempty"`
+	CombinedSent      int                `json:"combinedSentCount,omitempty"`  // Parent + resends
+	CombinedOpens     int                `json:"combinedOpenCount,omitempty"`  // Parent + resends
+	CombinedClicks    int                `json:"combinedClickCount,omitempty"` // Parent + resends
+	Conversions       int                `json:"conversions"`
+	Converted         int                `json:"convertedRecipients"` // Recipients with at least one conversion
+	ConversionRate    float64            `json:"conversionRate"`      // Percent of recipients sent to who converted
+	Revenue           float64            `json:"revenue"`
+	RevenueByCurrency map[string]float64 `json:"revenueByCurrency,omitempty"` // Set when conversions have currencies
+	ConversionPixel   string             `json:"conversionPixelUrl"`          // Load with ?email=&value=&currency=&orderId= on the thank you page
+}
+
+// CampaignLinkReport breaks a campaign's clicks down by link. Unique clicks
+// count each recipient once.
+type CampaignLinkReport struct {
+	TotalClicks  int                `json:"totalClicks"`
+	UniqueClicks int                `json:"uniqueClicks"` // Recipients who clicked any link
+	Links        []CampaignLinkStat `json:"links"`        // Most clicked first
+}
+
+type CampaignLinkStat struct {
+	URL             string    `json:"url"`
+	Display         string    `json:"display"` // Host and path of the URL
+	Clicks          int       `json:"clicks"`
+	UniqueClicks    int       `json:"uniqueClicks"`
+	UniqueClickRate float64   `json:"uniqueClickRate"` // Percent of recipients sent to
+	FirstClickedAt  time.Time `json:"firstClickedAt"`
+	LastClickedAt   time.Time `json:"lastClickedAt"`
+}
+
+// RecordConversionRequest reports a conversion of a campaign's recipient. An order
+// ID that was already reported isn't counted again.
+type RecordConversionRequest struct {
+	Email    string  `json:"email" v:"required|email"`
+	Value    float64 `json:"value" v:"min:0"`
+	Currency string  `json:"currency"` // ISO 4217 code
+	OrderID  string  `json:"orderId" v:"max-length:255"`
+}
+
+type CampaignConversion struct {
+	ID         int64     `json:"id"`
+	Email      string    `json:"email"`
+	Value      float64   `json:"value"`
+	Currency   string    `json:"currency,omitempty"`
+	OrderID    string    `json:"orderId,omitempty"`
+	Source     string    `json:"source"` // api, pixel
+	OccurredAt time.Time `json:"occurredAt"`
+	Duplicate  bool      `json:"duplicate,omitempty"` // The order was reported before, this is the earlier conversion
+}
+
+// CampaignSnapshot is a campaign's content as it was frozen when the campaign
+// was scheduled, sent or resumed. The campaign sends the latest one, so edits to
+// it or to its template made later don't change what goes out.
+type CampaignSnapshot struct {
+	ID                int64      `json:"id"`
+	Reason            string     `json:"reason"` // scheduled, sent, resumed
+	Subject           string     `json:"subject"`
+	HTMLContent       string     `json:"htmlContent,omitempty"`
+	TextContent       string     `json:"textContent,omitempty"`
+	FromName          string     `json:"fromName"`
+	FromEmail         string     `json:"fromEmail"`
+	ReplyTo           string     `json:"replyTo,omitempty"`
+	TemplateID        *int       `json:"templateId,omitempty"`
+	TemplateName      string     `json:"templateName,omitempty"`
+	TemplateUpdatedAt *time.Time `json:"templateUpdatedAt,omitempty"` // Version of the template the campaign was made from
+	ContentHash       string     `json:"contentHash"`
+	Current           bool       `json:"current"` // The snapshot the campaign sends
+	CreatedAt         time.Time  `json:"createdAt"`
+}
+
+// CampaignRecipientQuery filters a campaign's recipients
+type CampaignRecipientQuery struct {
+	Status   string `json:"status"` // queued, sent, delivered, opened, clicked, bounced, unsubscribed, failed, skipped, cancelled
+	Email    string `json:"email"`  // Part of the address
+	Page     int    `json:"page"`
+	PageSize int    `json:"pageSize"`
+}
+
+// CampaignRecipientActivity is how far a campaign got with one recipient. The
+// status is the furthest step reached: a bounce or an unsubscribe outranks opens
+// and clicks.
+type CampaignRecipientActivity struct {
+	ContactID   string     `json:"contactId,omitempty"`
+	Email       string     `json:"email"`
+	Status      string     `json:"status"`
+	SentAt      *time.Time `json:"sentAt,omitempty"`
+	DeliveredAt *time.Time `json:"deliveredAt,omitempty"`
+	OpenCount   int        `json:"openCount"`
+	ClickCount  int        `json:"clickCount"`
+	Error       string     `json:"error,omitempty"`
+}
+
+type CampaignRecipientListResponse struct {
+	Recipients []CampaignRecipientActivity `json:"recipients"`
+	Counts     map[string]int              `json:"counts"` // Recipients per status, before filtering
+	Total      int                         `json:"total"`
+	Page       int                         `json:"page"`
+	PageSize   int                         `json:"pageSize"`
+	TotalPages int                         `json:"totalPages"`
 }
 
 type CampaignListResponse struct {
@@ -750,20 +1913,47 @@ type AbTestVariant struct {
 
 // Automation represents an email automation workflow
 type Automation struct {
-	ID              int            `json:"id"`
-	UUID            string         `json:"uuid"`
-	OrgID           int            `json:"orgId"`
-	Name            string         `json:"name"`
-	Description     string         `json:"description,omitempty"`
-	TriggerType     string         `json:"triggerType"` // contact.created, contact.subscribed, tag.added, etc.
-	TriggerConfig   map[string]any `json:"triggerConfig,omitempty"`
-	Workflow        *Workflow      `json:"workflow"`
-	Status          string         `json:"status"` // draft, active, paused
-	EnrolledCount   int            `json:"enrolledCount"`
-	CompletedCount  int            `json:"completedCount"`
-	InProgressCount int            `json:"inProgressCount"`
-	CreatedAt       time.Time      `json:"createdAt"`
-	UpdatedAt       time.Time      `json:"updatedAt"`
+	ID                    int                    `json:"id"`
+	UUID                  string                 `json:"uuid"`
+	OrgID                 int                    `json:"orgId"`
+	Name                  string                 `json:"name"`
+	Description           string                 `json:"description,omitempty"`
+	TriggerType           string                 `json:"triggerType"` // contact.created, contact.subscribed, tag.added, contact.event, contact.date, email.received, etc.
+	TriggerConfig         map[string]any         `json:"triggerConfig,omitempty"`
+	TriggerURL            string                 `json:"triggerUrl,omitempty"`    // Where requests that trigger webhook automations are posted
+	WebhookSecret         string                 `json:"webhookSecret,omitempty"` // Signs those requests
+	Workflow              *Workflow              `json:"workflow"`
+	Version               int                    `json:"version"`               // Version of the workflow new enrollments start on
+	TopicID               *int                   `json:"topicId,omitempty"`     // Contacts opted out of the subscription topic aren't enrolled
+	Goal                  *AutomationGoal        `json:"goal,omitempty"`        // Contacts who reach it leave the workflow as conversions
+	AllowReenrollment     bool                   `json:"allowReenrollment"`     // Contacts whose enrollment is over can be enrolled again
+	ReenrollCooldownHours int                    `json:"reenrollCooldownHours"` // Hours since a contact was last enrolled before they can be again
+	ErrorPolicy           *AutomationErrorPolicy `json:"errorPolicy"`           // What happens when a node fails for a contact
+	Status                string                 `json:"status"`                // draft, active, paused
+	EnrolledCount         int                    `json:"enrolledCount"`
+	CompletedCount        int                    `json:"completedCount"`
+	InProgressCount       int                    `json:"inProgressCount"`
+	ConvertedCount        int                    `json:"convertedCount"`
+	CreatedAt             time.Time              `json:"createdAt"`
+	UpdatedAt             time.Time              `json:"updatedAt"`
+}
+
+// AutomationGoal is what an automation's contacts are after: clicking a link,
+// recording a custom event or joining a list after they were enrolled
+type AutomationGoal struct {
+	Type   string `json:"type"`             // clicked_link, event or joined_list
+	URL    string `json:"url,omitempty"`    // Part of the clicked link's URL; empty counts any link
+	Event  string `json:"event,omitempty"`  // The custom event's name
+	ListID string `json:"listId,omitempty"` // The list's UUID
+}
+
+// AutomationErrorPolicy is what an automation does when a node fails for a
+// contact: it retries the node, waiting longer before each retry, then stops
+// the enrollment in error, skips the node or pauses the enrollment at it
+type AutomationErrorPolicy struct {
+	Retries        int    `json:"retries"`        // Up to 10
+	BackoffMinutes int    `json:"backoffMinutes"` // Wait before the first retry, doubled for each one after
+	OnFailure      string `json:"onFailure"`      // stop, skip or pause
 }
 
 // AutomationSummary is a lighter version for list views
@@ -831,30 +2021,160 @@ type AutomationListResult struct {
 
 // AutomationStats represents automation statistics
 type AutomationStats struct {
-	AutomationUUID string  `json:"automationUuid"`
-	Enrolled       int     `json:"enrolled"`
-	InProgress     int     `json:"inProgress"`
-	Completed      int     `json:"completed"`
-	Errors         int     `json:"errors"`
-	CompletionRate float64 `json:"completionRate"`
+	AutomationUUID string                `json:"automationUuid"`
+	Enrolled       int                   `json:"enrolled"`
+	InProgress     int                   `json:"inProgress"`
+	Completed      int                   `json:"completed"`
+	Errors         int                   `json:"errors"`
+	Converted      int                   `json:"converted"` // Contacts who reached the automation's goal
+	CompletionRate float64               `json:"completionRate"`
+	ConversionRate float64               `json:"conversionRate"` // Converted over enrolled, in percent
+	Nodes          []AutomationNodeStats `json:"nodes"`          // Runs of each workflow node
+}
+
+// EnrollContactsRequest picks the contacts enrolled in or unenrolled from an
+// automation: contacts by UUID, or the members of a segment or list
+type EnrollContactsRequest struct {
+	ContactUUID  string   `json:"contactUuid"`
+	ContactUUIDs []string `json:"contactUuids"`
+	SegmentID    string   `json:"segmentId"` // UUID of a segment or list whose active members are picked
+}
+
+// EnrollContactsResult counts the contacts an enrollment request picked that
+// were enrolled or unenrolled, and those that weren't: contacts already
+// enrolled, opted out or not found
+type EnrollContactsResult struct {
+	Enrolled   int `json:"enrolled,omitempty"`
+	Unenrolled int `json:"unenrolled,omitempty"`
+	Skipped    int `json:"skipped"`
+}
+
+// FailedEnrollment is an enrollment a node failed for, which stopped in error
+// or was paused by the automation's error policy
+type FailedEnrollment struct {
+	UUID         string    `json:"uuid"`
+	ContactUUID  string    `json:"contactUuid"`
+	ContactEmail string    `json:"contactEmail"`
+	Status       string    `json:"status"` // error or paused
+	NodeID       string    `json:"nodeId,omitempty"`
+	Error        string    `json:"error,omitempty"`
+	RetryCount   int       `json:"retryCount"`
+	FailedAt     time.Time `json:"failedAt"`
+}
+
+// FailedEnrollmentList is a page of an automation's failed enrollments
+type FailedEnrollmentList struct {
+	Enrollments []FailedEnrollment `json:"enrollments"`
+	Total       int                `json:"total"`
+	Page        int                `json:"page"`
+	PageSize    int                `json:"pageSize"`
+}
+
+// RetryEnrollmentsRequest picks the failed enrollments put back in the workflow
+// at the node that failed
+type RetryEnrollmentsRequest struct {
+	EnrollmentUUIDs []string `json:"enrollmentUuids"`
+	All             bool     `json:"all"` // Retries all of the automation's failed enrollments
+}
+
+// RetryEnrollmentsResult counts the enrollments put back in the workflow
+type RetryEnrollmentsResult struct {
+	Retried int `json:"retried"`
+}
+
+// AutomationTriggerResult is the outcome of a request posted to a webhook
+// automation's trigger URL
+type AutomationTriggerResult struct {
+	ContactUUID string `json:"contactUuid"`
+	Created     bool   `json:"created"`  // The contact was created for the request
+	Enrolled    bool   `json:"enrolled"` // False when the contact is already enrolled, opted out or at the org's limit
+}
+
+// SimulateAutomationRequest picks the contact an automation simulation walks
+// through the workflow
+type SimulateAutomationRequest struct {
+	ContactUUID string    `json:"contactUuid" v:"required"`
+	Workflow    *Workflow `json:"workflow"` // Simulates this workflow instead of the saved one
+}
+
+// AutomationSimulation is the path a contact would take through an
+// automation's workflow. Nothing is sent or changed to get it.
+type AutomationSimulation struct {
+	ContactUUID     string                     `json:"contactUuid"`
+	Outcome         string                     `json:"outcome"` // completed, error, opted_out or max_steps
+	Message         string                     `json:"message,omitempty"`
+	DurationSeconds int64                      `json:"durationSeconds"` // Time the delays on the path add up to
+	Steps           []AutomationSimulationStep `json:"steps"`
+}
+
+// AutomationSimulationStep is a node the simulated contact went through
+type AutomationSimulationStep struct {
+	NodeID         string `json:"nodeId"`
+	NodeType       string `json:"nodeType"`
+	Label          string `json:"label,omitempty"`
+	Summary        string `json:"summary,omitempty"` // What the node would do
+	Branch         string `json:"branch,omitempty"`  // yes or no out of a condition
+	WaitSeconds    int64  `json:"waitSeconds,omitempty"`
+	ElapsedSeconds int64  `json:"elapsedSeconds"` // Time since the contact was enrolled when it gets to the node
+	Error          string `json:"error,omitempty"`
+}
+
+// AutomationNodeStats is how often a workflow node ran for a contact and failed
+type AutomationNodeStats struct {
+	NodeID    string     `json:"nodeId"`
+	NodeType  string     `json:"nodeType"`
+	Success   int        `json:"success"`
+	Errors    int        `json:"errors"`
+	Yes       int        `json:"yes,omitempty"` // Contacts a condition sent down its yes edge
+	No        int        `json:"no,omitempty"`  // and down its no edge
+	LastError string     `json:"lastError,omitempty"`
+	LastRunAt *time.Time `json:"lastRunAt,omitempty"`
 }
 
 // CreateAutomationRequest for creating an automation
 type CreateAutomationRequest struct {
-	Name          string         `json:"name" v:"required|min-length:2"`
-	Description   string         `json:"description"`
-	TriggerType   string         `json:"triggerType" v:"required"`
-	TriggerConfig map[string]any `json:"triggerConfig"`
-	Workflow      *Workflow      `json:"workflow"`
+	Name                  string                 `json:"name" v:"required|min-length:2"`
+	Description           string                 `json:"description"`
+	TriggerType           string                 `json:"triggerType" v:"required"`
+	TriggerConfig         map[string]any         `json:"triggerConfig"`
+	Workflow              *Workflow              `json:"workflow"`
+	TopicID               *int                   `json:"topicId"` // Optional subscription topic
+	Goal                  *AutomationGoal        `json:"goal"`    // Optional goal
+	AllowReenrollment     bool                   `json:"allowReenrollment"`
+	ReenrollCooldownHours int                    `json:"reenrollCooldownHours"`
+	ErrorPolicy           *AutomationErrorPolicy `json:"errorPolicy"` // Enrollments stop at the first error without one
 }
 
 // UpdateAutomationRequest for updating an automation
 type UpdateAutomationRequest struct {
-	Name          *string        `json:"name"`
-	Description   *string        `json:"description"`
-	TriggerType   *string        `json:"triggerType"`
-	TriggerConfig map[string]any `json:"triggerConfig"`
-	Workflow      *Workflow      `json:"workflow"`
+	Name                  *string                `json:"name"`
+	Description           *string                `json:"description"`
+	TriggerType           *string                `json:"triggerType"`
+	TriggerConfig         map[string]any         `json:"triggerConfig"`
+	Workflow              *Workflow              `json:"workflow"`
+	TopicID               *int                   `json:"topicId"` // 0 removes the subscription topic
+	Goal                  *AutomationGoal        `json:"goal"`    // A goal without a type removes the goal
+	AllowReenrollment     *bool                  `json:"allowReenrollment"`
+	ReenrollCooldownHours *int                   `json:"reenrollCooldownHours"`
+	ErrorPolicy           *AutomationErrorPolicy `json:"errorPolicy"`
+	Migration             *WorkflowMigration     `json:"migration"` // Moves enrollments under way onto the new workflow
+}
+
+// WorkflowMigration moves the enrollments under way on older versions of a
+// workflow onto a new version. Enrollments it doesn't move finish on the
+// version they started on.
+type WorkflowMigration struct {
+	Nodes       map[string]string `json:"nodes"`       // Node of an older version to the node of the new version its enrollments move to
+	KeepNodeIDs bool              `json:"keepNodeIds"` // Also move enrollments at nodes the new version still has
+}
+
+// AutomationVersion is a version of an automation's workflow
+type AutomationVersion struct {
+	Version           int       `json:"version"`
+	Current           bool      `json:"current"`           // New enrollments start on it
+	ActiveEnrollments int       `json:"activeEnrollments"` // Enrollments under way on it
+	Workflow          *Workflow `json:"workflow"`
+	CreatedAt         time.Time `json:"createdAt"`
 }
 
 // AutomationEnrollment tracks a contact's progress through an automation
@@ -864,7 +2184,7 @@ type AutomationEnrollment struct {
 	AutomationID  int        `json:"automationId"`
 	ContactID     int        `json:"contactId"`
 	OrgID         int        `json:"orgId"`
-	Status        string     `json:"status"` // active, completed, exited, error
+	Status        string     `json:"status"` // active, completed, converted, exited, error, paused
 	CurrentStepID string     `json:"currentStepId"`
 	StepIndex     int        `json:"stepIndex"`
 	EnrolledAt    time.Time  `json:"enrolledAt"`
@@ -919,6 +2239,11 @@ type ReceivedEmail struct {
 	// AWS metadata
 	SESMessageID      string     `json:"sesMessageId,omitempty"`
 	SNSNotificationID string     `json:"snsNotificationId,omitempty"`
+	// Open and click tracking of sent emails composed in the inbox
+	Tracked           bool       `json:"tracked,omitempty"`
+	OpenCount         int        `json:"openCount,omitempty"`
+	ClickCount        int        `json:"clickCount,omitempty"`
+	SeenAt            *time.Time `json:"seenAt,omitempty"` // First open or click
 	// Timestamps
 	ReceivedAt        time.Time  `json:"receivedAt"`
 	ReadAt            *time.Time `json:"readAt,omitempty"`
@@ -947,8 +2272,41 @@ type EmailAttachment struct {
 	IsInline        bool      `json:"isInline"`
 	Checksum        string    `json:"checksum,omitempty"`
 	CreatedAt       time.Time `json:"createdAt"`
-	// Presigned URL (generated on demand)
+	ThumbnailS3Key  string    `json:"-"`
+	VirusVerdict    string    `json:"virusVerdict,omitempty"` // FAIL attachments can't be downloaded
+	VirusName       string    `json:"virusName,omitempty"`
+	// Presigned URLs (generated on demand)
 	DownloadURL     string    `json:"downloadUrl,omitempty"`
+	PreviewURL      string    `json:"previewUrl,omitempty"`   // Shown inline by the browser
+	ThumbnailURL    string    `json:"thumbnailUrl,omitempty"` // Set once the thumbnail exists
+}
+
+// SentTracking is what the tracking of a sent email recorded
+type SentTracking struct {
+	Tracked    bool                `json:"tracked"`
+	OpenCount  int                 `json:"openCount"`
+	ClickCount int                 `json:"clickCount"`
+	SeenAt     *time.Time          `json:"seenAt,omitempty"`
+	Events     []SentTrackingEvent `json:"events"`
+}
+
+// SentTrackingEvent is an open or click of a tracked sent email
+type SentTrackingEvent struct {
+	Type       string    `json:"type"` // opened, clicked
+	URL        string    `json:"url,omitempty"`
+	IPAddress  string    `json:"ipAddress,omitempty"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	OccurredAt time.Time `json:"occurredAt"`
+}
+
+// AttachmentLink is a short-lived URL a received attachment, or its
+// thumbnail, can be fetched from
+type AttachmentLink struct {
+	URL         string    `json:"url"`
+	Filename    string    `json:"filename"`
+	ContentType string    `json:"contentType"`
+	SizeBytes   int       `json:"sizeBytes"`
+	ExpiresAt   time.Time `json:"expiresAt"`
 }
 
 // EmailLabel represents a user-defined label for organizing emails
@@ -1042,16 +2400,47 @@ type InboxListResponse struct {
 	TotalPages int             `json:"totalPages"`
 }
 
+// ReceivedThread is a conversation in the received inbox, shown by its
+// latest message
+type ReceivedThread struct {
+	ThreadID       string    `json:"threadId"`
+	Subject        string    `json:"subject"`
+	Snippet        string    `json:"snippet,omitempty"`
+	LatestUUID     string    `json:"latestUuid"`
+	FromEmail      string    `json:"fromEmail"`
+	FromName       string    `json:"fromName,omitempty"`
+	Participants   []string  `json:"participants"`
+	MessageCount   int       `json:"messageCount"`
+	UnreadCount    int       `json:"unreadCount"`
+	IsStarred      bool      `json:"isStarred"`
+	HasAttachments bool      `json:"hasAttachments"`
+	LastMessageAt  time.Time `json:"lastMessageAt"`
+	IdentityID     int64     `json:"identityId"`
+	IdentityEmail  string    `json:"identityEmail,omitempty"`
+	IdentityColor  string    `json:"identityColor,omitempty"`
+}
+
+// InboxThreadListResponse for paginated thread list
+type InboxThreadListResponse struct {
+	Threads    []ReceivedThread `json:"threads"`
+	Total      int              `json:"total"`
+	Unread     int              `json:"unread"`
+	Page       int              `json:"page"`
+	PageSize   int              `json:"pageSize"`
+	TotalPages int              `json:"totalPages"`
+}
+
 // InboxCountsResponse for folder/label counts
 type InboxCountsResponse struct {
-	Inbox    int            `json:"inbox"`
-	Unread   int            `json:"unread"`
-	Starred  int            `json:"starred"`
-	Sent     int            `json:"sent"`
-	Drafts   int            `json:"drafts"`
-	Spam     int            `json:"spam"`
-	Trash    int            `json:"trash"`
-	Labels   map[string]int `json:"labels,omitempty"`
+	Inbox     int            `json:"inbox"`
+	Unread    int            `json:"unread"`
+	Starred   int            `json:"starred"`
+	Sent      int            `json:"sent"`
+	Drafts    int            `json:"drafts"`
+	Scheduled int            `json:"scheduled"`
+	Spam      int            `json:"spam"`
+	Trash     int            `json:"trash"`
+	Labels    map[string]int `json:"labels,omitempty"`
 }
 
 // MarkEmailsRequest for marking emails as read/unread
@@ -1066,6 +2455,46 @@ type StarEmailsRequest struct {
 	IsStarred  bool     `json:"isStarred"`
 }
 
+// SpamFeedbackRequest for marking emails as spam or not spam
+type SpamFeedbackRequest struct {
+	EmailUUIDs []string `json:"emailUuids" v:"required"`
+}
+
+// SpamFeedbackResult counts the emails marked as spam or not spam
+type SpamFeedbackResult struct {
+	Marked  int `json:"marked"`
+	Trained int `json:"trained"` // Those not already marked so, which trained the spam filters
+}
+
+// SummarizeEmailRequest for summarizing the conversation of a received email
+type SummarizeEmailRequest struct {
+	Language string `json:"language"` // Language code of the summary; the emails' own when empty
+}
+
+// EmailSummary is a summary of the conversation of a received email
+type EmailSummary struct {
+	EmailID      string `json:"emailId"`
+	ThreadID     string `json:"threadId"`
+	MessageCount int    `json:"messageCount"` // Messages of the conversation summarized
+	Language     string `json:"language,omitempty"`
+	Summary      string `json:"summary"`
+	Provider     string `json:"provider"`
+}
+
+// TranslateEmailRequest for translating the body of a received email
+type TranslateEmailRequest struct {
+	TargetLanguage string `json:"targetLanguage" v:"required"` // Language code, such as de or pt-BR
+}
+
+// EmailTranslation is the body of a received email translated
+type EmailTranslation struct {
+	EmailID        string `json:"emailId"`
+	SourceLanguage string `json:"sourceLanguage,omitempty"` // When the provider detects it
+	TargetLanguage string `json:"targetLanguage"`
+	Text           string `json:"text"`
+	Provider       string `json:"provider"`
+}
+
 // MoveEmailsRequest for moving emails to folder
 type MoveEmailsRequest struct {
 	EmailUUIDs []string `json:"emailUuids" v:"required"`
@@ -1129,6 +2558,123 @@ type UpdateFilterRequest struct {
 	ActionForward  string            `json:"actionForward"`
 }
 
+// RunFilterRequest scopes a run of an inbox filter over emails already
+// received. Without a folder, every email not in the trash is included.
+type RunFilterRequest struct {
+	Folder         string `json:"folder"`         // inbox, archive, spam, trash or a custom folder
+	ReceivedAfter  string `json:"receivedAfter"`  // RFC3339
+	ReceivedBefore string `json:"receivedBefore"` // RFC3339
+}
+
+// InboxFilterRun is a run of an inbox filter over emails already received
+type InboxFilterRun struct {
+	ID             string     `json:"id"`
+	FilterID       string     `json:"filterId"`
+	Folder         string     `json:"folder,omitempty"`
+	ReceivedAfter  *time.Time `json:"receivedAfter,omitempty"`
+	ReceivedBefore *time.Time `json:"receivedBefore,omitempty"`
+	Status         string     `json:"status"`    // pending, running, completed, failed
+	Total          int        `json:"total"`     // Emails in scope when the run was created
+	Processed      int        `json:"processed"` // Emails checked so far
+	Matched        int        `json:"matched"`   // Emails the filter acted on
+	Progress       int        `json:"progress"`  // Percent
+	Error          string     `json:"error,omitempty"`
+	StartedAt      *time.Time `json:"startedAt,omitempty"`
+	CompletedAt    *time.Time `json:"completedAt,omitempty"`
+	CreatedAt      time.Time  `json:"createdAt"`
+}
+
+// InboxBulkFilter selects the received emails of a bulk operation, as the
+// list does, optionally only those received in a range
+type InboxBulkFilter struct {
+	IdentityID     int64  `json:"identityId,omitempty"`
+	Folder         string `json:"folder"` // inbox, sent, spam, trash, starred, archive, all or a custom folder
+	IsRead         *bool  `json:"isRead,omitempty"`
+	IsStarred      *bool  `json:"isStarred,omitempty"`
+	Search         string `json:"search,omitempty"`
+	ReceivedAfter  string `json:"receivedAfter,omitempty"`  // RFC3339
+	ReceivedBefore string `json:"receivedBefore,omitempty"` // RFC3339
+	OlderThanDays  int    `json:"olderThanDays,omitempty"`  // Sets receivedBefore that many days ago
+}
+
+// InboxBulkRequest applies an action to every received email matching a
+// filter, instead of a list of UUIDs
+type InboxBulkRequest struct {
+	Action string          `json:"action" v:"required"` // mark_read, mark_unread, star, unstar, move, trash, delete
+	Folder string          `json:"folder"`              // Where move puts the emails
+	Filter InboxBulkFilter `json:"filter"`
+}
+
+// InboxBulkJob is a bulk operation over received emails, done in the
+// background
+type InboxBulkJob struct {
+	ID          string          `json:"id"`
+	Action      string          `json:"action"`
+	Folder      string          `json:"folder,omitempty"`
+	Filter      InboxBulkFilter `json:"filter"`
+	Status      string          `json:"status"`    // pending, running, completed, failed
+	Total       int             `json:"total"`     // Emails matching when the job was created
+	Processed   int             `json:"processed"` // Emails acted on so far
+	Progress    int             `json:"progress"`  // Percent
+	Error       string          `json:"error,omitempty"`
+	StartedAt   *time.Time      `json:"startedAt,omitempty"`
+	CompletedAt *time.Time      `json:"completedAt,omitempty"`
+	CreatedAt   time.Time       `json:"createdAt"`
+}
+
+// Snippet is a canned response inserted into emails being composed
+type Snippet struct {
+	ID         string     `json:"id"`
+	Scope      string     `json:"scope"` // personal, org
+	Name       string     `json:"name"`
+	Shortcut   string     `json:"shortcut,omitempty"` // Typed after a slash in the composer
+	Subject    string     `json:"subject,omitempty"`
+	TextBody   string     `json:"textBody,omitempty"`
+	HTMLBody   string     `json:"htmlBody,omitempty"`
+	Variables  []string   `json:"variables"` // {{placeholders}} used
+	IsOwner    bool       `json:"isOwner"`
+	UseCount   int        `json:"useCount"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	UpdatedAt  time.Time  `json:"updatedAt"`
+}
+
+// CreateSnippetRequest for creating a snippet
+type CreateSnippetRequest struct {
+	Scope    string `json:"scope" d:"personal"`
+	Name     string `json:"name" v:"required|max-length:100"`
+	Shortcut string `json:"shortcut"`
+	Subject  string `json:"subject"`
+	TextBody string `json:"textBody"`
+	HTMLBody string `json:"htmlBody"`
+}
+
+// UpdateSnippetRequest for updating a snippet; omitted fields are kept
+type UpdateSnippetRequest struct {
+	Scope    *string `json:"scope"`
+	Name     *string `json:"name"`
+	Shortcut *string `json:"shortcut"` // Empty to remove it
+	Subject  *string `json:"subject"`
+	TextBody *string `json:"textBody"`
+	HTMLBody *string `json:"htmlBody"`
+}
+
+// RenderSnippetRequest for inserting a snippet into an email
+type RenderSnippetRequest struct {
+	IdentityID     int64             `json:"identityId"`     // Sender, for {{senderName}} and {{senderEmail}}
+	RecipientName  string            `json:"recipientName"`  // First recipient, for the {{recipient...}} variables
+	RecipientEmail string            `json:"recipientEmail"`
+	Variables      map[string]string `json:"variables"`
+}
+
+// RenderedSnippet is a snippet with its variables filled in
+type RenderedSnippet struct {
+	Subject  string   `json:"subject,omitempty"`
+	TextBody string   `json:"textBody,omitempty"`
+	HTMLBody string   `json:"htmlBody,omitempty"`
+	Missing  []string `json:"missing,omitempty"` // Variables without a value, left out
+}
+
 // SetupReceivingRequest for setting up email receiving
 type SetupReceivingRequest struct {
 	DomainUUID string `json:"domainUuid" v:"required"`
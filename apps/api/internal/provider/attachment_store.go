@@ -0,0 +1,98 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// AttachmentStoreConfig contains configuration for the attachment bucket
+type AttachmentStoreConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Bucket          string
+}
+
+// AttachmentStore keeps pre-uploaded attachments in S3 so they can be reused across sends
+type AttachmentStore struct {
+	s3Client *s3.Client
+	bucket   string
+}
+
+// NewAttachmentStore creates a new S3-backed attachment store
+func NewAttachmentStore(cfg *AttachmentStoreConfig) (*AttachmentStore, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("attachment bucket not configured")
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(cfg.Region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			cfg.AccessKeyID,
+			cfg.SecretAccessKey,
+			"",
+		)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &AttachmentStore{
+		s3Client: s3.NewFromConfig(awsCfg),
+		bucket:   cfg.Bucket,
+	}, nil
+}
+
+// Put uploads an attachment under the given key
+func (s *AttachmentStore) Put(ctx context.Context, key, contentType string, data []byte) error {
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:        aws.String(s.bucket),
+		Key:           aws.String(key),
+		Body:          bytes.NewReader(data),
+		ContentType:   aws.String(contentType),
+		ContentLength: aws.Int64(int64(len(data))),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload attachment: %w", err)
+	}
+	return nil
+}
+
+// Exists reports whether an object is already stored under the key
+func (s *AttachmentStore) Exists(ctx context.Context, key string) (bool, error) {
+	_, err := s.s3Client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to check attachment: %w", err)
+	}
+	return true, nil
+}
+
+// Get downloads an attachment
+func (s *AttachmentStore) Get(ctx context.Context, key string) ([]byte, error) {
+	result, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download attachment %s: %w", key, err)
+	}
+	defer result.Body.Close()
+
+	return io.ReadAll(result.Body)
+}
@@ -0,0 +1,94 @@
+package provider
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// BackupStoreConfig contains configuration for the backup bucket
+type BackupStoreConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Bucket          string
+}
+
+// BackupStore keeps encrypted organization backups in S3
+type BackupStore struct {
+	s3Client *s3.Client
+	bucket   string
+}
+
+// NewBackupStore creates a new S3-backed backup store
+func NewBackupStore(cfg *BackupStoreConfig) (*BackupStore, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("backup bucket not configured")
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(cfg.Region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			cfg.AccessKeyID,
+			cfg.SecretAccessKey,
+			"",
+		)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &BackupStore{
+		s3Client: s3.NewFromConfig(awsCfg),
+		bucket:   cfg.Bucket,
+	}, nil
+}
+
+// Put uploads a backup archive under the given key, encrypted at rest by S3 as well
+func (s *BackupStore) Put(ctx context.Context, key string, data []byte) error {
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		Body:                 bytes.NewReader(data),
+		ContentType:          aws.String("application/octet-stream"),
+		ContentLength:        aws.Int64(int64(len(data))),
+		ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload backup: %w", err)
+	}
+	return nil
+}
+
+// Get downloads a backup archive
+func (s *BackupStore) Get(ctx context.Context, key string) ([]byte, error) {
+	result, err := s.s3Client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to download backup %s: %w", key, err)
+	}
+	defer result.Body.Close()
+
+	return io.ReadAll(result.Body)
+}
+
+// Delete removes a backup archive
+func (s *BackupStore) Delete(ctx context.Context, key string) error {
+	_, err := s.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(s.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete backup %s: %w", key, err)
+	}
+	return nil
+}
@@ -2,6 +2,7 @@ package provider
 
 import (
 	"context"
+	"time"
 )
 
 // EmailMessage represents an email to be sent
@@ -14,7 +15,9 @@ type EmailMessage struct {
 	Subject     string
 	TextBody    string
 	HTMLBody    string
+	AMPBody     string // AMP for Email part, for mailbox providers that render it
 	MessageID   string
+	Date        time.Time // When the message was written, now when it's not set
 	Headers     map[string]string
 	Attachments []Attachment
 }
@@ -24,6 +27,7 @@ type Attachment struct {
 	Filename    string
 	ContentType string
 	Data        []byte
+	ContentID   string // Set for inline parts referenced from the HTML as cid:<ContentID>
 }
 
 // SendResult contains the result of sending an email
@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// ExportStoreConfig contains configuration for a bucket exports are written to
+type ExportStoreConfig struct {
+	Region          string
+	AccessKeyID     string
+	SecretAccessKey string
+	Bucket          string
+}
+
+// ExportStore writes data exports to S3, either the platform's exports bucket or
+// a bucket of the organization
+type ExportStore struct {
+	s3Client *s3.Client
+	bucket   string
+}
+
+// NewExportStore creates a new S3-backed export store
+func NewExportStore(cfg *ExportStoreConfig) (*ExportStore, error) {
+	if cfg.Bucket == "" {
+		return nil, fmt.Errorf("export bucket not configured")
+	}
+
+	awsCfg, err := config.LoadDefaultConfig(context.Background(),
+		config.WithRegion(cfg.Region),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			cfg.AccessKeyID,
+			cfg.SecretAccessKey,
+			"",
+		)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	return &ExportStore{
+		s3Client: s3.NewFromConfig(awsCfg),
+		bucket:   cfg.Bucket,
+	}, nil
+}
+
+// Put uploads an export file under the given key
+func (s *ExportStore) Put(ctx context.Context, key string, body io.ReadSeeker, size int64, contentType string) error {
+	_, err := s.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:               aws.String(s.bucket),
+		Key:                  aws.String(key),
+		Body:                 body,
+		ContentType:          aws.String(contentType),
+		ContentLength:        aws.Int64(size),
+		ServerSideEncryption: s3types.ServerSideEncryptionAes256,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload export to %s: %w", s.bucket, err)
+	}
+	return nil
+}
+
+// PresignGet returns a URL the export can be downloaded from until it expires
+func (s *ExportStore) PresignGet(ctx context.Context, key, filename string, expiry time.Duration) (string, error) {
+	presigner := s3.NewPresignClient(s.s3Client)
+	req, err := presigner.PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(s.bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("attachment; filename=%q", filename)),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign export download: %w", err)
+	}
+	return req.URL, nil
+}
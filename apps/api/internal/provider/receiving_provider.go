@@ -1,12 +1,15 @@
 package provider
 
 import (
+	"bytes"
 	"context"
 	"crypto/rand"
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"io"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
 	"github.com/aws/aws-sdk-go-v2/config"
@@ -373,13 +376,34 @@ func (p *ReceivingProvider) GetEmailFromS3(ctx context.Context, bucket, key stri
 	}
 	defer result.Body.Close()
 
-	buf := make([]byte, *result.ContentLength)
-	_, err = result.Body.Read(buf)
-	if err != nil && err.Error() != "EOF" {
-		return nil, err
+	return io.ReadAll(result.Body)
+}
+
+// PutObject stores an object in a receiving bucket, such as an attachment
+// extracted from a received email
+func (p *ReceivingProvider) PutObject(ctx context.Context, bucket, key, contentType string, data []byte) error {
+	_, err := p.s3Client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String(contentType),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload to s3://%s/%s: %w", bucket, key, err)
 	}
+	return nil
+}
 
-	return buf, nil
+// DeleteObject removes an object from a receiving bucket
+func (p *ReceivingProvider) DeleteObject(ctx context.Context, bucket, key string) error {
+	_, err := p.s3Client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("failed to delete s3://%s/%s: %w", bucket, key, err)
+	}
+	return nil
 }
 
 // GeneratePresignedURL generates a presigned URL for downloading an attachment
@@ -389,7 +413,7 @@ func (p *ReceivingProvider) GeneratePresignedURL(ctx context.Context, bucket, ke
 	result, err := presignClient.PresignGetObject(ctx, &s3.GetObjectInput{
 		Bucket: aws.String(bucket),
 		Key:    aws.String(key),
-	}, s3.WithPresignExpires(60*15)) // 15 minutes
+	}, s3.WithPresignExpires(time.Duration(expirySeconds)*time.Second))
 
 	if err != nil {
 		return "", err
@@ -398,6 +422,26 @@ func (p *ReceivingProvider) GeneratePresignedURL(ctx context.Context, bucket, ke
 	return result.URL, nil
 }
 
+// PresignAttachment generates a URL an attachment can be fetched from until it
+// expires. Inline ones are shown by the browser, others are downloaded as
+// filename.
+func (p *ReceivingProvider) PresignAttachment(ctx context.Context, bucket, key, filename, contentType string, inline bool, expiry time.Duration) (string, error) {
+	disposition := "attachment"
+	if inline {
+		disposition = "inline"
+	}
+	result, err := s3.NewPresignClient(p.s3Client).PresignGetObject(ctx, &s3.GetObjectInput{
+		Bucket:                     aws.String(bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(fmt.Sprintf("%s; filename=%q", disposition, filename)),
+		ResponseContentType:        aws.String(contentType),
+	}, s3.WithPresignExpires(expiry))
+	if err != nil {
+		return "", fmt.Errorf("failed to sign attachment download: %w", err)
+	}
+	return result.URL, nil
+}
+
 // getAccountID attempts to get the AWS account ID
 func (p *ReceivingProvider) getAccountID(ctx context.Context) string {
 	// For simplicity, we'll return "*" which is less restrictive
@@ -60,6 +60,11 @@ func (p *SESProvider) Name() string {
 
 // SendEmail sends an email via SES
 func (p *SESProvider) SendEmail(ctx context.Context, msg *EmailMessage) (*SendResult, error) {
+	// The Simple format cannot carry attachments or an AMP part, so those go out as raw MIME
+	if len(msg.Attachments) > 0 || msg.AMPBody != "" {
+		return p.sendMIME(ctx, msg)
+	}
+
 	// Build destination
 	destination := &types.Destination{
 		ToAddresses:  msg.To,
@@ -145,6 +150,51 @@ func (p *SESProvider) SendEmail(ctx context.Context, msg *EmailMessage) (*SendRe
 	}, nil
 }
 
+// sendMIME sends a message with attachments as raw MIME to all of its recipients
+func (p *SESProvider) sendMIME(ctx context.Context, msg *EmailMessage) (*SendResult, error) {
+	rawMsg, err := BuildMIMEMessage(msg)
+	if err != nil {
+		return &SendResult{
+			ProviderName: "ses",
+			Success:      false,
+			Error:        err,
+		}, err
+	}
+
+	input := &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(msg.From),
+		Destination: &types.Destination{
+			ToAddresses:  msg.To,
+			CcAddresses:  msg.Cc,
+			BccAddresses: msg.Bcc,
+		},
+		Content: &types.EmailContent{
+			Raw: &types.RawMessage{
+				Data: rawMsg,
+			},
+		},
+	}
+
+	if p.configurationSet != "" {
+		input.ConfigurationSetName = aws.String(p.configurationSet)
+	}
+
+	result, err := p.client.SendEmail(ctx, input)
+	if err != nil {
+		return &SendResult{
+			ProviderName: "ses",
+			Success:      false,
+			Error:        err,
+		}, err
+	}
+
+	return &SendResult{
+		MessageID:    aws.ToString(result.MessageId),
+		ProviderName: "ses",
+		Success:      true,
+	}, nil
+}
+
 // SendRawEmail sends a raw MIME message via SES
 func (p *SESProvider) SendRawEmail(ctx context.Context, from string, to []string, rawMessage []byte) (*SendResult, error) {
 	input := &sesv2.SendEmailInput{
@@ -469,82 +519,119 @@ func BuildMIMEMessage(msg *EmailMessage) ([]byte, error) {
 		buf.WriteString(fmt.Sprintf("Message-ID: %s\r\n", msg.MessageID))
 	}
 	buf.WriteString("MIME-Version: 1.0\r\n")
-	buf.WriteString(fmt.Sprintf("Date: %s\r\n", time.Now().Format(time.RFC1123Z)))
+	date := msg.Date
+	if date.IsZero() {
+		date = time.Now()
+	}
+	buf.WriteString(fmt.Sprintf("Date: %s\r\n", date.Format(time.RFC1123Z)))
 
 	// Add custom headers
 	for k, v := range msg.Headers {
 		buf.WriteString(fmt.Sprintf("%s: %s\r\n", k, v))
 	}
 
-	if len(msg.Attachments) > 0 {
+	// Inline parts are referenced from the HTML by Content-ID and travel with it in a
+	// multipart/related; everything else is a regular attachment
+	var inline, attached []Attachment
+	for _, att := range msg.Attachments {
+		if att.ContentID != "" {
+			inline = append(inline, att)
+		} else {
+			attached = append(attached, att)
+		}
+	}
+
+	if len(attached) > 0 {
 		// Multipart mixed for attachments
 		buf.WriteString(fmt.Sprintf("Content-Type: multipart/mixed; boundary=\"%s\"\r\n\r\n", boundary))
 
 		// Alternative part for text/html
-		altBoundary := fmt.Sprintf("----=_Alt_%d", time.Now().UnixNano())
 		buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-		buf.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n\r\n", altBoundary))
-
-		// Text part
-		if msg.TextBody != "" {
-			buf.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-			buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-			buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
-			buf.WriteString(msg.TextBody)
-			buf.WriteString("\r\n")
-		}
-
-		// HTML part
-		if msg.HTMLBody != "" {
-			buf.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
-			buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-			buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
-			buf.WriteString(msg.HTMLBody)
-			buf.WriteString("\r\n")
-		}
-
-		buf.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
+		writeAlternativePart(&buf, msg, inline)
 
 		// Attachments
-		for _, att := range msg.Attachments {
+		for _, att := range attached {
 			buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
 			buf.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", att.ContentType, att.Filename))
 			buf.WriteString("Content-Transfer-Encoding: base64\r\n")
 			buf.WriteString(fmt.Sprintf("Content-Disposition: attachment; filename=\"%s\"\r\n\r\n", att.Filename))
-			// Base64 encode attachment
-			encoded := make([]byte, base64Len(len(att.Data)))
-			base64Encode(encoded, att.Data)
-			buf.Write(encoded)
-			buf.WriteString("\r\n")
+			writeBase64(&buf, att.Data)
 		}
 
 		buf.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
 	} else {
-		// Simple multipart/alternative for text and html
-		buf.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n\r\n", boundary))
+		writeAlternativePart(&buf, msg, inline)
+	}
 
-		// Text part
-		if msg.TextBody != "" {
-			buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-			buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
-			buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
-			buf.WriteString(msg.TextBody)
-			buf.WriteString("\r\n")
-		}
+	return buf.Bytes(), nil
+}
 
-		// HTML part
-		if msg.HTMLBody != "" {
-			buf.WriteString(fmt.Sprintf("--%s\r\n", boundary))
-			buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
-			buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
-			buf.WriteString(msg.HTMLBody)
-			buf.WriteString("\r\n")
-		}
+// writeAlternativePart writes the text, AMP and HTML bodies as a multipart/alternative
+// entity. The AMP part goes before the HTML one, so clients that don't render AMP
+// show the HTML, the last part they support. With inline parts the HTML body is wrapped in a multipart/related together
+// with them.
+func writeAlternativePart(buf *bytes.Buffer, msg *EmailMessage, inline []Attachment) {
+	altBoundary := fmt.Sprintf("----=_Alt_%d", time.Now().UnixNano())
+	buf.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n\r\n", altBoundary))
 
-		buf.WriteString(fmt.Sprintf("--%s--\r\n", boundary))
+	// Text part
+	if msg.TextBody != "" {
+		buf.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
+		buf.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		buf.WriteString(msg.TextBody)
+		buf.WriteString("\r\n")
 	}
 
-	return buf.Bytes(), nil
+	// AMP part
+	if msg.AMPBody != "" {
+		buf.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
+		buf.WriteString("Content-Type: text/x-amp-html; charset=UTF-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		buf.WriteString(msg.AMPBody)
+		buf.WriteString("\r\n")
+	}
+
+	// HTML part, with its inline images
+	if msg.HTMLBody != "" {
+		buf.WriteString(fmt.Sprintf("--%s\r\n", altBoundary))
+		relBoundary := fmt.Sprintf("----=_Rel_%d", time.Now().UnixNano())
+		if len(inline) > 0 {
+			buf.WriteString(fmt.Sprintf("Content-Type: multipart/related; type=\"text/html\"; boundary=\"%s\"\r\n\r\n", relBoundary))
+			buf.WriteString(fmt.Sprintf("--%s\r\n", relBoundary))
+		}
+		buf.WriteString("Content-Type: text/html; charset=UTF-8\r\n")
+		buf.WriteString("Content-Transfer-Encoding: quoted-printable\r\n\r\n")
+		buf.WriteString(msg.HTMLBody)
+		buf.WriteString("\r\n")
+
+		if len(inline) > 0 {
+			for _, att := range inline {
+				buf.WriteString(fmt.Sprintf("--%s\r\n", relBoundary))
+				buf.WriteString(fmt.Sprintf("Content-Type: %s; name=\"%s\"\r\n", att.ContentType, att.Filename))
+				buf.WriteString("Content-Transfer-Encoding: base64\r\n")
+				buf.WriteString(fmt.Sprintf("Content-ID: <%s>\r\n", att.ContentID))
+				buf.WriteString(fmt.Sprintf("Content-Disposition: inline; filename=\"%s\"\r\n\r\n", att.Filename))
+				writeBase64(buf, att.Data)
+			}
+			buf.WriteString(fmt.Sprintf("--%s--\r\n", relBoundary))
+		}
+	}
+
+	buf.WriteString(fmt.Sprintf("--%s--\r\n", altBoundary))
+}
+
+// writeBase64 writes data base64 encoded in lines of 76 characters (RFC 2045)
+func writeBase64(buf *bytes.Buffer, data []byte) {
+	encoded := make([]byte, base64Len(len(data)))
+	base64Encode(encoded, data)
+	for len(encoded) > 76 {
+		buf.Write(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.Write(encoded)
+	buf.WriteString("\r\n")
 }
 
 // base64Len returns the length of base64 encoded data
@@ -1,6 +1,8 @@
 package router
 
 import (
+	"context"
+	"fmt"
 	"net/http"
 
 	"github.com/gogf/gf/v2/net/ghttp"
@@ -58,7 +60,7 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 	// Initialize services
 	authService := service.NewAuthService(database.DB, cfg)
 	domainService := service.NewDomainService(database.DB, cfg)
-	identityService := service.NewIdentityService(database.DB, cfg)
+	identityService := service.NewIdentityService(database.DB, cfg, database.Redis)
 	inboxService := service.NewInboxService(database.DB, cfg, identityService)
 	composeService := service.NewComposeService(database.DB, cfg, identityService)
 	transactionalService := service.NewTransactionalService(database.DB, cfg, database.Redis)
@@ -77,6 +79,18 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 	oauthService := service.NewOAuthService(database.DB, cfg)
 	sessionService := service.NewSessionService(database.DB, cfg)
 	settingsService := service.NewSettingsService(database.DB, cfg)
+	bounceService := service.NewBounceService(database.DB, cfg)
+	recipientService := service.NewRecipientService(database.DB, cfg)
+	suppressionService := service.NewSuppressionService(database.DB, cfg)
+	attachmentService := service.NewAttachmentService(database.DB, cfg)
+	backupService := service.NewBackupService(database.DB, cfg)
+	exportService := service.NewExportService(database.DB, cfg)
+	hygieneService := service.NewHygieneService(database.DB, cfg)
+	contactBulkService := service.NewContactBulkService(database.DB, cfg)
+	contactEventService := service.NewContactEventService(database.DB, cfg)
+	signupFormService := service.NewSignupFormService(database.DB, cfg, database.Redis)
+	subscriptionTopicService := service.NewSubscriptionTopicService(database.DB, cfg)
+	crmService := service.NewCRMService(database.DB, cfg)
 
 	// Phase 5 additional services
 	webauthnService := service.NewWebAuthnService(database.DB, cfg)
@@ -88,8 +102,17 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 
 	// Wire webhook trigger service to services that fire events (n8n/Zapier integration)
 	contactService.SetWebhookTriggerService(webhookTriggerService)
+	signupFormService.SetWebhookTriggerService(webhookTriggerService)
 	campaignService.SetWebhookTriggerService(webhookTriggerService)
 
+	// Campaign test sends go out through the transactional pipeline
+	campaignService.SetTransactionalService(transactionalService)
+
+	// Double opt-in confirmations of list subscriptions, too
+	contactService.SetTransactionalService(transactionalService)
+	listService.SetTransactionalService(transactionalService)
+	signupFormService.SetTransactionalService(transactionalService)
+
 	// Email Receiving service
 	receivingService, _ := service.NewReceivingService(
 		database.DB,
@@ -100,17 +123,31 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 	)
 	if receivingService != nil {
 		receivingService.SetWebhookTriggerService(webhookTriggerService)
+		// Users' inbox filters sort what arrives
+		receivingService.SetFilterEngine(service.NewInboxFilterEngine(database.DB, composeService))
+		receivingService.SetVirusScanAddr(cfg.ClamAVAddr)
+		// Attachments of received emails are fetched from the receiving bucket
+		inboxService.SetReceivingProvider(receivingService.Provider())
+		// and deleted from it when a contact's data is erased
+		complianceService.SetReceivingProvider(receivingService.Provider())
+	}
+
+	// Realtime inbox updates, pushed to clients over SSE and WebSocket
+	realtimeHub := service.NewRealtimeHub(database.DB, cfg, identityService)
+	if err := realtimeHub.Start(context.Background()); err != nil {
+		fmt.Printf("Warning: failed to start realtime inbox updates: %v\n", err)
 	}
 
 	// Initialize controllers
 	healthCtrl := controller.NewHealthController()
 	trackingCtrl := controller.NewTrackingController(trackingService)
-	complianceCtrl := controller.NewComplianceController(complianceService)
+	complianceCtrl := controller.NewComplianceController(complianceService, auditLogService)
 	authCtrl := controller.NewAuthController(authService)
 	domainCtrl := controller.NewDomainController(domainService)
 	identityCtrl := controller.NewIdentityController(identityService)
 	inboxCtrl := controller.NewInboxController(inboxService)
 	composeCtrl := controller.NewComposeController(composeService)
+	snippetCtrl := controller.NewSnippetController(service.NewSnippetService(database.DB))
 	transactionalCtrl := controller.NewTransactionalController(transactionalService)
 	webhookCtrl := controller.NewWebhookController(webhookService)
 	contactCtrl := controller.NewContactController(contactService)
@@ -123,14 +160,28 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 	oauthCtrl := controller.NewOAuthController(oauthService, auditLogService, cfg)
 	phase5Ctrl := controller.NewPhase5Controller(webauthnService, sharedMailboxService, sieveService, webhookTriggerService, pushService, brandingService, auditLogService)
 	settingsCtrl := controller.NewSettingsController(settingsService)
+	recipientCtrl := controller.NewRecipientController(recipientService)
+	suppressionCtrl := controller.NewSuppressionController(suppressionService)
+	attachmentCtrl := controller.NewAttachmentController(attachmentService)
+	backupCtrl := controller.NewBackupController(backupService)
+	exportCtrl := controller.NewExportController(exportService)
+	hygieneCtrl := controller.NewHygieneController(hygieneService)
+	contactBulkCtrl := controller.NewContactBulkController(contactBulkService, auditLogService)
+	contactEventCtrl := controller.NewContactEventController(contactEventService)
+	signupFormCtrl := controller.NewSignupFormController(signupFormService)
+	subscriptionTopicCtrl := controller.NewSubscriptionTopicController(subscriptionTopicService)
+	crmCtrl := controller.NewCRMController(crmService, cfg)
+	docsCtrl := controller.NewDocsController(s, cfg)
 
 	// AWS Setup handler
 	awsSetupHandler := handler.NewAWSSetupHandler(database.DB, cfg)
 
 	// Email Receiving controllers
-	sseCtrl := controller.NewSSEController()
-	sesWebhookCtrl := controller.NewSESWebhookController(receivingService, webhookTriggerService)
+	sseCtrl := controller.NewSSEController(realtimeHub)
+	realtimeCtrl := controller.NewRealtimeController(realtimeHub)
+	sesWebhookCtrl := controller.NewSESWebhookController(receivingService, webhookTriggerService, bounceService)
 	receivedInboxCtrl := controller.NewReceivedInboxController(inboxService, receivingService)
+	inboxFilterCtrl := controller.NewInboxFilterController(inboxService)
 
 	// CORS middleware
 	s.Use(ghttp.MiddlewareCORS)
@@ -148,6 +199,8 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			r.Response.Header().Set("Access-Control-Allow-Origin", "*")
 			http.ServeFile(r.Response.Writer, r.Request, "docs/openapi.json")
 		})
+		// Postman/Insomnia collection generated from the route table
+		group.GET("/postman.json", docsCtrl.PostmanCollection)
 		// Swagger UI using CDN
 		group.GET("/", func(r *ghttp.Request) {
 			r.Response.Header().Set("Content-Type", "text/html")
@@ -155,6 +208,10 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 		})
 	})
 
+	// Mail app autoconfig (public - fetched by Thunderbird and other mail apps)
+	s.BindHandler("GET:/mail/config-v1.1.xml", identityCtrl.Autoconfig)
+	s.BindHandler("GET:/.well-known/autoconfig/mail/config-v1.1.xml", identityCtrl.Autoconfig)
+
 	// API v1 routes
 	s.Group("/api/v1", func(group *ghttp.RouterGroup) {
 		// Health check (public)
@@ -164,6 +221,7 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 		// Tracking routes (public - no auth)
 		group.GET("/tracking/open/:token", trackingCtrl.TrackOpen)
 		group.GET("/tracking/click/:token", trackingCtrl.TrackClick)
+		group.GET("/tracking/conversion/:token", trackingCtrl.TrackConversion)
 
 		// Compliance routes (public - no auth)
 		group.GET("/unsubscribe/:token", complianceCtrl.GetUnsubscribePage)
@@ -171,8 +229,15 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 		group.DELETE("/unsubscribe/:token", complianceCtrl.ConfirmUnsubscribe)
 		group.GET("/preferences/:token", complianceCtrl.GetPreferences)
 		group.PUT("/preferences/:token", complianceCtrl.UpdatePreferences)
+		group.POST("/preferences/:token", complianceCtrl.SubmitPreferencesPage)
 		group.GET("/confirm/:token", complianceCtrl.ConfirmDoubleOptIn)
 
+		// Signup forms (public - posted by HTML forms on customers' sites)
+		group.POST("/forms/:uuid/submit", signupFormCtrl.Submit)
+
+		// Automation triggers (public - signed with the automation's secret)
+		group.POST("/automations/:uuid/trigger", automationCtrl.Trigger)
+
 		// Email forward verification (public - clicked from email)
 		group.POST("/forwards/:id/verify", emailRulesCtrl.VerifyEmailForward)
 
@@ -184,6 +249,9 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 		group.GET("/oauth/:provider", oauthCtrl.InitiateOAuth)
 		group.GET("/oauth/:provider/callback", oauthCtrl.HandleCallback)
 
+		// CRM OAuth callback (public - the signed state identifies the org)
+		group.GET("/crm/:provider/callback", crmCtrl.Callback)
+
 		// Auth routes (public)
 		group.Group("/auth", func(authGroup *ghttp.RouterGroup) {
 			authGroup.GET("/register-status", authCtrl.RegisterStatus)
@@ -215,6 +283,62 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			// User Settings
 			protectedGroup.GET("/settings", settingsCtrl.GetSettings)
 			protectedGroup.PUT("/settings", settingsCtrl.UpdateSettings)
+			protectedGroup.GET("/settings/address-normalization", settingsCtrl.GetAddressNormalization)
+			protectedGroup.PUT("/settings/address-normalization", settingsCtrl.UpdateAddressNormalization)
+			protectedGroup.GET("/settings/retention", settingsCtrl.GetRetentionPolicy)
+			protectedGroup.PUT("/settings/retention", settingsCtrl.UpdateRetentionPolicy)
+			protectedGroup.GET("/settings/sender-rotation", settingsCtrl.GetSenderRotation)
+			protectedGroup.PUT("/settings/sender-rotation", settingsCtrl.UpdateSenderRotation)
+			protectedGroup.GET("/settings/content-guard", settingsCtrl.GetContentGuard)
+			protectedGroup.PUT("/settings/content-guard", settingsCtrl.UpdateContentGuard)
+			protectedGroup.GET("/settings/outbound-rules", settingsCtrl.GetOutboundRules)
+			protectedGroup.PUT("/settings/outbound-rules", settingsCtrl.UpdateOutboundRules)
+			protectedGroup.GET("/settings/backups", settingsCtrl.GetBackupPolicy)
+			protectedGroup.PUT("/settings/backups", settingsCtrl.UpdateBackupPolicy)
+			protectedGroup.GET("/settings/list-hygiene", settingsCtrl.GetListHygiene)
+			protectedGroup.PUT("/settings/list-hygiene", settingsCtrl.UpdateListHygiene)
+			protectedGroup.GET("/settings/sending-window", settingsCtrl.GetSendingWindow)
+			protectedGroup.PUT("/settings/sending-window", settingsCtrl.UpdateSendingWindow)
+			protectedGroup.GET("/settings/campaign-send-rate", settingsCtrl.GetCampaignSendRate)
+			protectedGroup.PUT("/settings/campaign-send-rate", settingsCtrl.UpdateCampaignSendRate)
+			protectedGroup.GET("/settings/domain-warmup", settingsCtrl.GetDomainWarmup)
+			protectedGroup.PUT("/settings/domain-warmup", settingsCtrl.UpdateDomainWarmup)
+			protectedGroup.GET("/settings/campaign-utm", settingsCtrl.GetCampaignUTM)
+			protectedGroup.PUT("/settings/campaign-utm", settingsCtrl.UpdateCampaignUTM)
+			protectedGroup.GET("/settings/inbox-preview", settingsCtrl.GetInboxPreview)
+			protectedGroup.PUT("/settings/inbox-preview", settingsCtrl.UpdateInboxPreview)
+			protectedGroup.GET("/settings/event-export", settingsCtrl.GetEventExportBucket)
+			protectedGroup.PUT("/settings/event-export", settingsCtrl.UpdateEventExportBucket)
+			protectedGroup.GET("/settings/mail-assist", settingsCtrl.GetMailAssist)
+			protectedGroup.PUT("/settings/mail-assist", settingsCtrl.UpdateMailAssist)
+			protectedGroup.GET("/settings/test-recipients", settingsCtrl.GetTestRecipients)
+			protectedGroup.PUT("/settings/test-recipients", settingsCtrl.UpdateTestRecipients)
+			protectedGroup.GET("/settings/preference-center", settingsCtrl.GetPreferenceCenter)
+			protectedGroup.PUT("/settings/preference-center", settingsCtrl.UpdatePreferenceCenter)
+			protectedGroup.GET("/settings/automation-limits", settingsCtrl.GetAutomationLimits)
+			protectedGroup.PUT("/settings/automation-limits", settingsCtrl.UpdateAutomationLimits)
+
+			// Contact Backups
+			protectedGroup.GET("/backups", backupCtrl.List)
+			protectedGroup.POST("/backups", backupCtrl.Create)
+			protectedGroup.GET("/backups/:uuid", backupCtrl.Get)
+			protectedGroup.POST("/backups/:uuid/restore", backupCtrl.Restore)
+
+			// List Hygiene
+			protectedGroup.GET("/hygiene/runs", hygieneCtrl.List)
+			protectedGroup.POST("/hygiene/runs", hygieneCtrl.Start)
+			protectedGroup.GET("/hygiene/runs/:uuid", hygieneCtrl.Get)
+
+			// Delivery Event Exports
+			protectedGroup.GET("/exports/events", exportCtrl.ListEventExports)
+			protectedGroup.POST("/exports/events", exportCtrl.CreateEventExport)
+			protectedGroup.GET("/exports/events/:uuid", exportCtrl.GetEventExport)
+			protectedGroup.GET("/exports/contacts", exportCtrl.ListContactExports)
+			protectedGroup.POST("/exports/contacts", exportCtrl.CreateContactExport)
+			protectedGroup.GET("/exports/contacts/:uuid", exportCtrl.GetContactExport)
+			protectedGroup.GET("/exports/mailboxes", exportCtrl.ListMailboxExports)
+			protectedGroup.POST("/exports/mailboxes", exportCtrl.CreateMailboxExport)
+			protectedGroup.GET("/exports/mailboxes/:uuid", exportCtrl.GetMailboxExport)
 
 			// AWS Setup
 			protectedGroup.POST("/settings/aws/validate", awsSetupHandler.ValidateCredentials)
@@ -222,21 +346,40 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 
 			// SSE (Server-Sent Events)
 			protectedGroup.GET("/sse/connect", sseCtrl.Connect)
+			protectedGroup.GET("/realtime/ws", realtimeCtrl.Connect)
 
 			// Received Inbox
 			protectedGroup.GET("/inbox/received", receivedInboxCtrl.ListEmails)
 			protectedGroup.GET("/inbox/received/counts", receivedInboxCtrl.GetCounts)
+			protectedGroup.GET("/inbox/received/threads/:threadId", receivedInboxCtrl.GetThread)
+			protectedGroup.GET("/inbox/threads", receivedInboxCtrl.ListThreads)
 			protectedGroup.GET("/inbox/received/:uuid", receivedInboxCtrl.GetEmail)
+			protectedGroup.GET("/inbox/received/:uuid/attachments/:attachmentUuid", receivedInboxCtrl.GetAttachment)
+			protectedGroup.GET("/inbox/received/:uuid/attachments/:attachmentUuid/thumbnail", receivedInboxCtrl.GetAttachmentThumbnail)
+			protectedGroup.GET("/inbox/received/:uuid/tracking", receivedInboxCtrl.GetTracking)
 			protectedGroup.POST("/inbox/received/mark", receivedInboxCtrl.MarkEmails)
 			protectedGroup.POST("/inbox/received/star", receivedInboxCtrl.StarEmails)
 			protectedGroup.POST("/inbox/received/move", receivedInboxCtrl.MoveEmails)
+			protectedGroup.POST("/inbox/received/spam", receivedInboxCtrl.ReportSpam)
+			protectedGroup.POST("/inbox/received/not-spam", receivedInboxCtrl.ReportNotSpam)
 			protectedGroup.POST("/inbox/received/trash", receivedInboxCtrl.TrashEmails)
+			protectedGroup.POST("/inbox/received/bulk", receivedInboxCtrl.BulkAction)
+			protectedGroup.GET("/inbox/bulk-jobs/:uuid", receivedInboxCtrl.GetBulkJob)
+			protectedGroup.POST("/inbox/emails/:uuid/summarize", receivedInboxCtrl.SummarizeEmail)
+			protectedGroup.POST("/inbox/emails/:uuid/translate", receivedInboxCtrl.TranslateEmail)
 			protectedGroup.POST("/inbox/setup", receivedInboxCtrl.SetupReceiving)
+			protectedGroup.GET("/inbox/filters", inboxFilterCtrl.List)
+			protectedGroup.POST("/inbox/filters", inboxFilterCtrl.Create)
+			protectedGroup.PUT("/inbox/filters/:uuid", inboxFilterCtrl.Update)
+			protectedGroup.DELETE("/inbox/filters/:uuid", inboxFilterCtrl.Delete)
+			protectedGroup.POST("/inbox/filters/:uuid/run", inboxFilterCtrl.Run)
+			protectedGroup.GET("/inbox/filter-runs/:uuid", inboxFilterCtrl.GetRun)
 			protectedGroup.POST("/identities/:uuid/catch-all", receivedInboxCtrl.SetCatchAll)
 
 			// API Keys
 			protectedGroup.POST("/api-keys", authCtrl.CreateAPIKey)
 			protectedGroup.GET("/api-keys", authCtrl.ListAPIKeys)
+			protectedGroup.PUT("/api-keys/:uuid/scope", authCtrl.UpdateAPIKeyScope)
 			protectedGroup.DELETE("/api-keys/:uuid", authCtrl.DeleteAPIKey)
 
 			// Domains
@@ -256,6 +399,13 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			protectedGroup.GET("/identities", identityCtrl.List)
 			protectedGroup.GET("/identities/:uuid", identityCtrl.Get)
 			protectedGroup.PUT("/identities/:uuid/password", identityCtrl.UpdatePassword)
+			protectedGroup.GET("/identities/:uuid/app-passwords", identityCtrl.ListAppPasswords)
+			protectedGroup.POST("/identities/:uuid/app-passwords", identityCtrl.CreateAppPassword)
+			protectedGroup.DELETE("/identities/:uuid/app-passwords/:passwordUuid", identityCtrl.RevokeAppPassword)
+			protectedGroup.GET("/identities/:uuid/mail-settings", identityCtrl.MailSettings)
+			protectedGroup.GET("/identities/:uuid/signature", identityCtrl.GetSignature)
+			protectedGroup.PUT("/identities/:uuid/signature", identityCtrl.UpdateSignature)
+			protectedGroup.DELETE("/identities/:uuid/signature", identityCtrl.DeleteSignature)
 			protectedGroup.DELETE("/identities/:uuid", identityCtrl.Delete)
 
 			// Unified Inbox
@@ -271,19 +421,47 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 
 			// Compose & Reply
 			protectedGroup.POST("/compose/send", composeCtrl.SendEmail)
+			protectedGroup.GET("/compose/scheduled", composeCtrl.ListScheduled)
+			protectedGroup.GET("/compose/sends/:id", composeCtrl.GetSend)
+			protectedGroup.PUT("/compose/sends/:id", composeCtrl.UpdateScheduledSend)
+			protectedGroup.POST("/compose/sends/:id/cancel", composeCtrl.CancelSend)
 			protectedGroup.POST("/compose/drafts", composeCtrl.SaveDraft)
 			protectedGroup.PUT("/compose/drafts/:id", composeCtrl.UpdateDraft)
 			protectedGroup.DELETE("/compose/drafts/:id", composeCtrl.DeleteDraft)
 			protectedGroup.GET("/compose/reply/:id", composeCtrl.GetReplyContext)
 			protectedGroup.GET("/compose/forward/:id", composeCtrl.GetForwardContext)
 			protectedGroup.POST("/compose/attachments", composeCtrl.UploadAttachment)
+			protectedGroup.GET("/compose/recipients/suggest", composeCtrl.SuggestRecipients)
+			protectedGroup.GET("/compose/snippets", snippetCtrl.List)
+			protectedGroup.POST("/compose/snippets", snippetCtrl.Create)
+			protectedGroup.GET("/compose/snippets/:uuid", snippetCtrl.Get)
+			protectedGroup.PUT("/compose/snippets/:uuid", snippetCtrl.Update)
+			protectedGroup.DELETE("/compose/snippets/:uuid", snippetCtrl.Delete)
+			protectedGroup.POST("/compose/snippets/:uuid/render", snippetCtrl.Render)
 
 			// Transactional Email API (Phase 2)
+			protectedGroup.POST("/attachments", attachmentCtrl.Upload)
 			protectedGroup.POST("/emails", transactionalCtrl.SendEmail)
 			protectedGroup.POST("/emails/batch", transactionalCtrl.BatchSendEmail)
+			protectedGroup.GET("/emails/batches/:id", transactionalCtrl.GetBatch)
+			protectedGroup.GET("/emails/stats/tags", transactionalCtrl.GetStatsByTag)
+			protectedGroup.GET("/emails/stats/templates", transactionalCtrl.GetStatsByTemplate)
+			protectedGroup.GET("/emails/stats/metadata", transactionalCtrl.GetStatsByMetadata)
+			protectedGroup.GET("/emails/stats/senders", transactionalCtrl.GetStatsBySender)
+			protectedGroup.GET("/emails/held", transactionalCtrl.ListHeldEmails)
+			protectedGroup.POST("/emails/:id/approve", transactionalCtrl.ApproveHeldEmail)
+			protectedGroup.POST("/emails/:id/reject", transactionalCtrl.RejectHeldEmail)
 			protectedGroup.GET("/emails/:id", transactionalCtrl.GetEmailStatus)
 			protectedGroup.DELETE("/emails/:id", transactionalCtrl.CancelEmail)
 
+			// Recipient history
+			protectedGroup.GET("/recipients/:email/history", recipientCtrl.GetHistory)
+			protectedGroup.GET("/recipients/:email/history/export", recipientCtrl.ExportHistory)
+
+			// Suppressions
+			protectedGroup.POST("/suppressions/check", suppressionCtrl.Check)
+			protectedGroup.DELETE("/suppressions/:email", suppressionCtrl.Remove)
+
 			// Email Templates
 			protectedGroup.POST("/templates", transactionalCtrl.CreateTemplate)
 			protectedGroup.GET("/templates", transactionalCtrl.ListTemplates)
@@ -291,6 +469,15 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			protectedGroup.PUT("/templates/:uuid", transactionalCtrl.UpdateTemplate)
 			protectedGroup.DELETE("/templates/:uuid", transactionalCtrl.DeleteTemplate)
 			protectedGroup.POST("/templates/:uuid/preview", transactionalCtrl.PreviewTemplate)
+			protectedGroup.POST("/templates/:uuid/test-send", transactionalCtrl.TestSendTemplate)
+			protectedGroup.POST("/templates/render-design", transactionalCtrl.RenderDesign)
+			protectedGroup.POST("/templates/export", transactionalCtrl.ExportTemplates)
+			protectedGroup.POST("/templates/import", transactionalCtrl.ImportTemplates)
+			protectedGroup.GET("/template-partials", transactionalCtrl.ListPartials)
+			protectedGroup.POST("/template-partials", transactionalCtrl.CreatePartial)
+			protectedGroup.GET("/template-partials/:uuid", transactionalCtrl.GetPartial)
+			protectedGroup.PUT("/template-partials/:uuid", transactionalCtrl.UpdatePartial)
+			protectedGroup.DELETE("/template-partials/:uuid", transactionalCtrl.DeletePartial)
 
 			// Webhooks
 			protectedGroup.POST("/webhooks", webhookCtrl.CreateWebhook)
@@ -309,21 +496,58 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			protectedGroup.PUT("/contacts/:uuid", contactCtrl.Update)
 			protectedGroup.DELETE("/contacts/:uuid", contactCtrl.Delete)
 			protectedGroup.POST("/contacts/import", contactCtrl.Import)
-			protectedGroup.POST("/contacts/export", contactCtrl.Export)
+			protectedGroup.POST("/contacts/export", exportCtrl.CreateContactExport)
 			protectedGroup.POST("/contacts/unsubscribe", contactCtrl.Unsubscribe)
+			protectedGroup.POST("/contacts/bulk", contactBulkCtrl.Create)
+			protectedGroup.GET("/contacts/bulk/jobs", contactBulkCtrl.List)
+			protectedGroup.GET("/contacts/bulk/jobs/:uuid", contactBulkCtrl.Get)
+			protectedGroup.POST("/contacts/bulk/jobs/:uuid/cancel", contactBulkCtrl.Cancel)
 			protectedGroup.GET("/contacts/:uuid/export", complianceCtrl.ExportContactData)
 			protectedGroup.DELETE("/contacts/:uuid/gdpr", complianceCtrl.DeleteContactData)
+			protectedGroup.POST("/contacts/:uuid/gdpr-export", complianceCtrl.ExportContactArchive)
+			protectedGroup.POST("/contacts/:uuid/gdpr-erase", complianceCtrl.EraseContactData)
 			protectedGroup.GET("/contacts/:uuid/consent-audit", complianceCtrl.GetConsentAuditTrail)
+			protectedGroup.GET("/contacts/:uuid/engagement", contactCtrl.GetEngagement)
+			protectedGroup.GET("/contacts/:uuid/events", contactEventCtrl.List)
+			protectedGroup.GET("/contacts/:uuid/changes", contactCtrl.ListChanges)
+			protectedGroup.GET("/contacts/:uuid/topics", subscriptionTopicCtrl.ContactTopics)
+			protectedGroup.PUT("/contacts/:uuid/topics", subscriptionTopicCtrl.UpdateContactTopics)
+			protectedGroup.POST("/events", contactEventCtrl.Track)
+			protectedGroup.GET("/forms", signupFormCtrl.List)
+			protectedGroup.POST("/forms", signupFormCtrl.Create)
+			protectedGroup.GET("/forms/:uuid", signupFormCtrl.Get)
+			protectedGroup.PUT("/forms/:uuid", signupFormCtrl.Update)
+			protectedGroup.DELETE("/forms/:uuid", signupFormCtrl.Delete)
+			protectedGroup.GET("/topics", subscriptionTopicCtrl.List)
+			protectedGroup.POST("/topics", subscriptionTopicCtrl.Create)
+			protectedGroup.GET("/topics/:uuid", subscriptionTopicCtrl.Get)
+			protectedGroup.PUT("/topics/:uuid", subscriptionTopicCtrl.Update)
+			protectedGroup.DELETE("/topics/:uuid", subscriptionTopicCtrl.Delete)
+			protectedGroup.GET("/crm/connections", crmCtrl.List)
+			protectedGroup.POST("/crm/:provider/connect", crmCtrl.Connect)
+			protectedGroup.GET("/crm/connections/:uuid", crmCtrl.Get)
+			protectedGroup.PUT("/crm/connections/:uuid", crmCtrl.Update)
+			protectedGroup.DELETE("/crm/connections/:uuid", crmCtrl.Delete)
+			protectedGroup.POST("/crm/connections/:uuid/sync", crmCtrl.Sync)
+			protectedGroup.GET("/crm/connections/:uuid/runs", crmCtrl.ListRuns)
+			protectedGroup.GET("/contact-fields", contactCtrl.ListFields)
+			protectedGroup.POST("/contact-fields", contactCtrl.CreateField)
+			protectedGroup.GET("/contact-fields/:uuid", contactCtrl.GetField)
+			protectedGroup.PUT("/contact-fields/:uuid", contactCtrl.UpdateField)
+			protectedGroup.DELETE("/contact-fields/:uuid", contactCtrl.DeleteField)
 
 			// Phase 3: Marketing - Lists
 			protectedGroup.POST("/lists", listCtrl.Create)
 			protectedGroup.GET("/lists", listCtrl.List)
+			protectedGroup.POST("/lists/segment-preview", listCtrl.PreviewSegment)
 			protectedGroup.GET("/lists/:uuid", listCtrl.Get)
 			protectedGroup.PUT("/lists/:uuid", listCtrl.Update)
 			protectedGroup.DELETE("/lists/:uuid", listCtrl.Delete)
+			protectedGroup.POST("/lists/:uuid/refresh", listCtrl.RefreshSegment)
 			protectedGroup.POST("/lists/:uuid/contacts", listCtrl.AddContacts)
 			protectedGroup.DELETE("/lists/:uuid/contacts", listCtrl.RemoveContacts)
 			protectedGroup.GET("/lists/:uuid/contacts", listCtrl.GetListContacts)
+			protectedGroup.GET("/lists/:uuid/stats", listCtrl.GetStats)
 			protectedGroup.POST("/lists/:uuid/contacts/import", listCtrl.ImportContactsToList)
 			protectedGroup.POST("/lists/:uuid/contacts/manual", listCtrl.ManualAddContactToList)
 
@@ -338,8 +562,23 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			protectedGroup.POST("/campaigns/:uuid/pause", campaignCtrl.Pause)
 			protectedGroup.POST("/campaigns/:uuid/resume", campaignCtrl.Resume)
 			protectedGroup.POST("/campaigns/:uuid/cancel", campaignCtrl.Cancel)
+			protectedGroup.POST("/campaigns/:uuid/resend", campaignCtrl.Resend)
+			protectedGroup.POST("/campaigns/:uuid/resend-unopened", campaignCtrl.ResendUnopened)
+			protectedGroup.POST("/campaigns/:uuid/duplicate", campaignCtrl.Duplicate)
+			protectedGroup.POST("/campaigns/:uuid/archive", campaignCtrl.Archive)
+			protectedGroup.POST("/campaigns/:uuid/unarchive", campaignCtrl.Unarchive)
 			protectedGroup.GET("/campaigns/:uuid/stats", campaignCtrl.GetStats)
+			protectedGroup.GET("/campaigns/:uuid/links", campaignCtrl.GetLinks)
+			protectedGroup.GET("/campaigns/:uuid/recipients", campaignCtrl.ListRecipients)
+			protectedGroup.GET("/campaigns/:uuid/recipients/export", campaignCtrl.ExportRecipients)
 			protectedGroup.POST("/campaigns/:uuid/preview", campaignCtrl.Preview)
+			protectedGroup.GET("/campaigns/:uuid/previews", campaignCtrl.ListPreviews)
+			protectedGroup.POST("/campaigns/:uuid/previews", campaignCtrl.RenderPreviews)
+			protectedGroup.GET("/campaigns/:uuid/previews/:client/image", campaignCtrl.PreviewImage)
+			protectedGroup.POST("/campaigns/:uuid/conversions", campaignCtrl.RecordConversion)
+			protectedGroup.GET("/campaigns/:uuid/snapshots", campaignCtrl.ListSnapshots)
+			protectedGroup.GET("/campaigns/:uuid/snapshots/:id", campaignCtrl.GetSnapshot)
+			protectedGroup.POST("/campaigns/:uuid/lint", campaignCtrl.Lint)
 			protectedGroup.POST("/campaigns/:uuid/test", campaignCtrl.SendTest)
 
 			// Automations/Workflows
@@ -351,7 +590,13 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			protectedGroup.POST("/automations/:uuid/activate", automationCtrl.Activate)
 			protectedGroup.POST("/automations/:uuid/pause", automationCtrl.Pause)
 			protectedGroup.GET("/automations/:uuid/stats", automationCtrl.GetStats)
-			protectedGroup.POST("/automations/:uuid/enroll", automationCtrl.EnrollContact)
+			protectedGroup.GET("/automations/:uuid/versions", automationCtrl.ListVersions)
+			protectedGroup.POST("/automations/:uuid/simulate", automationCtrl.Simulate)
+			protectedGroup.POST("/automations/:uuid/enroll", automationCtrl.EnrollContacts)
+			protectedGroup.DELETE("/automations/:uuid/enroll", automationCtrl.UnenrollContacts)
+			protectedGroup.GET("/automations/:uuid/failed", automationCtrl.ListFailedEnrollments)
+			protectedGroup.POST("/automations/:uuid/failed/retry", automationCtrl.RetryFailedEnrollments)
+			protectedGroup.POST("/automations/:uuid/trigger-secret", automationCtrl.RotateTriggerSecret)
 
 			// Phase 4: Health & Operations
 			protectedGroup.POST("/health/blacklist-check", healthOpsCtrl.CheckBlacklists)
@@ -362,6 +607,7 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			protectedGroup.POST("/health/warmup", healthOpsCtrl.StartWarmup)
 			protectedGroup.GET("/health/warmup/:ip", healthOpsCtrl.GetWarmupStatus)
 			protectedGroup.GET("/health/quota", healthOpsCtrl.GetQuotaStatus)
+			protectedGroup.GET("/health/queues", healthOpsCtrl.GetQueueStatus)
 			protectedGroup.GET("/health/alerts", healthOpsCtrl.GetAlerts)
 			protectedGroup.POST("/health/alerts/:id/acknowledge", healthOpsCtrl.AcknowledgeAlert)
 			protectedGroup.GET("/health/logs", healthOpsCtrl.GetDeliveryLogs)
@@ -425,6 +671,13 @@ func Setup(s *ghttp.Server, cfg *config.Config) {
 			protectedGroup.POST("/shared-mailboxes/:id/members", phase5Ctrl.AddSharedMailboxMember)
 			protectedGroup.GET("/shared-mailboxes/:id/members", phase5Ctrl.ListSharedMailboxMembers)
 			protectedGroup.DELETE("/shared-mailboxes/:id/members/:userId", phase5Ctrl.RemoveSharedMailboxMember)
+			protectedGroup.GET("/shared-mailboxes/:id/messages", phase5Ctrl.ListSharedMailboxMessages)
+			protectedGroup.PUT("/shared-mailboxes/:id/messages/:emailId/assign", phase5Ctrl.AssignSharedMailboxMessage)
+			protectedGroup.PUT("/shared-mailboxes/:id/messages/:emailId/status", phase5Ctrl.SetSharedMailboxMessageStatus)
+			protectedGroup.GET("/shared-mailboxes/:id/messages/:emailId/notes", phase5Ctrl.ListSharedMailboxNotes)
+			protectedGroup.POST("/shared-mailboxes/:id/messages/:emailId/notes", phase5Ctrl.AddSharedMailboxNote)
+			protectedGroup.DELETE("/shared-mailboxes/:id/messages/:emailId/notes/:noteId", phase5Ctrl.DeleteSharedMailboxNote)
+			protectedGroup.GET("/inbox/shared-mailboxes", phase5Ctrl.ListMySharedMailboxes)
 
 			// Phase 5.1: Sieve Scripts
 			protectedGroup.POST("/sieve-scripts", phase5Ctrl.CreateSieveScript)
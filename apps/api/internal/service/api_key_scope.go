@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// API keys can be limited to specific sender domains, required tag prefixes and a
+// daily number of transactional sends, so a key embedded in a less trusted service
+// can only send what that service is meant to.
+
+const (
+	// maxAPIKeyScopeEntries bounds the allowed domains and tag prefixes of a key
+	maxAPIKeyScopeEntries = 50
+	// maxAPIKeyDailySendLimit is the highest per-key daily send limit
+	maxAPIKeyDailySendLimit = 10000000
+)
+
+// APIKeyScopeError is returned when a send is outside what the API key allows
+type APIKeyScopeError struct {
+	Message       string
+	LimitExceeded bool // The key's daily send limit is used up
+}
+
+func (e *APIKeyScopeError) Error() string {
+	return e.Message
+}
+
+// ErrorCode reports a used up daily limit as an exceeded quota
+func (e *APIKeyScopeError) ErrorCode() string {
+	if e.LimitExceeded {
+		return apierror.CodeQuotaExceeded
+	}
+	return apierror.CodeAPIKeyForbidden
+}
+
+func (e *APIKeyScopeError) HTTPStatus() int {
+	if e.LimitExceeded {
+		return http.StatusTooManyRequests
+	}
+	return http.StatusForbidden
+}
+
+// apiKeyScope is the sending restriction of an API key
+type apiKeyScope struct {
+	ID                  int64
+	AllowedDomains      []string
+	RequiredTagPrefixes []string
+	DailySendLimit      int
+}
+
+// loadAPIKeyScope returns the restrictions of the key a request was authenticated
+// with, or nil for requests authenticated otherwise
+func loadAPIKeyScope(ctx context.Context, db *sql.DB, keyID int64) (*apiKeyScope, error) {
+	if keyID == 0 {
+		return nil, nil
+	}
+
+	scope := &apiKeyScope{ID: keyID}
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(allowed_domains, '{}'), COALESCE(required_tag_prefixes, '{}'), COALESCE(daily_send_limit, 0)
+		FROM api_keys WHERE id = $1
+	`, keyID).Scan(pq.Array(&scope.AllowedDomains), pq.Array(&scope.RequiredTagPrefixes), &scope.DailySendLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load API key restrictions: %w", err)
+	}
+	return scope, nil
+}
+
+// checkDomain rejects sender domains the key may not send from
+func (sc *apiKeyScope) checkDomain(domain string) error {
+	if sc == nil || len(sc.AllowedDomains) == 0 {
+		return nil
+	}
+	for _, allowed := range sc.AllowedDomains {
+		if strings.EqualFold(domain, allowed) {
+			return nil
+		}
+	}
+	return &APIKeyScopeError{Message: fmt.Sprintf("API key is not allowed to send from %s", domain)}
+}
+
+// checkTags requires at least one tag and every tag to start with an allowed prefix
+func (sc *apiKeyScope) checkTags(tags []string) error {
+	if sc == nil || len(sc.RequiredTagPrefixes) == 0 {
+		return nil
+	}
+	if len(tags) == 0 {
+		return &APIKeyScopeError{Message: fmt.Sprintf("API key requires tags starting with %s", strings.Join(sc.RequiredTagPrefixes, ", "))}
+	}
+	for _, tag := range tags {
+		allowed := false
+		for _, prefix := range sc.RequiredTagPrefixes {
+			if strings.HasPrefix(tag, prefix) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &APIKeyScopeError{Message: fmt.Sprintf("tag %q does not start with a prefix allowed for this API key (%s)", tag, strings.Join(sc.RequiredTagPrefixes, ", "))}
+		}
+	}
+	return nil
+}
+
+// checkDailyLimit counts today's (UTC) transactional sends of the key
+func (sc *apiKeyScope) checkDailyLimit(ctx context.Context, db *sql.DB) error {
+	if sc == nil || sc.DailySendLimit <= 0 {
+		return nil
+	}
+
+	var sentToday int
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM transactional_emails
+		WHERE api_key_id = $1 AND NOT is_test AND created_at >= date_trunc('day', NOW() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC'
+	`, sc.ID).Scan(&sentToday)
+	if err != nil {
+		return fmt.Errorf("failed to check API key send limit: %w", err)
+	}
+	if sentToday >= sc.DailySendLimit {
+		return &APIKeyScopeError{
+			Message:       fmt.Sprintf("API key daily send limit of %d reached", sc.DailySendLimit),
+			LimitExceeded: true,
+		}
+	}
+	return nil
+}
+
+// normalizeAPIKeyScope validates the restrictions of a key. Allowed domains must be
+// domains of the organization.
+func normalizeAPIKeyScope(ctx context.Context, db *sql.DB, orgID int64, domains, tagPrefixes []string, dailySendLimit int) ([]string, []string, error) {
+	if len(domains) > maxAPIKeyScopeEntries || len(tagPrefixes) > maxAPIKeyScopeEntries {
+		return nil, nil, fmt.Errorf("at most %d allowed domains and tag prefixes", maxAPIKeyScopeEntries)
+	}
+	if dailySendLimit < 0 || dailySendLimit > maxAPIKeyDailySendLimit {
+		return nil, nil, fmt.Errorf("dailySendLimit must be between 0 and %d", maxAPIKeyDailySendLimit)
+	}
+
+	normalizedDomains := []string{}
+	for _, d := range domains {
+		d = strings.ToLower(strings.TrimSpace(d))
+		if d == "" {
+			continue
+		}
+		var exists bool
+		db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM domains WHERE name = $1 AND org_id = $2)
+		`, d, orgID).Scan(&exists)
+		if !exists {
+			return nil, nil, fmt.Errorf("domain %s not found", d)
+		}
+		normalizedDomains = append(normalizedDomains, d)
+	}
+
+	normalizedPrefixes := []string{}
+	for _, p := range tagPrefixes {
+		p = strings.TrimSpace(p)
+		if p == "" {
+			continue
+		}
+		normalizedPrefixes = append(normalizedPrefixes, p)
+	}
+
+	return normalizedDomains, normalizedPrefixes, nil
+}
+
+// isScopedAPIKey reports whether an API key has any sending restriction
+func isScopedAPIKey(ctx context.Context, db *sql.DB, keyID int64) bool {
+	scope, err := loadAPIKeyScope(ctx, db, keyID)
+	if err != nil {
+		// Treat keys whose restrictions can't be read as restricted
+		return keyID != 0
+	}
+	return scope != nil && (len(scope.AllowedDomains) > 0 || len(scope.RequiredTagPrefixes) > 0 || scope.DailySendLimit > 0)
+}
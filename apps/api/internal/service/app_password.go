@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/crypto"
+	"github.com/dublyo/mailat/api/pkg/mailconfig"
+)
+
+// App passwords let mail apps sign in to an identity's IMAP and SMTP without
+// its password. Each is a secret of the identity's Stalwart account in
+// Stalwart's app password form, "$app$<name>$<password>", named after the app
+// password's UUID. The secret is kept encrypted so revoking can remove it and
+// changing the identity's password can keep it.
+
+// appPasswordLength is how many characters app passwords have, not counting
+// the dashes between groups of four
+const appPasswordLength = 20
+
+// maxAppPasswords bounds the app passwords an identity has in use at once
+const maxAppPasswords = 20
+
+// ListAppPasswords returns an identity's app passwords, newest first, revoked
+// ones included
+func (s *IdentityService) ListAppPasswords(ctx context.Context, userID int64, identityUUID string) ([]model.IdentityAppPassword, error) {
+	identity, err := s.GetIdentity(ctx, userID, identityUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT uuid, name, password_prefix, created_at, revoked_at
+		FROM identity_app_passwords
+		WHERE identity_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, identity.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list app passwords: %w", err)
+	}
+	defer rows.Close()
+
+	passwords := []model.IdentityAppPassword{}
+	for rows.Next() {
+		var p model.IdentityAppPassword
+		var revokedAt sql.NullTime
+		if err := rows.Scan(&p.UUID, &p.Name, &p.PasswordPrefix, &p.CreatedAt, &revokedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan app password: %w", err)
+		}
+		if revokedAt.Valid {
+			p.RevokedAt = &revokedAt.Time
+		}
+		passwords = append(passwords, p)
+	}
+	return passwords, nil
+}
+
+// CreateAppPassword generates an app password for a device. The password is
+// only returned this once.
+func (s *IdentityService) CreateAppPassword(ctx context.Context, userID int64, identityUUID, name string) (*model.CreatedAppPassword, error) {
+	identity, err := s.GetIdentity(ctx, userID, identityUUID)
+	if err != nil {
+		return nil, err
+	}
+	if identity.StalwartAcctID == "" {
+		return nil, fmt.Errorf("identity has no mailbox on the mail server")
+	}
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+
+	var active int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM identity_app_passwords WHERE identity_id = $1 AND revoked_at IS NULL
+	`, identity.ID).Scan(&active)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count app passwords: %w", err)
+	}
+	if active >= maxAppPasswords {
+		return nil, fmt.Errorf("an identity can have at most %d app passwords; revoke one first", maxAppPasswords)
+	}
+
+	token := generateRandomToken(appPasswordLength)
+	groups := make([]string, 0, appPasswordLength/4)
+	for i := 0; i < len(token); i += 4 {
+		groups = append(groups, token[i:i+4])
+	}
+	password := strings.Join(groups, "-")
+
+	passwordUUID := uuid.New().String()
+	secret := "$app$" + passwordUUID + "$" + password
+	encryptedSecret, err := crypto.Encrypt(secret, s.cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt app password: %w", err)
+	}
+
+	if err := s.stalwart.AddSecret(ctx, identity.StalwartAcctID, secret); err != nil {
+		return nil, fmt.Errorf("failed to add app password to the mail server: %w", err)
+	}
+
+	created := &model.CreatedAppPassword{Password: password}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO identity_app_passwords (uuid, identity_id, name, password_prefix, encrypted_secret, created_at)
+		VALUES ($1, $2, $3, $4, $5, NOW())
+		RETURNING uuid, name, password_prefix, created_at
+	`, passwordUUID, identity.ID, name, groups[0], encryptedSecret).Scan(
+		&created.UUID, &created.Name, &created.PasswordPrefix, &created.CreatedAt,
+	)
+	if err != nil {
+		// Don't leave a password behind that can't be revoked
+		if removeErr := s.stalwart.RemoveSecret(ctx, identity.StalwartAcctID, secret); removeErr != nil {
+			fmt.Printf("Warning: Failed to remove app password from Stalwart: %v\n", removeErr)
+		}
+		return nil, fmt.Errorf("failed to save app password: %w", err)
+	}
+	return created, nil
+}
+
+// RevokeAppPassword stops a device signing in with its app password
+func (s *IdentityService) RevokeAppPassword(ctx context.Context, userID int64, identityUUID, passwordUUID string) error {
+	identity, err := s.GetIdentity(ctx, userID, identityUUID)
+	if err != nil {
+		return err
+	}
+
+	var encryptedSecret string
+	err = s.db.QueryRowContext(ctx, `
+		SELECT encrypted_secret FROM identity_app_passwords
+		WHERE uuid::text = $1 AND identity_id = $2 AND revoked_at IS NULL
+	`, passwordUUID, identity.ID).Scan(&encryptedSecret)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("app password not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get app password: %w", err)
+	}
+
+	if identity.StalwartAcctID != "" {
+		secret, err := crypto.Decrypt(encryptedSecret, s.cfg.EncryptionKey)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt app password: %w", err)
+		}
+		if err := s.stalwart.RemoveSecret(ctx, identity.StalwartAcctID, secret); err != nil {
+			return fmt.Errorf("failed to remove app password from the mail server: %w", err)
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE identity_app_passwords SET revoked_at = NOW() WHERE uuid::text = $1 AND identity_id = $2
+	`, passwordUUID, identity.ID)
+	if err != nil {
+		return fmt.Errorf("failed to revoke app password: %w", err)
+	}
+	return nil
+}
+
+// appPasswordSecrets returns the Stalwart secrets of an identity's app
+// passwords in use
+func (s *IdentityService) appPasswordSecrets(ctx context.Context, identityID int64) []string {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT encrypted_secret FROM identity_app_passwords WHERE identity_id = $1 AND revoked_at IS NULL
+	`, identityID)
+	if err != nil {
+		fmt.Printf("Warning: Failed to get app passwords: %v\n", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var secrets []string
+	for rows.Next() {
+		var encryptedSecret string
+		if err := rows.Scan(&encryptedSecret); err != nil {
+			continue
+		}
+		if secret, err := crypto.Decrypt(encryptedSecret, s.cfg.EncryptionKey); err == nil {
+			secrets = append(secrets, secret)
+		}
+	}
+	return secrets
+}
+
+// MailSettings returns what a mail app needs to add an identity
+func (s *IdentityService) MailSettings(ctx context.Context, userID int64, identityUUID string) (*mailconfig.Settings, error) {
+	identity, err := s.GetIdentity(ctx, userID, identityUUID)
+	if err != nil {
+		return nil, err
+	}
+	return mailconfig.New(identity.Email, s.cfg.MailHostname, s.cfg.IMAPPort, s.cfg.SubmissionPort), nil
+}
+
+// MailAutoconfig returns the autoconfig document of a domain mailboxes are
+// hosted on, which mail apps fetch when an address on it is added
+func (s *IdentityService) MailAutoconfig(ctx context.Context, domain string) ([]byte, error) {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+
+	var hosted bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM identities i JOIN domains d ON d.id = i.domain_id
+			WHERE LOWER(d.name) = $1 AND i.stalwart_account_id IS NOT NULL
+		)
+	`, domain).Scan(&hosted)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up domain: %w", err)
+	}
+	if !hosted {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "no mailboxes are hosted on this domain")
+	}
+
+	settings := mailconfig.New(mailconfig.UsernamePlaceholder, s.cfg.MailHostname, s.cfg.IMAPPort, s.cfg.SubmissionPort)
+	return mailconfig.Autoconfig(domain, s.cfg.AppName, settings)
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// cidReferencePattern matches cid: references in src and url() attributes of HTML bodies
+var cidReferencePattern = regexp.MustCompile(`(?i)cid:([^"'\s)>]+)`)
+
+const (
+	// maxAttachmentsPerEmail is the number of pre-uploaded attachments a send may reference
+	maxAttachmentsPerEmail = 10
+	// maxAttachmentsTotalSize keeps the encoded message under the SES 40MB limit
+	maxAttachmentsTotalSize = 25 * 1024 * 1024
+)
+
+// blockedAttachmentExtensions are executable and script types that mailbox providers reject
+var blockedAttachmentExtensions = map[string]bool{
+	".exe": true, ".bat": true, ".cmd": true, ".com": true, ".scr": true, ".pif": true,
+	".msi": true, ".js": true, ".jse": true, ".vbs": true, ".vbe": true, ".wsf": true,
+	".ps1": true, ".jar": true, ".lnk": true, ".hta": true, ".cpl": true,
+}
+
+// AttachmentService stores pre-uploaded attachments for transactional sends
+type AttachmentService struct {
+	db    *sql.DB
+	cfg   *config.Config
+	store *provider.AttachmentStore
+}
+
+// NewAttachmentService creates a new attachment service
+func NewAttachmentService(db *sql.DB, cfg *config.Config) *AttachmentService {
+	return &AttachmentService{db: db, cfg: cfg, store: newAttachmentStore(cfg)}
+}
+
+// newAttachmentStore returns the S3 attachment store, or nil when no bucket is configured
+func newAttachmentStore(cfg *config.Config) *provider.AttachmentStore {
+	if cfg.AttachmentsBucket == "" {
+		return nil
+	}
+	store, err := provider.NewAttachmentStore(&provider.AttachmentStoreConfig{
+		Region:          cfg.AWSRegion,
+		AccessKeyID:     cfg.AWSAccessKeyID,
+		SecretAccessKey: cfg.AWSSecretAccessKey,
+		Bucket:          cfg.AttachmentsBucket,
+	})
+	if err != nil {
+		fmt.Printf("Warning: failed to create attachment store: %v\n", err)
+		return nil
+	}
+	return store
+}
+
+// MaxSize returns the largest accepted attachment in bytes
+func (s *AttachmentService) MaxSize() int64 {
+	return int64(s.cfg.AttachmentMaxSizeMB) * 1024 * 1024
+}
+
+// Upload validates and stores an attachment. Identical content is stored once per
+// organization, and uploading the same file again returns the existing attachment.
+func (s *AttachmentService) Upload(ctx context.Context, orgID int64, filename, contentType, checksum string, data []byte) (*model.TransactionalAttachment, error) {
+	if s.store == nil {
+		return nil, fmt.Errorf("attachment storage is not configured")
+	}
+
+	filename = filepath.Base(strings.TrimSpace(filename))
+	if filename == "" || filename == "." || filename == "/" {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "filename required")
+	}
+	if len(data) == 0 {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "file is empty")
+	}
+	if int64(len(data)) > s.MaxSize() {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "file exceeds maximum size of %dMB", s.cfg.AttachmentMaxSizeMB)
+	}
+
+	sum := sha256.Sum256(data)
+	digest := hex.EncodeToString(sum[:])
+	if checksum != "" && !strings.EqualFold(checksum, digest) {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "checksum mismatch: expected %s, got %s", strings.ToLower(checksum), digest)
+	}
+
+	contentType, err := validateAttachmentType(filename, contentType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Same file uploaded again
+	existing, err := s.getByContent(ctx, orgID, digest, filename, contentType)
+	if err == nil {
+		return existing, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to look up attachment: %w", err)
+	}
+
+	// Content is addressed by checksum, so the object is only uploaded once
+	key := fmt.Sprintf("attachments/%d/%s", orgID, digest)
+	exists, err := s.store.Exists(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	if !exists {
+		if err := s.store.Put(ctx, key, contentType, data); err != nil {
+			return nil, err
+		}
+	}
+
+	attachment := &model.TransactionalAttachment{
+		Filename:    filename,
+		ContentType: contentType,
+		Size:        len(data),
+		Checksum:    digest,
+	}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO transactional_attachments (org_id, filename, content_type, size, checksum, storage_key)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (org_id, checksum, filename, content_type) DO UPDATE SET storage_key = EXCLUDED.storage_key
+		RETURNING uuid, created_at
+	`, orgID, filename, contentType, len(data), digest, key).Scan(&attachment.ID, &attachment.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save attachment: %w", err)
+	}
+
+	return attachment, nil
+}
+
+func (s *AttachmentService) getByContent(ctx context.Context, orgID int64, checksum, filename, contentType string) (*model.TransactionalAttachment, error) {
+	var a model.TransactionalAttachment
+	err := s.db.QueryRowContext(ctx, `
+		SELECT uuid, filename, content_type, size, checksum, created_at
+		FROM transactional_attachments
+		WHERE org_id = $1 AND checksum = $2 AND filename = $3 AND content_type = $4
+	`, orgID, checksum, filename, contentType).Scan(&a.ID, &a.Filename, &a.ContentType, &a.Size, &a.Checksum, &a.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &a, nil
+}
+
+// validateAttachmentType checks the declared content type against the filename and the
+// sniffed content, and returns the media type to store
+func validateAttachmentType(filename, declared string, data []byte) (string, error) {
+	if blockedAttachmentExtensions[strings.ToLower(filepath.Ext(filename))] {
+		return "", apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "file type %s is not allowed", filepath.Ext(filename))
+	}
+
+	if len(data) >= 2 && data[0] == 'M' && data[1] == 'Z' {
+		return "", apierror.New(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "executable files are not allowed")
+	}
+	sniffed, _, _ := mime.ParseMediaType(http.DetectContentType(data))
+
+	if declared == "" {
+		return sniffed, nil
+	}
+	mediaType, _, err := mime.ParseMediaType(declared)
+	if err != nil {
+		return "", apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "invalid content type %q", declared)
+	}
+	if mediaType == "application/octet-stream" {
+		return sniffed, nil
+	}
+
+	// Types the sniffer recognizes reliably must match the content
+	switch {
+	case strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml":
+		if !strings.HasPrefix(sniffed, "image/") {
+			return "", apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "content type %s does not match file content (%s)", mediaType, sniffed)
+		}
+	case mediaType == "application/pdf":
+		if sniffed != "application/pdf" {
+			return "", apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "content type %s does not match file content (%s)", mediaType, sniffed)
+		}
+	}
+
+	return mediaType, nil
+}
+
+// resolveAttachments looks up the pre-uploaded attachments and inline images referenced
+// by a send. Attachments come first, followed by the inline images.
+func (s *TransactionalService) resolveAttachments(ctx context.Context, orgID int64, uuids []string, inline []model.InlineImageRef) ([]int64, []worker.AttachmentInfo, error) {
+	if len(uuids) == 0 && len(inline) == 0 {
+		return nil, nil, nil
+	}
+	if len(uuids)+len(inline) > maxAttachmentsPerEmail {
+		return nil, nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "at most %d attachments allowed per email", maxAttachmentsPerEmail)
+	}
+
+	// Each reference, with the Content-ID of inline images
+	type reference struct {
+		id, uuid, cid string
+	}
+	refs := make([]reference, 0, len(uuids)+len(inline))
+	for _, id := range uuids {
+		refs = append(refs, reference{id: id})
+	}
+	cids := map[string]bool{}
+	for _, img := range inline {
+		cid := normalizeCID(img.CID)
+		if cid == "" || strings.ContainsAny(cid, " \t<>\"") {
+			return nil, nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "invalid cid %q", img.CID)
+		}
+		if cids[cid] {
+			return nil, nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "duplicate cid %q", cid)
+		}
+		cids[cid] = true
+		refs = append(refs, reference{id: img.ID, cid: cid})
+	}
+	lowered := make([]string, len(refs))
+	for i := range refs {
+		refs[i].uuid = strings.ToLower(strings.TrimSpace(refs[i].id))
+		lowered[i] = refs[i].uuid
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, uuid, filename, content_type, size, storage_key
+		FROM transactional_attachments
+		WHERE org_id = $1 AND uuid::text = ANY($2)
+	`, orgID, pq.Array(lowered))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to look up attachments: %w", err)
+	}
+	defer rows.Close()
+
+	type found struct {
+		id   int64
+		info worker.AttachmentInfo
+	}
+	byUUID := map[string]found{}
+	for rows.Next() {
+		var f found
+		var uuid string
+		if err := rows.Scan(&f.id, &uuid, &f.info.Name, &f.info.Type, &f.info.Size, &f.info.BlobID); err != nil {
+			continue
+		}
+		byUUID[uuid] = f
+	}
+
+	ids := make([]int64, 0, len(refs))
+	infos := make([]worker.AttachmentInfo, 0, len(refs))
+	total := 0
+	for _, ref := range refs {
+		f, ok := byUUID[ref.uuid]
+		if !ok {
+			return nil, nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "attachment %s not found", ref.id)
+		}
+		f.info.Disposition = "attachment"
+		if ref.cid != "" {
+			if !strings.HasPrefix(f.info.Type, "image/") {
+				return nil, nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "inline attachment %s is not an image (%s)", ref.id, f.info.Type)
+			}
+			f.info.Disposition = "inline"
+			f.info.CID = ref.cid
+		}
+		ids = append(ids, f.id)
+		infos = append(infos, f.info)
+		total += f.info.Size
+	}
+	if total > maxAttachmentsTotalSize {
+		return nil, nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "attachments exceed total size of %dMB", maxAttachmentsTotalSize/1024/1024)
+	}
+
+	return ids, infos, nil
+}
+
+// normalizeCID strips the cid: scheme and angle brackets clients sometimes include
+func normalizeCID(cid string) string {
+	cid = strings.TrimSpace(cid)
+	if len(cid) > 4 && strings.EqualFold(cid[:4], "cid:") {
+		cid = cid[4:]
+	}
+	return strings.TrimSuffix(strings.TrimPrefix(cid, "<"), ">")
+}
+
+// checkInlineReferences makes sure every cid: reference in the HTML body has an
+// inline image, so recipients never see a broken image
+func checkInlineReferences(htmlBody string, infos []worker.AttachmentInfo) error {
+	inline := map[string]bool{}
+	for _, info := range infos {
+		if info.Disposition == "inline" {
+			inline[strings.ToLower(info.CID)] = true
+		}
+	}
+	for _, match := range cidReferencePattern.FindAllStringSubmatch(htmlBody, -1) {
+		if !inline[strings.ToLower(match[1])] {
+			return apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "html references cid:%s but no inline image has that cid", match[1])
+		}
+	}
+	return nil
+}
+
+// linkAttachments records which attachments an email includes, in order, with the
+// Content-ID of inline images
+func (s *TransactionalService) linkAttachments(ctx context.Context, emailID int64, attachmentIDs []int64, infos []worker.AttachmentInfo) error {
+	if len(attachmentIDs) == 0 {
+		return nil
+	}
+	cids := make([]string, len(infos))
+	for i, info := range infos {
+		cids[i] = info.CID
+	}
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO transactional_email_attachments (email_id, attachment_id, position, content_id)
+		SELECT $1, a.id, a.position - 1, NULLIF(a.cid, '')
+		FROM unnest($2::bigint[], $3::text[]) WITH ORDINALITY AS a(id, cid, position)
+		ON CONFLICT (email_id, attachment_id) DO NOTHING
+	`, emailID, pq.Array(attachmentIDs), pq.Array(cids))
+	if err != nil {
+		return fmt.Errorf("failed to link attachments: %w", err)
+	}
+	return nil
+}
+
+// emailAttachments returns the attachments linked to an email for re-queueing
+func (s *TransactionalService) emailAttachments(ctx context.Context, emailID int64) ([]worker.AttachmentInfo, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.filename, a.content_type, a.size, a.storage_key, COALESCE(ea.content_id, '')
+		FROM transactional_email_attachments ea
+		JOIN transactional_attachments a ON a.id = ea.attachment_id
+		WHERE ea.email_id = $1
+		ORDER BY ea.position
+	`, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var infos []worker.AttachmentInfo
+	for rows.Next() {
+		info := worker.AttachmentInfo{Disposition: "attachment"}
+		if err := rows.Scan(&info.Name, &info.Type, &info.Size, &info.BlobID, &info.CID); err != nil {
+			continue
+		}
+		if info.CID != "" {
+			info.Disposition = "inline"
+		}
+		infos = append(infos, info)
+	}
+	return infos, nil
+}
+
+// downloadAttachments fetches attachment content for sending without the queue
+func (s *TransactionalService) downloadAttachments(ctx context.Context, infos []worker.AttachmentInfo) ([]provider.Attachment, error) {
+	if len(infos) == 0 {
+		return nil, nil
+	}
+	if s.attachmentStore == nil {
+		return nil, fmt.Errorf("attachment storage is not configured")
+	}
+
+	attachments := make([]provider.Attachment, 0, len(infos))
+	for _, info := range infos {
+		data, err := s.attachmentStore.Get(ctx, info.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, provider.Attachment{
+			Filename:    info.Name,
+			ContentType: info.Type,
+			Data:        data,
+			ContentID:   info.CID,
+		})
+	}
+	return attachments, nil
+}
@@ -36,6 +36,9 @@ const (
 	AuditActionAutoReplyCreate  = "auto_reply_create"
 	AuditActionAutoReplyUpdate  = "auto_reply_update"
 	AuditActionAutoReplyDelete  = "auto_reply_delete"
+	AuditActionGDPRExport       = "gdpr_export"
+	AuditActionGDPRErase        = "gdpr_erase"
+	AuditActionContactBulk      = "contact_bulk"
 )
 
 // AuditLog represents an audit log entry
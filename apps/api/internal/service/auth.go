@@ -217,16 +217,25 @@ func (s *AuthService) CreateAPIKey(ctx context.Context, orgID int64, userID int6
 		rateLimit = 10000 // max 10000 requests per minute
 	}
 
+	allowedDomains, tagPrefixes, err := normalizeAPIKeyScope(ctx, s.db, orgID, req.AllowedDomains, req.RequiredTagPrefixes, req.DailySendLimit)
+	if err != nil {
+		return nil, err
+	}
+
 	// Insert into database
 	var result model.ApiKeyResponse
 	keyUUID := uuid.New().String()
-	err := s.db.QueryRowContext(ctx, `
-		INSERT INTO api_keys (uuid, org_id, user_id, name, key_prefix, key_hash, permissions, rate_limit, expires_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
-		RETURNING id, uuid, name, key_prefix, permissions, rate_limit, expires_at, created_at
-	`, keyUUID, orgID, userID, req.Name, keyPrefix, keyHash, pq.Array(req.Permissions), rateLimit, expiresAt).Scan(
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO api_keys (uuid, org_id, user_id, name, key_prefix, key_hash, permissions, rate_limit, expires_at,
+			allowed_domains, required_tag_prefixes, daily_send_limit)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING id, uuid, name, key_prefix, permissions, rate_limit, expires_at, created_at,
+			allowed_domains, required_tag_prefixes, daily_send_limit
+	`, keyUUID, orgID, userID, req.Name, keyPrefix, keyHash, pq.Array(req.Permissions), rateLimit, expiresAt,
+		pq.Array(allowedDomains), pq.Array(tagPrefixes), req.DailySendLimit).Scan(
 		&result.ID, &result.UUID, &result.Name, &result.KeyPrefix,
 		pq.Array(&result.Permissions), &result.RateLimit, &result.ExpiresAt, &result.CreatedAt,
+		pq.Array(&result.AllowedDomains), pq.Array(&result.RequiredTagPrefixes), &result.DailySendLimit,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create API key: %w", err)
@@ -241,7 +250,8 @@ func (s *AuthService) CreateAPIKey(ctx context.Context, orgID int64, userID int6
 // ListAPIKeys returns all API keys for an organization
 func (s *AuthService) ListAPIKeys(ctx context.Context, orgID int64) ([]*model.ApiKeyResponse, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, uuid, name, key_prefix, permissions, rate_limit, last_used_at, expires_at, created_at
+		SELECT id, uuid, name, key_prefix, permissions, rate_limit, last_used_at, expires_at, created_at,
+		       COALESCE(allowed_domains, '{}'), COALESCE(required_tag_prefixes, '{}'), COALESCE(daily_send_limit, 0)
 		FROM api_keys
 		WHERE org_id = $1 AND (expires_at IS NULL OR expires_at > NOW())
 		ORDER BY created_at DESC
@@ -256,7 +266,8 @@ func (s *AuthService) ListAPIKeys(ctx context.Context, orgID int64) ([]*model.Ap
 		var key model.ApiKeyResponse
 		var lastUsedAt sql.NullTime
 		if err := rows.Scan(&key.ID, &key.UUID, &key.Name, &key.KeyPrefix,
-			pq.Array(&key.Permissions), &key.RateLimit, &lastUsedAt, &key.ExpiresAt, &key.CreatedAt); err != nil {
+			pq.Array(&key.Permissions), &key.RateLimit, &lastUsedAt, &key.ExpiresAt, &key.CreatedAt,
+			pq.Array(&key.AllowedDomains), pq.Array(&key.RequiredTagPrefixes), &key.DailySendLimit); err != nil {
 			return nil, fmt.Errorf("failed to scan API key: %w", err)
 		}
 		if lastUsedAt.Valid {
@@ -286,6 +297,60 @@ func (s *AuthService) DeleteAPIKey(ctx context.Context, orgID int64, keyUUID str
 	return nil
 }
 
+// UpdateAPIKeyScope changes the sending restrictions of an API key
+func (s *AuthService) UpdateAPIKeyScope(ctx context.Context, orgID int64, keyUUID string, req *model.UpdateApiKeyScopeRequest) (*model.ApiKeyResponse, error) {
+	var key model.ApiKeyResponse
+	var lastUsedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, uuid, name, key_prefix, permissions, rate_limit, last_used_at, expires_at, created_at,
+		       COALESCE(allowed_domains, '{}'), COALESCE(required_tag_prefixes, '{}'), COALESCE(daily_send_limit, 0)
+		FROM api_keys
+		WHERE uuid = $1 AND org_id = $2
+	`, keyUUID, orgID).Scan(&key.ID, &key.UUID, &key.Name, &key.KeyPrefix,
+		pq.Array(&key.Permissions), &key.RateLimit, &lastUsedAt, &key.ExpiresAt, &key.CreatedAt,
+		pq.Array(&key.AllowedDomains), pq.Array(&key.RequiredTagPrefixes), &key.DailySendLimit)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("API key not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get API key: %w", err)
+	}
+	if lastUsedAt.Valid {
+		key.LastUsedAt = &lastUsedAt.Time
+	}
+
+	if req.AllowedDomains != nil {
+		key.AllowedDomains = *req.AllowedDomains
+	}
+	if req.RequiredTagPrefixes != nil {
+		key.RequiredTagPrefixes = *req.RequiredTagPrefixes
+	}
+	if req.DailySendLimit != nil {
+		key.DailySendLimit = *req.DailySendLimit
+	}
+
+	key.AllowedDomains, key.RequiredTagPrefixes, err = normalizeAPIKeyScope(ctx, s.db, orgID, key.AllowedDomains, key.RequiredTagPrefixes, key.DailySendLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE api_keys SET allowed_domains = $2, required_tag_prefixes = $3, daily_send_limit = $4
+		WHERE id = $1
+	`, key.ID, pq.Array(key.AllowedDomains), pq.Array(key.RequiredTagPrefixes), key.DailySendLimit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update API key: %w", err)
+	}
+
+	return &key, nil
+}
+
+// IsScopedAPIKey reports whether an API key has sending restrictions. Such keys
+// can't manage API keys, which would let them create an unrestricted one.
+func (s *AuthService) IsScopedAPIKey(ctx context.Context, keyID int64) bool {
+	return isScopedAPIKey(ctx, s.db, keyID)
+}
+
 // IsRegistrationOpen checks if registration is still available (no users exist yet)
 func (s *AuthService) IsRegistrationOpen(ctx context.Context) (bool, error) {
 	var count int
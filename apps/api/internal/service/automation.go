@@ -9,9 +9,13 @@ import (
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 
 	"github.com/dublyo/mailat/api/internal/config"
 	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/automationgoal"
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+	"github.com/dublyo/mailat/api/pkg/workflow"
 )
 
 type AutomationService struct {
@@ -25,6 +29,30 @@ func NewAutomationService(db *sql.DB, cfg *config.Config) *AutomationService {
 
 // CreateAutomation creates a new automation
 func (s *AutomationService) CreateAutomation(ctx context.Context, orgID int64, req *model.CreateAutomationRequest) (*model.Automation, error) {
+	if err := validateTrigger(req.TriggerType, req.TriggerConfig); err != nil {
+		return nil, err
+	}
+	if req.TopicID != nil {
+		if err := checkTopic(ctx, s.db, orgID, *req.TopicID); err != nil {
+			return nil, err
+		}
+	}
+	goal, err := checkGoal(ctx, s.db, orgID, req.Goal)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkReenrollCooldown(req.ReenrollCooldownHours); err != nil {
+		return nil, err
+	}
+	errorPolicy, err := checkErrorPolicy(req.ErrorPolicy)
+	if err != nil {
+		return nil, err
+	}
+	var webhookSecret any
+	if req.TriggerType == automationtrigger.Webhook {
+		webhookSecret = generateWebhookSecret()
+	}
+
 	automationUUID := uuid.New().String()
 	now := time.Now()
 
@@ -35,9 +63,11 @@ func (s *AutomationService) CreateAutomation(ctx context.Context, orgID int64, r
 	}
 
 	query := `
-		INSERT INTO automations (uuid, org_id, name, description, trigger_type, trigger_config, workflow, status, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, 'draft', $8, $8)
-		RETURNING id, uuid, org_id, name, description, trigger_type, trigger_config, workflow, status, created_at, updated_at
+		INSERT INTO automations (uuid, org_id, name, description, trigger_type, trigger_config, workflow, topic_id, goal,
+		                         allow_reenrollment, reenroll_cooldown_hours, error_policy, webhook_secret, status, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $9, $10, $11, $12, $13, $14, 'draft', $8, $8)
+		RETURNING id, uuid, org_id, name, description, trigger_type, trigger_config, workflow, topic_id, goal,
+		          allow_reenrollment, reenroll_cooldown_hours, error_policy, webhook_secret, status, created_at, updated_at
 	`
 
 	triggerConfigJSON, _ := json.Marshal(req.TriggerConfig)
@@ -45,19 +75,36 @@ func (s *AutomationService) CreateAutomation(ctx context.Context, orgID int64, r
 	var automation model.Automation
 	var workflowBytes []byte
 	var triggerConfigBytes []byte
+	var goalBytes []byte
+	var errorPolicyBytes []byte
+	var secret sql.NullString
 	err = s.db.QueryRowContext(ctx, query,
-		automationUUID, orgID, req.Name, req.Description, req.TriggerType, triggerConfigJSON, workflowJSON, now,
+		automationUUID, orgID, req.Name, req.Description, req.TriggerType, triggerConfigJSON, workflowJSON, now, req.TopicID, goal,
+		req.AllowReenrollment, req.ReenrollCooldownHours, errorPolicy, webhookSecret,
 	).Scan(
 		&automation.ID, &automation.UUID, &automation.OrgID, &automation.Name, &automation.Description,
-		&automation.TriggerType, &triggerConfigBytes, &workflowBytes, &automation.Status,
+		&automation.TriggerType, &triggerConfigBytes, &workflowBytes, &automation.TopicID, &goalBytes,
+		&automation.AllowReenrollment, &automation.ReenrollCooldownHours, &errorPolicyBytes, &secret, &automation.Status,
 		&automation.CreatedAt, &automation.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create automation: %w", err)
 	}
+	automation.Version = 1
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO automation_versions (automation_id, version, workflow, created_at) VALUES ($1, 1, $2, $3)
+	`, automation.ID, workflowJSON, now)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save workflow version: %w", err)
+	}
 
 	json.Unmarshal(workflowBytes, &automation.Workflow)
 	json.Unmarshal(triggerConfigBytes, &automation.TriggerConfig)
+	if len(goalBytes) > 0 {
+		json.Unmarshal(goalBytes, &automation.Goal)
+	}
+	automation.ErrorPolicy = errorPolicyModel(errorPolicyBytes)
+	s.webhookTrigger(&automation, secret)
 
 	return &automation, nil
 }
@@ -65,8 +112,8 @@ func (s *AutomationService) CreateAutomation(ctx context.Context, orgID int64, r
 // GetAutomation retrieves an automation by UUID
 func (s *AutomationService) GetAutomation(ctx context.Context, orgID int64, automationUUID string) (*model.Automation, error) {
 	query := `
-		SELECT id, uuid, org_id, name, description, trigger_type, trigger_config, workflow, status,
-		       enrolled_count, completed_count, in_progress_count, created_at, updated_at
+		SELECT id, uuid, org_id, name, description, trigger_type, trigger_config, workflow, COALESCE(version, 1), topic_id, goal,
+		       COALESCE(allow_reenrollment, false), COALESCE(reenroll_cooldown_hours, 0), error_policy, webhook_secret, status, enrolled_count, completed_count, in_progress_count, COALESCE(converted_count, 0), created_at, updated_at
 		FROM automations
 		WHERE uuid = $1 AND org_id = $2
 	`
@@ -74,10 +121,13 @@ func (s *AutomationService) GetAutomation(ctx context.Context, orgID int64, auto
 	var automation model.Automation
 	var workflowBytes []byte
 	var triggerConfigBytes []byte
+	var goalBytes []byte
+	var errorPolicyBytes []byte
+	var secret sql.NullString
 	err := s.db.QueryRowContext(ctx, query, automationUUID, orgID).Scan(
 		&automation.ID, &automation.UUID, &automation.OrgID, &automation.Name, &automation.Description,
-		&automation.TriggerType, &triggerConfigBytes, &workflowBytes, &automation.Status,
-		&automation.EnrolledCount, &automation.CompletedCount, &automation.InProgressCount,
+		&automation.TriggerType, &triggerConfigBytes, &workflowBytes, &automation.Version, &automation.TopicID, &goalBytes,
+		&automation.AllowReenrollment, &automation.ReenrollCooldownHours, &errorPolicyBytes, &secret, &automation.Status, &automation.EnrolledCount, &automation.CompletedCount, &automation.InProgressCount, &automation.ConvertedCount,
 		&automation.CreatedAt, &automation.UpdatedAt,
 	)
 	if err != nil {
@@ -89,6 +139,11 @@ func (s *AutomationService) GetAutomation(ctx context.Context, orgID int64, auto
 
 	json.Unmarshal(workflowBytes, &automation.Workflow)
 	json.Unmarshal(triggerConfigBytes, &automation.TriggerConfig)
+	if len(goalBytes) > 0 {
+		json.Unmarshal(goalBytes, &automation.Goal)
+	}
+	automation.ErrorPolicy = errorPolicyModel(errorPolicyBytes)
+	s.webhookTrigger(&automation, secret)
 
 	return &automation, nil
 }
@@ -175,9 +230,18 @@ func (s *AutomationService) UpdateAutomation(ctx context.Context, orgID int64, a
 		argIndex++
 	}
 	if req.TriggerType != nil {
+		if err := validateTrigger(*req.TriggerType, req.TriggerConfig); err != nil {
+			return nil, err
+		}
 		updates = append(updates, fmt.Sprintf("trigger_type = $%d", argIndex))
 		args = append(args, *req.TriggerType)
 		argIndex++
+		if *req.TriggerType == automationtrigger.Webhook {
+			// Automations switched to webhooks keep the secret they had, if any
+			updates = append(updates, fmt.Sprintf("webhook_secret = COALESCE(webhook_secret, $%d)", argIndex))
+			args = append(args, generateWebhookSecret())
+			argIndex++
+		}
 	}
 	if req.TriggerConfig != nil {
 		configJSON, _ := json.Marshal(req.TriggerConfig)
@@ -185,11 +249,73 @@ func (s *AutomationService) UpdateAutomation(ctx context.Context, orgID int64, a
 		args = append(args, configJSON)
 		argIndex++
 	}
+	if req.TopicID != nil {
+		var topicID *int
+		if *req.TopicID != 0 {
+			if err := checkTopic(ctx, s.db, orgID, *req.TopicID); err != nil {
+				return nil, err
+			}
+			topicID = req.TopicID
+		}
+		updates = append(updates, fmt.Sprintf("topic_id = $%d", argIndex))
+		args = append(args, topicID)
+		argIndex++
+	}
+	if req.Goal != nil {
+		// A goal without a type removes it
+		var goal any
+		if req.Goal.Type != "" {
+			var err error
+			goal, err = checkGoal(ctx, s.db, orgID, req.Goal)
+			if err != nil {
+				return nil, err
+			}
+		}
+		updates = append(updates, fmt.Sprintf("goal = $%d", argIndex))
+		args = append(args, goal)
+		argIndex++
+	}
+	if req.AllowReenrollment != nil {
+		updates = append(updates, fmt.Sprintf("allow_reenrollment = $%d", argIndex))
+		args = append(args, *req.AllowReenrollment)
+		argIndex++
+	}
+	if req.ReenrollCooldownHours != nil {
+		if err := checkReenrollCooldown(*req.ReenrollCooldownHours); err != nil {
+			return nil, err
+		}
+		updates = append(updates, fmt.Sprintf("reenroll_cooldown_hours = $%d", argIndex))
+		args = append(args, *req.ReenrollCooldownHours)
+		argIndex++
+	}
+	if req.ErrorPolicy != nil {
+		errorPolicy, err := checkErrorPolicy(req.ErrorPolicy)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, fmt.Sprintf("error_policy = $%d", argIndex))
+		args = append(args, errorPolicy)
+		argIndex++
+	}
+	var workflowJSON []byte
 	if req.Workflow != nil {
-		workflowJSON, _ := json.Marshal(req.Workflow)
+		workflowJSON, _ = json.Marshal(req.Workflow)
+		// Active automations run their workflow as soon as it's saved
+		var status string
+		s.db.QueryRowContext(ctx, `SELECT status FROM automations WHERE uuid = $1 AND org_id = $2`, automationUUID, orgID).Scan(&status)
+		if status == "active" {
+			if err := checkWorkflow(ctx, s.db, orgID, workflowJSON); err != nil {
+				return nil, err
+			}
+		}
+		if err := checkMigration(workflowJSON, req.Migration); err != nil {
+			return nil, err
+		}
 		updates = append(updates, fmt.Sprintf("workflow = $%d", argIndex))
 		args = append(args, workflowJSON)
 		argIndex++
+	} else if req.Migration != nil {
+		return nil, fmt.Errorf("migration needs the new workflow")
 	}
 
 	if len(updates) == 0 {
@@ -217,9 +343,120 @@ func (s *AutomationService) UpdateAutomation(ctx context.Context, orgID int64, a
 		return nil, fmt.Errorf("automation not found")
 	}
 
+	if workflowJSON != nil {
+		if err := s.saveVersion(ctx, orgID, automationUUID, workflowJSON, req.Migration); err != nil {
+			return nil, err
+		}
+	}
+
 	return s.GetAutomation(ctx, orgID, automationUUID)
 }
 
+// saveVersion saves an automation's new workflow as its current version. The
+// current version is updated in place while no enrollment is on it; otherwise
+// the workflow becomes a new version and the enrollments on older ones finish
+// on theirs, unless a migration moves them onto it.
+func (s *AutomationService) saveVersion(ctx context.Context, orgID int64, automationUUID string, workflowJSON []byte, migration *model.WorkflowMigration) error {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to save workflow version: %w", err)
+	}
+	defer tx.Rollback()
+
+	var automationID, version int
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, COALESCE(version, 1) FROM automations WHERE uuid = $1 AND org_id = $2 FOR UPDATE
+	`, automationUUID, orgID).Scan(&automationID, &version)
+	if err != nil {
+		return fmt.Errorf("failed to save workflow version: %w", err)
+	}
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE automation_versions SET workflow = $3
+		WHERE automation_id = $1 AND version = $2
+		AND NOT EXISTS (SELECT 1 FROM automation_enrollments WHERE automation_id = $1 AND workflow_version = $2)
+	`, automationID, version, workflowJSON)
+	if err != nil {
+		return fmt.Errorf("failed to save workflow version: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		err = tx.QueryRowContext(ctx, `
+			INSERT INTO automation_versions (automation_id, version, workflow, created_at)
+			SELECT $1, COALESCE(MAX(version), 0) + 1, $2, NOW() FROM automation_versions WHERE automation_id = $1
+			RETURNING version
+		`, automationID, workflowJSON).Scan(&version)
+		if err != nil {
+			return fmt.Errorf("failed to save workflow version: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `UPDATE automations SET version = $2 WHERE id = $1`, automationID, version); err != nil {
+			return fmt.Errorf("failed to save workflow version: %w", err)
+		}
+	}
+
+	if migration != nil {
+		w, _ := workflow.Parse(workflowJSON)
+		nodeIDs := make([]string, 0, len(w.Nodes))
+		for _, n := range w.Nodes {
+			nodeIDs = append(nodeIDs, n.ID)
+		}
+		nodes, _ := json.Marshal(migration.Nodes)
+		_, err := tx.ExecContext(ctx, `
+			UPDATE automation_enrollments
+			SET current_node_id = COALESCE($3::jsonb->>current_node_id, current_node_id), workflow_version = $2, updated_at = NOW()
+			WHERE automation_id = $1 AND status = 'active' AND workflow_version < $2
+			AND ($3::jsonb ? current_node_id OR ($4 AND current_node_id = ANY($5)))
+		`, automationID, version, nodes, migration.KeepNodeIDs, pq.Array(nodeIDs))
+		if err != nil {
+			return fmt.Errorf("failed to migrate enrollments: %w", err)
+		}
+	}
+
+	return tx.Commit()
+}
+
+// ListVersions lists the versions of an automation's workflow, latest first,
+// with the enrollments under way on each
+func (s *AutomationService) ListVersions(ctx context.Context, orgID int64, automationUUID string) ([]model.AutomationVersion, error) {
+	var automationID, current int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, COALESCE(version, 1) FROM automations WHERE uuid = $1 AND org_id = $2
+	`, automationUUID, orgID).Scan(&automationID, &current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("automation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get automation: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT v.version, v.workflow, v.created_at, (
+			SELECT COUNT(*) FROM automation_enrollments e
+			WHERE e.automation_id = v.automation_id AND e.status = 'active'
+			AND COALESCE(e.workflow_version, $2) = v.version
+		)
+		FROM automation_versions v
+		WHERE v.automation_id = $1
+		ORDER BY v.version DESC
+	`, automationID, current)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list versions: %w", err)
+	}
+	defer rows.Close()
+
+	versions := []model.AutomationVersion{}
+	for rows.Next() {
+		var v model.AutomationVersion
+		var workflowBytes []byte
+		if err := rows.Scan(&v.Version, &workflowBytes, &v.CreatedAt, &v.ActiveEnrollments); err != nil {
+			return nil, fmt.Errorf("failed to scan version: %w", err)
+		}
+		json.Unmarshal(workflowBytes, &v.Workflow)
+		v.Current = v.Version == current
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
 // DeleteAutomation deletes an automation
 func (s *AutomationService) DeleteAutomation(ctx context.Context, orgID int64, automationUUID string) error {
 	query := `DELETE FROM automations WHERE uuid = $1 AND org_id = $2`
@@ -236,9 +473,24 @@ func (s *AutomationService) DeleteAutomation(ctx context.Context, orgID int64, a
 	return nil
 }
 
-// ActivateAutomation activates an automation
+// ActivateAutomation activates an automation once its workflow can run
 func (s *AutomationService) ActivateAutomation(ctx context.Context, orgID int64, automationUUID string) (*model.Automation, error) {
-	query := `UPDATE automations SET status = 'active', updated_at = $1 WHERE uuid = $2 AND org_id = $3`
+	var workflowJSON []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(workflow, '{}') FROM automations WHERE uuid = $1 AND org_id = $2
+	`, automationUUID, orgID).Scan(&workflowJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("automation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get automation: %w", err)
+	}
+	if err := checkWorkflow(ctx, s.db, orgID, workflowJSON); err != nil {
+		return nil, err
+	}
+
+	// Scheduled triggers only look at what happens from now on
+	query := `UPDATE automations SET status = 'active', trigger_checked_at = $1, updated_at = $1 WHERE uuid = $2 AND org_id = $3`
 	result, err := s.db.ExecContext(ctx, query, time.Now(), automationUUID, orgID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to activate automation: %w", err)
@@ -272,7 +524,7 @@ func (s *AutomationService) PauseAutomation(ctx context.Context, orgID int64, au
 func (s *AutomationService) GetAutomationStats(ctx context.Context, orgID int64, automationUUID string) (*model.AutomationStats, error) {
 	query := `
 		SELECT enrolled_count, completed_count, in_progress_count,
-		       COALESCE(error_count, 0), created_at
+		       COALESCE(error_count, 0), COALESCE(converted_count, 0), created_at
 		FROM automations
 		WHERE uuid = $1 AND org_id = $2
 	`
@@ -280,7 +532,7 @@ func (s *AutomationService) GetAutomationStats(ctx context.Context, orgID int64,
 	var stats model.AutomationStats
 	var createdAt time.Time
 	err := s.db.QueryRowContext(ctx, query, automationUUID, orgID).Scan(
-		&stats.Enrolled, &stats.Completed, &stats.InProgress, &stats.Errors, &createdAt,
+		&stats.Enrolled, &stats.Completed, &stats.InProgress, &stats.Errors, &stats.Converted, &createdAt,
 	)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -291,41 +543,215 @@ func (s *AutomationService) GetAutomationStats(ctx context.Context, orgID int64,
 
 	stats.AutomationUUID = automationUUID
 
-	// Calculate completion rate
+	// Calculate completion and conversion rates
 	if stats.Enrolled > 0 {
 		stats.CompletionRate = float64(stats.Completed) / float64(stats.Enrolled) * 100
+		stats.ConversionRate = float64(stats.Converted) / float64(stats.Enrolled) * 100
+	}
+
+	stats.Nodes, err = s.nodeStats(ctx, orgID, automationUUID)
+	if err != nil {
+		return nil, err
 	}
 
 	return &stats, nil
 }
 
-// EnrollContact enrolls a contact in an automation
-func (s *AutomationService) EnrollContact(ctx context.Context, orgID int64, automationUUID string, contactUUID string) error {
-	now := time.Now()
-	enrollmentUUID := uuid.New().String()
+// nodeStats returns the runs of an automation's workflow nodes
+func (s *AutomationService) nodeStats(ctx context.Context, orgID int64, automationUUID string) ([]model.AutomationNodeStats, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ns.node_id, ns.node_type, ns.success_count, ns.error_count, COALESCE(ns.yes_count, 0), COALESCE(ns.no_count, 0),
+		       COALESCE(ns.last_error, ''), ns.last_run_at
+		FROM automation_node_stats ns
+		JOIN automations a ON a.id = ns.automation_id
+		WHERE a.uuid = $1 AND a.org_id = $2
+		ORDER BY ns.node_id
+	`, automationUUID, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get node stats: %w", err)
+	}
+	defer rows.Close()
 
-	// Insert enrollment
-	query := `
-		INSERT INTO automation_enrollments (uuid, automation_id, contact_id, org_id, status, step_index, enrolled_at, updated_at)
-		SELECT $1, a.id, c.id, $2, 'active', 0, $3, $3
-		FROM automations a, contacts c
-		WHERE a.uuid = $4 AND a.org_id = $2 AND c.uuid = $5 AND c.org_id = $2
-	`
-	_, err := s.db.ExecContext(ctx, query, enrollmentUUID, orgID, now, automationUUID, contactUUID)
+	nodes := []model.AutomationNodeStats{}
+	for rows.Next() {
+		var n model.AutomationNodeStats
+		if err := rows.Scan(&n.NodeID, &n.NodeType, &n.Success, &n.Errors, &n.Yes, &n.No, &n.LastError, &n.LastRunAt); err != nil {
+			return nil, fmt.Errorf("failed to scan node stats: %w", err)
+		}
+		nodes = append(nodes, n)
+	}
+	return nodes, rows.Err()
+}
+
+// checkWorkflow checks that a workflow can run: it starts at a trigger, its
+// delays and actions are complete, and the lists its actions change are static
+// lists of the org
+func checkWorkflow(ctx context.Context, db *sql.DB, orgID int64, workflowJSON []byte) error {
+	w, err := workflow.Parse(workflowJSON)
+	if err != nil {
+		return err
+	}
+	if w.Start() == nil {
+		return fmt.Errorf("workflow needs a trigger node")
+	}
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	for i := range w.Nodes {
+		n := &w.Nodes[i]
+		if n.Data.Type == workflow.NodeEmail {
+			if err := checkEmailNode(ctx, db, orgID, n); err != nil {
+				return err
+			}
+			continue
+		}
+		if n.Data.Type != workflow.NodeAction {
+			continue
+		}
+		action, _ := n.Action()
+		for _, listUUID := range action.Lists() {
+			var listType string
+			err := db.QueryRowContext(ctx, `
+				SELECT type FROM lists WHERE org_id = $1 AND uuid::text = $2
+			`, orgID, listUUID).Scan(&listType)
+			if errors.Is(err, sql.ErrNoRows) {
+				return fmt.Errorf("node %s: list %s not found", n.Name(), listUUID)
+			}
+			if err != nil {
+				return fmt.Errorf("failed to check list: %w", err)
+			}
+			if listType == "dynamic" {
+				return fmt.Errorf("node %s: list %s is dynamic, its members come from its rules", n.Name(), listUUID)
+			}
+		}
+	}
+	return nil
+}
+
+// checkEmailNode checks that the template an email node sends and the identity
+// or domain it sends from are the org's
+func checkEmailNode(ctx context.Context, db *sql.DB, orgID int64, n *workflow.Node) error {
+	email, _ := n.Email()
+	var exists bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM email_templates WHERE org_id = $1 AND uuid::text = $2)
+	`, orgID, email.TemplateID).Scan(&exists)
 	if err != nil {
-		return fmt.Errorf("failed to enroll contact: %w", err)
+		return fmt.Errorf("failed to check template: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("node %s: template %s not found", n.Name(), email.TemplateID)
 	}
 
-	// Increment enrolled count
-	updateQuery := `UPDATE automations SET enrolled_count = enrolled_count + 1 WHERE uuid = $1 AND org_id = $2`
-	_, err = s.db.ExecContext(ctx, updateQuery, automationUUID, orgID)
+	if email.IdentityID != "" {
+		err = db.QueryRowContext(ctx, `
+			SELECT EXISTS (
+				SELECT 1 FROM identities i JOIN users u ON u.id = i.user_id
+				WHERE i.uuid::text = $1 AND u.org_id = $2
+			)
+		`, email.IdentityID, orgID).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("failed to check identity: %w", err)
+		}
+		if !exists {
+			return fmt.Errorf("node %s: identity %s not found", n.Name(), email.IdentityID)
+		}
+		return nil
+	}
+	err = db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM domains WHERE org_id = $1 AND name = $2)
+	`, orgID, extractDomain(email.FromEmail)).Scan(&exists)
 	if err != nil {
-		return fmt.Errorf("failed to update enrollment count: %w", err)
+		return fmt.Errorf("failed to check sender domain: %w", err)
 	}
+	if !exists {
+		return fmt.Errorf("node %s: sender domain of %s isn't one of the organization's", n.Name(), email.FromEmail)
+	}
+	return nil
+}
 
+// checkReenrollCooldown checks a re-enrollment cooldown is in range
+func checkReenrollCooldown(hours int) error {
+	if hours < 0 || hours > automationtrigger.MaxReenrollCooldownHours {
+		return fmt.Errorf("reenrollCooldownHours must be between 0 and %d", automationtrigger.MaxReenrollCooldownHours)
+	}
 	return nil
 }
 
+// checkErrorPolicy checks an automation's error policy and returns it as
+// stored: nil without one
+func checkErrorPolicy(policy *model.AutomationErrorPolicy) (any, error) {
+	if policy == nil {
+		return nil, nil
+	}
+	p := workflow.ErrorPolicy{Retries: policy.Retries, BackoffMinutes: policy.BackoffMinutes, OnFailure: policy.OnFailure}
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+	data, _ := json.Marshal(p)
+	return string(data), nil
+}
+
+// errorPolicyModel reads an automation's error policy as stored, with the
+// defaults it runs with when it has none
+func errorPolicyModel(data []byte) *model.AutomationErrorPolicy {
+	p := workflow.ParseErrorPolicy(data)
+	return &model.AutomationErrorPolicy{Retries: p.Retries, BackoffMinutes: p.BackoffMinutes, OnFailure: p.OnFailure}
+}
+
+// checkMigration checks that a migration moves enrollments to nodes of the new
+// workflow
+func checkMigration(workflowJSON []byte, migration *model.WorkflowMigration) error {
+	if migration == nil {
+		return nil
+	}
+	w, err := workflow.Parse(workflowJSON)
+	if err != nil {
+		return err
+	}
+	for from, to := range migration.Nodes {
+		if w.Node(to) == nil {
+			return fmt.Errorf("migration moves node %s to %s, which isn't in the workflow", from, to)
+		}
+	}
+	return nil
+}
+
+// checkGoal checks an automation's goal, and that the list a joined_list goal
+// names is one of the org's, and returns it as stored: nil without a goal
+func checkGoal(ctx context.Context, db *sql.DB, orgID int64, goal *model.AutomationGoal) (any, error) {
+	if goal == nil {
+		return nil, nil
+	}
+	g := &automationgoal.Goal{Type: goal.Type, URL: goal.URL, Event: goal.Event, ListID: goal.ListID}
+	if err := g.Validate(); err != nil {
+		return nil, err
+	}
+	if g.Type == automationgoal.JoinedList {
+		var exists bool
+		err := db.QueryRowContext(ctx, `
+			SELECT EXISTS (SELECT 1 FROM lists WHERE org_id = $1 AND uuid::text = $2)
+		`, orgID, g.ListID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check list: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("goal list %s not found", g.ListID)
+		}
+	}
+	data, err := json.Marshal(g)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// validateTrigger checks the config of triggers that need one
+func validateTrigger(triggerType string, config map[string]any) error {
+	return automationtrigger.Validate(triggerType, config)
+}
+
 // Helper function to join strings
 func joinStrings(strs []string, sep string) string {
 	if len(strs) == 0 {
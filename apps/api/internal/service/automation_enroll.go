@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+)
+
+// maxEnrollContacts bounds the contacts an enrollment request picks by UUID
+const maxEnrollContacts = 1000
+
+// EnrollContacts enrolls contacts in an automation, picked by UUID or as the
+// members of a segment. Contacts already enrolled are enrolled again only when
+// the automation allows re-enrollment, and contacts opted out of the
+// automation's subscription topic or at the org's limit of automations per
+// contact aren't enrolled.
+func (s *AutomationService) EnrollContacts(ctx context.Context, orgID int64, automationUUID string, req *model.EnrollContactsRequest) (*model.EnrollContactsResult, error) {
+	automationID, err := s.automationID(ctx, orgID, automationUUID)
+	if err != nil {
+		return nil, err
+	}
+	contacts, args, picked, err := s.pickContacts(ctx, orgID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	var enrolled int
+	err = s.db.QueryRowContext(ctx, `
+		WITH enrolled AS (
+			INSERT INTO automation_enrollments (automation_id, contact_id, org_id, status, step_index, enrolled_at, updated_at)
+			SELECT a.id, t.id, a.org_id, 'active', 0, NOW(), NOW()
+			FROM automations a, (`+contacts+`) t
+			WHERE a.id = $1 AND `+automationtrigger.EnrollFilter("a", "t.id")+`
+			`+automationtrigger.OnConflict+`
+			RETURNING 1
+		)
+		SELECT COUNT(*) FROM enrolled
+	`, append([]any{automationID}, args...)...).Scan(&enrolled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll contacts: %w", err)
+	}
+
+	if enrolled > 0 {
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE automations SET enrolled_count = enrolled_count + $2 WHERE id = $1
+		`, automationID, enrolled)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update enrollment count: %w", err)
+		}
+	}
+
+	return &model.EnrollContactsResult{Enrolled: enrolled, Skipped: max(picked-enrolled, 0)}, nil
+}
+
+// UnenrollContacts takes contacts, picked by UUID or as the members of a
+// segment, out of an automation. Their enrollments end as exited wherever they
+// are in the workflow.
+func (s *AutomationService) UnenrollContacts(ctx context.Context, orgID int64, automationUUID string, req *model.EnrollContactsRequest) (*model.EnrollContactsResult, error) {
+	automationID, err := s.automationID(ctx, orgID, automationUUID)
+	if err != nil {
+		return nil, err
+	}
+	contacts, args, picked, err := s.pickContacts(ctx, orgID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE automation_enrollments
+		SET status = 'exited', error_message = 'Unenrolled', next_run_at = NULL, updated_at = NOW()
+		WHERE automation_id = $1 AND status = 'active' AND contact_id IN (`+contacts+`)
+	`, append([]any{automationID}, args...)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unenroll contacts: %w", err)
+	}
+	unenrolled, _ := result.RowsAffected()
+
+	return &model.EnrollContactsResult{Unenrolled: int(unenrolled), Skipped: max(picked-int(unenrolled), 0)}, nil
+}
+
+// automationID returns the ID of one of the org's automations
+func (s *AutomationService) automationID(ctx context.Context, orgID int64, automationUUID string) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM automations WHERE uuid = $1 AND org_id = $2
+	`, automationUUID, orgID).Scan(&id)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("automation not found")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get automation: %w", err)
+	}
+	return id, nil
+}
+
+// pickContacts returns the query selecting the IDs of the contacts an
+// enrollment request picks, with its arguments numbered from $2, and how many
+// contacts it picks. Segments are dynamic lists, whose members are kept up to
+// date from their rules.
+func (s *AutomationService) pickContacts(ctx context.Context, orgID int64, req *model.EnrollContactsRequest) (string, []any, int, error) {
+	if req.SegmentID != "" {
+		if req.ContactUUID != "" || len(req.ContactUUIDs) > 0 {
+			return "", nil, 0, fmt.Errorf("pick contacts by UUID or by segment, not both")
+		}
+		var members int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COUNT(c.id) FROM lists l
+			LEFT JOIN list_contacts lc ON lc.list_id = l.id
+			LEFT JOIN contacts c ON c.id = lc.contact_id AND c.status = 'active'
+			WHERE l.org_id = $1 AND l.uuid::text = $2
+			GROUP BY l.id
+		`, orgID, req.SegmentID).Scan(&members)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", nil, 0, fmt.Errorf("segment not found")
+		}
+		if err != nil {
+			return "", nil, 0, fmt.Errorf("failed to get segment: %w", err)
+		}
+		return `
+			SELECT c.id FROM lists l
+			JOIN list_contacts lc ON lc.list_id = l.id
+			JOIN contacts c ON c.id = lc.contact_id
+			WHERE l.org_id = $2 AND l.uuid::text = $3 AND c.status = 'active'
+		`, []any{orgID, req.SegmentID}, members, nil
+	}
+
+	uuids := []string{}
+	seen := map[string]bool{}
+	for _, id := range append([]string{req.ContactUUID}, req.ContactUUIDs...) {
+		id = strings.TrimSpace(id)
+		if id == "" || seen[id] {
+			continue
+		}
+		seen[id] = true
+		uuids = append(uuids, id)
+	}
+	if len(uuids) == 0 {
+		return "", nil, 0, fmt.Errorf("contactUuids or segmentId is required")
+	}
+	if len(uuids) > maxEnrollContacts {
+		return "", nil, 0, fmt.Errorf("at most %d contacts can be picked at once, use a segment for more", maxEnrollContacts)
+	}
+	return `
+		SELECT c.id FROM contacts c
+		WHERE c.org_id = $2 AND c.uuid::text = ANY($3) AND c.status IS DISTINCT FROM 'erased'
+	`, []any{orgID, pq.Array(uuids)}, len(uuids), nil
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+)
+
+// ListFailedEnrollments lists an automation's failed enrollments, newest first:
+// the ones a node failed for, which stopped in error or were paused by the
+// automation's error policy
+func (s *AutomationService) ListFailedEnrollments(ctx context.Context, orgID int64, automationUUID string, page, pageSize int) (*model.FailedEnrollmentList, error) {
+	automationID, err := s.automationID(ctx, orgID, automationUUID)
+	if err != nil {
+		return nil, err
+	}
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	list := &model.FailedEnrollmentList{Enrollments: []model.FailedEnrollment{}, Page: page, PageSize: pageSize}
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM automation_enrollments WHERE automation_id = $1 AND status IN ('error', 'paused')
+	`, automationID).Scan(&list.Total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count failed enrollments: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.uuid, c.uuid, c.email, e.status, COALESCE(e.current_node_id, ''), COALESCE(e.error_message, ''),
+		       COALESCE(e.retry_count, 0), e.updated_at
+		FROM automation_enrollments e
+		JOIN contacts c ON c.id = e.contact_id
+		WHERE e.automation_id = $1 AND e.status IN ('error', 'paused')
+		ORDER BY e.updated_at DESC, e.id DESC
+		LIMIT $2 OFFSET $3
+	`, automationID, pageSize, (page-1)*pageSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list failed enrollments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e model.FailedEnrollment
+		if err := rows.Scan(&e.UUID, &e.ContactUUID, &e.ContactEmail, &e.Status, &e.NodeID, &e.Error, &e.RetryCount, &e.FailedAt); err != nil {
+			continue
+		}
+		list.Enrollments = append(list.Enrollments, e)
+	}
+	return list, nil
+}
+
+// RetryFailedEnrollments puts failed enrollments back in the workflow: they run
+// the node that failed again the next time the automation runs, with the
+// error policy's retries starting over
+func (s *AutomationService) RetryFailedEnrollments(ctx context.Context, orgID int64, automationUUID string, req *model.RetryEnrollmentsRequest) (*model.RetryEnrollmentsResult, error) {
+	if !req.All && len(req.EnrollmentUUIDs) == 0 {
+		return nil, fmt.Errorf("enrollmentUuids or all is required")
+	}
+	if len(req.EnrollmentUUIDs) > maxEnrollContacts {
+		return nil, fmt.Errorf("at most %d enrollments can be retried at once", maxEnrollContacts)
+	}
+	automationID, err := s.automationID(ctx, orgID, automationUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE automation_enrollments
+		SET status = 'active', error_message = NULL, retry_count = 0, next_run_at = NULL, updated_at = NOW()
+		WHERE automation_id = $1 AND status IN ('error', 'paused') AND ($2 OR uuid::text = ANY($3))
+	`, automationID, req.All, pq.Array(req.EnrollmentUUIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to retry enrollments: %w", err)
+	}
+	retried, _ := result.RowsAffected()
+	return &model.RetryEnrollmentsResult{Retried: int(retried)}, nil
+}
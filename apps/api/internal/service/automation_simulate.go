@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/segment"
+	"github.com/dublyo/mailat/api/pkg/sendwindow"
+	"github.com/dublyo/mailat/api/pkg/workflow"
+)
+
+// Simulation outcomes
+const (
+	SimulationCompleted = "completed" // The contact got to the end of the workflow
+	SimulationError     = "error"     // A node would fail
+	SimulationOptedOut  = "opted_out" // The contact wouldn't be enrolled
+	SimulationMaxSteps  = "max_steps" // The path is longer than a contact goes through at once, the workflow may loop
+)
+
+// SimulateAutomation walks a contact through an automation's workflow the way
+// the automation runner would, without sending anything or changing the
+// contact: conditions are tested against the contact as it is now, delays are
+// added up instead of waited out, from now and in the contact's timezone, and
+// actions only say what they would do
+func (s *AutomationService) SimulateAutomation(ctx context.Context, orgID int64, automationUUID string, req *model.SimulateAutomationRequest) (*model.AutomationSimulation, error) {
+	var automationID int64
+	var workflowJSON []byte
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, COALESCE(workflow, '{}') FROM automations WHERE uuid = $1 AND org_id = $2
+	`, automationUUID, orgID).Scan(&automationID, &workflowJSON)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("automation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get automation: %w", err)
+	}
+	if req.Workflow != nil {
+		workflowJSON, _ = json.Marshal(req.Workflow)
+	}
+	w, err := workflow.Parse(workflowJSON)
+	if err != nil {
+		return nil, err
+	}
+	node := w.Start()
+	if node == nil {
+		return nil, fmt.Errorf("workflow needs a trigger node")
+	}
+
+	var contactID int64
+	var enrollable bool
+	err = s.db.QueryRowContext(ctx, `
+		SELECT c.id, `+topicOptOutFilter("a", "c.id")+`
+		FROM contacts c, automations a
+		WHERE c.uuid::text = $1 AND c.org_id = $2 AND c.status IS DISTINCT FROM 'erased' AND a.id = $3
+	`, req.ContactUUID, orgID, automationID).Scan(&contactID, &enrollable)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("contact not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+
+	sim := &model.AutomationSimulation{ContactUUID: req.ContactUUID, Steps: []model.AutomationSimulationStep{}}
+	if !enrollable {
+		sim.Outcome = SimulationOptedOut
+		sim.Message = "the contact opted out of the automation's subscription topic"
+		return sim, nil
+	}
+
+	start := time.Now()
+	loc := sendwindow.ContactLocation(ctx, s.db, orgID, contactID)
+	var elapsed time.Duration
+	for steps := 0; node != nil; steps++ {
+		if steps == workflow.MaxSteps {
+			sim.Outcome = SimulationMaxSteps
+			sim.Message = fmt.Sprintf("the contact went through %d nodes without getting to the end", workflow.MaxSteps)
+			return sim, nil
+		}
+
+		step := model.AutomationSimulationStep{
+			NodeID:         node.ID,
+			NodeType:       node.Data.Type,
+			Label:          node.Data.Label,
+			ElapsedSeconds: int64(elapsed.Seconds()),
+		}
+		handle, wait, summary, err := s.simulateNode(ctx, automationID, contactID, node, start.Add(elapsed), loc)
+		step.Branch = handle
+		step.Summary = summary
+		step.WaitSeconds = int64(wait.Seconds())
+		if err != nil {
+			step.Error = err.Error()
+			sim.Steps = append(sim.Steps, step)
+			sim.Outcome = SimulationError
+			sim.Message = fmt.Sprintf("%s: %v", node.Name(), err)
+			return sim, nil
+		}
+		sim.Steps = append(sim.Steps, step)
+
+		elapsed += wait
+		node = w.Next(node.ID, handle)
+	}
+
+	sim.Outcome = SimulationCompleted
+	sim.DurationSeconds = int64(elapsed.Seconds())
+	return sim, nil
+}
+
+// simulateNode returns the edge the contact would leave a node by when they get
+// to it at a time, how long they would wait before the next node and what the
+// node would do
+func (s *AutomationService) simulateNode(ctx context.Context, automationID, contactID int64, node *workflow.Node, at time.Time, loc *time.Location) (string, time.Duration, string, error) {
+	switch node.Data.Type {
+	case workflow.NodeTrigger:
+		return "", 0, "Enters the workflow", nil
+	case workflow.NodeEmail:
+		email, err := node.Email()
+		if err != nil {
+			return "", 0, "", err
+		}
+		var name string
+		err = s.db.QueryRowContext(ctx, `
+			SELECT t.name FROM email_templates t JOIN automations a ON a.org_id = t.org_id
+			WHERE a.id = $1 AND t.uuid::text = $2
+		`, automationID, email.TemplateID).Scan(&name)
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", 0, "", fmt.Errorf("template %s not found", email.TemplateID)
+		}
+		if err != nil {
+			return "", 0, "", err
+		}
+		return "", 0, fmt.Sprintf("Would send the template %q", name), nil
+	case workflow.NodeDelay:
+		delay, err := node.Delay()
+		if err != nil {
+			return "", 0, "", err
+		}
+		end := delay.End(at, loc)
+		if delay.Until != "" || delay.BusinessHours != nil {
+			return "", end.Sub(at), "Waits until " + end.In(loc).Format("Mon Jan 2 15:04 MST"), nil
+		}
+		return "", end.Sub(at), "Waits " + describeWait(end.Sub(at)), nil
+	case workflow.NodeCondition:
+		rules, err := node.Rules()
+		if err != nil {
+			return "", 0, "", err
+		}
+		matches, err := segment.Matches(ctx, s.db, automationID, contactID, rules)
+		if err != nil {
+			return "", 0, "", err
+		}
+		if matches {
+			return workflow.HandleYes, 0, "Matches the condition", nil
+		}
+		return workflow.HandleNo, 0, "Doesn't match the condition", nil
+	case workflow.NodeAction:
+		action, err := node.Action()
+		if err != nil {
+			return "", 0, "", err
+		}
+		return "", 0, describeAction(action), nil
+	}
+	return "", 0, "", fmt.Errorf("%s nodes can't be run", node.Data.Type)
+}
+
+// describeAction says what an action node would do to the contact
+func describeAction(a *workflow.Action) string {
+	switch a.Type {
+	case workflow.ActionAddTag:
+		return fmt.Sprintf("Would add the tag %q", a.Tag)
+	case workflow.ActionRemoveTag:
+		return fmt.Sprintf("Would remove the tag %q", a.Tag)
+	case workflow.ActionAddToList:
+		return fmt.Sprintf("Would add the contact to list %s", a.ListID)
+	case workflow.ActionRemoveFromList:
+		return fmt.Sprintf("Would remove the contact from list %s", a.ListID)
+	case workflow.ActionMoveToList:
+		return fmt.Sprintf("Would move the contact from list %s to list %s", a.FromListID, a.ListID)
+	case workflow.ActionUpdateField:
+		if a.Value == nil {
+			return fmt.Sprintf("Would clear %s", a.Field)
+		}
+		return fmt.Sprintf("Would set %s to %v", a.Field, a.Value)
+	case workflow.ActionWebhook:
+		return fmt.Sprintf("Would send a %s webhook to %s", a.Method, a.URL)
+	}
+	return ""
+}
+
+// describeWait writes a delay in the largest whole unit it's a number of
+func describeWait(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour && d%(24*time.Hour) == 0:
+		return plural(int(d/(24*time.Hour)), "day")
+	case d >= time.Hour && d%time.Hour == 0:
+		return plural(int(d/time.Hour), "hour")
+	case d%time.Minute == 0:
+		return plural(int(d/time.Minute), "minute")
+	}
+	return d.String()
+}
+
+func plural(n int, unit string) string {
+	if n == 1 {
+		return "1 " + unit
+	}
+	return fmt.Sprintf("%d %ss", n, unit)
+}
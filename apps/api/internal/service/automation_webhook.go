@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+	"github.com/dublyo/mailat/api/pkg/contactchange"
+)
+
+// webhookTrigger fills in where webhook automations are triggered and the
+// secret their requests are signed with
+func (s *AutomationService) webhookTrigger(a *model.Automation, secret sql.NullString) {
+	if a.TriggerType != automationtrigger.Webhook {
+		return
+	}
+	a.TriggerURL = fmt.Sprintf("%s/api/v1/automations/%s/trigger", strings.TrimRight(s.cfg.APIUrl, "/"), a.UUID)
+	a.WebhookSecret = secret.String
+}
+
+// RotateTriggerSecret gives a webhook automation a new secret. Requests signed
+// with the old one are refused from then on.
+func (s *AutomationService) RotateTriggerSecret(ctx context.Context, orgID int64, automationUUID string) (*model.Automation, error) {
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE automations SET webhook_secret = $3, updated_at = NOW()
+		WHERE uuid = $1 AND org_id = $2 AND trigger_type = $4
+	`, automationUUID, orgID, generateWebhookSecret(), automationtrigger.Webhook)
+	if err != nil {
+		return nil, fmt.Errorf("failed to rotate secret: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, fmt.Errorf("webhook automation not found")
+	}
+	return s.GetAutomation(ctx, orgID, automationUUID)
+}
+
+// TriggerWebhook enrolls the contact of a request posted to a webhook
+// automation's trigger URL. The request is signed with the automation's
+// secret; the trigger's config finds the contact by the email in the payload,
+// creating them if it says so, and sets their fields from the payload. The
+// payload is the enrollment's trigger data, which the workflow's emails and
+// webhooks can use.
+func (s *AutomationService) TriggerWebhook(ctx context.Context, automationUUID, timestamp, signature string, body []byte) (*model.AutomationTriggerResult, error) {
+	if len(body) > automationtrigger.MaxPayloadSize {
+		return nil, apierror.Newf(http.StatusRequestEntityTooLarge, apierror.CodeInvalidRequest, "the payload can't be larger than %d KB", automationtrigger.MaxPayloadSize>>10)
+	}
+
+	var automationID, orgID int64
+	var status, triggerType string
+	var configJSON []byte
+	var secret sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, org_id, status, trigger_type, COALESCE(trigger_config, '{}'), webhook_secret
+		FROM automations WHERE uuid::text = $1
+	`, automationUUID).Scan(&automationID, &orgID, &status, &triggerType, &configJSON, &secret)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && (triggerType != automationtrigger.Webhook || !secret.Valid)) {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "automation not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get automation: %w", err)
+	}
+	if !automationtrigger.Verify(secret.String, timestamp, signature, body, time.Now()) {
+		return nil, apierror.New(http.StatusUnauthorized, apierror.CodeUnauthorized, "invalid or expired signature")
+	}
+	if status != "active" {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "automation is not active")
+	}
+
+	var payload map[string]any
+	if err := json.Unmarshal(body, &payload); err != nil || payload == nil {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "the payload must be a JSON object")
+	}
+	var config map[string]any
+	json.Unmarshal(configJSON, &config)
+	trigger, err := automationtrigger.ParseWebhook(config)
+	if err != nil {
+		return nil, err
+	}
+
+	email := strings.ToLower(automationtrigger.LookupString(payload, trigger.Email))
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeInvalidRequest, "the payload has no valid email at %s", trigger.Email)
+	}
+	firstName := automationtrigger.LookupString(payload, trigger.FirstName)
+	lastName := automationtrigger.LookupString(payload, trigger.LastName)
+	attributes := map[string]any{}
+	for key, path := range trigger.Attributes {
+		if value := automationtrigger.Lookup(payload, path); value != nil {
+			attributes[key] = value
+		}
+	}
+	if attributes, err = validateAttributes(ctx, s.db, orgID, attributes); err != nil {
+		return nil, err
+	}
+	attributesJSON, _ := json.Marshal(attributes)
+
+	result := &model.AutomationTriggerResult{}
+	contactID, err := s.triggerContact(ctx, orgID, automationUUID, email, firstName, lastName, attributesJSON, trigger.CreateContact, result)
+	if err != nil {
+		return nil, err
+	}
+
+	var enrolled int
+	err = s.db.QueryRowContext(ctx, `
+		WITH enrolled AS (
+			INSERT INTO automation_enrollments (automation_id, contact_id, org_id, status, step_index, step_data, enrolled_at, updated_at)
+			SELECT a.id, $2::bigint, a.org_id, 'active', 0, jsonb_build_object('trigger', $3::jsonb), NOW(), NOW()
+			FROM automations a
+			WHERE a.id = $1 AND `+automationtrigger.EnrollFilter("a", "$2::bigint")+`
+			`+automationtrigger.OnConflict+`
+			RETURNING 1
+		)
+		SELECT COUNT(*) FROM enrolled
+	`, automationID, contactID, string(body)).Scan(&enrolled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to enroll contact: %w", err)
+	}
+	if enrolled > 0 {
+		result.Enrolled = true
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE automations SET enrolled_count = enrolled_count + 1 WHERE id = $1
+		`, automationID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update enrollment count: %w", err)
+		}
+	}
+	return result, nil
+}
+
+// triggerContact finds the contact a webhook trigger enrolls, or creates them
+// when the trigger creates contacts, and sets the fields it maps. Changes to
+// existing contacts are recorded as made by the automation.
+func (s *AutomationService) triggerContact(ctx context.Context, orgID int64, automationUUID, email, firstName, lastName string, attributesJSON []byte, create bool, result *model.AutomationTriggerResult) (int64, error) {
+	var contactID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, uuid FROM contacts WHERE org_id = $1 AND email = $2 AND status IS DISTINCT FROM 'erased'
+	`, orgID, email).Scan(&contactID, &result.ContactUUID)
+	if errors.Is(err, sql.ErrNoRows) {
+		if !create {
+			return 0, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "contact not found")
+		}
+		err = s.db.QueryRowContext(ctx, `
+			INSERT INTO contacts (org_id, email, first_name, last_name, attributes, status, consent_source, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, $5, 'active', $6, NOW(), NOW())
+			RETURNING id, uuid
+		`, orgID, email, firstName, lastName, attributesJSON, "automation:"+automationUUID).Scan(&contactID, &result.ContactUUID)
+		if err != nil {
+			return 0, fmt.Errorf("failed to create contact: %w", err)
+		}
+		result.Created = true
+		return contactID, nil
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to find contact: %w", err)
+	}
+
+	if firstName == "" && lastName == "" && string(attributesJSON) == "{}" {
+		return contactID, nil
+	}
+	before, err := contactchange.Take(ctx, s.db, contactID)
+	if err != nil {
+		return 0, err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE contacts SET
+			first_name = COALESCE(NULLIF($2, ''), first_name),
+			last_name = COALESCE(NULLIF($3, ''), last_name),
+			attributes = COALESCE(attributes, '{}') || $4::jsonb,
+			updated_at = NOW()
+		WHERE id = $1
+	`, contactID, firstName, lastName, attributesJSON)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update contact: %w", err)
+	}
+	_, err = contactchange.Record(ctx, s.db, orgID, contactID, before, contactchange.Source{Source: "automation", SourceID: automationUUID})
+	return contactID, err
+}
@@ -0,0 +1,375 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/backup"
+)
+
+// Organizations can back up their contacts, lists and consent history to encrypted
+// archives in object storage, separately from the database backups. Restoring a
+// backup brings back the contacts and lists deleted since it was taken, together
+// with their list memberships and consent records. Rows that still exist are never
+// changed, so a restore only undoes deletions.
+
+// BackupService lists, requests and restores org backups
+type BackupService struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+// NewBackupService creates a new backup service
+func NewBackupService(db *sql.DB, cfg *config.Config) *BackupService {
+	return &BackupService{db: db, cfg: cfg}
+}
+
+const orgBackupColumns = `
+	uuid, trigger, status, COALESCE(size, 0), COALESCE(checksum, ''),
+	COALESCE(contact_count, 0), COALESCE(list_count, 0), COALESCE(membership_count, 0), COALESCE(consent_count, 0),
+	COALESCE(error, ''), verified_at, completed_at, last_restored_at, created_at`
+
+func scanOrgBackup(row interface{ Scan(...any) error }) (*model.OrgBackup, error) {
+	var b model.OrgBackup
+	var verifiedAt, completedAt, lastRestoredAt sql.NullTime
+	err := row.Scan(&b.ID, &b.Trigger, &b.Status, &b.Size, &b.Checksum,
+		&b.ContactCount, &b.ListCount, &b.MembershipCount, &b.ConsentCount,
+		&b.Error, &verifiedAt, &completedAt, &lastRestoredAt, &b.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if verifiedAt.Valid {
+		b.VerifiedAt = &verifiedAt.Time
+	}
+	if completedAt.Valid {
+		b.CompletedAt = &completedAt.Time
+	}
+	if lastRestoredAt.Valid {
+		b.LastRestoredAt = &lastRestoredAt.Time
+	}
+	return &b, nil
+}
+
+// List returns the organization's most recent backups
+func (s *BackupService) List(ctx context.Context, orgID int64) ([]*model.OrgBackup, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+orgBackupColumns+`
+		FROM org_backups WHERE org_id = $1
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	defer rows.Close()
+
+	backups := []*model.OrgBackup{}
+	for rows.Next() {
+		b, err := scanOrgBackup(rows)
+		if err != nil {
+			continue
+		}
+		backups = append(backups, b)
+	}
+	return backups, nil
+}
+
+// Get returns a backup by UUID
+func (s *BackupService) Get(ctx context.Context, orgID int64, backupUUID string) (*model.OrgBackup, error) {
+	b, err := scanOrgBackup(s.db.QueryRowContext(ctx, `
+		SELECT `+orgBackupColumns+`
+		FROM org_backups WHERE uuid = $1 AND org_id = $2
+	`, backupUUID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("backup not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup: %w", err)
+	}
+	return b, nil
+}
+
+// Create queues an on-demand backup
+func (s *BackupService) Create(ctx context.Context, orgID int64) (*model.OrgBackup, error) {
+	if s.cfg.BackupsBucket == "" || worker.BackupKey(s.cfg) == "" {
+		return nil, fmt.Errorf("backup storage is not configured")
+	}
+
+	var inProgress bool
+	s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM org_backups WHERE org_id = $1 AND status IN ($2, $3))
+	`, orgID, worker.BackupStatusPending, worker.BackupStatusRunning).Scan(&inProgress)
+	if inProgress {
+		return nil, fmt.Errorf("a backup is already in progress")
+	}
+
+	var backupID int64
+	var backupUUID string
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO org_backups (org_id, trigger, status, created_at)
+		VALUES ($1, $2, $3, NOW())
+		RETURNING id, uuid
+	`, orgID, worker.BackupTriggerManual, worker.BackupStatusPending).Scan(&backupID, &backupUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create backup: %w", err)
+	}
+
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		s.markBackupFailed(ctx, backupID, err)
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	if _, err := queueClient.EnqueueBackupRun(&worker.BackupRunPayload{BackupID: backupID, OrgID: orgID}); err != nil {
+		s.markBackupFailed(ctx, backupID, err)
+		return nil, fmt.Errorf("failed to queue backup: %w", err)
+	}
+
+	return s.Get(ctx, orgID, backupUUID)
+}
+
+func (s *BackupService) markBackupFailed(ctx context.Context, backupID int64, err error) {
+	s.db.ExecContext(ctx, `
+		UPDATE org_backups SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+	`, backupID, worker.BackupStatusFailed, err.Error())
+}
+
+// Restore brings back the contacts, lists, list memberships and consent records of a
+// backup that no longer exist. Contacts whose email has been added again since, and
+// contacts erased on request, are skipped. A dry run reports the same counts and
+// rolls everything back.
+func (s *BackupService) Restore(ctx context.Context, orgID int64, backupUUID string, req *model.RestoreBackupRequest) (*model.BackupRestoreResult, error) {
+	var backupID int64
+	var status, storageKey, checksum string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, status, COALESCE(storage_key, ''), COALESCE(checksum, '')
+		FROM org_backups WHERE uuid = $1 AND org_id = $2
+	`, backupUUID, orgID).Scan(&backupID, &status, &storageKey, &checksum)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("backup not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup: %w", err)
+	}
+	if status != worker.BackupStatusCompleted || storageKey == "" {
+		return nil, fmt.Errorf("only completed backups can be restored")
+	}
+
+	store, err := worker.OpenBackupStore(s.cfg)
+	if err != nil {
+		return nil, err
+	}
+	data, err := store.Get(ctx, storageKey)
+	if err != nil {
+		return nil, err
+	}
+	if backup.Checksum(data) != checksum {
+		return nil, fmt.Errorf("backup archive is corrupted: checksum does not match")
+	}
+	archive, err := backup.Open(data, worker.BackupKey(s.cfg))
+	if err != nil {
+		return nil, err
+	}
+	if archive.OrgID != orgID {
+		return nil, fmt.Errorf("backup belongs to another organization")
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result, err := restoreArchive(ctx, tx, orgID, archive)
+	if err != nil {
+		return nil, err
+	}
+	result.DryRun = req.DryRun
+	if req.DryRun {
+		return result, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE org_backups SET last_restored_at = NOW() WHERE id = $1
+	`, backupID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record restore: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to restore backup: %w", err)
+	}
+	return result, nil
+}
+
+// restoreArchive re-inserts the archived rows that are missing, under their original IDs
+func restoreArchive(ctx context.Context, tx *sql.Tx, orgID int64, archive *backup.Archive) (*model.BackupRestoreResult, error) {
+	result := &model.BackupRestoreResult{}
+
+	existingLists := map[int]bool{}
+	rows, err := tx.QueryContext(ctx, `SELECT id FROM lists WHERE org_id = $1`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load lists: %w", err)
+	}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err == nil {
+			existingLists[id] = true
+		}
+	}
+	rows.Close()
+
+	existingContacts := map[int64]bool{}
+	existingEmails := map[string]bool{}
+	rows, err = tx.QueryContext(ctx, `SELECT id, LOWER(email) FROM contacts WHERE org_id = $1`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load contacts: %w", err)
+	}
+	for rows.Next() {
+		var id int64
+		var email string
+		if err := rows.Scan(&id, &email); err == nil {
+			existingContacts[id] = true
+			existingEmails[email] = true
+		}
+	}
+	rows.Close()
+
+	erased := map[string]bool{}
+	rows, err = tx.QueryContext(ctx, `
+		SELECT LOWER(email) FROM suppressions WHERE org_id = $1 AND reason = 'gdpr_erasure'
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load erased contacts: %w", err)
+	}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err == nil {
+			erased[email] = true
+		}
+	}
+	rows.Close()
+
+	restoredLists := map[int]bool{}
+	for _, l := range archive.Lists {
+		if existingLists[l.ID] {
+			continue
+		}
+		var segmentRules any
+		if len(l.SegmentRules) > 0 {
+			segmentRules = string(l.SegmentRules)
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO lists (id, uuid, org_id, name, description, type, segment_rules, contact_count, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), $6, $7, 0, $8, NOW())
+		`, l.ID, l.UUID, orgID, l.Name, l.Description, l.Type, segmentRules, l.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore list %s: %w", l.Name, err)
+		}
+		restoredLists[l.ID] = true
+		existingLists[l.ID] = true
+		result.Lists++
+	}
+
+	restoredContacts := map[int64]bool{}
+	for _, c := range archive.Contacts {
+		if existingContacts[c.ID] {
+			continue
+		}
+		email := strings.ToLower(c.Email)
+		if erased[email] {
+			result.SkippedErased++
+			continue
+		}
+		if existingEmails[email] {
+			result.SkippedExisting++
+			continue
+		}
+		attributes := string(c.Attributes)
+		if attributes == "" {
+			attributes = "{}"
+		}
+		_, err := tx.ExecContext(ctx, `
+			INSERT INTO contacts (id, uuid, org_id, email, first_name, last_name, attributes, status,
+				consent_source, consent_timestamp, consent_ip, consent_user_agent, last_engaged_at,
+				engagement_score, created_at, updated_at)
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7, $8,
+				NULLIF($9, ''), $10, NULLIF($11, ''), NULLIF($12, ''), $13, $14, $15, NOW())
+		`, c.ID, c.UUID, orgID, c.Email, c.FirstName, c.LastName, attributes, c.Status,
+			c.ConsentSource, c.ConsentTimestamp, c.ConsentIP, c.ConsentUserAgent, c.LastEngagedAt,
+			c.EngagementScore, c.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore contact %s: %w", c.Email, err)
+		}
+		restoredContacts[c.ID] = true
+		existingContacts[c.ID] = true
+		existingEmails[email] = true
+		result.Contacts++
+	}
+
+	// Memberships come back only for restored contacts or lists, so contacts taken
+	// off a list on purpose since the backup stay off it
+	touchedLists := map[int]bool{}
+	for _, m := range archive.Memberships {
+		if !restoredLists[m.ListID] && !restoredContacts[m.ContactID] {
+			continue
+		}
+		if !existingLists[m.ListID] || !existingContacts[m.ContactID] {
+			continue
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO list_contacts (list_id, contact_id, created_at)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (list_id, contact_id) DO NOTHING
+		`, m.ListID, m.ContactID, m.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore list membership: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Memberships++
+			touchedLists[m.ListID] = true
+		}
+	}
+
+	for _, r := range archive.Consent {
+		if !restoredContacts[r.ContactID] {
+			continue
+		}
+		res, err := tx.ExecContext(ctx, `
+			INSERT INTO consent_audit (id, contact_id, org_id, action, source, list_id, ip_address, user_agent, details, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10)
+			ON CONFLICT (id) DO NOTHING
+		`, r.ID, r.ContactID, orgID, r.Action, r.Source, r.ListID, r.IPAddress, r.UserAgent, r.Details, r.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore consent record: %w", err)
+		}
+		if n, _ := res.RowsAffected(); n > 0 {
+			result.Consent++
+		}
+	}
+
+	if len(touchedLists) > 0 {
+		listIDs := make([]int64, 0, len(touchedLists))
+		for id := range touchedLists {
+			listIDs = append(listIDs, int64(id))
+		}
+		_, err := tx.ExecContext(ctx, `
+			UPDATE lists SET contact_count = (
+				SELECT COUNT(*) FROM list_contacts WHERE list_id = lists.id
+			), updated_at = NOW()
+			WHERE id = ANY($1)
+		`, pq.Array(listIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to update list counts: %w", err)
+		}
+	}
+
+	return result, nil
+}
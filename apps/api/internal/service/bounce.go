@@ -0,0 +1,152 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/bounce"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+)
+
+// BounceService classifies provider bounce notifications and applies the
+// retry/suppression policy for each bounce class
+type BounceService struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+// NewBounceService creates a new bounce service
+func NewBounceService(db *sql.DB, cfg *config.Config) *BounceService {
+	return &BounceService{db: db, cfg: cfg}
+}
+
+// BouncedRecipient is the classification result for a single bounced address
+type BouncedRecipient struct {
+	Email      string       `json:"email"`
+	Class      bounce.Class `json:"class"`
+	Diagnostic string       `json:"diagnostic,omitempty"`
+	Suppressed bool         `json:"suppressed"`
+}
+
+// classSeverity orders classes so an email with several bounced recipients
+// records the most severe one
+var classSeverity = map[bounce.Class]int{
+	bounce.ClassUnknown:     0,
+	bounce.ClassSoft:        1,
+	bounce.ClassFullMailbox: 2,
+	bounce.ClassBlock:       3,
+	bounce.ClassReputation:  4,
+	bounce.ClassHard:        5,
+}
+
+// ProcessSESBounce classifies every recipient of an SES bounce notification, stores the
+// classification on the matching transactional email and suppresses recipients whose
+// class requires it
+func (s *BounceService) ProcessSESBounce(ctx context.Context, notification *model.SESNotification) ([]BouncedRecipient, error) {
+	if notification == nil || notification.Bounce == nil {
+		return nil, nil
+	}
+	b := notification.Bounce
+
+	var emailID, orgID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, org_id FROM transactional_emails WHERE provider_message_id = $1
+	`, notification.Mail.MessageId).Scan(&emailID, &orgID)
+	if err == sql.ErrNoRows {
+		emailID = 0
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to find bounced email: %w", err)
+	}
+
+	results := make([]BouncedRecipient, 0, len(b.BouncedRecipients))
+	emailClass := bounce.ClassUnknown
+	emailReason := b.BounceSubType
+	for _, recipient := range b.BouncedRecipients {
+		class := bounce.ClassifySES(b.BounceType, b.BounceSubType, recipient.Status, recipient.DiagnosticCode)
+		results = append(results, BouncedRecipient{
+			Email:      recipient.EmailAddress,
+			Class:      class,
+			Diagnostic: recipient.DiagnosticCode,
+		})
+		if classSeverity[class] >= classSeverity[emailClass] {
+			emailClass = class
+			if recipient.DiagnosticCode != "" {
+				emailReason = recipient.DiagnosticCode
+			}
+		}
+	}
+	if len(results) == 0 {
+		emailClass = bounce.ClassifySES(b.BounceType, b.BounceSubType, "", "")
+	}
+
+	// Emails sent outside the transactional API can't be tied to an org, so stop at classification
+	if emailID == 0 {
+		return results, nil
+	}
+
+	// Attribute the bounce to each bounced recipient
+	for _, result := range results {
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE transactional_email_recipients
+			SET status = 'bounced', bounced_at = NOW(), bounce_class = $3, bounce_reason = $4, updated_at = NOW()
+			WHERE email_id = $1 AND email = $2
+		`, emailID, strings.ToLower(result.Email), string(result.Class), result.Diagnostic)
+		if err != nil {
+			fmt.Printf("Warning: failed to record recipient bounce: %v\n", err)
+		}
+	}
+
+	bounceType := "soft"
+	if b.BounceType == "Permanent" {
+		bounceType = "hard"
+	}
+
+	// The email is only 'bounced' once every recipient has bounced
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE transactional_emails
+		SET status = CASE WHEN EXISTS (
+				SELECT 1 FROM transactional_email_recipients r WHERE r.email_id = $1 AND r.bounced_at IS NULL
+			) THEN status ELSE 'bounced' END,
+			bounced_at = NOW(), bounce_type = $2, bounce_class = $3, bounce_reason = $4, updated_at = NOW()
+		WHERE id = $1
+	`, emailID, bounceType, string(emailClass), emailReason)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update bounced email: %w", err)
+	}
+
+	details := fmt.Sprintf("Bounce [%s]: %s/%s", emailClass, b.BounceType, b.BounceSubType)
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO transactional_delivery_events (email_id, event_type, details)
+		VALUES ($1, 'bounced', $2)
+	`, emailID, details)
+	if err != nil {
+		fmt.Printf("Warning: failed to record bounce event: %v\n", err)
+	}
+
+	rules := emailaddr.LoadRules(ctx, s.db, orgID)
+	for i, result := range results {
+		if !bounce.PolicyFor(result.Class).Suppress {
+			continue
+		}
+		reason := result.Diagnostic
+		if reason == "" {
+			reason = fmt.Sprintf("%s bounce", result.Class)
+		}
+		_, err = s.db.ExecContext(ctx, `
+			INSERT INTO suppression_list (org_id, email, reason, source, normalized_email)
+			VALUES ($1, $2, $3, 'bounce', $4)
+			ON CONFLICT (org_id, email) DO NOTHING
+		`, orgID, strings.ToLower(result.Email), reason, emailaddr.Normalize(result.Email, rules))
+		if err != nil {
+			fmt.Printf("Warning: failed to add to suppression list: %v\n", err)
+			continue
+		}
+		results[i].Suppressed = true
+	}
+
+	return results, nil
+}
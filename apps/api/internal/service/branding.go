@@ -9,6 +9,7 @@ import (
 	"time"
 
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/pkg/templating"
 )
 
 // TenantBranding represents organization branding settings
@@ -93,6 +94,18 @@ func (s *BrandingService) Update(ctx context.Context, orgID int64, input *Update
 		return nil, fmt.Errorf("invalid accent color format (use #RRGGBB)")
 	}
 
+	// Header and footer are the built-in header and footer template partials
+	if input.EmailHeaderHTML != nil {
+		if _, err := templating.Parse(*input.EmailHeaderHTML); err != nil {
+			return nil, fmt.Errorf("invalid email header: %w", err)
+		}
+	}
+	if input.EmailFooterHTML != nil {
+		if _, err := templating.Parse(*input.EmailFooterHTML); err != nil {
+			return nil, fmt.Errorf("invalid email footer: %w", err)
+		}
+	}
+
 	// Validate custom domain if provided
 	if input.CustomDomain != nil && *input.CustomDomain != "" && !isValidDomain(*input.CustomDomain) {
 		return nil, fmt.Errorf("invalid custom domain format")
@@ -5,23 +5,46 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"net/http"
+	"strings"
 	"time"
 
+	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 
 	"github.com/dublyo/mailat/api/internal/config"
 	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+	"github.com/dublyo/mailat/api/pkg/sendwindow"
+	"github.com/dublyo/mailat/api/pkg/tracking"
+	"github.com/dublyo/mailat/api/pkg/utm"
 )
 
 type CampaignService struct {
 	db                    *sql.DB
 	cfg                   *config.Config
 	redis                 *redis.Client
+	queueClient           *worker.QueueClient
 	webhookTriggerService *WebhookTriggerService
+	transactionalService  *TransactionalService
+	tracker               *tracking.Tracker
 }
 
 func NewCampaignService(db *sql.DB, cfg *config.Config, redis *redis.Client) *CampaignService {
-	return &CampaignService{db: db, cfg: cfg, redis: redis}
+	// Campaigns are sent by the worker, which takes them from the task queue
+	queueClient, err := worker.NewQueueClient(cfg)
+	if err != nil {
+		fmt.Printf("Warning: failed to create queue client, campaigns can't be sent: %v\n", err)
+	}
+	return &CampaignService{
+		db:          db,
+		cfg:         cfg,
+		redis:       redis,
+		queueClient: queueClient,
+		tracker:     tracking.New(cfg.APIUrl, cfg.JWTSecret),
+	}
 }
 
 // SetWebhookTriggerService sets the webhook trigger service for firing trigger events
@@ -29,19 +52,34 @@ func (s *CampaignService) SetWebhookTriggerService(svc *WebhookTriggerService) {
 	s.webhookTriggerService = svc
 }
 
+// SetTransactionalService sets the service campaign test sends go out through
+func (s *CampaignService) SetTransactionalService(svc *TransactionalService) {
+	s.transactionalService = svc
+}
+
 // CreateCampaign creates a new email campaign
 func (s *CampaignService) CreateCampaign(ctx context.Context, orgID int64, req *model.CreateCampaignRequest) (*model.Campaign, error) {
-	// Verify list exists and belongs to org
-	var listName string
-	err := s.db.QueryRowContext(ctx,
-		"SELECT name FROM lists WHERE id = $1 AND org_id = $2",
-		req.ListID, orgID,
-	).Scan(&listName)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("list not found")
+	throttleJSON, err := throttleSettingsJSON(req.Throttle)
+	if err != nil {
+		return nil, err
 	}
+	sendTimeJSON, err := sendTimeSettingsJSON(req.SendTime)
 	if err != nil {
-		return nil, fmt.Errorf("failed to verify list: %w", err)
+		return nil, err
+	}
+	utmJSON, err := utmSettingsJSON(req.UTM)
+	if err != nil {
+		return nil, err
+	}
+
+	// Verify the lists exist and belong to org
+	listID, listName, audienceJSON, err := s.resolveAudience(ctx, orgID, req.ListID, req.Audience)
+	if err != nil {
+		return nil, err
+	}
+	suppressionJSON, err := s.resolveSuppression(ctx, orgID, req.Suppression)
+	if err != nil {
+		return nil, err
 	}
 
 	// Insert campaign
@@ -52,16 +90,18 @@ func (s *CampaignService) CreateCampaign(ctx context.Context, orgID int64, req *
 			from_name, from_email, reply_to, list_id, status,
 			total_recipients, sent_count, delivered_count, open_count, click_count,
 			bounce_count, unsubscribe_count, complaint_count,
-			is_ab_test, created_at, updated_at
+			is_ab_test, throttle_settings, ignore_sending_window, send_time_settings, audience, utm_settings,
+			suppression_settings, created_at, updated_at
 		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 'draft',
-			0, 0, 0, 0, 0, 0, 0, 0, false, NOW(), NOW())
+			0, 0, 0, 0, 0, 0, 0, 0, false, $11, $12, $13, $14, $15, $16, NOW(), NOW())
 		RETURNING id, uuid, org_id, name, subject, html_content, text_content, template_id,
 			from_name, from_email, reply_to, list_id, status, scheduled_at, started_at, completed_at,
 			total_recipients, sent_count, delivered_count, open_count, click_count,
-			bounce_count, unsubscribe_count, complaint_count, is_ab_test, created_at, updated_at
+			bounce_count, unsubscribe_count, complaint_count, is_ab_test, ignore_sending_window, created_at, updated_at
 	`,
 		orgID, req.Name, req.Subject, req.HTMLContent, req.TextContent, req.TemplateID,
-		req.FromName, req.FromEmail, req.ReplyTo, req.ListID,
+		req.FromName, req.FromEmail, req.ReplyTo, listID, throttleJSON, req.IgnoreSendWindow, sendTimeJSON, audienceJSON, utmJSON,
+		suppressionJSON,
 	).Scan(
 		&campaign.ID, &campaign.UUID, &campaign.OrgID, &campaign.Name, &campaign.Subject,
 		&campaign.HTMLContent, &campaign.TextContent, &campaign.TemplateID,
@@ -70,30 +110,52 @@ func (s *CampaignService) CreateCampaign(ctx context.Context, orgID int64, req *
 		&campaign.TotalRecipients, &campaign.SentCount, &campaign.DeliveredCount,
 		&campaign.OpenCount, &campaign.ClickCount, &campaign.BounceCount,
 		&campaign.UnsubscribeCount, &campaign.ComplaintCount, &campaign.IsAbTest,
-		&campaign.CreatedAt, &campaign.UpdatedAt,
+		&campaign.IgnoreSendWindow, &campaign.CreatedAt, &campaign.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create campaign: %w", err)
 	}
 
 	campaign.ListName = listName
+	if throttleJSON != nil {
+		campaign.Throttle = req.Throttle
+	}
+	if sendTimeJSON != nil {
+		campaign.SendTime = req.SendTime
+	}
+	if audienceJSON != nil {
+		campaign.Audience = &model.CampaignAudience{}
+		json.Unmarshal(audienceJSON, campaign.Audience)
+	}
+	if utmJSON != nil {
+		campaign.UTM = req.UTM
+	}
+	if suppressionJSON != nil {
+		campaign.Suppression = &model.CampaignSuppression{}
+		json.Unmarshal(suppressionJSON, campaign.Suppression)
+	}
 	return &campaign, nil
 }
 
 // GetCampaign retrieves a campaign by UUID
 func (s *CampaignService) GetCampaign(ctx context.Context, orgID int64, campaignUUID string) (*model.Campaign, error) {
 	var campaign model.Campaign
-	var abTestSettingsJSON []byte
+	var abTestSettingsJSON, resendSettingsJSON, throttleJSON, sendTimeJSON, audienceJSON, utmJSON, suppressionJSON []byte
+	var parentUUID sql.NullString
+	var scheduledLocal sql.NullTime
 
 	err := s.db.QueryRowContext(ctx, `
 		SELECT c.id, c.uuid, c.org_id, c.name, c.subject, c.html_content, c.text_content, c.template_id,
 			c.from_name, c.from_email, c.reply_to, c.list_id, COALESCE(l.name, 'Deleted List'),
 			c.status, c.scheduled_at, c.started_at, c.completed_at,
 			c.total_recipients, c.sent_count, c.delivered_count, c.open_count, c.click_count,
-			c.bounce_count, c.unsubscribe_count, c.complaint_count, c.is_ab_test, c.ab_test_settings,
-			c.created_at, c.updated_at
+			c.bounce_count, c.unsubscribe_count, c.complaint_count, c.failed_count, c.is_ab_test, c.ab_test_settings,
+			c.parent_campaign_id, p.uuid, c.resend_settings, c.throttle_settings,
+			COALESCE(c.ignore_sending_window, false), c.send_time_settings, c.audience, c.utm_settings,
+			c.suppression_settings, c.scheduled_local_at, c.content_snapshot_id, c.archived_at, c.created_at, c.updated_at
 		FROM campaigns c
 		LEFT JOIN lists l ON l.id = c.list_id
+		LEFT JOIN campaigns p ON p.id = c.parent_campaign_id
 		WHERE c.org_id = $1 AND c.uuid = $2
 	`, orgID, campaignUUID).Scan(
 		&campaign.ID, &campaign.UUID, &campaign.OrgID, &campaign.Name, &campaign.Subject,
@@ -102,8 +164,9 @@ func (s *CampaignService) GetCampaign(ctx context.Context, orgID int64, campaign
 		&campaign.Status, &campaign.ScheduledAt, &campaign.StartedAt, &campaign.CompletedAt,
 		&campaign.TotalRecipients, &campaign.SentCount, &campaign.DeliveredCount,
 		&campaign.OpenCount, &campaign.ClickCount, &campaign.BounceCount,
-		&campaign.UnsubscribeCount, &campaign.ComplaintCount, &campaign.IsAbTest, &abTestSettingsJSON,
-		&campaign.CreatedAt, &campaign.UpdatedAt,
+		&campaign.UnsubscribeCount, &campaign.ComplaintCount, &campaign.FailedCount, &campaign.IsAbTest, &abTestSettingsJSON,
+		&campaign.ParentCampaignID, &parentUUID, &resendSettingsJSON, &throttleJSON,
+		&campaign.IgnoreSendWindow, &sendTimeJSON, &audienceJSON, &utmJSON, &suppressionJSON, &scheduledLocal, &campaign.ContentSnapshotID, &campaign.ArchivedAt, &campaign.CreatedAt, &campaign.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("campaign not found")
@@ -115,17 +178,52 @@ func (s *CampaignService) GetCampaign(ctx context.Context, orgID int64, campaign
 	if len(abTestSettingsJSON) > 0 {
 		json.Unmarshal(abTestSettingsJSON, &campaign.AbTestSettings)
 	}
+	if len(resendSettingsJSON) > 0 {
+		campaign.ResendSettings = &model.CampaignResendSettings{}
+		json.Unmarshal(resendSettingsJSON, campaign.ResendSettings)
+	}
+	if len(throttleJSON) > 0 {
+		campaign.Throttle = &model.CampaignThrottle{}
+		json.Unmarshal(throttleJSON, campaign.Throttle)
+	}
+	if len(sendTimeJSON) > 0 {
+		campaign.SendTime = &model.CampaignSendTime{}
+		json.Unmarshal(sendTimeJSON, campaign.SendTime)
+	}
+	if len(audienceJSON) > 0 {
+		campaign.Audience = &model.CampaignAudience{}
+		json.Unmarshal(audienceJSON, campaign.Audience)
+	}
+	if len(utmJSON) > 0 {
+		campaign.UTM = &model.CampaignUTM{}
+		json.Unmarshal(utmJSON, campaign.UTM)
+	}
+	if len(suppressionJSON) > 0 {
+		campaign.Suppression = &model.CampaignSuppression{}
+		json.Unmarshal(suppressionJSON, campaign.Suppression)
+	}
+	campaign.ParentUUID = parentUUID.String
+	if scheduledLocal.Valid {
+		campaign.ScheduledLocal = scheduledLocal.Time.Format("2006-01-02T15:04:05")
+	}
 
 	return &campaign, nil
 }
 
-// ListCampaigns retrieves campaigns with pagination
-func (s *CampaignService) ListCampaigns(ctx context.Context, orgID int64, page, pageSize int, status string) (*model.CampaignListResponse, error) {
+// ListCampaigns retrieves campaigns with pagination. Archived campaigns are only
+// listed when asked for, and then on their own.
+func (s *CampaignService) ListCampaigns(ctx context.Context, orgID int64, page, pageSize int, status string, archived bool) (*model.CampaignListResponse, error) {
 	// Build query - use LEFT JOIN to include campaigns even if their list was deleted
 	baseQuery := "FROM campaigns c LEFT JOIN lists l ON l.id = c.list_id WHERE c.org_id = $1"
 	args := []interface{}{orgID}
 	argIndex := 2
 
+	if archived {
+		baseQuery += " AND c.archived_at IS NOT NULL"
+	} else {
+		baseQuery += " AND c.archived_at IS NULL"
+	}
+
 	if status != "" {
 		baseQuery += fmt.Sprintf(" AND c.status = $%d", argIndex)
 		args = append(args, status)
@@ -158,8 +256,8 @@ func (s *CampaignService) ListCampaigns(ctx context.Context, orgID int64, page,
 			c.from_name, c.from_email, c.reply_to, c.list_id, COALESCE(l.name, 'Deleted List'),
 			c.status, c.scheduled_at, c.started_at, c.completed_at,
 			c.total_recipients, c.sent_count, c.delivered_count, c.open_count, c.click_count,
-			c.bounce_count, c.unsubscribe_count, c.complaint_count, c.is_ab_test,
-			c.created_at, c.updated_at
+			c.bounce_count, c.unsubscribe_count, c.complaint_count, c.failed_count, c.is_ab_test,
+			c.parent_campaign_id, c.archived_at, c.created_at, c.updated_at
 		%s
 		ORDER BY c.created_at DESC
 		LIMIT $%d OFFSET $%d
@@ -182,8 +280,8 @@ func (s *CampaignService) ListCampaigns(ctx context.Context, orgID int64, page,
 			&c.Status, &c.ScheduledAt, &c.StartedAt, &c.CompletedAt,
 			&c.TotalRecipients, &c.SentCount, &c.DeliveredCount,
 			&c.OpenCount, &c.ClickCount, &c.BounceCount,
-			&c.UnsubscribeCount, &c.ComplaintCount, &c.IsAbTest,
-			&c.CreatedAt, &c.UpdatedAt,
+			&c.UnsubscribeCount, &c.ComplaintCount, &c.FailedCount, &c.IsAbTest,
+			&c.ParentCampaignID, &c.ArchivedAt, &c.CreatedAt, &c.UpdatedAt,
 		); err != nil {
 			continue
 		}
@@ -203,10 +301,11 @@ func (s *CampaignService) ListCampaigns(ctx context.Context, orgID int64, page,
 func (s *CampaignService) UpdateCampaign(ctx context.Context, orgID int64, campaignUUID string, req *model.UpdateCampaignRequest) (*model.Campaign, error) {
 	// Verify campaign exists and is in draft status
 	var currentStatus string
+	var listID int
 	err := s.db.QueryRowContext(ctx,
-		"SELECT status FROM campaigns WHERE org_id = $1 AND uuid = $2",
+		"SELECT status, list_id FROM campaigns WHERE org_id = $1 AND uuid = $2",
 		orgID, campaignUUID,
-	).Scan(&currentStatus)
+	).Scan(&currentStatus, &listID)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("campaign not found")
 	}
@@ -217,6 +316,49 @@ func (s *CampaignService) UpdateCampaign(ctx context.Context, orgID int64, campa
 		return nil, fmt.Errorf("can only update campaigns in draft or paused status")
 	}
 
+	// A throttle of 0 messages per hour clears the profile
+	var throttleJSON []byte
+	if req.Throttle != nil && req.Throttle.MessagesPerHour != 0 {
+		if throttleJSON, err = throttleSettingsJSON(req.Throttle); err != nil {
+			return nil, err
+		}
+	}
+	var utmJSON []byte
+	if req.UTM != nil {
+		if utmJSON, err = utmSettingsJSON(req.UTM); err != nil {
+			return nil, err
+		}
+	}
+	var suppressionJSON []byte
+	if req.Suppression != nil {
+		if suppressionJSON, err = s.resolveSuppression(ctx, orgID, req.Suppression); err != nil {
+			return nil, err
+		}
+	}
+
+	// A new list or audience replaces the campaign's audience as a whole. An
+	// audience of only exclusions keeps the campaign's list.
+	var audienceJSON []byte
+	audienceChanged := req.ListID != nil || req.Audience != nil
+	if audienceChanged {
+		if req.ListID != nil {
+			listID = *req.ListID
+		} else if len(req.Audience.ListIDs)+len(req.Audience.SegmentIDs) > 0 {
+			listID = 0
+		}
+		if listID, _, audienceJSON, err = s.resolveAudience(ctx, orgID, listID, req.Audience); err != nil {
+			return nil, err
+		}
+	}
+
+	// So does a send time window of 0 hours
+	var sendTimeJSON []byte
+	if req.SendTime != nil && req.SendTime.WindowHours != 0 {
+		if sendTimeJSON, err = sendTimeSettingsJSON(req.SendTime); err != nil {
+			return nil, err
+		}
+	}
+
 	// Build update query
 	_, err = s.db.ExecContext(ctx, `
 		UPDATE campaigns SET
@@ -227,10 +369,20 @@ func (s *CampaignService) UpdateCampaign(ctx context.Context, orgID int64, campa
 			from_name = COALESCE(NULLIF($5, ''), from_name),
 			from_email = COALESCE(NULLIF($6, ''), from_email),
 			reply_to = COALESCE(NULLIF($7, ''), reply_to),
+			throttle_settings = CASE WHEN $10 THEN $11::jsonb ELSE throttle_settings END,
+			ignore_sending_window = COALESCE($12, ignore_sending_window),
+			send_time_settings = CASE WHEN $13 THEN $14::jsonb ELSE send_time_settings END,
+			list_id = CASE WHEN $15 THEN $16 ELSE list_id END,
+			audience = CASE WHEN $15 THEN $17::jsonb ELSE audience END,
+			utm_settings = CASE WHEN $18 THEN $19::jsonb ELSE utm_settings END,
+			suppression_settings = CASE WHEN $20 THEN $21::jsonb ELSE suppression_settings END,
 			updated_at = NOW()
 		WHERE org_id = $8 AND uuid = $9
 	`, req.Name, req.Subject, req.HTMLContent, req.TextContent,
-		req.FromName, req.FromEmail, req.ReplyTo, orgID, campaignUUID)
+		req.FromName, req.FromEmail, req.ReplyTo, orgID, campaignUUID,
+		req.Throttle != nil, throttleJSON, req.IgnoreSendWindow, req.SendTime != nil, sendTimeJSON,
+		audienceChanged, listID, audienceJSON, req.UTM != nil, utmJSON,
+		req.Suppression != nil, suppressionJSON)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update campaign: %w", err)
 	}
@@ -267,15 +419,90 @@ func (s *CampaignService) DeleteCampaign(ctx context.Context, orgID int64, campa
 	return nil
 }
 
-// ScheduleCampaign schedules a campaign for future sending
+// SetCampaignArchived archives or unarchives a campaign. Campaigns that are
+// scheduled or sending can't be archived.
+func (s *CampaignService) SetCampaignArchived(ctx context.Context, orgID int64, campaignUUID string, archived bool) (*model.Campaign, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, err
+	}
+	if archived && (campaign.Status == "scheduled" || campaign.Status == "sending") {
+		return nil, fmt.Errorf("cannot archive a campaign that is %s", campaign.Status)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE campaigns SET
+			archived_at = CASE WHEN $3 THEN COALESCE(archived_at, NOW()) END,
+			updated_at = NOW()
+		WHERE org_id = $1 AND uuid = $2
+	`, orgID, campaignUUID, archived)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update campaign: %w", err)
+	}
+
+	return s.GetCampaign(ctx, orgID, campaignUUID)
+}
+
+// DuplicateCampaign copies a campaign's content, audience and send settings into
+// a new draft. A resend's copy goes to its list rather than the parent's
+// recipients.
+func (s *CampaignService) DuplicateCampaign(ctx context.Context, orgID int64, campaignUUID string, req *model.DuplicateCampaignRequest) (*model.Campaign, error) {
+	original, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, err
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		name = original.Name + " (copy)"
+	}
+
+	var copyUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO campaigns (
+			org_id, name, subject, html_content, text_content, template_id,
+			from_name, from_email, reply_to, list_id, status,
+			total_recipients, sent_count, delivered_count, open_count, click_count,
+			bounce_count, unsubscribe_count, complaint_count,
+			is_ab_test, ab_test_settings, throttle_settings, ignore_sending_window,
+			send_time_settings, audience, utm_settings, suppression_settings, created_at, updated_at
+		)
+		SELECT org_id, $3, subject, html_content, text_content, template_id,
+			from_name, from_email, reply_to, list_id, 'draft',
+			0, 0, 0, 0, 0, 0, 0, 0,
+			is_ab_test, ab_test_settings, throttle_settings, ignore_sending_window,
+			send_time_settings, audience, utm_settings, suppression_settings, NOW(), NOW()
+		FROM campaigns WHERE org_id = $1 AND uuid = $2
+		RETURNING uuid
+	`, orgID, original.UUID, name).Scan(&copyUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to duplicate campaign: %w", err)
+	}
+
+	return s.GetCampaign(ctx, orgID, copyUUID)
+}
+
+// ScheduleCampaign schedules a campaign for future sending. A campaign scheduled
+// for the recipients' local time starts when the first timezone reaches the time,
+// and its recipients wait until the time comes in theirs.
 func (s *CampaignService) ScheduleCampaign(ctx context.Context, orgID int64, campaignUUID string, req *model.ScheduleCampaignRequest) (*model.Campaign, error) {
-	// Parse scheduled time
-	scheduledAt, err := time.Parse(time.RFC3339, req.ScheduledAt)
+	scheduledAt, err := parseScheduledAt(req.ScheduledAt, req.Timezone)
 	if err != nil {
-		return nil, fmt.Errorf("invalid scheduledAt format, use RFC3339")
+		return nil, err
 	}
 
-	if scheduledAt.Before(time.Now()) {
+	// The local time is kept as a wall clock time, without a timezone
+	var scheduledLocal any
+	if req.RecipientLocalTime {
+		local := sendwindow.AtLocal(scheduledAt, time.UTC)
+		if !local.Add(sendwindow.LocalTimeLag).After(time.Now()) {
+			return nil, fmt.Errorf("scheduledAt has passed in every timezone")
+		}
+		scheduledLocal = local.Format("2006-01-02 15:04:05")
+		scheduledAt = local.Add(-sendwindow.LocalTimeLead)
+		if scheduledAt.Before(time.Now()) {
+			scheduledAt = time.Now()
+		}
+	} else if scheduledAt.Before(time.Now()) {
 		return nil, fmt.Errorf("scheduledAt must be in the future")
 	}
 
@@ -288,38 +515,54 @@ func (s *CampaignService) ScheduleCampaign(ctx context.Context, orgID int64, cam
 		return nil, fmt.Errorf("can only schedule campaigns in draft or paused status")
 	}
 
-	// Count recipients
-	var recipientCount int
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(DISTINCT c.id)
-		FROM contacts c
-		JOIN list_contacts lc ON lc.contact_id = c.id
-		WHERE lc.list_id = $1 AND c.status = 'active'
-		AND c.email NOT IN (SELECT email FROM suppressions WHERE org_id = $2)
-	`, campaign.ListID, orgID).Scan(&recipientCount)
-	if err != nil {
-		return nil, fmt.Errorf("failed to count recipients: %w", err)
+	if err := validateMergeTags(campaign); err != nil {
+		return nil, err
+	}
+	if req.RecipientLocalTime && campaign.SendTime != nil {
+		return nil, fmt.Errorf("recipientLocalTime can't be combined with send time optimization")
+	}
+	if req.RecipientLocalTime && campaign.Status == "paused" {
+		return nil, fmt.Errorf("a paused campaign's recipients are already set, it can't be rescheduled for their local time")
 	}
 
-	if recipientCount == 0 {
-		return nil, fmt.Errorf("no active recipients in list")
+	// A paused campaign carries on from its recipient snapshot, so its audience
+	// isn't counted again
+	recipientCount := campaign.TotalRecipients
+	if campaign.Status == "draft" {
+		if recipientCount, err = s.countRecipients(ctx, orgID, campaign); err != nil {
+			return nil, err
+		}
+		if recipientCount == 0 {
+			return nil, fmt.Errorf("no active recipients in audience")
+		}
 	}
 
 	// Update campaign
-	_, err = s.db.ExecContext(ctx, `
+	result, err := s.db.ExecContext(ctx, `
 		UPDATE campaigns SET
 			status = 'scheduled',
 			scheduled_at = $1,
-			total_recipients = $2,
+			scheduled_local_at = $6,
+			total_recipients = CASE WHEN snapshot_at IS NULL THEN $2 ELSE total_recipients END,
 			updated_at = NOW()
-		WHERE org_id = $3 AND uuid = $4
-	`, scheduledAt, recipientCount, orgID, campaignUUID)
+		WHERE org_id = $3 AND uuid = $4 AND status = $5
+	`, scheduledAt, recipientCount, orgID, campaignUUID, campaign.Status, scheduledLocal)
 	if err != nil {
 		return nil, fmt.Errorf("failed to schedule campaign: %w", err)
 	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("can only schedule campaigns in draft or paused status")
+	}
+	if err := s.snapshotContent(ctx, campaign.ID, "scheduled"); err != nil {
+		s.restoreCampaignStatus(ctx, campaign)
+		return nil, err
+	}
 
 	// Queue the campaign for processing at scheduled time
-	s.queueCampaignJob(ctx, campaign.ID, scheduledAt)
+	if err := s.queueCampaignJob(ctx, campaign, scheduledAt); err != nil {
+		s.restoreCampaignStatus(ctx, campaign)
+		return nil, fmt.Errorf("failed to queue campaign: %w", err)
+	}
 
 	return s.GetCampaign(ctx, orgID, campaignUUID)
 }
@@ -330,43 +573,54 @@ func (s *CampaignService) SendCampaignNow(ctx context.Context, orgID int64, camp
 	if err != nil {
 		return nil, err
 	}
-	if campaign.Status != "draft" && campaign.Status != "scheduled" && campaign.Status != "paused" {
+	if campaign.Status == "paused" {
+		return s.ResumeCampaign(ctx, orgID, campaignUUID)
+	}
+	if campaign.Status != "draft" && campaign.Status != "scheduled" {
 		return nil, fmt.Errorf("campaign is not in a sendable status")
 	}
 
+	if err := validateMergeTags(campaign); err != nil {
+		return nil, err
+	}
+
 	// Count recipients
-	var recipientCount int
-	err = s.db.QueryRowContext(ctx, `
-		SELECT COUNT(DISTINCT c.id)
-		FROM contacts c
-		JOIN list_contacts lc ON lc.contact_id = c.id
-		WHERE lc.list_id = $1 AND c.status = 'active'
-		AND c.email NOT IN (SELECT email FROM suppressions WHERE org_id = $2)
-	`, campaign.ListID, orgID).Scan(&recipientCount)
+	recipientCount, err := s.countRecipients(ctx, orgID, campaign)
 	if err != nil {
-		return nil, fmt.Errorf("failed to count recipients: %w", err)
+		return nil, err
 	}
 
 	if recipientCount == 0 {
 		return nil, fmt.Errorf("no active recipients in list")
 	}
 
-	// Update campaign status
+	// Update campaign status, unless a dispatcher or another request got to it first
 	now := time.Now()
-	_, err = s.db.ExecContext(ctx, `
+	result, err := s.db.ExecContext(ctx, `
 		UPDATE campaigns SET
 			status = 'sending',
 			started_at = $1,
+			scheduled_local_at = NULL,
 			total_recipients = $2,
 			updated_at = NOW()
-		WHERE org_id = $3 AND uuid = $4
-	`, now, recipientCount, orgID, campaignUUID)
+		WHERE org_id = $3 AND uuid = $4 AND status = $5
+	`, now, recipientCount, orgID, campaignUUID, campaign.Status)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start campaign: %w", err)
 	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("campaign is not in a sendable status")
+	}
+	if err := s.snapshotContent(ctx, campaign.ID, "sent"); err != nil {
+		s.restoreCampaignStatus(ctx, campaign)
+		return nil, err
+	}
 
 	// Queue the campaign for immediate processing
-	s.queueCampaignJob(ctx, campaign.ID, now)
+	if err := s.queueCampaignJob(ctx, campaign, now); err != nil {
+		s.restoreCampaignStatus(ctx, campaign)
+		return nil, fmt.Errorf("failed to queue campaign: %w", err)
+	}
 
 	// Fire webhook trigger
 	if s.webhookTriggerService != nil {
@@ -381,7 +635,8 @@ func (s *CampaignService) SendCampaignNow(ctx context.Context, orgID int64, camp
 	return s.GetCampaign(ctx, orgID, campaignUUID)
 }
 
-// PauseCampaign pauses a sending campaign
+// PauseCampaign pauses a sending campaign. The email being sent finishes, and the
+// rest of each batch goes back to pending for the campaign's resume.
 func (s *CampaignService) PauseCampaign(ctx context.Context, orgID int64, campaignUUID string) (*model.Campaign, error) {
 	result, err := s.db.ExecContext(ctx, `
 		UPDATE campaigns SET
@@ -401,7 +656,9 @@ func (s *CampaignService) PauseCampaign(ctx context.Context, orgID int64, campai
 	return s.GetCampaign(ctx, orgID, campaignUUID)
 }
 
-// ResumeCampaign resumes a paused campaign
+// ResumeCampaign resumes a paused campaign. Its new dispatcher run takes over
+// from any earlier one and carries on from the recipient snapshot, so recipients
+// already sent are never sent again and the counters carry on as they were.
 func (s *CampaignService) ResumeCampaign(ctx context.Context, orgID int64, campaignUUID string) (*model.Campaign, error) {
 	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
 	if err != nil {
@@ -411,37 +668,68 @@ func (s *CampaignService) ResumeCampaign(ctx context.Context, orgID int64, campa
 		return nil, fmt.Errorf("campaign is not paused")
 	}
 
-	_, err = s.db.ExecContext(ctx, `
+	// Only one of concurrent resumes gets to queue a run
+	result, err := s.db.ExecContext(ctx, `
 		UPDATE campaigns SET
 			status = 'sending',
+			started_at = COALESCE(started_at, NOW()),
 			updated_at = NOW()
-		WHERE org_id = $1 AND uuid = $2
+		WHERE org_id = $1 AND uuid = $2 AND status = 'paused'
 	`, orgID, campaignUUID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to resume campaign: %w", err)
 	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("campaign is not paused")
+	}
+	// Edits made while paused go out to the rest of the recipients
+	if err := s.snapshotContent(ctx, campaign.ID, "resumed"); err != nil {
+		s.restoreCampaignStatus(ctx, campaign)
+		return nil, err
+	}
 
 	// Re-queue for processing
-	s.queueCampaignJob(ctx, campaign.ID, time.Now())
+	if err := s.queueCampaignJob(ctx, campaign, time.Now()); err != nil {
+		s.restoreCampaignStatus(ctx, campaign)
+		return nil, fmt.Errorf("failed to queue campaign: %w", err)
+	}
 
 	return s.GetCampaign(ctx, orgID, campaignUUID)
 }
 
-// CancelCampaign cancels a scheduled or sending campaign
+// CancelCampaign cancels a scheduled or sending campaign. Recipients not yet
+// being sent to are cancelled with it; batches stop before their next send.
 func (s *CampaignService) CancelCampaign(ctx context.Context, orgID int64, campaignUUID string) (*model.Campaign, error) {
-	result, err := s.db.ExecContext(ctx, `
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel campaign: %w", err)
+	}
+	defer tx.Rollback()
+
+	var campaignID int
+	err = tx.QueryRowContext(ctx, `
 		UPDATE campaigns SET
 			status = 'cancelled',
 			updated_at = NOW()
 		WHERE org_id = $1 AND uuid = $2 AND status IN ('scheduled', 'sending', 'paused')
-	`, orgID, campaignUUID)
+		RETURNING id
+	`, orgID, campaignUUID).Scan(&campaignID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("campaign not found or cannot be cancelled")
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to cancel campaign: %w", err)
 	}
 
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return nil, fmt.Errorf("campaign not found or cannot be cancelled")
+	_, err = tx.ExecContext(ctx, `
+		UPDATE campaign_recipients SET status = 'cancelled', updated_at = NOW()
+		WHERE campaign_id = $1 AND status IN ('pending', 'queued')
+	`, campaignID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel campaign recipients: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to cancel campaign: %w", err)
 	}
 
 	return s.GetCampaign(ctx, orgID, campaignUUID)
@@ -467,62 +755,378 @@ func (s *CampaignService) GetCampaignStats(ctx context.Context, orgID int64, cam
 		stats.ComplaintRate = float64(campaign.ComplaintCount) / float64(campaign.SentCount) * 100
 	}
 
+	links, err := s.campaignLinkStats(ctx, campaign.ID, campaign.SentCount, 0)
+	if err != nil {
+		return nil, err
+	}
+	if len(links) > 0 {
+		stats.ClicksByLink = make(map[string]int, len(links))
+		for _, link := range links {
+			stats.ClicksByLink[link.URL] = link.Clicks
+		}
+	}
+
+	if err := s.conversionStats(ctx, campaign, stats); err != nil {
+		return nil, err
+	}
+
+	// A resend reports against the campaign it follows up on
+	if campaign.ParentUUID != "" {
+		if stats.ParentCampaign, err = s.GetCampaign(ctx, orgID, campaign.ParentUUID); err != nil {
+			return nil, err
+		}
+	}
+
+	// Roll resend results up into the parent so the combined reach is visible in one place
+	resends, err := s.listResends(ctx, orgID, campaign.ID)
+	if err != nil {
+		return nil, err
+	}
+	if len(resends) > 0 {
+		stats.Resends = resends
+		stats.CombinedSent = campaign.SentCount
+		stats.CombinedOpens = campaign.OpenCount
+		stats.CombinedClicks = campaign.ClickCount
+		for _, r := range resends {
+			stats.CombinedSent += r.SentCount
+			stats.CombinedOpens += r.OpenCount
+			stats.CombinedClicks += r.ClickCount
+		}
+	}
+
 	return stats, nil
 }
 
-// PreviewCampaign renders a campaign preview
-func (s *CampaignService) PreviewCampaign(ctx context.Context, orgID int64, campaignUUID string) (map[string]string, error) {
-	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+// ResendCampaign clones a sent campaign as a draft that targets only the recipients
+// who did not open (or click) within the given window after the original send
+func (s *CampaignService) ResendCampaign(ctx context.Context, orgID int64, campaignUUID string, req *model.ResendCampaignRequest) (*model.Campaign, error) {
+	parent, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+	if parent.Status != "sent" {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "can only resend campaigns that have finished sending")
+	}
+	if parent.ParentCampaignID != nil {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "cannot resend a campaign that is itself a resend")
+	}
+
+	criteria := req.Criteria
+	if criteria == "" {
+		criteria = "not_opened"
+	}
+	if criteria != "not_opened" && criteria != "not_clicked" {
+		return nil, fmt.Errorf("criteria must be one of: not_opened, not_clicked")
+	}
+	if req.WindowDays < 1 || req.WindowDays > 30 {
+		return nil, fmt.Errorf("windowDays must be between 1 and 30")
+	}
+
+	// The engagement window must have elapsed, otherwise late openers would be resent to
+	sentAt := parent.CreatedAt
+	if parent.StartedAt != nil {
+		sentAt = *parent.StartedAt
+	}
+	if eligibleAt := sentAt.AddDate(0, 0, req.WindowDays); time.Now().Before(eligibleAt) {
+		return nil, fmt.Errorf("resend window has not elapsed yet, available after %s", eligibleAt.UTC().Format(time.RFC3339))
+	}
+
+	// Guardrail: a campaign can only be resent once
+	var existing int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM campaigns
+		WHERE org_id = $1 AND parent_campaign_id = $2 AND status != 'cancelled'
+	`, orgID, parent.ID).Scan(&existing)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check existing resends: %w", err)
+	}
+	if existing > 0 {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "campaign has already been resent")
+	}
+
+	settings := &model.CampaignResendSettings{Criteria: criteria, WindowDays: req.WindowDays}
+	recipientCount, err := s.countResendRecipients(ctx, orgID, parent.ID, settings)
 	if err != nil {
 		return nil, err
 	}
+	if recipientCount == 0 {
+		return nil, fmt.Errorf("no eligible recipients for resend")
+	}
 
-	// TODO: Process template variables with sample data
-	return map[string]string{
-		"subject": campaign.Subject,
-		"html":    campaign.HTMLContent,
-		"text":    campaign.TextContent,
-	}, nil
+	name := req.Name
+	if name == "" {
+		name = parent.Name + " (resend)"
+	}
+	subject := req.Subject
+	if subject == "" {
+		subject = parent.Subject
+	}
+	settingsJSON, _ := json.Marshal(settings)
+
+	var childUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO campaigns (
+			org_id, name, subject, html_content, text_content, template_id,
+			from_name, from_email, reply_to, list_id, status,
+			total_recipients, sent_count, delivered_count, open_count, click_count,
+			bounce_count, unsubscribe_count, complaint_count,
+			is_ab_test, parent_campaign_id, resend_settings, ignore_sending_window, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, 'draft',
+			$11, 0, 0, 0, 0, 0, 0, 0, false, $12, $13, $14, NOW(), NOW())
+		RETURNING uuid
+	`,
+		orgID, name, subject, parent.HTMLContent, parent.TextContent, parent.TemplateID,
+		parent.FromName, parent.FromEmail, parent.ReplyTo, parent.ListID,
+		recipientCount, parent.ID, settingsJSON, parent.IgnoreSendWindow,
+	).Scan(&childUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create resend campaign: %w", err)
+	}
+
+	return s.GetCampaign(ctx, orgID, childUUID)
 }
 
-// SendTestEmail sends a test email for a campaign
-func (s *CampaignService) SendTestEmail(ctx context.Context, orgID int64, campaignUUID string, testEmail string) error {
-	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+// listResends returns the resend campaigns cloned from a parent campaign
+func (s *CampaignService) listResends(ctx context.Context, orgID int64, parentID int) ([]model.Campaign, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, uuid, name, subject, status, started_at, completed_at,
+			total_recipients, sent_count, delivered_count, open_count, click_count,
+			bounce_count, unsubscribe_count, complaint_count, created_at, updated_at
+		FROM campaigns
+		WHERE org_id = $1 AND parent_campaign_id = $2
+		ORDER BY created_at
+	`, orgID, parentID)
 	if err != nil {
-		return err
+		return nil, fmt.Errorf("failed to get resends: %w", err)
 	}
+	defer rows.Close()
 
-	// Queue a test email job
-	job := map[string]interface{}{
-		"type":       "campaign_test",
-		"campaignId": campaign.ID,
-		"testEmail":  testEmail,
-		"orgId":      orgID,
+	var resends []model.Campaign
+	for rows.Next() {
+		var c model.Campaign
+		if err := rows.Scan(
+			&c.ID, &c.UUID, &c.Name, &c.Subject, &c.Status, &c.StartedAt, &c.CompletedAt,
+			&c.TotalRecipients, &c.SentCount, &c.DeliveredCount, &c.OpenCount, &c.ClickCount,
+			&c.BounceCount, &c.UnsubscribeCount, &c.ComplaintCount, &c.CreatedAt, &c.UpdatedAt,
+		); err != nil {
+			continue
+		}
+		c.OrgID = orgID
+		c.ParentCampaignID = &parentID
+		resends = append(resends, c)
 	}
-	jobData, _ := json.Marshal(job)
 
-	s.redis.LPush(ctx, "email:test", jobData)
+	return resends, nil
+}
 
-	return nil
+// ResendUnopened creates a follow-up to a sent campaign for the recipients who
+// didn't open it within the given days
+func (s *CampaignService) ResendUnopened(ctx context.Context, orgID int64, campaignUUID string, req *model.ResendUnopenedRequest) (*model.Campaign, error) {
+	return s.ResendCampaign(ctx, orgID, campaignUUID, &model.ResendCampaignRequest{
+		Criteria:   "not_opened",
+		WindowDays: req.WindowDays,
+		Subject:    req.Subject,
+		Name:       req.Name,
+	})
 }
 
-// queueCampaignJob queues a campaign for processing
-func (s *CampaignService) queueCampaignJob(ctx context.Context, campaignID int, scheduledAt time.Time) {
-	job := map[string]interface{}{
-		"type":        "campaign_send",
-		"campaignId":  campaignID,
-		"scheduledAt": scheduledAt.Unix(),
+// countRecipients counts the active, unsuppressed recipients a campaign will send to
+func (s *CampaignService) countRecipients(ctx context.Context, orgID int64, campaign *model.Campaign) (int, error) {
+	if campaign.ParentCampaignID != nil && campaign.ResendSettings != nil {
+		return s.countResendRecipients(ctx, orgID, *campaign.ParentCampaignID, campaign.ResendSettings)
 	}
-	jobData, _ := json.Marshal(job)
 
-	// Use Redis sorted set for scheduled jobs
-	if scheduledAt.After(time.Now()) {
-		s.redis.ZAdd(ctx, "campaign:scheduled", redis.Z{
-			Score:  float64(scheduledAt.Unix()),
-			Member: jobData,
-		})
+	include, exclude := audienceLists(campaign)
+	capDays, segments, topic := suppressionRules(campaign)
+	suppressed, err := emailaddr.SuppressedContacts(ctx, s.db, orgID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recipients: %w", err)
+	}
+	var recipientCount int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*)
+		FROM contacts c
+		WHERE c.org_id = $2 AND `+worker.AudienceFilter("c", 1, 3)+`
+		AND c.status = 'active'
+		AND c.email NOT IN (SELECT email FROM suppressions WHERE org_id = $2)
+		AND c.id <> ALL($8)
+		AND `+worker.SuppressionFilter("c", 4, 5, 6, 7)+`
+	`, pq.Array(include), orgID, pq.Array(exclude),
+		pq.Array([]int64{int64(campaign.ID)}), capDays, pq.Array(segments), topic, pq.Array(suppressed)).Scan(&recipientCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recipients: %w", err)
+	}
+	return recipientCount, nil
+}
+
+// countResendRecipients counts parent campaign recipients that did not engage within
+// the resend window and have not already received a resend of that campaign
+func (s *CampaignService) countResendRecipients(ctx context.Context, orgID int64, parentID int, settings *model.CampaignResendSettings) (int, error) {
+	suppressed, err := emailaddr.SuppressedContacts(ctx, s.db, orgID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count recipients: %w", err)
+	}
+	var recipientCount int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT c.id)
+		FROM emails e
+		JOIN contacts c ON c.id = e.contact_id
+		WHERE e.campaign_id = $1 AND e.org_id = $2
+		AND e.status NOT IN ('bounced', 'failed')
+		AND c.status = 'active'
+		AND c.email NOT IN (SELECT email FROM suppressions WHERE org_id = $2)
+		AND c.id <> ALL($5)
+		AND NOT EXISTS (
+			SELECT 1 FROM delivery_events de
+			WHERE de.email_id = e.id AND de.event_type = ANY($3)
+			AND de.occurred_at <= COALESCE(e.sent_at, e.created_at) + make_interval(days => $4)
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM emails r
+			JOIN campaigns rc ON rc.id = r.campaign_id
+			WHERE rc.parent_campaign_id = $1 AND r.contact_id = c.id
+		)
+	`, parentID, orgID, pq.Array(worker.ResendExcludedEvents(settings.Criteria)), settings.WindowDays,
+		pq.Array(suppressed)).Scan(&recipientCount)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count resend recipients: %w", err)
+	}
+	return recipientCount, nil
+}
+
+// throttleSettingsJSON validates a campaign throttle profile and encodes it for storage.
+// A nil profile is stored as NULL.
+func throttleSettingsJSON(throttle *model.CampaignThrottle) ([]byte, error) {
+	if throttle == nil {
+		return nil, nil
+	}
+
+	maxPerHour := worker.RateLimit * 3600
+	if throttle.MessagesPerHour < 1 || throttle.MessagesPerHour > maxPerHour {
+		return nil, fmt.Errorf("throttle messagesPerHour must be between 1 and %d", maxPerHour)
+	}
+
+	switch throttle.Ramp {
+	case "", worker.ThrottleRampNone:
+		throttle.Ramp = worker.ThrottleRampNone
+		throttle.StartPerHour = 0
+		throttle.RampHours = 0
+	case worker.ThrottleRampLinear, worker.ThrottleRampExponential:
+		if throttle.StartPerHour < 1 || throttle.StartPerHour > throttle.MessagesPerHour {
+			return nil, fmt.Errorf("throttle startPerHour must be between 1 and messagesPerHour")
+		}
+		if throttle.RampHours < 1 || throttle.RampHours > 30*24 {
+			return nil, fmt.Errorf("throttle rampHours must be between 1 and 720")
+		}
+	default:
+		return nil, fmt.Errorf("throttle ramp must be %s, %s or %s",
+			worker.ThrottleRampNone, worker.ThrottleRampLinear, worker.ThrottleRampExponential)
+	}
+
+	data, err := json.Marshal(throttle)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode throttle: %w", err)
+	}
+	return data, nil
+}
+
+// sendTimeSettingsJSON validates a campaign's send time optimization and encodes
+// it for storage. A nil setting is stored as NULL.
+func sendTimeSettingsJSON(sendTime *model.CampaignSendTime) ([]byte, error) {
+	if sendTime == nil {
+		return nil, nil
+	}
+	if sendTime.WindowHours < 1 || sendTime.WindowHours > worker.SendTimeMaxWindowHours {
+		return nil, fmt.Errorf("sendTimeOptimization windowHours must be between 1 and %d", worker.SendTimeMaxWindowHours)
+	}
+
+	data, err := json.Marshal(sendTime)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode send time optimization: %w", err)
+	}
+	return data, nil
+}
+
+// utmSettingsJSON validates a campaign's UTM override and encodes it for storage.
+// A nil or empty override is stored as NULL.
+func utmSettingsJSON(override *model.CampaignUTM) ([]byte, error) {
+	o := utmOverride(override)
+	if o == nil || o.IsZero() {
+		return nil, nil
+	}
+	if err := o.Validate(); err != nil {
+		return nil, fmt.Errorf("utm %w", err)
+	}
+
+	data, err := json.Marshal(o)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode utm override: %w", err)
+	}
+	return data, nil
+}
+
+// parseScheduledAt parses an RFC3339 time, or a date and time without a UTC
+// offset in the timezone
+func parseScheduledAt(value, timezone string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	loc := time.UTC
+	if timezone != "" {
+		var err error
+		if loc, err = time.LoadLocation(timezone); err != nil {
+			return time.Time{}, fmt.Errorf("unknown timezone %q", timezone)
+		}
+	}
+	for _, layout := range []string{"2006-01-02T15:04:05", "2006-01-02T15:04"} {
+		if t, err := time.ParseInLocation(layout, value, loc); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("invalid scheduledAt format, use RFC3339 or a local date and time")
+}
+
+// utmOverride converts a campaign's UTM override for the utm package
+func utmOverride(override *model.CampaignUTM) *utm.Override {
+	if override == nil {
+		return nil
+	}
+	return &utm.Override{
+		Enabled:  override.Enabled,
+		Source:   strings.TrimSpace(override.Source),
+		Medium:   strings.TrimSpace(override.Medium),
+		Campaign: strings.TrimSpace(override.Campaign),
+		Content:  strings.TrimSpace(override.Content),
+	}
+}
+
+// queueCampaignJob starts a new dispatcher run of a campaign at the given time.
+// Recipients a paused run left queued go back to pending for it.
+func (s *CampaignService) queueCampaignJob(ctx context.Context, campaign *model.Campaign, at time.Time) error {
+	if s.queueClient == nil {
+		return fmt.Errorf("task queue is unavailable")
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE campaign_recipients SET status = 'pending', updated_at = NOW()
+		WHERE campaign_id = $1 AND status = 'queued'
+	`, campaign.ID)
+	if err != nil {
+		return err
+	}
+
+	payload := &worker.CampaignProcessPayload{CampaignID: campaign.ID, OrgID: campaign.OrgID}
+	if at.After(time.Now()) {
+		_, err = s.queueClient.EnqueueCampaignProcessScheduled(payload, at)
 	} else {
-		// Immediate processing
-		s.redis.LPush(ctx, "email:campaign", jobData)
+		_, err = s.queueClient.EnqueueCampaignProcess(payload)
 	}
+	return err
+}
+
+// restoreCampaignStatus puts back the status a campaign had before it failed to queue
+func (s *CampaignService) restoreCampaignStatus(ctx context.Context, campaign *model.Campaign) {
+	s.db.ExecContext(ctx, `
+		UPDATE campaigns SET status = $2, updated_at = NOW() WHERE id = $1
+	`, campaign.ID, campaign.Status)
 }
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+)
+
+// A campaign goes to its list, or to an audience of several lists and saved
+// segments less some excluded ones. Its list_id stays set to the first list or
+// segment of the audience, which is the list it shows as.
+
+// resolveAudience checks a campaign's list and audience against the org's lists.
+// It returns the campaign's list, the list's name and the audience to store, which
+// is nil when the campaign only targets its list.
+func (s *CampaignService) resolveAudience(ctx context.Context, orgID int64, listID int, audience *model.CampaignAudience) (int, string, []byte, error) {
+	if audience == nil || len(audience.ListIDs)+len(audience.SegmentIDs)+len(audience.ExcludeListIDs) == 0 {
+		if listID == 0 {
+			return 0, "", nil, fmt.Errorf("listId or an audience is required")
+		}
+		audience = nil
+	}
+
+	resolved := model.CampaignAudience{}
+	if listID != 0 {
+		resolved.ListIDs = append(resolved.ListIDs, listID)
+	}
+	if audience != nil {
+		resolved.ListIDs = appendUnique(resolved.ListIDs, audience.ListIDs...)
+		resolved.SegmentIDs = appendUnique(nil, audience.SegmentIDs...)
+		resolved.ExcludeListIDs = appendUnique(nil, audience.ExcludeListIDs...)
+	}
+	included := append(slices.Clone(resolved.ListIDs), resolved.SegmentIDs...)
+	if len(included) == 0 {
+		return 0, "", nil, fmt.Errorf("audience needs at least one list or segment")
+	}
+	for _, id := range resolved.ExcludeListIDs {
+		if slices.Contains(included, id) {
+			return 0, "", nil, fmt.Errorf("list %d can't be both targeted and excluded", id)
+		}
+	}
+
+	// Every list must be the org's, and segments must be dynamic lists
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, name, COALESCE(type, 'static') FROM lists WHERE org_id = $1 AND id = ANY($2)
+	`, orgID, pq.Array(append(slices.Clone(included), resolved.ExcludeListIDs...)))
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to verify lists: %w", err)
+	}
+	defer rows.Close()
+	names := map[int]string{}
+	types := map[int]string{}
+	for rows.Next() {
+		var id int
+		var name, listType string
+		if err := rows.Scan(&id, &name, &listType); err != nil {
+			return 0, "", nil, fmt.Errorf("failed to verify lists: %w", err)
+		}
+		names[id], types[id] = name, listType
+	}
+	for _, id := range append(slices.Clone(included), resolved.ExcludeListIDs...) {
+		if _, ok := names[id]; !ok {
+			return 0, "", nil, fmt.Errorf("list %d not found", id)
+		}
+	}
+	for _, id := range resolved.SegmentIDs {
+		if types[id] != "dynamic" {
+			return 0, "", nil, fmt.Errorf("list %d is not a segment", id)
+		}
+	}
+
+	primary := included[0]
+	if audience == nil {
+		return primary, names[primary], nil, nil
+	}
+	audienceJSON, err := json.Marshal(resolved)
+	if err != nil {
+		return 0, "", nil, fmt.Errorf("failed to encode audience: %w", err)
+	}
+	return primary, names[primary], audienceJSON, nil
+}
+
+// resolveSuppression checks a campaign's suppression settings against the org's
+// segments and topics and encodes them for storage. Nil or empty settings are
+// stored as NULL.
+func (s *CampaignService) resolveSuppression(ctx context.Context, orgID int64, suppression *model.CampaignSuppression) ([]byte, error) {
+	if suppression == nil || (suppression.FrequencyCapDays == 0 && len(suppression.SegmentIDs) == 0 && suppression.TopicID == 0) {
+		return nil, nil
+	}
+	if suppression.FrequencyCapDays < 0 || suppression.FrequencyCapDays > worker.FrequencyCapMaxDays {
+		return nil, fmt.Errorf("suppression frequencyCapDays must be between 0 and %d", worker.FrequencyCapMaxDays)
+	}
+
+	resolved := model.CampaignSuppression{
+		FrequencyCapDays: suppression.FrequencyCapDays,
+		SegmentIDs:       appendUnique(nil, suppression.SegmentIDs...),
+		TopicID:          suppression.TopicID,
+	}
+	if len(resolved.SegmentIDs) > 0 {
+		var found int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM lists WHERE org_id = $1 AND id = ANY($2) AND type = 'dynamic'
+		`, orgID, pq.Array(resolved.SegmentIDs)).Scan(&found)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify segments: %w", err)
+		}
+		if found != len(resolved.SegmentIDs) {
+			return nil, fmt.Errorf("suppression segments must be the org's segments")
+		}
+	}
+	if resolved.TopicID != 0 {
+		if err := checkTopic(ctx, s.db, orgID, resolved.TopicID); err != nil {
+			return nil, err
+		}
+	}
+
+	data, err := json.Marshal(resolved)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode suppression: %w", err)
+	}
+	return data, nil
+}
+
+// suppressionRules returns a campaign's frequency cap in days, 0 for none, its
+// suppression segments and its subscription topic, 0 for none
+func suppressionRules(campaign *model.Campaign) (capDays int, segments []int64, topic int) {
+	segments = []int64{}
+	if campaign.Suppression == nil {
+		return 0, segments, 0
+	}
+	for _, id := range campaign.Suppression.SegmentIDs {
+		segments = append(segments, int64(id))
+	}
+	return campaign.Suppression.FrequencyCapDays, segments, campaign.Suppression.TopicID
+}
+
+// appendUnique appends the values that aren't in the slice yet
+func appendUnique[T comparable](values []T, more ...T) []T {
+	for _, v := range more {
+		if !slices.Contains(values, v) {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// audienceLists returns the lists a campaign's recipients come from and the
+// lists whose contacts are left out
+func audienceLists(campaign *model.Campaign) (include, exclude []int64) {
+	if campaign.Audience == nil {
+		return []int64{int64(campaign.ListID)}, []int64{}
+	}
+	include, exclude = []int64{}, []int64{}
+	for _, id := range append(slices.Clone(campaign.Audience.ListIDs), campaign.Audience.SegmentIDs...) {
+		include = append(include, int64(id))
+	}
+	if len(include) == 0 {
+		include = append(include, int64(campaign.ListID))
+	}
+	for _, id := range campaign.Audience.ExcludeListIDs {
+		exclude = append(exclude, int64(id))
+	}
+	return include, exclude
+}
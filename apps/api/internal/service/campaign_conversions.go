@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/tracking"
+)
+
+// Conversions are reported by the org, from its backend through the API or by
+// loading the campaign's conversion pixel on its thank you page. A conversion
+// counts for the recipient of the campaign with the reported email, and an order
+// is counted once however often it's reported.
+
+// RecordConversion records a conversion of a campaign's recipient reported through the API
+func (s *CampaignService) RecordConversion(ctx context.Context, orgID int64, campaignUUID string, req *model.RecordConversionRequest) (*model.CampaignConversion, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+	return recordConversion(ctx, s.db, campaign.ID, req, "api")
+}
+
+// RecordPixelConversion records a conversion reported by a campaign's conversion
+// pixel. The pixel is loaded by the customer's browser, so failures aren't
+// reported back to it.
+func (s *TrackingService) RecordPixelConversion(ctx context.Context, token string, req *model.RecordConversionRequest) error {
+	data, err := s.tracker.Decode(token)
+	if err != nil || data.LinkID != tracking.ConversionLink || data.CampaignID == 0 {
+		return fmt.Errorf("invalid conversion token")
+	}
+	_, err = recordConversion(ctx, s.db, data.CampaignID, req, "pixel")
+	return err
+}
+
+// recordConversion attributes a conversion to the campaign's recipient with the
+// email. An order that was reported before returns the earlier conversion.
+func recordConversion(ctx context.Context, db *sql.DB, campaignID int, req *model.RecordConversionRequest, source string) (*model.CampaignConversion, error) {
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	currency := strings.ToUpper(strings.TrimSpace(req.Currency))
+	orderID := strings.TrimSpace(req.OrderID)
+	if req.Value < 0 {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "value can't be negative")
+	}
+	if currency != "" && !isCurrencyCode(currency) {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "currency must be a 3 letter ISO 4217 code")
+	}
+
+	var contactID int64
+	var emailID sql.NullInt64
+	err := db.QueryRowContext(ctx, `
+		SELECT contact_id, email_id FROM campaign_recipients
+		WHERE campaign_id = $1 AND LOWER(email) = $2 AND status = 'sent'
+		LIMIT 1
+	`, campaignID, email).Scan(&contactID, &emailID)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "the campaign wasn't sent to this email")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find campaign recipient: %w", err)
+	}
+
+	conversion := &model.CampaignConversion{
+		Email:    email,
+		Value:    req.Value,
+		Currency: currency,
+		OrderID:  orderID,
+		Source:   source,
+	}
+	err = db.QueryRowContext(ctx, `
+		INSERT INTO campaign_conversions (campaign_id, contact_id, email_id, value, currency, order_id, source)
+		VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), $7)
+		ON CONFLICT (campaign_id, order_id) DO NOTHING
+		RETURNING id, occurred_at
+	`, campaignID, contactID, emailID, req.Value, currency, orderID, source).Scan(&conversion.ID, &conversion.OccurredAt)
+	if err == nil {
+		return conversion, nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("failed to record conversion: %w", err)
+	}
+
+	// The order was reported before
+	var earlierCurrency sql.NullString
+	err = db.QueryRowContext(ctx, `
+		SELECT c.id, r.email, c.value, c.currency, c.source, c.occurred_at
+		FROM campaign_conversions c
+		JOIN campaign_recipients r ON r.campaign_id = c.campaign_id AND r.contact_id = c.contact_id
+		WHERE c.campaign_id = $1 AND c.order_id = $2
+	`, campaignID, orderID).Scan(&conversion.ID, &conversion.Email, &conversion.Value, &earlierCurrency,
+		&conversion.Source, &conversion.OccurredAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load conversion: %w", err)
+	}
+	conversion.Currency = earlierCurrency.String
+	conversion.Duplicate = true
+	return conversion, nil
+}
+
+func isCurrencyCode(code string) bool {
+	if len(code) != 3 {
+		return false
+	}
+	for _, c := range code {
+		if c < 'A' || c > 'Z' {
+			return false
+		}
+	}
+	return true
+}
+
+// conversionStats adds a campaign's conversions and revenue to its stats
+func (s *CampaignService) conversionStats(ctx context.Context, campaign *model.Campaign, stats *model.CampaignStatsResponse) error {
+	stats.ConversionPixel = s.tracker.ConversionURL(campaign.ID)
+
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT contact_id), COALESCE(SUM(value), 0)
+		FROM campaign_conversions WHERE campaign_id = $1
+	`, campaign.ID).Scan(&stats.Conversions, &stats.Converted, &stats.Revenue)
+	if err != nil {
+		return fmt.Errorf("failed to load conversions: %w", err)
+	}
+	if campaign.SentCount > 0 {
+		stats.ConversionRate = float64(stats.Converted) / float64(campaign.SentCount) * 100
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT currency, SUM(value) FROM campaign_conversions
+		WHERE campaign_id = $1 AND currency IS NOT NULL
+		GROUP BY currency
+	`, campaign.ID)
+	if err != nil {
+		return fmt.Errorf("failed to load conversion revenue: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var currency string
+		var revenue float64
+		if err := rows.Scan(&currency, &revenue); err != nil {
+			return fmt.Errorf("failed to scan conversion revenue: %w", err)
+		}
+		if stats.RevenueByCurrency == nil {
+			stats.RevenueByCurrency = map[string]float64{}
+		}
+		stats.RevenueByCurrency[currency] = revenue
+	}
+	return rows.Err()
+}
@@ -0,0 +1,80 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// campaignLinkStats returns the clicks on each link of a campaign, most clicked
+// first. A limit above 0 keeps only the top links.
+func (s *CampaignService) campaignLinkStats(ctx context.Context, campaignID, sentCount, limit int) ([]model.CampaignLinkStat, error) {
+	query := `
+		SELECT de.data->>'url' AS url, COUNT(*) AS clicks, COUNT(DISTINCT de.email_id),
+			MIN(de.occurred_at), MAX(de.occurred_at)
+		FROM delivery_events de
+		JOIN emails e ON e.id = de.email_id
+		WHERE e.campaign_id = $1 AND de.event_type = 'clicked'
+			AND COALESCE(de.data->>'url', '') <> ''
+		GROUP BY url
+		ORDER BY clicks DESC, url`
+	args := []any{campaignID}
+	if limit > 0 {
+		query += ` LIMIT $2`
+		args = append(args, limit)
+	}
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load link clicks: %w", err)
+	}
+	defer rows.Close()
+
+	links := []model.CampaignLinkStat{}
+	for rows.Next() {
+		var link model.CampaignLinkStat
+		if err := rows.Scan(&link.URL, &link.Clicks, &link.UniqueClicks, &link.FirstClickedAt, &link.LastClickedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan link clicks: %w", err)
+		}
+		link.Display = link.URL
+		if parsed, err := url.Parse(link.URL); err == nil && parsed.Host != "" {
+			link.Display = parsed.Host + parsed.Path
+		}
+		if sentCount > 0 {
+			link.UniqueClickRate = float64(link.UniqueClicks) / float64(sentCount) * 100
+		}
+		links = append(links, link)
+	}
+	return links, rows.Err()
+}
+
+// GetCampaignLinks reports the clicks of a campaign per link, with the total and
+// unique clicks of each. A limit above 0 keeps only the top clicked links.
+func (s *CampaignService) GetCampaignLinks(ctx context.Context, orgID int64, campaignUUID string, limit int) (*model.CampaignLinkReport, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+
+	links, err := s.campaignLinkStats(ctx, campaign.ID, campaign.SentCount, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &model.CampaignLinkReport{Links: links}
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COUNT(DISTINCT de.email_id)
+		FROM delivery_events de
+		JOIN emails e ON e.id = de.email_id
+		WHERE e.campaign_id = $1 AND de.event_type = 'clicked'
+			AND COALESCE(de.data->>'url', '') <> ''
+	`, campaign.ID).Scan(&report.TotalClicks, &report.UniqueClicks)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count link clicks: %w", err)
+	}
+	return report, nil
+}
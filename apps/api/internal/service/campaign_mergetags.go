@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/templating"
+)
+
+// campaignParts returns the parts of a campaign that take merge tags, keyed by
+// their field
+func campaignParts(subject, html, text string) [][2]string {
+	return [][2]string{{"subject", subject}, {"htmlContent", html}, {"textContent", text}}
+}
+
+// lintMergeTagSyntax reports the parts of a campaign whose merge tags don't
+// parse. Campaigns render without partials, so including one is an error too.
+func lintMergeTagSyntax(parts [][2]string) []model.CampaignLintIssue {
+	var issues []model.CampaignLintIssue
+	for _, part := range parts {
+		if _, err := templating.Parse(part[1]); err != nil {
+			issues = append(issues, model.CampaignLintIssue{Field: part[0], Message: err.Error()})
+			continue
+		}
+		for _, name := range templating.PartialNames(part[1]) {
+			issues = append(issues, model.CampaignLintIssue{
+				Field:   part[0],
+				Tag:     "> " + name,
+				Message: "campaigns can't include partials",
+			})
+		}
+	}
+	return issues
+}
+
+// validateMergeTags checks that a campaign renders before it is sent
+func validateMergeTags(campaign *model.Campaign) error {
+	issues := lintMergeTagSyntax(campaignParts(campaign.Subject, campaign.HTMLContent, campaign.TextContent))
+	if len(issues) == 0 {
+		return nil
+	}
+	fields := make([]apierror.FieldError, len(issues))
+	for i, issue := range issues {
+		fields[i] = apierror.FieldError{Field: issue.Field, Rule: "template", Message: issue.Message}
+	}
+	return &apierror.ValidationError{Fields: fields}
+}
+
+// audienceAttributeKeys returns the attribute keys the contacts of a campaign's
+// audience have
+func (s *CampaignService) audienceAttributeKeys(ctx context.Context, orgID int64, campaign *model.Campaign) (map[string]bool, error) {
+	include, exclude := audienceLists(campaign)
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT jsonb_object_keys(c.attributes)
+		FROM contacts c
+		WHERE c.org_id = $2 AND `+worker.AudienceFilter("c", 1, 3)+`
+		AND jsonb_typeof(c.attributes) = 'object'
+	`, pq.Array(include), orgID, pq.Array(exclude))
+	if err != nil {
+		return nil, fmt.Errorf("failed to load contact attributes: %w", err)
+	}
+	defer rows.Close()
+
+	keys := map[string]bool{}
+	for rows.Next() {
+		var key string
+		if rows.Scan(&key) == nil {
+			keys[key] = true
+		}
+	}
+	return keys, rows.Err()
+}
+
+// mergeTagKnown reports whether a tag's path is a contact field or an attribute
+// some contact of the audience has
+func mergeTagKnown(path string, attributeKeys map[string]bool) bool {
+	segments := strings.Split(path, ".")
+	if segments[0] == "attributes" {
+		return len(segments) == 1 || attributeKeys[segments[1]]
+	}
+	for _, field := range worker.CampaignContactFields {
+		if segments[0] == field {
+			return true
+		}
+	}
+	return attributeKeys[segments[0]]
+}
+
+// LintCampaign reports merge tags of a campaign that won't parse, and tags no
+// contact of its audience fills, so they can be fixed before it is scheduled
+func (s *CampaignService) LintCampaign(ctx context.Context, orgID int64, campaignUUID string, req *model.CampaignLintRequest) (*model.CampaignLintResponse, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+	subject, html, text := campaign.Subject, campaign.HTMLContent, campaign.TextContent
+	if req.Subject != "" {
+		subject = req.Subject
+	}
+	if req.HTMLContent != "" {
+		html = req.HTMLContent
+	}
+	if req.TextContent != "" {
+		text = req.TextContent
+	}
+
+	attributeKeys, err := s.audienceAttributeKeys(ctx, orgID, campaign)
+	if err != nil {
+		return nil, err
+	}
+
+	parts := campaignParts(subject, html, text)
+	result := &model.CampaignLintResponse{
+		Errors:      lintMergeTagSyntax(parts),
+		UnknownTags: []model.CampaignLintIssue{},
+	}
+	if result.Errors == nil {
+		result.Errors = []model.CampaignLintIssue{}
+	}
+	for _, part := range parts {
+		for _, path := range templating.Paths(part[1]) {
+			if !mergeTagKnown(path, attributeKeys) {
+				result.UnknownTags = append(result.UnknownTags, model.CampaignLintIssue{
+					Field:   part[0],
+					Tag:     path,
+					Message: fmt.Sprintf("{{%s}} isn't a contact field or an attribute of any contact in the audience", path),
+				})
+			}
+		}
+	}
+	result.Valid = len(result.Errors) == 0 && len(result.UnknownTags) == 0
+
+	result.AvailableTags = append([]string{}, worker.CampaignContactFields...)
+	keys := make([]string, 0, len(attributeKeys))
+	for key := range attributeKeys {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		result.AvailableTags = append(result.AvailableTags, "attributes."+key)
+	}
+	return result, nil
+}
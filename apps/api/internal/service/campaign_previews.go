@@ -0,0 +1,181 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/inboxpreview"
+)
+
+// Inbox previews are screenshots of a campaign in email clients, rendered by the
+// org's external preview service. The campaign is rendered without a contact, so
+// no contact data leaves the org, and each preview keeps a hash of what it was
+// rendered from to tell when the campaign has changed since.
+
+// previewContentHash identifies the rendered subject and HTML of a campaign
+func previewContentHash(rendered *model.CampaignPreviewResponse) string {
+	sum := sha256.Sum256([]byte(rendered.Subject + "\x00" + rendered.HTML))
+	return hex.EncodeToString(sum[:])
+}
+
+// RenderCampaignPreviews renders a campaign through the inbox preview service and
+// stores the preview of each client, replacing earlier ones
+func (s *CampaignService) RenderCampaignPreviews(ctx context.Context, orgID int64, campaignUUID string, req *model.RenderCampaignPreviewsRequest) (*model.CampaignInboxPreviewsResponse, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+	previewService := inboxpreview.Load(ctx, s.db, orgID)
+	if !previewService.Enabled() {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodePreviewUnavailable, "no inbox preview service is configured")
+	}
+
+	clients := appendUnique(nil, req.Clients...)
+	if len(clients) == 0 {
+		clients = previewService.DefaultClients()
+	}
+	if err := inboxpreview.ValidateClients(clients); err != nil {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, err.Error())
+	}
+
+	rendered, err := s.renderCampaign(ctx, campaign, nil)
+	if err != nil {
+		return nil, err
+	}
+	images, err := previewService.Render(ctx, inboxpreview.Request{
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+		Clients: clients,
+	})
+	if err != nil {
+		return nil, apierror.New(http.StatusBadGateway, apierror.CodePreviewUnavailable, err.Error())
+	}
+
+	hash := previewContentHash(rendered)
+	for _, client := range clients {
+		image := inboxpreview.Image{Client: client, Error: "the preview service returned no preview for this client"}
+		for _, candidate := range images {
+			if candidate.Client == client {
+				image = candidate
+				break
+			}
+		}
+		if err := s.storeCampaignPreview(ctx, campaign.ID, hash, image); err != nil {
+			return nil, err
+		}
+	}
+
+	return s.ListCampaignPreviews(ctx, orgID, campaignUUID)
+}
+
+// storeCampaignPreview stores the preview of one client. Inline images are kept
+// in the database; hosted ones are linked to.
+func (s *CampaignService) storeCampaignPreview(ctx context.Context, campaignID int, hash string, image inboxpreview.Image) error {
+	status, errText := "ready", image.Error
+	var data []byte
+	if errText == "" && image.Image != "" {
+		decoded, err := base64.StdEncoding.DecodeString(image.Image)
+		switch {
+		case err != nil:
+			errText = "the preview service sent an invalid image"
+		case len(decoded) > inboxpreview.MaxImageBytes:
+			errText = fmt.Sprintf("the preview image is over %d MB", inboxpreview.MaxImageBytes>>20)
+		default:
+			data = decoded
+		}
+	} else if errText == "" && image.ImageURL == "" {
+		errText = "the preview service sent no image"
+	}
+	contentType := image.ContentType
+	if contentType == "" {
+		contentType = "image/png"
+	}
+	if errText != "" {
+		status, data, image.ImageURL = "failed", nil, ""
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO campaign_previews (campaign_id, client, status, image_url, image_data, content_type, error, content_hash, rendered_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, NULLIF($7, ''), $8, NOW())
+		ON CONFLICT (campaign_id, client) DO UPDATE SET
+			status = EXCLUDED.status, image_url = EXCLUDED.image_url, image_data = EXCLUDED.image_data,
+			content_type = EXCLUDED.content_type, error = EXCLUDED.error,
+			content_hash = EXCLUDED.content_hash, rendered_at = EXCLUDED.rendered_at
+	`, campaignID, image.Client, status, image.ImageURL, data, contentType, errText, hash)
+	if err != nil {
+		return fmt.Errorf("failed to store inbox preview: %w", err)
+	}
+	return nil
+}
+
+// ListCampaignPreviews returns a campaign's inbox previews. Images stored inline
+// are linked to the preview image endpoint.
+func (s *CampaignService) ListCampaignPreviews(ctx context.Context, orgID int64, campaignUUID string) (*model.CampaignInboxPreviewsResponse, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+
+	// A campaign that no longer renders has nothing current to compare with
+	var currentHash string
+	if rendered, err := s.renderCampaign(ctx, campaign, nil); err == nil {
+		currentHash = previewContentHash(rendered)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT client, status, COALESCE(image_url, ''), image_data IS NOT NULL, COALESCE(error, ''), content_hash, rendered_at
+		FROM campaign_previews WHERE campaign_id = $1
+		ORDER BY client
+	`, campaign.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list inbox previews: %w", err)
+	}
+	defer rows.Close()
+
+	result := &model.CampaignInboxPreviewsResponse{
+		Configured: inboxpreview.Load(ctx, s.db, orgID).Enabled(),
+		Previews:   []model.CampaignInboxPreview{},
+	}
+	for rows.Next() {
+		var preview model.CampaignInboxPreview
+		var inline bool
+		var hash string
+		if err := rows.Scan(&preview.Client, &preview.Status, &preview.ImageURL, &inline, &preview.Error, &hash, &preview.RenderedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan inbox preview: %w", err)
+		}
+		if inline {
+			preview.ImageURL = fmt.Sprintf("/api/v1/campaigns/%s/previews/%s/image", campaign.UUID, preview.Client)
+		}
+		preview.Stale = hash != currentHash
+		result.Previews = append(result.Previews, preview)
+	}
+	return result, rows.Err()
+}
+
+// GetCampaignPreviewImage returns the image of a client's inbox preview: its data
+// when stored inline, otherwise the URL the preview service hosts it at
+func (s *CampaignService) GetCampaignPreviewImage(ctx context.Context, orgID int64, campaignUUID, client string) ([]byte, string, string, error) {
+	var data []byte
+	var contentType, imageURL string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT p.image_data, COALESCE(p.content_type, 'image/png'), COALESCE(p.image_url, '')
+		FROM campaign_previews p
+		JOIN campaigns c ON c.id = p.campaign_id
+		WHERE c.org_id = $1 AND c.uuid = $2 AND p.client = $3 AND p.status = 'ready'
+	`, orgID, campaignUUID, client).Scan(&data, &contentType, &imageURL)
+	if err == sql.ErrNoRows {
+		return nil, "", "", apierror.New(http.StatusNotFound, apierror.CodeNotFound, "inbox preview not found")
+	}
+	if err != nil {
+		return nil, "", "", fmt.Errorf("failed to get inbox preview: %w", err)
+	}
+	return data, contentType, imageURL, nil
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// CampaignRecipientStatuses are the activity statuses a campaign recipient can have
+var CampaignRecipientStatuses = []string{
+	"queued", "sent", "delivered", "opened", "clicked", "bounced", "unsubscribed", "failed", "skipped", "cancelled",
+}
+
+// maxRecipientExportRows bounds a recipient export
+const maxRecipientExportRows = 100000
+
+// campaignRecipientActivity reads each recipient of a campaign's snapshot with
+// its furthest step. Unsubscribes count when they came from the campaign's email.
+const campaignRecipientActivity = `
+	SELECT r.id, r.email, COALESCE(c.uuid::text, '') AS contact_uuid, r.sent_at, e.delivered_at,
+		COALESCE(e.open_count, 0) AS open_count, COALESCE(e.click_count, 0) AS click_count,
+		COALESCE(r.error, '') AS error,
+		CASE
+			WHEN r.status IN ('pending', 'queued', 'sending') THEN 'queued'
+			WHEN r.status <> 'sent' THEN r.status
+			WHEN e.status = 'bounced' OR EXISTS (
+				SELECT 1 FROM delivery_events de WHERE de.email_id = e.id AND de.event_type = 'bounced'
+			) THEN 'bounced'
+			WHEN EXISTS (
+				SELECT 1 FROM suppressions s
+				WHERE s.org_id = r.org_id AND s.reason = 'unsubscribe'
+				AND s.source_type = 'email' AND s.source_id = e.id::text
+			) THEN 'unsubscribed'
+			WHEN COALESCE(e.click_count, 0) > 0 THEN 'clicked'
+			WHEN COALESCE(e.open_count, 0) > 0 THEN 'opened'
+			WHEN e.delivered_at IS NOT NULL OR e.status = 'delivered' THEN 'delivered'
+			ELSE 'sent'
+		END AS status
+	FROM campaign_recipients r
+	LEFT JOIN emails e ON e.id = r.email_id
+	LEFT JOIN contacts c ON c.id = r.contact_id
+	WHERE r.campaign_id = $1`
+
+// ListCampaignRecipients returns the recipients of a campaign with what happened
+// to their email, so support can tell whether a contact got it. A page size
+// below 1 returns every matching recipient, for exports.
+func (s *CampaignService) ListCampaignRecipients(ctx context.Context, orgID int64, campaignUUID string, query *model.CampaignRecipientQuery) (*model.CampaignRecipientListResponse, error) {
+	if query.Status != "" && !slices.Contains(CampaignRecipientStatuses, query.Status) {
+		return nil, &apierror.ValidationError{Fields: []apierror.FieldError{{
+			Field:   "status",
+			Rule:    "in",
+			Message: "status must be one of: " + strings.Join(CampaignRecipientStatuses, ", "),
+		}}}
+	}
+
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+
+	result := &model.CampaignRecipientListResponse{
+		Recipients: []model.CampaignRecipientActivity{},
+		Counts:     map[string]int{},
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT status, COUNT(*) FROM (`+campaignRecipientActivity+`) a GROUP BY status
+	`, campaign.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count campaign recipients: %w", err)
+	}
+	for rows.Next() {
+		var status string
+		var count int
+		if rows.Scan(&status, &count) == nil {
+			result.Counts[status] = count
+		}
+	}
+	rows.Close()
+
+	filter := `WHERE ($2 = '' OR a.status = $2) AND ($3 = '' OR a.email ILIKE '%' || $3 || '%')`
+	args := []any{campaign.ID, query.Status, strings.TrimSpace(query.Email)}
+	if err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM (`+campaignRecipientActivity+`) a `+filter, args...,
+	).Scan(&result.Total); err != nil {
+		return nil, fmt.Errorf("failed to count campaign recipients: %w", err)
+	}
+
+	limit, offset := maxRecipientExportRows, 0
+	if query.PageSize > 0 {
+		result.Page, result.PageSize = max(query.Page, 1), min(query.PageSize, 100)
+		limit, offset = result.PageSize, (result.Page-1)*result.PageSize
+		result.TotalPages = (result.Total + result.PageSize - 1) / result.PageSize
+	}
+	rows, err = s.db.QueryContext(ctx, `
+		SELECT a.contact_uuid, a.email, a.status, a.sent_at, a.delivered_at, a.open_count, a.click_count, a.error
+		FROM (`+campaignRecipientActivity+`) a `+filter+`
+		ORDER BY a.id
+		LIMIT $4 OFFSET $5
+	`, append(args, limit, offset)...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaign recipients: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var r model.CampaignRecipientActivity
+		if err := rows.Scan(&r.ContactID, &r.Email, &r.Status, &r.SentAt, &r.DeliveredAt, &r.OpenCount, &r.ClickCount, &r.Error); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign recipient: %w", err)
+		}
+		result.Recipients = append(result.Recipients, r)
+	}
+	return result, rows.Err()
+}
+
+// CampaignRecipientsCSV renders a campaign's recipients as CSV records
+func CampaignRecipientsCSV(recipients []model.CampaignRecipientActivity) [][]string {
+	records := [][]string{{"email", "contact_id", "status", "sent_at", "delivered_at", "open_count", "click_count", "error"}}
+	formatTime := func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	}
+	for _, r := range recipients {
+		records = append(records, []string{
+			r.Email, r.ContactID, r.Status, formatTime(r.SentAt), formatTime(r.DeliveredAt),
+			strconv.Itoa(r.OpenCount), strconv.Itoa(r.ClickCount), r.Error,
+		})
+	}
+	return records
+}
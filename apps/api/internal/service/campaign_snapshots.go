@@ -0,0 +1,113 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// A campaign's content is snapshotted when it's scheduled, sent or resumed, and
+// the worker sends the latest snapshot rather than the campaign's live content.
+// Edits to the campaign or its template made later don't change what goes out,
+// and the snapshots stay for audits of what each campaign sent.
+
+// snapshotContent freezes the campaign's content as the content it sends. Content
+// that didn't change since the current snapshot keeps that snapshot.
+func (s *CampaignService) snapshotContent(ctx context.Context, campaignID int, reason string) error {
+	_, err := s.db.ExecContext(ctx, `
+		WITH content AS (
+			SELECT c.id, c.subject, c.html_content, c.text_content, c.from_name, c.from_email, c.reply_to,
+				c.template_id, t.name AS template_name, t.updated_at AS template_updated_at,
+				encode(sha256(convert_to(concat_ws(E'\n', c.subject, COALESCE(c.html_content, ''),
+					COALESCE(c.text_content, ''), c.from_name, c.from_email, COALESCE(c.reply_to, '')), 'UTF8')), 'hex') AS content_hash
+			FROM campaigns c
+			LEFT JOIN templates t ON t.id = c.template_id
+			WHERE c.id = $1
+		), snapshot AS (
+			INSERT INTO campaign_snapshots (
+				campaign_id, reason, subject, html_content, text_content, from_name, from_email, reply_to,
+				template_id, template_name, template_updated_at, content_hash
+			)
+			SELECT id, $2, subject, html_content, text_content, from_name, from_email, reply_to,
+				template_id, template_name, template_updated_at, content_hash
+			FROM content
+			WHERE NOT EXISTS (
+				SELECT 1 FROM campaigns c
+				JOIN campaign_snapshots cs ON cs.id = c.content_snapshot_id
+				WHERE c.id = $1 AND cs.content_hash = content.content_hash
+			)
+			RETURNING id
+		)
+		UPDATE campaigns SET content_snapshot_id = snapshot.id
+		FROM snapshot
+		WHERE campaigns.id = $1
+	`, campaignID, reason)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot campaign content: %w", err)
+	}
+	return nil
+}
+
+// ListCampaignSnapshots lists the content snapshots of a campaign, newest first,
+// without their content
+func (s *CampaignService) ListCampaignSnapshots(ctx context.Context, orgID int64, campaignUUID string) ([]model.CampaignSnapshot, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, reason, subject, from_name, from_email, COALESCE(reply_to, ''),
+			template_id, COALESCE(template_name, ''), template_updated_at, content_hash, created_at
+		FROM campaign_snapshots
+		WHERE campaign_id = $1
+		ORDER BY created_at DESC, id DESC
+	`, campaign.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list campaign snapshots: %w", err)
+	}
+	defer rows.Close()
+
+	snapshots := []model.CampaignSnapshot{}
+	for rows.Next() {
+		var snapshot model.CampaignSnapshot
+		if err := rows.Scan(&snapshot.ID, &snapshot.Reason, &snapshot.Subject, &snapshot.FromName, &snapshot.FromEmail,
+			&snapshot.ReplyTo, &snapshot.TemplateID, &snapshot.TemplateName, &snapshot.TemplateUpdatedAt,
+			&snapshot.ContentHash, &snapshot.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan campaign snapshot: %w", err)
+		}
+		snapshot.Current = campaign.ContentSnapshotID != nil && *campaign.ContentSnapshotID == snapshot.ID
+		snapshots = append(snapshots, snapshot)
+	}
+	return snapshots, rows.Err()
+}
+
+// GetCampaignSnapshot returns a content snapshot of a campaign with its content
+func (s *CampaignService) GetCampaignSnapshot(ctx context.Context, orgID int64, campaignUUID string, snapshotID int64) (*model.CampaignSnapshot, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+
+	var snapshot model.CampaignSnapshot
+	err = s.db.QueryRowContext(ctx, `
+		SELECT id, reason, subject, COALESCE(html_content, ''), COALESCE(text_content, ''), from_name, from_email,
+			COALESCE(reply_to, ''), template_id, COALESCE(template_name, ''), template_updated_at, content_hash, created_at
+		FROM campaign_snapshots
+		WHERE campaign_id = $1 AND id = $2
+	`, campaign.ID, snapshotID).Scan(&snapshot.ID, &snapshot.Reason, &snapshot.Subject, &snapshot.HTMLContent,
+		&snapshot.TextContent, &snapshot.FromName, &snapshot.FromEmail, &snapshot.ReplyTo, &snapshot.TemplateID,
+		&snapshot.TemplateName, &snapshot.TemplateUpdatedAt, &snapshot.ContentHash, &snapshot.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "snapshot not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign snapshot: %w", err)
+	}
+	snapshot.Current = campaign.ContentSnapshotID != nil && *campaign.ContentSnapshotID == snapshot.ID
+	return &snapshot, nil
+}
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/utm"
+)
+
+// Before a campaign goes out it can be previewed and sent as a test, rendered
+// for a sample contact the way the worker renders it for each recipient. Test
+// sends go through the transactional pipeline as test traffic, so they never
+// count toward the campaign's stats.
+
+// sampleContact is the contact a campaign preview is rendered for
+type sampleContact struct {
+	UUID       string
+	Email      string
+	FirstName  string
+	LastName   string
+	Attributes map[string]any
+}
+
+// loadSampleContact returns the contact with the given UUID, or the first active
+// contact of the campaign's audience when none is given. An audience without
+// contacts gives nil.
+func (s *CampaignService) loadSampleContact(ctx context.Context, orgID int64, campaign *model.Campaign, contactUUID string) (*sampleContact, error) {
+	var row *sql.Row
+	if contactUUID != "" {
+		row = s.db.QueryRowContext(ctx, `
+			SELECT uuid, email, COALESCE(first_name, ''), COALESCE(last_name, ''), attributes
+			FROM contacts WHERE org_id = $1 AND uuid = $2
+		`, orgID, contactUUID)
+	} else {
+		include, exclude := audienceLists(campaign)
+		row = s.db.QueryRowContext(ctx, `
+			SELECT c.uuid, c.email, COALESCE(c.first_name, ''), COALESCE(c.last_name, ''), c.attributes
+			FROM contacts c
+			WHERE c.org_id = $2 AND `+worker.AudienceFilter("c", 1, 3)+`
+			AND c.status = 'active'
+			ORDER BY c.id
+			LIMIT 1
+		`, pq.Array(include), orgID, pq.Array(exclude))
+	}
+
+	var contact sampleContact
+	var attributesJSON []byte
+	err := row.Scan(&contact.UUID, &contact.Email, &contact.FirstName, &contact.LastName, &attributesJSON)
+	if err == sql.ErrNoRows {
+		if contactUUID != "" {
+			return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "contact not found")
+		}
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load sample contact: %w", err)
+	}
+	if len(attributesJSON) > 0 {
+		json.Unmarshal(attributesJSON, &contact.Attributes)
+	}
+	return &contact, nil
+}
+
+// renderCampaign renders a campaign's subject and bodies for a contact, with its
+// links tagged like the worker tags them. Without a contact the merge tags render
+// their fallbacks, as for a contact without the values.
+func (s *CampaignService) renderCampaign(ctx context.Context, campaign *model.Campaign, contact *sampleContact) (*model.CampaignPreviewResponse, error) {
+	if err := validateMergeTags(campaign); err != nil {
+		return nil, err
+	}
+	if contact == nil {
+		contact = &sampleContact{}
+	}
+	vars := worker.CampaignMergeVariables(contact.Email, contact.FirstName, contact.LastName, contact.Attributes)
+	rendered, err := worker.RenderCampaignContent(ctx, vars, campaign.Subject, campaign.HTMLContent, campaign.TextContent)
+	if err != nil {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeTemplateInvalid, err.Error())
+	}
+
+	preview := &model.CampaignPreviewResponse{
+		Subject: rendered[0],
+		HTML:    utm.Load(ctx, s.db, campaign.OrgID).With(utmOverride(campaign.UTM)).Apply(rendered[1], campaign.Name),
+		Text:    rendered[2],
+	}
+	if contact.UUID != "" {
+		preview.Contact = &model.CampaignPreviewContact{
+			UUID:      contact.UUID,
+			Email:     contact.Email,
+			FirstName: contact.FirstName,
+			LastName:  contact.LastName,
+		}
+	}
+	return preview, nil
+}
+
+// PreviewCampaign renders a campaign for a sample contact
+func (s *CampaignService) PreviewCampaign(ctx context.Context, orgID int64, campaignUUID string, req *model.CampaignPreviewRequest) (*model.CampaignPreviewResponse, error) {
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+
+	contact, err := s.loadSampleContact(ctx, orgID, campaign, req.ContactID)
+	if err != nil {
+		return nil, err
+	}
+	return s.renderCampaign(ctx, campaign, contact)
+}
+
+// SendTestEmail renders a campaign for a sample contact and sends it to up to
+// five members of the org or allowlisted addresses as test traffic
+func (s *CampaignService) SendTestEmail(ctx context.Context, orgID, apiKeyID int64, campaignUUID string, req *model.CampaignTestSendRequest) (*model.SendEmailResponse, error) {
+	to := req.To
+	if req.Email != "" {
+		to = append(to, req.Email)
+	}
+	if len(to) == 0 {
+		return nil, &apierror.ValidationError{Fields: []apierror.FieldError{{
+			Field:   "to",
+			Rule:    "required",
+			Message: "a test send needs at least one recipient",
+		}}}
+	}
+	for i := range to {
+		to[i] = strings.TrimSpace(to[i])
+	}
+
+	campaign, err := s.GetCampaign(ctx, orgID, campaignUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+	if s.transactionalService == nil {
+		return nil, fmt.Errorf("test sends are unavailable")
+	}
+
+	contact, err := s.loadSampleContact(ctx, orgID, campaign, req.ContactID)
+	if err != nil {
+		return nil, err
+	}
+	rendered, err := s.renderCampaign(ctx, campaign, contact)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.transactionalService.sendTest(ctx, orgID, apiKeyID, &model.SendEmailRequest{
+		From:    campaign.FromEmail,
+		To:      to,
+		ReplyTo: campaign.ReplyTo,
+		Subject: rendered.Subject,
+		HTML:    rendered.HTML,
+		Text:    rendered.Text,
+	})
+}
@@ -11,24 +11,24 @@ import (
 	"strings"
 	"time"
 
-	"github.com/google/uuid"
+	"github.com/lib/pq"
 
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/listevent"
+	"github.com/dublyo/mailat/api/pkg/unsubscribe"
 )
 
 // ComplianceService handles GDPR/CAN-SPAM compliance features
 type ComplianceService struct {
-	db  *sql.DB
-	cfg *config.Config
+	db        *sql.DB
+	cfg       *config.Config
+	receiving *provider.ReceivingProvider
 }
 
 // UnsubscribeData contains encoded unsubscribe information
-type UnsubscribeData struct {
-	ContactID int64  `json:"c"`
-	OrgID     int64  `json:"o"`
-	ListID    int    `json:"l,omitempty"`
-	EmailID   int64  `json:"e,omitempty"`
-}
+type UnsubscribeData = unsubscribe.Data
 
 // ConsentRecord tracks consent changes for audit trail
 type ConsentRecord struct {
@@ -50,6 +50,9 @@ type PreferenceData struct {
 	Email          string   `json:"email"`
 	SubscribedLists []int   `json:"subscribedLists"`
 	AllLists       []ListInfo `json:"allLists"`
+	Status         string   `json:"status"`
+	Profile        []ProfileField `json:"profile"` // Fields the contact can edit
+	Topics         []model.ContactTopic `json:"topics"`
 }
 
 // ListInfo contains list information for preference center
@@ -96,14 +99,22 @@ func (s *ComplianceService) ProcessOneClickUnsubscribe(ctx context.Context, toke
 		return fmt.Errorf("invalid unsubscribe token")
 	}
 
-	// Update contact status
-	_, err = s.db.ExecContext(ctx, `
+	// Emails of a topic opt the contact out of that topic only
+	if topicName, ok := s.tokenTopic(ctx, data); ok {
+		return s.optOutOfTopic(ctx, data.OrgID, data.ContactID, data.TopicID, topicName, "one-click", ipAddress, userAgent)
+	}
+
+	// Update contact status, recording the churn on the contact's lists
+	result, err := s.db.ExecContext(ctx, `
 		UPDATE contacts SET status = 'unsubscribed', updated_at = NOW()
-		WHERE id = $1 AND org_id = $2
+		WHERE id = $1 AND org_id = $2 AND status IS DISTINCT FROM 'unsubscribed'
 	`, data.ContactID, data.OrgID)
 	if err != nil {
 		return fmt.Errorf("failed to unsubscribe: %w", err)
 	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		listevent.RecordMemberships(ctx, s.db, data.OrgID, data.ContactID, listevent.Unsubscribed, listevent.SourceEmail)
+	}
 
 	// Get email for suppression list
 	var email string
@@ -111,10 +122,10 @@ func (s *ComplianceService) ProcessOneClickUnsubscribe(ctx context.Context, toke
 
 	// Add to suppression list
 	s.db.ExecContext(ctx, `
-		INSERT INTO suppressions (org_id, email, reason, source_type, source_id, created_at)
-		VALUES ($1, $2, 'unsubscribe', 'email', $3, NOW())
+		INSERT INTO suppressions (org_id, email, reason, source_type, source_id, normalized_email, created_at)
+		VALUES ($1, $2, 'unsubscribe', 'email', $3, $4, NOW())
 		ON CONFLICT (org_id, email) DO NOTHING
-	`, data.OrgID, email, fmt.Sprintf("%d", data.EmailID))
+	`, data.OrgID, email, fmt.Sprintf("%d", data.EmailID), normalizedAddress(ctx, s.db, data.OrgID, email))
 
 	// Record consent change for audit trail
 	s.recordConsentChange(ctx, data.ContactID, data.OrgID, "unsubscribe", "one-click", nil, ipAddress, userAgent, "One-click unsubscribe from email")
@@ -141,29 +152,41 @@ func (s *ComplianceService) GetUnsubscribePage(ctx context.Context, token string
 		return nil, fmt.Errorf("contact not found")
 	}
 
-	return map[string]interface{}{
+	page := map[string]interface{}{
 		"email":     contact.Email,
 		"firstName": contact.FirstName,
 		"status":    contact.Status,
 		"token":     token,
-	}, nil
+	}
+	if topicName, ok := s.tokenTopic(ctx, data); ok {
+		page["topic"] = topicName
+	}
+	return page, nil
 }
 
-// ConfirmUnsubscribe handles confirmed unsubscribe from landing page
-func (s *ComplianceService) ConfirmUnsubscribe(ctx context.Context, token string, reason string, ipAddress string, userAgent string) error {
+// ConfirmUnsubscribe handles confirmed unsubscribe from landing page. Links
+// from emails of a topic opt out of the topic only, unless all is set.
+func (s *ComplianceService) ConfirmUnsubscribe(ctx context.Context, token string, reason string, all bool, ipAddress string, userAgent string) error {
 	data, err := s.decodeUnsubscribeData(token)
 	if err != nil {
 		return fmt.Errorf("invalid unsubscribe token")
 	}
 
-	// Update contact status
-	_, err = s.db.ExecContext(ctx, `
+	if topicName, ok := s.tokenTopic(ctx, data); ok && !all {
+		return s.optOutOfTopic(ctx, data.OrgID, data.ContactID, data.TopicID, topicName, "landing_page", ipAddress, userAgent)
+	}
+
+	// Update contact status, recording the churn on the contact's lists
+	result, err := s.db.ExecContext(ctx, `
 		UPDATE contacts SET status = 'unsubscribed', updated_at = NOW()
-		WHERE id = $1 AND org_id = $2
+		WHERE id = $1 AND org_id = $2 AND status IS DISTINCT FROM 'unsubscribed'
 	`, data.ContactID, data.OrgID)
 	if err != nil {
 		return fmt.Errorf("failed to unsubscribe: %w", err)
 	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		listevent.RecordMemberships(ctx, s.db, data.OrgID, data.ContactID, listevent.Unsubscribed, listevent.SourceEmail)
+	}
 
 	// Get email for suppression list
 	var email string
@@ -171,10 +194,10 @@ func (s *ComplianceService) ConfirmUnsubscribe(ctx context.Context, token string
 
 	// Add to suppression list
 	s.db.ExecContext(ctx, `
-		INSERT INTO suppressions (org_id, email, reason, source_type, created_at)
-		VALUES ($1, $2, 'unsubscribe', 'landing_page', NOW())
+		INSERT INTO suppressions (org_id, email, reason, source_type, normalized_email, created_at)
+		VALUES ($1, $2, 'unsubscribe', 'landing_page', $3, NOW())
 		ON CONFLICT (org_id, email) DO NOTHING
-	`, data.OrgID, email)
+	`, data.OrgID, email, normalizedAddress(ctx, s.db, data.OrgID, email))
 
 	// Record consent change
 	details := "Unsubscribe from landing page"
@@ -194,10 +217,10 @@ func (s *ComplianceService) GetPreferenceCenter(ctx context.Context, token strin
 	}
 
 	// Get contact info
-	var contactEmail string
+	var contactEmail, status string
 	err = s.db.QueryRowContext(ctx, `
-		SELECT email FROM contacts WHERE id = $1 AND org_id = $2
-	`, data.ContactID, data.OrgID).Scan(&contactEmail)
+		SELECT email, COALESCE(status, 'active') FROM contacts WHERE id = $1 AND org_id = $2
+	`, data.ContactID, data.OrgID).Scan(&contactEmail, &status)
 	if err != nil {
 		return nil, fmt.Errorf("contact not found")
 	}
@@ -229,25 +252,61 @@ func (s *ComplianceService) GetPreferenceCenter(ctx context.Context, token strin
 		}
 	}
 
+	profile, err := s.contactProfile(ctx, data.OrgID, data.ContactID)
+	if err != nil {
+		return nil, err
+	}
+
+	topics, err := contactTopics(ctx, s.db, data.OrgID, data.ContactID)
+	if err != nil {
+		return nil, err
+	}
+
 	return &PreferenceData{
 		ContactID:       data.ContactID,
 		Email:           contactEmail,
 		SubscribedLists: subscribedLists,
 		AllLists:        lists,
+		Status:          status,
+		Profile:         profile,
+		Topics:          topics,
 	}, nil
 }
 
-// UpdatePreferences updates subscriber preferences from the preference center
-func (s *ComplianceService) UpdatePreferences(ctx context.Context, token string, newListIDs []int, ipAddress string, userAgent string) error {
+// UpdatePreferences updates subscriber preferences from the preference center.
+// When topicIDs is set, the contact is opted out of every other topic.
+func (s *ComplianceService) UpdatePreferences(ctx context.Context, token string, newListIDs []int, topicIDs *[]int, ipAddress string, userAgent string) error {
 	data, err := s.decodeUnsubscribeData(token)
 	if err != nil {
 		return fmt.Errorf("invalid token")
 	}
 
+	if topicIDs != nil {
+		topics, err := contactTopics(ctx, s.db, data.OrgID, data.ContactID)
+		if err != nil {
+			return err
+		}
+		subscribed := make(map[int]bool)
+		for _, id := range *topicIDs {
+			subscribed[id] = true
+		}
+		optedOut := []int{}
+		for _, t := range topics {
+			if !subscribed[t.ID] {
+				optedOut = append(optedOut, t.ID)
+			}
+		}
+		if err := s.setTopicOptOuts(ctx, data.OrgID, data.ContactID, optedOut, "preference-center", ipAddress, userAgent); err != nil {
+			return err
+		}
+	}
+
 	// Get current list memberships
 	rows, _ := s.db.QueryContext(ctx, `
-		SELECT list_id FROM list_contacts WHERE contact_id = $1
-	`, data.ContactID)
+		SELECT lc.list_id FROM list_contacts lc
+		JOIN lists l ON l.id = lc.list_id
+		WHERE lc.contact_id = $1 AND l.org_id = $2
+	`, data.ContactID, data.OrgID)
 	defer rows.Close()
 
 	currentLists := make(map[int]bool)
@@ -257,19 +316,34 @@ func (s *ComplianceService) UpdatePreferences(ctx context.Context, token string,
 		currentLists[listID] = true
 	}
 
+	// Only the org's lists can be joined
 	newListSet := make(map[int]bool)
-	for _, id := range newListIDs {
-		newListSet[id] = true
+	listRows, err := s.db.QueryContext(ctx, `
+		SELECT id FROM lists WHERE org_id = $1 AND id = ANY($2)
+	`, data.OrgID, pq.Array(newListIDs))
+	if err != nil {
+		return fmt.Errorf("failed to get lists: %w", err)
+	}
+	defer listRows.Close()
+	for listRows.Next() {
+		var listID int
+		listRows.Scan(&listID)
+		newListSet[listID] = true
 	}
 
 	// Add to new lists
 	for listID := range newListSet {
 		if !currentLists[listID] {
-			s.db.ExecContext(ctx, `
+			result, err := s.db.ExecContext(ctx, `
 				INSERT INTO list_contacts (list_id, contact_id, created_at)
 				VALUES ($1, $2, NOW())
 				ON CONFLICT DO NOTHING
 			`, listID, data.ContactID)
+			if err == nil {
+				if n, _ := result.RowsAffected(); n > 0 {
+					listevent.Record(ctx, s.db, data.OrgID, data.ContactID, []int{listID}, listevent.Subscribed, listevent.SourcePreferences)
+				}
+			}
 			s.recordConsentChange(ctx, data.ContactID, data.OrgID, "subscribe", "preference-center", &listID, ipAddress, userAgent, "Subscribed via preference center")
 		}
 	}
@@ -277,9 +351,14 @@ func (s *ComplianceService) UpdatePreferences(ctx context.Context, token string,
 	// Remove from old lists
 	for listID := range currentLists {
 		if !newListSet[listID] {
-			s.db.ExecContext(ctx, `
+			result, err := s.db.ExecContext(ctx, `
 				DELETE FROM list_contacts WHERE list_id = $1 AND contact_id = $2
 			`, listID, data.ContactID)
+			if err == nil {
+				if n, _ := result.RowsAffected(); n > 0 {
+					listevent.Record(ctx, s.db, data.OrgID, data.ContactID, []int{listID}, listevent.Unsubscribed, listevent.SourcePreferences)
+				}
+			}
 			s.recordConsentChange(ctx, data.ContactID, data.OrgID, "unsubscribe", "preference-center", &listID, ipAddress, userAgent, "Unsubscribed via preference center")
 		}
 	}
@@ -292,7 +371,7 @@ func (s *ComplianceService) UpdatePreferences(ctx context.Context, token string,
 	`, data.OrgID)
 
 	// If no lists selected, mark contact as unsubscribed
-	if len(newListIDs) == 0 {
+	if len(newListSet) == 0 {
 		s.db.ExecContext(ctx, `
 			UPDATE contacts SET status = 'unsubscribed', updated_at = NOW()
 			WHERE id = $1
@@ -308,12 +387,14 @@ func (s *ComplianceService) UpdatePreferences(ctx context.Context, token string,
 	return nil
 }
 
-// GenerateDoubleOptInToken generates a token for double opt-in confirmation
-func (s *ComplianceService) GenerateDoubleOptInToken(contactID int64, orgID int64, listIDs []int) string {
+// GenerateDoubleOptInToken generates a token for double opt-in confirmation,
+// with the source the subscription came from
+func (s *ComplianceService) GenerateDoubleOptInToken(contactID int64, orgID int64, listIDs []int, source string) string {
 	data := map[string]interface{}{
 		"c":  contactID,
 		"o":  orgID,
 		"l":  listIDs,
+		"s":  source,
 		"ts": time.Now().Unix(),
 	}
 	jsonData, _ := json.Marshal(data)
@@ -355,6 +436,7 @@ func (s *ComplianceService) ConfirmDoubleOptIn(ctx context.Context, token string
 		ContactID int64   `json:"c"`
 		OrgID     int64   `json:"o"`
 		ListIDs   []int   `json:"l"`
+		Source    string  `json:"s"`
 		Timestamp int64   `json:"ts"`
 	}
 	if err := json.Unmarshal(jsonData, &data); err != nil {
@@ -381,21 +463,26 @@ func (s *ComplianceService) ConfirmDoubleOptIn(ctx context.Context, token string
 		return fmt.Errorf("failed to activate contact: %w", err)
 	}
 
-	// Add to lists
-	for _, listID := range data.ListIDs {
-		s.db.ExecContext(ctx, `
-			INSERT INTO list_contacts (list_id, contact_id, created_at)
-			VALUES ($1, $2, NOW())
-			ON CONFLICT DO NOTHING
-		`, listID, data.ContactID)
+	// Add to lists, welcoming the contact. Tokens from before subscriptions
+	// carried their source don't say where it came from.
+	source := data.Source
+	if source == "" {
+		source = listevent.SourceUnknown
+	}
+	lists, err := loadSubscribingLists(ctx, s.db, data.OrgID, data.ListIDs)
+	if err != nil {
+		return err
+	}
+	if _, err := joinLists(ctx, s.db, data.OrgID, data.ContactID, lists, true, source); err != nil {
+		return err
 	}
 
 	// Update list counts
 	s.db.ExecContext(ctx, `
 		UPDATE lists SET contact_count = (
 			SELECT COUNT(*) FROM list_contacts WHERE list_id = lists.id
-		) WHERE id = ANY($1)
-	`, data.ListIDs)
+		) WHERE id = ANY($1) AND org_id = $2
+	`, pq.Array(data.ListIDs), data.OrgID)
 
 	// Record consent
 	s.recordConsentChange(ctx, data.ContactID, data.OrgID, "consent_given", "double_opt_in", nil, ipAddress, userAgent, "Double opt-in confirmed")
@@ -491,6 +578,8 @@ func (s *ComplianceService) ExportContactData(ctx context.Context, orgID int64,
 		})
 	}
 
+	topics, _ := contactTopics(ctx, s.db, orgID, contactID)
+
 	var attributes map[string]interface{}
 	json.Unmarshal(contact.Attributes, &attributes)
 
@@ -507,6 +596,7 @@ func (s *ComplianceService) ExportContactData(ctx context.Context, orgID int64,
 			"createdAt":        contact.CreatedAt,
 		},
 		"lists":          lists,
+		"topics":         topics,
 		"consentHistory": consentHistory,
 		"emailHistory":   emails,
 		"exportedAt":     time.Now(),
@@ -532,7 +622,13 @@ func (s *ComplianceService) DeleteContactData(ctx context.Context, orgID int64,
 	}
 	defer tx.Rollback()
 
-	// Delete from list_contacts
+	// Delete from list_contacts, the lists keeping their removal and their
+	// history no longer linked to the contact
+	tx.ExecContext(ctx, `
+		INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+		SELECT $2, list_id, NULL, $3, $4, NOW() FROM list_contacts WHERE contact_id = $1
+	`, contactID, orgID, listevent.Removed, listevent.SourceAPI)
+	tx.ExecContext(ctx, "UPDATE list_events SET contact_id = NULL WHERE contact_id = $1", contactID)
 	tx.ExecContext(ctx, "DELETE FROM list_contacts WHERE contact_id = $1", contactID)
 
 	// Delete consent audit records
@@ -547,15 +643,21 @@ func (s *ComplianceService) DeleteContactData(ctx context.Context, orgID int64,
 		WHERE contact_id = $1
 	`, contactID)
 
+	// Redact campaign recipient snapshots; unsent ones are skipped with the contact gone
+	tx.ExecContext(ctx, `
+		UPDATE campaign_recipients SET email = '[redacted]', updated_at = NOW()
+		WHERE contact_id = $1
+	`, contactID)
+
 	// Delete the contact
 	tx.ExecContext(ctx, "DELETE FROM contacts WHERE id = $1", contactID)
 
 	// Add to suppression list to prevent future mailings
 	tx.ExecContext(ctx, `
-		INSERT INTO suppressions (org_id, email, reason, source_type, created_at)
-		VALUES ($1, $2, 'gdpr_erasure', 'gdpr', NOW())
-		ON CONFLICT (org_id, email) DO UPDATE SET reason = 'gdpr_erasure'
-	`, orgID, email)
+		INSERT INTO suppressions (org_id, email, reason, source_type, normalized_email, created_at)
+		VALUES ($1, $2, 'gdpr_erasure', 'gdpr', $3, NOW())
+		ON CONFLICT (org_id, email) DO UPDATE SET reason = 'gdpr_erasure', normalized_email = EXCLUDED.normalized_email
+	`, orgID, email, normalizedAddress(ctx, s.db, orgID, email))
 
 	if err := tx.Commit(); err != nil {
 		return fmt.Errorf("failed to delete contact data: %w", err)
@@ -659,55 +761,12 @@ func (s *ComplianceService) recordConsentChange(ctx context.Context, contactID i
 	`, contactID, orgID, action, source, listID, ipAddress, userAgent, details)
 }
 
-// encodeUnsubscribeData encodes unsubscribe data to a URL-safe token
+// encodeUnsubscribeData encodes and signs unsubscribe data into a token
 func (s *ComplianceService) encodeUnsubscribeData(data UnsubscribeData) string {
-	// Add a unique ID to prevent token reuse tracking
-	fullData := struct {
-		UnsubscribeData
-		Nonce string `json:"n"`
-	}{
-		UnsubscribeData: data,
-		Nonce:           uuid.New().String()[:8],
-	}
-
-	jsonData, _ := json.Marshal(fullData)
-
-	// Sign the data
-	mac := hmac.New(sha256.New, []byte(s.cfg.JWTSecret))
-	mac.Write(jsonData)
-	signature := mac.Sum(nil)
-
-	combined := append(jsonData, signature[:8]...)
-	return base64.URLEncoding.EncodeToString(combined)
+	return unsubscribe.Encode(s.cfg.JWTSecret, data)
 }
 
 // decodeUnsubscribeData decodes and verifies an unsubscribe token
 func (s *ComplianceService) decodeUnsubscribeData(token string) (*UnsubscribeData, error) {
-	combined, err := base64.URLEncoding.DecodeString(token)
-	if err != nil {
-		return nil, fmt.Errorf("invalid token encoding")
-	}
-
-	if len(combined) < 9 {
-		return nil, fmt.Errorf("token too short")
-	}
-
-	jsonData := combined[:len(combined)-8]
-	providedSig := combined[len(combined)-8:]
-
-	// Verify signature
-	mac := hmac.New(sha256.New, []byte(s.cfg.JWTSecret))
-	mac.Write(jsonData)
-	expectedSig := mac.Sum(nil)[:8]
-
-	if !hmac.Equal(providedSig, expectedSig) {
-		return nil, fmt.Errorf("invalid signature")
-	}
-
-	var data UnsubscribeData
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		return nil, fmt.Errorf("invalid token data")
-	}
-
-	return &data, nil
+	return unsubscribe.Decode(s.cfg.JWTSecret, token)
 }
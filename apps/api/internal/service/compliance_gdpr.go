@@ -0,0 +1,402 @@
+package service
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/provider"
+)
+
+// A data subject can ask for everything the org stores about them (GDPR
+// articles 15 and 20) and for it to be erased (article 17). The export is a zip
+// of JSON files, one per kind of record. Erasure anonymizes the contact rather
+// than deleting it, so campaign stats keep adding up, and redacts the sent and
+// received messages that name them.
+
+// gdprErasedDomain is the domain of the address an erased contact is left with
+const gdprErasedDomain = "erased.invalid"
+
+// receivedFromOrTo matches the received emails from, to or copied to the
+// lowercased address $2, whatever the case it was written in
+const receivedFromOrTo = `(LOWER(from_email) = $2
+	OR $2 = ANY(SELECT LOWER(x) FROM unnest(to_emails) x)
+	OR $2 = ANY(SELECT LOWER(x) FROM unnest(cc_emails) x))`
+
+// SetReceivingProvider sets the provider the files of received emails are
+// deleted with when a contact's data is erased
+func (s *ComplianceService) SetReceivingProvider(rp *provider.ReceivingProvider) {
+	s.receiving = rp
+}
+
+// gdprSubject is the contact a data subject request is about
+type gdprSubject struct {
+	ID     int64
+	OrgID  int64
+	Email  string // Lowercased
+	Status string
+}
+
+// gdprExportSection is one file of a data subject export
+type gdprExportSection struct {
+	file  string
+	query string
+	args  func(gdprSubject) []any
+}
+
+func bySubjectID(c gdprSubject) []any    { return []any{c.ID, c.OrgID} }
+func bySubjectEmail(c gdprSubject) []any { return []any{c.Email, c.OrgID} }
+
+// gdprExportSections are the records exported about a contact
+var gdprExportSections = []gdprExportSection{
+	{"contact.json", `
+		SELECT uuid, email, first_name, last_name, attributes, status, consent_source, consent_timestamp,
+			consent_ip, consent_user_agent, last_engaged_at, engagement_score, created_at, updated_at
+		FROM contacts WHERE id = $1 AND org_id = $2`, bySubjectID},
+	{"lists.json", `
+		SELECT l.uuid, l.name, lc.created_at AS joined_at
+		FROM list_contacts lc JOIN lists l ON l.id = lc.list_id
+		WHERE lc.contact_id = $1 AND l.org_id = $2
+		ORDER BY lc.created_at`, bySubjectID},
+	{"consent_history.json", `
+		SELECT action, source, list_id, ip_address, user_agent, details, created_at
+		FROM consent_audit WHERE contact_id = $1 AND org_id = $2
+		ORDER BY created_at`, bySubjectID},
+	{"campaign_emails.json", `
+		SELECT e.uuid, e.message_id, e.from_email, e.from_name, e.to_emails, e.subject, e.text_content,
+			e.status, e.sent_at, e.delivered_at, e.open_count, e.click_count, e.created_at,
+			c.name AS campaign,
+			COALESCE((SELECT json_agg(json_build_object('event', de.event_type, 'occurredAt', de.occurred_at) ORDER BY de.occurred_at)
+				FROM delivery_events de WHERE de.email_id = e.id), '[]') AS events
+		FROM emails e LEFT JOIN campaigns c ON c.id = e.campaign_id
+		WHERE e.org_id = $2 AND (e.contact_id = $1 OR $3 = ANY(SELECT LOWER(x) FROM unnest(e.to_emails) x))
+		ORDER BY e.created_at`, func(c gdprSubject) []any { return []any{c.ID, c.OrgID, c.Email} }},
+	{"transactional_emails.json", `
+		SELECT t.uuid, t.message_id, t.from_address, r.email, r.type, t.subject, t.text_body, r.status,
+			t.sent_at, r.delivered_at, r.opened_at, r.clicked_at, r.bounced_at, r.bounce_reason, r.complained_at, t.created_at
+		FROM transactional_email_recipients r JOIN transactional_emails t ON t.id = r.email_id
+		WHERE LOWER(r.email) = $1 AND t.org_id = $2
+		ORDER BY t.created_at`, bySubjectEmail},
+	{"conversions.json", `
+		SELECT c.name AS campaign, cc.value, cc.currency, cc.order_id, cc.source, cc.occurred_at
+		FROM campaign_conversions cc JOIN campaigns c ON c.id = cc.campaign_id
+		WHERE cc.contact_id = $1 AND c.org_id = $2
+		ORDER BY cc.occurred_at`, bySubjectID},
+	{"events.json", `
+		SELECT uuid, name, properties, occurred_at
+		FROM contact_events WHERE contact_id = $1 AND org_id = $2
+		ORDER BY occurred_at`, bySubjectID},
+	{"changes.json", `
+		SELECT field, old_value, new_value, source, created_at
+		FROM contact_changes WHERE contact_id = $1 AND org_id = $2
+		ORDER BY created_at`, bySubjectID},
+	{"automations.json", `
+		SELECT a.name AS automation, ae.status, ae.step_index, ae.enrolled_at, ae.completed_at
+		FROM automation_enrollments ae JOIN automations a ON a.id = ae.automation_id
+		WHERE ae.contact_id = $1 AND ae.org_id = $2
+		ORDER BY ae.enrolled_at`, bySubjectID},
+	{"received_emails.json", `
+		SELECT uuid, message_id, from_email, from_name, to_emails, cc_emails, reply_to, subject, text_body,
+			has_attachments, received_at
+		FROM received_emails
+		WHERE (LOWER(from_email) = $1 OR $1 = ANY(SELECT LOWER(x) FROM unnest(to_emails) x)
+			OR $1 = ANY(SELECT LOWER(x) FROM unnest(cc_emails) x)) AND org_id = $2
+		ORDER BY received_at`, bySubjectEmail},
+}
+
+// gdprSubject looks up a contact of the org
+func (s *ComplianceService) gdprSubject(ctx context.Context, orgID int64, contactUUID string) (gdprSubject, error) {
+	subject := gdprSubject{OrgID: orgID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, email, COALESCE(status, '') FROM contacts WHERE uuid::text = $1 AND org_id = $2
+	`, contactUUID, orgID).Scan(&subject.ID, &subject.Email, &subject.Status)
+	if err == sql.ErrNoRows {
+		return subject, fmt.Errorf("contact not found")
+	}
+	if err != nil {
+		return subject, fmt.Errorf("failed to get contact: %w", err)
+	}
+	subject.Email = strings.ToLower(subject.Email)
+	return subject, nil
+}
+
+// ExportContactArchive returns a zip of everything stored about a contact: the
+// contact, its list memberships and consent history, the campaign and
+// transactional emails sent to them with their delivery events, their
+// conversions, custom events, field changes and automation enrollments, and the
+// emails received from or copied to them
+func (s *ComplianceService) ExportContactArchive(ctx context.Context, orgID int64, contactUUID string) ([]byte, *model.GDPRExportSummary, error) {
+	subject, err := s.gdprSubject(ctx, orgID, contactUUID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	summary := &model.GDPRExportSummary{
+		ContactUUID: contactUUID,
+		Records:     map[string]int{},
+		ExportedAt:  time.Now().UTC(),
+	}
+
+	var buf bytes.Buffer
+	archive := zip.NewWriter(&buf)
+	for _, section := range gdprExportSections {
+		records, err := queryRecords(ctx, s.db, section.query, section.args(subject)...)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to export %s: %w", section.file, err)
+		}
+		if err := writeJSONFile(archive, section.file, records); err != nil {
+			return nil, nil, err
+		}
+		summary.Records[strings.TrimSuffix(section.file, ".json")] = len(records)
+	}
+	if err := writeJSONFile(archive, "export.json", summary); err != nil {
+		return nil, nil, err
+	}
+	if err := archive.Close(); err != nil {
+		return nil, nil, fmt.Errorf("failed to write export: %w", err)
+	}
+
+	return buf.Bytes(), summary, nil
+}
+
+// writeJSONFile adds an indented JSON file to a zip
+func writeJSONFile(archive *zip.Writer, name string, value any) error {
+	w, err := archive.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", name, err)
+	}
+	data, err := json.MarshalIndent(value, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %w", name, err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// queryRecords returns the rows of a query as JSON objects keyed by column.
+// JSON columns stay JSON, and other raw values such as arrays become text.
+func queryRecords(ctx context.Context, db *sql.DB, query string, args ...any) ([]map[string]any, error) {
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns, err := rows.Columns()
+	if err != nil {
+		return nil, err
+	}
+
+	records := []map[string]any{}
+	for rows.Next() {
+		values := make([]any, len(columns))
+		pointers := make([]any, len(columns))
+		for i := range values {
+			pointers[i] = &values[i]
+		}
+		if err := rows.Scan(pointers...); err != nil {
+			return nil, err
+		}
+
+		record := make(map[string]any, len(columns))
+		for i, column := range columns {
+			if raw, ok := values[i].([]byte); ok {
+				if json.Valid(raw) {
+					record[column] = json.RawMessage(raw)
+				} else {
+					record[column] = string(raw)
+				}
+				continue
+			}
+			record[column] = values[i]
+		}
+		records = append(records, record)
+	}
+	return records, rows.Err()
+}
+
+// EraseContactData anonymizes a contact and redacts the messages that name them.
+// The contact keeps its ID and UUID so stats and the consent trail still add up,
+// but loses its address, name, attributes, list memberships and custom events.
+// Campaign emails sent to them and emails received from or copied to them lose
+// their address and content, and received ones their raw message and
+// attachments. The stored files of those are deleted once the rest is erased;
+// files that can't be are listed in the result. The address stays suppressed
+// so imports can't bring it back.
+func (s *ComplianceService) EraseContactData(ctx context.Context, orgID int64, contactUUID string) (*model.GDPRErasureResult, error) {
+	subject, err := s.gdprSubject(ctx, orgID, contactUUID)
+	if err != nil {
+		return nil, err
+	}
+	if subject.Status == "erased" {
+		return nil, fmt.Errorf("the contact's data was already erased")
+	}
+	contactID, email := subject.ID, subject.Email
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &model.GDPRErasureResult{ContactUUID: contactUUID}
+	objects, err := receivedObjects(ctx, tx, orgID, email)
+	if err != nil {
+		return nil, err
+	}
+
+	steps := []struct {
+		counter *int
+		query   string
+		args    []any
+	}{
+		// Lists keep their removal and their history, no longer linked to the contact
+		{nil, `
+			INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+			SELECT $2, list_id, NULL, 'removed', 'api', NOW() FROM list_contacts WHERE contact_id = $1
+		`, []any{contactID, orgID}},
+		{nil, `UPDATE list_events SET contact_id = NULL WHERE contact_id = $1`, []any{contactID}},
+		{&result.ListMemberships, `DELETE FROM list_contacts WHERE contact_id = $1`, []any{contactID}},
+		{&result.ContactEvents, `DELETE FROM contact_events WHERE contact_id = $1`, []any{contactID}},
+		{&result.ContactChanges, `DELETE FROM contact_changes WHERE contact_id = $1`, []any{contactID}},
+		{nil, `
+			UPDATE automation_enrollments SET status = 'cancelled', step_data = '{}', next_run_at = NULL, updated_at = NOW()
+			WHERE contact_id = $1 AND org_id = $2 AND status = 'active'
+		`, []any{contactID, orgID}},
+		{nil, `
+			UPDATE consent_audit SET ip_address = NULL, user_agent = NULL
+			WHERE contact_id = $1 AND org_id = $2
+		`, []any{contactID, orgID}},
+		{&result.Emails, `
+			UPDATE emails SET
+				to_emails = ARRAY['[redacted]'], cc_emails = '{}', bcc_emails = '{}',
+				subject = '[redacted]', html_content = NULL, text_content = NULL,
+				metadata = '{}', headers = '{}', updated_at = NOW()
+			WHERE org_id = $2 AND (contact_id = $1 OR $3 = ANY(SELECT LOWER(x) FROM unnest(to_emails) x))
+		`, []any{contactID, orgID, email}},
+		{&result.CampaignRecipients, `
+			UPDATE campaign_recipients SET email = '[redacted]', error = NULL, updated_at = NOW()
+			WHERE contact_id = $1 AND org_id = $2
+		`, []any{contactID, orgID}},
+		{&result.TransactionalEmails, `
+			UPDATE transactional_email_recipients r SET email = '[redacted-' || r.id || ']', bounce_reason = NULL, updated_at = NOW()
+			FROM transactional_emails t
+			WHERE t.id = r.email_id AND t.org_id = $1 AND LOWER(r.email) = $2
+		`, []any{orgID, email}},
+		{nil, `
+			DELETE FROM email_attachments WHERE received_email_id IN (
+				SELECT id FROM received_emails WHERE org_id = $1 AND ` + receivedFromOrTo + `
+			)
+		`, []any{orgID, email}},
+		{&result.ReceivedEmails, `
+			UPDATE received_emails SET
+				from_email = CASE WHEN LOWER(from_email) = $2 THEN '[redacted]' ELSE from_email END,
+				from_name = CASE WHEN LOWER(from_email) = $2 THEN NULL ELSE from_name END,
+				to_emails = ARRAY(SELECT CASE WHEN LOWER(x) = $2 THEN '[redacted]' ELSE x END FROM unnest(to_emails) x),
+				cc_emails = ARRAY(SELECT CASE WHEN LOWER(x) = $2 THEN '[redacted]' ELSE x END FROM unnest(cc_emails) x),
+				reply_to = CASE WHEN LOWER(reply_to) = $2 THEN NULL ELSE reply_to END,
+				subject = '[redacted]', text_body = NULL, html_body = NULL, snippet = NULL,
+				raw_s3_key = NULL, has_attachments = false, updated_at = NOW()
+			WHERE org_id = $1 AND ` + receivedFromOrTo + `
+		`, []any{orgID, email}},
+		{nil, `
+			UPDATE contacts SET
+				email = 'erased-' || uuid || '@` + gdprErasedDomain + `',
+				first_name = NULL, last_name = NULL, attributes = '{}',
+				status = 'erased', consent_ip = NULL, consent_user_agent = NULL, updated_at = NOW()
+			WHERE id = $1
+		`, []any{contactID}},
+		{nil, `
+			INSERT INTO suppressions (org_id, email, reason, source_type, normalized_email, created_at)
+			VALUES ($1, $2, 'gdpr_erasure', 'gdpr', $3, NOW())
+			ON CONFLICT (org_id, email) DO UPDATE SET reason = 'gdpr_erasure', normalized_email = EXCLUDED.normalized_email
+		`, []any{orgID, email, normalizedAddress(ctx, s.db, orgID, email)}},
+	}
+	for _, step := range steps {
+		res, err := tx.ExecContext(ctx, step.query, step.args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to erase contact data: %w", err)
+		}
+		if step.counter != nil {
+			n, _ := res.RowsAffected()
+			*step.counter = int(n)
+		}
+	}
+
+	// Lists the contact was in count one member fewer
+	if result.ListMemberships > 0 {
+		_, err := tx.ExecContext(ctx, `
+			UPDATE lists SET contact_count = (SELECT COUNT(*) FROM list_contacts WHERE list_id = lists.id)
+			WHERE org_id = $1
+		`, orgID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to update list counts: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to erase contact data: %w", err)
+	}
+
+	// Files are deleted after the commit, so a failed erasure leaves none of
+	// its emails pointing at files that are gone
+	for _, obj := range objects {
+		if s.receiving == nil {
+			result.StorageFailures = append(result.StorageFailures,
+				fmt.Sprintf("s3://%s/%s: receiving storage is not configured", obj.bucket, obj.key))
+			continue
+		}
+		if err := s.receiving.DeleteObject(ctx, obj.bucket, obj.key); err != nil {
+			result.StorageFailures = append(result.StorageFailures, err.Error())
+			continue
+		}
+		result.StoredFiles++
+	}
+
+	s.recordConsentChange(ctx, contactID, orgID, "erased", "gdpr", nil, "", "", "Personal data erased on request")
+	result.ErasedAt = time.Now().UTC()
+	return result, nil
+}
+
+// storedObject is a file in a receiving bucket
+type storedObject struct {
+	bucket string
+	key    string
+}
+
+// receivedObjects returns the raw messages, attachments and thumbnails stored
+// for the received emails from, to or copied to an address
+func receivedObjects(ctx context.Context, tx *sql.Tx, orgID int64, email string) ([]storedObject, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT COALESCE(raw_s3_bucket, ''), COALESCE(raw_s3_key, '')
+		FROM received_emails WHERE org_id = $1 AND `+receivedFromOrTo+`
+		UNION
+		SELECT s3_bucket, s3_key FROM email_attachments
+		WHERE received_email_id IN (SELECT id FROM received_emails WHERE org_id = $1 AND `+receivedFromOrTo+`)
+		UNION
+		SELECT s3_bucket, COALESCE(thumbnail_s3_key, '') FROM email_attachments
+		WHERE received_email_id IN (SELECT id FROM received_emails WHERE org_id = $1 AND `+receivedFromOrTo+`)
+	`, orgID, email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find stored files: %w", err)
+	}
+	defer rows.Close()
+
+	var objects []storedObject
+	for rows.Next() {
+		var obj storedObject
+		if err := rows.Scan(&obj.bucket, &obj.key); err != nil {
+			return nil, fmt.Errorf("failed to find stored files: %w", err)
+		}
+		if obj.bucket != "" && obj.key != "" {
+			objects = append(objects, obj)
+		}
+	}
+	return objects, rows.Err()
+}
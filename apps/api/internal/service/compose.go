@@ -3,15 +3,18 @@ package service
 import (
 	"context"
 	"database/sql"
-	"encoding/base64"
+	"html"
 	"fmt"
 	"strings"
 	"time"
 
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
 	"github.com/dublyo/mailat/api/internal/config"
 	"github.com/dublyo/mailat/api/internal/model"
 	"github.com/dublyo/mailat/api/internal/provider"
-	"github.com/dublyo/mailat/api/pkg/crypto"
+	"github.com/dublyo/mailat/api/pkg/tracking"
 )
 
 // ComposeService handles email composition and sending
@@ -21,6 +24,8 @@ type ComposeService struct {
 	jmap          *JMAPClient
 	identity      *IdentityService
 	emailProvider provider.EmailProvider
+	attachments   *provider.AttachmentStore // Attachments of emails sent through SES
+	tracker       *tracking.Tracker
 }
 
 // NewComposeService creates a new compose service
@@ -30,6 +35,7 @@ func NewComposeService(db *sql.DB, cfg *config.Config, identityService *Identity
 		cfg:      cfg,
 		jmap:     NewJMAPClient(cfg.StalwartURL),
 		identity: identityService,
+		tracker:  tracking.New(cfg.APIUrl, cfg.JWTSecret),
 	}
 
 	// Initialize email provider for sending
@@ -44,6 +50,7 @@ func NewComposeService(db *sql.DB, cfg *config.Config, identityService *Identity
 			fmt.Printf("Warning: Failed to initialize SES provider for compose: %v\n", err)
 		} else {
 			svc.emailProvider = sesProvider
+			svc.attachments = newAttachmentStore(cfg)
 			fmt.Println("ComposeService: Using SES for email sending")
 		}
 	}
@@ -53,20 +60,25 @@ func NewComposeService(db *sql.DB, cfg *config.Config, identityService *Identity
 
 // ComposeEmail represents an email being composed
 type ComposeEmail struct {
-	ID            string          `json:"id,omitempty"`
-	IdentityID    int64           `json:"identityId"`
-	From          EmailAddress    `json:"from"`
-	To            []EmailAddress  `json:"to"`
-	Cc            []EmailAddress  `json:"cc,omitempty"`
-	Bcc           []EmailAddress  `json:"bcc,omitempty"`
-	ReplyTo       []EmailAddress  `json:"replyTo,omitempty"`
-	Subject       string          `json:"subject"`
-	TextBody      string          `json:"textBody,omitempty"`
-	HTMLBody      string          `json:"htmlBody,omitempty"`
-	InReplyTo     string          `json:"inReplyTo,omitempty"`
-	References    []string        `json:"references,omitempty"`
-	Attachments   []AttachmentRef `json:"attachments,omitempty"`
-	IsDraft       bool            `json:"isDraft"`
+	ID             string          `json:"id,omitempty"`
+	IdentityID     int64           `json:"identityId"`
+	From           EmailAddress    `json:"from"`
+	To             []EmailAddress  `json:"to"`
+	Cc             []EmailAddress  `json:"cc,omitempty"`
+	Bcc            []EmailAddress  `json:"bcc,omitempty"`
+	ReplyTo        []EmailAddress  `json:"replyTo,omitempty"`
+	Subject        string          `json:"subject"`
+	TextBody       string          `json:"textBody,omitempty"`
+	HTMLBody       string          `json:"htmlBody,omitempty"`
+	InReplyTo      string          `json:"inReplyTo,omitempty"`
+	References     []string        `json:"references,omitempty"`
+	Attachments    []AttachmentRef `json:"attachments,omitempty"`
+	IsDraft        bool            `json:"isDraft"`
+	NoSignature    bool            `json:"noSignature,omitempty"`    // Send without the identity's signature
+	Confirmed      bool            `json:"-"`                        // The sender confirmed what the outbound rules asked about
+	TrackOpens     bool            `json:"trackOpens,omitempty"`     // Record opens on the sent copy
+	TrackClicks    bool            `json:"trackClicks,omitempty"`    // Record link clicks on the sent copy
+	AwayRecipients []RecipientAway `json:"awayRecipients,omitempty"` // Set in reply contexts
 }
 
 // AttachmentRef represents an attachment reference
@@ -77,14 +89,21 @@ type AttachmentRef struct {
 	Size        int    `json:"size"`
 	Disposition string `json:"disposition,omitempty"` // attachment or inline
 	CID         string `json:"cid,omitempty"`         // Content-ID for inline
+	Checksum    string `json:"checksum,omitempty"`    // SHA-256 of the content
 }
 
-// SendEmailResult represents the result of sending an email
+// SendEmailResult represents the result of sending an email. Emails held for
+// undo send are pending, with the send to cancel and when it goes out.
 type SendEmailResult struct {
-	EmailID    string    `json:"emailId"`
-	ThreadID   string    `json:"threadId"`
-	SentAt     time.Time `json:"sentAt"`
-	MessageID  string    `json:"messageId"`
+	Status         string          `json:"status"`
+	EmailID        string          `json:"emailId,omitempty"`
+	ThreadID       string          `json:"threadId,omitempty"`
+	SentAt         time.Time       `json:"sentAt,omitzero"`
+	MessageID      string          `json:"messageId,omitempty"`
+	SendID         string          `json:"sendId,omitempty"`
+	SendAt         *time.Time      `json:"sendAt,omitempty"`
+	Tracked        bool            `json:"tracked,omitempty"`        // Opens or clicks are recorded
+	AwayRecipients []RecipientAway `json:"awayRecipients,omitempty"` // Recipients of the org whose auto-reply is on
 }
 
 // DraftResult represents a saved draft
@@ -95,8 +114,13 @@ type DraftResult struct {
 	UpdatedAt  time.Time `json:"updatedAt"`
 }
 
-// SendEmail sends an email via SES (or falls back to JMAP if SES not configured)
+// SendEmail sends an email via SES (or falls back to JMAP if SES not configured).
+// Users with an undo send delay have it held for that long first.
 func (s *ComposeService) SendEmail(ctx context.Context, userID int64, email *ComposeEmail) (*SendEmailResult, error) {
+	if err := s.checkTracking(email); err != nil {
+		return nil, err
+	}
+
 	// Validate identity belongs to user
 	identity, err := s.getIdentityByID(ctx, userID, email.IdentityID)
 	if err != nil {
@@ -109,13 +133,44 @@ func (s *ComposeService) SendEmail(ctx context.Context, userID int64, email *Com
 		Email: identity.Email,
 	}
 
-	// Use SES if available (preferred method)
-	if s.emailProvider != nil {
-		return s.sendViaSES(ctx, identity, email)
+	if !email.NoSignature {
+		s.applySignature(ctx, identity, email)
+	}
+	away := s.awayRecipients(ctx, identity, email)
+	if err := s.applyOutboundRules(ctx, identity, email); err != nil {
+		return nil, withAwayRecipients(err, away)
 	}
 
-	// Fall back to JMAP
-	return s.sendViaJMAP(ctx, identity, email)
+	var result *SendEmailResult
+	if delay := s.undoSendDelay(ctx, userID); delay > 0 {
+		result, err = s.holdSend(ctx, userID, identity, email, time.Now().Add(delay), false)
+	} else {
+		result, err = s.send(ctx, identity, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.AwayRecipients = away
+	return result, nil
+}
+
+// send sends an email from an identity right away
+func (s *ComposeService) send(ctx context.Context, identity *model.Identity, email *ComposeEmail) (*SendEmailResult, error) {
+	var result *SendEmailResult
+	var err error
+	if s.emailProvider != nil {
+		// Use SES if available (preferred method)
+		result, err = s.sendViaSES(ctx, identity, email)
+	} else {
+		// Fall back to JMAP
+		result, err = s.sendViaJMAP(ctx, identity, email)
+	}
+	if err != nil {
+		return nil, err
+	}
+	result.Status = ComposeSendSent
+	s.recordRecipients(ctx, identity.UserID, email)
+	return result, nil
 }
 
 // sendViaSES sends email using AWS SES
@@ -168,11 +223,25 @@ func (s *ComposeService) sendViaSES(ctx context.Context, identity *model.Identit
 		Headers:  make(map[string]string),
 	}
 
+	// Tracking is recorded on the sent copy, which keeps the untracked body so
+	// the sender reading it doesn't count as an open
+	sentUUID := uuid.NewString()
+	tracked := (email.TrackOpens || email.TrackClicks) && email.HTMLBody != ""
+	if tracked {
+		msg.HTMLBody = s.tracker.ApplySent(sentUUID, email.HTMLBody, email.TrackOpens, email.TrackClicks)
+	}
+
 	// Add reply-to if specified
 	if len(email.ReplyTo) > 0 {
 		msg.ReplyTo = email.ReplyTo[0].Email
 	}
 
+	attachments, err := s.loadAttachments(ctx, identity, email.Attachments)
+	if err != nil {
+		return nil, err
+	}
+	msg.Attachments = attachments
+
 	// Add threading headers (ensure proper Message-ID format with angle brackets)
 	if email.InReplyTo != "" {
 		msg.Headers["In-Reply-To"] = formatMessageID(email.InReplyTo)
@@ -195,36 +264,90 @@ func (s *ComposeService) sendViaSES(ctx context.Context, identity *model.Identit
 		EmailID:   sendResult.MessageID,
 		MessageID: sendResult.MessageID,
 		SentAt:    time.Now(),
+		Tracked:   tracked,
 	}
 
+	// Keep a copy in the sent folder, in the thread of the conversation it replies to
+	result.ThreadID = s.recordSent(ctx, identity, email, sendResult.MessageID, sentUUID, tracked)
+
 	return result, nil
 }
 
-// sendViaJMAP sends email using JMAP (Stalwart) - fallback method
-func (s *ComposeService) sendViaJMAP(ctx context.Context, identity *model.Identity, email *ComposeEmail) (*SendEmailResult, error) {
-	// Get identity password
-	password, err := s.getIdentityPassword(ctx, identity.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get identity password: %w", err)
+// recordSent stores an email sent through SES in the identity's sent folder,
+// under the UUID its tracking refers to, and returns the thread it joined. The
+// email has been sent by then, so failing to store it is only reported.
+func (s *ComposeService) recordSent(ctx context.Context, identity *model.Identity, email *ComposeEmail, sesMessageID, sentUUID string, tracked bool) string {
+	// SES names the messages it sends after their SES ID
+	sesDomain := "email.amazonses.com"
+	if s.cfg.AWSRegion != "" && s.cfg.AWSRegion != "us-east-1" {
+		sesDomain = s.cfg.AWSRegion + ".amazonses.com"
 	}
+	messageID := fmt.Sprintf("<%s@%s>", sesMessageID, sesDomain)
 
-	// Get JMAP session
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get JMAP session: %w", err)
+	inReplyTo := formatMessageID(email.InReplyTo)
+	references := make([]string, len(email.References))
+	for i, ref := range email.References {
+		references[i] = formatMessageID(ref)
+	}
+	toEmails := make([]string, len(email.To))
+	for i, addr := range email.To {
+		toEmails[i] = strings.ToLower(addr.Email)
+	}
+	ccEmails := make([]string, len(email.Cc))
+	for i, addr := range email.Cc {
+		ccEmails[i] = strings.ToLower(addr.Email)
+	}
+	bccEmails := make([]string, len(email.Bcc))
+	for i, addr := range email.Bcc {
+		bccEmails[i] = strings.ToLower(addr.Email)
+	}
+	correspondent := ""
+	if len(toEmails) > 0 {
+		correspondent = toEmails[0]
 	}
 
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+	threadID := resolveThread(ctx, s.db, threadMessage{
+		IdentityID:    identity.ID,
+		MessageID:     messageID,
+		InReplyTo:     inReplyTo,
+		References:    references,
+		Subject:       email.Subject,
+		Correspondent: correspondent,
+	})
+
+	snippet := email.TextBody
+	if len(snippet) > 200 {
+		snippet = snippet[:200] + "..."
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO received_emails (
+			uuid, org_id, domain_id, identity_id, message_id, in_reply_to, "references", thread_id, thread_subject,
+			from_email, from_name, to_emails, cc_emails, bcc_emails, subject, text_body, html_body, snippet,
+			folder, is_read, ses_message_id, tracked, received_at, read_at
+		)
+		SELECT $18, d.org_id, d.id, $2, $3, NULLIF($4, ''), $5, $6, $7,
+			$8, $9, $10, $11, $12, $13, $14, $15, $16,
+			'sent', true, $17, $19, NOW(), NOW()
+		FROM domains d WHERE d.id = $1
+	`, identity.DomainID, identity.ID, messageID, inReplyTo, pq.Array(references), threadID, threadSubject(email.Subject),
+		identity.Email, identity.DisplayName, pq.Array(toEmails), pq.Array(ccEmails), pq.Array(bccEmails),
+		email.Subject, email.TextBody, email.HTMLBody, snippet, sesMessageID, sentUUID, tracked)
+	if err != nil {
+		fmt.Printf("Warning: Failed to store sent email %s: %v\n", sesMessageID, err)
 	}
-	if accountID == "" {
-		return nil, fmt.Errorf("no account found")
+	return threadID
+}
+
+// sendViaJMAP sends email using JMAP (Stalwart) - fallback method
+func (s *ComposeService) sendViaJMAP(ctx context.Context, identity *model.Identity, email *ComposeEmail) (*SendEmailResult, error) {
+	auth, err := s.identity.JMAPAuth(ctx, identity)
+	if err != nil {
+		return nil, err
 	}
 
 	// Find Sent mailbox
-	mailboxes, err := s.jmap.GetMailboxes(ctx, identity.Email, password, accountID)
+	mailboxes, err := s.jmap.GetMailboxes(ctx, auth.Username, auth.Password, auth.AccountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get mailboxes: %w", err)
 	}
@@ -250,7 +373,7 @@ func (s *ComposeService) sendViaJMAP(ctx context.Context, identity *model.Identi
 			{
 				"Email/set",
 				map[string]interface{}{
-					"accountId": accountID,
+					"accountId": auth.AccountID,
 					"create": map[string]interface{}{
 						"draft": emailCreate,
 					},
@@ -260,7 +383,7 @@ func (s *ComposeService) sendViaJMAP(ctx context.Context, identity *model.Identi
 			{
 				"EmailSubmission/set",
 				map[string]interface{}{
-					"accountId": accountID,
+					"accountId": auth.AccountID,
 					"create": map[string]interface{}{
 						"sendIt": map[string]interface{}{
 							"emailId":  "#draft",
@@ -279,7 +402,7 @@ func (s *ComposeService) sendViaJMAP(ctx context.Context, identity *model.Identi
 		},
 	}
 
-	response, err := s.jmap.Call(ctx, identity.Email, password, request)
+	response, err := s.jmap.Call(ctx, auth.Username, auth.Password, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send email: %w", err)
 	}
@@ -295,10 +418,10 @@ func (s *ComposeService) sendViaJMAP(ctx context.Context, identity *model.Identi
 			if created, ok := dataMap["created"].(map[string]interface{}); ok {
 				if draft, ok := created["draft"].(map[string]interface{}); ok {
 					if id, ok := draft["id"].(string); ok {
-						result.EmailID = fmt.Sprintf("%d:%s", identity.ID, id)
+						result.EmailID = formatUnifiedID(identity.ID, id)
 					}
 					if threadID, ok := draft["threadId"].(string); ok {
-						result.ThreadID = fmt.Sprintf("%d:%s", identity.ID, threadID)
+						result.ThreadID = formatUnifiedID(identity.ID, threadID)
 					}
 				}
 			}
@@ -328,24 +451,13 @@ func (s *ComposeService) SaveDraft(ctx context.Context, userID int64, email *Com
 		return nil, fmt.Errorf("invalid identity: %w", err)
 	}
 
-	password, err := s.getIdentityPassword(ctx, identity.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
+	auth, err := s.identity.JMAPAuth(ctx, identity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get JMAP session: %w", err)
-	}
-
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+		return nil, err
 	}
 
 	// Find Drafts mailbox
-	mailboxes, err := s.jmap.GetMailboxes(ctx, identity.Email, password, accountID)
+	mailboxes, err := s.jmap.GetMailboxes(ctx, auth.Username, auth.Password, auth.AccountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get mailboxes: %w", err)
 	}
@@ -375,7 +487,7 @@ func (s *ComposeService) SaveDraft(ctx context.Context, userID int64, email *Com
 			{
 				"Email/set",
 				map[string]interface{}{
-					"accountId": accountID,
+					"accountId": auth.AccountID,
 					"create": map[string]interface{}{
 						"draft": emailCreate,
 					},
@@ -385,7 +497,7 @@ func (s *ComposeService) SaveDraft(ctx context.Context, userID int64, email *Com
 		},
 	}
 
-	response, err := s.jmap.Call(ctx, identity.Email, password, request)
+	response, err := s.jmap.Call(ctx, auth.Username, auth.Password, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to save draft: %w", err)
 	}
@@ -401,7 +513,7 @@ func (s *ComposeService) SaveDraft(ctx context.Context, userID int64, email *Com
 			if created, ok := dataMap["created"].(map[string]interface{}); ok {
 				if draft, ok := created["draft"].(map[string]interface{}); ok {
 					if id, ok := draft["id"].(string); ok {
-						result.ID = fmt.Sprintf("%d:%s", identity.ID, id)
+						result.ID = formatUnifiedID(identity.ID, id)
 					}
 				}
 			}
@@ -426,24 +538,13 @@ func (s *ComposeService) UpdateDraft(ctx context.Context, userID int64, draftID
 		return nil, fmt.Errorf("invalid identity: %w", err)
 	}
 
-	password, err := s.getIdentityPassword(ctx, identity.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
+	auth, err := s.identity.JMAPAuth(ctx, identity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get JMAP session: %w", err)
-	}
-
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+		return nil, err
 	}
 
 	// Find Drafts mailbox
-	mailboxes, err := s.jmap.GetMailboxes(ctx, identity.Email, password, accountID)
+	mailboxes, err := s.jmap.GetMailboxes(ctx, auth.Username, auth.Password, auth.AccountID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get mailboxes: %w", err)
 	}
@@ -474,7 +575,7 @@ func (s *ComposeService) UpdateDraft(ctx context.Context, userID int64, draftID
 			{
 				"Email/set",
 				map[string]interface{}{
-					"accountId": accountID,
+					"accountId": auth.AccountID,
 					"destroy":   []string{jmapDraftID},
 					"create": map[string]interface{}{
 						"draft": emailCreate,
@@ -485,7 +586,7 @@ func (s *ComposeService) UpdateDraft(ctx context.Context, userID int64, draftID
 		},
 	}
 
-	response, err := s.jmap.Call(ctx, identity.Email, password, request)
+	response, err := s.jmap.Call(ctx, auth.Username, auth.Password, request)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update draft: %w", err)
 	}
@@ -500,7 +601,7 @@ func (s *ComposeService) UpdateDraft(ctx context.Context, userID int64, draftID
 			if created, ok := dataMap["created"].(map[string]interface{}); ok {
 				if draft, ok := created["draft"].(map[string]interface{}); ok {
 					if id, ok := draft["id"].(string); ok {
-						result.ID = fmt.Sprintf("%d:%s", identity.ID, id)
+						result.ID = formatUnifiedID(identity.ID, id)
 					}
 				}
 			}
@@ -522,23 +623,12 @@ func (s *ComposeService) DeleteDraft(ctx context.Context, userID int64, draftID
 		return fmt.Errorf("invalid identity: %w", err)
 	}
 
-	password, err := s.getIdentityPassword(ctx, identity.ID)
-	if err != nil {
-		return fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
+	auth, err := s.identity.JMAPAuth(ctx, identity)
 	if err != nil {
-		return fmt.Errorf("failed to get JMAP session: %w", err)
-	}
-
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+		return err
 	}
 
-	return s.jmap.DeleteEmails(ctx, identity.Email, password, accountID, []string{jmapDraftID}, true)
+	return s.jmap.DeleteEmails(ctx, auth.Username, auth.Password, auth.AccountID, []string{jmapDraftID}, true)
 }
 
 // GetReplyContext gets context for replying to an email
@@ -553,24 +643,13 @@ func (s *ComposeService) GetReplyContext(ctx context.Context, userID int64, emai
 		return nil, fmt.Errorf("invalid identity: %w", err)
 	}
 
-	password, err := s.getIdentityPassword(ctx, identity.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
+	auth, err := s.identity.JMAPAuth(ctx, identity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get JMAP session: %w", err)
-	}
-
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+		return nil, err
 	}
 
 	// Get the original email
-	emails, err := s.jmap.GetEmails(ctx, identity.Email, password, accountID, []string{jmapEmailID}, []string{
+	emails, err := s.jmap.GetEmails(ctx, auth.Username, auth.Password, auth.AccountID, []string{jmapEmailID}, []string{
 		"id", "from", "to", "cc", "subject", "messageId", "inReplyTo", "references",
 	})
 	if err != nil {
@@ -610,6 +689,9 @@ func (s *ComposeService) GetReplyContext(ctx context.Context, userID int64, emai
 		}
 	}
 
+	s.applySignature(ctx, identity, reply)
+	reply.AwayRecipients = s.awayRecipients(ctx, identity, reply)
+
 	return reply, nil
 }
 
@@ -625,24 +707,13 @@ func (s *ComposeService) GetForwardContext(ctx context.Context, userID int64, em
 		return nil, fmt.Errorf("invalid identity: %w", err)
 	}
 
-	password, err := s.getIdentityPassword(ctx, identity.ID)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
+	auth, err := s.identity.JMAPAuth(ctx, identity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get JMAP session: %w", err)
-	}
-
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+		return nil, err
 	}
 
 	// Get the original email with body
-	emails, err := s.jmap.GetEmails(ctx, identity.Email, password, accountID, []string{jmapEmailID}, []string{
+	emails, err := s.jmap.GetEmails(ctx, auth.Username, auth.Password, auth.AccountID, []string{jmapEmailID}, []string{
 		"id", "from", "to", "cc", "subject", "textBody", "htmlBody", "attachments", "receivedAt",
 	})
 	if err != nil {
@@ -663,44 +734,51 @@ func (s *ComposeService) GetForwardContext(ctx context.Context, userID int64, em
 		// For now, we just provide the context
 	}
 
+	s.applySignature(ctx, identity, forward)
+
 	return forward, nil
 }
 
-// UploadAttachment uploads an attachment and returns a blob reference
-func (s *ComposeService) UploadAttachment(ctx context.Context, userID int64, identityID int64, data []byte, filename, contentType string) (*AttachmentRef, error) {
+// ForwardReceived forwards a received email from the identity it was received
+// by, as inbox filters do
+func (s *ComposeService) ForwardReceived(ctx context.Context, userID, identityID, emailID int64, to string) error {
 	identity, err := s.getIdentityByID(ctx, userID, identityID)
 	if err != nil {
-		return nil, fmt.Errorf("invalid identity: %w", err)
+		return fmt.Errorf("invalid identity: %w", err)
 	}
 
-	password, err := s.getIdentityPassword(ctx, identity.ID)
+	var fromEmail, subject string
+	var fromName, textBody, htmlBody sql.NullString
+	var toEmails pq.StringArray
+	var receivedAt time.Time
+	err = s.db.QueryRowContext(ctx, `
+		SELECT from_email, from_name, to_emails, subject, text_body, html_body, received_at
+		FROM received_emails WHERE id = $1 AND identity_id = $2
+	`, emailID, identityID).Scan(&fromEmail, &fromName, &toEmails, &subject, &textBody, &htmlBody, &receivedAt)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get identity password: %w", err)
+		return fmt.Errorf("failed to get email: %w", err)
 	}
 
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get JMAP session: %w", err)
+	from := fromEmail
+	if fromName.String != "" {
+		from = fmt.Sprintf("%s <%s>", fromName.String, fromEmail)
 	}
+	header := fmt.Sprintf("---------- Forwarded message ---------\nFrom: %s\nDate: %s\nSubject: %s\nTo: %s\n\n",
+		from, receivedAt.Format(time.RFC1123Z), subject, strings.Join(toEmails, ", "))
 
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+	email := &ComposeEmail{
+		IdentityID: identity.ID,
+		From:       EmailAddress{Name: identity.DisplayName, Email: identity.Email},
+		To:         []EmailAddress{{Email: to}},
+		Subject:    s.buildForwardSubject(subject),
+		TextBody:   header + textBody.String,
 	}
-
-	// Upload blob via JMAP upload endpoint
-	blobID, err := s.uploadBlob(ctx, session.UploadUrl, identity.Email, password, accountID, data, contentType)
-	if err != nil {
-		return nil, fmt.Errorf("failed to upload attachment: %w", err)
+	if htmlBody.String != "" {
+		email.HTMLBody = "<div>" + strings.ReplaceAll(html.EscapeString(header), "\n", "<br>") + "</div>" + htmlBody.String
 	}
 
-	return &AttachmentRef{
-		BlobID: blobID,
-		Name:   filename,
-		Type:   contentType,
-		Size:   len(data),
-	}, nil
+	_, err = s.send(ctx, identity, email)
+	return err
 }
 
 // Helper methods
@@ -849,40 +927,6 @@ func (s *ComposeService) buildReferences(refs, messageIDs []string) []string {
 	return result
 }
 
-func (s *ComposeService) uploadBlob(ctx context.Context, uploadUrl, email, password, accountID string, data []byte, contentType string) (string, error) {
-	// Replace {accountId} placeholder in upload URL
-	_ = strings.Replace(uploadUrl, "{accountId}", accountID, 1)
-
-	// TODO: Implement actual HTTP upload
-	// For now, return a placeholder - this would need proper implementation
-	// with multipart form or direct PUT to the upload URL
-
-	// Encode data as base64 for now (simplified)
-	_ = base64.StdEncoding.EncodeToString(data)
-
-	// This is a placeholder - actual implementation would POST to upload URL
-	return "blob_placeholder_" + fmt.Sprintf("%d", len(data)), nil
-}
-
-func (s *ComposeService) getIdentityPassword(ctx context.Context, identityID int64) (string, error) {
-	var encryptedPassword sql.NullString
-	err := s.db.QueryRowContext(ctx, "SELECT encrypted_password FROM identities WHERE id = $1", identityID).Scan(&encryptedPassword)
-	if err != nil {
-		return "", fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	if !encryptedPassword.Valid || encryptedPassword.String == "" {
-		return "", fmt.Errorf("identity password not configured")
-	}
-
-	password, err := crypto.Decrypt(encryptedPassword.String, s.cfg.EncryptionKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to decrypt identity password: %w", err)
-	}
-
-	return password, nil
-}
-
 func (s *ComposeService) getIdentityByID(ctx context.Context, userID int64, identityID int64) (*model.Identity, error) {
 	var identity model.Identity
 	var stalwartAcctID sql.NullString
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// Compose attachments are uploaded where the email will be sent from: to the
+// identity's Stalwart account, whose blob the JMAP email references, or to the
+// attachments bucket when sending through SES, from where they're added to the
+// message. Uploads are recorded by checksum, so uploading the same file again
+// returns the blob already uploaded.
+
+// Compose attachment storages
+const (
+	attachmentStorageJMAP = "jmap"
+	attachmentStorageS3   = "s3"
+)
+
+// jmapBlobReuseWindow is how long an uploaded Stalwart blob is reused for. The
+// server may delete blobs no email references after an hour (RFC 8620 section
+// 6.1), so older ones are uploaded again.
+const jmapBlobReuseWindow = 50 * time.Minute
+
+// composeAttachmentPrefix is the attachments bucket prefix of a user's compose
+// attachments
+func composeAttachmentPrefix(userID int64) string {
+	return fmt.Sprintf("compose/%d/", userID)
+}
+
+// UploadAttachment validates an attachment and uploads it for an identity's
+// emails, returning the reference to send it with
+func (s *ComposeService) UploadAttachment(ctx context.Context, userID int64, identityID int64, data []byte, filename, contentType string) (*AttachmentRef, error) {
+	identity, err := s.getIdentityByID(ctx, userID, identityID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+
+	filename = filepath.Base(strings.TrimSpace(filename))
+	if filename == "" || filename == "." || filename == "/" {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "filename required")
+	}
+	if len(data) == 0 {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "file is empty")
+	}
+	if int64(len(data)) > s.MaxAttachmentSize() {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "file exceeds maximum size of %dMB", s.cfg.AttachmentMaxSizeMB)
+	}
+	contentType, err = validateAttachmentType(filename, contentType, data)
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	checksum := hex.EncodeToString(sum[:])
+	ref := &AttachmentRef{
+		Name:     filename,
+		Type:     contentType,
+		Size:     len(data),
+		Checksum: checksum,
+	}
+
+	storage := attachmentStorageJMAP
+	if s.emailProvider != nil {
+		storage = attachmentStorageS3
+	}
+
+	// Same file uploaded again
+	var since time.Time
+	if storage == attachmentStorageJMAP {
+		since = time.Now().Add(-jmapBlobReuseWindow)
+	}
+	err = s.db.QueryRowContext(ctx, `
+		SELECT blob_id FROM compose_attachments
+		WHERE identity_id = $1 AND storage = $2 AND checksum = $3 AND created_at >= $4
+		ORDER BY created_at DESC
+		LIMIT 1
+	`, identity.ID, storage, checksum, since).Scan(&ref.BlobID)
+	if err == nil {
+		return ref, nil
+	}
+	if err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to look up attachment: %w", err)
+	}
+
+	if storage == attachmentStorageS3 {
+		ref.BlobID, err = s.uploadToBucket(ctx, userID, checksum, contentType, data)
+	} else {
+		ref.BlobID, err = s.uploadToJMAP(ctx, identity, contentType, data)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO compose_attachments (user_id, identity_id, storage, checksum, filename, content_type, size, blob_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+	`, userID, identity.ID, storage, checksum, filename, contentType, len(data), ref.BlobID)
+	if err != nil {
+		// The upload itself succeeded, so it can still be sent
+		fmt.Printf("Warning: Failed to record attachment upload: %v\n", err)
+	}
+
+	return ref, nil
+}
+
+// MaxAttachmentSize returns the largest accepted attachment in bytes
+func (s *ComposeService) MaxAttachmentSize() int64 {
+	return int64(s.cfg.AttachmentMaxSizeMB) * 1024 * 1024
+}
+
+// uploadToBucket stores an attachment in the attachments bucket, addressed by
+// its checksum so the object is only uploaded once
+func (s *ComposeService) uploadToBucket(ctx context.Context, userID int64, checksum, contentType string, data []byte) (string, error) {
+	if s.attachments == nil {
+		return "", fmt.Errorf("attachment storage is not configured")
+	}
+	key := composeAttachmentPrefix(userID) + checksum
+	exists, err := s.attachments.Exists(ctx, key)
+	if err != nil {
+		return "", err
+	}
+	if !exists {
+		if err := s.attachments.Put(ctx, key, contentType, data); err != nil {
+			return "", err
+		}
+	}
+	return key, nil
+}
+
+// uploadToJMAP uploads an attachment to the identity's Stalwart account
+func (s *ComposeService) uploadToJMAP(ctx context.Context, identity *model.Identity, contentType string, data []byte) (string, error) {
+	auth, err := s.identity.JMAPAuth(ctx, identity)
+	if err != nil {
+		return "", err
+	}
+	blobID, err := s.jmap.UploadBlob(ctx, auth.Session.UploadUrl, auth.Username, auth.Password, auth.AccountID, data, contentType)
+	if err != nil {
+		return "", fmt.Errorf("failed to upload attachment: %w", err)
+	}
+	return blobID, nil
+}
+
+// loadAttachments downloads the attachments of an email sent through SES from
+// the attachments bucket. Only the sender's own uploads can be attached.
+func (s *ComposeService) loadAttachments(ctx context.Context, identity *model.Identity, refs []AttachmentRef) ([]provider.Attachment, error) {
+	if len(refs) == 0 {
+		return nil, nil
+	}
+	if len(refs) > maxAttachmentsPerEmail {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "at most %d attachments allowed per email", maxAttachmentsPerEmail)
+	}
+	if s.attachments == nil {
+		return nil, fmt.Errorf("attachment storage is not configured")
+	}
+
+	prefix := composeAttachmentPrefix(identity.UserID)
+	attachments := make([]provider.Attachment, 0, len(refs))
+	total := 0
+	for _, ref := range refs {
+		if !strings.HasPrefix(ref.BlobID, prefix) {
+			return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "attachment %s not found", ref.Name)
+		}
+		data, err := s.attachments.Get(ctx, ref.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		total += len(data)
+		if total > maxAttachmentsTotalSize {
+			return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeAttachmentInvalid, "attachments exceed total size of %dMB", maxAttachmentsTotalSize/1024/1024)
+		}
+		att := provider.Attachment{
+			Filename:    ref.Name,
+			ContentType: ref.Type,
+			Data:        data,
+		}
+		if ref.Disposition == "inline" {
+			att.ContentID = normalizeCID(ref.CID)
+		}
+		attachments = append(attachments, att)
+	}
+	return attachments, nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+)
+
+// RecipientAway is a recipient of the sender's org whose auto-reply is on, so
+// the sender knows they're away before they send
+type RecipientAway struct {
+	Email   string     `json:"email"`
+	Name    string     `json:"name,omitempty"`
+	Subject string     `json:"subject"`         // Of the auto-reply
+	Until   *time.Time `json:"until,omitempty"` // When the auto-reply ends, if it does
+}
+
+// awayRecipients returns the recipients of an email that are identities of the
+// sender's org with an auto-reply running for them. Checking is best effort:
+// a failure leaves the warning out rather than the email.
+func (s *ComposeService) awayRecipients(ctx context.Context, identity *model.Identity, email *ComposeEmail) []RecipientAway {
+	var addresses []string
+	for _, list := range [][]EmailAddress{email.To, email.Cc, email.Bcc} {
+		for _, addr := range list {
+			addresses = append(addresses, strings.ToLower(strings.TrimSpace(addr.Email)))
+		}
+	}
+	if len(addresses) == 0 {
+		return nil
+	}
+
+	// An auto-reply with no identities runs for all of its user's
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (LOWER(i.email)) i.email, COALESCE(i.display_name, ''), ar.subject, ar.end_date
+		FROM identities i
+		JOIN domains d ON d.id = i.domain_id
+		JOIN auto_replies ar ON ar.user_id = i.user_id AND ar.org_id = d.org_id
+		WHERE d.org_id = (SELECT org_id FROM domains WHERE id = $1)
+		  AND LOWER(i.email) = ANY($2) AND i.id <> $3
+		  AND ar.active = true AND ar.start_date <= NOW() AND (ar.end_date IS NULL OR ar.end_date >= NOW())
+		  AND (COALESCE(cardinality(ar.identity_ids), 0) = 0 OR i.id = ANY(ar.identity_ids))
+		ORDER BY LOWER(i.email), ar.end_date DESC NULLS FIRST
+	`, identity.DomainID, pq.Array(addresses), identity.ID)
+	if err != nil {
+		log.Printf("Failed to check auto-replies of recipients: %v", err)
+		return nil
+	}
+	defer rows.Close()
+
+	var away []RecipientAway
+	for rows.Next() {
+		var recipient RecipientAway
+		if err := rows.Scan(&recipient.Email, &recipient.Name, &recipient.Subject, &recipient.Until); err != nil {
+			continue
+		}
+		away = append(away, recipient)
+	}
+	return away
+}
+
+// withAwayRecipients adds the recipients that are away to an error of the
+// outbound rules, so the sender sees both before sending again
+func withAwayRecipients(err error, away []RecipientAway) error {
+	var ruleErr *OutboundRuleError
+	if errors.As(err, &ruleErr) {
+		ruleErr.AwayRecipients = away
+	}
+	return err
+}
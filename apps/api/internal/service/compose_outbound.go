@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/outboundrules"
+)
+
+// OutboundRuleError is returned when the org's outbound rules stop an email:
+// it matched a blocking rule, or needs the sender to confirm it and send it
+// again with confirmed set
+type OutboundRuleError struct {
+	Result         outboundrules.Result
+	AwayRecipients []RecipientAway // Recipients of the org whose auto-reply is on
+}
+
+func (e *OutboundRuleError) Error() string {
+	findings := e.Result.Blocked
+	prefix := "email blocked by outbound rules: "
+	if len(findings) == 0 {
+		findings = e.Result.Confirm
+		prefix = "email needs confirmation: "
+	}
+	details := make([]string, len(findings))
+	for i, f := range findings {
+		details[i] = f.Detail
+	}
+	return prefix + strings.Join(details, "; ")
+}
+
+func (e *OutboundRuleError) ErrorCode() string {
+	if len(e.Result.Blocked) > 0 {
+		return apierror.CodeContentBlocked
+	}
+	return apierror.CodeConfirmationRequired
+}
+
+func (e *OutboundRuleError) HTTPStatus() int {
+	if len(e.Result.Blocked) > 0 {
+		return http.StatusBadRequest
+	}
+	return http.StatusConflict
+}
+
+// applyOutboundRules checks an email against its sender's org rules before it
+// is sent or scheduled, then appends the org's disclaimer
+func (s *ComposeService) applyOutboundRules(ctx context.Context, identity *model.Identity, email *ComposeEmail) error {
+	var orgID int64
+	if err := s.db.QueryRowContext(ctx, `SELECT org_id FROM domains WHERE id = $1`, identity.DomainID).Scan(&orgID); err != nil {
+		return fmt.Errorf("failed to get organization: %w", err)
+	}
+	policy := outboundrules.Load(ctx, s.db, orgID)
+	if len(policy.Rules) == 0 && !policy.ConfirmExternal && policy.Disclaimer.Text == "" && policy.Disclaimer.HTML == "" {
+		return nil
+	}
+
+	var domains []string
+	rows, err := s.db.QueryContext(ctx, `SELECT name FROM domains WHERE org_id = $1`, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to get organization domains: %w", err)
+	}
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err == nil {
+			domains = append(domains, name)
+		}
+	}
+	rows.Close()
+
+	msg := outboundrules.Message{
+		Subject:  email.Subject,
+		TextBody: email.TextBody,
+		HTMLBody: email.HTMLBody,
+	}
+	for _, list := range [][]EmailAddress{email.To, email.Cc, email.Bcc} {
+		for _, addr := range list {
+			msg.Recipients = append(msg.Recipients, addr.Email)
+		}
+	}
+	for _, att := range email.Attachments {
+		msg.AttachmentNames = append(msg.AttachmentNames, att.Name)
+	}
+
+	result := policy.Check(msg, domains)
+	if len(result.Blocked) > 0 || (len(result.Confirm) > 0 && !email.Confirmed) {
+		return &OutboundRuleError{Result: result}
+	}
+
+	if !policy.Disclaimer.ExternalOnly || len(result.External) > 0 {
+		email.TextBody, email.HTMLBody = outboundrules.AppendDisclaimer(email.TextBody, email.HTMLBody, policy.Disclaimer)
+	}
+	return nil
+}
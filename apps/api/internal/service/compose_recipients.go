@@ -0,0 +1,137 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Recipient suggestions complete addresses as they're typed in the composer.
+// They come from whom the user has sent to, who has emailed them and the org's
+// contacts, ranked by how often and how recently each was emailed.
+
+const (
+	// defaultRecipientSuggestions and maxRecipientSuggestions bound how many
+	// suggestions are returned
+	defaultRecipientSuggestions = 10
+	maxRecipientSuggestions     = 50
+	// recipientHistoryWindow is how far back received emails count
+	recipientHistoryWindow = 365 * 24 * time.Hour
+)
+
+// RecipientSuggestion is an address suggested for an email being composed
+type RecipientSuggestion struct {
+	Email         string     `json:"email"`
+	Name          string     `json:"name,omitempty"`
+	SentCount     int        `json:"sentCount"`
+	ReceivedCount int        `json:"receivedCount"`
+	IsContact     bool       `json:"isContact"`
+	LastUsedAt    *time.Time `json:"lastUsedAt,omitempty"`
+}
+
+// recordRecipients counts the recipients of a sent email towards the sender's
+// suggestions. The email has been sent by then, so failures are only reported.
+func (s *ComposeService) recordRecipients(ctx context.Context, userID int64, email *ComposeEmail) {
+	seen := make(map[string]bool)
+	for _, list := range [][]EmailAddress{email.To, email.Cc, email.Bcc} {
+		for _, addr := range list {
+			address := strings.ToLower(strings.TrimSpace(addr.Email))
+			if address == "" || seen[address] {
+				continue
+			}
+			seen[address] = true
+			_, err := s.db.ExecContext(ctx, `
+				INSERT INTO recent_recipients (user_id, email, name, send_count, last_sent_at)
+				VALUES ($1, $2, NULLIF($3, ''), 1, NOW())
+				ON CONFLICT (user_id, email) DO UPDATE SET
+					name = COALESCE(EXCLUDED.name, recent_recipients.name),
+					send_count = recent_recipients.send_count + 1,
+					last_sent_at = NOW()
+			`, userID, address, strings.TrimSpace(addr.Name))
+			if err != nil {
+				fmt.Printf("Warning: Failed to record recipient %s: %v\n", address, err)
+			}
+		}
+	}
+}
+
+// SuggestRecipients returns the addresses matching what's typed so far, best
+// first. Addresses are scored by the emails sent to them, which count thrice,
+// and received from them, plus one for contacts, and the score halves when
+// they were last emailed a month ago. With nothing typed the most used
+// addresses are returned.
+func (s *ComposeService) SuggestRecipients(ctx context.Context, userID, orgID int64, query string, limit int) ([]RecipientSuggestion, error) {
+	if limit <= 0 {
+		limit = defaultRecipientSuggestions
+	}
+	if limit > maxRecipientSuggestions {
+		limit = maxRecipientSuggestions
+	}
+	query = strings.TrimSpace(query)
+	// Matches the start of the address, the name or a word of the name
+	prefix := escapeLike(strings.ToLower(query)) + "%"
+	word := "% " + prefix
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH candidates AS (
+			SELECT email, COALESCE(name, '') AS name, send_count AS sent, 0 AS received,
+				false AS contact, last_sent_at AS last_at
+			FROM recent_recipients
+			WHERE user_id = $1 AND (email LIKE $2 OR LOWER(name) LIKE $2 OR LOWER(name) LIKE $3)
+
+			UNION ALL
+			SELECT LOWER(re.from_email), COALESCE(MAX(re.from_name), ''), 0, COUNT(*)::int,
+				false, MAX(re.received_at)
+			FROM received_emails re
+			JOIN identities i ON i.id = re.identity_id
+			WHERE i.user_id = $1 AND re.received_at >= $5
+				AND re.folder NOT IN ('sent', 'drafts', 'spam', 'quarantine') AND re.is_spam = false
+				AND (LOWER(re.from_email) LIKE $2 OR LOWER(re.from_name) LIKE $2 OR LOWER(re.from_name) LIKE $3)
+			GROUP BY LOWER(re.from_email)
+
+			UNION ALL
+			SELECT LOWER(c.email), TRIM(COALESCE(c.first_name, '') || ' ' || COALESCE(c.last_name, '')), 0, 0,
+				true, NULL::timestamptz
+			FROM contacts c
+			WHERE c.org_id = $4 AND c.status NOT IN ('bounced', 'complained')
+				AND (LOWER(c.email) LIKE $2 OR LOWER(c.first_name) LIKE $2 OR LOWER(c.last_name) LIKE $2
+					OR LOWER(TRIM(COALESCE(c.first_name, '') || ' ' || COALESCE(c.last_name, ''))) LIKE $2)
+		)
+		SELECT c.email,
+			COALESCE((ARRAY_AGG(c.name ORDER BY c.sent DESC, c.last_at DESC NULLS LAST) FILTER (WHERE c.name <> ''))[1], ''),
+			SUM(c.sent)::int, SUM(c.received)::int, BOOL_OR(c.contact), MAX(c.last_at)
+		FROM candidates c
+		WHERE c.email NOT IN (SELECT LOWER(email) FROM identities WHERE user_id = $1)
+		GROUP BY c.email
+		ORDER BY (SUM(c.sent) * 3 + SUM(c.received) + CASE WHEN BOOL_OR(c.contact) THEN 1 ELSE 0 END)
+			/ (1 + COALESCE(EXTRACT(EPOCH FROM NOW() - MAX(c.last_at)) / 86400, 365) / 30) DESC,
+			c.email
+		LIMIT $6
+	`, userID, prefix, word, orgID, time.Now().Add(-recipientHistoryWindow), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to suggest recipients: %w", err)
+	}
+	defer rows.Close()
+
+	suggestions := []RecipientSuggestion{}
+	for rows.Next() {
+		var suggestion RecipientSuggestion
+		var lastUsedAt sql.NullTime
+		if err := rows.Scan(&suggestion.Email, &suggestion.Name, &suggestion.SentCount, &suggestion.ReceivedCount,
+			&suggestion.IsContact, &lastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan recipient: %w", err)
+		}
+		if lastUsedAt.Valid {
+			suggestion.LastUsedAt = &lastUsedAt.Time
+		}
+		suggestions = append(suggestions, suggestion)
+	}
+	return suggestions, rows.Err()
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
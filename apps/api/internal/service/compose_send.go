@@ -0,0 +1,369 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// Undo send holds a user's emails for the delay they chose before sending
+// them, so sending can still be cancelled, and send later holds an email
+// until the time the user picked. Held emails are kept in compose_sends and
+// sent by a worker task once due, through SES or JMAP as unheld ones are.
+// Whichever of the task and a cancellation moves the email out of pending
+// first wins. Scheduled emails can be edited until then, moving their task.
+
+// Undo send delays users can choose; 0 turns holding emails off
+const (
+	MinUndoSendSeconds = 5
+	MaxUndoSendSeconds = 30
+)
+
+// Compose send statuses
+const (
+	ComposeSendPending   = "pending"
+	ComposeSendSending   = "sending"
+	ComposeSendSent      = "sent"
+	ComposeSendFailed    = "failed"
+	ComposeSendCancelled = "cancelled"
+)
+
+// ComposeSend is an email held for undo send or scheduled to be sent later
+type ComposeSend struct {
+	ID        string           `json:"id"`
+	Status    string           `json:"status"`
+	Scheduled bool             `json:"scheduled"`
+	SendAt    time.Time        `json:"sendAt"`
+	Result    *SendEmailResult `json:"result,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Email     *ComposeEmail    `json:"email,omitempty"` // When listed, and once cancelled to edit it again
+}
+
+// undoSendDelay returns how long a user's emails are held before they're sent
+func (s *ComposeService) undoSendDelay(ctx context.Context, userID int64) time.Duration {
+	var seconds int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(undo_send_seconds, 0) FROM user_settings WHERE user_id = $1
+	`, userID).Scan(&seconds)
+	if err != nil {
+		return 0
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// checkTracking rejects tracking when emails are sent through JMAP, which
+// keeps no sent copy for opens and clicks to be recorded on
+func (s *ComposeService) checkTracking(email *ComposeEmail) error {
+	if (email.TrackOpens || email.TrackClicks) && s.emailProvider == nil {
+		return apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "trackOpens and trackClicks need SES sending, which isn't configured")
+	}
+	return nil
+}
+
+// ScheduleEmail holds an email to be sent at sendAt. It shows in the
+// Scheduled folder until then.
+func (s *ComposeService) ScheduleEmail(ctx context.Context, userID int64, email *ComposeEmail, sendAt time.Time) (*SendEmailResult, error) {
+	if !sendAt.After(time.Now()) {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "sendAt must be in the future")
+	}
+	if err := s.checkTracking(email); err != nil {
+		return nil, err
+	}
+	identity, err := s.getIdentityByID(ctx, userID, email.IdentityID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	email.From = EmailAddress{
+		Name:  identity.DisplayName,
+		Email: identity.Email,
+	}
+	if !email.NoSignature {
+		s.applySignature(ctx, identity, email)
+	}
+	away := s.awayRecipients(ctx, identity, email)
+	if err := s.applyOutboundRules(ctx, identity, email); err != nil {
+		return nil, withAwayRecipients(err, away)
+	}
+
+	result, err := s.holdSend(ctx, userID, identity, email, sendAt, true)
+	if err != nil {
+		return nil, err
+	}
+	result.AwayRecipients = away
+	return result, nil
+}
+
+// holdSend keeps an email back until sendAt and has the worker send it then
+func (s *ComposeService) holdSend(ctx context.Context, userID int64, identity *model.Identity, email *ComposeEmail, sendAt time.Time, scheduled bool) (*SendEmailResult, error) {
+	data, err := json.Marshal(email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	var sendID int64
+	var sendUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO compose_sends (user_id, identity_id, email, status, scheduled, send_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, uuid
+	`, userID, identity.ID, data, ComposeSendPending, scheduled, sendAt).Scan(&sendID, &sendUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to hold email: %w", err)
+	}
+
+	if err := s.enqueueSend(userID, sendID, sendAt); err != nil {
+		if _, delErr := s.db.ExecContext(ctx, `DELETE FROM compose_sends WHERE id = $1`, sendID); delErr != nil {
+			fmt.Printf("Warning: Failed to remove held email %d: %v\n", sendID, delErr)
+		}
+		if scheduled {
+			return nil, fmt.Errorf("failed to schedule email: %w", err)
+		}
+		// Nothing would send it later, so send it now rather than lose it
+		fmt.Printf("Warning: Failed to queue held email %d, sending it now: %v\n", sendID, err)
+		return s.send(ctx, identity, email)
+	}
+
+	return &SendEmailResult{
+		Status: ComposeSendPending,
+		SendID: sendUUID,
+		SendAt: &sendAt,
+	}, nil
+}
+
+// enqueueSend has the worker send a held email at sendAt
+func (s *ComposeService) enqueueSend(userID, sendID int64, sendAt time.Time) error {
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		return err
+	}
+	defer queueClient.Close()
+	_, err = queueClient.EnqueueComposeSend(&worker.ComposeSendPayload{SendID: sendID, UserID: userID}, sendAt)
+	return err
+}
+
+// UpdateScheduledSend changes a scheduled email and when it's sent, as long as
+// it hasn't started sending
+func (s *ComposeService) UpdateScheduledSend(ctx context.Context, userID int64, sendUUID string, email *ComposeEmail, sendAt time.Time) (*ComposeSend, error) {
+	if !sendAt.After(time.Now()) {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "sendAt must be in the future")
+	}
+	if err := s.checkTracking(email); err != nil {
+		return nil, err
+	}
+	identity, err := s.getIdentityByID(ctx, userID, email.IdentityID)
+	if err != nil {
+		return nil, fmt.Errorf("invalid identity: %w", err)
+	}
+	email.From = EmailAddress{
+		Name:  identity.DisplayName,
+		Email: identity.Email,
+	}
+	if !email.NoSignature {
+		s.applySignature(ctx, identity, email)
+	}
+	if err := s.applyOutboundRules(ctx, identity, email); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(email)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode email: %w", err)
+	}
+
+	existing, err := s.GetSend(ctx, userID, sendUUID)
+	if err != nil {
+		return nil, err
+	}
+	if !existing.Scheduled {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "only scheduled emails can be edited")
+	}
+	if existing.Status != ComposeSendPending {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "the email is no longer scheduled")
+	}
+
+	// Queue the new time first: the task queued for the old time finds the
+	// email not yet due and leaves it, so the email is never left without one
+	var sendID int64
+	if err := s.db.QueryRowContext(ctx, `SELECT id FROM compose_sends WHERE uuid::text = $1`, sendUUID).Scan(&sendID); err != nil {
+		return nil, fmt.Errorf("failed to get send: %w", err)
+	}
+	if err := s.enqueueSend(userID, sendID, sendAt); err != nil {
+		return nil, fmt.Errorf("failed to reschedule email: %w", err)
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE compose_sends SET identity_id = $3, email = $4, send_at = $5, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND status = $6
+	`, sendID, userID, identity.ID, data, sendAt, ComposeSendPending)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update scheduled email: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "the email is no longer scheduled")
+	}
+
+	return &ComposeSend{
+		ID:        sendUUID,
+		Status:    ComposeSendPending,
+		Scheduled: true,
+		SendAt:    sendAt,
+		Email:     email,
+	}, nil
+}
+
+// ListScheduled returns the emails in a user's Scheduled folder, soonest
+// first, optionally of one identity
+func (s *ComposeService) ListScheduled(ctx context.Context, userID, identityID int64) ([]ComposeSend, error) {
+	query := `
+		SELECT uuid, status, scheduled, send_at, email
+		FROM compose_sends
+		WHERE user_id = $1 AND scheduled = true AND status = $2
+	`
+	args := []interface{}{userID, ComposeSendPending}
+	if identityID > 0 {
+		query += " AND identity_id = $3"
+		args = append(args, identityID)
+	}
+	query += " ORDER BY send_at, id"
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list scheduled emails: %w", err)
+	}
+	defer rows.Close()
+
+	sends := []ComposeSend{}
+	for rows.Next() {
+		var send ComposeSend
+		var data []byte
+		if err := rows.Scan(&send.ID, &send.Status, &send.Scheduled, &send.SendAt, &data); err != nil {
+			return nil, fmt.Errorf("failed to scan scheduled email: %w", err)
+		}
+		send.Email = &ComposeEmail{}
+		if err := json.Unmarshal(data, send.Email); err != nil {
+			continue
+		}
+		sends = append(sends, send)
+	}
+	return sends, nil
+}
+
+// SendPending sends a held email once it's due, unless it was cancelled or
+// rescheduled for later. An
+// email that fails to send is marked failed rather than retried, as the
+// attempt may have gone out in part.
+func (s *ComposeService) SendPending(ctx context.Context, userID, sendID int64) error {
+	var identityID int64
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE compose_sends SET status = $3, updated_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND status = $4 AND send_at <= $5
+		RETURNING identity_id, email
+	`, sendID, userID, ComposeSendSending, ComposeSendPending, time.Now()).Scan(&identityID, &data)
+	if err == sql.ErrNoRows {
+		// Cancelled, rescheduled, or already taken by another attempt
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to claim held email: %w", err)
+	}
+
+	var email ComposeEmail
+	if err := json.Unmarshal(data, &email); err != nil {
+		s.finishSend(ctx, sendID, nil, fmt.Errorf("failed to decode email: %w", err))
+		return nil
+	}
+	identity, err := s.getIdentityByID(ctx, userID, identityID)
+	if err != nil {
+		s.finishSend(ctx, sendID, nil, fmt.Errorf("invalid identity: %w", err))
+		return nil
+	}
+
+	result, err := s.send(ctx, identity, &email)
+	s.finishSend(ctx, sendID, result, err)
+	return nil
+}
+
+// finishSend records how sending a held email went
+func (s *ComposeService) finishSend(ctx context.Context, sendID int64, result *SendEmailResult, sendErr error) {
+	status := ComposeSendSent
+	var resultJSON []byte
+	var errMsg sql.NullString
+	if sendErr != nil {
+		status = ComposeSendFailed
+		errMsg = sql.NullString{String: sendErr.Error(), Valid: true}
+	} else {
+		resultJSON, _ = json.Marshal(result)
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE compose_sends SET status = $2, result = $3, error = $4, updated_at = NOW()
+		WHERE id = $1
+	`, sendID, status, resultJSON, errMsg)
+	if err != nil {
+		fmt.Printf("Warning: Failed to record held email %d as %s: %v\n", sendID, status, err)
+	}
+}
+
+// GetSend returns a held email's status, with its result once sent
+func (s *ComposeService) GetSend(ctx context.Context, userID int64, sendUUID string) (*ComposeSend, error) {
+	var send ComposeSend
+	var resultJSON []byte
+	var errMsg sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT uuid, status, scheduled, send_at, result, error
+		FROM compose_sends
+		WHERE uuid::text = $1 AND user_id = $2
+	`, sendUUID, userID).Scan(&send.ID, &send.Status, &send.Scheduled, &send.SendAt, &resultJSON, &errMsg)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "send not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get send: %w", err)
+	}
+	if len(resultJSON) > 0 {
+		send.Result = &SendEmailResult{}
+		if err := json.Unmarshal(resultJSON, send.Result); err != nil {
+			send.Result = nil
+		}
+	}
+	send.Error = errMsg.String
+	return &send, nil
+}
+
+// CancelSend stops a held email from being sent and returns it, so it can be
+// edited again. Once it has started sending it can't be cancelled.
+func (s *ComposeService) CancelSend(ctx context.Context, userID int64, sendUUID string) (*ComposeSend, error) {
+	var send ComposeSend
+	var data []byte
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE compose_sends SET status = $3, updated_at = NOW()
+		WHERE uuid::text = $1 AND user_id = $2 AND status = $4
+		RETURNING uuid, status, scheduled, send_at, email
+	`, sendUUID, userID, ComposeSendCancelled, ComposeSendPending).Scan(&send.ID, &send.Status, &send.Scheduled, &send.SendAt, &data)
+	if err == sql.ErrNoRows {
+		existing, getErr := s.GetSend(ctx, userID, sendUUID)
+		if getErr != nil {
+			return nil, getErr
+		}
+		if existing.Status == ComposeSendCancelled {
+			return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "the email has already been cancelled")
+		}
+		return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "the email has already been sent")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel send: %w", err)
+	}
+
+	send.Email = &ComposeEmail{}
+	if err := json.Unmarshal(data, send.Email); err != nil {
+		return nil, fmt.Errorf("failed to decode email: %w", err)
+	}
+	return &send, nil
+}
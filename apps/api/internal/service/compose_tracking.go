@@ -0,0 +1,92 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/tracking"
+)
+
+// Emails composed in the inbox can ask for their opens and clicks to be
+// tracked, with the same signed pixel and link tokens as transactional and
+// campaign emails. Their tokens name the sent copy, which keeps the counts and
+// when the email was first seen; each event is kept in sent_email_events.
+// The whole email is tracked, not each recipient, since all of them get the
+// same body.
+
+// maxSentTrackingEvents is how many of the latest events are returned
+const maxSentTrackingEvents = 100
+
+// recordSentEvent records an open or click of a tracked sent email. A click
+// means the email was seen even when its images weren't loaded.
+func (s *TrackingService) recordSentEvent(ctx context.Context, data *tracking.Data, eventType, ipAddress, userAgent string) error {
+	opens, clicks := 1, 0
+	if eventType == "clicked" {
+		opens, clicks = 0, 1
+	}
+	_, err := s.db.ExecContext(ctx, `
+		WITH sent AS (
+			UPDATE received_emails SET
+				open_count = open_count + $2,
+				click_count = click_count + $3,
+				seen_at = COALESCE(seen_at, NOW())
+			WHERE uuid::text = $1 AND folder = 'sent' AND tracked = true
+			RETURNING id
+		)
+		INSERT INTO sent_email_events (received_email_id, event_type, link_id, url, ip_address, user_agent)
+		SELECT id, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, '') FROM sent
+	`, data.SentEmail, opens, clicks, eventType, data.LinkID, data.TargetURL, ipAddress, userAgent)
+	if err != nil {
+		return fmt.Errorf("failed to record %s event: %w", eventType, err)
+	}
+	return nil
+}
+
+// GetSentTracking returns what the tracking of a sent email recorded, latest
+// events first
+func (s *InboxService) GetSentTracking(ctx context.Context, userID int64, emailUUID string) (*model.SentTracking, error) {
+	var id int64
+	var result model.SentTracking
+	var seenAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT re.id, re.tracked, re.open_count, re.click_count, re.seen_at
+		FROM received_emails re
+		JOIN identities i ON re.identity_id = i.id
+		WHERE re.uuid::text = $1 AND re.folder = 'sent' AND `+receivedEmailAccess("$2")+`
+	`, emailUUID, userID).Scan(&id, &result.Tracked, &result.OpenCount, &result.ClickCount, &seenAt)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeEmailNotFound, "sent email not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email: %w", err)
+	}
+	if seenAt.Valid {
+		result.SeenAt = &seenAt.Time
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT event_type, COALESCE(url, ''), COALESCE(ip_address, ''), COALESCE(user_agent, ''), occurred_at
+		FROM sent_email_events
+		WHERE received_email_id = $1
+		ORDER BY occurred_at DESC
+		LIMIT $2
+	`, id, maxSentTrackingEvents)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get tracking events: %w", err)
+	}
+	defer rows.Close()
+
+	result.Events = []model.SentTrackingEvent{}
+	for rows.Next() {
+		var event model.SentTrackingEvent
+		if err := rows.Scan(&event.Type, &event.URL, &event.IPAddress, &event.UserAgent, &event.OccurredAt); err != nil {
+			return nil, fmt.Errorf("failed to scan tracking event: %w", err)
+		}
+		result.Events = append(result.Events, event)
+	}
+	return &result, rows.Err()
+}
@@ -8,14 +8,20 @@ import (
 	"strings"
 	"time"
 
+	"github.com/lib/pq"
+
 	"github.com/dublyo/mailat/api/internal/config"
 	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/contactchange"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/listevent"
 )
 
 type ContactService struct {
 	db                    *sql.DB
 	cfg                   *config.Config
 	webhookTriggerService *WebhookTriggerService
+	transactionalService  *TransactionalService
 }
 
 func NewContactService(db *sql.DB, cfg *config.Config) *ContactService {
@@ -27,6 +33,11 @@ func (s *ContactService) SetWebhookTriggerService(svc *WebhookTriggerService) {
 	s.webhookTriggerService = svc
 }
 
+// SetTransactionalService sets the service double opt-in confirmation emails go out through
+func (s *ContactService) SetTransactionalService(svc *TransactionalService) {
+	s.transactionalService = svc
+}
+
 // CreateContact creates a new contact
 func (s *ContactService) CreateContact(ctx context.Context, orgID int64, req *model.CreateContactRequest) (*model.Contact, error) {
 	// Check if contact already exists
@@ -43,8 +54,14 @@ func (s *ContactService) CreateContact(ctx context.Context, orgID int64, req *mo
 		return nil, fmt.Errorf("failed to check existing contact: %w", err)
 	}
 
+	// Check attributes against the org's contact fields
+	attributes, err := validateAttributes(ctx, s.db, orgID, req.Attributes)
+	if err != nil {
+		return nil, err
+	}
+
 	// Marshal attributes
-	attributesJSON, err := json.Marshal(req.Attributes)
+	attributesJSON, err := json.Marshal(attributes)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal attributes: %w", err)
 	}
@@ -95,6 +112,9 @@ func (s *ContactService) CreateContact(ctx context.Context, orgID int64, req *mo
 				return nil, fmt.Errorf("failed to add contact to list: %w", err)
 			}
 		}
+		if err := listevent.Record(ctx, s.db, orgID, contact.ID, req.ListIDs, listevent.Subscribed, listevent.SourceAPI); err != nil {
+			return nil, err
+		}
 
 		// Update list counts
 		_, err = s.db.ExecContext(ctx, `
@@ -124,11 +144,15 @@ func (s *ContactService) CreateContact(ctx context.Context, orgID int64, req *mo
 func (s *ContactService) GetContact(ctx context.Context, orgID int64, contactUUID string) (*model.Contact, error) {
 	var contact model.Contact
 	var attributesJSON []byte
+	var verification model.ContactVerification
+	var verifiedAt sql.NullTime
 
 	err := s.db.QueryRowContext(ctx, `
 		SELECT id, uuid, org_id, email, first_name, last_name, attributes,
 			status, consent_source, consent_timestamp, last_engaged_at,
-			engagement_score, created_at, updated_at
+			engagement_score, created_at, updated_at,
+			COALESCE(verification_status, ''), COALESCE(verification_reasons, '{}'), verified_at,
+			COALESCE(tags, '{}')
 		FROM contacts
 		WHERE org_id = $1 AND uuid = $2
 	`, orgID, contactUUID).Scan(
@@ -137,6 +161,8 @@ func (s *ContactService) GetContact(ctx context.Context, orgID int64, contactUUI
 		&contact.Status, &contact.ConsentSource, &contact.ConsentTimestamp,
 		&contact.LastEngagedAt, &contact.EngagementScore,
 		&contact.CreatedAt, &contact.UpdatedAt,
+		&verification.Status, pq.Array(&verification.Reasons), &verifiedAt,
+		pq.Array(&contact.Tags),
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("contact not found")
@@ -148,6 +174,10 @@ func (s *ContactService) GetContact(ctx context.Context, orgID int64, contactUUI
 	if len(attributesJSON) > 0 {
 		json.Unmarshal(attributesJSON, &contact.Attributes)
 	}
+	if verifiedAt.Valid {
+		verification.VerifiedAt = verifiedAt.Time
+		contact.Verification = &verification
+	}
 
 	// Get list memberships
 	rows, err := s.db.QueryContext(ctx, `
@@ -234,7 +264,7 @@ func (s *ContactService) ListContacts(ctx context.Context, orgID int64, req *mod
 	query := fmt.Sprintf(`
 		SELECT id, uuid, org_id, email, first_name, last_name, attributes,
 			status, consent_source, consent_timestamp, last_engaged_at,
-			engagement_score, created_at, updated_at
+			engagement_score, created_at, updated_at, COALESCE(tags, '{}')
 		%s
 		ORDER BY %s %s
 		LIMIT $%d OFFSET $%d
@@ -257,7 +287,7 @@ func (s *ContactService) ListContacts(ctx context.Context, orgID int64, req *mod
 			&c.FirstName, &c.LastName, &attributesJSON,
 			&c.Status, &c.ConsentSource, &c.ConsentTimestamp,
 			&c.LastEngagedAt, &c.EngagementScore,
-			&c.CreatedAt, &c.UpdatedAt,
+			&c.CreatedAt, &c.UpdatedAt, pq.Array(&c.Tags),
 		); err != nil {
 			continue
 		}
@@ -276,8 +306,8 @@ func (s *ContactService) ListContacts(ctx context.Context, orgID int64, req *mod
 	}, nil
 }
 
-// UpdateContact updates a contact
-func (s *ContactService) UpdateContact(ctx context.Context, orgID int64, contactUUID string, req *model.UpdateContactRequest) (*model.Contact, error) {
+// UpdateContact updates a contact, recording the changes as made by the user
+func (s *ContactService) UpdateContact(ctx context.Context, orgID, userID int64, contactUUID string, req *model.UpdateContactRequest) (*model.Contact, error) {
 	// Build update query dynamically
 	updates := []string{}
 	args := []interface{}{}
@@ -304,7 +334,11 @@ func (s *ContactService) UpdateContact(ctx context.Context, orgID int64, contact
 		argIndex++
 	}
 	if req.Attributes != nil {
-		attributesJSON, _ := json.Marshal(req.Attributes)
+		attributes, err := validateAttributes(ctx, s.db, orgID, req.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		attributesJSON, _ := json.Marshal(attributes)
 		updates = append(updates, fmt.Sprintf("attributes = $%d", argIndex))
 		args = append(args, attributesJSON)
 		argIndex++
@@ -316,22 +350,47 @@ func (s *ContactService) UpdateContact(ctx context.Context, orgID int64, contact
 
 	updates = append(updates, "updated_at = NOW()")
 
-	query := fmt.Sprintf(`
-		UPDATE contacts SET %s
-		WHERE org_id = $%d AND uuid = $%d
-		RETURNING id
-	`, strings.Join(updates, ", "), argIndex, argIndex+1)
-
-	args = append(args, orgID, contactUUID)
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
 
 	var id int64
-	err := s.db.QueryRowContext(ctx, query, args...).Scan(&id)
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM contacts WHERE org_id = $1 AND uuid = $2 FOR UPDATE
+	`, orgID, contactUUID).Scan(&id)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("contact not found")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to update contact: %w", err)
 	}
+	before, err := contactchange.Take(ctx, tx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	query := fmt.Sprintf(`
+		UPDATE contacts SET %s
+		WHERE id = $%d
+	`, strings.Join(updates, ", "), argIndex)
+	args = append(args, id)
+
+	if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("failed to update contact: %w", err)
+	}
+	if _, err := contactchange.Record(ctx, tx, orgID, id, before, contactchange.Source{Source: "api", UserID: userID}); err != nil {
+		return nil, err
+	}
+	if event, ok := listevent.StatusEvent(req.Status); ok && before["status"] != req.Status {
+		if err := listevent.RecordMemberships(ctx, tx, orgID, id, event, listevent.SourceAPI); err != nil {
+			return nil, err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to update contact: %w", err)
+	}
 
 	contact, err := s.GetContact(ctx, orgID, contactUUID)
 	if err != nil {
@@ -351,10 +410,16 @@ func (s *ContactService) UpdateContact(ctx context.Context, orgID int64, contact
 
 // DeleteContact deletes a contact
 func (s *ContactService) DeleteContact(ctx context.Context, orgID int64, contactUUID string) error {
-	result, err := s.db.ExecContext(ctx,
-		"DELETE FROM contacts WHERE org_id = $1 AND uuid = $2",
-		orgID, contactUUID,
-	)
+	// The contact's lists keep their removal, no longer linked to the contact
+	result, err := s.db.ExecContext(ctx, `
+		WITH removed AS (
+			INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+			SELECT $1, lc.list_id, NULL, $3, $4, NOW()
+			FROM list_contacts lc JOIN contacts c ON c.id = lc.contact_id
+			WHERE c.org_id = $1 AND c.uuid = $2
+		)
+		DELETE FROM contacts WHERE org_id = $1 AND uuid = $2
+	`, orgID, contactUUID, listevent.Removed, listevent.SourceAPI)
 	if err != nil {
 		return fmt.Errorf("failed to delete contact: %w", err)
 	}
@@ -374,16 +439,38 @@ func (s *ContactService) DeleteContact(ctx context.Context, orgID int64, contact
 	return nil
 }
 
-// ImportContacts bulk imports contacts
-func (s *ContactService) ImportContacts(ctx context.Context, orgID int64, req *model.ImportContactsRequest) (*model.ImportContactsResponse, error) {
+// ImportContacts bulk imports contacts, recording changes to existing ones as
+// made by the user
+func (s *ContactService) ImportContacts(ctx context.Context, orgID, userID int64, req *model.ImportContactsRequest) (*model.ImportContactsResponse, error) {
 	response := &model.ImportContactsResponse{}
 
+	fields, err := contactfield.Load(ctx, s.db, orgID)
+	if err != nil {
+		return nil, err
+	}
+
 	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to start transaction: %w", err)
 	}
 	defer tx.Rollback()
 
+	// Lists with double opt-in are joined once the contact confirms by email
+	lists, err := loadSubscribingLists(ctx, tx, orgID, req.ListIDs)
+	if err != nil {
+		return nil, err
+	}
+	newStatus := "active"
+	if needConfirmation(lists, req.SkipConfirmation) {
+		newStatus = "pending"
+	}
+	type confirmation struct {
+		contactID int64
+		email     string
+		lists     []subscribingList
+	}
+	var confirmations []confirmation
+
 	for i, row := range req.Contacts {
 		email := strings.ToLower(row.Email)
 
@@ -397,8 +484,21 @@ func (s *ContactService) ImportContacts(ctx context.Context, orgID int64, req *m
 		if err == nil {
 			// Contact exists
 			if req.UpdateExisting {
-				// Update existing contact
-				attributesJSON, _ := json.Marshal(row.Attributes)
+				// Update existing contact, keeping its attributes when the row has none
+				var attributesJSON []byte
+				if row.Attributes != nil {
+					attributes, err := contactfield.Validate(fields, row.Attributes)
+					if err != nil {
+						response.Errors = append(response.Errors, fmt.Sprintf("row %d: %v", i, err))
+						continue
+					}
+					attributesJSON, _ = json.Marshal(attributes)
+				}
+				before, err := contactchange.Take(ctx, tx, existingID)
+				if err != nil {
+					response.Errors = append(response.Errors, fmt.Sprintf("row %d: %v", i, err))
+					continue
+				}
 				_, err = tx.ExecContext(ctx, `
 					UPDATE contacts SET
 						first_name = COALESCE(NULLIF($1, ''), first_name),
@@ -411,18 +511,24 @@ func (s *ContactService) ImportContacts(ctx context.Context, orgID int64, req *m
 					response.Errors = append(response.Errors, fmt.Sprintf("row %d: failed to update", i))
 					continue
 				}
+				_, err = contactchange.Record(ctx, tx, orgID, existingID, before, contactchange.Source{Source: "import", UserID: userID})
+				if err != nil {
+					response.Errors = append(response.Errors, fmt.Sprintf("row %d: %v", i, err))
+					continue
+				}
 				response.Updated++
 			} else {
 				response.Skipped++
 			}
 
 			// Add to lists
-			for _, listID := range req.ListIDs {
-				tx.ExecContext(ctx, `
-					INSERT INTO list_contacts (list_id, contact_id, created_at)
-					VALUES ($1, $2, NOW())
-					ON CONFLICT DO NOTHING
-				`, listID, existingID)
+			confirm, err := joinLists(ctx, tx, orgID, existingID, lists, req.SkipConfirmation, listevent.SourceImport)
+			if err != nil {
+				response.Errors = append(response.Errors, fmt.Sprintf("row %d: %v", i, err))
+				continue
+			}
+			if len(confirm) > 0 {
+				confirmations = append(confirmations, confirmation{existingID, email, confirm})
 			}
 			continue
 		}
@@ -433,7 +539,12 @@ func (s *ContactService) ImportContacts(ctx context.Context, orgID int64, req *m
 		}
 
 		// Insert new contact
-		attributesJSON, _ := json.Marshal(row.Attributes)
+		attributes, err := contactfield.Validate(fields, row.Attributes)
+		if err != nil {
+			response.Errors = append(response.Errors, fmt.Sprintf("row %d: %v", i, err))
+			continue
+		}
+		attributesJSON, _ := json.Marshal(attributes)
 		var consentTimestamp *time.Time
 		if req.ConsentSource != "" {
 			now := time.Now()
@@ -445,10 +556,10 @@ func (s *ContactService) ImportContacts(ctx context.Context, orgID int64, req *m
 			INSERT INTO contacts (
 				org_id, email, first_name, last_name, attributes,
 				status, consent_source, consent_timestamp, created_at, updated_at
-			) VALUES ($1, $2, $3, $4, $5, 'active', $6, $7, NOW(), NOW())
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NOW(), NOW())
 			RETURNING id
 		`, orgID, email, row.FirstName, row.LastName, attributesJSON,
-			req.ConsentSource, consentTimestamp,
+			newStatus, req.ConsentSource, consentTimestamp,
 		).Scan(&newID)
 		if err != nil {
 			response.Errors = append(response.Errors, fmt.Sprintf("row %d: %v", i, err))
@@ -456,12 +567,13 @@ func (s *ContactService) ImportContacts(ctx context.Context, orgID int64, req *m
 		}
 
 		// Add to lists
-		for _, listID := range req.ListIDs {
-			tx.ExecContext(ctx, `
-				INSERT INTO list_contacts (list_id, contact_id, created_at)
-				VALUES ($1, $2, NOW())
-				ON CONFLICT DO NOTHING
-			`, listID, newID)
+		confirm, err := joinLists(ctx, tx, orgID, newID, lists, req.SkipConfirmation, listevent.SourceImport)
+		if err != nil {
+			response.Errors = append(response.Errors, fmt.Sprintf("row %d: %v", i, err))
+			continue
+		}
+		if len(confirm) > 0 {
+			confirmations = append(confirmations, confirmation{newID, email, confirm})
 		}
 
 		response.Imported++
@@ -472,94 +584,51 @@ func (s *ContactService) ImportContacts(ctx context.Context, orgID int64, req *m
 		tx.ExecContext(ctx, `
 			UPDATE lists SET contact_count = (
 				SELECT COUNT(*) FROM list_contacts WHERE list_id = lists.id
-			) WHERE id = ANY($1)
-		`, req.ListIDs)
+			) WHERE id = ANY($1) AND org_id = $2
+		`, pq.Array(req.ListIDs), orgID)
 	}
 
 	if err := tx.Commit(); err != nil {
 		return nil, fmt.Errorf("failed to commit transaction: %w", err)
 	}
 
+	for _, c := range confirmations {
+		if err := sendListConfirmations(ctx, s.db, s.cfg, s.transactionalService, orgID, c.contactID, c.email, c.lists, listevent.SourceImport); err != nil {
+			response.Errors = append(response.Errors, fmt.Sprintf("%s: %v", c.email, err))
+			continue
+		}
+		response.Pending++
+	}
+
 	return response, nil
 }
 
 // Unsubscribe marks a contact as unsubscribed
 func (s *ContactService) Unsubscribe(ctx context.Context, orgID int64, email string) error {
-	result, err := s.db.ExecContext(ctx, `
-		UPDATE contacts SET status = 'unsubscribed', updated_at = NOW()
-		WHERE org_id = $1 AND email = $2
-	`, orgID, strings.ToLower(email))
+	var contactID int64
+	var previous string
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE contacts c SET status = 'unsubscribed', updated_at = NOW()
+		FROM (SELECT id, COALESCE(status, '') AS status FROM contacts WHERE org_id = $1 AND email = $2 FOR UPDATE) old
+		WHERE c.id = old.id
+		RETURNING c.id, old.status
+	`, orgID, strings.ToLower(email)).Scan(&contactID, &previous)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("contact not found")
+	}
 	if err != nil {
 		return fmt.Errorf("failed to unsubscribe: %w", err)
 	}
-
-	rows, _ := result.RowsAffected()
-	if rows == 0 {
-		return fmt.Errorf("contact not found")
+	if previous != "unsubscribed" {
+		listevent.RecordMemberships(ctx, s.db, orgID, contactID, listevent.Unsubscribed, listevent.SourceAPI)
 	}
 
 	// Also add to suppression list
 	s.db.ExecContext(ctx, `
-		INSERT INTO suppressions (org_id, email, reason, source_type, created_at)
-		VALUES ($1, $2, 'unsubscribe', 'contact', NOW())
+		INSERT INTO suppressions (org_id, email, reason, source_type, normalized_email, created_at)
+		VALUES ($1, $2, 'unsubscribe', 'contact', $3, NOW())
 		ON CONFLICT (org_id, email) DO NOTHING
-	`, orgID, strings.ToLower(email))
+	`, orgID, strings.ToLower(email), normalizedAddress(ctx, s.db, orgID, email))
 
 	return nil
 }
-
-// ExportContacts exports contacts based on filters
-func (s *ContactService) ExportContacts(ctx context.Context, orgID int64, req *model.ExportContactsRequest) ([]model.Contact, error) {
-	baseQuery := "FROM contacts WHERE org_id = $1"
-	args := []interface{}{orgID}
-	argIndex := 2
-
-	// Filter by status
-	if len(req.Status) > 0 {
-		baseQuery += fmt.Sprintf(" AND status = ANY($%d)", argIndex)
-		args = append(args, req.Status)
-		argIndex++
-	}
-
-	// Filter by list membership
-	if len(req.ListIDs) > 0 {
-		baseQuery += fmt.Sprintf(" AND id IN (SELECT contact_id FROM list_contacts WHERE list_id = ANY($%d))", argIndex)
-		args = append(args, req.ListIDs)
-	}
-
-	// Query all matching contacts (no pagination for export)
-	query := fmt.Sprintf(`
-		SELECT id, uuid, org_id, email, first_name, last_name, attributes,
-			status, consent_source, consent_timestamp, last_engaged_at,
-			engagement_score, created_at, updated_at
-		%s
-		ORDER BY created_at DESC
-	`, baseQuery)
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query contacts: %w", err)
-	}
-	defer rows.Close()
-
-	var contacts []model.Contact
-	for rows.Next() {
-		var c model.Contact
-		var attributesJSON []byte
-		if err := rows.Scan(
-			&c.ID, &c.UUID, &c.OrgID, &c.Email,
-			&c.FirstName, &c.LastName, &attributesJSON,
-			&c.Status, &c.ConsentSource, &c.ConsentTimestamp,
-			&c.LastEngagedAt, &c.EngagementScore,
-			&c.CreatedAt, &c.UpdatedAt,
-		); err != nil {
-			continue
-		}
-		if len(attributesJSON) > 0 {
-			json.Unmarshal(attributesJSON, &c.Attributes)
-		}
-		contacts = append(contacts, c)
-	}
-
-	return contacts, nil
-}
@@ -0,0 +1,225 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/contactbulk"
+)
+
+// Bulk operations tag, untag, set the status of, add to, remove from or move
+// between lists, or delete every contact of a segment or filter. They run as
+// worker jobs that change contacts in batches, each committed with the job's
+// progress, and can be cancelled between batches.
+
+// ContactBulkService starts, lists and cancels contact bulk jobs
+type ContactBulkService struct {
+	db    *sql.DB
+	cfg   *config.Config
+	lists *ListService
+}
+
+// NewContactBulkService creates a new contact bulk service
+func NewContactBulkService(db *sql.DB, cfg *config.Config) *ContactBulkService {
+	return &ContactBulkService{db: db, cfg: cfg, lists: NewListService(db, cfg)}
+}
+
+const contactBulkJobColumns = `
+	uuid, operation, status, COALESCE(total, 0), COALESCE(processed, 0), COALESCE(affected, 0),
+	COALESCE(error, ''), started_at, completed_at, created_at`
+
+func scanContactBulkJob(row interface{ Scan(...any) error }) (*model.ContactBulkJob, error) {
+	var j model.ContactBulkJob
+	var startedAt, completedAt sql.NullTime
+	err := row.Scan(&j.ID, &j.Operation, &j.Status, &j.Total, &j.Processed, &j.Affected,
+		&j.Error, &startedAt, &completedAt, &j.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if startedAt.Valid {
+		j.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		j.CompletedAt = &completedAt.Time
+	}
+	switch {
+	case j.Status == worker.BulkStatusCompleted:
+		j.Progress = 100
+	case j.Total > 0:
+		j.Progress = min(99, j.Processed*100/j.Total)
+	}
+	return &j, nil
+}
+
+// List returns the organization's most recent bulk jobs
+func (s *ContactBulkService) List(ctx context.Context, orgID int64) ([]*model.ContactBulkJob, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+contactBulkJobColumns+`
+		FROM contact_bulk_jobs WHERE org_id = $1
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list bulk jobs: %w", err)
+	}
+	defer rows.Close()
+
+	jobs := []*model.ContactBulkJob{}
+	for rows.Next() {
+		j, err := scanContactBulkJob(rows)
+		if err != nil {
+			continue
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, nil
+}
+
+// Get returns a bulk job by UUID
+func (s *ContactBulkService) Get(ctx context.Context, orgID int64, jobUUID string) (*model.ContactBulkJob, error) {
+	j, err := scanContactBulkJob(s.db.QueryRowContext(ctx, `
+		SELECT `+contactBulkJobColumns+`
+		FROM contact_bulk_jobs WHERE uuid::text = $1 AND org_id = $2
+	`, jobUUID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("bulk job not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bulk job: %w", err)
+	}
+	return j, nil
+}
+
+// Create validates the operation and its target, counts the contacts it
+// targets and queues the job
+func (s *ContactBulkService) Create(ctx context.Context, orgID, userID int64, req *model.BulkContactRequest) (*model.ContactBulkJob, error) {
+	spec, err := s.resolveSpec(ctx, orgID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	where, whereArgs := spec.Where("c", 2)
+	var total int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM contacts c WHERE c.org_id = $1 AND `+where,
+		append([]any{orgID}, whereArgs...)...).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count contacts: %w", err)
+	}
+
+	specJSON, err := json.Marshal(spec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal bulk job: %w", err)
+	}
+
+	var jobID int64
+	var jobUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO contact_bulk_jobs (org_id, requested_by, operation, spec, status, total, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, uuid
+	`, orgID, userID, spec.Operation, specJSON, worker.BulkStatusPending, total).Scan(&jobID, &jobUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bulk job: %w", err)
+	}
+
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		s.markJobFailed(ctx, jobID, err)
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	if _, err := queueClient.EnqueueContactBulk(&worker.ContactBulkPayload{JobID: jobID, OrgID: orgID}); err != nil {
+		s.markJobFailed(ctx, jobID, err)
+		return nil, fmt.Errorf("failed to queue bulk job: %w", err)
+	}
+
+	return s.Get(ctx, orgID, jobUUID)
+}
+
+// resolveSpec turns a request into a validated spec, with its lists resolved
+// from their UUIDs. Lists the operation changes must be static.
+func (s *ContactBulkService) resolveSpec(ctx context.Context, orgID int64, req *model.BulkContactRequest) (*contactbulk.Spec, error) {
+	spec := &contactbulk.Spec{
+		Operation: strings.TrimSpace(req.Operation),
+		Tag:       req.Tag,
+		Status:    req.Status,
+		Target: contactbulk.Target{
+			All:    req.Target.All,
+			Query:  strings.TrimSpace(req.Target.Query),
+			Status: req.Target.Status,
+		},
+	}
+
+	var err error
+	if req.ListID != "" {
+		if spec.ListID, err = s.lists.staticListID(ctx, orgID, req.ListID); err != nil {
+			return nil, err
+		}
+	}
+	if req.FromListID != "" {
+		if spec.FromListID, err = s.lists.staticListID(ctx, orgID, req.FromListID); err != nil {
+			return nil, err
+		}
+	}
+	if req.Target.SegmentID != "" {
+		err := s.db.QueryRowContext(ctx, `
+			SELECT id FROM lists WHERE org_id = $1 AND uuid::text = $2
+		`, orgID, req.Target.SegmentID).Scan(&spec.Target.ListID)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("segment not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get segment: %w", err)
+		}
+	}
+	if req.Target.Rules != nil {
+		data, err := json.Marshal(req.Target.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal segment rules: %w", err)
+		}
+		if spec.Target.Rules, err = s.lists.parseSegmentRules(ctx, orgID, 0, data); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := spec.Validate(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+// Cancel stops a pending or running job after the batch it's on. The contacts
+// of the batches that committed keep their changes.
+func (s *ContactBulkService) Cancel(ctx context.Context, orgID int64, jobUUID string) (*model.ContactBulkJob, error) {
+	job, err := s.Get(ctx, orgID, jobUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE contact_bulk_jobs SET status = $3, completed_at = NOW()
+		WHERE uuid::text = $1 AND org_id = $2 AND status IN ($4, $5)
+	`, jobUUID, orgID, worker.BulkStatusCancelled, worker.BulkStatusPending, worker.BulkStatusRunning)
+	if err != nil {
+		return nil, fmt.Errorf("failed to cancel bulk job: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil, fmt.Errorf("the bulk job is already %s", job.Status)
+	}
+
+	return s.Get(ctx, orgID, jobUUID)
+}
+
+func (s *ContactBulkService) markJobFailed(ctx context.Context, jobID int64, err error) {
+	s.db.ExecContext(ctx, `
+		UPDATE contact_bulk_jobs SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+	`, jobID, worker.BulkStatusFailed, err.Error())
+}
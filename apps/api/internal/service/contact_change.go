@@ -0,0 +1,58 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dublyo/mailat/api/internal/model"
+)
+
+// ListContactChanges returns a contact's most recent field changes, newest
+// first, optionally only those of a field and those before a change ID
+func (s *ContactService) ListContactChanges(ctx context.Context, orgID int64, contactUUID, field string, before int64, limit int) ([]*model.ContactChange, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	var contactID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM contacts WHERE uuid::text = $1 AND org_id = $2
+	`, contactUUID, orgID).Scan(&contactID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("contact not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT ch.id, ch.field, ch.old_value, ch.new_value, ch.source, COALESCE(ch.source_id, ''),
+			ch.user_id, COALESCE(u.email, ''), ch.created_at
+		FROM contact_changes ch
+		LEFT JOIN users u ON u.id = ch.user_id
+		WHERE ch.contact_id = $1 AND ($2 = '' OR ch.field = $2) AND ($3 = 0 OR ch.id < $3)
+		ORDER BY ch.id DESC
+		LIMIT $4
+	`, contactID, field, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list changes: %w", err)
+	}
+	defer rows.Close()
+
+	changes := []*model.ContactChange{}
+	for rows.Next() {
+		var c model.ContactChange
+		var oldValue, newValue []byte
+		err := rows.Scan(&c.ID, &c.Field, &oldValue, &newValue, &c.Source, &c.SourceID,
+			&c.UserID, &c.UserEmail, &c.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan change: %w", err)
+		}
+		json.Unmarshal(oldValue, &c.OldValue)
+		json.Unmarshal(newValue, &c.NewValue)
+		changes = append(changes, &c)
+	}
+	return changes, rows.Err()
+}
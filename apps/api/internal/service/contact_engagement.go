@@ -0,0 +1,50 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/engagement"
+)
+
+// GetContactEngagement returns a contact's engagement score and its changes over
+// the last days, up to engagement.HistoryDays
+func (s *ContactService) GetContactEngagement(ctx context.Context, orgID int64, contactUUID string, days int) (*model.ContactEngagement, error) {
+	if days <= 0 || days > engagement.HistoryDays {
+		days = engagement.HistoryDays
+	}
+
+	var contactID int64
+	result := &model.ContactEngagement{History: []model.EngagementScorePoint{}}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, COALESCE(engagement_score, 0), last_engaged_at FROM contacts
+		WHERE uuid::text = $1 AND org_id = $2
+	`, contactUUID, orgID).Scan(&contactID, &result.Score, &result.LastEngagedAt)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("contact not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT score, computed_at FROM contact_engagement_scores
+		WHERE contact_id = $1 AND computed_at >= NOW() - make_interval(days => $2)
+		ORDER BY computed_at ASC
+	`, contactID, days)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get score history: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var p model.EngagementScorePoint
+		if err := rows.Scan(&p.Score, &p.ComputedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan score history: %w", err)
+		}
+		result.History = append(result.History, p)
+	}
+	return result, rows.Err()
+}
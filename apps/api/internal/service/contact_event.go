@@ -0,0 +1,208 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+	"github.com/dublyo/mailat/api/pkg/contactevent"
+)
+
+// Custom events, like a purchase or a login, are recorded against contacts
+// through the API. Segment rules test them with custom conditions, and active
+// contact.event automations enroll the contact when they record the event the
+// automation names.
+
+// ContactEventService records and lists custom contact events
+type ContactEventService struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+// NewContactEventService creates a new contact event service
+func NewContactEventService(db *sql.DB, cfg *config.Config) *ContactEventService {
+	return &ContactEventService{db: db, cfg: cfg}
+}
+
+// Track records an event against a contact and enrolls them in the active
+// automations it triggers
+func (s *ContactEventService) Track(ctx context.Context, orgID, apiKeyID int64, req *model.TrackContactEventRequest) (*model.ContactEvent, error) {
+	name := strings.TrimSpace(req.Event)
+	if err := contactevent.CheckName(name); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	occurredAt := now
+	if req.OccurredAt != nil {
+		occurredAt = *req.OccurredAt
+		if err := contactevent.CheckOccurredAt(occurredAt, now); err != nil {
+			return nil, err
+		}
+	}
+
+	if req.Properties == nil {
+		req.Properties = map[string]any{}
+	}
+	propertiesJSON, err := json.Marshal(req.Properties)
+	if err != nil {
+		return nil, fmt.Errorf("properties are not valid: %w", err)
+	}
+	if len(propertiesJSON) > contactevent.MaxPropertiesSize {
+		return nil, fmt.Errorf("properties can't be larger than %d bytes", contactevent.MaxPropertiesSize)
+	}
+
+	contactID, contactUUID, err := s.eventContact(ctx, orgID, req)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	event := &model.ContactEvent{ContactID: contactUUID, Event: name, Properties: req.Properties}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO contact_events (org_id, contact_id, name, properties, api_key_id, occurred_at, created_at)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0), $6, NOW())
+		RETURNING uuid, occurred_at, created_at
+	`, orgID, contactID, name, propertiesJSON, apiKeyID, occurredAt).Scan(&event.ID, &event.OccurredAt, &event.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record event: %w", err)
+	}
+
+	if now.Sub(occurredAt) <= contactevent.TriggerWindow {
+		if event.Enrolled, err = enrollEventAutomations(ctx, tx, orgID, contactID, name); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to record event: %w", err)
+	}
+	return event, nil
+}
+
+// eventContact finds the contact an event is recorded against. Erased contacts
+// can't record events.
+func (s *ContactEventService) eventContact(ctx context.Context, orgID int64, req *model.TrackContactEventRequest) (int64, string, error) {
+	var lookup, key string
+	switch {
+	case req.ContactID != "":
+		lookup, key = "uuid::text = $1", req.ContactID
+	case req.Email != "":
+		lookup, key = "LOWER(email) = $1", strings.ToLower(strings.TrimSpace(req.Email))
+	default:
+		return 0, "", fmt.Errorf("contactId or email is required")
+	}
+
+	var id int64
+	var contactUUID, status string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, uuid, COALESCE(status, '') FROM contacts WHERE `+lookup+` AND org_id = $2
+	`, key, orgID).Scan(&id, &contactUUID, &status)
+	if err == sql.ErrNoRows || status == "erased" {
+		return 0, "", fmt.Errorf("contact not found")
+	}
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to get contact: %w", err)
+	}
+	return id, contactUUID, nil
+}
+
+// enrollEventAutomations enrolls a contact in the org's active automations
+// triggered by an event and returns how many it was enrolled in. Recording the
+// event again only restarts automations that allow re-enrollment. Contacts
+// aren't enrolled in automations of a subscription topic they opted out of or
+// beyond the org's limit of automations per contact.
+func enrollEventAutomations(ctx context.Context, tx *sql.Tx, orgID, contactID int64, name string) (int, error) {
+	rows, err := tx.QueryContext(ctx, `
+		INSERT INTO automation_enrollments (automation_id, contact_id, org_id, status, step_index, enrolled_at, updated_at)
+		SELECT a.id, $2, $1, 'active', 0, NOW(), NOW()
+		FROM automations a
+		WHERE a.org_id = $1 AND a.status = 'active' AND a.trigger_type = $3 AND a.trigger_config->>'event' = $4
+		AND `+automationtrigger.EnrollFilter("a", "$2")+`
+		`+automationtrigger.OnConflict+`
+		RETURNING automation_id
+	`, orgID, contactID, contactevent.AutomationTrigger, name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to enroll contact: %w", err)
+	}
+	var automationIDs []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, fmt.Errorf("failed to enroll contact: %w", err)
+		}
+		automationIDs = append(automationIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, fmt.Errorf("failed to enroll contact: %w", err)
+	}
+	if len(automationIDs) == 0 {
+		return 0, nil
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE automations SET enrolled_count = enrolled_count + 1 WHERE id = ANY($1)
+	`, pq.Array(automationIDs))
+	if err != nil {
+		return 0, fmt.Errorf("failed to update enrollment count: %w", err)
+	}
+	return len(automationIDs), nil
+}
+
+// ListForContact returns a contact's most recent events, optionally only those
+// of one name
+func (s *ContactEventService) ListForContact(ctx context.Context, orgID int64, contactUUID, name string, limit int) ([]*model.ContactEvent, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+
+	var contactID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM contacts WHERE uuid::text = $1 AND org_id = $2
+	`, contactUUID, orgID).Scan(&contactID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("contact not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT uuid, name, COALESCE(properties, '{}'), occurred_at, created_at
+		FROM contact_events
+		WHERE contact_id = $1 AND ($2 = '' OR name = $2)
+		ORDER BY occurred_at DESC
+		LIMIT $3
+	`, contactID, name, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []*model.ContactEvent{}
+	for rows.Next() {
+		e := &model.ContactEvent{ContactID: contactUUID}
+		var properties []byte
+		if err := rows.Scan(&e.ID, &e.Event, &properties, &e.OccurredAt, &e.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan event: %w", err)
+		}
+		json.Unmarshal(properties, &e.Properties)
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
@@ -0,0 +1,201 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/eventexport"
+)
+
+// Contacts are exported like delivery events: a worker job reads the contacts
+// of the given lists or segments, statuses and segment rules in batches into a
+// CSV or JSON file and uploads it, then raises an alert and fires the org's
+// contact_export_ready webhook triggers.
+
+const contactExportColumns = `
+	uuid, format, destination, filters, status, COALESCE(storage_key, ''),
+	COALESCE(row_count, 0), COALESCE(size, 0), COALESCE(error, ''), completed_at, expires_at, created_at`
+
+func scanContactExport(row interface{ Scan(...any) error }) (*model.ContactExport, string, error) {
+	var e model.ContactExport
+	var storageKey string
+	var filters []byte
+	var completedAt, expiresAt sql.NullTime
+	err := row.Scan(&e.ID, &e.Format, &e.Destination, &filters, &e.Status, &storageKey,
+		&e.RowCount, &e.Size, &e.Error, &completedAt, &expiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	json.Unmarshal(filters, &e.Filters)
+	if completedAt.Valid {
+		e.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		e.ExpiresAt = &expiresAt.Time
+	}
+	return &e, storageKey, nil
+}
+
+// ListContactExports returns the organization's most recent contact exports
+func (s *ExportService) ListContactExports(ctx context.Context, orgID int64) ([]*model.ContactExport, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+contactExportColumns+`
+		FROM contact_exports WHERE org_id = $1
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exports: %w", err)
+	}
+	defer rows.Close()
+
+	exports := []*model.ContactExport{}
+	for rows.Next() {
+		e, _, err := scanContactExport(rows)
+		if err != nil {
+			continue
+		}
+		exports = append(exports, e)
+	}
+	return exports, nil
+}
+
+// GetContactExport returns a contact export by UUID. A completed download
+// export comes with a presigned URL until it expires.
+func (s *ExportService) GetContactExport(ctx context.Context, orgID int64, exportUUID string) (*model.ContactExport, error) {
+	e, storageKey, err := scanContactExport(s.db.QueryRowContext(ctx, `
+		SELECT `+contactExportColumns+`
+		FROM contact_exports WHERE uuid::text = $1 AND org_id = $2
+	`, exportUUID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("export not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export: %w", err)
+	}
+	if e.Status != worker.ExportStatusCompleted || storageKey == "" {
+		return e, nil
+	}
+
+	if e.Destination == eventexport.DestinationS3 {
+		bucket := eventexport.Load(ctx, s.db, orgID)
+		e.Location = "s3://" + bucket.Bucket + "/" + storageKey
+		return e, nil
+	}
+	if e.ExpiresAt != nil && e.ExpiresAt.Before(time.Now()) {
+		return e, nil
+	}
+
+	store, _, err := worker.OpenExportStore(ctx, s.db, s.cfg, orgID, e.Destination)
+	if err != nil {
+		return nil, err
+	}
+	e.DownloadURL, err = store.PresignGet(ctx, storageKey, path.Base(storageKey), exportDownloadURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CreateContactExport validates the filters and destination and queues the export
+func (s *ExportService) CreateContactExport(ctx context.Context, orgID, userID int64, req *model.ExportContactsRequest) (*model.ContactExport, error) {
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = worker.ContactExportCSV
+	}
+	if format != worker.ContactExportCSV && format != worker.ContactExportJSON {
+		return nil, fmt.Errorf("format must be csv or json")
+	}
+
+	destination := strings.ToLower(strings.TrimSpace(req.Destination))
+	if destination == "" {
+		destination = eventexport.DestinationDownload
+	}
+	switch destination {
+	case eventexport.DestinationDownload:
+		if s.cfg.ExportsBucket == "" {
+			return nil, fmt.Errorf("export storage is not configured")
+		}
+	case eventexport.DestinationS3:
+		if !eventexport.Load(ctx, s.db, orgID).Configured() {
+			return nil, fmt.Errorf("no export bucket is configured for the organization")
+		}
+	default:
+		return nil, fmt.Errorf("destination must be download or s3")
+	}
+
+	filter := worker.ContactExportFilter{ListIDs: req.ListIDs, Status: req.Status}
+	if len(req.ListIDs) > 0 {
+		var found int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM lists WHERE id = ANY($1) AND org_id = $2
+		`, pq.Array(req.ListIDs), orgID).Scan(&found)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get lists: %w", err)
+		}
+		if found != len(req.ListIDs) {
+			return nil, fmt.Errorf("list not found")
+		}
+	}
+	if req.Rules != nil {
+		data, err := json.Marshal(req.Rules)
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal segment rules: %w", err)
+		}
+		if filter.Rules, err = NewListService(s.db, s.cfg).parseSegmentRules(ctx, orgID, 0, data); err != nil {
+			return nil, err
+		}
+	}
+	filtersJSON, err := json.Marshal(filter)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal filters: %w", err)
+	}
+
+	var inProgress bool
+	s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM contact_exports WHERE org_id = $1 AND status IN ($2, $3))
+	`, orgID, worker.ExportStatusPending, worker.ExportStatusRunning).Scan(&inProgress)
+	if inProgress {
+		return nil, fmt.Errorf("a contact export is already in progress")
+	}
+
+	var exportID int64
+	var exportUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO contact_exports (org_id, requested_by, format, destination, filters, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, uuid
+	`, orgID, userID, format, destination, filtersJSON, worker.ExportStatusPending).Scan(&exportID, &exportUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		s.markContactExportFailed(ctx, exportID, err)
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	if _, err := queueClient.EnqueueContactExport(&worker.ContactExportPayload{ExportID: exportID, OrgID: orgID}); err != nil {
+		s.markContactExportFailed(ctx, exportID, err)
+		return nil, fmt.Errorf("failed to queue export: %w", err)
+	}
+
+	return s.GetContactExport(ctx, orgID, exportUUID)
+}
+
+func (s *ExportService) markContactExportFailed(ctx context.Context, exportID int64, err error) {
+	s.db.ExecContext(ctx, `
+		UPDATE contact_exports SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+	`, exportID, worker.ExportStatusFailed, err.Error())
+}
@@ -0,0 +1,218 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/segment"
+)
+
+// Contact fields type the attributes of an org's contacts. Contacts created,
+// updated or imported with a field's key must hold a value of its type, and
+// segment conditions on it are limited to the operators of its type.
+
+// validateAttributes checks a contact's attributes against the org's fields and
+// returns them normalized
+func validateAttributes(ctx context.Context, db *sql.DB, orgID int64, attributes map[string]any) (map[string]any, error) {
+	fields, err := contactfield.Load(ctx, db, orgID)
+	if err != nil {
+		return nil, err
+	}
+	return contactfield.Validate(fields, attributes)
+}
+
+// checkAttributeConditions checks that segment conditions on typed attributes
+// use the operators of their type, and that enum values are among the options
+func checkAttributeConditions(fields []contactfield.Field, rules *segment.Rules) error {
+	byKey := make(map[string]*contactfield.Field, len(fields))
+	for i := range fields {
+		byKey[fields[i].Key] = &fields[i]
+	}
+
+	for _, c := range rules.AttributeConditions() {
+		f, ok := byKey[c.Attribute]
+		if !ok {
+			continue
+		}
+		if !f.Allows(c.Operator) {
+			return fmt.Errorf("invalid segment rules: operator %q doesn't apply to the %s field %s", c.Operator, f.Type, f.Key)
+		}
+		if f.Type != contactfield.TypeEnum {
+			continue
+		}
+		values, isList := c.Value.([]any)
+		if !isList {
+			values = []any{c.Value}
+		}
+		for _, v := range values {
+			if v == nil {
+				continue
+			}
+			if _, err := f.Normalize(v); err != nil {
+				return fmt.Errorf("invalid segment rules: %s %s", f.Key, err)
+			}
+		}
+	}
+	return nil
+}
+
+// scanContactField reads a field from its row
+func scanContactField(row interface{ Scan(...any) error }) (*model.ContactField, error) {
+	var f model.ContactField
+	err := row.Scan(&f.UUID, &f.Key, &f.Label, &f.Type, pq.Array(&f.Options), &f.Required, &f.Description, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	f.Operators = contactfield.Operators(f.Type)
+	return &f, nil
+}
+
+const contactFieldColumns = `uuid, key, label, type, COALESCE(options, '{}'), required, COALESCE(description, ''), created_at, updated_at`
+
+// ListContactFields returns the org's contact fields
+func (s *ContactService) ListContactFields(ctx context.Context, orgID int64) ([]*model.ContactField, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+contactFieldColumns+`
+		FROM contact_fields WHERE org_id = $1
+		ORDER BY key ASC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list contact fields: %w", err)
+	}
+	defer rows.Close()
+
+	fields := []*model.ContactField{}
+	for rows.Next() {
+		f, err := scanContactField(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan contact field: %w", err)
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
+
+// GetContactField returns a contact field of the org by UUID
+func (s *ContactService) GetContactField(ctx context.Context, orgID int64, fieldUUID string) (*model.ContactField, error) {
+	f, err := scanContactField(s.db.QueryRowContext(ctx, `
+		SELECT `+contactFieldColumns+`
+		FROM contact_fields WHERE uuid::text = $1 AND org_id = $2
+	`, fieldUUID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeContactFieldNotFound, "contact field not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact field: %w", err)
+	}
+	return f, nil
+}
+
+// CreateContactField defines a typed attribute for the org's contacts. Values
+// contacts already hold under the key are checked from their next write.
+func (s *ContactService) CreateContactField(ctx context.Context, orgID int64, req *model.CreateContactFieldRequest) (*model.ContactField, error) {
+	field := contactfield.Field{
+		Key:      strings.TrimSpace(req.Key),
+		Label:    strings.TrimSpace(req.Label),
+		Type:     req.Type,
+		Options:  req.Options,
+		Required: req.Required,
+	}
+	if errs := field.Validate(); len(errs) > 0 {
+		return nil, &apierror.ValidationError{Fields: errs}
+	}
+
+	var count int
+	var taken bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*), COALESCE(BOOL_OR(key = $2), false) FROM contact_fields WHERE org_id = $1
+	`, orgID, field.Key).Scan(&count, &taken)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check contact fields: %w", err)
+	}
+	if taken {
+		return nil, apierror.Newf(http.StatusConflict, apierror.CodeConflict, "a contact field with key %q already exists", field.Key)
+	}
+	if count >= contactfield.MaxFields {
+		return nil, fmt.Errorf("organizations can't have more than %d contact fields", contactfield.MaxFields)
+	}
+
+	fieldUUID := uuid.New().String()
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO contact_fields (uuid, org_id, key, label, type, options, required, description, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NOW())
+	`, fieldUUID, orgID, field.Key, field.Label, field.Type, pq.Array(field.Options), field.Required, req.Description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create contact field: %w", err)
+	}
+
+	return s.GetContactField(ctx, orgID, fieldUUID)
+}
+
+// UpdateContactField changes the label, options, requirement or description of
+// a field
+func (s *ContactService) UpdateContactField(ctx context.Context, orgID int64, fieldUUID string, req *model.UpdateContactFieldRequest) (*model.ContactField, error) {
+	current, err := s.GetContactField(ctx, orgID, fieldUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	field := contactfield.Field{
+		Key:      current.Key,
+		Label:    current.Label,
+		Type:     current.Type,
+		Options:  current.Options,
+		Required: current.Required,
+	}
+	if label := strings.TrimSpace(req.Label); label != "" {
+		field.Label = label
+	}
+	if req.Options != nil {
+		field.Options = req.Options
+	}
+	if req.Required != nil {
+		field.Required = *req.Required
+	}
+	description := current.Description
+	if req.Description != nil {
+		description = *req.Description
+	}
+	if errs := field.Validate(); len(errs) > 0 {
+		return nil, &apierror.ValidationError{Fields: errs}
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE contact_fields SET label = $1, options = $2, required = $3, description = NULLIF($4, ''), updated_at = NOW()
+		WHERE uuid::text = $5 AND org_id = $6
+	`, field.Label, pq.Array(field.Options), field.Required, description, fieldUUID, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update contact field: %w", err)
+	}
+
+	return s.GetContactField(ctx, orgID, fieldUUID)
+}
+
+// DeleteContactField deletes a field. Contacts keep the values they hold under
+// its key, which become free-form again.
+func (s *ContactService) DeleteContactField(ctx context.Context, orgID int64, fieldUUID string) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM contact_fields WHERE uuid::text = $1 AND org_id = $2
+	`, fieldUUID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete contact field: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return apierror.New(http.StatusNotFound, apierror.CodeContactFieldNotFound, "contact field not found")
+	}
+	return nil
+}
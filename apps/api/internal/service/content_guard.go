@@ -0,0 +1,279 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/contentguard"
+	"github.com/dublyo/mailat/api/pkg/safehttp"
+)
+
+// Organizations can have rendered transactional emails checked before they are
+// queued: spam score, broken links, missing unsubscribe link and image-heavy
+// layouts. Depending on the org policy flagged emails are accepted with warnings
+// or rejected.
+
+const (
+	// contentGuardMaxLinks is the number of distinct links requested per email
+	contentGuardMaxLinks = 20
+	// contentGuardTimeout bounds each scanner call and link request
+	contentGuardTimeout = 5 * time.Second
+)
+
+var (
+	contentGuardHrefPattern        = regexp.MustCompile(`(?i)(?:href|src)\s*=\s*["']([^"']+)["']`)
+	contentGuardImagePattern       = regexp.MustCompile(`(?i)<img\b`)
+	contentGuardUnsubscribePattern = regexp.MustCompile(`(?i)unsubscribe|opt[- ]out|email preferences|manage preferences`)
+	contentGuardHiddenPattern      = regexp.MustCompile(`(?is)<(style|script|head)\b.*?</(style|script|head)>`)
+	contentGuardSpacePattern       = regexp.MustCompile(`\s+`)
+	spamdScorePattern              = regexp.MustCompile(`(?i)^Spam:\s*\w+\s*;\s*(-?[\d.]+)\s*/`)
+)
+
+// ContentBlockedError is returned when the content guard rejects an email
+type ContentBlockedError struct {
+	Findings []model.ContentFinding
+}
+
+func (e *ContentBlockedError) Error() string {
+	details := make([]string, len(e.Findings))
+	for i, f := range e.Findings {
+		details[i] = f.Detail
+	}
+	return "email blocked by content guard: " + strings.Join(details, "; ")
+}
+
+func (e *ContentBlockedError) ErrorCode() string { return apierror.CodeContentBlocked }
+func (e *ContentBlockedError) HTTPStatus() int   { return http.StatusBadRequest }
+
+// checkContent runs the checks enabled by the policy and returns a finding for each
+// check that failed. Checks whose scanner is unavailable are skipped.
+func (s *TransactionalService) checkContent(ctx context.Context, policy contentguard.Policy, from string, to []string, subject, htmlBody, textBody string) []model.ContentFinding {
+	var findings []model.ContentFinding
+
+	if policy.MaxSpamScore > 0 {
+		raw, err := provider.BuildMIMEMessage(&provider.EmailMessage{
+			From:     from,
+			To:       to,
+			Subject:  subject,
+			HTMLBody: htmlBody,
+			TextBody: textBody,
+		})
+		if err == nil {
+			score, ok, err := s.spamScore(ctx, from, to, raw)
+			if err != nil {
+				fmt.Printf("Warning: content guard spam scoring failed: %v\n", err)
+			} else if ok && score > policy.MaxSpamScore {
+				findings = append(findings, model.ContentFinding{
+					Check:  "spam_score",
+					Detail: fmt.Sprintf("spam score %.1f exceeds %.1f", score, policy.MaxSpamScore),
+				})
+			}
+		}
+	}
+
+	if policy.CheckLinks {
+		for _, link := range brokenLinks(ctx, contentLinks(htmlBody, textBody)) {
+			findings = append(findings, model.ContentFinding{
+				Check:  "broken_link",
+				Detail: "broken link " + link,
+			})
+		}
+	}
+
+	if policy.RequireUnsubscribe && !contentGuardUnsubscribePattern.MatchString(htmlBody+"\n"+textBody) {
+		findings = append(findings, model.ContentFinding{
+			Check:  "missing_unsubscribe",
+			Detail: "no unsubscribe link found",
+		})
+	}
+
+	if policy.MinTextPerImage > 0 && htmlBody != "" {
+		images := len(contentGuardImagePattern.FindAllStringIndex(htmlBody, -1))
+		text := contentGuardHiddenPattern.ReplaceAllString(htmlBody, " ")
+		text = strings.TrimSpace(contentGuardSpacePattern.ReplaceAllString(probationTagPattern.ReplaceAllString(text, " "), " "))
+		if images > 0 && len(text) < images*policy.MinTextPerImage {
+			findings = append(findings, model.ContentFinding{
+				Check:  "image_ratio",
+				Detail: fmt.Sprintf("%d images with only %d characters of text (%d per image required)", images, len(text), policy.MinTextPerImage),
+			})
+		}
+	}
+
+	return findings
+}
+
+// spamScore scores a message with the configured scanner. It reports false when no
+// scanner is configured.
+func (s *TransactionalService) spamScore(ctx context.Context, from string, to []string, raw []byte) (float64, bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, contentGuardTimeout)
+	defer cancel()
+
+	switch {
+	case s.cfg.RspamdURL != "":
+		score, err := rspamdScore(ctx, s.cfg.RspamdURL, from, to, raw)
+		return score, err == nil, err
+	case s.cfg.SpamdAddr != "":
+		score, err := spamdScore(ctx, s.cfg.SpamdAddr, raw)
+		return score, err == nil, err
+	default:
+		return 0, false, nil
+	}
+}
+
+// rspamdScore scores a message through the rspamd controller's checkv2 endpoint
+func rspamdScore(ctx context.Context, baseURL, from string, to []string, raw []byte) (float64, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(baseURL, "/")+"/checkv2", bytes.NewReader(raw))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("From", from)
+	for _, rcpt := range to {
+		req.Header.Add("Rcpt", rcpt)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("rspamd request failed: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("rspamd returned status %d", resp.StatusCode)
+	}
+
+	var result struct {
+		Score float64 `json:"score"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return 0, fmt.Errorf("failed to decode rspamd response: %w", err)
+	}
+	return result.Score, nil
+}
+
+// spamdScore scores a message with SpamAssassin's spamd using the SPAMC protocol
+func spamdScore(ctx context.Context, addr string, raw []byte) (float64, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return 0, fmt.Errorf("spamd connection failed: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := fmt.Fprintf(conn, "CHECK SPAMC/1.5\r\nContent-length: %d\r\n\r\n", len(raw)); err != nil {
+		return 0, fmt.Errorf("spamd request failed: %w", err)
+	}
+	if _, err := conn.Write(raw); err != nil {
+		return 0, fmt.Errorf("spamd request failed: %w", err)
+	}
+
+	reader := bufio.NewReader(conn)
+	status, err := reader.ReadString('\n')
+	if err != nil {
+		return 0, fmt.Errorf("spamd response failed: %w", err)
+	}
+	if !strings.Contains(status, "EX_OK") {
+		return 0, fmt.Errorf("spamd returned %s", strings.TrimSpace(status))
+	}
+	for {
+		line, err := reader.ReadString('\n')
+		if match := spamdScorePattern.FindStringSubmatch(strings.TrimSpace(line)); match != nil {
+			return strconv.ParseFloat(match[1], 64)
+		}
+		if err != nil {
+			if err == io.EOF {
+				break
+			}
+			return 0, fmt.Errorf("spamd response failed: %w", err)
+		}
+	}
+	return 0, fmt.Errorf("spamd response has no score")
+}
+
+// contentLinks returns the distinct http(s) links of an email, skipping links that
+// still contain template placeholders
+func contentLinks(htmlBody, textBody string) []string {
+	var candidates []string
+	for _, match := range contentGuardHrefPattern.FindAllStringSubmatch(htmlBody, -1) {
+		candidates = append(candidates, match[1])
+	}
+	candidates = append(candidates, probationURLPattern.FindAllString(textBody, -1)...)
+
+	seen := map[string]bool{}
+	var links []string
+	for _, link := range candidates {
+		link = strings.TrimSpace(link)
+		lower := strings.ToLower(link)
+		if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+			continue
+		}
+		if strings.Contains(link, "{{") || seen[link] {
+			continue
+		}
+		seen[link] = true
+		links = append(links, link)
+		if len(links) == contentGuardMaxLinks {
+			break
+		}
+	}
+	return links
+}
+
+// contentGuardClient requests links from emails. It refuses to connect to internal
+// addresses so the check cannot be used to probe the private network.
+var contentGuardClient = safehttp.NewClient(contentGuardTimeout)
+
+// brokenLinks requests each link and returns those that fail or answer with an error status
+func brokenLinks(ctx context.Context, links []string) []string {
+	broken := make([]bool, len(links))
+	var wg sync.WaitGroup
+	for i, link := range links {
+		wg.Add(1)
+		go func(i int, link string) {
+			defer wg.Done()
+			status, err := linkStatus(ctx, http.MethodHead, link)
+			// Some servers don't implement HEAD
+			if err == nil && (status == http.StatusMethodNotAllowed || status == http.StatusNotImplemented) {
+				status, err = linkStatus(ctx, http.MethodGet, link)
+			}
+			broken[i] = err != nil || status >= 400
+		}(i, link)
+	}
+	wg.Wait()
+
+	var result []string
+	for i, link := range links {
+		if broken[i] {
+			result = append(result, link)
+		}
+	}
+	return result
+}
+
+func linkStatus(ctx context.Context, method, link string) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, method, link, nil)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := contentGuardClient.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	return resp.StatusCode, nil
+}
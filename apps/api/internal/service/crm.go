@@ -0,0 +1,302 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/crm"
+	"github.com/dublyo/mailat/api/pkg/crypto"
+)
+
+// CRM sync connects an org's HubSpot or Salesforce account over OAuth. A
+// worker job pushes contacts' status and engagement to the CRM and pulls the
+// CRM's changes to their names and attributes back, hourly or on demand,
+// through the connection's field mappings. Pulled changes only update
+// contacts the org already has, and are recorded in their change history.
+
+// CRMService manages CRM connections and their sync runs
+type CRMService struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+// NewCRMService creates a new CRM service
+func NewCRMService(db *sql.DB, cfg *config.Config) *CRMService {
+	return &CRMService{db: db, cfg: cfg}
+}
+
+var errCRMConnectionNotFound = apierror.New(http.StatusNotFound, apierror.CodeNotFound, "CRM connection not found")
+
+const crmConnectionColumns = `
+	uuid, provider, COALESCE(account_id, ''), field_mappings, push_enabled, pull_enabled,
+	status, COALESCE(last_error, ''), last_synced_at, created_at, updated_at`
+
+func scanCRMConnection(row interface{ Scan(...any) error }) (*model.CRMConnection, error) {
+	var c model.CRMConnection
+	var mappings []byte
+	err := row.Scan(&c.ID, &c.Provider, &c.AccountID, &mappings, &c.PushEnabled, &c.PullEnabled,
+		&c.Status, &c.LastError, &c.LastSyncedAt, &c.CreatedAt, &c.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	c.FieldMappings = []model.CRMFieldMapping{}
+	json.Unmarshal(mappings, &c.FieldMappings)
+	return &c, nil
+}
+
+// ListConnections returns the organization's CRM connections
+func (s *CRMService) ListConnections(ctx context.Context, orgID int64) ([]*model.CRMConnection, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+crmConnectionColumns+` FROM crm_connections WHERE org_id = $1 ORDER BY provider ASC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list CRM connections: %w", err)
+	}
+	defer rows.Close()
+
+	connections := []*model.CRMConnection{}
+	for rows.Next() {
+		c, err := scanCRMConnection(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan CRM connection: %w", err)
+		}
+		connections = append(connections, c)
+	}
+	return connections, rows.Err()
+}
+
+// GetConnection returns a CRM connection
+func (s *CRMService) GetConnection(ctx context.Context, orgID int64, connectionUUID string) (*model.CRMConnection, error) {
+	c, err := scanCRMConnection(s.db.QueryRowContext(ctx, `
+		SELECT `+crmConnectionColumns+` FROM crm_connections WHERE uuid::text = $1 AND org_id = $2
+	`, connectionUUID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, errCRMConnectionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CRM connection: %w", err)
+	}
+	return c, nil
+}
+
+// Connect returns where to send the user to authorize a CRM account for the
+// organization. Connecting a provider the org already has replaces its
+// account and keeps its field mappings.
+func (s *CRMService) Connect(ctx context.Context, orgID, userID int64, provider string) (*model.CRMConnectResult, error) {
+	if !slices.Contains(crm.Providers, provider) {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeInvalidRequest, "unknown CRM provider %q", provider)
+	}
+	app := worker.CRMApp(s.cfg, provider)
+	if !app.Configured() {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeInvalidRequest, "%s sync is not configured on this server", provider)
+	}
+
+	state := crm.SignState(crm.State{OrgID: orgID, UserID: userID, Provider: provider}, s.cfg.JWTSecret)
+	return &model.CRMConnectResult{AuthURL: app.AuthURL(state)}, nil
+}
+
+// CompleteConnect stores the account a user authorized, trading the callback's
+// code for its tokens
+func (s *CRMService) CompleteConnect(ctx context.Context, provider, code, signedState string) (*model.CRMConnection, error) {
+	state, err := crm.VerifyState(signedState, s.cfg.JWTSecret)
+	if err != nil {
+		return nil, err
+	}
+	if state.Provider != provider {
+		return nil, fmt.Errorf("invalid state")
+	}
+
+	token, err := worker.CRMApp(s.cfg, provider).Exchange(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	accessToken, err := crypto.Encrypt(token.AccessToken, s.cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	refreshToken, err := crypto.Encrypt(token.RefreshToken, s.cfg.EncryptionKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
+	mappings, _ := json.Marshal(crm.DefaultMappings(provider))
+
+	// Another account of the provider syncs from scratch
+	var connectionUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO crm_connections (org_id, provider, account_id, instance_url, access_token, refresh_token,
+			token_expires_at, field_mappings, connected_by, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), NULLIF($4, ''), $5, $6, $7, $8, $9, NOW(), NOW())
+		ON CONFLICT (org_id, provider) DO UPDATE SET
+			pushed_until = CASE WHEN crm_connections.account_id IS DISTINCT FROM EXCLUDED.account_id THEN NULL ELSE crm_connections.pushed_until END,
+			pulled_until = CASE WHEN crm_connections.account_id IS DISTINCT FROM EXCLUDED.account_id THEN NULL ELSE crm_connections.pulled_until END,
+			account_id = EXCLUDED.account_id, instance_url = EXCLUDED.instance_url,
+			access_token = EXCLUDED.access_token, refresh_token = EXCLUDED.refresh_token,
+			token_expires_at = EXCLUDED.token_expires_at, connected_by = EXCLUDED.connected_by,
+			status = 'active', last_error = NULL, updated_at = NOW()
+		RETURNING uuid
+	`, state.OrgID, provider, token.AccountID, token.InstanceURL, accessToken, refreshToken,
+		token.ExpiresAt, mappings, state.UserID).Scan(&connectionUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save CRM connection: %w", err)
+	}
+
+	return s.GetConnection(ctx, state.OrgID, connectionUUID)
+}
+
+// UpdateConnection changes a CRM connection's field mappings or what it syncs
+func (s *CRMService) UpdateConnection(ctx context.Context, orgID int64, connectionUUID string, req *model.UpdateCRMConnectionRequest) (*model.CRMConnection, error) {
+	var mappings []byte
+	if req.FieldMappings != nil {
+		converted := make([]crm.FieldMapping, len(*req.FieldMappings))
+		for i, m := range *req.FieldMappings {
+			converted[i] = crm.FieldMapping{Field: m.Field, CRMField: m.CRMField, Direction: m.Direction}
+		}
+		if err := crm.ValidateMappings(converted); err != nil {
+			return nil, err
+		}
+		mappings, _ = json.Marshal(converted)
+	}
+
+	result, err := s.db.ExecContext(ctx, `
+		UPDATE crm_connections SET
+			field_mappings = COALESCE($3::jsonb, field_mappings),
+			push_enabled = COALESCE($4, push_enabled),
+			pull_enabled = COALESCE($5, pull_enabled),
+			updated_at = NOW()
+		WHERE uuid::text = $1 AND org_id = $2
+	`, connectionUUID, orgID, mappings, req.PushEnabled, req.PullEnabled)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update CRM connection: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil, errCRMConnectionNotFound
+	}
+
+	return s.GetConnection(ctx, orgID, connectionUUID)
+}
+
+// DeleteConnection disconnects a CRM account, dropping its tokens and runs
+func (s *CRMService) DeleteConnection(ctx context.Context, orgID int64, connectionUUID string) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM crm_connections WHERE uuid::text = $1 AND org_id = $2
+	`, connectionUUID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete CRM connection: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return errCRMConnectionNotFound
+	}
+	return nil
+}
+
+const crmSyncRunColumns = `
+	uuid, trigger, status, pushed, pulled, failed, COALESCE(error, ''), started_at, completed_at, created_at`
+
+func scanCRMSyncRun(row interface{ Scan(...any) error }) (*model.CRMSyncRun, error) {
+	var run model.CRMSyncRun
+	err := row.Scan(&run.ID, &run.Trigger, &run.Status, &run.Pushed, &run.Pulled, &run.Failed,
+		&run.Error, &run.StartedAt, &run.CompletedAt, &run.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &run, nil
+}
+
+// Sync queues a sync of a CRM connection, unless one is already in progress
+func (s *CRMService) Sync(ctx context.Context, orgID int64, connectionUUID string) (*model.CRMSyncRun, error) {
+	var connectionID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM crm_connections WHERE uuid::text = $1 AND org_id = $2
+	`, connectionUUID, orgID).Scan(&connectionID)
+	if err == sql.ErrNoRows {
+		return nil, errCRMConnectionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CRM connection: %w", err)
+	}
+
+	var runID int64
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO crm_sync_runs (connection_id, org_id, trigger, status, created_at)
+		SELECT $1, $2, $3, $4, NOW()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM crm_sync_runs WHERE connection_id = $1 AND status IN ($4, $5)
+		)
+		RETURNING id
+	`, connectionID, orgID, worker.CRMTriggerManual, worker.CRMSyncPending, worker.CRMSyncRunning).Scan(&runID)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusConflict, apierror.CodeConflict, "a sync of this connection is already in progress")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create sync run: %w", err)
+	}
+
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		s.markRunFailed(ctx, runID, err)
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	if _, err := queueClient.EnqueueCRMSync(&worker.CRMSyncPayload{RunID: runID, OrgID: orgID}); err != nil {
+		s.markRunFailed(ctx, runID, err)
+		return nil, fmt.Errorf("failed to queue sync run: %w", err)
+	}
+
+	return scanCRMSyncRun(s.db.QueryRowContext(ctx, `
+		SELECT `+crmSyncRunColumns+` FROM crm_sync_runs WHERE id = $1
+	`, runID))
+}
+
+func (s *CRMService) markRunFailed(ctx context.Context, runID int64, err error) {
+	s.db.ExecContext(ctx, `
+		UPDATE crm_sync_runs SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+	`, runID, worker.CRMSyncFailed, err.Error())
+}
+
+// ListRuns returns a CRM connection's most recent sync runs, newest first
+func (s *CRMService) ListRuns(ctx context.Context, orgID int64, connectionUUID string, limit int) ([]*model.CRMSyncRun, error) {
+	if limit <= 0 || limit > 100 {
+		limit = 20
+	}
+
+	var connectionID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM crm_connections WHERE uuid::text = $1 AND org_id = $2
+	`, connectionUUID, orgID).Scan(&connectionID)
+	if err == sql.ErrNoRows {
+		return nil, errCRMConnectionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CRM connection: %w", err)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+crmSyncRunColumns+` FROM crm_sync_runs
+		WHERE connection_id = $1
+		ORDER BY created_at DESC
+		LIMIT $2
+	`, connectionID, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sync runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []*model.CRMSyncRun{}
+	for rows.Next() {
+		run, err := scanCRMSyncRun(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan sync run: %w", err)
+		}
+		runs = append(runs, run)
+	}
+	return runs, rows.Err()
+}
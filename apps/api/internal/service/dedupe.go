@@ -0,0 +1,103 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// A send can ask not to go to a recipient that was already sent the same template
+// (or, without a template, the same subject) within the last N hours. Each
+// recipient is claimed in Redis for the window, so a client job that retries after
+// a timeout can't send twice. Without Redis sends aren't deduplicated.
+
+// maxDedupeWindowHours caps the duplicate-recipient window of a send
+const maxDedupeWindowHours = 720
+
+// DuplicateSendError is returned when recipients were already sent the same
+// message within the send's dedupe window
+type DuplicateSendError struct {
+	Recipients  []string
+	EmailID     string // The earlier email, of the first duplicate recipient
+	WindowHours int
+}
+
+func (e *DuplicateSendError) Error() string {
+	return fmt.Sprintf("%s already sent this message within the last %d hours (email %s)",
+		strings.Join(e.Recipients, ", "), e.WindowHours, e.EmailID)
+}
+
+func (e *DuplicateSendError) ErrorCode() string { return apierror.CodeDuplicateSend }
+func (e *DuplicateSendError) HTTPStatus() int   { return http.StatusConflict }
+
+// validateDedupeWindow checks the dedupe window of a send
+func validateDedupeWindow(hours int) error {
+	if hours < 0 || hours > maxDedupeWindowHours {
+		return &apierror.ValidationError{Fields: []apierror.FieldError{{
+			Field:   "dedupeWindowHours",
+			Rule:    "between",
+			Message: fmt.Sprintf("dedupeWindowHours must be between 0 and %d", maxDedupeWindowHours),
+		}}}
+	}
+	return nil
+}
+
+// dedupeKey identifies a message sent to a recipient: the template, or the
+// rendered subject of emails without one
+func dedupeKey(orgID int64, templateID, subject, recipient string) string {
+	message := "template:" + templateID
+	if templateID == "" {
+		message = "subject:" + subject
+	}
+	sum := sha256.Sum256([]byte(message + "\n" + strings.ToLower(strings.TrimSpace(recipient))))
+	return fmt.Sprintf("dedupe:org:%d:%s", orgID, hex.EncodeToString(sum[:]))
+}
+
+// claimRecipients claims the recipients of an email for the dedupe window. When any
+// of them was already claimed, the others are released again and a
+// DuplicateSendError is returned.
+func (s *TransactionalService) claimRecipients(ctx context.Context, orgID int64, templateID, subject string, recipients []string, emailUUID string, windowHours int) ([]string, error) {
+	if s.redis == nil || windowHours <= 0 {
+		return nil, nil
+	}
+
+	window := time.Duration(windowHours) * time.Hour
+	var claimed []string
+	dupErr := &DuplicateSendError{WindowHours: windowHours}
+	for _, recipient := range recipients {
+		key := dedupeKey(orgID, templateID, subject, recipient)
+		ok, err := s.redis.SetNX(ctx, key, emailUUID, window).Result()
+		if err != nil {
+			fmt.Printf("Warning: failed to check duplicate recipients: %v\n", err)
+			continue // Don't block sends on Redis errors
+		}
+		if ok {
+			claimed = append(claimed, key)
+			continue
+		}
+		if dupErr.EmailID == "" {
+			dupErr.EmailID, _ = s.redis.Get(ctx, key).Result()
+		}
+		dupErr.Recipients = append(dupErr.Recipients, recipient)
+	}
+
+	if len(dupErr.Recipients) > 0 {
+		s.releaseRecipients(ctx, claimed)
+		return nil, dupErr
+	}
+	return claimed, nil
+}
+
+// releaseRecipients gives up the claims of an email that was not sent after all
+func (s *TransactionalService) releaseRecipients(ctx context.Context, keys []string) {
+	if s.redis == nil || len(keys) == 0 {
+		return
+	}
+	s.redis.Del(ctx, keys...)
+}
@@ -0,0 +1,215 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+)
+
+// statsIntervals whitelists the date_trunc units accepted for time series
+var statsIntervals = map[string]bool{
+	"hour":  true,
+	"day":   true,
+	"week":  true,
+	"month": true,
+}
+
+// statsDimension describes how transactional emails are grouped for a breakdown
+type statsDimension struct {
+	keyExpr   string // SQL expression for the group key
+	labelExpr string // SQL expression for a human-readable label
+	join      string // Extra FROM clause (joins or lateral expansions)
+	where     string // Extra WHERE condition
+	bindKey   bool   // Bind query.Key as $4
+}
+
+const statsCountColumns = `
+	COUNT(*) FILTER (WHERE e.sent_at IS NOT NULL),
+	COUNT(*) FILTER (WHERE e.delivered_at IS NOT NULL),
+	COUNT(*) FILTER (WHERE e.opened_at IS NOT NULL),
+	COUNT(*) FILTER (WHERE e.clicked_at IS NOT NULL),
+	COUNT(*) FILTER (WHERE e.bounced_at IS NOT NULL),
+	COUNT(*) FILTER (WHERE e.status = 'complained')`
+
+// GetStatsByTag aggregates delivery/engagement rates per tag
+func (s *TransactionalService) GetStatsByTag(ctx context.Context, orgID int64, query *model.EmailStatsQuery) (*model.EmailStatsResponse, error) {
+	// tags is stored as a JSON array; rows without tags are skipped
+	return s.getStatsBreakdown(ctx, orgID, query, "tag", statsDimension{
+		keyExpr:   "g.tag",
+		labelExpr: "g.tag",
+		join: `CROSS JOIN LATERAL jsonb_array_elements_text(
+			CASE WHEN jsonb_typeof(COALESCE(NULLIF(e.tags, ''), '[]')::jsonb) = 'array'
+			THEN COALESCE(NULLIF(e.tags, ''), '[]')::jsonb ELSE '[]'::jsonb END
+		) AS g(tag)`,
+	})
+}
+
+// GetStatsByTemplate aggregates delivery/engagement rates per template
+func (s *TransactionalService) GetStatsByTemplate(ctx context.Context, orgID int64, query *model.EmailStatsQuery) (*model.EmailStatsResponse, error) {
+	return s.getStatsBreakdown(ctx, orgID, query, "template", statsDimension{
+		keyExpr:   "COALESCE(t.uuid::text, 'none')",
+		labelExpr: "COALESCE(t.name, 'No template')",
+		join:      "LEFT JOIN email_templates t ON t.id = e.template_id",
+	})
+}
+
+// GetStatsByMetadata aggregates delivery/engagement rates per value of a metadata key
+func (s *TransactionalService) GetStatsByMetadata(ctx context.Context, orgID int64, query *model.EmailStatsQuery) (*model.EmailStatsResponse, error) {
+	if query.Key == "" {
+		return nil, fmt.Errorf("metadata key is required")
+	}
+	// The key is bound as the last positional argument by getStatsBreakdown
+	valueExpr := "(COALESCE(NULLIF(e.metadata, ''), '{}')::jsonb ->> $4)"
+	return s.getStatsBreakdown(ctx, orgID, query, "metadata", statsDimension{
+		keyExpr:   valueExpr,
+		labelExpr: valueExpr,
+		where:     valueExpr + " IS NOT NULL",
+		bindKey:   true,
+	})
+}
+
+// GetStatsBySender aggregates volume and delivery rates per sending identity, optionally
+// limited to the emails sent through one rotation pool (query.Key)
+func (s *TransactionalService) GetStatsBySender(ctx context.Context, orgID int64, query *model.EmailStatsQuery) (*model.EmailStatsResponse, error) {
+	dim := statsDimension{
+		keyExpr:   "lower(e.from_address)",
+		labelExpr: "e.from_address",
+	}
+	if query.Key != "" {
+		dim.where = "e.sender_pool = $4"
+		dim.bindKey = true
+	}
+	return s.getStatsBreakdown(ctx, orgID, query, "sender", dim)
+}
+
+// getStatsBreakdown runs the grouped aggregation for a dimension, optionally with a time series per group
+func (s *TransactionalService) getStatsBreakdown(ctx context.Context, orgID int64, query *model.EmailStatsQuery, groupBy string, dim statsDimension) (*model.EmailStatsResponse, error) {
+	to := time.Now()
+	from := to.AddDate(0, 0, -30)
+	if query.From != "" {
+		t, err := time.Parse(time.RFC3339, query.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from format, use RFC3339")
+		}
+		from = t
+	}
+	if query.To != "" {
+		t, err := time.Parse(time.RFC3339, query.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to format, use RFC3339")
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+	if to.Sub(from) > 366*24*time.Hour {
+		return nil, fmt.Errorf("time window cannot exceed one year")
+	}
+	if query.Interval != "" && !statsIntervals[query.Interval] {
+		return nil, fmt.Errorf("interval must be one of: hour, day, week, month")
+	}
+
+	limit := query.Limit
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	args := []any{orgID, from, to}
+	if dim.bindKey {
+		args = append(args, query.Key)
+	}
+
+	where := "e.org_id = $1 AND e.created_at >= $2 AND e.created_at < $3 AND NOT e.is_test"
+	if dim.where != "" {
+		where += " AND " + dim.where
+	}
+
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT %s AS key, MIN(%s) AS label, %s
+		FROM transactional_emails e
+		%s
+		WHERE %s
+		GROUP BY 1
+		ORDER BY 3 DESC, 1
+		LIMIT %d
+	`, dim.keyExpr, dim.labelExpr, statsCountColumns, dim.join, where, limit), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to aggregate email stats: %w", err)
+	}
+	defer rows.Close()
+
+	groups := []model.EmailStatsGroup{}
+	index := map[string]int{}
+	for rows.Next() {
+		var g model.EmailStatsGroup
+		var label sql.NullString
+		if err := rows.Scan(&g.Key, &label, &g.Sent, &g.Delivered, &g.Opened, &g.Clicked, &g.Bounced, &g.Complained); err != nil {
+			continue
+		}
+		if label.String != g.Key {
+			g.Label = label.String
+		}
+		computeStatsRates(&g.EmailStatsCounts)
+		index[g.Key] = len(groups)
+		groups = append(groups, g)
+	}
+
+	if query.Interval != "" && len(groups) > 0 {
+		seriesRows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT %s AS key, date_trunc('%s', e.created_at) AS bucket, %s
+			FROM transactional_emails e
+			%s
+			WHERE %s
+			GROUP BY 1, 2
+		`, dim.keyExpr, query.Interval, statsCountColumns, dim.join, where), args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to aggregate email stats series: %w", err)
+		}
+		defer seriesRows.Close()
+
+		for seriesRows.Next() {
+			var key string
+			var b model.EmailStatsBucket
+			if err := seriesRows.Scan(&key, &b.Bucket, &b.Sent, &b.Delivered, &b.Opened, &b.Clicked, &b.Bounced, &b.Complained); err != nil {
+				continue
+			}
+			i, ok := index[key]
+			if !ok {
+				continue // Group fell outside the limit
+			}
+			computeStatsRates(&b.EmailStatsCounts)
+			groups[i].Series = append(groups[i].Series, b)
+		}
+
+		for i := range groups {
+			series := groups[i].Series
+			sort.Slice(series, func(a, b int) bool { return series[a].Bucket.Before(series[b].Bucket) })
+		}
+	}
+
+	return &model.EmailStatsResponse{
+		GroupBy:  groupBy,
+		Key:      query.Key,
+		From:     from,
+		To:       to,
+		Interval: query.Interval,
+		Groups:   groups,
+	}, nil
+}
+
+// computeStatsRates fills in percentage rates relative to sent emails
+func computeStatsRates(c *model.EmailStatsCounts) {
+	if c.Sent == 0 {
+		return
+	}
+	sent := float64(c.Sent)
+	c.DeliveryRate = float64(c.Delivered) / sent * 100
+	c.OpenRate = float64(c.Opened) / sent * 100
+	c.ClickRate = float64(c.Clicked) / sent * 100
+	c.BounceRate = float64(c.Bounced) / sent * 100
+}
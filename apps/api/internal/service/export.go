@@ -0,0 +1,216 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/eventexport"
+)
+
+// Delivery events can be exported for a date range as CSV or NDJSON, for BI
+// pipelines and compliance requests. Exports are written by a worker job, either to
+// the platform's exports bucket, from where they are downloaded through a short
+// lived presigned URL, or straight to a bucket of the organization.
+
+// exportDownloadURLExpiry is how long a presigned download URL is valid
+const exportDownloadURLExpiry = time.Hour
+
+// ExportService requests and lists delivery event exports
+type ExportService struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+// NewExportService creates a new export service
+func NewExportService(db *sql.DB, cfg *config.Config) *ExportService {
+	return &ExportService{db: db, cfg: cfg}
+}
+
+const eventExportColumns = `
+	uuid, format, destination, date_from, date_to, status, COALESCE(storage_key, ''),
+	COALESCE(row_count, 0), COALESCE(size, 0), COALESCE(error, ''), completed_at, expires_at, created_at`
+
+func scanEventExport(row interface{ Scan(...any) error }) (*model.EventExport, string, error) {
+	var e model.EventExport
+	var storageKey string
+	var completedAt, expiresAt sql.NullTime
+	err := row.Scan(&e.ID, &e.Format, &e.Destination, &e.From, &e.To, &e.Status, &storageKey,
+		&e.RowCount, &e.Size, &e.Error, &completedAt, &expiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	if completedAt.Valid {
+		e.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		e.ExpiresAt = &expiresAt.Time
+	}
+	return &e, storageKey, nil
+}
+
+// List returns the organization's most recent exports
+func (s *ExportService) List(ctx context.Context, orgID int64) ([]*model.EventExport, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+eventExportColumns+`
+		FROM event_exports WHERE org_id = $1
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exports: %w", err)
+	}
+	defer rows.Close()
+
+	exports := []*model.EventExport{}
+	for rows.Next() {
+		e, _, err := scanEventExport(rows)
+		if err != nil {
+			continue
+		}
+		exports = append(exports, e)
+	}
+	return exports, nil
+}
+
+// Get returns an export by UUID. A completed download export comes with a
+// presigned URL until it expires.
+func (s *ExportService) Get(ctx context.Context, orgID int64, exportUUID string) (*model.EventExport, error) {
+	e, storageKey, err := scanEventExport(s.db.QueryRowContext(ctx, `
+		SELECT `+eventExportColumns+`
+		FROM event_exports WHERE uuid = $1 AND org_id = $2
+	`, exportUUID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("export not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export: %w", err)
+	}
+	if e.Status != worker.ExportStatusCompleted || storageKey == "" {
+		return e, nil
+	}
+
+	if e.Destination == eventexport.DestinationS3 {
+		bucket := eventexport.Load(ctx, s.db, orgID)
+		e.Location = "s3://" + bucket.Bucket + "/" + storageKey
+		return e, nil
+	}
+	if e.ExpiresAt != nil && e.ExpiresAt.Before(time.Now()) {
+		return e, nil
+	}
+
+	store, _, err := worker.OpenExportStore(ctx, s.db, s.cfg, orgID, e.Destination)
+	if err != nil {
+		return nil, err
+	}
+	e.DownloadURL, err = store.PresignGet(ctx, storageKey, path.Base(storageKey), exportDownloadURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CreateEventExport validates the date range and destination and queues the export
+func (s *ExportService) CreateEventExport(ctx context.Context, orgID, userID int64, req *model.CreateEventExportRequest) (*model.EventExport, error) {
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = eventexport.FormatCSV
+	}
+	if format != eventexport.FormatCSV && format != eventexport.FormatNDJSON {
+		return nil, fmt.Errorf("format must be csv or ndjson")
+	}
+
+	destination := strings.ToLower(strings.TrimSpace(req.Destination))
+	if destination == "" {
+		destination = eventexport.DestinationDownload
+	}
+	switch destination {
+	case eventexport.DestinationDownload:
+		if s.cfg.ExportsBucket == "" {
+			return nil, fmt.Errorf("export storage is not configured")
+		}
+	case eventexport.DestinationS3:
+		if !eventexport.Load(ctx, s.db, orgID).Configured() {
+			return nil, fmt.Errorf("no export bucket is configured for the organization")
+		}
+	default:
+		return nil, fmt.Errorf("destination must be download or s3")
+	}
+
+	from, _, err := parseExportTime(req.From)
+	if err != nil {
+		return nil, fmt.Errorf("from: %w", err)
+	}
+	to, dateOnly, err := parseExportTime(req.To)
+	if err != nil {
+		return nil, fmt.Errorf("to: %w", err)
+	}
+	if dateOnly {
+		to = to.AddDate(0, 0, 1)
+	}
+	if !to.After(from) {
+		return nil, fmt.Errorf("to must be after from")
+	}
+	if to.Sub(from) > eventexport.MaxRangeDays*24*time.Hour {
+		return nil, fmt.Errorf("date range cannot exceed %d days", eventexport.MaxRangeDays)
+	}
+
+	var inProgress bool
+	s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM event_exports WHERE org_id = $1 AND status IN ($2, $3))
+	`, orgID, worker.ExportStatusPending, worker.ExportStatusRunning).Scan(&inProgress)
+	if inProgress {
+		return nil, fmt.Errorf("an export is already in progress")
+	}
+
+	var exportID int64
+	var exportUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO event_exports (org_id, requested_by, format, destination, date_from, date_to, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NOW())
+		RETURNING id, uuid
+	`, orgID, userID, format, destination, from, to, worker.ExportStatusPending).Scan(&exportID, &exportUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		s.markExportFailed(ctx, exportID, err)
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	if _, err := queueClient.EnqueueEventExport(&worker.EventExportPayload{ExportID: exportID, OrgID: orgID}); err != nil {
+		s.markExportFailed(ctx, exportID, err)
+		return nil, fmt.Errorf("failed to queue export: %w", err)
+	}
+
+	return s.Get(ctx, orgID, exportUUID)
+}
+
+func (s *ExportService) markExportFailed(ctx context.Context, exportID int64, err error) {
+	s.db.ExecContext(ctx, `
+		UPDATE event_exports SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+	`, exportID, worker.ExportStatusFailed, err.Error())
+}
+
+// parseExportTime parses an RFC 3339 time or a YYYY-MM-DD date, which is taken as
+// midnight UTC, and reports whether it was a date
+func parseExportTime(value string) (time.Time, bool, error) {
+	value = strings.TrimSpace(value)
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, true, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, false, fmt.Errorf("must be an RFC 3339 time or a YYYY-MM-DD date")
+	}
+	return t, false, nil
+}
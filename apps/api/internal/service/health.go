@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"sort"
 	"strings"
 	"time"
 
@@ -14,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/ses"
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/worker"
 )
 
 // HealthService handles email health monitoring and operations
@@ -355,7 +357,7 @@ func (s *HealthService) GetReputationMetrics(ctx context.Context, orgID int64, p
 			COALESCE(SUM(CASE WHEN status = 'failed' THEN 1 ELSE 0 END), 0) as failed,
 			COALESCE(SUM(CASE WHEN status = 'complained' THEN 1 ELSE 0 END), 0) as complaints
 		FROM transactional_emails
-		WHERE org_id = $1 AND created_at >= $2
+		WHERE org_id = $1 AND created_at >= $2 AND NOT is_test
 	`, orgID, startDate).Scan(&metrics.TotalSent, &metrics.TotalDelivered, &metrics.TotalBounced, &metrics.TotalFailed, &metrics.TotalComplaints)
 	if err != nil && err != sql.ErrNoRows {
 		// Table might not exist or be empty, return zero metrics
@@ -406,7 +408,7 @@ func (s *HealthService) GetReputationMetrics(ctx context.Context, orgID int64, p
 			COALESCE(SUM(CASE WHEN status = 'bounced' THEN 1 ELSE 0 END), 0) as bounced,
 			COALESCE(SUM(CASE WHEN status = 'complained' THEN 1 ELSE 0 END), 0) as complaints
 		FROM transactional_emails
-		WHERE org_id = $1 AND created_at >= $2 AND ARRAY_LENGTH(to_addresses, 1) > 0
+		WHERE org_id = $1 AND created_at >= $2 AND NOT is_test AND ARRAY_LENGTH(to_addresses, 1) > 0
 		GROUP BY domain
 		HAVING SPLIT_PART(to_addresses[1], '@', 2) IS NOT NULL AND SPLIT_PART(to_addresses[1], '@', 2) != ''
 		ORDER BY sent DESC
@@ -799,13 +801,13 @@ func (s *HealthService) GetWarmupStatus(ctx context.Context, orgID int64, ipAddr
 	// Get sent count for today
 	s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM transactional_emails
-		WHERE org_id = $1 AND created_at >= CURRENT_DATE
+		WHERE org_id = $1 AND created_at >= CURRENT_DATE AND NOT is_test
 	`, orgID).Scan(&status.SentToday)
 
 	// Get total sent
 	s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM transactional_emails
-		WHERE org_id = $1 AND created_at >= $2
+		WHERE org_id = $1 AND created_at >= $2 AND NOT is_test
 	`, orgID, status.StartedAt).Scan(&status.TotalSent)
 
 	return &status, nil
@@ -843,13 +845,13 @@ func (s *HealthService) GetQuotaStatus(ctx context.Context, orgID int64) (*Quota
 	// Get monthly usage
 	s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM transactional_emails
-		WHERE org_id = $1 AND created_at >= DATE_TRUNC('month', CURRENT_DATE)
+		WHERE org_id = $1 AND created_at >= DATE_TRUNC('month', CURRENT_DATE) AND NOT is_test
 	`, orgID).Scan(&status.MonthlyUsed)
 
 	// Get daily usage
 	s.db.QueryRowContext(ctx, `
 		SELECT COUNT(*) FROM transactional_emails
-		WHERE org_id = $1 AND created_at >= CURRENT_DATE
+		WHERE org_id = $1 AND created_at >= CURRENT_DATE AND NOT is_test
 	`, orgID).Scan(&status.DailyUsed)
 
 	// Calculate remaining
@@ -882,6 +884,62 @@ func (s *HealthService) GetQuotaStatus(ctx context.Context, orgID int64) (*Quota
 	return &status, nil
 }
 
+// QueueSummary contains the task counts of one worker queue
+type QueueSummary struct {
+	Name      string `json:"name"`
+	Paused    bool   `json:"paused"`
+	Pending   int    `json:"pending"`
+	Active    int    `json:"active"`
+	Scheduled int    `json:"scheduled"`
+	Retry     int    `json:"retry"`
+	Archived  int    `json:"archived"`
+	Processed int    `json:"processed"` // Processed today
+	Failed    int    `json:"failed"`    // Failed today
+}
+
+// QueueStatus contains the worker queues and the organization's task failures by class
+type QueueStatus struct {
+	Queues   []QueueSummary             `json:"queues"`
+	Failures []worker.QueueFailureStats `json:"failures"`
+}
+
+// GetQueueStatus returns the worker queue sizes and a breakdown of the
+// organization's retrying and archived tasks by failure class
+func (s *HealthService) GetQueueStatus(ctx context.Context, orgID int64) (*QueueStatus, error) {
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	infos, err := queueClient.GetQueueInfo()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get queue info: %w", err)
+	}
+
+	status := &QueueStatus{Queues: make([]QueueSummary, 0, len(infos))}
+	for name, info := range infos {
+		status.Queues = append(status.Queues, QueueSummary{
+			Name:      name,
+			Paused:    info.Paused,
+			Pending:   info.Pending,
+			Active:    info.Active,
+			Scheduled: info.Scheduled,
+			Retry:     info.Retry,
+			Archived:  info.Archived,
+			Processed: info.Processed,
+			Failed:    info.Failed,
+		})
+	}
+	sort.Slice(status.Queues, func(i, j int) bool { return status.Queues[i].Name < status.Queues[j].Name })
+
+	status.Failures, err = queueClient.GetFailureBreakdown(orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get failure breakdown: %w", err)
+	}
+	return status, nil
+}
+
 // GetAlerts returns alerts for an organization
 func (s *HealthService) GetAlerts(ctx context.Context, orgID int64, unacknowledgedOnly bool) ([]Alert, error) {
 	query := `
@@ -8,10 +8,12 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
 	"golang.org/x/crypto/bcrypt"
 
 	"github.com/dublyo/mailat/api/internal/config"
@@ -23,6 +25,7 @@ type IdentityService struct {
 	db       *sql.DB
 	cfg      *config.Config
 	stalwart *StalwartClient
+	sessions *JMAPSessions
 }
 
 type StalwartClient struct {
@@ -41,14 +44,20 @@ func NewStalwartClient(baseURL, adminPassword string) *StalwartClient {
 	}
 }
 
-func NewIdentityService(db *sql.DB, cfg *config.Config) *IdentityService {
+func NewIdentityService(db *sql.DB, cfg *config.Config, redisClient *redis.Client) *IdentityService {
 	return &IdentityService{
 		db:       db,
 		cfg:      cfg,
 		stalwart: NewStalwartClient(cfg.StalwartURL, cfg.StalwartAdminToken),
+		sessions: NewJMAPSessions(db, cfg, redisClient),
 	}
 }
 
+// JMAPAuth returns how to reach an identity's Stalwart account over JMAP
+func (s *IdentityService) JMAPAuth(ctx context.Context, identity *model.Identity) (*JMAPAuth, error) {
+	return s.sessions.Auth(ctx, identity)
+}
+
 // CreateIdentity creates a new email identity with Stalwart sync
 func (s *IdentityService) CreateIdentity(ctx context.Context, userID int64, req *model.CreateIdentityRequest) (*model.Identity, error) {
 	// Verify domain ownership
@@ -311,10 +320,11 @@ func (s *IdentityService) UpdateIdentityPassword(ctx context.Context, userID int
 	if err != nil {
 		return fmt.Errorf("failed to update password: %w", err)
 	}
+	s.sessions.Invalidate(ctx, identity.ID)
 
 	// Update in Stalwart
 	if identity.StalwartAcctID != "" {
-		err = s.stalwart.UpdatePassword(ctx, identity.StalwartAcctID, newPassword)
+		err = s.stalwart.UpdatePassword(ctx, identity.StalwartAcctID, newPassword, s.appPasswordSecrets(ctx, identity.ID))
 		if err != nil {
 			fmt.Printf("Warning: Failed to update Stalwart password: %v\n", err)
 		}
@@ -343,6 +353,7 @@ func (s *IdentityService) DeleteIdentity(ctx context.Context, userID int64, iden
 	if rows == 0 {
 		return fmt.Errorf("identity not found")
 	}
+	s.sessions.Invalidate(ctx, identity.ID)
 
 	// Delete from Stalwart
 	if identity.StalwartAcctID != "" {
@@ -434,12 +445,38 @@ func (c *StalwartClient) CreateAccount(ctx context.Context, req StalwartAccountR
 	return req.Email, nil
 }
 
-func (c *StalwartClient) UpdatePassword(ctx context.Context, accountID, newPassword string) error {
+// UpdatePassword replaces an account's password. Stalwart holds the password
+// and app passwords as one list of secrets, so the app passwords still in use
+// are set again alongside it.
+func (c *StalwartClient) UpdatePassword(ctx context.Context, accountID, newPassword string, appSecrets []string) error {
+	secrets := append([]string{newPassword}, appSecrets...)
+	if err := c.patchPrincipal(ctx, accountID, []stalwartPatch{{Action: "set", Field: "secrets", Value: secrets}}); err != nil {
+		return fmt.Errorf("stalwart update password failed: %w", err)
+	}
+	return nil
+}
+
+// AddSecret lets an account sign in with another secret
+func (c *StalwartClient) AddSecret(ctx context.Context, accountID, secret string) error {
+	return c.patchPrincipal(ctx, accountID, []stalwartPatch{{Action: "addItem", Field: "secrets", Value: secret}})
+}
+
+// RemoveSecret stops an account signing in with a secret
+func (c *StalwartClient) RemoveSecret(ctx context.Context, accountID, secret string) error {
+	return c.patchPrincipal(ctx, accountID, []stalwartPatch{{Action: "removeItem", Field: "secrets", Value: secret}})
+}
+
+// stalwartPatch is a change to a field of a principal
+type stalwartPatch struct {
+	Action string      `json:"action"` // set, addItem or removeItem
+	Field  string      `json:"field"`
+	Value  interface{} `json:"value"`
+}
+
+func (c *StalwartClient) patchPrincipal(ctx context.Context, accountID string, patches []stalwartPatch) error {
 	endpoint := fmt.Sprintf("%s/api/principal/%s", c.baseURL, accountID)
 
-	body, _ := json.Marshal(map[string]interface{}{
-		"secrets": []string{newPassword},
-	})
+	body, _ := json.Marshal(patches)
 
 	req, err := http.NewRequestWithContext(ctx, "PATCH", endpoint, bytes.NewReader(body))
 	if err != nil {
@@ -450,12 +487,13 @@ func (c *StalwartClient) UpdatePassword(ctx context.Context, accountID, newPassw
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
-		return err
+		return fmt.Errorf("stalwart API error: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode >= 400 {
-		return fmt.Errorf("stalwart update password failed: %d", resp.StatusCode)
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("stalwart returned %d: %s", resp.StatusCode, string(bodyBytes))
 	}
 
 	return nil
@@ -482,3 +520,33 @@ func (c *StalwartClient) DeleteAccount(ctx context.Context, accountID string) er
 
 	return nil
 }
+
+// TrainSpamFilter trains the spam filter of an account with a raw email, as
+// spam or as legitimate (ham)
+func (c *StalwartClient) TrainSpamFilter(ctx context.Context, account string, spam bool, rawEmail []byte) error {
+	class := "ham"
+	if spam {
+		class = "spam"
+	}
+	endpoint := fmt.Sprintf("%s/api/spam-filter/train/%s/%s", c.baseURL, class, url.PathEscape(account))
+
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewReader(rawEmail))
+	if err != nil {
+		return err
+	}
+	req.SetBasicAuth(c.username, c.password)
+	req.Header.Set("Content-Type", "message/rfc822")
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("stalwart API error: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		bodyBytes, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("stalwart returned %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/signature"
+)
+
+// maxSignatureLength bounds each form of a signature
+const maxSignatureLength = 10000
+
+// GetSignature returns an identity's signature as it's stored, placeholders
+// and all
+func (s *IdentityService) GetSignature(ctx context.Context, userID int64, identityUUID string) (*model.IdentitySignature, error) {
+	identity, err := s.GetIdentity(ctx, userID, identityUUID)
+	if err != nil {
+		return nil, err
+	}
+	return s.identitySignature(ctx, identity.ID)
+}
+
+// UpdateSignature changes an identity's signature
+func (s *IdentityService) UpdateSignature(ctx context.Context, userID int64, identityUUID string, req *model.UpdateSignatureRequest) (*model.IdentitySignature, error) {
+	if req.Position != nil && !signature.ValidPosition(*req.Position) {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "position must be below_reply or bottom")
+	}
+	if (req.HTML != nil && len(*req.HTML) > maxSignatureLength) || (req.Text != nil && len(*req.Text) > maxSignatureLength) {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeInvalidRequest, "signatures can be at most %d characters", maxSignatureLength)
+	}
+	identity, err := s.GetIdentity(ctx, userID, identityUUID)
+	if err != nil {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, err.Error())
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE identities SET
+			signature_html = COALESCE($2, signature_html),
+			signature_text = COALESCE($3, signature_text),
+			signature_position = COALESCE($4, signature_position),
+			updated_at = NOW()
+		WHERE id = $1
+	`, identity.ID, req.HTML, req.Text, req.Position)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update signature: %w", err)
+	}
+	return s.identitySignature(ctx, identity.ID)
+}
+
+// DeleteSignature removes an identity's signature, so its emails go without
+func (s *IdentityService) DeleteSignature(ctx context.Context, userID int64, identityUUID string) error {
+	identity, err := s.GetIdentity(ctx, userID, identityUUID)
+	if err != nil {
+		return err
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE identities SET signature_html = NULL, signature_text = NULL, updated_at = NOW() WHERE id = $1
+	`, identity.ID)
+	if err != nil {
+		return fmt.Errorf("failed to delete signature: %w", err)
+	}
+	return nil
+}
+
+// identitySignature returns the signature of an identity
+func (s *IdentityService) identitySignature(ctx context.Context, identityID int64) (*model.IdentitySignature, error) {
+	var htmlSig, textSig, position sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT signature_html, signature_text, signature_position FROM identities WHERE id = $1
+	`, identityID).Scan(&htmlSig, &textSig, &position)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get signature: %w", err)
+	}
+	sig := &model.IdentitySignature{HTML: htmlSig.String, Text: textSig.String, Position: position.String}
+	if !signature.ValidPosition(sig.Position) {
+		sig.Position = signature.PositionBelowReply
+	}
+	return sig, nil
+}
+
+// applySignature adds an identity's signature to an email it sends, where the
+// identity wants it. Emails that already have it are left as they are, so
+// clients that show the signature while composing can keep it in.
+func (s *ComposeService) applySignature(ctx context.Context, identity *model.Identity, email *ComposeEmail) {
+	sig, err := s.identity.identitySignature(ctx, identity.ID)
+	if err != nil {
+		fmt.Printf("Warning: Failed to get signature of %s: %v\n", identity.Email, err)
+		return
+	}
+	vars := signature.Vars{DisplayName: identity.DisplayName, Email: identity.Email}
+	if email.TextBody == "" && email.HTMLBody == "" {
+		// Reply and forward contexts start out with just the signature
+		email.TextBody = signature.InsertText("", signature.Render(sig.Text, vars, false), sig.Position)
+		email.HTMLBody = signature.InsertHTML("", signature.Render(sig.HTML, vars, true), sig.Position)
+		return
+	}
+	if email.TextBody != "" && sig.Text != "" {
+		email.TextBody = signature.InsertText(email.TextBody, signature.Render(sig.Text, vars, false), sig.Position)
+	}
+	if email.HTMLBody != "" && sig.HTML != "" {
+		email.HTMLBody = signature.InsertHTML(email.HTMLBody, signature.Render(sig.HTML, vars, true), sig.Position)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"net/http"
+	"slices"
 	"strings"
 	"sync"
 	"time"
@@ -12,7 +14,8 @@ import (
 
 	"github.com/dublyo/mailat/api/internal/config"
 	"github.com/dublyo/mailat/api/internal/model"
-	"github.com/dublyo/mailat/api/pkg/crypto"
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/apierror"
 )
 
 // InboxService handles unified inbox operations
@@ -21,6 +24,8 @@ type InboxService struct {
 	cfg      *config.Config
 	jmap     *JMAPClient
 	identity *IdentityService
+	// receiving stores received emails' attachments, when receiving is set up
+	receiving *provider.ReceivingProvider
 }
 
 // NewInboxService creates a new inbox service
@@ -81,13 +86,14 @@ type UnifiedEmail struct {
 	DomainColor   string                  `json:"domainColor,omitempty"`
 }
 
-// UnifiedInboxResponse represents paginated inbox response
+// UnifiedInboxResponse represents a page of the unified inbox. Total counts
+// the emails from the page's cursor on.
 type UnifiedInboxResponse struct {
 	Emails     []UnifiedEmail `json:"emails"`
 	Total      int            `json:"total"`
-	Page       int            `json:"page"`
 	PageSize   int            `json:"pageSize"`
 	HasMore    bool           `json:"hasMore"`
+	NextCursor string         `json:"nextCursor,omitempty"`
 }
 
 // IdentityCredentials stores credentials for JMAP access
@@ -135,33 +141,14 @@ func (s *InboxService) GetUnifiedMailboxes(ctx context.Context, userID int64) ([
 		go func(ident *model.Identity) {
 			defer wg.Done()
 
-			// Get stored password for identity
-			password, err := s.getIdentityPassword(ctx, ident.ID)
+			auth, err := s.identity.JMAPAuth(ctx, ident)
 			if err != nil {
-				errorsChan <- fmt.Errorf("failed to get password for %s: %w", ident.Email, err)
-				return
-			}
-
-			// Get JMAP session to find account ID
-			session, err := s.jmap.GetSession(ctx, ident.Email, password)
-			if err != nil {
-				errorsChan <- fmt.Errorf("failed to get JMAP session for %s: %w", ident.Email, err)
-				return
-			}
-
-			// Find the account ID
-			var accountID string
-			for accID := range session.Accounts {
-				accountID = accID
-				break
-			}
-			if accountID == "" {
-				errorsChan <- fmt.Errorf("no account found for %s", ident.Email)
+				errorsChan <- err
 				return
 			}
 
 			// Get mailboxes
-			mailboxes, err := s.jmap.GetMailboxes(ctx, ident.Email, password, accountID)
+			mailboxes, err := s.jmap.GetMailboxes(ctx, auth.Username, auth.Password, auth.AccountID)
 			if err != nil {
 				errorsChan <- fmt.Errorf("failed to get mailboxes for %s: %w", ident.Email, err)
 				return
@@ -171,7 +158,7 @@ func (s *InboxService) GetUnifiedMailboxes(ctx context.Context, userID int64) ([
 			unified := make([]UnifiedMailbox, len(mailboxes))
 			for i, mb := range mailboxes {
 				unified[i] = UnifiedMailbox{
-					ID:            fmt.Sprintf("%d:%s", ident.ID, mb.ID),
+					ID:            formatUnifiedID(ident.ID, mb.ID),
 					Name:          mb.Name,
 					ParentID:      mb.ParentID,
 					Role:          mb.Role,
@@ -212,21 +199,63 @@ func (s *InboxService) GetUnifiedMailboxes(ctx context.Context, userID int64) ([
 	return allMailboxes, nil
 }
 
-// GetUnifiedInbox retrieves emails from all identities
+// GetUnifiedInbox retrieves a page of emails from all identities, newest first.
+// Identities are queried concurrently and their emails merged; the response's
+// NextCursor is where the next page starts.
 func (s *InboxService) GetUnifiedInbox(ctx context.Context, userID int64, req *model.UnifiedInboxRequest) (*UnifiedInboxResponse, error) {
+	var cursor *unifiedCursor
+	if req.Cursor != "" {
+		var err error
+		if cursor, err = decodeUnifiedCursor(req.Cursor); err != nil {
+			return nil, err
+		}
+	}
+
 	// Get all identities for user
 	identities, err := s.identity.ListIdentities(ctx, userID)
 	if err != nil {
 		return nil, fmt.Errorf("failed to list identities: %w", err)
 	}
 
+	// Build JMAP filter
+	filter := make(map[string]interface{})
+	if req.MailboxID != "" {
+		// Mailboxes belong to one identity, so filtering by one narrows the inbox to it
+		identityID, mailboxID, err := parseUnifiedID(req.MailboxID)
+		if err != nil {
+			return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid mailbox ID")
+		}
+		if req.IdentityID != 0 && req.IdentityID != identityID {
+			identities = nil
+		}
+		req.IdentityID = identityID
+		filter["inMailbox"] = mailboxID
+	}
+	if req.Search != "" {
+		filter["text"] = req.Search
+	}
+	if req.Unread {
+		filter["notKeyword"] = "$seen"
+	}
+	if req.Flagged {
+		filter["hasKeyword"] = "$flagged"
+	}
+
+	// If filtering by specific identity
+	if req.IdentityID != 0 {
+		var selected []*model.Identity
+		for _, identity := range identities {
+			if identity.ID == req.IdentityID {
+				selected = append(selected, identity)
+			}
+		}
+		identities = selected
+	}
+
 	if len(identities) == 0 {
 		return &UnifiedInboxResponse{
 			Emails:   []UnifiedEmail{},
-			Total:    0,
-			Page:     req.Page,
 			PageSize: req.PageSize,
-			HasMore:  false,
 		}, nil
 	}
 
@@ -250,83 +279,98 @@ func (s *InboxService) GetUnifiedInbox(ctx context.Context, userID int64, req *m
 		}
 	}
 
-	// Build JMAP filter
-	filter := make(map[string]interface{})
-	if req.MailboxID != "" {
-		filter["inMailbox"] = req.MailboxID
-	}
-	if req.Search != "" {
-		filter["text"] = req.Search
-	}
-	if req.Unread {
-		filter["notKeyword"] = "$seen"
-	}
-	if req.Flagged {
-		filter["hasKeyword"] = "$flagged"
-	}
+	// Fetch one more email than the page from each identity in parallel: the
+	// page is the first of them all, and any left over means there are more
+	lists := make([][]UnifiedEmail, len(identities))
+	totals := make([]int, len(identities))
+	var wg sync.WaitGroup
+	for i, identity := range identities {
+		if identity.StalwartAcctID == "" {
+			continue
+		}
 
-	// Determine sort order
-	sort := []map[string]interface{}{
-		{"property": "receivedAt", "isAscending": false},
+		wg.Add(1)
+		go func(i int, ident *model.Identity) {
+			defer wg.Done()
+
+			info := domainInfo[ident.DomainID]
+			emails, total, err := s.unifiedIdentityEmails(ctx, ident, filter, cursor, req.PageSize+1)
+			if err != nil {
+				fmt.Printf("Warning: %v\n", err)
+				return
+			}
+			for j := range emails {
+				emails[j].DomainName = info.Name
+				emails[j].DomainColor = info.Color
+			}
+			lists[i] = emails
+			totals[i] = total
+		}(i, identity)
 	}
+	wg.Wait()
 
-	// Fetch emails from each identity
-	var allEmails []UnifiedEmail
 	totalCount := 0
-	position := (req.Page - 1) * req.PageSize
-
-	// If filtering by specific identity
-	if req.IdentityID != 0 {
-		for _, identity := range identities {
-			if identity.ID == req.IdentityID {
-				identities = []*model.Identity{identity}
-				break
-			}
-		}
+	for _, total := range totals {
+		totalCount += total
 	}
 
-	for _, identity := range identities {
-		if identity.StalwartAcctID == "" {
-			continue
-		}
+	emails := mergeUnified(lists, req.PageSize+1)
+	hasMore := len(emails) > req.PageSize
+	if hasMore {
+		emails = emails[:req.PageSize]
+	}
 
-		password, err := s.getIdentityPassword(ctx, identity.ID)
-		if err != nil {
-			fmt.Printf("Warning: failed to get password for %s: %v\n", identity.Email, err)
-			continue
-		}
+	result := &UnifiedInboxResponse{
+		Emails:   emails,
+		Total:    totalCount,
+		PageSize: req.PageSize,
+		HasMore:  hasMore,
+	}
+	if hasMore {
+		result.NextCursor = encodeUnifiedCursor(emails[len(emails)-1])
+	}
+	return result, nil
+}
 
-		session, err := s.jmap.GetSession(ctx, identity.Email, password)
-		if err != nil {
-			fmt.Printf("Warning: failed to get JMAP session for %s: %v\n", identity.Email, err)
-			continue
-		}
+// unifiedIdentityEmails returns up to limit of an identity's emails matching a
+// filter that come after the cursor, in the unified inbox's order, and how
+// many emails there are from the cursor on
+func (s *InboxService) unifiedIdentityEmails(ctx context.Context, identity *model.Identity, filter map[string]interface{}, cursor *unifiedCursor, limit int) ([]UnifiedEmail, int, error) {
+	auth, err := s.identity.JMAPAuth(ctx, identity)
+	if err != nil {
+		return nil, 0, err
+	}
 
-		var accountID string
-		for accID := range session.Accounts {
-			accountID = accID
-			break
-		}
-		if accountID == "" {
-			continue
+	// JMAP dates have whole seconds, so the query takes the cursor's whole
+	// second and the emails in it up to the cursor are dropped here
+	if cursor != nil {
+		query := make(map[string]interface{}, len(filter)+1)
+		for k, v := range filter {
+			query[k] = v
 		}
+		query["before"] = cursor.ReceivedAt.UTC().Truncate(time.Second).Add(time.Second).Format(time.RFC3339)
+		filter = query
+	}
+	sort := []map[string]interface{}{
+		{"property": "receivedAt", "isAscending": false},
+	}
 
-		// Query emails
-		emails, total, err := s.jmap.QueryAndGetEmails(ctx, identity.Email, password, accountID, filter, sort, position, req.PageSize, nil)
+	var unified []UnifiedEmail
+	total := 0
+	for position := 0; len(unified) < limit; {
+		emails, queryTotal, err := s.jmap.QueryAndGetEmails(ctx, auth.Username, auth.Password, auth.AccountID, filter, sort, position, limit, nil)
 		if err != nil {
-			fmt.Printf("Warning: failed to get emails for %s: %v\n", identity.Email, err)
-			continue
+			return nil, 0, fmt.Errorf("failed to get emails for %s: %w", identity.Email, err)
+		}
+		if position == 0 {
+			total = queryTotal
 		}
 
-		totalCount += total
-		info := domainInfo[identity.DomainID]
-
-		// Convert to unified emails
 		for _, email := range emails {
-			unified := UnifiedEmail{
-				ID:            fmt.Sprintf("%d:%s", identity.ID, email.ID),
+			e := UnifiedEmail{
+				ID:            formatUnifiedID(identity.ID, email.ID),
 				BlobID:        email.BlobID,
-				ThreadID:      fmt.Sprintf("%d:%s", identity.ID, email.ThreadID),
+				ThreadID:      formatUnifiedID(identity.ID, email.ThreadID),
 				MailboxIDs:    email.MailboxIDs,
 				Keywords:      email.Keywords,
 				Size:          email.Size,
@@ -344,30 +388,32 @@ func (s *InboxService) GetUnifiedInbox(ctx context.Context, userID int64, req *m
 				IdentityUUID:  identity.UUID,
 				IdentityEmail: identity.Email,
 				DomainID:      identity.DomainID,
-				DomainName:    info.Name,
-				DomainColor:   info.Color,
 			}
-			allEmails = append(allEmails, unified)
+			if cursor == nil || cursor.after(e) {
+				unified = append(unified, e)
+			}
 		}
-	}
-
-	// Sort all emails by receivedAt
-	sortEmailsByDate(allEmails)
 
-	// Paginate
-	start := 0
-	end := len(allEmails)
-	if end > req.PageSize {
-		end = req.PageSize
+		position += len(emails)
+		if len(emails) == 0 || position >= queryTotal {
+			break
+		}
 	}
 
-	return &UnifiedInboxResponse{
-		Emails:   allEmails[start:end],
-		Total:    totalCount,
-		Page:     req.Page,
-		PageSize: req.PageSize,
-		HasMore:  totalCount > req.Page*req.PageSize,
-	}, nil
+	// Emails received in the same second come in no particular order
+	slices.SortFunc(unified, func(a, b UnifiedEmail) int {
+		if unifiedLess(a, b) {
+			return -1
+		}
+		if unifiedLess(b, a) {
+			return 1
+		}
+		return 0
+	})
+	if len(unified) > limit {
+		unified = unified[:limit]
+	}
+	return unified, total, nil
 }
 
 // GetEmail retrieves a single email
@@ -384,24 +430,13 @@ func (s *InboxService) GetEmail(ctx context.Context, userID int64, emailID strin
 		return nil, err
 	}
 
-	password, err := s.getIdentityPassword(ctx, identity.ID)
+	auth, err := s.identity.JMAPAuth(ctx, identity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get JMAP session: %w", err)
-	}
-
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+		return nil, err
 	}
 
 	// Get email with full body
-	emails, err := s.jmap.GetEmails(ctx, identity.Email, password, accountID, []string{jmapEmailID}, []string{
+	emails, err := s.jmap.GetEmails(ctx, auth.Username, auth.Password, auth.AccountID, []string{jmapEmailID}, []string{
 		"id", "blobId", "threadId", "mailboxIds", "keywords", "size",
 		"receivedAt", "messageId", "inReplyTo", "references",
 		"from", "to", "cc", "bcc", "replyTo", "subject", "sentAt",
@@ -422,9 +457,9 @@ func (s *InboxService) GetEmail(ctx context.Context, userID int64, emailID strin
 	s.db.QueryRowContext(ctx, "SELECT name FROM domains WHERE id = $1", identity.DomainID).Scan(&domainName)
 
 	return &UnifiedEmail{
-		ID:            emailID,
+		ID:            formatUnifiedID(identity.ID, jmapEmailID),
 		BlobID:        email.BlobID,
-		ThreadID:      fmt.Sprintf("%d:%s", identity.ID, email.ThreadID),
+		ThreadID:      formatUnifiedID(identity.ID, email.ThreadID),
 		MailboxIDs:    email.MailboxIDs,
 		Keywords:      email.Keywords,
 		Size:          email.Size,
@@ -465,22 +500,11 @@ func (s *InboxService) MarkEmailsRead(ctx context.Context, userID int64, emailID
 			continue
 		}
 
-		password, err := s.getIdentityPassword(ctx, identity.ID)
-		if err != nil {
-			continue
-		}
-
-		session, err := s.jmap.GetSession(ctx, identity.Email, password)
+		auth, err := s.identity.JMAPAuth(ctx, identity)
 		if err != nil {
 			continue
 		}
 
-		var accountID string
-		for accID := range session.Accounts {
-			accountID = accID
-			break
-		}
-
 		updates := make(map[string]map[string]interface{})
 		for _, jmapID := range jmapIDs {
 			if read {
@@ -494,7 +518,7 @@ func (s *InboxService) MarkEmailsRead(ctx context.Context, userID int64, emailID
 			}
 		}
 
-		if err := s.jmap.SetEmailKeywords(ctx, identity.Email, password, accountID, updates); err != nil {
+		if err := s.jmap.SetEmailKeywords(ctx, auth.Username, auth.Password, auth.AccountID, updates); err != nil {
 			fmt.Printf("Warning: failed to update emails for %s: %v\n", identity.Email, err)
 		}
 	}
@@ -519,22 +543,11 @@ func (s *InboxService) ToggleEmailFlag(ctx context.Context, userID int64, emailI
 			continue
 		}
 
-		password, err := s.getIdentityPassword(ctx, identity.ID)
-		if err != nil {
-			continue
-		}
-
-		session, err := s.jmap.GetSession(ctx, identity.Email, password)
+		auth, err := s.identity.JMAPAuth(ctx, identity)
 		if err != nil {
 			continue
 		}
 
-		var accountID string
-		for accID := range session.Accounts {
-			accountID = accID
-			break
-		}
-
 		updates := make(map[string]map[string]interface{})
 		for _, jmapID := range jmapIDs {
 			if flagged {
@@ -548,7 +561,7 @@ func (s *InboxService) ToggleEmailFlag(ctx context.Context, userID int64, emailI
 			}
 		}
 
-		if err := s.jmap.SetEmailKeywords(ctx, identity.Email, password, accountID, updates); err != nil {
+		if err := s.jmap.SetEmailKeywords(ctx, auth.Username, auth.Password, auth.AccountID, updates); err != nil {
 			fmt.Printf("Warning: failed to flag emails for %s: %v\n", identity.Email, err)
 		}
 	}
@@ -573,23 +586,12 @@ func (s *InboxService) DeleteEmails(ctx context.Context, userID int64, emailIDs
 			continue
 		}
 
-		password, err := s.getIdentityPassword(ctx, identity.ID)
-		if err != nil {
-			continue
-		}
-
-		session, err := s.jmap.GetSession(ctx, identity.Email, password)
+		auth, err := s.identity.JMAPAuth(ctx, identity)
 		if err != nil {
 			continue
 		}
 
-		var accountID string
-		for accID := range session.Accounts {
-			accountID = accID
-			break
-		}
-
-		if err := s.jmap.DeleteEmails(ctx, identity.Email, password, accountID, jmapIDs, permanent); err != nil {
+		if err := s.jmap.DeleteEmails(ctx, auth.Username, auth.Password, auth.AccountID, jmapIDs, permanent); err != nil {
 			fmt.Printf("Warning: failed to delete emails for %s: %v\n", identity.Email, err)
 		}
 	}
@@ -623,22 +625,11 @@ func (s *InboxService) MoveEmails(ctx context.Context, userID int64, emailIDs []
 			continue
 		}
 
-		password, err := s.getIdentityPassword(ctx, identity.ID)
-		if err != nil {
-			continue
-		}
-
-		session, err := s.jmap.GetSession(ctx, identity.Email, password)
+		auth, err := s.identity.JMAPAuth(ctx, identity)
 		if err != nil {
 			continue
 		}
 
-		var accountID string
-		for accID := range session.Accounts {
-			accountID = accID
-			break
-		}
-
 		// Set new mailbox
 		updates := make(map[string]map[string]interface{})
 		for _, jmapID := range jmapIDs {
@@ -647,7 +638,7 @@ func (s *InboxService) MoveEmails(ctx context.Context, userID int64, emailIDs []
 			}
 		}
 
-		if err := s.jmap.SetEmailKeywords(ctx, identity.Email, password, accountID, updates); err != nil {
+		if err := s.jmap.SetEmailKeywords(ctx, auth.Username, auth.Password, auth.AccountID, updates); err != nil {
 			fmt.Printf("Warning: failed to move emails for %s: %v\n", identity.Email, err)
 		}
 	}
@@ -667,24 +658,13 @@ func (s *InboxService) GetThread(ctx context.Context, userID int64, threadID str
 		return nil, err
 	}
 
-	password, err := s.getIdentityPassword(ctx, identity.ID)
+	auth, err := s.identity.JMAPAuth(ctx, identity)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	session, err := s.jmap.GetSession(ctx, identity.Email, password)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get JMAP session: %w", err)
-	}
-
-	var accountID string
-	for accID := range session.Accounts {
-		accountID = accID
-		break
+		return nil, err
 	}
 
 	// Get thread
-	threads, err := s.jmap.GetThreads(ctx, identity.Email, password, accountID, []string{jmapThreadID})
+	threads, err := s.jmap.GetThreads(ctx, auth.Username, auth.Password, auth.AccountID, []string{jmapThreadID})
 	if err != nil {
 		return nil, err
 	}
@@ -694,7 +674,7 @@ func (s *InboxService) GetThread(ctx context.Context, userID int64, threadID str
 	}
 
 	// Get all emails in thread
-	emails, err := s.jmap.GetEmails(ctx, identity.Email, password, accountID, threads[0].EmailIDs, nil)
+	emails, err := s.jmap.GetEmails(ctx, auth.Username, auth.Password, auth.AccountID, threads[0].EmailIDs, nil)
 	if err != nil {
 		return nil, err
 	}
@@ -705,9 +685,9 @@ func (s *InboxService) GetThread(ctx context.Context, userID int64, threadID str
 	var unified []UnifiedEmail
 	for _, email := range emails {
 		unified = append(unified, UnifiedEmail{
-			ID:            fmt.Sprintf("%d:%s", identity.ID, email.ID),
+			ID:            formatUnifiedID(identity.ID, email.ID),
 			BlobID:        email.BlobID,
-			ThreadID:      threadID,
+			ThreadID:      formatUnifiedID(identity.ID, jmapThreadID),
 			MailboxIDs:    email.MailboxIDs,
 			Keywords:      email.Keywords,
 			Size:          email.Size,
@@ -735,25 +715,6 @@ func (s *InboxService) GetThread(ctx context.Context, userID int64, threadID str
 
 // Helper functions
 
-func (s *InboxService) getIdentityPassword(ctx context.Context, identityID int64) (string, error) {
-	var encryptedPassword sql.NullString
-	err := s.db.QueryRowContext(ctx, "SELECT encrypted_password FROM identities WHERE id = $1", identityID).Scan(&encryptedPassword)
-	if err != nil {
-		return "", fmt.Errorf("failed to get identity password: %w", err)
-	}
-
-	if !encryptedPassword.Valid || encryptedPassword.String == "" {
-		return "", fmt.Errorf("identity password not configured")
-	}
-
-	password, err := crypto.Decrypt(encryptedPassword.String, s.cfg.EncryptionKey)
-	if err != nil {
-		return "", fmt.Errorf("failed to decrypt identity password: %w", err)
-	}
-
-	return password, nil
-}
-
 func (s *InboxService) getIdentityByID(ctx context.Context, userID int64, identityID int64) (*model.Identity, error) {
 	var identity model.Identity
 	var stalwartAcctID sql.NullString
@@ -780,16 +741,6 @@ func (s *InboxService) getIdentityByID(ctx context.Context, userID int64, identi
 	return &identity, nil
 }
 
-func parseUnifiedID(id string) (int64, string, error) {
-	var identityID int64
-	var jmapID string
-	_, err := fmt.Sscanf(id, "%d:%s", &identityID, &jmapID)
-	if err != nil {
-		return 0, "", fmt.Errorf("invalid unified ID format: %s", id)
-	}
-	return identityID, jmapID, nil
-}
-
 func generateDomainColor(domain string) string {
 	// Generate a consistent color based on domain name
 	colors := []string{
@@ -810,17 +761,6 @@ func generateDomainColor(domain string) string {
 	return colors[hash]
 }
 
-func sortEmailsByDate(emails []UnifiedEmail) {
-	// Simple bubble sort for now - can optimize later
-	for i := 0; i < len(emails)-1; i++ {
-		for j := 0; j < len(emails)-i-1; j++ {
-			if emails[j].ReceivedAt.Before(emails[j+1].ReceivedAt) {
-				emails[j], emails[j+1] = emails[j+1], emails[j]
-			}
-		}
-	}
-}
-
 // ===================================
 // SES Received Emails Methods
 // ===================================
@@ -829,14 +769,74 @@ func sortEmailsByDate(emails []UnifiedEmail) {
 // ListReceivedEmails returns a paginated list of received emails
 // If req.IdentityID is 0, returns emails from all user's identities (unified inbox)
 func (s *InboxService) ListReceivedEmails(ctx context.Context, userID int64, req *model.InboxListRequest) (*model.InboxListResponse, error) {
+	baseQuery, args := receivedEmailFilter(userID, req)
+
+	// Get total count
+	var total int
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) "+baseQuery, args...).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count emails: %w", err)
+	}
+
+	// Get unread count (for specific identity or all)
+	unreadCount := s.receivedUnreadCount(ctx, userID, req.IdentityID)
+
+	// Apply pagination
+	page, pageSize := receivedEmailPage(req)
+	offset := (page - 1) * pageSize
+
+	// Build final query with ordering and pagination
+	sortBy := "re.received_at"
+	sortOrder := "DESC"
+	if req.SortBy != "" && (req.SortBy == "subject" || req.SortBy == "from_email" || req.SortBy == "size_bytes") {
+		sortBy = "re." + req.SortBy
+	}
+	if req.SortOrder == "asc" {
+		sortOrder = "ASC"
+	}
+
+	query := fmt.Sprintf(`
+		SELECT `+receivedEmailColumns+`
+		%s
+		ORDER BY %s %s
+		LIMIT %d OFFSET %d
+	`, baseQuery, sortBy, sortOrder, pageSize, offset)
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query emails: %w", err)
+	}
+	defer rows.Close()
+
+	emails := scanReceivedEmails(rows)
+
+	totalPages := total / pageSize
+	if total%pageSize > 0 {
+		totalPages++
+	}
+
+	return &model.InboxListResponse{
+		Emails:     emails,
+		Total:      total,
+		Unread:     unreadCount,
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// receivedEmailFilter returns the FROM and WHERE clauses selecting the
+// received emails a list request asks for, and their arguments
+func receivedEmailFilter(userID int64, req *model.InboxListRequest) (string, []interface{}) {
 	var args []interface{}
 	argNum := 1
 
-	// Build base query with identity info join
+	// Build base query with identity info join; the emails of the shared
+	// mailboxes the user reads are listed with their own
 	baseQuery := `
 		FROM received_emails re
 		JOIN identities i ON re.identity_id = i.id
-		WHERE i.user_id = $1
+		WHERE ` + receivedEmailAccess("$1") + `
 	`
 	args = append(args, userID)
 	argNum++
@@ -865,7 +865,7 @@ func (s *InboxService) ListReceivedEmails(ctx context.Context, userID int64, req
 	case "archive":
 		baseQuery += " AND re.is_archived = true AND re.is_trashed = false"
 	case "all":
-		baseQuery += " AND re.is_trashed = false"
+		baseQuery += " AND re.is_trashed = false AND re.folder <> 'quarantine'"
 	default:
 		if req.Folder != "" {
 			baseQuery += fmt.Sprintf(" AND re.folder = $%d AND re.is_trashed = false", argNum)
@@ -895,31 +895,32 @@ func (s *InboxService) ListReceivedEmails(ctx context.Context, userID int64, req
 		argNum++
 	}
 
-	// Get total count
-	var total int
-	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*) "+baseQuery, args...).Scan(&total)
-	if err != nil {
-		return nil, fmt.Errorf("failed to count emails: %w", err)
-	}
+	return baseQuery, args
+}
 
-	// Get unread count (for specific identity or all)
+// receivedUnreadCount counts the unread emails of an identity, or of all the
+// user's identities when identityID is 0
+func (s *InboxService) receivedUnreadCount(ctx context.Context, userID, identityID int64) int {
 	var unreadCount int
-	if req.IdentityID > 0 {
+	if identityID > 0 {
 		s.db.QueryRowContext(ctx, `
 			SELECT COUNT(*)
 			FROM received_emails
 			WHERE identity_id = $1 AND is_read = false AND is_trashed = false
-		`, req.IdentityID).Scan(&unreadCount)
+		`, identityID).Scan(&unreadCount)
 	} else {
 		s.db.QueryRowContext(ctx, `
 			SELECT COUNT(*)
 			FROM received_emails re
 			JOIN identities i ON re.identity_id = i.id
-			WHERE i.user_id = $1 AND re.is_read = false AND re.is_trashed = false
+			WHERE `+receivedEmailAccess("$1")+` AND re.is_read = false AND re.is_trashed = false
 		`, userID).Scan(&unreadCount)
 	}
+	return unreadCount
+}
 
-	// Apply pagination
+// receivedEmailPage returns the page and page size of a list request
+func receivedEmailPage(req *model.InboxListRequest) (int, int) {
 	page := req.Page
 	if page < 1 {
 		page = 1
@@ -931,45 +932,28 @@ func (s *InboxService) ListReceivedEmails(ctx context.Context, userID int64, req
 	if pageSize > 100 {
 		pageSize = 100
 	}
+	return page, pageSize
+}
 
-	offset := (page - 1) * pageSize
-
-	// Build final query with ordering and pagination
-	sortBy := "re.received_at"
-	sortOrder := "DESC"
-	if req.SortBy != "" && (req.SortBy == "subject" || req.SortBy == "from_email" || req.SortBy == "size_bytes") {
-		sortBy = "re." + req.SortBy
-	}
-	if req.SortOrder == "asc" {
-		sortOrder = "ASC"
-	}
-
-	query := fmt.Sprintf(`
-		SELECT re.id, re.uuid, re.org_id, re.domain_id, re.identity_id, re.message_id,
+// receivedEmailColumns are the columns scanReceivedEmails reads
+const receivedEmailColumns = `re.id, re.uuid, re.org_id, re.domain_id, re.identity_id, re.message_id,
 			   re.in_reply_to, re.thread_id, re.from_email, re.from_name,
 			   re.to_emails, re.cc_emails, re.subject, re.snippet,
 			   re.size_bytes, re.has_attachments, re.folder,
 			   re.is_read, re.is_starred, re.is_archived, re.is_trashed, re.is_spam,
 			   re.labels, re.spam_verdict, re.spf_verdict, re.dkim_verdict, re.dmarc_verdict,
 			   re.received_at, re.read_at, re.created_at, re.updated_at,
-			   i.email, i.display_name, i.color
-		%s
-		ORDER BY %s %s
-		LIMIT %d OFFSET %d
-	`, baseQuery, sortBy, sortOrder, pageSize, offset)
-
-	rows, err := s.db.QueryContext(ctx, query, args...)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query emails: %w", err)
-	}
-	defer rows.Close()
+			   i.email, i.display_name, i.color,
+			   COALESCE(re.tracked, false), COALESCE(re.open_count, 0), COALESCE(re.click_count, 0), re.seen_at`
 
+// scanReceivedEmails reads the list rows of received emails
+func scanReceivedEmails(rows *sql.Rows) []model.ReceivedEmail {
 	var emails []model.ReceivedEmail
 	for rows.Next() {
 		var email model.ReceivedEmail
 		var inReplyTo, threadID, fromName, snippet sql.NullString
 		var spamVerdict, spfVerdict, dkimVerdict, dmarcVerdict sql.NullString
-		var readAt sql.NullTime
+		var readAt, seenAt sql.NullTime
 		var toEmails, ccEmails, labels []string
 		var identityEmail, identityDisplayName sql.NullString
 		var identityColor sql.NullString
@@ -983,6 +967,7 @@ func (s *InboxService) ListReceivedEmails(ctx context.Context, userID int64, req
 			pq.Array(&labels), &spamVerdict, &spfVerdict, &dkimVerdict, &dmarcVerdict,
 			&email.ReceivedAt, &readAt, &email.CreatedAt, &email.UpdatedAt,
 			&identityEmail, &identityDisplayName, &identityColor,
+			&email.Tracked, &email.OpenCount, &email.ClickCount, &seenAt,
 		)
 		if err != nil {
 			continue
@@ -1002,6 +987,9 @@ func (s *InboxService) ListReceivedEmails(ctx context.Context, userID int64, req
 		if readAt.Valid {
 			email.ReadAt = &readAt.Time
 		}
+		if seenAt.Valid {
+			email.SeenAt = &seenAt.Time
+		}
 		// Set identity info for unified inbox display
 		email.IdentityEmail = identityEmail.String
 		email.IdentityDisplayName = identityDisplayName.String
@@ -1010,19 +998,7 @@ func (s *InboxService) ListReceivedEmails(ctx context.Context, userID int64, req
 		emails = append(emails, email)
 	}
 
-	totalPages := total / pageSize
-	if total%pageSize > 0 {
-		totalPages++
-	}
-
-	return &model.InboxListResponse{
-		Emails:     emails,
-		Total:      total,
-		Unread:     unreadCount,
-		Page:       page,
-		PageSize:   pageSize,
-		TotalPages: totalPages,
-	}, nil
+	return emails
 }
 
 // GetReceivedEmail returns a single received email by UUID
@@ -1032,7 +1008,7 @@ func (s *InboxService) GetReceivedEmail(ctx context.Context, userID int64, email
 	var rawS3Key, rawS3Bucket sql.NullString
 	var spamVerdict, virusVerdict, spfVerdict, dkimVerdict, dmarcVerdict sql.NullString
 	var sesMessageID, replyTo sql.NullString
-	var readAt, trashedAt sql.NullTime
+	var readAt, trashedAt, seenAt sql.NullTime
 	var spamScore sql.NullFloat64
 	var toEmails, ccEmails, bccEmails, references, labels []string
 
@@ -1045,10 +1021,11 @@ func (s *InboxService) GetReceivedEmail(ctx context.Context, userID int64, email
 			   re.is_read, re.is_starred, re.is_archived, re.is_trashed, re.is_spam,
 			   re.labels, re.spam_score, re.spam_verdict, re.virus_verdict,
 			   re.spf_verdict, re.dkim_verdict, re.dmarc_verdict, re.ses_message_id,
-			   re.received_at, re.read_at, re.trashed_at, re.created_at, re.updated_at
+			   re.received_at, re.read_at, re.trashed_at, re.created_at, re.updated_at,
+			   COALESCE(re.tracked, false), COALESCE(re.open_count, 0), COALESCE(re.click_count, 0), re.seen_at
 		FROM received_emails re
 		JOIN identities i ON re.identity_id = i.id
-		WHERE re.uuid = $1 AND i.user_id = $2
+		WHERE re.uuid = $1 AND `+receivedEmailAccess("$2")+`
 	`, emailUUID, userID).Scan(
 		&email.ID, &email.UUID, &email.OrgID, &email.DomainID, &email.IdentityID, &email.MessageID,
 		&inReplyTo, pq.Array(&references), &threadID, &email.FromEmail, &fromName,
@@ -1059,6 +1036,7 @@ func (s *InboxService) GetReceivedEmail(ctx context.Context, userID int64, email
 		pq.Array(&labels), &spamScore, &spamVerdict, &virusVerdict,
 		&spfVerdict, &dkimVerdict, &dmarcVerdict, &sesMessageID,
 		&email.ReceivedAt, &readAt, &trashedAt, &email.CreatedAt, &email.UpdatedAt,
+		&email.Tracked, &email.OpenCount, &email.ClickCount, &seenAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("email not found")
@@ -1096,11 +1074,15 @@ func (s *InboxService) GetReceivedEmail(ctx context.Context, userID int64, email
 	if trashedAt.Valid {
 		email.TrashedAt = &trashedAt.Time
 	}
+	if seenAt.Valid {
+		email.SeenAt = &seenAt.Time
+	}
 
 	// Load attachments
 	attachmentRows, err := s.db.QueryContext(ctx, `
 		SELECT id, uuid, filename, content_type, size_bytes, s3_key, s3_bucket,
-			   content_id, is_inline, checksum, created_at
+			   content_id, is_inline, checksum, COALESCE(thumbnail_s3_key, ''),
+			   COALESCE(virus_verdict, ''), COALESCE(virus_name, ''), created_at
 		FROM email_attachments
 		WHERE received_email_id = $1
 	`, email.ID)
@@ -1111,13 +1093,15 @@ func (s *InboxService) GetReceivedEmail(ctx context.Context, userID int64, email
 			var contentID, checksum sql.NullString
 			attachmentRows.Scan(
 				&att.ID, &att.UUID, &att.Filename, &att.ContentType, &att.SizeBytes,
-				&att.S3Key, &att.S3Bucket, &contentID, &att.IsInline, &checksum, &att.CreatedAt,
+				&att.S3Key, &att.S3Bucket, &contentID, &att.IsInline, &checksum, &att.ThumbnailS3Key,
+				&att.VirusVerdict, &att.VirusName, &att.CreatedAt,
 			)
 			att.ContentID = contentID.String
 			att.Checksum = checksum.String
 			email.Attachments = append(email.Attachments, att)
 		}
 	}
+	s.resolveAttachmentURLs(ctx, &email)
 
 	// Mark as read if not already
 	if !email.IsRead {
@@ -1206,27 +1190,30 @@ func (s *InboxService) MoveReceivedEmails(ctx context.Context, userID int64, ema
 		args = append(args, uuid)
 	}
 
-	// Handle special folders
-	extraUpdates := ""
-	switch folder {
-	case "archive":
-		extraUpdates = ", is_archived = true"
-	case "spam":
-		extraUpdates = ", is_spam = true"
-	case "inbox":
-		extraUpdates = ", is_archived = false, is_spam = false"
-	}
-
 	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
 		UPDATE received_emails
 		SET folder = $1, updated_at = $2%s
 		WHERE uuid IN (%s)
 		AND identity_id IN (SELECT id FROM identities WHERE user_id = $3)
-	`, extraUpdates, strings.Join(placeholders, ",")), args...)
+	`, folderMoveUpdates(folder), strings.Join(placeholders, ",")), args...)
 
 	return err
 }
 
+// folderMoveUpdates returns the flags set, after a comma, when emails are
+// moved to a folder with a flag of its own
+func folderMoveUpdates(folder string) string {
+	switch folder {
+	case "archive":
+		return ", is_archived = true"
+	case "spam":
+		return ", is_spam = true"
+	case "inbox":
+		return ", is_archived = false, is_spam = false"
+	}
+	return ""
+}
+
 // TrashReceivedEmails moves received emails to trash or permanently deletes
 func (s *InboxService) TrashReceivedEmails(ctx context.Context, userID int64, emailUUIDs []string, permanent bool) error {
 	if len(emailUUIDs) == 0 {
@@ -1290,84 +1277,36 @@ func (s *InboxService) GetReceivedEmailCounts(ctx context.Context, userID, ident
 			return nil, fmt.Errorf("identity not found")
 		}
 
-		// Get counts for specific identity
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails
-			WHERE identity_id = $1 AND folder = 'inbox' AND is_trashed = false AND is_archived = false
-		`, identityID).Scan(&counts.Inbox)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails
-			WHERE identity_id = $1 AND is_read = false AND is_trashed = false
-		`, identityID).Scan(&counts.Unread)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails
-			WHERE identity_id = $1 AND is_starred = true AND is_trashed = false
-		`, identityID).Scan(&counts.Starred)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails
-			WHERE identity_id = $1 AND folder = 'sent' AND is_trashed = false
-		`, identityID).Scan(&counts.Sent)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails
-			WHERE identity_id = $1 AND folder = 'drafts' AND is_trashed = false
-		`, identityID).Scan(&counts.Drafts)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails
-			WHERE identity_id = $1 AND (folder = 'spam' OR is_spam = true) AND is_trashed = false
-		`, identityID).Scan(&counts.Spam)
+		// Get counts for specific identity, kept by the counts trigger
+		err = s.db.QueryRowContext(ctx, `
+			SELECT inbox, unread, starred, sent, drafts, spam, trash
+			FROM received_email_counts WHERE identity_id = $1
+		`, identityID).Scan(&counts.Inbox, &counts.Unread, &counts.Starred, &counts.Sent, &counts.Drafts, &counts.Spam, &counts.Trash)
+		if err != nil && err != sql.ErrNoRows {
+			return nil, fmt.Errorf("failed to get counts: %w", err)
+		}
 
 		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails
-			WHERE identity_id = $1 AND is_trashed = true
-		`, identityID).Scan(&counts.Trash)
+			SELECT COUNT(*) FROM compose_sends
+			WHERE identity_id = $1 AND scheduled = true AND status = 'pending'
+		`, identityID).Scan(&counts.Scheduled)
 	} else {
 		// Get counts across all user's identities (unified inbox)
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails re
-			JOIN identities i ON re.identity_id = i.id
-			WHERE i.user_id = $1 AND re.folder = 'inbox' AND re.is_trashed = false AND re.is_archived = false
-		`, userID).Scan(&counts.Inbox)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails re
-			JOIN identities i ON re.identity_id = i.id
-			WHERE i.user_id = $1 AND re.is_read = false AND re.is_trashed = false
-		`, userID).Scan(&counts.Unread)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails re
-			JOIN identities i ON re.identity_id = i.id
-			WHERE i.user_id = $1 AND re.is_starred = true AND re.is_trashed = false
-		`, userID).Scan(&counts.Starred)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails re
-			JOIN identities i ON re.identity_id = i.id
-			WHERE i.user_id = $1 AND re.folder = 'sent' AND re.is_trashed = false
-		`, userID).Scan(&counts.Sent)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails re
-			JOIN identities i ON re.identity_id = i.id
-			WHERE i.user_id = $1 AND re.folder = 'drafts' AND re.is_trashed = false
-		`, userID).Scan(&counts.Drafts)
-
-		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails re
-			JOIN identities i ON re.identity_id = i.id
-			WHERE i.user_id = $1 AND (re.folder = 'spam' OR re.is_spam = true) AND re.is_trashed = false
-		`, userID).Scan(&counts.Spam)
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COALESCE(SUM(c.inbox), 0), COALESCE(SUM(c.unread), 0), COALESCE(SUM(c.starred), 0),
+				COALESCE(SUM(c.sent), 0), COALESCE(SUM(c.drafts), 0), COALESCE(SUM(c.spam), 0), COALESCE(SUM(c.trash), 0)
+			FROM received_email_counts c
+			JOIN identities i ON c.identity_id = i.id
+			WHERE i.user_id = $1
+		`, userID).Scan(&counts.Inbox, &counts.Unread, &counts.Starred, &counts.Sent, &counts.Drafts, &counts.Spam, &counts.Trash)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get counts: %w", err)
+		}
 
 		s.db.QueryRowContext(ctx, `
-			SELECT COUNT(*) FROM received_emails re
-			JOIN identities i ON re.identity_id = i.id
-			WHERE i.user_id = $1 AND re.is_trashed = true
-		`, userID).Scan(&counts.Trash)
+			SELECT COUNT(*) FROM compose_sends
+			WHERE user_id = $1 AND scheduled = true AND status = 'pending'
+		`, userID).Scan(&counts.Scheduled)
 	}
 
 	return counts, nil
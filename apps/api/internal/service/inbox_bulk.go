@@ -0,0 +1,376 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// Bulk operations act on every received email matching a filter, such as all
+// spam older than 30 days, rather than on a list of UUIDs. The emails are
+// worked through in batches by the worker, oldest first, with the job's
+// progress saved after each one. Only the user's own emails are changed, not
+// those of shared mailboxes, and only those there were when the job was
+// created.
+
+// Bulk inbox actions
+const (
+	BulkActionMarkRead   = "mark_read"
+	BulkActionMarkUnread = "mark_unread"
+	BulkActionStar       = "star"
+	BulkActionUnstar     = "unstar"
+	BulkActionMove       = "move"
+	BulkActionTrash      = "trash"
+	BulkActionDelete     = "delete" // Permanently
+)
+
+// Inbox bulk job statuses, as stored in inbox_bulk_jobs
+const (
+	BulkJobPending   = "pending"
+	BulkJobRunning   = "running"
+	BulkJobCompleted = "completed"
+	BulkJobFailed    = "failed"
+)
+
+// bulkJobBatchSize is how many emails a job changes between saves of its
+// progress
+const bulkJobBatchSize = 500
+
+// bulkActionUpdates are the columns each action other than move and delete
+// sets; $2 is the time of the batch
+var bulkActionUpdates = map[string]string{
+	BulkActionMarkRead:   "is_read = true, read_at = COALESCE(read_at, $2), updated_at = $2",
+	BulkActionMarkUnread: "is_read = false, read_at = NULL, updated_at = $2",
+	BulkActionStar:       "is_starred = true, updated_at = $2",
+	BulkActionUnstar:     "is_starred = false, updated_at = $2",
+	BulkActionTrash:      "is_trashed = true, trashed_at = $2, updated_at = $2",
+}
+
+// bulkJobColumns are the columns scanned by scanInboxBulkJob
+const bulkJobColumns = `uuid, action, COALESCE(folder, ''), criteria, status,
+	COALESCE(total, 0), COALESCE(processed, 0), COALESCE(error, ''), started_at, completed_at, created_at`
+
+// scanInboxBulkJob scans a row of bulkJobColumns
+func scanInboxBulkJob(row interface{ Scan(...interface{}) error }) (*model.InboxBulkJob, error) {
+	var job model.InboxBulkJob
+	var criteria []byte
+	var startedAt, completedAt sql.NullTime
+	err := row.Scan(&job.ID, &job.Action, &job.Folder, &criteria, &job.Status,
+		&job.Total, &job.Processed, &job.Error, &startedAt, &completedAt, &job.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	json.Unmarshal(criteria, &job.Filter)
+	if startedAt.Valid {
+		job.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		job.CompletedAt = &completedAt.Time
+	}
+	switch {
+	case job.Status == BulkJobCompleted:
+		job.Progress = 100
+	case job.Total > 0:
+		job.Progress = min(99, job.Processed*100/job.Total)
+	}
+	return &job, nil
+}
+
+// bulkJobScope returns the FROM and WHERE clauses selecting the user's own
+// emails matching a bulk filter, and their arguments. $1 is the user.
+func bulkJobScope(userID int64, filter *model.InboxBulkFilter) (string, []interface{}) {
+	scope, args := receivedEmailFilter(userID, &model.InboxListRequest{
+		IdentityID: filter.IdentityID,
+		Folder:     filter.Folder,
+		IsRead:     filter.IsRead,
+		IsStarred:  filter.IsStarred,
+		Search:     filter.Search,
+	})
+	scope += " AND i.user_id = $1"
+	if filter.ReceivedAfter != "" {
+		args = append(args, filter.ReceivedAfter)
+		scope += fmt.Sprintf(" AND re.received_at >= $%d", len(args))
+	}
+	if filter.ReceivedBefore != "" {
+		args = append(args, filter.ReceivedBefore)
+		scope += fmt.Sprintf(" AND re.received_at < $%d", len(args))
+	}
+	return scope, args
+}
+
+// StartInboxBulk queues a bulk operation over the user's emails matching the
+// request's filter
+func (s *InboxService) StartInboxBulk(ctx context.Context, userID int64, req *model.InboxBulkRequest) (*model.InboxBulkJob, error) {
+	action := strings.ToLower(strings.TrimSpace(req.Action))
+	folder := strings.ToLower(strings.TrimSpace(req.Folder))
+	filter := req.Filter
+	filter.Folder = strings.ToLower(strings.TrimSpace(filter.Folder))
+
+	var fields []apierror.FieldError
+	if _, ok := bulkActionUpdates[action]; !ok && action != BulkActionMove && action != BulkActionDelete {
+		fields = append(fields, apierror.FieldError{Field: "action", Message: "must be mark_read, mark_unread, star, unstar, move, trash or delete"})
+	}
+	if action == BulkActionMove && (folder == "" || len(folder) > 50) {
+		fields = append(fields, apierror.FieldError{Field: "folder", Message: "must be 1 to 50 characters"})
+	}
+	if filter.Folder == "" {
+		fields = append(fields, apierror.FieldError{Field: "filter.folder", Message: "is required"})
+	}
+	var after, before time.Time
+	if filter.ReceivedAfter != "" {
+		t, err := time.Parse(time.RFC3339, filter.ReceivedAfter)
+		if err != nil {
+			fields = append(fields, apierror.FieldError{Field: "filter.receivedAfter", Message: "must be an RFC3339 time"})
+		}
+		after = t
+	}
+	if filter.OlderThanDays < 0 {
+		fields = append(fields, apierror.FieldError{Field: "filter.olderThanDays", Message: "must not be negative"})
+	} else if filter.OlderThanDays > 0 {
+		if filter.ReceivedBefore != "" {
+			fields = append(fields, apierror.FieldError{Field: "filter.olderThanDays", Message: "set either olderThanDays or receivedBefore"})
+		}
+		// Resolved now, so the job acts on what was older when it was asked for
+		filter.ReceivedBefore = time.Now().AddDate(0, 0, -filter.OlderThanDays).UTC().Format(time.RFC3339)
+		filter.OlderThanDays = 0
+	}
+	if filter.ReceivedBefore != "" {
+		t, err := time.Parse(time.RFC3339, filter.ReceivedBefore)
+		if err != nil {
+			fields = append(fields, apierror.FieldError{Field: "filter.receivedBefore", Message: "must be an RFC3339 time"})
+		}
+		before = t
+	}
+	if !after.IsZero() && !before.IsZero() && !after.Before(before) {
+		fields = append(fields, apierror.FieldError{Field: "filter.receivedBefore", Message: "must be after receivedAfter"})
+	}
+	if len(fields) > 0 {
+		return nil, &apierror.ValidationError{Fields: fields}
+	}
+	if action != BulkActionMove {
+		folder = ""
+	}
+
+	scope, args := bulkJobScope(userID, &filter)
+	var total int
+	var maxEmailID int64
+	err := s.db.QueryRowContext(ctx, "SELECT COUNT(*), COALESCE(MAX(re.id), 0) "+scope, args...).Scan(&total, &maxEmailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count emails: %w", err)
+	}
+
+	criteria, _ := json.Marshal(filter)
+	// Nothing matching is done already
+	status := BulkJobPending
+	var completedAt sql.NullTime
+	if total == 0 {
+		status = BulkJobCompleted
+		completedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	}
+	var jobID int64
+	var jobUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO inbox_bulk_jobs (user_id, action, folder, criteria, max_email_id, status, total, completed_at, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, $8, NOW())
+		RETURNING id, uuid
+	`, userID, action, folder, criteria, maxEmailID, status, total, completedAt).Scan(&jobID, &jobUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bulk job: %w", err)
+	}
+
+	if total > 0 {
+		queueClient, err := worker.NewQueueClient(s.cfg)
+		if err != nil {
+			markInboxBulkFailed(ctx, s.db, jobID, err)
+			return nil, fmt.Errorf("failed to connect to queue: %w", err)
+		}
+		defer queueClient.Close()
+
+		if _, err := queueClient.EnqueueInboxBulk(&worker.InboxBulkPayload{JobID: jobID, UserID: userID}); err != nil {
+			markInboxBulkFailed(ctx, s.db, jobID, err)
+			return nil, fmt.Errorf("failed to queue bulk job: %w", err)
+		}
+	}
+
+	return s.GetInboxBulk(ctx, userID, jobUUID)
+}
+
+// GetInboxBulk returns a bulk job by UUID, with its progress
+func (s *InboxService) GetInboxBulk(ctx context.Context, userID int64, jobUUID string) (*model.InboxBulkJob, error) {
+	job, err := scanInboxBulkJob(s.db.QueryRowContext(ctx, `
+		SELECT `+bulkJobColumns+`
+		FROM inbox_bulk_jobs
+		WHERE uuid::text = $1 AND user_id = $2
+	`, jobUUID, userID))
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "bulk job not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get bulk job: %w", err)
+	}
+	return job, nil
+}
+
+// markInboxBulkFailed ends a job that can't go on
+func markInboxBulkFailed(ctx context.Context, db *sql.DB, jobID int64, err error) {
+	db.ExecContext(ctx, `
+		UPDATE inbox_bulk_jobs SET status = $2, error = $3, completed_at = NOW()
+		WHERE id = $1 AND status IN ($4, $5)
+	`, jobID, BulkJobFailed, err.Error(), BulkJobPending, BulkJobRunning)
+}
+
+// RunInboxBulk works through the emails of a bulk job it has not reached
+// yet. It implements worker.InboxBulkRunner.
+func (s *InboxService) RunInboxBulk(ctx context.Context, userID, jobID int64) error {
+	var status string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT status FROM inbox_bulk_jobs WHERE id = $1 AND user_id = $2
+	`, jobID, userID).Scan(&status)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get bulk job: %w", err)
+	}
+	if status != BulkJobPending && status != BulkJobRunning {
+		return nil
+	}
+
+	s.db.ExecContext(ctx, `
+		UPDATE inbox_bulk_jobs SET status = $2, started_at = COALESCE(started_at, NOW())
+		WHERE id = $1 AND status = $3
+	`, jobID, BulkJobRunning, BulkJobPending)
+
+	for {
+		done, err := s.runInboxBulkBatch(ctx, userID, jobID)
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+
+	s.db.ExecContext(ctx, `
+		UPDATE inbox_bulk_jobs SET status = $2, completed_at = NOW() WHERE id = $1 AND status = $3
+	`, jobID, BulkJobCompleted, BulkJobRunning)
+	return nil
+}
+
+// FailInboxBulk marks a job that kept failing as failed. It implements
+// worker.InboxBulkRunner.
+func (s *InboxService) FailInboxBulk(ctx context.Context, jobID int64, err error) {
+	markInboxBulkFailed(ctx, s.db, jobID, err)
+}
+
+// runInboxBulkBatch applies the job's action to the next batch of emails and
+// reports whether the job is done. Every action leaves an email it was
+// already applied to as it is, so a batch retried after a failure only
+// changes what it didn't get to.
+func (s *InboxService) runInboxBulkBatch(ctx context.Context, userID, jobID int64) (bool, error) {
+	var status, action, folder string
+	var criteria []byte
+	var maxEmailID, cursor int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT status, action, COALESCE(folder, ''), criteria, COALESCE(max_email_id, 0), COALESCE(last_email_id, 0)
+		FROM inbox_bulk_jobs WHERE id = $1
+	`, jobID).Scan(&status, &action, &folder, &criteria, &maxEmailID, &cursor)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get bulk job: %w", err)
+	}
+	if status != BulkJobRunning {
+		return true, nil
+	}
+	var filter model.InboxBulkFilter
+	if err := json.Unmarshal(criteria, &filter); err != nil {
+		return false, fmt.Errorf("invalid bulk job filter: %w", err)
+	}
+
+	scope, args := bulkJobScope(userID, &filter)
+	args = append(args, cursor, maxEmailID, bulkJobBatchSize)
+	n := len(args)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT re.id %s AND re.id > $%d AND re.id <= $%d
+		ORDER BY re.id
+		LIMIT $%d
+	`, scope, n-2, n-1, n), args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to get emails: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan email: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if len(ids) == 0 {
+		return true, nil
+	}
+
+	if err := s.applyBulkAction(ctx, action, folder, ids); err != nil {
+		return false, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE inbox_bulk_jobs SET processed = processed + $2, last_email_id = $3 WHERE id = $1
+	`, jobID, len(ids), ids[len(ids)-1])
+	if err != nil {
+		return false, fmt.Errorf("failed to save bulk job progress: %w", err)
+	}
+
+	return len(ids) < bulkJobBatchSize, nil
+}
+
+// applyBulkAction applies a bulk action to a batch of emails, as the UUID
+// list endpoints do
+func (s *InboxService) applyBulkAction(ctx context.Context, action, folder string, ids []int64) error {
+	now := time.Now()
+	var err error
+	switch action {
+	case BulkActionMove:
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE received_emails SET folder = $3, updated_at = $2`+folderMoveUpdates(folder)+`
+			WHERE id = ANY($1)
+		`, pq.Array(ids), now, folder)
+	case BulkActionDelete:
+		tx, txErr := s.db.BeginTx(ctx, nil)
+		if txErr != nil {
+			return fmt.Errorf("failed to start transaction: %w", txErr)
+		}
+		defer tx.Rollback()
+		if _, err = tx.ExecContext(ctx, `DELETE FROM email_attachments WHERE received_email_id = ANY($1)`, pq.Array(ids)); err == nil {
+			if _, err = tx.ExecContext(ctx, `DELETE FROM received_emails WHERE id = ANY($1)`, pq.Array(ids)); err == nil {
+				err = tx.Commit()
+			}
+		}
+	default:
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE received_emails SET `+bulkActionUpdates[action]+`
+			WHERE id = ANY($1)
+		`, pq.Array(ids), now)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to %s emails: %w", strings.ReplaceAll(action, "_", " "), err)
+	}
+	return nil
+}
@@ -0,0 +1,481 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// Inbox filters sort a user's received emails as they arrive. Every active
+// filter of the user whose conditions an email meets acts on it, highest
+// priority first; where filters disagree on a folder, the highest priority
+// one wins. Their actions are applied to the email in one update.
+
+// Inbox filter condition fields and operators
+var (
+	filterFields    = map[string]bool{"from": true, "to": true, "cc": true, "subject": true, "body": true, "hasAttachment": true}
+	filterOperators = map[string]bool{"contains": true, "notContains": true, "equals": true, "startsWith": true, "endsWith": true, "regex": true}
+)
+
+// inboxFilterColumns are the columns scanned by scanInboxFilter
+const inboxFilterColumns = `id, uuid, org_id, user_id, identity_id, name, priority, active, conditions,
+	condition_logic, action_labels, action_folder, action_star, action_mark_read, action_archive,
+	action_trash, action_forward, match_count, last_matched_at, created_at, updated_at`
+
+// scanInboxFilter scans a row of inboxFilterColumns
+func scanInboxFilter(row interface{ Scan(...interface{}) error }) (*model.InboxFilter, error) {
+	var f model.InboxFilter
+	var identityID sql.NullInt64
+	var conditions []byte
+	var labels pq.StringArray
+	var folder, forward sql.NullString
+	var lastMatchedAt sql.NullTime
+	err := row.Scan(&f.ID, &f.UUID, &f.OrgID, &f.UserID, &identityID, &f.Name, &f.Priority, &f.Active, &conditions,
+		&f.ConditionLogic, &labels, &folder, &f.ActionStar, &f.ActionMarkRead, &f.ActionArchive,
+		&f.ActionTrash, &forward, &f.MatchCount, &lastMatchedAt, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if identityID.Valid {
+		f.IdentityID = &identityID.Int64
+	}
+	if err := json.Unmarshal(conditions, &f.Conditions); err != nil {
+		f.Conditions = nil
+	}
+	f.ActionLabels = []string(labels)
+	f.ActionFolder = folder.String
+	f.ActionForward = forward.String
+	if lastMatchedAt.Valid {
+		f.LastMatchedAt = &lastMatchedAt.Time
+	}
+	return &f, nil
+}
+
+// ListFilters returns a user's inbox filters in the order they're applied
+func (s *InboxService) ListFilters(ctx context.Context, userID int64) ([]*model.InboxFilter, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+inboxFilterColumns+`
+		FROM inbox_filters
+		WHERE user_id = $1
+		ORDER BY priority DESC, id
+	`, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list filters: %w", err)
+	}
+	defer rows.Close()
+
+	filters := []*model.InboxFilter{}
+	for rows.Next() {
+		f, err := scanInboxFilter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan filter: %w", err)
+		}
+		filters = append(filters, f)
+	}
+	return filters, nil
+}
+
+// CreateFilter adds an inbox filter, which applies to emails received from
+// then on
+func (s *InboxService) CreateFilter(ctx context.Context, userID, orgID int64, req *model.CreateFilterRequest) (*model.InboxFilter, error) {
+	logic := req.ConditionLogic
+	if logic == "" {
+		logic = "all"
+	}
+	if err := s.validateFilter(ctx, userID, req.IdentityID, req.Conditions, logic, req.ActionForward); err != nil {
+		return nil, err
+	}
+	conditions, _ := json.Marshal(req.Conditions)
+
+	row := s.db.QueryRowContext(ctx, `
+		INSERT INTO inbox_filters (
+			org_id, user_id, identity_id, name, priority, conditions, condition_logic,
+			action_labels, action_folder, action_star, action_mark_read, action_archive, action_trash, action_forward
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, NULLIF($9, ''), $10, $11, $12, $13, NULLIF($14, ''))
+		RETURNING `+inboxFilterColumns,
+		orgID, userID, req.IdentityID, req.Name, req.Priority, conditions, logic,
+		pq.Array(req.ActionLabels), req.ActionFolder, req.ActionStar, req.ActionMarkRead, req.ActionArchive, req.ActionTrash,
+		strings.TrimSpace(req.ActionForward))
+	f, err := scanInboxFilter(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create filter: %w", err)
+	}
+	return f, nil
+}
+
+// UpdateFilter changes an inbox filter; omitted fields are kept
+func (s *InboxService) UpdateFilter(ctx context.Context, userID int64, filterUUID string, req *model.UpdateFilterRequest) (*model.InboxFilter, error) {
+	existing, err := scanInboxFilter(s.db.QueryRowContext(ctx, `
+		SELECT `+inboxFilterColumns+` FROM inbox_filters WHERE uuid::text = $1 AND user_id = $2
+	`, filterUUID, userID))
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "filter not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter: %w", err)
+	}
+
+	conditions := existing.Conditions
+	if req.Conditions != nil {
+		conditions = req.Conditions
+	}
+	logic := existing.ConditionLogic
+	if req.ConditionLogic != "" {
+		logic = req.ConditionLogic
+	}
+	forward := existing.ActionForward
+	if req.ActionForward != "" {
+		forward = strings.TrimSpace(req.ActionForward)
+	}
+	if err := s.validateFilter(ctx, userID, existing.IdentityID, conditions, logic, forward); err != nil {
+		return nil, err
+	}
+	conditionsJSON, _ := json.Marshal(conditions)
+
+	var labels interface{}
+	if req.ActionLabels != nil {
+		labels = pq.Array(req.ActionLabels)
+	}
+	row := s.db.QueryRowContext(ctx, `
+		UPDATE inbox_filters SET
+			name = COALESCE(NULLIF($3, ''), name),
+			priority = COALESCE($4, priority),
+			active = COALESCE($5, active),
+			conditions = $6,
+			condition_logic = $7,
+			action_labels = COALESCE($8, action_labels),
+			action_folder = COALESCE(NULLIF($9, ''), action_folder),
+			action_star = COALESCE($10, action_star),
+			action_mark_read = COALESCE($11, action_mark_read),
+			action_archive = COALESCE($12, action_archive),
+			action_trash = COALESCE($13, action_trash),
+			action_forward = NULLIF($14, ''),
+			updated_at = NOW()
+		WHERE id = $1 AND user_id = $2
+		RETURNING `+inboxFilterColumns,
+		existing.ID, userID, req.Name, req.Priority, req.Active, conditionsJSON, logic,
+		labels, req.ActionFolder, req.ActionStar, req.ActionMarkRead, req.ActionArchive, req.ActionTrash, forward)
+	f, err := scanInboxFilter(row)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update filter: %w", err)
+	}
+	return f, nil
+}
+
+// DeleteFilter removes an inbox filter
+func (s *InboxService) DeleteFilter(ctx context.Context, userID int64, filterUUID string) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM inbox_filters WHERE uuid::text = $1 AND user_id = $2`, filterUUID, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete filter: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return apierror.New(http.StatusNotFound, apierror.CodeNotFound, "filter not found")
+	}
+	return nil
+}
+
+// validateFilter checks a filter's conditions, and that the identity and
+// forwarding address it names are the user's to use
+func (s *InboxService) validateFilter(ctx context.Context, userID int64, identityID *int64, conditions []model.FilterCondition, logic, forward string) error {
+	var fields []apierror.FieldError
+	if len(conditions) == 0 {
+		fields = append(fields, apierror.FieldError{Field: "conditions", Rule: "required", Message: "at least one condition is required"})
+	}
+	for i, cond := range conditions {
+		field := fmt.Sprintf("conditions[%d]", i)
+		if !filterFields[cond.Field] {
+			fields = append(fields, apierror.FieldError{Field: field + ".field", Rule: "in", Message: "field must be from, to, cc, subject, body or hasAttachment"})
+		}
+		if cond.Field != "hasAttachment" && !filterOperators[cond.Operator] {
+			fields = append(fields, apierror.FieldError{Field: field + ".operator", Rule: "in", Message: "operator must be contains, notContains, equals, startsWith, endsWith or regex"})
+		}
+		if cond.Operator == "regex" {
+			if _, err := regexp.Compile(cond.Value); err != nil {
+				fields = append(fields, apierror.FieldError{Field: field + ".value", Rule: "regex", Message: "value is not a valid regular expression"})
+			}
+		}
+	}
+	if logic != "all" && logic != "any" {
+		fields = append(fields, apierror.FieldError{Field: "conditionLogic", Rule: "in", Message: "conditionLogic must be all or any"})
+	}
+	if len(fields) > 0 {
+		return &apierror.ValidationError{Fields: fields}
+	}
+
+	if identityID != nil {
+		var owned bool
+		err := s.db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM identities WHERE id = $1 AND user_id = $2)
+		`, *identityID, userID).Scan(&owned)
+		if err != nil || !owned {
+			return apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "identity not found")
+		}
+	}
+	if forward != "" && !filterForwardAllowed(ctx, s.db, userID, forward) {
+		return apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest,
+			"emails can only be forwarded to your own identities or verified forwarding addresses")
+	}
+	return nil
+}
+
+// filterForwardAllowed reports whether filters of a user may forward to an
+// address: one of the user's identities, or a forwarding address they have
+// verified. Anything else would let filters send mail anywhere.
+func filterForwardAllowed(ctx context.Context, db *sql.DB, userID int64, address string) bool {
+	var allowed bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM identities WHERE user_id = $1 AND LOWER(email) = LOWER($2))
+			OR EXISTS(SELECT 1 FROM email_forwards WHERE user_id = $1 AND LOWER(forward_to) = LOWER($2) AND verified = true)
+	`, userID, address).Scan(&allowed)
+	return err == nil && allowed
+}
+
+// InboxFilterEngine runs users' inbox filters on the emails they receive
+type InboxFilterEngine struct {
+	db      *sql.DB
+	compose *ComposeService
+}
+
+// NewInboxFilterEngine creates the inbox filter engine. Filters forward
+// emails through the compose service.
+func NewInboxFilterEngine(db *sql.DB, composeService *ComposeService) *InboxFilterEngine {
+	return &InboxFilterEngine{db: db, compose: composeService}
+}
+
+// filterActions are the combined actions of the filters an email matched
+type filterActions struct {
+	filterIDs []int
+	folder    string
+	labels    []string
+	star      bool
+	markRead  bool
+	archive   bool
+	trash     bool
+	forwards  []string
+}
+
+// add combines a matched filter's actions into those of the filters matched
+// before it, which have at least its priority
+func (a *filterActions) add(f *model.InboxFilter) {
+	a.filterIDs = append(a.filterIDs, f.ID)
+	if a.folder == "" {
+		a.folder = f.ActionFolder
+	}
+	a.labels = append(a.labels, f.ActionLabels...)
+	a.star = a.star || f.ActionStar
+	a.markRead = a.markRead || f.ActionMarkRead
+	a.archive = a.archive || f.ActionArchive
+	a.trash = a.trash || f.ActionTrash
+	if f.ActionForward != "" {
+		a.forwards = append(a.forwards, f.ActionForward)
+	}
+}
+
+// filterEmailColumns are the columns of a received email and its owner that
+// filters are matched against, scanned by scanFilterEmail
+const filterEmailColumns = `re.id, re.identity_id, i.user_id, re.from_email, re.from_name, re.to_emails, re.cc_emails,
+	re.subject, re.text_body, re.has_attachments, re.is_spam`
+
+// scanFilterEmail scans a row of filterEmailColumns
+func scanFilterEmail(row interface{ Scan(...interface{}) error }) (*model.ReceivedEmail, int64, error) {
+	var email model.ReceivedEmail
+	var userID int64
+	var toEmails, ccEmails pq.StringArray
+	var fromName, textBody sql.NullString
+	err := row.Scan(&email.ID, &email.IdentityID, &userID, &email.FromEmail, &fromName, &toEmails, &ccEmails,
+		&email.Subject, &textBody, &email.HasAttachments, &email.IsSpam)
+	if err != nil {
+		return nil, 0, err
+	}
+	email.FromName = fromName.String
+	email.TextBody = textBody.String
+	email.ToEmails = []string(toEmails)
+	email.CcEmails = []string(ccEmails)
+	return &email, userID, nil
+}
+
+// Apply runs the filters of a received email's owner on it
+func (e *InboxFilterEngine) Apply(ctx context.Context, emailID int64) error {
+	email, userID, err := scanFilterEmail(e.db.QueryRowContext(ctx, `
+		SELECT `+filterEmailColumns+`
+		FROM received_emails re
+		JOIN identities i ON i.id = re.identity_id
+		WHERE re.id = $1
+	`, emailID))
+	if err != nil {
+		return fmt.Errorf("failed to get email: %w", err)
+	}
+
+	rows, err := e.db.QueryContext(ctx, `
+		SELECT `+inboxFilterColumns+`
+		FROM inbox_filters
+		WHERE user_id = $1 AND active = true AND (identity_id IS NULL OR identity_id = $2)
+		ORDER BY priority DESC, id
+	`, userID, email.IdentityID)
+	if err != nil {
+		return fmt.Errorf("failed to get filters: %w", err)
+	}
+	var filters []*model.InboxFilter
+	for rows.Next() {
+		f, err := scanInboxFilter(rows)
+		if err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan filter: %w", err)
+		}
+		filters = append(filters, f)
+	}
+	rows.Close()
+
+	var actions filterActions
+	for _, f := range filters {
+		if matchesFilter(email, f.Conditions, f.ConditionLogic) {
+			actions.add(f)
+		}
+	}
+	if len(actions.filterIDs) == 0 {
+		return nil
+	}
+	if err := e.act(ctx, email, userID, &actions, true); err != nil {
+		return err
+	}
+
+	_, err = e.db.ExecContext(ctx, `
+		UPDATE inbox_filters SET match_count = match_count + 1, last_matched_at = $2 WHERE id = ANY($1)
+	`, pq.Array(actions.filterIDs), time.Now())
+	if err != nil {
+		log.Printf("Failed to update filter match counts: %v", err)
+	}
+
+	log.Printf("Applied %d filter(s) to email %d", len(actions.filterIDs), email.ID)
+	return nil
+}
+
+// act applies the actions of the filters an email matched, forwarding it
+// only if asked to
+func (e *InboxFilterEngine) act(ctx context.Context, email *model.ReceivedEmail, userID int64, actions *filterActions, forward bool) error {
+	if actions.labels == nil {
+		actions.labels = []string{}
+	}
+	_, err := e.db.ExecContext(ctx, `
+		UPDATE received_emails SET
+			folder = COALESCE(NULLIF($2, ''), folder),
+			labels = ARRAY(SELECT DISTINCT unnest(COALESCE(labels, '{}') || $3::text[])),
+			is_starred = is_starred OR $4,
+			is_read = is_read OR $5,
+			read_at = CASE WHEN $5 AND read_at IS NULL THEN NOW() ELSE read_at END,
+			is_archived = is_archived OR $6,
+			is_trashed = is_trashed OR $7,
+			trashed_at = CASE WHEN $7 AND trashed_at IS NULL THEN NOW() ELSE trashed_at END,
+			updated_at = NOW()
+		WHERE id = $1
+	`, email.ID, actions.folder, pq.Array(actions.labels), actions.star, actions.markRead, actions.archive, actions.trash)
+	if err != nil {
+		return fmt.Errorf("failed to apply filters: %w", err)
+	}
+
+	// Spam isn't passed on
+	if forward && !email.IsSpam && e.compose != nil {
+		seen := make(map[string]bool)
+		for _, to := range actions.forwards {
+			key := strings.ToLower(to)
+			if seen[key] {
+				continue
+			}
+			seen[key] = true
+			// Checked again in case the address was removed since
+			if !filterForwardAllowed(ctx, e.db, userID, to) {
+				log.Printf("Filter forward of email %d to %s is no longer allowed", email.ID, to)
+				continue
+			}
+			if err := e.compose.ForwardReceived(ctx, userID, email.IdentityID, email.ID, to); err != nil {
+				log.Printf("Failed to forward email %d to %s: %v", email.ID, to, err)
+			}
+		}
+	}
+	return nil
+}
+
+// matchesFilter checks if an email matches filter conditions
+func matchesFilter(email *model.ReceivedEmail, conditions []model.FilterCondition, logic string) bool {
+	if len(conditions) == 0 {
+		return false
+	}
+
+	for _, cond := range conditions {
+		matches := matchesCondition(email, cond)
+
+		if logic == "any" && matches {
+			return true
+		}
+		if logic != "any" && !matches {
+			return false
+		}
+	}
+
+	return logic != "any"
+}
+
+// matchesCondition checks if an email matches a single condition
+func matchesCondition(email *model.ReceivedEmail, cond model.FilterCondition) bool {
+	// Text conditions on the sender see its name too; the others, its address
+	var value, text string
+	switch cond.Field {
+	case "from":
+		value = email.FromEmail
+		text = email.FromName + " <" + email.FromEmail + ">"
+	case "to":
+		value = strings.Join(email.ToEmails, ", ")
+	case "cc":
+		value = strings.Join(email.CcEmails, ", ")
+	case "subject":
+		value = email.Subject
+	case "body":
+		value = email.TextBody
+	case "hasAttachment":
+		if email.HasAttachments {
+			return cond.Value == "true"
+		}
+		return cond.Value == "false"
+	default:
+		return false
+	}
+
+	if text == "" {
+		text = value
+	}
+
+	if cond.Operator == "regex" {
+		re, err := regexp.Compile("(?i)" + cond.Value)
+		return err == nil && re.MatchString(text)
+	}
+
+	value = strings.ToLower(value)
+	text = strings.ToLower(text)
+	condValue := strings.ToLower(cond.Value)
+
+	switch cond.Operator {
+	case "contains":
+		return strings.Contains(text, condValue)
+	case "notContains":
+		return !strings.Contains(text, condValue)
+	case "equals":
+		return value == condValue
+	case "startsWith":
+		return strings.HasPrefix(value, condValue)
+	case "endsWith":
+		return strings.HasSuffix(value, condValue)
+	}
+
+	return false
+}
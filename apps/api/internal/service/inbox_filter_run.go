@@ -0,0 +1,331 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// A filter run applies one inbox filter to emails already received, so a new
+// rule can clean up an inbox that's already full. The emails in scope are
+// worked through in batches by the worker, oldest first, with the run's
+// progress saved after each one. Runs don't forward emails: only mail
+// arriving after a filter is saved is passed on.
+
+// Inbox filter run statuses, as stored in inbox_filter_runs
+const (
+	FilterRunPending   = "pending"
+	FilterRunRunning   = "running"
+	FilterRunCompleted = "completed"
+	FilterRunFailed    = "failed"
+)
+
+// filterRunBatchSize is how many emails a run checks between saves of its
+// progress
+const filterRunBatchSize = 200
+
+// filterRunScope selects the emails of a run: $1 is the user, $2 the filter's
+// identity or NULL, $3 the folder, $4 and $5 the received range. Quarantined
+// emails are never filtered.
+const filterRunScope = `i.user_id = $1
+	AND re.folder <> 'quarantine'
+	AND ($2::int IS NULL OR re.identity_id = $2)
+	AND CASE $3::text
+		WHEN '' THEN re.is_trashed = false
+		WHEN 'trash' THEN re.is_trashed = true
+		WHEN 'archive' THEN re.is_archived = true AND re.is_trashed = false
+		WHEN 'spam' THEN (re.folder = 'spam' OR re.is_spam = true) AND re.is_trashed = false
+		WHEN 'inbox' THEN re.folder = 'inbox' AND re.is_archived = false AND re.is_trashed = false
+		ELSE re.folder = $3 AND re.is_trashed = false
+	END
+	AND ($4::timestamptz IS NULL OR re.received_at >= $4)
+	AND ($5::timestamptz IS NULL OR re.received_at < $5)`
+
+// inboxFilterRunColumns are the columns scanned by scanInboxFilterRun
+const inboxFilterRunColumns = `r.uuid, f.uuid, COALESCE(r.folder, ''), r.received_after, r.received_before, r.status,
+	COALESCE(r.total, 0), COALESCE(r.processed, 0), COALESCE(r.matched, 0), COALESCE(r.error, ''),
+	r.started_at, r.completed_at, r.created_at`
+
+// scanInboxFilterRun scans a row of inboxFilterRunColumns
+func scanInboxFilterRun(row interface{ Scan(...interface{}) error }) (*model.InboxFilterRun, error) {
+	var run model.InboxFilterRun
+	var after, before, startedAt, completedAt sql.NullTime
+	err := row.Scan(&run.ID, &run.FilterID, &run.Folder, &after, &before, &run.Status,
+		&run.Total, &run.Processed, &run.Matched, &run.Error, &startedAt, &completedAt, &run.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if after.Valid {
+		run.ReceivedAfter = &after.Time
+	}
+	if before.Valid {
+		run.ReceivedBefore = &before.Time
+	}
+	if startedAt.Valid {
+		run.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		run.CompletedAt = &completedAt.Time
+	}
+	switch {
+	case run.Status == FilterRunCompleted:
+		run.Progress = 100
+	case run.Total > 0:
+		run.Progress = min(99, run.Processed*100/run.Total)
+	}
+	return &run, nil
+}
+
+// RunFilter queues a run of a filter over the user's emails already received
+// that are in the requested folder and date range
+func (s *InboxService) RunFilter(ctx context.Context, userID int64, filterUUID string, req *model.RunFilterRequest) (*model.InboxFilterRun, error) {
+	var filterID int64
+	var identityID sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, identity_id FROM inbox_filters WHERE uuid::text = $1 AND user_id = $2
+	`, filterUUID, userID).Scan(&filterID, &identityID)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "filter not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter: %w", err)
+	}
+
+	folder := strings.ToLower(strings.TrimSpace(req.Folder))
+	var fields []apierror.FieldError
+	if len(folder) > 50 {
+		fields = append(fields, apierror.FieldError{Field: "folder", Message: "must be at most 50 characters"})
+	}
+	var after, before sql.NullTime
+	if req.ReceivedAfter != "" {
+		t, err := time.Parse(time.RFC3339, req.ReceivedAfter)
+		if err != nil {
+			fields = append(fields, apierror.FieldError{Field: "receivedAfter", Message: "must be an RFC3339 time"})
+		}
+		after = sql.NullTime{Time: t, Valid: err == nil}
+	}
+	if req.ReceivedBefore != "" {
+		t, err := time.Parse(time.RFC3339, req.ReceivedBefore)
+		if err != nil {
+			fields = append(fields, apierror.FieldError{Field: "receivedBefore", Message: "must be an RFC3339 time"})
+		}
+		before = sql.NullTime{Time: t, Valid: err == nil}
+	}
+	if after.Valid && before.Valid && !after.Time.Before(before.Time) {
+		fields = append(fields, apierror.FieldError{Field: "receivedBefore", Message: "must be after receivedAfter"})
+	}
+	if len(fields) > 0 {
+		return nil, &apierror.ValidationError{Fields: fields}
+	}
+
+	var total int
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM received_emails re
+		JOIN identities i ON i.id = re.identity_id
+		WHERE `+filterRunScope,
+		userID, identityID, folder, after, before).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count emails: %w", err)
+	}
+
+	var runID int64
+	var runUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO inbox_filter_runs (filter_id, user_id, folder, received_after, received_before, status, total, created_at)
+		VALUES ($1, $2, NULLIF($3, ''), $4, $5, $6, $7, NOW())
+		RETURNING id, uuid
+	`, filterID, userID, folder, after, before, FilterRunPending, total).Scan(&runID, &runUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create filter run: %w", err)
+	}
+
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		markFilterRunFailed(ctx, s.db, runID, err)
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	if _, err := queueClient.EnqueueFilterRun(&worker.FilterRunPayload{RunID: runID, UserID: userID}); err != nil {
+		markFilterRunFailed(ctx, s.db, runID, err)
+		return nil, fmt.Errorf("failed to queue filter run: %w", err)
+	}
+
+	return s.GetFilterRun(ctx, userID, runUUID)
+}
+
+// GetFilterRun returns a filter run by UUID, with its progress
+func (s *InboxService) GetFilterRun(ctx context.Context, userID int64, runUUID string) (*model.InboxFilterRun, error) {
+	run, err := scanInboxFilterRun(s.db.QueryRowContext(ctx, `
+		SELECT `+inboxFilterRunColumns+`
+		FROM inbox_filter_runs r
+		JOIN inbox_filters f ON f.id = r.filter_id
+		WHERE r.uuid::text = $1 AND r.user_id = $2
+	`, runUUID, userID))
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "filter run not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get filter run: %w", err)
+	}
+	return run, nil
+}
+
+// markFilterRunFailed ends a run that can't go on
+func markFilterRunFailed(ctx context.Context, db *sql.DB, runID int64, err error) {
+	db.ExecContext(ctx, `
+		UPDATE inbox_filter_runs SET status = $2, error = $3, completed_at = NOW()
+		WHERE id = $1 AND status IN ($4, $5)
+	`, runID, FilterRunFailed, err.Error(), FilterRunPending, FilterRunRunning)
+}
+
+// RunFilter works through the emails of a filter run that have not been
+// processed yet. It implements worker.FilterRunner.
+func (e *InboxFilterEngine) RunFilter(ctx context.Context, userID, runID int64) error {
+	var status string
+	err := e.db.QueryRowContext(ctx, `
+		SELECT status FROM inbox_filter_runs WHERE id = $1 AND user_id = $2
+	`, runID, userID).Scan(&status)
+	if err == sql.ErrNoRows {
+		// The filter was deleted, and its runs with it
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get filter run: %w", err)
+	}
+	if status != FilterRunPending && status != FilterRunRunning {
+		return nil
+	}
+
+	e.db.ExecContext(ctx, `
+		UPDATE inbox_filter_runs SET status = $2, started_at = COALESCE(started_at, NOW())
+		WHERE id = $1 AND status = $3
+	`, runID, FilterRunRunning, FilterRunPending)
+
+	for {
+		done, err := e.runFilterBatch(ctx, userID, runID)
+		if err != nil {
+			return err
+		}
+		if done {
+			break
+		}
+	}
+
+	e.db.ExecContext(ctx, `
+		UPDATE inbox_filter_runs SET status = $2, completed_at = NOW() WHERE id = $1 AND status = $3
+	`, runID, FilterRunCompleted, FilterRunRunning)
+	return nil
+}
+
+// FailFilterRun marks a run that kept failing as failed. It implements
+// worker.FilterRunner.
+func (e *InboxFilterEngine) FailFilterRun(ctx context.Context, runID int64, err error) {
+	markFilterRunFailed(ctx, e.db, runID, err)
+}
+
+// runFilterBatch applies the run's filter to the next batch of emails and
+// reports whether the run is done. The filter's actions leave an email they
+// were already applied to as it is, so a batch retried after a failure only
+// changes what it didn't get to.
+func (e *InboxFilterEngine) runFilterBatch(ctx context.Context, userID, runID int64) (bool, error) {
+	var status, folder string
+	var cursor int64
+	var after, before sql.NullTime
+	f, err := scanInboxFilter(e.db.QueryRowContext(ctx, `
+		SELECT `+inboxFilterColumns+`
+		FROM inbox_filters
+		WHERE id = (SELECT filter_id FROM inbox_filter_runs WHERE id = $1)
+	`, runID))
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get filter: %w", err)
+	}
+	err = e.db.QueryRowContext(ctx, `
+		SELECT status, COALESCE(folder, ''), received_after, received_before, COALESCE(last_email_id, 0)
+		FROM inbox_filter_runs WHERE id = $1
+	`, runID).Scan(&status, &folder, &after, &before, &cursor)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get filter run: %w", err)
+	}
+	if status != FilterRunRunning {
+		return true, nil
+	}
+
+	var identityID sql.NullInt64
+	if f.IdentityID != nil {
+		identityID = sql.NullInt64{Int64: *f.IdentityID, Valid: true}
+	}
+	rows, err := e.db.QueryContext(ctx, `
+		SELECT `+filterEmailColumns+`
+		FROM received_emails re
+		JOIN identities i ON i.id = re.identity_id
+		WHERE `+filterRunScope+` AND re.id > $6
+		ORDER BY re.id
+		LIMIT $7
+	`, userID, identityID, folder, after, before, cursor, filterRunBatchSize)
+	if err != nil {
+		return false, fmt.Errorf("failed to get emails: %w", err)
+	}
+	var emails []*model.ReceivedEmail
+	for rows.Next() {
+		email, _, err := scanFilterEmail(rows)
+		if err != nil {
+			rows.Close()
+			return false, fmt.Errorf("failed to scan email: %w", err)
+		}
+		emails = append(emails, email)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if len(emails) == 0 {
+		return true, nil
+	}
+
+	var actions filterActions
+	actions.add(f)
+	matched := 0
+	for _, email := range emails {
+		if !matchesFilter(email, f.Conditions, f.ConditionLogic) {
+			continue
+		}
+		if err := e.act(ctx, email, userID, &actions, false); err != nil {
+			return false, err
+		}
+		matched++
+	}
+
+	_, err = e.db.ExecContext(ctx, `
+		UPDATE inbox_filter_runs
+		SET processed = processed + $2, matched = matched + $3, last_email_id = $4
+		WHERE id = $1
+	`, runID, len(emails), matched, emails[len(emails)-1].ID)
+	if err != nil {
+		return false, fmt.Errorf("failed to save filter run progress: %w", err)
+	}
+	if matched > 0 {
+		_, err = e.db.ExecContext(ctx, `
+			UPDATE inbox_filters SET match_count = match_count + $2, last_matched_at = $3 WHERE id = $1
+		`, f.ID, matched, time.Now())
+		if err != nil {
+			log.Printf("Failed to update filter match count: %v", err)
+		}
+	}
+
+	return len(emails) < filterRunBatchSize, nil
+}
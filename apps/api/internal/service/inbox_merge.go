@@ -0,0 +1,117 @@
+package service
+
+import (
+	"container/heap"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// The unified inbox orders emails newest first, across identities, breaking
+// ties by identity and then by email ID so the order is total. A page ends at
+// a cursor naming its last email; the next page takes each identity's emails
+// after it and merges them, so pages neither skip nor repeat emails when
+// others arrive in the meantime.
+
+// errInvalidCursor is returned for cursors the unified inbox didn't make
+var errInvalidCursor = apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "invalid cursor")
+
+// unifiedCursor is the position of an email in the unified inbox's order
+type unifiedCursor struct {
+	ReceivedAt time.Time
+	IdentityID int64
+	EmailID    string // The email's JMAP ID
+}
+
+// encodeUnifiedCursor returns the opaque cursor of the page after an email
+func encodeUnifiedCursor(e UnifiedEmail) string {
+	_, emailID, _ := parseUnifiedID(e.ID)
+	raw := fmt.Sprintf("%d:%d:%s", e.ReceivedAt.UnixNano(), e.IdentityID, emailID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeUnifiedCursor reads a cursor made by encodeUnifiedCursor
+func decodeUnifiedCursor(cursor string) (*unifiedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	parts := strings.SplitN(string(raw), ":", 3)
+	if len(parts) != 3 || parts[2] == "" {
+		return nil, errInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	identityID, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	return &unifiedCursor{ReceivedAt: time.Unix(0, nanos), IdentityID: identityID, EmailID: parts[2]}, nil
+}
+
+// unifiedLess reports whether email a comes before email b in the unified
+// inbox
+func unifiedLess(a, b UnifiedEmail) bool {
+	if !a.ReceivedAt.Equal(b.ReceivedAt) {
+		return a.ReceivedAt.After(b.ReceivedAt)
+	}
+	if a.IdentityID != b.IdentityID {
+		return a.IdentityID < b.IdentityID
+	}
+	return a.ID < b.ID
+}
+
+// after reports whether an email comes after the cursor
+func (c *unifiedCursor) after(e UnifiedEmail) bool {
+	return unifiedLess(UnifiedEmail{
+		ID:         formatUnifiedID(c.IdentityID, c.EmailID),
+		ReceivedAt: c.ReceivedAt,
+		IdentityID: c.IdentityID,
+	}, e)
+}
+
+// mergeUnified merges the emails of each identity, each in the unified
+// inbox's order, into the first limit emails of them all
+func mergeUnified(lists [][]UnifiedEmail, limit int) []UnifiedEmail {
+	h := &unifiedHeap{}
+	for _, list := range lists {
+		if len(list) > 0 {
+			*h = append(*h, list)
+		}
+	}
+	heap.Init(h)
+
+	merged := make([]UnifiedEmail, 0, limit)
+	for h.Len() > 0 && len(merged) < limit {
+		list := (*h)[0]
+		merged = append(merged, list[0])
+		if len(list) == 1 {
+			heap.Pop(h)
+		} else {
+			(*h)[0] = list[1:]
+			heap.Fix(h, 0)
+		}
+	}
+	return merged
+}
+
+// unifiedHeap holds the emails left of each identity, ordered by their first
+type unifiedHeap [][]UnifiedEmail
+
+func (h unifiedHeap) Len() int           { return len(h) }
+func (h unifiedHeap) Less(i, j int) bool { return unifiedLess(h[i][0], h[j][0]) }
+func (h unifiedHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *unifiedHeap) Push(x any)        { *h = append(*h, x.([]UnifiedEmail)) }
+func (h *unifiedHeap) Pop() any {
+	old := *h
+	list := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return list
+}
@@ -0,0 +1,110 @@
+package service
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+)
+
+// receivedThreadKey groups received emails by thread; emails without one are
+// a thread of their own, keyed by their UUID
+const receivedThreadKey = `COALESCE(NULLIF(re.thread_id, ''), re.uuid::text)`
+
+// ListReceivedThreads returns a paginated list of the conversations in the
+// received inbox, newest first. It takes the filters of ListReceivedEmails;
+// each thread is shown by its latest message, with counts over the messages
+// that match them.
+func (s *InboxService) ListReceivedThreads(ctx context.Context, userID int64, req *model.InboxListRequest) (*model.InboxThreadListResponse, error) {
+	baseQuery, args := receivedEmailFilter(userID, req)
+
+	var total int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(DISTINCT re.identity_id::text || ':' || `+receivedThreadKey+`) `+baseQuery,
+		args...,
+	).Scan(&total)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count threads: %w", err)
+	}
+
+	page, pageSize := receivedEmailPage(req)
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		WITH matched AS (
+			SELECT re.id, re.identity_id, `+receivedThreadKey+` AS thread_key, re.received_at,
+			       re.is_read, re.is_starred, re.has_attachments, LOWER(re.from_email) AS from_email
+			%s
+		), threads AS (
+			SELECT identity_id, thread_key, COUNT(*) AS message_count,
+			       COUNT(*) FILTER (WHERE NOT is_read) AS unread_count,
+			       bool_or(is_starred) AS is_starred, bool_or(has_attachments) AS has_attachments,
+			       array_agg(DISTINCT from_email) AS participants, MAX(received_at) AS last_message_at,
+			       (array_agg(id ORDER BY received_at DESC, id DESC))[1] AS latest_id
+			FROM matched
+			GROUP BY identity_id, thread_key
+		)
+		SELECT t.thread_key, re.subject, COALESCE(re.snippet, ''), re.uuid, re.from_email, COALESCE(re.from_name, ''),
+		       t.participants, t.message_count, t.unread_count, t.is_starred, t.has_attachments, t.last_message_at,
+		       t.identity_id, i.email, COALESCE(i.color, '')
+		FROM threads t
+		JOIN received_emails re ON re.id = t.latest_id
+		JOIN identities i ON i.id = t.identity_id
+		ORDER BY t.last_message_at DESC, t.latest_id DESC
+		LIMIT %d OFFSET %d
+	`, baseQuery, pageSize, (page-1)*pageSize), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query threads: %w", err)
+	}
+	defer rows.Close()
+
+	threads := []model.ReceivedThread{}
+	for rows.Next() {
+		var t model.ReceivedThread
+		err := rows.Scan(
+			&t.ThreadID, &t.Subject, &t.Snippet, &t.LatestUUID, &t.FromEmail, &t.FromName,
+			pq.Array(&t.Participants), &t.MessageCount, &t.UnreadCount, &t.IsStarred, &t.HasAttachments, &t.LastMessageAt,
+			&t.IdentityID, &t.IdentityEmail, &t.IdentityColor,
+		)
+		if err != nil {
+			continue
+		}
+		threads = append(threads, t)
+	}
+
+	totalPages := total / pageSize
+	if total%pageSize > 0 {
+		totalPages++
+	}
+
+	return &model.InboxThreadListResponse{
+		Threads:    threads,
+		Total:      total,
+		Unread:     s.receivedUnreadCount(ctx, userID, req.IdentityID),
+		Page:       page,
+		PageSize:   pageSize,
+		TotalPages: totalPages,
+	}, nil
+}
+
+// GetReceivedThread returns the messages of a conversation in the received
+// inbox, received and sent, oldest first
+func (s *InboxService) GetReceivedThread(ctx context.Context, userID int64, threadID string) ([]model.ReceivedEmail, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+receivedEmailColumns+`
+		FROM received_emails re
+		JOIN identities i ON re.identity_id = i.id
+		WHERE i.user_id = $1 AND `+receivedThreadKey+` = $2
+		ORDER BY re.received_at ASC, re.id ASC
+	`, userID, threadID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	defer rows.Close()
+
+	emails := scanReceivedEmails(rows)
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("thread not found")
+	}
+	return emails, nil
+}
@@ -8,6 +8,8 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 )
 
@@ -186,6 +188,47 @@ func (c *JMAPClient) Call(ctx context.Context, email, password string, request *
 	return &response, nil
 }
 
+// UploadBlob uploads content to an account's upload URL, as given by its
+// session, and returns the blob ID to reference it by (RFC 8620 section 6.1)
+func (c *JMAPClient) UploadBlob(ctx context.Context, uploadURL, email, password, accountID string, data []byte, contentType string) (string, error) {
+	uploadURL = strings.ReplaceAll(uploadURL, "{accountId}", url.PathEscape(accountID))
+	if strings.HasPrefix(uploadURL, "/") {
+		uploadURL = c.baseURL + uploadURL
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", uploadURL, bytes.NewReader(data))
+	if err != nil {
+		return "", err
+	}
+
+	auth := base64.StdEncoding.EncodeToString([]byte(email + ":" + password))
+	req.Header.Set("Authorization", "Basic "+auth)
+	req.Header.Set("Content-Type", contentType)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("JMAP upload failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusCreated {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("JMAP upload failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	var result struct {
+		BlobID string `json:"blobId"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode JMAP upload response: %w", err)
+	}
+	if result.BlobID == "" {
+		return "", fmt.Errorf("JMAP upload returned no blob ID")
+	}
+
+	return result.BlobID, nil
+}
+
 // GetMailboxes retrieves all mailboxes for an account
 func (c *JMAPClient) GetMailboxes(ctx context.Context, email, password, accountID string) ([]Mailbox, error) {
 	request := &JMAPRequest{
@@ -0,0 +1,111 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// jmapEventSourcePing is how often Stalwart is asked to ping an event source;
+// a stream silent for three pings is taken as dead
+const jmapEventSourcePing = 30 * time.Second
+
+// errNoEventSource is returned for sessions that don't offer push
+var errNoEventSource = errors.New("JMAP session has no event source")
+
+// jmapStreamClient reads event sources, which stay open for as long as they're
+// wanted, so it has no timeout of its own
+var jmapStreamClient = &http.Client{}
+
+// JMAPStateChange tells which types of an account's data changed, with their
+// new states (RFC 8620 section 7.1)
+type JMAPStateChange struct {
+	Type    string                       `json:"@type"`
+	Changed map[string]map[string]string `json:"changed"`
+}
+
+// EventSource opens a session's event source (RFC 8620 section 7.3) for
+// changes to the given types, and calls onChange with each state change until
+// the stream ends or ctx is done
+func (c *JMAPClient) EventSource(ctx context.Context, email, password string, session *JMAPSession, types []string, onChange func(*JMAPStateChange)) error {
+	if session.EventSourceUrl == "" {
+		return errNoEventSource
+	}
+	target := strings.NewReplacer(
+		"{types}", url.QueryEscape(strings.Join(types, ",")),
+		"{closeafter}", "no",
+		"{ping}", fmt.Sprint(int(jmapEventSourcePing.Seconds())),
+	).Replace(session.EventSourceUrl)
+	// Stalwart advertises its public URL; reach it the way the API reaches it
+	if u, err := url.Parse(target); err == nil && u.IsAbs() {
+		target = c.baseURL + u.RequestURI()
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	idle := time.AfterFunc(3*jmapEventSourcePing, cancel)
+	defer idle.Stop()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", target, nil)
+	if err != nil {
+		return err
+	}
+	auth := base64.StdEncoding.EncodeToString([]byte(email + ":" + password))
+	req.Header.Set("Authorization", "Basic "+auth)
+	req.Header.Set("Accept", "text/event-stream")
+
+	resp, err := jmapStreamClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("JMAP event source request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return fmt.Errorf("JMAP event source failed with status %d: %s", resp.StatusCode, string(body))
+	}
+
+	// Server-sent events: fields until a blank line, which dispatches the event
+	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	var event string
+	var data strings.Builder
+	for scanner.Scan() {
+		idle.Reset(3 * jmapEventSourcePing)
+		line := scanner.Text()
+		if line == "" {
+			if event == "state" {
+				var change JMAPStateChange
+				if err := json.Unmarshal([]byte(data.String()), &change); err == nil {
+					onChange(&change)
+				}
+			}
+			event = ""
+			data.Reset()
+			continue
+		}
+		field, value, _ := strings.Cut(line, ":")
+		value = strings.TrimPrefix(value, " ")
+		switch field {
+		case "event":
+			event = value
+		case "data":
+			if data.Len() > 0 {
+				data.WriteByte('\n')
+			}
+			data.WriteString(value)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("JMAP event source broke off: %w", err)
+	}
+	return fmt.Errorf("JMAP event source closed")
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/crypto"
+)
+
+// jmapSessionTTL is how long an identity's JMAP session is cached
+const jmapSessionTTL = 15 * time.Minute
+
+// JMAPAuth is how to reach an identity's Stalwart account over JMAP
+type JMAPAuth struct {
+	Username  string // The identity's address, or "<address>%<master user>"
+	Password  string
+	AccountID string
+	Session   *JMAPSession
+}
+
+// JMAPSessions signs in to identities' Stalwart accounts. Sessions are cached
+// in Redis, when there is one, so inbox operations don't fetch a session each
+// time; passwords never are. With a Stalwart master user configured, every
+// account is reached with it rather than with its identity's password.
+type JMAPSessions struct {
+	db    *sql.DB
+	cfg   *config.Config
+	jmap  *JMAPClient
+	redis *redis.Client
+}
+
+// NewJMAPSessions creates the JMAP session store
+func NewJMAPSessions(db *sql.DB, cfg *config.Config, redisClient *redis.Client) *JMAPSessions {
+	return &JMAPSessions{
+		db:    db,
+		cfg:   cfg,
+		jmap:  NewJMAPClient(cfg.StalwartURL),
+		redis: redisClient,
+	}
+}
+
+// cachedJMAPSession is a session as it's cached
+type cachedJMAPSession struct {
+	AccountID string       `json:"accountId"`
+	Session   *JMAPSession `json:"session"`
+}
+
+// Auth returns how to reach an identity's account
+func (s *JMAPSessions) Auth(ctx context.Context, identity *model.Identity) (*JMAPAuth, error) {
+	auth := &JMAPAuth{Username: identity.Email}
+	if s.cfg.StalwartMasterUser != "" {
+		auth.Username = identity.Email + "%" + s.cfg.StalwartMasterUser
+		auth.Password = s.cfg.StalwartMasterPassword
+	} else {
+		password, err := s.identityPassword(ctx, identity.ID)
+		if err != nil {
+			return nil, err
+		}
+		auth.Password = password
+	}
+
+	key := jmapSessionKey(identity.ID)
+	if s.redis != nil {
+		if data, err := s.redis.Get(ctx, key).Bytes(); err == nil {
+			var cached cachedJMAPSession
+			if json.Unmarshal(data, &cached) == nil && cached.AccountID != "" && cached.Session != nil {
+				auth.AccountID = cached.AccountID
+				auth.Session = cached.Session
+				return auth, nil
+			}
+		}
+	}
+
+	session, err := s.jmap.GetSession(ctx, auth.Username, auth.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get JMAP session for %s: %w", identity.Email, err)
+	}
+	auth.Session = session
+	auth.AccountID = session.PrimaryAccounts["urn:ietf:params:jmap:mail"]
+	if auth.AccountID == "" {
+		for accountID := range session.Accounts {
+			auth.AccountID = accountID
+			break
+		}
+	}
+	if auth.AccountID == "" {
+		return nil, fmt.Errorf("no account found for %s", identity.Email)
+	}
+
+	if s.redis != nil {
+		if data, err := json.Marshal(cachedJMAPSession{AccountID: auth.AccountID, Session: session}); err == nil {
+			s.redis.Set(ctx, key, data, jmapSessionTTL)
+		}
+	}
+	return auth, nil
+}
+
+// Invalidate drops an identity's cached session, for when its password
+// changes or it's deleted
+func (s *JMAPSessions) Invalidate(ctx context.Context, identityID int64) {
+	if s.redis != nil {
+		s.redis.Del(ctx, jmapSessionKey(identityID))
+	}
+}
+
+// identityPassword decrypts the password an identity signs in to Stalwart with
+func (s *JMAPSessions) identityPassword(ctx context.Context, identityID int64) (string, error) {
+	var encryptedPassword sql.NullString
+	err := s.db.QueryRowContext(ctx, "SELECT encrypted_password FROM identities WHERE id = $1", identityID).Scan(&encryptedPassword)
+	if err != nil {
+		return "", fmt.Errorf("failed to get identity password: %w", err)
+	}
+
+	if !encryptedPassword.Valid || encryptedPassword.String == "" {
+		return "", fmt.Errorf("identity password not configured")
+	}
+
+	password, err := crypto.Decrypt(encryptedPassword.String, s.cfg.EncryptionKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to decrypt identity password: %w", err)
+	}
+
+	return password, nil
+}
+
+func jmapSessionKey(identityID int64) string {
+	return fmt.Sprintf("jmap:session:%d", identityID)
+}
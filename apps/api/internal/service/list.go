@@ -6,24 +6,49 @@ import (
 	"encoding/json"
 	"fmt"
 
+	"github.com/lib/pq"
+
 	"github.com/dublyo/mailat/api/internal/config"
 	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/contactchange"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/listevent"
 )
 
 type ListService struct {
-	db  *sql.DB
-	cfg *config.Config
+	db                   *sql.DB
+	cfg                  *config.Config
+	transactionalService *TransactionalService
 }
 
 func NewListService(db *sql.DB, cfg *config.Config) *ListService {
 	return &ListService{db: db, cfg: cfg}
 }
 
+// SetTransactionalService sets the service double opt-in confirmation emails go out through
+func (s *ListService) SetTransactionalService(svc *TransactionalService) {
+	s.transactionalService = svc
+}
+
 // CreateList creates a new contact list
 func (s *ListService) CreateList(ctx context.Context, orgID int64, req *model.CreateListRequest) (*model.List, error) {
-	// Handle nullable segment rules
+	listType := req.Type
+	if listType == "" {
+		listType = "static"
+	}
+	if listType != "static" && listType != "dynamic" {
+		return nil, fmt.Errorf("type must be static or dynamic")
+	}
+
+	// Handle nullable segment rules, which dynamic lists need
 	var segmentRulesJSON interface{}
-	if req.SegmentRules != nil {
+	if listType == "dynamic" {
+		jsonBytes, err := s.segmentRulesJSON(ctx, orgID, 0, req.SegmentRules)
+		if err != nil {
+			return nil, err
+		}
+		segmentRulesJSON = jsonBytes
+	} else if req.SegmentRules != nil {
 		jsonBytes, err := json.Marshal(req.SegmentRules)
 		if err != nil {
 			return nil, fmt.Errorf("failed to marshal segment rules: %w", err)
@@ -31,9 +56,12 @@ func (s *ListService) CreateList(ctx context.Context, orgID int64, req *model.Cr
 		segmentRulesJSON = jsonBytes
 	}
 
-	listType := req.Type
-	if listType == "" {
-		listType = "static"
+	settingsJSON := []byte("{}")
+	if req.Settings != nil {
+		var err error
+		if settingsJSON, err = listSettingsJSON(ctx, s.db, orgID, req.Settings); err != nil {
+			return nil, err
+		}
 	}
 
 	// Handle nullable description
@@ -43,16 +71,16 @@ func (s *ListService) CreateList(ctx context.Context, orgID int64, req *model.Cr
 	}
 
 	var list model.List
-	var rulesJSON []byte
+	var rulesJSON, storedSettings []byte
 	var descPtr sql.NullString
 	err := s.db.QueryRowContext(ctx, `
-		INSERT INTO lists (org_id, name, description, type, segment_rules, contact_count, created_at, updated_at)
-		VALUES ($1, $2, $3, $4, $5, 0, NOW(), NOW())
-		RETURNING id, uuid, org_id, name, description, type, segment_rules, contact_count, created_at, updated_at
-	`, orgID, req.Name, description, listType, segmentRulesJSON,
+		INSERT INTO lists (org_id, name, description, type, segment_rules, settings, contact_count, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, 0, NOW(), NOW())
+		RETURNING id, uuid, org_id, name, description, type, segment_rules, contact_count, segment_refreshed_at, settings, created_at, updated_at
+	`, orgID, req.Name, description, listType, segmentRulesJSON, settingsJSON,
 	).Scan(
 		&list.ID, &list.UUID, &list.OrgID, &list.Name, &descPtr,
-		&list.Type, &rulesJSON, &list.ContactCount, &list.CreatedAt, &list.UpdatedAt,
+		&list.Type, &rulesJSON, &list.ContactCount, &list.SegmentRefreshedAt, &storedSettings, &list.CreatedAt, &list.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create list: %w", err)
@@ -64,6 +92,11 @@ func (s *ListService) CreateList(ctx context.Context, orgID int64, req *model.Cr
 	if len(rulesJSON) > 0 {
 		json.Unmarshal(rulesJSON, &list.SegmentRules)
 	}
+	json.Unmarshal(storedSettings, &list.Settings)
+
+	if list.Type == "dynamic" {
+		s.refreshSegment(ctx, orgID, &list)
+	}
 
 	return &list, nil
 }
@@ -71,16 +104,17 @@ func (s *ListService) CreateList(ctx context.Context, orgID int64, req *model.Cr
 // GetList retrieves a list by UUID
 func (s *ListService) GetList(ctx context.Context, orgID int64, listUUID string) (*model.List, error) {
 	var list model.List
-	var rulesJSON []byte
+	var rulesJSON, settingsJSON []byte
 	var descPtr sql.NullString
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, uuid, org_id, name, description, type, segment_rules, contact_count, created_at, updated_at
+		SELECT id, uuid, org_id, name, description, type, segment_rules, contact_count, segment_refreshed_at,
+		       COALESCE(settings, '{}'), created_at, updated_at
 		FROM lists
 		WHERE org_id = $1 AND uuid = $2
 	`, orgID, listUUID).Scan(
 		&list.ID, &list.UUID, &list.OrgID, &list.Name, &descPtr,
-		&list.Type, &rulesJSON, &list.ContactCount, &list.CreatedAt, &list.UpdatedAt,
+		&list.Type, &rulesJSON, &list.ContactCount, &list.SegmentRefreshedAt, &settingsJSON, &list.CreatedAt, &list.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
 		return nil, fmt.Errorf("list not found")
@@ -95,6 +129,7 @@ func (s *ListService) GetList(ctx context.Context, orgID int64, listUUID string)
 	if len(rulesJSON) > 0 {
 		json.Unmarshal(rulesJSON, &list.SegmentRules)
 	}
+	json.Unmarshal(settingsJSON, &list.Settings)
 
 	return &list, nil
 }
@@ -102,7 +137,8 @@ func (s *ListService) GetList(ctx context.Context, orgID int64, listUUID string)
 // ListLists retrieves all lists for an organization
 func (s *ListService) ListLists(ctx context.Context, orgID int64) ([]model.List, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, uuid, org_id, name, description, type, segment_rules, contact_count, created_at, updated_at
+		SELECT id, uuid, org_id, name, description, type, segment_rules, contact_count, segment_refreshed_at,
+		       COALESCE(settings, '{}'), created_at, updated_at
 		FROM lists
 		WHERE org_id = $1
 		ORDER BY name ASC
@@ -115,11 +151,11 @@ func (s *ListService) ListLists(ctx context.Context, orgID int64) ([]model.List,
 	var lists []model.List
 	for rows.Next() {
 		var list model.List
-		var rulesJSON []byte
+		var rulesJSON, settingsJSON []byte
 		var descPtr sql.NullString
 		if err := rows.Scan(
 			&list.ID, &list.UUID, &list.OrgID, &list.Name, &descPtr,
-			&list.Type, &rulesJSON, &list.ContactCount, &list.CreatedAt, &list.UpdatedAt,
+			&list.Type, &rulesJSON, &list.ContactCount, &list.SegmentRefreshedAt, &settingsJSON, &list.CreatedAt, &list.UpdatedAt,
 		); err != nil {
 			continue
 		}
@@ -129,6 +165,7 @@ func (s *ListService) ListLists(ctx context.Context, orgID int64) ([]model.List,
 		if len(rulesJSON) > 0 {
 			json.Unmarshal(rulesJSON, &list.SegmentRules)
 		}
+		json.Unmarshal(settingsJSON, &list.Settings)
 		lists = append(lists, list)
 	}
 
@@ -155,7 +192,20 @@ func (s *ListService) UpdateList(ctx context.Context, orgID int64, listUUID stri
 
 	var segmentRulesJSON []byte
 	if req.SegmentRules != nil {
-		segmentRulesJSON, _ = json.Marshal(req.SegmentRules)
+		if existing.Type == "dynamic" {
+			if segmentRulesJSON, err = s.segmentRulesJSON(ctx, orgID, existing.ID, req.SegmentRules); err != nil {
+				return nil, err
+			}
+		} else {
+			segmentRulesJSON, _ = json.Marshal(req.SegmentRules)
+		}
+	}
+
+	var settingsJSON []byte
+	if req.Settings != nil {
+		if settingsJSON, err = listSettingsJSON(ctx, s.db, orgID, req.Settings); err != nil {
+			return nil, err
+		}
 	}
 
 	_, err = s.db.ExecContext(ctx, `
@@ -163,14 +213,22 @@ func (s *ListService) UpdateList(ctx context.Context, orgID int64, listUUID stri
 			name = $1,
 			description = $2,
 			segment_rules = COALESCE($3::jsonb, segment_rules),
+			settings = COALESCE($6::jsonb, settings),
 			updated_at = NOW()
 		WHERE org_id = $4 AND uuid = $5
-	`, name, description, segmentRulesJSON, orgID, listUUID)
+	`, name, description, segmentRulesJSON, orgID, listUUID, settingsJSON)
 	if err != nil {
 		return nil, fmt.Errorf("failed to update list: %w", err)
 	}
 
-	return s.GetList(ctx, orgID, listUUID)
+	list, err := s.GetList(ctx, orgID, listUUID)
+	if err != nil {
+		return nil, err
+	}
+	if list.Type == "dynamic" && segmentRulesJSON != nil {
+		s.refreshSegment(ctx, orgID, list)
+	}
+	return list, nil
 }
 
 // DeleteList deletes a list
@@ -207,28 +265,26 @@ func (s *ListService) DeleteList(ctx context.Context, orgID int64, listUUID stri
 
 // AddContactsToList adds contacts to a list by their UUIDs
 func (s *ListService) AddContactsToList(ctx context.Context, orgID int64, listUUID string, contactUUIDs []string) error {
-	// Get list ID
-	var listID int
-	err := s.db.QueryRowContext(ctx,
-		"SELECT id FROM lists WHERE org_id = $1 AND uuid = $2",
-		orgID, listUUID,
-	).Scan(&listID)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("list not found")
-	}
+	// Members of dynamic lists come from their segment rules
+	listID, err := s.staticListID(ctx, orgID, listUUID)
 	if err != nil {
-		return fmt.Errorf("failed to get list: %w", err)
+		return err
 	}
 
 	// Verify contacts belong to org and insert by UUID
 	for _, contactUUID := range contactUUIDs {
 		_, err = s.db.ExecContext(ctx, `
-			INSERT INTO list_contacts (list_id, contact_id, created_at)
-			SELECT $1, c.id, NOW()
-			FROM contacts c
-			WHERE c.uuid = $2 AND c.org_id = $3
-			ON CONFLICT (list_id, contact_id) DO NOTHING
-		`, listID, contactUUID, orgID)
+			WITH added AS (
+				INSERT INTO list_contacts (list_id, contact_id, created_at)
+				SELECT $1, c.id, NOW()
+				FROM contacts c
+				WHERE c.uuid = $2 AND c.org_id = $3
+				ON CONFLICT (list_id, contact_id) DO NOTHING
+				RETURNING contact_id
+			)
+			INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+			SELECT $3, $1, contact_id, $4, $5, NOW() FROM added
+		`, listID, contactUUID, orgID, listevent.Subscribed, listevent.SourceAPI)
 		if err != nil {
 			return fmt.Errorf("failed to add contact to list: %w", err)
 		}
@@ -250,26 +306,24 @@ func (s *ListService) AddContactsToList(ctx context.Context, orgID int64, listUU
 
 // RemoveContactsFromList removes contacts from a list by their UUIDs
 func (s *ListService) RemoveContactsFromList(ctx context.Context, orgID int64, listUUID string, contactUUIDs []string) error {
-	// Get list ID
-	var listID int
-	err := s.db.QueryRowContext(ctx,
-		"SELECT id FROM lists WHERE org_id = $1 AND uuid = $2",
-		orgID, listUUID,
-	).Scan(&listID)
-	if err == sql.ErrNoRows {
-		return fmt.Errorf("list not found")
-	}
+	// Members of dynamic lists come from their segment rules
+	listID, err := s.staticListID(ctx, orgID, listUUID)
 	if err != nil {
-		return fmt.Errorf("failed to get list: %w", err)
+		return err
 	}
 
 	// Remove contacts by UUID
 	_, err = s.db.ExecContext(ctx, `
-		DELETE FROM list_contacts
-		WHERE list_id = $1 AND contact_id IN (
-			SELECT id FROM contacts WHERE uuid = ANY($2) AND org_id = $3
+		WITH removed AS (
+			DELETE FROM list_contacts
+			WHERE list_id = $1 AND contact_id IN (
+				SELECT id FROM contacts WHERE uuid = ANY($2) AND org_id = $3
+			)
+			RETURNING contact_id
 		)
-	`, listID, contactUUIDs, orgID)
+		INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+		SELECT $3, $1, contact_id, $4, $5, NOW() FROM removed
+	`, listID, pq.Array(contactUUIDs), orgID, listevent.Removed, listevent.SourceAPI)
 	if err != nil {
 		return fmt.Errorf("failed to remove contacts from list: %w", err)
 	}
@@ -371,18 +425,25 @@ func (s *ListService) GetListContacts(ctx context.Context, orgID int64, listUUID
 }
 
 // ImportContactsToList imports contacts from a CSV-like structure directly to a list
-func (s *ListService) ImportContactsToList(ctx context.Context, orgID int64, listUUID string, req *model.ImportContactsToListRequest) (*model.ImportContactsToListResponse, error) {
-	// Get list ID
-	var listID int
-	err := s.db.QueryRowContext(ctx,
-		"SELECT id FROM lists WHERE org_id = $1 AND uuid = $2",
-		orgID, listUUID,
-	).Scan(&listID)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("list not found")
+func (s *ListService) ImportContactsToList(ctx context.Context, orgID, userID int64, listUUID string, req *model.ImportContactsToListRequest) (*model.ImportContactsToListResponse, error) {
+	// Members of dynamic lists come from their segment rules
+	listID, err := s.staticListID(ctx, orgID, listUUID)
+	if err != nil {
+		return nil, err
 	}
+
+	lists, err := loadSubscribingLists(ctx, s.db, orgID, []int{listID})
 	if err != nil {
-		return nil, fmt.Errorf("failed to get list: %w", err)
+		return nil, err
+	}
+	newStatus := "active"
+	if needConfirmation(lists, req.SkipConfirmation) {
+		newStatus = "pending"
+	}
+
+	fields, err := contactfield.Load(ctx, s.db, orgID)
+	if err != nil {
+		return nil, err
 	}
 
 	result := &model.ImportContactsToListResponse{}
@@ -408,16 +469,18 @@ func (s *ListService) ImportContactsToList(ctx context.Context, orgID int64, lis
 		var contactID int64
 		if err == sql.ErrNoRows {
 			// Create new contact
-			var attributesJSON []byte
-			if row.Attributes != nil {
-				attributesJSON, _ = json.Marshal(row.Attributes)
+			attributes, err := contactfield.Validate(fields, row.Attributes)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Invalid attributes for %s: %v", row.Email, err))
+				continue
 			}
+			attributesJSON, _ := json.Marshal(attributes)
 
 			err = s.db.QueryRowContext(ctx, `
 				INSERT INTO contacts (org_id, email, first_name, last_name, attributes, status, consent_source, consent_timestamp, engagement_score, created_at, updated_at)
-				VALUES ($1, $2, $3, $4, $5, 'active', $6, NOW(), 0, NOW(), NOW())
+				VALUES ($1, $2, $3, $4, $5, $6, $7, NOW(), 0, NOW(), NOW())
 				RETURNING id
-			`, orgID, row.Email, row.FirstName, row.LastName, attributesJSON, consentSource).Scan(&contactID)
+			`, orgID, row.Email, row.FirstName, row.LastName, attributesJSON, newStatus, consentSource).Scan(&contactID)
 			if err != nil {
 				result.Errors = append(result.Errors, fmt.Sprintf("Failed to create contact %s: %v", row.Email, err))
 				continue
@@ -432,7 +495,17 @@ func (s *ListService) ImportContactsToList(ctx context.Context, orgID int64, lis
 				// Update existing contact
 				var attributesJSON []byte
 				if row.Attributes != nil {
-					attributesJSON, _ = json.Marshal(row.Attributes)
+					attributes, err := contactfield.Validate(fields, row.Attributes)
+					if err != nil {
+						result.Errors = append(result.Errors, fmt.Sprintf("Invalid attributes for %s: %v", row.Email, err))
+						continue
+					}
+					attributesJSON, _ = json.Marshal(attributes)
+				}
+				before, err := contactchange.Take(ctx, s.db, contactID)
+				if err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("Failed to update contact %s: %v", row.Email, err))
+					continue
 				}
 				_, err = s.db.ExecContext(ctx, `
 					UPDATE contacts SET
@@ -442,6 +515,13 @@ func (s *ListService) ImportContactsToList(ctx context.Context, orgID int64, lis
 						updated_at = NOW()
 					WHERE id = $4
 				`, row.FirstName, row.LastName, attributesJSON, contactID)
+				if err == nil {
+					_, err = contactchange.Record(ctx, s.db, orgID, contactID, before, contactchange.Source{
+						Source:   "import",
+						SourceID: listUUID,
+						UserID:   userID,
+					})
+				}
 				if err != nil {
 					result.Errors = append(result.Errors, fmt.Sprintf("Failed to update contact %s: %v", row.Email, err))
 				} else {
@@ -452,14 +532,18 @@ func (s *ListService) ImportContactsToList(ctx context.Context, orgID int64, lis
 			}
 		}
 
-		// Add contact to list
-		_, err = s.db.ExecContext(ctx, `
-			INSERT INTO list_contacts (list_id, contact_id, created_at)
-			VALUES ($1, $2, NOW())
-			ON CONFLICT (list_id, contact_id) DO NOTHING
-		`, listID, contactID)
+		// Add contact to list, or ask them to confirm it
+		confirm, err := joinLists(ctx, s.db, orgID, contactID, lists, req.SkipConfirmation, listevent.SourceImport)
 		if err != nil {
 			result.Errors = append(result.Errors, fmt.Sprintf("Failed to add contact %s to list: %v", row.Email, err))
+			continue
+		}
+		if len(confirm) > 0 {
+			if err := sendListConfirmations(ctx, s.db, s.cfg, s.transactionalService, orgID, contactID, row.Email, confirm, listevent.SourceImport); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("Failed to send confirmation to %s: %v", row.Email, err))
+				continue
+			}
+			result.Pending++
 		}
 	}
 
@@ -479,17 +563,10 @@ func (s *ListService) ImportContactsToList(ctx context.Context, orgID int64, lis
 
 // ManualAddContactToList creates a new contact and adds it to a list in one operation
 func (s *ListService) ManualAddContactToList(ctx context.Context, orgID int64, listUUID string, req *model.ManualAddContactToListRequest) (*model.Contact, error) {
-	// Get list ID
-	var listID int
-	err := s.db.QueryRowContext(ctx,
-		"SELECT id FROM lists WHERE org_id = $1 AND uuid = $2",
-		orgID, listUUID,
-	).Scan(&listID)
-	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("list not found")
-	}
+	// Members of dynamic lists come from their segment rules
+	listID, err := s.staticListID(ctx, orgID, listUUID)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get list: %w", err)
+		return nil, err
 	}
 
 	// Check if contact already exists
@@ -501,12 +578,14 @@ func (s *ListService) ManualAddContactToList(ctx context.Context, orgID int64, l
 
 	var contact model.Contact
 	var attributesJSON []byte
-	if req.Attributes != nil {
-		attributesJSON, _ = json.Marshal(req.Attributes)
-	}
 
 	if err == sql.ErrNoRows {
 		// Create new contact
+		attributes, err := validateAttributes(ctx, s.db, orgID, req.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		attributesJSON, _ = json.Marshal(attributes)
 		err = s.db.QueryRowContext(ctx, `
 			INSERT INTO contacts (org_id, email, first_name, last_name, attributes, status, consent_source, consent_timestamp, engagement_score, created_at, updated_at)
 			VALUES ($1, $2, $3, $4, $5, 'active', 'manual', NOW(), 0, NOW(), NOW())
@@ -547,7 +626,7 @@ func (s *ListService) ManualAddContactToList(ctx context.Context, orgID int64, l
 	}
 
 	// Add contact to list
-	_, err = s.db.ExecContext(ctx, `
+	result, err := s.db.ExecContext(ctx, `
 		INSERT INTO list_contacts (list_id, contact_id, created_at)
 		VALUES ($1, $2, NOW())
 		ON CONFLICT (list_id, contact_id) DO NOTHING
@@ -555,6 +634,11 @@ func (s *ListService) ManualAddContactToList(ctx context.Context, orgID int64, l
 	if err != nil {
 		return nil, fmt.Errorf("failed to add contact to list: %w", err)
 	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		if err := listevent.Record(ctx, s.db, orgID, contact.ID, []int{listID}, listevent.Subscribed, listevent.SourceAPI); err != nil {
+			return nil, err
+		}
+	}
 
 	// Update contact count
 	_, err = s.db.ExecContext(ctx, `
@@ -0,0 +1,141 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+)
+
+// List hygiene re-verifies the addresses of contacts that stopped engaging. A
+// worker job checks each address's syntax and mail servers and whether it's a
+// disposable or role address, records the verdict on the contact and, under
+// the org's policy, quarantines risky and undeliverable contacts so campaigns
+// skip them. Every run keeps a report of what it found.
+
+// HygieneService lists and starts list hygiene runs
+type HygieneService struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+// NewHygieneService creates a new list hygiene service
+func NewHygieneService(db *sql.DB, cfg *config.Config) *HygieneService {
+	return &HygieneService{db: db, cfg: cfg}
+}
+
+const listHygieneRunColumns = `
+	uuid, trigger, status, COALESCE(checked_count, 0), COALESCE(valid_count, 0), COALESCE(risky_count, 0),
+	COALESCE(undeliverable_count, 0), COALESCE(unknown_count, 0), COALESCE(quarantined_count, 0),
+	COALESCE(reasons, '{}'), COALESCE(error, ''), started_at, completed_at, created_at`
+
+// scanListHygieneRun reads a run from its row, and any columns selected after
+// listHygieneRunColumns into extra
+func scanListHygieneRun(row interface{ Scan(...any) error }, extra ...any) (*model.ListHygieneRun, error) {
+	var run model.ListHygieneRun
+	var reasons []byte
+	var startedAt, completedAt sql.NullTime
+	dest := []any{&run.ID, &run.Trigger, &run.Status, &run.Checked, &run.Valid, &run.Risky,
+		&run.Undeliverable, &run.Unknown, &run.Quarantined,
+		&reasons, &run.Error, &startedAt, &completedAt, &run.CreatedAt}
+	err := row.Scan(append(dest, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	run.Reasons = map[string]int{}
+	json.Unmarshal(reasons, &run.Reasons)
+	if startedAt.Valid {
+		run.StartedAt = &startedAt.Time
+	}
+	if completedAt.Valid {
+		run.CompletedAt = &completedAt.Time
+	}
+	return &run, nil
+}
+
+// List returns the organization's most recent runs
+func (s *HygieneService) List(ctx context.Context, orgID int64) ([]*model.ListHygieneRun, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+listHygieneRunColumns+`
+		FROM list_hygiene_runs WHERE org_id = $1
+		ORDER BY created_at DESC
+		LIMIT 100
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list hygiene runs: %w", err)
+	}
+	defer rows.Close()
+
+	runs := []*model.ListHygieneRun{}
+	for rows.Next() {
+		run, err := scanListHygieneRun(rows)
+		if err != nil {
+			continue
+		}
+		runs = append(runs, run)
+	}
+	return runs, nil
+}
+
+// Get returns a run by UUID with the contacts it flagged
+func (s *HygieneService) Get(ctx context.Context, orgID int64, runUUID string) (*model.ListHygieneRun, error) {
+	var flagged []byte
+	run, err := scanListHygieneRun(s.db.QueryRowContext(ctx, `
+		SELECT `+listHygieneRunColumns+`, COALESCE(flagged, '[]')
+		FROM list_hygiene_runs WHERE uuid::text = $1 AND org_id = $2
+	`, runUUID, orgID), &flagged)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("hygiene run not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get hygiene run: %w", err)
+	}
+
+	json.Unmarshal(flagged, &run.Flagged)
+	return run, nil
+}
+
+// Start queues a run under the organization's policy, whether or not scheduled
+// runs are enabled
+func (s *HygieneService) Start(ctx context.Context, orgID int64) (*model.ListHygieneRun, error) {
+	var runID int64
+	var runUUID string
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO list_hygiene_runs (org_id, trigger, status, created_at)
+		SELECT $1, $2, $3, NOW()
+		WHERE NOT EXISTS (
+			SELECT 1 FROM list_hygiene_runs WHERE org_id = $1 AND status IN ($3, $4)
+		)
+		RETURNING id, uuid
+	`, orgID, worker.HygieneTriggerManual, worker.HygieneStatusPending, worker.HygieneStatusRunning).Scan(&runID, &runUUID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("a hygiene run is already in progress")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create hygiene run: %w", err)
+	}
+
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		s.markRunFailed(ctx, runID, err)
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	if _, err := queueClient.EnqueueListHygieneRun(&worker.ListHygieneRunPayload{RunID: runID, OrgID: orgID}); err != nil {
+		s.markRunFailed(ctx, runID, err)
+		return nil, fmt.Errorf("failed to queue hygiene run: %w", err)
+	}
+
+	return s.Get(ctx, orgID, runUUID)
+}
+
+func (s *HygieneService) markRunFailed(ctx context.Context, runID int64, err error) {
+	s.db.ExecContext(ctx, `
+		UPDATE list_hygiene_runs SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+	`, runID, worker.HygieneStatusFailed, err.Error())
+}
@@ -0,0 +1,143 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/segment"
+)
+
+// Dynamic lists are segments: their members are the contacts their segment rules
+// select, materialized into list_contacts when the rules are saved, on demand,
+// on a schedule and before a campaign to them snapshots its recipients.
+
+// segmentPreviewSample is how many matching emails a segment preview shows
+const segmentPreviewSample = 10
+
+// segmentRulesJSON validates the segment rules of a dynamic list, 0 for a new
+// one, and returns them as JSON
+func (s *ListService) segmentRulesJSON(ctx context.Context, orgID int64, listID int, rules any) ([]byte, error) {
+	if rules == nil {
+		return nil, fmt.Errorf("dynamic lists need segment rules")
+	}
+	data, err := json.Marshal(rules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal segment rules: %w", err)
+	}
+	parsed, err := s.parseSegmentRules(ctx, orgID, listID, data)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(parsed)
+}
+
+// parseSegmentRules parses and validates segment rules, including that the lists
+// they test membership of are the org's and that conditions on typed attributes
+// fit their contact field
+func (s *ListService) parseSegmentRules(ctx context.Context, orgID int64, listID int, data []byte) (*segment.Rules, error) {
+	rules, err := segment.Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	if err := rules.Validate(listID); err != nil {
+		return nil, fmt.Errorf("invalid segment rules: %w", err)
+	}
+	if len(rules.AttributeConditions()) > 0 {
+		fields, err := contactfield.Load(ctx, s.db, orgID)
+		if err != nil {
+			return nil, err
+		}
+		if err := checkAttributeConditions(fields, rules); err != nil {
+			return nil, err
+		}
+	}
+
+	if ids := appendUnique(nil, rules.ListIDs()...); len(ids) > 0 {
+		var found int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FROM lists WHERE org_id = $1 AND id = ANY($2)
+		`, orgID, pq.Array(ids)).Scan(&found)
+		if err != nil {
+			return nil, fmt.Errorf("failed to verify segment lists: %w", err)
+		}
+		if found != len(ids) {
+			return nil, fmt.Errorf("invalid segment rules: a list they test membership of was not found")
+		}
+	}
+	return rules, nil
+}
+
+// refreshSegment materializes a dynamic list's members after its rules were
+// saved. The list is saved either way, so a failure only leaves its members as
+// they were until the next refresh.
+func (s *ListService) refreshSegment(ctx context.Context, orgID int64, list *model.List) {
+	count, err := segment.Refresh(ctx, s.db, orgID, list.ID)
+	if err != nil {
+		fmt.Printf("Warning: failed to refresh segment %d: %v\n", list.ID, err)
+		return
+	}
+	now := time.Now()
+	list.ContactCount = count
+	list.SegmentRefreshedAt = &now
+}
+
+// RefreshSegment materializes the members of a dynamic list from its rules now
+func (s *ListService) RefreshSegment(ctx context.Context, orgID int64, listUUID string) (*model.List, error) {
+	list, err := s.GetList(ctx, orgID, listUUID)
+	if err != nil {
+		return nil, err
+	}
+	if list.Type != "dynamic" {
+		return nil, fmt.Errorf("only dynamic lists can be refreshed")
+	}
+	if _, err := segment.Refresh(ctx, s.db, orgID, list.ID); err != nil {
+		return nil, err
+	}
+	return s.GetList(ctx, orgID, listUUID)
+}
+
+// PreviewSegment counts the contacts segment rules select, with a sample of them
+func (s *ListService) PreviewSegment(ctx context.Context, orgID int64, req *model.PreviewSegmentRequest) (*model.SegmentPreview, error) {
+	data, err := json.Marshal(req.SegmentRules)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal segment rules: %w", err)
+	}
+	rules, err := s.parseSegmentRules(ctx, orgID, 0, data)
+	if err != nil {
+		return nil, err
+	}
+
+	count, sample, err := segment.Preview(ctx, s.db, orgID, rules, segmentPreviewSample)
+	if err != nil {
+		return nil, err
+	}
+	return &model.SegmentPreview{Count: count, Sample: sample}, nil
+}
+
+// staticListID returns the ID of a list whose members are added and removed by
+// hand. Changes to a dynamic list's members would be undone by its next refresh.
+func (s *ListService) staticListID(ctx context.Context, orgID int64, listUUID string) (int, error) {
+	var listID int
+	var listType string
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, COALESCE(type, 'static') FROM lists WHERE org_id = $1 AND uuid = $2",
+		orgID, listUUID,
+	).Scan(&listID, &listType)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("list not found")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get list: %w", err)
+	}
+	if listType == "dynamic" {
+		return 0, fmt.Errorf("the members of a dynamic list come from its segment rules and can't be changed by hand")
+	}
+	return listID, nil
+}
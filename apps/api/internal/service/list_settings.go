@@ -0,0 +1,353 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+	"github.com/dublyo/mailat/api/pkg/listevent"
+)
+
+// Signup forms and imports subscribe contacts to lists following the lists'
+// settings: a list with double opt-in is joined once the contact confirms by
+// email, sent from the list's identity in its language, and joining a list
+// enrolls the contact in its welcome automation.
+
+// languagePattern matches language tags like en, pt-BR or zh-Hant
+var languagePattern = regexp.MustCompile(`^[a-z]{2,3}(-[A-Za-z0-9]{2,8})?$`)
+
+// dbExecutor runs queries in a transaction or not
+type dbExecutor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// listSettingsJSON validates a list's settings and returns them as stored
+func listSettingsJSON(ctx context.Context, db *sql.DB, orgID int64, settings *model.ListSettings) ([]byte, error) {
+	settings.FromIdentityID = strings.TrimSpace(settings.FromIdentityID)
+	settings.WelcomeAutomationID = strings.TrimSpace(settings.WelcomeAutomationID)
+	settings.Language = strings.TrimSpace(settings.Language)
+
+	if settings.FromIdentityID != "" {
+		var canSend bool
+		err := db.QueryRowContext(ctx, `
+			SELECT COALESCE(i.can_send, true) FROM identities i
+			JOIN users u ON i.user_id = u.id
+			WHERE i.uuid::text = $1 AND u.org_id = $2
+		`, settings.FromIdentityID, orgID).Scan(&canSend)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("from identity not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get identity: %w", err)
+		}
+		if !canSend {
+			return nil, fmt.Errorf("from identity can't send email")
+		}
+	}
+	if settings.DoubleOptIn && settings.FromIdentityID == "" {
+		return nil, fmt.Errorf("double opt-in needs a from identity to send confirmation emails")
+	}
+
+	if settings.WelcomeAutomationID != "" {
+		var exists bool
+		err := db.QueryRowContext(ctx, `
+			SELECT EXISTS(SELECT 1 FROM automations WHERE uuid::text = $1 AND org_id = $2)
+		`, settings.WelcomeAutomationID, orgID).Scan(&exists)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get automation: %w", err)
+		}
+		if !exists {
+			return nil, fmt.Errorf("welcome automation not found")
+		}
+	}
+
+	if settings.Language != "" && !languagePattern.MatchString(settings.Language) {
+		return nil, fmt.Errorf("language must be a language tag like en or pt-BR")
+	}
+
+	data, err := json.Marshal(settings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal list settings: %w", err)
+	}
+	return data, nil
+}
+
+// subscribingList is a static list a contact is being subscribed to
+type subscribingList struct {
+	ID       int
+	Name     string
+	Settings model.ListSettings
+}
+
+// loadSubscribingLists returns the org's static lists among listIDs. Members
+// of dynamic lists come from their segment rules.
+func loadSubscribingLists(ctx context.Context, db dbExecutor, orgID int64, listIDs []int) ([]subscribingList, error) {
+	if len(listIDs) == 0 {
+		return nil, nil
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, name, COALESCE(settings, '{}') FROM lists
+		WHERE id = ANY($1) AND org_id = $2 AND COALESCE(type, 'static') <> 'dynamic'
+		ORDER BY id
+	`, pq.Array(listIDs), orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get lists: %w", err)
+	}
+	defer rows.Close()
+
+	var lists []subscribingList
+	for rows.Next() {
+		var l subscribingList
+		var settings []byte
+		if err := rows.Scan(&l.ID, &l.Name, &settings); err != nil {
+			return nil, fmt.Errorf("failed to get lists: %w", err)
+		}
+		json.Unmarshal(settings, &l.Settings)
+		lists = append(lists, l)
+	}
+	return lists, rows.Err()
+}
+
+// needConfirmation reports whether a contact can join none of the lists
+// without confirming by email
+func needConfirmation(lists []subscribingList, skipConfirmation bool) bool {
+	if skipConfirmation || len(lists) == 0 {
+		return false
+	}
+	for _, l := range lists {
+		if !l.Settings.DoubleOptIn {
+			return false
+		}
+	}
+	return true
+}
+
+// joinLists adds a contact to the lists, enrolling them in the lists' welcome
+// automations and recording where they came from, and returns the lists with
+// double opt-in the contact must confirm first. List contact counts are left
+// to the caller.
+func joinLists(ctx context.Context, db dbExecutor, orgID, contactID int64, lists []subscribingList, skipConfirmation bool, source string) ([]subscribingList, error) {
+	var joined []int
+	var confirm []subscribingList
+	for _, l := range lists {
+		if l.Settings.DoubleOptIn && !skipConfirmation {
+			confirm = append(confirm, l)
+			continue
+		}
+		joined = append(joined, l.ID)
+	}
+	if len(confirm) > 0 {
+		var err error
+		if confirm, err = withoutMemberships(ctx, db, contactID, confirm); err != nil {
+			return nil, err
+		}
+	}
+	if len(joined) == 0 {
+		return confirm, nil
+	}
+
+	// Only new members are welcomed
+	rows, err := db.QueryContext(ctx, `
+		INSERT INTO list_contacts (list_id, contact_id, created_at)
+		SELECT unnest($1::int[]), $2, NOW()
+		ON CONFLICT (list_id, contact_id) DO NOTHING
+		RETURNING list_id
+	`, pq.Array(joined), contactID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add contact to lists: %w", err)
+	}
+	added := map[int]bool{}
+	var addedIDs []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to add contact to lists: %w", err)
+		}
+		added[id] = true
+		addedIDs = append(addedIDs, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to add contact to lists: %w", err)
+	}
+	if err := listevent.Record(ctx, db, orgID, contactID, addedIDs, listevent.Subscribed, source); err != nil {
+		return nil, err
+	}
+
+	var automations []string
+	for _, l := range lists {
+		if added[l.ID] && l.Settings.WelcomeAutomationID != "" {
+			automations = append(automations, l.Settings.WelcomeAutomationID)
+		}
+	}
+	if len(automations) > 0 {
+		if err := enrollWelcomeAutomations(ctx, db, orgID, contactID, automations); err != nil {
+			return nil, err
+		}
+	}
+	return confirm, nil
+}
+
+// withoutMemberships drops the lists a contact is already a member of
+func withoutMemberships(ctx context.Context, db dbExecutor, contactID int64, lists []subscribingList) ([]subscribingList, error) {
+	ids := make([]int, len(lists))
+	for i, l := range lists {
+		ids[i] = l.ID
+	}
+	rows, err := db.QueryContext(ctx, `
+		SELECT list_id FROM list_contacts WHERE contact_id = $1 AND list_id = ANY($2)
+	`, contactID, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list memberships: %w", err)
+	}
+	defer rows.Close()
+	member := map[int]bool{}
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to get list memberships: %w", err)
+		}
+		member[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get list memberships: %w", err)
+	}
+
+	var rest []subscribingList
+	for _, l := range lists {
+		if !member[l.ID] {
+			rest = append(rest, l)
+		}
+	}
+	return rest, nil
+}
+
+// enrollWelcomeAutomations enrolls a contact in the org's active automations
+// among automationUUIDs. Contacts are enrolled again only in automations that
+// allow re-enrollment, and not in automations of a subscription topic they
+// opted out of or beyond the org's limit of automations per contact.
+func enrollWelcomeAutomations(ctx context.Context, db dbExecutor, orgID, contactID int64, automationUUIDs []string) error {
+	_, err := db.ExecContext(ctx, `
+		WITH enrolled AS (
+			INSERT INTO automation_enrollments (automation_id, contact_id, org_id, status, step_index, enrolled_at, updated_at)
+			SELECT a.id, $2, $1, 'active', 0, NOW(), NOW()
+			FROM automations a
+			WHERE a.org_id = $1 AND a.status = 'active' AND a.uuid::text = ANY($3)
+			AND `+automationtrigger.EnrollFilter("a", "$2")+`
+			`+automationtrigger.OnConflict+`
+			RETURNING automation_id
+		)
+		UPDATE automations SET enrolled_count = enrolled_count + 1
+		WHERE id IN (SELECT automation_id FROM enrolled)
+	`, orgID, contactID, pq.Array(automationUUIDs))
+	if err != nil {
+		return fmt.Errorf("failed to enroll contact: %w", err)
+	}
+	return nil
+}
+
+// confirmationText is the text of confirmation emails in a language
+type confirmationText struct {
+	Subject string
+	Body    string // Followed by the link
+	Button  string
+	Ignore  string
+}
+
+// confirmationTexts are keyed by primary language subtag. English is the default.
+var confirmationTexts = map[string]confirmationText{
+	"en": {"Confirm your subscription", "Please confirm that you want to subscribe to %s:", "Confirm subscription", "If you didn't sign up, you can ignore this email."},
+	"de": {"Bestätigen Sie Ihr Abonnement", "Bitte bestätigen Sie, dass Sie %s abonnieren möchten:", "Abonnement bestätigen", "Wenn Sie sich nicht angemeldet haben, können Sie diese E-Mail ignorieren."},
+	"es": {"Confirma tu suscripción", "Confirma que quieres suscribirte a %s:", "Confirmar suscripción", "Si no te has registrado, puedes ignorar este correo."},
+	"fr": {"Confirmez votre abonnement", "Veuillez confirmer que vous souhaitez vous abonner à %s :", "Confirmer l'abonnement", "Si vous ne vous êtes pas inscrit, vous pouvez ignorer cet e-mail."},
+	"it": {"Conferma la tua iscrizione", "Conferma di volerti iscrivere a %s:", "Conferma iscrizione", "Se non ti sei iscritto, puoi ignorare questa email."},
+	"nl": {"Bevestig je inschrijving", "Bevestig dat je je wilt inschrijven voor %s:", "Inschrijving bevestigen", "Als je je niet hebt ingeschreven, kun je deze e-mail negeren."},
+	"pt": {"Confirme sua inscrição", "Confirme que deseja se inscrever em %s:", "Confirmar inscrição", "Se você não se inscreveu, pode ignorar este e-mail."},
+}
+
+// sendListConfirmations emails a contact links confirming their subscription
+// to lists with double opt-in, one email per sender and language. The links
+// carry the source the subscription came from.
+func sendListConfirmations(ctx context.Context, db *sql.DB, cfg *config.Config, transactional *TransactionalService, orgID, contactID int64, email string, lists []subscribingList, source string) error {
+	if len(lists) == 0 {
+		return nil
+	}
+	if transactional == nil {
+		return fmt.Errorf("confirmation emails can't be sent")
+	}
+
+	type group struct {
+		identity, language string
+		ids                []int
+		names              []string
+	}
+	var groups []*group
+	for _, l := range lists {
+		var g *group
+		for _, existing := range groups {
+			if existing.identity == l.Settings.FromIdentityID && existing.language == l.Settings.Language {
+				g = existing
+			}
+		}
+		if g == nil {
+			g = &group{identity: l.Settings.FromIdentityID, language: l.Settings.Language}
+			groups = append(groups, g)
+		}
+		g.ids = append(g.ids, l.ID)
+		g.names = append(g.names, l.Name)
+	}
+
+	compliance := NewComplianceService(db, cfg)
+	for _, g := range groups {
+		var from string
+		err := db.QueryRowContext(ctx, `
+			SELECT i.email FROM identities i
+			JOIN users u ON i.user_id = u.id
+			WHERE i.uuid::text = $1 AND u.org_id = $2
+		`, g.identity, orgID).Scan(&from)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("from identity of lists %s not found", strings.Join(g.names, ", "))
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get identity: %w", err)
+		}
+
+		text, ok := confirmationTexts[strings.ToLower(strings.SplitN(g.language, "-", 2)[0])]
+		if !ok {
+			text = confirmationTexts["en"]
+		}
+		lang := g.language
+		if lang == "" {
+			lang = "en"
+		}
+		link := fmt.Sprintf("%s/api/v1/confirm/%s", strings.TrimRight(cfg.APIUrl, "/"),
+			compliance.GenerateDoubleOptInToken(contactID, orgID, g.ids, source))
+		names := strings.Join(g.names, ", ")
+
+		_, err = transactional.SendEmail(ctx, orgID, 0, &model.SendEmailRequest{
+			From:    from,
+			To:      []string{email},
+			Subject: text.Subject,
+			HTML: fmt.Sprintf(`<html lang="%s"><body><p>%s</p><p><a href="%s">%s</a></p><p>%s</p></body></html>`,
+				html.EscapeString(lang), fmt.Sprintf(html.EscapeString(text.Body), html.EscapeString(names)),
+				html.EscapeString(link), html.EscapeString(text.Button), html.EscapeString(text.Ignore)),
+			Text: fmt.Sprintf(text.Body, names) + "\n\n" + link + "\n\n" + text.Ignore + "\n",
+		})
+		if err != nil {
+			return fmt.Errorf("failed to send confirmation email: %w", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/listevent"
+)
+
+// maxListStatsDays bounds the range list stats count over
+const maxListStatsDays = 366
+
+// GetListStats counts a list's events by day, in UTC, over a range of days
+func (s *ListService) GetListStats(ctx context.Context, orgID int64, listUUID string, query *model.ListStatsQuery) (*model.ListStats, error) {
+	days := query.Days
+	if days < 1 {
+		days = 30
+	}
+
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	to := today
+	if query.To != "" {
+		t, err := time.Parse("2006-01-02", query.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to format, use YYYY-MM-DD")
+		}
+		to = t
+	}
+	from := to.AddDate(0, 0, -(days - 1))
+	if query.From != "" {
+		t, err := time.Parse("2006-01-02", query.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from format, use YYYY-MM-DD")
+		}
+		from = t
+	}
+	if from.After(to) {
+		return nil, fmt.Errorf("from must not be after to")
+	}
+	if to.Sub(from) >= maxListStatsDays*24*time.Hour {
+		return nil, fmt.Errorf("range can't be longer than %d days", maxListStatsDays)
+	}
+
+	var listID, memberCount int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT l.id, (
+			SELECT COUNT(*) FROM list_contacts lc
+			JOIN contacts c ON c.id = lc.contact_id
+			WHERE lc.list_id = l.id AND c.status = 'active'
+		)
+		FROM lists l WHERE l.org_id = $1 AND l.uuid = $2
+	`, orgID, listUUID).Scan(&listID, &memberCount)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("list not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get list: %w", err)
+	}
+
+	stats := &model.ListStats{
+		ListID:      listUUID,
+		From:        from.Format("2006-01-02"),
+		To:          to.Format("2006-01-02"),
+		MemberCount: memberCount,
+		Sources:     []model.ListStatsSource{},
+		Days:        []model.ListStatsDay{},
+	}
+
+	// Events are counted from the start of from to the end of to
+	end := to.AddDate(0, 0, 1)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT to_char(d.day, 'YYYY-MM-DD'),
+		       COUNT(e.id) FILTER (WHERE e.event = $4),
+		       COUNT(e.id) FILTER (WHERE e.event = $5),
+		       COUNT(e.id) FILTER (WHERE e.event = $6),
+		       COUNT(e.id) FILTER (WHERE e.event = $7),
+		       COUNT(e.id) FILTER (WHERE e.event = $8)
+		FROM generate_series($2::timestamp, $3::timestamp - INTERVAL '1 day', INTERVAL '1 day') d(day)
+		LEFT JOIN list_events e ON e.list_id = $1
+		     AND e.created_at >= d.day AND e.created_at < d.day + INTERVAL '1 day'
+		GROUP BY d.day
+		ORDER BY d.day
+	`, listID, from, end,
+		listevent.Subscribed, listevent.Unsubscribed, listevent.Bounced, listevent.Complained, listevent.Removed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count list events: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var day model.ListStatsDay
+		if err := rows.Scan(&day.Date, &day.Subscribed, &day.Unsubscribed, &day.Bounced, &day.Complained, &day.Removed); err != nil {
+			return nil, fmt.Errorf("failed to scan list events: %w", err)
+		}
+		day.Net = day.Subscribed - day.Unsubscribed - day.Bounced - day.Complained - day.Removed
+
+		stats.Subscribed += day.Subscribed
+		stats.Unsubscribed += day.Unsubscribed
+		stats.Bounced += day.Bounced
+		stats.Complained += day.Complained
+		stats.Removed += day.Removed
+		stats.NetGrowth += day.Net
+		stats.Days = append(stats.Days, day)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count list events: %w", err)
+	}
+
+	sourceRows, err := s.db.QueryContext(ctx, `
+		SELECT source, COUNT(*)
+		FROM list_events
+		WHERE list_id = $1 AND event = $2 AND created_at >= $3 AND created_at < $4
+		GROUP BY source
+		ORDER BY COUNT(*) DESC, source
+	`, listID, listevent.Subscribed, from, end)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count list sources: %w", err)
+	}
+	defer sourceRows.Close()
+
+	for sourceRows.Next() {
+		var source model.ListStatsSource
+		if err := sourceRows.Scan(&source.Source, &source.Subscribed); err != nil {
+			return nil, fmt.Errorf("failed to scan list sources: %w", err)
+		}
+		stats.Sources = append(stats.Sources, source)
+	}
+	if err := sourceRows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to count list sources: %w", err)
+	}
+
+	// Members at the start of the range are estimated as the active members now
+	// less the growth since, which counts days after the range when it ends
+	// before today
+	startCount := memberCount - stats.NetGrowth
+	if end.Before(today.AddDate(0, 0, 1)) {
+		var laterNet int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COUNT(*) FILTER (WHERE event = $3) - COUNT(*) FILTER (WHERE event <> $3)
+			FROM list_events WHERE list_id = $1 AND created_at >= $2
+		`, listID, end, listevent.Subscribed).Scan(&laterNet)
+		if err != nil {
+			return nil, fmt.Errorf("failed to count list events: %w", err)
+		}
+		startCount -= laterNet
+	}
+	if startCount > 0 {
+		churned := stats.Unsubscribed + stats.Bounced + stats.Complained + stats.Removed
+		stats.ChurnRate = float64(churned) / float64(startCount) * 100
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/crypto"
+	"github.com/dublyo/mailat/api/pkg/mailassist"
+)
+
+// Summaries and translations are made on demand by the org's own provider,
+// called with its API key, and aren't stored: only the emails a user asks
+// about are sent, when they ask.
+
+// maxSummaryMessages caps the latest messages of a conversation summarized
+const maxSummaryMessages = 30
+
+// mailAssistProvider returns the org's summary and translation provider and
+// its name
+func (s *InboxService) mailAssistProvider(ctx context.Context, orgID int64) (mailassist.Provider, string, error) {
+	config := mailassist.Load(ctx, s.db, orgID)
+	if !config.Configured() {
+		return nil, "", apierror.New(http.StatusBadRequest, apierror.CodeAssistUnavailable, "no summary and translation provider is configured")
+	}
+	var apiKey string
+	if config.APIKey != "" {
+		key, err := crypto.Decrypt(config.APIKey, s.cfg.EncryptionKey)
+		if err != nil {
+			return nil, "", fmt.Errorf("failed to decrypt API key: %w", err)
+		}
+		apiKey = key
+	}
+	provider, err := mailassist.New(config, apiKey)
+	if err != nil {
+		return nil, "", apierror.New(http.StatusBadRequest, apierror.CodeAssistUnavailable, err.Error())
+	}
+	return provider, config.Provider, nil
+}
+
+// mailAssistError reports a failed call to the provider
+func mailAssistError(err error) error {
+	if errors.Is(err, mailassist.ErrUnsupported) {
+		return apierror.New(http.StatusBadRequest, apierror.CodeAssistUnavailable, err.Error())
+	}
+	return apierror.New(http.StatusBadGateway, apierror.CodeAssistUnavailable, err.Error())
+}
+
+// SummarizeEmail summarizes the conversation of a received email the user can
+// read, by its latest messages
+func (s *InboxService) SummarizeEmail(ctx context.Context, userID int64, emailUUID string, req *model.SummarizeEmailRequest) (*model.EmailSummary, error) {
+	language := strings.TrimSpace(req.Language)
+	if language != "" && !mailassist.ValidLanguage(language) {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "language must be a language code, such as de or pt-BR")
+	}
+
+	var orgID int64
+	var threadID string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT re.org_id, `+receivedThreadKey+`
+		FROM received_emails re
+		JOIN identities i ON re.identity_id = i.id
+		WHERE re.uuid::text = $1 AND `+receivedEmailAccess("$2")+`
+	`, emailUUID, userID).Scan(&orgID, &threadID)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeEmailNotFound, "email not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email: %w", err)
+	}
+
+	provider, providerName, err := s.mailAssistProvider(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT re.from_email, COALESCE(re.from_name, ''), re.subject, COALESCE(re.text_body, ''),
+			COALESCE(re.html_body, ''), COALESCE(re.received_at, re.created_at)
+		FROM received_emails re
+		JOIN identities i ON re.identity_id = i.id
+		WHERE re.org_id = $1 AND `+receivedThreadKey+` = $2 AND `+receivedEmailAccess("$3")+`
+		ORDER BY COALESCE(re.received_at, re.created_at) DESC, re.id DESC
+		LIMIT $4
+	`, orgID, threadID, userID, maxSummaryMessages)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	defer rows.Close()
+
+	// Messages are taken newest first while they fit, then put back in order
+	var messages []string
+	size := 0
+	for rows.Next() {
+		var fromEmail, fromName, subject, textBody, htmlBody string
+		var receivedAt time.Time
+		if err := rows.Scan(&fromEmail, &fromName, &subject, &textBody, &htmlBody, &receivedAt); err != nil {
+			return nil, fmt.Errorf("failed to get thread: %w", err)
+		}
+		from := fromEmail
+		if fromName != "" {
+			from = fmt.Sprintf("%s <%s>", fromName, fromEmail)
+		}
+		message := fmt.Sprintf("From: %s\nDate: %s\nSubject: %s\n\n%s",
+			from, receivedAt.UTC().Format(time.RFC1123), subject, withoutQuotedLines(mailassist.PlainText(textBody, htmlBody)))
+		if len(messages) > 0 && size+len(message) > mailassist.MaxInputChars {
+			break
+		}
+		messages = append(messages, message)
+		size += len(message)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to get thread: %w", err)
+	}
+	slices.Reverse(messages)
+
+	summary, err := provider.Summarize(ctx, strings.Join(messages, "\n\n---\n\n"), language)
+	if err != nil {
+		return nil, mailAssistError(err)
+	}
+	return &model.EmailSummary{
+		EmailID:      emailUUID,
+		ThreadID:     threadID,
+		MessageCount: len(messages),
+		Language:     language,
+		Summary:      summary,
+		Provider:     providerName,
+	}, nil
+}
+
+// TranslateEmail translates the body of a received email the user can read
+func (s *InboxService) TranslateEmail(ctx context.Context, userID int64, emailUUID string, req *model.TranslateEmailRequest) (*model.EmailTranslation, error) {
+	target := strings.TrimSpace(req.TargetLanguage)
+	if !mailassist.ValidLanguage(target) {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "targetLanguage must be a language code, such as de or pt-BR")
+	}
+
+	var orgID int64
+	var textBody, htmlBody string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT re.org_id, COALESCE(re.text_body, ''), COALESCE(re.html_body, '')
+		FROM received_emails re
+		JOIN identities i ON re.identity_id = i.id
+		WHERE re.uuid::text = $1 AND `+receivedEmailAccess("$2")+`
+	`, emailUUID, userID).Scan(&orgID, &textBody, &htmlBody)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeEmailNotFound, "email not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email: %w", err)
+	}
+
+	text := mailassist.PlainText(textBody, htmlBody)
+	if text == "" {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "the email has no text to translate")
+	}
+
+	provider, providerName, err := s.mailAssistProvider(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+	translation, err := provider.Translate(ctx, text, target)
+	if err != nil {
+		return nil, mailAssistError(err)
+	}
+	return &model.EmailTranslation{
+		EmailID:        emailUUID,
+		SourceLanguage: translation.SourceLanguage,
+		TargetLanguage: target,
+		Text:           translation.Text,
+		Provider:       providerName,
+	}, nil
+}
+
+// withoutQuotedLines drops the lines a reply quotes, which the summary gets
+// from the earlier messages themselves
+func withoutQuotedLines(text string) string {
+	lines := strings.Split(text, "\n")
+	kept := lines[:0]
+	for _, line := range lines {
+		if !strings.HasPrefix(strings.TrimSpace(line), ">") {
+			kept = append(kept, line)
+		}
+	}
+	return strings.TrimSpace(strings.Join(kept, "\n"))
+}
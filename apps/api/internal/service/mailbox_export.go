@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/eventexport"
+	"github.com/dublyo/mailat/api/pkg/mailexport"
+)
+
+// Mailboxes are exported like contacts: a worker job writes every email of an
+// identity, with its attachments, to an MBOX file or a zip of EML files and
+// uploads it. Users export their own identities; admins can export any
+// identity of the org, such as a departing member's.
+
+const mailboxExportColumns = `
+	me.uuid, me.identity_id, i.email, me.format, me.destination, me.status, COALESCE(me.storage_key, ''),
+	COALESCE(me.email_count, 0), COALESCE(me.size, 0), COALESCE(me.error, ''), me.completed_at, me.expires_at, me.created_at`
+
+// mailboxExportVisible restricts exports to those the user requested, unless
+// they're an admin
+const mailboxExportVisible = `me.org_id = $1 AND ($3 OR me.requested_by = $2)`
+
+func scanMailboxExport(row interface{ Scan(...any) error }) (*model.MailboxExport, string, error) {
+	var e model.MailboxExport
+	var storageKey string
+	var completedAt, expiresAt sql.NullTime
+	err := row.Scan(&e.ID, &e.IdentityID, &e.Email, &e.Format, &e.Destination, &e.Status, &storageKey,
+		&e.EmailCount, &e.Size, &e.Error, &completedAt, &expiresAt, &e.CreatedAt)
+	if err != nil {
+		return nil, "", err
+	}
+	if completedAt.Valid {
+		e.CompletedAt = &completedAt.Time
+	}
+	if expiresAt.Valid {
+		e.ExpiresAt = &expiresAt.Time
+	}
+	return &e, storageKey, nil
+}
+
+// ListMailboxExports returns the most recent mailbox exports the user
+// requested, or the whole org's for admins
+func (s *ExportService) ListMailboxExports(ctx context.Context, orgID, userID int64, isAdmin bool) ([]*model.MailboxExport, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+mailboxExportColumns+`
+		FROM mailbox_exports me
+		JOIN identities i ON i.id = me.identity_id
+		WHERE `+mailboxExportVisible+`
+		ORDER BY me.created_at DESC
+		LIMIT 100
+	`, orgID, userID, isAdmin)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list exports: %w", err)
+	}
+	defer rows.Close()
+
+	exports := []*model.MailboxExport{}
+	for rows.Next() {
+		e, _, err := scanMailboxExport(rows)
+		if err != nil {
+			continue
+		}
+		exports = append(exports, e)
+	}
+	return exports, nil
+}
+
+// GetMailboxExport returns a mailbox export by UUID. A completed download
+// export comes with a presigned URL until it expires.
+func (s *ExportService) GetMailboxExport(ctx context.Context, orgID, userID int64, isAdmin bool, exportUUID string) (*model.MailboxExport, error) {
+	e, storageKey, err := scanMailboxExport(s.db.QueryRowContext(ctx, `
+		SELECT `+mailboxExportColumns+`
+		FROM mailbox_exports me
+		JOIN identities i ON i.id = me.identity_id
+		WHERE me.uuid::text = $4 AND `+mailboxExportVisible+`
+	`, orgID, userID, isAdmin, exportUUID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("export not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get export: %w", err)
+	}
+	if e.Status != worker.ExportStatusCompleted || storageKey == "" {
+		return e, nil
+	}
+
+	if e.Destination == eventexport.DestinationS3 {
+		bucket := eventexport.Load(ctx, s.db, orgID)
+		e.Location = "s3://" + bucket.Bucket + "/" + storageKey
+		return e, nil
+	}
+	if e.ExpiresAt != nil && e.ExpiresAt.Before(time.Now()) {
+		return e, nil
+	}
+
+	store, _, err := worker.OpenExportStore(ctx, s.db, s.cfg, orgID, e.Destination)
+	if err != nil {
+		return nil, err
+	}
+	e.DownloadURL, err = store.PresignGet(ctx, storageKey, path.Base(storageKey), exportDownloadURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// CreateMailboxExport checks the user can export the identity and queues the
+// export
+func (s *ExportService) CreateMailboxExport(ctx context.Context, orgID, userID int64, isAdmin bool, req *model.CreateMailboxExportRequest) (*model.MailboxExport, error) {
+	format := strings.ToLower(strings.TrimSpace(req.Format))
+	if format == "" {
+		format = mailexport.FormatMBOX
+	}
+	if !mailexport.ValidFormat(format) {
+		return nil, fmt.Errorf("format must be mbox or eml")
+	}
+
+	destination := strings.ToLower(strings.TrimSpace(req.Destination))
+	if destination == "" {
+		destination = eventexport.DestinationDownload
+	}
+	switch destination {
+	case eventexport.DestinationDownload:
+		if s.cfg.ExportsBucket == "" {
+			return nil, fmt.Errorf("export storage is not configured")
+		}
+	case eventexport.DestinationS3:
+		if !isAdmin {
+			return nil, fmt.Errorf("only admins can export to the organization's bucket")
+		}
+		if !eventexport.Load(ctx, s.db, orgID).Configured() {
+			return nil, fmt.Errorf("no export bucket is configured for the organization")
+		}
+	default:
+		return nil, fmt.Errorf("destination must be download or s3")
+	}
+
+	var ownerID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT i.user_id FROM identities i
+		JOIN domains d ON d.id = i.domain_id
+		WHERE i.id = $1 AND d.org_id = $2
+	`, req.IdentityID, orgID).Scan(&ownerID)
+	if err == sql.ErrNoRows || (err == nil && ownerID != userID && !isAdmin) {
+		return nil, fmt.Errorf("identity not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get identity: %w", err)
+	}
+
+	var inProgress bool
+	s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM mailbox_exports WHERE identity_id = $1 AND status IN ($2, $3))
+	`, req.IdentityID, worker.ExportStatusPending, worker.ExportStatusRunning).Scan(&inProgress)
+	if inProgress {
+		return nil, fmt.Errorf("an export of this mailbox is already in progress")
+	}
+
+	var exportID int64
+	var exportUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO mailbox_exports (org_id, identity_id, requested_by, format, destination, status, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, NOW())
+		RETURNING id, uuid
+	`, orgID, req.IdentityID, userID, format, destination, worker.ExportStatusPending).Scan(&exportID, &exportUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create export: %w", err)
+	}
+
+	queueClient, err := worker.NewQueueClient(s.cfg)
+	if err != nil {
+		s.markMailboxExportFailed(ctx, exportID, err)
+		return nil, fmt.Errorf("failed to connect to queue: %w", err)
+	}
+	defer queueClient.Close()
+
+	if _, err := queueClient.EnqueueMailboxExport(&worker.MailboxExportPayload{ExportID: exportID, OrgID: orgID}); err != nil {
+		s.markMailboxExportFailed(ctx, exportID, err)
+		return nil, fmt.Errorf("failed to queue export: %w", err)
+	}
+
+	return s.GetMailboxExport(ctx, orgID, userID, isAdmin, exportUUID)
+}
+
+func (s *ExportService) markMailboxExportFailed(ctx context.Context, exportID int64, err error) {
+	s.db.ExecContext(ctx, `
+		UPDATE mailbox_exports SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+	`, exportID, worker.ExportStatusFailed, err.Error())
+}
@@ -5,12 +5,15 @@ import (
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
 	"github.com/lib/pq"
 
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/pkg/bounce"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
 )
 
 // NotifyListener listens for PostgreSQL NOTIFY events
@@ -67,11 +70,13 @@ func (l *NotifyListener) Subscribe(channel string, handler NotifyHandler) {
 
 // Start begins listening for notifications
 func (l *NotifyListener) Start(ctx context.Context) error {
-	// Subscribe to channels
-	channels := []string{
-		"email_status_changed",
-		"delivery_event_created",
+	// Subscribe to the channels there are handlers for
+	l.handlersMux.RLock()
+	channels := make([]string, 0, len(l.handlers))
+	for ch := range l.handlers {
+		channels = append(channels, ch)
 	}
+	l.handlersMux.RUnlock()
 
 	for _, ch := range channels {
 		if err := l.listener.Listen(ch); err != nil {
@@ -136,7 +141,8 @@ func (l *NotifyListener) processNotification(notification *pq.Notification) {
 	}
 }
 
-// SetupTriggers creates the necessary PostgreSQL triggers for delivery tracking
+// SetupTriggers creates the necessary PostgreSQL triggers for delivery tracking,
+// realtime inbox updates and inbox counts
 func SetupTriggers(db *sql.DB) error {
 	// Create the notify function for email status changes
 	_, err := db.Exec(`
@@ -221,7 +227,161 @@ func SetupTriggers(db *sql.DB) error {
 		return fmt.Errorf("failed to create delivery event trigger: %w", err)
 	}
 
-	fmt.Println("PostgreSQL triggers for delivery tracking created successfully")
+	// Create the notify function for received email changes, which carries
+	// what the owner's connected clients need to update their inbox
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION notify_received_email_change()
+		RETURNS TRIGGER AS $$
+		DECLARE
+			payload JSON;
+			email RECORD;
+			owner_id BIGINT;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				email := OLD;
+			ELSE
+				email := NEW;
+			END IF;
+
+			SELECT i.user_id INTO owner_id FROM identities i WHERE i.id = email.identity_id;
+
+			payload := json_build_object(
+				'table', TG_TABLE_NAME,
+				'action', TG_OP,
+				'email_id', email.id,
+				'org_id', email.org_id,
+				'data', json_build_object(
+					'uuid', email.uuid,
+					'identity_id', email.identity_id,
+					'user_id', owner_id,
+					'folder', email.folder,
+					'is_read', email.is_read,
+					'is_starred', email.is_starred,
+					'is_trashed', email.is_trashed
+				)
+			);
+			PERFORM pg_notify('received_email_changed', payload::text);
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create notify function for received emails: %w", err)
+	}
+
+	// Create triggers for received emails arriving, changing state and being deleted
+	_, err = db.Exec(`
+		DROP TRIGGER IF EXISTS received_email_changed_trigger ON received_emails;
+		CREATE TRIGGER received_email_changed_trigger
+		AFTER INSERT OR DELETE ON received_emails
+		FOR EACH ROW
+		EXECUTE FUNCTION notify_received_email_change();
+
+		DROP TRIGGER IF EXISTS received_email_updated_trigger ON received_emails;
+		CREATE TRIGGER received_email_updated_trigger
+		AFTER UPDATE OF folder, is_read, is_starred, is_trashed ON received_emails
+		FOR EACH ROW
+		WHEN (OLD.folder IS DISTINCT FROM NEW.folder
+			OR OLD.is_read IS DISTINCT FROM NEW.is_read
+			OR OLD.is_starred IS DISTINCT FROM NEW.is_starred
+			OR OLD.is_trashed IS DISTINCT FROM NEW.is_trashed)
+		EXECUTE FUNCTION notify_received_email_change();
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create received email triggers: %w", err)
+	}
+
+	// Create the functions keeping the per-identity inbox counts. The vector
+	// holds an email's contribution to the inbox, unread, starred, sent,
+	// drafts, spam and trash counts, which must match how the scheduled
+	// reconciliation counts them.
+	_, err = db.Exec(`
+		CREATE OR REPLACE FUNCTION received_email_count_vector(email received_emails)
+		RETURNS INT[] AS $$
+			SELECT ARRAY[
+				COALESCE(email.folder = 'inbox' AND email.is_trashed = false AND email.is_archived = false, false)::int,
+				COALESCE(email.is_read = false AND email.is_trashed = false, false)::int,
+				COALESCE(email.is_starred = true AND email.is_trashed = false, false)::int,
+				COALESCE(email.folder = 'sent' AND email.is_trashed = false, false)::int,
+				COALESCE(email.folder = 'drafts' AND email.is_trashed = false, false)::int,
+				COALESCE((email.folder = 'spam' OR email.is_spam = true) AND email.is_trashed = false, false)::int,
+				COALESCE(email.is_trashed = true, false)::int
+			];
+		$$ LANGUAGE sql IMMUTABLE;
+
+		CREATE OR REPLACE FUNCTION update_received_email_counts()
+		RETURNS TRIGGER AS $$
+		DECLARE
+			old_counts INT[];
+			new_counts INT[];
+		BEGIN
+			IF TG_OP <> 'INSERT' THEN
+				old_counts := received_email_count_vector(OLD);
+			END IF;
+			IF TG_OP <> 'DELETE' THEN
+				new_counts := received_email_count_vector(NEW);
+			END IF;
+			IF TG_OP = 'UPDATE' AND OLD.identity_id = NEW.identity_id AND old_counts = new_counts THEN
+				RETURN NULL;
+			END IF;
+
+			IF old_counts IS NOT NULL THEN
+				UPDATE received_email_counts SET
+					inbox = inbox - old_counts[1],
+					unread = unread - old_counts[2],
+					starred = starred - old_counts[3],
+					sent = sent - old_counts[4],
+					drafts = drafts - old_counts[5],
+					spam = spam - old_counts[6],
+					trash = trash - old_counts[7],
+					updated_at = NOW()
+				WHERE identity_id = OLD.identity_id;
+			END IF;
+
+			IF new_counts IS NOT NULL THEN
+				INSERT INTO received_email_counts (identity_id, inbox, unread, starred, sent, drafts, spam, trash)
+				VALUES (NEW.identity_id, new_counts[1], new_counts[2], new_counts[3], new_counts[4], new_counts[5], new_counts[6], new_counts[7])
+				ON CONFLICT (identity_id) DO UPDATE SET
+					inbox = received_email_counts.inbox + EXCLUDED.inbox,
+					unread = received_email_counts.unread + EXCLUDED.unread,
+					starred = received_email_counts.starred + EXCLUDED.starred,
+					sent = received_email_counts.sent + EXCLUDED.sent,
+					drafts = received_email_counts.drafts + EXCLUDED.drafts,
+					spam = received_email_counts.spam + EXCLUDED.spam,
+					trash = received_email_counts.trash + EXCLUDED.trash,
+					updated_at = NOW();
+			END IF;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create inbox count functions: %w", err)
+	}
+
+	// Create the inbox counts trigger, and count the existing emails the first
+	// time. Both run in one transaction, so no email is missed or counted twice.
+	_, err = db.Exec(`
+		DROP TRIGGER IF EXISTS received_email_counts_trigger ON received_emails;
+		CREATE TRIGGER received_email_counts_trigger
+		AFTER INSERT OR DELETE OR UPDATE OF identity_id, folder, is_read, is_starred, is_archived, is_trashed, is_spam ON received_emails
+		FOR EACH ROW
+		EXECUTE FUNCTION update_received_email_counts();
+
+		INSERT INTO received_email_counts (identity_id, inbox, unread, starred, sent, drafts, spam, trash)
+		SELECT identity_id, SUM(v[1]), SUM(v[2]), SUM(v[3]), SUM(v[4]), SUM(v[5]), SUM(v[6]), SUM(v[7])
+		FROM (
+			SELECT re.identity_id, received_email_count_vector(re) AS v FROM received_emails re
+		) counted
+		WHERE NOT EXISTS (SELECT 1 FROM received_email_counts)
+		GROUP BY identity_id
+		ON CONFLICT (identity_id) DO NOTHING;
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to create inbox counts trigger: %w", err)
+	}
+
+	fmt.Println("PostgreSQL triggers for delivery tracking, realtime inbox and inbox counts created successfully")
 	return nil
 }
 
@@ -343,28 +503,29 @@ func (t *DeliveryTracker) updateOrgStats(orgID int64, statType string) {
 func (t *DeliveryTracker) handleBounce(payload NotifyPayload) {
 	// Get the recipient email
 	var toAddresses string
-	var bounceType string
+	var bounceClass string
 	err := t.db.QueryRow(`
-		SELECT to_addresses, bounce_type FROM transactional_emails WHERE id = $1
-	`, payload.EmailID).Scan(&toAddresses, &bounceType)
+		SELECT to_addresses, COALESCE(bounce_class, bounce_type, '') FROM transactional_emails WHERE id = $1
+	`, payload.EmailID).Scan(&toAddresses, &bounceClass)
 	if err != nil {
 		fmt.Printf("Failed to get email for bounce handling: %v\n", err)
 		return
 	}
 
-	// For hard bounces, add to suppression list
-	if bounceType == "hard" {
-		// Add each recipient to suppression list
-		recipients := splitAddresses(toAddresses)
-		for _, recipient := range recipients {
-			_, err := t.db.Exec(`
-				INSERT INTO suppression_list (org_id, email, reason, source)
-				VALUES ($1, $2, 'Hard bounce', 'bounce')
-				ON CONFLICT (org_id, email) DO NOTHING
-			`, payload.OrgID, recipient)
-			if err != nil {
-				fmt.Printf("Failed to add to suppression list: %v\n", err)
-			}
+	// Suppress recipients only for classes whose policy requires it (hard bounces).
+	// Each recipient is judged by its own bounce class when it has one.
+	rules := emailaddr.LoadRules(context.Background(), t.db, payload.OrgID)
+	for _, recipient := range t.eventRecipients(payload.EmailID, "bounced_at", toAddresses, bounceClass) {
+		if !bounce.PolicyFor(bounce.Class(recipient.class)).Suppress {
+			continue
+		}
+		_, err := t.db.Exec(`
+			INSERT INTO suppression_list (org_id, email, reason, source, normalized_email)
+			VALUES ($1, $2, 'Hard bounce', 'bounce', $3)
+			ON CONFLICT (org_id, email) DO NOTHING
+		`, payload.OrgID, recipient.email, emailaddr.Normalize(recipient.email, rules))
+		if err != nil {
+			fmt.Printf("Failed to add to suppression list: %v\n", err)
 		}
 	}
 
@@ -383,14 +544,14 @@ func (t *DeliveryTracker) handleComplaint(payload NotifyPayload) {
 		return
 	}
 
-	// Add to suppression list
-	recipients := splitAddresses(toAddresses)
-	for _, recipient := range recipients {
+	// Add the complaining recipients to suppression list
+	rules := emailaddr.LoadRules(context.Background(), t.db, payload.OrgID)
+	for _, recipient := range t.eventRecipients(payload.EmailID, "complained_at", toAddresses, "") {
 		_, err := t.db.Exec(`
-			INSERT INTO suppression_list (org_id, email, reason, source)
-			VALUES ($1, $2, 'Spam complaint', 'complaint')
+			INSERT INTO suppression_list (org_id, email, reason, source, normalized_email)
+			VALUES ($1, $2, 'Spam complaint', 'complaint', $3)
 			ON CONFLICT (org_id, email) DO NOTHING
-		`, payload.OrgID, recipient)
+		`, payload.OrgID, recipient.email, emailaddr.Normalize(recipient.email, rules))
 		if err != nil {
 			fmt.Printf("Failed to add to suppression list: %v\n", err)
 		}
@@ -399,6 +560,50 @@ func (t *DeliveryTracker) handleComplaint(payload NotifyPayload) {
 	t.updateOrgStats(payload.OrgID, "complained")
 }
 
+// eventRecipient is a recipient a bounce or complaint was attributed to
+type eventRecipient struct {
+	email string
+	class string
+}
+
+// eventRecipients returns the recipients whose timestamp column (bounced_at or complained_at)
+// is set. Emails without per-recipient rows fall back to all To addresses.
+func (t *DeliveryTracker) eventRecipients(emailID int64, column, toAddresses, fallbackClass string) []eventRecipient {
+	var recipients []eventRecipient
+
+	rows, err := t.db.Query(fmt.Sprintf(`
+		SELECT email, COALESCE(bounce_class, '') FROM transactional_email_recipients
+		WHERE email_id = $1 AND %s IS NOT NULL
+	`, column), emailID)
+	if err == nil {
+		defer rows.Close()
+		for rows.Next() {
+			var r eventRecipient
+			if err := rows.Scan(&r.email, &r.class); err != nil {
+				continue
+			}
+			if r.class == "" {
+				r.class = fallbackClass
+			}
+			recipients = append(recipients, r)
+		}
+	}
+	if len(recipients) > 0 {
+		return recipients
+	}
+
+	var tracked bool
+	t.db.QueryRow(`SELECT EXISTS(SELECT 1 FROM transactional_email_recipients WHERE email_id = $1)`, emailID).Scan(&tracked)
+	if tracked {
+		return nil // Recipients are tracked but none were affected
+	}
+
+	for _, addr := range splitAddresses(toAddresses) {
+		recipients = append(recipients, eventRecipient{email: strings.ToLower(addr), class: fallbackClass})
+	}
+	return recipients
+}
+
 // queueWebhookDelivery queues a webhook delivery for an event
 func (t *DeliveryTracker) queueWebhookDelivery(orgID, emailID int64, eventType string) {
 	// This will be implemented fully when webhooks are added
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/prefcenter"
+)
+
+// The unsubscribe and preference links of emails open hosted pages when
+// followed in a browser. The pages are drawn with the org's tenant branding,
+// and every change a contact makes on them is recorded to consent_audit.
+
+// PageBranding is the branding the hosted pages are drawn with
+type PageBranding struct {
+	OrgName       string
+	LogoURL       string
+	PrimaryColor  string
+	AccentColor   string
+	HidePoweredBy bool
+}
+
+// ProfileField is a profile field contacts can edit on the preference center
+type ProfileField struct {
+	Key      string   `json:"key"`
+	Label    string   `json:"label"`
+	Type     string   `json:"type"`
+	Options  []string `json:"options,omitempty"`
+	Required bool     `json:"required"`
+	Value    string   `json:"value"`
+}
+
+// maxNameLength is the length of the contact name columns
+const maxNameLength = 100
+
+var cssColorPattern = regexp.MustCompile(`^#(?:[0-9A-Fa-f]{3}|[0-9A-Fa-f]{6})$`)
+
+// PageBranding returns the branding of the org an unsubscribe token belongs to
+func (s *ComplianceService) PageBranding(ctx context.Context, token string) (*PageBranding, error) {
+	data, err := s.decodeUnsubscribeData(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token")
+	}
+
+	page := &PageBranding{PrimaryColor: "#4F46E5", AccentColor: "#10B981"}
+	s.db.QueryRowContext(ctx, "SELECT name FROM organizations WHERE id = $1", data.OrgID).Scan(&page.OrgName)
+
+	branding, err := NewBrandingService(s.db, s.cfg).Get(ctx, data.OrgID)
+	if err != nil {
+		return page, nil
+	}
+	page.LogoURL = branding.LogoURL
+	page.HidePoweredBy = branding.HidePoweredBy
+	// Colors go into the page's stylesheet, so only plain hex colors are used
+	if cssColorPattern.MatchString(branding.PrimaryColor) {
+		page.PrimaryColor = branding.PrimaryColor
+	}
+	if cssColorPattern.MatchString(branding.AccentColor) {
+		page.AccentColor = branding.AccentColor
+	}
+	return page, nil
+}
+
+// contactProfile returns the profile fields of a contact the org lets them edit
+func (s *ComplianceService) contactProfile(ctx context.Context, orgID int64, contactID int64) ([]ProfileField, error) {
+	settings := prefcenter.Load(ctx, s.db, orgID)
+	profile := []ProfileField{}
+	if len(settings.ProfileFields) == 0 {
+		return profile, nil
+	}
+
+	fields, err := contactfield.Load(ctx, s.db, orgID)
+	if err != nil {
+		return nil, err
+	}
+	byKey := make(map[string]contactfield.Field, len(fields))
+	for _, f := range fields {
+		byKey[f.Key] = f
+	}
+
+	var firstName, lastName string
+	var rawAttributes []byte
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(attributes, '{}')
+		FROM contacts WHERE id = $1 AND org_id = $2
+	`, contactID, orgID).Scan(&firstName, &lastName, &rawAttributes)
+	if err != nil {
+		return nil, fmt.Errorf("contact not found")
+	}
+	var attributes map[string]any
+	json.Unmarshal(rawAttributes, &attributes)
+
+	for _, key := range settings.ProfileFields {
+		switch key {
+		case prefcenter.FieldFirstName:
+			profile = append(profile, ProfileField{Key: key, Label: "First name", Type: contactfield.TypeString, Value: firstName})
+		case prefcenter.FieldLastName:
+			profile = append(profile, ProfileField{Key: key, Label: "Last name", Type: contactfield.TypeString, Value: lastName})
+		default:
+			// Fields deleted since the settings were saved are left out
+			f, ok := byKey[key]
+			if !ok {
+				continue
+			}
+			profile = append(profile, ProfileField{
+				Key:      f.Key,
+				Label:    f.Label,
+				Type:     f.Type,
+				Options:  f.Options,
+				Required: f.Required,
+				Value:    attributeText(attributes[key]),
+			})
+		}
+	}
+	return profile, nil
+}
+
+// UpdateProfile changes the profile fields of a contact from the preference
+// center. Only the fields the org lets contacts edit can be given; an empty
+// value clears a field.
+func (s *ComplianceService) UpdateProfile(ctx context.Context, token string, values map[string]any, ipAddress string, userAgent string) error {
+	data, err := s.decodeUnsubscribeData(token)
+	if err != nil {
+		return fmt.Errorf("invalid token")
+	}
+	if len(values) == 0 {
+		return nil
+	}
+
+	settings := prefcenter.Load(ctx, s.db, data.OrgID)
+	for key := range values {
+		if !settings.Editable(key) {
+			return fmt.Errorf("%s can't be changed on the preference center", key)
+		}
+	}
+
+	fields, err := contactfield.Load(ctx, s.db, data.OrgID)
+	if err != nil {
+		return err
+	}
+	byKey := make(map[string]contactfield.Field, len(fields))
+	for _, f := range fields {
+		byKey[f.Key] = f
+	}
+
+	var firstName, lastName string
+	var rawAttributes []byte
+	err = s.db.QueryRowContext(ctx, `
+		SELECT COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(attributes, '{}')
+		FROM contacts WHERE id = $1 AND org_id = $2
+	`, data.ContactID, data.OrgID).Scan(&firstName, &lastName, &rawAttributes)
+	if err != nil {
+		return fmt.Errorf("contact not found")
+	}
+	attributes := map[string]any{}
+	json.Unmarshal(rawAttributes, &attributes)
+
+	var changed []string
+	for _, key := range settings.ProfileFields {
+		value, ok := values[key]
+		if !ok {
+			continue
+		}
+		text, isText := value.(string)
+		text = strings.TrimSpace(text)
+
+		if key == prefcenter.FieldFirstName || key == prefcenter.FieldLastName {
+			if !isText && value != nil {
+				return fmt.Errorf("%s must be a string", key)
+			}
+			if len(text) > maxNameLength {
+				return fmt.Errorf("%s must be at most %d characters", key, maxNameLength)
+			}
+			name := &firstName
+			if key == prefcenter.FieldLastName {
+				name = &lastName
+			}
+			if *name != text {
+				*name = text
+				changed = append(changed, key)
+			}
+			continue
+		}
+
+		f, ok := byKey[key]
+		if !ok {
+			continue
+		}
+		_, had := attributes[key]
+		if value == nil || (isText && text == "") {
+			if f.Required {
+				return fmt.Errorf("%s is required", f.Label)
+			}
+			if had {
+				delete(attributes, key)
+				changed = append(changed, key)
+			}
+			continue
+		}
+		normalized, err := f.Normalize(value)
+		if err != nil {
+			return fmt.Errorf("%s %s", f.Label, err)
+		}
+		if !had || attributeText(attributes[key]) != attributeText(normalized) {
+			attributes[key] = normalized
+			changed = append(changed, key)
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+
+	encoded, err := json.Marshal(attributes)
+	if err != nil {
+		return fmt.Errorf("failed to encode attributes: %w", err)
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE contacts SET first_name = $1, last_name = $2, attributes = $3, updated_at = NOW()
+		WHERE id = $4 AND org_id = $5
+	`, sql.NullString{String: firstName, Valid: firstName != ""}, sql.NullString{String: lastName, Valid: lastName != ""},
+		encoded, data.ContactID, data.OrgID)
+	if err != nil {
+		return fmt.Errorf("failed to update profile: %w", err)
+	}
+
+	s.recordConsentChange(ctx, data.ContactID, data.OrgID, "profile_update", "preference-center", nil, ipAddress, userAgent,
+		fmt.Sprintf("Updated %s via preference center", strings.Join(changed, ", ")))
+	return nil
+}
+
+// UnsubscribeFromAll unsubscribes a contact from every email of the org from
+// the preference center
+func (s *ComplianceService) UnsubscribeFromAll(ctx context.Context, token string, ipAddress string, userAgent string) error {
+	data, err := s.decodeUnsubscribeData(token)
+	if err != nil {
+		return fmt.Errorf("invalid token")
+	}
+
+	var email string
+	err = s.db.QueryRowContext(ctx, `
+		UPDATE contacts SET status = 'unsubscribed', updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING email
+	`, data.ContactID, data.OrgID).Scan(&email)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("contact not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to unsubscribe: %w", err)
+	}
+
+	s.db.ExecContext(ctx, `
+		INSERT INTO suppressions (org_id, email, reason, source_type, normalized_email, created_at)
+		VALUES ($1, $2, 'unsubscribe', 'preference_center', $3, NOW())
+		ON CONFLICT (org_id, email) DO NOTHING
+	`, data.OrgID, email, normalizedAddress(ctx, s.db, data.OrgID, email))
+
+	s.recordConsentChange(ctx, data.ContactID, data.OrgID, "unsubscribe", "preference-center", nil, ipAddress, userAgent, "Unsubscribed from all emails via preference center")
+	return nil
+}
+
+// attributeText formats an attribute value for a form field
+func attributeText(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(value)
+}
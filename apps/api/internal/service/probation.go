@@ -0,0 +1,273 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+)
+
+// Newly verified domains are the most abused, so their first sends go through
+// automated content checks and are held for review when anything looks off.
+// Probation ends once cfg.DomainProbationSends emails have been dispatched.
+
+// probationMaxLinks is the number of links above which a probation email is held
+const probationMaxLinks = 20
+
+// probationPhrases are phrases common in phishing and spam content
+var probationPhrases = []string{
+	"verify your account",
+	"confirm your password",
+	"account suspended",
+	"account has been locked",
+	"unusual sign-in activity",
+	"update your payment details",
+	"wire transfer",
+	"gift card",
+	"claim your prize",
+	"you have won",
+	"act now",
+	"100% free",
+	"risk-free",
+	"double your",
+	"crypto investment",
+}
+
+// probationShorteners are URL shortener hosts that hide the real link target
+var probationShorteners = map[string]bool{
+	"bit.ly":      true,
+	"tinyurl.com": true,
+	"goo.gl":      true,
+	"t.co":        true,
+	"ow.ly":       true,
+	"is.gd":       true,
+	"buff.ly":     true,
+	"cutt.ly":     true,
+	"rebrand.ly":  true,
+	"shorturl.at": true,
+}
+
+var (
+	probationAnchorPattern = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']+)["'][^>]*>(.*?)</a>`)
+	probationURLPattern    = regexp.MustCompile(`(?i)https?://[^\s"'<>]+`)
+	probationTagPattern    = regexp.MustCompile(`<[^>]*>`)
+)
+
+// checkProbationContent runs the automated content checks for a domain on probation
+// and returns a finding for each check that failed
+func checkProbationContent(subject, htmlBody, textBody string) []string {
+	var findings []string
+
+	content := strings.ToLower(subject + "\n" + probationTagPattern.ReplaceAllString(htmlBody, " ") + "\n" + textBody)
+	for _, phrase := range probationPhrases {
+		if strings.Contains(content, phrase) {
+			findings = append(findings, fmt.Sprintf("suspicious phrase %q", phrase))
+		}
+	}
+
+	links := probationURLPattern.FindAllString(htmlBody+"\n"+textBody, -1)
+	if len(links) > probationMaxLinks {
+		findings = append(findings, fmt.Sprintf("%d links (max %d)", len(links), probationMaxLinks))
+	}
+
+	shorteners := map[string]bool{}
+	for _, link := range links {
+		host := linkHost(link)
+		if probationShorteners[host] && !shorteners[host] {
+			shorteners[host] = true
+			findings = append(findings, fmt.Sprintf("URL shortener %s", host))
+		}
+	}
+
+	// Anchors whose visible text is a URL pointing somewhere other than the href
+	for _, match := range probationAnchorPattern.FindAllStringSubmatch(htmlBody, -1) {
+		text := strings.TrimSpace(probationTagPattern.ReplaceAllString(match[2], ""))
+		if !strings.Contains(text, ".") || strings.Contains(text, " ") {
+			continue
+		}
+		textHost := linkHost(text)
+		hrefHost := linkHost(match[1])
+		if textHost != "" && hrefHost != "" && textHost != hrefHost {
+			findings = append(findings, fmt.Sprintf("link text %s points to %s", textHost, hrefHost))
+			break
+		}
+	}
+
+	return findings
+}
+
+// linkHost returns the lowercased host of a link, accepting links without a scheme
+func linkHost(link string) string {
+	if !strings.Contains(link, "://") {
+		link = "http://" + link
+	}
+	u, err := url.Parse(link)
+	if err != nil {
+		return ""
+	}
+	return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+}
+
+// onProbation reports whether a domain's sends still go through probation
+func (s *TransactionalService) onProbation(sentCount int, clearedAt sql.NullTime) bool {
+	return s.cfg.DomainProbationSends > 0 && !clearedAt.Valid && sentCount < s.cfg.DomainProbationSends
+}
+
+// probationHoldReason decides whether an email from a domain on probation must be held.
+// An empty reason means the email can be dispatched right away.
+func (s *TransactionalService) probationHoldReason(subject, htmlBody, textBody string) string {
+	if findings := checkProbationContent(subject, htmlBody, textBody); len(findings) > 0 {
+		return "Content check: " + strings.Join(findings, "; ")
+	}
+	if s.cfg.DomainProbationManualReview {
+		return "Manual review required for new sending domain"
+	}
+	return ""
+}
+
+// recordProbationSend counts a dispatched email towards its domain's probation and
+// clears probation once the configured number of sends is reached
+func (s *TransactionalService) recordProbationSend(ctx context.Context, domainID int64) {
+	_, err := s.db.ExecContext(ctx, `
+		UPDATE domains
+		SET probation_sent_count = probation_sent_count + 1,
+		    probation_cleared_at = CASE WHEN probation_sent_count + 1 >= $2 THEN NOW() ELSE probation_cleared_at END,
+		    updated_at = NOW()
+		WHERE id = $1 AND probation_cleared_at IS NULL
+	`, domainID, s.cfg.DomainProbationSends)
+	if err != nil {
+		fmt.Printf("Warning: failed to record probation send: %v\n", err)
+	}
+}
+
+// ListHeldEmails returns the emails held for review in an organization, oldest first
+func (s *TransactionalService) ListHeldEmails(ctx context.Context, orgID int64) ([]*model.HeldEmail, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT uuid, message_id, from_address, to_addresses, subject, COALESCE(hold_reason, ''), created_at
+		FROM transactional_emails
+		WHERE org_id = $1 AND status = 'held'
+		ORDER BY created_at ASC
+		LIMIT 500
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list held emails: %w", err)
+	}
+	defer rows.Close()
+
+	emails := []*model.HeldEmail{}
+	for rows.Next() {
+		var e model.HeldEmail
+		var to string
+		if err := rows.Scan(&e.ID, &e.MessageID, &e.From, &to, &e.Subject, &e.HoldReason, &e.CreatedAt); err != nil {
+			continue
+		}
+		e.To = splitAddresses(to)
+		e.Domain = extractDomain(e.From)
+		emails = append(emails, &e)
+	}
+
+	return emails, nil
+}
+
+// ApproveHeldEmail releases a held email for delivery and counts it towards probation
+func (s *TransactionalService) ApproveHeldEmail(ctx context.Context, orgID, reviewerID int64, emailUUID string) error {
+	var emailID int64
+	var from, to, subject, messageID string
+	var cc, bcc, replyTo, htmlBody, textBody, ampBody, senderPool sql.NullString
+	var scheduledFor sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE transactional_emails
+		SET status = 'queued', reviewed_at = NOW(), reviewed_by = $3, updated_at = NOW()
+		WHERE uuid = $1 AND org_id = $2 AND status = 'held'
+		RETURNING id, from_address, to_addresses, cc_addresses, bcc_addresses, reply_to,
+		          subject, html_body, text_body, amp_body, message_id, scheduled_for, sender_pool
+	`, emailUUID, orgID, reviewerID).Scan(
+		&emailID, &from, &to, &cc, &bcc, &replyTo,
+		&subject, &htmlBody, &textBody, &ampBody, &messageID, &scheduledFor, &senderPool,
+	)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("email not found or not held")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to approve email: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO transactional_delivery_events (email_id, event_type, details)
+		VALUES ($1, 'released', 'Email approved for delivery after review')
+	`, emailID)
+	if err != nil {
+		fmt.Printf("Warning: failed to create delivery event: %v\n", err)
+	}
+	s.triggerWebhooks(ctx, emailID, "email.released", nil)
+
+	toList, ccList, bccList := splitAddresses(to), splitAddresses(cc.String), splitAddresses(bcc.String)
+	if s.queueClient != nil {
+		payload := worker.NewEmailSendPayload(emailID, orgID, from, toList, subject, htmlBody.String, textBody.String, messageID)
+		payload.Cc = ccList
+		payload.Bcc = bccList
+		payload.ReplyTo = replyTo.String
+		payload.AMPBody = ampBody.String
+		payload.SenderPool = senderPool.String
+		payload.Attachments, err = s.emailAttachments(ctx, emailID)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+
+		if scheduledFor.Valid && scheduledFor.Time.After(time.Now()) {
+			_, err = s.queueClient.EnqueueEmailSendScheduled(payload, scheduledFor.Time)
+		} else {
+			_, err = s.queueClient.EnqueueEmailSend(payload)
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to enqueue email: %v\n", err)
+			go s.processEmail(context.Background(), emailID, from, toList, ccList, bccList, subject, htmlBody.String, textBody.String, messageID)
+		}
+	} else {
+		go s.processEmail(context.Background(), emailID, from, toList, ccList, bccList, subject, htmlBody.String, textBody.String, messageID)
+	}
+
+	var domainID int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT id FROM domains WHERE name = $1 AND org_id = $2
+	`, extractDomain(from), orgID).Scan(&domainID)
+	if err == nil {
+		s.recordProbationSend(ctx, domainID)
+	}
+
+	return nil
+}
+
+// RejectHeldEmail permanently stops a held email from being sent
+func (s *TransactionalService) RejectHeldEmail(ctx context.Context, orgID, reviewerID int64, emailUUID, reason string) error {
+	var emailID int64
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE transactional_emails
+		SET status = 'rejected', reviewed_at = NOW(), reviewed_by = $3, updated_at = NOW()
+		WHERE uuid = $1 AND org_id = $2 AND status = 'held'
+		RETURNING id
+	`, emailUUID, orgID, reviewerID).Scan(&emailID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("email not found or not held")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reject email: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO transactional_delivery_events (email_id, event_type, details)
+		VALUES ($1, 'rejected', $2)
+	`, emailID, "Rejected after review: "+reason)
+	if err != nil {
+		fmt.Printf("Warning: failed to create delivery event: %v\n", err)
+	}
+	s.triggerWebhooks(ctx, emailID, "email.rejected", map[string]any{"reason": reason})
+
+	return nil
+}
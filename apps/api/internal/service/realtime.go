@@ -0,0 +1,264 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+)
+
+// Clients are told about inbox changes as they happen instead of polling for
+// them. Changes to received emails reach every API instance through a
+// PostgreSQL NOTIFY trigger, so each instance tells the clients connected to
+// it, whichever instance or worker made the change. Changes to identities'
+// Stalwart mailboxes are pushed by Stalwart's JMAP event source, which an
+// instance follows for each identity of the users connected to it.
+
+// Realtime event types
+const (
+	RealtimeConnected     = "connected"
+	RealtimeHeartbeat     = "heartbeat"
+	RealtimeNewEmail      = "new_email"
+	RealtimeEmailUpdate   = "email_update"
+	RealtimeEmailDeleted  = "email_deleted"
+	RealtimeMailboxChange = "mailbox_change"
+)
+
+// realtimeChannel is the NOTIFY channel of received email changes
+const realtimeChannel = "received_email_changed"
+
+// realtimeBuffer is how many events a client can fall behind by; events past
+// it are dropped rather than holding up the others
+const realtimeBuffer = 100
+
+// RealtimeEvent is an event pushed to a user's connected clients
+type RealtimeEvent struct {
+	Type       string      `json:"type"`
+	Data       interface{} `json:"data"`
+	IdentityID int64       `json:"identityId,omitempty"`
+}
+
+// RealtimeClient is a connection a user receives events on
+type RealtimeClient struct {
+	UserID int64
+	Events chan *RealtimeEvent
+}
+
+// RealtimeHub pushes inbox changes to the clients connected to this instance
+type RealtimeHub struct {
+	db       *sql.DB
+	cfg      *config.Config
+	identity *IdentityService
+	jmap     *JMAPClient
+
+	mu       sync.Mutex
+	clients  map[int64]map[*RealtimeClient]struct{}
+	watchers map[int64]context.CancelFunc // Per user, while they're connected
+}
+
+// NewRealtimeHub creates the realtime hub
+func NewRealtimeHub(db *sql.DB, cfg *config.Config, identityService *IdentityService) *RealtimeHub {
+	return &RealtimeHub{
+		db:       db,
+		cfg:      cfg,
+		identity: identityService,
+		jmap:     NewJMAPClient(cfg.StalwartURL),
+		clients:  make(map[int64]map[*RealtimeClient]struct{}),
+		watchers: make(map[int64]context.CancelFunc),
+	}
+}
+
+// Start begins listening for received email changes. Until it does, clients
+// only hear about changes to their Stalwart mailboxes.
+func (h *RealtimeHub) Start(ctx context.Context) error {
+	listener, err := NewNotifyListener(h.db, h.cfg)
+	if err != nil {
+		return err
+	}
+	listener.Subscribe(realtimeChannel, h.handleReceivedEmailChange)
+	return listener.Start(ctx)
+}
+
+// Subscribe connects a client of a user. The user's identities are watched
+// from their first client connecting until their last disconnects.
+func (h *RealtimeHub) Subscribe(userID int64) *RealtimeClient {
+	client := &RealtimeClient{UserID: userID, Events: make(chan *RealtimeEvent, realtimeBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.clients[userID] == nil {
+		h.clients[userID] = make(map[*RealtimeClient]struct{})
+		ctx, cancel := context.WithCancel(context.Background())
+		h.watchers[userID] = cancel
+		go h.watchUser(ctx, userID)
+	}
+	h.clients[userID][client] = struct{}{}
+	return client
+}
+
+// Unsubscribe disconnects a client
+func (h *RealtimeHub) Unsubscribe(client *RealtimeClient) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	clients := h.clients[client.UserID]
+	delete(clients, client)
+	if len(clients) == 0 {
+		delete(h.clients, client.UserID)
+		if cancel, ok := h.watchers[client.UserID]; ok {
+			cancel()
+			delete(h.watchers, client.UserID)
+		}
+	}
+}
+
+// Connected reports whether a user has clients connected to this instance
+func (h *RealtimeHub) Connected(userID int64) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	return len(h.clients[userID]) > 0
+}
+
+// Notify sends an event to a user's clients connected to this instance
+func (h *RealtimeHub) Notify(userID int64, event *RealtimeEvent) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for client := range h.clients[userID] {
+		select {
+		case client.Events <- event:
+		default:
+			// Client has fallen behind, skip
+		}
+	}
+}
+
+// handleReceivedEmailChange tells a received email's owner that it arrived,
+// changed or was deleted
+func (h *RealtimeHub) handleReceivedEmailChange(payload NotifyPayload) error {
+	userID := notifyInt(payload.Data["user_id"])
+	if userID == 0 || !h.Connected(userID) {
+		return nil
+	}
+	identityID := notifyInt(payload.Data["identity_id"])
+	uuid, _ := payload.Data["uuid"].(string)
+
+	switch payload.Action {
+	case "INSERT":
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		rows, err := h.db.QueryContext(ctx, `
+			SELECT `+receivedEmailColumns+`
+			FROM received_emails re
+			JOIN identities i ON re.identity_id = i.id
+			WHERE re.id = $1
+		`, payload.EmailID)
+		if err != nil {
+			return fmt.Errorf("failed to get received email: %w", err)
+		}
+		defer rows.Close()
+		for _, email := range scanReceivedEmails(rows) {
+			h.Notify(userID, &RealtimeEvent{Type: RealtimeNewEmail, IdentityID: identityID, Data: email})
+		}
+
+	case "UPDATE":
+		h.Notify(userID, &RealtimeEvent{
+			Type:       RealtimeEmailUpdate,
+			IdentityID: identityID,
+			Data: map[string]interface{}{
+				"uuid": uuid,
+				"updates": map[string]interface{}{
+					"folder":    payload.Data["folder"],
+					"isRead":    payload.Data["is_read"],
+					"isStarred": payload.Data["is_starred"],
+					"isTrashed": payload.Data["is_trashed"],
+				},
+			},
+		})
+
+	case "DELETE":
+		h.Notify(userID, &RealtimeEvent{
+			Type:       RealtimeEmailDeleted,
+			IdentityID: identityID,
+			Data:       map[string]interface{}{"uuids": []string{uuid}},
+		})
+	}
+	return nil
+}
+
+// notifyInt reads an ID out of a notification payload, where JSON numbers
+// decode to float64
+func notifyInt(v interface{}) int64 {
+	if f, ok := v.(float64); ok {
+		return int64(f)
+	}
+	return 0
+}
+
+// watchUser follows the JMAP event sources of a user's identities until ctx
+// is done. Identities added in the meantime are watched once the user
+// reconnects.
+func (h *RealtimeHub) watchUser(ctx context.Context, userID int64) {
+	identities, err := h.identity.ListIdentities(ctx, userID)
+	if err != nil {
+		fmt.Printf("Realtime: failed to list identities of user %d: %v\n", userID, err)
+		return
+	}
+	for _, identity := range identities {
+		go h.watchIdentity(ctx, userID, identity)
+	}
+}
+
+// watchIdentity follows an identity's JMAP event source, reconnecting with
+// backoff when it breaks off, and tells the user's clients when the
+// identity's emails or mailboxes change
+func (h *RealtimeHub) watchIdentity(ctx context.Context, userID int64, identity *model.Identity) {
+	delay := time.Second
+	for {
+		auth, err := h.identity.JMAPAuth(ctx, identity)
+		if err != nil {
+			if ctx.Err() == nil {
+				fmt.Printf("Realtime: not watching %s: %v\n", identity.Email, err)
+			}
+			return
+		}
+
+		started := time.Now()
+		err = h.jmap.EventSource(ctx, auth.Username, auth.Password, auth.Session, []string{"Email", "Mailbox"}, func(change *JMAPStateChange) {
+			types := make([]string, 0, 2)
+			for typ := range change.Changed[auth.AccountID] {
+				types = append(types, typ)
+			}
+			if len(types) == 0 {
+				return
+			}
+			h.Notify(userID, &RealtimeEvent{
+				Type:       RealtimeMailboxChange,
+				IdentityID: identity.ID,
+				Data:       map[string]interface{}{"identityId": identity.ID, "changed": types},
+			})
+		})
+		if ctx.Err() != nil || err == errNoEventSource {
+			return
+		}
+		fmt.Printf("Realtime: event source of %s: %v\n", identity.Email, err)
+		// The cached session may be what's stale
+		h.identity.sessions.Invalidate(ctx, identity.ID)
+
+		// A stream that stayed up a while starts the backoff over
+		if time.Since(started) > time.Minute {
+			delay = time.Second
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, time.Minute)
+	}
+}
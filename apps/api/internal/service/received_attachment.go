@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/thumbnail"
+)
+
+// Attachments of received emails are stored in the receiving bucket next to
+// the raw email, and fetched by the browser from short-lived presigned URLs.
+// Image and PDF attachments get a JPEG thumbnail. Since the URLs expire, the
+// cid: references of HTML bodies are rewritten when the email is read rather
+// than when it's stored.
+
+const (
+	// attachmentURLExpiry is how long presigned attachment URLs work for
+	attachmentURLExpiry = 15 * time.Minute
+	// thumbnailSize is the largest width and height of thumbnails in pixels
+	thumbnailSize = 320
+)
+
+// receivedAttachmentKey is where an attachment of the email stored at rawKey
+// is stored, addressed by checksum so a file attached twice is stored once
+func receivedAttachmentKey(rawKey, checksum string) string {
+	return "attachments/" + strings.TrimPrefix(rawKey, "incoming/") + "/" + checksum
+}
+
+// thumbnailKey is where the thumbnail of an attachment is stored
+func thumbnailKey(attachmentKey string) string {
+	return attachmentKey + ".thumb.jpg"
+}
+
+// Provider returns the AWS provider received emails are stored with
+func (s *ReceivingService) Provider() *provider.ReceivingProvider {
+	return s.receivingProvider
+}
+
+// SetReceivingProvider sets where received emails' attachments are fetched
+// from
+func (s *InboxService) SetReceivingProvider(rp *provider.ReceivingProvider) {
+	s.receiving = rp
+}
+
+// storeAttachment uploads an attachment parsed from the email stored at
+// bucket/rawKey, with its thumbnail. Attachments that fail to upload are
+// still recorded, without a key.
+func (s *ReceivingService) storeAttachment(ctx context.Context, bucket, rawKey string, att *AttachmentInfo) {
+	if bucket == "" || rawKey == "" {
+		return
+	}
+	key := receivedAttachmentKey(rawKey, att.Checksum)
+	if err := s.receivingProvider.PutObject(ctx, bucket, key, att.ContentType, att.data); err != nil {
+		log.Printf("Failed to store attachment %s: %v", att.Filename, err)
+		return
+	}
+	att.S3Key = key
+	att.S3Bucket = bucket
+
+	if !thumbnail.Supported(att.ContentType) {
+		return
+	}
+	thumb, err := thumbnail.Generate(att.data, att.ContentType, thumbnailSize)
+	if err != nil {
+		if errors.Is(err, thumbnail.ErrUnsupported) {
+			att.ThumbnailS3Key = sql.NullString{Valid: true}
+		}
+		return
+	}
+	if err := s.receivingProvider.PutObject(ctx, bucket, thumbnailKey(key), thumbnail.ContentType, thumb); err != nil {
+		log.Printf("Failed to store thumbnail of %s: %v", att.Filename, err)
+		return
+	}
+	att.ThumbnailS3Key = sql.NullString{String: thumbnailKey(key), Valid: true}
+}
+
+// storedAttachment is a received attachment as stored
+type storedAttachment struct {
+	id           int64
+	filename     string
+	contentType  string
+	sizeBytes    int
+	s3Key        string
+	s3Bucket     string
+	thumbnailKey sql.NullString
+	virusVerdict string
+	virusName    string
+}
+
+// getStoredAttachment returns an attachment of a received email the user can
+// read
+func (s *InboxService) getStoredAttachment(ctx context.Context, userID int64, emailUUID, attachmentUUID string) (*storedAttachment, error) {
+	if s.receiving == nil {
+		return nil, apierror.New(http.StatusServiceUnavailable, apierror.CodeInternal, "attachment storage is not configured")
+	}
+	var a storedAttachment
+	err := s.db.QueryRowContext(ctx, `
+		SELECT ea.id, ea.filename, ea.content_type, ea.size_bytes, ea.s3_key, ea.s3_bucket, ea.thumbnail_s3_key,
+			COALESCE(ea.virus_verdict, ''), COALESCE(ea.virus_name, '')
+		FROM email_attachments ea
+		JOIN received_emails re ON ea.received_email_id = re.id
+		JOIN identities i ON re.identity_id = i.id
+		WHERE re.uuid = $1 AND ea.uuid = $3 AND `+receivedEmailAccess("$2")+`
+	`, emailUUID, userID, attachmentUUID).Scan(
+		&a.id, &a.filename, &a.contentType, &a.sizeBytes, &a.s3Key, &a.s3Bucket, &a.thumbnailKey,
+		&a.virusVerdict, &a.virusName,
+	)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "attachment not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get attachment: %w", err)
+	}
+	if a.virusVerdict == VirusVerdictFail {
+		if a.virusName != "" {
+			return nil, apierror.Newf(http.StatusForbidden, apierror.CodeForbidden, "attachment blocked: infected with %s", a.virusName)
+		}
+		return nil, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "attachment blocked: flagged as malware")
+	}
+	if a.s3Key == "" || a.s3Bucket == "" {
+		// Received before attachments were stored
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "attachment content is not available")
+	}
+	return &a, nil
+}
+
+// GetReceivedAttachment returns a short-lived URL to download an attachment
+// of a received email from, or to show it inline
+func (s *InboxService) GetReceivedAttachment(ctx context.Context, userID int64, emailUUID, attachmentUUID string, inline bool) (*model.AttachmentLink, error) {
+	a, err := s.getStoredAttachment(ctx, userID, emailUUID, attachmentUUID)
+	if err != nil {
+		return nil, err
+	}
+	expiresAt := time.Now().Add(attachmentURLExpiry)
+	link, err := s.receiving.PresignAttachment(ctx, a.s3Bucket, a.s3Key, a.filename, a.contentType, inline, attachmentURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AttachmentLink{
+		URL:         link,
+		Filename:    a.filename,
+		ContentType: a.contentType,
+		SizeBytes:   a.sizeBytes,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// GetAttachmentThumbnail returns a short-lived URL of an attachment's
+// thumbnail, generating the thumbnail first if it wasn't on receipt
+func (s *InboxService) GetAttachmentThumbnail(ctx context.Context, userID int64, emailUUID, attachmentUUID string) (*model.AttachmentLink, error) {
+	a, err := s.getStoredAttachment(ctx, userID, emailUUID, attachmentUUID)
+	if err != nil {
+		return nil, err
+	}
+	noThumbnail := apierror.New(http.StatusNotFound, apierror.CodeNotFound, "no thumbnail available for this attachment")
+	if !thumbnail.Supported(a.contentType) || (a.thumbnailKey.Valid && a.thumbnailKey.String == "") {
+		return nil, noThumbnail
+	}
+
+	key := a.thumbnailKey.String
+	if !a.thumbnailKey.Valid {
+		data, err := s.receiving.GetEmailFromS3(ctx, a.s3Bucket, a.s3Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch attachment: %w", err)
+		}
+		thumb, err := thumbnail.Generate(data, a.contentType, thumbnailSize)
+		if errors.Is(err, thumbnail.ErrUnsupported) {
+			s.db.ExecContext(ctx, `UPDATE email_attachments SET thumbnail_s3_key = '' WHERE id = $1`, a.id)
+			return nil, noThumbnail
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate thumbnail: %w", err)
+		}
+		key = thumbnailKey(a.s3Key)
+		if err := s.receiving.PutObject(ctx, a.s3Bucket, key, thumbnail.ContentType, thumb); err != nil {
+			return nil, err
+		}
+		s.db.ExecContext(ctx, `UPDATE email_attachments SET thumbnail_s3_key = $1 WHERE id = $2`, key, a.id)
+	}
+
+	expiresAt := time.Now().Add(attachmentURLExpiry)
+	link, err := s.receiving.PresignAttachment(ctx, a.s3Bucket, key, a.filename+".jpg", thumbnail.ContentType, true, attachmentURLExpiry)
+	if err != nil {
+		return nil, err
+	}
+	return &model.AttachmentLink{
+		URL:         link,
+		Filename:    a.filename,
+		ContentType: thumbnail.ContentType,
+		ExpiresAt:   expiresAt,
+	}, nil
+}
+
+// resolveAttachmentURLs signs the URLs of a received email's stored
+// attachments, and points the cid: references of its HTML body at its inline
+// ones
+func (s *InboxService) resolveAttachmentURLs(ctx context.Context, email *model.ReceivedEmail) {
+	if s.receiving == nil {
+		return
+	}
+	inline := make(map[string]string)
+	for i := range email.Attachments {
+		att := &email.Attachments[i]
+		if att.S3Key == "" || att.S3Bucket == "" || att.VirusVerdict == VirusVerdictFail {
+			continue
+		}
+		var err error
+		att.DownloadURL, err = s.receiving.PresignAttachment(ctx, att.S3Bucket, att.S3Key, att.Filename, att.ContentType, false, attachmentURLExpiry)
+		if err != nil {
+			continue
+		}
+		att.PreviewURL, _ = s.receiving.PresignAttachment(ctx, att.S3Bucket, att.S3Key, att.Filename, att.ContentType, true, attachmentURLExpiry)
+		if att.ThumbnailS3Key != "" {
+			att.ThumbnailURL, _ = s.receiving.PresignAttachment(ctx, att.S3Bucket, att.ThumbnailS3Key, att.Filename+".jpg", thumbnail.ContentType, true, attachmentURLExpiry)
+		}
+		if att.ContentID != "" && att.PreviewURL != "" {
+			inline[strings.ToLower(normalizeCID(att.ContentID))] = att.PreviewURL
+		}
+	}
+	email.HTMLBody = resolveCIDReferences(email.HTMLBody, inline)
+}
+
+// resolveCIDReferences replaces the cid: references of an HTML body with the
+// URLs of the inline attachments, keyed by lowercased content ID. References
+// to unknown content IDs are left as they are.
+func resolveCIDReferences(htmlBody string, urls map[string]string) string {
+	if len(urls) == 0 || htmlBody == "" {
+		return htmlBody
+	}
+	return cidReferencePattern.ReplaceAllStringFunc(htmlBody, func(ref string) string {
+		// cid: URLs are URL-encoded (RFC 2392)
+		cid := ref[len("cid:"):]
+		if unescaped, err := url.PathUnescape(cid); err == nil {
+			cid = unescaped
+		}
+		if link, ok := urls[strings.ToLower(cid)]; ok {
+			return strings.ReplaceAll(link, "&", "&amp;")
+		}
+		return ref
+	})
+}
@@ -5,15 +5,14 @@ import (
 	"context"
 	"crypto/sha256"
 	"database/sql"
+	"encoding/base64"
 	"encoding/hex"
-	"encoding/json"
 	"fmt"
 	"io"
 	"log"
 	"mime"
 	"mime/multipart"
 	"net/mail"
-	"regexp"
 	"strings"
 	"time"
 
@@ -28,6 +27,8 @@ type ReceivingService struct {
 	db                    *sql.DB
 	receivingProvider     *provider.ReceivingProvider
 	webhookTriggerService *WebhookTriggerService
+	filterEngine          *InboxFilterEngine
+	clamdAddr             string
 }
 
 // NewReceivingService creates a new receiving service
@@ -55,6 +56,11 @@ func (s *ReceivingService) SetWebhookTriggerService(svc *WebhookTriggerService)
 	s.webhookTriggerService = svc
 }
 
+// SetFilterEngine sets what runs users' inbox filters on the emails received
+func (s *ReceivingService) SetFilterEngine(engine *InboxFilterEngine) {
+	s.filterEngine = engine
+}
+
 // DB returns the database connection
 func (s *ReceivingService) DB() *sql.DB {
 	return s.db
@@ -279,8 +285,20 @@ func (s *ReceivingService) ProcessIncomingEmail(ctx context.Context, notificatio
 		snippet = snippet[:200] + "..."
 	}
 
-	// Generate thread ID from In-Reply-To or References
-	threadID := generateThreadID(notification.Mail.Headers)
+	// Thread the email with the conversation it belongs to
+	inReplyTo := ""
+	if ids := parseMessageIDs(headerValue(notification.Mail.Headers, "In-Reply-To")); len(ids) > 0 {
+		inReplyTo = ids[0]
+	}
+	references := parseMessageIDs(headerValue(notification.Mail.Headers, "References"))
+	threadID := resolveThread(ctx, s.db, threadMessage{
+		IdentityID:    identity.ID,
+		MessageID:     headers.MessageId,
+		InReplyTo:     inReplyTo,
+		References:    references,
+		Subject:       headers.Subject,
+		Correspondent: extractEmail(headers.From),
+	})
 
 	// Prepare spam verdict values
 	isSpam := receipt.SpamVerdict.Status == "FAIL"
@@ -288,6 +306,9 @@ func (s *ReceivingService) ProcessIncomingEmail(ctx context.Context, notificatio
 	if isSpam {
 		folder = "spam"
 	}
+	if receipt.VirusVerdict.Status == VirusVerdictFail {
+		folder = QuarantineFolder
+	}
 
 	// Insert the email
 	var emailID int64
@@ -297,19 +318,19 @@ func (s *ReceivingService) ProcessIncomingEmail(ctx context.Context, notificatio
 			from_email, from_name, to_emails, cc_emails, subject, snippet,
 			raw_s3_bucket, raw_s3_key, folder, is_read, is_starred, is_spam,
 			spam_verdict, virus_verdict, spf_verdict, dkim_verdict, dmarc_verdict,
-			ses_message_id, received_at
+			ses_message_id, received_at, in_reply_to, "references", thread_subject
 		) VALUES (
 			$1, $2, $3, $4, $5,
 			$6, $7, $8, $9, $10, $11,
 			$12, $13, $14, $15, $16, $17,
 			$18, $19, $20, $21, $22,
-			$23, $24
+			$23, $24, NULLIF($25, ''), $26, $27
 		) RETURNING id`,
 		identity.OrgID, identity.DomainID, identity.ID, headers.MessageId, threadID,
 		extractEmail(headers.From), extractName(headers.From), pq.Array(headers.To), pq.Array(headers.Cc), headers.Subject, snippet,
 		s3Bucket, s3Key, folder, false, false, isSpam,
 		receipt.SpamVerdict.Status, receipt.VirusVerdict.Status, receipt.SPFVerdict.Status, receipt.DKIMVerdict.Status, receipt.DMARCVerdict.Status,
-		notification.Mail.MessageId, parseTimestamp(receipt.Timestamp),
+		notification.Mail.MessageId, parseTimestamp(receipt.Timestamp), inReplyTo, pq.Array(references), threadSubject(headers.Subject),
 	).Scan(&emailID)
 
 	if err != nil {
@@ -323,11 +344,21 @@ func (s *ReceivingService) ProcessIncomingEmail(ctx context.Context, notificatio
 
 	log.Printf("Created received email record: %d", emailID)
 
-	// Parse email body from S3 (async)
-	go s.parseEmailBody(context.Background(), emailID, s3Bucket, s3Key)
-
-	// Apply filters
-	go s.applyFilters(context.Background(), identity.OrgID, emailID)
+	// Parse email body from S3 (async), then classify it with the identity's
+	// spam filter and apply inbox filters, which may look at the body.
+	// Quarantined emails stay where they are.
+	go func() {
+		ctx := context.Background()
+		quarantined := s.parseEmailBody(ctx, emailID, s3Bucket, s3Key)
+		if !quarantined {
+			s.classifySpam(ctx, emailID)
+		}
+		if s.filterEngine != nil && !quarantined {
+			if err := s.filterEngine.Apply(ctx, emailID); err != nil {
+				log.Printf("Failed to apply filters to email %d: %v", emailID, err)
+			}
+		}
+	}()
 
 	// Fire webhook trigger (n8n / Zapier integration)
 	if s.webhookTriggerService != nil {
@@ -344,31 +375,57 @@ func (s *ReceivingService) ProcessIncomingEmail(ctx context.Context, notificatio
 	return nil
 }
 
-// parseEmailBody fetches and parses the email body from S3
-func (s *ReceivingService) parseEmailBody(ctx context.Context, emailID int64, bucket, key string) {
+// parseEmailBody fetches and parses the email body from S3, and scans its
+// attachments. It reports whether the email is quarantined.
+func (s *ReceivingService) parseEmailBody(ctx context.Context, emailID int64, bucket, key string) bool {
 	log.Printf("Parsing email body for email %d from s3://%s/%s", emailID, bucket, key)
 
+	var virusVerdict sql.NullString
+	s.db.QueryRowContext(ctx, `SELECT virus_verdict FROM received_emails WHERE id = $1`, emailID).Scan(&virusVerdict)
+	sesFlagged := virusVerdict.String == VirusVerdictFail
+
 	// Fetch from S3
 	rawEmail, err := s.receivingProvider.GetEmailFromS3(ctx, bucket, key)
 	if err != nil {
 		log.Printf("Failed to fetch email from S3: %v", err)
-		return
+		return sesFlagged
 	}
 
 	// Parse MIME message
 	msg, err := mail.ReadMessage(bytes.NewReader(rawEmail))
 	if err != nil {
 		log.Printf("Failed to parse email: %v", err)
-		return
+		return sesFlagged
 	}
 
 	// Extract body and attachments
 	textBody, htmlBody, attachments, err := s.parseEmailParts(ctx, msg)
 	if err != nil {
 		log.Printf("Failed to parse email parts: %v", err)
-		return
+		return sesFlagged
 	}
 
+	// Scan attachments. Without a scanner, those of emails SES flagged are
+	// all treated as infected.
+	scanVerdict := ""
+	for i := range attachments {
+		att := &attachments[i]
+		s.scanAttachment(ctx, att)
+		if att.VirusVerdict == "" && sesFlagged {
+			att.VirusVerdict = VirusVerdictFail
+		}
+		// The email's verdict is its worst attachment's
+		switch {
+		case att.VirusVerdict == VirusVerdictFail:
+			scanVerdict = VirusVerdictFail
+		case att.VirusVerdict == VirusVerdictFailed && scanVerdict != VirusVerdictFail:
+			scanVerdict = VirusVerdictFailed
+		case att.VirusVerdict == VirusVerdictPass && scanVerdict == "":
+			scanVerdict = VirusVerdictPass
+		}
+	}
+	infected := scanVerdict == VirusVerdictFail
+
 	// Create snippet from text body
 	snippet := ""
 	if textBody != "" {
@@ -392,21 +449,39 @@ func (s *ReceivingService) parseEmailBody(ctx context.Context, emailID int64, bu
 	if err != nil {
 		log.Printf("Failed to update email: %v", err)
 	}
+	if infected && !sesFlagged {
+		_, err = s.db.ExecContext(ctx,
+			`UPDATE received_emails SET virus_verdict = $1, folder = $2, updated_at = NOW() WHERE id = $3`,
+			VirusVerdictFail, QuarantineFolder, emailID,
+		)
+		if err != nil {
+			log.Printf("Failed to quarantine email: %v", err)
+		}
+	} else if scanVerdict != "" && !sesFlagged {
+		s.db.ExecContext(ctx, `UPDATE received_emails SET virus_verdict = $1 WHERE id = $2`, scanVerdict, emailID)
+	}
 
-	// Save attachments
+	// Save attachments, keeping infected ones out of storage
 	for _, att := range attachments {
+		if att.VirusVerdict != VirusVerdictFail {
+			s.storeAttachment(ctx, bucket, key, &att)
+		}
 		_, err := s.db.ExecContext(ctx,
 			`INSERT INTO email_attachments (
 				received_email_id, filename, content_type, size_bytes,
-				s3_key, s3_bucket, content_id, is_inline, checksum
-			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)`,
+				s3_key, s3_bucket, content_id, is_inline, checksum, thumbnail_s3_key,
+				virus_verdict, virus_name
+			) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, NULLIF($11, ''), NULLIF($12, ''))`,
 			emailID, att.Filename, att.ContentType, att.SizeBytes,
-			att.S3Key, att.S3Bucket, att.ContentID, att.IsInline, att.Checksum,
+			att.S3Key, att.S3Bucket, att.ContentID, att.IsInline, att.Checksum, att.ThumbnailS3Key,
+			att.VirusVerdict, att.VirusName,
 		)
 		if err != nil {
 			log.Printf("Failed to save attachment: %v", err)
 		}
 	}
+
+	return infected || sesFlagged
 }
 
 // AttachmentInfo contains parsed attachment information
@@ -419,6 +494,13 @@ type AttachmentInfo struct {
 	ContentID   string
 	IsInline    bool
 	Checksum    string
+	// ThumbnailS3Key is NULL until a thumbnail is attempted, and empty when
+	// none can be made
+	ThumbnailS3Key sql.NullString
+	VirusVerdict   string // Empty when not scanned
+	VirusName      string
+
+	data []byte
 }
 
 // parseEmailParts parses the MIME parts of an email
@@ -426,214 +508,104 @@ func (s *ReceivingService) parseEmailParts(ctx context.Context, msg *mail.Messag
 	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
 	if err != nil {
 		// Assume plain text
-		body, _ := io.ReadAll(msg.Body)
+		body, _ := io.ReadAll(decodeTransfer(msg.Body, msg.Header.Get("Content-Transfer-Encoding")))
 		return string(body), "", nil, nil
 	}
 
 	if strings.HasPrefix(mediaType, "multipart/") {
-		mr := multipart.NewReader(msg.Body, params["boundary"])
-		for {
-			p, err := mr.NextPart()
-			if err == io.EOF {
-				break
-			}
-			if err != nil {
-				return textBody, htmlBody, attachments, err
-			}
-
-			partMediaType, _, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
-			disposition, dispParams, _ := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
-
-			partBody, err := io.ReadAll(p)
-			if err != nil {
-				continue
-			}
+		p := &parsedParts{}
+		err = p.walk(msg.Body, params["boundary"])
+		return p.textBody, p.htmlBody, p.attachments, err
+	}
 
-			switch {
-			case partMediaType == "text/plain" && disposition != "attachment":
-				textBody = string(partBody)
-			case partMediaType == "text/html" && disposition != "attachment":
-				htmlBody = string(partBody)
-			case disposition == "attachment" || disposition == "inline":
-				filename := dispParams["filename"]
-				if filename == "" {
-					filename = p.FileName()
-				}
-				if filename == "" {
-					filename = "attachment"
-				}
-
-				// Calculate checksum
-				hash := sha256.Sum256(partBody)
-				checksum := hex.EncodeToString(hash[:])
-
-				attachments = append(attachments, AttachmentInfo{
-					Filename:    filename,
-					ContentType: partMediaType,
-					SizeBytes:   len(partBody),
-					ContentID:   strings.Trim(p.Header.Get("Content-ID"), "<>"),
-					IsInline:    disposition == "inline",
-					Checksum:    checksum,
-					// Note: S3 upload would happen here in production
-				})
-			}
-		}
-	} else if mediaType == "text/plain" {
-		body, _ := io.ReadAll(msg.Body)
+	body, _ := io.ReadAll(decodeTransfer(msg.Body, msg.Header.Get("Content-Transfer-Encoding")))
+	if mediaType == "text/plain" {
 		textBody = string(body)
 	} else if mediaType == "text/html" {
-		body, _ := io.ReadAll(msg.Body)
 		htmlBody = string(body)
 	}
 
-	return textBody, htmlBody, attachments, nil
+	return textBody, htmlBody, nil, nil
 }
 
-// applyFilters applies user-defined filters to an email
-func (s *ReceivingService) applyFilters(ctx context.Context, orgID, emailID int64) {
-	// Get email
-	var email model.ReceivedEmail
-	var toEmailsArr, ccEmailsArr pq.StringArray
-	var textBody sql.NullString
-	err := s.db.QueryRowContext(ctx,
-		`SELECT id, org_id, domain_id, identity_id, from_email, to_emails, cc_emails,
-		        subject, text_body, has_attachments, folder, is_starred, is_read
-		 FROM received_emails WHERE id = $1`,
-		emailID,
-	).Scan(&email.ID, &email.OrgID, &email.DomainID, &email.IdentityID, &email.FromEmail,
-		&toEmailsArr, &ccEmailsArr, &email.Subject, &textBody, &email.HasAttachments,
-		&email.Folder, &email.IsStarred, &email.IsRead)
-	if err != nil {
-		log.Printf("Failed to get email for filtering: %v", err)
-		return
-	}
-	email.TextBody = textBody.String
-	email.ToEmails = []string(toEmailsArr)
-	email.CcEmails = []string(ccEmailsArr)
-
-	// Get applicable filters
-	rows, err := s.db.QueryContext(ctx,
-		`SELECT id, conditions, condition_logic, action_labels, action_folder,
-		        action_star, action_mark_read, action_archive, action_trash
-		 FROM inbox_filters
-		 WHERE org_id = $1 AND active = true AND (identity_id IS NULL OR identity_id = $2)
-		 ORDER BY priority DESC`,
-		orgID, email.IdentityID,
-	)
-	if err != nil {
-		log.Printf("Failed to get filters: %v", err)
-		return
-	}
-	defer rows.Close()
-
-	for rows.Next() {
-		var filter struct {
-			ID             int64
-			Conditions     string
-			ConditionLogic string
-			ActionLabels   sql.NullString
-			ActionFolder   sql.NullString
-			ActionStar     bool
-			ActionMarkRead bool
-			ActionArchive  bool
-			ActionTrash    bool
-		}
+// parsedParts collects the bodies and attachments of a multipart email
+type parsedParts struct {
+	textBody    string
+	htmlBody    string
+	attachments []AttachmentInfo
+}
 
-		err := rows.Scan(&filter.ID, &filter.Conditions, &filter.ConditionLogic, &filter.ActionLabels,
-			&filter.ActionFolder, &filter.ActionStar, &filter.ActionMarkRead, &filter.ActionArchive, &filter.ActionTrash)
+// walk parses the parts of a multipart body, descending into nested ones such
+// as the multipart/related holding an HTML body and its inline images
+func (pp *parsedParts) walk(body io.Reader, boundary string) error {
+	mr := multipart.NewReader(body, boundary)
+	for {
+		p, err := mr.NextPart()
+		if err == io.EOF {
+			return nil
+		}
 		if err != nil {
-			log.Printf("Failed to scan filter: %v", err)
-			continue
+			return err
 		}
 
-		var conditions []model.FilterCondition
-		json.Unmarshal([]byte(filter.Conditions), &conditions)
+		partMediaType, partParams, _ := mime.ParseMediaType(p.Header.Get("Content-Type"))
+		disposition, dispParams, _ := mime.ParseMediaType(p.Header.Get("Content-Disposition"))
+		contentID := strings.Trim(strings.TrimSpace(p.Header.Get("Content-ID")), "<>")
 
-		if s.matchesFilter(email, conditions, filter.ConditionLogic) {
-			// Apply actions based on what's set
-			if filter.ActionFolder.Valid && filter.ActionFolder.String != "" {
-				s.db.ExecContext(ctx, `UPDATE received_emails SET folder = $1 WHERE id = $2`, filter.ActionFolder.String, emailID)
-			}
-			if filter.ActionStar {
-				s.db.ExecContext(ctx, `UPDATE received_emails SET is_starred = true WHERE id = $1`, emailID)
-			}
-			if filter.ActionMarkRead {
-				s.db.ExecContext(ctx, `UPDATE received_emails SET is_read = true, read_at = $1 WHERE id = $2`, time.Now(), emailID)
-			}
-			if filter.ActionArchive {
-				s.db.ExecContext(ctx, `UPDATE received_emails SET is_archived = true WHERE id = $1`, emailID)
-			}
-			if filter.ActionTrash {
-				s.db.ExecContext(ctx, `UPDATE received_emails SET is_trashed = true, trashed_at = $1 WHERE id = $2`, time.Now(), emailID)
+		if strings.HasPrefix(partMediaType, "multipart/") {
+			if err := pp.walk(p, partParams["boundary"]); err != nil {
+				return err
 			}
-
-			// Update filter stats
-			s.db.ExecContext(ctx, `UPDATE inbox_filters SET match_count = match_count + 1, last_matched_at = $1 WHERE id = $2`, time.Now(), filter.ID)
-
-			log.Printf("Applied filter %d to email %d", filter.ID, emailID)
+			continue
 		}
-	}
-}
-
-// matchesFilter checks if an email matches filter conditions
-func (s *ReceivingService) matchesFilter(email model.ReceivedEmail, conditions []model.FilterCondition, logic string) bool {
-	if len(conditions) == 0 {
-		return false
-	}
-
-	for _, cond := range conditions {
-		matches := s.matchesCondition(email, cond)
 
-		if logic == "any" && matches {
-			return true
-		}
-		if logic == "all" && !matches {
-			return false
+		// multipart.Reader only undoes quoted-printable itself
+		partBody, err := io.ReadAll(decodeTransfer(p, p.Header.Get("Content-Transfer-Encoding")))
+		if err != nil {
+			continue
 		}
-	}
 
-	return logic == "all"
-}
+		switch {
+		case partMediaType == "text/plain" && disposition != "attachment" && pp.textBody == "":
+			pp.textBody = string(partBody)
+		case partMediaType == "text/html" && disposition != "attachment" && pp.htmlBody == "":
+			pp.htmlBody = string(partBody)
+		case disposition == "attachment" || disposition == "inline" || contentID != "":
+			filename := dispParams["filename"]
+			if filename == "" {
+				filename = p.FileName()
+			}
+			if filename == "" {
+				filename = partParams["name"]
+			}
+			if filename == "" {
+				filename = "attachment"
+			}
 
-// matchesCondition checks if an email matches a single condition
-func (s *ReceivingService) matchesCondition(email model.ReceivedEmail, cond model.FilterCondition) bool {
-	var value string
-	switch cond.Field {
-	case "from":
-		value = email.FromEmail
-	case "to":
-		value = strings.Join(email.ToEmails, ", ")
-	case "subject":
-		value = email.Subject
-	case "body":
-		value = email.TextBody
-	case "hasAttachment":
-		if email.HasAttachments {
-			return cond.Value == "true"
+			// Calculate checksum
+			hash := sha256.Sum256(partBody)
+			checksum := hex.EncodeToString(hash[:])
+
+			pp.attachments = append(pp.attachments, AttachmentInfo{
+				Filename:    filename,
+				ContentType: partMediaType,
+				SizeBytes:   len(partBody),
+				ContentID:   contentID,
+				IsInline:    disposition == "inline" || (disposition == "" && contentID != ""),
+				Checksum:    checksum,
+				data:        partBody,
+			})
 		}
-		return cond.Value == "false"
-	default:
-		return false
 	}
+}
 
-	value = strings.ToLower(value)
-	condValue := strings.ToLower(cond.Value)
-
-	switch cond.Operator {
-	case "contains":
-		return strings.Contains(value, condValue)
-	case "equals":
-		return value == condValue
-	case "startsWith":
-		return strings.HasPrefix(value, condValue)
-	case "endsWith":
-		return strings.HasSuffix(value, condValue)
-	case "regex":
-		matched, _ := regexp.MatchString(cond.Value, value)
-		return matched
+// decodeTransfer undoes a part's base64 content transfer encoding
+func decodeTransfer(r io.Reader, encoding string) io.Reader {
+	if strings.EqualFold(strings.TrimSpace(encoding), "base64") {
+		// The decoder skips the line breaks base64 bodies are wrapped with
+		return base64.NewDecoder(base64.StdEncoding, r)
 	}
-
-	return false
+	return r
 }
 
 // Helper functions
@@ -666,21 +638,6 @@ func extractName(addresses []string) string {
 	return ""
 }
 
-func generateThreadID(headers []model.SESHeader) string {
-	for _, h := range headers {
-		if h.Name == "In-Reply-To" || h.Name == "References" {
-			// Use first reference as thread ID
-			refs := strings.Fields(h.Value)
-			if len(refs) > 0 {
-				// Hash the reference
-				hash := sha256.Sum256([]byte(refs[0]))
-				return hex.EncodeToString(hash[:8])
-			}
-		}
-	}
-	return ""
-}
-
 func parseTimestamp(ts string) time.Time {
 	t, err := time.Parse(time.RFC3339, ts)
 	if err != nil {
@@ -0,0 +1,348 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+	"github.com/dublyo/mailat/api/pkg/retention"
+)
+
+// RecipientService answers "what happened to mail sent to this address?" across
+// transactional sends, campaign sends, suppressions and inbound replies
+type RecipientService struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+// NewRecipientService creates a new recipient service
+func NewRecipientService(db *sql.DB, cfg *config.Config) *RecipientService {
+	return &RecipientService{db: db, cfg: cfg}
+}
+
+// GetHistory returns everything involving an address within the organization, newest first
+func (s *RecipientService) GetHistory(ctx context.Context, orgID int64, email string, query *model.RecipientHistoryQuery) (*model.RecipientHistoryResponse, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !strings.Contains(email, "@") {
+		return nil, fmt.Errorf("invalid email address")
+	}
+
+	to := time.Now()
+	from := time.Time{}
+	if query.From != "" {
+		t, err := time.Parse(time.RFC3339, query.From)
+		if err != nil {
+			return nil, fmt.Errorf("invalid from format, use RFC3339")
+		}
+		from = t
+	}
+	if query.To != "" {
+		t, err := time.Parse(time.RFC3339, query.To)
+		if err != nil {
+			return nil, fmt.Errorf("invalid to format, use RFC3339")
+		}
+		to = t
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("from must be before to")
+	}
+
+	limit := query.Limit
+	if limit < 1 || limit > 500 {
+		limit = 100
+	}
+
+	policy := retention.Load(ctx, s.db, orgID)
+	history := &model.RecipientHistoryResponse{
+		Email:           email,
+		NormalizedEmail: emailaddr.Normalize(email, emailaddr.LoadRules(ctx, s.db, orgID)),
+		Sends:           []model.RecipientSend{},
+		Suppressions:    []model.RecipientSuppression{},
+		Replies:         []model.RecipientReply{},
+		Retention: model.RecipientRetention{
+			StripContentAfterDays: policy.StripContentAfterDays,
+			DeleteAfterDays:       policy.DeleteAfterDays,
+		},
+	}
+	if policy.DeleteAfterDays > 0 {
+		availableFrom := time.Now().AddDate(0, 0, -policy.DeleteAfterDays)
+		history.Retention.HistoryAvailableFrom = &availableFrom
+	}
+
+	transactional, err := s.transactionalSends(ctx, orgID, email, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	campaign, err := s.campaignSends(ctx, orgID, email, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+	history.Sends = append(transactional, campaign...)
+	sort.Slice(history.Sends, func(i, j int) bool {
+		return history.Sends[i].CreatedAt.After(history.Sends[j].CreatedAt)
+	})
+	if len(history.Sends) > limit {
+		history.Sends = history.Sends[:limit]
+	}
+
+	history.Suppressions, err = s.suppressions(ctx, orgID, email, history.NormalizedEmail)
+	if err != nil {
+		return nil, err
+	}
+	history.Suppressed = len(history.Suppressions) > 0
+
+	history.Replies, err = s.replies(ctx, orgID, email, from, to, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return history, nil
+}
+
+// transactionalSends returns transactional emails with the address in to, cc or bcc.
+// Status and bounce details are the recipient's own, not those of other recipients.
+func (s *RecipientService) transactionalSends(ctx context.Context, orgID int64, email string, from, to time.Time, limit int) ([]model.RecipientSend, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT DISTINCT ON (e.created_at, e.id) e.id, e.uuid, e.message_id, e.from_address, e.subject,
+		       CASE WHEN r.status = 'queued' THEN e.status ELSE r.status END,
+		       COALESCE(r.bounce_class, ''), COALESCE(r.bounce_reason, ''),
+		       e.content_archived_at IS NOT NULL, e.created_at, e.sent_at
+		FROM transactional_email_recipients r
+		JOIN transactional_emails e ON e.id = r.email_id
+		WHERE r.email = $2 AND e.org_id = $1 AND e.created_at >= $3 AND e.created_at < $4
+		ORDER BY e.created_at DESC, e.id
+		LIMIT $5
+	`, orgID, email, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get transactional sends: %w", err)
+	}
+	defer rows.Close()
+
+	sends := []model.RecipientSend{}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var send model.RecipientSend
+		var sentAt sql.NullTime
+		if err := rows.Scan(&id, &send.ID, &send.MessageID, &send.From, &send.Subject, &send.Status,
+			&send.BounceClass, &send.BounceReason, &send.ContentArchived, &send.CreatedAt, &sentAt); err != nil {
+			continue
+		}
+		send.Type = "transactional"
+		send.Events = []model.RecipientEvent{}
+		if sentAt.Valid {
+			send.SentAt = &sentAt.Time
+		}
+		ids = append(ids, id)
+		sends = append(sends, send)
+	}
+
+	if len(ids) == 0 {
+		return sends, nil
+	}
+
+	eventRows, err := s.db.QueryContext(ctx, `
+		SELECT email_id, event_type, COALESCE(details, ''), created_at
+		FROM transactional_delivery_events
+		WHERE email_id = ANY($1)
+		ORDER BY created_at ASC
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery events: %w", err)
+	}
+	defer eventRows.Close()
+
+	index := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+	for eventRows.Next() {
+		var emailID int64
+		var event model.RecipientEvent
+		if err := eventRows.Scan(&emailID, &event.Type, &event.Details, &event.Timestamp); err != nil {
+			continue
+		}
+		if i, ok := index[emailID]; ok {
+			sends[i].Events = append(sends[i].Events, event)
+		}
+	}
+
+	return sends, nil
+}
+
+// campaignSends returns campaign emails addressed to the recipient
+func (s *RecipientService) campaignSends(ctx context.Context, orgID int64, email string, from, to time.Time, limit int) ([]model.RecipientSend, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.uuid, e.message_id, e.from_email, e.subject, e.status,
+		       COALESCE(c.uuid::text, ''), COALESCE(c.name, ''), e.created_at, e.sent_at
+		FROM emails e
+		LEFT JOIN campaigns c ON c.id = e.campaign_id
+		WHERE e.org_id = $1 AND e.created_at >= $3 AND e.created_at < $4
+		  AND EXISTS (SELECT 1 FROM unnest(e.to_emails || e.cc_emails || e.bcc_emails) addr WHERE lower(addr) = $2)
+		ORDER BY e.created_at DESC
+		LIMIT $5
+	`, orgID, email, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get campaign sends: %w", err)
+	}
+	defer rows.Close()
+
+	sends := []model.RecipientSend{}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		var send model.RecipientSend
+		var sentAt sql.NullTime
+		if err := rows.Scan(&id, &send.ID, &send.MessageID, &send.From, &send.Subject, &send.Status,
+			&send.CampaignID, &send.CampaignName, &send.CreatedAt, &sentAt); err != nil {
+			continue
+		}
+		send.Type = "campaign"
+		send.Events = []model.RecipientEvent{}
+		if sentAt.Valid {
+			send.SentAt = &sentAt.Time
+		}
+		ids = append(ids, id)
+		sends = append(sends, send)
+	}
+
+	if len(ids) == 0 {
+		return sends, nil
+	}
+
+	eventRows, err := s.db.QueryContext(ctx, `
+		SELECT email_id, event_type, COALESCE(data::text, ''), occurred_at
+		FROM delivery_events
+		WHERE email_id = ANY($1)
+		ORDER BY occurred_at ASC
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get delivery events: %w", err)
+	}
+	defer eventRows.Close()
+
+	index := make(map[int64]int, len(ids))
+	for i, id := range ids {
+		index[id] = i
+	}
+	for eventRows.Next() {
+		var emailID int64
+		var event model.RecipientEvent
+		if err := eventRows.Scan(&emailID, &event.Type, &event.Details, &event.Timestamp); err != nil {
+			continue
+		}
+		if event.Details == "{}" {
+			event.Details = ""
+		}
+		if i, ok := index[emailID]; ok {
+			sends[i].Events = append(sends[i].Events, event)
+		}
+	}
+
+	return sends, nil
+}
+
+// suppressions returns suppression entries matching the address or its canonical form
+func (s *RecipientService) suppressions(ctx context.Context, orgID int64, email, normalized string) ([]model.RecipientSuppression, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT email, COALESCE(reason, ''), COALESCE(source, ''), created_at
+		FROM suppression_list
+		WHERE org_id = $1 AND (email = $2 OR normalized_email = $3)
+		UNION ALL
+		SELECT email, reason, source_type, created_at
+		FROM suppressions
+		WHERE org_id = $1 AND (lower(email) = $2 OR normalized_email = $3)
+		ORDER BY created_at DESC
+	`, orgID, email, normalized)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get suppressions: %w", err)
+	}
+	defer rows.Close()
+
+	suppressions := []model.RecipientSuppression{}
+	for rows.Next() {
+		var sup model.RecipientSuppression
+		if err := rows.Scan(&sup.Email, &sup.Reason, &sup.Source, &sup.CreatedAt); err != nil {
+			continue
+		}
+		suppressions = append(suppressions, sup)
+	}
+
+	return suppressions, nil
+}
+
+// replies returns inbound emails received from the address
+func (s *RecipientService) replies(ctx context.Context, orgID int64, email string, from, to time.Time, limit int) ([]model.RecipientReply, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT uuid, message_id, COALESCE(in_reply_to, ''), subject, COALESCE(snippet, ''), received_at
+		FROM received_emails
+		WHERE org_id = $1 AND lower(from_email) = $2 AND received_at >= $3 AND received_at < $4
+		ORDER BY received_at DESC
+		LIMIT $5
+	`, orgID, email, from, to, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get replies: %w", err)
+	}
+	defer rows.Close()
+
+	replies := []model.RecipientReply{}
+	for rows.Next() {
+		var reply model.RecipientReply
+		if err := rows.Scan(&reply.ID, &reply.MessageID, &reply.InReplyTo, &reply.Subject, &reply.Snippet, &reply.ReceivedAt); err != nil {
+			continue
+		}
+		replies = append(replies, reply)
+	}
+
+	return replies, nil
+}
+
+// HistoryCSV flattens a recipient history into a timeline of CSV rows (header included)
+func HistoryCSV(history *model.RecipientHistoryResponse) [][]string {
+	records := [][]string{{"timestamp", "kind", "type", "id", "message_id", "subject", "status", "details"}}
+
+	type row struct {
+		at     time.Time
+		record []string
+	}
+	var rows []row
+	for _, send := range history.Sends {
+		details := send.CampaignName
+		if send.ContentArchived {
+			details = strings.TrimSpace(details + " (content archived)")
+		}
+		rows = append(rows, row{send.CreatedAt, []string{
+			send.CreatedAt.UTC().Format(time.RFC3339), "send", send.Type, send.ID, send.MessageID, send.Subject, send.Status, details,
+		}})
+		for _, event := range send.Events {
+			rows = append(rows, row{event.Timestamp, []string{
+				event.Timestamp.UTC().Format(time.RFC3339), "event", event.Type, send.ID, send.MessageID, send.Subject, "", event.Details,
+			}})
+		}
+	}
+	for _, sup := range history.Suppressions {
+		rows = append(rows, row{sup.CreatedAt, []string{
+			sup.CreatedAt.UTC().Format(time.RFC3339), "suppression", sup.Source, "", "", "", "", sup.Email + ": " + sup.Reason,
+		}})
+	}
+	for _, reply := range history.Replies {
+		rows = append(rows, row{reply.ReceivedAt, []string{
+			reply.ReceivedAt.UTC().Format(time.RFC3339), "reply", "inbound", reply.ID, reply.MessageID, reply.Subject, "", reply.InReplyTo,
+		}})
+	}
+
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].at.Before(rows[j].at) })
+	for _, r := range rows {
+		records = append(records, r.record)
+	}
+
+	return records
+}
@@ -3,10 +3,33 @@ package service
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
+	"net/mail"
+	"strings"
 	"time"
 
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+	"github.com/dublyo/mailat/api/pkg/backup"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/hygiene"
+	"github.com/dublyo/mailat/api/pkg/contentguard"
+	"github.com/dublyo/mailat/api/pkg/outboundrules"
+	"github.com/dublyo/mailat/api/pkg/crypto"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+	"github.com/dublyo/mailat/api/pkg/eventexport"
+	"github.com/dublyo/mailat/api/pkg/inboxpreview"
+	"github.com/dublyo/mailat/api/pkg/mailassist"
+	"github.com/dublyo/mailat/api/pkg/prefcenter"
+	"github.com/dublyo/mailat/api/pkg/retention"
+	"github.com/dublyo/mailat/api/pkg/rotation"
+	"github.com/dublyo/mailat/api/pkg/sendrate"
+	"github.com/dublyo/mailat/api/pkg/sendwindow"
+	"github.com/dublyo/mailat/api/pkg/utm"
+	"github.com/dublyo/mailat/api/pkg/warmup"
 )
 
 // UserSettings represents user preferences
@@ -27,6 +50,7 @@ type UserSettings struct {
 	Theme                 string    `json:"theme"`
 	Density               string    `json:"density"`
 	InboxLayout           string    `json:"inboxLayout"`
+	UndoSendSeconds       int       `json:"undoSendSeconds"` // 0 sends at once
 	TwoFactorEnabled      bool      `json:"twoFactorEnabled"`
 	TwoFactorMethod       *string   `json:"twoFactorMethod"`
 	CreatedAt             time.Time `json:"createdAt"`
@@ -49,6 +73,7 @@ type UpdateSettingsRequest struct {
 	Theme                 *string `json:"theme"`
 	Density               *string `json:"density"`
 	InboxLayout           *string `json:"inboxLayout"`
+	UndoSendSeconds       *int    `json:"undoSendSeconds"`
 }
 
 // ChangePasswordRequest for password changes
@@ -74,7 +99,8 @@ func (s *SettingsService) GetSettings(ctx context.Context, userID int64) (*UserS
 		SELECT id, user_id, COALESCE(display_name, ''), show_snippets, conversation_view, auto_advance,
 			   new_email_notifications, campaign_reports, weekly_digest, blacklist_alerts,
 			   bounce_rate_warnings, quota_warnings, browser_notifications, theme, density,
-			   inbox_layout, two_factor_enabled, two_factor_method, created_at, updated_at
+			   inbox_layout, COALESCE(undo_send_seconds, 0), two_factor_enabled, two_factor_method,
+			   created_at, updated_at
 		FROM user_settings
 		WHERE user_id = $1
 	`, userID).Scan(
@@ -82,8 +108,8 @@ func (s *SettingsService) GetSettings(ctx context.Context, userID int64) (*UserS
 		&settings.ConversationView, &settings.AutoAdvance, &settings.NewEmailNotifications,
 		&settings.CampaignReports, &settings.WeeklyDigest, &settings.BlacklistAlerts,
 		&settings.BounceRateWarnings, &settings.QuotaWarnings, &settings.BrowserNotifications,
-		&settings.Theme, &settings.Density, &settings.InboxLayout, &settings.TwoFactorEnabled,
-		&settings.TwoFactorMethod, &settings.CreatedAt, &settings.UpdatedAt,
+		&settings.Theme, &settings.Density, &settings.InboxLayout, &settings.UndoSendSeconds,
+		&settings.TwoFactorEnabled, &settings.TwoFactorMethod, &settings.CreatedAt, &settings.UpdatedAt,
 	)
 
 	if err == sql.ErrNoRows {
@@ -149,6 +175,15 @@ func (s *SettingsService) createDefaultSettings(ctx context.Context, userID int6
 
 // UpdateSettings updates user settings
 func (s *SettingsService) UpdateSettings(ctx context.Context, userID int64, req *UpdateSettingsRequest) (*UserSettings, error) {
+	if req.UndoSendSeconds != nil && *req.UndoSendSeconds != 0 &&
+		(*req.UndoSendSeconds < MinUndoSendSeconds || *req.UndoSendSeconds > MaxUndoSendSeconds) {
+		return nil, &apierror.ValidationError{Fields: []apierror.FieldError{{
+			Field:   "undoSendSeconds",
+			Rule:    "between",
+			Message: fmt.Sprintf("undoSendSeconds must be 0 or between %d and %d", MinUndoSendSeconds, MaxUndoSendSeconds),
+		}}}
+	}
+
 	// First ensure settings exist
 	_, err := s.GetSettings(ctx, userID)
 	if err != nil {
@@ -171,12 +206,13 @@ func (s *SettingsService) UpdateSettings(ctx context.Context, userID int64, req
 			theme = COALESCE($13, theme),
 			density = COALESCE($14, density),
 			inbox_layout = COALESCE($15, inbox_layout),
+			undo_send_seconds = COALESCE($16, undo_send_seconds),
 			updated_at = NOW()
 		WHERE user_id = $1
 	`, userID, req.DisplayName, req.ShowSnippets, req.ConversationView, req.AutoAdvance,
 		req.NewEmailNotifications, req.CampaignReports, req.WeeklyDigest, req.BlacklistAlerts,
 		req.BounceRateWarnings, req.QuotaWarnings, req.BrowserNotifications, req.Theme,
-		req.Density, req.InboxLayout)
+		req.Density, req.InboxLayout, req.UndoSendSeconds)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to update settings: %w", err)
@@ -184,3 +220,814 @@ func (s *SettingsService) UpdateSettings(ctx context.Context, userID int64, req
 
 	return s.GetSettings(ctx, userID)
 }
+
+// UpdateAddressNormalizationRequest for updating org-level address normalization rules
+type UpdateAddressNormalizationRequest struct {
+	Lowercase      *bool    `json:"lowercase"`
+	StripPlusTags  *bool    `json:"stripPlusTags"`
+	StripGmailDots *bool    `json:"stripGmailDots"`
+	TagSeparators  []string `json:"tagSeparators"`
+}
+
+// GetAddressNormalization returns the rules used to canonicalize recipient
+// addresses for suppression checks and bounce matching
+func (s *SettingsService) GetAddressNormalization(ctx context.Context, orgID int64) (emailaddr.Rules, error) {
+	return emailaddr.LoadRules(ctx, s.db, orgID), nil
+}
+
+// UpdateAddressNormalization updates the organization's address normalization rules
+func (s *SettingsService) UpdateAddressNormalization(ctx context.Context, orgID int64, req *UpdateAddressNormalizationRequest) (emailaddr.Rules, error) {
+	rules := emailaddr.LoadRules(ctx, s.db, orgID)
+	if req.Lowercase != nil {
+		rules.Lowercase = *req.Lowercase
+	}
+	if req.StripPlusTags != nil {
+		rules.StripPlusTags = *req.StripPlusTags
+	}
+	if req.StripGmailDots != nil {
+		rules.StripGmailDots = *req.StripGmailDots
+	}
+	if req.TagSeparators != nil {
+		for _, sep := range req.TagSeparators {
+			if len(sep) != 1 || sep == "@" {
+				return rules, fmt.Errorf("invalid tag separator %q: must be a single character other than @", sep)
+			}
+		}
+		rules.TagSeparators = req.TagSeparators
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "addressNormalization", rules); err != nil {
+		return rules, err
+	}
+
+	// Suppressions stored under the old rules must match under the new ones
+	if err := emailaddr.Renormalize(ctx, s.db, orgID); err != nil {
+		return rules, err
+	}
+
+	return rules, nil
+}
+
+// UpdateRetentionPolicyRequest for updating the org's transactional email retention policy
+type UpdateRetentionPolicyRequest struct {
+	StripContentAfterDays *int    `json:"stripContentAfterDays"`
+	DeleteAfterDays       *int    `json:"deleteAfterDays"`
+	ExportURL             *string `json:"exportUrl"`
+	ExportSecret          *string `json:"exportSecret"`
+}
+
+// maskedSecret replaces secrets in settings responses
+const maskedSecret = "********"
+
+// RetentionSettings is the retention policy together with the outcome of its last run
+type RetentionSettings struct {
+	Policy  retention.Policy           `json:"policy"`
+	LastRun *worker.RetentionRunResult `json:"lastRun,omitempty"`
+}
+
+// GetRetentionPolicy returns the organization's retention policy. The export secret is masked.
+func (s *SettingsService) GetRetentionPolicy(ctx context.Context, orgID int64) (*RetentionSettings, error) {
+	settings := &RetentionSettings{Policy: retention.Load(ctx, s.db, orgID)}
+	if settings.Policy.ExportSecret != "" {
+		settings.Policy.ExportSecret = maskedSecret
+	}
+
+	var raw sql.NullString
+	err := s.db.QueryRowContext(ctx, `
+		SELECT settings->'retentionLastRun' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to get retention status: %w", err)
+	}
+	if raw.Valid && raw.String != "" && raw.String != "null" {
+		var lastRun worker.RetentionRunResult
+		if json.Unmarshal([]byte(raw.String), &lastRun) == nil {
+			settings.LastRun = &lastRun
+		}
+	}
+
+	return settings, nil
+}
+
+// UpdateRetentionPolicy updates the organization's retention policy
+func (s *SettingsService) UpdateRetentionPolicy(ctx context.Context, orgID int64, req *UpdateRetentionPolicyRequest) (*RetentionSettings, error) {
+	policy := retention.Load(ctx, s.db, orgID)
+	if req.StripContentAfterDays != nil {
+		policy.StripContentAfterDays = *req.StripContentAfterDays
+	}
+	if req.DeleteAfterDays != nil {
+		policy.DeleteAfterDays = *req.DeleteAfterDays
+	}
+	if req.ExportURL != nil {
+		policy.ExportURL = *req.ExportURL
+	}
+	// The masked value returned by GetRetentionPolicy leaves the stored secret unchanged
+	if req.ExportSecret != nil && *req.ExportSecret != maskedSecret {
+		policy.ExportSecret = *req.ExportSecret
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "retention", policy); err != nil {
+		return nil, err
+	}
+
+	return s.GetRetentionPolicy(ctx, orgID)
+}
+
+// UpdateSenderRotationRequest replaces the org's sender rotation pools
+type UpdateSenderRotationRequest struct {
+	Pools []rotation.Pool `json:"pools"`
+}
+
+// SenderRotationMember is a pool member with its volume so far today
+type SenderRotationMember struct {
+	rotation.Member
+	SentToday int  `json:"sentToday"`
+	Capped    bool `json:"capped"` // Reached its daily cap, skipped until tomorrow (UTC)
+}
+
+// SenderRotationPool is a rotation pool with per-member volume
+type SenderRotationPool struct {
+	Name     string                 `json:"name"`
+	Strategy string                 `json:"strategy"`
+	Members  []SenderRotationMember `json:"members"`
+}
+
+// SenderRotationSettings lists the org's rotation pools
+type SenderRotationSettings struct {
+	Pools []SenderRotationPool `json:"pools"`
+}
+
+// GetSenderRotation returns the organization's sender rotation pools with today's volume per identity
+func (s *SettingsService) GetSenderRotation(ctx context.Context, orgID int64) (*SenderRotationSettings, error) {
+	policy := rotation.Load(ctx, s.db, orgID)
+	settings := &SenderRotationSettings{Pools: []SenderRotationPool{}}
+
+	for _, pool := range policy.Pools {
+		sentToday, err := worker.SentTodayBySender(ctx, s.db, orgID, pool.Addresses())
+		if err != nil {
+			return nil, fmt.Errorf("failed to count sender volume: %w", err)
+		}
+
+		status := SenderRotationPool{Name: pool.Name, Strategy: pool.Strategy, Members: []SenderRotationMember{}}
+		for _, m := range pool.Members {
+			sent := sentToday[strings.ToLower(m.From)]
+			status.Members = append(status.Members, SenderRotationMember{
+				Member:    m,
+				SentToday: sent,
+				Capped:    m.DailyCap > 0 && sent >= m.DailyCap,
+			})
+		}
+		settings.Pools = append(settings.Pools, status)
+	}
+
+	return settings, nil
+}
+
+// UpdateSenderRotation replaces the organization's sender rotation pools. Every member
+// must send from an active domain of the organization.
+func (s *SettingsService) UpdateSenderRotation(ctx context.Context, orgID int64, req *UpdateSenderRotationRequest) (*SenderRotationSettings, error) {
+	policy := rotation.Policy{Pools: req.Pools}
+	for i := range policy.Pools {
+		policy.Pools[i].Name = strings.TrimSpace(policy.Pools[i].Name)
+		for j := range policy.Pools[i].Members {
+			policy.Pools[i].Members[j].From = strings.ToLower(strings.TrimSpace(policy.Pools[i].Members[j].From))
+		}
+	}
+
+	if err := policy.Validate(); err != nil {
+		return nil, err
+	}
+
+	for _, pool := range policy.Pools {
+		for _, m := range pool.Members {
+			var status string
+			err := s.db.QueryRowContext(ctx, `
+				SELECT status FROM domains WHERE name = $1 AND org_id = $2
+			`, extractDomain(m.From), orgID).Scan(&status)
+			if err == sql.ErrNoRows || (err == nil && status != "active") {
+				return nil, fmt.Errorf("pool %q: %s is not on an active domain of your organization", pool.Name, m.From)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("failed to verify sender domain: %w", err)
+			}
+		}
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "senderRotation", policy); err != nil {
+		return nil, err
+	}
+
+	return s.GetSenderRotation(ctx, orgID)
+}
+
+// UpdateContentGuardRequest for updating the org's send-time content guard
+type UpdateContentGuardRequest struct {
+	Mode               *string  `json:"mode"` // off, warn, block
+	MaxSpamScore       *float64 `json:"maxSpamScore"`
+	CheckLinks         *bool    `json:"checkLinks"`
+	RequireUnsubscribe *bool    `json:"requireUnsubscribe"`
+	MinTextPerImage    *int     `json:"minTextPerImage"`
+}
+
+// GetContentGuard returns the organization's send-time content guard policy
+func (s *SettingsService) GetContentGuard(ctx context.Context, orgID int64) (contentguard.Policy, error) {
+	return contentguard.Load(ctx, s.db, orgID), nil
+}
+
+// UpdateContentGuard updates the organization's send-time content guard policy
+func (s *SettingsService) UpdateContentGuard(ctx context.Context, orgID int64, req *UpdateContentGuardRequest) (contentguard.Policy, error) {
+	policy := contentguard.Load(ctx, s.db, orgID)
+	if req.Mode != nil {
+		policy.Mode = *req.Mode
+	}
+	if req.MaxSpamScore != nil {
+		policy.MaxSpamScore = *req.MaxSpamScore
+	}
+	if req.CheckLinks != nil {
+		policy.CheckLinks = *req.CheckLinks
+	}
+	if req.RequireUnsubscribe != nil {
+		policy.RequireUnsubscribe = *req.RequireUnsubscribe
+	}
+	if req.MinTextPerImage != nil {
+		policy.MinTextPerImage = *req.MinTextPerImage
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+	if policy.MaxSpamScore > 0 && s.cfg.RspamdURL == "" && s.cfg.SpamdAddr == "" {
+		return policy, fmt.Errorf("spam scoring is not available: no rspamd or spamd scanner is configured")
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "contentGuard", policy); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// UpdateOutboundRulesRequest for updating the org's rules for emails composed
+// in the inbox. Fields left out keep their value.
+type UpdateOutboundRulesRequest struct {
+	Rules           *[]outboundrules.Rule     `json:"rules"`
+	ConfirmExternal *bool                     `json:"confirmExternal"`
+	Disclaimer      *outboundrules.Disclaimer `json:"disclaimer"`
+}
+
+// GetOutboundRules returns the organization's rules for emails composed in the
+// inbox
+func (s *SettingsService) GetOutboundRules(ctx context.Context, orgID int64) (outboundrules.Policy, error) {
+	return outboundrules.Load(ctx, s.db, orgID), nil
+}
+
+// UpdateOutboundRules updates the organization's rules for emails composed in
+// the inbox
+func (s *SettingsService) UpdateOutboundRules(ctx context.Context, orgID int64, req *UpdateOutboundRulesRequest) (outboundrules.Policy, error) {
+	policy := outboundrules.Load(ctx, s.db, orgID)
+	if req.Rules != nil {
+		policy.Rules = *req.Rules
+	}
+	if req.ConfirmExternal != nil {
+		policy.ConfirmExternal = *req.ConfirmExternal
+	}
+	if req.Disclaimer != nil {
+		policy.Disclaimer = *req.Disclaimer
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "outboundRules", policy); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// setOrgSetting stores a value under a top-level key of organizations.settings
+func (s *SettingsService) setOrgSetting(ctx context.Context, orgID int64, key string, value any) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return fmt.Errorf("failed to encode setting: %w", err)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE organizations
+		SET settings = jsonb_set(COALESCE(settings, '{}'::jsonb), ARRAY[$2::text], $3::jsonb, true),
+			updated_at = NOW()
+		WHERE id = $1
+	`, orgID, key, string(data))
+	if err != nil {
+		return fmt.Errorf("failed to update organization settings: %w", err)
+	}
+
+	return nil
+}
+
+// UpdateBackupPolicyRequest for updating the org's scheduled contact backups
+type UpdateBackupPolicyRequest struct {
+	Enabled       *bool `json:"enabled"`
+	RetentionDays *int  `json:"retentionDays"`
+}
+
+// GetBackupPolicy returns the organization's scheduled backup policy
+func (s *SettingsService) GetBackupPolicy(ctx context.Context, orgID int64) (backup.Policy, error) {
+	return backup.Load(ctx, s.db, orgID), nil
+}
+
+// UpdateBackupPolicy updates the organization's scheduled backup policy
+func (s *SettingsService) UpdateBackupPolicy(ctx context.Context, orgID int64, req *UpdateBackupPolicyRequest) (backup.Policy, error) {
+	policy := backup.Load(ctx, s.db, orgID)
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.RetentionDays != nil {
+		policy.RetentionDays = *req.RetentionDays
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+	if policy.Enabled && (s.cfg.BackupsBucket == "" || worker.BackupKey(s.cfg) == "") {
+		return policy, fmt.Errorf("backup storage is not configured")
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "backups", policy); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// UpdateListHygieneRequest for updating the org's list hygiene policy
+type UpdateListHygieneRequest struct {
+	Enabled                 *bool `json:"enabled"`
+	StaleDays               *int  `json:"staleDays"`
+	RecheckDays             *int  `json:"recheckDays"`
+	BatchSize               *int  `json:"batchSize"`
+	QuarantineUndeliverable *bool `json:"quarantineUndeliverable"`
+	QuarantineRisky         *bool `json:"quarantineRisky"`
+}
+
+// GetListHygiene returns the organization's list hygiene policy
+func (s *SettingsService) GetListHygiene(ctx context.Context, orgID int64) (hygiene.Policy, error) {
+	return hygiene.Load(ctx, s.db, orgID), nil
+}
+
+// UpdateListHygiene updates which stale contacts are re-verified and which
+// verdicts quarantine them
+func (s *SettingsService) UpdateListHygiene(ctx context.Context, orgID int64, req *UpdateListHygieneRequest) (hygiene.Policy, error) {
+	policy := hygiene.Load(ctx, s.db, orgID)
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.StaleDays != nil {
+		policy.StaleDays = *req.StaleDays
+	}
+	if req.RecheckDays != nil {
+		policy.RecheckDays = *req.RecheckDays
+	}
+	if req.BatchSize != nil {
+		policy.BatchSize = *req.BatchSize
+	}
+	if req.QuarantineUndeliverable != nil {
+		policy.QuarantineUndeliverable = *req.QuarantineUndeliverable
+	}
+	if req.QuarantineRisky != nil {
+		policy.QuarantineRisky = *req.QuarantineRisky
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "listHygiene", policy); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// UpdateSendingWindowRequest for updating the org's sending window
+type UpdateSendingWindowRequest struct {
+	Enabled  *bool   `json:"enabled"`
+	Start    *string `json:"start"`
+	End      *string `json:"end"`
+	Days     *[]int  `json:"days"`
+	Timezone *string `json:"timezone"`
+}
+
+// GetSendingWindow returns the organization's sending window
+func (s *SettingsService) GetSendingWindow(ctx context.Context, orgID int64) (sendwindow.Policy, error) {
+	return sendwindow.Load(ctx, s.db, orgID), nil
+}
+
+// UpdateSendingWindow updates the window scheduled and campaign sends are held to
+func (s *SettingsService) UpdateSendingWindow(ctx context.Context, orgID int64, req *UpdateSendingWindowRequest) (sendwindow.Policy, error) {
+	policy := sendwindow.Load(ctx, s.db, orgID)
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.Start != nil {
+		policy.Start = *req.Start
+	}
+	if req.End != nil {
+		policy.End = *req.End
+	}
+	if req.Days != nil {
+		policy.Days = *req.Days
+	}
+	if req.Timezone != nil {
+		policy.Timezone = *req.Timezone
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "sendingWindow", policy); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// UpdateCampaignSendRateRequest for updating how fast the org's campaigns send
+type UpdateCampaignSendRateRequest struct {
+	PerHour          *int            `json:"perHour"`
+	PerDomainPerHour *int            `json:"perDomainPerHour"`
+	Domains          *map[string]int `json:"domains"`
+}
+
+// GetCampaignSendRate returns the organization's campaign send rate
+func (s *SettingsService) GetCampaignSendRate(ctx context.Context, orgID int64) (sendrate.Policy, error) {
+	return sendrate.Load(ctx, s.db, orgID), nil
+}
+
+// UpdateCampaignSendRate updates the hourly limits campaigns are dispatched under
+func (s *SettingsService) UpdateCampaignSendRate(ctx context.Context, orgID int64, req *UpdateCampaignSendRateRequest) (sendrate.Policy, error) {
+	policy := sendrate.Load(ctx, s.db, orgID)
+	if req.PerHour != nil {
+		policy.PerHour = *req.PerHour
+	}
+	if req.PerDomainPerHour != nil {
+		policy.PerDomainPerHour = *req.PerDomainPerHour
+	}
+	if req.Domains != nil {
+		policy.Domains = *req.Domains
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "campaignSendRate", policy); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// UpdateDomainWarmupRequest for updating how new sending domains ramp up
+type UpdateDomainWarmupRequest struct {
+	Enabled       *bool   `json:"enabled"`
+	NewDomainDays *int    `json:"newDomainDays"`
+	Schedule      *string `json:"schedule"`
+}
+
+// GetDomainWarmup returns the organization's warmup of new sending domains
+func (s *SettingsService) GetDomainWarmup(ctx context.Context, orgID int64) (warmup.DomainPolicy, error) {
+	return warmup.LoadDomainPolicy(ctx, s.db, orgID), nil
+}
+
+// UpdateDomainWarmup updates how campaigns from new sending domains are spread
+// over days
+func (s *SettingsService) UpdateDomainWarmup(ctx context.Context, orgID int64, req *UpdateDomainWarmupRequest) (warmup.DomainPolicy, error) {
+	policy := warmup.LoadDomainPolicy(ctx, s.db, orgID)
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.NewDomainDays != nil {
+		policy.NewDomainDays = *req.NewDomainDays
+	}
+	if req.Schedule != nil {
+		policy.Schedule = *req.Schedule
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "domainWarmup", policy); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// UpdateCampaignUTMRequest for updating how campaign links are tagged with UTM
+// parameters
+type UpdateCampaignUTMRequest struct {
+	Enabled  *bool   `json:"enabled"`
+	Source   *string `json:"source"`
+	Medium   *string `json:"medium"`
+	Campaign *string `json:"campaign"`
+}
+
+// GetCampaignUTM returns the organization's UTM tagging of campaign links
+func (s *SettingsService) GetCampaignUTM(ctx context.Context, orgID int64) (utm.Policy, error) {
+	return utm.Load(ctx, s.db, orgID), nil
+}
+
+// UpdateCampaignUTM updates the UTM parameters campaign links are tagged with
+func (s *SettingsService) UpdateCampaignUTM(ctx context.Context, orgID int64, req *UpdateCampaignUTMRequest) (utm.Policy, error) {
+	policy := utm.Load(ctx, s.db, orgID)
+	if req.Enabled != nil {
+		policy.Enabled = *req.Enabled
+	}
+	if req.Source != nil {
+		policy.Source = strings.TrimSpace(*req.Source)
+	}
+	if req.Medium != nil {
+		policy.Medium = strings.TrimSpace(*req.Medium)
+	}
+	if req.Campaign != nil {
+		policy.Campaign = strings.TrimSpace(*req.Campaign)
+	}
+
+	if err := policy.Validate(); err != nil {
+		return policy, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "campaignUtm", policy); err != nil {
+		return policy, err
+	}
+
+	return policy, nil
+}
+
+// UpdateInboxPreviewRequest for updating the service campaign inbox previews are
+// rendered by. An empty URL removes it.
+type UpdateInboxPreviewRequest struct {
+	URL     *string  `json:"url"`
+	APIKey  *string  `json:"apiKey"`
+	Clients []string `json:"clients"` // Replaces the default clients when set
+}
+
+// GetInboxPreview returns the organization's inbox preview service. The API key is masked.
+func (s *SettingsService) GetInboxPreview(ctx context.Context, orgID int64) (inboxpreview.Service, error) {
+	service := inboxpreview.Load(ctx, s.db, orgID)
+	if service.APIKey != "" {
+		service.APIKey = maskedSecret
+	}
+	return service, nil
+}
+
+// UpdateInboxPreview updates the organization's inbox preview service
+func (s *SettingsService) UpdateInboxPreview(ctx context.Context, orgID int64, req *UpdateInboxPreviewRequest) (inboxpreview.Service, error) {
+	service := inboxpreview.Load(ctx, s.db, orgID)
+	if req.URL != nil {
+		service.URL = strings.TrimSpace(*req.URL)
+	}
+	// The masked value returned by GetInboxPreview leaves the stored key unchanged
+	if req.APIKey != nil && *req.APIKey != maskedSecret {
+		service.APIKey = *req.APIKey
+	}
+	if req.Clients != nil {
+		service.Clients = req.Clients
+	}
+
+	if err := service.Validate(); err != nil {
+		return service, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "inboxPreview", service); err != nil {
+		return service, err
+	}
+
+	return s.GetInboxPreview(ctx, orgID)
+}
+
+// UpdateEventExportBucketRequest for updating the bucket delivery event exports are
+// written to. An empty bucket removes it.
+type UpdateEventExportBucketRequest struct {
+	Bucket          *string `json:"bucket"`
+	Region          *string `json:"region"`
+	Prefix          *string `json:"prefix"`
+	AccessKeyID     *string `json:"accessKeyId"`
+	SecretAccessKey *string `json:"secretAccessKey"`
+}
+
+// GetEventExportBucket returns the organization's export bucket without its secret
+func (s *SettingsService) GetEventExportBucket(ctx context.Context, orgID int64) (eventexport.Bucket, error) {
+	bucket := eventexport.Load(ctx, s.db, orgID)
+	bucket.SecretAccessKey = ""
+	return bucket, nil
+}
+
+// UpdateEventExportBucket updates the bucket delivery event exports can be written to
+func (s *SettingsService) UpdateEventExportBucket(ctx context.Context, orgID int64, req *UpdateEventExportBucketRequest) (eventexport.Bucket, error) {
+	bucket := eventexport.Load(ctx, s.db, orgID)
+	if req.Bucket != nil {
+		bucket.Bucket = strings.TrimSpace(*req.Bucket)
+	}
+	if req.Region != nil {
+		bucket.Region = strings.TrimSpace(*req.Region)
+	}
+	if req.Prefix != nil {
+		bucket.Prefix = strings.TrimSpace(*req.Prefix)
+	}
+	if req.AccessKeyID != nil {
+		bucket.AccessKeyID = strings.TrimSpace(*req.AccessKeyID)
+	}
+	if req.SecretAccessKey != nil && *req.SecretAccessKey != "" {
+		encrypted, err := crypto.Encrypt(*req.SecretAccessKey, s.cfg.EncryptionKey)
+		if err != nil {
+			return eventexport.Bucket{}, fmt.Errorf("failed to encrypt secret access key: %w", err)
+		}
+		bucket.SecretAccessKey = encrypted
+		bucket.HasSecret = true
+	}
+	if bucket.Bucket == "" {
+		bucket = eventexport.Bucket{}
+	}
+
+	if err := bucket.Validate(); err != nil {
+		return eventexport.Bucket{}, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "eventExportBucket", bucket); err != nil {
+		return eventexport.Bucket{}, err
+	}
+
+	bucket.SecretAccessKey = ""
+	return bucket, nil
+}
+
+// UpdateMailAssistRequest for updating the provider emails are summarized and
+// translated with. An empty provider removes it.
+type UpdateMailAssistRequest struct {
+	Provider *string `json:"provider"`
+	Model    *string `json:"model"`
+	BaseURL  *string `json:"baseUrl"`
+	APIKey   *string `json:"apiKey"`
+}
+
+// GetMailAssist returns the organization's summary and translation provider
+// without its API key
+func (s *SettingsService) GetMailAssist(ctx context.Context, orgID int64) (mailassist.Config, error) {
+	config := mailassist.Load(ctx, s.db, orgID)
+	config.APIKey = ""
+	return config, nil
+}
+
+// UpdateMailAssist updates the provider emails are summarized and translated with
+func (s *SettingsService) UpdateMailAssist(ctx context.Context, orgID int64, req *UpdateMailAssistRequest) (mailassist.Config, error) {
+	config := mailassist.Load(ctx, s.db, orgID)
+	if req.Provider != nil {
+		provider := strings.ToLower(strings.TrimSpace(*req.Provider))
+		if provider != config.Provider {
+			// A key is only good for the provider it was issued by
+			config = mailassist.Config{Provider: provider}
+		}
+	}
+	if req.Model != nil {
+		config.Model = strings.TrimSpace(*req.Model)
+	}
+	if req.BaseURL != nil {
+		config.BaseURL = strings.TrimSpace(*req.BaseURL)
+	}
+	if req.APIKey != nil && *req.APIKey != "" {
+		encrypted, err := crypto.Encrypt(strings.TrimSpace(*req.APIKey), s.cfg.EncryptionKey)
+		if err != nil {
+			return mailassist.Config{}, fmt.Errorf("failed to encrypt API key: %w", err)
+		}
+		config.APIKey = encrypted
+		config.HasKey = true
+	}
+	if config.Provider == "" {
+		config = mailassist.Config{}
+	}
+
+	if err := config.Validate(); err != nil {
+		return mailassist.Config{}, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "mailAssist", config); err != nil {
+		return mailassist.Config{}, err
+	}
+
+	config.APIKey = ""
+	return config, nil
+}
+
+// UpdateTestRecipientsRequest replaces the extra addresses template test sends may go to
+type UpdateTestRecipientsRequest struct {
+	Addresses []string `json:"addresses"`
+}
+
+// TestRecipientSettings lists the addresses template test sends may go to besides
+// the org's members
+type TestRecipientSettings struct {
+	Addresses []string `json:"addresses"`
+}
+
+// GetTestRecipients returns the organization's allowlisted test addresses
+func (s *SettingsService) GetTestRecipients(ctx context.Context, orgID int64) (*TestRecipientSettings, error) {
+	return &TestRecipientSettings{Addresses: loadTestRecipients(ctx, s.db, orgID)}, nil
+}
+
+// UpdateTestRecipients replaces the organization's allowlisted test addresses
+func (s *SettingsService) UpdateTestRecipients(ctx context.Context, orgID int64, req *UpdateTestRecipientsRequest) (*TestRecipientSettings, error) {
+	addresses := []string{}
+	seen := map[string]bool{}
+	for _, address := range req.Addresses {
+		address = strings.ToLower(strings.TrimSpace(address))
+		if address == "" || seen[address] {
+			continue
+		}
+		if _, err := mail.ParseAddress(address); err != nil {
+			return nil, fmt.Errorf("invalid address %q", address)
+		}
+		seen[address] = true
+		addresses = append(addresses, address)
+	}
+	if len(addresses) > maxTestRecipients {
+		return nil, fmt.Errorf("at most %d test addresses can be allowlisted", maxTestRecipients)
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "testRecipients", addresses); err != nil {
+		return nil, err
+	}
+
+	return &TestRecipientSettings{Addresses: addresses}, nil
+}
+
+// UpdatePreferenceCenterRequest for updating the org's hosted preference center
+type UpdatePreferenceCenterRequest struct {
+	ProfileFields *[]string `json:"profileFields"`
+}
+
+// GetPreferenceCenter returns the organization's preference center settings
+func (s *SettingsService) GetPreferenceCenter(ctx context.Context, orgID int64) (prefcenter.Settings, error) {
+	return prefcenter.Load(ctx, s.db, orgID), nil
+}
+
+// UpdatePreferenceCenter updates the profile fields contacts can edit on the
+// hosted preference center
+func (s *SettingsService) UpdatePreferenceCenter(ctx context.Context, orgID int64, req *UpdatePreferenceCenterRequest) (prefcenter.Settings, error) {
+	settings := prefcenter.Load(ctx, s.db, orgID)
+	if req.ProfileFields != nil {
+		settings.ProfileFields = *req.ProfileFields
+	}
+
+	fields, err := contactfield.Load(ctx, s.db, orgID)
+	if err != nil {
+		return settings, err
+	}
+	if err := settings.Validate(fields); err != nil {
+		return settings, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "preferenceCenter", settings); err != nil {
+		return settings, err
+	}
+
+	return settings, nil
+}
+
+// UpdateAutomationLimitsRequest for updating the org's limits on automations
+type UpdateAutomationLimitsRequest struct {
+	MaxActivePerContact *int `json:"maxActivePerContact"`
+}
+
+// GetAutomationLimits returns the organization's limits on how many automations
+// a contact can be in
+func (s *SettingsService) GetAutomationLimits(ctx context.Context, orgID int64) (automationtrigger.Limits, error) {
+	return automationtrigger.LoadLimits(ctx, s.db, orgID), nil
+}
+
+// UpdateAutomationLimits updates how many automations a contact can be in at
+// once. Contacts already in more aren't taken out of any.
+func (s *SettingsService) UpdateAutomationLimits(ctx context.Context, orgID int64, req *UpdateAutomationLimitsRequest) (automationtrigger.Limits, error) {
+	limits := automationtrigger.LoadLimits(ctx, s.db, orgID)
+	if req.MaxActivePerContact != nil {
+		limits.MaxActivePerContact = *req.MaxActivePerContact
+	}
+
+	if err := limits.Validate(); err != nil {
+		return limits, err
+	}
+
+	if err := s.setOrgSetting(ctx, orgID, "automationLimits", limits); err != nil {
+		return limits, err
+	}
+
+	return limits, nil
+}
@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// A shared mailbox's emails are those received at the identity with its
+// address. Its members who can read see them with their own received emails,
+// and work them as a light help desk: an email can be assigned to a member,
+// closed once handled and reopened, and carry internal notes its sender never
+// sees. An email nobody has acted on yet is open and unassigned.
+
+// Shared mailbox message statuses
+const (
+	SharedMessageOpen   = "open"
+	SharedMessageClosed = "closed"
+)
+
+// SharedMailboxMessage is an email received at a shared mailbox, with its help
+// desk state
+type SharedMailboxMessage struct {
+	ID             string     `json:"id"` // The received email's UUID
+	FromEmail      string     `json:"fromEmail"`
+	FromName       string     `json:"fromName,omitempty"`
+	Subject        string     `json:"subject"`
+	Snippet        string     `json:"snippet,omitempty"`
+	HasAttachments bool       `json:"hasAttachments"`
+	IsRead         bool       `json:"isRead"`
+	ReceivedAt     time.Time  `json:"receivedAt"`
+	Status         string     `json:"status"` // open, closed
+	AssignedTo     *int       `json:"assignedTo,omitempty"`
+	AssigneeEmail  string     `json:"assigneeEmail,omitempty"`
+	AssigneeName   string     `json:"assigneeName,omitempty"`
+	AssignedAt     *time.Time `json:"assignedAt,omitempty"`
+	ClosedAt       *time.Time `json:"closedAt,omitempty"`
+	NoteCount      int        `json:"noteCount"`
+}
+
+// SharedMailboxMessageList is a page of a shared mailbox's emails
+type SharedMailboxMessageList struct {
+	Messages []*SharedMailboxMessage `json:"messages"`
+	Total    int                     `json:"total"`
+	Page     int                     `json:"page"`
+	PageSize int                     `json:"pageSize"`
+}
+
+// SharedMailboxNote is an internal note on an email of a shared mailbox
+type SharedMailboxNote struct {
+	ID        string    `json:"id"`
+	UserID    int       `json:"userId"`
+	UserEmail string    `json:"userEmail,omitempty"`
+	UserName  string    `json:"userName,omitempty"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+	UpdatedAt time.Time `json:"updatedAt"`
+}
+
+// ListSharedMessagesInput filters a shared mailbox's emails
+type ListSharedMessagesInput struct {
+	Status   string `json:"status"`   // open, closed; both when empty
+	Assignee string `json:"assignee"` // me, unassigned or a user ID; anyone when empty
+	Page     int    `json:"page" d:"1"`
+	PageSize int    `json:"pageSize" d:"50"`
+}
+
+// AssignMessageInput is the input for assigning an email; a user ID of 0
+// unassigns it
+type AssignMessageInput struct {
+	UserID int `json:"userId"`
+}
+
+// SetMessageStatusInput is the input for closing or reopening an email
+type SetMessageStatusInput struct {
+	Status string `json:"status" v:"required|in:open,closed"`
+}
+
+// AddNoteInput is the input for adding a note to an email
+type AddNoteInput struct {
+	Body string `json:"body" v:"required"`
+}
+
+// receivedEmailAccess is the condition on received_emails re joined with
+// identities i that selects the emails of the user in placeholder userArg:
+// those of their own identities and those of the shared mailboxes they can read
+func receivedEmailAccess(userArg string) string {
+	return `(i.user_id = ` + userArg + ` OR (re.org_id, LOWER(i.email)) IN (
+		SELECT sm.org_id, LOWER(sm.email) FROM shared_mailboxes sm
+		JOIN shared_mailbox_members smm ON smm.shared_mailbox_id = sm.id
+		WHERE smm.user_id = ` + userArg + ` AND smm.can_read = true
+	))`
+}
+
+// sharedMessagesFrom joins a shared mailbox, sm, with its emails, re, and
+// their help desk state, m, and assignee, u
+const sharedMessagesFrom = `
+	FROM shared_mailboxes sm
+	JOIN identities i ON LOWER(i.email) = LOWER(sm.email)
+	JOIN received_emails re ON re.identity_id = i.id AND re.org_id = sm.org_id
+	LEFT JOIN shared_mailbox_messages m ON m.received_email_id = re.id
+	LEFT JOIN users u ON u.id = m.assigned_to`
+
+// sharedMessageColumns are the columns scanned by scanSharedMessage
+const sharedMessageColumns = `re.uuid, re.from_email, COALESCE(re.from_name, ''), re.subject, COALESCE(re.snippet, ''),
+	re.has_attachments, re.is_read, re.received_at, COALESCE(m.status, 'open'), m.assigned_to,
+	COALESCE(u.email, ''), COALESCE(u.name, ''), m.assigned_at, m.closed_at,
+	(SELECT COUNT(*) FROM shared_mailbox_notes n WHERE n.received_email_id = re.id)`
+
+// scanSharedMessage scans a row of sharedMessageColumns
+func scanSharedMessage(row interface{ Scan(...interface{}) error }) (*SharedMailboxMessage, error) {
+	var m SharedMailboxMessage
+	var assignedTo sql.NullInt64
+	var assignedAt, closedAt sql.NullTime
+	err := row.Scan(&m.ID, &m.FromEmail, &m.FromName, &m.Subject, &m.Snippet,
+		&m.HasAttachments, &m.IsRead, &m.ReceivedAt, &m.Status, &assignedTo,
+		&m.AssigneeEmail, &m.AssigneeName, &assignedAt, &closedAt, &m.NoteCount)
+	if err != nil {
+		return nil, err
+	}
+	if assignedTo.Valid {
+		id := int(assignedTo.Int64)
+		m.AssignedTo = &id
+	}
+	if assignedAt.Valid {
+		m.AssignedAt = &assignedAt.Time
+	}
+	if closedAt.Valid {
+		m.ClosedAt = &closedAt.Time
+	}
+	return &m, nil
+}
+
+// requireReader checks the user is a member of the shared mailbox who can
+// read it, and returns whether they can manage it
+func (s *SharedMailboxService) requireReader(ctx context.Context, userID int64, mailboxID int) (bool, error) {
+	canRead, _, canManage, err := s.HasAccess(ctx, userID, mailboxID)
+	if err != nil {
+		return false, fmt.Errorf("failed to check access: %w", err)
+	}
+	if !canRead {
+		return false, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "shared mailbox not found")
+	}
+	return canManage, nil
+}
+
+// sharedMessageID resolves an email of a shared mailbox from its UUID
+func (s *SharedMailboxService) sharedMessageID(ctx context.Context, mailboxID int, emailUUID string) (int64, error) {
+	var emailID int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT re.id `+sharedMessagesFrom+`
+		WHERE sm.id = $1 AND re.uuid::text = $2
+	`, mailboxID, emailUUID).Scan(&emailID)
+	if err == sql.ErrNoRows {
+		return 0, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "email not found")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get email: %w", err)
+	}
+	return emailID, nil
+}
+
+// getSharedMessage returns an email of a shared mailbox by ID
+func (s *SharedMailboxService) getSharedMessage(ctx context.Context, mailboxID int, emailID int64) (*SharedMailboxMessage, error) {
+	m, err := scanSharedMessage(s.db.QueryRowContext(ctx, `
+		SELECT `+sharedMessageColumns+sharedMessagesFrom+`
+		WHERE sm.id = $1 AND re.id = $2
+	`, mailboxID, emailID))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get email: %w", err)
+	}
+	return m, nil
+}
+
+// ListMessages returns a page of a shared mailbox's emails, newest first.
+// Trashed and spam emails are left out.
+func (s *SharedMailboxService) ListMessages(ctx context.Context, userID int64, mailboxID int, input *ListSharedMessagesInput) (*SharedMailboxMessageList, error) {
+	if _, err := s.requireReader(ctx, userID, mailboxID); err != nil {
+		return nil, err
+	}
+
+	where := ` WHERE sm.id = $1 AND re.is_trashed = false AND re.is_spam = false`
+	args := []interface{}{mailboxID}
+
+	switch input.Status {
+	case "":
+	case SharedMessageOpen, SharedMessageClosed:
+		args = append(args, input.Status)
+		where += fmt.Sprintf(" AND COALESCE(m.status, 'open') = $%d", len(args))
+	default:
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "status must be open or closed")
+	}
+
+	switch input.Assignee {
+	case "":
+	case "me":
+		args = append(args, userID)
+		where += fmt.Sprintf(" AND m.assigned_to = $%d", len(args))
+	case "unassigned":
+		where += " AND m.assigned_to IS NULL"
+	default:
+		assignee, err := strconv.Atoi(input.Assignee)
+		if err != nil {
+			return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "assignee must be me, unassigned or a user ID")
+		}
+		args = append(args, assignee)
+		where += fmt.Sprintf(" AND m.assigned_to = $%d", len(args))
+	}
+
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) `+sharedMessagesFrom+where, args...).Scan(&total); err != nil {
+		return nil, fmt.Errorf("failed to count emails: %w", err)
+	}
+
+	page := max(input.Page, 1)
+	pageSize := input.PageSize
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 50
+	}
+	rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT `+sharedMessageColumns+sharedMessagesFrom+where+`
+		ORDER BY re.received_at DESC
+		LIMIT %d OFFSET %d
+	`, pageSize, (page-1)*pageSize), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list emails: %w", err)
+	}
+	defer rows.Close()
+
+	list := &SharedMailboxMessageList{Messages: []*SharedMailboxMessage{}, Total: total, Page: page, PageSize: pageSize}
+	for rows.Next() {
+		m, err := scanSharedMessage(rows)
+		if err != nil {
+			continue
+		}
+		list.Messages = append(list.Messages, m)
+	}
+	return list, nil
+}
+
+// AssignMessage assigns an email of a shared mailbox to one of its members who
+// can read it, or unassigns it
+func (s *SharedMailboxService) AssignMessage(ctx context.Context, userID int64, mailboxID int, emailUUID string, input *AssignMessageInput) (*SharedMailboxMessage, error) {
+	if _, err := s.requireReader(ctx, userID, mailboxID); err != nil {
+		return nil, err
+	}
+	emailID, err := s.sharedMessageID(ctx, mailboxID, emailUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if input.UserID != 0 {
+		canRead, _, _, err := s.HasAccess(ctx, int64(input.UserID), mailboxID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check assignee: %w", err)
+		}
+		if !canRead {
+			return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "emails can only be assigned to members who can read the mailbox")
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO shared_mailbox_messages (shared_mailbox_id, received_email_id, assigned_to, assigned_by, assigned_at)
+		VALUES ($1, $2, NULLIF($3, 0), $4, CASE WHEN $3 = 0 THEN NULL ELSE NOW() END)
+		ON CONFLICT (received_email_id) DO UPDATE
+		SET assigned_to = EXCLUDED.assigned_to, assigned_by = EXCLUDED.assigned_by,
+		    assigned_at = EXCLUDED.assigned_at, updated_at = NOW()
+	`, mailboxID, emailID, input.UserID, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to assign email: %w", err)
+	}
+
+	return s.getSharedMessage(ctx, mailboxID, emailID)
+}
+
+// SetMessageStatus closes or reopens an email of a shared mailbox
+func (s *SharedMailboxService) SetMessageStatus(ctx context.Context, userID int64, mailboxID int, emailUUID string, input *SetMessageStatusInput) (*SharedMailboxMessage, error) {
+	if input.Status != SharedMessageOpen && input.Status != SharedMessageClosed {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "status must be open or closed")
+	}
+	if _, err := s.requireReader(ctx, userID, mailboxID); err != nil {
+		return nil, err
+	}
+	emailID, err := s.sharedMessageID(ctx, mailboxID, emailUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO shared_mailbox_messages (shared_mailbox_id, received_email_id, status, closed_by, closed_at)
+		VALUES ($1, $2, $3, CASE WHEN $3 = 'closed' THEN $4::int END, CASE WHEN $3 = 'closed' THEN NOW() END)
+		ON CONFLICT (received_email_id) DO UPDATE
+		SET status = EXCLUDED.status, closed_by = EXCLUDED.closed_by, closed_at = EXCLUDED.closed_at, updated_at = NOW()
+	`, mailboxID, emailID, input.Status, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update email status: %w", err)
+	}
+
+	return s.getSharedMessage(ctx, mailboxID, emailID)
+}
+
+// ListNotes returns the internal notes on an email of a shared mailbox, oldest
+// first
+func (s *SharedMailboxService) ListNotes(ctx context.Context, userID int64, mailboxID int, emailUUID string) ([]*SharedMailboxNote, error) {
+	if _, err := s.requireReader(ctx, userID, mailboxID); err != nil {
+		return nil, err
+	}
+	emailID, err := s.sharedMessageID(ctx, mailboxID, emailUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT n.uuid, n.user_id, COALESCE(u.email, ''), COALESCE(u.name, ''), n.body, n.created_at, n.updated_at
+		FROM shared_mailbox_notes n
+		LEFT JOIN users u ON u.id = n.user_id
+		WHERE n.received_email_id = $1
+		ORDER BY n.created_at, n.id
+	`, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list notes: %w", err)
+	}
+	defer rows.Close()
+
+	notes := []*SharedMailboxNote{}
+	for rows.Next() {
+		var n SharedMailboxNote
+		if err := rows.Scan(&n.ID, &n.UserID, &n.UserEmail, &n.UserName, &n.Body, &n.CreatedAt, &n.UpdatedAt); err != nil {
+			continue
+		}
+		notes = append(notes, &n)
+	}
+	return notes, nil
+}
+
+// AddNote adds an internal note to an email of a shared mailbox
+func (s *SharedMailboxService) AddNote(ctx context.Context, userID int64, mailboxID int, emailUUID string, input *AddNoteInput) (*SharedMailboxNote, error) {
+	body := strings.TrimSpace(input.Body)
+	if body == "" {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "body is required")
+	}
+	if _, err := s.requireReader(ctx, userID, mailboxID); err != nil {
+		return nil, err
+	}
+	emailID, err := s.sharedMessageID(ctx, mailboxID, emailUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	var n SharedMailboxNote
+	err = s.db.QueryRowContext(ctx, `
+		WITH note AS (
+			INSERT INTO shared_mailbox_notes (shared_mailbox_id, received_email_id, user_id, body)
+			VALUES ($1, $2, $3, $4)
+			RETURNING uuid, user_id, body, created_at, updated_at
+		)
+		SELECT note.uuid, note.user_id, COALESCE(u.email, ''), COALESCE(u.name, ''), note.body, note.created_at, note.updated_at
+		FROM note LEFT JOIN users u ON u.id = note.user_id
+	`, mailboxID, emailID, userID, body).Scan(&n.ID, &n.UserID, &n.UserEmail, &n.UserName, &n.Body, &n.CreatedAt, &n.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to add note: %w", err)
+	}
+	return &n, nil
+}
+
+// DeleteNote removes a note from an email of a shared mailbox. Members delete
+// their own notes; those who manage the mailbox, anyone's.
+func (s *SharedMailboxService) DeleteNote(ctx context.Context, userID int64, mailboxID int, emailUUID, noteUUID string) error {
+	canManage, err := s.requireReader(ctx, userID, mailboxID)
+	if err != nil {
+		return err
+	}
+	emailID, err := s.sharedMessageID(ctx, mailboxID, emailUUID)
+	if err != nil {
+		return err
+	}
+
+	var authorID int64
+	err = s.db.QueryRowContext(ctx, `
+		SELECT user_id FROM shared_mailbox_notes WHERE uuid::text = $1 AND received_email_id = $2
+	`, noteUUID, emailID).Scan(&authorID)
+	if err == sql.ErrNoRows {
+		return apierror.New(http.StatusNotFound, apierror.CodeNotFound, "note not found")
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get note: %w", err)
+	}
+	if authorID != userID && !canManage {
+		return apierror.New(http.StatusForbidden, apierror.CodeForbidden, "only the note's author or a mailbox manager can delete it")
+	}
+
+	if _, err := s.db.ExecContext(ctx, `
+		DELETE FROM shared_mailbox_notes WHERE uuid::text = $1 AND received_email_id = $2
+	`, noteUUID, emailID); err != nil {
+		return fmt.Errorf("failed to delete note: %w", err)
+	}
+	return nil
+}
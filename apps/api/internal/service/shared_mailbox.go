@@ -4,6 +4,7 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/dublyo/mailat/api/internal/config"
@@ -70,6 +71,9 @@ func (s *SharedMailboxService) Create(ctx context.Context, orgID int64, input *C
 	if input.Email == "" {
 		return nil, fmt.Errorf("email is required")
 	}
+	// Its emails are those of the identity with the same address, which are
+	// stored lowercased
+	input.Email = strings.ToLower(strings.TrimSpace(input.Email))
 
 	var mailbox SharedMailbox
 	err := s.db.QueryRowContext(ctx, `
@@ -277,6 +281,13 @@ func (s *SharedMailboxService) RemoveMember(ctx context.Context, orgID int64, ma
 		return fmt.Errorf("member not found")
 	}
 
+	// Emails assigned to them go back to being unassigned
+	s.db.ExecContext(ctx, `
+		UPDATE shared_mailbox_messages
+		SET assigned_to = NULL, assigned_by = NULL, assigned_at = NULL, updated_at = NOW()
+		WHERE shared_mailbox_id = $1 AND assigned_to = $2
+	`, mailboxID, userID)
+
 	return nil
 }
 
@@ -0,0 +1,681 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/contactchange"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/listevent"
+	"github.com/dublyo/mailat/api/pkg/crypto"
+)
+
+// Signup forms let customers post HTML forms straight to mailat. A submission
+// creates or updates the contact, adds them to the form's lists and records
+// their consent with the address and browser it came from. Forms can be limited
+// to the sites that embed them, and are protected from bots by a rate limit per
+// IP address, an optional honeypot field and an optional Cloudflare Turnstile
+// challenge.
+
+const (
+	// defaultFormRateLimit is how many submissions an IP address can make to a
+	// form per hour, unless the form sets its own
+	defaultFormRateLimit = 10
+	maxFormRateLimit     = 1000
+	// maxFormEntries bounds a form's lists, fields and allowed origins
+	maxFormEntries = 50
+	// turnstileResponseField is the field the Turnstile widget submits its token in
+	turnstileResponseField = "cf-turnstile-response"
+	turnstileVerifyURL     = "https://challenges.cloudflare.com/turnstile/v0/siteverify"
+)
+
+// SignupFormService manages signup forms and takes their submissions
+type SignupFormService struct {
+	db                    *sql.DB
+	cfg                   *config.Config
+	redis                 *redis.Client
+	lists                 *ListService
+	httpClient            *http.Client
+	webhookTriggerService *WebhookTriggerService
+	transactionalService  *TransactionalService
+}
+
+// NewSignupFormService creates a new signup form service
+func NewSignupFormService(db *sql.DB, cfg *config.Config, redisClient *redis.Client) *SignupFormService {
+	return &SignupFormService{
+		db:         db,
+		cfg:        cfg,
+		redis:      redisClient,
+		lists:      NewListService(db, cfg),
+		httpClient: &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// SetWebhookTriggerService sets the webhook trigger service for firing events
+func (s *SignupFormService) SetWebhookTriggerService(svc *WebhookTriggerService) {
+	s.webhookTriggerService = svc
+}
+
+// SetTransactionalService sets the service double opt-in confirmation emails go out through
+func (s *SignupFormService) SetTransactionalService(svc *TransactionalService) {
+	s.transactionalService = svc
+}
+
+// signupForm is a form with what taking a submission needs
+type signupForm struct {
+	model.SignupForm
+	id              int
+	orgID           int64
+	listIDs         []int64
+	turnstileSecret string // Encrypted
+}
+
+const signupFormColumns = `
+	f.id, f.org_id, f.uuid, f.name, f.list_ids,
+	ARRAY(SELECT l.uuid::text FROM lists l WHERE l.id = ANY(f.list_ids) ORDER BY l.id),
+	COALESCE(f.fields, '{}'), COALESCE(f.allowed_origins, '{}'), COALESCE(f.honeypot_field, ''),
+	COALESCE(f.turnstile_secret, ''), COALESCE(f.redirect_url, ''), COALESCE(f.success_message, ''),
+	COALESCE(f.rate_limit, 0), COALESCE(f.active, true), COALESCE(f.submission_count, 0),
+	f.last_submitted_at, f.created_at, f.updated_at`
+
+func (s *SignupFormService) scanForm(row interface{ Scan(...any) error }) (*signupForm, error) {
+	f := &signupForm{}
+	var lastSubmittedAt sql.NullTime
+	err := row.Scan(&f.id, &f.orgID, &f.ID, &f.Name, pq.Array(&f.listIDs), pq.Array(&f.ListIDs),
+		pq.Array(&f.Fields), pq.Array(&f.AllowedOrigins), &f.HoneypotField,
+		&f.turnstileSecret, &f.RedirectURL, &f.SuccessMessage,
+		&f.RateLimit, &f.Active, &f.SubmissionCount,
+		&lastSubmittedAt, &f.CreatedAt, &f.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastSubmittedAt.Valid {
+		f.LastSubmittedAt = &lastSubmittedAt.Time
+	}
+	if f.RateLimit <= 0 {
+		f.RateLimit = defaultFormRateLimit
+	}
+	f.TurnstileEnabled = f.turnstileSecret != ""
+	f.SubmitURL = fmt.Sprintf("%s/api/v1/forms/%s/submit", strings.TrimRight(s.cfg.APIUrl, "/"), f.ID)
+	return f, nil
+}
+
+// List returns the organization's signup forms
+func (s *SignupFormService) List(ctx context.Context, orgID int64) ([]*model.SignupForm, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+signupFormColumns+`
+		FROM signup_forms f WHERE f.org_id = $1
+		ORDER BY f.created_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list forms: %w", err)
+	}
+	defer rows.Close()
+
+	forms := []*model.SignupForm{}
+	for rows.Next() {
+		f, err := s.scanForm(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan form: %w", err)
+		}
+		forms = append(forms, &f.SignupForm)
+	}
+	return forms, rows.Err()
+}
+
+// Get returns a signup form by UUID
+func (s *SignupFormService) Get(ctx context.Context, orgID int64, formUUID string) (*model.SignupForm, error) {
+	f, err := s.scanForm(s.db.QueryRowContext(ctx, `
+		SELECT `+signupFormColumns+`
+		FROM signup_forms f WHERE f.uuid::text = $1 AND f.org_id = $2
+	`, formUUID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("form not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get form: %w", err)
+	}
+	return &f.SignupForm, nil
+}
+
+// Create creates a signup form
+func (s *SignupFormService) Create(ctx context.Context, orgID int64, req *model.CreateSignupFormRequest) (*model.SignupForm, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("name is required")
+	}
+	listIDs, err := s.formListIDs(ctx, orgID, req.ListIDs)
+	if err != nil {
+		return nil, err
+	}
+	fields, origins, err := checkFormEntries(req.Fields, req.AllowedOrigins)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkFormSettings(req.HoneypotField, req.RedirectURL, req.RateLimit); err != nil {
+		return nil, err
+	}
+	secret, err := s.encryptTurnstileSecret(req.TurnstileSecret)
+	if err != nil {
+		return nil, err
+	}
+	active := true
+	if req.Active != nil {
+		active = *req.Active
+	}
+	rateLimit := req.RateLimit
+	if rateLimit == 0 {
+		rateLimit = defaultFormRateLimit
+	}
+
+	var formUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO signup_forms (
+			org_id, name, list_ids, fields, allowed_origins, honeypot_field, turnstile_secret,
+			redirect_url, success_message, rate_limit, active, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''), NULLIF($9, ''), $10, $11, NOW(), NOW())
+		RETURNING uuid
+	`, orgID, name, pq.Array(listIDs), pq.Array(fields), pq.Array(origins), strings.TrimSpace(req.HoneypotField), secret,
+		strings.TrimSpace(req.RedirectURL), strings.TrimSpace(req.SuccessMessage), rateLimit, active).Scan(&formUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create form: %w", err)
+	}
+
+	return s.Get(ctx, orgID, formUUID)
+}
+
+// Update changes the settings a request sets
+func (s *SignupFormService) Update(ctx context.Context, orgID int64, formUUID string, req *model.UpdateSignupFormRequest) (*model.SignupForm, error) {
+	form, err := s.Get(ctx, orgID, formUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	sets := []string{}
+	args := []any{}
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s = $%d", column, len(args)))
+	}
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			return nil, fmt.Errorf("name is required")
+		}
+		set("name", name)
+	}
+	if req.ListIDs != nil {
+		listIDs, err := s.formListIDs(ctx, orgID, *req.ListIDs)
+		if err != nil {
+			return nil, err
+		}
+		set("list_ids", pq.Array(listIDs))
+	}
+	fields, origins := form.Fields, form.AllowedOrigins
+	if req.Fields != nil {
+		fields = *req.Fields
+	}
+	if req.AllowedOrigins != nil {
+		origins = *req.AllowedOrigins
+	}
+	if fields, origins, err = checkFormEntries(fields, origins); err != nil {
+		return nil, err
+	}
+	if req.Fields != nil {
+		set("fields", pq.Array(fields))
+	}
+	if req.AllowedOrigins != nil {
+		set("allowed_origins", pq.Array(origins))
+	}
+
+	honeypot, redirectURL, rateLimit := form.HoneypotField, form.RedirectURL, form.RateLimit
+	if req.HoneypotField != nil {
+		honeypot = strings.TrimSpace(*req.HoneypotField)
+		set("honeypot_field", sql.NullString{String: honeypot, Valid: honeypot != ""})
+	}
+	if req.RedirectURL != nil {
+		redirectURL = strings.TrimSpace(*req.RedirectURL)
+		set("redirect_url", sql.NullString{String: redirectURL, Valid: redirectURL != ""})
+	}
+	if req.RateLimit != nil {
+		rateLimit = *req.RateLimit
+		set("rate_limit", rateLimit)
+	}
+	if err := checkFormSettings(honeypot, redirectURL, rateLimit); err != nil {
+		return nil, err
+	}
+	if req.TurnstileSecret != nil {
+		secret, err := s.encryptTurnstileSecret(*req.TurnstileSecret)
+		if err != nil {
+			return nil, err
+		}
+		set("turnstile_secret", sql.NullString{String: secret, Valid: secret != ""})
+	}
+	if req.SuccessMessage != nil {
+		message := strings.TrimSpace(*req.SuccessMessage)
+		set("success_message", sql.NullString{String: message, Valid: message != ""})
+	}
+	if req.Active != nil {
+		set("active", *req.Active)
+	}
+
+	if len(sets) == 0 {
+		return form, nil
+	}
+	args = append(args, formUUID, orgID)
+	_, err = s.db.ExecContext(ctx, fmt.Sprintf(`
+		UPDATE signup_forms SET %s, updated_at = NOW() WHERE uuid::text = $%d AND org_id = $%d
+	`, strings.Join(sets, ", "), len(args)-1, len(args)), args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update form: %w", err)
+	}
+
+	return s.Get(ctx, orgID, formUUID)
+}
+
+// Delete deletes a signup form. Contacts it created are kept.
+func (s *SignupFormService) Delete(ctx context.Context, orgID int64, formUUID string) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM signup_forms WHERE uuid::text = $1 AND org_id = $2
+	`, formUUID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete form: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("form not found")
+	}
+	return nil
+}
+
+// formListIDs resolves a form's lists from their UUIDs. Forms subscribe
+// contacts to lists, so the lists must be static.
+func (s *SignupFormService) formListIDs(ctx context.Context, orgID int64, listUUIDs []string) ([]int64, error) {
+	if len(listUUIDs) == 0 {
+		return nil, fmt.Errorf("a form needs at least one list")
+	}
+	if len(listUUIDs) > maxFormEntries {
+		return nil, fmt.Errorf("a form can't have more than %d lists", maxFormEntries)
+	}
+	ids := make([]int64, 0, len(listUUIDs))
+	for _, listUUID := range listUUIDs {
+		id, err := s.lists.staticListID(ctx, orgID, listUUID)
+		if err != nil {
+			return nil, err
+		}
+		ids = append(ids, int64(id))
+	}
+	return ids, nil
+}
+
+// checkFormEntries checks a form's attribute fields and allowed origins, and
+// returns them trimmed
+func checkFormEntries(fields, origins []string) ([]string, []string, error) {
+	if len(fields) > maxFormEntries || len(origins) > maxFormEntries {
+		return nil, nil, fmt.Errorf("a form can't have more than %d fields or allowed origins", maxFormEntries)
+	}
+	cleanFields := make([]string, 0, len(fields))
+	for _, field := range fields {
+		field = strings.TrimSpace(field)
+		if !contactfield.ValidKey(field) {
+			return nil, nil, fmt.Errorf("field %q must be up to 100 letters, digits, dots, dashes or underscores", field)
+		}
+		cleanFields = append(cleanFields, field)
+	}
+	cleanOrigins := make([]string, 0, len(origins))
+	for _, origin := range origins {
+		origin = strings.TrimRight(strings.TrimSpace(origin), "/")
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || u.Path != "" {
+			return nil, nil, fmt.Errorf("allowed origin %q must be a scheme and host, like https://example.com", origin)
+		}
+		cleanOrigins = append(cleanOrigins, strings.ToLower(origin))
+	}
+	return cleanFields, cleanOrigins, nil
+}
+
+func checkFormSettings(honeypot, redirectURL string, rateLimit int) error {
+	if honeypot != "" && !contactfield.ValidKey(honeypot) {
+		return fmt.Errorf("honeypotField must be up to 100 letters, digits, dots, dashes or underscores")
+	}
+	if redirectURL != "" {
+		u, err := url.Parse(redirectURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("redirectUrl must be an http or https URL")
+		}
+	}
+	if rateLimit < 0 || rateLimit > maxFormRateLimit {
+		return fmt.Errorf("rateLimit must be between 1 and %d submissions per hour", maxFormRateLimit)
+	}
+	return nil
+}
+
+func (s *SignupFormService) encryptTurnstileSecret(secret string) (string, error) {
+	secret = strings.TrimSpace(secret)
+	if secret == "" {
+		return "", nil
+	}
+	encrypted, err := crypto.Encrypt(secret, s.cfg.EncryptionKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to encrypt turnstile secret: %w", err)
+	}
+	return encrypted, nil
+}
+
+// SignupSubmission is a submission of a signup form
+type SignupSubmission struct {
+	Values    map[string]any // The submitted fields
+	Origin    string         // The Origin header, empty when the browser sent none
+	IPAddress string
+	UserAgent string
+}
+
+// Submit takes a form submission: it creates or updates the contact, adds them
+// to the form's lists and records their consent. Submissions that fill in the
+// honeypot field look successful but are dropped.
+func (s *SignupFormService) Submit(ctx context.Context, formUUID string, sub *SignupSubmission) (*model.SignupFormResult, error) {
+	form, err := s.scanForm(s.db.QueryRowContext(ctx, `
+		SELECT `+signupFormColumns+`
+		FROM signup_forms f WHERE f.uuid::text = $1
+	`, formUUID))
+	if err == sql.ErrNoRows || err == nil && !form.Active {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeFormNotFound, "form not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get form: %w", err)
+	}
+
+	if !form.allowsOrigin(sub.Origin) {
+		return nil, apierror.New(http.StatusForbidden, apierror.CodeOriginNotAllowed, "this form can't be submitted from "+sub.Origin)
+	}
+	if err := s.checkFormRateLimit(ctx, form, sub.IPAddress); err != nil {
+		return nil, err
+	}
+
+	result := &model.SignupFormResult{Message: form.SuccessMessage, RedirectURL: form.RedirectURL}
+	if result.Message == "" {
+		result.Message = "Thanks for signing up!"
+	}
+	if form.HoneypotField != "" && formValue(sub.Values, form.HoneypotField) != "" {
+		return result, nil
+	}
+	if form.turnstileSecret != "" {
+		if err := s.verifyTurnstile(ctx, form.turnstileSecret, formValue(sub.Values, turnstileResponseField), sub.IPAddress); err != nil {
+			return nil, err
+		}
+	}
+
+	email := strings.ToLower(formValue(sub.Values, "email"))
+	if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		return nil, &apierror.ValidationError{Fields: []apierror.FieldError{{Field: "email", Rule: "email", Message: "a valid email address is required"}}}
+	}
+	firstName := formValue(sub.Values, "firstName", "first_name")
+	lastName := formValue(sub.Values, "lastName", "last_name")
+
+	attributes := map[string]any{}
+	for _, field := range form.Fields {
+		if value := formValue(sub.Values, field); value != "" {
+			attributes[field] = value
+		}
+	}
+	if attributes, err = validateAttributes(ctx, s.db, form.orgID, attributes); err != nil {
+		return nil, err
+	}
+	attributesJSON, err := json.Marshal(attributes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal attributes: %w", err)
+	}
+
+	subscription, err := s.subscribe(ctx, form, sub, email, firstName, lastName, attributesJSON)
+	if err != nil {
+		return nil, err
+	}
+	if len(subscription.confirm) > 0 {
+		if err := sendListConfirmations(ctx, s.db, s.cfg, s.transactionalService, form.orgID, subscription.contactID, email, subscription.confirm, listevent.SourceForm); err != nil {
+			return nil, err
+		}
+		result.ConfirmationRequired = true
+		if form.SuccessMessage == "" {
+			result.Message = "Thanks for signing up! Please check your inbox to confirm your subscription."
+		}
+	}
+
+	if s.webhookTriggerService != nil {
+		data := map[string]interface{}{
+			"uuid":      subscription.contactUUID,
+			"email":     email,
+			"firstName": firstName,
+			"lastName":  lastName,
+			"formId":    form.ID,
+		}
+		if subscription.created {
+			go s.webhookTriggerService.Fire(context.Background(), form.orgID, TriggerContactCreated, data)
+		}
+		if subscription.joined {
+			go s.webhookTriggerService.Fire(context.Background(), form.orgID, TriggerSubscribed, data)
+		}
+	}
+
+	return result, nil
+}
+
+// formSubscription is the outcome of subscribing a form's contact to its lists
+type formSubscription struct {
+	contactID   int64
+	contactUUID string
+	created     bool
+	joined      bool              // The contact joined a list without confirming
+	confirm     []subscribingList // Lists with double opt-in the contact must confirm
+}
+
+// subscribe creates or updates the contact of a submission, adds them to the
+// form's lists and records their consent. Contacts who had unsubscribed are
+// subscribed again, as the form is a new consent, unless all the lists need
+// them to confirm first; bounced and complained ones keep their status.
+func (s *SignupFormService) subscribe(ctx context.Context, form *signupForm, sub *SignupSubmission, email, firstName, lastName string, attributesJSON []byte) (*formSubscription, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	listIDs := make([]int, len(form.listIDs))
+	for i, id := range form.listIDs {
+		listIDs[i] = int(id)
+	}
+	lists, err := loadSubscribingLists(ctx, tx, form.orgID, listIDs)
+	if err != nil {
+		return nil, err
+	}
+	status := "active"
+	if needConfirmation(lists, false) {
+		status = "pending"
+	}
+
+	// Changes to an existing contact are recorded as made by the form
+	var before contactchange.Snapshot
+	var existingID int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT id FROM contacts WHERE org_id = $1 AND email = $2 FOR UPDATE
+	`, form.orgID, email).Scan(&existingID)
+	if err == nil {
+		before, err = contactchange.Take(ctx, tx, existingID)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to save contact: %w", err)
+	}
+
+	source := "form:" + form.ID
+	result := &formSubscription{}
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO contacts (
+			org_id, email, first_name, last_name, attributes, status,
+			consent_source, consent_timestamp, consent_ip, consent_user_agent, created_at, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $9, $6, NOW(), $7, $8, NOW(), NOW())
+		ON CONFLICT (org_id, email) DO UPDATE SET
+			first_name = COALESCE(NULLIF(EXCLUDED.first_name, ''), contacts.first_name),
+			last_name = COALESCE(NULLIF(EXCLUDED.last_name, ''), contacts.last_name),
+			attributes = COALESCE(contacts.attributes, '{}') || EXCLUDED.attributes,
+			status = CASE WHEN contacts.status = 'unsubscribed' AND EXCLUDED.status = 'active' THEN 'active' ELSE contacts.status END,
+			consent_source = EXCLUDED.consent_source,
+			consent_timestamp = EXCLUDED.consent_timestamp,
+			consent_ip = EXCLUDED.consent_ip,
+			consent_user_agent = EXCLUDED.consent_user_agent,
+			updated_at = NOW()
+		RETURNING id, uuid, (xmax = 0)
+	`, form.orgID, email, firstName, lastName, attributesJSON, source, sub.IPAddress, sub.UserAgent, status).Scan(
+		&result.contactID, &result.contactUUID, &result.created)
+	if err != nil {
+		return nil, fmt.Errorf("failed to save contact: %w", err)
+	}
+	if before != nil {
+		_, err := contactchange.Record(ctx, tx, form.orgID, result.contactID, before, contactchange.Source{Source: "form", SourceID: form.ID})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if result.confirm, err = joinLists(ctx, tx, form.orgID, result.contactID, lists, false, listevent.SourceForm); err != nil {
+		return nil, err
+	}
+	result.joined = !needConfirmation(lists, false)
+	_, err = tx.ExecContext(ctx, `
+		UPDATE lists SET contact_count = (
+			SELECT COUNT(*) FROM list_contacts WHERE list_id = lists.id
+		), updated_at = NOW()
+		WHERE id = ANY($1) AND org_id = $2
+	`, pq.Array(form.listIDs), form.orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update list counts: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO consent_audit (contact_id, org_id, action, source, ip_address, user_agent, details, created_at)
+		VALUES ($1, $2, 'consent_given', $3, $4, $5, $6, NOW())
+	`, result.contactID, form.orgID, source, sub.IPAddress, sub.UserAgent, "Signed up with form "+form.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to record consent: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE signup_forms SET submission_count = submission_count + 1, last_submitted_at = NOW() WHERE id = $1
+	`, form.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update form: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to save contact: %w", err)
+	}
+	return result, nil
+}
+
+// allowsOrigin reports whether a form can be submitted from a site. Forms
+// without allowed origins can be submitted from anywhere, and submissions
+// without an Origin header don't come from a browser's cross-site request.
+func (f *signupForm) allowsOrigin(origin string) bool {
+	if len(f.AllowedOrigins) == 0 || origin == "" {
+		return true
+	}
+	origin = strings.ToLower(strings.TrimRight(origin, "/"))
+	for _, allowed := range f.AllowedOrigins {
+		if origin == allowed {
+			return true
+		}
+	}
+	return false
+}
+
+// checkFormRateLimit counts a submission from an IP address against the form's
+// hourly limit. Submissions aren't limited when Redis is unavailable.
+func (s *SignupFormService) checkFormRateLimit(ctx context.Context, form *signupForm, ip string) error {
+	if s.redis == nil || ip == "" {
+		return nil
+	}
+
+	key := fmt.Sprintf("ratelimit:form:%s:%s", form.ID, ip)
+	count, err := s.redis.Incr(ctx, key).Result()
+	if err != nil {
+		return nil // Don't block on Redis errors
+	}
+	if count == 1 {
+		s.redis.Expire(ctx, key, time.Hour)
+	}
+	if count > int64(form.RateLimit) {
+		return apierror.New(http.StatusTooManyRequests, apierror.CodeRateLimited, "too many submissions, try again later")
+	}
+	return nil
+}
+
+// verifyTurnstile checks a Turnstile token with Cloudflare
+func (s *SignupFormService) verifyTurnstile(ctx context.Context, encryptedSecret, token, ip string) error {
+	if token == "" {
+		return apierror.New(http.StatusBadRequest, apierror.CodeCaptchaFailed, "the captcha wasn't completed")
+	}
+	secret, err := crypto.Decrypt(encryptedSecret, s.cfg.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to decrypt turnstile secret: %w", err)
+	}
+
+	form := url.Values{"secret": {secret}, "response": {token}}
+	if ip != "" {
+		form.Set("remoteip", ip)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, turnstileVerifyURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	resp, err := s.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var outcome struct {
+		Success bool `json:"success"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&outcome); err != nil {
+		return fmt.Errorf("failed to verify captcha: %w", err)
+	}
+	if !outcome.Success {
+		return apierror.New(http.StatusBadRequest, apierror.CodeCaptchaFailed, "the captcha couldn't be verified")
+	}
+	return nil
+}
+
+// formValue returns the first of the named fields a submission filled in
+func formValue(values map[string]any, names ...string) string {
+	for _, name := range names {
+		var text string
+		switch v := values[name].(type) {
+		case string:
+			text = v
+		case []any:
+			if len(v) > 0 {
+				text = fmt.Sprint(v[0])
+			}
+		case nil:
+		default:
+			text = fmt.Sprint(v)
+		}
+		if text = strings.TrimSpace(text); text != "" {
+			return text
+		}
+	}
+	return ""
+}
@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/snippet"
+)
+
+// Snippets are canned responses inserted into emails being composed, found by
+// name or by a shortcut typed in the composer. Personal ones are their
+// author's; org ones are shared with the whole organization and managed by
+// their author and admins.
+
+// maxSnippetLength is the largest snippet body in bytes
+const maxSnippetLength = 100 * 1024
+
+// SnippetService manages users' snippets
+type SnippetService struct {
+	db *sql.DB
+}
+
+// NewSnippetService creates a new snippet service
+func NewSnippetService(db *sql.DB) *SnippetService {
+	return &SnippetService{db: db}
+}
+
+// snippetColumns are the columns scanned by scanSnippet; $1 is the user
+const snippetColumns = `uuid, scope, name, COALESCE(shortcut, ''), COALESCE(subject, ''),
+	COALESCE(text_body, ''), COALESCE(html_body, ''), user_id = $1, use_count, last_used_at, created_at, updated_at`
+
+// snippetVisible restricts snippets to those the user, $1, of the org, $2,
+// can use
+const snippetVisible = `((scope = 'personal' AND user_id = $1) OR (scope = 'org' AND org_id = $2))`
+
+// scanSnippet scans a row of snippetColumns
+func scanSnippet(row interface{ Scan(...interface{}) error }) (*model.Snippet, error) {
+	var sn model.Snippet
+	var lastUsedAt sql.NullTime
+	err := row.Scan(&sn.ID, &sn.Scope, &sn.Name, &sn.Shortcut, &sn.Subject, &sn.TextBody, &sn.HTMLBody,
+		&sn.IsOwner, &sn.UseCount, &lastUsedAt, &sn.CreatedAt, &sn.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	if lastUsedAt.Valid {
+		sn.LastUsedAt = &lastUsedAt.Time
+	}
+	sn.Variables = snippet.Variables(sn.Subject, sn.TextBody, sn.HTMLBody)
+	if sn.Variables == nil {
+		sn.Variables = []string{}
+	}
+	return &sn, nil
+}
+
+// ListSnippets returns the snippets a user can insert, most used first,
+// optionally only those whose name or shortcut starts with query
+func (s *SnippetService) ListSnippets(ctx context.Context, userID, orgID int64, query string) ([]*model.Snippet, error) {
+	pattern := escapeLike(snippet.NormalizeShortcut(query)) + "%"
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+snippetColumns+`
+		FROM compose_snippets
+		WHERE `+snippetVisible+`
+			AND (shortcut LIKE $3 OR LOWER(name) LIKE $3 OR LOWER(name) LIKE '% ' || $3)
+		ORDER BY use_count DESC, name
+	`, userID, orgID, pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list snippets: %w", err)
+	}
+	defer rows.Close()
+
+	snippets := []*model.Snippet{}
+	for rows.Next() {
+		sn, err := scanSnippet(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan snippet: %w", err)
+		}
+		snippets = append(snippets, sn)
+	}
+	return snippets, rows.Err()
+}
+
+// GetSnippet returns a snippet the user can insert
+func (s *SnippetService) GetSnippet(ctx context.Context, userID, orgID int64, snippetUUID string) (*model.Snippet, error) {
+	sn, err := scanSnippet(s.db.QueryRowContext(ctx, `
+		SELECT `+snippetColumns+`
+		FROM compose_snippets
+		WHERE uuid::text = $3 AND `+snippetVisible+`
+	`, userID, orgID, snippetUUID))
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "snippet not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get snippet: %w", err)
+	}
+	return sn, nil
+}
+
+// CreateSnippet adds a snippet
+func (s *SnippetService) CreateSnippet(ctx context.Context, userID, orgID int64, req *model.CreateSnippetRequest) (*model.Snippet, error) {
+	scope := req.Scope
+	if scope == "" {
+		scope = snippet.ScopePersonal
+	}
+	shortcut := snippet.NormalizeShortcut(req.Shortcut)
+	if err := s.validateSnippet(ctx, userID, orgID, "", scope, req.Name, shortcut, req.Subject, req.TextBody, req.HTMLBody); err != nil {
+		return nil, err
+	}
+
+	sn, err := scanSnippet(s.db.QueryRowContext(ctx, `
+		INSERT INTO compose_snippets (org_id, user_id, scope, name, shortcut, subject, text_body, html_body)
+		VALUES ($2, $1, $3, $4, NULLIF($5, ''), NULLIF($6, ''), NULLIF($7, ''), NULLIF($8, ''))
+		RETURNING `+snippetColumns,
+		userID, orgID, scope, strings.TrimSpace(req.Name), shortcut, req.Subject, req.TextBody, req.HTMLBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create snippet: %w", err)
+	}
+	return sn, nil
+}
+
+// UpdateSnippet changes a snippet; omitted fields are kept. Org snippets can
+// be changed by their author and admins.
+func (s *SnippetService) UpdateSnippet(ctx context.Context, userID, orgID int64, isAdmin bool, snippetUUID string, req *model.UpdateSnippetRequest) (*model.Snippet, error) {
+	existing, err := s.editableSnippet(ctx, userID, orgID, isAdmin, snippetUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.Scope != nil {
+		if *req.Scope != existing.Scope && !existing.IsOwner {
+			return nil, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "only the snippet's author can change its scope")
+		}
+		existing.Scope = *req.Scope
+	}
+	if req.Name != nil {
+		existing.Name = strings.TrimSpace(*req.Name)
+	}
+	if req.Shortcut != nil {
+		existing.Shortcut = snippet.NormalizeShortcut(*req.Shortcut)
+	}
+	if req.Subject != nil {
+		existing.Subject = *req.Subject
+	}
+	if req.TextBody != nil {
+		existing.TextBody = *req.TextBody
+	}
+	if req.HTMLBody != nil {
+		existing.HTMLBody = *req.HTMLBody
+	}
+	if err := s.validateSnippet(ctx, userID, orgID, snippetUUID, existing.Scope, existing.Name, existing.Shortcut,
+		existing.Subject, existing.TextBody, existing.HTMLBody); err != nil {
+		return nil, err
+	}
+
+	sn, err := scanSnippet(s.db.QueryRowContext(ctx, `
+		UPDATE compose_snippets SET
+			scope = $4, name = $5, shortcut = NULLIF($6, ''), subject = NULLIF($7, ''),
+			text_body = NULLIF($8, ''), html_body = NULLIF($9, ''), updated_at = NOW()
+		WHERE uuid::text = $3 AND `+snippetVisible+`
+		RETURNING `+snippetColumns,
+		userID, orgID, snippetUUID, existing.Scope, existing.Name, existing.Shortcut,
+		existing.Subject, existing.TextBody, existing.HTMLBody))
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "snippet not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to update snippet: %w", err)
+	}
+	return sn, nil
+}
+
+// DeleteSnippet removes a snippet. Org snippets can be removed by their
+// author and admins.
+func (s *SnippetService) DeleteSnippet(ctx context.Context, userID, orgID int64, isAdmin bool, snippetUUID string) error {
+	if _, err := s.editableSnippet(ctx, userID, orgID, isAdmin, snippetUUID); err != nil {
+		return err
+	}
+	_, err := s.db.ExecContext(ctx, `
+		DELETE FROM compose_snippets WHERE uuid::text = $3 AND `+snippetVisible+`
+	`, userID, orgID, snippetUUID)
+	if err != nil {
+		return fmt.Errorf("failed to delete snippet: %w", err)
+	}
+	return nil
+}
+
+// RenderSnippet fills in a snippet's variables for the email being composed
+// and counts the use. Variables supplied in the request win over those taken
+// from the email.
+func (s *SnippetService) RenderSnippet(ctx context.Context, userID, orgID int64, snippetUUID string, req *model.RenderSnippetRequest) (*model.RenderedSnippet, error) {
+	sn, err := s.GetSnippet(ctx, userID, orgID, snippetUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	vars := map[string]string{
+		snippet.VarRecipientName:      req.RecipientName,
+		snippet.VarRecipientFirstName: snippet.FirstName(req.RecipientName),
+		snippet.VarRecipientEmail:     req.RecipientEmail,
+	}
+	if req.IdentityID > 0 {
+		var name, email string
+		err := s.db.QueryRowContext(ctx, `
+			SELECT COALESCE(display_name, ''), email FROM identities WHERE id = $1 AND user_id = $2
+		`, req.IdentityID, userID).Scan(&name, &email)
+		if err == sql.ErrNoRows {
+			return nil, apierror.New(http.StatusNotFound, apierror.CodeNotFound, "identity not found")
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to get identity: %w", err)
+		}
+		vars[snippet.VarSenderName] = name
+		vars[snippet.VarSenderEmail] = email
+	}
+	for name, value := range req.Variables {
+		vars[name] = value
+	}
+
+	var rendered model.RenderedSnippet
+	missing := make(map[string]bool)
+	var m []string
+	rendered.Subject, m = snippet.Render(sn.Subject, vars, false)
+	addMissing(missing, m)
+	rendered.TextBody, m = snippet.Render(sn.TextBody, vars, false)
+	addMissing(missing, m)
+	rendered.HTMLBody, m = snippet.Render(sn.HTMLBody, vars, true)
+	addMissing(missing, m)
+	for _, name := range snippet.Variables(sn.Subject, sn.TextBody, sn.HTMLBody) {
+		if missing[name] {
+			rendered.Missing = append(rendered.Missing, name)
+		}
+	}
+
+	s.db.ExecContext(ctx, `
+		UPDATE compose_snippets SET use_count = use_count + 1, last_used_at = NOW() WHERE uuid::text = $1
+	`, snippetUUID)
+
+	return &rendered, nil
+}
+
+// addMissing adds names to the set of missing variables
+func addMissing(set map[string]bool, names []string) {
+	for _, name := range names {
+		set[name] = true
+	}
+}
+
+// editableSnippet returns a snippet the user can change
+func (s *SnippetService) editableSnippet(ctx context.Context, userID, orgID int64, isAdmin bool, snippetUUID string) (*model.Snippet, error) {
+	sn, err := s.GetSnippet(ctx, userID, orgID, snippetUUID)
+	if err != nil {
+		return nil, err
+	}
+	if !sn.IsOwner && !isAdmin {
+		return nil, apierror.New(http.StatusForbidden, apierror.CodeForbidden, "only the snippet's author or an admin can change it")
+	}
+	return sn, nil
+}
+
+// validateSnippet checks a snippet's fields, and that its shortcut isn't
+// taken by another snippet the same users would see
+func (s *SnippetService) validateSnippet(ctx context.Context, userID, orgID int64, snippetUUID, scope, name, shortcut, subject, textBody, htmlBody string) error {
+	var fields []apierror.FieldError
+	if !snippet.ValidScope(scope) {
+		fields = append(fields, apierror.FieldError{Field: "scope", Message: "scope must be personal or org"})
+	}
+	if strings.TrimSpace(name) == "" || len(name) > 100 {
+		fields = append(fields, apierror.FieldError{Field: "name", Message: "name must be 1 to 100 characters"})
+	}
+	if shortcut != "" && !snippet.ValidShortcut(shortcut) {
+		fields = append(fields, apierror.FieldError{Field: "shortcut", Message: "shortcut must be up to 50 letters, digits, - or _"})
+	}
+	if len(subject) > 998 {
+		fields = append(fields, apierror.FieldError{Field: "subject", Message: "subject is too long"})
+	}
+	if textBody == "" && htmlBody == "" {
+		fields = append(fields, apierror.FieldError{Field: "textBody", Message: "textBody or htmlBody is required"})
+	}
+	if len(textBody) > maxSnippetLength || len(htmlBody) > maxSnippetLength {
+		fields = append(fields, apierror.FieldError{Field: "textBody", Message: "snippet must be at most 100KB"})
+	}
+	if len(fields) > 0 {
+		return &apierror.ValidationError{Fields: fields}
+	}
+
+	if shortcut == "" {
+		return nil
+	}
+	// Org shortcuts clash with everyone's; personal ones with the org's and
+	// the user's own
+	var taken bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(
+			SELECT 1 FROM compose_snippets
+			WHERE shortcut = $3 AND uuid::text <> $4 AND org_id = $2
+				AND (scope = 'org' OR $5 = 'org' OR user_id = $1)
+		)
+	`, userID, orgID, shortcut, snippetUUID, scope).Scan(&taken)
+	if err != nil {
+		return fmt.Errorf("failed to check shortcut: %w", err)
+	}
+	if taken {
+		return apierror.Newf(http.StatusConflict, apierror.CodeConflict, "shortcut /%s is already used", shortcut)
+	}
+	return nil
+}
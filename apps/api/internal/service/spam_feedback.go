@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/spamfilter"
+)
+
+// Marking received emails as spam or not spam moves them, and trains both the
+// identity's own Bayesian filter, which then flags look-alikes the receiving
+// provider lets through, and Stalwart's spam filter for the account. Each
+// email keeps the verdict it was trained with, so marking it again with the
+// other verdict unlearns the first.
+
+// stalwartTrainTimeout bounds training Stalwart with the emails of one report
+const stalwartTrainTimeout = 5 * time.Minute
+
+// spamFeedbackEmail is a received email being marked as spam or not spam
+type spamFeedbackEmail struct {
+	id          int64
+	identityID  int64
+	account     string
+	tokens      []string
+	previous    string
+	rawS3Bucket string
+	rawS3Key    string
+}
+
+// ReportSpam marks the user's received emails as spam, moving them to the
+// spam folder, or as not spam, moving them to the inbox, and trains the spam
+// filters with them
+func (s *InboxService) ReportSpam(ctx context.Context, userID int64, emailUUIDs []string, spam bool) (*model.SpamFeedbackResult, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT re.id, re.identity_id, i.email, re.from_email, re.subject,
+			COALESCE(re.text_body, ''), COALESCE(re.html_body, ''), COALESCE(re.spam_feedback, ''),
+			COALESCE(re.raw_s3_bucket, ''), COALESCE(re.raw_s3_key, '')
+		FROM received_emails re
+		JOIN identities i ON re.identity_id = i.id
+		WHERE re.uuid::text = ANY($1) AND i.user_id = $2
+	`, pq.Array(emailUUIDs), userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get emails: %w", err)
+	}
+	var emails []*spamFeedbackEmail
+	for rows.Next() {
+		var e spamFeedbackEmail
+		var from, subject, textBody, htmlBody string
+		err := rows.Scan(&e.id, &e.identityID, &e.account, &from, &subject,
+			&textBody, &htmlBody, &e.previous, &e.rawS3Bucket, &e.rawS3Key)
+		if err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to get emails: %w", err)
+		}
+		e.tokens = spamfilter.Tokens(from, subject, textBody, htmlBody)
+		emails = append(emails, &e)
+	}
+	rows.Close()
+
+	folder, verdict := "inbox", spamfilter.VerdictHam
+	if spam {
+		folder, verdict = "spam", spamfilter.VerdictSpam
+	}
+	if err := s.MoveReceivedEmails(ctx, userID, emailUUIDs, folder); err != nil {
+		return nil, fmt.Errorf("failed to move emails: %w", err)
+	}
+
+	result := &model.SpamFeedbackResult{Marked: len(emails)}
+	var trained []*spamFeedbackEmail
+	for _, e := range emails {
+		if e.previous == verdict {
+			continue
+		}
+		if err := spamfilter.Learn(ctx, s.db, e.identityID, e.tokens, e.previous, verdict); err != nil {
+			return result, err
+		}
+		_, err := s.db.ExecContext(ctx, `
+			UPDATE received_emails SET spam_feedback = $1 WHERE id = $2
+		`, verdict, e.id)
+		if err != nil {
+			return result, fmt.Errorf("failed to record feedback: %w", err)
+		}
+		result.Trained++
+		trained = append(trained, e)
+	}
+
+	if len(trained) > 0 && s.receiving != nil && s.identity != nil && s.cfg.StalwartAdminToken != "" {
+		go s.trainStalwart(trained, spam)
+	}
+	return result, nil
+}
+
+// trainStalwart trains Stalwart's spam filter of each email's account with
+// its raw source, as stored on receipt. Training is best effort: Stalwart's
+// filter only helps with email it receives itself.
+func (s *InboxService) trainStalwart(emails []*spamFeedbackEmail, spam bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), stalwartTrainTimeout)
+	defer cancel()
+
+	for _, e := range emails {
+		if e.rawS3Bucket == "" || e.rawS3Key == "" {
+			continue
+		}
+		raw, err := s.receiving.GetEmailFromS3(ctx, e.rawS3Bucket, e.rawS3Key)
+		if err != nil {
+			log.Printf("Failed to fetch email %d to train spam filter: %v", e.id, err)
+			continue
+		}
+		if err := s.identity.stalwart.TrainSpamFilter(ctx, e.account, spam, raw); err != nil {
+			log.Printf("Failed to train Stalwart spam filter with email %d: %v", e.id, err)
+		}
+	}
+}
+
+// classifySpam moves a received email the provider didn't flag to the spam
+// folder when its identity's filter, trained by the owner, finds it's spam
+func (s *ReceivingService) classifySpam(ctx context.Context, emailID int64) {
+	var identityID int64
+	var from, subject, textBody, htmlBody string
+	var isSpam bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT identity_id, from_email, subject, COALESCE(text_body, ''), COALESCE(html_body, ''),
+			COALESCE(is_spam, false)
+		FROM received_emails WHERE id = $1
+	`, emailID).Scan(&identityID, &from, &subject, &textBody, &htmlBody, &isSpam)
+	if err != nil || isSpam {
+		return
+	}
+
+	score, trained, err := spamfilter.Score(ctx, s.db, identityID, spamfilter.Tokens(from, subject, textBody, htmlBody))
+	if err != nil {
+		log.Printf("Failed to classify email %d: %v", emailID, err)
+		return
+	}
+	if !trained || score < spamfilter.SpamThreshold {
+		return
+	}
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE received_emails SET folder = 'spam', is_spam = true, updated_at = NOW()
+		WHERE id = $1 AND folder = 'inbox'
+	`, emailID)
+	if err != nil {
+		log.Printf("Failed to move email %d to spam: %v", emailID, err)
+	}
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+)
+
+// Subscription topics are kinds of email, like a newsletter, product updates
+// or billing notices. Contacts get every topic they haven't opted out of;
+// campaigns and automations declare their topic, and leave out the contacts
+// opted out of it.
+
+// maxTopicNameLength is the longest name a topic can have
+const maxTopicNameLength = 100
+
+// maxTopics is how many subscription topics an organization can have
+const maxTopics = 50
+
+type SubscriptionTopicService struct {
+	db         *sql.DB
+	cfg        *config.Config
+	compliance *ComplianceService
+}
+
+func NewSubscriptionTopicService(db *sql.DB, cfg *config.Config) *SubscriptionTopicService {
+	return &SubscriptionTopicService{db: db, cfg: cfg, compliance: NewComplianceService(db, cfg)}
+}
+
+const subscriptionTopicColumns = `
+	t.id, t.uuid, t.name, COALESCE(t.description, ''),
+	(SELECT COUNT(*) FROM contact_topic_optouts o WHERE o.topic_id = t.id), t.created_at, t.updated_at`
+
+func scanSubscriptionTopic(row interface{ Scan(...any) error }) (*model.SubscriptionTopic, error) {
+	var t model.SubscriptionTopic
+	err := row.Scan(&t.ID, &t.UUID, &t.Name, &t.Description, &t.OptOutCount, &t.CreatedAt, &t.UpdatedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// List returns the organization's subscription topics
+func (s *SubscriptionTopicService) List(ctx context.Context, orgID int64) ([]*model.SubscriptionTopic, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+subscriptionTopicColumns+`
+		FROM subscription_topics t WHERE t.org_id = $1
+		ORDER BY t.name
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list topics: %w", err)
+	}
+	defer rows.Close()
+
+	topics := []*model.SubscriptionTopic{}
+	for rows.Next() {
+		t, err := scanSubscriptionTopic(rows)
+		if err != nil {
+			continue
+		}
+		topics = append(topics, t)
+	}
+	return topics, nil
+}
+
+// Get returns a subscription topic by UUID
+func (s *SubscriptionTopicService) Get(ctx context.Context, orgID int64, topicUUID string) (*model.SubscriptionTopic, error) {
+	t, err := scanSubscriptionTopic(s.db.QueryRowContext(ctx, `
+		SELECT `+subscriptionTopicColumns+`
+		FROM subscription_topics t WHERE t.uuid::text = $1 AND t.org_id = $2
+	`, topicUUID, orgID))
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("topic not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get topic: %w", err)
+	}
+	return t, nil
+}
+
+// Create creates a subscription topic
+func (s *SubscriptionTopicService) Create(ctx context.Context, orgID int64, req *model.CreateSubscriptionTopicRequest) (*model.SubscriptionTopic, error) {
+	name, err := s.checkName(ctx, orgID, 0, req.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	var count int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM subscription_topics WHERE org_id = $1`, orgID).Scan(&count); err != nil {
+		return nil, fmt.Errorf("failed to count topics: %w", err)
+	}
+	if count >= maxTopics {
+		return nil, fmt.Errorf("an organization can have at most %d topics", maxTopics)
+	}
+
+	var topicUUID string
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO subscription_topics (org_id, name, description, created_at, updated_at)
+		VALUES ($1, $2, NULLIF($3, ''), NOW(), NOW())
+		RETURNING uuid
+	`, orgID, name, strings.TrimSpace(req.Description)).Scan(&topicUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create topic: %w", err)
+	}
+	return s.Get(ctx, orgID, topicUUID)
+}
+
+// Update changes a subscription topic's name or description
+func (s *SubscriptionTopicService) Update(ctx context.Context, orgID int64, topicUUID string, req *model.UpdateSubscriptionTopicRequest) (*model.SubscriptionTopic, error) {
+	topic, err := s.Get(ctx, orgID, topicUUID)
+	if err != nil {
+		return nil, err
+	}
+
+	name, description := topic.Name, topic.Description
+	if req.Name != nil {
+		if name, err = s.checkName(ctx, orgID, topic.ID, *req.Name); err != nil {
+			return nil, err
+		}
+	}
+	if req.Description != nil {
+		description = strings.TrimSpace(*req.Description)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE subscription_topics SET name = $3, description = NULLIF($4, ''), updated_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, topic.ID, orgID, name, description)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update topic: %w", err)
+	}
+	return s.Get(ctx, orgID, topicUUID)
+}
+
+// Delete deletes a subscription topic with its opt-outs. Automations of the
+// topic are left without one.
+func (s *SubscriptionTopicService) Delete(ctx context.Context, orgID int64, topicUUID string) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM subscription_topics WHERE uuid::text = $1 AND org_id = $2
+	`, topicUUID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete topic: %w", err)
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return fmt.Errorf("topic not found")
+	}
+	return nil
+}
+
+// checkName trims a topic's name and checks no other topic of the org has it
+func (s *SubscriptionTopicService) checkName(ctx context.Context, orgID int64, topicID int, name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", fmt.Errorf("name is required")
+	}
+	if len(name) > maxTopicNameLength {
+		return "", fmt.Errorf("name can be at most %d characters", maxTopicNameLength)
+	}
+
+	var taken bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM subscription_topics WHERE org_id = $1 AND LOWER(name) = LOWER($2) AND id <> $3)
+	`, orgID, name, topicID).Scan(&taken)
+	if err != nil {
+		return "", fmt.Errorf("failed to check topics: %w", err)
+	}
+	if taken {
+		return "", apierror.Newf(http.StatusConflict, apierror.CodeConflict, "a topic named %q already exists", name)
+	}
+	return name, nil
+}
+
+// ContactTopics returns whether a contact gets each of the org's topics
+func (s *SubscriptionTopicService) ContactTopics(ctx context.Context, orgID int64, contactUUID string) ([]model.ContactTopic, error) {
+	contactID, err := s.contactID(ctx, orgID, contactUUID)
+	if err != nil {
+		return nil, err
+	}
+	return contactTopics(ctx, s.db, orgID, contactID)
+}
+
+// UpdateContactTopics replaces the topics a contact opted out of
+func (s *SubscriptionTopicService) UpdateContactTopics(ctx context.Context, orgID int64, contactUUID string, req *model.UpdateContactTopicsRequest) ([]model.ContactTopic, error) {
+	contactID, err := s.contactID(ctx, orgID, contactUUID)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.compliance.setTopicOptOuts(ctx, orgID, contactID, req.OptedOutTopicIDs, "api", "", ""); err != nil {
+		return nil, err
+	}
+	return contactTopics(ctx, s.db, orgID, contactID)
+}
+
+func (s *SubscriptionTopicService) contactID(ctx context.Context, orgID int64, contactUUID string) (int64, error) {
+	var id int64
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id FROM contacts WHERE uuid::text = $1 AND org_id = $2
+	`, contactUUID, orgID).Scan(&id)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("contact not found")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get contact: %w", err)
+	}
+	return id, nil
+}
+
+// topicOptOutFilter returns the SQL condition that the contact isn't opted out
+// of the subscription topic of the automation with the given alias
+func topicOptOutFilter(alias, contactID string) string {
+	return automationtrigger.OptOutFilter(alias, contactID)
+}
+
+// checkTopic checks a subscription topic belongs to the organization
+func checkTopic(ctx context.Context, db *sql.DB, orgID int64, topicID int) error {
+	var exists bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM subscription_topics WHERE id = $1 AND org_id = $2)
+	`, topicID, orgID).Scan(&exists)
+	if err != nil {
+		return fmt.Errorf("failed to verify topic: %w", err)
+	}
+	if !exists {
+		return fmt.Errorf("topic not found")
+	}
+	return nil
+}
+
+// contactTopics returns whether a contact gets each of the org's topics
+func contactTopics(ctx context.Context, db *sql.DB, orgID, contactID int64) ([]model.ContactTopic, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT t.id, t.name, COALESCE(t.description, ''), o.topic_id IS NULL
+		FROM subscription_topics t
+		LEFT JOIN contact_topic_optouts o ON o.topic_id = t.id AND o.contact_id = $2
+		WHERE t.org_id = $1
+		ORDER BY t.name
+	`, orgID, contactID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get topics: %w", err)
+	}
+	defer rows.Close()
+
+	topics := []model.ContactTopic{}
+	for rows.Next() {
+		var t model.ContactTopic
+		if err := rows.Scan(&t.ID, &t.Name, &t.Description, &t.Subscribed); err != nil {
+			return nil, fmt.Errorf("failed to get topics: %w", err)
+		}
+		topics = append(topics, t)
+	}
+	return topics, rows.Err()
+}
+
+// setTopicOptOuts replaces the topics a contact opted out of, recording each
+// change in the consent audit trail
+func (s *ComplianceService) setTopicOptOuts(ctx context.Context, orgID, contactID int64, optedOut []int, source, ipAddress, userAgent string) error {
+	var unknown int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM unnest($1::int[]) AS u(topic_id)
+		WHERE NOT EXISTS (SELECT 1 FROM subscription_topics t WHERE t.id = u.topic_id AND t.org_id = $2)
+	`, pq.Array(optedOut), orgID).Scan(&unknown)
+	if err != nil {
+		return fmt.Errorf("failed to check topics: %w", err)
+	}
+	if unknown > 0 {
+		return fmt.Errorf("topic not found")
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT t.id, t.name, o.topic_id IS NOT NULL
+		FROM subscription_topics t
+		LEFT JOIN contact_topic_optouts o ON o.topic_id = t.id AND o.contact_id = $2
+		WHERE t.org_id = $1
+	`, orgID, contactID)
+	if err != nil {
+		return fmt.Errorf("failed to get topics: %w", err)
+	}
+	type topicState struct {
+		id       int
+		name     string
+		optedOut bool
+	}
+	var topics []topicState
+	for rows.Next() {
+		var t topicState
+		if err := rows.Scan(&t.id, &t.name, &t.optedOut); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to get topics: %w", err)
+		}
+		topics = append(topics, t)
+	}
+	rows.Close()
+
+	want := map[int]bool{}
+	for _, id := range optedOut {
+		want[id] = true
+	}
+	for _, t := range topics {
+		switch {
+		case want[t.id] && !t.optedOut:
+			if err := s.optOutOfTopic(ctx, orgID, contactID, t.id, t.name, source, ipAddress, userAgent); err != nil {
+				return err
+			}
+		case !want[t.id] && t.optedOut:
+			_, err := s.db.ExecContext(ctx, `
+				DELETE FROM contact_topic_optouts WHERE contact_id = $1 AND topic_id = $2
+			`, contactID, t.id)
+			if err != nil {
+				return fmt.Errorf("failed to update topics: %w", err)
+			}
+			s.recordConsentChange(ctx, contactID, orgID, "subscribe", source, nil, ipAddress, userAgent, "Opted back in to topic "+t.name)
+		}
+	}
+	return nil
+}
+
+// tokenTopic returns the name of an unsubscribe token's topic, if it has one
+// that still exists in the token's organization
+func (s *ComplianceService) tokenTopic(ctx context.Context, data *UnsubscribeData) (string, bool) {
+	if data.TopicID == 0 {
+		return "", false
+	}
+	var name string
+	err := s.db.QueryRowContext(ctx, `
+		SELECT name FROM subscription_topics WHERE id = $1 AND org_id = $2
+	`, data.TopicID, data.OrgID).Scan(&name)
+	if err != nil {
+		return "", false
+	}
+	return name, true
+}
+
+// optOutOfTopic opts a contact out of a topic
+func (s *ComplianceService) optOutOfTopic(ctx context.Context, orgID, contactID int64, topicID int, topicName, source, ipAddress, userAgent string) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO contact_topic_optouts (contact_id, topic_id, source, created_at)
+		VALUES ($1, $2, $3, NOW())
+		ON CONFLICT (contact_id, topic_id) DO NOTHING
+	`, contactID, topicID, source)
+	if err != nil {
+		return fmt.Errorf("failed to opt out of topic: %w", err)
+	}
+	s.recordConsentChange(ctx, contactID, orgID, "unsubscribe", source, nil, ipAddress, userAgent, "Opted out of topic "+topicName)
+	return nil
+}
@@ -0,0 +1,194 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+)
+
+// maxSuppressionCheck is the number of addresses accepted by a single bulk check
+const maxSuppressionCheck = 1000
+
+// SuppressedRecipientError is returned when a send is rejected because one or
+// more recipients are on the suppression list
+type SuppressedRecipientError struct {
+	Suppressions []model.SuppressionDetail
+}
+
+func (e *SuppressedRecipientError) Error() string {
+	if len(e.Suppressions) == 1 {
+		sup := e.Suppressions[0]
+		return fmt.Sprintf("recipient %s is on suppression list (%s: %s, since %s)",
+			sup.Email, sup.Source, sup.Reason, sup.SuppressedAt.Format("2006-01-02"))
+	}
+
+	emails := make([]string, len(e.Suppressions))
+	for i, sup := range e.Suppressions {
+		emails[i] = sup.Email
+	}
+	return fmt.Sprintf("recipients %s are on suppression list", strings.Join(emails, ", "))
+}
+
+func (e *SuppressedRecipientError) ErrorCode() string { return apierror.CodeRecipientSuppressed }
+func (e *SuppressedRecipientError) HTTPStatus() int   { return http.StatusBadRequest }
+
+// SuppressionService checks and lifts suppressions of recipient addresses
+type SuppressionService struct {
+	db  *sql.DB
+	cfg *config.Config
+}
+
+// NewSuppressionService creates a new suppression service
+func NewSuppressionService(db *sql.DB, cfg *config.Config) *SuppressionService {
+	return &SuppressionService{db: db, cfg: cfg}
+}
+
+// Check reports which of the given addresses would be rejected at send time
+func (s *SuppressionService) Check(ctx context.Context, orgID int64, emails []string) (*model.SuppressionCheckResponse, error) {
+	if len(emails) == 0 {
+		return nil, fmt.Errorf("at least one email required")
+	}
+	if len(emails) > maxSuppressionCheck {
+		return nil, fmt.Errorf("at most %d emails can be checked at once", maxSuppressionCheck)
+	}
+
+	found, err := findSuppressions(ctx, s.db, orgID, emails)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &model.SuppressionCheckResponse{Results: make([]model.SuppressionCheckResult, len(emails))}
+	for i, email := range emails {
+		resp.Results[i] = model.SuppressionCheckResult{Email: email}
+		if sup, ok := found[email]; ok {
+			resp.Results[i].Suppressed = true
+			resp.Results[i].Suppression = sup
+			resp.SuppressedCount++
+		}
+	}
+
+	return resp, nil
+}
+
+// Remove lifts the suppression of an address, including entries for its aliases.
+// It returns the number of entries removed.
+func (s *SuppressionService) Remove(ctx context.Context, orgID int64, email string) (int64, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if !strings.Contains(email, "@") {
+		return 0, fmt.Errorf("invalid email address")
+	}
+	normalized := emailaddr.Normalize(email, emailaddr.LoadRules(ctx, s.db, orgID))
+
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM suppression_list
+		WHERE org_id = $1 AND (email = $2 OR normalized_email = $3)
+	`, orgID, email, normalized)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove suppression: %w", err)
+	}
+	removed, _ := result.RowsAffected()
+
+	// Erasures stay, so an erased contact is never mailed again
+	result, err = s.db.ExecContext(ctx, `
+		DELETE FROM suppressions
+		WHERE org_id = $1 AND reason = 'hard_bounce' AND (LOWER(email) = $2 OR normalized_email = $3)
+	`, orgID, email, normalized)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove suppression: %w", err)
+	}
+	n, _ := result.RowsAffected()
+
+	return removed + n, nil
+}
+
+// findSuppressions looks up the suppression entries blocking each address, matching
+// both the literal address and its canonical form. Marketing unsubscribes are not
+// checked, as they don't stop transactional sends. Addresses that are not
+// suppressed are absent from the result.
+func findSuppressions(ctx context.Context, db *sql.DB, orgID int64, emails []string) (map[string]*model.SuppressionDetail, error) {
+	rules := emailaddr.LoadRules(ctx, db, orgID)
+	lowered := make([]string, len(emails))
+	normalized := make([]string, len(emails))
+	for i, email := range emails {
+		lowered[i] = strings.ToLower(strings.TrimSpace(email))
+		normalized[i] = emailaddr.Normalize(email, rules)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT email, COALESCE(normalized_email, ''), COALESCE(reason, ''), COALESCE(source, 'manual'), created_at
+		FROM suppression_list
+		WHERE org_id = $1 AND (email = ANY($2) OR normalized_email = ANY($3))
+		UNION ALL
+		SELECT LOWER(email), COALESCE(normalized_email, ''), reason,
+			CASE reason WHEN 'hard_bounce' THEN 'bounce' ELSE 'manual' END, created_at
+		FROM suppressions
+		WHERE org_id = $1 AND reason IN ('hard_bounce', 'gdpr_erasure')
+			AND (LOWER(email) = ANY($2) OR normalized_email = ANY($3))
+		ORDER BY created_at DESC
+	`, orgID, pq.Array(lowered), pq.Array(normalized))
+	if err != nil {
+		return nil, fmt.Errorf("failed to check suppression list: %w", err)
+	}
+	defer rows.Close()
+
+	type entry struct {
+		email, normalized, reason, source string
+		createdAt                         time.Time
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.email, &e.normalized, &e.reason, &e.source, &e.createdAt); err != nil {
+			continue
+		}
+		entries = append(entries, e)
+	}
+
+	found := make(map[string]*model.SuppressionDetail)
+	for i, email := range emails {
+		for _, e := range entries {
+			if e.email != lowered[i] && e.normalized != normalized[i] {
+				continue
+			}
+			found[email] = &model.SuppressionDetail{
+				Email:           email,
+				SuppressedEmail: e.email,
+				Reason:          e.reason,
+				Source:          suppressionSource(e.source),
+				SuppressedAt:    e.createdAt,
+			}
+			if e.reason != "gdpr_erasure" {
+				found[email].RemoveEndpoint = "DELETE /api/v1/suppressions/" + url.PathEscape(e.email)
+			}
+			break
+		}
+	}
+
+	return found, nil
+}
+
+// normalizedAddress returns the canonical form of an address under the org's rules
+func normalizedAddress(ctx context.Context, db *sql.DB, orgID int64, email string) string {
+	return emailaddr.Normalize(email, emailaddr.LoadRules(ctx, db, orgID))
+}
+
+// suppressionSource maps a stored source onto the documented set of sources
+func suppressionSource(source string) string {
+	switch source {
+	case "bounce", "complaint", "unsubscribe":
+		return source
+	default:
+		return "manual"
+	}
+}
@@ -0,0 +1,78 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dublyo/mailat/api/pkg/amphtml"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/templating"
+)
+
+// Templates can carry an AMP for Email part next to the HTML and text bodies. It
+// is checked against the AMP4Email spec when saved, and again once rendered at
+// send time. Providers only show AMP from registered senders that pass SPF, DKIM
+// and DMARC; everyone else gets the HTML body.
+
+// maxAMPProblems bounds the problems reported for an AMP part
+const maxAMPProblems = 20
+
+// ampMustache matches amp-mustache templates, which AMP renders in the mailbox
+// with its own {{tags}}, so the template engine must leave them alone
+var ampMustache = regexp.MustCompile(`(?is)<template\b[^>]*\btype\s*=\s*["']?amp-mustache["']?[^>]*>.*?</template\s*>`)
+
+// maskAMPTemplates swaps the amp-mustache templates of an AMP part for markers
+// without tags, and returns them to put back after rendering
+func maskAMPTemplates(amp string) (string, []string) {
+	var blocks []string
+	masked := ampMustache.ReplaceAllStringFunc(amp, func(block string) string {
+		blocks = append(blocks, block)
+		return fmt.Sprintf("<!--amp-mustache-%d-->", len(blocks)-1)
+	})
+	return masked, blocks
+}
+
+func unmaskAMPTemplates(amp string, blocks []string) string {
+	for i, block := range blocks {
+		amp = strings.Replace(amp, fmt.Sprintf("<!--amp-mustache-%d-->", i), block, 1)
+	}
+	return amp
+}
+
+// validateAMP checks an AMP part given on a template
+func validateAMP(amp string) error {
+	problems := amphtml.Validate(amp)
+	if len(problems) == 0 {
+		return nil
+	}
+	if len(problems) > maxAMPProblems {
+		problems = problems[:maxAMPProblems]
+	}
+	fields := make([]apierror.FieldError, len(problems))
+	for i, p := range problems {
+		fields[i] = apierror.FieldError{Field: "amp", Rule: "amp4email", Message: p.String()}
+	}
+	return &apierror.ValidationError{Fields: fields}
+}
+
+// renderAMP renders the AMP part of a template. A rendered part that no longer
+// passes the spec, say because a variable put in markup AMP forbids, is dropped
+// so the email goes out with its HTML body.
+func (s *TransactionalService) renderAMP(ctx context.Context, templateUUID, amp string, variables map[string]any, partials templating.Partials) (string, error) {
+	if amp == "" {
+		return "", nil
+	}
+	masked, blocks := maskAMPTemplates(amp)
+	rendered, err := s.renderTemplates(ctx, variables, partials, masked)
+	if err != nil {
+		return "", err
+	}
+	out := unmaskAMPTemplates(rendered[0], blocks)
+	if problems := amphtml.Validate(out); len(problems) > 0 {
+		fmt.Printf("Warning: dropping AMP part of template %s, it fails validation once rendered: %s\n", templateUUID, problems[0])
+		return "", nil
+	}
+	return out, nil
+}
@@ -0,0 +1,501 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/templating"
+)
+
+// Templates move between organizations or environments, such as from staging to
+// production, as a JSON bundle: the templates, the org partials they include and
+// the images they load. An import matches templates and partials by name, and a
+// name that is already taken is skipped, overwritten or renamed as asked. Bodies are
+// imported as exported, so MJML and designs aren't recompiled on the way.
+
+const (
+	templateBundleVersion = 1
+	maxBundleTemplates    = 500
+	maxBundlePartials     = 500
+)
+
+// What an import does with a name that is already taken
+const (
+	conflictSkip      = "skip"
+	conflictOverwrite = "overwrite"
+	conflictRename    = "rename"
+)
+
+// What happened to an imported template or partial
+const (
+	importCreated   = "created"
+	importUpdated   = "updated"
+	importRenamed   = "renamed"
+	importSkipped   = "skipped"
+	importUnchanged = "unchanged" // A partial with the same content exists
+)
+
+var imageSrcPattern = regexp.MustCompile(`(?i)<img\b[^>]*?\bsrc\s*=\s*["']([^"']+)["']`)
+var partialRefPattern = regexp.MustCompile(`\{\{\s*>\s*([A-Za-z0-9_-]+)`)
+
+// ExportTemplates bundles the given templates, or all templates of the org, with
+// the org partials they include
+func (s *TransactionalService) ExportTemplates(ctx context.Context, orgID int64, req *model.ExportTemplatesRequest) (*model.TemplateBundle, error) {
+	var templates []*model.EmailTemplate
+	if len(req.TemplateIDs) == 0 {
+		var err error
+		if templates, err = s.ListTemplates(ctx, orgID); err != nil {
+			return nil, err
+		}
+	} else {
+		for _, templateUUID := range req.TemplateIDs {
+			template, err := s.getTemplateByUUID(ctx, orgID, templateUUID)
+			if err != nil {
+				return nil, err
+			}
+			templates = append(templates, template)
+		}
+	}
+
+	orgPartials, err := s.orgPartials(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	bundle := &model.TemplateBundle{
+		Version:    templateBundleVersion,
+		ExportedAt: time.Now().UTC(),
+		Templates:  []model.TemplateBundleTemplate{},
+		Partials:   []model.TemplateBundlePartial{},
+	}
+	assets := map[string][]string{}
+	addAssets := func(name string, sources ...string) {
+		for _, src := range sources {
+			for _, u := range imageURLs(src) {
+				assets[u] = append(assets[u], name)
+			}
+		}
+	}
+
+	// Partials included by the templates, and by those partials in turn
+	included := map[string]bool{}
+	var pending []string
+	include := func(sources ...string) {
+		for _, src := range sources {
+			for _, name := range templating.PartialNames(src) {
+				if _, ok := orgPartials[name]; ok && !included[name] {
+					included[name] = true
+					pending = append(pending, name)
+				}
+			}
+		}
+	}
+
+	for _, t := range templates {
+		bt := model.TemplateBundleTemplate{
+			Name:        t.Name,
+			Description: t.Description,
+			Subject:     t.Subject,
+			HTML:        t.HTMLBody,
+			Text:        t.TextBody,
+			AMP:         t.AMPBody,
+			MJML:        t.MJML,
+			UseLayout:   t.UseLayout,
+			IsActive:    t.IsActive,
+		}
+		if len(t.Design) > 0 {
+			json.Unmarshal(t.Design, &bt.Design)
+		}
+		if len(t.VariableSchema) > 0 {
+			json.Unmarshal(t.VariableSchema, &bt.VariableSchema)
+		}
+		bundle.Templates = append(bundle.Templates, bt)
+		addAssets(t.Name, t.HTMLBody)
+		amp, _ := maskAMPTemplates(t.AMPBody)
+		include(t.Subject, t.HTMLBody, t.TextBody, amp)
+		if t.UseLayout {
+			include("{{> header}}{{> footer}}")
+		}
+	}
+	for len(pending) > 0 {
+		name := pending[0]
+		pending = pending[1:]
+		p := orgPartials[name]
+		bundle.Partials = append(bundle.Partials, model.TemplateBundlePartial{Name: p.Name, Description: p.Description, Content: p.Content})
+		addAssets(p.Name, p.Content)
+		include(p.Content)
+	}
+	sort.Slice(bundle.Partials, func(i, j int) bool { return bundle.Partials[i].Name < bundle.Partials[j].Name })
+
+	bundle.Assets = make([]model.TemplateBundleAsset, 0, len(assets))
+	for u, usedBy := range assets {
+		bundle.Assets = append(bundle.Assets, model.TemplateBundleAsset{URL: u, UsedBy: usedBy})
+	}
+	sort.Slice(bundle.Assets, func(i, j int) bool { return bundle.Assets[i].URL < bundle.Assets[j].URL })
+
+	return bundle, nil
+}
+
+// orgPartials returns the partials the org defined, by name
+func (s *TransactionalService) orgPartials(ctx context.Context, orgID int64) (map[string]*model.TemplatePartial, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT uuid, name, COALESCE(description, ''), content FROM template_partials WHERE org_id = $1
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load partials: %w", err)
+	}
+	defer rows.Close()
+
+	partials := map[string]*model.TemplatePartial{}
+	for rows.Next() {
+		var p model.TemplatePartial
+		if err := rows.Scan(&p.UUID, &p.Name, &p.Description, &p.Content); err != nil {
+			continue
+		}
+		partials[p.Name] = &p
+	}
+	return partials, nil
+}
+
+// imageURLs returns the http and https URLs of the images an HTML body loads,
+// leaving out those built by template tags
+func imageURLs(html string) []string {
+	var urls []string
+	seen := map[string]bool{}
+	for _, m := range imageSrcPattern.FindAllStringSubmatch(html, -1) {
+		src := strings.TrimSpace(m[1])
+		lower := strings.ToLower(src)
+		if strings.Contains(src, "{{") || !(strings.HasPrefix(lower, "http://") || strings.HasPrefix(lower, "https://")) {
+			continue
+		}
+		if !seen[src] {
+			seen[src] = true
+			urls = append(urls, src)
+		}
+	}
+	return urls
+}
+
+// validateBundle checks every template and partial of a bundle before anything is
+// imported, reporting fields by their position in the bundle
+func validateBundle(bundle *model.TemplateBundle) error {
+	var fields []apierror.FieldError
+	add := func(prefix string, err error) {
+		if ve, ok := err.(*apierror.ValidationError); ok {
+			for _, f := range ve.Fields {
+				f.Field = prefix + f.Field
+				fields = append(fields, f)
+			}
+		} else if err != nil {
+			fields = append(fields, apierror.FieldError{Field: strings.TrimSuffix(prefix, "."), Rule: "invalid", Message: err.Error()})
+		}
+	}
+	fail := func(field, rule, message string) {
+		fields = append(fields, apierror.FieldError{Field: field, Rule: rule, Message: message})
+	}
+
+	if bundle.Version != templateBundleVersion {
+		fail("bundle.version", "version", fmt.Sprintf("unsupported bundle version %d, expected %d", bundle.Version, templateBundleVersion))
+	}
+	if len(bundle.Templates) > maxBundleTemplates {
+		fail("bundle.templates", "max-length", fmt.Sprintf("a bundle can have at most %d templates", maxBundleTemplates))
+	}
+	if len(bundle.Partials) > maxBundlePartials {
+		fail("bundle.partials", "max-length", fmt.Sprintf("a bundle can have at most %d partials", maxBundlePartials))
+	}
+	if len(fields) > 0 {
+		return &apierror.ValidationError{Fields: fields}
+	}
+
+	partialNames := map[string]bool{}
+	for i, p := range bundle.Partials {
+		prefix := "bundle.partials." + strconv.Itoa(i) + "."
+		add(prefix, validatePartial(p.Name, p.Content))
+		if partialNames[p.Name] {
+			fail(prefix+"name", "unique", fmt.Sprintf("the bundle has more than one partial named %q", p.Name))
+		}
+		partialNames[p.Name] = true
+	}
+
+	templateNames := map[string]bool{}
+	for i, t := range bundle.Templates {
+		prefix := "bundle.templates." + strconv.Itoa(i) + "."
+		if len(strings.TrimSpace(t.Name)) < 2 {
+			fail(prefix+"name", "min-length", "name must be at least 2 characters")
+		} else if templateNames[t.Name] {
+			fail(prefix+"name", "unique", fmt.Sprintf("the bundle has more than one template named %q", t.Name))
+		}
+		templateNames[t.Name] = true
+		if t.Subject == "" {
+			fail(prefix+"subject", "required", "subject is required")
+		}
+		if t.HTML == "" {
+			fail(prefix+"html", "required", "html is required")
+		}
+		if t.AMP != "" {
+			add(prefix, validateAMP(t.AMP))
+		}
+		amp, _ := maskAMPTemplates(t.AMP)
+		add(prefix, validateTemplateSyntax(map[string]string{"subject": t.Subject, "html": t.HTML, "text": t.Text, "amp": amp}))
+		if len(t.Design) > 0 {
+			_, _, err := renderDesign(t.Design)
+			add(prefix, err)
+		}
+		if len(t.VariableSchema) > 0 {
+			_, err := parseVariableSchema(t.VariableSchema)
+			add(prefix, err)
+		}
+	}
+
+	if len(fields) > 0 {
+		return &apierror.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// freeName returns the first of name, then name with 2, 3, ... appended by suffix,
+// that isn't taken
+func freeName(name string, taken map[string]bool, suffix func(n int) string) string {
+	if !taken[name] {
+		return name
+	}
+	for n := 2; ; n++ {
+		if candidate := name + suffix(n); !taken[candidate] {
+			return candidate
+		}
+	}
+}
+
+// renamePartialRefs points {{> name}} tags at the names partials were imported under
+func renamePartialRefs(src string, renamed map[string]string) string {
+	if len(renamed) == 0 || src == "" {
+		return src
+	}
+	var b strings.Builder
+	last := 0
+	for _, m := range partialRefPattern.FindAllStringSubmatchIndex(src, -1) {
+		if name, ok := renamed[src[m[2]:m[3]]]; ok {
+			b.WriteString(src[last:m[2]])
+			b.WriteString(name)
+			last = m[3]
+		}
+	}
+	b.WriteString(src[last:])
+	return b.String()
+}
+
+// ImportTemplates imports a bundle into the org. Partials are imported first, and
+// templates that include a renamed partial are pointed at its new name. With
+// dryRun, the result reports what would happen and nothing is changed.
+func (s *TransactionalService) ImportTemplates(ctx context.Context, orgID int64, req *model.ImportTemplatesRequest) (*model.ImportTemplatesResponse, error) {
+	onConflict := req.OnConflict
+	if onConflict == "" {
+		onConflict = conflictSkip
+	}
+	if onConflict != conflictSkip && onConflict != conflictOverwrite && onConflict != conflictRename {
+		return nil, &apierror.ValidationError{Fields: []apierror.FieldError{{
+			Field:   "onConflict",
+			Rule:    "in",
+			Message: "onConflict must be skip, overwrite or rename",
+		}}}
+	}
+	bundle := &req.Bundle
+	if len(bundle.Templates) == 0 && len(bundle.Partials) == 0 {
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeInvalidRequest, "the bundle has no templates or partials")
+	}
+	if err := validateBundle(bundle); err != nil {
+		return nil, err
+	}
+
+	existingPartials, err := s.orgPartials(ctx, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	result := &model.ImportTemplatesResponse{
+		DryRun:    req.DryRun,
+		Templates: []model.TemplateImportItem{},
+		Partials:  []model.TemplateImportItem{},
+	}
+
+	// Decide what happens to each partial before writing any, as a partial may
+	// include one that gets renamed after it
+	takenPartials := map[string]bool{}
+	for name := range existingPartials {
+		takenPartials[name] = true
+	}
+	renamed := map[string]string{}
+	items := make([]model.TemplateImportItem, len(bundle.Partials))
+	for i, p := range bundle.Partials {
+		item := model.TemplateImportItem{Name: p.Name, Action: importCreated}
+		if existing, ok := existingPartials[p.Name]; ok {
+			item.UUID = existing.UUID
+			switch {
+			case existing.Content == p.Content:
+				item.Action = importUnchanged
+			case onConflict == conflictSkip:
+				item.Action = importSkipped
+			case onConflict == conflictOverwrite:
+				item.Action = importUpdated
+			default:
+				item.Name = freeName(p.Name, takenPartials, func(n int) string { return "_" + strconv.Itoa(n) })
+				item.OriginalName = p.Name
+				item.UUID = ""
+				item.Action = importRenamed
+				renamed[p.Name] = item.Name
+			}
+		}
+		takenPartials[item.Name] = true
+		items[i] = item
+	}
+
+	for i, p := range bundle.Partials {
+		item := &items[i]
+		content := renamePartialRefs(p.Content, renamed)
+		switch item.Action {
+		case importCreated, importRenamed:
+			item.UUID = uuid.New().String()
+			_, err = tx.ExecContext(ctx, `
+				INSERT INTO template_partials (uuid, org_id, name, description, content, updated_at)
+				VALUES ($1, $2, $3, NULLIF($4, ''), $5, NOW())
+			`, item.UUID, orgID, item.Name, p.Description, content)
+		case importUpdated:
+			_, err = tx.ExecContext(ctx, `
+				UPDATE template_partials SET description = NULLIF($1, ''), content = $2, updated_at = NOW()
+				WHERE uuid = $3 AND org_id = $4
+			`, p.Description, content, item.UUID, orgID)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to import partial %q: %w", p.Name, err)
+		}
+		result.Partials = append(result.Partials, *item)
+	}
+
+	// Templates match the most recently updated template of the same name
+	existingTemplates := map[string]string{}
+	rows, err := tx.QueryContext(ctx, `
+		SELECT uuid, name FROM email_templates WHERE org_id = $1 ORDER BY updated_at DESC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load templates: %w", err)
+	}
+	for rows.Next() {
+		var templateUUID, name string
+		if err := rows.Scan(&templateUUID, &name); err == nil {
+			if _, ok := existingTemplates[name]; !ok {
+				existingTemplates[name] = templateUUID
+			}
+		}
+	}
+	rows.Close()
+	takenTemplates := map[string]bool{}
+	for name := range existingTemplates {
+		takenTemplates[name] = true
+	}
+
+	for _, t := range bundle.Templates {
+		item := model.TemplateImportItem{Name: t.Name, Action: importCreated}
+		if existingUUID, ok := existingTemplates[t.Name]; ok {
+			switch onConflict {
+			case conflictSkip:
+				item.UUID = existingUUID
+				item.Action = importSkipped
+			case conflictOverwrite:
+				item.UUID = existingUUID
+				item.Action = importUpdated
+			default:
+				item.Name = freeName(t.Name, takenTemplates, func(n int) string { return " (" + strconv.Itoa(n) + ")" })
+				item.OriginalName = t.Name
+				item.Action = importRenamed
+			}
+		}
+		takenTemplates[item.Name] = true
+
+		if item.Action != importSkipped {
+			if err := s.writeBundleTemplate(ctx, tx, orgID, &item, t, renamed); err != nil {
+				return nil, err
+			}
+		}
+		result.Templates = append(result.Templates, item)
+	}
+
+	if req.DryRun {
+		// Nothing is kept, so new templates and partials have no UUID yet
+		for _, list := range [][]model.TemplateImportItem{result.Partials, result.Templates} {
+			for i := range list {
+				if list[i].Action == importCreated || list[i].Action == importRenamed {
+					list[i].UUID = ""
+				}
+			}
+		}
+		return result, nil
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to import templates: %w", err)
+	}
+	return result, nil
+}
+
+// writeBundleTemplate creates or overwrites a template from a bundle
+func (s *TransactionalService) writeBundleTemplate(ctx context.Context, tx *sql.Tx, orgID int64, item *model.TemplateImportItem, t model.TemplateBundleTemplate, renamed map[string]string) error {
+	subject := renamePartialRefs(t.Subject, renamed)
+	htmlBody := renamePartialRefs(t.HTML, renamed)
+	textBody := renamePartialRefs(t.Text, renamed)
+	ampBody := renamePartialRefs(t.AMP, renamed)
+	mjml := renamePartialRefs(t.MJML, renamed)
+	amp, _ := maskAMPTemplates(ampBody)
+	variablesJSON, _ := json.Marshal(s.extractVariables(subject, htmlBody, textBody, amp))
+
+	var design, variableSchema sql.NullString
+	if len(t.Design) > 0 {
+		data, _ := json.Marshal(t.Design)
+		design = sql.NullString{String: renamePartialRefs(string(data), renamed), Valid: true}
+	}
+	if len(t.VariableSchema) > 0 {
+		schema, err := parseVariableSchema(t.VariableSchema)
+		if err != nil {
+			return err
+		}
+		variableSchema = sql.NullString{String: schema, Valid: true}
+	}
+
+	var err error
+	if item.Action == importUpdated {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE email_templates SET description = $1, subject = $2, html_body = $3, text_body = $4,
+				mjml_source = NULLIF($5, ''), design = $6, variables = $7, variable_schema = $8,
+				use_layout = $9, is_active = $10, amp_body = NULLIF($11, ''), updated_at = NOW()
+			WHERE uuid = $12 AND org_id = $13
+		`, t.Description, subject, htmlBody, textBody, mjml, design, string(variablesJSON), variableSchema,
+			t.UseLayout, t.IsActive, ampBody, item.UUID, orgID)
+	} else {
+		item.UUID = uuid.New().String()
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO email_templates (uuid, org_id, name, description, subject, html_body, text_body, amp_body, mjml_source, design, variables, variable_schema, use_layout, is_active, updated_at)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10, $11, $12, $13, $14, NOW())
+		`, item.UUID, orgID, item.Name, t.Description, subject, htmlBody, textBody, ampBody, mjml, design,
+			string(variablesJSON), variableSchema, t.UseLayout, t.IsActive)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to import template %q: %w", t.Name, err)
+	}
+	return nil
+}
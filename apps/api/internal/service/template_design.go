@@ -0,0 +1,50 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/emaildesign"
+)
+
+// Templates built in the drag-and-drop editor are saved as a block design. The
+// design is stored with the template and rendered to its HTML body on save, by the
+// same renderer the editor previews with, so both always show the same email.
+
+// renderDesign checks a design and renders it, returning the HTML body and the
+// design to store
+func renderDesign(design map[string]any) (string, sql.NullString, error) {
+	data, err := json.Marshal(design)
+	if err != nil {
+		return "", sql.NullString{}, fmt.Errorf("failed to encode design: %w", err)
+	}
+	parsed, err := emaildesign.Parse(data)
+	if err != nil {
+		field := "design"
+		var designErr *emaildesign.Error
+		if errors.As(err, &designErr) && designErr.Path != "" {
+			field += "." + designErr.Path
+		}
+		return "", sql.NullString{}, &apierror.ValidationError{Fields: []apierror.FieldError{{
+			Field:   field,
+			Rule:    "design",
+			Message: err.Error(),
+		}}}
+	}
+
+	return emaildesign.Render(parsed), sql.NullString{String: string(data), Valid: true}, nil
+}
+
+// RenderDesign renders a design to the HTML body a template saved with it gets,
+// without saving it. Template tags are left unrendered.
+func (s *TransactionalService) RenderDesign(design map[string]any) (*model.RenderDesignResponse, error) {
+	html, _, err := renderDesign(design)
+	if err != nil {
+		return nil, err
+	}
+	return &model.RenderDesignResponse{HTML: html}, nil
+}
@@ -0,0 +1,153 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// Templates can be written in MJML. The source is compiled to responsive HTML when
+// the template is saved, with the mjml CLI or an MJML render API, and both are
+// stored so the source can be edited later while sends use the compiled HTML.
+
+// mjmlCompileTimeout bounds one compilation
+const mjmlCompileTimeout = 15 * time.Second
+
+// MJMLCompileError is returned when MJML source does not compile
+type MJMLCompileError struct {
+	Messages []string
+}
+
+func (e *MJMLCompileError) Error() string {
+	if len(e.Messages) == 0 {
+		return "invalid MJML"
+	}
+	return "invalid MJML: " + strings.Join(e.Messages, "; ")
+}
+
+func (e *MJMLCompileError) ErrorCode() string { return apierror.CodeTemplateInvalid }
+func (e *MJMLCompileError) HTTPStatus() int   { return http.StatusBadRequest }
+
+// templateBody returns the HTML body of a template saved with one of an HTML body,
+// MJML source or a block design, and the design to store with it
+func (s *TransactionalService) templateBody(ctx context.Context, html, mjml string, design map[string]any, required bool) (string, sql.NullString, error) {
+	field := func(name, rule, message string) error {
+		return &apierror.ValidationError{Fields: []apierror.FieldError{{Field: name, Rule: rule, Message: message}}}
+	}
+	switch {
+	case len(design) > 0 && (html != "" || mjml != ""):
+		return "", sql.NullString{}, field("design", "exclusive", "provide one of html, mjml or design")
+	case html != "" && mjml != "":
+		return "", sql.NullString{}, field("mjml", "exclusive", "provide html or mjml, not both")
+	case len(design) > 0:
+		return renderDesign(design)
+	case mjml != "":
+		body, err := s.compileMJML(ctx, mjml)
+		return body, sql.NullString{}, err
+	case html == "" && required:
+		return "", sql.NullString{}, field("html", "required", "html, mjml or design required")
+	}
+	return html, sql.NullString{}, nil
+}
+
+// compileMJML compiles MJML source to HTML with the configured compiler. Invalid
+// markup is rejected rather than rendered leniently.
+func (s *TransactionalService) compileMJML(ctx context.Context, source string) (string, error) {
+	if !strings.Contains(source, "<mjml") {
+		return "", &MJMLCompileError{Messages: []string{"source must have an <mjml> root element"}}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, mjmlCompileTimeout)
+	defer cancel()
+
+	if s.cfg.MJMLAPIURL != "" {
+		return mjmlRenderAPI(ctx, s.cfg.MJMLAPIURL, s.cfg.MJMLAppID, s.cfg.MJMLSecretKey, source)
+	}
+	if s.cfg.MJMLBinary == "" {
+		return "", apierror.New(http.StatusBadRequest, apierror.CodeTemplateInvalid, "MJML templates are not supported: no MJML compiler is configured")
+	}
+	return mjmlCLI(ctx, s.cfg.MJMLBinary, source)
+}
+
+// mjmlCLI compiles with the mjml command line tool, reading the source from stdin
+func mjmlCLI(ctx context.Context, binary, source string) (string, error) {
+	cmd := exec.CommandContext(ctx, binary, "-i", "-s", "--config.validationLevel=strict", "--config.minify=false")
+	cmd.Stdin = strings.NewReader(source)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if errors.Is(err, exec.ErrNotFound) {
+		return "", apierror.New(http.StatusBadRequest, apierror.CodeTemplateInvalid, "MJML templates are not supported: the mjml compiler is not installed")
+	}
+	if ctx.Err() != nil {
+		return "", fmt.Errorf("MJML compilation timed out")
+	}
+	if err != nil {
+		var messages []string
+		for _, line := range strings.Split(stderr.String(), "\n") {
+			if line = strings.TrimSpace(line); line != "" {
+				messages = append(messages, line)
+			}
+		}
+		return "", &MJMLCompileError{Messages: messages}
+	}
+	return stdout.String(), nil
+}
+
+// mjmlRenderAPI compiles with an MJML render API (the mjml.io API, or a self-hosted
+// server compatible with it)
+func mjmlRenderAPI(ctx context.Context, url, appID, secretKey, source string) (string, error) {
+	body, _ := json.Marshal(map[string]string{"mjml": source})
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if appID != "" {
+		req.SetBasicAuth(appID, secretKey)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("MJML render request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var result struct {
+		HTML    string `json:"html"`
+		Message string `json:"message"`
+		Errors  []struct {
+			Line    int    `json:"line"`
+			Message string `json:"message"`
+		} `json:"errors"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", fmt.Errorf("failed to decode MJML render response: %w", err)
+	}
+
+	if len(result.Errors) > 0 {
+		compileErr := &MJMLCompileError{}
+		for _, e := range result.Errors {
+			compileErr.Messages = append(compileErr.Messages, fmt.Sprintf("line %d: %s", e.Line, e.Message))
+		}
+		return "", compileErr
+	}
+	if resp.StatusCode == http.StatusBadRequest {
+		return "", &MJMLCompileError{Messages: []string{result.Message}}
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("MJML render API returned status %d", resp.StatusCode)
+	}
+	return result.HTML, nil
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/templatepartial"
+	"github.com/dublyo/mailat/api/pkg/templating"
+)
+
+// Partials are snippets templates include with {{> name}}. The org's own are
+// managed here; package templatepartial loads them with the built-in header,
+// footer and button, and lays out templates with them.
+
+// validatePartial checks the name and content of a partial
+func validatePartial(name, content string) error {
+	var fields []apierror.FieldError
+	if !templating.ValidPartialName(name) {
+		fields = append(fields, apierror.FieldError{Field: "name", Rule: "partial-name", Message: "name may only contain letters, digits, dashes and underscores"})
+	}
+	if _, err := templating.Parse(content); err != nil {
+		fields = append(fields, apierror.FieldError{Field: "content", Rule: "template", Message: err.Error()})
+	}
+	if len(fields) > 0 {
+		return &apierror.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// ListPartials returns the org's partials and the built-in partials it hasn't replaced
+func (s *TransactionalService) ListPartials(ctx context.Context, orgID int64) ([]*model.TemplatePartial, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT uuid, name, COALESCE(description, ''), content, created_at, updated_at
+		FROM template_partials
+		WHERE org_id = $1
+		ORDER BY name ASC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list partials: %w", err)
+	}
+	defer rows.Close()
+
+	partials := []*model.TemplatePartial{}
+	defined := map[string]bool{}
+	for rows.Next() {
+		var p model.TemplatePartial
+		var createdAt, updatedAt time.Time
+		if err := rows.Scan(&p.UUID, &p.Name, &p.Description, &p.Content, &createdAt, &updatedAt); err != nil {
+			continue
+		}
+		p.CreatedAt, p.UpdatedAt = &createdAt, &updatedAt
+		defined[p.Name] = true
+		partials = append(partials, &p)
+	}
+
+	builtIn, err := templatepartial.BuiltIn(ctx, s.db, orgID)
+	if err != nil {
+		return nil, err
+	}
+	for name, content := range builtIn {
+		if !defined[name] {
+			partials = append(partials, &model.TemplatePartial{Name: name, Content: content, BuiltIn: true})
+		}
+	}
+	sort.SliceStable(partials, func(i, j int) bool { return partials[i].Name < partials[j].Name })
+
+	return partials, nil
+}
+
+// GetPartial returns a partial of the org by UUID
+func (s *TransactionalService) GetPartial(ctx context.Context, orgID int64, partialUUID string) (*model.TemplatePartial, error) {
+	var p model.TemplatePartial
+	var createdAt, updatedAt time.Time
+	err := s.db.QueryRowContext(ctx, `
+		SELECT uuid, name, COALESCE(description, ''), content, created_at, updated_at
+		FROM template_partials
+		WHERE uuid = $1 AND org_id = $2
+	`, partialUUID, orgID).Scan(&p.UUID, &p.Name, &p.Description, &p.Content, &createdAt, &updatedAt)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodePartialNotFound, "partial not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get partial: %w", err)
+	}
+	p.CreatedAt, p.UpdatedAt = &createdAt, &updatedAt
+	return &p, nil
+}
+
+// partialNameTaken reports whether another partial of the org has the name
+func (s *TransactionalService) partialNameTaken(ctx context.Context, orgID int64, name, exceptUUID string) (bool, error) {
+	var taken bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM template_partials WHERE org_id = $1 AND name = $2 AND uuid::text <> $3)
+	`, orgID, name, exceptUUID).Scan(&taken)
+	if err != nil {
+		return false, fmt.Errorf("failed to check partial name: %w", err)
+	}
+	return taken, nil
+}
+
+// CreatePartial creates a partial. A partial named header, footer or button
+// replaces the built-in one.
+func (s *TransactionalService) CreatePartial(ctx context.Context, orgID int64, req *model.CreateTemplatePartialRequest) (*model.TemplatePartial, error) {
+	req.Name = strings.TrimSpace(req.Name)
+	if err := validatePartial(req.Name, req.Content); err != nil {
+		return nil, err
+	}
+	taken, err := s.partialNameTaken(ctx, orgID, req.Name, "")
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, apierror.Newf(http.StatusConflict, apierror.CodeConflict, "a partial named %q already exists", req.Name)
+	}
+
+	partialUUID := uuid.New().String()
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO template_partials (uuid, org_id, name, description, content, updated_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, NOW())
+	`, partialUUID, orgID, req.Name, req.Description, req.Content)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create partial: %w", err)
+	}
+
+	return s.GetPartial(ctx, orgID, partialUUID)
+}
+
+// UpdatePartial updates a partial. Templates that include it use the new content
+// from their next send.
+func (s *TransactionalService) UpdatePartial(ctx context.Context, orgID int64, partialUUID string, req *model.UpdateTemplatePartialRequest) (*model.TemplatePartial, error) {
+	partial, err := s.GetPartial(ctx, orgID, partialUUID)
+	if err != nil {
+		return nil, err
+	}
+	if name := strings.TrimSpace(req.Name); name != "" {
+		partial.Name = name
+	}
+	if req.Description != nil {
+		partial.Description = *req.Description
+	}
+	if req.Content != "" {
+		partial.Content = req.Content
+	}
+
+	if err := validatePartial(partial.Name, partial.Content); err != nil {
+		return nil, err
+	}
+	taken, err := s.partialNameTaken(ctx, orgID, partial.Name, partialUUID)
+	if err != nil {
+		return nil, err
+	}
+	if taken {
+		return nil, apierror.Newf(http.StatusConflict, apierror.CodeConflict, "a partial named %q already exists", partial.Name)
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE template_partials SET name = $1, description = NULLIF($2, ''), content = $3, updated_at = NOW()
+		WHERE uuid = $4 AND org_id = $5
+	`, partial.Name, partial.Description, partial.Content, partialUUID, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to update partial: %w", err)
+	}
+
+	return s.GetPartial(ctx, orgID, partialUUID)
+}
+
+// DeletePartial deletes a partial. Deleting a replacement of a built-in partial
+// restores the built-in one.
+func (s *TransactionalService) DeletePartial(ctx context.Context, orgID int64, partialUUID string) error {
+	result, err := s.db.ExecContext(ctx, `
+		DELETE FROM template_partials WHERE uuid = $1 AND org_id = $2
+	`, partialUUID, orgID)
+	if err != nil {
+		return fmt.Errorf("failed to delete partial: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return apierror.New(http.StatusNotFound, apierror.CodePartialNotFound, "partial not found")
+	}
+
+	return nil
+}
@@ -0,0 +1,75 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/templating"
+)
+
+// A template can declare the variables it expects as a JSON schema. Sends with
+// the template are checked against it before they are queued, and the defaults it
+// declares fill in missing variables.
+
+// TemplateVariablesError is returned when a send's variables don't match the
+// template's variable schema
+type TemplateVariablesError struct {
+	Fields []apierror.FieldError
+}
+
+func (e *TemplateVariablesError) Error() string {
+	if len(e.Fields) == 1 {
+		return fmt.Sprintf("variable %s %s", e.Fields[0].Field, e.Fields[0].Message)
+	}
+	return fmt.Sprintf("%d variables don't match the template's schema", len(e.Fields))
+}
+
+func (e *TemplateVariablesError) ErrorCode() string                  { return apierror.CodeVariablesInvalid }
+func (e *TemplateVariablesError) HTTPStatus() int                    { return http.StatusUnprocessableEntity }
+func (e *TemplateVariablesError) FieldErrors() []apierror.FieldError { return e.Fields }
+
+// parseVariableSchema checks a variable schema given on a template and returns it
+// encoded for storage
+func parseVariableSchema(schema map[string]any) (string, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return "", fmt.Errorf("failed to encode variable schema: %w", err)
+	}
+	if _, err := templating.ParseSchema(data); err != nil {
+		return "", &apierror.ValidationError{Fields: []apierror.FieldError{{
+			Field:   "variableSchema",
+			Rule:    "schema",
+			Message: err.Error(),
+		}}}
+	}
+	return string(data), nil
+}
+
+// applyVariableSchema checks variables against the template's schema and returns
+// them with defaults filled in. Templates without a schema take any variables.
+// When strict is false, variables that don't match are let through, as previews
+// render whatever they are given.
+func applyVariableSchema(template *model.EmailTemplate, variables map[string]any, strict bool) (map[string]any, error) {
+	if len(template.VariableSchema) == 0 {
+		return variables, nil
+	}
+	schema, err := templating.ParseSchema(template.VariableSchema)
+	if err != nil {
+		// Schemas are checked when saved, so this one predates a stricter check
+		fmt.Printf("Warning: ignoring variable schema of template %s: %v\n", template.UUID, err)
+		return variables, nil
+	}
+
+	filled, errs := schema.Validate(variables)
+	if len(errs) > 0 && strict {
+		fields := make([]apierror.FieldError, len(errs))
+		for i, e := range errs {
+			fields[i] = apierror.FieldError{Field: "variables." + e.Path, Rule: e.Rule, Message: e.Message}
+		}
+		return nil, &TemplateVariablesError{Fields: fields}
+	}
+	return filled, nil
+}
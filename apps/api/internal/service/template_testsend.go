@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// A template or campaign can be sent as a test to the org's members and a short
+// list of extra addresses. Test sends go through the normal pipeline but are
+// flagged on the email, so they stay out of analytics and don't count toward
+// quotas.
+
+// Test send limits
+const (
+	maxTestRecipients     = 10 // Extra addresses the org may allowlist
+	maxTestSendRecipients = 5  // Recipients of one test send
+	testSubjectPrefix     = "[Test] "
+)
+
+// loadTestRecipients returns the extra addresses the org allows test sends to
+func loadTestRecipients(ctx context.Context, db *sql.DB, orgID int64) []string {
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'testRecipients' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return []string{}
+	}
+
+	addresses := []string{}
+	json.Unmarshal([]byte(raw.String), &addresses)
+	return addresses
+}
+
+// testRecipientAllowed reports whether test sends may go to the recipient: a
+// member of the org or an allowlisted address
+func (s *TransactionalService) testRecipientAllowed(ctx context.Context, orgID int64, allowlist []string, recipient string) (bool, error) {
+	for _, address := range allowlist {
+		if strings.EqualFold(address, recipient) {
+			return true, nil
+		}
+	}
+
+	var member bool
+	err := s.db.QueryRowContext(ctx, `
+		SELECT EXISTS(SELECT 1 FROM users WHERE org_id = $1 AND LOWER(email) = LOWER($2))
+	`, orgID, recipient).Scan(&member)
+	if err != nil {
+		return false, fmt.Errorf("failed to check test recipient: %w", err)
+	}
+	return member, nil
+}
+
+// TestSendTemplate renders a template with the given variables and sends it to
+// allowlisted addresses as test traffic
+func (s *TransactionalService) TestSendTemplate(ctx context.Context, orgID, apiKeyID int64, templateUUID string, req *model.TestSendTemplateRequest) (*model.SendEmailResponse, error) {
+	variables := req.Variables
+	if variables == nil {
+		variables = map[string]any{}
+	}
+	return s.sendTest(ctx, orgID, apiKeyID, &model.SendEmailRequest{
+		From:       req.From,
+		To:         req.To,
+		TemplateID: templateUUID,
+		Variables:  variables,
+	})
+}
+
+// sendTest sends an email as test traffic, once its recipients are checked
+// against the test send limits
+func (s *TransactionalService) sendTest(ctx context.Context, orgID, apiKeyID int64, req *model.SendEmailRequest) (*model.SendEmailResponse, error) {
+	if len(req.To) > maxTestSendRecipients {
+		return nil, &apierror.ValidationError{Fields: []apierror.FieldError{{
+			Field:   "to",
+			Rule:    "max-length",
+			Message: fmt.Sprintf("a test send can go to at most %d recipients", maxTestSendRecipients),
+		}}}
+	}
+
+	allowlist := loadTestRecipients(ctx, s.db, orgID)
+	var denied []string
+	for _, to := range req.To {
+		ok, err := s.testRecipientAllowed(ctx, orgID, allowlist, strings.TrimSpace(to))
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			denied = append(denied, to)
+		}
+	}
+	if len(denied) > 0 {
+		return nil, apierror.Newf(http.StatusForbidden, apierror.CodeTestRecipientDenied,
+			"test sends can only go to members of the organization or allowlisted addresses: %s", strings.Join(denied, ", "))
+	}
+
+	return s.sendEmail(ctx, orgID, apiKeyID, req, true)
+}
@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+)
+
+// Received and sent emails are grouped into conversations by their thread_id.
+// A message joins the thread of the messages its In-Reply-To and References
+// headers name (RFC 5322 section 3.6.4), or failing that the thread of a
+// recent message exchanged with the same correspondent whose subject is the
+// same once reply and forward prefixes are removed. Otherwise it starts a
+// thread named after the root of its references, so a reply that arrives
+// before the message it answers still ends up in that message's thread.
+
+// threadSubjectWindow is how far back a subject can match an earlier message
+const threadSubjectWindow = 30 * 24 * time.Hour
+
+// replyPrefix matches the reply and forward prefixes of a subject, in English
+// and the other languages mail clients commonly write them in
+var replyPrefix = regexp.MustCompile(`(?i)^\s*((re|fwd?|aw|sv|wg)(\[\d+\])?\s*:\s*)+`)
+
+// messageIDPattern matches the msg-id tokens of an In-Reply-To or References
+// header
+var messageIDPattern = regexp.MustCompile(`<[^<>\s]+>`)
+
+// threadMessage is what threading needs to know about a message
+type threadMessage struct {
+	IdentityID    int64
+	MessageID     string
+	InReplyTo     string
+	References    []string
+	Subject       string
+	Correspondent string // The address the message is from, or to when it was sent
+}
+
+// parseMessageIDs returns the message IDs in an In-Reply-To or References
+// header, in order
+func parseMessageIDs(value string) []string {
+	ids := messageIDPattern.FindAllString(value, -1)
+	if len(ids) == 0 {
+		// Some clients leave out the angle brackets
+		for _, field := range strings.Fields(value) {
+			if strings.Contains(field, "@") {
+				ids = append(ids, formatMessageID(field))
+			}
+		}
+	}
+	return ids
+}
+
+// threadSubject returns a subject as threads compare it: without reply and
+// forward prefixes, with its whitespace collapsed, in lower case
+func threadSubject(subject string) string {
+	subject = replyPrefix.ReplaceAllString(subject, "")
+	return strings.ToLower(strings.Join(strings.Fields(subject), " "))
+}
+
+// newThreadID names a thread after the message it starts with
+func newThreadID(messageID string) string {
+	hash := sha256.Sum256([]byte(messageID))
+	return hex.EncodeToString(hash[:8])
+}
+
+// resolveThread returns the thread a message belongs to, among the emails of
+// its identity
+func resolveThread(ctx context.Context, db *sql.DB, m threadMessage) string {
+	refs := slices.Clone(m.References)
+	if m.InReplyTo != "" && !slices.Contains(refs, m.InReplyTo) {
+		refs = append(refs, m.InReplyTo)
+	}
+
+	var threadID string
+	if len(refs) > 0 {
+		// Messages sent through SES are known by their SES ID, which is the
+		// local part of the Message-ID SES gives them
+		var sesIDs []string
+		for _, ref := range refs {
+			local, domain, _ := strings.Cut(strings.Trim(ref, "<>"), "@")
+			if strings.HasSuffix(domain, "amazonses.com") {
+				sesIDs = append(sesIDs, local)
+			}
+		}
+		err := db.QueryRowContext(ctx, `
+			SELECT thread_id FROM received_emails
+			WHERE identity_id = $1 AND thread_id IS NOT NULL AND thread_id != ''
+			AND (message_id = ANY($2) OR ses_message_id = ANY($3))
+			ORDER BY received_at DESC LIMIT 1
+		`, m.IdentityID, pq.Array(refs), pq.Array(sesIDs)).Scan(&threadID)
+		if err == nil {
+			return threadID
+		}
+	}
+
+	// Only replies and forwards fall back to their subject, so unrelated
+	// messages that happen to share one stay apart
+	subject := threadSubject(m.Subject)
+	if subject != "" && m.Correspondent != "" && (len(refs) > 0 || replyPrefix.MatchString(m.Subject)) {
+		err := db.QueryRowContext(ctx, `
+			SELECT thread_id FROM received_emails
+			WHERE identity_id = $1 AND thread_subject = $2 AND thread_id IS NOT NULL AND thread_id != ''
+			AND received_at > $3 AND (LOWER(from_email) = $4 OR $4 = ANY(to_emails))
+			ORDER BY received_at DESC LIMIT 1
+		`, m.IdentityID, subject, time.Now().Add(-threadSubjectWindow), strings.ToLower(m.Correspondent)).Scan(&threadID)
+		if err == nil {
+			return threadID
+		}
+	}
+
+	root := m.MessageID
+	if len(m.References) > 0 {
+		root = m.References[0]
+	} else if m.InReplyTo != "" {
+		root = m.InReplyTo
+	}
+	return newThreadID(root)
+}
+
+// headerValue returns the value of a message's header, matched case
+// insensitively
+func headerValue(headers []model.SESHeader, name string) string {
+	for _, h := range headers {
+		if strings.EqualFold(h.Name, name) {
+			return h.Value
+		}
+	}
+	return ""
+}
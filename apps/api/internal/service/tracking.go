@@ -2,33 +2,26 @@ package service
 
 import (
 	"context"
-	"crypto/hmac"
-	"crypto/sha256"
 	"database/sql"
-	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"net/url"
-	"strings"
 	"time"
 
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/pkg/engagement"
+	"github.com/dublyo/mailat/api/pkg/tracking"
 )
 
 // TrackingService handles email open and click tracking
 type TrackingService struct {
-	db  *sql.DB
-	cfg *config.Config
+	db      *sql.DB
+	cfg     *config.Config
+	tracker *tracking.Tracker
 }
 
 // TrackingData contains encoded tracking information
-type TrackingData struct {
-	EmailID    int64  `json:"e"`
-	CampaignID int    `json:"c,omitempty"`
-	ContactID  int64  `json:"ct,omitempty"`
-	LinkID     string `json:"l,omitempty"`
-	TargetURL  string `json:"u,omitempty"`
-}
+type TrackingData = tracking.Data
 
 // OpenEvent represents an email open event
 type OpenEvent struct {
@@ -53,51 +46,28 @@ type ClickEvent struct {
 }
 
 func NewTrackingService(db *sql.DB, cfg *config.Config) *TrackingService {
-	return &TrackingService{db: db, cfg: cfg}
+	return &TrackingService{db: db, cfg: cfg, tracker: tracking.New(cfg.APIUrl, cfg.JWTSecret)}
 }
 
 // GenerateTrackingPixelURL generates a tracking pixel URL for an email
 func (s *TrackingService) GenerateTrackingPixelURL(emailID int64, campaignID int, contactID int64) string {
-	data := TrackingData{
-		EmailID:    emailID,
-		CampaignID: campaignID,
-		ContactID:  contactID,
-	}
-
-	token := s.encodeTrackingData(data)
-	baseURL := s.cfg.APIUrl
-	if baseURL == "" {
-		baseURL = "http://localhost:3001"
-	}
-
-	return fmt.Sprintf("%s/api/v1/tracking/open/%s.gif", baseURL, token)
+	return s.tracker.PixelURL(emailID, campaignID, contactID)
 }
 
 // GenerateClickTrackingURL wraps a URL with click tracking
 func (s *TrackingService) GenerateClickTrackingURL(emailID int64, campaignID int, contactID int64, targetURL string, linkID string) string {
-	data := TrackingData{
-		EmailID:    emailID,
-		CampaignID: campaignID,
-		ContactID:  contactID,
-		LinkID:     linkID,
-		TargetURL:  targetURL,
-	}
-
-	token := s.encodeTrackingData(data)
-	baseURL := s.cfg.APIUrl
-	if baseURL == "" {
-		baseURL = "http://localhost:3001"
-	}
-
-	return fmt.Sprintf("%s/api/v1/tracking/click/%s", baseURL, token)
+	return s.tracker.ClickURL(emailID, campaignID, contactID, targetURL, linkID)
 }
 
 // ProcessOpenEvent processes an email open event
 func (s *TrackingService) ProcessOpenEvent(ctx context.Context, token string, ipAddress string, userAgent string) error {
-	data, err := s.decodeTrackingData(token)
+	data, err := s.tracker.Decode(token)
 	if err != nil {
 		return fmt.Errorf("invalid tracking token")
 	}
+	if data.SentEmail != "" {
+		return s.recordSentEvent(ctx, data, "opened", ipAddress, userAgent)
+	}
 
 	// Record the open event
 	_, err = s.db.ExecContext(ctx, `
@@ -129,15 +99,16 @@ func (s *TrackingService) ProcessOpenEvent(ctx context.Context, token string, ip
 		`, data.CampaignID)
 	}
 
-	// Update contact engagement
+	// Update contact engagement. The score counts the event in full until the
+	// scheduled recompute decays it.
 	if data.ContactID > 0 {
 		s.db.ExecContext(ctx, `
 			UPDATE contacts SET
 				last_engaged_at = NOW(),
-				engagement_score = engagement_score + 1,
+				engagement_score = LEAST($2, COALESCE(engagement_score, 0) + $3),
 				updated_at = NOW()
 			WHERE id = $1
-		`, data.ContactID)
+		`, data.ContactID, engagement.MaxScore, engagement.OpenPoints)
 	}
 
 	return nil
@@ -145,10 +116,13 @@ func (s *TrackingService) ProcessOpenEvent(ctx context.Context, token string, ip
 
 // ProcessClickEvent processes a link click event
 func (s *TrackingService) ProcessClickEvent(ctx context.Context, token string, ipAddress string, userAgent string) (string, error) {
-	data, err := s.decodeTrackingData(token)
+	data, err := s.tracker.Decode(token)
 	if err != nil {
 		return "", fmt.Errorf("invalid tracking token")
 	}
+	if data.SentEmail != "" {
+		return data.TargetURL, s.recordSentEvent(ctx, data, "clicked", ipAddress, userAgent)
+	}
 
 	// Record the click event
 	eventData := map[string]string{
@@ -188,15 +162,16 @@ func (s *TrackingService) ProcessClickEvent(ctx context.Context, token string, i
 		`, data.CampaignID)
 	}
 
-	// Update contact engagement
+	// Update contact engagement. The score counts the event in full until the
+	// scheduled recompute decays it.
 	if data.ContactID > 0 {
 		s.db.ExecContext(ctx, `
 			UPDATE contacts SET
 				last_engaged_at = NOW(),
-				engagement_score = engagement_score + 2,
+				engagement_score = LEAST($2, COALESCE(engagement_score, 0) + $3),
 				updated_at = NOW()
 			WHERE id = $1
-		`, data.ContactID)
+		`, data.ContactID, engagement.MaxScore, engagement.ClickPoints)
 	}
 
 	return data.TargetURL, nil
@@ -204,118 +179,7 @@ func (s *TrackingService) ProcessClickEvent(ctx context.Context, token string, i
 
 // ProcessEmailContent adds tracking to email HTML content
 func (s *TrackingService) ProcessEmailContent(emailID int64, campaignID int, contactID int64, htmlContent string) string {
-	if htmlContent == "" {
-		return htmlContent
-	}
-
-	// Add tracking pixel before closing body tag
-	trackingPixel := fmt.Sprintf(`<img src="%s" width="1" height="1" style="display:none" alt="" />`,
-		s.GenerateTrackingPixelURL(emailID, campaignID, contactID))
-
-	if strings.Contains(htmlContent, "</body>") {
-		htmlContent = strings.Replace(htmlContent, "</body>", trackingPixel+"</body>", 1)
-	} else {
-		htmlContent = htmlContent + trackingPixel
-	}
-
-	// Wrap all links with click tracking
-	// This is a simplified version - a proper implementation would use HTML parsing
-	htmlContent = s.wrapLinksWithTracking(htmlContent, emailID, campaignID, contactID)
-
-	return htmlContent
-}
-
-// wrapLinksWithTracking wraps href links with click tracking
-func (s *TrackingService) wrapLinksWithTracking(html string, emailID int64, campaignID int, contactID int64) string {
-	// Find and replace href attributes
-	// Note: This is a simplified approach. Production code should use proper HTML parsing.
-	result := html
-	linkIndex := 0
-
-	// Find href="..." patterns
-	for {
-		hrefStart := strings.Index(result, `href="`)
-		if hrefStart == -1 {
-			break
-		}
-
-		hrefStart += 6 // Move past href="
-		hrefEnd := strings.Index(result[hrefStart:], `"`)
-		if hrefEnd == -1 {
-			break
-		}
-
-		originalURL := result[hrefStart : hrefStart+hrefEnd]
-
-		// Skip mailto:, tel:, and anchor links
-		if strings.HasPrefix(originalURL, "mailto:") ||
-			strings.HasPrefix(originalURL, "tel:") ||
-			strings.HasPrefix(originalURL, "#") ||
-			strings.HasPrefix(originalURL, "{{") {
-			result = result[:hrefStart] + "SKIP:" + result[hrefStart:]
-			continue
-		}
-
-		// Generate tracked URL
-		linkID := fmt.Sprintf("link_%d", linkIndex)
-		trackedURL := s.GenerateClickTrackingURL(emailID, campaignID, contactID, originalURL, linkID)
-
-		// Replace the URL
-		result = result[:hrefStart] + trackedURL + result[hrefStart+hrefEnd:]
-		linkIndex++
-	}
-
-	// Remove SKIP: markers
-	result = strings.ReplaceAll(result, "SKIP:", "")
-
-	return result
-}
-
-// encodeTrackingData encodes tracking data to a URL-safe token
-func (s *TrackingService) encodeTrackingData(data TrackingData) string {
-	jsonData, _ := json.Marshal(data)
-
-	// Sign the data
-	mac := hmac.New(sha256.New, []byte(s.cfg.JWTSecret))
-	mac.Write(jsonData)
-	signature := mac.Sum(nil)
-
-	// Combine data + signature
-	combined := append(jsonData, signature[:8]...) // Use first 8 bytes of signature
-
-	return base64.URLEncoding.EncodeToString(combined)
-}
-
-// decodeTrackingData decodes and verifies a tracking token
-func (s *TrackingService) decodeTrackingData(token string) (*TrackingData, error) {
-	combined, err := base64.URLEncoding.DecodeString(token)
-	if err != nil {
-		return nil, fmt.Errorf("invalid token encoding")
-	}
-
-	if len(combined) < 9 {
-		return nil, fmt.Errorf("token too short")
-	}
-
-	// Split data and signature
-	jsonData := combined[:len(combined)-8]
-	providedSig := combined[len(combined)-8:]
-
-	// Verify signature
-	mac := hmac.New(sha256.New, []byte(s.cfg.JWTSecret))
-	mac.Write(jsonData)
-	expectedSig := mac.Sum(nil)[:8]
-
-	if !hmac.Equal(providedSig, expectedSig) {
-		return nil, fmt.Errorf("invalid signature")
-	}
-
-	var data TrackingData
-	if err := json.Unmarshal(jsonData, &data); err != nil {
-		return nil, fmt.Errorf("invalid token data")
-	}
-
-	return &data, nil
+	return s.tracker.Apply(emailID, campaignID, contactID, htmlContent)
 }
 
 // GetEmailAnalytics retrieves analytics for an email
@@ -7,17 +7,24 @@ import (
 	"encoding/hex"
 	"encoding/json"
 	"fmt"
-	"regexp"
+	"net/http"
 	"strings"
 	"time"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 	"github.com/redis/go-redis/v9"
 
 	"github.com/dublyo/mailat/api/internal/config"
 	"github.com/dublyo/mailat/api/internal/model"
 	"github.com/dublyo/mailat/api/internal/provider"
 	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+	"github.com/dublyo/mailat/api/pkg/contentguard"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+	"github.com/dublyo/mailat/api/pkg/rotation"
+	"github.com/dublyo/mailat/api/pkg/templatepartial"
+	"github.com/dublyo/mailat/api/pkg/templating"
 )
 
 // TransactionalService handles transactional email sending
@@ -25,8 +32,9 @@ type TransactionalService struct {
 	db            *sql.DB
 	cfg           *config.Config
 	redis         *redis.Client
-	queueClient   *worker.QueueClient
-	emailProvider provider.EmailProvider
+	queueClient     *worker.QueueClient
+	emailProvider   provider.EmailProvider
+	attachmentStore *provider.AttachmentStore
 }
 
 // NewTransactionalService creates a new transactional service
@@ -38,10 +46,11 @@ func NewTransactionalService(db *sql.DB, cfg *config.Config, redisClient *redis.
 	}
 
 	svc := &TransactionalService{
-		db:          db,
-		cfg:         cfg,
-		redis:       redisClient,
-		queueClient: queueClient,
+		db:              db,
+		cfg:             cfg,
+		redis:           redisClient,
+		queueClient:     queueClient,
+		attachmentStore: newAttachmentStore(cfg),
 	}
 
 	// Initialize email provider based on config
@@ -82,8 +91,15 @@ func NewTransactionalService(db *sql.DB, cfg *config.Config, redisClient *redis.
 	return svc
 }
 
-// SendEmail sends a single transactional email
-func (s *TransactionalService) SendEmail(ctx context.Context, orgID int64, req *model.SendEmailRequest) (*model.SendEmailResponse, error) {
+// SendEmail sends a single transactional email. Requests authenticated with an API
+// key (apiKeyID not 0) are held to the key's sending restrictions.
+func (s *TransactionalService) SendEmail(ctx context.Context, orgID, apiKeyID int64, req *model.SendEmailRequest) (*model.SendEmailResponse, error) {
+	return s.sendEmail(ctx, orgID, apiKeyID, req, false)
+}
+
+// sendEmail sends an email. Test sends are flagged on the email and don't count
+// toward the org's quotas or the probation of the sender domain.
+func (s *TransactionalService) sendEmail(ctx context.Context, orgID, apiKeyID int64, req *model.SendEmailRequest, test bool) (*model.SendEmailResponse, error) {
 	// Check idempotency
 	if req.IdempotencyKey != "" {
 		existing, err := s.checkIdempotency(ctx, req.IdempotencyKey)
@@ -92,23 +108,41 @@ func (s *TransactionalService) SendEmail(ctx context.Context, orgID int64, req *
 		}
 	}
 
+	if err := validateDedupeWindow(req.DedupeWindowHours); err != nil {
+		return nil, err
+	}
+
 	// Validate sender domain ownership
 	fromEmail := req.From
 	domainName := extractDomain(fromEmail)
 
+	scope, err := loadAPIKeyScope(ctx, s.db, apiKeyID)
+	if err != nil {
+		return nil, err
+	}
+	if err := scope.checkDomain(domainName); err != nil {
+		return nil, err
+	}
+	if err := scope.checkTags(req.Tags); err != nil {
+		return nil, err
+	}
+
 	var domainID int64
 	var domainStatus string
-	err := s.db.QueryRowContext(ctx, `
-		SELECT id, status FROM domains WHERE name = $1 AND org_id = $2
-	`, domainName, orgID).Scan(&domainID, &domainStatus)
+	var probationSent int
+	var probationCleared sql.NullTime
+	err = s.db.QueryRowContext(ctx, `
+		SELECT id, status, COALESCE(probation_sent_count, 0), probation_cleared_at
+		FROM domains WHERE name = $1 AND org_id = $2
+	`, domainName, orgID).Scan(&domainID, &domainStatus, &probationSent, &probationCleared)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("sender domain not verified for your organization")
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeDomainNotVerified, "sender domain not verified for your organization")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to verify sender domain: %w", err)
 	}
 	if domainStatus != "active" {
-		return nil, fmt.Errorf("sender domain is not active")
+		return nil, apierror.New(http.StatusBadRequest, apierror.CodeDomainNotActive, "sender domain is not active")
 	}
 
 	// Find identity for the sender
@@ -124,66 +158,194 @@ func (s *TransactionalService) SendEmail(ctx context.Context, orgID int64, req *
 	}
 
 	// Check rate limits
-	if err := s.checkRateLimits(ctx, orgID); err != nil {
-		return nil, err
+	if !test {
+		if err := scope.checkDailyLimit(ctx, s.db); err != nil {
+			return nil, err
+		}
+		if err := s.checkRateLimits(ctx, orgID); err != nil {
+			return nil, err
+		}
 	}
 
 	// Check suppression list
-	for _, to := range req.To {
-		suppressed, err := s.isEmailSuppressed(ctx, orgID, to)
-		if err != nil {
-			return nil, fmt.Errorf("failed to check suppression list: %w", err)
+	suppressed, err := findSuppressions(ctx, s.db, orgID, req.To)
+	if err != nil {
+		return nil, err
+	}
+	if len(suppressed) > 0 {
+		supErr := &SuppressedRecipientError{}
+		for _, to := range req.To {
+			if sup, ok := suppressed[to]; ok {
+				supErr.Suppressions = append(supErr.Suppressions, *sup)
+				delete(suppressed, to)
+			}
 		}
-		if suppressed {
-			return nil, fmt.Errorf("recipient %s is on suppression list", to)
+		return nil, supErr
+	}
+
+	// Senders are rotated by the worker; the pool must exist when the email is accepted
+	var senderPool sql.NullString
+	if req.SenderPool != "" {
+		pool, ok := rotation.Load(ctx, s.db, orgID).Pool(req.SenderPool)
+		if !ok {
+			return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeSenderPoolNotFound, "sender pool %q not found", req.SenderPool)
+		}
+		// Any member may end up as the sender
+		for _, address := range pool.Addresses() {
+			if err := scope.checkDomain(extractDomain(address)); err != nil {
+				return nil, err
+			}
 		}
+		senderPool = sql.NullString{String: req.SenderPool, Valid: true}
+	}
+
+	// Resolve pre-uploaded attachments
+	attachmentIDs, attachments, err := s.resolveAttachments(ctx, orgID, req.AttachmentIDs, req.InlineImages)
+	if err != nil {
+		return nil, err
 	}
 
 	// Render template if provided
 	subject := req.Subject
 	htmlBody := req.HTML
 	textBody := req.Text
+	var ampBody string
+	var templateID sql.NullInt64
+	var sentWithKey sql.NullInt64
+	var partials templating.Partials
+	if apiKeyID != 0 {
+		sentWithKey = sql.NullInt64{Int64: apiKeyID, Valid: true}
+	}
 
 	if req.TemplateID != "" {
 		template, err := s.getTemplateByUUID(ctx, orgID, req.TemplateID)
 		if err != nil {
-			return nil, fmt.Errorf("template not found: %w", err)
+			return nil, err
+		}
+		templateID = sql.NullInt64{Int64: template.ID, Valid: true}
+		if req.Variables, err = applyVariableSchema(template, req.Variables, true); err != nil {
+			return nil, err
+		}
+		if partials, err = templatepartial.Load(ctx, s.db, orgID); err != nil {
+			return nil, err
+		}
+		subject, htmlBody, textBody = template.Subject, template.HTMLBody, template.TextBody
+		if template.UseLayout {
+			htmlBody = templatepartial.WithLayout(htmlBody, partials)
+		}
+		// The layout is HTML, AMP parts stand on their own
+		if ampBody, err = s.renderAMP(ctx, template.UUID, template.AMPBody, req.Variables, partials); err != nil {
+			return nil, err
 		}
-		subject = s.renderTemplate(template.Subject, req.Variables)
-		htmlBody = s.renderTemplate(template.HTMLBody, req.Variables)
-		textBody = s.renderTemplate(template.TextBody, req.Variables)
 	} else if req.Variables != nil {
+		if partials, err = templatepartial.Load(ctx, s.db, orgID); err != nil {
+			return nil, err
+		}
+	}
+	if req.TemplateID != "" || req.Variables != nil {
 		// Apply variables to subject and body
-		subject = s.renderTemplate(subject, req.Variables)
-		htmlBody = s.renderTemplate(htmlBody, req.Variables)
-		textBody = s.renderTemplate(textBody, req.Variables)
+		rendered, err := s.renderTemplates(ctx, req.Variables, partials, subject, htmlBody, textBody)
+		if err != nil {
+			return nil, err
+		}
+		subject, htmlBody, textBody = rendered[0], rendered[1], rendered[2]
+	}
+	if test {
+		subject = testSubjectPrefix + subject
+	}
+
+	if err := checkInlineReferences(htmlBody, attachments); err != nil {
+		return nil, err
+	}
+
+	// Run the org's content guard on the rendered message
+	var contentWarnings []model.ContentFinding
+	if guard := contentguard.Load(ctx, s.db, orgID); guard.Enabled() {
+		findings := s.checkContent(ctx, guard, fromEmail, req.To, subject, htmlBody, textBody)
+		if len(findings) > 0 && guard.Mode == contentguard.ModeBlock {
+			return nil, &ContentBlockedError{Findings: findings}
+		}
+		contentWarnings = findings
 	}
 
 	// Generate Message-ID
 	messageID := s.generateMessageID(domainName)
 
+	// New domains are on probation: flagged content (or every email, with manual review) is held
+	status := "queued"
+	onProbation := s.onProbation(probationSent, probationCleared)
+	var holdReason sql.NullString
+	if onProbation {
+		if reason := s.probationHoldReason(subject, htmlBody, textBody); reason != "" {
+			status = "held"
+			holdReason = sql.NullString{String: reason, Valid: true}
+		}
+	}
+
+	var scheduledFor sql.NullTime
+	if req.ScheduledFor != nil {
+		if t, err := time.Parse(time.RFC3339, *req.ScheduledFor); err == nil {
+			scheduledFor = sql.NullTime{Time: t, Valid: true}
+		}
+	}
+
 	// Create email record
 	emailUUID := uuid.New().String()
 	var emailID int64
 
+	// Refuse recipients that already got this message within the dedupe window
+	dedupeClaims, err := s.claimRecipients(ctx, orgID, req.TemplateID, subject, req.To, emailUUID, req.DedupeWindowHours)
+	if err != nil {
+		return nil, err
+	}
+
 	tagsJSON, _ := json.Marshal(req.Tags)
 	metadataJSON, _ := json.Marshal(req.Metadata)
 
 	err = s.db.QueryRowContext(ctx, `
 		INSERT INTO transactional_emails (
 			uuid, org_id, identity_id, message_id, from_address, to_addresses,
-			cc_addresses, bcc_addresses, reply_to, subject, html_body, text_body,
-			tags, metadata, status, idempotency_key, updated_at
-		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, NOW())
+			cc_addresses, bcc_addresses, reply_to, subject, html_body, text_body, amp_body,
+			tags, metadata, status, idempotency_key, template_id, scheduled_for, hold_reason, sender_pool, api_key_id, is_test, updated_at
+		) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, NULLIF($13, ''), $14, $15, $16, $17, $18, $19, $20, $21, $22, $23, NOW())
 		RETURNING id
 	`, emailUUID, orgID, identityID, messageID, fromEmail, strings.Join(req.To, ","),
 		strings.Join(req.Cc, ","), strings.Join(req.Bcc, ","), req.ReplyTo,
-		subject, htmlBody, textBody, string(tagsJSON), string(metadataJSON),
-		"queued", req.IdempotencyKey,
+		subject, htmlBody, textBody, ampBody, string(tagsJSON), string(metadataJSON),
+		status, req.IdempotencyKey, templateID, scheduledFor, holdReason, senderPool, sentWithKey, test,
 	).Scan(&emailID)
 	if err != nil {
+		s.releaseRecipients(ctx, dedupeClaims)
 		return nil, fmt.Errorf("failed to create email record: %w", err)
 	}
+	s.insertRecipients(ctx, emailID, req.To, req.Cc, req.Bcc)
+	if err := s.linkAttachments(ctx, emailID, attachmentIDs, attachments); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	// Held emails wait for review instead of being queued
+	if status == "held" {
+		_, err = s.db.ExecContext(ctx, `
+			INSERT INTO transactional_delivery_events (email_id, event_type, details)
+			VALUES ($1, 'held', $2)
+		`, emailID, "Held for review while sender domain is on probation. "+holdReason.String)
+		if err != nil {
+			fmt.Printf("Warning: failed to create delivery event: %v\n", err)
+		}
+		s.triggerWebhooks(ctx, emailID, "email.held", map[string]any{"reason": holdReason.String})
+
+		response := &model.SendEmailResponse{
+			ID:              emailUUID,
+			MessageID:       messageID,
+			Status:          status,
+			AcceptedAt:      time.Now(),
+			ContentWarnings: contentWarnings,
+		}
+		if req.IdempotencyKey != "" {
+			s.storeIdempotencyResult(ctx, req.IdempotencyKey, response)
+		}
+		return response, nil
+	}
 
 	// Create initial delivery event
 	_, err = s.db.ExecContext(ctx, `
@@ -194,18 +356,28 @@ func (s *TransactionalService) SendEmail(ctx context.Context, orgID int64, req *
 		fmt.Printf("Warning: failed to create delivery event: %v\n", err)
 	}
 
+	if onProbation && !test {
+		s.recordProbationSend(ctx, domainID)
+	}
+
 	// Queue for sending via asynq job queue
 	if s.queueClient != nil {
 		payload := worker.NewEmailSendPayload(emailID, orgID, fromEmail, req.To, subject, htmlBody, textBody, messageID)
 		payload.Cc = req.Cc
 		payload.Bcc = req.Bcc
 		payload.ReplyTo = req.ReplyTo
+		payload.AMPBody = ampBody
+		payload.Attachments = attachments
+		payload.SenderPool = req.SenderPool
+		if scheduledFor.Valid {
+			payload.ScheduledFor = &scheduledFor.Time
+			payload.IgnoreSendWindow = req.IgnoreSendWindow
+		}
 
 		// Check for scheduled sending
 		if req.ScheduledFor != nil {
-			scheduledTime, err := time.Parse(time.RFC3339, *req.ScheduledFor)
-			if err == nil && scheduledTime.After(time.Now()) {
-				_, err = s.queueClient.EnqueueEmailSendScheduled(payload, scheduledTime)
+			if scheduledFor.Valid && scheduledFor.Time.After(time.Now()) {
+				_, err = s.queueClient.EnqueueEmailSendScheduled(payload, scheduledFor.Time)
 				if err != nil {
 					fmt.Printf("Warning: failed to schedule email, sending immediately: %v\n", err)
 					_, _ = s.queueClient.EnqueueEmailSend(payload)
@@ -227,10 +399,11 @@ func (s *TransactionalService) SendEmail(ctx context.Context, orgID int64, req *
 	}
 
 	response := &model.SendEmailResponse{
-		ID:         emailUUID,
-		MessageID:  messageID,
-		Status:     "queued",
-		AcceptedAt: time.Now(),
+		ID:              emailUUID,
+		MessageID:       messageID,
+		Status:          "queued",
+		AcceptedAt:      time.Now(),
+		ContentWarnings: contentWarnings,
 	}
 
 	// Store idempotency result
@@ -241,60 +414,37 @@ func (s *TransactionalService) SendEmail(ctx context.Context, orgID int64, req *
 	return response, nil
 }
 
-// BatchSendEmail sends multiple emails in batch
-func (s *TransactionalService) BatchSendEmail(ctx context.Context, orgID int64, req *model.BatchSendRequest) (*model.BatchSendResponse, error) {
-	if len(req.Emails) > 100 {
-		return nil, fmt.Errorf("batch size exceeds maximum of 100 emails")
-	}
-
-	results := make([]model.BatchEmailResult, len(req.Emails))
-
-	for i, emailReq := range req.Emails {
-		resp, err := s.SendEmail(ctx, orgID, &emailReq)
-		if err != nil {
-			results[i] = model.BatchEmailResult{
-				Index:  i,
-				Status: "failed",
-				Error:  err.Error(),
-			}
-		} else {
-			results[i] = model.BatchEmailResult{
-				Index:     i,
-				ID:        resp.ID,
-				MessageID: resp.MessageID,
-				Status:    resp.Status,
-			}
-		}
-	}
-
-	return &model.BatchSendResponse{Results: results}, nil
-}
-
 // GetEmailStatus retrieves the status of a sent email
 func (s *TransactionalService) GetEmailStatus(ctx context.Context, orgID int64, emailUUID string) (*model.GetEmailStatusResponse, error) {
 	var email struct {
-		ID          int64
-		MessageID   string
-		From        string
-		To          string
-		Subject     string
-		Status      string
-		CreatedAt   time.Time
-		SentAt      sql.NullTime
-		DeliveredAt sql.NullTime
+		ID           int64
+		MessageID    string
+		From         string
+		To           string
+		Cc           sql.NullString
+		Bcc          sql.NullString
+		Subject      string
+		Status       string
+		CreatedAt    time.Time
+		SentAt       sql.NullTime
+		DeliveredAt  sql.NullTime
+		BounceClass  sql.NullString
+		BounceReason sql.NullString
+		HoldReason   sql.NullString
 	}
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, message_id, from_address, to_addresses, subject, status,
-		       created_at, sent_at, delivered_at
+		SELECT id, message_id, from_address, to_addresses, cc_addresses, bcc_addresses, subject, status,
+		       created_at, sent_at, delivered_at, bounce_class, bounce_reason, hold_reason
 		FROM transactional_emails
 		WHERE uuid = $1 AND org_id = $2
 	`, emailUUID, orgID).Scan(
-		&email.ID, &email.MessageID, &email.From, &email.To, &email.Subject,
+		&email.ID, &email.MessageID, &email.From, &email.To, &email.Cc, &email.Bcc, &email.Subject,
 		&email.Status, &email.CreatedAt, &email.SentAt, &email.DeliveredAt,
+		&email.BounceClass, &email.BounceReason, &email.HoldReason,
 	)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("email not found")
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeEmailNotFound, "email not found")
 	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to get email: %w", err)
@@ -328,15 +478,23 @@ func (s *TransactionalService) GetEmailStatus(ctx context.Context, orgID int64,
 		events = append(events, event)
 	}
 
+	recipients, err := s.getRecipientStatuses(ctx, email.ID)
+	if err != nil {
+		return nil, err
+	}
+
 	response := &model.GetEmailStatusResponse{
-		ID:        emailUUID,
-		MessageID: email.MessageID,
-		From:      email.From,
-		To:        strings.Split(email.To, ","),
-		Subject:   email.Subject,
-		Status:    email.Status,
-		Events:    events,
-		CreatedAt: email.CreatedAt,
+		ID:         emailUUID,
+		MessageID:  email.MessageID,
+		From:       email.From,
+		To:         strings.Split(email.To, ","),
+		Cc:         splitAddresses(email.Cc.String),
+		Bcc:        splitAddresses(email.Bcc.String),
+		Subject:    email.Subject,
+		Status:     email.Status,
+		Recipients: recipients,
+		Events:     events,
+		CreatedAt:  email.CreatedAt,
 	}
 
 	if email.SentAt.Valid {
@@ -345,16 +503,62 @@ func (s *TransactionalService) GetEmailStatus(ctx context.Context, orgID int64,
 	if email.DeliveredAt.Valid {
 		response.DeliveredAt = &email.DeliveredAt.Time
 	}
+	response.BounceClass = email.BounceClass.String
+	response.BounceReason = email.BounceReason.String
+	response.HoldReason = email.HoldReason.String
 
 	return response, nil
 }
 
-// CancelEmail cancels a scheduled email
+// getRecipientStatuses returns the per-recipient delivery state of an email
+func (s *TransactionalService) getRecipientStatuses(ctx context.Context, emailID int64) ([]model.EmailRecipientStatus, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT email, type, status, delivered_at, opened_at, clicked_at, bounced_at,
+		       COALESCE(bounce_class, ''), COALESCE(bounce_reason, ''), complained_at
+		FROM transactional_email_recipients
+		WHERE email_id = $1
+		ORDER BY id
+	`, emailID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recipients: %w", err)
+	}
+	defer rows.Close()
+
+	recipients := []model.EmailRecipientStatus{}
+	for rows.Next() {
+		var r model.EmailRecipientStatus
+		var deliveredAt, openedAt, clickedAt, bouncedAt, complainedAt sql.NullTime
+		if err := rows.Scan(&r.Email, &r.Type, &r.Status, &deliveredAt, &openedAt, &clickedAt, &bouncedAt,
+			&r.BounceClass, &r.BounceReason, &complainedAt); err != nil {
+			continue
+		}
+		if deliveredAt.Valid {
+			r.DeliveredAt = &deliveredAt.Time
+		}
+		if openedAt.Valid {
+			r.OpenedAt = &openedAt.Time
+		}
+		if clickedAt.Valid {
+			r.ClickedAt = &clickedAt.Time
+		}
+		if bouncedAt.Valid {
+			r.BouncedAt = &bouncedAt.Time
+		}
+		if complainedAt.Valid {
+			r.ComplainedAt = &complainedAt.Time
+		}
+		recipients = append(recipients, r)
+	}
+
+	return recipients, nil
+}
+
+// CancelEmail cancels a scheduled or held email
 func (s *TransactionalService) CancelEmail(ctx context.Context, orgID int64, emailUUID string) error {
 	result, err := s.db.ExecContext(ctx, `
 		UPDATE transactional_emails
 		SET status = 'cancelled', updated_at = NOW()
-		WHERE uuid = $1 AND org_id = $2 AND status = 'queued'
+		WHERE uuid = $1 AND org_id = $2 AND status IN ('queued', 'held')
 	`, emailUUID, orgID)
 	if err != nil {
 		return fmt.Errorf("failed to cancel email: %w", err)
@@ -362,7 +566,7 @@ func (s *TransactionalService) CancelEmail(ctx context.Context, orgID int64, ema
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("email not found or cannot be cancelled")
+		return apierror.New(http.StatusConflict, apierror.CodeEmailNotCancelable, "email not found or cannot be cancelled")
 	}
 
 	return nil
@@ -374,25 +578,62 @@ func (s *TransactionalService) CancelEmail(ctx context.Context, orgID int64, ema
 func (s *TransactionalService) CreateTemplate(ctx context.Context, orgID int64, req *model.CreateTemplateRequest) (*model.EmailTemplate, error) {
 	templateUUID := uuid.New().String()
 
+	htmlBody, design, err := s.templateBody(ctx, req.HTML, req.MJML, req.Design, true)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.AMP != "" {
+		if err := validateAMP(req.AMP); err != nil {
+			return nil, err
+		}
+	}
+	amp, _ := maskAMPTemplates(req.AMP)
+	if err := validateTemplateSyntax(map[string]string{"subject": req.Subject, "html": htmlBody, "text": req.Text, "amp": amp}); err != nil {
+		return nil, err
+	}
+
 	// Extract variables from template
-	variables := s.extractVariables(req.Subject + req.HTML + req.Text)
+	variables := s.extractVariables(req.Subject, htmlBody, req.Text, amp)
 	variablesJSON, _ := json.Marshal(variables)
 
+	var variableSchema sql.NullString
+	if len(req.VariableSchema) > 0 {
+		schema, err := parseVariableSchema(req.VariableSchema)
+		if err != nil {
+			return nil, err
+		}
+		variableSchema = sql.NullString{String: schema, Valid: true}
+	}
+
+	useLayout := true
+	if req.UseLayout != nil {
+		useLayout = *req.UseLayout
+	}
+
 	var template model.EmailTemplate
-	err := s.db.QueryRowContext(ctx, `
-		INSERT INTO email_templates (uuid, org_id, name, description, subject, html_body, text_body, variables, is_active, updated_at)
-		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, true, NOW())
-		RETURNING id, uuid, org_id, name, description, subject, html_body, text_body, is_active, created_at, updated_at
-	`, templateUUID, orgID, req.Name, req.Description, req.Subject, req.HTML, req.Text, string(variablesJSON)).Scan(
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO email_templates (uuid, org_id, name, description, subject, html_body, text_body, amp_body, mjml_source, design, variables, variable_schema, use_layout, is_active, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, NULLIF($8, ''), NULLIF($9, ''), $10, $11, $12, $13, true, NOW())
+		RETURNING id, uuid, org_id, name, description, subject, html_body, text_body, use_layout, is_active, created_at, updated_at
+	`, templateUUID, orgID, req.Name, req.Description, req.Subject, htmlBody, req.Text, req.AMP, req.MJML, design, string(variablesJSON), variableSchema, useLayout).Scan(
 		&template.ID, &template.UUID, &template.OrgID, &template.Name, &template.Description,
-		&template.Subject, &template.HTMLBody, &template.TextBody, &template.IsActive,
+		&template.Subject, &template.HTMLBody, &template.TextBody, &template.UseLayout, &template.IsActive,
 		&template.CreatedAt, &template.UpdatedAt,
 	)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create template: %w", err)
 	}
 
+	template.AMPBody = req.AMP
+	template.MJML = req.MJML
 	template.Variables = variables
+	if design.Valid {
+		template.Design = json.RawMessage(design.String)
+	}
+	if variableSchema.Valid {
+		template.VariableSchema = json.RawMessage(variableSchema.String)
+	}
 	return &template, nil
 }
 
@@ -404,7 +645,7 @@ func (s *TransactionalService) GetTemplate(ctx context.Context, orgID int64, tem
 // ListTemplates returns all templates for an organization
 func (s *TransactionalService) ListTemplates(ctx context.Context, orgID int64) ([]*model.EmailTemplate, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, uuid, org_id, name, description, subject, html_body, text_body, variables, is_active, created_at, updated_at
+		SELECT id, uuid, org_id, name, description, subject, html_body, text_body, COALESCE(amp_body, ''), COALESCE(mjml_source, ''), COALESCE(design::text, ''), variables, COALESCE(variable_schema::text, ''), use_layout, is_active, created_at, updated_at
 		FROM email_templates
 		WHERE org_id = $1
 		ORDER BY name ASC
@@ -417,17 +658,23 @@ func (s *TransactionalService) ListTemplates(ctx context.Context, orgID int64) (
 	var templates []*model.EmailTemplate
 	for rows.Next() {
 		var template model.EmailTemplate
-		var variablesJSON string
+		var design, variablesJSON, variableSchema string
 		var desc sql.NullString
 		if err := rows.Scan(&template.ID, &template.UUID, &template.OrgID, &template.Name, &desc,
-			&template.Subject, &template.HTMLBody, &template.TextBody, &variablesJSON,
-			&template.IsActive, &template.CreatedAt, &template.UpdatedAt); err != nil {
+			&template.Subject, &template.HTMLBody, &template.TextBody, &template.AMPBody, &template.MJML, &design, &variablesJSON, &variableSchema,
+			&template.UseLayout, &template.IsActive, &template.CreatedAt, &template.UpdatedAt); err != nil {
 			continue
 		}
 		if desc.Valid {
 			template.Description = desc.String
 		}
 		json.Unmarshal([]byte(variablesJSON), &template.Variables)
+		if design != "" {
+			template.Design = json.RawMessage(design)
+		}
+		if variableSchema != "" {
+			template.VariableSchema = json.RawMessage(variableSchema)
+		}
 		templates = append(templates, &template)
 	}
 
@@ -451,21 +698,59 @@ func (s *TransactionalService) UpdateTemplate(ctx context.Context, orgID int64,
 		args = append(args, req.Description)
 		argIndex++
 	}
+	var amp string
+	if req.AMP != nil && *req.AMP != "" {
+		if err := validateAMP(*req.AMP); err != nil {
+			return nil, err
+		}
+		amp, _ = maskAMPTemplates(*req.AMP)
+	}
+	if err := validateTemplateSyntax(map[string]string{"subject": req.Subject, "html": req.HTML, "text": req.Text, "amp": amp}); err != nil {
+		return nil, err
+	}
 	if req.Subject != "" {
 		updates = append(updates, fmt.Sprintf("subject = $%d", argIndex))
 		args = append(args, req.Subject)
 		argIndex++
 	}
-	if req.HTML != "" {
-		updates = append(updates, fmt.Sprintf("html_body = $%d", argIndex))
-		args = append(args, req.HTML)
-		argIndex++
+	if req.HTML != "" || req.MJML != "" || len(req.Design) > 0 {
+		htmlBody, design, err := s.templateBody(ctx, req.HTML, req.MJML, req.Design, false)
+		if err != nil {
+			return nil, err
+		}
+		updates = append(updates, fmt.Sprintf("html_body = $%d", argIndex), fmt.Sprintf("mjml_source = NULLIF($%d, '')", argIndex+1), fmt.Sprintf("design = $%d", argIndex+2))
+		args = append(args, htmlBody, req.MJML, design)
+		argIndex += 3
 	}
 	if req.Text != "" {
 		updates = append(updates, fmt.Sprintf("text_body = $%d", argIndex))
 		args = append(args, req.Text)
 		argIndex++
 	}
+	if req.AMP != nil {
+		updates = append(updates, fmt.Sprintf("amp_body = NULLIF($%d, '')", argIndex))
+		args = append(args, *req.AMP)
+		argIndex++
+	}
+	if req.VariableSchema != nil {
+		// An empty schema removes it
+		var variableSchema sql.NullString
+		if len(req.VariableSchema) > 0 {
+			schema, err := parseVariableSchema(req.VariableSchema)
+			if err != nil {
+				return nil, err
+			}
+			variableSchema = sql.NullString{String: schema, Valid: true}
+		}
+		updates = append(updates, fmt.Sprintf("variable_schema = $%d", argIndex))
+		args = append(args, variableSchema)
+		argIndex++
+	}
+	if req.UseLayout != nil {
+		updates = append(updates, fmt.Sprintf("use_layout = $%d", argIndex))
+		args = append(args, *req.UseLayout)
+		argIndex++
+	}
 	if req.IsActive != nil {
 		updates = append(updates, fmt.Sprintf("is_active = $%d", argIndex))
 		args = append(args, *req.IsActive)
@@ -503,23 +788,45 @@ func (s *TransactionalService) DeleteTemplate(ctx context.Context, orgID int64,
 
 	rows, _ := result.RowsAffected()
 	if rows == 0 {
-		return fmt.Errorf("template not found")
+		return apierror.New(http.StatusNotFound, apierror.CodeTemplateNotFound, "template not found")
 	}
 
 	return nil
 }
 
 // PreviewTemplate renders a template with variables
-func (s *TransactionalService) PreviewTemplate(ctx context.Context, orgID int64, templateUUID string, variables map[string]string) (*model.PreviewTemplateResponse, error) {
+func (s *TransactionalService) PreviewTemplate(ctx context.Context, orgID int64, templateUUID string, variables map[string]any) (*model.PreviewTemplateResponse, error) {
 	template, err := s.GetTemplate(ctx, orgID, templateUUID)
 	if err != nil {
 		return nil, err
 	}
 
+	partials, err := templatepartial.Load(ctx, s.db, orgID)
+	if err != nil {
+		return nil, err
+	}
+	htmlBody := template.HTMLBody
+	if template.UseLayout {
+		htmlBody = templatepartial.WithLayout(htmlBody, partials)
+	}
+	if variables, err = applyVariableSchema(template, variables, false); err != nil {
+		return nil, err
+	}
+
+	rendered, err := s.renderTemplates(ctx, variables, partials, template.Subject, htmlBody, template.TextBody)
+	if err != nil {
+		return nil, err
+	}
+	amp, err := s.renderAMP(ctx, template.UUID, template.AMPBody, variables, partials)
+	if err != nil {
+		return nil, err
+	}
+
 	return &model.PreviewTemplateResponse{
-		Subject: s.renderTemplate(template.Subject, variables),
-		HTML:    s.renderTemplate(template.HTMLBody, variables),
-		Text:    s.renderTemplate(template.TextBody, variables),
+		Subject: rendered[0],
+		HTML:    rendered[1],
+		Text:    rendered[2],
+		AMP:     amp,
 	}, nil
 }
 
@@ -527,20 +834,20 @@ func (s *TransactionalService) PreviewTemplate(ctx context.Context, orgID int64,
 
 func (s *TransactionalService) getTemplateByUUID(ctx context.Context, orgID int64, templateUUID string) (*model.EmailTemplate, error) {
 	var template model.EmailTemplate
-	var variablesJSON string
+	var design, variablesJSON, variableSchema string
 	var desc sql.NullString
 
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, uuid, org_id, name, description, subject, html_body, text_body, variables, is_active, created_at, updated_at
+		SELECT id, uuid, org_id, name, description, subject, html_body, text_body, COALESCE(amp_body, ''), COALESCE(mjml_source, ''), COALESCE(design::text, ''), variables, COALESCE(variable_schema::text, ''), use_layout, is_active, created_at, updated_at
 		FROM email_templates
 		WHERE uuid = $1 AND org_id = $2
 	`, templateUUID, orgID).Scan(
 		&template.ID, &template.UUID, &template.OrgID, &template.Name, &desc,
-		&template.Subject, &template.HTMLBody, &template.TextBody, &variablesJSON,
-		&template.IsActive, &template.CreatedAt, &template.UpdatedAt,
+		&template.Subject, &template.HTMLBody, &template.TextBody, &template.AMPBody, &template.MJML, &design, &variablesJSON, &variableSchema,
+		&template.UseLayout, &template.IsActive, &template.CreatedAt, &template.UpdatedAt,
 	)
 	if err == sql.ErrNoRows {
-		return nil, fmt.Errorf("template not found")
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeTemplateNotFound, "template not found")
 	}
 	if err != nil {
 		return nil, err
@@ -550,33 +857,53 @@ func (s *TransactionalService) getTemplateByUUID(ctx context.Context, orgID int6
 		template.Description = desc.String
 	}
 	json.Unmarshal([]byte(variablesJSON), &template.Variables)
+	if design != "" {
+		template.Design = json.RawMessage(design)
+	}
+	if variableSchema != "" {
+		template.VariableSchema = json.RawMessage(variableSchema)
+	}
 
 	return &template, nil
 }
 
-func (s *TransactionalService) renderTemplate(template string, variables map[string]string) string {
-	if variables == nil {
-		return template
+// renderTemplates renders templates with the same variables and partials. A
+// template that doesn't render, or runs over the render limits, is rejected.
+func (s *TransactionalService) renderTemplates(ctx context.Context, variables map[string]any, partials templating.Partials, templates ...string) ([]string, error) {
+	rendered := make([]string, len(templates))
+	for i, template := range templates {
+		out, err := templating.Render(ctx, template, variables, partials)
+		if err != nil {
+			return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeTemplateInvalid, "template failed to render: %v", err)
+		}
+		rendered[i] = out
 	}
+	return rendered, nil
+}
 
-	result := template
-	for key, value := range variables {
-		placeholder := "{{" + key + "}}"
-		result = strings.ReplaceAll(result, placeholder, value)
+// validateTemplateSyntax checks that the parts of a template parse, keyed by field
+func validateTemplateSyntax(parts map[string]string) error {
+	var fields []apierror.FieldError
+	for _, name := range []string{"subject", "html", "text", "amp"} {
+		if _, err := templating.Parse(parts[name]); err != nil {
+			fields = append(fields, apierror.FieldError{Field: name, Rule: "template", Message: err.Error()})
+		}
 	}
-	return result
+	if len(fields) > 0 {
+		return &apierror.ValidationError{Fields: fields}
+	}
+	return nil
 }
 
-func (s *TransactionalService) extractVariables(content string) []string {
-	re := regexp.MustCompile(`\{\{(\w+)\}\}`)
-	matches := re.FindAllStringSubmatch(content, -1)
-
+func (s *TransactionalService) extractVariables(parts ...string) []string {
 	seen := make(map[string]bool)
 	var variables []string
-	for _, match := range matches {
-		if len(match) > 1 && !seen[match[1]] {
-			seen[match[1]] = true
-			variables = append(variables, match[1])
+	for _, part := range parts {
+		for _, name := range templating.Variables(part) {
+			if !seen[name] {
+				seen[name] = true
+				variables = append(variables, name)
+			}
 		}
 	}
 	return variables
@@ -625,7 +952,7 @@ func (s *TransactionalService) checkRateLimits(ctx context.Context, orgID int64)
 	}
 
 	if count >= int64(dailyQuota) {
-		return fmt.Errorf("daily email quota exceeded")
+		return apierror.New(http.StatusTooManyRequests, apierror.CodeQuotaExceeded, "daily email quota exceeded")
 	}
 
 	// Increment counter
@@ -637,20 +964,6 @@ func (s *TransactionalService) checkRateLimits(ctx context.Context, orgID int64)
 	return nil
 }
 
-func (s *TransactionalService) isEmailSuppressed(ctx context.Context, orgID int64, email string) (bool, error) {
-	var exists bool
-	err := s.db.QueryRowContext(ctx, `
-		SELECT EXISTS(
-			SELECT 1 FROM suppression_list
-			WHERE org_id = $1 AND email = $2
-		)
-	`, orgID, strings.ToLower(email)).Scan(&exists)
-	if err != nil {
-		return false, err
-	}
-	return exists, nil
-}
-
 func (s *TransactionalService) checkIdempotency(ctx context.Context, key string) (*model.SendEmailResponse, error) {
 	if s.redis == nil {
 		return nil, fmt.Errorf("redis not available")
@@ -700,14 +1013,24 @@ func (s *TransactionalService) processEmail(ctx context.Context, emailID int64,
 		MessageID: messageID,
 	}
 
-	// Send via email provider (SES or SMTP)
-	result, err := s.emailProvider.SendEmail(ctx, emailMsg)
+	var result *provider.SendResult
+	infos, err := s.emailAttachments(ctx, emailID)
+	if err == nil {
+		emailMsg.Attachments, err = s.downloadAttachments(ctx, infos)
+	}
+	if err == nil {
+		// Send via email provider (SES or SMTP)
+		result, err = s.emailProvider.SendEmail(ctx, emailMsg)
+	}
 
 	if err != nil {
 		// Update status to failed
 		s.db.ExecContext(ctx, `
 			UPDATE transactional_emails SET status = 'failed', updated_at = NOW() WHERE id = $1
 		`, emailID)
+		s.db.ExecContext(ctx, `
+			UPDATE transactional_email_recipients SET status = 'failed', bounce_reason = $2, updated_at = NOW() WHERE email_id = $1
+		`, emailID, err.Error())
 		s.db.ExecContext(ctx, `
 			INSERT INTO transactional_delivery_events (email_id, event_type, details) VALUES ($1, 'failed', $2)
 		`, emailID, err.Error())
@@ -728,6 +1051,9 @@ func (s *TransactionalService) processEmail(ctx context.Context, emailID int64,
 		SET status = 'sent', sent_at = NOW(), provider_message_id = $2, email_provider = $3, updated_at = NOW()
 		WHERE id = $1
 	`, emailID, providerMsgID, s.emailProvider.Name())
+	s.db.ExecContext(ctx, `
+		UPDATE transactional_email_recipients SET status = 'sent', updated_at = NOW() WHERE email_id = $1 AND status = 'queued'
+	`, emailID)
 	s.db.ExecContext(ctx, `
 		INSERT INTO transactional_delivery_events (email_id, event_type, details) VALUES ($1, 'sent', $2)
 	`, emailID, fmt.Sprintf("Email sent via %s", s.emailProvider.Name()))
@@ -736,6 +1062,38 @@ func (s *TransactionalService) processEmail(ctx context.Context, emailID int64,
 	s.triggerWebhooks(ctx, emailID, "email.sent", nil)
 }
 
+// insertRecipients records one row per to/cc/bcc address so delivery events can be
+// attributed to the specific recipient they concern
+func (s *TransactionalService) insertRecipients(ctx context.Context, emailID int64, to, cc, bcc []string) {
+	var emails, types []string
+	for _, group := range []struct {
+		kind      string
+		addresses []string
+	}{{"to", to}, {"cc", cc}, {"bcc", bcc}} {
+		for _, addr := range group.addresses {
+			// Only lowercase and strip display names; the address itself is kept as sent
+			addr = emailaddr.Normalize(addr, emailaddr.Rules{Lowercase: true})
+			if addr == "" {
+				continue
+			}
+			emails = append(emails, addr)
+			types = append(types, group.kind)
+		}
+	}
+	if len(emails) == 0 {
+		return
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO transactional_email_recipients (email_id, email, type)
+		SELECT $1, r.email, r.type FROM unnest($2::text[], $3::text[]) AS r(email, type)
+		ON CONFLICT (email_id, email, type) DO NOTHING
+	`, emailID, pq.Array(emails), pq.Array(types))
+	if err != nil {
+		fmt.Printf("Warning: failed to record email recipients: %v\n", err)
+	}
+}
+
 // triggerWebhooks enqueues webhook deliveries for an event
 func (s *TransactionalService) triggerWebhooks(ctx context.Context, emailID int64, eventType string, data map[string]any) {
 	// Get org_id for this email
@@ -0,0 +1,347 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/model"
+	"github.com/dublyo/mailat/api/internal/worker"
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// Batches are validated as a whole when submitted, stored, and sent by a single
+// worker job. Clients poll the batch for a result per entry.
+
+// maxBatchSize is the number of emails accepted in one batch
+const maxBatchSize = 1000
+
+// Batch statuses
+const (
+	batchStatusQueued     = "queued"
+	batchStatusProcessing = "processing"
+	batchStatusCompleted  = "completed"
+)
+
+// Batch entry statuses
+const (
+	batchItemPending  = "pending"
+	batchItemAccepted = "accepted"
+	batchItemFailed   = "failed"
+)
+
+// BatchSendEmail validates every entry of a batch and queues the batch for sending.
+// Nothing is sent when an entry is invalid.
+func (s *TransactionalService) BatchSendEmail(ctx context.Context, orgID, apiKeyID int64, req *model.BatchSendRequest) (*model.BatchSendResponse, error) {
+	if len(req.Emails) > maxBatchSize {
+		return nil, apierror.Newf(http.StatusBadRequest, apierror.CodeBatchTooLarge, "batch size exceeds maximum of %d emails", maxBatchSize)
+	}
+	if err := s.validateBatch(ctx, orgID, apiKeyID, req.Emails); err != nil {
+		return nil, err
+	}
+
+	requests := make([]string, len(req.Emails))
+	for i := range req.Emails {
+		data, err := json.Marshal(&req.Emails[i])
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode batch entry %d: %w", i, err)
+		}
+		requests[i] = string(data)
+	}
+
+	var sentWithKey sql.NullInt64
+	if apiKeyID != 0 {
+		sentWithKey = sql.NullInt64{Int64: apiKeyID, Valid: true}
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var batchID int64
+	var batchUUID string
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO transactional_batches (org_id, api_key_id, status, total)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, uuid
+	`, orgID, sentWithKey, batchStatusQueued, len(requests)).Scan(&batchID, &batchUUID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create batch: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO transactional_batch_items (batch_id, position, request)
+		SELECT $1, t.ord - 1, t.req::jsonb
+		FROM unnest($2::text[]) WITH ORDINALITY AS t(req, ord)
+	`, batchID, pq.Array(requests))
+	if err != nil {
+		return nil, fmt.Errorf("failed to store batch entries: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit batch: %w", err)
+	}
+
+	if s.queueClient != nil {
+		_, err = s.queueClient.EnqueueEmailBatch(&worker.EmailBatchPayload{BatchID: batchID, OrgID: orgID})
+		if err != nil {
+			fmt.Printf("Warning: failed to enqueue batch, sending in background: %v\n", err)
+			go s.ProcessBatch(context.Background(), batchID)
+		}
+	} else {
+		go s.ProcessBatch(context.Background(), batchID)
+	}
+
+	return &model.BatchSendResponse{
+		BatchID: batchUUID,
+		Status:  batchStatusQueued,
+		Total:   len(requests),
+	}, nil
+}
+
+// validateBatch checks every entry up front: required fields, sender domains and
+// the restrictions of the API key. Checks that depend on send time, such as rate
+// limits and suppressions, are applied per entry when the batch is sent.
+func (s *TransactionalService) validateBatch(ctx context.Context, orgID, apiKeyID int64, emails []model.SendEmailRequest) error {
+	scope, err := loadAPIKeyScope(ctx, s.db, apiKeyID)
+	if err != nil {
+		return err
+	}
+
+	var fields []apierror.FieldError
+	invalid := func(i int, field, rule, message string) {
+		fields = append(fields, apierror.FieldError{
+			Field:   fmt.Sprintf("emails[%d].%s", i, field),
+			Rule:    rule,
+			Message: message,
+		})
+	}
+
+	domainStatus := map[string]string{}
+	for i := range emails {
+		email := &emails[i]
+		if email.From == "" {
+			invalid(i, "from", "required", "sender required")
+		}
+		if len(email.To) == 0 {
+			invalid(i, "to", "required", "at least one recipient required")
+		}
+		if email.Subject == "" && email.TemplateID == "" {
+			invalid(i, "subject", "required", "subject or templateId required")
+		}
+		if email.HTML == "" && email.Text == "" && email.TemplateID == "" {
+			invalid(i, "html", "required", "email body or templateId required")
+		}
+		if email.DedupeWindowHours < 0 || email.DedupeWindowHours > maxDedupeWindowHours {
+			invalid(i, "dedupeWindowHours", "between", fmt.Sprintf("dedupeWindowHours must be between 0 and %d", maxDedupeWindowHours))
+		}
+		if email.From == "" {
+			continue
+		}
+
+		domain := extractDomain(email.From)
+		status, checked := domainStatus[domain]
+		if !checked {
+			err := s.db.QueryRowContext(ctx, `
+				SELECT status FROM domains WHERE name = $1 AND org_id = $2
+			`, domain, orgID).Scan(&status)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("failed to verify sender domain: %w", err)
+			}
+			domainStatus[domain] = status
+		}
+		switch status {
+		case "":
+			invalid(i, "from", apierror.CodeDomainNotVerified, "sender domain not verified for your organization")
+		case "active":
+		default:
+			invalid(i, "from", apierror.CodeDomainNotActive, "sender domain is not active")
+		}
+
+		if err := scope.checkDomain(domain); err != nil {
+			return err
+		}
+		if err := scope.checkTags(email.Tags); err != nil {
+			return err
+		}
+	}
+
+	if len(fields) > 0 {
+		return &apierror.ValidationError{Fields: fields}
+	}
+	return nil
+}
+
+// ProcessBatch sends the entries of a batch that have not been sent yet, so a
+// retried job resumes where the previous attempt stopped
+func (s *TransactionalService) ProcessBatch(ctx context.Context, batchID int64) error {
+	var orgID int64
+	var apiKeyID sql.NullInt64
+	err := s.db.QueryRowContext(ctx, `
+		UPDATE transactional_batches
+		SET status = $2, started_at = COALESCE(started_at, NOW())
+		WHERE id = $1 AND status != $3
+		RETURNING org_id, api_key_id
+	`, batchID, batchStatusProcessing, batchStatusCompleted).Scan(&orgID, &apiKeyID)
+	if err == sql.ErrNoRows {
+		return nil // Already completed
+	}
+	if err != nil {
+		return fmt.Errorf("failed to start batch: %w", err)
+	}
+
+	type entry struct {
+		id       int64
+		position int
+		request  []byte
+	}
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, position, request FROM transactional_batch_items
+		WHERE batch_id = $1 AND status = $2
+		ORDER BY position
+	`, batchID, batchItemPending)
+	if err != nil {
+		return fmt.Errorf("failed to load batch entries: %w", err)
+	}
+	var entries []entry
+	for rows.Next() {
+		var e entry
+		if err := rows.Scan(&e.id, &e.position, &e.request); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to load batch entries: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	rows.Close()
+
+	for _, e := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		var req model.SendEmailRequest
+		var resp *model.SendEmailResponse
+		err := json.Unmarshal(e.request, &req)
+		if err == nil {
+			resp, err = s.SendEmail(ctx, orgID, apiKeyID.Int64, &req)
+		}
+		result := batchEmailResult(e.position, resp, err)
+
+		status := batchItemAccepted
+		if err != nil {
+			status = batchItemFailed
+		}
+		resultJSON, _ := json.Marshal(result)
+		// The entry is now stored as an email, so the request isn't kept
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE transactional_batch_items
+			SET status = $2, result = $3, request = NULL, processed_at = NOW()
+			WHERE id = $1
+		`, e.id, status, string(resultJSON))
+		if err != nil {
+			return fmt.Errorf("failed to record batch result: %w", err)
+		}
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE transactional_batches SET status = $2, completed_at = NOW() WHERE id = $1
+	`, batchID, batchStatusCompleted)
+	if err != nil {
+		return fmt.Errorf("failed to complete batch: %w", err)
+	}
+	return nil
+}
+
+// batchEmailResult is the result of sending one batch entry
+func batchEmailResult(index int, resp *model.SendEmailResponse, err error) model.BatchEmailResult {
+	if err != nil {
+		_, code := apierror.From(err)
+		result := model.BatchEmailResult{
+			Index:     index,
+			Status:    "failed",
+			Error:     err.Error(),
+			ErrorCode: code,
+		}
+		var supErr *SuppressedRecipientError
+		if errors.As(err, &supErr) {
+			result.Suppressions = supErr.Suppressions
+		}
+		var contentErr *ContentBlockedError
+		if errors.As(err, &contentErr) {
+			result.Content = contentErr.Findings
+		}
+		return result
+	}
+
+	return model.BatchEmailResult{
+		Index:     index,
+		ID:        resp.ID,
+		MessageID: resp.MessageID,
+		Status:    resp.Status,
+		Content:   resp.ContentWarnings,
+	}
+}
+
+// GetBatch returns the progress of a batch and the result of each entry
+func (s *TransactionalService) GetBatch(ctx context.Context, orgID int64, batchUUID string) (*model.BatchStatusResponse, error) {
+	var batchID int64
+	var completedAt sql.NullTime
+	batch := &model.BatchStatusResponse{BatchID: batchUUID}
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, status, total, created_at, completed_at
+		FROM transactional_batches
+		WHERE uuid = $1 AND org_id = $2
+	`, batchUUID, orgID).Scan(&batchID, &batch.Status, &batch.Total, &batch.CreatedAt, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil, apierror.New(http.StatusNotFound, apierror.CodeBatchNotFound, "batch not found")
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch: %w", err)
+	}
+	if completedAt.Valid {
+		batch.CompletedAt = &completedAt.Time
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT position, status, result FROM transactional_batch_items
+		WHERE batch_id = $1
+		ORDER BY position
+	`, batchID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get batch results: %w", err)
+	}
+	defer rows.Close()
+
+	batch.Results = make([]model.BatchEmailResult, 0, batch.Total)
+	for rows.Next() {
+		var position int
+		var status string
+		var resultJSON sql.NullString
+		if err := rows.Scan(&position, &status, &resultJSON); err != nil {
+			return nil, fmt.Errorf("failed to get batch results: %w", err)
+		}
+
+		result := model.BatchEmailResult{Index: position, Status: batchItemPending}
+		if resultJSON.Valid {
+			json.Unmarshal([]byte(resultJSON.String), &result)
+		}
+		switch status {
+		case batchItemAccepted:
+			batch.Accepted++
+		case batchItemFailed:
+			batch.Failed++
+		default:
+			batch.Pending++
+		}
+		batch.Results = append(batch.Results, result)
+	}
+
+	return batch, nil
+}
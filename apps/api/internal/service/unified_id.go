@@ -0,0 +1,51 @@
+package service
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Mailboxes, emails, threads and drafts of the Stalwart accounts are named
+// across identities by unified IDs, which pair the identity with the JMAP ID.
+// They're base64url-encoded, so clients treat them as opaque and JMAP IDs may
+// hold any character. IDs of the older "<identityID>:<jmapID>" form are still
+// accepted.
+
+// formatUnifiedID returns the unified ID of a JMAP object of an identity
+func formatUnifiedID(identityID int64, jmapID string) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(identityID, 10) + ":" + jmapID))
+}
+
+// parseUnifiedID returns the identity and JMAP ID of a unified ID
+func parseUnifiedID(id string) (int64, string, error) {
+	raw := id
+	if prefix, _, ok := strings.Cut(id, ":"); !ok || !isDigits(prefix) {
+		decoded, err := base64.RawURLEncoding.DecodeString(id)
+		if err != nil {
+			return 0, "", fmt.Errorf("invalid unified ID format: %s", id)
+		}
+		raw = string(decoded)
+	}
+
+	prefix, jmapID, ok := strings.Cut(raw, ":")
+	identityID, err := strconv.ParseInt(prefix, 10, 64)
+	if !ok || err != nil || identityID <= 0 || jmapID == "" {
+		return 0, "", fmt.Errorf("invalid unified ID format: %s", id)
+	}
+	return identityID, jmapID, nil
+}
+
+// isDigits reports whether s is a non-empty run of ASCII digits
+func isDigits(s string) bool {
+	if s == "" {
+		return false
+	}
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
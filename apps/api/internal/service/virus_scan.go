@@ -0,0 +1,113 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"time"
+)
+
+// Attachments of received emails are scanned with ClamAV when CLAMAV_ADDR is
+// set. Emails with an infected attachment, or which SES itself flagged, are
+// quarantined, and their flagged attachments are neither stored nor served.
+
+// Virus verdicts, as SES reports them
+const (
+	VirusVerdictPass   = "PASS"
+	VirusVerdictFail   = "FAIL"
+	VirusVerdictFailed = "PROCESSING_FAILED"
+)
+
+// QuarantineFolder holds received emails carrying malware. Inbox filters skip
+// them.
+const QuarantineFolder = "quarantine"
+
+const (
+	// virusScanTimeout bounds the scan of one attachment
+	virusScanTimeout = 30 * time.Second
+	// clamdChunkSize is the size of the chunks attachments are streamed in
+	clamdChunkSize = 64 * 1024
+)
+
+// SetVirusScanAddr sets the clamd host:port attachments are scanned with
+func (s *ReceivingService) SetVirusScanAddr(addr string) {
+	s.clamdAddr = addr
+}
+
+// scanAttachment sets the virus verdict of an attachment. Attachments are
+// left without a verdict when no scanner is set up.
+func (s *ReceivingService) scanAttachment(ctx context.Context, att *AttachmentInfo) {
+	if s.clamdAddr == "" {
+		return
+	}
+	ctx, cancel := context.WithTimeout(ctx, virusScanTimeout)
+	defer cancel()
+
+	virus, err := clamdScan(ctx, s.clamdAddr, att.data)
+	switch {
+	case err != nil:
+		log.Printf("Failed to scan attachment %s: %v", att.Filename, err)
+		att.VirusVerdict = VirusVerdictFailed
+	case virus != "":
+		log.Printf("Attachment %s is infected: %s", att.Filename, virus)
+		att.VirusVerdict = VirusVerdictFail
+		att.VirusName = virus
+	default:
+		att.VirusVerdict = VirusVerdictPass
+	}
+}
+
+// clamdScan scans data with clamd using the INSTREAM command, returning the
+// name of the virus found, if any
+func clamdScan(ctx context.Context, addr string, data []byte) (string, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return "", fmt.Errorf("clamd connection failed: %w", err)
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	if _, err := conn.Write([]byte("zINSTREAM\x00")); err != nil {
+		return "", fmt.Errorf("clamd request failed: %w", err)
+	}
+	// Length-prefixed chunks, ended by an empty one
+	size := make([]byte, 4)
+	for len(data) > 0 {
+		chunk := data[:min(len(data), clamdChunkSize)]
+		data = data[len(chunk):]
+		binary.BigEndian.PutUint32(size, uint32(len(chunk)))
+		if _, err := conn.Write(size); err != nil {
+			return "", fmt.Errorf("clamd request failed: %w", err)
+		}
+		if _, err := conn.Write(chunk); err != nil {
+			return "", fmt.Errorf("clamd request failed: %w", err)
+		}
+	}
+	binary.BigEndian.PutUint32(size, 0)
+	if _, err := conn.Write(size); err != nil {
+		return "", fmt.Errorf("clamd request failed: %w", err)
+	}
+
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("clamd response failed: %w", err)
+	}
+	// "stream: OK", "stream: <virus> FOUND" or "<reason> ERROR"
+	reply = strings.TrimSpace(strings.TrimRight(reply, "\x00"))
+	reply = strings.TrimPrefix(reply, "stream: ")
+	switch {
+	case reply == "OK":
+		return "", nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return strings.TrimSuffix(reply, " FOUND"), nil
+	default:
+		return "", fmt.Errorf("clamd returned %s", reply)
+	}
+}
@@ -30,6 +30,7 @@ const (
 	TriggerComplaintReceived = "complaint_received"
 	TriggerSubscribed       = "subscribed"
 	TriggerUnsubscribed     = "unsubscribed"
+	TriggerContactExportReady = "contact_export_ready"
 )
 
 // WebhookTrigger represents a webhook trigger configuration
@@ -98,7 +99,8 @@ func (s *WebhookTriggerService) Create(ctx context.Context, userID, orgID int64,
 	// Validate trigger type
 	validTypes := []string{TriggerEmailReceived, TriggerEmailSent, TriggerContactCreated, TriggerContactUpdated,
 		TriggerContactDeleted, TriggerCampaignSent, TriggerCampaignOpened, TriggerCampaignClicked,
-		TriggerBounceReceived, TriggerComplaintReceived, TriggerSubscribed, TriggerUnsubscribed}
+		TriggerBounceReceived, TriggerComplaintReceived, TriggerSubscribed, TriggerUnsubscribed,
+		TriggerContactExportReady}
 	valid := false
 	for _, t := range validTypes {
 		if input.TriggerType == t {
@@ -423,5 +425,6 @@ func (s *WebhookTriggerService) GetAvailableTriggerTypes() []map[string]string {
 		{"type": TriggerComplaintReceived, "name": "Complaint Received", "description": "Triggered when a spam complaint is received"},
 		{"type": TriggerSubscribed, "name": "Subscribed", "description": "Triggered when someone subscribes to a list"},
 		{"type": TriggerUnsubscribed, "name": "Unsubscribed", "description": "Triggered when someone unsubscribes from a list"},
+		{"type": TriggerContactExportReady, "name": "Contact Export Ready", "description": "Triggered when a contact export has finished"},
 	}
 }
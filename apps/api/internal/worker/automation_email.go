@@ -0,0 +1,211 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+	"github.com/dublyo/mailat/api/pkg/templatepartial"
+	"github.com/dublyo/mailat/api/pkg/templating"
+	"github.com/dublyo/mailat/api/pkg/workflow"
+)
+
+// errContactUnreachable stops the enrollment of a contact who can't be emailed
+var errContactUnreachable = fmt.Errorf("the contact can't be emailed")
+
+// runEmail sends an email node's template to the enrollment's contact. The
+// email is one of the automation's, tracked like campaign emails, so goals and
+// conditions see its opens and clicks. Contacts who aren't active or are
+// suppressed aren't emailed.
+func (h *ScheduledTaskHandler) runEmail(ctx context.Context, run *enrollmentRun, node *workflow.Node) error {
+	email, err := node.Email()
+	if err != nil {
+		return err
+	}
+
+	contact := contactInfo{ID: run.contactID}
+	var attributesJSON []byte
+	var status string
+	var suppressed bool
+	err = h.db.QueryRowContext(ctx, `
+		SELECT c.email, COALESCE(c.first_name, ''), COALESCE(c.last_name, ''), COALESCE(c.attributes, '{}'),
+		       COALESCE(c.status, ''), EXISTS (SELECT 1 FROM suppressions s WHERE s.org_id = c.org_id AND s.email = c.email)
+		FROM contacts c
+		WHERE c.id = $1 AND c.org_id = $2 AND c.status IS DISTINCT FROM 'erased'
+	`, run.contactID, run.orgID).Scan(&contact.Email, &contact.FirstName, &contact.LastName, &attributesJSON, &status, &suppressed)
+	if err == sql.ErrNoRows {
+		return errContactGone
+	}
+	if err != nil {
+		return err
+	}
+	if !suppressed {
+		// The contact's address may be suppressed through an alias
+		aliases, err := emailaddr.Suppressed(ctx, h.db, run.orgID, []string{contact.Email})
+		if err != nil {
+			return err
+		}
+		suppressed = aliases[contact.Email]
+	}
+	if status != "active" || suppressed {
+		return errContactUnreachable
+	}
+	json.Unmarshal(attributesJSON, &contact.Attributes)
+
+	var templateID int64
+	var subject, htmlBody, textBody string
+	var useLayout, active bool
+	var schemaJSON []byte
+	err = h.db.QueryRowContext(ctx, `
+		SELECT id, subject, html_body, COALESCE(text_body, ''), use_layout, COALESCE(is_active, true), variable_schema
+		FROM email_templates WHERE org_id = $1 AND uuid::text = $2
+	`, run.orgID, email.TemplateID).Scan(&templateID, &subject, &htmlBody, &textBody, &useLayout, &active, &schemaJSON)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("template %s not found", email.TemplateID)
+	}
+	if err != nil {
+		return err
+	}
+	if !active {
+		return fmt.Errorf("template %s is inactive", email.TemplateID)
+	}
+	if email.Subject != "" {
+		subject = email.Subject
+	}
+
+	fromEmail, fromName, err := h.emailSender(ctx, run.orgID, email)
+	if err != nil {
+		return err
+	}
+	domain := fromEmail[strings.LastIndex(fromEmail, "@")+1:]
+	var domainID int64
+	err = h.db.QueryRowContext(ctx, `
+		SELECT id FROM domains WHERE org_id = $1 AND name = $2 AND status = 'active'
+	`, run.orgID, domain).Scan(&domainID)
+	if err == sql.ErrNoRows {
+		return fmt.Errorf("sender domain %s is not active", domain)
+	}
+	if err != nil {
+		return err
+	}
+
+	vars := CampaignMergeVariables(contact.Email, contact.FirstName, contact.LastName, contact.Attributes)
+	for name, field := range email.Variables {
+		if path, ok := strings.CutPrefix(field, "trigger."); ok {
+			vars[name] = automationtrigger.Lookup(run.trigger, path)
+			continue
+		}
+		vars[name] = contactValue(contact, field)
+	}
+	vars["trigger"] = run.trigger
+	if len(schemaJSON) > 0 {
+		// Defaults fill what the contact doesn't have; schemas are checked when saved
+		if schema, err := templating.ParseSchema(schemaJSON); err == nil {
+			vars, _ = schema.Validate(vars)
+		}
+	}
+	partials, err := templatepartial.Load(ctx, h.db, run.orgID)
+	if err != nil {
+		return err
+	}
+	if useLayout {
+		htmlBody = templatepartial.WithLayout(htmlBody, partials)
+	}
+	parts := []string{subject, htmlBody, textBody}
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		if parts[i], err = templating.Render(ctx, part, vars, partials); err != nil {
+			return fmt.Errorf("failed to render template: %w", err)
+		}
+	}
+	subject, htmlBody, textBody = parts[0], parts[1], parts[2]
+
+	var topicID sql.NullInt64
+	h.db.QueryRowContext(ctx, `SELECT topic_id FROM automations WHERE id = $1`, run.automationID).Scan(&topicID)
+
+	messageID := fmt.Sprintf("<%s@%s>", uuid.New().String(), domain)
+	var emailID int64
+	err = h.db.QueryRowContext(ctx, `
+		INSERT INTO emails (
+			org_id, message_id, identity_id, from_email, from_name,
+			to_emails, subject, html_content, text_content,
+			source, domain_id, automation_id, template_id, contact_id,
+			status, created_at, updated_at
+		)
+		VALUES ($1, $2, 0, $3, $4, $5, $6, $7, $8, 'automation', $9, $10, $11, $12, 'queued', NOW(), NOW())
+		RETURNING id
+	`,
+		run.orgID, messageID, fromEmail, fromName,
+		[]string{contact.Email}, subject, htmlBody, textBody,
+		domainID, run.automationID, templateID, contact.ID,
+	).Scan(&emailID)
+	if err != nil {
+		return fmt.Errorf("failed to create email record: %w", err)
+	}
+	h.db.ExecContext(ctx, `
+		INSERT INTO delivery_events (email_id, event_type, data, occurred_at)
+		VALUES ($1, 'queued', '{}', NOW())
+	`, emailID)
+
+	mailer := NewCampaignHandler(h.db, h.cfg)
+	return mailer.deliverEmail(ctx, contactMessage{
+		EmailID:   emailID,
+		OrgID:     run.orgID,
+		ContactID: contact.ID,
+		TopicID:   int(topicID.Int64),
+		MessageID: messageID,
+		FromEmail: fromEmail,
+		FromName:  fromName,
+		ReplyTo:   email.ReplyTo,
+		To:        contact.Email,
+		Subject:   subject,
+		HTML:      mailer.tracker.Apply(emailID, 0, contact.ID, htmlBody),
+		Text:      textBody,
+	})
+}
+
+// emailSender returns the address and name an email node sends from: its
+// identity's, or the address it names
+func (h *ScheduledTaskHandler) emailSender(ctx context.Context, orgID int64, email *workflow.Email) (string, string, error) {
+	if email.IdentityID == "" {
+		return email.FromEmail, email.FromName, nil
+	}
+	var address, name string
+	err := h.db.QueryRowContext(ctx, `
+		SELECT i.email, COALESCE(i.display_name, '')
+		FROM identities i JOIN users u ON u.id = i.user_id
+		WHERE i.uuid::text = $1 AND u.org_id = $2 AND COALESCE(i.can_send, true)
+	`, email.IdentityID, orgID).Scan(&address, &name)
+	if err == sql.ErrNoRows {
+		return "", "", fmt.Errorf("identity %s not found", email.IdentityID)
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if email.FromName != "" {
+		name = email.FromName
+	}
+	return address, name, nil
+}
+
+// contactValue returns the value of a contact field an email node maps a
+// template variable from
+func contactValue(contact contactInfo, field string) any {
+	switch field {
+	case "email":
+		return contact.Email
+	case "firstName":
+		return contact.FirstName
+	case "lastName":
+		return contact.LastName
+	}
+	return contact.Attributes[strings.TrimPrefix(field, "attributes.")]
+}
@@ -0,0 +1,65 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dublyo/mailat/api/pkg/automationgoal"
+)
+
+// convertEnrollments takes the contacts who reached their automation's goal
+// out of its workflow, wherever they are in it, and counts them as conversions
+// on the automation
+func (h *ScheduledTaskHandler) convertEnrollments(ctx context.Context) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, goal FROM automations WHERE status = 'active' AND goal IS NOT NULL
+	`)
+	if err != nil {
+		return err
+	}
+	type automation struct {
+		id   int64
+		goal *automationgoal.Goal
+	}
+	var automations []automation
+	for rows.Next() {
+		var a automation
+		var goalJSON []byte
+		if err := rows.Scan(&a.id, &goalJSON); err != nil {
+			continue
+		}
+		if a.goal, err = automationgoal.Parse(goalJSON); err != nil || a.goal == nil {
+			continue
+		}
+		automations = append(automations, a)
+	}
+	rows.Close()
+
+	for _, a := range automations {
+		where, arg := a.goal.Where("e", 2)
+		var converted int
+		err := h.db.QueryRowContext(ctx, `
+			WITH converted AS (
+				UPDATE automation_enrollments e
+				SET status = $3, converted_at = NOW(), next_run_at = NULL, updated_at = NOW()
+				WHERE e.automation_id = $1 AND e.status = 'active' AND `+where+`
+				RETURNING e.id, e.step_index
+			), logged AS (
+				INSERT INTO automation_logs (enrollment_id, automation_id, step_index, step_type, status, message, created_at)
+				SELECT id, $1, COALESCE(step_index, 0), 'goal', 'success', 'Reached the goal', NOW() FROM converted
+			)
+			SELECT COUNT(*) FROM converted
+		`, a.id, arg, EnrollmentConverted).Scan(&converted)
+		if err != nil {
+			fmt.Printf("Warning: failed to check the goal of automation %d: %v\n", a.id, err)
+			continue
+		}
+		if converted > 0 {
+			h.db.ExecContext(ctx, `
+				UPDATE automations SET converted_count = COALESCE(converted_count, 0) + $2 WHERE id = $1
+			`, a.id, converted)
+			fmt.Printf("Automation %d: %d contacts reached the goal\n", a.id, converted)
+		}
+	}
+	return nil
+}
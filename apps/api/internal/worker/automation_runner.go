@@ -0,0 +1,587 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/contactchange"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/listevent"
+	"github.com/dublyo/mailat/api/pkg/safehttp"
+	"github.com/dublyo/mailat/api/pkg/segment"
+	"github.com/dublyo/mailat/api/pkg/sendwindow"
+	"github.com/dublyo/mailat/api/pkg/templating"
+	"github.com/dublyo/mailat/api/pkg/workflow"
+)
+
+// Enrolled contacts go through their automation's workflow from the trigger,
+// node after node along its edges. A run takes each enrollment as far as it
+// can: up to a delay, which it waits out until a later run, or to the end of
+// the workflow. Email nodes send the contact a template, and conditions send
+// them down their yes or no edge. A node that fails is retried, skipped or stops
+// the enrollment, as the automation's error policy says. Every node counts the
+// contacts it ran for and the errors it had. Contacts who reach their
+// automation's goal leave the workflow before each run. Contacts enrolled by a
+// webhook request carry its payload, which emails and webhook actions can use.
+//
+// Enrollments start on the automation's latest workflow version and finish on
+// it, even when the workflow is edited in the meantime, unless the edit
+// migrated them onto the new version.
+
+// Automation run limits
+const (
+	automationRunBatch    = 500               // Enrollments taken by each run
+	automationMaxSteps    = workflow.MaxSteps // Nodes one enrollment goes through in a run
+	automationClaimFor    = 5 * time.Minute   // How long a run holds an enrollment before another run may take it
+	automationWebhookWait = 15 * time.Second  // How long a webhook node waits for an answer
+)
+
+// Enrollment statuses
+const (
+	EnrollmentActive    = "active"
+	EnrollmentCompleted = "completed"
+	EnrollmentConverted = "converted" // Reached the automation's goal
+	EnrollmentExited    = "exited"
+	EnrollmentError     = "error"
+	EnrollmentPaused    = "paused" // A node failed and the automation's error policy holds the contact there
+)
+
+// automationWebhookClient sends webhook nodes' requests. It refuses to connect
+// to internal addresses so automations can't be used to probe the private
+// network.
+var automationWebhookClient = safehttp.NewClient(automationWebhookWait)
+
+// enrollmentRun is an enrollment a run took, with its automation's workflow
+type enrollmentRun struct {
+	id             int64
+	automationID   int64
+	automationUUID string
+	automationName string
+	contactID      int64
+	orgID          int64
+	nodeID         string // The node the enrollment is at; empty before the trigger
+	stepIndex      int
+	version        int // The version of the workflow the enrollment is on
+	workflow       *workflow.Workflow
+	errorPolicy    workflow.ErrorPolicy
+	retryCount     int // Times the node the enrollment is at was retried
+	trigger        any // The payload of the webhook request that enrolled the contact, if one did
+}
+
+// HandleScheduledAutomationSteps moves the active enrollments that are due
+// through their automation's workflow
+func (h *ScheduledTaskHandler) HandleScheduledAutomationSteps(ctx context.Context, task *asynq.Task) error {
+	if err := h.convertEnrollments(ctx); err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT e.id FROM automation_enrollments e
+		JOIN automations a ON a.id = e.automation_id
+		WHERE e.status = 'active' AND a.status = 'active'
+		AND (e.next_run_at IS NULL OR e.next_run_at <= NOW())
+		ORDER BY e.next_run_at NULLS FIRST, e.id
+		LIMIT $1
+	`, automationRunBatch)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			ids = append(ids, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range ids {
+		if err := h.runEnrollment(ctx, id); err != nil {
+			fmt.Printf("Warning: failed to run automation enrollment %d: %v\n", id, err)
+		}
+	}
+	return nil
+}
+
+// runEnrollment takes an enrollment through its workflow as far as it can go
+// now. The enrollment is claimed first, so runs that overlap don't both take it.
+func (h *ScheduledTaskHandler) runEnrollment(ctx context.Context, enrollmentID int64) error {
+	run := &enrollmentRun{id: enrollmentID}
+	var workflowJSON, policyJSON, triggerJSON []byte
+	err := h.db.QueryRowContext(ctx, `
+		UPDATE automation_enrollments e SET next_run_at = NOW() + make_interval(secs => $2), updated_at = NOW()
+		FROM automations a
+		WHERE e.id = $1 AND a.id = e.automation_id AND e.status = 'active' AND a.status = 'active'
+		AND (e.next_run_at IS NULL OR e.next_run_at <= NOW())
+		RETURNING e.automation_id, a.uuid, a.name, e.contact_id, e.org_id, COALESCE(e.current_node_id, ''),
+		          COALESCE(e.step_index, 0), COALESCE(e.workflow_version, a.version, 1), COALESCE(e.retry_count, 0), a.error_policy,
+		          COALESCE(e.step_data->'trigger', 'null'),
+		          COALESCE((
+		              SELECT v.workflow FROM automation_versions v
+		              WHERE v.automation_id = a.id AND v.version = COALESCE(e.workflow_version, a.version, 1)
+		          ), a.workflow, '{}')
+	`, enrollmentID, automationClaimFor.Seconds()).Scan(
+		&run.automationID, &run.automationUUID, &run.automationName, &run.contactID, &run.orgID,
+		&run.nodeID, &run.stepIndex, &run.version, &run.retryCount, &policyJSON, &triggerJSON, &workflowJSON,
+	)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	run.errorPolicy = workflow.ParseErrorPolicy(policyJSON)
+	json.Unmarshal(triggerJSON, &run.trigger)
+	run.workflow, err = workflow.Parse(workflowJSON)
+	if err != nil {
+		return h.stopEnrollment(ctx, run, EnrollmentError, err.Error())
+	}
+
+	var node *workflow.Node
+	if run.nodeID == "" {
+		node = run.workflow.Start()
+		if node == nil {
+			return h.stopEnrollment(ctx, run, EnrollmentError, "the workflow has no trigger")
+		}
+	} else {
+		node = run.workflow.Node(run.nodeID)
+		if node == nil {
+			return h.stopEnrollment(ctx, run, EnrollmentError, fmt.Sprintf("node %s is no longer in the workflow", run.nodeID))
+		}
+	}
+
+	for steps := 0; node != nil; steps++ {
+		if steps == automationMaxSteps {
+			// Carry on in the next run
+			return h.moveEnrollment(ctx, run, node.ID, time.Now())
+		}
+
+		handle, wait, err := h.runNode(ctx, run, node)
+		if err == errContactGone {
+			return h.stopEnrollment(ctx, run, EnrollmentExited, "the contact was deleted")
+		}
+		if err == errContactUnreachable {
+			return h.stopEnrollment(ctx, run, EnrollmentExited, err.Error())
+		}
+		h.recordNode(ctx, run, node, handle, err)
+		if err != nil {
+			// The enrollment stays at the node that failed, so retrying it runs the node again
+			run.nodeID = node.ID
+			message := fmt.Sprintf("%s: %v", node.Name(), err)
+			if run.retryCount < run.errorPolicy.Retries {
+				return h.retryNode(ctx, run, message)
+			}
+			switch run.errorPolicy.OnFailure {
+			case workflow.OnFailureSkip:
+				// Carry on from the node as if it had worked
+				handle, wait = "", 0
+			case workflow.OnFailurePause:
+				return h.stopEnrollment(ctx, run, EnrollmentPaused, message)
+			default:
+				return h.stopEnrollment(ctx, run, EnrollmentError, message)
+			}
+		}
+		run.retryCount = 0
+
+		next := run.workflow.Next(node.ID, handle)
+		if wait > 0 && next != nil {
+			return h.moveEnrollment(ctx, run, next.ID, time.Now().Add(wait))
+		}
+		node = next
+	}
+	return h.stopEnrollment(ctx, run, EnrollmentCompleted, "")
+}
+
+// errContactGone stops the enrollment of a contact that was deleted
+var errContactGone = fmt.Errorf("contact not found")
+
+// runNode does what a node does for the enrollment's contact and returns the
+// edge the contact leaves it by, for conditions, and how long the contact waits
+// before the next node
+func (h *ScheduledTaskHandler) runNode(ctx context.Context, run *enrollmentRun, node *workflow.Node) (string, time.Duration, error) {
+	switch node.Data.Type {
+	case workflow.NodeTrigger:
+		return "", 0, nil
+	case workflow.NodeEmail:
+		return "", 0, h.runEmail(ctx, run, node)
+	case workflow.NodeDelay:
+		delay, err := node.Delay()
+		if err != nil {
+			return "", 0, err
+		}
+		loc := time.UTC
+		if delay.Local() {
+			loc = sendwindow.ContactLocation(ctx, h.db, run.orgID, run.contactID)
+		}
+		now := time.Now()
+		return "", delay.End(now, loc).Sub(now), nil
+	case workflow.NodeCondition:
+		handle, err := h.runCondition(ctx, run, node)
+		return handle, 0, err
+	case workflow.NodeAction:
+		action, err := node.Action()
+		if err != nil {
+			return "", 0, err
+		}
+		return "", 0, h.runAction(ctx, run, node, action)
+	}
+	return "", 0, fmt.Errorf("%s nodes can't be run", node.Data.Type)
+}
+
+// runCondition tests the contact against a condition's rules, the same rules
+// as dynamic segments, and returns the edge it takes: yes when it matches
+func (h *ScheduledTaskHandler) runCondition(ctx context.Context, run *enrollmentRun, node *workflow.Node) (string, error) {
+	rules, err := node.Rules()
+	if err != nil {
+		return "", err
+	}
+	matches, err := segment.Matches(ctx, h.db, run.automationID, run.contactID, rules)
+	if err != nil {
+		return "", err
+	}
+	if matches {
+		return workflow.HandleYes, nil
+	}
+	return workflow.HandleNo, nil
+}
+
+// runAction applies an action node to the enrollment's contact
+func (h *ScheduledTaskHandler) runAction(ctx context.Context, run *enrollmentRun, node *workflow.Node, action *workflow.Action) error {
+	var exists bool
+	err := h.db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM contacts WHERE id = $1 AND org_id = $2 AND status IS DISTINCT FROM 'erased')
+	`, run.contactID, run.orgID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return errContactGone
+	}
+
+	switch action.Type {
+	case workflow.ActionAddTag:
+		_, err := h.db.ExecContext(ctx, `
+			UPDATE contacts SET tags = array_append(COALESCE(tags, '{}'), $2), updated_at = NOW()
+			WHERE id = $1 AND NOT ($2 = ANY(COALESCE(tags, '{}')))
+		`, run.contactID, action.Tag)
+		return err
+	case workflow.ActionRemoveTag:
+		_, err := h.db.ExecContext(ctx, `
+			UPDATE contacts SET tags = array_remove(tags, $2), updated_at = NOW()
+			WHERE id = $1 AND $2 = ANY(tags)
+		`, run.contactID, action.Tag)
+		return err
+	case workflow.ActionAddToList, workflow.ActionRemoveFromList, workflow.ActionMoveToList:
+		return h.runListAction(ctx, run, action)
+	case workflow.ActionUpdateField:
+		return h.runFieldAction(ctx, run, action)
+	case workflow.ActionWebhook:
+		return h.runWebhookAction(ctx, run, node, action)
+	}
+	return fmt.Errorf("unknown action %q", action.Type)
+}
+
+// runListAction adds the contact to a list, removes it from one or moves it
+// between two, recording the list events. Dynamic lists' members come from
+// their rules, so they can't be changed.
+func (h *ScheduledTaskHandler) runListAction(ctx context.Context, run *enrollmentRun, action *workflow.Action) error {
+	listIDs := map[string]int{}
+	for _, listUUID := range action.Lists() {
+		var id int
+		var listType string
+		err := h.db.QueryRowContext(ctx, `
+			SELECT id, type FROM lists WHERE org_id = $1 AND uuid::text = $2
+		`, run.orgID, listUUID).Scan(&id, &listType)
+		if err == sql.ErrNoRows {
+			return fmt.Errorf("list %s not found", listUUID)
+		}
+		if err != nil {
+			return err
+		}
+		if listType == "dynamic" {
+			return fmt.Errorf("list %s is dynamic, its members come from its rules", listUUID)
+		}
+		listIDs[listUUID] = id
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if action.Type == workflow.ActionRemoveFromList || action.Type == workflow.ActionMoveToList {
+		from := listIDs[action.ListID]
+		if action.Type == workflow.ActionMoveToList {
+			from = listIDs[action.FromListID]
+		}
+		_, err := tx.ExecContext(ctx, `
+			WITH removed AS (
+				DELETE FROM list_contacts WHERE list_id = $1 AND contact_id = $2
+				RETURNING contact_id
+			)
+			INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+			SELECT $3, $1, contact_id, $4, $5, NOW() FROM removed
+		`, from, run.contactID, run.orgID, listevent.Removed, listevent.SourceAutomation)
+		if err != nil {
+			return err
+		}
+	}
+	if action.Type == workflow.ActionAddToList || action.Type == workflow.ActionMoveToList {
+		_, err := tx.ExecContext(ctx, `
+			WITH added AS (
+				INSERT INTO list_contacts (list_id, contact_id, created_at)
+				VALUES ($1, $2, NOW())
+				ON CONFLICT (list_id, contact_id) DO NOTHING
+				RETURNING contact_id
+			)
+			INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+			SELECT $3, $1, contact_id, $4, $5, NOW() FROM added
+		`, listIDs[action.ListID], run.contactID, run.orgID, listevent.Subscribed, listevent.SourceAutomation)
+		if err != nil {
+			return err
+		}
+	}
+
+	ids := make([]int, 0, len(listIDs))
+	for _, id := range listIDs {
+		ids = append(ids, id)
+	}
+	_, err = tx.ExecContext(ctx, `
+		UPDATE lists SET contact_count = (
+			SELECT COUNT(*) FROM list_contacts WHERE list_id = lists.id
+		), updated_at = NOW()
+		WHERE id = ANY($1)
+	`, pq.Array(ids))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// runFieldAction sets one of the contact's fields or custom attributes, which
+// must hold a value of the attribute's field type, and records the change in
+// the contact's history
+func (h *ScheduledTaskHandler) runFieldAction(ctx context.Context, run *enrollmentRun, action *workflow.Action) error {
+	column, key := action.Column()
+	value := action.Value
+	if key != "" && value != nil {
+		fields, err := contactfield.Load(ctx, h.db, run.orgID)
+		if err != nil {
+			return err
+		}
+		for i := range fields {
+			if fields[i].Key == key {
+				if value, err = fields[i].Normalize(value); err != nil {
+					return fmt.Errorf("%s %w", fields[i].Label, err)
+				}
+			}
+		}
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := contactchange.Take(ctx, tx, run.contactID)
+	if err != nil {
+		return err
+	}
+	switch {
+	case column != "":
+		text := ""
+		if value != nil {
+			text = fmt.Sprint(value)
+		}
+		_, err = tx.ExecContext(ctx, `
+			UPDATE contacts SET `+column+` = NULLIF($2, ''), updated_at = NOW() WHERE id = $1
+		`, run.contactID, text)
+	case value == nil:
+		_, err = tx.ExecContext(ctx, `
+			UPDATE contacts SET attributes = COALESCE(attributes, '{}') - $2, updated_at = NOW() WHERE id = $1
+		`, run.contactID, key)
+	default:
+		data, _ := json.Marshal(value)
+		_, err = tx.ExecContext(ctx, `
+			UPDATE contacts SET attributes = jsonb_set(COALESCE(attributes, '{}'), ARRAY[$2::text], $3::jsonb), updated_at = NOW()
+			WHERE id = $1
+		`, run.contactID, key, string(data))
+	}
+	if err != nil {
+		return err
+	}
+	_, err = contactchange.Record(ctx, tx, run.orgID, run.contactID, before, contactchange.Source{
+		Source: "automation", SourceID: run.automationUUID,
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// runWebhookAction sends the contact to a URL. The body is the node's payload
+// template rendered with the contact, automation and node, or by default all
+// of them as JSON. Answers outside 2xx fail the node.
+func (h *ScheduledTaskHandler) runWebhookAction(ctx context.Context, run *enrollmentRun, node *workflow.Node, action *workflow.Action) error {
+	var contactUUID, email, firstName, lastName, status string
+	var tags []string
+	var attributesJSON []byte
+	err := h.db.QueryRowContext(ctx, `
+		SELECT uuid, email, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(status, ''),
+		       COALESCE(tags, '{}'), COALESCE(attributes, '{}')
+		FROM contacts WHERE id = $1
+	`, run.contactID).Scan(&contactUUID, &email, &firstName, &lastName, &status, pq.Array(&tags), &attributesJSON)
+	if err != nil {
+		return err
+	}
+	attributes := map[string]any{}
+	json.Unmarshal(attributesJSON, &attributes)
+
+	vars := map[string]any{
+		"contact": map[string]any{
+			"id":         contactUUID,
+			"email":      email,
+			"firstName":  firstName,
+			"lastName":   lastName,
+			"status":     status,
+			"tags":       tags,
+			"attributes": attributes,
+		},
+		"automation": map[string]any{"id": run.automationUUID, "name": run.automationName},
+		"node":       map[string]any{"id": node.ID, "label": node.Data.Label},
+		"trigger":    run.trigger,
+		"timestamp":  time.Now().UTC().Format(time.RFC3339),
+	}
+
+	var body []byte
+	if action.Payload == "" {
+		body, err = json.Marshal(vars)
+		if err != nil {
+			return err
+		}
+	} else {
+		rendered, err := templating.Render(ctx, action.Payload, vars, nil)
+		if err != nil {
+			return fmt.Errorf("failed to render payload: %w", err)
+		}
+		if !json.Valid([]byte(rendered)) {
+			return fmt.Errorf("payload isn't valid JSON once rendered; use the json filter for values")
+		}
+		body = []byte(rendered)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, action.Method, action.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	for name, value := range action.Headers {
+		req.Header.Set(name, value)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fmt.Sprintf("%s/1.0", h.cfg.AppName))
+
+	resp, err := automationWebhookClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("webhook failed: %w", err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook answered %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// recordNode counts a node's run in its stats and the enrollment's log, with
+// the edge a condition took
+func (h *ScheduledTaskHandler) recordNode(ctx context.Context, run *enrollmentRun, node *workflow.Node, handle string, nodeErr error) {
+	success, errors := 1, 0
+	status, message := "success", ""
+	if nodeErr != nil {
+		success, errors = 0, 1
+		status, message = "error", nodeErr.Error()
+	}
+
+	h.db.ExecContext(ctx, `
+		INSERT INTO automation_node_stats (automation_id, node_id, node_type, success_count, error_count, yes_count, no_count, last_error, last_run_at)
+		VALUES ($1, $2, $3, $4, $5, CASE WHEN $7 = 'yes' THEN 1 ELSE 0 END, CASE WHEN $7 = 'no' THEN 1 ELSE 0 END, NULLIF($6, ''), NOW())
+		ON CONFLICT (automation_id, node_id) DO UPDATE SET
+			node_type = EXCLUDED.node_type,
+			success_count = automation_node_stats.success_count + EXCLUDED.success_count,
+			error_count = automation_node_stats.error_count + EXCLUDED.error_count,
+			yes_count = COALESCE(automation_node_stats.yes_count, 0) + EXCLUDED.yes_count,
+			no_count = COALESCE(automation_node_stats.no_count, 0) + EXCLUDED.no_count,
+			last_error = COALESCE(EXCLUDED.last_error, automation_node_stats.last_error),
+			last_run_at = NOW()
+	`, run.automationID, node.ID, node.Data.Type, success, errors, message, handle)
+
+	run.stepIndex++
+	h.db.ExecContext(ctx, `
+		INSERT INTO automation_logs (enrollment_id, automation_id, step_index, step_type, status, message, data, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), jsonb_strip_nulls(jsonb_build_object('nodeId', $7::text, 'branch', NULLIF($8, ''))), NOW())
+	`, run.id, run.automationID, run.stepIndex, node.Data.Type, status, message, node.ID, handle)
+}
+
+// moveEnrollment leaves the enrollment at a node until a time
+func (h *ScheduledTaskHandler) moveEnrollment(ctx context.Context, run *enrollmentRun, nodeID string, at time.Time) error {
+	_, err := h.db.ExecContext(ctx, `
+		UPDATE automation_enrollments
+		SET current_node_id = $2, step_index = $3, next_run_at = $4, workflow_version = $5, retry_count = 0,
+		    error_message = NULL, updated_at = NOW()
+		WHERE id = $1 AND status = 'active' AND COALESCE(workflow_version, $5) = $5
+	`, run.id, nodeID, run.stepIndex, at, run.version)
+	return err
+}
+
+// retryNode runs the node that failed again once the error policy's backoff for
+// the retry passed
+func (h *ScheduledTaskHandler) retryNode(ctx context.Context, run *enrollmentRun, message string) error {
+	retry := run.retryCount + 1
+	_, err := h.db.ExecContext(ctx, `
+		UPDATE automation_enrollments
+		SET current_node_id = $2, step_index = $3, next_run_at = $4, workflow_version = $5, retry_count = $6,
+		    error_message = $7, updated_at = NOW()
+		WHERE id = $1 AND status = 'active' AND COALESCE(workflow_version, $5) = $5
+	`, run.id, run.nodeID, run.stepIndex, time.Now().Add(run.errorPolicy.Backoff(retry)), run.version, retry, message)
+	return err
+}
+
+// stopEnrollment ends the enrollment as completed, exited, paused or in error,
+// and counts it on the automation
+func (h *ScheduledTaskHandler) stopEnrollment(ctx context.Context, run *enrollmentRun, status, message string) error {
+	// Enrollments that reached the goal while they ran stay converted, and ones
+	// migrated to another version carry on there
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE automation_enrollments
+		SET status = $2, error_message = NULLIF($3, ''), step_index = $4, next_run_at = NULL, workflow_version = $5,
+		    current_node_id = COALESCE(NULLIF($6, ''), current_node_id),
+		    completed_at = CASE WHEN $2 = 'completed' THEN NOW() ELSE completed_at END, updated_at = NOW()
+		WHERE id = $1 AND status = 'active' AND COALESCE(workflow_version, $5) = $5
+	`, run.id, status, message, run.stepIndex, run.version, run.nodeID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return nil
+	}
+
+	switch status {
+	case EnrollmentCompleted:
+		_, err = h.db.ExecContext(ctx, `UPDATE automations SET completed_count = completed_count + 1 WHERE id = $1`, run.automationID)
+	case EnrollmentError, EnrollmentPaused:
+		_, err = h.db.ExecContext(ctx, `UPDATE automations SET error_count = COALESCE(error_count, 0) + 1 WHERE id = $1`, run.automationID)
+	}
+	return err
+}
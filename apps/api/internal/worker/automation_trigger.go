@@ -0,0 +1,140 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/dublyo/mailat/api/pkg/automationtrigger"
+)
+
+// HandleScheduledAutomationTriggers enrolls contacts in the active automations
+// whose trigger the scheduler evaluates: contacts whose date came up, and
+// contacts who sent an email since the automation was last looked at.
+// Contacts are enrolled again only in automations that allow re-enrollment,
+// and not in automations of a subscription topic they opted out of or beyond
+// the org's limit of automations per contact.
+func (h *ScheduledTaskHandler) HandleScheduledAutomationTriggers(ctx context.Context, task *asynq.Task) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, trigger_type, COALESCE(trigger_config, '{}'), COALESCE(trigger_checked_at, updated_at)
+		FROM automations
+		WHERE status = 'active' AND trigger_type IN ($1, $2)
+	`, automationtrigger.ContactDate, automationtrigger.EmailReceived)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	type automation struct {
+		id          int64
+		triggerType string
+		config      map[string]any
+		checkedAt   time.Time
+	}
+	var automations []automation
+	for rows.Next() {
+		var a automation
+		var configJSON []byte
+		if err := rows.Scan(&a.id, &a.triggerType, &configJSON, &a.checkedAt); err != nil {
+			continue
+		}
+		json.Unmarshal(configJSON, &a.config)
+		automations = append(automations, a)
+	}
+	rows.Close()
+
+	for _, a := range automations {
+		now := time.Now()
+		var enrolled int
+		var err error
+		switch a.triggerType {
+		case automationtrigger.ContactDate:
+			enrolled, err = h.enrollDateTrigger(ctx, a.id, a.config, a.checkedAt, now)
+		case automationtrigger.EmailReceived:
+			enrolled, err = h.enrollEmailTrigger(ctx, a.id, a.config, a.checkedAt, now)
+		}
+		if err != nil {
+			fmt.Printf("Warning: failed to evaluate the trigger of automation %d: %v\n", a.id, err)
+			continue
+		}
+		h.db.ExecContext(ctx, `
+			UPDATE automations SET trigger_checked_at = $2, enrolled_count = enrolled_count + $3 WHERE id = $1
+		`, a.id, now, enrolled)
+		if enrolled > 0 {
+			fmt.Printf("Automation %d: enrolled %d contacts\n", a.id, enrolled)
+		}
+	}
+	return nil
+}
+
+// enrollDateTrigger enrolls the active contacts whose date comes up on the
+// days since the trigger was last evaluated, today included, making up for at
+// most MaxCatchUpDays missed days
+func (h *ScheduledTaskHandler) enrollDateTrigger(ctx context.Context, automationID int64, config map[string]any, checkedAt, now time.Time) (int, error) {
+	trigger, err := automationtrigger.ParseDate(config)
+	if err != nil {
+		return 0, err
+	}
+
+	today := now.UTC().Truncate(24 * time.Hour)
+	day := checkedAt.UTC().Truncate(24 * time.Hour)
+	if earliest := today.AddDate(0, 0, -automationtrigger.MaxCatchUpDays); day.Before(earliest) {
+		day = earliest
+	}
+
+	enrolled := 0
+	for ; !day.After(today); day = day.AddDate(0, 0, 1) {
+		n, err := h.enrollContacts(ctx, `
+			SELECT c.id FROM automations a
+			JOIN contacts c ON c.org_id = a.org_id
+			WHERE a.id = $1 AND c.status = 'active' AND `+trigger.Where("c", "$2")+`
+		`, automationID, trigger.Date(day))
+		if err != nil {
+			return enrolled, err
+		}
+		enrolled += n
+	}
+	return enrolled, nil
+}
+
+// enrollEmailTrigger enrolls the contacts who sent an email to the org since
+// the trigger was last evaluated. Spam doesn't count.
+func (h *ScheduledTaskHandler) enrollEmailTrigger(ctx context.Context, automationID int64, config map[string]any, checkedAt, now time.Time) (int, error) {
+	trigger, err := automationtrigger.ParseEmail(config)
+	if err != nil {
+		return 0, err
+	}
+
+	return h.enrollContacts(ctx, `
+		SELECT DISTINCT c.id FROM automations a
+		JOIN received_emails re ON re.org_id = a.org_id
+		JOIN contacts c ON c.org_id = a.org_id AND LOWER(c.email) = LOWER(re.from_email)
+		WHERE a.id = $1 AND re.received_at > $2 AND re.received_at <= $3
+		AND NOT COALESCE(re.is_spam, false) AND c.status IS DISTINCT FROM 'erased'
+		AND ($4 = '' OR re.identity_id IN (SELECT i.id FROM identities i WHERE i.uuid::text = $4))
+		AND ($5 = '' OR re.subject ILIKE '%' || $5 || '%')
+	`, automationID, checkedAt, now, trigger.IdentityID, trigger.SubjectContains)
+}
+
+// enrollContacts enrolls the contacts a query selects, by ID, in the automation
+// whose ID is its first argument, and returns how many were enrolled
+func (h *ScheduledTaskHandler) enrollContacts(ctx context.Context, contacts string, args ...any) (int, error) {
+	var enrolled int
+	err := h.db.QueryRowContext(ctx, `
+		WITH enrolled AS (
+			INSERT INTO automation_enrollments (automation_id, contact_id, org_id, status, step_index, enrolled_at, updated_at)
+			SELECT a.id, t.id, a.org_id, 'active', 0, NOW(), NOW()
+			FROM automations a, (`+contacts+`) t
+			WHERE a.id = $1 AND `+automationtrigger.EnrollFilter("a", "t.id")+`
+			`+automationtrigger.OnConflict+`
+			RETURNING 1
+		)
+		SELECT COUNT(*) FROM enrolled
+	`, args...).Scan(&enrolled)
+	if err == sql.ErrNoRows {
+		return 0, nil
+	}
+	return enrolled, err
+}
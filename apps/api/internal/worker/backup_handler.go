@@ -0,0 +1,372 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/backup"
+)
+
+// Backup triggers and statuses, as stored in org_backups
+const (
+	BackupTriggerScheduled = "scheduled"
+	BackupTriggerManual    = "manual"
+
+	BackupStatusPending   = "pending"
+	BackupStatusRunning   = "running"
+	BackupStatusCompleted = "completed"
+	BackupStatusFailed    = "failed"
+	BackupStatusExpired   = "expired"
+)
+
+// BackupKey returns the key org backups are encrypted with
+func BackupKey(cfg *config.Config) string {
+	if cfg.BackupEncryptionKey != "" {
+		return cfg.BackupEncryptionKey
+	}
+	return cfg.EncryptionKey
+}
+
+// OpenBackupStore returns the S3 store org backups are kept in
+func OpenBackupStore(cfg *config.Config) (*provider.BackupStore, error) {
+	if cfg.BackupsBucket == "" || BackupKey(cfg) == "" {
+		return nil, fmt.Errorf("backup storage is not configured")
+	}
+	return provider.NewBackupStore(&provider.BackupStoreConfig{
+		Region:          cfg.AWSRegion,
+		AccessKeyID:     cfg.AWSAccessKeyID,
+		SecretAccessKey: cfg.AWSSecretAccessKey,
+		Bucket:          cfg.BackupsBucket,
+	})
+}
+
+// HandleBackups backs up every organization with scheduled backups enabled and
+// deletes their backups past the retention window
+func (h *ScheduledTaskHandler) HandleBackups(ctx context.Context, task *asynq.Task) error {
+	if h.cfg.BackupsBucket == "" {
+		return nil
+	}
+	fmt.Println("Running scheduled org backups...")
+
+	store, err := OpenBackupStore(h.cfg)
+	if err != nil {
+		return permanentError(FailureInternal, "backup_storage_unconfigured", err)
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id FROM organizations WHERE (settings->'backups'->>'enabled')::boolean IS TRUE
+	`)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	var orgIDs []int64
+	for rows.Next() {
+		var orgID int64
+		if err := rows.Scan(&orgID); err == nil {
+			orgIDs = append(orgIDs, orgID)
+		}
+	}
+	rows.Close()
+
+	for _, orgID := range orgIDs {
+		var backupID int64
+		err := h.db.QueryRowContext(ctx, `
+			INSERT INTO org_backups (org_id, trigger, status, created_at)
+			VALUES ($1, $2, $3, NOW())
+			RETURNING id
+		`, orgID, BackupTriggerScheduled, BackupStatusPending).Scan(&backupID)
+		if err != nil {
+			fmt.Printf("Warning: failed to create backup for org %d: %v\n", orgID, err)
+			continue
+		}
+
+		if err := h.RunBackup(ctx, store, orgID, backupID); err != nil {
+			fmt.Printf("Backup for org %d failed: %v\n", orgID, err)
+		}
+		h.pruneBackups(ctx, store, orgID, backup.Load(ctx, h.db, orgID).RetentionDays)
+	}
+
+	return nil
+}
+
+// HandleBackupRun takes an on-demand org backup
+func (h *ScheduledTaskHandler) HandleBackupRun(ctx context.Context, task *asynq.Task) error {
+	payload, err := UnmarshalBackupRunPayload(task.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	store, err := OpenBackupStore(h.cfg)
+	if err != nil {
+		h.failBackup(ctx, payload.OrgID, payload.BackupID, err)
+		return permanentError(FailureInternal, "backup_storage_unconfigured", err)
+	}
+
+	if err := h.RunBackup(ctx, store, payload.OrgID, payload.BackupID); err != nil {
+		return transientError(FailureInternal, "backup", err)
+	}
+	return nil
+}
+
+// RunBackup snapshots an organization's contacts, lists and consent history into
+// the backup record, then downloads and opens the stored archive again to verify it
+// can be restored. Failures are recorded on the backup and raised as an alert.
+func (h *ScheduledTaskHandler) RunBackup(ctx context.Context, store *provider.BackupStore, orgID, backupID int64) error {
+	var backupUUID string
+	err := h.db.QueryRowContext(ctx, `
+		UPDATE org_backups SET status = $3, error = NULL
+		WHERE id = $1 AND org_id = $2
+		RETURNING uuid
+	`, backupID, orgID, BackupStatusRunning).Scan(&backupUUID)
+	if err != nil {
+		return fmt.Errorf("failed to start backup: %w", err)
+	}
+
+	if err := h.takeBackup(ctx, store, orgID, backupID, backupUUID); err != nil {
+		h.failBackup(ctx, orgID, backupID, err)
+		return err
+	}
+	return nil
+}
+
+func (h *ScheduledTaskHandler) takeBackup(ctx context.Context, store *provider.BackupStore, orgID, backupID int64, backupUUID string) error {
+	archive, err := h.collectBackup(ctx, orgID)
+	if err != nil {
+		return err
+	}
+
+	key := BackupKey(h.cfg)
+	sealed, err := backup.Seal(archive, key)
+	if err != nil {
+		return err
+	}
+	checksum := backup.Checksum(sealed)
+
+	storageKey := fmt.Sprintf("orgs/%d/backups/%s.json.gz.enc", orgID, backupUUID)
+	if err := store.Put(ctx, storageKey, sealed); err != nil {
+		return err
+	}
+
+	// Read the archive back the way a restore would
+	stored, err := store.Get(ctx, storageKey)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	if backup.Checksum(stored) != checksum {
+		return fmt.Errorf("verification failed: stored archive checksum does not match")
+	}
+	opened, err := backup.Open(stored, key)
+	if err != nil {
+		return fmt.Errorf("verification failed: %w", err)
+	}
+	counts := archive.Counts()
+	if opened.OrgID != orgID || opened.Counts() != counts {
+		return fmt.Errorf("verification failed: stored archive contents do not match")
+	}
+
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE org_backups
+		SET status = $3, storage_key = $4, size = $5, checksum = $6,
+		    contact_count = $7, list_count = $8, membership_count = $9, consent_count = $10,
+		    verified_at = NOW(), completed_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, backupID, orgID, BackupStatusCompleted, storageKey, len(sealed), checksum,
+		counts.Contacts, counts.Lists, counts.Memberships, counts.Consent)
+	if err != nil {
+		return fmt.Errorf("failed to record backup: %w", err)
+	}
+	return nil
+}
+
+// collectBackup reads an organization's contacts, lists, list memberships and consent audit trail
+func (h *ScheduledTaskHandler) collectBackup(ctx context.Context, orgID int64) (*backup.Archive, error) {
+	archive := &backup.Archive{
+		Version:   backup.ArchiveVersion,
+		OrgID:     orgID,
+		CreatedAt: time.Now(),
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, uuid, email, COALESCE(first_name, ''), COALESCE(last_name, ''),
+		       COALESCE(attributes::text, '{}'), COALESCE(status, 'active'), COALESCE(consent_source, ''),
+		       consent_timestamp, COALESCE(consent_ip, ''), COALESCE(consent_user_agent, ''),
+		       last_engaged_at, COALESCE(engagement_score, 0), created_at
+		FROM contacts WHERE org_id = $1
+		ORDER BY id
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up contacts: %w", err)
+	}
+	for rows.Next() {
+		var c backup.Contact
+		var attributes string
+		var consentTimestamp, lastEngagedAt sql.NullTime
+		if err := rows.Scan(&c.ID, &c.UUID, &c.Email, &c.FirstName, &c.LastName, &attributes, &c.Status,
+			&c.ConsentSource, &consentTimestamp, &c.ConsentIP, &c.ConsentUserAgent, &lastEngagedAt,
+			&c.EngagementScore, &c.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to back up contacts: %w", err)
+		}
+		c.Attributes = json.RawMessage(attributes)
+		if consentTimestamp.Valid {
+			c.ConsentTimestamp = &consentTimestamp.Time
+		}
+		if lastEngagedAt.Valid {
+			c.LastEngagedAt = &lastEngagedAt.Time
+		}
+		archive.Contacts = append(archive.Contacts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to back up contacts: %w", err)
+	}
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT id, uuid, name, COALESCE(description, ''), COALESCE(type, 'static'), segment_rules::text, created_at
+		FROM lists WHERE org_id = $1
+		ORDER BY id
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up lists: %w", err)
+	}
+	for rows.Next() {
+		var l backup.List
+		var segmentRules sql.NullString
+		if err := rows.Scan(&l.ID, &l.UUID, &l.Name, &l.Description, &l.Type, &segmentRules, &l.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to back up lists: %w", err)
+		}
+		if segmentRules.Valid {
+			l.SegmentRules = json.RawMessage(segmentRules.String)
+		}
+		archive.Lists = append(archive.Lists, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to back up lists: %w", err)
+	}
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT lc.list_id, lc.contact_id, lc.created_at
+		FROM list_contacts lc
+		JOIN lists l ON l.id = lc.list_id
+		WHERE l.org_id = $1
+		ORDER BY lc.id
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up list memberships: %w", err)
+	}
+	for rows.Next() {
+		var m backup.Membership
+		if err := rows.Scan(&m.ListID, &m.ContactID, &m.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to back up list memberships: %w", err)
+		}
+		archive.Memberships = append(archive.Memberships, m)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to back up list memberships: %w", err)
+	}
+
+	rows, err = h.db.QueryContext(ctx, `
+		SELECT id, contact_id, action, source, list_id, COALESCE(ip_address, ''),
+		       COALESCE(user_agent, ''), COALESCE(details, ''), created_at
+		FROM consent_audit WHERE org_id = $1
+		ORDER BY id
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up consent audit: %w", err)
+	}
+	for rows.Next() {
+		var r backup.ConsentRecord
+		var listID sql.NullInt64
+		if err := rows.Scan(&r.ID, &r.ContactID, &r.Action, &r.Source, &listID, &r.IPAddress,
+			&r.UserAgent, &r.Details, &r.CreatedAt); err != nil {
+			rows.Close()
+			return nil, fmt.Errorf("failed to back up consent audit: %w", err)
+		}
+		if listID.Valid {
+			id := int(listID.Int64)
+			r.ListID = &id
+		}
+		archive.Consent = append(archive.Consent, r)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to back up consent audit: %w", err)
+	}
+
+	return archive, nil
+}
+
+// pruneBackups deletes an organization's backups past the retention window. The
+// newest completed backup is kept however old it is.
+func (h *ScheduledTaskHandler) pruneBackups(ctx context.Context, store *provider.BackupStore, orgID int64, retentionDays int) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, COALESCE(storage_key, '')
+		FROM org_backups
+		WHERE org_id = $1 AND status IN ($2, $3)
+		  AND created_at < NOW() - make_interval(days => $4)
+		  AND id <> COALESCE((
+			SELECT id FROM org_backups WHERE org_id = $1 AND status = $2 ORDER BY created_at DESC LIMIT 1
+		  ), 0)
+	`, orgID, BackupStatusCompleted, BackupStatusFailed, retentionDays)
+	if err != nil {
+		fmt.Printf("Warning: failed to find expired backups: %v\n", err)
+		return
+	}
+	type expired struct {
+		id         int64
+		storageKey string
+	}
+	var backups []expired
+	for rows.Next() {
+		var b expired
+		if err := rows.Scan(&b.id, &b.storageKey); err == nil {
+			backups = append(backups, b)
+		}
+	}
+	rows.Close()
+
+	for _, b := range backups {
+		if b.storageKey != "" {
+			if err := store.Delete(ctx, b.storageKey); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+				continue
+			}
+		}
+		h.db.ExecContext(ctx, `
+			UPDATE org_backups SET status = $2, storage_key = NULL WHERE id = $1
+		`, b.id, BackupStatusExpired)
+	}
+}
+
+func (h *ScheduledTaskHandler) failBackup(ctx context.Context, orgID, backupID int64, err error) {
+	h.db.ExecContext(ctx, `
+		UPDATE org_backups SET status = $3, error = $4, completed_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, backupID, orgID, BackupStatusFailed, err.Error())
+
+	alertData, _ := json.Marshal(map[string]any{
+		"backupId": backupID,
+		"error":    err.Error(),
+	})
+
+	h.db.ExecContext(ctx, `
+		INSERT INTO alerts (org_id, type, severity, title, message, data, acknowledged, created_at)
+		VALUES ($1, 'backup', 'warning',
+			'Contact backup failed',
+			$2, $3, false, NOW())
+	`, orgID,
+		fmt.Sprintf("The backup of contacts, lists and consent history failed: %s", err.Error()),
+		alertData,
+	)
+}
@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+// BatchProcessor sends the entries of a transactional batch. It is implemented by
+// the transactional service, so batch entries go through the same checks as single
+// sends without the worker importing the service package.
+type BatchProcessor interface {
+	ProcessBatch(ctx context.Context, batchID int64) error
+}
+
+// BatchHandler handles transactional batch tasks
+type BatchHandler struct {
+	processor BatchProcessor
+}
+
+// NewBatchHandler creates a new batch handler
+func NewBatchHandler(processor BatchProcessor) *BatchHandler {
+	return &BatchHandler{processor: processor}
+}
+
+// HandleEmailBatch sends the entries of a batch that have not been sent yet
+func (h *BatchHandler) HandleEmailBatch(ctx context.Context, t *asynq.Task) error {
+	payload, err := UnmarshalEmailBatchPayload(t.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	if err := h.processor.ProcessBatch(ctx, payload.BatchID); err != nil {
+		return transientError(FailureInternal, "batch", fmt.Errorf("failed to process batch %d: %w", payload.BatchID, err))
+	}
+	return nil
+}
@@ -0,0 +1,50 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// campaignAudience is the worker's view of a campaign's audience column. Without
+// one, a campaign goes to its single list.
+type campaignAudience struct {
+	ListIDs        []int `json:"listIds"`
+	SegmentIDs     []int `json:"segmentIds"`
+	ExcludeListIDs []int `json:"excludeListIds"`
+}
+
+// audienceLists returns the lists a campaign's recipients come from and the lists
+// whose contacts are left out. Segments are dynamic lists, so their materialized
+// members are targeted like any list's.
+func audienceLists(listID int, audienceJSON []byte) (include, exclude []int64) {
+	var audience campaignAudience
+	if len(audienceJSON) == 0 || json.Unmarshal(audienceJSON, &audience) != nil {
+		return []int64{int64(listID)}, []int64{}
+	}
+
+	include = []int64{}
+	for _, id := range append(audience.ListIDs, audience.SegmentIDs...) {
+		include = append(include, int64(id))
+	}
+	if len(include) == 0 {
+		include = append(include, int64(listID))
+	}
+	exclude = []int64{}
+	for _, id := range audience.ExcludeListIDs {
+		exclude = append(exclude, int64(id))
+	}
+	return include, exclude
+}
+
+// AudienceFilter returns the SQL condition that the contact with the given alias
+// is on one of the lists of the include parameter and none of the exclude
+// parameter's. Both parameters are int arrays. A contact on several of the lists
+// still matches once, so recipients come out de-duplicated.
+func AudienceFilter(alias string, include, exclude int) string {
+	return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM list_contacts al WHERE al.contact_id = %[1]s.id AND al.list_id = ANY($%[2]d)
+		)
+		AND NOT EXISTS (
+			SELECT 1 FROM list_contacts xl WHERE xl.contact_id = %[1]s.id AND xl.list_id = ANY($%[3]d)
+		)`, alias, include, exclude)
+}
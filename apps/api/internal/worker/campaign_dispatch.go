@@ -0,0 +1,450 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+)
+
+// A campaign sends from a snapshot of its recipients taken when it starts, one
+// campaign_recipients row each. Rows move from pending to queued when the
+// dispatcher hands them to a batch task, to sending while the batch sends them,
+// and end as sent, failed, skipped or cancelled. The campaign's counters change
+// in the same transaction as the row, so they always add up.
+//
+// A row is claimed from queued to sending right before its email goes out, so
+// however batches, resumes and recovered runs overlap, each recipient is sent
+// once. Pausing hands the rest of a batch back to pending; a resumed or recovered
+// run picks the rows up again from there.
+
+// staleSendAfter is how long a recipient may stay in sending before it is taken
+// as lost to a crashed worker and settled, and how long a campaign may sit idle
+// before the recovery sweep restarts its dispatch
+const staleSendAfter = 15 * time.Minute
+
+// claimDispatch makes the run of a dispatcher task the campaign's current run. A
+// task without a run starts a new one and takes over; a task of a run that was
+// taken over reports false and stops, so resuming a campaign never leaves two
+// dispatchers running.
+func (h *CampaignHandler) claimDispatch(ctx context.Context, campaignID int, run string) (string, bool, error) {
+	next := uuid.New().String()
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE campaigns SET dispatch_run = $2
+		WHERE id = $1 AND ($3 = '' OR dispatch_run IS NULL OR dispatch_run::text = $3)
+	`, campaignID, next, run)
+	if err != nil {
+		return "", false, err
+	}
+	rows, _ := result.RowsAffected()
+	return next, rows > 0, nil
+}
+
+// scheduleDispatch queues the campaign's next dispatcher run. When it is due is
+// recorded, so the recovery sweep can tell a campaign waiting for its next run
+// from one whose dispatcher was lost.
+func (h *CampaignHandler) scheduleDispatch(ctx context.Context, campaign *campaignInfo, run string, at time.Time) error {
+	queueClient, err := NewQueueClient(h.cfg)
+	if err != nil {
+		return transientError(FailureInternal, "queue", fmt.Errorf("failed to create queue client: %w", err))
+	}
+	defer queueClient.Close()
+
+	_, err = queueClient.EnqueueCampaignProcessScheduled(&CampaignProcessPayload{
+		CampaignID: campaign.ID,
+		OrgID:      campaign.OrgID,
+		Run:        run,
+	}, at)
+	if err != nil {
+		return transientError(FailureInternal, "queue", fmt.Errorf("failed to schedule next campaign run: %w", err))
+	}
+	h.db.ExecContext(ctx, `
+		UPDATE campaigns SET dispatch_due_at = $3 WHERE id = $1 AND dispatch_run::text = $2
+	`, campaign.ID, run, at)
+	return nil
+}
+
+// snapshotRecipients records who the campaign goes to: the active, unsuppressed
+// contacts of its audience, once each, or the parent campaign's non-engaged recipients for a
+// resend. Contacts the campaign was already sent to are left out, so campaigns
+// that were sending before snapshots existed carry on where they were, as are
+// contacts the campaign's frequency cap or suppression segments hold back.
+func (h *CampaignHandler) snapshotRecipients(ctx context.Context, campaign *campaignInfo) error {
+	// Contacts whose address is suppressed through an alias
+	suppressed, err := emailaddr.SuppressedContacts(ctx, h.db, campaign.OrgID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	ignore := []int64{int64(campaign.ID)}
+	if campaign.ParentCampaignID.Valid {
+		ignore = append(ignore, campaign.ParentCampaignID.Int64)
+	}
+
+	if campaign.ParentCampaignID.Valid {
+		// Contacts already sent any resend of the parent are skipped
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO campaign_recipients (campaign_id, org_id, contact_id, email, domain)
+			SELECT DISTINCT $5::int, $2::int, c.id, c.email, LOWER(split_part(c.email, '@', 2))
+			FROM emails e
+			JOIN contacts c ON c.id = e.contact_id
+			WHERE e.campaign_id = $1 AND e.org_id = $2
+			AND e.status NOT IN ('bounced', 'failed')
+			AND c.status = 'active'
+			AND c.email NOT IN (SELECT email FROM suppressions WHERE org_id = $2)
+			AND c.id <> ALL($10)
+			AND NOT EXISTS (
+				SELECT 1 FROM delivery_events de
+				WHERE de.email_id = e.id AND de.event_type = ANY($3)
+				AND de.occurred_at <= COALESCE(e.sent_at, e.created_at) + make_interval(days => $4)
+			)
+			AND NOT EXISTS (
+				SELECT 1 FROM emails r
+				JOIN campaigns rc ON rc.id = r.campaign_id
+				WHERE rc.parent_campaign_id = $1 AND r.contact_id = c.id
+			)
+			AND `+SuppressionFilter("c", 6, 7, 8, 9)+`
+			ON CONFLICT (campaign_id, contact_id) DO NOTHING
+		`, campaign.ParentCampaignID.Int64, campaign.OrgID,
+			pq.Array(ResendExcludedEvents(campaign.ResendCriteria)), campaign.ResendWindowDays, campaign.ID,
+			pq.Array(ignore), campaign.FrequencyCapDays, pq.Array(campaign.SuppressionSegments), campaign.TopicID,
+			pq.Array(suppressed))
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO campaign_recipients (campaign_id, org_id, contact_id, email, domain)
+			SELECT $3, $2, c.id, c.email, LOWER(split_part(c.email, '@', 2))
+			FROM contacts c
+			WHERE c.org_id = $2 AND `+AudienceFilter("c", 1, 4)+`
+			AND c.status = 'active'
+			AND c.email NOT IN (SELECT email FROM suppressions WHERE org_id = $2)
+			AND c.id <> ALL($9)
+			AND NOT EXISTS (SELECT 1 FROM emails e WHERE e.campaign_id = $3 AND e.contact_id = c.id)
+			AND `+SuppressionFilter("c", 5, 6, 7, 8)+`
+			ORDER BY c.id
+			ON CONFLICT (campaign_id, contact_id) DO NOTHING
+		`, pq.Array(campaign.AudienceLists), campaign.OrgID, campaign.ID, pq.Array(campaign.ExcludedLists),
+			pq.Array(ignore), campaign.FrequencyCapDays, pq.Array(campaign.SuppressionSegments), campaign.TopicID,
+			pq.Array(suppressed))
+	}
+	if err != nil {
+		return err
+	}
+	if err := h.optimizeSendTimes(ctx, tx, campaign); err != nil {
+		return err
+	}
+	if err := h.scheduleLocalTimes(ctx, tx, campaign); err != nil {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE campaigns SET
+			total_recipients = sent_count + (SELECT COUNT(*) FROM campaign_recipients WHERE campaign_id = $1),
+			snapshot_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, campaign.ID)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	campaign.SnapshotAt = time.Now()
+	return nil
+}
+
+// settleStaleRecipients settles recipients a crashed batch left in sending.
+// Those whose email record shows it went out count as sent; the others fail, as
+// whether their email went out is unknown. Neither is retried, so a restart never
+// sends a recipient twice.
+func (h *CampaignHandler) settleStaleRecipients(ctx context.Context, campaignID int) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.QueryContext(ctx, `
+		WITH stale AS (
+			SELECT r.id, e.id AS email_id, COALESCE(e.status NOT IN ('queued', 'failed'), false) AS sent
+			FROM campaign_recipients r
+			LEFT JOIN LATERAL (
+				SELECT id, status FROM emails
+				WHERE campaign_id = r.campaign_id AND contact_id = r.contact_id
+				ORDER BY id DESC LIMIT 1
+			) e ON true
+			WHERE r.campaign_id = $1 AND r.status = 'sending' AND r.updated_at < NOW() - make_interval(secs => $2)
+		)
+		UPDATE campaign_recipients r SET
+			status = CASE WHEN s.sent THEN 'sent' ELSE 'failed' END,
+			email_id = s.email_id,
+			error = CASE WHEN s.sent THEN NULL ELSE 'interrupted while sending' END,
+			sent_at = CASE WHEN s.sent THEN NOW() END,
+			updated_at = NOW()
+		FROM stale s
+		WHERE r.id = s.id AND r.status = 'sending'
+		RETURNING s.sent
+	`, campaignID, staleSendAfter.Seconds())
+	if err != nil {
+		return
+	}
+	var sent, failed int
+	for rows.Next() {
+		var wasSent bool
+		if rows.Scan(&wasSent) != nil {
+			continue
+		}
+		if wasSent {
+			sent++
+		} else {
+			failed++
+		}
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		return
+	}
+
+	if sent+failed > 0 {
+		if _, err := tx.ExecContext(ctx, `
+			UPDATE campaigns SET sent_count = sent_count + $2, failed_count = failed_count + $3, updated_at = NOW()
+			WHERE id = $1
+		`, campaignID, sent, failed); err != nil {
+			return
+		}
+		fmt.Printf("Campaign %d: %d recipients were interrupted while sending, %d of them after their email went out\n",
+			campaignID, sent+failed, sent)
+	}
+	tx.Commit()
+}
+
+// getPendingRecipients returns the recipients waiting to be queued that are due
+func (h *CampaignHandler) getPendingRecipients(ctx context.Context, campaignID int) ([]contactInfo, error) {
+	return h.scanRecipients(h.db.QueryContext(ctx, `
+		SELECT r.id, r.domain, r.contact_id, r.email,
+			COALESCE(c.first_name, ''), COALESCE(c.last_name, ''), c.attributes, true
+		FROM campaign_recipients r
+		LEFT JOIN contacts c ON c.id = r.contact_id
+		WHERE r.campaign_id = $1 AND r.status = 'pending'
+		AND (r.send_after IS NULL OR r.send_after <= NOW())
+		ORDER BY r.id
+	`, campaignID))
+}
+
+// getQueuedRecipients returns the recipients of a batch that are still queued
+func (h *CampaignHandler) getQueuedRecipients(ctx context.Context, campaign *campaignInfo, recipientIDs []int64) ([]contactInfo, error) {
+	recipients, err := h.scanRecipients(h.db.QueryContext(ctx, `
+		SELECT r.id, r.domain, r.contact_id, r.email,
+			COALESCE(c.first_name, ''), COALESCE(c.last_name, ''), c.attributes,
+			COALESCE(c.status = 'active', false)
+				AND NOT EXISTS (SELECT 1 FROM suppressions s WHERE s.org_id = r.org_id AND s.email = r.email)
+		FROM campaign_recipients r
+		LEFT JOIN contacts c ON c.id = r.contact_id
+		WHERE r.id = ANY($1) AND r.campaign_id = $2 AND r.status = 'queued'
+		ORDER BY r.id
+	`, pq.Array(recipientIDs), campaign.ID))
+	if err != nil {
+		return nil, err
+	}
+
+	// Recipients suppressed since the snapshot through an alias of their address
+	emails := make([]string, 0, len(recipients))
+	for _, r := range recipients {
+		if r.Sendable {
+			emails = append(emails, r.Email)
+		}
+	}
+	suppressed, err := emailaddr.Suppressed(ctx, h.db, campaign.OrgID, emails)
+	if err != nil {
+		return nil, err
+	}
+	for i := range recipients {
+		if suppressed[recipients[i].Email] {
+			recipients[i].Sendable = false
+		}
+	}
+	return recipients, nil
+}
+
+func (h *CampaignHandler) scanRecipients(rows *sql.Rows, err error) ([]contactInfo, error) {
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var recipients []contactInfo
+	for rows.Next() {
+		var c contactInfo
+		var attributesJSON []byte
+		if err := rows.Scan(&c.RecipientID, &c.Domain, &c.ID, &c.Email, &c.FirstName, &c.LastName, &attributesJSON, &c.Sendable); err != nil {
+			return nil, err
+		}
+		if len(attributesJSON) > 0 {
+			json.Unmarshal(attributesJSON, &c.Attributes)
+		}
+		recipients = append(recipients, c)
+	}
+	return recipients, rows.Err()
+}
+
+// queueRecipients marks recipients queued and hands them to batch tasks. It
+// returns how many were queued; recipients a failed enqueue couldn't hand over
+// go back to pending.
+func (h *CampaignHandler) queueRecipients(ctx context.Context, campaign *campaignInfo, recipients []contactInfo) (int, error) {
+	if len(recipients) == 0 {
+		return 0, nil
+	}
+	ids := make([]int64, len(recipients))
+	for i, r := range recipients {
+		ids[i] = r.RecipientID
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		UPDATE campaign_recipients SET status = 'queued', updated_at = NOW()
+		WHERE id = ANY($1) AND status = 'pending'
+		RETURNING id
+	`, pq.Array(ids))
+	if err != nil {
+		return 0, transientError(FailureInternal, "database", fmt.Errorf("failed to queue recipients: %w", err))
+	}
+	var queued []int64
+	for rows.Next() {
+		var id int64
+		if rows.Scan(&id) == nil {
+			queued = append(queued, id)
+		}
+	}
+	rows.Close()
+	sort.Slice(queued, func(i, j int) bool { return queued[i] < queued[j] })
+
+	queueClient, err := NewQueueClient(h.cfg)
+	if err != nil {
+		h.releaseRecipients(ctx, campaign.ID, queued)
+		return 0, transientError(FailureInternal, "queue", fmt.Errorf("failed to create queue client: %w", err))
+	}
+	defer queueClient.Close()
+
+	for start := 0; start < len(queued); start += BatchSize {
+		end := min(start+BatchSize, len(queued))
+		_, err := queueClient.EnqueueCampaignBatch(&CampaignBatchPayload{
+			CampaignID:   campaign.ID,
+			OrgID:        campaign.OrgID,
+			RecipientIDs: queued[start:end],
+		})
+		if err != nil {
+			h.releaseRecipients(ctx, campaign.ID, queued[start:])
+			return start, transientError(FailureInternal, "queue", fmt.Errorf("failed to enqueue campaign batch: %w", err))
+		}
+	}
+	return len(queued), nil
+}
+
+// releaseRecipients puts queued recipients back to pending for a later run
+func (h *CampaignHandler) releaseRecipients(ctx context.Context, campaignID int, recipientIDs []int64) {
+	h.db.ExecContext(ctx, `
+		UPDATE campaign_recipients SET status = 'pending', updated_at = NOW()
+		WHERE id = ANY($1) AND campaign_id = $2 AND status = 'queued'
+	`, pq.Array(recipientIDs), campaignID)
+}
+
+// claimRecipient moves a queued recipient to sending, and reports false when
+// another batch or a cancel got to it first
+func (h *CampaignHandler) claimRecipient(ctx context.Context, recipientID int64) (bool, error) {
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE campaign_recipients SET status = 'sending', updated_at = NOW()
+		WHERE id = $1 AND status = 'queued'
+	`, recipientID)
+	if err != nil {
+		return false, err
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0, nil
+}
+
+// recordRecipient settles a sent recipient and counts it on the campaign
+func (h *CampaignHandler) recordRecipient(ctx context.Context, campaignID int, recipientID, emailID int64, sendErr error) error {
+	if sendErr != nil {
+		return h.settleRecipient(ctx, campaignID, recipientID, "failed", emailID, sendErr.Error())
+	}
+	return h.settleRecipient(ctx, campaignID, recipientID, "sent", emailID, "")
+}
+
+// skipRecipient settles a recipient that is no longer sendable. It comes off the
+// campaign's recipient count, which then still adds up to what was sent.
+func (h *CampaignHandler) skipRecipient(ctx context.Context, campaignID int, recipientID int64) {
+	if err := h.settleRecipient(ctx, campaignID, recipientID, "skipped", 0, ""); err != nil {
+		fmt.Printf("Warning: failed to skip campaign %d recipient %d: %v\n", campaignID, recipientID, err)
+	}
+}
+
+// recipientCounters is the campaign counter each final status changes
+var recipientCounters = map[string]string{
+	"sent":    "sent_count = sent_count + 1",
+	"failed":  "failed_count = failed_count + 1",
+	"skipped": "total_recipients = GREATEST(total_recipients - 1, 0)",
+}
+
+func (h *CampaignHandler) settleRecipient(ctx context.Context, campaignID int, recipientID int64, status string, emailID int64, errText string) error {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.ExecContext(ctx, `
+		UPDATE campaign_recipients SET
+			status = $2, email_id = NULLIF($3::bigint, 0), error = NULLIF($4, ''),
+			sent_at = CASE WHEN $5 THEN NOW() END, updated_at = NOW()
+		WHERE id = $1 AND status = 'sending'
+	`, recipientID, status, emailID, errText, status == "sent")
+	if err != nil {
+		return err
+	}
+	if rows, _ := result.RowsAffected(); rows == 0 {
+		return nil // Already failed as stale
+	}
+
+	if _, err := tx.ExecContext(ctx, `
+		UPDATE campaigns SET `+recipientCounters[status]+`, updated_at = NOW() WHERE id = $1
+	`, campaignID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// getCampaignStatus returns the campaign's current status
+func (h *CampaignHandler) getCampaignStatus(ctx context.Context, campaignID int) string {
+	var status string
+	h.db.QueryRowContext(ctx, `SELECT status FROM campaigns WHERE id = $1`, campaignID).Scan(&status)
+	return status
+}
+
+// finishCampaign marks a sending campaign sent once none of its recipients are
+// left to send, and reports whether it did
+func (h *CampaignHandler) finishCampaign(ctx context.Context, campaignID int) bool {
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE campaigns SET status = 'sent', completed_at = NOW(), updated_at = NOW()
+		WHERE id = $1 AND status = 'sending'
+		AND NOT EXISTS (
+			SELECT 1 FROM campaign_recipients
+			WHERE campaign_id = $1 AND status IN ('pending', 'queued', 'sending')
+		)
+	`, campaignID)
+	if err != nil {
+		return false
+	}
+	rows, _ := result.RowsAffected()
+	return rows > 0
+}
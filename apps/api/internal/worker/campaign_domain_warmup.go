@@ -0,0 +1,87 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/warmup"
+)
+
+// domainWarmup is the daily limit of a campaign's sending domain while it's new
+type domainWarmup struct {
+	domainID int
+	domain   string
+	limit    int
+}
+
+// getDomainWarmup returns the warmup of the campaign's sending domain, or nil
+// when the domain isn't new or the org turned domain warmup off
+func (h *CampaignHandler) getDomainWarmup(ctx context.Context, campaign *campaignInfo) *domainWarmup {
+	policy := warmup.LoadDomainPolicy(ctx, h.db, campaign.OrgID)
+	if !policy.Enabled {
+		return nil
+	}
+
+	domain := strings.ToLower(h.extractDomain(campaign.FromEmail))
+	if domain == "" {
+		return nil
+	}
+	dw := &domainWarmup{domain: domain}
+	var verifiedAt sql.NullTime
+	err := h.db.QueryRowContext(ctx, `
+		SELECT id, COALESCE(verified_at, created_at) FROM domains
+		WHERE org_id = $1 AND LOWER(name) = $2
+		LIMIT 1
+	`, campaign.OrgID, domain).Scan(&dw.domainID, &verifiedAt)
+	if err != nil || !verifiedAt.Valid {
+		return nil
+	}
+
+	if dw.limit = policy.DailyLimit(verifiedAt.Time, time.Now()); dw.limit == 0 {
+		return nil
+	}
+	return dw
+}
+
+// getDomainDailySentCount returns the number of emails a domain sent today,
+// transactional ones included
+func (h *CampaignHandler) getDomainDailySentCount(ctx context.Context, orgID int64, domainID int) int {
+	var count int
+	h.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM emails
+		WHERE org_id = $1 AND domain_id = $2 AND created_at >= CURRENT_DATE
+	`, orgID, domainID).Scan(&count)
+	return count
+}
+
+// getDomainInFlightCount returns the campaign recipients queued or being sent
+// from a domain, which have no email record yet
+func (h *CampaignHandler) getDomainInFlightCount(ctx context.Context, orgID int64, domain string) int {
+	var count int
+	h.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM campaign_recipients cr
+		JOIN campaigns c ON c.id = cr.campaign_id
+		WHERE cr.org_id = $1 AND cr.status IN ('queued', 'sending')
+			AND LOWER(SPLIT_PART(c.from_email, '@', 2)) = $2
+	`, orgID, domain).Scan(&count)
+	return count
+}
+
+// createDomainWarmupAlert tells the org a campaign carries over to tomorrow
+// because its sending domain reached its warmup limit for the day
+func (h *CampaignHandler) createDomainWarmupAlert(ctx context.Context, campaign *campaignInfo, dw *domainWarmup) {
+	alertData, _ := json.Marshal(map[string]any{
+		"campaignId": campaign.ID,
+		"domain":     dw.domain,
+		"dailyLimit": dw.limit,
+	})
+	h.db.ExecContext(ctx, `
+		INSERT INTO alerts (org_id, type, severity, title, message, data, acknowledged, created_at)
+		VALUES ($1, 'warmup', 'info', 'Domain Warmup Daily Limit Reached', $2, $3, false, NOW())
+	`, campaign.OrgID, fmt.Sprintf("%s is still warming up and sent its %d emails for today. Campaign %q will continue sending tomorrow.",
+		dw.domain, dw.limit, campaign.Name), alertData)
+}
@@ -8,20 +8,23 @@ import (
 	"fmt"
 	"net/smtp"
 	"strings"
-	"sync"
 	"time"
 
 	"github.com/google/uuid"
 	"github.com/hibiken/asynq"
 
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/pkg/tracking"
+	"github.com/dublyo/mailat/api/pkg/unsubscribe"
+	"github.com/dublyo/mailat/api/pkg/utm"
+	"github.com/dublyo/mailat/api/pkg/warmup"
 )
 
 const (
-	// BatchSize is the number of contacts to process per batch
+	// BatchSize is the number of recipients sent per batch task
 	BatchSize = 100
 
-	// RateLimit is the maximum emails per second per campaign
+	// RateLimit is the maximum emails per second of a batch task
 	RateLimit = 50
 
 	// MaxConcurrentCampaigns is the maximum number of campaigns to process concurrently
@@ -30,185 +33,188 @@ const (
 
 // CampaignHandler handles campaign processing tasks
 type CampaignHandler struct {
-	db              *sql.DB
-	cfg             *config.Config
-	activeCampaigns sync.Map // campaignID -> cancel function
-}
-
-// campaignState tracks the state of an active campaign
-type campaignState struct {
-	cancel context.CancelFunc
-	paused bool
+	db      *sql.DB
+	cfg     *config.Config
+	tracker *tracking.Tracker
 }
 
 // NewCampaignHandler creates a new campaign handler
 func NewCampaignHandler(db *sql.DB, cfg *config.Config) *CampaignHandler {
 	return &CampaignHandler{
-		db:  db,
-		cfg: cfg,
+		db:      db,
+		cfg:     cfg,
+		tracker: tracking.New(cfg.APIUrl, cfg.JWTSecret),
 	}
 }
 
-// HandleCampaignProcess processes a campaign by batching and sending emails
-// This implements a listmonk-style pipe-based processing pattern
+// HandleCampaignProcess is the dispatcher of a campaign. Its first run snapshots
+// the recipients; every run then queues as many due recipients as the throttle
+// profile, the warmup schedule and the org's send rate allow, in batches, and
+// schedules the next run for the rest.
 func (h *CampaignHandler) HandleCampaignProcess(ctx context.Context, task *asynq.Task) error {
 	payload, err := UnmarshalCampaignProcessPayload(task.Payload())
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal payload: %w", err)
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
 	}
 
-	// Create cancellable context for this campaign
-	campaignCtx, cancel := context.WithCancel(ctx)
-	h.activeCampaigns.Store(payload.CampaignID, &campaignState{cancel: cancel})
-	defer h.activeCampaigns.Delete(payload.CampaignID)
-
 	// Get campaign details
 	campaign, err := h.getCampaign(ctx, payload.CampaignID)
 	if err != nil {
-		return fmt.Errorf("failed to get campaign: %w", err)
+		return databaseError("campaign_not_found", fmt.Errorf("failed to get campaign: %w", err))
+	}
+
+	// Paused and cancelled campaigns stop here, resuming queues a new run
+	switch campaign.Status {
+	case "scheduled":
+		if campaign.ScheduledAt.After(time.Now()) {
+			return nil // Rescheduled since this task was queued
+		}
+		h.db.ExecContext(ctx, `
+			UPDATE campaigns SET status = 'sending', updated_at = NOW()
+			WHERE id = $1 AND status = 'scheduled'
+		`, campaign.ID)
+	case "sending":
+	default:
+		return nil
 	}
 
-	// Check if campaign should be processed
-	if campaign.Status != "sending" && campaign.Status != "scheduled" {
-		return nil // Campaign was paused or cancelled
+	run, ok, err := h.claimDispatch(ctx, campaign.ID, payload.Run)
+	if err != nil {
+		return transientError(FailureInternal, "database", fmt.Errorf("failed to claim campaign dispatch: %w", err))
+	}
+	if !ok {
+		return nil // A newer run dispatches the campaign
 	}
+	h.markCampaignStarted(ctx, campaign)
 
-	// Update status to sending
-	if campaign.Status == "scheduled" {
-		h.updateCampaignStatus(ctx, payload.CampaignID, "sending")
+	if campaign.SnapshotAt.IsZero() {
+		h.refreshSegments(ctx, campaign)
+		if err := h.snapshotRecipients(ctx, campaign); err != nil {
+			return transientError(FailureInternal, "database", fmt.Errorf("failed to snapshot recipients: %w", err))
+		}
 	}
+	h.settleStaleRecipients(ctx, campaign.ID)
 
-	// Get active contacts from list (excluding suppressed)
-	contacts, err := h.getCampaignContacts(ctx, campaign)
+	recipients, err := h.getPendingRecipients(ctx, campaign.ID)
 	if err != nil {
-		return fmt.Errorf("failed to get contacts: %w", err)
+		return transientError(FailureInternal, "database", fmt.Errorf("failed to get recipients: %w", err))
 	}
-
-	if len(contacts) == 0 {
-		h.completeCampaign(ctx, payload.CampaignID)
+	// Recipients waiting for their best send time are left to a later run
+	sendTimeDue := h.nextSendTime(ctx, campaign.ID)
+	if len(recipients) == 0 {
+		if !sendTimeDue.IsZero() {
+			return h.scheduleDispatch(ctx, campaign, run, sendTimeDue)
+		}
+		if h.finishCampaign(ctx, campaign.ID) && h.getWarmupLimit(ctx, campaign.OrgID) > 0 {
+			h.updateWarmupProgress(ctx, campaign.OrgID)
+		}
 		return nil
 	}
 
-	// Check IP warmup limits
-	warmupLimit := h.getWarmupLimit(ctx, campaign.OrgID)
-	dailySentCount := h.getDailySentCount(ctx, campaign.OrgID)
+	// Recipients outside the org's sending window in their timezone wait for a later run
+	sendable, deferredUntil := h.applySendingWindow(ctx, campaign, recipients)
 
-	// Process contacts in batches with rate limiting
-	rateLimiter := time.NewTicker(time.Second / RateLimit)
-	defer rateLimiter.Stop()
-
-	sentCount := 0
-	for i := 0; i < len(contacts); i++ {
-		select {
-		case <-campaignCtx.Done():
-			// Campaign was cancelled or paused
-			return nil
-		case <-rateLimiter.C:
-			// Check if campaign is still active
-			state, ok := h.activeCampaigns.Load(payload.CampaignID)
-			if ok && state.(*campaignState).paused {
-				return nil
-			}
-
-			// Check warmup limit
-			if warmupLimit > 0 && (dailySentCount+sentCount) >= warmupLimit {
-				fmt.Printf("Campaign %d paused: warmup daily limit reached (%d/%d)\n",
-					payload.CampaignID, dailySentCount+sentCount, warmupLimit)
-				h.updateCampaignStatus(ctx, payload.CampaignID, "paused")
-				h.updateCampaignProgress(ctx, payload.CampaignID, sentCount)
-				// Create alert
-				h.createWarmupAlert(ctx, campaign.OrgID, warmupLimit)
-				return nil
-			}
-
-			// Send email to contact
-			contact := contacts[i]
-			err := h.sendCampaignEmail(ctx, campaign, contact)
-			if err != nil {
-				// Log error but continue with other contacts
-				fmt.Printf("Failed to send to %s: %v\n", contact.Email, err)
-				continue
-			}
+	allowance := h.getSendAllowance(ctx, campaign)
+	if allowance.warmupReached {
+		h.createWarmupAlert(ctx, campaign.OrgID, allowance.warmupLimit)
+	}
+	if allowance.domainWarmup != nil {
+		h.createDomainWarmupAlert(ctx, campaign, allowance.domainWarmup)
+	}
+	selected, heldBack := allowance.take(sendable)
 
-			sentCount++
+	queued, err := h.queueRecipients(ctx, campaign, selected)
+	if err != nil {
+		return err
+	}
+	if queued > 0 {
+		fmt.Printf("Campaign %d: queued %d of %d pending recipients\n", campaign.ID, queued, len(recipients))
+	}
 
-			// Update progress every 100 emails
-			if sentCount%100 == 0 {
-				h.updateCampaignProgress(ctx, payload.CampaignID, sentCount)
-			}
+	// The next run picks up whatever this one left pending
+	var next time.Time
+	if heldBack {
+		next = time.Now().Add(allowance.wait)
+	}
+	for _, due := range []time.Time{deferredUntil, sendTimeDue} {
+		if !due.IsZero() && (next.IsZero() || due.Before(next)) {
+			next = due
 		}
 	}
-
-	// Update warmup day progress if applicable
-	if warmupLimit > 0 {
-		h.updateWarmupProgress(ctx, campaign.OrgID)
+	if next.IsZero() {
+		return nil
 	}
-
-	// Update final counts and mark as complete
-	h.updateCampaignProgress(ctx, payload.CampaignID, sentCount)
-	h.completeCampaign(ctx, payload.CampaignID)
-
-	return nil
+	return h.scheduleDispatch(ctx, campaign, run, next)
 }
 
-// HandleCampaignBatch processes a batch of campaign emails
+// HandleCampaignBatch sends a batch of a campaign's queued recipients. The
+// campaign's status is checked before each send, so a pause or cancel stops the
+// batch mid-way.
 func (h *CampaignHandler) HandleCampaignBatch(ctx context.Context, task *asynq.Task) error {
 	payload, err := UnmarshalCampaignBatchPayload(task.Payload())
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal payload: %w", err)
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
 	}
 
 	// Get campaign details
 	campaign, err := h.getCampaign(ctx, payload.CampaignID)
 	if err != nil {
-		return fmt.Errorf("failed to get campaign: %w", err)
+		return databaseError("campaign_not_found", fmt.Errorf("failed to get campaign: %w", err))
 	}
 
-	// Check if campaign is still sending
-	if campaign.Status != "sending" {
-		return nil
-	}
-
-	// Get contacts for this batch
-	contacts, err := h.getContactsByIDs(ctx, payload.OrgID, payload.ContactIDs)
+	recipients, err := h.getQueuedRecipients(ctx, campaign, payload.RecipientIDs)
 	if err != nil {
-		return fmt.Errorf("failed to get contacts: %w", err)
+		return transientError(FailureInternal, "database", fmt.Errorf("failed to get recipients: %w", err))
 	}
 
-	// Rate limiter for this batch
-	rateLimiter := time.NewTicker(time.Second / RateLimit)
+	// Rate limiter for this batch, slowed down by the campaign's throttle profile
+	rateLimiter := time.NewTicker(campaign.Throttle.sendInterval(time.Since(campaign.StartedAt)))
 	defer rateLimiter.Stop()
 
-	sentCount := 0
-	for _, contact := range contacts {
-		<-rateLimiter.C
+	for i, recipient := range recipients {
+		if status := h.getCampaignStatus(ctx, campaign.ID); status != "sending" {
+			// Resuming queues the rest again, cancelling already cancelled them
+			if status == "paused" {
+				h.releaseRecipients(ctx, campaign.ID, payload.RecipientIDs)
+			}
+			return nil
+		}
+		if i > 0 {
+			<-rateLimiter.C
+		}
 
-		err := h.sendCampaignEmail(ctx, campaign, contact)
+		claimed, err := h.claimRecipient(ctx, recipient.RecipientID)
 		if err != nil {
-			fmt.Printf("Failed to send to %s: %v\n", contact.Email, err)
+			return transientError(FailureInternal, "database", fmt.Errorf("failed to claim recipient: %w", err))
+		}
+		if !claimed {
 			continue
 		}
-		sentCount++
-	}
-
-	// Update progress
-	h.updateCampaignProgress(ctx, payload.CampaignID, sentCount)
 
-	return nil
-}
+		// Contacts that unsubscribed or were suppressed since the snapshot are skipped
+		if !recipient.Sendable {
+			h.skipRecipient(ctx, campaign.ID, recipient.RecipientID)
+			continue
+		}
 
-// PauseCampaign pauses an active campaign
-func (h *CampaignHandler) PauseCampaign(campaignID int) {
-	if state, ok := h.activeCampaigns.Load(campaignID); ok {
-		state.(*campaignState).paused = true
-		state.(*campaignState).cancel()
+		emailID, sendErr := h.sendCampaignEmail(ctx, campaign, recipient)
+		if sendErr != nil {
+			fmt.Printf("Failed to send to %s: %v\n", recipient.Email, classifySendError(sendErr))
+		}
+		if err := h.recordRecipient(ctx, campaign.ID, recipient.RecipientID, emailID, sendErr); err != nil {
+			fmt.Printf("Warning: failed to record campaign %d recipient %d: %v\n", campaign.ID, recipient.RecipientID, err)
+		}
 	}
+
+	h.finishCampaign(ctx, campaign.ID)
+	return nil
 }
 
 // campaignInfo holds campaign data for processing
 type campaignInfo struct {
 	ID          int
 	OrgID       int64
+	Name        string
 	Subject     string
 	HTMLContent string
 	TextContent string
@@ -217,6 +223,43 @@ type campaignInfo struct {
 	ReplyTo     string
 	ListID      int
 	Status      string
+
+	// Lists the recipients come from and lists whose contacts are left out
+	AudienceLists []int64
+	ExcludedLists []int64
+
+	// Recipients sent another campaign within this many days are left out, 0 for
+	// no cap, as are members of the suppression segments and contacts opted out
+	// of the campaign's subscription topic
+	FrequencyCapDays    int
+	SuppressionSegments []int64
+	TopicID             int
+
+	StartedAt   time.Time
+	ScheduledAt time.Time
+
+	// Set when each recipient is sent at this wall clock time in their timezone
+	ScheduledLocalAt time.Time
+
+	// Set once the recipients were snapshotted into campaign_recipients
+	SnapshotAt time.Time
+
+	// Set when the campaign has its own send rate profile
+	Throttle *throttleProfile
+
+	// Set when the campaign is sent regardless of the org's sending window
+	IgnoreSendWindow bool
+
+	// Set when each recipient is sent at their best engagement hour
+	SendTime *sendTimeProfile
+
+	// How links are tagged with UTM parameters, the org's policy with the campaign's override
+	UTM utm.Policy
+
+	// Set when the campaign is a resend to a parent campaign's non-engaged recipients
+	ParentCampaignID sql.NullInt64
+	ResendCriteria   string
+	ResendWindowDays int
 }
 
 // contactInfo holds contact data for sending
@@ -226,21 +269,34 @@ type contactInfo struct {
 	FirstName  string
 	LastName   string
 	Attributes map[string]any
+
+	// Set when loaded from a campaign's recipient snapshot
+	RecipientID int64
+	Domain      string
+	Sendable    bool // Still active and not suppressed
 }
 
 // getCampaign retrieves campaign details
 func (h *CampaignHandler) getCampaign(ctx context.Context, campaignID int) (*campaignInfo, error) {
 	var campaign campaignInfo
 	var replyTo sql.NullString
+	var resendSettingsJSON, throttleSettingsJSON, sendTimeSettingsJSON, audienceJSON, utmJSON, suppressionJSON []byte
+	var startedAt, scheduledAt, scheduledLocalAt, snapshotAt sql.NullTime
 
 	err := h.db.QueryRowContext(ctx, `
-		SELECT id, org_id, subject, html_content, text_content, from_name, from_email, reply_to, list_id, status
+		SELECT id, org_id, name, subject, html_content, text_content, from_name, from_email, reply_to, list_id, status,
+			started_at, scheduled_at, snapshot_at, parent_campaign_id, resend_settings, throttle_settings,
+			COALESCE(ignore_sending_window, false), send_time_settings, audience, utm_settings, suppression_settings,
+			scheduled_local_at
 		FROM campaigns WHERE id = $1
 	`, campaignID).Scan(
-		&campaign.ID, &campaign.OrgID, &campaign.Subject,
+		&campaign.ID, &campaign.OrgID, &campaign.Name, &campaign.Subject,
 		&campaign.HTMLContent, &campaign.TextContent,
 		&campaign.FromName, &campaign.FromEmail, &replyTo,
-		&campaign.ListID, &campaign.Status,
+		&campaign.ListID, &campaign.Status, &startedAt, &scheduledAt, &snapshotAt,
+		&campaign.ParentCampaignID, &resendSettingsJSON, &throttleSettingsJSON,
+		&campaign.IgnoreSendWindow, &sendTimeSettingsJSON, &audienceJSON, &utmJSON, &suppressionJSON,
+		&scheduledLocalAt,
 	)
 	if err != nil {
 		return nil, err
@@ -249,83 +305,106 @@ func (h *CampaignHandler) getCampaign(ctx context.Context, campaignID int) (*cam
 	if replyTo.Valid {
 		campaign.ReplyTo = replyTo.String
 	}
+	campaign.AudienceLists, campaign.ExcludedLists = audienceLists(campaign.ListID, audienceJSON)
+	campaign.FrequencyCapDays, campaign.SuppressionSegments, campaign.TopicID = suppressionRules(suppressionJSON)
 
-	return &campaign, nil
-}
-
-// getCampaignContacts retrieves active contacts for a campaign
-func (h *CampaignHandler) getCampaignContacts(ctx context.Context, campaign *campaignInfo) ([]contactInfo, error) {
-	rows, err := h.db.QueryContext(ctx, `
-		SELECT c.id, c.email, c.first_name, c.last_name, c.attributes
-		FROM contacts c
-		JOIN list_contacts lc ON lc.contact_id = c.id
-		WHERE lc.list_id = $1
-		AND c.status = 'active'
-		AND c.email NOT IN (SELECT email FROM suppressions WHERE org_id = $2)
-		ORDER BY c.id
-	`, campaign.ListID, campaign.OrgID)
-	if err != nil {
-		return nil, err
+	var utmOverride *utm.Override
+	if len(utmJSON) > 0 {
+		utmOverride = &utm.Override{}
+		json.Unmarshal(utmJSON, utmOverride)
 	}
-	defer rows.Close()
-
-	var contacts []contactInfo
-	for rows.Next() {
-		var c contactInfo
-		var attributesJSON []byte
-		if err := rows.Scan(&c.ID, &c.Email, &c.FirstName, &c.LastName, &attributesJSON); err != nil {
-			continue
+	campaign.UTM = utm.Load(ctx, h.db, campaign.OrgID).With(utmOverride)
+	if len(resendSettingsJSON) > 0 {
+		var settings struct {
+			Criteria   string `json:"criteria"`
+			WindowDays int    `json:"windowDays"`
 		}
-		if len(attributesJSON) > 0 {
-			json.Unmarshal(attributesJSON, &c.Attributes)
+		json.Unmarshal(resendSettingsJSON, &settings)
+		campaign.ResendCriteria = settings.Criteria
+		campaign.ResendWindowDays = settings.WindowDays
+	}
+	if startedAt.Valid {
+		campaign.StartedAt = startedAt.Time
+	}
+	if scheduledAt.Valid {
+		campaign.ScheduledAt = scheduledAt.Time
+	}
+	if scheduledLocalAt.Valid {
+		campaign.ScheduledLocalAt = scheduledLocalAt.Time
+	}
+	if snapshotAt.Valid {
+		campaign.SnapshotAt = snapshotAt.Time
+	}
+	if len(throttleSettingsJSON) > 0 {
+		var profile throttleProfile
+		if json.Unmarshal(throttleSettingsJSON, &profile) == nil && profile.MessagesPerHour > 0 {
+			campaign.Throttle = &profile
 		}
-		contacts = append(contacts, c)
+	}
+	if len(sendTimeSettingsJSON) > 0 {
+		var profile sendTimeProfile
+		if json.Unmarshal(sendTimeSettingsJSON, &profile) == nil && profile.WindowHours > 0 {
+			campaign.SendTime = &profile
+		}
+	}
+
+	if err := h.applyContentSnapshot(ctx, &campaign); err != nil {
+		return nil, err
 	}
 
-	return contacts, nil
+	return &campaign, nil
 }
 
-// getContactsByIDs retrieves contacts by their IDs
-func (h *CampaignHandler) getContactsByIDs(ctx context.Context, orgID int64, contactIDs []int64) ([]contactInfo, error) {
-	rows, err := h.db.QueryContext(ctx, `
-		SELECT id, email, first_name, last_name, attributes
-		FROM contacts
-		WHERE id = ANY($1) AND org_id = $2 AND status = 'active'
-	`, contactIDs, orgID)
+// applyContentSnapshot replaces a campaign's content with the snapshot taken when
+// it was scheduled or sent, so edits made since don't change what goes out.
+// Campaigns started before snapshots existed keep their live content.
+func (h *CampaignHandler) applyContentSnapshot(ctx context.Context, campaign *campaignInfo) error {
+	var htmlContent, textContent, replyTo sql.NullString
+	err := h.db.QueryRowContext(ctx, `
+		SELECT cs.subject, cs.html_content, cs.text_content, cs.from_name, cs.from_email, cs.reply_to
+		FROM campaigns c
+		JOIN campaign_snapshots cs ON cs.id = c.content_snapshot_id
+		WHERE c.id = $1
+	`, campaign.ID).Scan(&campaign.Subject, &htmlContent, &textContent, &campaign.FromName, &campaign.FromEmail, &replyTo)
+	if err == sql.ErrNoRows {
+		return nil
+	}
 	if err != nil {
-		return nil, err
+		return err
 	}
-	defer rows.Close()
+	campaign.HTMLContent = htmlContent.String
+	campaign.TextContent = textContent.String
+	campaign.ReplyTo = replyTo.String
+	return nil
+}
 
-	var contacts []contactInfo
-	for rows.Next() {
-		var c contactInfo
-		var attributesJSON []byte
-		if err := rows.Scan(&c.ID, &c.Email, &c.FirstName, &c.LastName, &attributesJSON); err != nil {
-			continue
-		}
-		if len(attributesJSON) > 0 {
-			json.Unmarshal(attributesJSON, &c.Attributes)
-		}
-		contacts = append(contacts, c)
+// ResendExcludedEvents returns the engagement events that disqualify a recipient from a resend
+func ResendExcludedEvents(criteria string) []string {
+	if criteria == "not_clicked" {
+		return []string{"clicked"}
 	}
-
-	return contacts, nil
+	// A click implies the message was opened even if the tracking pixel was blocked
+	return []string{"opened", "clicked"}
 }
 
-// sendCampaignEmail sends an email to a contact
-func (h *CampaignHandler) sendCampaignEmail(ctx context.Context, campaign *campaignInfo, contact contactInfo) error {
+// sendCampaignEmail sends an email to a contact and returns the ID of its email
+// record, 0 when none was created
+func (h *CampaignHandler) sendCampaignEmail(ctx context.Context, campaign *campaignInfo, contact contactInfo) (int64, error) {
 	// Generate unique message ID
 	messageID := fmt.Sprintf("<%s@%s>", uuid.New().String(), h.extractDomain(campaign.FromEmail))
 
 	// Personalize content
-	subject := h.personalizeContent(campaign.Subject, contact)
-	htmlContent := h.personalizeContent(campaign.HTMLContent, contact)
-	textContent := h.personalizeContent(campaign.TextContent, contact)
+	rendered, err := RenderCampaignContent(ctx, CampaignMergeVariables(contact.Email, contact.FirstName, contact.LastName, contact.Attributes),
+		campaign.Subject, campaign.HTMLContent, campaign.TextContent)
+	if err != nil {
+		return 0, err
+	}
+	subject, htmlContent, textContent := rendered[0], rendered[1], rendered[2]
+	htmlContent = campaign.UTM.Apply(htmlContent, campaign.Name)
 
 	// Insert email record
 	var emailID int64
-	err := h.db.QueryRowContext(ctx, `
+	err = h.db.QueryRowContext(ctx, `
 		INSERT INTO emails (
 			org_id, message_id, identity_id, from_email, from_name,
 			to_emails, subject, html_content, text_content,
@@ -342,7 +421,7 @@ func (h *CampaignHandler) sendCampaignEmail(ctx context.Context, campaign *campa
 		h.extractDomain(campaign.FromEmail), campaign.ID, contact.ID,
 	).Scan(&emailID)
 	if err != nil {
-		return fmt.Errorf("failed to create email record: %w", err)
+		return 0, fmt.Errorf("failed to create email record: %w", err)
 	}
 
 	// Add delivery event
@@ -351,62 +430,107 @@ func (h *CampaignHandler) sendCampaignEmail(ctx context.Context, campaign *campa
 		VALUES ($1, 'queued', '{}', NOW())
 	`, emailID)
 
+	// Track opens and clicks per recipient, so the campaign's link report can
+	// tell which links were clicked and by how many recipients
+	htmlContent = h.tracker.Apply(emailID, campaign.ID, contact.ID, htmlContent)
+
+	return emailID, h.deliverEmail(ctx, contactMessage{
+		EmailID:   emailID,
+		OrgID:     campaign.OrgID,
+		ContactID: contact.ID,
+		TopicID:   campaign.TopicID,
+		MessageID: messageID,
+		FromEmail: campaign.FromEmail,
+		FromName:  campaign.FromName,
+		ReplyTo:   campaign.ReplyTo,
+		To:        contact.Email,
+		Subject:   subject,
+		HTML:      htmlContent,
+		Text:      textContent,
+	})
+}
+
+// contactMessage is an email to a contact, recorded in emails, that the worker
+// sends over SMTP
+type contactMessage struct {
+	EmailID   int64
+	OrgID     int64
+	ContactID int64
+	TopicID   int // Unsubscribing opts out of this topic only, when set
+	MessageID string
+	FromEmail string
+	FromName  string
+	ReplyTo   string
+	To        string
+	Subject   string
+	HTML      string
+	Text      string
+}
+
+// deliverEmail sends an email to a contact with a List-Unsubscribe header, and
+// marks its record sent or failed
+func (h *CampaignHandler) deliverEmail(ctx context.Context, m contactMessage) error {
 	// Build email message
-	fromHeader := campaign.FromEmail
-	if campaign.FromName != "" {
-		fromHeader = fmt.Sprintf("%s <%s>", campaign.FromName, campaign.FromEmail)
+	fromHeader := m.FromEmail
+	if m.FromName != "" {
+		fromHeader = fmt.Sprintf("%s <%s>", m.FromName, m.FromEmail)
 	}
 
 	// Build MIME message
 	boundary := uuid.New().String()
 	var msg strings.Builder
 	msg.WriteString(fmt.Sprintf("From: %s\r\n", fromHeader))
-	msg.WriteString(fmt.Sprintf("To: %s\r\n", contact.Email))
-	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", subject))
-	msg.WriteString(fmt.Sprintf("Message-ID: %s\r\n", messageID))
+	msg.WriteString(fmt.Sprintf("To: %s\r\n", m.To))
+	msg.WriteString(fmt.Sprintf("Subject: %s\r\n", m.Subject))
+	msg.WriteString(fmt.Sprintf("Message-ID: %s\r\n", m.MessageID))
 	msg.WriteString("MIME-Version: 1.0\r\n")
 
 	// Add Reply-To if set
-	if campaign.ReplyTo != "" {
-		msg.WriteString(fmt.Sprintf("Reply-To: %s\r\n", campaign.ReplyTo))
+	if m.ReplyTo != "" {
+		msg.WriteString(fmt.Sprintf("Reply-To: %s\r\n", m.ReplyTo))
 	}
 
 	// Add List-Unsubscribe header (RFC 8058)
-	unsubToken := fmt.Sprintf("%d-%d-%d", contact.ID, campaign.OrgID, emailID)
-	msg.WriteString(fmt.Sprintf("List-Unsubscribe: <%s/api/v1/unsubscribe/%s>\r\n", h.cfg.APIUrl, unsubToken))
+	unsubToken := unsubscribe.Encode(h.cfg.JWTSecret, unsubscribe.Data{
+		ContactID: m.ContactID,
+		OrgID:     m.OrgID,
+		EmailID:   m.EmailID,
+		TopicID:   m.TopicID,
+	})
+	msg.WriteString(fmt.Sprintf("List-Unsubscribe: <%s>\r\n", unsubscribe.URL(h.cfg.APIUrl, unsubToken)))
 	msg.WriteString(fmt.Sprintf("List-Unsubscribe-Post: List-Unsubscribe=One-Click\r\n"))
 
-	if htmlContent != "" && textContent != "" {
+	if m.HTML != "" && m.Text != "" {
 		// Multipart alternative
 		msg.WriteString(fmt.Sprintf("Content-Type: multipart/alternative; boundary=\"%s\"\r\n\r\n", boundary))
 		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
 		msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
-		msg.WriteString(textContent)
+		msg.WriteString(m.Text)
 		msg.WriteString(fmt.Sprintf("\r\n--%s\r\n", boundary))
 		msg.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n\r\n")
-		msg.WriteString(htmlContent)
+		msg.WriteString(m.HTML)
 		msg.WriteString(fmt.Sprintf("\r\n--%s--\r\n", boundary))
-	} else if htmlContent != "" {
+	} else if m.HTML != "" {
 		msg.WriteString("Content-Type: text/html; charset=\"utf-8\"\r\n\r\n")
-		msg.WriteString(htmlContent)
+		msg.WriteString(m.HTML)
 	} else {
 		msg.WriteString("Content-Type: text/plain; charset=\"utf-8\"\r\n\r\n")
-		msg.WriteString(textContent)
+		msg.WriteString(m.Text)
 	}
 
 	// Send via SMTP
-	sendErr := h.sendViaSMTP(campaign.FromEmail, contact.Email, msg.String())
+	sendErr := h.sendViaSMTP(m.FromEmail, m.To, msg.String())
 	if sendErr != nil {
 		// Mark as failed
 		h.db.ExecContext(ctx, `
 			UPDATE emails SET status = 'failed', updated_at = NOW()
 			WHERE id = $1
-		`, emailID)
+		`, m.EmailID)
 
 		h.db.ExecContext(ctx, `
 			INSERT INTO delivery_events (email_id, event_type, data, occurred_at)
 			VALUES ($1, 'failed', $2, NOW())
-		`, emailID, fmt.Sprintf(`{"error": "%s"}`, sendErr.Error()))
+		`, m.EmailID, fmt.Sprintf(`{"error": "%s"}`, sendErr.Error()))
 
 		return sendErr
 	}
@@ -415,12 +539,12 @@ func (h *CampaignHandler) sendCampaignEmail(ctx context.Context, campaign *campa
 	h.db.ExecContext(ctx, `
 		UPDATE emails SET status = 'sent', sent_at = NOW(), updated_at = NOW()
 		WHERE id = $1
-	`, emailID)
+	`, m.EmailID)
 
 	h.db.ExecContext(ctx, `
 		INSERT INTO delivery_events (email_id, event_type, data, occurred_at)
 		VALUES ($1, 'sent', '{}', NOW())
-	`, emailID)
+	`, m.EmailID)
 
 	return nil
 }
@@ -549,29 +673,6 @@ func (h *CampaignHandler) sendViaSMTPStartTLS(addr string, auth smtp.Auth, from,
 	return client.Quit()
 }
 
-// personalizeContent replaces template variables with contact data
-func (h *CampaignHandler) personalizeContent(content string, contact contactInfo) string {
-	if content == "" {
-		return content
-	}
-
-	// Replace standard variables
-	content = strings.ReplaceAll(content, "{{email}}", contact.Email)
-	content = strings.ReplaceAll(content, "{{firstName}}", contact.FirstName)
-	content = strings.ReplaceAll(content, "{{lastName}}", contact.LastName)
-	content = strings.ReplaceAll(content, "{{first_name}}", contact.FirstName)
-	content = strings.ReplaceAll(content, "{{last_name}}", contact.LastName)
-
-	// Replace custom attributes
-	for key, value := range contact.Attributes {
-		if strVal, ok := value.(string); ok {
-			content = strings.ReplaceAll(content, "{{"+key+"}}", strVal)
-		}
-	}
-
-	return content
-}
-
 // extractDomain extracts domain from email address
 func (h *CampaignHandler) extractDomain(email string) string {
 	parts := strings.Split(email, "@")
@@ -581,36 +682,8 @@ func (h *CampaignHandler) extractDomain(email string) string {
 	return ""
 }
 
-// updateCampaignStatus updates campaign status
-func (h *CampaignHandler) updateCampaignStatus(ctx context.Context, campaignID int, status string) {
-	h.db.ExecContext(ctx, `
-		UPDATE campaigns SET status = $1, updated_at = NOW()
-		WHERE id = $2
-	`, status, campaignID)
-}
-
-// updateCampaignProgress updates campaign progress
-func (h *CampaignHandler) updateCampaignProgress(ctx context.Context, campaignID int, sentCount int) {
-	h.db.ExecContext(ctx, `
-		UPDATE campaigns SET sent_count = sent_count + $1, updated_at = NOW()
-		WHERE id = $2
-	`, sentCount, campaignID)
-}
-
-// completeCampaign marks a campaign as complete
-func (h *CampaignHandler) completeCampaign(ctx context.Context, campaignID int) {
-	h.db.ExecContext(ctx, `
-		UPDATE campaigns SET status = 'sent', completed_at = NOW(), updated_at = NOW()
-		WHERE id = $1
-	`, campaignID)
-}
-
 // Warmup schedules - daily limits for each day
-var warmupSchedules = map[string][]int{
-	"conservative": {20, 50, 100, 200, 400, 600, 800, 1000, 1200, 1400, 1600, 1800, 2000, 2400, 2800, 3200, 4000, 5000, 6000, 7000, 8000, 9000, 10000, 12000, 14000, 16000, 18000, 20000, 25000, 30000},
-	"moderate":     {50, 100, 300, 600, 1000, 1500, 2000, 3000, 4000, 5000, 6000, 8000, 10000, 12000, 15000, 18000, 22000, 27000, 35000, 45000, 60000},
-	"aggressive":   {100, 500, 1000, 2000, 4000, 7000, 10000, 15000, 20000, 30000, 45000, 60000, 80000, 100000},
-}
+var warmupSchedules = warmup.Schedules
 
 // getWarmupLimit returns the daily limit for an org in warmup, or 0 if not in warmup
 func (h *CampaignHandler) getWarmupLimit(ctx context.Context, orgID int64) int {
@@ -630,7 +703,7 @@ func (h *CampaignHandler) getWarmupLimit(ctx context.Context, orgID int64) int {
 
 	schedule, ok := warmupSchedules[scheduleName]
 	if !ok {
-		schedule = warmupSchedules["conservative"]
+		schedule = warmupSchedules[warmup.DefaultSchedule]
 	}
 
 	if currentDay <= 0 || currentDay > len(schedule) {
@@ -697,7 +770,7 @@ func (h *CampaignHandler) createWarmupAlert(ctx context.Context, orgID int64, li
 	h.db.ExecContext(ctx, `
 		INSERT INTO alerts (org_id, type, severity, title, message, data, acknowledged, created_at)
 		VALUES ($1, 'warmup', 'info', 'Warmup Daily Limit Reached',
-			'Your campaign has been paused because the daily warmup limit has been reached. It will resume tomorrow.',
+			'Your campaign has reached the daily warmup limit. It will continue sending tomorrow.',
 			$2, false, NOW())
 	`, orgID, alertData)
 }
@@ -0,0 +1,62 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/sendwindow"
+)
+
+// scheduleLocalTimes sets when each snapshotted recipient is due for a campaign
+// scheduled for the recipient's local time: the campaign's wall clock time in the
+// timezone contact attribute, the country attribute's timezone, or the org's
+// timezone for contacts with neither. Recipients whose time has passed stay due
+// right away.
+func (h *CampaignHandler) scheduleLocalTimes(ctx context.Context, tx *sql.Tx, campaign *campaignInfo) error {
+	if campaign.ScheduledLocalAt.IsZero() {
+		return nil
+	}
+	fallback := sendwindow.Load(ctx, h.db, campaign.OrgID).Timezone
+
+	// Recipients sharing a timezone and country are due at the same time
+	rows, err := tx.QueryContext(ctx, `
+		SELECT DISTINCT COALESCE(c.attributes->>'timezone', ''), COALESCE(c.attributes->>'country', '')
+		FROM campaign_recipients r
+		JOIN contacts c ON c.id = r.contact_id
+		WHERE r.campaign_id = $1 AND r.status = 'pending'
+	`, campaign.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	var timezones, countries, dueAt []string
+	for rows.Next() {
+		var timezone, country string
+		if err := rows.Scan(&timezone, &country); err != nil {
+			rows.Close()
+			return err
+		}
+		due := sendwindow.AtLocal(campaign.ScheduledLocalAt, sendwindow.RecipientLocation(timezone, country, fallback))
+		if due.After(now) {
+			timezones = append(timezones, timezone)
+			countries = append(countries, country)
+			dueAt = append(dueAt, due.UTC().Format(time.RFC3339))
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(dueAt) == 0 {
+		return err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE campaign_recipients r SET send_after = g.due_at
+		FROM contacts c, unnest($2::text[], $3::text[], $4::timestamptz[]) AS g(timezone, country, due_at)
+		WHERE r.campaign_id = $1 AND r.status = 'pending' AND c.id = r.contact_id
+		AND COALESCE(c.attributes->>'timezone', '') = g.timezone
+		AND COALESCE(c.attributes->>'country', '') = g.country
+	`, campaign.ID, pq.Array(timezones), pq.Array(countries), pq.Array(dueAt))
+	return err
+}
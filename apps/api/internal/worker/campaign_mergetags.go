@@ -0,0 +1,53 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/dublyo/mailat/api/pkg/templating"
+)
+
+// Campaigns are rendered for each recipient with the template engine, so their
+// subject and bodies take merge tags like {{firstName}} and {{attributes.plan}},
+// with a fallback for contacts without the value: {{firstName | default: "there"}}.
+// Attributes can also be used by bare name, {{plan}}, as before they had their
+// own namespace.
+
+// CampaignContactFields are the merge tags every contact fills, next to its
+// attributes
+var CampaignContactFields = []string{"email", "firstName", "lastName", "first_name", "last_name"}
+
+// CampaignMergeVariables returns the variables a campaign is rendered with for a
+// contact. Attributes never shadow the contact's own fields.
+func CampaignMergeVariables(email, firstName, lastName string, attributes map[string]any) map[string]any {
+	if attributes == nil {
+		attributes = map[string]any{}
+	}
+	vars := make(map[string]any, len(attributes)+len(CampaignContactFields)+1)
+	for key, value := range attributes {
+		vars[key] = value
+	}
+	vars["email"] = email
+	vars["firstName"] = firstName
+	vars["lastName"] = lastName
+	vars["first_name"] = firstName
+	vars["last_name"] = lastName
+	vars["attributes"] = attributes
+	return vars
+}
+
+// RenderCampaignContent renders the parts of a campaign with a contact's variables
+func RenderCampaignContent(ctx context.Context, vars map[string]any, parts ...string) ([]string, error) {
+	rendered := make([]string, len(parts))
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		out, err := templating.Render(ctx, part, vars, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render merge tags: %w", err)
+		}
+		rendered[i] = out
+	}
+	return rendered, nil
+}
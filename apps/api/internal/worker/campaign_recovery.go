@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+// HandleCampaignRecovery restarts the dispatch of campaigns whose dispatcher was
+// lost, such as to a worker restart: sending campaigns with no run due and no
+// recipient activity for a while, and scheduled ones well past their time. Their
+// stale queued recipients go back to pending, and the new run settles stale sends
+// and finishes campaigns that have nothing left to send. Recipients are claimed
+// one at a time, so a batch that turns out to be alive still sends none twice.
+func (h *ScheduledTaskHandler) HandleCampaignRecovery(ctx context.Context, task *asynq.Task) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT c.id, c.org_id FROM campaigns c
+		WHERE (
+			c.status = 'sending'
+			AND (c.dispatch_due_at IS NULL OR c.dispatch_due_at < NOW() - make_interval(secs => $1))
+			AND c.updated_at < NOW() - make_interval(secs => $1)
+			AND NOT EXISTS (
+				SELECT 1 FROM campaign_recipients r
+				WHERE r.campaign_id = c.id AND r.updated_at >= NOW() - make_interval(secs => $1)
+			)
+		) OR (
+			c.status = 'scheduled' AND c.scheduled_at < NOW() - make_interval(secs => $1)
+		)
+	`, staleSendAfter.Seconds())
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	var campaigns []CampaignProcessPayload
+	for rows.Next() {
+		var p CampaignProcessPayload
+		if err := rows.Scan(&p.CampaignID, &p.OrgID); err == nil {
+			campaigns = append(campaigns, p)
+		}
+	}
+	rows.Close()
+	if len(campaigns) == 0 {
+		return nil
+	}
+
+	queueClient, err := NewQueueClient(h.cfg)
+	if err != nil {
+		return transientError(FailureInternal, "queue", fmt.Errorf("failed to create queue client: %w", err))
+	}
+	defer queueClient.Close()
+
+	for _, p := range campaigns {
+		h.db.ExecContext(ctx, `
+			UPDATE campaign_recipients SET status = 'pending', updated_at = NOW()
+			WHERE campaign_id = $1 AND status = 'queued' AND updated_at < NOW() - make_interval(secs => $2)
+		`, p.CampaignID, staleSendAfter.Seconds())
+
+		// A run without a run ID takes the dispatch over
+		if _, err := queueClient.EnqueueCampaignProcess(&p); err != nil {
+			fmt.Printf("Campaign recovery: failed to requeue campaign %d: %v\n", p.CampaignID, err)
+			continue
+		}
+		h.db.ExecContext(ctx, `UPDATE campaigns SET dispatch_due_at = NOW() WHERE id = $1`, p.CampaignID)
+		fmt.Printf("Campaign recovery: restarted the dispatch of campaign %d\n", p.CampaignID)
+	}
+	return nil
+}
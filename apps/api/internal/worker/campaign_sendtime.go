@@ -0,0 +1,67 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// Send time optimization spreads a campaign over a window after it starts:
+// each recipient waits in pending until the hour of day they have opened email
+// the most, taken from their recent opens across the org's campaigns. The
+// dispatcher leaves waiting recipients alone and runs again when the next one
+// is due.
+
+const (
+	// SendTimeMaxWindowHours bounds how long a campaign may spread its sends
+	SendTimeMaxWindowHours = 72
+
+	// sendTimeHistoryDays is how far back opens count toward a recipient's best hour
+	sendTimeHistoryDays = 90
+)
+
+// sendTimeProfile is the worker's view of a campaign's send_time_settings
+type sendTimeProfile struct {
+	WindowHours int `json:"windowHours"`
+}
+
+// optimizeSendTimes sets when each snapshotted recipient is due: the next time
+// it's their best hour, when that is within the campaign's window. Recipients
+// without opens, or whose best hour is now, stay due right away.
+func (h *CampaignHandler) optimizeSendTimes(ctx context.Context, tx *sql.Tx, campaign *campaignInfo) error {
+	if campaign.SendTime == nil || campaign.SendTime.WindowHours <= 0 {
+		return nil
+	}
+
+	// Hours are compared in UTC, so the best hour is the same moment of the day
+	// wherever the recipient is
+	_, err := tx.ExecContext(ctx, `
+		UPDATE campaign_recipients r
+		SET send_after = date_trunc('hour', NOW()) + make_interval(hours => best.wait)
+		FROM (
+			SELECT e.contact_id,
+				(mode() WITHIN GROUP (ORDER BY EXTRACT(HOUR FROM de.occurred_at AT TIME ZONE 'UTC')::int)
+					- EXTRACT(HOUR FROM NOW() AT TIME ZONE 'UTC')::int + 24) % 24 AS wait
+			FROM delivery_events de
+			JOIN emails e ON e.id = de.email_id
+			WHERE e.org_id = $2 AND de.event_type = 'opened'
+			AND de.occurred_at > NOW() - make_interval(days => $4)
+			AND e.contact_id IN (SELECT contact_id FROM campaign_recipients WHERE campaign_id = $1)
+			GROUP BY e.contact_id
+		) best
+		WHERE r.campaign_id = $1 AND r.contact_id = best.contact_id AND r.status = 'pending'
+		AND best.wait > 0 AND best.wait < $3
+	`, campaign.ID, campaign.OrgID, campaign.SendTime.WindowHours, sendTimeHistoryDays)
+	return err
+}
+
+// nextSendTime returns when the next recipient waiting for their best hour or
+// local time is due, zero when none is waiting
+func (h *CampaignHandler) nextSendTime(ctx context.Context, campaignID int) time.Time {
+	var next sql.NullTime
+	h.db.QueryRowContext(ctx, `
+		SELECT MIN(send_after) FROM campaign_recipients
+		WHERE campaign_id = $1 AND status = 'pending' AND send_after > NOW()
+	`, campaignID).Scan(&next)
+	return next.Time
+}
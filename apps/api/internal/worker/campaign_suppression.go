@@ -0,0 +1,54 @@
+package worker
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// FrequencyCapMaxDays is the longest frequency cap a campaign can have
+const FrequencyCapMaxDays = 365
+
+// campaignSuppression is the worker's view of a campaign's suppression settings
+type campaignSuppression struct {
+	FrequencyCapDays int   `json:"frequencyCapDays"`
+	SegmentIDs       []int `json:"segmentIds"`
+	TopicID          int   `json:"topicId"`
+}
+
+// suppressionRules returns how many days back a recipient's last campaign email
+// keeps them from getting the campaign, 0 for no cap, the segments whose
+// members are left out and the campaign's subscription topic, 0 for none
+func suppressionRules(settingsJSON []byte) (capDays int, segments []int64, topic int) {
+	segments = []int64{}
+	var settings campaignSuppression
+	if len(settingsJSON) == 0 || json.Unmarshal(settingsJSON, &settings) != nil {
+		return 0, segments, 0
+	}
+	for _, id := range settings.SegmentIDs {
+		segments = append(segments, int64(id))
+	}
+	return max(settings.FrequencyCapDays, 0), segments, settings.TopicID
+}
+
+// SuppressionFilter returns the SQL condition that the contact with the given
+// alias is in none of the suppression segments of the segments parameter and,
+// when the days parameter isn't 0, wasn't sent a campaign within that many days
+// nor, when the topic parameter isn't 0, opted out of that subscription topic.
+// Emails of the campaigns of the ignore parameter don't count towards the cap,
+// so a campaign, or a resend and its parent, don't cap themselves. The segments
+// and ignore parameters are int arrays.
+func SuppressionFilter(alias string, ignore, days, segments, topic int) string {
+	return fmt.Sprintf(`NOT EXISTS (
+			SELECT 1 FROM list_contacts sl WHERE sl.contact_id = %[1]s.id AND sl.list_id = ANY($%[4]d)
+		)
+		AND ($%[3]d = 0 OR NOT EXISTS (
+			SELECT 1 FROM emails fe
+			WHERE fe.contact_id = %[1]s.id AND fe.campaign_id IS NOT NULL
+			AND fe.campaign_id <> ALL($%[2]d)
+			AND fe.status NOT IN ('bounced', 'failed')
+			AND COALESCE(fe.sent_at, fe.created_at) > NOW() - make_interval(days => $%[3]d)
+		))
+		AND ($%[5]d = 0 OR NOT EXISTS (
+			SELECT 1 FROM contact_topic_optouts ot WHERE ot.contact_id = %[1]s.id AND ot.topic_id = $%[5]d
+		))`, alias, ignore, days, segments, topic)
+}
@@ -0,0 +1,223 @@
+package worker
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/sendrate"
+)
+
+// Ramp curves of a campaign throttle profile
+const (
+	// ThrottleRampNone sends at messagesPerHour from the start
+	ThrottleRampNone = "none"
+	// ThrottleRampLinear climbs from startPerHour to messagesPerHour in equal steps
+	ThrottleRampLinear = "linear"
+	// ThrottleRampExponential multiplies the rate by the same factor every hour of the ramp
+	ThrottleRampExponential = "exponential"
+)
+
+// ThrottleInterval is how often a throttled or rate limited campaign wakes up to queue
+// its next slice. Between slices the campaign holds no worker.
+const ThrottleInterval = 5 * time.Minute
+
+// throttleProfile is the worker's view of a campaign's throttle_settings
+type throttleProfile struct {
+	MessagesPerHour int    `json:"messagesPerHour"`
+	Ramp            string `json:"ramp"`
+	StartPerHour    int    `json:"startPerHour"`
+	RampHours       int    `json:"rampHours"`
+}
+
+// rateAt returns the allowed messages per hour once the campaign has been sending for elapsed
+func (p *throttleProfile) rateAt(elapsed time.Duration) float64 {
+	target := float64(p.MessagesPerHour)
+	if p.Ramp == "" || p.Ramp == ThrottleRampNone || p.RampHours <= 0 || p.StartPerHour <= 0 {
+		return target
+	}
+
+	progress := elapsed.Hours() / float64(p.RampHours)
+	if progress >= 1 {
+		return target
+	}
+	if progress < 0 {
+		progress = 0
+	}
+
+	start := float64(p.StartPerHour)
+	if p.Ramp == ThrottleRampExponential {
+		return start * math.Pow(target/start, progress)
+	}
+	return start + (target-start)*progress
+}
+
+// slice returns how many messages may be sent in this run and how long to wait before
+// the next one. Rates below one message per interval send a single message and wait
+// for it to be earned.
+func (p *throttleProfile) slice(elapsed time.Duration) (int, time.Duration) {
+	rate := p.rateAt(elapsed)
+	if rate <= 0 {
+		return 0, ThrottleInterval
+	}
+
+	count := int(rate * ThrottleInterval.Hours())
+	if count >= 1 {
+		return count, ThrottleInterval
+	}
+	return 1, time.Duration(float64(time.Hour) / rate)
+}
+
+// sendInterval returns the spacing between consecutive sends of a campaign
+func (p *throttleProfile) sendInterval(elapsed time.Duration) time.Duration {
+	interval := time.Second / RateLimit
+	if p == nil {
+		return interval
+	}
+	if rate := p.rateAt(elapsed); rate > 0 {
+		if throttled := time.Duration(float64(time.Hour) / rate); throttled > interval {
+			return throttled
+		}
+	}
+	return interval
+}
+
+// sendAllowance is how much a campaign may queue in one dispatcher run, under
+// its throttle profile, the org's warmup schedule and the org's send rate
+type sendAllowance struct {
+	limit       int           // Recipients that may be queued, -1 for no limit
+	wait        time.Duration // Until the next run when recipients are held back
+	policy      sendrate.Policy
+	domainsUsed map[string]int // Sends per recipient domain in the last hour, queued ones included
+
+	warmupLimit   int
+	warmupReached bool
+
+	// Set when the campaign's sending domain is new and reached its limit for the day
+	domainWarmup *domainWarmup
+}
+
+// getSendAllowance works out the allowance of a campaign's next run
+func (h *CampaignHandler) getSendAllowance(ctx context.Context, campaign *campaignInfo) *sendAllowance {
+	a := &sendAllowance{limit: -1, wait: ThrottleInterval}
+	if campaign.Throttle != nil {
+		a.limit, a.wait = campaign.Throttle.slice(time.Since(campaign.StartedAt))
+	}
+
+	// Warmup caps the org's emails per day, and recipients already queued count
+	if a.warmupLimit = h.getWarmupLimit(ctx, campaign.OrgID); a.warmupLimit > 0 {
+		remaining := a.warmupLimit - h.getDailySentCount(ctx, campaign.OrgID) - h.getInFlightCount(ctx, campaign.OrgID)
+		if remaining <= 0 {
+			a.limit, a.wait = 0, untilTomorrow(time.Now())
+			a.warmupReached = true
+			return a
+		}
+		a.capAt(remaining)
+	}
+
+	// A new sending domain ramps up on its own schedule, whatever the org's warmup
+	if dw := h.getDomainWarmup(ctx, campaign); dw != nil {
+		remaining := dw.limit - h.getDomainDailySentCount(ctx, campaign.OrgID, dw.domainID) - h.getDomainInFlightCount(ctx, campaign.OrgID, dw.domain)
+		if remaining <= 0 {
+			a.limit, a.wait = 0, untilTomorrow(time.Now())
+			a.domainWarmup = dw
+			return a
+		}
+		a.capAt(remaining)
+	}
+
+	a.policy = sendrate.Load(ctx, h.db, campaign.OrgID)
+	if a.policy.Limited() {
+		a.domainsUsed = h.getHourlySendsByDomain(ctx, campaign.OrgID)
+		if a.policy.PerHour > 0 {
+			used := 0
+			for _, n := range a.domainsUsed {
+				used += n
+			}
+			a.capAt(max(a.policy.PerHour-used, 0))
+		}
+	}
+	return a
+}
+
+// untilTomorrow returns the time left until midnight, when daily limits start over
+func untilTomorrow(now time.Time) time.Duration {
+	return time.Date(now.Year(), now.Month(), now.Day()+1, 0, 0, 0, 0, now.Location()).Sub(now)
+}
+
+func (a *sendAllowance) capAt(n int) {
+	if a.limit < 0 || n < a.limit {
+		a.limit = n
+	}
+}
+
+// take picks the recipients the allowance covers, in order, and reports whether
+// any were held back. Recipients of a domain at its hourly limit are passed over
+// for those of other domains.
+func (a *sendAllowance) take(recipients []contactInfo) ([]contactInfo, bool) {
+	var selected []contactInfo
+	heldBack := false
+	for _, r := range recipients {
+		if a.limit >= 0 && len(selected) >= a.limit {
+			return selected, true
+		}
+		if limit := a.policy.DomainLimit(r.Domain); limit > 0 {
+			if a.domainsUsed[r.Domain] >= limit {
+				heldBack = true
+				continue
+			}
+			a.domainsUsed[r.Domain]++
+		}
+		selected = append(selected, r)
+	}
+	return selected, heldBack
+}
+
+// getInFlightCount returns the org's campaign recipients queued or being sent,
+// which have no email record yet
+func (h *CampaignHandler) getInFlightCount(ctx context.Context, orgID int64) int {
+	var count int
+	h.db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM campaign_recipients
+		WHERE org_id = $1 AND status IN ('queued', 'sending')
+	`, orgID).Scan(&count)
+	return count
+}
+
+// getHourlySendsByDomain counts the org's campaign sends of the last hour by
+// recipient domain, counting recipients queued or being sent as sends
+func (h *CampaignHandler) getHourlySendsByDomain(ctx context.Context, orgID int64) map[string]int {
+	counts := map[string]int{}
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT domain, COUNT(*) FROM campaign_recipients
+		WHERE org_id = $1 AND (
+			status IN ('queued', 'sending')
+			OR (status = 'sent' AND sent_at > NOW() - INTERVAL '1 hour')
+		)
+		GROUP BY domain
+	`, orgID)
+	if err != nil {
+		return counts
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var domain string
+		var n int
+		if rows.Scan(&domain, &n) == nil {
+			counts[domain] = n
+		}
+	}
+	return counts
+}
+
+// markCampaignStarted records when a campaign began sending, which anchors its throttle ramp
+func (h *CampaignHandler) markCampaignStarted(ctx context.Context, campaign *campaignInfo) {
+	if !campaign.StartedAt.IsZero() {
+		return
+	}
+	campaign.StartedAt = time.Now()
+	h.db.ExecContext(ctx, `
+		UPDATE campaigns SET started_at = COALESCE(started_at, NOW()), updated_at = NOW()
+		WHERE id = $1
+	`, campaign.ID)
+}
@@ -0,0 +1,38 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+// ComposeSender sends emails held for undo send. It is implemented by the
+// compose service, so held emails are sent the way unheld ones are without the
+// worker importing the service package.
+type ComposeSender interface {
+	SendPending(ctx context.Context, userID, sendID int64) error
+}
+
+// ComposeSendHandler handles compose send tasks
+type ComposeSendHandler struct {
+	sender ComposeSender
+}
+
+// NewComposeSendHandler creates a new compose send handler
+func NewComposeSendHandler(sender ComposeSender) *ComposeSendHandler {
+	return &ComposeSendHandler{sender: sender}
+}
+
+// HandleComposeSend sends an email held for undo send unless it was cancelled
+func (h *ComposeSendHandler) HandleComposeSend(ctx context.Context, t *asynq.Task) error {
+	payload, err := UnmarshalComposeSendPayload(t.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	if err := h.sender.SendPending(ctx, payload.UserID, payload.SendID); err != nil {
+		return transientError(FailureInternal, "compose", fmt.Errorf("failed to send held email %d: %w", payload.SendID, err))
+	}
+	return nil
+}
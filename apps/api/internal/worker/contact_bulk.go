@@ -0,0 +1,271 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/contactbulk"
+	"github.com/dublyo/mailat/api/pkg/listevent"
+)
+
+// Contact bulk job statuses, as stored in contact_bulk_jobs
+const (
+	BulkStatusPending   = "pending"
+	BulkStatusRunning   = "running"
+	BulkStatusCompleted = "completed"
+	BulkStatusFailed    = "failed"
+	BulkStatusCancelled = "cancelled"
+)
+
+// HandleContactBulk applies a bulk operation to its targeted contacts in
+// batches of contactbulk.BatchSize. Each batch commits together with the job's
+// progress, so a failed batch changes nothing and a retried job resumes after
+// the last batch that committed.
+func (h *ScheduledTaskHandler) HandleContactBulk(ctx context.Context, task *asynq.Task) error {
+	payload, err := UnmarshalContactBulkPayload(task.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	var raw []byte
+	var status string
+	err = h.db.QueryRowContext(ctx, `
+		SELECT spec, status FROM contact_bulk_jobs WHERE id = $1 AND org_id = $2
+	`, payload.JobID, payload.OrgID).Scan(&raw, &status)
+	if err != nil {
+		return databaseError("bulk_job_not_found", err)
+	}
+	if status != BulkStatusPending && status != BulkStatusRunning {
+		return nil
+	}
+
+	var spec contactbulk.Spec
+	if err := json.Unmarshal(raw, &spec); err != nil {
+		h.finishContactBulk(ctx, payload, &spec, BulkStatusFailed, err)
+		return permanentError(FailureValidation, "spec", err)
+	}
+
+	h.db.ExecContext(ctx, `
+		UPDATE contact_bulk_jobs SET status = $2, started_at = COALESCE(started_at, NOW())
+		WHERE id = $1 AND status = $3
+	`, payload.JobID, BulkStatusRunning, BulkStatusPending)
+
+	for {
+		done, err := h.runContactBulkBatch(ctx, payload, &spec)
+		if err != nil {
+			if finalAttempt(ctx) {
+				h.finishContactBulk(ctx, payload, &spec, BulkStatusFailed, err)
+			}
+			return transientError(FailureInternal, "bulk_batch", err)
+		}
+		if done {
+			break
+		}
+	}
+
+	h.finishContactBulk(ctx, payload, &spec, BulkStatusCompleted, nil)
+	return nil
+}
+
+// runContactBulkBatch applies the operation to the next batch of contacts and
+// reports whether the job is done: every contact was processed, or the job
+// was cancelled.
+func (h *ScheduledTaskHandler) runContactBulkBatch(ctx context.Context, payload *ContactBulkPayload, spec *contactbulk.Spec) (bool, error) {
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	// The job's row is locked for the batch, so a cancel waits for it and the
+	// cursor can't be moved by anyone else
+	var status string
+	var cursor int64
+	err = tx.QueryRowContext(ctx, `
+		SELECT status, COALESCE(last_contact_id, 0) FROM contact_bulk_jobs WHERE id = $1 FOR UPDATE
+	`, payload.JobID).Scan(&status, &cursor)
+	if err != nil {
+		return false, err
+	}
+	if status != BulkStatusRunning {
+		return true, nil
+	}
+
+	where, whereArgs := spec.Where("c", 4)
+	args := append([]any{payload.OrgID, cursor, contactbulk.BatchSize}, whereArgs...)
+	rows, err := tx.QueryContext(ctx, `
+		SELECT c.id FROM contacts c
+		WHERE c.org_id = $1 AND c.id > $2 AND `+where+`
+		ORDER BY c.id
+		LIMIT $3
+		FOR UPDATE
+	`, args...)
+	if err != nil {
+		return false, fmt.Errorf("failed to select contacts: %w", err)
+	}
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return false, err
+		}
+		ids = append(ids, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return false, err
+	}
+	if len(ids) == 0 {
+		return true, nil
+	}
+
+	affected, err := applyContactBulk(ctx, tx, payload.JobID, spec, ids)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		UPDATE contact_bulk_jobs
+		SET processed = processed + $2, affected = affected + $3, last_contact_id = $4
+		WHERE id = $1
+	`, payload.JobID, len(ids), affected, ids[len(ids)-1])
+	if err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return len(ids) < contactbulk.BatchSize, nil
+}
+
+// applyContactBulk applies the operation to a batch of contacts and returns how
+// many it changed. Status changes are recorded in the contacts' change history
+// as made by the job, and list memberships it changes as list events.
+func applyContactBulk(ctx context.Context, tx *sql.Tx, jobID int64, spec *contactbulk.Spec, ids []int64) (int64, error) {
+	var result sql.Result
+	var err error
+
+	switch spec.Operation {
+	case contactbulk.OpAddTag:
+		result, err = tx.ExecContext(ctx, `
+			UPDATE contacts SET tags = array_append(COALESCE(tags, '{}'), $2), updated_at = NOW()
+			WHERE id = ANY($1) AND NOT ($2 = ANY(COALESCE(tags, '{}')))
+		`, pq.Array(ids), spec.Tag)
+	case contactbulk.OpRemoveTag:
+		result, err = tx.ExecContext(ctx, `
+			UPDATE contacts SET tags = array_remove(tags, $2), updated_at = NOW()
+			WHERE id = ANY($1) AND $2 = ANY(tags)
+		`, pq.Array(ids), spec.Tag)
+	case contactbulk.OpSetStatus:
+		event, _ := listevent.StatusEvent(spec.Status)
+		result, err = tx.ExecContext(ctx, `
+			WITH changed AS (
+				SELECT id, org_id, status FROM contacts
+				WHERE id = ANY($1) AND status IS DISTINCT FROM $2
+			), updated AS (
+				UPDATE contacts c SET status = $2, updated_at = NOW()
+				FROM changed WHERE c.id = changed.id
+			), churned AS (
+				INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+				SELECT changed.org_id, lc.list_id, changed.id, $4, $5, NOW()
+				FROM changed JOIN list_contacts lc ON lc.contact_id = changed.id
+				WHERE $4 <> ''
+			)
+			INSERT INTO contact_changes (org_id, contact_id, field, old_value, new_value, source, source_id, user_id, created_at)
+			SELECT changed.org_id, changed.id, 'status', to_jsonb(COALESCE(changed.status, '')), to_jsonb($2::text),
+				'bulk', j.uuid::text, j.requested_by, NOW()
+			FROM changed JOIN contact_bulk_jobs j ON j.id = $3
+		`, pq.Array(ids), spec.Status, jobID, event, listevent.SourceBulk)
+	case contactbulk.OpAddToList:
+		result, err = addToListBulk(ctx, tx, jobID, spec.ListID, ids)
+	case contactbulk.OpRemoveFromList:
+		result, err = removeFromListBulk(ctx, tx, jobID, spec.ListID, ids)
+	case contactbulk.OpMoveToList:
+		if _, err = addToListBulk(ctx, tx, jobID, spec.ListID, ids); err != nil {
+			return 0, fmt.Errorf("failed to move contacts: %w", err)
+		}
+		result, err = removeFromListBulk(ctx, tx, jobID, spec.FromListID, ids)
+	case contactbulk.OpDelete:
+		// The contacts' lists keep their removal, no longer linked to them
+		result, err = tx.ExecContext(ctx, `
+			WITH removed AS (
+				INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+				SELECT j.org_id, lc.list_id, NULL, $3, $4, NOW()
+				FROM list_contacts lc JOIN contact_bulk_jobs j ON j.id = $2
+				WHERE lc.contact_id = ANY($1)
+			)
+			DELETE FROM contacts WHERE id = ANY($1)
+		`, pq.Array(ids), jobID, listevent.Removed, listevent.SourceBulk)
+	default:
+		return 0, fmt.Errorf("unknown operation %q", spec.Operation)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to %s: %w", spec.Operation, err)
+	}
+	return result.RowsAffected()
+}
+
+// addToListBulk adds contacts to a list, recording each one added
+func addToListBulk(ctx context.Context, tx *sql.Tx, jobID int64, listID int, ids []int64) (sql.Result, error) {
+	return tx.ExecContext(ctx, `
+		WITH added AS (
+			INSERT INTO list_contacts (list_id, contact_id, created_at)
+			SELECT $2, id, NOW() FROM unnest($1::bigint[]) AS id
+			ON CONFLICT (list_id, contact_id) DO NOTHING
+			RETURNING contact_id
+		)
+		INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+		SELECT j.org_id, $2, added.contact_id, $4, $5, NOW()
+		FROM added JOIN contact_bulk_jobs j ON j.id = $3
+	`, pq.Array(ids), listID, jobID, listevent.Subscribed, listevent.SourceBulk)
+}
+
+// removeFromListBulk removes contacts from a list, recording each one removed
+func removeFromListBulk(ctx context.Context, tx *sql.Tx, jobID int64, listID int, ids []int64) (sql.Result, error) {
+	return tx.ExecContext(ctx, `
+		WITH removed AS (
+			DELETE FROM list_contacts WHERE list_id = $2 AND contact_id = ANY($1)
+			RETURNING contact_id
+		)
+		INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+		SELECT j.org_id, $2, removed.contact_id, $4, $5, NOW()
+		FROM removed JOIN contact_bulk_jobs j ON j.id = $3
+	`, pq.Array(ids), listID, jobID, listevent.Removed, listevent.SourceBulk)
+}
+
+// finishContactBulk records the end of a job and brings the contact counts of
+// the lists it changed up to date
+func (h *ScheduledTaskHandler) finishContactBulk(ctx context.Context, payload *ContactBulkPayload, spec *contactbulk.Spec, status string, jobErr error) {
+	if spec.Operation == contactbulk.OpDelete {
+		h.db.ExecContext(ctx, `
+			UPDATE lists SET contact_count = (
+				SELECT COUNT(*) FROM list_contacts WHERE list_id = lists.id
+			), updated_at = NOW()
+			WHERE org_id = $1
+		`, payload.OrgID)
+	} else if lists := spec.Lists(); len(lists) > 0 {
+		h.db.ExecContext(ctx, `
+			UPDATE lists SET contact_count = (
+				SELECT COUNT(*) FROM list_contacts WHERE list_id = lists.id
+			), updated_at = NOW()
+			WHERE id = ANY($1) AND org_id = $2
+		`, pq.Array(lists), payload.OrgID)
+	}
+
+	errText := sql.NullString{}
+	if jobErr != nil {
+		errText = sql.NullString{String: jobErr.Error(), Valid: true}
+	}
+	// A cancelled job keeps its status
+	h.db.ExecContext(ctx, `
+		UPDATE contact_bulk_jobs SET status = $2, error = $3, completed_at = NOW()
+		WHERE id = $1 AND status IN ($4, $5)
+	`, payload.JobID, status, errText, BulkStatusPending, BulkStatusRunning)
+}
@@ -0,0 +1,284 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/eventexport"
+	"github.com/dublyo/mailat/api/pkg/segment"
+)
+
+// Contact export formats. JSON exports are an array of contacts.
+const (
+	ContactExportCSV  = "csv"
+	ContactExportJSON = "json"
+)
+
+// contactExportBatchSize is how many contacts are read from the database at a time
+const contactExportBatchSize = 1000
+
+// contactExportColumns are the fields of each exported contact, in CSV column order
+var contactExportColumns = []string{
+	"id", "email", "firstName", "lastName", "status", "tags", "attributes", "engagementScore",
+	"consentSource", "consentTimestamp", "lastEngagedAt", "createdAt", "updatedAt",
+}
+
+// ContactExportFilter selects the contacts of an export. Its filters combine
+// with AND, and erased contacts are never exported.
+type ContactExportFilter struct {
+	ListIDs []int          `json:"listIds,omitempty"` // Members of any of the lists or segments
+	Status  []string       `json:"status,omitempty"`
+	Rules   *segment.Rules `json:"rules,omitempty"`
+}
+
+// Where returns the SQL condition the exported contacts, with the given alias,
+// match, with its arguments numbered from first on
+func (f *ContactExportFilter) Where(alias string, first int) (string, []any) {
+	parts := []string{alias + ".status IS DISTINCT FROM 'erased'"}
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", first+len(args)-1)
+	}
+
+	if len(f.ListIDs) > 0 {
+		parts = append(parts, fmt.Sprintf("EXISTS (SELECT 1 FROM list_contacts el WHERE el.contact_id = %s.id AND el.list_id = ANY(%s))",
+			alias, arg(pq.Array(f.ListIDs))))
+	}
+	if len(f.Status) > 0 {
+		parts = append(parts, fmt.Sprintf("%s.status = ANY(%s)", alias, arg(pq.Array(f.Status))))
+	}
+	if f.Rules != nil {
+		where, ruleArgs := f.Rules.Compile(alias, first+len(args))
+		args = append(args, ruleArgs...)
+		parts = append(parts, where)
+	}
+	return "(" + strings.Join(parts, " AND ") + ")", args
+}
+
+// HandleContactExport writes the contacts an export selects to a CSV or JSON
+// file, reading them in batches, uploads it to the export's destination and
+// tells the organization it's ready
+func (h *ScheduledTaskHandler) HandleContactExport(ctx context.Context, task *asynq.Task) error {
+	payload, err := UnmarshalContactExportPayload(task.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	var exportUUID, format, destination string
+	var rawFilter []byte
+	err = h.db.QueryRowContext(ctx, `
+		UPDATE contact_exports SET status = $3, error = NULL
+		WHERE id = $1 AND org_id = $2 AND status = $4
+		RETURNING uuid, format, destination, filters
+	`, payload.ExportID, payload.OrgID, ExportStatusRunning, ExportStatusPending).Scan(
+		&exportUUID, &format, &destination, &rawFilter)
+	if err != nil {
+		return databaseError("export_not_found", err)
+	}
+
+	var filter ContactExportFilter
+	err = json.Unmarshal(rawFilter, &filter)
+	if err == nil {
+		err = h.runContactExport(ctx, payload.OrgID, payload.ExportID, exportUUID, format, destination, &filter)
+	}
+	if err != nil {
+		h.db.ExecContext(ctx, `
+			UPDATE contact_exports SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+		`, payload.ExportID, ExportStatusFailed, err.Error())
+		return permanentError(FailureInternal, "export", err)
+	}
+	return nil
+}
+
+func (h *ScheduledTaskHandler) runContactExport(ctx context.Context, orgID, exportID int64, exportUUID, format, destination string, filter *ContactExportFilter) error {
+	store, bucket, err := OpenExportStore(ctx, h.db, h.cfg, orgID, destination)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", "contact-export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	rowCount, err := h.writeContacts(ctx, file, orgID, format, filter)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to read export file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read export file: %w", err)
+	}
+
+	contentType := "text/csv"
+	if format == ContactExportJSON {
+		contentType = "application/json"
+	}
+
+	name := fmt.Sprintf("contacts-%s-%s.%s", time.Now().UTC().Format("20060102"), exportUUID, format)
+	var storageKey string
+	var expiresAt sql.NullTime
+	if destination == eventexport.DestinationS3 {
+		storageKey = bucket.Key(name)
+	} else {
+		storageKey = fmt.Sprintf("orgs/%d/exports/%s", orgID, name)
+		expiresAt = sql.NullTime{Time: time.Now().Add(ExportDownloadTTL), Valid: true}
+	}
+	if err := store.Put(ctx, storageKey, file, size, contentType); err != nil {
+		return err
+	}
+
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE contact_exports
+		SET status = $3, storage_key = $4, row_count = $5, size = $6, expires_at = $7, completed_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, exportID, orgID, ExportStatusCompleted, storageKey, rowCount, size, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record export: %w", err)
+	}
+
+	h.notifyContactExport(ctx, orgID, exportUUID, format, rowCount, size)
+	return nil
+}
+
+// writeContacts streams the contacts a filter selects to w, in batches by ID
+func (h *ScheduledTaskHandler) writeContacts(ctx context.Context, w io.Writer, orgID int64, format string, filter *ContactExportFilter) (int, error) {
+	buf := bufio.NewWriter(w)
+	var csvWriter *csv.Writer
+	if format == ContactExportJSON {
+		buf.WriteString("[")
+	} else {
+		csvWriter = csv.NewWriter(buf)
+		csvWriter.Write(contactExportColumns)
+	}
+
+	where, whereArgs := filter.Where("c", 4)
+	count := 0
+	var cursor int64
+	for {
+		rows, err := h.db.QueryContext(ctx, `
+			SELECT c.id, c.uuid, c.email, COALESCE(c.first_name, ''), COALESCE(c.last_name, ''),
+			       COALESCE(c.status, ''), COALESCE(c.tags, '{}'), COALESCE(c.attributes, '{}'),
+			       COALESCE(c.engagement_score, 0), COALESCE(c.consent_source, ''), c.consent_timestamp,
+			       c.last_engaged_at, c.created_at, c.updated_at
+			FROM contacts c
+			WHERE c.org_id = $1 AND c.id > $2 AND `+where+`
+			ORDER BY c.id
+			LIMIT $3
+		`, append([]any{orgID, cursor, contactExportBatchSize}, whereArgs...)...)
+		if err != nil {
+			return count, fmt.Errorf("failed to read contacts: %w", err)
+		}
+
+		batch := 0
+		for rows.Next() {
+			var id int64
+			var contactUUID, email, firstName, lastName, status, consentSource string
+			var tags []string
+			var attributes []byte
+			var score float64
+			var consentTimestamp, lastEngagedAt sql.NullTime
+			var createdAt, updatedAt time.Time
+			if err := rows.Scan(&id, &contactUUID, &email, &firstName, &lastName, &status, pq.Array(&tags),
+				&attributes, &score, &consentSource, &consentTimestamp, &lastEngagedAt, &createdAt, &updatedAt); err != nil {
+				rows.Close()
+				return count, fmt.Errorf("failed to read contacts: %w", err)
+			}
+			cursor = id
+			batch++
+
+			if csvWriter != nil {
+				err = csvWriter.Write([]string{contactUUID, email, firstName, lastName, status, strings.Join(tags, ";"),
+					string(attributes), strconv.FormatFloat(score, 'f', -1, 64), consentSource,
+					exportTime(consentTimestamp), exportTime(lastEngagedAt),
+					createdAt.UTC().Format(time.RFC3339), updatedAt.UTC().Format(time.RFC3339)})
+			} else {
+				var record []byte
+				record, err = json.Marshal(map[string]any{
+					"id": contactUUID, "email": email, "firstName": firstName, "lastName": lastName,
+					"status": status, "tags": tags, "attributes": json.RawMessage(attributes), "engagementScore": score,
+					"consentSource": consentSource, "consentTimestamp": exportTime(consentTimestamp),
+					"lastEngagedAt": exportTime(lastEngagedAt), "createdAt": createdAt.UTC().Format(time.RFC3339),
+					"updatedAt": updatedAt.UTC().Format(time.RFC3339),
+				})
+				if err == nil {
+					if count > 0 {
+						buf.WriteString(",")
+					}
+					buf.WriteString("\n")
+					_, err = buf.Write(record)
+				}
+			}
+			if err != nil {
+				rows.Close()
+				return count, fmt.Errorf("failed to write export file: %w", err)
+			}
+			count++
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return count, fmt.Errorf("failed to read contacts: %w", err)
+		}
+		if batch < contactExportBatchSize {
+			break
+		}
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return count, fmt.Errorf("failed to write export file: %w", err)
+		}
+	} else {
+		buf.WriteString("\n]\n")
+	}
+	if err := buf.Flush(); err != nil {
+		return count, fmt.Errorf("failed to write export file: %w", err)
+	}
+	return count, nil
+}
+
+// notifyContactExport raises an alert and fires the org's contact_export_ready
+// webhook triggers
+func (h *ScheduledTaskHandler) notifyContactExport(ctx context.Context, orgID int64, exportUUID, format string, rowCount int, size int64) {
+	data := map[string]interface{}{
+		"exportId": exportUUID,
+		"format":   format,
+		"rowCount": rowCount,
+		"size":     size,
+	}
+
+	alertData, _ := json.Marshal(data)
+	h.db.ExecContext(ctx, `
+		INSERT INTO alerts (org_id, type, severity, title, message, data, acknowledged, created_at)
+		VALUES ($1, 'contact_export', 'info', 'Contact export ready', $2, $3, false, NOW())
+	`, orgID, fmt.Sprintf("The export of %d contacts is ready to download.", rowCount), alertData)
+
+	NewWebhookTriggerFirer(h.db, h.cfg).Fire(ctx, orgID, "contact_export_ready", data)
+}
+
+// exportTime formats an optional time for an export, empty when it's not set
+func exportTime(t sql.NullTime) string {
+	if !t.Valid {
+		return ""
+	}
+	return t.Time.UTC().Format(time.RFC3339)
+}
@@ -0,0 +1,542 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/pkg/contactchange"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/crm"
+	"github.com/dublyo/mailat/api/pkg/crypto"
+)
+
+// CRM sync run triggers and statuses, as stored in crm_sync_runs, and
+// connection statuses, as stored in crm_connections
+const (
+	CRMTriggerScheduled = "scheduled"
+	CRMTriggerManual    = "manual"
+
+	CRMSyncPending   = "pending"
+	CRMSyncRunning   = "running"
+	CRMSyncCompleted = "completed"
+	CRMSyncFailed    = "failed"
+
+	CRMConnectionActive = "active"
+	CRMConnectionError  = "error"
+)
+
+// crmPushBatch is how many contacts a push reads and sends at a time
+const crmPushBatch = 500
+
+// crmPullPages bounds the pages of CRM changes one run pulls. The rest are
+// pulled by the next run, from where this one stopped.
+const crmPullPages = 50
+
+// crmTokenLeeway is how long before its expiry an access token is refreshed
+const crmTokenLeeway = 5 * time.Minute
+
+// CRMApp returns the OAuth app orgs connect a provider's accounts through
+func CRMApp(cfg *config.Config, provider string) *crm.App {
+	app := &crm.App{
+		Provider:    provider,
+		RedirectURL: strings.TrimRight(cfg.APIUrl, "/") + "/api/v1/crm/" + provider + "/callback",
+		LoginURL:    cfg.SalesforceLoginURL,
+	}
+	switch provider {
+	case crm.ProviderHubSpot:
+		app.ClientID, app.ClientSecret = cfg.HubSpotClientID, cfg.HubSpotClientSecret
+	case crm.ProviderSalesforce:
+		app.ClientID, app.ClientSecret = cfg.SalesforceClientID, cfg.SalesforceClientSecret
+	}
+	return app
+}
+
+// crmConnection is a connection as a run syncs it
+type crmConnection struct {
+	id          int64
+	uuid        string
+	orgID       int64
+	provider    string
+	token       crm.Token
+	mappings    []crm.FieldMapping
+	pushEnabled bool
+	pullEnabled bool
+	pushedUntil *time.Time
+	pulledUntil *time.Time
+	createdAt   time.Time
+}
+
+// HandleScheduledCRMSync syncs every CRM connection that pushes or pulls
+func (h *ScheduledTaskHandler) HandleScheduledCRMSync(ctx context.Context, task *asynq.Task) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, org_id FROM crm_connections WHERE push_enabled OR pull_enabled
+	`)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	type connection struct{ id, orgID int64 }
+	var connections []connection
+	for rows.Next() {
+		var c connection
+		if err := rows.Scan(&c.id, &c.orgID); err == nil {
+			connections = append(connections, c)
+		}
+	}
+	rows.Close()
+
+	for _, c := range connections {
+		var runID int64
+		err := h.db.QueryRowContext(ctx, `
+			INSERT INTO crm_sync_runs (connection_id, org_id, trigger, status, created_at)
+			SELECT $1, $2, $3, $4, NOW()
+			WHERE NOT EXISTS (
+				SELECT 1 FROM crm_sync_runs WHERE connection_id = $1 AND status IN ($4, $5)
+			)
+			RETURNING id
+		`, c.id, c.orgID, CRMTriggerScheduled, CRMSyncPending, CRMSyncRunning).Scan(&runID)
+		if err != nil {
+			// A run of the connection that's still going is left to finish
+			continue
+		}
+
+		if err := h.RunCRMSync(ctx, c.orgID, runID); err != nil {
+			fmt.Printf("CRM sync of connection %d failed: %v\n", c.id, err)
+		}
+	}
+
+	return nil
+}
+
+// HandleCRMSync runs an on-demand CRM sync
+func (h *ScheduledTaskHandler) HandleCRMSync(ctx context.Context, task *asynq.Task) error {
+	payload, err := UnmarshalCRMSyncPayload(task.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	if err := h.RunCRMSync(ctx, payload.OrgID, payload.RunID); err != nil {
+		return permanentError(FailureProvider, "crm_sync", err)
+	}
+	return nil
+}
+
+// RunCRMSync pushes the contacts changed since the connection's last push to
+// its CRM, then pulls the CRM's changes since its last pull into contacts.
+// The run records how many contacts went each way, and the connection the
+// outcome of its latest run.
+func (h *ScheduledTaskHandler) RunCRMSync(ctx context.Context, orgID, runID int64) error {
+	var connectionID int64
+	err := h.db.QueryRowContext(ctx, `
+		UPDATE crm_sync_runs SET status = $3, error = NULL, started_at = NOW()
+		WHERE id = $1 AND org_id = $2
+		RETURNING connection_id
+	`, runID, orgID, CRMSyncRunning).Scan(&connectionID)
+	if err != nil {
+		return fmt.Errorf("CRM sync run %d not found", runID)
+	}
+
+	started := time.Now()
+	pushed, pulled, failed, err := h.syncCRM(ctx, connectionID, started)
+
+	status, connectionStatus, message := CRMSyncCompleted, CRMConnectionActive, ""
+	if err != nil {
+		status, connectionStatus, message = CRMSyncFailed, CRMConnectionError, err.Error()
+	}
+	h.db.ExecContext(ctx, `
+		UPDATE crm_sync_runs SET status = $3, pushed = $4, pulled = $5, failed = $6, error = NULLIF($7, ''), completed_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, runID, orgID, status, pushed, pulled, failed, message)
+	h.db.ExecContext(ctx, `
+		UPDATE crm_connections SET status = $2, last_error = NULLIF($3, ''), last_synced_at = NOW(), updated_at = NOW()
+		WHERE id = $1
+	`, connectionID, connectionStatus, message)
+	return err
+}
+
+func (h *ScheduledTaskHandler) syncCRM(ctx context.Context, connectionID int64, started time.Time) (pushed, pulled, failed int, err error) {
+	conn, err := h.loadCRMConnection(ctx, connectionID)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+
+	if time.Until(conn.token.ExpiresAt) < crmTokenLeeway {
+		if err := h.refreshCRMToken(ctx, conn); err != nil {
+			return 0, 0, 0, err
+		}
+	}
+
+	// A token the CRM revoked early is refreshed once before the run gives up
+	retry := func(step func(crm.Connector) error) error {
+		connector, err := crm.NewConnector(conn.provider, &conn.token)
+		if err != nil {
+			return err
+		}
+		err = step(connector)
+		var apiErr *crm.APIError
+		if !errors.As(err, &apiErr) || !apiErr.Unauthorized() {
+			return err
+		}
+		if err := h.refreshCRMToken(ctx, conn); err != nil {
+			return err
+		}
+		if connector, err = crm.NewConnector(conn.provider, &conn.token); err != nil {
+			return err
+		}
+		return step(connector)
+	}
+
+	if conn.pushEnabled {
+		err = retry(func(connector crm.Connector) error {
+			var err error
+			pushed, failed, err = h.pushCRM(ctx, conn, connector, started)
+			return err
+		})
+		if err != nil {
+			return pushed, 0, failed, fmt.Errorf("push failed: %w", err)
+		}
+	}
+	if conn.pullEnabled {
+		err = retry(func(connector crm.Connector) error {
+			var err error
+			pulled, err = h.pullCRM(ctx, conn, connector)
+			return err
+		})
+		if err != nil {
+			return pushed, pulled, failed, fmt.Errorf("pull failed: %w", err)
+		}
+	}
+	return pushed, pulled, failed, nil
+}
+
+func (h *ScheduledTaskHandler) loadCRMConnection(ctx context.Context, connectionID int64) (*crmConnection, error) {
+	conn := &crmConnection{id: connectionID}
+	var accessToken, refreshToken string
+	var expiresAt sql.NullTime
+	var mappingsJSON []byte
+	err := h.db.QueryRowContext(ctx, `
+		SELECT uuid, org_id, provider, access_token, refresh_token, token_expires_at,
+			COALESCE(instance_url, ''), COALESCE(account_id, ''), field_mappings,
+			push_enabled, pull_enabled, pushed_until, pulled_until, created_at
+		FROM crm_connections WHERE id = $1
+	`, connectionID).Scan(&conn.uuid, &conn.orgID, &conn.provider, &accessToken, &refreshToken, &expiresAt,
+		&conn.token.InstanceURL, &conn.token.AccountID, &mappingsJSON,
+		&conn.pushEnabled, &conn.pullEnabled, &conn.pushedUntil, &conn.pulledUntil, &conn.createdAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get CRM connection: %w", err)
+	}
+	if expiresAt.Valid {
+		conn.token.ExpiresAt = expiresAt.Time
+	}
+	if err := json.Unmarshal(mappingsJSON, &conn.mappings); err != nil {
+		return nil, fmt.Errorf("invalid field mappings: %w", err)
+	}
+
+	if conn.token.AccessToken, err = crypto.Decrypt(accessToken, h.cfg.EncryptionKey); err != nil {
+		return nil, fmt.Errorf("failed to decrypt access token: %w", err)
+	}
+	if conn.token.RefreshToken, err = crypto.Decrypt(refreshToken, h.cfg.EncryptionKey); err != nil {
+		return nil, fmt.Errorf("failed to decrypt refresh token: %w", err)
+	}
+	return conn, nil
+}
+
+// refreshCRMToken gets the connection a new access token and stores it
+func (h *ScheduledTaskHandler) refreshCRMToken(ctx context.Context, conn *crmConnection) error {
+	token, err := CRMApp(h.cfg, conn.provider).Refresh(ctx, &conn.token)
+	if err != nil {
+		return err
+	}
+
+	accessToken, err := crypto.Encrypt(token.AccessToken, h.cfg.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt access token: %w", err)
+	}
+	refreshToken, err := crypto.Encrypt(token.RefreshToken, h.cfg.EncryptionKey)
+	if err != nil {
+		return fmt.Errorf("failed to encrypt refresh token: %w", err)
+	}
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE crm_connections SET access_token = $2, refresh_token = $3, token_expires_at = $4,
+			instance_url = NULLIF($5, ''), updated_at = NOW()
+		WHERE id = $1
+	`, conn.id, accessToken, refreshToken, token.ExpiresAt, token.InstanceURL)
+	if err != nil {
+		return fmt.Errorf("failed to store refreshed token: %w", err)
+	}
+	conn.token = *token
+	return nil
+}
+
+// pushCRM sends the contacts changed, engaged or rescored since the last push,
+// or every contact on the first one, through the push mappings
+func (h *ScheduledTaskHandler) pushCRM(ctx context.Context, conn *crmConnection, connector crm.Connector, started time.Time) (pushed, failed int, err error) {
+	var mappings []crm.FieldMapping
+	for _, m := range conn.mappings {
+		if m.Pushes() {
+			mappings = append(mappings, m)
+		}
+	}
+	if len(mappings) == 0 {
+		return 0, 0, nil
+	}
+
+	var lastID int64
+	for {
+		rows, err := h.db.QueryContext(ctx, `
+			SELECT c.id, c.email, COALESCE(c.first_name, ''), COALESCE(c.last_name, ''), COALESCE(c.status, ''),
+				COALESCE(c.engagement_score, 0), c.last_engaged_at, COALESCE(c.attributes, '{}')
+			FROM contacts c
+			WHERE c.org_id = $1 AND c.id > $2 AND c.status IS DISTINCT FROM 'erased'
+				AND ($3::timestamptz IS NULL OR c.updated_at > $3 OR c.last_engaged_at > $3
+					OR EXISTS (SELECT 1 FROM contact_engagement_scores s WHERE s.contact_id = c.id AND s.computed_at > $3))
+			ORDER BY c.id ASC
+			LIMIT $4
+		`, conn.orgID, lastID, conn.pushedUntil, crmPushBatch)
+		if err != nil {
+			return pushed, failed, fmt.Errorf("failed to read contacts: %w", err)
+		}
+
+		var contacts []crm.Contact
+		for rows.Next() {
+			var email, firstName, lastName, status string
+			var score float64
+			var lastEngagedAt sql.NullTime
+			var attributesJSON []byte
+			if err := rows.Scan(&lastID, &email, &firstName, &lastName, &status, &score, &lastEngagedAt, &attributesJSON); err != nil {
+				rows.Close()
+				return pushed, failed, fmt.Errorf("failed to read contacts: %w", err)
+			}
+			var attributes map[string]any
+			json.Unmarshal(attributesJSON, &attributes)
+
+			values := map[string]string{
+				crm.FieldFirstName:       firstName,
+				crm.FieldLastName:        lastName,
+				crm.FieldStatus:          status,
+				crm.FieldEngagementScore: strconv.FormatFloat(score, 'f', -1, 64),
+			}
+			if lastEngagedAt.Valid {
+				values[crm.FieldLastEngagedAt] = lastEngagedAt.Time.UTC().Format(time.RFC3339)
+			}
+
+			c := crm.Contact{Email: email, Fields: map[string]string{}}
+			for _, m := range mappings {
+				value := values[m.Field]
+				if key, ok := strings.CutPrefix(m.Field, crm.AttributePrefix); ok {
+					value = crmValue(attributes[key])
+				}
+				// An empty value would clear what the CRM has
+				if value != "" {
+					c.Fields[m.CRMField] = value
+				}
+			}
+			contacts = append(contacts, c)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return pushed, failed, fmt.Errorf("failed to read contacts: %w", err)
+		}
+		if len(contacts) == 0 {
+			break
+		}
+
+		n, err := connector.Push(ctx, contacts)
+		failed += n
+		if err != nil {
+			return pushed, failed, err
+		}
+		pushed += len(contacts) - n
+		if len(contacts) < crmPushBatch {
+			break
+		}
+	}
+
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE crm_connections SET pushed_until = $2 WHERE id = $1
+	`, conn.id, started)
+	if err != nil {
+		return pushed, failed, fmt.Errorf("failed to record push: %w", err)
+	}
+	return pushed, failed, nil
+}
+
+// pullCRM applies the CRM's changes since the last pull, or since the
+// connection was made, to the contacts with the same emails. Contacts the CRM
+// has that the org doesn't are left alone, as are empty CRM values. Returns
+// how many contacts changed.
+func (h *ScheduledTaskHandler) pullCRM(ctx context.Context, conn *crmConnection, connector crm.Connector) (int, error) {
+	var mappings []crm.FieldMapping
+	var crmFields []string
+	for _, m := range conn.mappings {
+		if m.Pulls() {
+			mappings = append(mappings, m)
+			crmFields = append(crmFields, m.CRMField)
+		}
+	}
+	if len(mappings) == 0 {
+		return 0, nil
+	}
+
+	fields, err := contactfield.Load(ctx, h.db, conn.orgID)
+	if err != nil {
+		return 0, err
+	}
+	typed := map[string]*contactfield.Field{}
+	for i := range fields {
+		typed[fields[i].Key] = &fields[i]
+	}
+
+	since := conn.createdAt
+	if conn.pulledUntil != nil {
+		since = *conn.pulledUntil
+	}
+	pulledUntil := since
+
+	pulled := 0
+	cursor := ""
+	for page := 0; page < crmPullPages; page++ {
+		contacts, next, err := connector.Pull(ctx, since, crmFields, cursor)
+		if err != nil {
+			return pulled, err
+		}
+
+		for _, c := range contacts {
+			changed, err := h.applyCRMContact(ctx, conn, mappings, typed, &c)
+			if err != nil {
+				return pulled, err
+			}
+			if changed {
+				pulled++
+			}
+			if c.UpdatedAt.After(pulledUntil) {
+				pulledUntil = c.UpdatedAt
+			}
+		}
+
+		if next == "" {
+			break
+		}
+		cursor = next
+	}
+
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE crm_connections SET pulled_until = $2 WHERE id = $1
+	`, conn.id, pulledUntil)
+	if err != nil {
+		return pulled, fmt.Errorf("failed to record pull: %w", err)
+	}
+	return pulled, nil
+}
+
+// applyCRMContact writes a CRM contact's pulled values to the org's contact
+// with its email, recording the changes. Attribute values that don't fit the
+// org's typed field are skipped.
+func (h *ScheduledTaskHandler) applyCRMContact(ctx context.Context, conn *crmConnection, mappings []crm.FieldMapping, typed map[string]*contactfield.Field, c *crm.Contact) (bool, error) {
+	if c.Email == "" {
+		return false, nil
+	}
+
+	tx, err := h.db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback()
+
+	var contactID int64
+	var firstName, lastName string
+	var attributesJSON []byte
+	err = tx.QueryRowContext(ctx, `
+		SELECT id, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(attributes, '{}')
+		FROM contacts
+		WHERE org_id = $1 AND lower(email) = lower($2) AND status IS DISTINCT FROM 'erased'
+		FOR UPDATE
+	`, conn.orgID, c.Email).Scan(&contactID, &firstName, &lastName, &attributesJSON)
+	if err == sql.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to get contact: %w", err)
+	}
+	var attributes map[string]any
+	json.Unmarshal(attributesJSON, &attributes)
+
+	newFirstName, newLastName := firstName, lastName
+	newAttributes := map[string]any{}
+	for _, m := range mappings {
+		value := strings.TrimSpace(c.Fields[m.CRMField])
+		if value == "" {
+			continue
+		}
+		switch m.Field {
+		case crm.FieldFirstName:
+			newFirstName = value
+		case crm.FieldLastName:
+			newLastName = value
+		default:
+			key, ok := strings.CutPrefix(m.Field, crm.AttributePrefix)
+			if !ok {
+				continue
+			}
+			var v any = value
+			if field, ok := typed[key]; ok {
+				if v, err = field.Normalize(value); err != nil {
+					continue
+				}
+			}
+			if !reflect.DeepEqual(attributes[key], v) {
+				newAttributes[key] = v
+			}
+		}
+	}
+	if newFirstName == firstName && newLastName == lastName && len(newAttributes) == 0 {
+		return false, nil
+	}
+
+	before, err := contactchange.Take(ctx, tx, contactID)
+	if err != nil {
+		return false, err
+	}
+	attributesPatch, _ := json.Marshal(newAttributes)
+	_, err = tx.ExecContext(ctx, `
+		UPDATE contacts SET first_name = $2, last_name = $3, attributes = COALESCE(attributes, '{}') || $4::jsonb, updated_at = NOW()
+		WHERE id = $1
+	`, contactID, newFirstName, newLastName, attributesPatch)
+	if err != nil {
+		return false, fmt.Errorf("failed to update contact: %w", err)
+	}
+	source := contactchange.Source{Source: "crm", SourceID: conn.uuid}
+	if _, err := contactchange.Record(ctx, tx, conn.orgID, contactID, before, source); err != nil {
+		return false, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to commit contact: %w", err)
+	}
+	return true, nil
+}
+
+// crmValue formats an attribute value as a CRM property value
+func crmValue(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
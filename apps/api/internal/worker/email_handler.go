@@ -17,6 +17,8 @@ import (
 
 	"github.com/dublyo/mailat/api/internal/config"
 	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/bounce"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
 )
 
 // sendMailWithTLS sends email using SMTP with proper TLS handling for internal Docker networks.
@@ -90,6 +92,7 @@ type EmailHandler struct {
 	db                    *sql.DB
 	cfg                   *config.Config
 	emailProvider         provider.EmailProvider
+	attachmentStore       *provider.AttachmentStore
 	webhookTriggerService webhookTriggerFirer
 }
 
@@ -140,6 +143,20 @@ func NewEmailHandler(db *sql.DB, cfg *config.Config) *EmailHandler {
 		fmt.Println("Email handler initialized with SMTP provider")
 	}
 
+	if cfg.AttachmentsBucket != "" {
+		store, err := provider.NewAttachmentStore(&provider.AttachmentStoreConfig{
+			Region:          cfg.AWSRegion,
+			AccessKeyID:     cfg.AWSAccessKeyID,
+			SecretAccessKey: cfg.AWSSecretAccessKey,
+			Bucket:          cfg.AttachmentsBucket,
+		})
+		if err != nil {
+			fmt.Printf("Warning: Failed to create attachment store: %v\n", err)
+		} else {
+			handler.attachmentStore = store
+		}
+	}
+
 	return handler
 }
 
@@ -152,7 +169,7 @@ func (h *EmailHandler) SetWebhookTriggerService(svc webhookTriggerFirer) {
 func (h *EmailHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error {
 	payload, err := UnmarshalEmailSendPayload(t.Payload())
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal payload: %w", err)
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
 	}
 
 	// Check if email was cancelled
@@ -161,10 +178,23 @@ func (h *EmailHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 		SELECT status FROM transactional_emails WHERE id = $1
 	`, payload.EmailID).Scan(&status)
 	if err != nil {
-		return fmt.Errorf("failed to get email status: %w", err)
+		return databaseError("email_not_found", fmt.Errorf("failed to get email status: %w", err))
 	}
-	if status == "cancelled" {
-		return nil // Skip cancelled emails
+	if status == "cancelled" || status == "rejected" {
+		return nil // Skip cancelled emails and emails rejected in review
+	}
+
+	// Scheduled emails wait for the org's sending window in the recipient's timezone
+	if payload.ScheduledFor != nil && !payload.IgnoreSendWindow {
+		deferred, err := h.deferToSendingWindow(ctx, payload)
+		if err != nil || deferred {
+			return err
+		}
+	}
+
+	// Spread volume across the identities of the email's rotation pool
+	if payload.SenderPool != "" {
+		h.applySenderRotation(ctx, payload)
 	}
 
 	// Update status to sending
@@ -172,7 +202,7 @@ func (h *EmailHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 		UPDATE transactional_emails SET status = 'sending', updated_at = NOW() WHERE id = $1
 	`, payload.EmailID)
 	if err != nil {
-		return fmt.Errorf("failed to update email status: %w", err)
+		return transientError(FailureInternal, "database", fmt.Errorf("failed to update email status: %w", err))
 	}
 
 	// Record sending event
@@ -188,20 +218,29 @@ func (h *EmailHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 		Subject:   payload.Subject,
 		TextBody:  payload.TextBody,
 		HTMLBody:  payload.HTMLBody,
+		AMPBody:   payload.AMPBody,
 		MessageID: payload.MessageID,
 	}
 
-	// Send via provider with retry logic
-	var sendErr error
-	var sendResult *provider.SendResult
-	for attempt := 0; attempt <= payload.MaxRetries; attempt++ {
-		if attempt > 0 {
-			// Exponential backoff: 1s, 2s, 4s, 8s...
-			backoff := time.Duration(1<<uint(attempt-1)) * time.Second
-			time.Sleep(backoff)
-			h.recordEvent(ctx, payload.EmailID, "retry", fmt.Sprintf("Retry attempt %d after backoff", attempt))
+	// Pre-uploaded attachments are fetched from storage at send time
+	if len(payload.Attachments) > 0 {
+		attachments, err := h.loadAttachments(ctx, payload.Attachments)
+		if err != nil {
+			h.recordEvent(ctx, payload.EmailID, "attachment_error", err.Error())
+			if h.attachmentStore == nil {
+				return permanentError(FailureInternal, "attachment_storage_unconfigured", err)
+			}
+			return transientError(FailureInternal, "attachment_storage", fmt.Errorf("failed to load attachments: %w", err))
 		}
+		emailMsg.Attachments = attachments
+	}
 
+	// Send via provider, retrying according to the bounce class of each failure
+	var sendErr error
+	var sendResult *provider.SendResult
+	var bounceClass bounce.Class
+	var taskErr *TaskError
+	for attempt := 0; ; attempt++ {
 		// Send via the configured email provider (SES or SMTP)
 		sendResult, sendErr = h.emailProvider.SendEmail(ctx, emailMsg)
 
@@ -209,10 +248,16 @@ func (h *EmailHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 			break // Success
 		}
 
-		// Check if error is retryable
-		if !isRetryableError(sendErr) {
-			break // Don't retry non-retryable errors
+		// Classify the failure to decide whether (and how long) to back off
+		bounceClass = bounce.Classify(sendErr.Error())
+		taskErr = classifySendError(sendErr)
+		policy := bounce.PolicyFor(bounceClass)
+		if !taskErr.Retryable || attempt >= payload.MaxRetries || attempt >= policy.MaxRetries {
+			break
 		}
+
+		time.Sleep(policy.Backoff(attempt + 1))
+		h.recordEvent(ctx, payload.EmailID, "retry", fmt.Sprintf("Retry attempt %d after %s/%s failure", attempt+1, taskErr.Category, taskErr.Reason))
 	}
 
 	// Store provider message ID if available
@@ -228,24 +273,39 @@ func (h *EmailHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 	}
 
 	if sendErr != nil {
+		// Transient failures go back to the queue, which retries them later
+		if taskErr.Retryable && !finalAttempt(ctx) {
+			h.db.ExecContext(ctx, `
+				UPDATE transactional_emails SET status = 'queued', updated_at = NOW() WHERE id = $1
+			`, payload.EmailID)
+			h.recordEvent(ctx, payload.EmailID, "retry_scheduled", taskErr.Error())
+			return taskErr
+		}
+
 		// Update status to failed
 		_, err = h.db.ExecContext(ctx, `
 			UPDATE transactional_emails
-			SET status = 'failed', updated_at = NOW()
+			SET status = 'failed', bounce_class = $2, bounce_reason = $3, updated_at = NOW()
 			WHERE id = $1
-		`, payload.EmailID)
+		`, payload.EmailID, string(bounceClass), sendErr.Error())
 		if err != nil {
 			fmt.Printf("Warning: failed to update email status: %v\n", err)
 		}
+		h.db.ExecContext(ctx, `
+			UPDATE transactional_email_recipients
+			SET status = 'failed', bounce_class = $2, bounce_reason = $3, updated_at = NOW()
+			WHERE email_id = $1
+		`, payload.EmailID, string(bounceClass), sendErr.Error())
 
-		h.recordEvent(ctx, payload.EmailID, "failed", sendErr.Error())
+		h.recordEvent(ctx, payload.EmailID, "failed", taskErr.Error())
 
-		// Check if we should add to suppression list (permanent failure)
-		if isPermanentFailure(sendErr) {
-			h.handlePermanentFailure(ctx, payload)
+		// Only hard failures suppress the recipient; block/reputation failures are sender-side
+		if bounce.PolicyFor(bounceClass).Suppress {
+			h.handlePermanentFailure(ctx, payload, sendErr)
 		}
 
-		return fmt.Errorf("failed to send email after %d retries: %w", payload.MaxRetries, sendErr)
+		// Permanent failures skip the queue's retries
+		return taskErr
 	}
 
 	// Update status to sent
@@ -258,6 +318,10 @@ func (h *EmailHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 	if err != nil {
 		fmt.Printf("Warning: failed to update email status: %v\n", err)
 	}
+	h.db.ExecContext(ctx, `
+		UPDATE transactional_email_recipients SET status = 'sent', updated_at = NOW()
+		WHERE email_id = $1 AND status = 'queued'
+	`, payload.EmailID)
 
 	h.recordEvent(ctx, payload.EmailID, "sent", "Email sent successfully")
 
@@ -277,6 +341,38 @@ func (h *EmailHandler) HandleEmailSend(ctx context.Context, t *asynq.Task) error
 	return nil
 }
 
+// finalAttempt reports whether the queue will not retry the running task again
+func finalAttempt(ctx context.Context) bool {
+	retried, ok := asynq.GetRetryCount(ctx)
+	maxRetry, ok2 := asynq.GetMaxRetry(ctx)
+	return !ok || !ok2 || retried >= maxRetry
+}
+
+// loadAttachments downloads the content of the attachments referenced by a payload
+func (h *EmailHandler) loadAttachments(ctx context.Context, infos []AttachmentInfo) ([]provider.Attachment, error) {
+	if h.attachmentStore == nil {
+		return nil, fmt.Errorf("attachment storage is not configured")
+	}
+
+	attachments := make([]provider.Attachment, 0, len(infos))
+	for _, info := range infos {
+		data, err := h.attachmentStore.Get(ctx, info.BlobID)
+		if err != nil {
+			return nil, err
+		}
+		attachment := provider.Attachment{
+			Filename:    info.Name,
+			ContentType: info.Type,
+			Data:        data,
+		}
+		if info.Disposition == "inline" {
+			attachment.ContentID = info.CID
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, nil
+}
+
 // recordEvent records a delivery event
 func (h *EmailHandler) recordEvent(ctx context.Context, emailID int64, eventType, details string) {
 	_, err := h.db.ExecContext(ctx, `
@@ -334,15 +430,31 @@ func (h *EmailHandler) triggerWebhook(ctx context.Context, orgID, emailID int64,
 	}
 }
 
-// handlePermanentFailure handles permanent delivery failures
-func (h *EmailHandler) handlePermanentFailure(ctx context.Context, payload *EmailSendPayload) {
+// handlePermanentFailure suppresses the recipients a permanent delivery failure can be
+// attributed to: the only recipient of the email, or those named in the error
+func (h *EmailHandler) handlePermanentFailure(ctx context.Context, payload *EmailSendPayload, sendErr error) {
+	rules := emailaddr.LoadRules(ctx, h.db, payload.OrgID)
+
+	all := make([]string, 0, len(payload.To)+len(payload.Cc)+len(payload.Bcc))
+	all = append(append(append(all, payload.To...), payload.Cc...), payload.Bcc...)
+	recipients := all
+	if len(all) > 1 {
+		errText := strings.ToLower(sendErr.Error())
+		recipients = nil
+		for _, recipient := range all {
+			if strings.Contains(errText, strings.ToLower(recipient)) {
+				recipients = append(recipients, recipient)
+			}
+		}
+	}
+
 	// Add recipients to suppression list
-	for _, recipient := range payload.To {
+	for _, recipient := range recipients {
 		_, err := h.db.ExecContext(ctx, `
-			INSERT INTO suppression_list (org_id, email, reason, source)
-			VALUES ($1, $2, $3, 'bounce')
+			INSERT INTO suppression_list (org_id, email, reason, source, normalized_email)
+			VALUES ($1, $2, $3, 'bounce', $4)
 			ON CONFLICT (org_id, email) DO NOTHING
-		`, payload.OrgID, strings.ToLower(recipient), "Permanent delivery failure")
+		`, payload.OrgID, strings.ToLower(recipient), "Permanent delivery failure", emailaddr.Normalize(recipient, rules))
 		if err != nil {
 			fmt.Printf("Warning: failed to add to suppression list: %v\n", err)
 		}
@@ -385,6 +497,16 @@ func (h *EmailHandler) buildMIMEMessage(payload *EmailSendPayload) string {
 		msg.WriteString("\r\n")
 	}
 
+	// AMP part, before the HTML one that clients without AMP fall back to
+	if payload.AMPBody != "" {
+		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
+		msg.WriteString("Content-Type: text/x-amp-html; charset=UTF-8\r\n")
+		msg.WriteString("Content-Transfer-Encoding: quoted-printable\r\n")
+		msg.WriteString("\r\n")
+		msg.WriteString(payload.AMPBody)
+		msg.WriteString("\r\n")
+	}
+
 	// HTML part
 	if payload.HTMLBody != "" {
 		msg.WriteString(fmt.Sprintf("--%s\r\n", boundary))
@@ -424,58 +546,6 @@ func (h *EmailHandler) getSMTPPort() string {
 	return "587"
 }
 
-// isRetryableError determines if an SMTP error is retryable
-func isRetryableError(err error) bool {
-	errStr := err.Error()
-
-	// Temporary errors that should be retried
-	retryablePatterns := []string{
-		"connection refused",
-		"connection reset",
-		"timeout",
-		"temporary",
-		"try again",
-		"service unavailable",
-		"421",
-		"450",
-		"451",
-		"452",
-	}
-
-	for _, pattern := range retryablePatterns {
-		if strings.Contains(strings.ToLower(errStr), pattern) {
-			return true
-		}
-	}
-
-	return false
-}
-
-// isPermanentFailure determines if the error indicates a permanent failure
-func isPermanentFailure(err error) bool {
-	errStr := err.Error()
-
-	// Permanent errors
-	permanentPatterns := []string{
-		"user unknown",
-		"mailbox not found",
-		"invalid address",
-		"550",
-		"551",
-		"552",
-		"553",
-		"554",
-	}
-
-	for _, pattern := range permanentPatterns {
-		if strings.Contains(strings.ToLower(errStr), pattern) {
-			return true
-		}
-	}
-
-	return false
-}
-
 // generateRandomString generates a random hex string
 func generateRandomString(length int) string {
 	bytes := make([]byte, length/2)
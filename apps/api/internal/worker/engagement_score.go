@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/dublyo/mailat/api/pkg/engagement"
+)
+
+// HandleEngagementScores recomputes the engagement score of every contact, org
+// by org, so scores decay for contacts who stopped opening and clicking
+func (h *ScheduledTaskHandler) HandleEngagementScores(ctx context.Context, task *asynq.Task) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT DISTINCT org_id FROM contacts
+	`)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	var orgIDs []int64
+	for rows.Next() {
+		var orgID int64
+		if rows.Scan(&orgID) == nil {
+			orgIDs = append(orgIDs, orgID)
+		}
+	}
+	rows.Close()
+
+	changed := 0
+	for _, orgID := range orgIDs {
+		n, err := engagement.Recompute(ctx, h.db, orgID)
+		if err != nil {
+			fmt.Printf("Warning: failed to score contacts of org %d: %v\n", orgID, err)
+			continue
+		}
+		changed += n
+	}
+	if changed > 0 {
+		fmt.Printf("Engagement scores changed for %d contacts\n", changed)
+	}
+	return nil
+}
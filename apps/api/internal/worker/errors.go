@@ -0,0 +1,129 @@
+package worker
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/dublyo/mailat/api/pkg/bounce"
+)
+
+// FailureCategory says where a task failure came from
+type FailureCategory string
+
+const (
+	// FailureValidation is a malformed payload or data the task can never process
+	FailureValidation FailureCategory = "validation"
+	// FailureProvider is a rejection by the email provider or a remote endpoint
+	FailureProvider FailureCategory = "provider"
+	// FailureQuota is a send rate or quota limit
+	FailureQuota FailureCategory = "quota"
+	// FailureInternal is a database, storage or queue problem on our side
+	FailureInternal FailureCategory = "internal"
+)
+
+// TaskError is the result of a failed task. Handlers return it so that retry
+// decisions, status transitions and queue metrics all come from the same
+// classification. Permanent errors are never retried by the queue.
+type TaskError struct {
+	Category  FailureCategory
+	Reason    string // Finer-grained cause, such as a bounce class or HTTP status
+	Retryable bool
+	Err       error
+}
+
+func (e *TaskError) Error() string {
+	return fmt.Sprintf("[%s/%s %s] %v", e.Category, e.Reason, e.retryability(), e.Err)
+}
+
+// Unwrap exposes the cause, and asynq.SkipRetry for permanent failures
+func (e *TaskError) Unwrap() []error {
+	if e.Retryable {
+		return []error{e.Err}
+	}
+	return []error{e.Err, asynq.SkipRetry}
+}
+
+func (e *TaskError) retryability() string {
+	if e.Retryable {
+		return "transient"
+	}
+	return "permanent"
+}
+
+// permanentError classifies a failure that retrying cannot fix
+func permanentError(category FailureCategory, reason string, err error) *TaskError {
+	return &TaskError{Category: category, Reason: reason, Err: err}
+}
+
+// transientError classifies a failure that may succeed when retried
+func transientError(category FailureCategory, reason string, err error) *TaskError {
+	return &TaskError{Category: category, Reason: reason, Retryable: true, Err: err}
+}
+
+// databaseError classifies a failed lookup: a missing row is permanent, anything
+// else is an internal problem worth retrying
+func databaseError(notFoundReason string, err error) *TaskError {
+	if errors.Is(err, sql.ErrNoRows) {
+		return permanentError(FailureValidation, notFoundReason, err)
+	}
+	return transientError(FailureInternal, "database", err)
+}
+
+// quotaPatterns are provider responses for send rate and quota limits
+var quotaPatterns = []string{
+	"throttling", "maximum sending rate", "max send rate", "sending quota", "daily message quota",
+	"rate exceeded", "rate limit", "too many requests", "too many messages",
+}
+
+// isNetworkError reports whether a send failed on the way to the provider, so
+// no receiving server ever judged the message
+func isNetworkError(err error) bool {
+	var netErr net.Error
+	return errors.As(err, &netErr) ||
+		errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// classifySendError classifies a provider send failure by its bounce class. Quota
+// and rate limits are told apart from soft bounces so they show up separately.
+// Only failures positively identified as hard bounces or blocks are permanent.
+func classifySendError(err error) *TaskError {
+	if isNetworkError(err) {
+		return transientError(FailureProvider, "network", err)
+	}
+
+	text := strings.ToLower(err.Error())
+	for _, pattern := range quotaPatterns {
+		if strings.Contains(text, pattern) {
+			return transientError(FailureQuota, "rate_limit", err)
+		}
+	}
+
+	class := bounce.Classify(err.Error())
+	switch class {
+	case bounce.ClassHard, bounce.ClassBlock, bounce.ClassReputation:
+		return permanentError(FailureProvider, string(class), err)
+	}
+	return transientError(FailureProvider, string(class), err)
+}
+
+// taskErrorPattern matches the prefix TaskError.Error writes, as stored by the queue
+var taskErrorPattern = regexp.MustCompile(`^\[(\w+)/([\w.-]*) (transient|permanent)\]`)
+
+// ParseTaskError recovers the classification from a task's last error message.
+// It reports false for errors that were not classified.
+func ParseTaskError(message string) (category FailureCategory, reason string, retryable bool, ok bool) {
+	m := taskErrorPattern.FindStringSubmatch(message)
+	if m == nil {
+		return "", "", false, false
+	}
+	return FailureCategory(m[1]), m[2], m[3] == "transient", true
+}
@@ -0,0 +1,220 @@
+package worker
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/crypto"
+	"github.com/dublyo/mailat/api/pkg/eventexport"
+)
+
+// Event export statuses, as stored in event_exports
+const (
+	ExportStatusPending   = "pending"
+	ExportStatusRunning   = "running"
+	ExportStatusCompleted = "completed"
+	ExportStatusFailed    = "failed"
+)
+
+// ExportDownloadTTL is how long an export in the exports bucket can be downloaded
+const ExportDownloadTTL = 7 * 24 * time.Hour
+
+// exportColumns are the fields of each exported delivery event, in CSV column order
+var exportColumns = []string{
+	"emailId", "messageId", "event", "from", "to", "subject", "tags",
+	"details", "ipAddress", "userAgent", "occurredAt",
+}
+
+// OpenExportStore returns the store an export is written to: the platform's
+// exports bucket for downloads, or the organization's own bucket
+func OpenExportStore(ctx context.Context, db *sql.DB, cfg *config.Config, orgID int64, destination string) (*provider.ExportStore, eventexport.Bucket, error) {
+	if destination != eventexport.DestinationS3 {
+		if cfg.ExportsBucket == "" {
+			return nil, eventexport.Bucket{}, fmt.Errorf("export storage is not configured")
+		}
+		store, err := provider.NewExportStore(&provider.ExportStoreConfig{
+			Region:          cfg.AWSRegion,
+			AccessKeyID:     cfg.AWSAccessKeyID,
+			SecretAccessKey: cfg.AWSSecretAccessKey,
+			Bucket:          cfg.ExportsBucket,
+		})
+		return store, eventexport.Bucket{}, err
+	}
+
+	bucket := eventexport.Load(ctx, db, orgID)
+	if !bucket.Configured() {
+		return nil, bucket, fmt.Errorf("no export bucket is configured for the organization")
+	}
+	secret, err := crypto.Decrypt(bucket.SecretAccessKey, cfg.EncryptionKey)
+	if err != nil {
+		return nil, bucket, fmt.Errorf("failed to decrypt export bucket credentials: %w", err)
+	}
+	store, err := provider.NewExportStore(&provider.ExportStoreConfig{
+		Region:          bucket.Region,
+		AccessKeyID:     bucket.AccessKeyID,
+		SecretAccessKey: secret,
+		Bucket:          bucket.Bucket,
+	})
+	return store, bucket, err
+}
+
+// HandleEventExport writes an organization's delivery events for a date range to
+// a CSV or NDJSON file and uploads it to the export's destination
+func (h *ScheduledTaskHandler) HandleEventExport(ctx context.Context, task *asynq.Task) error {
+	payload, err := UnmarshalEventExportPayload(task.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	var exportUUID, format, destination string
+	var from, to time.Time
+	err = h.db.QueryRowContext(ctx, `
+		UPDATE event_exports SET status = $3, error = NULL
+		WHERE id = $1 AND org_id = $2 AND status = $4
+		RETURNING uuid, format, destination, date_from, date_to
+	`, payload.ExportID, payload.OrgID, ExportStatusRunning, ExportStatusPending).Scan(
+		&exportUUID, &format, &destination, &from, &to)
+	if err != nil {
+		return databaseError("export_not_found", err)
+	}
+
+	if err := h.runEventExport(ctx, payload.OrgID, payload.ExportID, exportUUID, format, destination, from, to); err != nil {
+		h.db.ExecContext(ctx, `
+			UPDATE event_exports SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+		`, payload.ExportID, ExportStatusFailed, err.Error())
+		return permanentError(FailureInternal, "export", err)
+	}
+	return nil
+}
+
+func (h *ScheduledTaskHandler) runEventExport(ctx context.Context, orgID, exportID int64, exportUUID, format, destination string, from, to time.Time) error {
+	store, bucket, err := OpenExportStore(ctx, h.db, h.cfg, orgID, destination)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", "event-export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	rowCount, err := h.writeDeliveryEvents(ctx, file, orgID, format, from, to)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to read export file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read export file: %w", err)
+	}
+
+	contentType := "text/csv"
+	if format == eventexport.FormatNDJSON {
+		contentType = "application/x-ndjson"
+	}
+
+	name := fmt.Sprintf("delivery-events-%s-%s.%s", from.UTC().Format("20060102"), exportUUID, format)
+	var storageKey string
+	var expiresAt sql.NullTime
+	if destination == eventexport.DestinationS3 {
+		storageKey = bucket.Key(name)
+	} else {
+		storageKey = fmt.Sprintf("orgs/%d/exports/%s", orgID, name)
+		expiresAt = sql.NullTime{Time: time.Now().Add(ExportDownloadTTL), Valid: true}
+	}
+	if err := store.Put(ctx, storageKey, file, size, contentType); err != nil {
+		return err
+	}
+
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE event_exports
+		SET status = $3, storage_key = $4, row_count = $5, size = $6, expires_at = $7, completed_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, exportID, orgID, ExportStatusCompleted, storageKey, rowCount, size, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record export: %w", err)
+	}
+	return nil
+}
+
+// writeDeliveryEvents streams the organization's delivery events in [from, to) to w
+func (h *ScheduledTaskHandler) writeDeliveryEvents(ctx context.Context, w io.Writer, orgID int64, format string, from, to time.Time) (int, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT te.uuid, te.message_id, e.event_type, te.from_address, te.to_addresses, te.subject,
+		       COALESCE(te.tags, ''), COALESCE(e.details, ''), COALESCE(e.ip_address, ''),
+		       COALESCE(e.user_agent, ''), e.created_at
+		FROM transactional_delivery_events e
+		JOIN transactional_emails te ON te.id = e.email_id
+		WHERE te.org_id = $1 AND e.created_at >= $2 AND e.created_at < $3
+		ORDER BY e.created_at, e.id
+	`, orgID, from, to)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read delivery events: %w", err)
+	}
+	defer rows.Close()
+
+	buf := bufio.NewWriter(w)
+	var csvWriter *csv.Writer
+	var encoder *json.Encoder
+	if format == eventexport.FormatNDJSON {
+		encoder = json.NewEncoder(buf)
+	} else {
+		csvWriter = csv.NewWriter(buf)
+		csvWriter.Write(exportColumns)
+	}
+
+	count := 0
+	for rows.Next() {
+		var emailUUID, messageID, event, fromAddress, toAddresses, subject, tags, details, ip, userAgent string
+		var occurredAt time.Time
+		if err := rows.Scan(&emailUUID, &messageID, &event, &fromAddress, &toAddresses, &subject, &tags,
+			&details, &ip, &userAgent, &occurredAt); err != nil {
+			return count, fmt.Errorf("failed to read delivery events: %w", err)
+		}
+
+		values := []string{emailUUID, messageID, event, fromAddress, toAddresses, subject, tags,
+			details, ip, userAgent, occurredAt.UTC().Format(time.RFC3339Nano)}
+		if encoder != nil {
+			record := make(map[string]string, len(exportColumns))
+			for i, column := range exportColumns {
+				record[column] = values[i]
+			}
+			err = encoder.Encode(record)
+		} else {
+			err = csvWriter.Write(values)
+		}
+		if err != nil {
+			return count, fmt.Errorf("failed to write export file: %w", err)
+		}
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		return count, fmt.Errorf("failed to read delivery events: %w", err)
+	}
+
+	if csvWriter != nil {
+		csvWriter.Flush()
+		if err := csvWriter.Error(); err != nil {
+			return count, fmt.Errorf("failed to write export file: %w", err)
+		}
+	}
+	if err := buf.Flush(); err != nil {
+		return count, fmt.Errorf("failed to write export file: %w", err)
+	}
+	return count, nil
+}
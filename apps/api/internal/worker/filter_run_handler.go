@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+// FilterRunner applies an inbox filter to emails already received. It is
+// implemented by the inbox filter engine, so a run acts on emails the way the
+// filter does on arrival without the worker importing the service package.
+type FilterRunner interface {
+	RunFilter(ctx context.Context, userID, runID int64) error
+	FailFilterRun(ctx context.Context, runID int64, err error)
+}
+
+// FilterRunHandler handles inbox filter run tasks
+type FilterRunHandler struct {
+	runner FilterRunner
+}
+
+// NewFilterRunHandler creates a new filter run handler
+func NewFilterRunHandler(runner FilterRunner) *FilterRunHandler {
+	return &FilterRunHandler{runner: runner}
+}
+
+// HandleFilterRun applies a filter to the emails of its run that have not been
+// processed yet. A run that still fails on its final attempt is marked failed.
+func (h *FilterRunHandler) HandleFilterRun(ctx context.Context, t *asynq.Task) error {
+	payload, err := UnmarshalFilterRunPayload(t.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	if err := h.runner.RunFilter(ctx, payload.UserID, payload.RunID); err != nil {
+		if finalAttempt(ctx) {
+			h.runner.FailFilterRun(ctx, payload.RunID, err)
+		}
+		return transientError(FailureInternal, "filter_run", fmt.Errorf("failed to run filter run %d: %w", payload.RunID, err))
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+)
+
+// InboxBulkRunner applies a bulk operation to the received emails matching
+// its filter. It is implemented by the inbox service.
+type InboxBulkRunner interface {
+	RunInboxBulk(ctx context.Context, userID, jobID int64) error
+	FailInboxBulk(ctx context.Context, jobID int64, err error)
+}
+
+// InboxBulkHandler handles bulk inbox operation tasks
+type InboxBulkHandler struct {
+	runner InboxBulkRunner
+}
+
+// NewInboxBulkHandler creates a new inbox bulk handler
+func NewInboxBulkHandler(runner InboxBulkRunner) *InboxBulkHandler {
+	return &InboxBulkHandler{runner: runner}
+}
+
+// HandleInboxBulk applies a bulk operation to the emails it has not reached
+// yet. A job that still fails on its final attempt is marked failed.
+func (h *InboxBulkHandler) HandleInboxBulk(ctx context.Context, t *asynq.Task) error {
+	payload, err := UnmarshalInboxBulkPayload(t.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	if err := h.runner.RunInboxBulk(ctx, payload.UserID, payload.JobID); err != nil {
+		if finalAttempt(ctx) {
+			h.runner.FailInboxBulk(ctx, payload.JobID, err)
+		}
+		return transientError(FailureInternal, "inbox_bulk", fmt.Errorf("failed to run inbox bulk job %d: %w", payload.JobID, err))
+	}
+	return nil
+}
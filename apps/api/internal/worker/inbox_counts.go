@@ -0,0 +1,46 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+
+	"github.com/dublyo/mailat/api/pkg/inboxcounts"
+)
+
+// HandleInboxCounts recounts the emails of every identity and corrects the
+// inbox counters the trigger on received_emails keeps, should they have
+// drifted
+func (h *ScheduledTaskHandler) HandleInboxCounts(ctx context.Context, task *asynq.Task) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id FROM identities ORDER BY id
+	`)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	var identityIDs []int64
+	for rows.Next() {
+		var identityID int64
+		if rows.Scan(&identityID) == nil {
+			identityIDs = append(identityIDs, identityID)
+		}
+	}
+	rows.Close()
+
+	drifted := 0
+	for _, identityID := range identityIDs {
+		changed, err := inboxcounts.Reconcile(ctx, h.db, identityID)
+		if err != nil {
+			fmt.Printf("Warning: failed to reconcile inbox counts of identity %d: %v\n", identityID, err)
+			continue
+		}
+		if changed {
+			drifted++
+		}
+	}
+	if drifted > 0 {
+		fmt.Printf("Inbox counts corrected for %d identities\n", drifted)
+	}
+	return nil
+}
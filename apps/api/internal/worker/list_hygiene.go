@@ -0,0 +1,241 @@
+package worker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/hygiene"
+)
+
+// List hygiene run triggers and statuses, as stored in list_hygiene_runs
+const (
+	HygieneTriggerScheduled = "scheduled"
+	HygieneTriggerManual    = "manual"
+
+	HygieneStatusPending   = "pending"
+	HygieneStatusRunning   = "running"
+	HygieneStatusCompleted = "completed"
+	HygieneStatusFailed    = "failed"
+)
+
+// hygieneFlaggedSample is how many flagged contacts a run's report lists
+const hygieneFlaggedSample = 100
+
+// hygieneLookupTimeout bounds the DNS lookups of a single address
+const hygieneLookupTimeout = 10 * time.Second
+
+// hygieneFlagged is a contact a run flagged, as listed in its report. The
+// service reads it back as model.ListHygieneFlagged.
+type hygieneFlagged struct {
+	ContactUUID string   `json:"contactUuid"`
+	Email       string   `json:"email"`
+	Verdict     string   `json:"verdict"`
+	Reasons     []string `json:"reasons"`
+	Quarantined bool     `json:"quarantined"`
+}
+
+// HandleListHygiene re-verifies the stale contacts of every organization with
+// scheduled list cleaning enabled
+func (h *ScheduledTaskHandler) HandleListHygiene(ctx context.Context, task *asynq.Task) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id FROM organizations WHERE (settings->'listHygiene'->>'enabled')::boolean IS TRUE
+	`)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	var orgIDs []int64
+	for rows.Next() {
+		var orgID int64
+		if err := rows.Scan(&orgID); err == nil {
+			orgIDs = append(orgIDs, orgID)
+		}
+	}
+	rows.Close()
+
+	for _, orgID := range orgIDs {
+		var runID int64
+		err := h.db.QueryRowContext(ctx, `
+			INSERT INTO list_hygiene_runs (org_id, trigger, status, created_at)
+			SELECT $1, $2, $3, NOW()
+			WHERE NOT EXISTS (
+				SELECT 1 FROM list_hygiene_runs WHERE org_id = $1 AND status IN ($3, $4)
+			)
+			RETURNING id
+		`, orgID, HygieneTriggerScheduled, HygieneStatusPending, HygieneStatusRunning).Scan(&runID)
+		if err != nil {
+			// A run of the org that's still going is left to finish
+			continue
+		}
+
+		if err := h.RunListHygiene(ctx, orgID, runID); err != nil {
+			fmt.Printf("List hygiene for org %d failed: %v\n", orgID, err)
+		}
+	}
+
+	return nil
+}
+
+// HandleListHygieneRun runs an on-demand list hygiene run
+func (h *ScheduledTaskHandler) HandleListHygieneRun(ctx context.Context, task *asynq.Task) error {
+	payload, err := UnmarshalListHygieneRunPayload(task.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	if err := h.RunListHygiene(ctx, payload.OrgID, payload.RunID); err != nil {
+		return permanentError(FailureInternal, "list_hygiene", err)
+	}
+	return nil
+}
+
+// RunListHygiene checks the addresses of an organization's stale contacts
+// under its policy, records each verdict on the contact, quarantines the
+// contacts the policy says to, and writes the run's report. Contacts are stale
+// when they haven't engaged, or been added if they never did, for the policy's
+// StaleDays; those checked in the last RecheckDays are skipped.
+func (h *ScheduledTaskHandler) RunListHygiene(ctx context.Context, orgID, runID int64) error {
+	result, err := h.db.ExecContext(ctx, `
+		UPDATE list_hygiene_runs SET status = $3, error = NULL, started_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, runID, orgID, HygieneStatusRunning)
+	if err != nil {
+		return fmt.Errorf("failed to start list hygiene run: %w", err)
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return fmt.Errorf("list hygiene run %d not found", runID)
+	}
+
+	if err := h.cleanList(ctx, orgID, runID, hygiene.Load(ctx, h.db, orgID)); err != nil {
+		h.db.ExecContext(ctx, `
+			UPDATE list_hygiene_runs SET status = $3, error = $4, completed_at = NOW()
+			WHERE id = $1 AND org_id = $2
+		`, runID, orgID, HygieneStatusFailed, err.Error())
+		return err
+	}
+	return nil
+}
+
+func (h *ScheduledTaskHandler) cleanList(ctx context.Context, orgID, runID int64, policy hygiene.Policy) error {
+	type staleContact struct {
+		id    int64
+		uuid  string
+		email string
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, uuid, email FROM contacts
+		WHERE org_id = $1 AND status = 'active'
+			AND COALESCE(last_engaged_at, created_at) < NOW() - make_interval(days => $2)
+			AND (verified_at IS NULL OR verified_at < NOW() - make_interval(days => $3))
+		ORDER BY verified_at ASC NULLS FIRST, id ASC
+		LIMIT $4
+	`, orgID, policy.StaleDays, policy.RecheckDays, policy.BatchSize)
+	if err != nil {
+		return fmt.Errorf("failed to find stale contacts: %w", err)
+	}
+	var contacts []staleContact
+	for rows.Next() {
+		var c staleContact
+		if err := rows.Scan(&c.id, &c.uuid, &c.email); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to find stale contacts: %w", err)
+		}
+		contacts = append(contacts, c)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find stale contacts: %w", err)
+	}
+
+	checker := hygiene.NewChecker(net.DefaultResolver)
+	counts := map[string]int{}
+	reasons := map[string]int{}
+	flagged := []hygieneFlagged{}
+	checked, quarantined := 0, 0
+
+	for _, c := range contacts {
+		lookupCtx, cancel := context.WithTimeout(ctx, hygieneLookupTimeout)
+		check := checker.Check(lookupCtx, c.email)
+		cancel()
+
+		quarantine := policy.Quarantines(check.Verdict)
+		var status string
+		err := h.db.QueryRowContext(ctx, `
+			UPDATE contacts
+			SET verification_status = $3, verification_reasons = $4, verified_at = NOW(),
+				status = CASE WHEN $5 AND status = 'active' THEN $6 ELSE status END,
+				updated_at = NOW()
+			WHERE id = $1 AND org_id = $2
+			RETURNING status
+		`, c.id, orgID, check.Verdict, pq.Array(check.Reasons), quarantine, hygiene.StatusQuarantined).Scan(&status)
+		if err != nil {
+			// The contact was deleted during the run
+			continue
+		}
+
+		checked++
+		counts[check.Verdict]++
+		if check.Verdict != hygiene.VerdictRisky && check.Verdict != hygiene.VerdictUndeliverable {
+			continue
+		}
+		for _, reason := range check.Reasons {
+			reasons[reason]++
+		}
+		isQuarantined := quarantine && status == hygiene.StatusQuarantined
+		if isQuarantined {
+			quarantined++
+		}
+		if len(flagged) < hygieneFlaggedSample {
+			flagged = append(flagged, hygieneFlagged{
+				ContactUUID: c.uuid,
+				Email:       c.email,
+				Verdict:     check.Verdict,
+				Reasons:     check.Reasons,
+				Quarantined: isQuarantined,
+			})
+		}
+	}
+
+	reasonsJSON, _ := json.Marshal(reasons)
+	flaggedJSON, _ := json.Marshal(flagged)
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE list_hygiene_runs
+		SET status = $3, checked_count = $4, valid_count = $5, risky_count = $6,
+		    undeliverable_count = $7, unknown_count = $8, quarantined_count = $9,
+		    reasons = $10, flagged = $11, completed_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, runID, orgID, HygieneStatusCompleted, checked, counts[hygiene.VerdictValid], counts[hygiene.VerdictRisky],
+		counts[hygiene.VerdictUndeliverable], counts[hygiene.VerdictUnknown], quarantined, reasonsJSON, flaggedJSON)
+	if err != nil {
+		return fmt.Errorf("failed to record list hygiene run: %w", err)
+	}
+
+	flaggedCount := counts[hygiene.VerdictRisky] + counts[hygiene.VerdictUndeliverable]
+	if flaggedCount == 0 {
+		return nil
+	}
+
+	alertData, _ := json.Marshal(map[string]any{
+		"runId":         runID,
+		"risky":         counts[hygiene.VerdictRisky],
+		"undeliverable": counts[hygiene.VerdictUndeliverable],
+		"quarantined":   quarantined,
+	})
+	h.db.ExecContext(ctx, `
+		INSERT INTO alerts (org_id, type, severity, title, message, data, acknowledged, created_at)
+		VALUES ($1, 'list_hygiene', 'info',
+			'List cleaning flagged contacts',
+			$2, $3, false, NOW())
+	`, orgID,
+		fmt.Sprintf("Re-verifying %d stale contacts flagged %d risky and %d undeliverable addresses; %d contacts were quarantined.",
+			checked, counts[hygiene.VerdictRisky], counts[hygiene.VerdictUndeliverable], quarantined),
+		alertData,
+	)
+	return nil
+}
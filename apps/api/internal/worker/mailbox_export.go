@@ -0,0 +1,272 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/internal/provider"
+	"github.com/dublyo/mailat/api/pkg/eventexport"
+	"github.com/dublyo/mailat/api/pkg/mailexport"
+)
+
+// mailboxExportBatchSize is how many emails are read from the database at a time
+const mailboxExportBatchSize = 200
+
+// mailboxEmail is a received email as exported
+type mailboxEmail struct {
+	id          int64
+	uuid        string
+	folder      string
+	fromEmail   string
+	fromName    string
+	to          []string
+	cc          []string
+	replyTo     string
+	subject     string
+	textBody    string
+	htmlBody    string
+	messageID   string
+	inReplyTo   string
+	references  []string
+	receivedAt  time.Time
+	rawS3Key    string
+	rawS3Bucket string
+}
+
+// HandleMailboxExport writes every email of an identity, with its attachments,
+// to an MBOX file or a zip of EML files, uploads it to the export's destination
+// and records where it is
+func (h *ScheduledTaskHandler) HandleMailboxExport(ctx context.Context, task *asynq.Task) error {
+	payload, err := UnmarshalMailboxExportPayload(task.Payload())
+	if err != nil {
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
+	}
+
+	var exportUUID, format, destination string
+	var identityID int64
+	err = h.db.QueryRowContext(ctx, `
+		UPDATE mailbox_exports SET status = $3, error = NULL
+		WHERE id = $1 AND org_id = $2 AND status = $4
+		RETURNING uuid, identity_id, format, destination
+	`, payload.ExportID, payload.OrgID, ExportStatusRunning, ExportStatusPending).Scan(
+		&exportUUID, &identityID, &format, &destination)
+	if err != nil {
+		return databaseError("export_not_found", err)
+	}
+
+	if err := h.runMailboxExport(ctx, payload.OrgID, payload.ExportID, identityID, exportUUID, format, destination); err != nil {
+		h.db.ExecContext(ctx, `
+			UPDATE mailbox_exports SET status = $2, error = $3, completed_at = NOW() WHERE id = $1
+		`, payload.ExportID, ExportStatusFailed, err.Error())
+		return permanentError(FailureInternal, "export", err)
+	}
+	return nil
+}
+
+func (h *ScheduledTaskHandler) runMailboxExport(ctx context.Context, orgID, exportID, identityID int64, exportUUID, format, destination string) error {
+	store, bucket, err := OpenExportStore(ctx, h.db, h.cfg, orgID, destination)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp("", "mailbox-export-*")
+	if err != nil {
+		return fmt.Errorf("failed to create export file: %w", err)
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	emailCount, err := h.writeMailbox(ctx, file, identityID, format)
+	if err != nil {
+		return err
+	}
+	size, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return fmt.Errorf("failed to read export file: %w", err)
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("failed to read export file: %w", err)
+	}
+
+	var address string
+	h.db.QueryRowContext(ctx, `SELECT email FROM identities WHERE id = $1`, identityID).Scan(&address)
+	name := fmt.Sprintf("mailbox-%s-%s-%s.%s", strings.ReplaceAll(address, "@", "_at_"),
+		time.Now().UTC().Format("20060102"), exportUUID, mailexport.Extension(format))
+	var storageKey string
+	var expiresAt sql.NullTime
+	if destination == eventexport.DestinationS3 {
+		storageKey = bucket.Key(name)
+	} else {
+		storageKey = fmt.Sprintf("orgs/%d/exports/%s", orgID, name)
+		expiresAt = sql.NullTime{Time: time.Now().Add(ExportDownloadTTL), Valid: true}
+	}
+	if err := store.Put(ctx, storageKey, file, size, mailexport.ContentType(format)); err != nil {
+		return err
+	}
+
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE mailbox_exports
+		SET status = $3, storage_key = $4, email_count = $5, size = $6, expires_at = $7, completed_at = NOW()
+		WHERE id = $1 AND org_id = $2
+	`, exportID, orgID, ExportStatusCompleted, storageKey, emailCount, size, expiresAt)
+	if err != nil {
+		return fmt.Errorf("failed to record export: %w", err)
+	}
+	return nil
+}
+
+// writeMailbox streams the emails of an identity to w, oldest first, reading
+// them in batches by ID. Emails are written as received when their raw source
+// is still stored, and rebuilt from what was kept of them otherwise.
+func (h *ScheduledTaskHandler) writeMailbox(ctx context.Context, w io.Writer, identityID int64, format string) (int, error) {
+	receiving, err := provider.NewReceivingProvider(&provider.ReceivingConfig{
+		Region:          h.cfg.AWSRegion,
+		AccessKeyID:     h.cfg.AWSAccessKeyID,
+		SecretAccessKey: h.cfg.AWSSecretAccessKey,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect to email storage: %w", err)
+	}
+
+	archive := mailexport.NewWriter(w, format)
+	count := 0
+	var cursor int64
+	for {
+		emails, err := h.mailboxBatch(ctx, identityID, cursor)
+		if err != nil {
+			return count, err
+		}
+		for _, email := range emails {
+			raw, err := h.mailboxSource(ctx, receiving, email)
+			if err != nil {
+				return count, err
+			}
+			name := email.folder + "/" + email.receivedAt.UTC().Format("20060102-150405") + "-" + email.uuid
+			if err := archive.Add(name, email.fromEmail, email.receivedAt, raw); err != nil {
+				return count, fmt.Errorf("failed to write export file: %w", err)
+			}
+			count++
+			cursor = email.id
+		}
+		if len(emails) < mailboxExportBatchSize {
+			break
+		}
+	}
+
+	if err := archive.Close(); err != nil {
+		return count, fmt.Errorf("failed to write export file: %w", err)
+	}
+	return count, nil
+}
+
+// mailboxBatch reads the next batch of an identity's emails after cursor
+func (h *ScheduledTaskHandler) mailboxBatch(ctx context.Context, identityID, cursor int64) ([]*mailboxEmail, error) {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, uuid, COALESCE(folder, 'inbox'), from_email, COALESCE(from_name, ''),
+		       COALESCE(to_emails, '{}'), COALESCE(cc_emails, '{}'), COALESCE(reply_to, ''), subject,
+		       COALESCE(text_body, ''), COALESCE(html_body, ''), message_id, COALESCE(in_reply_to, ''),
+		       COALESCE("references", '{}'), COALESCE(received_at, created_at),
+		       COALESCE(raw_s3_key, ''), COALESCE(raw_s3_bucket, '')
+		FROM received_emails
+		WHERE identity_id = $1 AND id > $2
+		ORDER BY id
+		LIMIT $3
+	`, identityID, cursor, mailboxExportBatchSize)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read emails: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []*mailboxEmail
+	for rows.Next() {
+		var e mailboxEmail
+		err := rows.Scan(&e.id, &e.uuid, &e.folder, &e.fromEmail, &e.fromName,
+			pq.Array(&e.to), pq.Array(&e.cc), &e.replyTo, &e.subject,
+			&e.textBody, &e.htmlBody, &e.messageID, &e.inReplyTo,
+			pq.Array(&e.references), &e.receivedAt, &e.rawS3Key, &e.rawS3Bucket)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read emails: %w", err)
+		}
+		emails = append(emails, &e)
+	}
+	return emails, rows.Err()
+}
+
+// mailboxSource returns the MIME source of an email: the raw email as
+// received, or, for emails with none stored anymore such as sent copies, one
+// built from the stored headers, bodies and attachments
+func (h *ScheduledTaskHandler) mailboxSource(ctx context.Context, receiving *provider.ReceivingProvider, email *mailboxEmail) ([]byte, error) {
+	if email.rawS3Key != "" && email.rawS3Bucket != "" {
+		raw, err := receiving.GetEmailFromS3(ctx, email.rawS3Bucket, email.rawS3Key)
+		if err == nil {
+			return raw, nil
+		}
+		// Expired from the receiving bucket, so rebuilt below
+	}
+
+	from := email.fromEmail
+	if email.fromName != "" {
+		from = fmt.Sprintf("%q <%s>", email.fromName, email.fromEmail)
+	}
+	msg := &provider.EmailMessage{
+		From:      from,
+		To:        email.to,
+		Cc:        email.cc,
+		ReplyTo:   email.replyTo,
+		Subject:   email.subject,
+		TextBody:  email.textBody,
+		HTMLBody:  email.htmlBody,
+		MessageID: email.messageID,
+		Date:      email.receivedAt,
+		Headers:   map[string]string{},
+	}
+	if email.inReplyTo != "" {
+		msg.Headers["In-Reply-To"] = email.inReplyTo
+	}
+	if len(email.references) > 0 {
+		msg.Headers["References"] = strings.Join(email.references, " ")
+	}
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT filename, content_type, s3_bucket, s3_key, COALESCE(content_id, ''), COALESCE(is_inline, false)
+		FROM email_attachments
+		WHERE received_email_id = $1 AND s3_key <> '' AND COALESCE(virus_verdict, '') <> 'FAIL'
+		ORDER BY id
+	`, email.id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read attachments: %w", err)
+	}
+	type storedAttachment struct {
+		filename, contentType, bucket, key, contentID string
+		inline                                        bool
+	}
+	var stored []storedAttachment
+	for rows.Next() {
+		var a storedAttachment
+		if rows.Scan(&a.filename, &a.contentType, &a.bucket, &a.key, &a.contentID, &a.inline) == nil {
+			stored = append(stored, a)
+		}
+	}
+	rows.Close()
+
+	for _, a := range stored {
+		data, err := receiving.GetEmailFromS3(ctx, a.bucket, a.key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to fetch attachment %s of email %s: %w", a.filename, email.uuid, err)
+		}
+		att := provider.Attachment{Filename: a.filename, ContentType: a.contentType, Data: data}
+		if a.inline {
+			att.ContentID = a.contentID
+		}
+		msg.Attachments = append(msg.Attachments, att)
+	}
+	return provider.BuildMIMEMessage(msg)
+}
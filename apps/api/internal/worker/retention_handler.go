@@ -0,0 +1,313 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/retention"
+	"github.com/dublyo/mailat/api/pkg/safehttp"
+)
+
+const (
+	// retentionBatchSize is the number of emails exported and purged at a time
+	retentionBatchSize = 500
+	// retentionMaxBatches bounds the work done for one org in a single run
+	retentionMaxBatches = 200
+)
+
+// Retention actions, also sent as the "action" of export requests
+const (
+	RetentionActionStripContent = "strip_content"
+	RetentionActionDelete       = "delete"
+)
+
+// retentionExportClient posts to the export hooks orgs configure, so it refuses
+// to connect to internal addresses
+var retentionExportClient = safehttp.NewClient(60 * time.Second)
+
+// RetentionRunResult summarizes the last retention run for an organization
+type RetentionRunResult struct {
+	RanAt    time.Time `json:"ranAt"`
+	Stripped int       `json:"stripped"`
+	Deleted  int       `json:"deleted"`
+	Error    string    `json:"error,omitempty"`
+}
+
+// retentionEmail is the exported form of a transactional email about to be purged
+type retentionEmail struct {
+	ID        int64            `json:"-"`
+	UUID      string           `json:"id"`
+	MessageID string           `json:"messageId"`
+	From      string           `json:"from"`
+	To        string           `json:"to"`
+	Cc        string           `json:"cc,omitempty"`
+	Bcc       string           `json:"bcc,omitempty"`
+	Subject   string           `json:"subject"`
+	HTMLBody  string           `json:"html,omitempty"`
+	TextBody  string           `json:"text,omitempty"`
+	Status    string           `json:"status"`
+	Tags      string           `json:"tags,omitempty"`
+	Metadata  string           `json:"metadata,omitempty"`
+	CreatedAt time.Time        `json:"createdAt"`
+	SentAt    *time.Time       `json:"sentAt,omitempty"`
+	Events    []retentionEvent `json:"events,omitempty"`
+}
+
+type retentionEvent struct {
+	Type      string    `json:"type"`
+	Details   string    `json:"details,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// HandleRetention applies each organization's retention policy to its transactional emails
+func (h *ScheduledTaskHandler) HandleRetention(ctx context.Context, task *asynq.Task) error {
+	fmt.Println("Running scheduled retention...")
+
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id FROM organizations WHERE settings->'retention' IS NOT NULL
+	`)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	var orgIDs []int64
+	for rows.Next() {
+		var orgID int64
+		if err := rows.Scan(&orgID); err == nil {
+			orgIDs = append(orgIDs, orgID)
+		}
+	}
+	rows.Close()
+
+	for _, orgID := range orgIDs {
+		policy := retention.Load(ctx, h.db, orgID)
+		if !policy.Enabled() {
+			continue
+		}
+		result := h.ApplyRetention(ctx, orgID, policy)
+		if result.Error != "" {
+			fmt.Printf("Retention for org %d stopped: %s\n", orgID, result.Error)
+		}
+	}
+
+	return nil
+}
+
+// ApplyRetention strips content and deletes emails past the policy windows for one
+// organization. When an export URL is configured each batch is exported first and
+// nothing is purged if the export fails.
+func (h *ScheduledTaskHandler) ApplyRetention(ctx context.Context, orgID int64, policy retention.Policy) RetentionRunResult {
+	result := RetentionRunResult{RanAt: time.Now()}
+
+	var err error
+	if policy.StripContentAfterDays > 0 {
+		result.Stripped, err = h.purgeRetention(ctx, orgID, policy, RetentionActionStripContent, policy.StripContentAfterDays)
+	}
+	if err == nil && policy.DeleteAfterDays > 0 {
+		result.Deleted, err = h.purgeRetention(ctx, orgID, policy, RetentionActionDelete, policy.DeleteAfterDays)
+	}
+	if err != nil {
+		result.Error = err.Error()
+		h.createRetentionAlert(ctx, orgID, err)
+	}
+
+	resultJSON, _ := json.Marshal(result)
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE organizations
+		SET settings = jsonb_set(COALESCE(settings, '{}'::jsonb), '{retentionLastRun}', $2::jsonb, true)
+		WHERE id = $1
+	`, orgID, string(resultJSON))
+	if err != nil {
+		fmt.Printf("Warning: failed to record retention run: %v\n", err)
+	}
+
+	return result
+}
+
+// purgeRetention processes batches of emails older than the window until none are left
+func (h *ScheduledTaskHandler) purgeRetention(ctx context.Context, orgID int64, policy retention.Policy, action string, days int) (int, error) {
+	cutoff := time.Now().AddDate(0, 0, -days)
+	total := 0
+
+	for batch := 0; batch < retentionMaxBatches; batch++ {
+		emails, err := h.loadRetentionBatch(ctx, orgID, action, cutoff)
+		if err != nil {
+			return total, err
+		}
+		if len(emails) == 0 {
+			break
+		}
+
+		if policy.ExportURL != "" {
+			if err := h.exportRetentionBatch(ctx, orgID, policy, action, emails); err != nil {
+				return total, fmt.Errorf("export before %s failed, nothing purged: %w", action, err)
+			}
+		}
+
+		ids := make([]int64, len(emails))
+		for i, e := range emails {
+			ids[i] = e.ID
+		}
+
+		if action == RetentionActionDelete {
+			_, err = h.db.ExecContext(ctx, `
+				DELETE FROM transactional_emails WHERE id = ANY($1)
+			`, pq.Array(ids))
+		} else {
+			_, err = h.db.ExecContext(ctx, `
+				UPDATE transactional_emails
+				SET html_body = NULL, text_body = NULL, amp_body = NULL, content_archived_at = NOW(), updated_at = NOW()
+				WHERE id = ANY($1)
+			`, pq.Array(ids))
+		}
+		if err != nil {
+			return total, fmt.Errorf("failed to %s emails: %w", action, err)
+		}
+		total += len(emails)
+
+		if len(emails) < retentionBatchSize {
+			break
+		}
+	}
+
+	return total, nil
+}
+
+// loadRetentionBatch returns the next batch of emails eligible for an action.
+// Emails that have not been sent yet are never purged.
+func (h *ScheduledTaskHandler) loadRetentionBatch(ctx context.Context, orgID int64, action string, cutoff time.Time) ([]retentionEmail, error) {
+	condition := "TRUE"
+	if action == RetentionActionStripContent {
+		condition = "content_archived_at IS NULL AND (html_body IS NOT NULL OR text_body IS NOT NULL)"
+	}
+
+	rows, err := h.db.QueryContext(ctx, fmt.Sprintf(`
+		SELECT id, uuid, message_id, from_address, to_addresses, COALESCE(cc_addresses, ''),
+		       COALESCE(bcc_addresses, ''), subject, COALESCE(html_body, ''), COALESCE(text_body, ''),
+		       status, COALESCE(tags, ''), COALESCE(metadata, ''), created_at, sent_at
+		FROM transactional_emails
+		WHERE org_id = $1 AND created_at < $2
+		  AND status NOT IN ('queued', 'held', 'sending')
+		  AND %s
+		ORDER BY id
+		LIMIT %d
+	`, condition, retentionBatchSize), orgID, cutoff)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load emails for retention: %w", err)
+	}
+	defer rows.Close()
+
+	var emails []retentionEmail
+	index := map[int64]int{}
+	for rows.Next() {
+		var e retentionEmail
+		var sentAt sql.NullTime
+		if err := rows.Scan(&e.ID, &e.UUID, &e.MessageID, &e.From, &e.To, &e.Cc, &e.Bcc, &e.Subject,
+			&e.HTMLBody, &e.TextBody, &e.Status, &e.Tags, &e.Metadata, &e.CreatedAt, &sentAt); err != nil {
+			continue
+		}
+		if sentAt.Valid {
+			e.SentAt = &sentAt.Time
+		}
+		index[e.ID] = len(emails)
+		emails = append(emails, e)
+	}
+
+	// Deleted emails take their delivery events with them, so export those too
+	if action == RetentionActionDelete && len(emails) > 0 {
+		ids := make([]int64, 0, len(emails))
+		for _, e := range emails {
+			ids = append(ids, e.ID)
+		}
+		eventRows, err := h.db.QueryContext(ctx, `
+			SELECT email_id, event_type, COALESCE(details, ''), created_at
+			FROM transactional_delivery_events
+			WHERE email_id = ANY($1)
+			ORDER BY created_at
+		`, pq.Array(ids))
+		if err != nil {
+			return nil, fmt.Errorf("failed to load delivery events for retention: %w", err)
+		}
+		defer eventRows.Close()
+		for eventRows.Next() {
+			var emailID int64
+			var ev retentionEvent
+			if err := eventRows.Scan(&emailID, &ev.Type, &ev.Details, &ev.Timestamp); err != nil {
+				continue
+			}
+			if i, ok := index[emailID]; ok {
+				emails[i].Events = append(emails[i].Events, ev)
+			}
+		}
+	}
+
+	return emails, nil
+}
+
+// exportRetentionBatch posts a batch to the org's export hook, signed like webhook deliveries
+func (h *ScheduledTaskHandler) exportRetentionBatch(ctx context.Context, orgID int64, policy retention.Policy, action string, emails []retentionEmail) error {
+	body, err := json.Marshal(map[string]any{
+		"event":     "retention.export",
+		"action":    action,
+		"orgId":     orgID,
+		"timestamp": time.Now().UTC().Format(time.RFC3339),
+		"emails":    emails,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to marshal export: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", policy.ExportURL, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("failed to create export request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Mailat-Webhook/1.0")
+
+	if policy.ExportSecret != "" {
+		timestamp := fmt.Sprintf("%d", time.Now().Unix())
+		mac := hmac.New(sha256.New, []byte(policy.ExportSecret))
+		mac.Write([]byte(timestamp + "." + string(body)))
+		req.Header.Set("X-Webhook-Timestamp", timestamp)
+		req.Header.Set("X-Webhook-Signature", hex.EncodeToString(mac.Sum(nil)))
+	}
+
+	resp, err := retentionExportClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	return nil
+}
+
+func (h *ScheduledTaskHandler) createRetentionAlert(ctx context.Context, orgID int64, err error) {
+	alertData, _ := json.Marshal(map[string]any{
+		"error": err.Error(),
+	})
+
+	h.db.ExecContext(ctx, `
+		INSERT INTO alerts (org_id, type, severity, title, message, data, acknowledged, created_at)
+		VALUES ($1, 'retention', 'warning',
+			'Email retention run incomplete',
+			$2, $3, false, NOW())
+	`, orgID,
+		fmt.Sprintf("The retention policy could not be fully applied: %s. Emails are kept until the next run succeeds.", err.Error()),
+		alertData,
+	)
+}
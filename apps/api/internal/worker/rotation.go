@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/rotation"
+)
+
+// applySenderRotation picks the sending identity for an email sent through a rotation
+// pool and rewrites its sender. When every member is at its daily cap the email keeps
+// the sender it was submitted with.
+func (h *EmailHandler) applySenderRotation(ctx context.Context, payload *EmailSendPayload) {
+	pool, ok := rotation.Load(ctx, h.db, payload.OrgID).Pool(payload.SenderPool)
+	if !ok {
+		h.recordEvent(ctx, payload.EmailID, "rotation_skipped", fmt.Sprintf("Sender pool %q no longer exists, sending as %s", payload.SenderPool, payload.From))
+		return
+	}
+
+	sentToday, err := SentTodayBySender(ctx, h.db, payload.OrgID, pool.Addresses())
+	if err != nil {
+		fmt.Printf("Warning: failed to count sender volume: %v\n", err)
+		return
+	}
+
+	member, ok := pool.Pick(sentToday)
+	if !ok {
+		h.recordEvent(ctx, payload.EmailID, "rotation_skipped", fmt.Sprintf("All senders in pool %q reached their daily cap, sending as %s", pool.Name, payload.From))
+		return
+	}
+
+	payload.From = member.From
+	_, err = h.db.ExecContext(ctx, `
+		UPDATE transactional_emails SET from_address = $2, updated_at = NOW() WHERE id = $1
+	`, payload.EmailID, member.From)
+	if err != nil {
+		fmt.Printf("Warning: failed to record rotated sender: %v\n", err)
+	}
+}
+
+// SentTodayBySender counts today's (UTC) sends per lowercased sender address, including
+// emails currently being sent
+func SentTodayBySender(ctx context.Context, db *sql.DB, orgID int64, addresses []string) (map[string]int, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT from_address, COUNT(*)
+		FROM transactional_emails
+		WHERE org_id = $1 AND from_address = ANY($2)
+		  AND (sent_at >= date_trunc('day', NOW() AT TIME ZONE 'UTC') AT TIME ZONE 'UTC' OR status = 'sending')
+		GROUP BY from_address
+	`, orgID, pq.Array(addresses))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int, len(addresses))
+	for rows.Next() {
+		var from string
+		var count int
+		if err := rows.Scan(&from, &count); err == nil {
+			counts[strings.ToLower(from)] += count
+		}
+	}
+	return counts, nil
+}
@@ -15,10 +15,20 @@ import (
 
 // Task types for scheduled jobs
 const (
-	TypeScheduledBlacklistCheck = "scheduled:blacklist-check"
-	TypeScheduledWarmupAdvance  = "scheduled:warmup-advance"
-	TypeScheduledBounceCheck    = "scheduled:bounce-check"
-	TypeScheduledAlertDigest    = "scheduled:alert-digest"
+	TypeScheduledBlacklistCheck     = "scheduled:blacklist-check"
+	TypeScheduledWarmupAdvance      = "scheduled:warmup-advance"
+	TypeScheduledBounceCheck        = "scheduled:bounce-check"
+	TypeScheduledAlertDigest        = "scheduled:alert-digest"
+	TypeScheduledRetention          = "scheduled:retention"
+	TypeScheduledBackup             = "scheduled:backup"
+	TypeScheduledCampaignRecovery   = "scheduled:campaign-recovery"
+	TypeScheduledSegmentRefresh     = "scheduled:segment-refresh"
+	TypeScheduledEngagementScore    = "scheduled:engagement-score"
+	TypeScheduledListHygiene        = "scheduled:list-hygiene"
+	TypeScheduledCRMSync            = "scheduled:crm-sync"
+	TypeScheduledAutomationSteps    = "scheduled:automation-steps"
+	TypeScheduledAutomationTriggers = "scheduled:automation-triggers"
+	TypeScheduledInboxCounts        = "scheduled:inbox-counts"
 )
 
 // Scheduler handles scheduled/periodic tasks
@@ -67,11 +77,82 @@ func (s *Scheduler) RegisterScheduledTasks() error {
 		return fmt.Errorf("failed to register alert digest: %w", err)
 	}
 
+	// Email content retention at 3am
+	_, err = s.scheduler.Register("0 3 * * *", asynq.NewTask(TypeScheduledRetention, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register retention: %w", err)
+	}
+
+	// Org backups at 2am, before retention purges anything
+	_, err = s.scheduler.Register("0 2 * * *", asynq.NewTask(TypeScheduledBackup, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register backups: %w", err)
+	}
+
+	// Campaigns whose dispatcher was lost every 5 minutes
+	_, err = s.scheduler.Register("*/5 * * * *", asynq.NewTask(TypeScheduledCampaignRecovery, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register campaign recovery: %w", err)
+	}
+
+	// Dynamic list members every hour, so date and engagement rules keep up
+	_, err = s.scheduler.Register("30 * * * *", asynq.NewTask(TypeScheduledSegmentRefresh, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register segment refresh: %w", err)
+	}
+
+	// Engagement scores at 1am, before the 1:30 segment refresh picks them up
+	_, err = s.scheduler.Register("0 1 * * *", asynq.NewTask(TypeScheduledEngagementScore, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register engagement scoring: %w", err)
+	}
+
+	// List hygiene at 4am, after the nightly retention and backups
+	_, err = s.scheduler.Register("0 4 * * *", asynq.NewTask(TypeScheduledListHygiene, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register list hygiene: %w", err)
+	}
+
+	// CRM sync hourly, off the hour's other tasks
+	_, err = s.scheduler.Register("15 * * * *", asynq.NewTask(TypeScheduledCRMSync, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register CRM sync: %w", err)
+	}
+
+	// Automation enrollments every minute, so delays end close to on time
+	_, err = s.scheduler.Register("* * * * *", asynq.NewTask(TypeScheduledAutomationSteps, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register automation steps: %w", err)
+	}
+
+	// Date and received-email automation triggers every 5 minutes
+	_, err = s.scheduler.Register("*/5 * * * *", asynq.NewTask(TypeScheduledAutomationTriggers, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register automation triggers: %w", err)
+	}
+
+	// Inbox counts reconciliation at 3:30am, after the nightly retention
+	// deleted old emails
+	_, err = s.scheduler.Register("30 3 * * *", asynq.NewTask(TypeScheduledInboxCounts, nil))
+	if err != nil {
+		return fmt.Errorf("failed to register inbox counts reconciliation: %w", err)
+	}
+
 	fmt.Println("Registered scheduled tasks:")
 	fmt.Println("  - Blacklist check (every 6 hours)")
 	fmt.Println("  - Warmup day advance (midnight)")
 	fmt.Println("  - Bounce rate check (hourly)")
 	fmt.Println("  - Alert digest (9am daily)")
+	fmt.Println("  - Email retention (3am daily)")
+	fmt.Println("  - Org backups (2am daily)")
+	fmt.Println("  - Campaign recovery (every 5 minutes)")
+	fmt.Println("  - Segment refresh (hourly)")
+	fmt.Println("  - Engagement scoring (1am daily)")
+	fmt.Println("  - List hygiene (4am daily)")
+	fmt.Println("  - CRM sync (hourly)")
+	fmt.Println("  - Automation steps (every minute)")
+	fmt.Println("  - Automation triggers (every 5 minutes)")
+	fmt.Println("  - Inbox counts reconciliation (3:30am daily)")
 
 	return nil
 }
@@ -110,7 +191,7 @@ func (h *ScheduledTaskHandler) HandleBlacklistCheck(ctx context.Context, task *a
 		SELECT DISTINCT org_id, ip_address FROM warmup_progress WHERE status = 'active'
 	`)
 	if err != nil {
-		return err
+		return transientError(FailureInternal, "database", err)
 	}
 	defer rows.Close()
 
@@ -144,7 +225,7 @@ func (h *ScheduledTaskHandler) HandleWarmupAdvance(ctx context.Context, task *as
 		WHERE status = 'active'
 	`)
 	if err != nil {
-		return fmt.Errorf("failed to advance warmup days: %w", err)
+		return transientError(FailureInternal, "database", fmt.Errorf("failed to advance warmup days: %w", err))
 	}
 
 	// Check for completed warmups
@@ -154,7 +235,7 @@ func (h *ScheduledTaskHandler) HandleWarmupAdvance(ctx context.Context, task *as
 		WHERE status = 'active' AND current_day > 30
 	`)
 	if err != nil {
-		return fmt.Errorf("failed to mark completed warmups: %w", err)
+		return transientError(FailureInternal, "database", fmt.Errorf("failed to mark completed warmups: %w", err))
 	}
 
 	return nil
@@ -176,7 +257,7 @@ func (h *ScheduledTaskHandler) HandleBounceCheck(ctx context.Context, task *asyn
 		HAVING COUNT(*) >= 100
 	`)
 	if err != nil {
-		return err
+		return transientError(FailureInternal, "database", err)
 	}
 	defer rows.Close()
 
@@ -225,13 +306,13 @@ func (h *ScheduledTaskHandler) HandleAlertDigest(ctx context.Context, task *asyn
 		HAVING COUNT(*) > 0
 	`)
 	if err != nil {
-		return err
+		return transientError(FailureInternal, "database", err)
 	}
 	defer rows.Close()
 
 	queueClient, err := NewQueueClient(h.cfg)
 	if err != nil {
-		return err
+		return transientError(FailureInternal, "queue", err)
 	}
 	defer queueClient.Close()
 
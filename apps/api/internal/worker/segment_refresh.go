@@ -0,0 +1,78 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hibiken/asynq"
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/segment"
+)
+
+// HandleSegmentRefresh materializes the members of every dynamic list from its
+// segment rules, so rules on dates and engagement keep up as time passes. The
+// lists refreshed longest ago go first.
+func (h *ScheduledTaskHandler) HandleSegmentRefresh(ctx context.Context, task *asynq.Task) error {
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id, org_id FROM lists
+		WHERE type = 'dynamic' AND segment_rules IS NOT NULL
+		ORDER BY segment_refreshed_at NULLS FIRST
+	`)
+	if err != nil {
+		return transientError(FailureInternal, "database", err)
+	}
+	type list struct {
+		id    int
+		orgID int64
+	}
+	var lists []list
+	for rows.Next() {
+		var l list
+		if err := rows.Scan(&l.id, &l.orgID); err == nil {
+			lists = append(lists, l)
+		}
+	}
+	rows.Close()
+
+	refreshed := 0
+	for _, l := range lists {
+		if _, err := segment.Refresh(ctx, h.db, l.orgID, l.id); err != nil {
+			fmt.Printf("Warning: failed to refresh segment %d: %v\n", l.id, err)
+			continue
+		}
+		refreshed++
+	}
+	if len(lists) > 0 {
+		fmt.Printf("Refreshed %d of %d segments\n", refreshed, len(lists))
+	}
+	return nil
+}
+
+// refreshSegments materializes the dynamic lists a campaign targets, excludes or
+// suppresses, so its recipients are snapshotted from their current members. A
+// segment that fails to refresh keeps its last members.
+func (h *CampaignHandler) refreshSegments(ctx context.Context, campaign *campaignInfo) {
+	ids := append(append(append([]int64{}, campaign.AudienceLists...), campaign.ExcludedLists...), campaign.SuppressionSegments...)
+	rows, err := h.db.QueryContext(ctx, `
+		SELECT id FROM lists
+		WHERE org_id = $1 AND id = ANY($2) AND type = 'dynamic' AND segment_rules IS NOT NULL
+	`, campaign.OrgID, pq.Array(ids))
+	if err != nil {
+		return
+	}
+	var segments []int
+	for rows.Next() {
+		var id int
+		if rows.Scan(&id) == nil {
+			segments = append(segments, id)
+		}
+	}
+	rows.Close()
+
+	for _, id := range segments {
+		if _, err := segment.Refresh(ctx, h.db, campaign.OrgID, id); err != nil {
+			fmt.Printf("Warning: campaign %d: failed to refresh segment %d: %v\n", campaign.ID, id, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package worker
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/sendwindow"
+)
+
+// applySendingWindow returns the recipients that are inside the org's sending window
+// in their own timezone (the timezone contact attribute), and when the earliest of
+// the others can be sent to. The time is zero when no contact was held back.
+func (h *CampaignHandler) applySendingWindow(ctx context.Context, campaign *campaignInfo, contacts []contactInfo) ([]contactInfo, time.Time) {
+	if campaign.IgnoreSendWindow {
+		return contacts, time.Time{}
+	}
+	window := sendwindow.Load(ctx, h.db, campaign.OrgID)
+	if !window.Enabled {
+		return contacts, time.Time{}
+	}
+
+	now := time.Now()
+	var deferredUntil time.Time
+	sendable := make([]contactInfo, 0, len(contacts))
+	for _, contact := range contacts {
+		timezone, _ := contact.Attributes["timezone"].(string)
+		next, inside := window.Next(now, timezone)
+		if inside {
+			sendable = append(sendable, contact)
+			continue
+		}
+		if deferredUntil.IsZero() || next.Before(deferredUntil) {
+			deferredUntil = next
+		}
+	}
+	return sendable, deferredUntil
+}
+
+// deferToSendingWindow re-schedules an email that is due outside the org's sending
+// window for the first recipient, and reports whether it did
+func (h *EmailHandler) deferToSendingWindow(ctx context.Context, payload *EmailSendPayload) (bool, error) {
+	window := sendwindow.Load(ctx, h.db, payload.OrgID)
+	if !window.Enabled {
+		return false, nil
+	}
+
+	var timezone string
+	if len(payload.To) > 0 {
+		timezone = sendwindow.RecipientTimezone(ctx, h.db, payload.OrgID, payload.To[0])
+	}
+	next, inside := window.Next(time.Now(), timezone)
+	if inside {
+		return false, nil
+	}
+
+	queueClient, err := NewQueueClient(h.cfg)
+	if err != nil {
+		return false, transientError(FailureInternal, "queue", fmt.Errorf("failed to create queue client: %w", err))
+	}
+	defer queueClient.Close()
+
+	payload.ScheduledFor = &next
+	if _, err := queueClient.EnqueueEmailSendScheduled(payload, next); err != nil {
+		return false, transientError(FailureInternal, "queue", fmt.Errorf("failed to defer email to its sending window: %w", err))
+	}
+
+	h.db.ExecContext(ctx, `
+		UPDATE transactional_emails SET scheduled_for = $2, updated_at = NOW() WHERE id = $1
+	`, payload.EmailID, next)
+	h.recordEvent(ctx, payload.EmailID, "deferred", fmt.Sprintf("Outside the sending window, deferred until %s", next.UTC().Format(time.RFC3339)))
+	return true, nil
+}
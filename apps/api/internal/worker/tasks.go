@@ -14,6 +14,16 @@ const (
 	TypeSuppressionCheck = "suppression:check"
 	TypeCampaignProcess  = "campaign:process"
 	TypeCampaignBatch    = "campaign:batch"
+	TypeBackupRun        = "backup:run"
+	TypeEventExport      = "export:events"
+	TypeContactExport    = "export:contacts"
+	TypeMailboxExport    = "export:mailbox"
+	TypeListHygieneRun   = "hygiene:run"
+	TypeContactBulk      = "contacts:bulk"
+	TypeCRMSync          = "crm:sync"
+	TypeComposeSend      = "compose:send"
+	TypeFilterRun        = "inbox:filter_run"
+	TypeInboxBulk        = "inbox:bulk"
 )
 
 // EmailSendPayload contains the data needed to send an email
@@ -28,18 +38,23 @@ type EmailSendPayload struct {
 	Subject        string            `json:"subject"`
 	HTMLBody       string            `json:"htmlBody,omitempty"`
 	TextBody       string            `json:"textBody,omitempty"`
+	AMPBody        string            `json:"ampBody,omitempty"` // AMP for Email part
 	MessageID      string            `json:"messageId"`
 	Attachments    []AttachmentInfo  `json:"attachments,omitempty"`
+	SenderPool     string            `json:"senderPool,omitempty"`
 	Metadata       map[string]string `json:"metadata,omitempty"`
 	RetryCount     int               `json:"retryCount"`
 	MaxRetries     int               `json:"maxRetries"`
 	ScheduledFor   *time.Time        `json:"scheduledFor,omitempty"`
 	IdempotencyKey string            `json:"idempotencyKey,omitempty"`
+
+	// IgnoreSendWindow sends a scheduled email outside the org's sending window
+	IgnoreSendWindow bool `json:"ignoreSendWindow,omitempty"`
 }
 
 // AttachmentInfo contains attachment metadata for sending
 type AttachmentInfo struct {
-	BlobID      string `json:"blobId"`
+	BlobID      string `json:"blobId"` // Storage key of a pre-uploaded attachment
 	Name        string `json:"name"`
 	Type        string `json:"type"`
 	Size        int    `json:"size"`
@@ -47,11 +62,29 @@ type AttachmentInfo struct {
 	CID         string `json:"cid,omitempty"`
 }
 
-// EmailBatchPayload contains data for batch email sending
+// EmailBatchPayload identifies a batch of transactional emails to send. The
+// entries are stored with the batch rather than in the payload.
 type EmailBatchPayload struct {
-	OrgID   int64              `json:"orgId"`
-	Emails  []EmailSendPayload `json:"emails"`
-	BatchID string             `json:"batchId"`
+	BatchID int64 `json:"batchId"`
+	OrgID   int64 `json:"orgId"`
+}
+
+// ComposeSendPayload identifies an email held for undo send that is due
+type ComposeSendPayload struct {
+	SendID int64 `json:"sendId"`
+	UserID int64 `json:"userId"`
+}
+
+// FilterRunPayload identifies an inbox filter run to work through
+type FilterRunPayload struct {
+	RunID  int64 `json:"runId"`
+	UserID int64 `json:"userId"`
+}
+
+// InboxBulkPayload identifies a bulk inbox operation to work through
+type InboxBulkPayload struct {
+	JobID  int64 `json:"jobId"`
+	UserID int64 `json:"userId"`
 }
 
 // WebhookDeliverPayload contains data for webhook delivery
@@ -88,15 +121,59 @@ type SuppressionCheckPayload struct {
 type CampaignProcessPayload struct {
 	CampaignID int   `json:"campaignId"`
 	OrgID      int64 `json:"orgId"`
+
+	// Run is the dispatcher run that scheduled the task. Tasks of a run that was
+	// superseded stop; tasks without one start a new run.
+	Run string `json:"run,omitempty"`
+}
+
+// BackupRunPayload identifies an on-demand org backup to take
+type BackupRunPayload struct {
+	BackupID int64 `json:"backupId"`
+	OrgID    int64 `json:"orgId"`
+}
+
+// ListHygieneRunPayload identifies an on-demand list hygiene run
+type ListHygieneRunPayload struct {
+	RunID int64 `json:"runId"`
+	OrgID int64 `json:"orgId"`
+}
+
+// ContactBulkPayload identifies a contact bulk job to run
+type ContactBulkPayload struct {
+	JobID int64 `json:"jobId"`
+	OrgID int64 `json:"orgId"`
+}
+
+// CRMSyncPayload identifies a CRM sync run to perform
+type CRMSyncPayload struct {
+	RunID int64 `json:"runId"`
+	OrgID int64 `json:"orgId"`
+}
+
+// EventExportPayload identifies a delivery event export to produce
+type EventExportPayload struct {
+	ExportID int64 `json:"exportId"`
+	OrgID    int64 `json:"orgId"`
+}
+
+// ContactExportPayload identifies a contact export to produce
+type ContactExportPayload struct {
+	ExportID int64 `json:"exportId"`
+	OrgID    int64 `json:"orgId"`
+}
+
+// MailboxExportPayload identifies a mailbox export to produce
+type MailboxExportPayload struct {
+	ExportID int64 `json:"exportId"`
+	OrgID    int64 `json:"orgId"`
 }
 
 // CampaignBatchPayload contains data for a batch of campaign emails
 type CampaignBatchPayload struct {
-	CampaignID  int      `json:"campaignId"`
-	OrgID       int64    `json:"orgId"`
-	ContactIDs  []int64  `json:"contactIds"`
-	BatchNumber int      `json:"batchNumber"`
-	TotalBatches int     `json:"totalBatches"`
+	CampaignID   int     `json:"campaignId"`
+	OrgID        int64   `json:"orgId"`
+	RecipientIDs []int64 `json:"recipientIds"` // Rows of the campaign's recipient snapshot
 }
 
 // NewEmailSendPayload creates a new email send task payload
@@ -183,3 +260,157 @@ func UnmarshalCampaignBatchPayload(data []byte) (*CampaignBatchPayload, error) {
 	}
 	return &p, nil
 }
+
+// Marshal serializes the payload to JSON
+func (p *EmailBatchPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalEmailBatchPayload deserializes JSON to EmailBatchPayload
+func UnmarshalEmailBatchPayload(data []byte) (*EmailBatchPayload, error) {
+	var p EmailBatchPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *ComposeSendPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalComposeSendPayload deserializes JSON to ComposeSendPayload
+func UnmarshalComposeSendPayload(data []byte) (*ComposeSendPayload, error) {
+	var p ComposeSendPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *FilterRunPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalFilterRunPayload deserializes JSON to FilterRunPayload
+func UnmarshalFilterRunPayload(data []byte) (*FilterRunPayload, error) {
+	var p FilterRunPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *InboxBulkPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalInboxBulkPayload deserializes JSON to InboxBulkPayload
+func UnmarshalInboxBulkPayload(data []byte) (*InboxBulkPayload, error) {
+	var p InboxBulkPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *BackupRunPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalBackupRunPayload deserializes JSON to BackupRunPayload
+func UnmarshalBackupRunPayload(data []byte) (*BackupRunPayload, error) {
+	var p BackupRunPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *ListHygieneRunPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalListHygieneRunPayload deserializes JSON to ListHygieneRunPayload
+func UnmarshalListHygieneRunPayload(data []byte) (*ListHygieneRunPayload, error) {
+	var p ListHygieneRunPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *ContactBulkPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalContactBulkPayload deserializes JSON to ContactBulkPayload
+func UnmarshalContactBulkPayload(data []byte) (*ContactBulkPayload, error) {
+	var p ContactBulkPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *EventExportPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalEventExportPayload deserializes JSON to EventExportPayload
+func UnmarshalEventExportPayload(data []byte) (*EventExportPayload, error) {
+	var p EventExportPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *ContactExportPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalContactExportPayload deserializes JSON to ContactExportPayload
+func UnmarshalContactExportPayload(data []byte) (*ContactExportPayload, error) {
+	var p ContactExportPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *MailboxExportPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalMailboxExportPayload deserializes JSON to MailboxExportPayload
+func UnmarshalMailboxExportPayload(data []byte) (*MailboxExportPayload, error) {
+	var p MailboxExportPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
+
+// Marshal serializes the payload to JSON
+func (p *CRMSyncPayload) Marshal() ([]byte, error) {
+	return json.Marshal(p)
+}
+
+// UnmarshalCRMSyncPayload deserializes JSON to CRMSyncPayload
+func UnmarshalCRMSyncPayload(data []byte) (*CRMSyncPayload, error) {
+	var p CRMSyncPayload
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, err
+	}
+	return &p, nil
+}
@@ -16,6 +16,8 @@ import (
 	"github.com/hibiken/asynq"
 
 	"github.com/dublyo/mailat/api/internal/config"
+	"github.com/dublyo/mailat/api/pkg/emailaddr"
+	"github.com/dublyo/mailat/api/pkg/listevent"
 )
 
 // WebhookHandler handles webhook delivery tasks
@@ -40,7 +42,7 @@ func NewWebhookHandler(db *sql.DB, cfg *config.Config) *WebhookHandler {
 func (h *WebhookHandler) HandleWebhookDeliver(ctx context.Context, task *asynq.Task) error {
 	payload, err := UnmarshalWebhookDeliverPayload(task.Payload())
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal payload: %w", err)
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
 	}
 
 	// Build webhook payload
@@ -54,13 +56,13 @@ func (h *WebhookHandler) HandleWebhookDeliver(ctx context.Context, task *asynq.T
 
 	jsonPayload, err := json.Marshal(webhookPayload)
 	if err != nil {
-		return fmt.Errorf("failed to marshal webhook payload: %w", err)
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to marshal webhook payload: %w", err))
 	}
 
 	// Create request
 	req, err := http.NewRequestWithContext(ctx, "POST", payload.URL, bytes.NewReader(jsonPayload))
 	if err != nil {
-		return fmt.Errorf("failed to create request: %w", err)
+		return permanentError(FailureValidation, "webhook_url", fmt.Errorf("failed to create request: %w", err))
 	}
 
 	// Set headers
@@ -106,18 +108,34 @@ func (h *WebhookHandler) HandleWebhookDeliver(ctx context.Context, task *asynq.T
 
 	// Return error to trigger retry if needed
 	if callStatus != "success" {
+		taskErr := classifyWebhookError(callStatusCode, fmt.Errorf("webhook delivery failed: %s", callError))
 		if payload.RetryCount >= payload.MaxRetries {
 			// Max retries exceeded, don't retry
-			fmt.Printf("Webhook delivery to %s failed after %d retries: %s\n",
-				payload.URL, payload.RetryCount, callError)
+			fmt.Printf("Webhook delivery to %s failed after %d retries: %v\n",
+				payload.URL, payload.RetryCount, taskErr)
 			return nil
 		}
-		return fmt.Errorf("webhook delivery failed: %s", callError)
+		return taskErr
 	}
 
 	return nil
 }
 
+// classifyWebhookError classifies a failed delivery by the endpoint's response.
+// Client errors other than timeouts and rate limits won't change on retry.
+func classifyWebhookError(statusCode int, err error) *TaskError {
+	switch {
+	case statusCode == 0:
+		return transientError(FailureProvider, "network", err)
+	case statusCode == http.StatusTooManyRequests:
+		return transientError(FailureQuota, "http_429", err)
+	case statusCode == http.StatusRequestTimeout || statusCode >= 500:
+		return transientError(FailureProvider, fmt.Sprintf("http_%d", statusCode), err)
+	default:
+		return permanentError(FailureProvider, fmt.Sprintf("http_%d", statusCode), err)
+	}
+}
+
 // computeSignature creates an HMAC-SHA256 signature for webhook verification
 func (h *WebhookHandler) computeSignature(timestamp string, payload []byte, secret string) string {
 	// Format: timestamp.payload
@@ -158,7 +176,7 @@ func NewBounceHandler(db *sql.DB, cfg *config.Config) *BounceHandler {
 func (h *BounceHandler) HandleBounceProcess(ctx context.Context, task *asynq.Task) error {
 	payload, err := UnmarshalBounceProcessPayload(task.Payload())
 	if err != nil {
-		return fmt.Errorf("failed to unmarshal payload: %w", err)
+		return permanentError(FailureValidation, "payload", fmt.Errorf("failed to unmarshal payload: %w", err))
 	}
 
 	// Update email status
@@ -167,7 +185,7 @@ func (h *BounceHandler) HandleBounceProcess(ctx context.Context, task *asynq.Tas
 		WHERE id = $1
 	`, payload.EmailID)
 	if err != nil {
-		return fmt.Errorf("failed to update email status: %w", err)
+		return transientError(FailureInternal, "database", fmt.Errorf("failed to update email status: %w", err))
 	}
 
 	// Record bounce event
@@ -184,20 +202,27 @@ func (h *BounceHandler) HandleBounceProcess(ctx context.Context, task *asynq.Tas
 
 	// For hard bounces, add to suppression list
 	if payload.BounceType == "hard" {
+		normalized := emailaddr.Normalize(payload.Recipient, emailaddr.LoadRules(ctx, h.db, payload.OrgID))
 		_, err = h.db.ExecContext(ctx, `
-			INSERT INTO suppressions (org_id, email, reason, source_type, source_id, created_at)
-			VALUES ($1, $2, 'hard_bounce', 'email', $3, NOW())
+			INSERT INTO suppressions (org_id, email, reason, source_type, source_id, normalized_email, created_at)
+			VALUES ($1, $2, 'hard_bounce', 'email', $3, $4, NOW())
 			ON CONFLICT (org_id, email) DO NOTHING
-		`, payload.OrgID, payload.Recipient, fmt.Sprintf("%d", payload.EmailID))
+		`, payload.OrgID, payload.Recipient, fmt.Sprintf("%d", payload.EmailID), normalized)
 		if err != nil {
 			fmt.Printf("Failed to add to suppression list: %v\n", err)
 		}
 
-		// Update contact status if exists
+		// Update contact status if exists, recording the churn on its lists
 		h.db.ExecContext(ctx, `
-			UPDATE contacts SET status = 'bounced', updated_at = NOW()
-			WHERE org_id = $1 AND email = $2
-		`, payload.OrgID, payload.Recipient)
+			WITH bounced AS (
+				UPDATE contacts SET status = 'bounced', updated_at = NOW()
+				WHERE org_id = $1 AND email = $2 AND status IS DISTINCT FROM 'bounced'
+				RETURNING id
+			)
+			INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+			SELECT $1, lc.list_id, lc.contact_id, $3, $4, NOW()
+			FROM bounced JOIN list_contacts lc ON lc.contact_id = bounced.id
+		`, payload.OrgID, payload.Recipient, listevent.Bounced, listevent.SourceProvider)
 	}
 
 	// Trigger webhooks for bounce event
@@ -3,6 +3,7 @@ package worker
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"fmt"
 	"net/url"
 	"time"
@@ -41,10 +42,14 @@ func parseRedisURL(redisURL string, fallbackPassword string) asynq.RedisClientOp
 
 // Worker manages the asynq server and handlers
 type Worker struct {
-	server *asynq.Server
-	mux    *asynq.ServeMux
-	db     *sql.DB
-	cfg    *config.Config
+	server         *asynq.Server
+	mux            *asynq.ServeMux
+	db             *sql.DB
+	cfg            *config.Config
+	batchProcessor BatchProcessor
+	composeSender  ComposeSender
+	filterRunner   FilterRunner
+	bulkRunner     InboxBulkRunner
 }
 
 // QueueClient is a client for enqueuing tasks
@@ -106,6 +111,30 @@ func NewWorker(db *sql.DB, cfg *config.Config) *Worker {
 	}
 }
 
+// SetBatchProcessor sets what sends the entries of transactional batches. Batch
+// tasks are not handled without one.
+func (w *Worker) SetBatchProcessor(p BatchProcessor) {
+	w.batchProcessor = p
+}
+
+// SetComposeSender sets what sends emails held for undo send once they're
+// due. Compose send tasks are not handled without one.
+func (w *Worker) SetComposeSender(s ComposeSender) {
+	w.composeSender = s
+}
+
+// SetFilterRunner sets what applies inbox filters to emails already received.
+// Filter run tasks are not handled without one.
+func (w *Worker) SetFilterRunner(r FilterRunner) {
+	w.filterRunner = r
+}
+
+// SetInboxBulkRunner sets what applies bulk operations to received emails.
+// Inbox bulk tasks are not handled without one.
+func (w *Worker) SetInboxBulkRunner(r InboxBulkRunner) {
+	w.bulkRunner = r
+}
+
 // RegisterHandlers registers all task handlers
 func (w *Worker) RegisterHandlers() {
 	// Create webhook trigger firer for n8n/Zapier integration
@@ -125,12 +154,41 @@ func (w *Worker) RegisterHandlers() {
 	w.mux.HandleFunc(TypeCampaignBatch, campaignHandler.HandleCampaignBatch)
 	w.mux.HandleFunc(TypeWebhookDeliver, webhookHandler.HandleWebhookDeliver)
 	w.mux.HandleFunc(TypeBounceProcess, bounceHandler.HandleBounceProcess)
+	w.mux.HandleFunc(TypeBackupRun, scheduledHandler.HandleBackupRun)
+	w.mux.HandleFunc(TypeEventExport, scheduledHandler.HandleEventExport)
+	w.mux.HandleFunc(TypeContactExport, scheduledHandler.HandleContactExport)
+	w.mux.HandleFunc(TypeMailboxExport, scheduledHandler.HandleMailboxExport)
+	w.mux.HandleFunc(TypeListHygieneRun, scheduledHandler.HandleListHygieneRun)
+	w.mux.HandleFunc(TypeContactBulk, scheduledHandler.HandleContactBulk)
+	w.mux.HandleFunc(TypeCRMSync, scheduledHandler.HandleCRMSync)
+	if w.batchProcessor != nil {
+		w.mux.HandleFunc(TypeEmailBatch, NewBatchHandler(w.batchProcessor).HandleEmailBatch)
+	}
+	if w.composeSender != nil {
+		w.mux.HandleFunc(TypeComposeSend, NewComposeSendHandler(w.composeSender).HandleComposeSend)
+	}
+	if w.filterRunner != nil {
+		w.mux.HandleFunc(TypeFilterRun, NewFilterRunHandler(w.filterRunner).HandleFilterRun)
+	}
+	if w.bulkRunner != nil {
+		w.mux.HandleFunc(TypeInboxBulk, NewInboxBulkHandler(w.bulkRunner).HandleInboxBulk)
+	}
 
 	// Register scheduled task handlers
 	w.mux.HandleFunc(TypeScheduledBlacklistCheck, scheduledHandler.HandleBlacklistCheck)
 	w.mux.HandleFunc(TypeScheduledWarmupAdvance, scheduledHandler.HandleWarmupAdvance)
 	w.mux.HandleFunc(TypeScheduledBounceCheck, scheduledHandler.HandleBounceCheck)
 	w.mux.HandleFunc(TypeScheduledAlertDigest, scheduledHandler.HandleAlertDigest)
+	w.mux.HandleFunc(TypeScheduledRetention, scheduledHandler.HandleRetention)
+	w.mux.HandleFunc(TypeScheduledBackup, scheduledHandler.HandleBackups)
+	w.mux.HandleFunc(TypeScheduledCampaignRecovery, scheduledHandler.HandleCampaignRecovery)
+	w.mux.HandleFunc(TypeScheduledSegmentRefresh, scheduledHandler.HandleSegmentRefresh)
+	w.mux.HandleFunc(TypeScheduledEngagementScore, scheduledHandler.HandleEngagementScores)
+	w.mux.HandleFunc(TypeScheduledListHygiene, scheduledHandler.HandleListHygiene)
+	w.mux.HandleFunc(TypeScheduledCRMSync, scheduledHandler.HandleScheduledCRMSync)
+	w.mux.HandleFunc(TypeScheduledAutomationSteps, scheduledHandler.HandleScheduledAutomationSteps)
+	w.mux.HandleFunc(TypeScheduledAutomationTriggers, scheduledHandler.HandleScheduledAutomationTriggers)
+	w.mux.HandleFunc(TypeScheduledInboxCounts, scheduledHandler.HandleInboxCounts)
 
 	fmt.Println("Registered task handlers:")
 	fmt.Printf("  - %s\n", TypeEmailSend)
@@ -138,10 +196,39 @@ func (w *Worker) RegisterHandlers() {
 	fmt.Printf("  - %s\n", TypeCampaignBatch)
 	fmt.Printf("  - %s\n", TypeWebhookDeliver)
 	fmt.Printf("  - %s\n", TypeBounceProcess)
+	fmt.Printf("  - %s\n", TypeBackupRun)
+	fmt.Printf("  - %s\n", TypeEventExport)
+	fmt.Printf("  - %s\n", TypeContactExport)
+	fmt.Printf("  - %s\n", TypeMailboxExport)
+	fmt.Printf("  - %s\n", TypeListHygieneRun)
+	fmt.Printf("  - %s\n", TypeContactBulk)
+	fmt.Printf("  - %s\n", TypeCRMSync)
+	if w.batchProcessor != nil {
+		fmt.Printf("  - %s\n", TypeEmailBatch)
+	}
+	if w.composeSender != nil {
+		fmt.Printf("  - %s\n", TypeComposeSend)
+	}
+	if w.filterRunner != nil {
+		fmt.Printf("  - %s\n", TypeFilterRun)
+	}
+	if w.bulkRunner != nil {
+		fmt.Printf("  - %s\n", TypeInboxBulk)
+	}
 	fmt.Printf("  - %s (scheduled)\n", TypeScheduledBlacklistCheck)
 	fmt.Printf("  - %s (scheduled)\n", TypeScheduledWarmupAdvance)
 	fmt.Printf("  - %s (scheduled)\n", TypeScheduledBounceCheck)
 	fmt.Printf("  - %s (scheduled)\n", TypeScheduledAlertDigest)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledRetention)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledBackup)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledCampaignRecovery)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledSegmentRefresh)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledEngagementScore)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledListHygiene)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledCRMSync)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledAutomationSteps)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledAutomationTriggers)
+	fmt.Printf("  - %s (scheduled)\n", TypeScheduledInboxCounts)
 }
 
 // Start starts the worker server
@@ -294,6 +381,184 @@ func (c *QueueClient) EnqueueCampaignBatch(payload *CampaignBatchPayload) (*asyn
 	)
 }
 
+// EnqueueBackupRun enqueues an on-demand org backup
+func (c *QueueClient) EnqueueBackupRun(payload *BackupRunPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeBackupRun, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(0), // A failed backup is recorded and can be requested again
+		asynq.Timeout(1*time.Hour),
+	)
+}
+
+// EnqueueListHygieneRun enqueues an on-demand list hygiene run
+func (c *QueueClient) EnqueueListHygieneRun(payload *ListHygieneRunPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeListHygieneRun, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(0), // A failed run is recorded and can be started again
+		asynq.Timeout(2*time.Hour),
+	)
+}
+
+// EnqueueContactBulk enqueues a contact bulk job
+func (c *QueueClient) EnqueueContactBulk(payload *ContactBulkPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeContactBulk, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(3), // A retried job resumes after its last committed batch
+		asynq.Timeout(2*time.Hour),
+	)
+}
+
+// EnqueueCRMSync enqueues an on-demand CRM sync run
+func (c *QueueClient) EnqueueCRMSync(payload *CRMSyncPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeCRMSync, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(0), // A failed run is recorded and the next one picks up where it stopped
+		asynq.Timeout(1*time.Hour),
+	)
+}
+
+// EnqueueEventExport enqueues a delivery event export
+func (c *QueueClient) EnqueueEventExport(payload *EventExportPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeEventExport, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(0), // A failed export is recorded and can be requested again
+		asynq.Timeout(1*time.Hour),
+	)
+}
+
+// EnqueueContactExport enqueues a contact export
+func (c *QueueClient) EnqueueContactExport(payload *ContactExportPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeContactExport, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(0), // A failed export is recorded and can be requested again
+		asynq.Timeout(1*time.Hour),
+	)
+}
+
+// EnqueueMailboxExport enqueues an export of an identity's mailbox
+func (c *QueueClient) EnqueueMailboxExport(payload *MailboxExportPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeMailboxExport, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(0),          // A failed export is recorded and can be requested again
+		asynq.Timeout(6*time.Hour), // Mailboxes can hold years of email
+	)
+}
+
+// EnqueueEmailBatch enqueues the sending of a transactional batch
+func (c *QueueClient) EnqueueEmailBatch(payload *EmailBatchPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeEmailBatch, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("default"),
+		asynq.MaxRetry(5), // Retries resume with the entries not yet sent
+		asynq.Timeout(30*time.Minute),
+	)
+}
+
+// EnqueueComposeSend enqueues an email held for undo send, to be sent once
+// its delay is up
+func (c *QueueClient) EnqueueComposeSend(payload *ComposeSendPayload, processAt time.Time) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeComposeSend, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("critical"),
+		asynq.MaxRetry(3), // The send is claimed first, so retries can't send twice
+		asynq.Timeout(5*time.Minute),
+		asynq.ProcessAt(processAt),
+	)
+}
+
+// EnqueueFilterRun enqueues an inbox filter run
+func (c *QueueClient) EnqueueFilterRun(payload *FilterRunPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeFilterRun, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(3), // Retries resume after the last batch that committed
+		asynq.Timeout(time.Hour),
+	)
+}
+
+// EnqueueInboxBulk enqueues a bulk inbox operation
+func (c *QueueClient) EnqueueInboxBulk(payload *InboxBulkPayload) (*asynq.TaskInfo, error) {
+	data, err := payload.Marshal()
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal payload: %w", err)
+	}
+
+	task := asynq.NewTask(TypeInboxBulk, data)
+
+	return c.client.Enqueue(task,
+		asynq.Queue("low"),
+		asynq.MaxRetry(3), // Retries resume after the last batch that committed
+		asynq.Timeout(time.Hour),
+	)
+}
+
 // GetQueueInfo returns information about queues
 func (c *QueueClient) GetQueueInfo() (map[string]*asynq.QueueInfo, error) {
 	inspector := asynq.NewInspector(c.redisOpt)
@@ -315,3 +580,77 @@ func (c *QueueClient) GetQueueInfo() (map[string]*asynq.QueueInfo, error) {
 
 	return result, nil
 }
+
+// failureScanLimit caps the retrying and archived tasks inspected per queue
+const failureScanLimit = 1000
+
+// QueueFailureStats counts an organization's failed tasks of one classification
+type QueueFailureStats struct {
+	Category  FailureCategory `json:"category"` // validation, provider, quota, internal, unclassified
+	Reason    string          `json:"reason"`
+	Retryable bool            `json:"retryable"`
+	Retrying  int             `json:"retrying"` // Waiting for another attempt
+	Archived  int             `json:"archived"` // Given up on
+}
+
+// GetFailureBreakdown groups an organization's retrying and archived tasks by the
+// classification of their last error
+func (c *QueueClient) GetFailureBreakdown(orgID int64) ([]QueueFailureStats, error) {
+	inspector := asynq.NewInspector(c.redisOpt)
+	defer inspector.Close()
+
+	queues, err := inspector.Queues()
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		category  FailureCategory
+		reason    string
+		retryable bool
+	}
+	counts := map[key]*QueueFailureStats{}
+	var order []key
+	count := func(tasks []*asynq.TaskInfo, archived bool) {
+		for _, t := range tasks {
+			var owner struct {
+				OrgID int64 `json:"orgId"`
+			}
+			if json.Unmarshal(t.Payload, &owner) != nil || owner.OrgID != orgID {
+				continue
+			}
+
+			category, reason, retryable, ok := ParseTaskError(t.LastErr)
+			if !ok {
+				category, reason, retryable = "unclassified", "", !archived
+			}
+			k := key{category, reason, retryable}
+			stats, exists := counts[k]
+			if !exists {
+				stats = &QueueFailureStats{Category: category, Reason: reason, Retryable: retryable}
+				counts[k] = stats
+				order = append(order, k)
+			}
+			if archived {
+				stats.Archived++
+			} else {
+				stats.Retrying++
+			}
+		}
+	}
+
+	for _, q := range queues {
+		if tasks, err := inspector.ListRetryTasks(q, asynq.PageSize(failureScanLimit)); err == nil {
+			count(tasks, false)
+		}
+		if tasks, err := inspector.ListArchivedTasks(q, asynq.PageSize(failureScanLimit)); err == nil {
+			count(tasks, true)
+		}
+	}
+
+	result := make([]QueueFailureStats, 0, len(order))
+	for _, k := range order {
+		result = append(result, *counts[k])
+	}
+	return result, nil
+}
@@ -0,0 +1,382 @@
+package amphtml
+
+import (
+	"fmt"
+	"io"
+	"net/url"
+	"sort"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// AMP for Email documents go out as a text/x-amp-html part next to the HTML one.
+// Mailbox providers drop the AMP part, and show the HTML, unless it passes the
+// AMP4Email spec, so Validate checks the rules that decide it: the required
+// markup, the allowed components and scripts, and the tags, attributes, URLs and
+// CSS email allows. Template tags like {{name}} are taken as text.
+
+// Limits of the AMP4Email spec
+const (
+	MaxSize      = 200 << 10 // Bytes of the AMP part
+	MaxCustomCSS = 75000     // Bytes of the <style amp-custom> stylesheet
+)
+
+const (
+	runtimeScript   = "https://cdn.ampproject.org/v0.js"
+	componentPrefix = "https://cdn.ampproject.org/v0/"
+)
+
+// components are the AMP components email allows, by the name of their script
+var components = map[string]bool{
+	"amp-accordion":      true,
+	"amp-anim":           true,
+	"amp-autocomplete":   true,
+	"amp-bind":           true,
+	"amp-carousel":       true,
+	"amp-fit-text":       true,
+	"amp-form":           true,
+	"amp-image-lightbox": true,
+	"amp-lightbox":       true,
+	"amp-list":           true,
+	"amp-mustache":       true,
+	"amp-selector":       true,
+	"amp-sidebar":        true,
+	"amp-timeago":        true,
+}
+
+// builtInElements need no component script
+var builtInElements = map[string]bool{"amp-img": true, "amp-layout": true}
+
+// elementScripts maps elements to the component script they come from, where the
+// names differ
+var elementScripts = map[string]string{"amp-state": "amp-bind"}
+
+// disallowedTags can't appear in AMP for Email, by what to use instead
+var disallowedTags = map[string]string{
+	"img":      "use amp-img",
+	"video":    "",
+	"audio":    "",
+	"iframe":   "",
+	"frame":    "",
+	"frameset": "",
+	"object":   "",
+	"embed":    "",
+	"applet":   "",
+	"base":     "",
+	"link":     "stylesheets go in <style amp-custom>",
+	"picture":  "use amp-img",
+	"canvas":   "",
+}
+
+// Problem is a rule a document breaks, at its line when known
+type Problem struct {
+	Line    int
+	Message string
+}
+
+func (p Problem) String() string {
+	if p.Line > 0 {
+		return fmt.Sprintf("line %d: %s", p.Line, p.Message)
+	}
+	return p.Message
+}
+
+type validator struct {
+	problems []Problem
+	line     int
+
+	amp4email    bool
+	runtime      bool
+	boilerplate  bool
+	charsetFirst bool
+	customStyles int
+	inHead       bool
+	headChildren int
+	scripts      map[string]bool // Component scripts included
+	used         map[string]int  // Components used, with the line of first use
+	styleKind    string          // Kind of the <style> being read
+	styleText    strings.Builder
+}
+
+// Validate checks an AMP for Email document and returns the problems it has,
+// ordered by line. A document without problems is valid.
+func Validate(doc string) []Problem {
+	v := &validator{line: 1, scripts: map[string]bool{}, used: map[string]int{}}
+	if len(doc) > MaxSize {
+		v.fail(0, "the AMP part is larger than %d KB", MaxSize>>10)
+		return v.problems
+	}
+	if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(doc)), "<!doctype html>") {
+		v.fail(1, "the document must start with <!doctype html>")
+	}
+
+	z := html.NewTokenizer(strings.NewReader(doc))
+	for {
+		tt := z.Next()
+		if tt == html.ErrorToken {
+			if z.Err() != io.EOF {
+				v.fail(v.line, "unreadable markup: %v", z.Err())
+			}
+			break
+		}
+		raw := z.Raw()
+		tok := z.Token()
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			v.startTag(tok)
+		case html.EndTagToken:
+			v.endTag(tok)
+		case html.TextToken:
+			if v.styleKind != "" {
+				v.styleText.WriteString(tok.Data)
+			}
+		}
+		v.line += strings.Count(string(raw), "\n")
+	}
+
+	if !v.amp4email {
+		v.fail(0, "the <html> tag must have the ⚡4email or amp4email attribute")
+	}
+	if !v.charsetFirst {
+		v.fail(0, `<meta charset="utf-8"> must be the first child of <head>`)
+	}
+	if !v.runtime {
+		v.fail(0, `<head> must include <script async src="%s"></script>`, runtimeScript)
+	}
+	if !v.boilerplate {
+		v.fail(0, "<head> must include <style amp4email-boilerplate>body{visibility:hidden}</style>")
+	}
+	for name, line := range v.used {
+		if !v.scripts[name] {
+			v.fail(line, "%s is used without its component script", name)
+		}
+	}
+
+	sort.SliceStable(v.problems, func(i, j int) bool { return v.problems[i].Line < v.problems[j].Line })
+	return v.problems
+}
+
+func (v *validator) fail(line int, format string, args ...any) {
+	v.problems = append(v.problems, Problem{Line: line, Message: fmt.Sprintf(format, args...)})
+}
+
+func attr(tok html.Token, name string) (string, bool) {
+	for _, a := range tok.Attr {
+		if a.Key == name {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+func (v *validator) startTag(tok html.Token) {
+	name := tok.Data
+	if v.inHead {
+		v.headChildren++
+	}
+
+	switch name {
+	case "html":
+		_, bolt := attr(tok, "⚡4email")
+		_, word := attr(tok, "amp4email")
+		v.amp4email = bolt || word
+	case "head":
+		v.inHead = true
+	case "meta":
+		if charset, ok := attr(tok, "charset"); ok {
+			if !strings.EqualFold(charset, "utf-8") {
+				v.fail(v.line, "the charset must be utf-8")
+			}
+			if v.inHead && v.headChildren == 1 {
+				v.charsetFirst = true
+			}
+		} else if metaName, _ := attr(tok, "name"); metaName != "viewport" {
+			v.fail(v.line, "only the charset and viewport <meta> tags are allowed")
+		}
+	case "script":
+		v.script(tok)
+	case "style":
+		v.styleTag(tok)
+	case "template":
+		if typ, _ := attr(tok, "type"); typ != "amp-mustache" {
+			v.fail(v.line, `<template> must have type="amp-mustache"`)
+		} else {
+			v.use("amp-mustache")
+		}
+	case "form":
+		if _, ok := attr(tok, "action"); ok {
+			v.fail(v.line, "forms must submit with action-xhr, not action")
+		}
+		v.use("amp-form")
+	default:
+		if instead, bad := disallowedTags[name]; bad {
+			if instead != "" {
+				v.fail(v.line, "<%s> isn't allowed in AMP for Email, %s", name, instead)
+			} else {
+				v.fail(v.line, "<%s> isn't allowed in AMP for Email", name)
+			}
+		}
+		if strings.HasPrefix(name, "amp-") && !builtInElements[name] {
+			component := name
+			if owner, ok := elementScripts[name]; ok {
+				component = owner
+			}
+			if !components[component] {
+				v.fail(v.line, "<%s> isn't an AMP for Email component", name)
+			} else {
+				v.use(component)
+			}
+		}
+	}
+
+	v.attributes(tok)
+}
+
+func (v *validator) endTag(tok html.Token) {
+	switch tok.Data {
+	case "head":
+		v.inHead = false
+	case "style":
+		v.checkStyle()
+	}
+}
+
+func (v *validator) use(component string) {
+	if _, seen := v.used[component]; !seen {
+		v.used[component] = v.line
+	}
+}
+
+// script allows the AMP runtime, email components and JSON data only
+func (v *validator) script(tok html.Token) {
+	if typ, _ := attr(tok, "type"); typ == "application/json" {
+		return
+	}
+	src, _ := attr(tok, "src")
+	if _, async := attr(tok, "async"); !async || src == "" {
+		v.fail(v.line, "scripts must be AMP scripts loaded with async")
+		return
+	}
+	if src == runtimeScript {
+		v.runtime = true
+		return
+	}
+
+	name, isElement := attr(tok, "custom-element")
+	if !isElement {
+		name, _ = attr(tok, "custom-template")
+	}
+	if name == "" || !components[name] {
+		v.fail(v.line, "script %s isn't an AMP for Email component", src)
+		return
+	}
+	if !strings.HasPrefix(src, componentPrefix+name+"-") || !strings.HasSuffix(src, ".js") {
+		v.fail(v.line, "the script of %s must load from %s", name, componentPrefix)
+		return
+	}
+	v.scripts[name] = true
+}
+
+func (v *validator) styleTag(tok html.Token) {
+	_, boilerplate := attr(tok, "amp4email-boilerplate")
+	_, custom := attr(tok, "amp-custom")
+	switch {
+	case boilerplate:
+		v.styleKind = "boilerplate"
+	case custom:
+		v.customStyles++
+		if v.customStyles > 1 {
+			v.fail(v.line, "only one <style amp-custom> is allowed")
+		}
+		if !v.inHead {
+			v.fail(v.line, "<style amp-custom> must be in <head>")
+		}
+		v.styleKind = "custom"
+	default:
+		v.fail(v.line, "<style> must be <style amp-custom> or the boilerplate")
+		v.styleKind = "other"
+	}
+	v.styleText.Reset()
+}
+
+func (v *validator) checkStyle() {
+	text := v.styleText.String()
+	switch v.styleKind {
+	case "boilerplate":
+		if strings.Join(strings.Fields(text), "") == "body{visibility:hidden}" {
+			v.boilerplate = true
+		} else {
+			v.fail(v.line, "the boilerplate style must be body{visibility:hidden}")
+		}
+	case "custom":
+		if len(text) > MaxCustomCSS {
+			v.fail(v.line, "<style amp-custom> is larger than %d bytes", MaxCustomCSS)
+		}
+		if strings.Contains(text, "!important") {
+			v.fail(v.line, "!important isn't allowed in CSS")
+		}
+	}
+	v.styleKind = ""
+}
+
+// attributes rejects event handlers and URLs email can't load
+func (v *validator) attributes(tok html.Token) {
+	for _, a := range tok.Attr {
+		key := strings.ToLower(a.Key)
+		switch {
+		case strings.HasPrefix(key, "on") && key != "on":
+			v.fail(v.line, "event handler %s isn't allowed, use the on attribute", a.Key)
+		case key == "href" || key == "src" || key == "action-xhr" || key == "srcset":
+			if tok.Data == "script" {
+				continue
+			}
+			if problem := checkURL(key, a.Val); problem != "" {
+				v.fail(v.line, "%s of <%s> %s", a.Key, tok.Data, problem)
+			}
+		case key == "style":
+			if strings.Contains(a.Val, "!important") {
+				v.fail(v.line, "!important isn't allowed in CSS")
+			}
+		}
+	}
+}
+
+// checkURL requires absolute https URLs, or mailto and tel links. URLs made by a
+// template tag are only known at send time.
+func checkURL(key, raw string) string {
+	raw = strings.TrimSpace(raw)
+	if raw == "" || strings.HasPrefix(raw, "{{") {
+		return ""
+	}
+	if key == "srcset" {
+		for _, candidate := range strings.Split(raw, ",") {
+			fields := strings.Fields(candidate)
+			if len(fields) > 0 {
+				if problem := checkURL("src", fields[0]); problem != "" {
+					return problem
+				}
+			}
+		}
+		return ""
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "isn't a valid URL"
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "https":
+		return ""
+	case "mailto", "tel":
+		if key == "href" {
+			return ""
+		}
+	case "":
+		if key == "href" && strings.HasPrefix(raw, "#") {
+			return ""
+		}
+		return "must be an absolute URL"
+	}
+	return "must be an https URL"
+}
@@ -0,0 +1,157 @@
+package apierror
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// Machine-readable error codes returned to API clients in the errorCode field
+const (
+	// Generic codes, derived from the HTTP status when no specific code applies
+	CodeInvalidRequest = "invalid_request"
+	CodeUnauthorized   = "unauthorized"
+	CodeForbidden      = "forbidden"
+	CodeNotFound       = "not_found"
+	CodeConflict       = "conflict"
+	CodeRateLimited    = "rate_limited"
+	CodeInternal       = "internal_error"
+
+	// CodeValidationFailed comes with field-level errors
+	CodeValidationFailed = "validation_failed"
+
+	// Transactional sending
+	CodeDomainNotVerified   = "domain_not_verified"
+	CodeDomainNotActive     = "domain_not_active"
+	CodeRecipientSuppressed = "recipient_suppressed"
+	CodeQuotaExceeded       = "quota_exceeded"
+	CodeTemplateNotFound    = "template_not_found"
+	CodeTemplateInvalid     = "template_invalid"
+	CodePartialNotFound     = "partial_not_found"
+	CodeVariablesInvalid    = "variables_invalid"
+	CodeContentBlocked      = "content_blocked"
+	CodeAPIKeyForbidden     = "api_key_forbidden"
+	CodeSenderPoolNotFound  = "sender_pool_not_found"
+	CodeAttachmentInvalid   = "attachment_invalid"
+	CodeBatchTooLarge       = "batch_too_large"
+	CodeBatchNotFound       = "batch_not_found"
+	CodeEmailNotFound       = "email_not_found"
+	CodeEmailNotCancelable  = "email_not_cancelable"
+	CodeDuplicateSend       = "duplicate_send"
+	CodeTestRecipientDenied = "test_recipient_not_allowed"
+
+	// Inbox compose
+	CodeConfirmationRequired = "confirmation_required"
+
+	// Inbox summaries and translations
+	CodeAssistUnavailable = "mail_assist_unavailable"
+
+	// Campaigns
+	CodePreviewUnavailable = "preview_service_unavailable"
+
+	// Contacts
+	CodeContactFieldNotFound = "contact_field_not_found"
+
+	// Signup forms
+	CodeFormNotFound     = "form_not_found"
+	CodeOriginNotAllowed = "origin_not_allowed"
+	CodeCaptchaFailed    = "captcha_failed"
+)
+
+// Coder is implemented by errors that carry an error code and HTTP status
+type Coder interface {
+	ErrorCode() string
+	HTTPStatus() int
+}
+
+// FieldError is a validation failure of one request field
+type FieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule,omitempty"`
+	Message string `json:"message"`
+}
+
+// FieldErrorer is implemented by errors that report invalid fields
+type FieldErrorer interface {
+	FieldErrors() []FieldError
+}
+
+// ValidationError reports invalid request fields found outside of request parsing
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	if len(e.Fields) == 0 {
+		return "validation failed"
+	}
+	first := e.Fields[0]
+	if len(e.Fields) == 1 {
+		return fmt.Sprintf("%s: %s", first.Field, first.Message)
+	}
+	return fmt.Sprintf("%d invalid fields, first %s: %s", len(e.Fields), first.Field, first.Message)
+}
+
+func (e *ValidationError) ErrorCode() string         { return CodeValidationFailed }
+func (e *ValidationError) HTTPStatus() int           { return http.StatusBadRequest }
+func (e *ValidationError) FieldErrors() []FieldError { return e.Fields }
+
+// Error is an error with a code clients can act on
+type Error struct {
+	Status  int
+	Code    string
+	Message string
+}
+
+// New creates an error with the given HTTP status and code
+func New(status int, code, message string) *Error {
+	return &Error{Status: status, Code: code, Message: message}
+}
+
+// Newf creates an error with a formatted message
+func Newf(status int, code, format string, args ...any) *Error {
+	return New(status, code, fmt.Sprintf(format, args...))
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// ErrorCode returns the machine-readable code
+func (e *Error) ErrorCode() string {
+	return e.Code
+}
+
+// HTTPStatus returns the status the error is answered with
+func (e *Error) HTTPStatus() int {
+	return e.Status
+}
+
+// From returns the status and code of an error. Errors without one are bad requests.
+func From(err error) (int, string) {
+	var coder Coder
+	if errors.As(err, &coder) {
+		return coder.HTTPStatus(), coder.ErrorCode()
+	}
+	return http.StatusBadRequest, CodeInvalidRequest
+}
+
+// CodeForStatus returns the generic code of an HTTP error status
+func CodeForStatus(status int) string {
+	switch status {
+	case http.StatusUnauthorized:
+		return CodeUnauthorized
+	case http.StatusForbidden:
+		return CodeForbidden
+	case http.StatusNotFound:
+		return CodeNotFound
+	case http.StatusConflict:
+		return CodeConflict
+	case http.StatusTooManyRequests:
+		return CodeRateLimited
+	}
+	if status >= 500 {
+		return CodeInternal
+	}
+	return CodeInvalidRequest
+}
@@ -0,0 +1,101 @@
+// Package automationgoal describes automation goals: what a contact enrolled in
+// an automation does that makes the automation a success for them. Contacts who
+// reach the goal leave the workflow early and count as conversions.
+package automationgoal
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/dublyo/mailat/api/pkg/contactevent"
+	"github.com/dublyo/mailat/api/pkg/listevent"
+)
+
+// Goal types
+const (
+	ClickedLink = "clicked_link" // Clicked a link in any email sent to the contact
+	Event       = "event"        // Recorded a custom event, like a purchase
+	JoinedList  = "joined_list"  // Joined a list
+)
+
+// Goal is what an automation's contacts are after, reached once they do it
+// after they were enrolled.
+//
+//	{"type": "clicked_link", "url": "/pricing"}
+//	{"type": "event", "event": "purchase"}
+//	{"type": "joined_list", "listId": "<uuid>"}
+type Goal struct {
+	Type   string `json:"type"`
+	URL    string `json:"url,omitempty"`    // Part of the clicked link's URL; empty counts any link
+	Event  string `json:"event,omitempty"`  // The custom event's name
+	ListID string `json:"listId,omitempty"` // The list's UUID
+}
+
+// Parse reads a goal as stored, nil when there's none
+func Parse(data []byte) (*Goal, error) {
+	if len(data) == 0 || string(data) == "null" {
+		return nil, nil
+	}
+	var g Goal
+	if err := json.Unmarshal(data, &g); err != nil {
+		return nil, fmt.Errorf("invalid goal: %w", err)
+	}
+	if g.Type == "" {
+		return nil, nil
+	}
+	return &g, g.Validate()
+}
+
+// Validate checks a goal has what its type needs
+func (g *Goal) Validate() error {
+	g.URL = strings.TrimSpace(g.URL)
+	g.Event = strings.TrimSpace(g.Event)
+	g.ListID = strings.TrimSpace(g.ListID)
+	switch g.Type {
+	case ClickedLink:
+		if len(g.URL) > 500 {
+			return fmt.Errorf("goal url can't be longer than 500 characters")
+		}
+	case Event:
+		if g.Event == "" {
+			return fmt.Errorf("goal event is required")
+		}
+		if err := contactevent.CheckName(g.Event); err != nil {
+			return fmt.Errorf("goal %w", err)
+		}
+	case JoinedList:
+		if g.ListID == "" {
+			return fmt.Errorf("goal listId is required")
+		}
+	default:
+		return fmt.Errorf("goal type must be clicked_link, event or joined_list")
+	}
+	return nil
+}
+
+// Where returns the SQL condition that the contact of an enrollment, with the
+// given alias, reached the goal since they were enrolled, and its argument,
+// numbered arg
+func (g *Goal) Where(alias string, arg int) (string, any) {
+	switch g.Type {
+	case ClickedLink:
+		return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM emails ge JOIN delivery_events gd ON gd.email_id = ge.id
+			WHERE ge.contact_id = %[1]s.contact_id AND gd.event_type = 'clicked' AND gd.occurred_at >= %[1]s.enrolled_at
+			AND ($%[2]d = '' OR gd.data->>'url' ILIKE '%%' || $%[2]d || '%%')
+		)`, alias, arg), g.URL
+	case Event:
+		return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM contact_events ge
+			WHERE ge.contact_id = %[1]s.contact_id AND ge.name = $%[2]d AND ge.occurred_at >= %[1]s.enrolled_at
+		)`, alias, arg), g.Event
+	case JoinedList:
+		return fmt.Sprintf(`EXISTS (
+			SELECT 1 FROM list_events ge JOIN lists gl ON gl.id = ge.list_id
+			WHERE ge.contact_id = %[1]s.contact_id AND gl.uuid::text = $%[2]d
+			AND ge.event = '%[3]s' AND ge.created_at >= %[1]s.enrolled_at
+		)`, alias, arg, listevent.Subscribed), g.ListID
+	}
+	return "false", nil
+}
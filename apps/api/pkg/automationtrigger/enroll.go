@@ -0,0 +1,77 @@
+package automationtrigger
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// MaxActiveLimit bounds the org's limit of automations a contact can be in at
+// once
+const MaxActiveLimit = 100
+
+// MaxReenrollCooldownHours bounds how long automations can wait before
+// enrolling a contact again
+const MaxReenrollCooldownHours = 365 * 24
+
+// Limits are the org's rules on how many automations a contact can be in. They
+// live in the org's settings.
+type Limits struct {
+	MaxActivePerContact int `json:"maxActivePerContact"` // Automations a contact can be in at once; 0 for no limit
+}
+
+// Validate checks the limits are in range
+func (l Limits) Validate() error {
+	if l.MaxActivePerContact < 0 || l.MaxActivePerContact > MaxActiveLimit {
+		return fmt.Errorf("maxActivePerContact must be between 0 and %d", MaxActiveLimit)
+	}
+	return nil
+}
+
+// LoadLimits reads the org's limits from its settings; orgs without any have no
+// limit
+func LoadLimits(ctx context.Context, db *sql.DB, orgID int64) Limits {
+	var limits Limits
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'automationLimits' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return limits
+	}
+	json.Unmarshal([]byte(raw.String), &limits)
+	if limits.Validate() != nil {
+		return Limits{}
+	}
+	return limits
+}
+
+// EnrollFilter is the SQL condition that a contact can be enrolled in an
+// automation, with the given alias: they didn't opt out of its subscription
+// topic and are in fewer automations than the org's limit. Automations
+// enrolled in by the same statement aren't counted against the limit.
+func EnrollFilter(alias, contactID string) string {
+	return OptOutFilter(alias, contactID) + fmt.Sprintf(` AND (
+			SELECT COUNT(*) FROM automation_enrollments le
+			WHERE le.contact_id = %[2]s AND le.status = 'active' AND le.automation_id <> %[1]s.id
+		) < (
+			SELECT COALESCE(NULLIF((o.settings->'automationLimits'->>'maxActivePerContact')::int, 0), 2147483647)
+			FROM organizations o WHERE o.id = %[1]s.org_id
+		)`, alias, contactID)
+}
+
+// OnConflict ends the statements that enroll contacts. Contacts already in an
+// automation aren't enrolled again, unless the automation allows
+// re-enrollment, their enrollment is over and its cooldown passed since they
+// were last enrolled: the enrollment then starts over.
+const OnConflict = `ON CONFLICT (automation_id, contact_id) DO UPDATE
+	SET status = 'active', step_index = 0, current_node_id = NULL, workflow_version = NULL, step_data = EXCLUDED.step_data,
+	    next_run_at = NULL, completed_at = NULL, converted_at = NULL, error_message = NULL, retry_count = 0,
+	    enrollment_count = COALESCE(automation_enrollments.enrollment_count, 1) + 1,
+	    enrolled_at = EXCLUDED.enrolled_at, updated_at = EXCLUDED.updated_at
+	WHERE automation_enrollments.status <> 'active' AND EXISTS (
+		SELECT 1 FROM automations ra
+		WHERE ra.id = automation_enrollments.automation_id AND ra.allow_reenrollment
+		AND automation_enrollments.enrolled_at <= NOW() - make_interval(hours => COALESCE(ra.reenroll_cooldown_hours, 0))
+	)`
@@ -0,0 +1,152 @@
+// Package automationtrigger describes what enrolls contacts in automations.
+// Custom events enroll their contact when the event is recorded; date and
+// received-email triggers are evaluated by the scheduler, which enrolls the
+// contacts whose date came up or who sent an email since it last looked.
+// Webhook triggers enroll the contact of each signed request posted to the
+// automation's trigger URL.
+package automationtrigger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/contactevent"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+)
+
+// Trigger types
+const (
+	ContactEvent  = contactevent.AutomationTrigger // A custom event the contact recorded
+	ContactDate   = "contact.date"                 // Days before or after a date of the contact
+	EmailReceived = "email.received"               // An email the contact sent to one of the org's identities
+)
+
+// MaxDays is how far before or after its date a date trigger can enroll
+const MaxDays = 365
+
+// MaxCatchUpDays is how many missed days a date trigger makes up for when the
+// scheduler didn't run
+const MaxCatchUpDays = 7
+
+// dateColumns are the contact columns date triggers can use
+var dateColumns = map[string]bool{
+	"created_at": true, "last_engaged_at": true, "consent_timestamp": true, "verified_at": true,
+}
+
+// Scheduled reports whether the scheduler evaluates a trigger type
+func Scheduled(triggerType string) bool {
+	return triggerType == ContactDate || triggerType == EmailReceived
+}
+
+// Validate checks the config of triggers that need one
+func Validate(triggerType string, config map[string]any) error {
+	switch triggerType {
+	case ContactEvent:
+		_, err := contactevent.TriggerEvent(config)
+		return err
+	case ContactDate:
+		_, err := ParseDate(config)
+		return err
+	case EmailReceived:
+		_, err := ParseEmail(config)
+		return err
+	case Webhook:
+		_, err := ParseWebhook(config)
+		return err
+	}
+	return nil
+}
+
+// DateTrigger enrolls contacts a number of days before or after a date: one of
+// their date columns or a custom attribute holding a YYYY-MM-DD date.
+//
+//	{"triggerType": "contact.date", "triggerConfig": {"field": "attributes.renewal_date", "days": 7, "when": "before"}}
+type DateTrigger struct {
+	Field string // A column like created_at, or attributes.<key>
+	Days  int
+	When  string // before, after or on
+}
+
+// ParseDate reads and checks a date trigger's config
+func ParseDate(config map[string]any) (*DateTrigger, error) {
+	d := &DateTrigger{When: "on"}
+	d.Field, _ = config["field"].(string)
+	if days, ok := config["days"].(float64); ok {
+		d.Days = int(days)
+	}
+	if when, ok := config["when"].(string); ok && when != "" {
+		d.When = when
+	}
+
+	if key, ok := strings.CutPrefix(d.Field, "attributes."); ok {
+		if !contactfield.ValidKey(key) {
+			return nil, fmt.Errorf("contact.date automations need a valid attribute key in triggerConfig.field")
+		}
+	} else if !dateColumns[d.Field] {
+		return nil, fmt.Errorf("contact.date automations need triggerConfig.field: created_at, last_engaged_at, consent_timestamp, verified_at or attributes.<key>")
+	}
+	switch d.When {
+	case "before", "after":
+		if d.Days < 1 || d.Days > MaxDays {
+			return nil, fmt.Errorf("triggerConfig.days must be between 1 and %d", MaxDays)
+		}
+	case "on":
+		d.Days = 0
+	default:
+		return nil, fmt.Errorf("triggerConfig.when must be before, after or on")
+	}
+	return d, nil
+}
+
+// Date returns the date contacts are enrolled for on a day: the day itself
+// moved by the trigger's days
+func (d *DateTrigger) Date(day time.Time) string {
+	switch d.When {
+	case "before":
+		day = day.AddDate(0, 0, d.Days)
+	case "after":
+		day = day.AddDate(0, 0, -d.Days)
+	}
+	return day.Format("2006-01-02")
+}
+
+// Where returns the SQL condition of contacts, with the given alias, whose date
+// is the given YYYY-MM-DD date, in UTC. Attributes compare as text, which
+// can't fail on values that aren't dates.
+func (d *DateTrigger) Where(alias, dateArg string) string {
+	if key, ok := strings.CutPrefix(d.Field, "attributes."); ok {
+		return fmt.Sprintf("LEFT(%s.attributes->>'%s', 10) = %s", alias, key, dateArg)
+	}
+	return fmt.Sprintf("(%s.%s AT TIME ZONE 'UTC')::date = %s::date", alias, d.Field, dateArg)
+}
+
+// EmailTrigger enrolls contacts who send an email to the org, optionally only
+// to one identity or with a subject containing some text.
+//
+//	{"triggerType": "email.received", "triggerConfig": {"identityId": "<uuid>", "subjectContains": "quote"}}
+type EmailTrigger struct {
+	IdentityID      string
+	SubjectContains string
+}
+
+// ParseEmail reads and checks a received-email trigger's config
+func ParseEmail(config map[string]any) (*EmailTrigger, error) {
+	e := &EmailTrigger{}
+	e.IdentityID, _ = config["identityId"].(string)
+	e.SubjectContains, _ = config["subjectContains"].(string)
+	e.IdentityID = strings.TrimSpace(e.IdentityID)
+	e.SubjectContains = strings.TrimSpace(e.SubjectContains)
+	if len(e.SubjectContains) > 200 {
+		return nil, fmt.Errorf("triggerConfig.subjectContains can't be longer than 200 characters")
+	}
+	return e, nil
+}
+
+// OptOutFilter is the SQL condition that an automation, with the given alias,
+// doesn't belong to a subscription topic the contact opted out of
+func OptOutFilter(alias, contactID string) string {
+	return fmt.Sprintf(`(%[1]s.topic_id IS NULL OR NOT EXISTS (
+			SELECT 1 FROM contact_topic_optouts ot WHERE ot.contact_id = %[2]s AND ot.topic_id = %[1]s.topic_id
+		))`, alias, contactID)
+}
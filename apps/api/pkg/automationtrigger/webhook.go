@@ -0,0 +1,121 @@
+package automationtrigger
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+)
+
+// Webhook is the trigger of automations that external systems trigger by
+// posting to the automation's trigger URL
+const Webhook = "webhook"
+
+// SignatureMaxAge is how old a signed trigger request can be
+const SignatureMaxAge = 5 * time.Minute
+
+// MaxPayloadSize bounds the body of a trigger request
+const MaxPayloadSize = 64 << 10
+
+// WebhookTrigger maps the JSON payload posted to an automation's trigger URL to
+// the contact it enrolls. Fields are dot paths into the payload, with array
+// indexes as numbers; the payload is kept as the enrollment's trigger data.
+//
+//	{"triggerType": "webhook", "triggerConfig": {"email": "customer.email", "firstName": "customer.name",
+//	 "attributes": {"plan": "order.items.0.plan"}, "createContact": true}}
+type WebhookTrigger struct {
+	Email         string            // Path of the contact's email; email when not set
+	FirstName     string            // Path of the contact's first name
+	LastName      string            // Path of the contact's last name
+	Attributes    map[string]string // Attribute key to the path of its value
+	CreateContact bool              // Creates contacts not found by email
+}
+
+// ParseWebhook reads and checks a webhook trigger's config
+func ParseWebhook(config map[string]any) (*WebhookTrigger, error) {
+	w := &WebhookTrigger{Email: "email"}
+	if email, _ := config["email"].(string); strings.TrimSpace(email) != "" {
+		w.Email = strings.TrimSpace(email)
+	}
+	w.FirstName, _ = config["firstName"].(string)
+	w.LastName, _ = config["lastName"].(string)
+	w.CreateContact, _ = config["createContact"].(bool)
+	if attributes, ok := config["attributes"].(map[string]any); ok {
+		w.Attributes = make(map[string]string, len(attributes))
+		for key, path := range attributes {
+			if !contactfield.ValidKey(key) {
+				return nil, fmt.Errorf("triggerConfig.attributes: %q isn't a valid attribute key", key)
+			}
+			p, _ := path.(string)
+			if strings.TrimSpace(p) == "" {
+				return nil, fmt.Errorf("triggerConfig.attributes.%s needs the path of its value", key)
+			}
+			w.Attributes[key] = strings.TrimSpace(p)
+		}
+	}
+	return w, nil
+}
+
+// Lookup returns the value at a dot path in a payload, nil when there's none
+func Lookup(payload any, path string) any {
+	v := payload
+	for _, part := range strings.Split(path, ".") {
+		switch node := v.(type) {
+		case map[string]any:
+			v = node[part]
+		case []any:
+			i, err := strconv.Atoi(part)
+			if err != nil || i < 0 || i >= len(node) {
+				return nil
+			}
+			v = node[i]
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// LookupString returns the text at a dot path in a payload: strings as they
+// are, numbers and booleans written out, "" for anything else
+func LookupString(payload any, path string) string {
+	if path == "" {
+		return ""
+	}
+	switch v := Lookup(payload, path).(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64, bool:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Sign returns the signature of a trigger request: the hex HMAC-SHA256, keyed
+// with the automation's secret, of its timestamp and body joined by a dot, as
+// outgoing webhooks are signed
+func Sign(secret, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "." + string(body)))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a trigger request's signature, and that its Unix timestamp is
+// at most SignatureMaxAge away from now
+func Verify(secret, timestamp, signature string, body []byte, now time.Time) bool {
+	unix, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	age := now.Sub(time.Unix(unix, 0))
+	if age > SignatureMaxAge || age < -SignatureMaxAge {
+		return false
+	}
+	signature = strings.TrimPrefix(signature, "sha256=")
+	return hmac.Equal([]byte(signature), []byte(Sign(secret, timestamp, body)))
+}
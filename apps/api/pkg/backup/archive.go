@@ -0,0 +1,148 @@
+package backup
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/crypto"
+)
+
+// ArchiveVersion is the format version written by Seal
+const ArchiveVersion = 1
+
+// Archive is a logical snapshot of an organization's marketing data. Rows keep
+// their original IDs so a restore can tell which ones have since been deleted.
+type Archive struct {
+	Version     int             `json:"version"`
+	OrgID       int64           `json:"orgId"`
+	CreatedAt   time.Time       `json:"createdAt"`
+	Contacts    []Contact       `json:"contacts"`
+	Lists       []List          `json:"lists"`
+	Memberships []Membership    `json:"memberships"`
+	Consent     []ConsentRecord `json:"consent"`
+}
+
+// Contact is a backed up contact
+type Contact struct {
+	ID               int64           `json:"id"`
+	UUID             string          `json:"uuid"`
+	Email            string          `json:"email"`
+	FirstName        string          `json:"firstName,omitempty"`
+	LastName         string          `json:"lastName,omitempty"`
+	Attributes       json.RawMessage `json:"attributes,omitempty"`
+	Status           string          `json:"status"`
+	ConsentSource    string          `json:"consentSource,omitempty"`
+	ConsentTimestamp *time.Time      `json:"consentTimestamp,omitempty"`
+	ConsentIP        string          `json:"consentIp,omitempty"`
+	ConsentUserAgent string          `json:"consentUserAgent,omitempty"`
+	LastEngagedAt    *time.Time      `json:"lastEngagedAt,omitempty"`
+	EngagementScore  float64         `json:"engagementScore"`
+	CreatedAt        time.Time       `json:"createdAt"`
+}
+
+// List is a backed up list
+type List struct {
+	ID           int             `json:"id"`
+	UUID         string          `json:"uuid"`
+	Name         string          `json:"name"`
+	Description  string          `json:"description,omitempty"`
+	Type         string          `json:"type"`
+	SegmentRules json.RawMessage `json:"segmentRules,omitempty"`
+	CreatedAt    time.Time       `json:"createdAt"`
+}
+
+// Membership is a contact's membership of a list
+type Membership struct {
+	ListID    int       `json:"listId"`
+	ContactID int64     `json:"contactId"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// ConsentRecord is a backed up consent audit entry
+type ConsentRecord struct {
+	ID        int64     `json:"id"`
+	ContactID int64     `json:"contactId"`
+	Action    string    `json:"action"`
+	Source    string    `json:"source"`
+	ListID    *int      `json:"listId,omitempty"`
+	IPAddress string    `json:"ipAddress,omitempty"`
+	UserAgent string    `json:"userAgent,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// Counts is the number of rows of each kind in an archive
+type Counts struct {
+	Contacts    int `json:"contacts"`
+	Lists       int `json:"lists"`
+	Memberships int `json:"memberships"`
+	Consent     int `json:"consent"`
+}
+
+// Counts returns the number of rows of each kind
+func (a *Archive) Counts() Counts {
+	return Counts{
+		Contacts:    len(a.Contacts),
+		Lists:       len(a.Lists),
+		Memberships: len(a.Memberships),
+		Consent:     len(a.Consent),
+	}
+}
+
+// Seal compresses and encrypts an archive
+func Seal(a *Archive, key string) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	if err := json.NewEncoder(gz).Encode(a); err != nil {
+		return nil, fmt.Errorf("failed to encode backup: %w", err)
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to compress backup: %w", err)
+	}
+
+	sealed, err := crypto.EncryptBytes(buf.Bytes(), key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encrypt backup: %w", err)
+	}
+	return sealed, nil
+}
+
+// Open decrypts and decompresses an archive sealed by Seal
+func Open(data []byte, key string) (*Archive, error) {
+	compressed, err := crypto.DecryptBytes(data, key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt backup: %w", err)
+	}
+
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+	defer gz.Close()
+
+	raw, err := io.ReadAll(gz)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decompress backup: %w", err)
+	}
+
+	var a Archive
+	if err := json.Unmarshal(raw, &a); err != nil {
+		return nil, fmt.Errorf("failed to decode backup: %w", err)
+	}
+	if a.Version != ArchiveVersion {
+		return nil, fmt.Errorf("unsupported backup version %d", a.Version)
+	}
+	return &a, nil
+}
+
+// Checksum returns the hex SHA-256 of a sealed archive
+func Checksum(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,52 @@
+package backup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+const (
+	// DefaultRetentionDays is how long backups are kept when the policy doesn't say
+	DefaultRetentionDays = 30
+	// MaxRetentionDays caps how long backups are kept
+	MaxRetentionDays = 365
+)
+
+// Policy controls the scheduled backups of an organization's contacts, lists and consent history
+type Policy struct {
+	Enabled       bool `json:"enabled"`       // Take a backup every night
+	RetentionDays int  `json:"retentionDays"` // Delete backups older than this, the newest completed backup is always kept
+}
+
+// Validate checks the retention window
+func (p Policy) Validate() error {
+	if p.RetentionDays < 1 || p.RetentionDays > MaxRetentionDays {
+		return fmt.Errorf("retentionDays must be between 1 and %d", MaxRetentionDays)
+	}
+	return nil
+}
+
+// Load reads the organization's backup policy from organizations.settings.
+// Organizations without a policy have scheduled backups turned off.
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	policy := Policy{RetentionDays: DefaultRetentionDays}
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'backups' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	if policy.RetentionDays <= 0 {
+		policy.RetentionDays = DefaultRetentionDays
+	}
+	return policy
+}
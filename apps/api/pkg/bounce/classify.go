@@ -0,0 +1,207 @@
+package bounce
+
+import (
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Class is the normalized category of a delivery failure
+type Class string
+
+const (
+	ClassHard        Class = "hard"         // Address does not exist or is permanently undeliverable
+	ClassSoft        Class = "soft"         // Transient failure, retry later
+	ClassBlock       Class = "block"        // Receiving server rejected the message (policy, content, blocklist)
+	ClassReputation  Class = "reputation"   // Rejected because of sender IP/domain reputation or authentication
+	ClassFullMailbox Class = "full_mailbox" // Recipient mailbox is over quota
+	ClassUnknown     Class = "unknown"
+)
+
+// Policy describes how the platform reacts to a class of bounce
+type Policy struct {
+	Retry      bool          // Whether the send should be retried
+	MaxRetries int           // Upper bound on retries for this class
+	BaseDelay  time.Duration // Initial backoff between retries
+	Suppress   bool          // Whether the recipient is added to the suppression list
+}
+
+// policies maps each class to its retry/suppression behavior
+var policies = map[Class]Policy{
+	ClassHard:        {Retry: false, Suppress: true},
+	ClassSoft:        {Retry: true, MaxRetries: 5, BaseDelay: time.Second},
+	ClassFullMailbox: {Retry: true, MaxRetries: 2, BaseDelay: 10 * time.Second},
+	ClassBlock:       {Retry: false, Suppress: false},
+	ClassReputation:  {Retry: false, Suppress: false},
+	ClassUnknown:     {Retry: true, MaxRetries: 2, BaseDelay: 5 * time.Second}, // Likely a network or provider hiccup
+}
+
+// PolicyFor returns the retry/suppression policy for a class
+func PolicyFor(class Class) Policy {
+	if p, ok := policies[class]; ok {
+		return p
+	}
+	return policies[ClassUnknown]
+}
+
+// Backoff returns the delay before the given retry attempt (1-based) for a class
+func (p Policy) Backoff(attempt int) time.Duration {
+	if attempt < 1 {
+		attempt = 1
+	}
+	return p.BaseDelay * time.Duration(1<<uint(attempt-1))
+}
+
+// enhancedStatusRe matches RFC 3463 enhanced status codes such as 5.1.1
+var enhancedStatusRe = regexp.MustCompile(`\b([245])\.(\d{1,3})\.(\d{1,3})\b`)
+
+// replyCodeRe matches a leading or embedded 3-digit SMTP reply code
+var replyCodeRe = regexp.MustCompile(`\b([245]\d\d)\b`)
+
+// leadingReplyCodeRe matches the reply code a response starts with
+var leadingReplyCodeRe = regexp.MustCompile(`^([245])\d\d\b`)
+
+// Keyword patterns checked against the lowercased diagnostic text, most specific first
+var (
+	fullMailboxPatterns = []string{
+		"mailbox full", "mailbox is full", "over quota", "quota exceeded", "exceeded storage",
+		"insufficient storage", "user is over", "mailbox size limit",
+	}
+	reputationPatterns = []string{
+		"reputation", "spamhaus", "barracuda", "blacklist", "blocklist", "listed at", "listed on",
+		"rbl", "dnsbl", "poor sender", "dmarc", "spf", "dkim", "not authenticated", "unauthenticated",
+	}
+	blockPatterns = []string{
+		"blocked", "block list", "rejected by policy", "policy", "spam", "content rejected",
+		"message rejected", "denied", "not allowed", "refused",
+	}
+	hardPatterns = []string{
+		"user unknown", "unknown user", "no such user", "mailbox not found", "mailbox unavailable",
+		"does not exist", "invalid address", "invalid recipient", "recipient address rejected",
+		"address rejected", "no mailbox", "account disabled", "account has been disabled", "domain not found",
+		"host not found", "no mx",
+	}
+	softPatterns = []string{
+		"timeout", "timed out", "try again", "temporar", "connection refused", "connection reset",
+		"service unavailable", "greylist", "rate limit", "too many",
+	}
+)
+
+// ClassifySES classifies an SES bounce using its type, subtype, and the recipient's
+// status and diagnostic code
+func ClassifySES(bounceType, bounceSubType, status, diagnosticCode string) Class {
+	switch bounceSubType {
+	case "MailboxFull":
+		return ClassFullMailbox
+	case "NoEmail", "Suppressed", "OnAccountSuppressionList":
+		return ClassHard
+	case "ContentRejected", "AttachmentRejected":
+		return ClassBlock
+	case "MessageTooLarge":
+		return ClassBlock
+	}
+
+	class := Classify(status + " " + diagnosticCode)
+	if class != ClassUnknown {
+		return class
+	}
+
+	switch bounceType {
+	case "Permanent":
+		return ClassHard
+	case "Transient":
+		return ClassSoft
+	}
+	return ClassUnknown
+}
+
+// Classify classifies a raw SMTP response or diagnostic string
+func Classify(diagnostic string) Class {
+	text := strings.ToLower(strings.TrimSpace(diagnostic))
+	if text == "" {
+		return ClassUnknown
+	}
+
+	// Enhanced status codes are the most precise signal when present
+	if m := enhancedStatusRe.FindStringSubmatch(text); m != nil {
+		if class := classifyEnhanced(m[1], m[2], m[3]); class != ClassUnknown {
+			return class
+		}
+	}
+
+	// A 4xx reply is transient whatever its text says
+	if m := leadingReplyCodeRe.FindStringSubmatch(text); m != nil && m[1] == "4" {
+		return ClassSoft
+	}
+
+	// Soft patterns go before block ones, so that "connection refused" isn't
+	// taken for a refused message
+	switch {
+	case containsAny(text, fullMailboxPatterns):
+		return ClassFullMailbox
+	case containsAny(text, reputationPatterns):
+		return ClassReputation
+	case containsAny(text, hardPatterns):
+		return ClassHard
+	case containsAny(text, softPatterns):
+		return ClassSoft
+	case containsAny(text, blockPatterns):
+		return ClassBlock
+	}
+
+	if m := replyCodeRe.FindStringSubmatch(text); m != nil {
+		switch m[1] {
+		case "452", "552":
+			return ClassFullMailbox
+		case "550", "551", "553":
+			return ClassHard
+		case "554":
+			return ClassBlock
+		}
+		if m[1][0] == '4' {
+			return ClassSoft
+		}
+	}
+
+	return ClassUnknown
+}
+
+// classifyEnhanced maps RFC 3463 class.subject.detail codes to a bounce class.
+// Codes of the 4 class are persistent transient failures, so they're soft
+// whatever their subject.
+func classifyEnhanced(class, subject, detail string) Class {
+	if class == "4" {
+		return ClassSoft
+	}
+
+	code := subject + "." + detail
+	switch code {
+	case "2.2":
+		return ClassFullMailbox
+	case "3.4":
+		return ClassBlock
+	case "7.1", "7.26", "7.27", "7.25", "7.23", "7.7":
+		return ClassReputation
+	case "1.1", "1.2", "1.3", "1.6", "1.10":
+		if class == "5" {
+			return ClassHard
+		}
+	case "2.1":
+		if class == "5" {
+			return ClassHard
+		}
+	case "7.0", "7.28", "6.0":
+		return ClassBlock
+	}
+	return ClassUnknown
+}
+
+// containsAny reports whether text contains any of the patterns
+func containsAny(text string, patterns []string) bool {
+	for _, p := range patterns {
+		if strings.Contains(text, p) {
+			return true
+		}
+	}
+	return false
+}
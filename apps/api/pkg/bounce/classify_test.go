@@ -0,0 +1,36 @@
+package bounce
+
+import "testing"
+
+func TestClassify(t *testing.T) {
+	tests := []struct {
+		diagnostic string
+		want       Class
+	}{
+		{"550 5.1.1 <user@example.com>: Recipient address rejected: User unknown", ClassHard},
+		{"552 5.2.2 Mailbox full", ClassFullMailbox},
+		{"550 5.7.1 Service unavailable; client host blocked using Spamhaus", ClassReputation},
+		{"554 5.7.0 Message rejected by policy", ClassBlock},
+		{"550 Message content rejected as spam", ClassBlock},
+		{"421 4.7.0 Try again later", ClassSoft},
+		{"451 4.7.1 Greylisted, please retry", ClassSoft},
+		{"450 Requested action not taken: policy temporarily refused", ClassSoft},
+		{"failed to connect: dial tcp 10.0.0.1:587: connect: connection refused", ClassSoft},
+		{"read tcp 10.0.0.1:41234->10.0.0.2:25: i/o timeout", ClassSoft},
+		{"connection reset by peer", ClassSoft},
+		{"EOF", ClassUnknown},
+		{"", ClassUnknown},
+	}
+	for _, tt := range tests {
+		if got := Classify(tt.diagnostic); got != tt.want {
+			t.Errorf("Classify(%q) = %s, want %s", tt.diagnostic, got, tt.want)
+		}
+	}
+}
+
+func TestPolicyForUnknownRetries(t *testing.T) {
+	p := PolicyFor(ClassUnknown)
+	if !p.Retry || p.MaxRetries == 0 || p.Suppress {
+		t.Errorf("unknown failures should be retried a few times without suppressing, got %+v", p)
+	}
+}
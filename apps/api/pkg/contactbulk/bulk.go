@@ -0,0 +1,166 @@
+// Package contactbulk describes operations applied to many of an org's
+// contacts at once, and the contacts they target: the members of a list or
+// segment, contacts matching inline segment rules or a search, or all of them.
+package contactbulk
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/segment"
+)
+
+// Operations
+const (
+	OpAddTag         = "add_tag"
+	OpRemoveTag      = "remove_tag"
+	OpSetStatus      = "set_status"
+	OpAddToList      = "add_to_list"
+	OpRemoveFromList = "remove_from_list"
+	OpMoveToList     = "move_to_list" // Out of FromListID into ListID
+	OpDelete         = "delete"
+)
+
+// BatchSize is how many contacts are changed in each transaction
+const BatchSize = 500
+
+// MaxTagLength is the longest tag a contact can have
+const MaxTagLength = 50
+
+var tagPattern = regexp.MustCompile(`^[A-Za-z0-9 _.:/-]+$`)
+
+// statuses are the statuses contacts can be set to. Erased contacts only come
+// from a GDPR erasure.
+var statuses = map[string]bool{
+	"active": true, "unsubscribed": true, "bounced": true, "complained": true, "quarantined": true,
+}
+
+// Spec is an operation and the contacts it applies to. List IDs are resolved
+// from their UUIDs when the job is created.
+type Spec struct {
+	Operation  string `json:"operation"`
+	Tag        string `json:"tag,omitempty"`
+	Status     string `json:"status,omitempty"`
+	ListID     int    `json:"listId,omitempty"`     // The list added to or removed from
+	FromListID int    `json:"fromListId,omitempty"` // The list moved out of
+	Target     Target `json:"target"`
+}
+
+// Target selects contacts. Its filters combine with AND; a target without any
+// must set All, so a missing filter never selects every contact by accident.
+type Target struct {
+	All    bool           `json:"all,omitempty"`
+	ListID int            `json:"listId,omitempty"` // Members of a list or segment
+	Rules  *segment.Rules `json:"rules,omitempty"`
+	Query  string         `json:"query,omitempty"` // Email or name contains
+	Status []string       `json:"status,omitempty"`
+}
+
+func (t Target) filtered() bool {
+	return t.ListID > 0 || t.Rules != nil || t.Query != "" || len(t.Status) > 0
+}
+
+// ValidTag reports whether a tag is 1 to MaxTagLength letters, digits, spaces
+// or _.:/-
+func ValidTag(tag string) bool {
+	return len(tag) <= MaxTagLength && tagPattern.MatchString(tag)
+}
+
+// Validate checks the operation's parameters and the target
+func (s *Spec) Validate() error {
+	s.Tag = strings.TrimSpace(s.Tag)
+	switch s.Operation {
+	case OpAddTag, OpRemoveTag:
+		if !ValidTag(s.Tag) {
+			return fmt.Errorf("tag must be up to %d letters, digits, spaces or _.:/-", MaxTagLength)
+		}
+	case OpSetStatus:
+		if !statuses[s.Status] {
+			return fmt.Errorf("status must be active, unsubscribed, bounced, complained or quarantined")
+		}
+	case OpAddToList, OpRemoveFromList:
+		if s.ListID <= 0 {
+			return fmt.Errorf("listId is required")
+		}
+	case OpMoveToList:
+		if s.ListID <= 0 || s.FromListID <= 0 {
+			return fmt.Errorf("listId and fromListId are required")
+		}
+		if s.ListID == s.FromListID {
+			return fmt.Errorf("contacts can't be moved to the list they're in")
+		}
+	case OpDelete:
+	default:
+		return fmt.Errorf("operation must be add_tag, remove_tag, set_status, add_to_list, remove_from_list, move_to_list or delete")
+	}
+
+	t := s.Target
+	if t.All == t.filtered() {
+		return fmt.Errorf("target must either set all or filter contacts by segment, rules, query or status")
+	}
+	if t.Rules != nil {
+		if err := t.Rules.Validate(0); err != nil {
+			return fmt.Errorf("invalid segment rules: %w", err)
+		}
+	}
+	return nil
+}
+
+// Lists returns the lists the operation changes the members of
+func (s *Spec) Lists() []int {
+	switch s.Operation {
+	case OpAddToList, OpRemoveFromList:
+		return []int{s.ListID}
+	case OpMoveToList:
+		return []int{s.ListID, s.FromListID}
+	}
+	return nil
+}
+
+// Where returns the SQL condition the targeted contacts, with the given alias,
+// match, with its arguments numbered from first on. Moves only target members
+// of the list they move out of, and erased contacts are only targeted by deletes.
+func (s *Spec) Where(alias string, first int) (string, []any) {
+	var parts []string
+	var args []any
+	arg := func(value any) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", first+len(args)-1)
+	}
+
+	member := func(listID int) string {
+		return fmt.Sprintf("EXISTS (SELECT 1 FROM list_contacts bl WHERE bl.contact_id = %s.id AND bl.list_id = %s)", alias, arg(listID))
+	}
+	// Erased contacts have nothing left to change and must not become active again
+	if s.Operation != OpDelete {
+		parts = append(parts, fmt.Sprintf("%s.status IS DISTINCT FROM 'erased'", alias))
+	}
+	if s.Operation == OpMoveToList {
+		parts = append(parts, member(s.FromListID))
+	}
+
+	t := s.Target
+	if t.ListID > 0 {
+		parts = append(parts, member(t.ListID))
+	}
+	if t.Query != "" {
+		pattern := arg("%" + t.Query + "%")
+		parts = append(parts, fmt.Sprintf("(%[1]s.email ILIKE %[2]s OR %[1]s.first_name ILIKE %[2]s OR %[1]s.last_name ILIKE %[2]s)", alias, pattern))
+	}
+	if len(t.Status) > 0 {
+		parts = append(parts, fmt.Sprintf("%s.status = ANY(%s)", alias, arg(pq.Array(t.Status))))
+	}
+	if t.Rules != nil {
+		where, ruleArgs := t.Rules.Compile(alias, first+len(args))
+		args = append(args, ruleArgs...)
+		parts = append(parts, where)
+	}
+
+	if len(parts) == 0 {
+		return "TRUE", nil
+	}
+	return "(" + strings.Join(parts, " AND ") + ")", args
+}
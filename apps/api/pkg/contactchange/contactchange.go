@@ -0,0 +1,110 @@
+// Package contactchange records the history of changes to contacts' fields and
+// custom attributes. A change is recorded by taking a snapshot of the contact,
+// changing it, then recording how it differs from the snapshot.
+package contactchange
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// Executor runs queries in a transaction or not
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// Source is what changed a contact
+type Source struct {
+	Source   string // api, import, form, bulk, crm or automation
+	SourceID string // The list, form, bulk job, CRM connection or automation it came from
+	UserID   int64  // 0 when no user made it
+}
+
+// Snapshot is a contact's tracked fields by name, with each custom attribute
+// as attributes.<key>
+type Snapshot map[string]any
+
+// Take returns a contact's tracked fields, to compare with them once the
+// contact was changed
+func Take(ctx context.Context, db Executor, contactID int64) (Snapshot, error) {
+	var email, firstName, lastName, status string
+	var attributesJSON []byte
+	err := db.QueryRowContext(ctx, `
+		SELECT email, COALESCE(first_name, ''), COALESCE(last_name, ''), COALESCE(status, ''), COALESCE(attributes, '{}')
+		FROM contacts WHERE id = $1
+	`, contactID).Scan(&email, &firstName, &lastName, &status, &attributesJSON)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get contact: %w", err)
+	}
+
+	snapshot := Snapshot{
+		"email":     email,
+		"firstName": firstName,
+		"lastName":  lastName,
+		"status":    status,
+	}
+	var attributes map[string]any
+	json.Unmarshal(attributesJSON, &attributes)
+	for key, value := range attributes {
+		snapshot["attributes."+key] = value
+	}
+	return snapshot, nil
+}
+
+// Record records how a contact's tracked fields changed since the before
+// snapshot and returns how many did
+func Record(ctx context.Context, db Executor, orgID, contactID int64, before Snapshot, source Source) (int, error) {
+	after, err := Take(ctx, db, contactID)
+	if err != nil {
+		return 0, err
+	}
+
+	fields := make([]string, 0, len(after))
+	for field := range after {
+		fields = append(fields, field)
+	}
+	for field := range before {
+		if _, ok := after[field]; !ok {
+			fields = append(fields, field)
+		}
+	}
+	sort.Strings(fields)
+
+	var userID *int64
+	if source.UserID != 0 {
+		userID = &source.UserID
+	}
+	changed := 0
+	for _, field := range fields {
+		oldValue, hadOld := before[field]
+		newValue, hasNew := after[field]
+		if hadOld == hasNew && reflect.DeepEqual(oldValue, newValue) {
+			continue
+		}
+		_, err := db.ExecContext(ctx, `
+			INSERT INTO contact_changes (org_id, contact_id, field, old_value, new_value, source, source_id, user_id, created_at)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''), $8, NOW())
+		`, orgID, contactID, field, value(oldValue, hadOld), value(newValue, hasNew),
+			source.Source, source.SourceID, userID)
+		if err != nil {
+			return changed, fmt.Errorf("failed to record contact change: %w", err)
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// value returns a field's value as stored in contact_changes, NULL when the
+// contact doesn't have it
+func value(v any, ok bool) []byte {
+	if !ok {
+		return nil
+	}
+	data, _ := json.Marshal(v)
+	return data
+}
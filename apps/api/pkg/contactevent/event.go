@@ -0,0 +1,64 @@
+// Package contactevent describes the custom events an org records against its
+// contacts, like a purchase or a login, which segments test and automations are
+// triggered by.
+package contactevent
+
+import (
+	"fmt"
+	"regexp"
+	"time"
+)
+
+// Limits of an event
+const (
+	MaxNameLength     = 100
+	MaxPropertiesSize = 16 << 10 // Bytes of the properties' JSON
+	MaxPastDays       = 365      // How far back an event's occurredAt can be
+	MaxFutureSkew     = 5 * time.Minute
+)
+
+// AutomationTrigger is the trigger type of automations that enroll a contact
+// when they record an event. The automation's trigger config names the event:
+//
+//	{"triggerType": "contact.event", "triggerConfig": {"event": "purchase"}}
+const AutomationTrigger = "contact.event"
+
+// TriggerWindow is how recent an event must be to trigger automations, so that
+// backfilling past events doesn't enroll their contacts
+const TriggerWindow = 24 * time.Hour
+
+var namePattern = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// ValidName reports whether an event name is 1 to MaxNameLength letters, digits
+// or _.:-
+func ValidName(name string) bool {
+	return len(name) <= MaxNameLength && namePattern.MatchString(name)
+}
+
+// CheckName returns why an event name isn't valid, or nil
+func CheckName(name string) error {
+	if !ValidName(name) {
+		return fmt.Errorf("event name must be up to %d letters, digits or _.:-", MaxNameLength)
+	}
+	return nil
+}
+
+// CheckOccurredAt rejects times too far in the past or in the future
+func CheckOccurredAt(at, now time.Time) error {
+	if at.After(now.Add(MaxFutureSkew)) {
+		return fmt.Errorf("occurredAt can't be in the future")
+	}
+	if at.Before(now.AddDate(0, 0, -MaxPastDays)) {
+		return fmt.Errorf("occurredAt can't be more than %d days ago", MaxPastDays)
+	}
+	return nil
+}
+
+// TriggerEvent returns the event an automation's trigger config names
+func TriggerEvent(config map[string]any) (string, error) {
+	name, _ := config["event"].(string)
+	if name == "" {
+		return "", fmt.Errorf("contact.event automations need the event in triggerConfig")
+	}
+	return name, CheckName(name)
+}
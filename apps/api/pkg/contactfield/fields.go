@@ -0,0 +1,245 @@
+// Package contactfield types the attributes of an org's contacts. An org defines
+// fields for the attribute keys it uses, and contacts written with those keys
+// must hold values of the field's type. Keys without a field stay free-form.
+package contactfield
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// Field types
+const (
+	TypeString  = "string"
+	TypeNumber  = "number"
+	TypeDate    = "date"    // Stored as 2006-01-02, or RFC 3339 when it has a time
+	TypeBoolean = "boolean" // Stored as true or false
+	TypeEnum    = "enum"    // One of the field's options
+)
+
+// Limits of a field
+const (
+	MaxOptions      = 100
+	MaxOptionLength = 100
+	MaxFields       = 200 // Fields of one org
+)
+
+// Field is a typed attribute key of an org's contacts
+type Field struct {
+	Key      string
+	Label    string
+	Type     string
+	Options  []string
+	Required bool
+}
+
+// operators are the segment operators attribute conditions on each type can use
+var operators = map[string][]string{
+	TypeString:  {"equals", "not_equals", "contains", "not_contains", "starts_with", "ends_with", "in", "not_in", "is_set", "is_not_set"},
+	TypeNumber:  {"equals", "not_equals", "greater_than", "less_than", "is_set", "is_not_set"},
+	TypeDate:    {"before", "after", "within_last_days", "more_than_days_ago", "within_next_days", "is_set", "is_not_set"},
+	TypeBoolean: {"equals", "not_equals", "is_set", "is_not_set"},
+	TypeEnum:    {"equals", "not_equals", "in", "not_in", "is_set", "is_not_set"},
+}
+
+var keyPattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+
+// ValidType reports whether t is a field type
+func ValidType(t string) bool {
+	_, ok := operators[t]
+	return ok
+}
+
+// ValidKey reports whether key can name a field. Keys are the ones segment
+// conditions can test.
+func ValidKey(key string) bool {
+	return keyPattern.MatchString(key)
+}
+
+// Operators returns the segment operators conditions on a field of the type
+// can use
+func Operators(t string) []string {
+	return operators[t]
+}
+
+// Allows reports whether conditions on the field can use the operator
+func (f *Field) Allows(operator string) bool {
+	for _, op := range operators[f.Type] {
+		if op == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// Validate checks the definition of a field
+func (f *Field) Validate() []apierror.FieldError {
+	var errs []apierror.FieldError
+	if !ValidKey(f.Key) {
+		errs = append(errs, apierror.FieldError{Field: "key", Rule: "field-key", Message: "key must be up to 100 letters, digits, dots, dashes or underscores"})
+	}
+	if strings.TrimSpace(f.Label) == "" {
+		errs = append(errs, apierror.FieldError{Field: "label", Rule: "required", Message: "label is required"})
+	}
+	if !ValidType(f.Type) {
+		errs = append(errs, apierror.FieldError{Field: "type", Rule: "field-type", Message: "type must be string, number, date, boolean or enum"})
+	}
+
+	switch {
+	case f.Type == TypeEnum && len(f.Options) == 0:
+		errs = append(errs, apierror.FieldError{Field: "options", Rule: "required", Message: "enum fields need options"})
+	case f.Type != TypeEnum && len(f.Options) > 0:
+		errs = append(errs, apierror.FieldError{Field: "options", Rule: "field-options", Message: "only enum fields have options"})
+	case len(f.Options) > MaxOptions:
+		errs = append(errs, apierror.FieldError{Field: "options", Rule: "field-options", Message: fmt.Sprintf("fields can't have more than %d options", MaxOptions)})
+	}
+	seen := map[string]bool{}
+	for _, option := range f.Options {
+		if option == "" || len(option) > MaxOptionLength {
+			errs = append(errs, apierror.FieldError{Field: "options", Rule: "field-options", Message: fmt.Sprintf("options must be 1 to %d characters", MaxOptionLength)})
+			break
+		}
+		if seen[strings.ToLower(option)] {
+			errs = append(errs, apierror.FieldError{Field: "options", Rule: "field-options", Message: fmt.Sprintf("option %q is listed twice", option)})
+			break
+		}
+		seen[strings.ToLower(option)] = true
+	}
+	return errs
+}
+
+// Normalize converts a value to how the field stores it. Imports carry every
+// value as text, so numbers, dates and booleans are also read from strings.
+func (f *Field) Normalize(value any) (any, error) {
+	text, isText := value.(string)
+	if isText {
+		text = strings.TrimSpace(text)
+	}
+
+	switch f.Type {
+	case TypeString:
+		switch v := value.(type) {
+		case string:
+			return v, nil
+		case float64:
+			return strconv.FormatFloat(v, 'f', -1, 64), nil
+		case bool:
+			return strconv.FormatBool(v), nil
+		}
+		return nil, fmt.Errorf("must be a string")
+	case TypeNumber:
+		if n, ok := value.(float64); ok {
+			return n, nil
+		}
+		if isText {
+			if n, err := strconv.ParseFloat(text, 64); err == nil && !math.IsInf(n, 0) && !math.IsNaN(n) {
+				return n, nil
+			}
+		}
+		return nil, fmt.Errorf("must be a number")
+	case TypeDate:
+		if isText {
+			if t, err := time.Parse("2006-01-02", text); err == nil {
+				return t.Format("2006-01-02"), nil
+			}
+			if t, err := time.Parse(time.RFC3339, text); err == nil {
+				return t.UTC().Format(time.RFC3339), nil
+			}
+		}
+		return nil, fmt.Errorf("must be a date like 2006-01-02")
+	case TypeBoolean:
+		if b, ok := value.(bool); ok {
+			return b, nil
+		}
+		if isText {
+			switch strings.ToLower(text) {
+			case "true", "yes", "1":
+				return true, nil
+			case "false", "no", "0":
+				return false, nil
+			}
+		}
+		return nil, fmt.Errorf("must be true or false")
+	case TypeEnum:
+		if isText {
+			for _, option := range f.Options {
+				if strings.EqualFold(option, text) {
+					return option, nil
+				}
+			}
+		}
+		return nil, fmt.Errorf("must be one of %s", strings.Join(f.Options, ", "))
+	}
+	return value, nil
+}
+
+// Validate checks the attributes of a contact against the org's fields and
+// returns them with the values of typed keys normalized. A null or empty value
+// leaves the key unset, which only required fields refuse.
+func Validate(fields []Field, attributes map[string]any) (map[string]any, error) {
+	normalized := make(map[string]any, len(attributes))
+	for key, value := range attributes {
+		normalized[key] = value
+	}
+
+	var errs []apierror.FieldError
+	for i := range fields {
+		f := &fields[i]
+		value, ok := attributes[f.Key]
+		if text, isText := value.(string); ok && (value == nil || isText && strings.TrimSpace(text) == "") {
+			ok = false
+			delete(normalized, f.Key)
+		}
+		if !ok {
+			if f.Required {
+				errs = append(errs, apierror.FieldError{Field: "attributes." + f.Key, Rule: "required", Message: f.Label + " is required"})
+			}
+			continue
+		}
+
+		v, err := f.Normalize(value)
+		if err != nil {
+			errs = append(errs, apierror.FieldError{Field: "attributes." + f.Key, Rule: f.Type, Message: fmt.Sprintf("%s %s", f.Label, err)})
+			continue
+		}
+		normalized[f.Key] = v
+	}
+
+	if len(errs) > 0 {
+		return nil, &apierror.ValidationError{Fields: errs}
+	}
+	return normalized, nil
+}
+
+// Load returns the fields the org defined, by key
+func Load(ctx context.Context, db *sql.DB, orgID int64) ([]Field, error) {
+	rows, err := db.QueryContext(ctx, `
+		SELECT key, label, type, COALESCE(options, '{}'), required
+		FROM contact_fields WHERE org_id = $1
+		ORDER BY key ASC
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load contact fields: %w", err)
+	}
+	defer rows.Close()
+
+	fields := []Field{}
+	for rows.Next() {
+		var f Field
+		if err := rows.Scan(&f.Key, &f.Label, &f.Type, pq.Array(&f.Options), &f.Required); err != nil {
+			return nil, fmt.Errorf("failed to scan contact field: %w", err)
+		}
+		fields = append(fields, f)
+	}
+	return fields, rows.Err()
+}
@@ -0,0 +1,69 @@
+package contentguard
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// Modes of the content guard
+const (
+	// ModeOff skips the checks
+	ModeOff = "off"
+	// ModeWarn accepts flagged emails and reports the findings to the sender
+	ModeWarn = "warn"
+	// ModeBlock rejects flagged emails
+	ModeBlock = "block"
+)
+
+// MaxSpamScoreLimit is the highest accepted spam score threshold
+const MaxSpamScoreLimit = 50
+
+// Policy controls which checks run on transactional emails before they are queued
+type Policy struct {
+	Mode               string  `json:"mode"`               // off, warn, block
+	MaxSpamScore       float64 `json:"maxSpamScore"`       // Flag emails scoring above this, 0 to skip spam scoring
+	CheckLinks         bool    `json:"checkLinks"`         // Request every link and flag the broken ones
+	RequireUnsubscribe bool    `json:"requireUnsubscribe"` // Flag emails without an unsubscribe link
+	MinTextPerImage    int     `json:"minTextPerImage"`    // Characters of text required per image, 0 to skip
+}
+
+// Enabled reports whether any check runs
+func (p Policy) Enabled() bool {
+	return p.Mode == ModeWarn || p.Mode == ModeBlock
+}
+
+// Validate checks the mode and thresholds
+func (p Policy) Validate() error {
+	if p.Mode != ModeOff && p.Mode != ModeWarn && p.Mode != ModeBlock {
+		return fmt.Errorf("mode must be %s, %s or %s", ModeOff, ModeWarn, ModeBlock)
+	}
+	if p.MaxSpamScore < 0 || p.MaxSpamScore > MaxSpamScoreLimit {
+		return fmt.Errorf("maxSpamScore must be between 0 and %d", MaxSpamScoreLimit)
+	}
+	if p.MinTextPerImage < 0 || p.MinTextPerImage > 10000 {
+		return fmt.Errorf("minTextPerImage must be between 0 and 10000")
+	}
+	return nil
+}
+
+// Load reads the organization's content guard policy from organizations.settings.
+// Organizations without a policy have the guard turned off.
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	policy := Policy{Mode: ModeOff}
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'contentGuard' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	return policy
+}
@@ -0,0 +1,408 @@
+// Package crm syncs contacts with an org's CRM. A connector pushes contacts'
+// status and engagement to the CRM and pulls the CRM's changes to their
+// names and attributes back, through the org's field mappings.
+package crm
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/apierror"
+)
+
+// Providers
+const (
+	ProviderHubSpot    = "hubspot"
+	ProviderSalesforce = "salesforce"
+)
+
+// Providers are the CRMs contacts can sync with
+var Providers = []string{ProviderHubSpot, ProviderSalesforce}
+
+// Mapping directions
+const (
+	DirectionPush = "push" // From contacts to the CRM
+	DirectionPull = "pull" // From the CRM to contacts
+	DirectionBoth = "both"
+)
+
+// Contact fields a mapping can name, besides attributes.<key>
+const (
+	FieldFirstName       = "firstName"
+	FieldLastName        = "lastName"
+	FieldStatus          = "status"
+	FieldEngagementScore = "engagementScore"
+	FieldLastEngagedAt   = "lastEngagedAt"
+)
+
+// AttributePrefix prefixes the fields of a contact's custom attributes
+const AttributePrefix = "attributes."
+
+// MaxMappings is how many field mappings a connection can have
+const MaxMappings = 50
+
+// pushOnly are the fields contacts get from sending, which a CRM can't set
+var pushOnly = map[string]bool{
+	FieldStatus:          true,
+	FieldEngagementScore: true,
+	FieldLastEngagedAt:   true,
+}
+
+var attributeKey = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+
+// FieldMapping maps a contact field to a CRM property
+type FieldMapping struct {
+	Field     string `json:"field"`
+	CRMField  string `json:"crmField"`
+	Direction string `json:"direction"`
+}
+
+// Pushes reports whether the mapping sends the contact field to the CRM
+func (m *FieldMapping) Pushes() bool {
+	return m.Direction == DirectionPush || m.Direction == DirectionBoth
+}
+
+// Pulls reports whether the mapping sets the contact field from the CRM
+func (m *FieldMapping) Pulls() bool {
+	return m.Direction == DirectionPull || m.Direction == DirectionBoth
+}
+
+// DefaultMappings are the mappings a new connection starts with
+func DefaultMappings(provider string) []FieldMapping {
+	switch provider {
+	case ProviderHubSpot:
+		return []FieldMapping{
+			{Field: FieldFirstName, CRMField: "firstname", Direction: DirectionPull},
+			{Field: FieldLastName, CRMField: "lastname", Direction: DirectionPull},
+		}
+	case ProviderSalesforce:
+		return []FieldMapping{
+			{Field: FieldFirstName, CRMField: "FirstName", Direction: DirectionPull},
+			{Field: FieldLastName, CRMField: "LastName", Direction: DirectionPull},
+		}
+	}
+	return []FieldMapping{}
+}
+
+// ValidateMappings checks a connection's field mappings. Status and engagement
+// can only be pushed, and a contact field or CRM property can be mapped once.
+func ValidateMappings(mappings []FieldMapping) error {
+	if len(mappings) > MaxMappings {
+		return apierror.Newf(http.StatusBadRequest, apierror.CodeInvalidRequest, "a connection can have at most %d field mappings", MaxMappings)
+	}
+
+	var errs []apierror.FieldError
+	fields := map[string]bool{}
+	crmFields := map[string]bool{}
+	for i, m := range mappings {
+		name := fmt.Sprintf("fieldMappings[%d]", i)
+		switch {
+		case m.Field == FieldFirstName, m.Field == FieldLastName, pushOnly[m.Field]:
+		case strings.HasPrefix(m.Field, AttributePrefix) && attributeKey.MatchString(strings.TrimPrefix(m.Field, AttributePrefix)):
+		default:
+			errs = append(errs, apierror.FieldError{Field: name + ".field", Rule: "field", Message: fmt.Sprintf("unknown contact field %q", m.Field)})
+			continue
+		}
+		if strings.TrimSpace(m.CRMField) == "" || len(m.CRMField) > 100 {
+			errs = append(errs, apierror.FieldError{Field: name + ".crmField", Rule: "required", Message: "CRM field is required"})
+			continue
+		}
+		switch m.Direction {
+		case DirectionPush, DirectionPull, DirectionBoth:
+		default:
+			errs = append(errs, apierror.FieldError{Field: name + ".direction", Rule: "direction", Message: "direction must be push, pull or both"})
+			continue
+		}
+		if pushOnly[m.Field] && m.Pulls() {
+			errs = append(errs, apierror.FieldError{Field: name + ".direction", Rule: "direction", Message: fmt.Sprintf("%s can only be pushed", m.Field)})
+			continue
+		}
+		if fields[m.Field] || crmFields[strings.ToLower(m.CRMField)] {
+			errs = append(errs, apierror.FieldError{Field: name, Rule: "unique", Message: fmt.Sprintf("%s is mapped more than once", m.Field)})
+			continue
+		}
+		fields[m.Field] = true
+		crmFields[strings.ToLower(m.CRMField)] = true
+	}
+
+	if len(errs) > 0 {
+		return &apierror.ValidationError{Fields: errs}
+	}
+	return nil
+}
+
+// Contact is a contact as a CRM has it, its properties keyed by CRM field
+type Contact struct {
+	ExternalID string
+	Email      string
+	Fields     map[string]string
+	UpdatedAt  time.Time
+}
+
+// Connector reads and writes the contacts of one CRM account
+type Connector interface {
+	// Push creates or updates the CRM's contacts with the same emails and
+	// returns how many it couldn't write
+	Push(ctx context.Context, contacts []Contact) (failed int, err error)
+	// Pull returns a page of the contacts changed since a time, oldest first,
+	// with their given fields, and the cursor of the next page if there is one
+	Pull(ctx context.Context, since time.Time, fields []string, cursor string) ([]Contact, string, error)
+}
+
+// Token is the OAuth token a connection calls its CRM with
+type Token struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresAt    time.Time
+	InstanceURL  string // Salesforce's API host of the account
+	AccountID    string
+}
+
+// NewConnector returns the connector of a provider, calling it with the token
+func NewConnector(provider string, token *Token) (Connector, error) {
+	client := &http.Client{Timeout: 30 * time.Second}
+	switch provider {
+	case ProviderHubSpot:
+		return &hubSpot{client: client, token: token.AccessToken}, nil
+	case ProviderSalesforce:
+		return &salesforce{client: client, token: token.AccessToken, instanceURL: token.InstanceURL}, nil
+	}
+	return nil, fmt.Errorf("unknown CRM provider %q", provider)
+}
+
+// APIError is a failed call to a CRM's API
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("CRM API returned %d: %s", e.StatusCode, e.Body)
+}
+
+// Unauthorized reports whether the CRM refused the access token, which a
+// refreshed token may fix
+func (e *APIError) Unauthorized() bool {
+	return e.StatusCode == http.StatusUnauthorized
+}
+
+// App is the OAuth app orgs connect their CRM account through
+type App struct {
+	Provider     string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	LoginURL     string // Salesforce's login host
+}
+
+// Configured reports whether the app has its credentials
+func (a *App) Configured() bool {
+	return a.ClientID != "" && a.ClientSecret != ""
+}
+
+// AuthURL returns where to send a user to authorize the app
+func (a *App) AuthURL(state string) string {
+	params := url.Values{
+		"client_id":    {a.ClientID},
+		"redirect_uri": {a.RedirectURL},
+		"state":        {state},
+	}
+	switch a.Provider {
+	case ProviderHubSpot:
+		params.Set("scope", "crm.objects.contacts.read crm.objects.contacts.write")
+		return "https://app.hubspot.com/oauth/authorize?" + params.Encode()
+	case ProviderSalesforce:
+		params.Set("response_type", "code")
+		params.Set("scope", "api refresh_token")
+		return strings.TrimRight(a.LoginURL, "/") + "/services/oauth2/authorize?" + params.Encode()
+	}
+	return ""
+}
+
+// Exchange trades an authorization code for a token
+func (a *App) Exchange(ctx context.Context, code string) (*Token, error) {
+	token, err := a.requestToken(ctx, url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {a.RedirectURL},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if a.Provider == ProviderHubSpot {
+		token.AccountID, err = a.hubSpotAccount(ctx, token.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return token, nil
+}
+
+// Refresh returns a new access token for a token. Its refresh token and
+// account carry over when the CRM doesn't send new ones.
+func (a *App) Refresh(ctx context.Context, token *Token) (*Token, error) {
+	refreshed, err := a.requestToken(ctx, url.Values{
+		"grant_type":    {"refresh_token"},
+		"refresh_token": {token.RefreshToken},
+	})
+	if err != nil {
+		return nil, err
+	}
+	if refreshed.RefreshToken == "" {
+		refreshed.RefreshToken = token.RefreshToken
+	}
+	if refreshed.InstanceURL == "" {
+		refreshed.InstanceURL = token.InstanceURL
+	}
+	if refreshed.AccountID == "" {
+		refreshed.AccountID = token.AccountID
+	}
+	return refreshed, nil
+}
+
+// requestToken calls the provider's token endpoint
+func (a *App) requestToken(ctx context.Context, params url.Values) (*Token, error) {
+	params.Set("client_id", a.ClientID)
+	params.Set("client_secret", a.ClientSecret)
+
+	endpoint := "https://api.hubapi.com/oauth/v1/token"
+	if a.Provider == ProviderSalesforce {
+		endpoint = strings.TrimRight(a.LoginURL, "/") + "/services/oauth2/token"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var result struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+		ExpiresIn    int    `json:"expires_in"`
+		InstanceURL  string `json:"instance_url"`
+		ID           string `json:"id"`
+	}
+	if err := do(&http.Client{Timeout: 30 * time.Second}, req, &result); err != nil {
+		return nil, fmt.Errorf("failed to get %s token: %w", a.Provider, err)
+	}
+
+	token := &Token{
+		AccessToken:  result.AccessToken,
+		RefreshToken: result.RefreshToken,
+		InstanceURL:  result.InstanceURL,
+	}
+	if result.ExpiresIn > 0 {
+		token.ExpiresAt = time.Now().Add(time.Duration(result.ExpiresIn) * time.Second)
+	} else {
+		// Salesforce doesn't say, and its sessions last two hours by default
+		token.ExpiresAt = time.Now().Add(time.Hour)
+	}
+	if a.Provider == ProviderSalesforce && result.ID != "" {
+		// The identity URL ends in /<org ID>/<user ID>
+		parts := strings.Split(strings.TrimRight(result.ID, "/"), "/")
+		if len(parts) >= 2 {
+			token.AccountID = parts[len(parts)-2]
+		}
+	}
+	return token, nil
+}
+
+// State is what an authorization carries to its callback
+type State struct {
+	OrgID    int64  `json:"o"`
+	UserID   int64  `json:"u"`
+	Provider string `json:"p"`
+	Expires  int64  `json:"e"`
+}
+
+// SignState returns the state of an authorization, signed so the callback
+// can trust it. It expires after 15 minutes.
+func SignState(state State, secret string) string {
+	state.Expires = time.Now().Add(15 * time.Minute).Unix()
+	data, _ := json.Marshal(state)
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + stateSignature(payload, secret)
+}
+
+// VerifyState returns the state an authorization carried, if it is signed and
+// not expired
+func VerifyState(signed, secret string) (*State, error) {
+	payload, signature, ok := strings.Cut(signed, ".")
+	if !ok || !hmac.Equal([]byte(signature), []byte(stateSignature(payload, secret))) {
+		return nil, fmt.Errorf("invalid state")
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, fmt.Errorf("invalid state")
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return nil, fmt.Errorf("invalid state")
+	}
+	if time.Now().Unix() > state.Expires {
+		return nil, fmt.Errorf("authorization expired, connect again")
+	}
+	return &state, nil
+}
+
+func stateSignature(payload, secret string) string {
+	mac := hmac.New(sha256.New, []byte("crm-oauth:"+secret))
+	mac.Write([]byte(payload))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// do sends a request and decodes its JSON response into result
+func do(client *http.Client, req *http.Request, result any) error {
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		if len(body) > 500 {
+			body = body[:500]
+		}
+		return &APIError{StatusCode: resp.StatusCode, Body: string(body)}
+	}
+	if result == nil || len(body) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, result)
+}
+
+// jsonRequest builds an API request with a bearer token and JSON body
+func jsonRequest(ctx context.Context, method, endpoint, token string, body any) (*http.Request, error) {
+	var reader io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, err
+		}
+		reader = bytes.NewReader(data)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, reader)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return req, nil
+}
@@ -0,0 +1,131 @@
+package crm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const hubSpotAPI = "https://api.hubapi.com"
+
+// hubSpotBatchSize is the most contacts a HubSpot batch call takes
+const hubSpotBatchSize = 100
+
+// hubSpot is the connector of a HubSpot portal
+type hubSpot struct {
+	client *http.Client
+	token  string
+}
+
+type hubSpotContact struct {
+	ID         string            `json:"id"`
+	Properties map[string]string `json:"properties"`
+	UpdatedAt  time.Time         `json:"updatedAt"`
+}
+
+// Push upserts contacts by email, a batch at a time
+func (h *hubSpot) Push(ctx context.Context, contacts []Contact) (int, error) {
+	failed := 0
+	for start := 0; start < len(contacts); start += hubSpotBatchSize {
+		end := min(start+hubSpotBatchSize, len(contacts))
+
+		inputs := make([]map[string]any, 0, end-start)
+		for _, c := range contacts[start:end] {
+			properties := map[string]string{"email": c.Email}
+			for field, value := range c.Fields {
+				properties[field] = value
+			}
+			inputs = append(inputs, map[string]any{
+				"id":         c.Email,
+				"idProperty": "email",
+				"properties": properties,
+			})
+		}
+
+		req, err := jsonRequest(ctx, http.MethodPost, hubSpotAPI+"/crm/v3/objects/contacts/batch/upsert", h.token,
+			map[string]any{"inputs": inputs})
+		if err != nil {
+			return failed, err
+		}
+		var result struct {
+			Results []hubSpotContact `json:"results"`
+		}
+		if err := do(h.client, req, &result); err != nil {
+			return failed, err
+		}
+		failed += end - start - len(result.Results)
+	}
+	return failed, nil
+}
+
+// Pull searches the contacts modified since a time, oldest first. HubSpot
+// pages a search with the after offset, which is the cursor.
+func (h *hubSpot) Pull(ctx context.Context, since time.Time, fields []string, cursor string) ([]Contact, string, error) {
+	properties := append([]string{"email", "lastmodifieddate"}, fields...)
+	search := map[string]any{
+		"filterGroups": []map[string]any{{
+			"filters": []map[string]any{{
+				"propertyName": "lastmodifieddate",
+				"operator":     "GTE",
+				"value":        strconv.FormatInt(since.UnixMilli(), 10),
+			}},
+		}},
+		"sorts":      []map[string]any{{"propertyName": "lastmodifieddate", "direction": "ASCENDING"}},
+		"properties": properties,
+		"limit":      hubSpotBatchSize,
+	}
+	if cursor != "" {
+		search["after"] = cursor
+	}
+
+	req, err := jsonRequest(ctx, http.MethodPost, hubSpotAPI+"/crm/v3/objects/contacts/search", h.token, search)
+	if err != nil {
+		return nil, "", err
+	}
+	var result struct {
+		Results []hubSpotContact `json:"results"`
+		Paging  struct {
+			Next struct {
+				After string `json:"after"`
+			} `json:"next"`
+		} `json:"paging"`
+	}
+	if err := do(h.client, req, &result); err != nil {
+		return nil, "", err
+	}
+
+	contacts := make([]Contact, 0, len(result.Results))
+	for _, r := range result.Results {
+		c := Contact{
+			ExternalID: r.ID,
+			Email:      strings.TrimSpace(r.Properties["email"]),
+			Fields:     map[string]string{},
+			UpdatedAt:  r.UpdatedAt,
+		}
+		for _, field := range fields {
+			if value, ok := r.Properties[field]; ok {
+				c.Fields[field] = value
+			}
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts, result.Paging.Next.After, nil
+}
+
+// hubSpotAccount returns the ID of the portal a token was issued for
+func (a *App) hubSpotAccount(ctx context.Context, accessToken string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hubSpotAPI+"/oauth/v1/access-tokens/"+accessToken, nil)
+	if err != nil {
+		return "", err
+	}
+	var result struct {
+		HubID int64 `json:"hub_id"`
+	}
+	if err := do(&http.Client{Timeout: 30 * time.Second}, req, &result); err != nil {
+		return "", fmt.Errorf("failed to get HubSpot account: %w", err)
+	}
+	return strconv.FormatInt(result.HubID, 10), nil
+}
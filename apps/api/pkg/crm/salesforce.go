@@ -0,0 +1,171 @@
+package crm
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const salesforceAPIVersion = "v59.0"
+
+// salesforceBatchSize is the most records a Salesforce composite call takes
+const salesforceBatchSize = 200
+
+// salesforce is the connector of a Salesforce org, which syncs its Contact
+// records
+type salesforce struct {
+	client      *http.Client
+	token       string
+	instanceURL string
+}
+
+type salesforceResult struct {
+	ID      string `json:"id"`
+	Success bool   `json:"success"`
+}
+
+// Push updates the Contact records with the contacts' emails and creates the
+// missing ones, a batch at a time. Salesforce requires a last name, so a new
+// record without one gets its email's.
+func (s *salesforce) Push(ctx context.Context, contacts []Contact) (int, error) {
+	failed := 0
+	for start := 0; start < len(contacts); start += salesforceBatchSize {
+		end := min(start+salesforceBatchSize, len(contacts))
+		batch := contacts[start:end]
+
+		emails := make([]string, 0, len(batch))
+		for _, c := range batch {
+			emails = append(emails, "'"+soqlEscape(c.Email)+"'")
+		}
+		records, err := s.query(ctx, fmt.Sprintf("SELECT Id, Email FROM Contact WHERE Email IN (%s)", strings.Join(emails, ",")))
+		if err != nil {
+			return failed, err
+		}
+		existing := map[string]string{}
+		for _, r := range records {
+			if email, ok := r["Email"].(string); ok {
+				existing[strings.ToLower(email)] = fmt.Sprint(r["Id"])
+			}
+		}
+
+		var updates, creates []map[string]any
+		for _, c := range batch {
+			record := map[string]any{"attributes": map[string]string{"type": "Contact"}}
+			for field, value := range c.Fields {
+				record[field] = value
+			}
+			if id, ok := existing[strings.ToLower(c.Email)]; ok {
+				record["Id"] = id
+				updates = append(updates, record)
+				continue
+			}
+			record["Email"] = c.Email
+			if record["LastName"] == nil || record["LastName"] == "" {
+				record["LastName"] = c.Email
+			}
+			creates = append(creates, record)
+		}
+
+		for _, call := range []struct {
+			method  string
+			records []map[string]any
+		}{{http.MethodPatch, updates}, {http.MethodPost, creates}} {
+			if len(call.records) == 0 {
+				continue
+			}
+			req, err := jsonRequest(ctx, call.method, s.endpoint("/composite/sobjects"), s.token,
+				map[string]any{"allOrNone": false, "records": call.records})
+			if err != nil {
+				return failed, err
+			}
+			var results []salesforceResult
+			if err := do(s.client, req, &results); err != nil {
+				return failed, err
+			}
+			for _, r := range results {
+				if !r.Success {
+					failed++
+				}
+			}
+		}
+	}
+	return failed, nil
+}
+
+// Pull queries the Contact records modified since a time, oldest first. The
+// cursor is the URL of the query's next records.
+func (s *salesforce) Pull(ctx context.Context, since time.Time, fields []string, cursor string) ([]Contact, string, error) {
+	endpoint := ""
+	if cursor != "" {
+		endpoint = strings.TrimRight(s.instanceURL, "/") + cursor
+	} else {
+		columns := []string{"Id", "Email", "LastModifiedDate"}
+		for _, field := range fields {
+			if field != "Id" && field != "Email" && field != "LastModifiedDate" {
+				columns = append(columns, field)
+			}
+		}
+		soql := fmt.Sprintf("SELECT %s FROM Contact WHERE LastModifiedDate >= %s AND Email != null ORDER BY LastModifiedDate ASC",
+			strings.Join(columns, ", "), since.UTC().Format("2006-01-02T15:04:05Z"))
+		endpoint = s.endpoint("/query?q=" + url.QueryEscape(soql))
+	}
+
+	req, err := jsonRequest(ctx, http.MethodGet, endpoint, s.token, nil)
+	if err != nil {
+		return nil, "", err
+	}
+	var result struct {
+		Records        []map[string]any `json:"records"`
+		NextRecordsURL string           `json:"nextRecordsUrl"`
+	}
+	if err := do(s.client, req, &result); err != nil {
+		return nil, "", err
+	}
+
+	contacts := make([]Contact, 0, len(result.Records))
+	for _, r := range result.Records {
+		email, _ := r["Email"].(string)
+		c := Contact{
+			ExternalID: fmt.Sprint(r["Id"]),
+			Email:      strings.TrimSpace(email),
+			Fields:     map[string]string{},
+		}
+		if modified, ok := r["LastModifiedDate"].(string); ok {
+			c.UpdatedAt, _ = time.Parse("2006-01-02T15:04:05.000-0700", modified)
+		}
+		for _, field := range fields {
+			if value, ok := r[field]; ok && value != nil {
+				c.Fields[field] = fmt.Sprint(value)
+			}
+		}
+		contacts = append(contacts, c)
+	}
+	return contacts, result.NextRecordsURL, nil
+}
+
+// query runs a SOQL query, returning its first page of records
+func (s *salesforce) query(ctx context.Context, soql string) ([]map[string]any, error) {
+	req, err := jsonRequest(ctx, http.MethodGet, s.endpoint("/query?q="+url.QueryEscape(soql)), s.token, nil)
+	if err != nil {
+		return nil, err
+	}
+	var result struct {
+		Records []map[string]any `json:"records"`
+	}
+	if err := do(s.client, req, &result); err != nil {
+		return nil, err
+	}
+	return result.Records, nil
+}
+
+func (s *salesforce) endpoint(path string) string {
+	return strings.TrimRight(s.instanceURL, "/") + "/services/data/" + salesforceAPIVersion + path
+}
+
+// soqlEscape escapes a value for a quoted SOQL string
+func soqlEscape(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value)
+}
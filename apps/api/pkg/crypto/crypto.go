@@ -89,3 +89,57 @@ func Decrypt(ciphertext, key string) (string, error) {
 
 	return string(plaintext), nil
 }
+
+// EncryptBytes encrypts data using AES-GCM with the given key. The nonce is
+// prepended to the returned ciphertext.
+func EncryptBytes(data []byte, key string) ([]byte, error) {
+	if key == "" {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(deriveKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// DecryptBytes decrypts data produced by EncryptBytes
+func DecryptBytes(data []byte, key string) ([]byte, error) {
+	if key == "" {
+		return nil, ErrInvalidKey
+	}
+
+	block, err := aes.NewCipher(deriveKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ErrDecryptionFailed
+	}
+
+	plaintext, err := gcm.Open(nil, data[:nonceSize], data[nonceSize:], nil)
+	if err != nil {
+		return nil, ErrDecryptionFailed
+	}
+
+	return plaintext, nil
+}
@@ -0,0 +1,96 @@
+package emailaddr
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"strings"
+)
+
+// Rules controls how recipient addresses are canonicalized before they are
+// compared against suppression lists or matched against bounces
+type Rules struct {
+	Lowercase      bool     `json:"lowercase"`
+	StripPlusTags  bool     `json:"stripPlusTags"`
+	StripGmailDots bool     `json:"stripGmailDots"`
+	TagSeparators  []string `json:"tagSeparators,omitempty"` // defaults to "+"
+}
+
+// gmailDomains are the domains where dots in the local part are ignored
+var gmailDomains = map[string]bool{
+	"gmail.com":      true,
+	"googlemail.com": true,
+}
+
+// DefaultRules returns the rules applied when an organization has not configured any
+func DefaultRules() Rules {
+	return Rules{
+		Lowercase:      true,
+		StripPlusTags:  true,
+		StripGmailDots: true,
+		TagSeparators:  []string{"+"},
+	}
+}
+
+// Normalize returns the canonical form of an email address under the given rules.
+// Addresses that cannot be parsed are returned trimmed (and lowercased if enabled).
+func Normalize(address string, rules Rules) string {
+	address = strings.TrimSpace(address)
+	// Strip display name wrappers such as "Alice <alice@example.com>"
+	if i := strings.LastIndex(address, "<"); i >= 0 {
+		if j := strings.LastIndex(address, ">"); j > i {
+			address = address[i+1 : j]
+		}
+	}
+	if rules.Lowercase {
+		address = strings.ToLower(address)
+	}
+
+	at := strings.LastIndex(address, "@")
+	if at <= 0 || at == len(address)-1 {
+		return address
+	}
+	local, domain := address[:at], strings.ToLower(address[at+1:])
+
+	if rules.StripPlusTags {
+		separators := rules.TagSeparators
+		if len(separators) == 0 {
+			separators = []string{"+"}
+		}
+		for _, sep := range separators {
+			if sep == "" {
+				continue
+			}
+			if i := strings.Index(local, sep); i > 0 {
+				local = local[:i]
+			}
+		}
+	}
+
+	if rules.StripGmailDots && gmailDomains[domain] {
+		local = strings.ReplaceAll(local, ".", "")
+		domain = "gmail.com"
+	}
+
+	return local + "@" + domain
+}
+
+// LoadRules reads the organization's normalization rules from organizations.settings,
+// falling back to DefaultRules when none are configured
+func LoadRules(ctx context.Context, db *sql.DB, orgID int64) Rules {
+	rules := DefaultRules()
+	if db == nil {
+		return rules
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'addressNormalization' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return rules
+	}
+
+	json.Unmarshal([]byte(raw.String), &rules)
+	return rules
+}
@@ -0,0 +1,103 @@
+package emailaddr
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// suppressionTables store a normalized_email beside each suppressed address
+var suppressionTables = []string{"suppression_list", "suppressions"}
+
+// renormalizeBatch caps the rows written by one update
+const renormalizeBatch = 1000
+
+// Renormalize recomputes the canonical addresses stored on an organization's
+// suppressions under its current rules. It runs when the rules change, so
+// entries stored under the old ones keep matching.
+func Renormalize(ctx context.Context, db *sql.DB, orgID int64) error {
+	return renormalize(ctx, db, orgID, false)
+}
+
+// BackfillNormalized fills in the canonical address of the suppressions that
+// have none, under each organization's rules
+func BackfillNormalized(ctx context.Context, db *sql.DB) error {
+	rows, err := db.QueryContext(ctx, `
+		SELECT org_id FROM suppression_list WHERE normalized_email IS NULL
+		UNION
+		SELECT org_id FROM suppressions WHERE normalized_email IS NULL
+	`)
+	if err != nil {
+		return fmt.Errorf("failed to find suppressions to normalize: %w", err)
+	}
+	var orgIDs []int64
+	for rows.Next() {
+		var orgID int64
+		if err := rows.Scan(&orgID); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to find suppressions to normalize: %w", err)
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to find suppressions to normalize: %w", err)
+	}
+
+	for _, orgID := range orgIDs {
+		if err := renormalize(ctx, db, orgID, true); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renormalize rewrites the canonical addresses of an organization's
+// suppressions that differ from their address under its rules, or only the
+// missing ones
+func renormalize(ctx context.Context, db *sql.DB, orgID int64, onlyMissing bool) error {
+	rules := LoadRules(ctx, db, orgID)
+	for _, table := range suppressionTables {
+		query := `SELECT id, email, COALESCE(normalized_email, '') FROM ` + table + ` WHERE org_id = $1`
+		if onlyMissing {
+			query += ` AND normalized_email IS NULL`
+		}
+		rows, err := db.QueryContext(ctx, query, orgID)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+		var ids []int64
+		var normalized []string
+		for rows.Next() {
+			var id int64
+			var email, current string
+			if err := rows.Scan(&id, &email, &current); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to read %s: %w", table, err)
+			}
+			if n := Normalize(email, rules); n != current || onlyMissing {
+				ids = append(ids, id)
+				normalized = append(normalized, n)
+			}
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("failed to read %s: %w", table, err)
+		}
+
+		for start := 0; start < len(ids); start += renormalizeBatch {
+			end := min(start+renormalizeBatch, len(ids))
+			_, err := db.ExecContext(ctx, `
+				UPDATE `+table+` t SET normalized_email = v.normalized
+				FROM unnest($1::bigint[], $2::text[]) AS v(id, normalized)
+				WHERE t.id = v.id
+			`, pq.Array(ids[start:end]), pq.Array(normalized[start:end]))
+			if err != nil {
+				return fmt.Errorf("failed to update %s: %w", table, err)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,98 @@
+package emailaddr
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Marketing sends skip the contacts on an organization's suppressions. An
+// entry also stops the aliases of its address, so the contacts' addresses are
+// compared in their canonical form under the organization's rules.
+
+// SuppressedContacts returns the IDs of the organization's active contacts
+// whose canonical address is on its suppressions. The result is never nil, so
+// it can be passed to SQL as an array.
+func SuppressedContacts(ctx context.Context, db *sql.DB, orgID int64) ([]int64, error) {
+	suppressed, err := suppressedAddresses(ctx, db, orgID, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := []int64{}
+	if len(suppressed) == 0 {
+		return ids, nil
+	}
+
+	rules := LoadRules(ctx, db, orgID)
+	rows, err := db.QueryContext(ctx, `
+		SELECT id, email FROM contacts WHERE org_id = $1 AND status = 'active'
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read contacts: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var id int64
+		var email string
+		if err := rows.Scan(&id, &email); err != nil {
+			return nil, fmt.Errorf("failed to read contacts: %w", err)
+		}
+		if suppressed[Normalize(email, rules)] {
+			ids = append(ids, id)
+		}
+	}
+	return ids, rows.Err()
+}
+
+// Suppressed reports which of the given addresses have their canonical form on
+// the organization's suppressions
+func Suppressed(ctx context.Context, db *sql.DB, orgID int64, emails []string) (map[string]bool, error) {
+	result := make(map[string]bool, len(emails))
+	if len(emails) == 0 {
+		return result, nil
+	}
+
+	rules := LoadRules(ctx, db, orgID)
+	normalized := make([]string, len(emails))
+	for i, email := range emails {
+		normalized[i] = Normalize(email, rules)
+	}
+	suppressed, err := suppressedAddresses(ctx, db, orgID, normalized)
+	if err != nil {
+		return nil, err
+	}
+	for i, email := range emails {
+		if suppressed[normalized[i]] {
+			result[email] = true
+		}
+	}
+	return result, nil
+}
+
+// suppressedAddresses returns the canonical addresses on the organization's
+// suppressions, or only those among the given ones when any are given
+func suppressedAddresses(ctx context.Context, db *sql.DB, orgID int64, only []string) (map[string]bool, error) {
+	query := `SELECT DISTINCT normalized_email FROM suppressions WHERE org_id = $1 AND normalized_email IS NOT NULL`
+	args := []any{orgID}
+	if only != nil {
+		query += ` AND normalized_email = ANY($2)`
+		args = append(args, pq.Array(only))
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read suppressions: %w", err)
+	}
+	defer rows.Close()
+
+	suppressed := map[string]bool{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return nil, fmt.Errorf("failed to read suppressions: %w", err)
+		}
+		suppressed[email] = true
+	}
+	return suppressed, rows.Err()
+}
@@ -0,0 +1,268 @@
+package emaildesign
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// A design is an email built from blocks, as saved by the drag-and-drop editor.
+// Render turns it into the HTML body of a template, so the editor and the API
+// produce the same markup. Text fields may hold template tags like {{firstName}},
+// which are left for the template engine.
+
+// Block types
+const (
+	BlockHeading = "heading"
+	BlockText    = "text"
+	BlockImage   = "image"
+	BlockButton  = "button"
+	BlockDivider = "divider"
+	BlockSpacer  = "spacer"
+	BlockColumns = "columns"
+	BlockHTML    = "html"
+)
+
+// Limits on the size of a design
+const (
+	MaxBlocks  = 500 // Blocks in a design, those in columns included
+	MaxColumns = 4   // Columns in a columns block
+	MinWidth   = 320
+	MaxWidth   = 1200
+	MaxSpacer  = 200 // Pixels of a spacer
+)
+
+// Defaults of the design settings
+const (
+	DefaultWidth           = 600
+	DefaultBackgroundColor = "#f4f4f5"
+	DefaultContentColor    = "#ffffff"
+	DefaultTextColor       = "#111827"
+	DefaultLinkColor       = "#4F46E5"
+	DefaultButtonColor     = "#4F46E5"
+	DefaultFontFamily      = "Arial, Helvetica, sans-serif"
+)
+
+// Design is an email made of blocks
+type Design struct {
+	Settings Settings `json:"settings"`
+	Blocks   []*Block `json:"blocks"`
+}
+
+// Settings apply to the whole email
+type Settings struct {
+	Width           int    `json:"width,omitempty"`           // Content width in pixels
+	BackgroundColor string `json:"backgroundColor,omitempty"` // Around the content
+	ContentColor    string `json:"contentColor,omitempty"`    // Behind the content
+	TextColor       string `json:"textColor,omitempty"`
+	LinkColor       string `json:"linkColor,omitempty"`
+	FontFamily      string `json:"fontFamily,omitempty"`
+}
+
+// Block is one row of the email. Which fields apply depends on its type.
+type Block struct {
+	Type      string    `json:"type"`
+	Text      string    `json:"text,omitempty"`      // heading
+	Level     int       `json:"level,omitempty"`     // heading, 1 to 3
+	HTML      string    `json:"html,omitempty"`      // text, html
+	Src       string    `json:"src,omitempty"`       // image
+	Alt       string    `json:"alt,omitempty"`       // image
+	Href      string    `json:"href,omitempty"`      // image, optional link
+	Width     int       `json:"width,omitempty"`     // image, pixels
+	Label     string    `json:"label,omitempty"`     // button
+	URL       string    `json:"url,omitempty"`       // button
+	Color     string    `json:"color,omitempty"`     // heading text, button background, divider line
+	TextColor string    `json:"textColor,omitempty"` // button
+	Height    int       `json:"height,omitempty"`    // spacer, pixels
+	Align     string    `json:"align,omitempty"`     // left, center or right
+	Columns   []*Column `json:"columns,omitempty"`   // columns
+}
+
+// Column is a column of a columns block
+type Column struct {
+	Blocks []*Block `json:"blocks"`
+}
+
+// Error is a design that doesn't validate, at the path of the offending field
+type Error struct {
+	Path    string
+	Message string
+}
+
+func (e *Error) Error() string {
+	if e.Path == "" {
+		return e.Message
+	}
+	return e.Path + ": " + e.Message
+}
+
+var hexColor = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+var fontFamily = regexp.MustCompile(`^[A-Za-z0-9 ,'-]+$`)
+
+// Parse decodes and checks a design
+func Parse(data []byte) (*Design, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	var d Design
+	if err := dec.Decode(&d); err != nil {
+		return nil, &Error{Message: fmt.Sprintf("invalid design: %v", err)}
+	}
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func (d *Design) check() error {
+	s := &d.Settings
+	if s.Width != 0 && (s.Width < MinWidth || s.Width > MaxWidth) {
+		return &Error{Path: "settings.width", Message: fmt.Sprintf("must be between %d and %d", MinWidth, MaxWidth)}
+	}
+	colors := []struct{ field, value string }{
+		{"backgroundColor", s.BackgroundColor},
+		{"contentColor", s.ContentColor},
+		{"textColor", s.TextColor},
+		{"linkColor", s.LinkColor},
+	}
+	for _, color := range colors {
+		if color.value != "" && !hexColor.MatchString(color.value) {
+			return &Error{Path: "settings." + color.field, Message: "must be a hex color like #1a2b3c"}
+		}
+	}
+	if s.FontFamily != "" && !fontFamily.MatchString(s.FontFamily) {
+		return &Error{Path: "settings.fontFamily", Message: "may only contain font names separated by commas"}
+	}
+
+	if len(d.Blocks) == 0 {
+		return &Error{Path: "blocks", Message: "a design needs at least one block"}
+	}
+	count := 0
+	return checkBlocks("blocks", d.Blocks, false, &count)
+}
+
+func checkBlocks(path string, blocks []*Block, inColumn bool, count *int) error {
+	for i, b := range blocks {
+		at := path + "." + strconv.Itoa(i)
+		if b == nil {
+			return &Error{Path: at, Message: "block is empty"}
+		}
+		*count++
+		if *count > MaxBlocks {
+			return &Error{Path: at, Message: fmt.Sprintf("a design can have at most %d blocks", MaxBlocks)}
+		}
+		if err := b.check(at, inColumn, count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (b *Block) check(path string, inColumn bool, count *int) error {
+	fail := func(field, message string) error {
+		return &Error{Path: path + "." + field, Message: message}
+	}
+
+	switch b.Align {
+	case "", "left", "center", "right":
+	default:
+		return fail("align", "must be left, center or right")
+	}
+	if b.Color != "" && !hexColor.MatchString(b.Color) {
+		return fail("color", "must be a hex color like #1a2b3c")
+	}
+	if b.TextColor != "" && !hexColor.MatchString(b.TextColor) {
+		return fail("textColor", "must be a hex color like #1a2b3c")
+	}
+
+	switch b.Type {
+	case BlockHeading:
+		if strings.TrimSpace(b.Text) == "" {
+			return fail("text", "is required")
+		}
+		if b.Level < 0 || b.Level > 3 {
+			return fail("level", "must be 1, 2 or 3")
+		}
+	case BlockText, BlockHTML:
+		if strings.TrimSpace(b.HTML) == "" {
+			return fail("html", "is required")
+		}
+	case BlockImage:
+		if b.Src == "" {
+			return fail("src", "is required")
+		}
+		if !validURL(b.Src, "http", "https") {
+			return fail("src", "must be an http or https URL")
+		}
+		if b.Href != "" && !validURL(b.Href, linkSchemes...) {
+			return fail("href", "must be an http, https, mailto or tel URL")
+		}
+		if b.Width < 0 || b.Width > MaxWidth {
+			return fail("width", fmt.Sprintf("must be between 1 and %d", MaxWidth))
+		}
+	case BlockButton:
+		if strings.TrimSpace(b.Label) == "" {
+			return fail("label", "is required")
+		}
+		if b.URL == "" {
+			return fail("url", "is required")
+		}
+		if !validURL(b.URL, linkSchemes...) {
+			return fail("url", "must be an http, https, mailto or tel URL")
+		}
+	case BlockDivider:
+	case BlockSpacer:
+		if b.Height < 0 || b.Height > MaxSpacer {
+			return fail("height", fmt.Sprintf("must be between 1 and %d", MaxSpacer))
+		}
+	case BlockColumns:
+		if inColumn {
+			return fail("type", "columns can't be nested")
+		}
+		if len(b.Columns) < 2 || len(b.Columns) > MaxColumns {
+			return fail("columns", fmt.Sprintf("must have 2 to %d columns", MaxColumns))
+		}
+		for i, c := range b.Columns {
+			if c == nil {
+				return fail("columns."+strconv.Itoa(i), "column is empty")
+			}
+			if err := checkBlocks(path+".columns."+strconv.Itoa(i)+".blocks", c.Blocks, true, count); err != nil {
+				return err
+			}
+		}
+	case "":
+		return fail("type", "is required")
+	default:
+		return fail("type", fmt.Sprintf("unknown block type %q", b.Type))
+	}
+	return nil
+}
+
+var linkSchemes = []string{"http", "https", "mailto", "tel"}
+
+// validURL accepts URLs with one of the schemes, and URLs made by a template tag,
+// which are only known at send time
+func validURL(raw string, schemes ...string) bool {
+	raw = strings.TrimSpace(raw)
+	if strings.HasPrefix(raw, "{{") {
+		return true
+	}
+	u, err := url.Parse(raw)
+	if err != nil {
+		return false
+	}
+	scheme := strings.ToLower(u.Scheme)
+	for _, allowed := range schemes {
+		if scheme != allowed {
+			continue
+		}
+		if scheme == "http" || scheme == "https" {
+			return u.Host != ""
+		}
+		return u.Opaque != ""
+	}
+	return false
+}
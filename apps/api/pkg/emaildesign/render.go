@@ -0,0 +1,144 @@
+package emaildesign
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var headingSizes = map[int]int{1: 28, 2: 22, 3: 18}
+
+// Render renders a design to a complete HTML document made of tables, which
+// email clients lay out consistently
+func Render(d *Design) string {
+	s := d.Settings
+	width := or(s.Width, DefaultWidth)
+	background := orString(s.BackgroundColor, DefaultBackgroundColor)
+	content := orString(s.ContentColor, DefaultContentColor)
+	text := orString(s.TextColor, DefaultTextColor)
+	link := orString(s.LinkColor, DefaultLinkColor)
+	font := orString(s.FontFamily, DefaultFontFamily)
+
+	var b strings.Builder
+	b.WriteString(`<!DOCTYPE html>` + "\n")
+	b.WriteString(`<html><head><meta charset="utf-8"><meta name="viewport" content="width=device-width, initial-scale=1">`)
+	fmt.Fprintf(&b, `<style>a{color:%s}img{border:0;outline:none;text-decoration:none}</style></head>`+"\n", link)
+	fmt.Fprintf(&b, `<body style="margin:0;padding:0;background-color:%s">`+"\n", background)
+	fmt.Fprintf(&b, `<table role="presentation" width="100%%" border="0" cellpadding="0" cellspacing="0" style="background-color:%s"><tr><td align="center" style="padding:24px 0">`+"\n", background)
+	fmt.Fprintf(&b, `<table role="presentation" width="%d" border="0" cellpadding="0" cellspacing="0" style="width:%dpx;max-width:100%%;background-color:%s;font-family:%s;color:%s">`+"\n",
+		width, width, content, escape(font), text)
+	renderBlocks(&b, d.Blocks, width-48)
+	b.WriteString("</table>\n</td></tr></table>\n</body></html>\n")
+	return b.String()
+}
+
+// renderBlocks writes each block as a table row. width is the space the blocks have.
+func renderBlocks(b *strings.Builder, blocks []*Block, width int) {
+	for _, block := range blocks {
+		padding := "8px 24px"
+		if block.Type == BlockSpacer || block.Type == BlockColumns {
+			padding = "0 24px"
+		}
+		fmt.Fprintf(b, `<tr><td align="%s" style="padding:%s">`, orString(block.Align, "left"), padding)
+		renderBlock(b, block, width)
+		b.WriteString("</td></tr>\n")
+	}
+}
+
+func renderBlock(b *strings.Builder, block *Block, width int) {
+	switch block.Type {
+	case BlockHeading:
+		level := or(block.Level, 1)
+		color := ""
+		if block.Color != "" {
+			color = ";color:" + block.Color
+		}
+		fmt.Fprintf(b, `<h%d style="margin:0;font-size:%dpx;line-height:1.3;font-weight:bold%s">%s</h%d>`,
+			level, headingSizes[level], color, escape(block.Text), level)
+	case BlockText:
+		fmt.Fprintf(b, `<div style="font-size:16px;line-height:1.5">%s</div>`, block.HTML)
+	case BlockHTML:
+		b.WriteString(block.HTML)
+	case BlockImage:
+		imageWidth := width
+		if block.Width > 0 && block.Width < width {
+			imageWidth = block.Width
+		}
+		img := fmt.Sprintf(`<img src="%s" alt="%s" width="%d" style="display:inline-block;width:%dpx;max-width:100%%;height:auto">`,
+			escape(block.Src), escape(block.Alt), imageWidth, imageWidth)
+		if block.Href != "" {
+			img = fmt.Sprintf(`<a href="%s" target="_blank">%s</a>`, escape(block.Href), img)
+		}
+		b.WriteString(img)
+	case BlockButton:
+		fmt.Fprintf(b, `<table role="presentation" border="0" cellpadding="0" cellspacing="0" style="display:inline-table"><tr>`+
+			`<td align="center" bgcolor="%s" style="border-radius:6px">`+
+			`<a href="%s" target="_blank" style="display:inline-block;padding:12px 24px;font-size:16px;font-weight:bold;`+
+			`color:%s;text-decoration:none;border-radius:6px">%s</a></td></tr></table>`,
+			orString(block.Color, DefaultButtonColor), escape(block.URL), orString(block.TextColor, "#ffffff"), escape(block.Label))
+	case BlockDivider:
+		fmt.Fprintf(b, `<table role="presentation" width="100%%" border="0" cellpadding="0" cellspacing="0"><tr>`+
+			`<td style="border-top:1px solid %s;font-size:0;line-height:0">&nbsp;</td></tr></table>`, orString(block.Color, "#e5e7eb"))
+	case BlockSpacer:
+		height := or(block.Height, 24)
+		fmt.Fprintf(b, `<div style="height:%dpx;line-height:%dpx;font-size:0">&nbsp;</div>`, height, height)
+	case BlockColumns:
+		columnWidth := width / len(block.Columns)
+		percent := strconv.Itoa(100 / len(block.Columns))
+		b.WriteString(`<table role="presentation" width="100%" border="0" cellpadding="0" cellspacing="0"><tr>`)
+		for _, column := range block.Columns {
+			b.WriteString(`<td width="` + percent + `%" valign="top">`)
+			b.WriteString(`<table role="presentation" width="100%" border="0" cellpadding="0" cellspacing="0">` + "\n")
+			renderColumn(b, column.Blocks, columnWidth)
+			b.WriteString(`</table></td>`)
+		}
+		b.WriteString(`</tr></table>`)
+	}
+}
+
+// renderColumn writes the blocks of a column, with less padding than top-level ones
+func renderColumn(b *strings.Builder, blocks []*Block, width int) {
+	for _, block := range blocks {
+		fmt.Fprintf(b, `<tr><td align="%s" style="padding:8px">`, orString(block.Align, "left"))
+		renderBlock(b, block, width-16)
+		b.WriteString("</td></tr>\n")
+	}
+}
+
+// escape escapes text for HTML content and attributes, leaving template tags
+// as they are so the template engine still reads them
+func escape(s string) string {
+	var b strings.Builder
+	for {
+		start := strings.Index(s, "{{")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(s[start:], "}}")
+		if end < 0 {
+			break
+		}
+		end += start + 2
+		b.WriteString(htmlEscaper.Replace(s[:start]))
+		b.WriteString(s[start:end])
+		s = s[end:]
+	}
+	b.WriteString(htmlEscaper.Replace(s))
+	return b.String()
+}
+
+var htmlEscaper = strings.NewReplacer(`&`, "&amp;", `<`, "&lt;", `>`, "&gt;", `"`, "&#34;", `'`, "&#39;")
+
+func or(v, fallback int) int {
+	if v == 0 {
+		return fallback
+	}
+	return v
+}
+
+func orString(v, fallback string) string {
+	if v == "" {
+		return fallback
+	}
+	return v
+}
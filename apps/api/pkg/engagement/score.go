@@ -0,0 +1,91 @@
+// Package engagement scores how engaged contacts are with an org's emails. A
+// contact's score runs from 0 to 100 and adds up their opens and clicks, each
+// worth less the longer ago it happened, so contacts who stop engaging drift
+// back to 0.
+package engagement
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Scoring model
+const (
+	MaxScore     = 100
+	OpenPoints   = 10 // A fresh open, counted once per email
+	ClickPoints  = 30 // A fresh click, counted once per email
+	HalfLifeDays = 30 // Days after which an event is worth half its points
+	WindowDays   = 365
+)
+
+// HistoryDays is how long score changes are kept, and so how far back segment
+// conditions on past scores can look
+const HistoryDays = 365
+
+// Recompute scores every contact of an org from its opens and clicks of the
+// last WindowDays, and records the scores that changed in the contact's score
+// history. It returns how many scores changed.
+func Recompute(ctx context.Context, db *sql.DB, orgID int64) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to score contacts: %w", err)
+	}
+	defer tx.Rollback()
+
+	var changed int
+	err = tx.QueryRowContext(ctx, `
+		WITH events AS (
+			SELECT DISTINCT ON (de.email_id, de.event_type) e.contact_id, de.event_type, de.occurred_at
+			FROM delivery_events de
+			JOIN emails e ON e.id = de.email_id
+			WHERE e.org_id = $1 AND e.contact_id IS NOT NULL
+				AND de.event_type IN ('opened', 'clicked')
+				AND de.occurred_at >= NOW() - make_interval(days => $2)
+			ORDER BY de.email_id, de.event_type, de.occurred_at DESC
+		), raw AS (
+			SELECT contact_id, SUM(
+				CASE event_type WHEN 'clicked' THEN $3::float8 ELSE $4::float8 END
+				* POWER(0.5, EXTRACT(EPOCH FROM NOW() - occurred_at) / 86400.0 / $5::float8)
+			) AS points
+			FROM events GROUP BY contact_id
+		), scored AS (
+			SELECT c.id, ROUND(LEAST($6::float8, COALESCE(raw.points, 0))::numeric, 2)::float8 AS score
+			FROM contacts c LEFT JOIN raw ON raw.contact_id = c.id
+			WHERE c.org_id = $1
+		), updated AS (
+			UPDATE contacts c SET engagement_score = scored.score
+			FROM scored
+			WHERE c.id = scored.id AND c.engagement_score IS DISTINCT FROM scored.score
+			RETURNING c.id, c.engagement_score
+		), recorded AS (
+			INSERT INTO contact_engagement_scores (contact_id, org_id, score, computed_at)
+			SELECT id, $1, engagement_score, NOW() FROM updated
+			RETURNING 1
+		)
+		SELECT COUNT(*) FROM recorded
+	`, orgID, WindowDays, float64(ClickPoints), float64(OpenPoints), float64(HalfLifeDays), float64(MaxScore)).Scan(&changed)
+	if err != nil {
+		return 0, fmt.Errorf("failed to score contacts: %w", err)
+	}
+
+	// History older than HistoryDays goes, except each contact's last score
+	// before then, which is still their score at the start of the window
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM contact_engagement_scores h
+		WHERE h.org_id = $1 AND h.computed_at < NOW() - make_interval(days => $2)
+			AND EXISTS (
+				SELECT 1 FROM contact_engagement_scores n
+				WHERE n.contact_id = h.contact_id AND n.computed_at > h.computed_at
+					AND n.computed_at < NOW() - make_interval(days => $2)
+			)
+	`, orgID, HistoryDays)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune score history: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to score contacts: %w", err)
+	}
+	return changed, nil
+}
@@ -0,0 +1,90 @@
+package eventexport
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Export formats
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// Export destinations
+const (
+	DestinationDownload = "download" // The platform's exports bucket, fetched through a presigned URL
+	DestinationS3       = "s3"       // The organization's own bucket
+)
+
+// MaxRangeDays caps the date range of one export
+const MaxRangeDays = 366
+
+// Bucket is an organization's S3 bucket exports are delivered to. The secret
+// access key is stored encrypted and never returned by the API.
+type Bucket struct {
+	Bucket          string `json:"bucket"`
+	Region          string `json:"region"`
+	Prefix          string `json:"prefix,omitempty"` // Key prefix exports are written under
+	AccessKeyID     string `json:"accessKeyId"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	HasSecret       bool   `json:"hasSecret"`
+}
+
+// Configured reports whether exports can be delivered to the bucket
+func (b Bucket) Configured() bool {
+	return b.Bucket != "" && b.Region != "" && b.AccessKeyID != "" && b.HasSecret
+}
+
+// Validate checks the bucket name, region and key prefix
+func (b Bucket) Validate() error {
+	if b.Bucket == "" {
+		return nil // Removes the bucket
+	}
+	if len(b.Bucket) < 3 || len(b.Bucket) > 63 || strings.ContainsAny(b.Bucket, "/ ") {
+		return fmt.Errorf("bucket must be an S3 bucket name")
+	}
+	if b.Region == "" {
+		return fmt.Errorf("region is required")
+	}
+	if b.AccessKeyID == "" || !b.HasSecret {
+		return fmt.Errorf("accessKeyId and secretAccessKey are required")
+	}
+	if strings.HasPrefix(b.Prefix, "/") {
+		return fmt.Errorf("prefix must not start with /")
+	}
+	return nil
+}
+
+// Key returns the object key of a file in the bucket
+func (b Bucket) Key(name string) string {
+	prefix := strings.TrimSuffix(b.Prefix, "/")
+	if prefix == "" {
+		return name
+	}
+	return prefix + "/" + name
+}
+
+// Load reads the organization's export bucket from organizations.settings, with
+// the secret access key still encrypted
+func Load(ctx context.Context, db *sql.DB, orgID int64) Bucket {
+	var bucket Bucket
+	if db == nil {
+		return bucket
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'eventExportBucket' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return bucket
+	}
+
+	json.Unmarshal([]byte(raw.String), &bucket)
+	bucket.HasSecret = bucket.SecretAccessKey != ""
+	return bucket
+}
@@ -0,0 +1,163 @@
+package hygiene
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/mail"
+	"strings"
+)
+
+// Verdicts of an address check
+const (
+	VerdictValid         = "valid"
+	VerdictRisky         = "risky"         // Deliverable, but likely to hurt engagement or reputation
+	VerdictUndeliverable = "undeliverable" // Mail to it can't be delivered
+	VerdictUnknown       = "unknown"       // The check couldn't finish, so it's retried next run
+)
+
+// Reasons an address is flagged
+const (
+	ReasonInvalidSyntax = "invalid_syntax" // Undeliverable
+	ReasonNoMailServer  = "no_mail_server" // Undeliverable: the domain has no MX or address record
+	ReasonDisposable    = "disposable"     // Risky: a throwaway mailbox provider
+	ReasonRoleAccount   = "role_account"   // Risky: a shared mailbox like info@ or support@
+	ReasonDNSFailure    = "dns_failure"    // Unknown: the domain's records couldn't be looked up
+)
+
+// disposableDomains are throwaway mailbox providers
+var disposableDomains = map[string]bool{
+	"mailinator.com": true, "guerrillamail.com": true, "guerrillamail.net": true, "sharklasers.com": true,
+	"10minutemail.com": true, "tempmail.com": true, "temp-mail.org": true, "yopmail.com": true,
+	"trashmail.com": true, "getnada.com": true, "dispostable.com": true, "maildrop.cc": true,
+	"throwawaymail.com": true, "fakeinbox.com": true, "mintemail.com": true, "mohmal.com": true,
+	"emailondeck.com": true, "spamgourmet.com": true, "mailnesia.com": true, "tempr.email": true,
+}
+
+// roleAccounts are local parts of mailboxes shared by a team rather than read
+// by a person
+var roleAccounts = map[string]bool{
+	"admin": true, "administrator": true, "abuse": true, "billing": true, "contact": true,
+	"help": true, "hostmaster": true, "info": true, "marketing": true, "noreply": true,
+	"no-reply": true, "office": true, "postmaster": true, "root": true, "sales": true,
+	"security": true, "support": true, "team": true, "webmaster": true,
+}
+
+// Resolver looks up the DNS records a check needs. *net.Resolver is one.
+type Resolver interface {
+	LookupMX(ctx context.Context, name string) ([]*net.MX, error)
+	LookupHost(ctx context.Context, host string) ([]string, error)
+}
+
+// Result is the outcome of checking an address
+type Result struct {
+	Verdict string
+	Reasons []string
+}
+
+// Checker checks addresses, looking up each domain once
+type Checker struct {
+	resolver Resolver
+	domains  map[string]domainResult
+}
+
+type domainResult struct {
+	deliverable bool
+	err         error
+}
+
+// NewChecker creates a checker that looks domains up with the resolver
+func NewChecker(resolver Resolver) *Checker {
+	return &Checker{resolver: resolver, domains: map[string]domainResult{}}
+}
+
+// Check checks the syntax of an address, whether its domain accepts mail, and
+// whether it's a disposable or role address
+func (c *Checker) Check(ctx context.Context, address string) Result {
+	local, domain, ok := splitAddress(address)
+	if !ok {
+		return Result{Verdict: VerdictUndeliverable, Reasons: []string{ReasonInvalidSyntax}}
+	}
+
+	d := c.lookup(ctx, domain)
+	if d.err != nil {
+		return Result{Verdict: VerdictUnknown, Reasons: []string{ReasonDNSFailure}}
+	}
+	if !d.deliverable {
+		return Result{Verdict: VerdictUndeliverable, Reasons: []string{ReasonNoMailServer}}
+	}
+
+	var reasons []string
+	if disposableDomains[domain] {
+		reasons = append(reasons, ReasonDisposable)
+	}
+	if roleAccounts[strings.SplitN(local, "+", 2)[0]] {
+		reasons = append(reasons, ReasonRoleAccount)
+	}
+	if len(reasons) > 0 {
+		return Result{Verdict: VerdictRisky, Reasons: reasons}
+	}
+	return Result{Verdict: VerdictValid}
+}
+
+// lookup tells whether a domain accepts mail: it has MX records other than a
+// null MX, or, without any, an address record mail falls back to
+func (c *Checker) lookup(ctx context.Context, domain string) domainResult {
+	if d, ok := c.domains[domain]; ok {
+		return d
+	}
+
+	var d domainResult
+	mxs, err := c.resolver.LookupMX(ctx, domain)
+	switch {
+	case err == nil && len(mxs) > 0:
+		for _, mx := range mxs {
+			if host := strings.TrimSuffix(mx.Host, "."); host != "" {
+				d.deliverable = true
+			}
+		}
+	case err == nil || isNotFound(err):
+		_, err := c.resolver.LookupHost(ctx, domain)
+		if err != nil && !isNotFound(err) {
+			d.err = err
+		}
+		d.deliverable = err == nil
+	default:
+		d.err = err
+	}
+
+	// A failed lookup is retried the next time the domain comes up
+	if d.err == nil {
+		c.domains[domain] = d
+	}
+	return d
+}
+
+func isNotFound(err error) bool {
+	var dnsErr *net.DNSError
+	return errors.As(err, &dnsErr) && dnsErr.IsNotFound
+}
+
+// splitAddress returns the lowercased local part and domain of a plain address
+func splitAddress(address string) (string, string, bool) {
+	address = strings.ToLower(strings.TrimSpace(address))
+	if len(address) > 254 {
+		return "", "", false
+	}
+	parsed, err := mail.ParseAddress(address)
+	if err != nil || parsed.Address != address || parsed.Name != "" {
+		return "", "", false
+	}
+
+	at := strings.LastIndex(address, "@")
+	local, domain := address[:at], address[at+1:]
+	if local == "" || len(local) > 64 || !strings.Contains(domain, ".") || strings.HasPrefix(domain, "[") {
+		return "", "", false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || strings.HasPrefix(label, "-") || strings.HasSuffix(label, "-") {
+			return "", "", false
+		}
+	}
+	return local, domain, true
+}
@@ -0,0 +1,85 @@
+// Package hygiene re-verifies the addresses of contacts that went stale, so
+// lists shed addresses that would bounce or hurt the sender's reputation
+// before a campaign mails them.
+package hygiene
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// StatusQuarantined is the contact status of quarantined contacts
+const StatusQuarantined = "quarantined"
+
+// Limits of a policy
+const (
+	MaxDays      = 3650
+	MaxBatchSize = 50000
+)
+
+// Policy controls the org's list cleaning. Contacts that haven't engaged for
+// StaleDays, and weren't checked in the last RecheckDays, have their address
+// checked, up to BatchSize of them a run. Undeliverable and risky addresses are
+// flagged, and optionally quarantined: quarantined contacts keep their data but
+// campaigns skip them until they're set active again.
+type Policy struct {
+	Enabled                 bool `json:"enabled"` // Run daily; runs can be started by hand either way
+	StaleDays               int  `json:"staleDays"`
+	RecheckDays             int  `json:"recheckDays"`
+	BatchSize               int  `json:"batchSize"`
+	QuarantineUndeliverable bool `json:"quarantineUndeliverable"`
+	QuarantineRisky         bool `json:"quarantineRisky"`
+}
+
+// DefaultPolicy applies to orgs that haven't set their own. It flags without
+// quarantining.
+var DefaultPolicy = Policy{StaleDays: 180, RecheckDays: 90, BatchSize: 5000}
+
+// Validate checks the policy windows and batch size
+func (p Policy) Validate() error {
+	if p.StaleDays < 1 || p.StaleDays > MaxDays {
+		return fmt.Errorf("staleDays must be between 1 and %d", MaxDays)
+	}
+	if p.RecheckDays < 1 || p.RecheckDays > MaxDays {
+		return fmt.Errorf("recheckDays must be between 1 and %d", MaxDays)
+	}
+	if p.BatchSize < 1 || p.BatchSize > MaxBatchSize {
+		return fmt.Errorf("batchSize must be between 1 and %d", MaxBatchSize)
+	}
+	return nil
+}
+
+// Quarantines reports whether contacts with the verdict are quarantined
+func (p Policy) Quarantines(verdict string) bool {
+	switch verdict {
+	case VerdictUndeliverable:
+		return p.QuarantineUndeliverable
+	case VerdictRisky:
+		return p.QuarantineRisky
+	}
+	return false
+}
+
+// Load reads the org's policy from its settings, falling back to DefaultPolicy
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	policy := DefaultPolicy
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'listHygiene' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	if policy.Validate() != nil {
+		return DefaultPolicy
+	}
+	return policy
+}
@@ -0,0 +1,98 @@
+// Package inboxcounts reconciles the per-identity inbox counters that a
+// trigger on received_emails keeps up to date, so the counts endpoint reads a
+// single row instead of counting every folder.
+package inboxcounts
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+)
+
+// Counts are the email counts of an identity's folders and views
+type Counts struct {
+	Inbox   int
+	Unread  int
+	Starred int
+	Sent    int
+	Drafts  int
+	Spam    int
+	Trash   int
+}
+
+// countsQuery counts the emails of an identity the way the inbox lists them.
+// The received_email_count_vector function of the counts trigger must count
+// them the same way.
+const countsQuery = `
+	SELECT
+		COUNT(*) FILTER (WHERE folder = 'inbox' AND is_trashed = false AND is_archived = false),
+		COUNT(*) FILTER (WHERE is_read = false AND is_trashed = false),
+		COUNT(*) FILTER (WHERE is_starred = true AND is_trashed = false),
+		COUNT(*) FILTER (WHERE folder = 'sent' AND is_trashed = false),
+		COUNT(*) FILTER (WHERE folder = 'drafts' AND is_trashed = false),
+		COUNT(*) FILTER (WHERE (folder = 'spam' OR is_spam = true) AND is_trashed = false),
+		COUNT(*) FILTER (WHERE is_trashed = true)
+	FROM received_emails
+	WHERE identity_id = $1
+`
+
+// Reconcile recounts the emails of an identity and corrects its counters when
+// they drifted. It returns whether they had.
+//
+// The counters row is locked before counting, so trigger updates of emails
+// changed meanwhile wait for the recount and are applied on top of it.
+func Reconcile(ctx context.Context, db *sql.DB, identityID int64) (bool, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return false, fmt.Errorf("failed to reconcile inbox counts: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO received_email_counts (identity_id) VALUES ($1)
+		ON CONFLICT (identity_id) DO NOTHING
+	`, identityID)
+	if err != nil {
+		return false, fmt.Errorf("failed to reconcile inbox counts: %w", err)
+	}
+
+	var stored Counts
+	err = tx.QueryRowContext(ctx, `
+		SELECT inbox, unread, starred, sent, drafts, spam, trash
+		FROM received_email_counts WHERE identity_id = $1
+		FOR UPDATE
+	`, identityID).Scan(&stored.Inbox, &stored.Unread, &stored.Starred, &stored.Sent, &stored.Drafts, &stored.Spam, &stored.Trash)
+	if err != nil {
+		return false, fmt.Errorf("failed to reconcile inbox counts: %w", err)
+	}
+
+	var actual Counts
+	err = tx.QueryRowContext(ctx, countsQuery, identityID).Scan(
+		&actual.Inbox, &actual.Unread, &actual.Starred, &actual.Sent, &actual.Drafts, &actual.Spam, &actual.Trash,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to reconcile inbox counts: %w", err)
+	}
+
+	drifted := stored != actual
+	if drifted {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE received_email_counts SET
+				inbox = $2, unread = $3, starred = $4, sent = $5, drafts = $6, spam = $7, trash = $8,
+				updated_at = NOW(), reconciled_at = NOW()
+			WHERE identity_id = $1
+		`, identityID, actual.Inbox, actual.Unread, actual.Starred, actual.Sent, actual.Drafts, actual.Spam, actual.Trash)
+	} else {
+		_, err = tx.ExecContext(ctx, `
+			UPDATE received_email_counts SET reconciled_at = NOW() WHERE identity_id = $1
+		`, identityID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to reconcile inbox counts: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("failed to reconcile inbox counts: %w", err)
+	}
+	return drifted, nil
+}
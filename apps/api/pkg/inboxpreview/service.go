@@ -0,0 +1,158 @@
+package inboxpreview
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/safehttp"
+)
+
+// Email clients previews are rendered for
+const (
+	ClientGmail     = "gmail"
+	ClientOutlook   = "outlook"
+	ClientAppleMail = "apple_mail"
+)
+
+// Clients lists the email clients a preview service is asked to render for
+var Clients = []string{ClientGmail, ClientOutlook, ClientAppleMail}
+
+const (
+	// MaxImageBytes caps a preview image sent inline by the service
+	MaxImageBytes = 5 << 20
+
+	// maxResponseBytes caps the service's response, which may hold an inline
+	// image per client
+	maxResponseBytes = 32 << 20
+)
+
+// httpClient calls the preview services orgs configure, so it refuses to
+// connect to internal addresses
+var httpClient = safehttp.NewClient(2 * time.Minute)
+
+// Service is an organization's external inbox preview service. Rendering posts
+// the email to its URL and gets back a screenshot per client, as an image URL or
+// as inline base64 image data.
+type Service struct {
+	URL     string   `json:"url"`
+	APIKey  string   `json:"apiKey,omitempty"`  // Sent as a bearer token
+	Clients []string `json:"clients,omitempty"` // Clients rendered by default; empty for all
+}
+
+// Enabled reports whether a service is configured
+func (s Service) Enabled() bool {
+	return s.URL != ""
+}
+
+// Validate checks the service URL and clients
+func (s Service) Validate() error {
+	if s.URL != "" {
+		u, err := url.Parse(s.URL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("url must be an http(s) URL")
+		}
+	}
+	return ValidateClients(s.Clients)
+}
+
+// DefaultClients returns the clients rendered when a request doesn't pick any
+func (s Service) DefaultClients() []string {
+	if len(s.Clients) == 0 {
+		return Clients
+	}
+	return s.Clients
+}
+
+// ValidateClients checks that every client is one previews are rendered for
+func ValidateClients(clients []string) error {
+	for _, client := range clients {
+		if !slices.Contains(Clients, client) {
+			return fmt.Errorf("unknown client %q, use %s", client, strings.Join(Clients, ", "))
+		}
+	}
+	return nil
+}
+
+// Request is what is posted to the service
+type Request struct {
+	Subject string   `json:"subject"`
+	HTML    string   `json:"html"`
+	Text    string   `json:"text,omitempty"`
+	Clients []string `json:"clients"`
+}
+
+// Image is the service's preview of the email in one client
+type Image struct {
+	Client      string `json:"client"`
+	ImageURL    string `json:"imageUrl,omitempty"`
+	Image       string `json:"image,omitempty"` // Base64 image data, instead of an image URL
+	ContentType string `json:"contentType,omitempty"`
+	Error       string `json:"error,omitempty"` // Set when the client couldn't be rendered
+}
+
+// Render posts the email to the service and returns its preview per client
+func (s Service) Render(ctx context.Context, req Request) ([]Image, error) {
+	if !s.Enabled() {
+		return nil, fmt.Errorf("no inbox preview service is configured")
+	}
+	body, err := json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode preview request: %w", err)
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", s.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create preview request: %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("User-Agent", "Mailat-Preview/1.0")
+	if s.APIKey != "" {
+		httpReq.Header.Set("Authorization", "Bearer "+s.APIKey)
+	}
+
+	resp, err := httpClient.Do(httpReq)
+	if err != nil {
+		return nil, fmt.Errorf("preview service unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		respBody, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("preview service returned HTTP %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var result struct {
+		Previews []Image `json:"previews"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxResponseBytes)).Decode(&result); err != nil {
+		return nil, fmt.Errorf("invalid preview service response: %w", err)
+	}
+	return result.Previews, nil
+}
+
+// Load reads the organization's inbox preview service from organizations.settings
+func Load(ctx context.Context, db *sql.DB, orgID int64) Service {
+	var service Service
+	if db == nil {
+		return service
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'inboxPreview' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return service
+	}
+
+	json.Unmarshal([]byte(raw.String), &service)
+	return service
+}
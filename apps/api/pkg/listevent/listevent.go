@@ -0,0 +1,87 @@
+// Package listevent records how lists grow and churn. Every contact joining
+// or leaving a list, and every member who unsubscribes, bounces or complains,
+// is an event of the list with the source that caused it, which list stats
+// count by day.
+package listevent
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// Events
+const (
+	Subscribed   = "subscribed"   // The contact joined the list
+	Unsubscribed = "unsubscribed" // The member unsubscribed, from the list or from everything
+	Bounced      = "bounced"      // The member's address hard bounced
+	Complained   = "complained"   // The member marked an email as spam
+	Removed      = "removed"      // The contact was taken off the list or deleted
+)
+
+// Events are the events of a list, in the order stats list them
+var Events = []string{Subscribed, Unsubscribed, Bounced, Complained, Removed}
+
+// Sources
+const (
+	SourceAPI         = "api"
+	SourceImport      = "import"
+	SourceForm        = "form"
+	SourceBulk        = "bulk"
+	SourceSegment     = "segment"     // A dynamic list's rules
+	SourcePreferences = "preferences" // The preference center
+	SourceEmail       = "email"       // An email's unsubscribe link
+	SourceProvider    = "provider"    // A bounce or complaint the sending provider reported
+	SourceAutomation  = "automation"  // An automation's action node
+	SourceUnknown     = "unknown"
+)
+
+// Executor runs queries in a transaction or not
+type Executor interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// Record records an event of a contact on lists
+func Record(ctx context.Context, db Executor, orgID, contactID int64, listIDs []int, event, source string) error {
+	if len(listIDs) == 0 {
+		return nil
+	}
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+		SELECT $1, unnest($2::int[]), $3, $4, $5, NOW()
+	`, orgID, pq.Array(listIDs), contactID, event, source)
+	if err != nil {
+		return fmt.Errorf("failed to record list event: %w", err)
+	}
+	return nil
+}
+
+// RecordMemberships records an event of a contact on every list it is a member
+// of, such as unsubscribing from everything
+func RecordMemberships(ctx context.Context, db Executor, orgID, contactID int64, event, source string) error {
+	_, err := db.ExecContext(ctx, `
+		INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+		SELECT $1, lc.list_id, $2, $3, $4, NOW()
+		FROM list_contacts lc WHERE lc.contact_id = $2
+	`, orgID, contactID, event, source)
+	if err != nil {
+		return fmt.Errorf("failed to record list event: %w", err)
+	}
+	return nil
+}
+
+// StatusEvent returns the event of a contact's status becoming status, if it is
+// one members churn with
+func StatusEvent(status string) (string, bool) {
+	switch status {
+	case "unsubscribed":
+		return Unsubscribed, true
+	case "bounced":
+		return Bounced, true
+	case "complained":
+		return Complained, true
+	}
+	return "", false
+}
@@ -0,0 +1,57 @@
+package mailassist
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	anthropicAPI          = "https://api.anthropic.com/v1/messages"
+	anthropicVersion      = "2023-06-01"
+	anthropicDefaultModel = "claude-3-5-haiku-latest"
+	anthropicMaxTokens    = 4096
+)
+
+// anthropic calls Anthropic's messages API
+type anthropic struct {
+	model  string
+	apiKey string
+}
+
+func (a *anthropic) complete(ctx context.Context, system, message string) (string, error) {
+	model := a.model
+	if model == "" {
+		model = anthropicDefaultModel
+	}
+
+	var result struct {
+		Content []struct {
+			Type string `json:"type"`
+			Text string `json:"text"`
+		} `json:"content"`
+	}
+	err := postJSON(ctx, anthropicAPI, map[string]string{
+		"x-api-key":         a.apiKey,
+		"anthropic-version": anthropicVersion,
+	}, map[string]any{
+		"model":      model,
+		"max_tokens": anthropicMaxTokens,
+		"system":     system,
+		"messages":   []map[string]string{{"role": "user", "content": message}},
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+
+	var text strings.Builder
+	for _, block := range result.Content {
+		if block.Type == "text" {
+			text.WriteString(block.Text)
+		}
+	}
+	if text.Len() == 0 {
+		return "", fmt.Errorf("the provider returned no answer")
+	}
+	return text.String(), nil
+}
@@ -0,0 +1,52 @@
+package mailassist
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	deepLAPI     = "https://api.deepl.com/v2/translate"
+	deepLFreeAPI = "https://api-free.deepl.com/v2/translate"
+)
+
+// deepL translates with DeepL. It doesn't summarize.
+type deepL struct {
+	apiKey string
+}
+
+func (d *deepL) Summarize(ctx context.Context, text, language string) (string, error) {
+	return "", ErrUnsupported
+}
+
+func (d *deepL) Translate(ctx context.Context, text, targetLanguage string) (*Translation, error) {
+	// Keys of the free plan end in :fx and only work with its API
+	endpoint := deepLAPI
+	if strings.HasSuffix(d.apiKey, ":fx") {
+		endpoint = deepLFreeAPI
+	}
+
+	var result struct {
+		Translations []struct {
+			Text                   string `json:"text"`
+			DetectedSourceLanguage string `json:"detected_source_language"`
+		} `json:"translations"`
+	}
+	err := postJSON(ctx, endpoint, map[string]string{
+		"Authorization": "DeepL-Auth-Key " + d.apiKey,
+	}, map[string]any{
+		"text":        []string{Truncate(text)},
+		"target_lang": strings.ToUpper(targetLanguage),
+	}, &result)
+	if err != nil {
+		return nil, err
+	}
+	if len(result.Translations) == 0 {
+		return nil, fmt.Errorf("the provider returned no translation")
+	}
+	return &Translation{
+		Text:           result.Translations[0].Text,
+		SourceLanguage: strings.ToLower(result.Translations[0].DetectedSourceLanguage),
+	}, nil
+}
@@ -0,0 +1,220 @@
+// Package mailassist summarizes and translates emails through an org's own
+// language model or translation provider, called with the org's API key. Only
+// the emails a user asks about are sent, when they ask.
+package mailassist
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Providers
+const (
+	ProviderOpenAI    = "openai" // OpenAI, or any API compatible with its chat completions
+	ProviderAnthropic = "anthropic"
+	ProviderDeepL     = "deepl" // Translation only
+)
+
+// Providers are the providers an org can use
+var Providers = []string{ProviderOpenAI, ProviderAnthropic, ProviderDeepL}
+
+// MaxInputChars caps the text sent to a provider in one call
+const MaxInputChars = 30000
+
+// ErrUnsupported is returned by providers that can't do what's asked, such as
+// DeepL summarizing
+var ErrUnsupported = errors.New("the configured provider can't do this")
+
+var httpClient = &http.Client{Timeout: 2 * time.Minute}
+
+var languageCode = regexp.MustCompile(`^[A-Za-z]{2,3}(-[A-Za-z0-9]{2,8})*$`)
+
+// Config is an organization's provider. The API key is stored encrypted and
+// never returned by the API.
+type Config struct {
+	Provider string `json:"provider"`
+	Model    string `json:"model,omitempty"`   // The provider's default when empty
+	BaseURL  string `json:"baseUrl,omitempty"` // An OpenAI-compatible API, such as a self-hosted model
+	APIKey   string `json:"apiKey,omitempty"`
+	HasKey   bool   `json:"hasKey"`
+}
+
+// Configured reports whether emails can be summarized or translated. A
+// self-hosted OpenAI-compatible API may not need a key.
+func (c Config) Configured() bool {
+	if c.Provider == ProviderOpenAI && c.BaseURL != "" {
+		return true
+	}
+	return c.Provider != "" && c.HasKey
+}
+
+// Validate checks the provider, model and base URL
+func (c Config) Validate() error {
+	if c.Provider == "" {
+		return nil // Removes the provider
+	}
+	if !slices.Contains(Providers, c.Provider) {
+		return fmt.Errorf("unknown provider %q, use %s", c.Provider, strings.Join(Providers, ", "))
+	}
+	if len(c.Model) > 100 {
+		return fmt.Errorf("model must be at most 100 characters")
+	}
+	if c.BaseURL != "" {
+		if c.Provider != ProviderOpenAI {
+			return fmt.Errorf("baseUrl can only be set for the openai provider")
+		}
+		u, err := url.Parse(c.BaseURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("baseUrl must be an http(s) URL")
+		}
+	}
+	if !c.Configured() {
+		return fmt.Errorf("apiKey is required")
+	}
+	return nil
+}
+
+// Load reads the organization's provider from organizations.settings, with the
+// API key still encrypted
+func Load(ctx context.Context, db *sql.DB, orgID int64) Config {
+	var config Config
+	if db == nil {
+		return config
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'mailAssist' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return config
+	}
+
+	json.Unmarshal([]byte(raw.String), &config)
+	config.HasKey = config.APIKey != ""
+	return config
+}
+
+// Translation is a text translated by a provider
+type Translation struct {
+	Text           string
+	SourceLanguage string // As detected by the provider, when it says
+}
+
+// Provider summarizes and translates text
+type Provider interface {
+	// Summarize returns a short summary of an email or conversation, written
+	// in a language, or in the text's own when language is empty
+	Summarize(ctx context.Context, text, language string) (string, error)
+	// Translate translates a text into a language
+	Translate(ctx context.Context, text, targetLanguage string) (*Translation, error)
+}
+
+// New returns the provider of a config, calling it with the decrypted API key
+func New(config Config, apiKey string) (Provider, error) {
+	switch config.Provider {
+	case ProviderOpenAI:
+		return &chatProvider{model: &openAI{baseURL: config.BaseURL, model: config.Model, apiKey: apiKey}}, nil
+	case ProviderAnthropic:
+		return &chatProvider{model: &anthropic{model: config.Model, apiKey: apiKey}}, nil
+	case ProviderDeepL:
+		return &deepL{apiKey: apiKey}, nil
+	}
+	return nil, fmt.Errorf("unknown provider %q", config.Provider)
+}
+
+// ValidLanguage reports whether language is a language code, such as "de" or
+// "pt-BR"
+func ValidLanguage(language string) bool {
+	return languageCode.MatchString(language)
+}
+
+// PlainText returns the text of an email body: the text one, or the HTML one
+// without its markup
+func PlainText(textBody, htmlBody string) string {
+	if strings.TrimSpace(textBody) != "" {
+		return strings.TrimSpace(textBody)
+	}
+	text := scriptRe.ReplaceAllString(htmlBody, "")
+	text = breakRe.ReplaceAllString(text, "\n")
+	text = tagRe.ReplaceAllString(text, "")
+	text = html.UnescapeString(text)
+	text = blankLinesRe.ReplaceAllString(text, "\n\n")
+	return strings.TrimSpace(text)
+}
+
+var (
+	scriptRe     = regexp.MustCompile(`(?is)<(script|style)[^>]*>.*?</(script|style)>`)
+	breakRe      = regexp.MustCompile(`(?i)<br\s*/?>|</p>|</div>|</li>|</tr>|</h[1-6]>`)
+	tagRe        = regexp.MustCompile(`<[^>]+>`)
+	blankLinesRe = regexp.MustCompile(`\n\s*\n(\s*\n)+`)
+)
+
+// Truncate cuts text to MaxInputChars characters
+func Truncate(text string) string {
+	runes := []rune(text)
+	if len(runes) <= MaxInputChars {
+		return text
+	}
+	return string(runes[:MaxInputChars])
+}
+
+// APIError is a failed call to a provider's API
+type APIError struct {
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("provider API returned %d: %s", e.StatusCode, e.Body)
+}
+
+// postJSON posts a JSON body with the given headers and decodes the JSON
+// response into result
+func postJSON(ctx context.Context, endpoint string, headers map[string]string, body, result any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("provider unreachable: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(io.LimitReader(resp.Body, 10<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 300 {
+		if len(respBody) > 500 {
+			respBody = respBody[:500]
+		}
+		return &APIError{StatusCode: resp.StatusCode, Body: string(respBody)}
+	}
+	if err := json.Unmarshal(respBody, result); err != nil {
+		return fmt.Errorf("invalid provider response: %w", err)
+	}
+	return nil
+}
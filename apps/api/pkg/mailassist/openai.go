@@ -0,0 +1,57 @@
+package mailassist
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+const (
+	openAIAPI          = "https://api.openai.com/v1"
+	openAIDefaultModel = "gpt-4o-mini"
+)
+
+// openAI calls the chat completions of OpenAI, or of a compatible API at
+// baseURL
+type openAI struct {
+	baseURL string
+	model   string
+	apiKey  string
+}
+
+func (o *openAI) complete(ctx context.Context, system, message string) (string, error) {
+	baseURL := strings.TrimRight(o.baseURL, "/")
+	if baseURL == "" {
+		baseURL = openAIAPI
+	}
+	model := o.model
+	if model == "" {
+		model = openAIDefaultModel
+	}
+	headers := map[string]string{}
+	if o.apiKey != "" {
+		headers["Authorization"] = "Bearer " + o.apiKey
+	}
+
+	var result struct {
+		Choices []struct {
+			Message struct {
+				Content string `json:"content"`
+			} `json:"message"`
+		} `json:"choices"`
+	}
+	err := postJSON(ctx, baseURL+"/chat/completions", headers, map[string]any{
+		"model": model,
+		"messages": []map[string]string{
+			{"role": "system", "content": system},
+			{"role": "user", "content": message},
+		},
+	}, &result)
+	if err != nil {
+		return "", err
+	}
+	if len(result.Choices) == 0 {
+		return "", fmt.Errorf("the provider returned no answer")
+	}
+	return result.Choices[0].Message.Content, nil
+}
@@ -0,0 +1,98 @@
+// Package mailconfig describes how mail apps reach an identity's mailbox over
+// IMAP and SMTP, and publishes it in the autoconfig format Thunderbird and
+// other clients look up when an account is added.
+package mailconfig
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+// SecurityTLS is a connection that's TLS from the start (IMAPS on 993,
+// SMTPS on 465)
+const SecurityTLS = "SSL/TLS"
+
+// UsernamePlaceholder stands in for the address in autoconfig documents, which
+// describe a whole domain; clients put the address being added in its place
+const UsernamePlaceholder = "%EMAILADDRESS%"
+
+// Server is where a mail app connects for one protocol
+type Server struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Security string `json:"security"`
+}
+
+// Settings are what a mail app needs to add an identity. Apps sign in with
+// the identity's address and one of its app passwords.
+type Settings struct {
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	IMAP     Server `json:"imap"`
+	SMTP     Server `json:"smtp"`
+}
+
+// New returns the settings of an address on a mail host
+func New(email, host string, imapPort, smtpPort int) *Settings {
+	return &Settings{
+		Email:    email,
+		Username: email,
+		IMAP:     Server{Host: host, Port: imapPort, Security: SecurityTLS},
+		SMTP:     Server{Host: host, Port: smtpPort, Security: SecurityTLS},
+	}
+}
+
+type clientConfig struct {
+	XMLName  xml.Name      `xml:"clientConfig"`
+	Version  string        `xml:"version,attr"`
+	Provider emailProvider `xml:"emailProvider"`
+}
+
+type emailProvider struct {
+	ID               string       `xml:"id,attr"`
+	Domain           string       `xml:"domain"`
+	DisplayName      string       `xml:"displayName"`
+	DisplayShortName string       `xml:"displayShortName"`
+	Incoming         serverConfig `xml:"incomingServer"`
+	Outgoing         serverConfig `xml:"outgoingServer"`
+}
+
+type serverConfig struct {
+	Type           string `xml:"type,attr"`
+	Hostname       string `xml:"hostname"`
+	Port           int    `xml:"port"`
+	SocketType     string `xml:"socketType"`
+	Authentication string `xml:"authentication"`
+	Username       string `xml:"username"`
+}
+
+// Autoconfig renders the settings as the autoconfig document of a domain
+// (config-v1.1.xml), named after the app
+func Autoconfig(domain, appName string, s *Settings) ([]byte, error) {
+	server := func(typ string, srv Server) serverConfig {
+		return serverConfig{
+			Type:           typ,
+			Hostname:       srv.Host,
+			Port:           srv.Port,
+			SocketType:     "SSL",
+			Authentication: "password-cleartext",
+			Username:       s.Username,
+		}
+	}
+	doc := clientConfig{
+		Version: "1.1",
+		Provider: emailProvider{
+			ID:               strings.ToLower(domain),
+			Domain:           strings.ToLower(domain),
+			DisplayName:      appName + " (" + domain + ")",
+			DisplayShortName: appName,
+			Incoming:         server("imap", s.IMAP),
+			Outgoing:         server("smtp", s.SMTP),
+		},
+	}
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
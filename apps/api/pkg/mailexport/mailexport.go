@@ -0,0 +1,115 @@
+// Package mailexport writes emails to mailbox archives: a single MBOX file, or
+// a zip with an EML file per email. Both hold the emails' MIME source, so they
+// can be imported into mail clients and discovery tools.
+package mailexport
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// Archive formats
+const (
+	FormatMBOX = "mbox"
+	FormatEML  = "eml"
+)
+
+// ValidFormat reports whether format is an archive format
+func ValidFormat(format string) bool {
+	return format == FormatMBOX || format == FormatEML
+}
+
+// ContentType returns the content type of archives in a format
+func ContentType(format string) string {
+	if format == FormatEML {
+		return "application/zip"
+	}
+	return "application/mbox"
+}
+
+// Extension returns the file extension of archives in a format
+func Extension(format string) string {
+	if format == FormatEML {
+		return "zip"
+	}
+	return "mbox"
+}
+
+// Writer adds emails to an archive
+type Writer interface {
+	// Add writes the MIME source of an email, sent by sender at date. Name
+	// identifies the email in the archive, as a path with no extension.
+	Add(name, sender string, date time.Time, raw []byte) error
+	// Close finishes the archive without closing the underlying writer
+	Close() error
+}
+
+// NewWriter returns a writer of archives in a format to w
+func NewWriter(w io.Writer, format string) Writer {
+	if format == FormatEML {
+		return &emlWriter{zip: zip.NewWriter(w)}
+	}
+	return &mboxWriter{buf: bufio.NewWriter(w)}
+}
+
+// mboxWriter writes the mboxrd variant: each email starts with a "From " line,
+// and lines of the email that would be taken for one, even once quoted, are
+// quoted with one more ">"
+type mboxWriter struct {
+	buf *bufio.Writer
+}
+
+func (m *mboxWriter) Add(name, sender string, date time.Time, raw []byte) error {
+	if sender == "" || strings.ContainsAny(sender, " \t\r\n") {
+		sender = "MAILER-DAEMON"
+	}
+	fmt.Fprintf(m.buf, "From %s %s\n", sender, date.UTC().Format(time.ANSIC))
+
+	raw = bytes.ReplaceAll(raw, []byte("\r\n"), []byte("\n"))
+	for len(raw) > 0 {
+		line := raw
+		if i := bytes.IndexByte(raw, '\n'); i >= 0 {
+			line, raw = raw[:i], raw[i+1:]
+		} else {
+			raw = nil
+		}
+		if bytes.HasPrefix(bytes.TrimLeft(line, ">"), []byte("From ")) {
+			m.buf.WriteByte('>')
+		}
+		m.buf.Write(line)
+		m.buf.WriteByte('\n')
+	}
+	_, err := m.buf.WriteString("\n")
+	return err
+}
+
+func (m *mboxWriter) Close() error {
+	return m.buf.Flush()
+}
+
+// emlWriter writes a zip of EML files
+type emlWriter struct {
+	zip *zip.Writer
+}
+
+func (e *emlWriter) Add(name, sender string, date time.Time, raw []byte) error {
+	w, err := e.zip.CreateHeader(&zip.FileHeader{
+		Name:     name + ".eml",
+		Method:   zip.Deflate,
+		Modified: date,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(raw)
+	return err
+}
+
+func (e *emlWriter) Close() error {
+	return e.zip.Close()
+}
@@ -0,0 +1,309 @@
+// Package outboundrules holds the org's rules for emails composed in the inbox:
+// content that must not leave, like card numbers, recipients outside the org
+// the sender has to confirm, and a disclaimer appended to what's sent.
+package outboundrules
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+)
+
+// What a matching rule does
+const (
+	// ActionBlock refuses to send the email
+	ActionBlock = "block"
+	// ActionConfirm sends the email once the sender confirms it
+	ActionConfirm = "confirm"
+)
+
+// Built-in patterns rules can use instead of their own
+const (
+	PresetCreditCard = "credit_card" // Card numbers passing the Luhn check
+	PresetIBAN       = "iban"        // IBANs passing the mod 97 check
+	PresetUSSSN      = "us_ssn"      // US social security numbers
+)
+
+// MaxRules is how many content rules an org can have
+const MaxRules = 50
+
+// Rule flags emails whose subject, body or attachment names match
+type Rule struct {
+	Name         string `json:"name"`
+	Pattern      string `json:"pattern,omitempty"` // Go regular expression, when there's no preset
+	Preset       string `json:"preset,omitempty"`  // credit_card, iban, us_ssn
+	Action       string `json:"action"`            // block, confirm
+	ExternalOnly bool   `json:"externalOnly"`      // Only when sending outside the org
+}
+
+// Disclaimer is appended to the emails sent
+type Disclaimer struct {
+	Text         string `json:"text"`
+	HTML         string `json:"html,omitempty"` // Used in HTML bodies, the escaped text when empty
+	ExternalOnly bool   `json:"externalOnly"`   // Only when sending outside the org
+}
+
+// Policy is an org's outbound rules
+type Policy struct {
+	Rules           []Rule     `json:"rules"`
+	ConfirmExternal bool       `json:"confirmExternal"` // Senders confirm emails to recipients outside the org
+	Disclaimer      Disclaimer `json:"disclaimer"`
+}
+
+// Validate checks the rules
+func (p Policy) Validate() error {
+	if len(p.Rules) > MaxRules {
+		return fmt.Errorf("at most %d rules allowed", MaxRules)
+	}
+	for i, r := range p.Rules {
+		if strings.TrimSpace(r.Name) == "" {
+			return fmt.Errorf("rules[%d]: name is required", i)
+		}
+		if r.Action != ActionBlock && r.Action != ActionConfirm {
+			return fmt.Errorf("rules[%d]: action must be %s or %s", i, ActionBlock, ActionConfirm)
+		}
+		switch {
+		case r.Preset != "" && r.Pattern != "":
+			return fmt.Errorf("rules[%d]: set either a pattern or a preset", i)
+		case r.Preset != "":
+			if _, ok := presets[r.Preset]; !ok {
+				return fmt.Errorf("rules[%d]: preset must be %s, %s or %s", i, PresetCreditCard, PresetIBAN, PresetUSSSN)
+			}
+		case r.Pattern != "":
+			if _, err := regexp.Compile(r.Pattern); err != nil {
+				return fmt.Errorf("rules[%d]: invalid pattern: %v", i, err)
+			}
+		default:
+			return fmt.Errorf("rules[%d]: a pattern or preset is required", i)
+		}
+	}
+	return nil
+}
+
+// Load reads the organization's outbound rules from organizations.settings.
+// Organizations without any have none.
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	var policy Policy
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'outboundRules' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	return policy
+}
+
+// Message is what the rules are checked against
+type Message struct {
+	Subject         string
+	TextBody        string
+	HTMLBody        string
+	AttachmentNames []string
+	Recipients      []string
+}
+
+// Finding is a rule an email matched. The matched content itself isn't
+// repeated.
+type Finding struct {
+	Rule    string `json:"rule"`
+	Action  string `json:"action"`
+	Matches int    `json:"matches,omitempty"`
+	Detail  string `json:"detail"`
+}
+
+// Result is what the rules found in an email
+type Result struct {
+	Blocked  []Finding `json:"blocked,omitempty"`
+	Confirm  []Finding `json:"confirm,omitempty"`
+	External []string  `json:"external,omitempty"` // Recipients outside the org
+}
+
+// Check runs the rules on an email. Recipients outside internalDomains are
+// external.
+func (p Policy) Check(msg Message, internalDomains []string) Result {
+	var result Result
+	result.External = External(msg.Recipients, internalDomains)
+
+	content := strings.Join([]string{
+		msg.Subject,
+		msg.TextBody,
+		htmlText(msg.HTMLBody),
+		strings.Join(msg.AttachmentNames, "\n"),
+	}, "\n")
+
+	for _, r := range p.Rules {
+		if r.ExternalOnly && len(result.External) == 0 {
+			continue
+		}
+		n := r.count(content)
+		if n == 0 {
+			continue
+		}
+		finding := Finding{
+			Rule:    r.Name,
+			Action:  r.Action,
+			Matches: n,
+			Detail:  fmt.Sprintf("content matches %q", r.Name),
+		}
+		if r.Action == ActionBlock {
+			result.Blocked = append(result.Blocked, finding)
+		} else {
+			result.Confirm = append(result.Confirm, finding)
+		}
+	}
+
+	if p.ConfirmExternal && len(result.External) > 0 {
+		result.Confirm = append(result.Confirm, Finding{
+			Rule:   "external_recipients",
+			Action: ActionConfirm,
+			Detail: "sending outside the organization to " + strings.Join(result.External, ", "),
+		})
+	}
+	return result
+}
+
+// count returns how many times the rule matches content
+func (r Rule) count(content string) int {
+	if preset, ok := presets[r.Preset]; ok {
+		n := 0
+		for _, match := range preset.pattern.FindAllString(content, -1) {
+			if preset.valid == nil || preset.valid(match) {
+				n++
+			}
+		}
+		return n
+	}
+	re, err := regexp.Compile(r.Pattern)
+	if err != nil {
+		return 0
+	}
+	return len(re.FindAllStringIndex(content, -1))
+}
+
+// External returns the recipients whose domain isn't one of internalDomains
+func External(recipients, internalDomains []string) []string {
+	internal := make(map[string]bool, len(internalDomains))
+	for _, d := range internalDomains {
+		internal[strings.ToLower(d)] = true
+	}
+	var external []string
+	seen := make(map[string]bool)
+	for _, addr := range recipients {
+		addr = strings.ToLower(strings.TrimSpace(addr))
+		at := strings.LastIndex(addr, "@")
+		if at < 0 || internal[addr[at+1:]] || seen[addr] {
+			continue
+		}
+		seen[addr] = true
+		external = append(external, addr)
+	}
+	return external
+}
+
+// disclaimerClass marks the disclaimer in HTML bodies
+const disclaimerClass = "mailat-disclaimer"
+
+// AppendDisclaimer adds the disclaimer to the end of the bodies, unless it's
+// already there
+func AppendDisclaimer(textBody, htmlBody string, d Disclaimer) (string, string) {
+	text := strings.TrimSpace(d.Text)
+	if text != "" && textBody != "" && !strings.Contains(textBody, text) {
+		textBody = strings.TrimRight(textBody, " \t\n") + "\n\n" + text
+	}
+
+	block := strings.TrimSpace(d.HTML)
+	if block == "" && text != "" {
+		block = strings.ReplaceAll(html.EscapeString(text), "\n", "<br>")
+	}
+	if block != "" && htmlBody != "" && !strings.Contains(htmlBody, `class="`+disclaimerClass+`"`) {
+		block = `<div class="` + disclaimerClass + `">` + block + `</div>`
+		if i := strings.LastIndex(strings.ToLower(htmlBody), "</body>"); i >= 0 {
+			htmlBody = htmlBody[:i] + block + htmlBody[i:]
+		} else {
+			htmlBody += block
+		}
+	}
+	return textBody, htmlBody
+}
+
+var (
+	htmlHiddenPattern = regexp.MustCompile(`(?is)<(style|script|head)\b.*?</(style|script|head)>`)
+	htmlTagPattern    = regexp.MustCompile(`(?s)<[^>]*>`)
+)
+
+// htmlText returns the text of an HTML body
+func htmlText(body string) string {
+	if body == "" {
+		return ""
+	}
+	body = htmlHiddenPattern.ReplaceAllString(body, " ")
+	body = htmlTagPattern.ReplaceAllString(body, " ")
+	return html.UnescapeString(body)
+}
+
+// preset is a built-in pattern, with a check of the matches it finds
+type preset struct {
+	pattern *regexp.Regexp
+	valid   func(match string) bool
+}
+
+var presets = map[string]preset{
+	PresetCreditCard: {regexp.MustCompile(`\b\d(?:[ -]?\d){12,18}\b`), luhn},
+	PresetIBAN:       {regexp.MustCompile(`(?i)\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]){11,30}\b`), ibanChecksum},
+	PresetUSSSN:      {regexp.MustCompile(`\b(?:00[1-9]|0[1-9]\d|[1-578]\d\d|6[0-57-9]\d|66[0-57-9])-(?:0[1-9]|[1-9]\d)-(?:000[1-9]|00[1-9]\d|0[1-9]\d\d|[1-9]\d{3})\b`), nil},
+}
+
+// luhn reports whether the digits of a number pass the Luhn check
+func luhn(number string) bool {
+	sum, n := 0, 0
+	double := false
+	for i := len(number) - 1; i >= 0; i-- {
+		c := number[i]
+		if c < '0' || c > '9' {
+			continue
+		}
+		d := int(c - '0')
+		if double {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+		double = !double
+		n++
+	}
+	return n >= 13 && sum%10 == 0
+}
+
+// ibanChecksum reports whether an IBAN passes the ISO 13616 mod 97 check
+func ibanChecksum(iban string) bool {
+	iban = strings.ToUpper(strings.ReplaceAll(iban, " ", ""))
+	if len(iban) < 15 {
+		return false
+	}
+	rearranged := iban[4:] + iban[:4]
+	remainder := 0
+	for _, c := range rearranged {
+		switch {
+		case c >= '0' && c <= '9':
+			remainder = (remainder*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			remainder = (remainder*100 + int(c-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return remainder == 1
+}
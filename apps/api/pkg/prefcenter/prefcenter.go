@@ -0,0 +1,84 @@
+// Package prefcenter holds an organization's settings for the hosted preference
+// center, the page contacts reach from the links of its emails to manage their
+// subscriptions and profile.
+package prefcenter
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+)
+
+// Profile fields that are columns of the contact rather than attributes
+const (
+	FieldFirstName = "firstName"
+	FieldLastName  = "lastName"
+)
+
+// MaxProfileFields caps the fields contacts can edit
+const MaxProfileFields = 50
+
+// Settings lists the profile fields contacts can see and edit on the
+// preference center. Other attributes of a contact are never shown there.
+type Settings struct {
+	ProfileFields []string `json:"profileFields"` // firstName, lastName or contact field keys, in page order
+}
+
+// Validate checks the profile fields against the org's contact fields
+func (s Settings) Validate(fields []contactfield.Field) error {
+	if len(s.ProfileFields) > MaxProfileFields {
+		return fmt.Errorf("at most %d profile fields can be shown", MaxProfileFields)
+	}
+
+	known := map[string]bool{FieldFirstName: true, FieldLastName: true}
+	for _, f := range fields {
+		known[f.Key] = true
+	}
+	seen := map[string]bool{}
+	for _, key := range s.ProfileFields {
+		if !known[key] {
+			return fmt.Errorf("profile field %q is not firstName, lastName or a contact field", key)
+		}
+		if seen[key] {
+			return fmt.Errorf("profile field %q is listed twice", key)
+		}
+		seen[key] = true
+	}
+	return nil
+}
+
+// Editable reports whether contacts can change the profile field
+func (s Settings) Editable(key string) bool {
+	for _, k := range s.ProfileFields {
+		if k == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Load reads the organization's preference center settings from
+// organizations.settings. Without them, contacts can edit their name.
+func Load(ctx context.Context, db *sql.DB, orgID int64) Settings {
+	settings := Settings{ProfileFields: []string{FieldFirstName, FieldLastName}}
+	if db == nil {
+		return settings
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'preferenceCenter' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return settings
+	}
+
+	json.Unmarshal([]byte(raw.String), &settings)
+	if settings.ProfileFields == nil {
+		settings.ProfileFields = []string{}
+	}
+	return settings
+}
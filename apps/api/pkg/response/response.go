@@ -1,13 +1,21 @@
 package response
 
 import (
+	"errors"
+	"sort"
+
 	"github.com/gogf/gf/v2/net/ghttp"
+	"github.com/gogf/gf/v2/util/gvalid"
+
+	"github.com/dublyo/mailat/api/pkg/apierror"
 )
 
 type Response struct {
-	Code    int         `json:"code"`
-	Message string      `json:"message"`
-	Data    interface{} `json:"data,omitempty"`
+	Code      int                   `json:"code"`
+	Message   string                `json:"message"`
+	ErrorCode string                `json:"errorCode,omitempty"` // Machine-readable, set on every error
+	Errors    []apierror.FieldError `json:"errors,omitempty"`    // Field-level validation errors
+	Data      interface{}           `json:"data,omitempty"`
 }
 
 type PaginatedResponse struct {
@@ -58,11 +66,84 @@ func Paginated(r *ghttp.Request, data interface{}, total, page, perPage int) {
 	})
 }
 
-// Error sends an error JSON response
+// Error sends an error JSON response with the generic error code of the status
 func Error(r *ghttp.Request, code int, message string) {
 	r.Response.WriteJsonExit(Response{
-		Code:    code,
-		Message: message,
+		Code:      code,
+		Message:   message,
+		ErrorCode: apierror.CodeForStatus(code),
+	})
+}
+
+// Fail sends an error with its own status and error code, or as a bad request
+// when it has none
+func Fail(r *ghttp.Request, err error) {
+	FailWithData(r, err, nil)
+}
+
+// FailWithData sends an error like Fail, with details the client can act on
+func FailWithData(r *ghttp.Request, err error, data interface{}) {
+	status, code := apierror.From(err)
+	var fields []apierror.FieldError
+	var fieldErr apierror.FieldErrorer
+	if errors.As(err, &fieldErr) {
+		fields = fieldErr.FieldErrors()
+	}
+	r.Response.Status = status
+	r.Response.WriteJsonExit(Response{
+		Code:      status,
+		Message:   err.Error(),
+		ErrorCode: code,
+		Errors:    fields,
+		Data:      data,
+	})
+}
+
+// FieldRequired sends a validation error for a missing request field
+func FieldRequired(r *ghttp.Request, field, message string) {
+	r.Response.Status = 400
+	r.Response.WriteJsonExit(Response{
+		Code:      400,
+		Message:   message,
+		ErrorCode: apierror.CodeValidationFailed,
+		Errors:    []apierror.FieldError{{Field: field, Rule: "required", Message: message}},
+	})
+}
+
+// ValidationFailed sends a 400 error response for a request that failed to parse,
+// with an entry per invalid field
+func ValidationFailed(r *ghttp.Request, err error) {
+	var fields []apierror.FieldError
+	var validationErr gvalid.Error
+	if errors.As(err, &validationErr) {
+		for _, item := range validationErr.Items() {
+			for field, rules := range item {
+				names := make([]string, 0, len(rules))
+				for rule := range rules {
+					names = append(names, rule)
+				}
+				sort.Strings(names)
+				for _, rule := range names {
+					fields = append(fields, apierror.FieldError{
+						Field:   field,
+						Rule:    rule,
+						Message: rules[rule].Error(),
+					})
+				}
+			}
+		}
+	}
+
+	code := apierror.CodeInvalidRequest
+	if len(fields) > 0 {
+		code = apierror.CodeValidationFailed
+	}
+	r.Response.Status = 400
+	r.Response.WriteJsonExit(Response{
+		Code:      400,
+		Message:   err.Error(),
+		ErrorCode: code,
+		Errors:    fields,
 	})
 }
 
@@ -72,6 +153,17 @@ func BadRequest(r *ghttp.Request, message string) {
 	Error(r, 400, message)
 }
 
+// BadRequestWithData sends a 400 error response with details the client can act on
+func BadRequestWithData(r *ghttp.Request, message string, data interface{}) {
+	r.Response.Status = 400
+	r.Response.WriteJsonExit(Response{
+		Code:      400,
+		Message:   message,
+		ErrorCode: apierror.CodeInvalidRequest,
+		Data:      data,
+	})
+}
+
 // Unauthorized sends a 401 error response
 func Unauthorized(r *ghttp.Request, message string) {
 	r.Response.Status = 401
@@ -90,6 +182,12 @@ func NotFound(r *ghttp.Request, message string) {
 	Error(r, 404, message)
 }
 
+// TooManyRequests sends a 429 error response
+func TooManyRequests(r *ghttp.Request, message string) {
+	r.Response.Status = 429
+	Error(r, 429, message)
+}
+
 // InternalError sends a 500 error response
 func InternalError(r *ghttp.Request, message string) {
 	r.Response.Status = 500
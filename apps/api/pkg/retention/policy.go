@@ -0,0 +1,66 @@
+package retention
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// MaxDays caps retention windows at ten years
+const MaxDays = 3650
+
+// Policy controls how long transactional email content and records are kept.
+// A zero window keeps the data forever.
+type Policy struct {
+	StripContentAfterDays int    `json:"stripContentAfterDays"`  // Clear html/text bodies after this many days
+	DeleteAfterDays       int    `json:"deleteAfterDays"`        // Delete email rows (and their events) after this many days
+	ExportURL             string `json:"exportUrl,omitempty"`    // Receives each batch as JSON before it is purged
+	ExportSecret          string `json:"exportSecret,omitempty"` // Signs export requests like webhook deliveries
+}
+
+// Enabled reports whether the policy purges anything
+func (p Policy) Enabled() bool {
+	return p.StripContentAfterDays > 0 || p.DeleteAfterDays > 0
+}
+
+// Validate checks the policy windows and export URL
+func (p Policy) Validate() error {
+	if p.StripContentAfterDays < 0 || p.StripContentAfterDays > MaxDays {
+		return fmt.Errorf("stripContentAfterDays must be between 0 and %d", MaxDays)
+	}
+	if p.DeleteAfterDays < 0 || p.DeleteAfterDays > MaxDays {
+		return fmt.Errorf("deleteAfterDays must be between 0 and %d", MaxDays)
+	}
+	if p.StripContentAfterDays > 0 && p.DeleteAfterDays > 0 && p.DeleteAfterDays <= p.StripContentAfterDays {
+		return fmt.Errorf("deleteAfterDays must be greater than stripContentAfterDays")
+	}
+	if p.ExportURL != "" {
+		u, err := url.Parse(p.ExportURL)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("exportUrl must be an http(s) URL")
+		}
+	}
+	return nil
+}
+
+// Load reads the organization's retention policy from organizations.settings.
+// Organizations without a policy keep everything.
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	var policy Policy
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'retention' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	return policy
+}
@@ -0,0 +1,149 @@
+package rotation
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// Strategies for choosing the sending identity of a pool
+const (
+	// StrategyWeighted spreads volume across members in proportion to their weights
+	StrategyWeighted = "weighted_round_robin"
+	// StrategyVolumeCap fills members in order, moving on once a member hits its daily cap
+	StrategyVolumeCap = "volume_cap"
+)
+
+// MaxPools caps the number of rotation pools per organization
+const MaxPools = 20
+
+// Member is a sending identity that takes part in a pool
+type Member struct {
+	From     string `json:"from"`               // Verified sender address
+	Weight   int    `json:"weight"`             // Relative share of the pool's volume (weighted strategy)
+	DailyCap int    `json:"dailyCap,omitempty"` // Max sends per UTC day, 0 for no cap
+}
+
+// Pool is a named set of identities that sends rotate across
+type Pool struct {
+	Name     string   `json:"name"`
+	Strategy string   `json:"strategy"`
+	Members  []Member `json:"members"`
+}
+
+// Policy holds an organization's sender rotation pools
+type Policy struct {
+	Pools []Pool `json:"pools"`
+}
+
+// Validate checks pool names, strategies and members
+func (p Policy) Validate() error {
+	if len(p.Pools) > MaxPools {
+		return fmt.Errorf("at most %d pools allowed", MaxPools)
+	}
+
+	names := map[string]bool{}
+	for _, pool := range p.Pools {
+		if strings.TrimSpace(pool.Name) == "" {
+			return fmt.Errorf("pool name required")
+		}
+		if names[pool.Name] {
+			return fmt.Errorf("duplicate pool name %q", pool.Name)
+		}
+		names[pool.Name] = true
+
+		if pool.Strategy != StrategyWeighted && pool.Strategy != StrategyVolumeCap {
+			return fmt.Errorf("pool %q: strategy must be %s or %s", pool.Name, StrategyWeighted, StrategyVolumeCap)
+		}
+		if len(pool.Members) == 0 {
+			return fmt.Errorf("pool %q: at least one member required", pool.Name)
+		}
+
+		members := map[string]bool{}
+		for i, m := range pool.Members {
+			from := strings.ToLower(m.From)
+			if !strings.Contains(from, "@") {
+				return fmt.Errorf("pool %q: invalid member address %q", pool.Name, m.From)
+			}
+			if members[from] {
+				return fmt.Errorf("pool %q: duplicate member %s", pool.Name, m.From)
+			}
+			members[from] = true
+			if m.Weight < 0 || m.DailyCap < 0 {
+				return fmt.Errorf("pool %q: weight and dailyCap cannot be negative", pool.Name)
+			}
+			if pool.Strategy == StrategyVolumeCap && m.DailyCap == 0 && i < len(pool.Members)-1 {
+				return fmt.Errorf("pool %q: only the last member of a volume_cap pool may be uncapped", pool.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// Pool returns the pool with the given name
+func (p Policy) Pool(name string) (*Pool, bool) {
+	for i := range p.Pools {
+		if p.Pools[i].Name == name {
+			return &p.Pools[i], true
+		}
+	}
+	return nil, false
+}
+
+// Addresses returns the member addresses of the pool
+func (p Pool) Addresses() []string {
+	addresses := make([]string, len(p.Members))
+	for i, m := range p.Members {
+		addresses[i] = m.From
+	}
+	return addresses
+}
+
+// Pick chooses the member for the next send given how many emails each member has
+// sent today (keyed by lowercased address). It reports false when every member is
+// at its daily cap.
+func (p Pool) Pick(sentToday map[string]int) (Member, bool) {
+	var best Member
+	bestLoad := -1.0
+	for _, m := range p.Members {
+		sent := sentToday[strings.ToLower(m.From)]
+		if m.DailyCap > 0 && sent >= m.DailyCap {
+			continue
+		}
+		if p.Strategy == StrategyVolumeCap {
+			return m, true
+		}
+
+		// Smooth weighted round-robin: the member furthest below its share goes next
+		weight := m.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		load := float64(sent+1) / float64(weight)
+		if bestLoad < 0 || load < bestLoad {
+			best, bestLoad = m, load
+		}
+	}
+	return best, bestLoad >= 0
+}
+
+// Load reads the organization's rotation pools from organizations.settings
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	var policy Policy
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'senderRotation' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	return policy
+}
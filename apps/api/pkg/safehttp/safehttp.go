@@ -0,0 +1,41 @@
+// Package safehttp makes HTTP clients for requests to URLs organizations
+// choose, such as the links of their emails and their webhooks. The clients
+// refuse to connect to internal addresses, so the requests can't be used to
+// probe the private network or cloud metadata endpoints.
+package safehttp
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// NewClient returns a client that gives up on requests after timeout and
+// refuses to connect to internal addresses, redirects included
+func NewClient(timeout time.Duration) *http.Client {
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			DialContext: (&net.Dialer{
+				Timeout: timeout,
+				Control: refuseInternal,
+			}).DialContext,
+		},
+	}
+}
+
+// refuseInternal checks the address a connection is about to be made to, once
+// the host name is resolved
+func refuseInternal(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsUnspecified() {
+		return fmt.Errorf("refusing to connect to internal address %s", host)
+	}
+	return nil
+}
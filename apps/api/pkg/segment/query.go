@@ -0,0 +1,300 @@
+package segment
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// query builds the SQL condition of a segment's rules
+type query struct {
+	alias        string
+	args         []any
+	first        int // Number of the first argument
+	today        time.Time
+	automationID int64 // The automation the rules branch in, 0 outside automations
+}
+
+// Compile returns the SQL condition a contact with the given alias matches the
+// rules under, with its arguments numbered from first on. The rules must have
+// been validated.
+func (r *Rules) Compile(alias string, first int) (string, []any) {
+	return r.CompileIn(0, alias, first)
+}
+
+// CompileIn compiles the rules of a condition in an automation, whose own
+// emails event conditions can be limited to. Outside automations those
+// conditions match no email.
+func (r *Rules) CompileIn(automationID int64, alias string, first int) (string, []any) {
+	now := time.Now().UTC()
+	q := &query{
+		alias:        alias,
+		first:        first,
+		today:        time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC),
+		automationID: automationID,
+	}
+	return q.group(r.Match, r.Conditions), q.args
+}
+
+func (q *query) arg(value any) string {
+	q.args = append(q.args, value)
+	return fmt.Sprintf("$%d", q.first+len(q.args)-1)
+}
+
+func (q *query) group(match string, conditions []Condition) string {
+	if len(conditions) == 0 {
+		return "FALSE"
+	}
+	joiner := " AND "
+	if match == "any" {
+		joiner = " OR "
+	}
+	parts := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		parts = append(parts, q.condition(c))
+	}
+	return "(" + strings.Join(parts, joiner) + ")"
+}
+
+func (q *query) condition(c Condition) string {
+	switch c.Type {
+	case TypeGroup:
+		return q.group(c.Match, c.Conditions)
+	case TypeField:
+		kind, ok := fields[c.Field]
+		if !ok {
+			return "FALSE"
+		}
+		return q.compare(q.alias+"."+c.Field, kind, false, c.Operator, c.Value)
+	case TypeAttribute:
+		expr := fmt.Sprintf("(%s.attributes->>%s)", q.alias, q.arg(c.Attribute))
+		return q.compare(expr, attributeKind(c.Operator), true, c.Operator, c.Value)
+	case TypeList:
+		exists := fmt.Sprintf("EXISTS (SELECT 1 FROM list_contacts sl WHERE sl.contact_id = %s.id AND sl.list_id = %s)",
+			q.alias, q.arg(c.ListID))
+		if c.Operator == "not_in_list" {
+			return "NOT " + exists
+		}
+		return exists
+	case TypeEvent:
+		return q.event(c)
+	case TypeScore:
+		return q.score(c)
+	case TypeCustom:
+		return q.custom(c)
+	case TypeTag:
+		tag, _ := c.Value.(string)
+		has := fmt.Sprintf("%s = ANY(COALESCE(%s.tags, '{}'))", q.arg(tag), q.alias)
+		if c.Operator == "has_not" {
+			return "NOT " + has
+		}
+		return has
+	}
+	return "FALSE"
+}
+
+// compare tests a field or attribute. Attributes are text, so numbers and dates
+// are only compared when the attribute reads as one.
+func (q *query) compare(expr, kind string, attribute bool, operator string, value any) string {
+	switch operator {
+	case "is_set":
+		if kind == kindText || attribute {
+			return fmt.Sprintf("(%s IS NOT NULL AND %s <> '')", expr, expr)
+		}
+		return expr + " IS NOT NULL"
+	case "is_not_set":
+		if kind == kindText || attribute {
+			return fmt.Sprintf("(%s IS NULL OR %s = '')", expr, expr)
+		}
+		return expr + " IS NULL"
+	}
+
+	switch kind {
+	case kindNumber:
+		if attribute {
+			expr = fmt.Sprintf("(CASE WHEN %s ~ '^-?[0-9]+(\\.[0-9]+)?$' THEN %s::numeric END)", expr, expr)
+		}
+		number, _ := value.(float64)
+		switch operator {
+		case "equals":
+			return fmt.Sprintf("%s = %s", expr, q.arg(number))
+		case "not_equals":
+			return fmt.Sprintf("(%s IS NULL OR %s <> %s)", expr, expr, q.arg(number))
+		case "greater_than":
+			return fmt.Sprintf("%s > %s", expr, q.arg(number))
+		case "less_than":
+			return fmt.Sprintf("%s < %s", expr, q.arg(number))
+		}
+	case kindDate:
+		if attribute {
+			return q.compareDateText(expr, operator, value)
+		}
+		return q.compareDate(expr, operator, value)
+	default:
+		text, _ := scalarText(value)
+		switch operator {
+		case "equals":
+			return fmt.Sprintf("LOWER(%s) = LOWER(%s)", expr, q.arg(text))
+		case "not_equals":
+			return fmt.Sprintf("(%s IS NULL OR LOWER(%s) <> LOWER(%s))", expr, expr, q.arg(text))
+		case "contains":
+			return fmt.Sprintf("%s ILIKE %s", expr, q.arg("%"+escapeLike(text)+"%"))
+		case "not_contains":
+			return fmt.Sprintf("(%s IS NULL OR %s NOT ILIKE %s)", expr, expr, q.arg("%"+escapeLike(text)+"%"))
+		case "starts_with":
+			return fmt.Sprintf("%s ILIKE %s", expr, q.arg(escapeLike(text)+"%"))
+		case "ends_with":
+			return fmt.Sprintf("%s ILIKE %s", expr, q.arg("%"+escapeLike(text)))
+		case "in", "not_in":
+			values, _ := value.([]any)
+			texts := make([]string, 0, len(values))
+			for _, v := range values {
+				if text, ok := scalarText(v); ok {
+					texts = append(texts, strings.ToLower(text))
+				}
+			}
+			in := fmt.Sprintf("LOWER(%s) = ANY(%s)", expr, q.arg(pq.Array(texts)))
+			if operator == "not_in" {
+				return fmt.Sprintf("(%s IS NULL OR NOT %s)", expr, in)
+			}
+			return in
+		}
+	}
+	return "FALSE"
+}
+
+// compareDate tests a timestamp column
+func (q *query) compareDate(expr, operator string, value any) string {
+	switch operator {
+	case "before", "after":
+		text, _ := value.(string)
+		date, _ := parseDate(text)
+		if operator == "before" {
+			return fmt.Sprintf("%s < %s", expr, q.arg(date))
+		}
+		return fmt.Sprintf("%s > %s", expr, q.arg(date))
+	}
+
+	days, _ := value.(float64)
+	interval := fmt.Sprintf("make_interval(days => %s)", q.arg(int(days)))
+	switch operator {
+	case "within_last_days":
+		return fmt.Sprintf("%s >= NOW() - %s", expr, interval)
+	case "more_than_days_ago":
+		return fmt.Sprintf("%s < NOW() - %s", expr, interval)
+	case "within_next_days":
+		return fmt.Sprintf("(%s >= NOW() AND %s <= NOW() + %s)", expr, expr, interval)
+	}
+	return "FALSE"
+}
+
+// compareDateText tests an attribute holding a date. Dates starting with
+// YYYY-MM-DD compare as text, which can't fail on values that aren't dates.
+func (q *query) compareDateText(expr, operator string, value any) string {
+	date := fmt.Sprintf("(CASE WHEN %s ~ '^[0-9]{4}-[0-9]{2}-[0-9]{2}' THEN LEFT(%s, 10) END)", expr, expr)
+	day := func(t time.Time) string { return q.arg(t.Format("2006-01-02")) }
+
+	switch operator {
+	case "before", "after":
+		text, _ := value.(string)
+		parsed, _ := parseDate(text)
+		if operator == "before" {
+			return fmt.Sprintf("%s < %s", date, day(parsed.UTC()))
+		}
+		return fmt.Sprintf("%s > %s", date, day(parsed.UTC()))
+	}
+
+	days, _ := value.(float64)
+	switch operator {
+	case "within_last_days":
+		return fmt.Sprintf("(%s >= %s AND %s <= %s)", date, day(q.today.AddDate(0, 0, -int(days))), date, day(q.today))
+	case "more_than_days_ago":
+		return fmt.Sprintf("%s < %s", date, day(q.today.AddDate(0, 0, -int(days))))
+	case "within_next_days":
+		return fmt.Sprintf("(%s >= %s AND %s <= %s)", date, day(q.today), date, day(q.today.AddDate(0, 0, int(days))))
+	}
+	return "FALSE"
+}
+
+// event tests whether the contact was sent an email, or had a delivery event on
+// one, optionally within the last days and of one campaign or the automation
+func (q *query) event(c Condition) string {
+	var where []string
+	from := "emails se"
+	if c.Event == "sent" {
+		where = append(where, "se.status NOT IN ('queued', 'failed')")
+		if c.Days > 0 {
+			where = append(where, fmt.Sprintf("se.created_at >= NOW() - make_interval(days => %s)", q.arg(c.Days)))
+		}
+	} else {
+		from += " JOIN delivery_events de ON de.email_id = se.id"
+		where = append(where, "de.event_type = "+q.arg(c.Event))
+		if c.Days > 0 {
+			where = append(where, fmt.Sprintf("de.occurred_at >= NOW() - make_interval(days => %s)", q.arg(c.Days)))
+		}
+	}
+	if c.CampaignID > 0 {
+		where = append(where, "se.campaign_id = "+q.arg(c.CampaignID))
+	}
+	if c.Automation {
+		where = append(where, "se.automation_id = "+q.arg(q.automationID))
+	}
+
+	exists := fmt.Sprintf("EXISTS (SELECT 1 FROM %s WHERE se.contact_id = %s.id AND %s)", from, q.alias, strings.Join(where, " AND "))
+	if c.Operator == "has_not" {
+		return "NOT " + exists
+	}
+	return exists
+}
+
+// custom tests whether the contact recorded a custom event at least count
+// times, optionally within the last days
+func (q *query) custom(c Condition) string {
+	where := fmt.Sprintf("ce.contact_id = %s.id AND ce.name = %s", q.alias, q.arg(c.Event))
+	if c.Days > 0 {
+		where += fmt.Sprintf(" AND ce.occurred_at >= NOW() - make_interval(days => %s)", q.arg(c.Days))
+	}
+
+	var has string
+	if c.Count > 1 {
+		has = fmt.Sprintf("(SELECT COUNT(*) FROM contact_events ce WHERE %s) >= %s", where, q.arg(c.Count))
+	} else {
+		has = fmt.Sprintf("EXISTS (SELECT 1 FROM contact_events ce WHERE %s)", where)
+	}
+	if c.Operator == "has_not" {
+		return "NOT " + has
+	}
+	return has
+}
+
+// score tests the contact's engagement score, now or throughout the last days.
+// Scores are recorded when they change, so the scores over the window are the
+// current one, those recorded in it and the last one recorded before it.
+func (q *query) score(c Condition) string {
+	value, _ := c.Value.(float64)
+	current := q.alias + ".engagement_score"
+	if c.Days == 0 {
+		if c.Operator == "less_than" {
+			return fmt.Sprintf("COALESCE(%s, 0) < %s", current, q.arg(value))
+		}
+		return fmt.Sprintf("COALESCE(%s, 0) > %s", current, q.arg(value))
+	}
+
+	aggregate, extreme := "MAX", "GREATEST"
+	if c.Operator == "greater_than" {
+		aggregate, extreme = "MIN", "LEAST"
+	}
+	since := fmt.Sprintf("NOW() - make_interval(days => %s)", q.arg(c.Days))
+	within := fmt.Sprintf("(SELECT %s(sh.score) FROM contact_engagement_scores sh WHERE sh.contact_id = %s.id AND sh.computed_at >= %s)",
+		aggregate, q.alias, since)
+	before := fmt.Sprintf("(SELECT sh.score FROM contact_engagement_scores sh WHERE sh.contact_id = %s.id AND sh.computed_at < %s ORDER BY sh.computed_at DESC LIMIT 1)",
+		q.alias, since)
+
+	op := "<"
+	if c.Operator == "greater_than" {
+		op = ">"
+	}
+	return fmt.Sprintf("%s(COALESCE(%s, 0), %s, %s) %s %s", extreme, current, within, before, op, q.arg(value))
+}
@@ -0,0 +1,147 @@
+package segment
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/dublyo/mailat/api/pkg/listevent"
+)
+
+// Refresh materializes the members of a dynamic list from its rules, adding the
+// org's contacts that match and removing those that no longer do, and returns
+// how many members it has. Members added and removed are recorded as list
+// events. Refreshes of the same list run one at a time.
+func Refresh(ctx context.Context, db *sql.DB, orgID int64, listID int) (int, error) {
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to refresh segment: %w", err)
+	}
+	defer tx.Rollback()
+
+	var listType string
+	var raw []byte
+	err = tx.QueryRowContext(ctx, `
+		SELECT COALESCE(type, 'static'), segment_rules FROM lists
+		WHERE id = $1 AND org_id = $2
+		FOR UPDATE
+	`, listID, orgID).Scan(&listType, &raw)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("list not found")
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to get list: %w", err)
+	}
+	if listType != "dynamic" {
+		return 0, fmt.Errorf("only dynamic lists have segment rules")
+	}
+	if len(raw) == 0 || string(raw) == "null" {
+		return 0, fmt.Errorf("the segment has no rules")
+	}
+	rules, err := Parse(raw)
+	if err != nil {
+		return 0, err
+	}
+	if err := rules.Validate(listID); err != nil {
+		return 0, err
+	}
+
+	where, ruleArgs := rules.Compile("c", 3)
+	args := append([]any{listID, orgID}, ruleArgs...)
+
+	_, err = tx.ExecContext(ctx, `
+		WITH removed AS (
+			DELETE FROM list_contacts lc
+			WHERE lc.list_id = $1 AND NOT EXISTS (
+				SELECT 1 FROM contacts c WHERE c.id = lc.contact_id AND c.org_id = $2 AND `+where+`
+			)
+			RETURNING lc.contact_id
+		)
+		INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+		SELECT $2, $1, contact_id, '`+listevent.Removed+`', '`+listevent.SourceSegment+`', NOW() FROM removed
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove segment members: %w", err)
+	}
+
+	_, err = tx.ExecContext(ctx, `
+		WITH added AS (
+			INSERT INTO list_contacts (list_id, contact_id, created_at)
+			SELECT $1, c.id, NOW() FROM contacts c
+			WHERE c.org_id = $2 AND `+where+`
+			ON CONFLICT (list_id, contact_id) DO NOTHING
+			RETURNING contact_id
+		)
+		INSERT INTO list_events (org_id, list_id, contact_id, event, source, created_at)
+		SELECT $2, $1, contact_id, '`+listevent.Subscribed+`', '`+listevent.SourceSegment+`', NOW() FROM added
+	`, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add segment members: %w", err)
+	}
+
+	var count int
+	err = tx.QueryRowContext(ctx, `
+		UPDATE lists SET
+			contact_count = (SELECT COUNT(*) FROM list_contacts WHERE list_id = $1),
+			segment_refreshed_at = NOW()
+		WHERE id = $1
+		RETURNING contact_count
+	`, listID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to update list count: %w", err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to refresh segment: %w", err)
+	}
+	return count, nil
+}
+
+// Preview counts the org's contacts that match rules, without materializing
+// them, and returns the emails of up to limit of them. The rules must have been
+// validated.
+func Preview(ctx context.Context, db *sql.DB, orgID int64, rules *Rules, limit int) (int, []string, error) {
+	where, ruleArgs := rules.Compile("c", 2)
+	args := append([]any{orgID}, ruleArgs...)
+
+	var count int
+	err := db.QueryRowContext(ctx, `
+		SELECT COUNT(*) FROM contacts c WHERE c.org_id = $1 AND `+where, args...).Scan(&count)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to count segment contacts: %w", err)
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT c.email FROM contacts c WHERE c.org_id = $1 AND `+where+`
+		ORDER BY c.created_at DESC
+		LIMIT `+fmt.Sprint(limit), args...)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to sample segment contacts: %w", err)
+	}
+	defer rows.Close()
+
+	sample := []string{}
+	for rows.Next() {
+		var email string
+		if err := rows.Scan(&email); err != nil {
+			return 0, nil, fmt.Errorf("failed to scan segment contact: %w", err)
+		}
+		sample = append(sample, email)
+	}
+	return count, sample, rows.Err()
+}
+
+// Matches reports whether a contact matches the rules of a condition in an
+// automation. The rules must have been validated.
+func Matches(ctx context.Context, db *sql.DB, automationID, contactID int64, rules *Rules) (bool, error) {
+	where, ruleArgs := rules.CompileIn(automationID, "c", 2)
+	args := append([]any{contactID}, ruleArgs...)
+
+	var matches bool
+	err := db.QueryRowContext(ctx, `
+		SELECT EXISTS (SELECT 1 FROM contacts c WHERE c.id = $1 AND `+where+`)`, args...).Scan(&matches)
+	if err != nil {
+		return false, fmt.Errorf("failed to test segment rules: %w", err)
+	}
+	return matches, nil
+}
@@ -0,0 +1,342 @@
+package segment
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/contactevent"
+	"github.com/dublyo/mailat/api/pkg/engagement"
+)
+
+// Limits of a segment's rules
+const (
+	MaxDepth      = 5   // Nesting of groups
+	MaxConditions = 100 // Conditions in all groups together
+	MaxDays       = 3650
+	MaxCount      = 10000 // Occurrences a custom condition can ask for
+)
+
+// Condition types
+const (
+	TypeField     = "field"     // A contact column
+	TypeAttribute = "attribute" // A key of the contact's attributes
+	TypeList      = "list"      // Membership of another list
+	TypeEvent     = "event"     // Engagement with the org's emails
+	TypeScore     = "score"     // The engagement score over the last days
+	TypeTag       = "tag"       // A tag of the contact
+	TypeCustom    = "custom"    // A custom event recorded against the contact
+	TypeGroup     = "group"     // Nested conditions with their own match
+)
+
+// Rules select the contacts of a dynamic list. Conditions combine with AND when
+// Match is all and with OR when it's any, and groups nest further conditions.
+//
+//	{"match": "all", "conditions": [
+//		{"type": "attribute", "attribute": "plan", "operator": "equals", "value": "pro"},
+//		{"type": "event", "event": "opened", "operator": "has", "days": 30},
+//		{"type": "group", "match": "any", "conditions": [
+//			{"type": "field", "field": "created_at", "operator": "within_last_days", "value": 7},
+//			{"type": "list", "operator": "in_list", "listId": 12}
+//		]},
+//		{"type": "score", "operator": "greater_than", "value": 40, "days": 90},
+//		{"type": "tag", "operator": "has_not", "value": "churned"},
+//		{"type": "custom", "event": "purchase", "operator": "has", "count": 3, "days": 90}
+//	]}
+//
+// Automations branch on the same rules for the contact going through them.
+type Rules struct {
+	Match      string      `json:"match"` // all, any
+	Conditions []Condition `json:"conditions"`
+}
+
+// Condition is one test of a contact, or a group of them
+type Condition struct {
+	Type       string      `json:"type"`
+	Field      string      `json:"field,omitempty"`      // field conditions
+	Attribute  string      `json:"attribute,omitempty"`  // attribute conditions
+	Operator   string      `json:"operator,omitempty"`   // See the operators of each type
+	Value      any         `json:"value,omitempty"`      // A string, number or boolean, a list of them for in and not_in, days for day operators
+	ListID     int         `json:"listId,omitempty"`     // list conditions
+	Event      string      `json:"event,omitempty"`      // event conditions: sent, delivered, opened, clicked, bounced, complained; custom conditions: the event's name
+	Days       int         `json:"days,omitempty"`       // event and custom conditions: within the last days, 0 for ever; score conditions: throughout the last days, 0 for now
+	Count      int         `json:"count,omitempty"`      // custom conditions: at least this many times, 1 by default
+	CampaignID int         `json:"campaignId,omitempty"` // event conditions: of one campaign only
+	Automation bool        `json:"automation,omitempty"` // event conditions in automation conditions: of the automation's own emails only
+	Match      string      `json:"match,omitempty"`      // group conditions
+	Conditions []Condition `json:"conditions,omitempty"` // group conditions
+}
+
+// Kinds of values a field holds, which decide its operators
+const (
+	kindText   = "text"
+	kindNumber = "number"
+	kindDate   = "date"
+)
+
+// fields are the contact columns conditions can test
+var fields = map[string]string{
+	"email":               kindText,
+	"first_name":          kindText,
+	"last_name":           kindText,
+	"status":              kindText,
+	"consent_source":      kindText,
+	"verification_status": kindText,
+	"engagement_score":    kindNumber,
+	"created_at":          kindDate,
+	"updated_at":          kindDate,
+	"last_engaged_at":     kindDate,
+	"consent_timestamp":   kindDate,
+	"verified_at":         kindDate,
+}
+
+var textOperators = map[string]bool{
+	"equals": true, "not_equals": true, "contains": true, "not_contains": true,
+	"starts_with": true, "ends_with": true, "in": true, "not_in": true,
+	"is_set": true, "is_not_set": true,
+}
+
+var numberOperators = map[string]bool{
+	"equals": true, "not_equals": true, "greater_than": true, "less_than": true,
+	"is_set": true, "is_not_set": true,
+}
+
+// Date operators take a date for before and after, and a number of days for the others
+var dateOperators = map[string]bool{
+	"before": true, "after": true, "within_last_days": true, "more_than_days_ago": true,
+	"within_next_days": true, "is_set": true, "is_not_set": true,
+}
+
+// events are what event conditions can test. Sent looks at the emails
+// themselves, the others at their delivery events.
+var events = map[string]bool{
+	"sent": true, "delivered": true, "opened": true, "clicked": true, "bounced": true, "complained": true,
+}
+
+var attributePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,100}$`)
+
+// Parse reads rules from their JSON
+func Parse(data []byte) (*Rules, error) {
+	var rules Rules
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return nil, fmt.Errorf("segment rules are not valid: %w", err)
+	}
+	return &rules, nil
+}
+
+// Validate checks every condition of the rules. A segment can't test its own
+// membership, so listID is the dynamic list the rules belong to, 0 for none.
+func (r *Rules) Validate(listID int) error {
+	count := 0
+	return validateGroup(r.Match, r.Conditions, listID, 1, &count)
+}
+
+func validateGroup(match string, conditions []Condition, listID, depth int, count *int) error {
+	if match != "" && match != "all" && match != "any" {
+		return fmt.Errorf("match must be all or any")
+	}
+	if depth > MaxDepth {
+		return fmt.Errorf("groups can't be nested more than %d deep", MaxDepth)
+	}
+	if len(conditions) == 0 {
+		return fmt.Errorf("a group needs at least one condition")
+	}
+	for i, c := range conditions {
+		if *count++; *count > MaxConditions {
+			return fmt.Errorf("segments can't have more than %d conditions", MaxConditions)
+		}
+		if err := c.validate(listID, depth, count); err != nil {
+			return fmt.Errorf("condition %d: %w", i+1, err)
+		}
+	}
+	return nil
+}
+
+func (c *Condition) validate(listID, depth int, count *int) error {
+	switch c.Type {
+	case TypeGroup:
+		return validateGroup(c.Match, c.Conditions, listID, depth+1, count)
+	case TypeField:
+		kind, ok := fields[c.Field]
+		if !ok {
+			return fmt.Errorf("unknown field %q", c.Field)
+		}
+		return validateOperator(kind, c.Operator, c.Value)
+	case TypeAttribute:
+		if !attributePattern.MatchString(c.Attribute) {
+			return fmt.Errorf("attribute must be up to 100 letters, digits, dots, dashes or underscores")
+		}
+		return validateOperator(attributeKind(c.Operator), c.Operator, c.Value)
+	case TypeList:
+		if c.Operator != "in_list" && c.Operator != "not_in_list" {
+			return fmt.Errorf("list conditions take the in_list or not_in_list operator")
+		}
+		if c.ListID <= 0 {
+			return fmt.Errorf("listId is required")
+		}
+		if c.ListID == listID {
+			return fmt.Errorf("a segment can't test its own membership")
+		}
+	case TypeEvent:
+		if !events[c.Event] {
+			return fmt.Errorf("event must be sent, delivered, opened, clicked, bounced or complained")
+		}
+		if c.Operator != "" && c.Operator != "has" && c.Operator != "has_not" {
+			return fmt.Errorf("event conditions take the has or has_not operator")
+		}
+		if c.Days < 0 || c.Days > MaxDays {
+			return fmt.Errorf("days must be between 0 and %d", MaxDays)
+		}
+	case TypeScore:
+		if c.Operator != "less_than" && c.Operator != "greater_than" {
+			return fmt.Errorf("score conditions take the less_than or greater_than operator")
+		}
+		if score, ok := c.Value.(float64); !ok || score < 0 || score > engagement.MaxScore {
+			return fmt.Errorf("score conditions take a score between 0 and %d", engagement.MaxScore)
+		}
+		if c.Days < 0 || c.Days > engagement.HistoryDays {
+			return fmt.Errorf("days must be between 0 and %d", engagement.HistoryDays)
+		}
+	case TypeTag:
+		if c.Operator != "has" && c.Operator != "has_not" {
+			return fmt.Errorf("tag conditions take the has or has_not operator")
+		}
+		if tag, ok := c.Value.(string); !ok || tag == "" || len(tag) > 50 {
+			return fmt.Errorf("tag conditions take a tag of up to 50 characters")
+		}
+	case TypeCustom:
+		if !contactevent.ValidName(c.Event) {
+			return fmt.Errorf("event must be up to %d letters, digits or _.:-", contactevent.MaxNameLength)
+		}
+		if c.Operator != "has" && c.Operator != "has_not" {
+			return fmt.Errorf("custom conditions take the has or has_not operator")
+		}
+		if c.Days < 0 || c.Days > MaxDays {
+			return fmt.Errorf("days must be between 0 and %d", MaxDays)
+		}
+		if c.Count < 0 || c.Count > MaxCount {
+			return fmt.Errorf("count must be between 1 and %d", MaxCount)
+		}
+	default:
+		return fmt.Errorf("type must be field, attribute, list, event, score, tag, custom or group")
+	}
+	return nil
+}
+
+// attributeKind tells how an attribute is compared. Attributes have no type of
+// their own, so the operator decides.
+func attributeKind(operator string) string {
+	switch {
+	case dateOperators[operator] && operator != "is_set" && operator != "is_not_set":
+		return kindDate
+	case operator == "greater_than" || operator == "less_than":
+		return kindNumber
+	}
+	return kindText
+}
+
+func validateOperator(kind, operator string, value any) error {
+	operators := textOperators
+	switch kind {
+	case kindNumber:
+		operators = numberOperators
+	case kindDate:
+		operators = dateOperators
+	}
+	if !operators[operator] {
+		return fmt.Errorf("operator %q doesn't apply to %s values", operator, kind)
+	}
+
+	switch {
+	case operator == "is_set" || operator == "is_not_set":
+		return nil
+	case operator == "in" || operator == "not_in":
+		values, ok := value.([]any)
+		if !ok || len(values) == 0 {
+			return fmt.Errorf("%s takes a list of values", operator)
+		}
+		for _, v := range values {
+			if _, ok := scalarText(v); !ok {
+				return fmt.Errorf("%s takes a list of strings, numbers or booleans", operator)
+			}
+		}
+	case operator == "before" || operator == "after":
+		text, _ := value.(string)
+		if _, err := parseDate(text); err != nil {
+			return fmt.Errorf("%s takes a date like 2006-01-02", operator)
+		}
+	case kind == kindDate:
+		if days, ok := value.(float64); !ok || days < 0 || days > MaxDays || days != float64(int(days)) {
+			return fmt.Errorf("%s takes a whole number of days up to %d", operator, MaxDays)
+		}
+	case kind == kindNumber:
+		if _, ok := value.(float64); !ok {
+			return fmt.Errorf("%s takes a number", operator)
+		}
+	default:
+		if _, ok := scalarText(value); !ok {
+			return fmt.Errorf("%s takes a string, number or boolean", operator)
+		}
+	}
+	return nil
+}
+
+// ListIDs returns the lists the rules test membership of
+func (r *Rules) ListIDs() []int {
+	var ids []int
+	for _, c := range r.conditionsOf(TypeList) {
+		ids = append(ids, c.ListID)
+	}
+	return ids
+}
+
+// AttributeConditions returns the conditions of the rules that test attributes
+func (r *Rules) AttributeConditions() []Condition {
+	return r.conditionsOf(TypeAttribute)
+}
+
+// conditionsOf returns the conditions of a type, those in groups included
+func (r *Rules) conditionsOf(conditionType string) []Condition {
+	var found []Condition
+	var walk func([]Condition)
+	walk = func(conditions []Condition) {
+		for _, c := range conditions {
+			switch c.Type {
+			case conditionType:
+				found = append(found, c)
+			case TypeGroup:
+				walk(c.Conditions)
+			}
+		}
+	}
+	walk(r.Conditions)
+	return found
+}
+
+// scalarText returns how a JSON scalar reads as an attribute value
+func scalarText(value any) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
+
+func parseDate(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.Parse("2006-01-02", value)
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
@@ -0,0 +1,73 @@
+package sendrate
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// MaxPerHour bounds every limit of a policy
+const MaxPerHour = 1000000
+
+// Policy caps how fast an org's campaigns send, across all of them. Limits are
+// messages per rolling hour, and 0 means no limit. Mailbox providers throttle
+// senders that go over what they accept from them, so recipient domains can be
+// capped on their own.
+type Policy struct {
+	PerHour          int            `json:"perHour"`           // All campaign sends of the org
+	PerDomainPerHour int            `json:"perDomainPerHour"`  // Each recipient domain without its own limit
+	Domains          map[string]int `json:"domains,omitempty"` // Recipient domains with their own limit, like gmail.com
+}
+
+// Validate checks the limits and domain names
+func (p Policy) Validate() error {
+	if p.PerHour < 0 || p.PerHour > MaxPerHour {
+		return fmt.Errorf("perHour must be between 0 and %d", MaxPerHour)
+	}
+	if p.PerDomainPerHour < 0 || p.PerDomainPerHour > MaxPerHour {
+		return fmt.Errorf("perDomainPerHour must be between 0 and %d", MaxPerHour)
+	}
+	for domain, limit := range p.Domains {
+		if domain == "" || domain != strings.ToLower(domain) || strings.ContainsAny(domain, "@ ") || !strings.Contains(domain, ".") {
+			return fmt.Errorf("domains: %q is not a lowercase domain name", domain)
+		}
+		if limit < 1 || limit > MaxPerHour {
+			return fmt.Errorf("domains: the limit of %s must be between 1 and %d", domain, MaxPerHour)
+		}
+	}
+	return nil
+}
+
+// DomainLimit returns the hourly limit of a recipient domain, 0 for none
+func (p Policy) DomainLimit(domain string) int {
+	if limit, ok := p.Domains[strings.ToLower(domain)]; ok {
+		return limit
+	}
+	return p.PerDomainPerHour
+}
+
+// Limited reports whether the policy has any limit
+func (p Policy) Limited() bool {
+	return p.PerHour > 0 || p.PerDomainPerHour > 0 || len(p.Domains) > 0
+}
+
+// Load reads the org's policy from its settings. Orgs without one have no limits.
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	var policy Policy
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'campaignSendRate' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	return policy
+}
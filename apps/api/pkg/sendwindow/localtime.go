@@ -0,0 +1,69 @@
+package sendwindow
+
+import (
+	"strings"
+	"time"
+)
+
+// Campaigns scheduled for the recipient's local time go out at the same wall
+// clock time in every recipient's timezone, so their sending starts when the
+// first timezone reaches that time and ends when the last one does.
+const (
+	LocalTimeLead = 14 * time.Hour // UTC+14, the first timezone to reach a time
+	LocalTimeLag  = 12 * time.Hour // UTC-12, the last one
+)
+
+// countryTimezones maps ISO 3166-1 alpha-2 country codes to the timezone most
+// of the country's people live in
+var countryTimezones = map[string]string{
+	"AE": "Asia/Dubai", "AR": "America/Argentina/Buenos_Aires", "AT": "Europe/Vienna",
+	"AU": "Australia/Sydney", "BD": "Asia/Dhaka", "BE": "Europe/Brussels",
+	"BG": "Europe/Sofia", "BR": "America/Sao_Paulo", "CA": "America/Toronto",
+	"CH": "Europe/Zurich", "CL": "America/Santiago", "CN": "Asia/Shanghai",
+	"CO": "America/Bogota", "CZ": "Europe/Prague", "DE": "Europe/Berlin",
+	"DK": "Europe/Copenhagen", "DZ": "Africa/Algiers", "EE": "Europe/Tallinn",
+	"EG": "Africa/Cairo", "ES": "Europe/Madrid", "FI": "Europe/Helsinki",
+	"FR": "Europe/Paris", "GB": "Europe/London", "GH": "Africa/Accra",
+	"GR": "Europe/Athens", "HK": "Asia/Hong_Kong", "HR": "Europe/Zagreb",
+	"HU": "Europe/Budapest", "ID": "Asia/Jakarta", "IE": "Europe/Dublin",
+	"IL": "Asia/Jerusalem", "IN": "Asia/Kolkata", "IS": "Atlantic/Reykjavik",
+	"IT": "Europe/Rome", "JP": "Asia/Tokyo", "KE": "Africa/Nairobi",
+	"KR": "Asia/Seoul", "LT": "Europe/Vilnius", "LU": "Europe/Luxembourg",
+	"LV": "Europe/Riga", "MA": "Africa/Casablanca", "MX": "America/Mexico_City",
+	"MY": "Asia/Kuala_Lumpur", "NG": "Africa/Lagos", "NL": "Europe/Amsterdam",
+	"NO": "Europe/Oslo", "NZ": "Pacific/Auckland", "PE": "America/Lima",
+	"PH": "Asia/Manila", "PK": "Asia/Karachi", "PL": "Europe/Warsaw",
+	"PT": "Europe/Lisbon", "RO": "Europe/Bucharest", "RS": "Europe/Belgrade",
+	"RU": "Europe/Moscow", "SA": "Asia/Riyadh", "SE": "Europe/Stockholm",
+	"SG": "Asia/Singapore", "SI": "Europe/Ljubljana", "SK": "Europe/Bratislava",
+	"TH": "Asia/Bangkok", "TR": "Europe/Istanbul", "TW": "Asia/Taipei",
+	"UA": "Europe/Kyiv", "US": "America/New_York", "UY": "America/Montevideo",
+	"VE": "America/Caracas", "VN": "Asia/Ho_Chi_Minh", "ZA": "Africa/Johannesburg",
+}
+
+// CountryTimezone returns the main timezone of a country given as an ISO 3166-1
+// alpha-2 code, or "" for countries it doesn't know
+func CountryTimezone(country string) string {
+	return countryTimezones[strings.ToUpper(strings.TrimSpace(country))]
+}
+
+// RecipientLocation returns the location of a recipient: their own timezone when
+// it is known, otherwise their country's, otherwise the fallback timezone
+func RecipientLocation(timezone, country, fallback string) *time.Location {
+	for _, name := range []string{timezone, CountryTimezone(country), fallback} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// AtLocal returns the moment the wall clock time of local reads in loc. Only the
+// date and time of day of local are used, not its location.
+func AtLocal(local time.Time, loc *time.Location) time.Time {
+	return time.Date(local.Year(), local.Month(), local.Day(),
+		local.Hour(), local.Minute(), local.Second(), 0, loc)
+}
@@ -0,0 +1,173 @@
+package sendwindow
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Defaults used when the policy doesn't say
+const (
+	DefaultStart    = "08:00"
+	DefaultEnd      = "20:00"
+	DefaultTimezone = "UTC"
+)
+
+// Policy limits scheduled and campaign sends to a daily window in the recipient's
+// local time. A window whose end is before its start spans midnight.
+type Policy struct {
+	Enabled  bool   `json:"enabled"`
+	Start    string `json:"start"`          // HH:MM, start of the allowed window
+	End      string `json:"end"`            // HH:MM, end of the allowed window
+	Days     []int  `json:"days,omitempty"` // Weekdays a window may start on, 0 is Sunday; empty for every day
+	Timezone string `json:"timezone"`       // IANA zone for recipients without a known timezone
+}
+
+// Validate checks the window times, weekdays and timezone
+func (p Policy) Validate() error {
+	start, err := parseClock(p.Start)
+	if err != nil {
+		return fmt.Errorf("start: %w", err)
+	}
+	end, err := parseClock(p.End)
+	if err != nil {
+		return fmt.Errorf("end: %w", err)
+	}
+	if start == end {
+		return fmt.Errorf("start and end must differ")
+	}
+	for _, d := range p.Days {
+		if d < 0 || d > 6 {
+			return fmt.Errorf("days must be between 0 (Sunday) and 6 (Saturday)")
+		}
+	}
+	if _, err := time.LoadLocation(p.Timezone); err != nil {
+		return fmt.Errorf("unknown timezone %q", p.Timezone)
+	}
+	return nil
+}
+
+// Next returns now when it is inside the window in the given timezone, otherwise
+// the start of the next window. An unknown timezone falls back to the policy's.
+func (p Policy) Next(now time.Time, timezone string) (time.Time, bool) {
+	if !p.Enabled {
+		return now, true
+	}
+	start, err := parseClock(p.Start)
+	if err != nil {
+		return now, true
+	}
+	end, err := parseClock(p.End)
+	if err != nil || start == end {
+		return now, true
+	}
+
+	loc := p.location(timezone)
+	local := now.In(loc)
+	midnight := time.Date(local.Year(), local.Month(), local.Day(), 0, 0, 0, 0, loc)
+
+	// A window that spans midnight may have started yesterday
+	for offset := -1; offset <= 7; offset++ {
+		day := midnight.AddDate(0, 0, offset)
+		if !p.allowsDay(day.Weekday()) {
+			continue
+		}
+		windowStart := clockOn(day, start)
+		windowEnd := clockOn(day, end)
+		if end < start {
+			windowEnd = clockOn(day.AddDate(0, 0, 1), end)
+		}
+		if !local.Before(windowStart) && local.Before(windowEnd) {
+			return now, true
+		}
+		if windowStart.After(local) {
+			return windowStart, false
+		}
+	}
+	return now, true
+}
+
+func (p Policy) allowsDay(day time.Weekday) bool {
+	if len(p.Days) == 0 {
+		return true
+	}
+	for _, d := range p.Days {
+		if time.Weekday(d) == day {
+			return true
+		}
+	}
+	return false
+}
+
+func (p Policy) location(timezone string) *time.Location {
+	for _, name := range []string{timezone, p.Timezone} {
+		if name == "" {
+			continue
+		}
+		if loc, err := time.LoadLocation(name); err == nil {
+			return loc
+		}
+	}
+	return time.UTC
+}
+
+// parseClock parses HH:MM into minutes after midnight
+func parseClock(value string) (int, error) {
+	t, err := time.Parse("15:04", strings.TrimSpace(value))
+	if err != nil {
+		return 0, fmt.Errorf("must be a time of day as HH:MM")
+	}
+	return t.Hour()*60 + t.Minute(), nil
+}
+
+// clockOn returns the wall clock time minutes after midnight on the day, which
+// differs from adding a duration on days with a DST change
+func clockOn(day time.Time, minutes int) time.Time {
+	return time.Date(day.Year(), day.Month(), day.Day(), minutes/60, minutes%60, 0, 0, day.Location())
+}
+
+// Load reads the organization's sending window from organizations.settings.
+// Organizations without one send at any time.
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	policy := Policy{Start: DefaultStart, End: DefaultEnd, Timezone: DefaultTimezone}
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'sendingWindow' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	return policy
+}
+
+// RecipientTimezone returns the timezone stored in the attributes of the org's
+// contact with the address, or "" when there is none
+func RecipientTimezone(ctx context.Context, db *sql.DB, orgID int64, email string) string {
+	var timezone sql.NullString
+	db.QueryRowContext(ctx, `
+		SELECT attributes->>'timezone' FROM contacts
+		WHERE org_id = $1 AND email = $2
+	`, orgID, email).Scan(&timezone)
+	return timezone.String
+}
+
+// ContactLocation returns the location of one of the org's contacts the way
+// campaigns sent at the recipient's local time find it: their timezone
+// attribute, their country's timezone, or the timezone of the org's window
+func ContactLocation(ctx context.Context, db *sql.DB, orgID, contactID int64) *time.Location {
+	var timezone, country sql.NullString
+	db.QueryRowContext(ctx, `
+		SELECT attributes->>'timezone', attributes->>'country' FROM contacts
+		WHERE id = $1 AND org_id = $2
+	`, contactID, orgID).Scan(&timezone, &country)
+	return RecipientLocation(timezone.String, country.String, Load(ctx, db, orgID).Timezone)
+}
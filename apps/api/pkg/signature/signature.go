@@ -0,0 +1,112 @@
+// Package signature renders identities' email signatures and puts them into
+// the emails they send.
+package signature
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+// Where the signature goes in replies and forwards. In new emails, which quote
+// nothing, it goes at the end either way.
+const (
+	PositionBelowReply = "below_reply" // Under the reply, above the quoted email
+	PositionBottom     = "bottom"      // At the very end, below the quoted email
+)
+
+// ValidPosition reports whether p is a signature position
+func ValidPosition(p string) bool {
+	return p == PositionBelowReply || p == PositionBottom
+}
+
+// textDelimiter comes before plain text signatures, so mail apps recognize
+// and can trim them (RFC 3676 section 4.3)
+const textDelimiter = "-- \n"
+
+// htmlClass marks the signature in HTML bodies
+const htmlClass = "mailat-signature"
+
+// Vars are what {{name}} placeholders in signatures are replaced with
+type Vars struct {
+	DisplayName string
+	Email       string
+}
+
+var placeholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Render replaces the placeholders of a signature: {{displayName}}, {{email}}
+// and {{domain}}. Values are escaped for HTML signatures. Unknown placeholders
+// are left as they are.
+func Render(tmpl string, vars Vars, isHTML bool) string {
+	domain := ""
+	if at := strings.LastIndex(vars.Email, "@"); at >= 0 {
+		domain = vars.Email[at+1:]
+	}
+	values := map[string]string{
+		"displayName": vars.DisplayName,
+		"email":       vars.Email,
+		"domain":      domain,
+	}
+	return placeholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		value, ok := values[placeholder.FindStringSubmatch(m)[1]]
+		if !ok {
+			return m
+		}
+		if isHTML {
+			return html.EscapeString(value)
+		}
+		return value
+	})
+}
+
+// textQuote finds where a plain text body starts quoting: the "On ... wrote:"
+// line of a reply, its first quoted line, or a forwarded message's header
+var textQuote = regexp.MustCompile(`(?m)^(On .+wrote:\s*$|>|-{5,} ?Forwarded message)`)
+
+// htmlQuote finds where an HTML body starts quoting
+var htmlQuote = regexp.MustCompile(`(?i)<div[^>]*class="[^"]*(gmail_quote|mailat-quote)|<blockquote|-{5,} ?Forwarded message`)
+
+// InsertText puts a rendered plain text signature into a body, unless it's
+// already there
+func InsertText(body, sig, position string) string {
+	sig = strings.TrimSpace(sig)
+	if sig == "" || strings.Contains(body, textDelimiter+sig) {
+		return body
+	}
+	block := textDelimiter + sig
+
+	if position != PositionBottom {
+		if loc := textQuote.FindStringIndex(body); loc != nil {
+			reply := strings.TrimRight(body[:loc[0]], " \t\n")
+			return reply + "\n\n" + block + "\n\n" + body[loc[0]:]
+		}
+	}
+	body = strings.TrimRight(body, " \t\n")
+	if body == "" {
+		return block
+	}
+	return body + "\n\n" + block
+}
+
+// InsertHTML puts a rendered HTML signature into a body, unless it's already
+// there
+func InsertHTML(body, sig, position string) string {
+	sig = strings.TrimSpace(sig)
+	if sig == "" || strings.Contains(body, `class="`+htmlClass+`"`) {
+		return body
+	}
+	block := `<div class="` + htmlClass + `">-- <br>` + sig + `</div>`
+
+	if position != PositionBottom {
+		if loc := htmlQuote.FindStringIndex(body); loc != nil {
+			return body[:loc[0]] + block + body[loc[0]:]
+		}
+	}
+	// Inside the body element of full documents
+	lower := strings.ToLower(body)
+	if i := strings.LastIndex(lower, "</body>"); i >= 0 {
+		return body[:i] + block + body[i:]
+	}
+	return body + block
+}
@@ -0,0 +1,95 @@
+// Package snippet renders the canned responses users insert into emails they
+// compose.
+package snippet
+
+import (
+	"html"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Who can see and insert a snippet
+const (
+	ScopePersonal = "personal" // Only its author
+	ScopeOrg      = "org"      // Everyone in the organization
+)
+
+// ValidScope reports whether s is a snippet scope
+func ValidScope(s string) bool {
+	return s == ScopePersonal || s == ScopeOrg
+}
+
+// shortcutPattern is what shortcuts look like: typed after a slash in the
+// composer, such as /thanks
+var shortcutPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,49}$`)
+
+// NormalizeShortcut lowercases a shortcut and drops its leading slash
+func NormalizeShortcut(s string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(s), "/"))
+}
+
+// ValidShortcut reports whether a normalized shortcut is usable
+func ValidShortcut(s string) bool {
+	return shortcutPattern.MatchString(s)
+}
+
+// Variables filled in from the email being composed. Others are supplied
+// when inserting the snippet.
+const (
+	VarRecipientName      = "recipientName"
+	VarRecipientFirstName = "recipientFirstName"
+	VarRecipientEmail     = "recipientEmail"
+	VarSenderName         = "senderName"
+	VarSenderEmail        = "senderEmail"
+)
+
+var placeholder = regexp.MustCompile(`\{\{\s*(\w+)\s*\}\}`)
+
+// Variables returns the distinct placeholders of the given texts, in order
+func Variables(texts ...string) []string {
+	seen := make(map[string]bool)
+	var vars []string
+	for _, text := range texts {
+		for _, match := range placeholder.FindAllStringSubmatch(text, -1) {
+			if !seen[match[1]] {
+				seen[match[1]] = true
+				vars = append(vars, match[1])
+			}
+		}
+	}
+	return vars
+}
+
+// Render replaces the placeholders of a snippet with vars, escaping values in
+// HTML. Placeholders without a value are removed and returned, sorted, so the
+// composer can ask for them.
+func Render(tmpl string, vars map[string]string, isHTML bool) (string, []string) {
+	missing := make(map[string]bool)
+	out := placeholder.ReplaceAllStringFunc(tmpl, func(m string) string {
+		name := placeholder.FindStringSubmatch(m)[1]
+		value, ok := vars[name]
+		if !ok {
+			missing[name] = true
+			return ""
+		}
+		if isHTML {
+			return html.EscapeString(value)
+		}
+		return value
+	})
+	names := make([]string, 0, len(missing))
+	for name := range missing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return out, names
+}
+
+// FirstName returns the first word of a display name
+func FirstName(name string) string {
+	if fields := strings.Fields(name); len(fields) > 0 {
+		return fields[0]
+	}
+	return ""
+}
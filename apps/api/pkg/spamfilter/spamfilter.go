@@ -0,0 +1,241 @@
+// Package spamfilter is a naive Bayesian spam filter that each identity trains
+// by marking emails as spam or not spam. It catches the emails the receiving
+// provider let through that look like those the identity's owner marked as
+// spam.
+package spamfilter
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/lib/pq"
+)
+
+// Verdicts an email is trained with
+const (
+	VerdictSpam = "spam"
+	VerdictHam  = "ham"
+)
+
+const (
+	// MinMessages is how many spam and how many legitimate emails an identity
+	// must have marked before its filter classifies anything
+	MinMessages = 10
+	// SpamThreshold is the probability from which an email is spam
+	SpamThreshold = 0.99
+	// interestingTokens is how many tokens, those furthest from neutral, an
+	// email is classified by
+	interestingTokens = 15
+	// maxTokens bounds the tokens taken from an email
+	maxTokens = 1000
+)
+
+// Tokens returns the distinct tokens of an email: the words of its subject and
+// body, and its sender's address and domain. The body is the text one, or the
+// HTML one without its tags.
+func Tokens(from, subject, textBody, htmlBody string) []string {
+	seen := map[string]bool{}
+	var tokens []string
+	add := func(token string) {
+		if len(tokens) < maxTokens && !seen[token] {
+			seen[token] = true
+			tokens = append(tokens, token)
+		}
+	}
+
+	from = strings.ToLower(strings.TrimSpace(from))
+	if from != "" {
+		add("from:" + from)
+		if at := strings.LastIndex(from, "@"); at >= 0 {
+			add("fromdomain:" + from[at+1:])
+		}
+	}
+	for _, word := range words(subject) {
+		add("subject:" + word)
+	}
+	body := textBody
+	if strings.TrimSpace(body) == "" {
+		body = stripTags(htmlBody)
+	}
+	for _, word := range words(body) {
+		add(word)
+	}
+	return tokens
+}
+
+// words splits text into lowercase words of 3 to 30 letters and digits,
+// leaving out numbers
+func words(text string) []string {
+	var result []string
+	for _, word := range strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '$' && r != '\''
+	}) {
+		word = strings.Trim(word, "'")
+		n := len([]rune(word))
+		if n < 3 || n > 30 || strings.IndexFunc(word, func(r rune) bool { return !unicode.IsDigit(r) }) < 0 {
+			continue
+		}
+		result = append(result, word)
+	}
+	return result
+}
+
+// stripTags replaces the tags of HTML with spaces
+func stripTags(html string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range html {
+		switch {
+		case r == '<':
+			inTag = true
+			b.WriteByte(' ')
+		case r == '>':
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// Learn trains an identity's filter with an email's tokens as spam or ham. An
+// email trained before with the other verdict is unlearnt from it first, and
+// one trained with the same verdict is left alone.
+func Learn(ctx context.Context, db *sql.DB, identityID int64, tokens []string, previous, verdict string) error {
+	if previous == verdict {
+		return nil
+	}
+	var spamDelta, hamDelta int
+	switch verdict {
+	case VerdictSpam:
+		spamDelta = 1
+	case VerdictHam:
+		hamDelta = 1
+	default:
+		return fmt.Errorf("unknown verdict %q", verdict)
+	}
+	switch previous {
+	case VerdictSpam:
+		spamDelta--
+	case VerdictHam:
+		hamDelta--
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to train spam filter: %w", err)
+	}
+	defer tx.Rollback()
+
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO spam_filter_totals (identity_id, spam_count, ham_count, updated_at)
+		VALUES ($1, GREATEST($2, 0), GREATEST($3, 0), NOW())
+		ON CONFLICT (identity_id) DO UPDATE SET
+			spam_count = GREATEST(spam_filter_totals.spam_count + $2, 0),
+			ham_count = GREATEST(spam_filter_totals.ham_count + $3, 0),
+			updated_at = NOW()
+	`, identityID, spamDelta, hamDelta)
+	if err != nil {
+		return fmt.Errorf("failed to train spam filter: %w", err)
+	}
+
+	if len(tokens) > 0 {
+		_, err = tx.ExecContext(ctx, `
+			INSERT INTO spam_filter_tokens (identity_id, token, spam_count, ham_count)
+			SELECT $1, t, GREATEST($3, 0), GREATEST($4, 0) FROM unnest($2::text[]) t
+			ON CONFLICT (identity_id, token) DO UPDATE SET
+				spam_count = GREATEST(spam_filter_tokens.spam_count + $3, 0),
+				ham_count = GREATEST(spam_filter_tokens.ham_count + $4, 0)
+		`, identityID, pq.Array(tokens), spamDelta, hamDelta)
+		if err != nil {
+			return fmt.Errorf("failed to train spam filter: %w", err)
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to train spam filter: %w", err)
+	}
+	return nil
+}
+
+// Score returns the probability an email with the given tokens is spam, by
+// the identity's filter. It reports false when the filter isn't trained
+// enough to tell.
+func Score(ctx context.Context, db *sql.DB, identityID int64, tokens []string) (float64, bool, error) {
+	var spamMessages, hamMessages int
+	err := db.QueryRowContext(ctx, `
+		SELECT spam_count, ham_count FROM spam_filter_totals WHERE identity_id = $1
+	`, identityID).Scan(&spamMessages, &hamMessages)
+	if err == sql.ErrNoRows {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to score email: %w", err)
+	}
+	if spamMessages < MinMessages || hamMessages < MinMessages {
+		return 0, false, nil
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT spam_count, ham_count FROM spam_filter_tokens
+		WHERE identity_id = $1 AND token = ANY($2)
+	`, identityID, pq.Array(tokens))
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to score email: %w", err)
+	}
+	defer rows.Close()
+
+	var probabilities []float64
+	for rows.Next() {
+		var spam, ham int
+		if rows.Scan(&spam, &ham) != nil || spam+ham == 0 {
+			continue
+		}
+		probabilities = append(probabilities, tokenProbability(spam, ham, spamMessages, hamMessages))
+	}
+	if err := rows.Err(); err != nil {
+		return 0, false, fmt.Errorf("failed to score email: %w", err)
+	}
+	return Combine(probabilities), true, nil
+}
+
+// tokenProbability is how likely an email with a token is spam, given how
+// many spam and ham emails had it out of all those trained. Rare tokens are
+// pulled towards neutral, so a token seen once doesn't decide anything.
+func tokenProbability(spam, ham, spamMessages, hamMessages int) float64 {
+	spamRate := float64(spam) / float64(spamMessages)
+	hamRate := float64(ham) / float64(hamMessages)
+	p := spamRate / (spamRate + hamRate)
+	n := float64(spam + ham)
+	p = (0.5 + n*p) / (1 + n)
+	return math.Min(0.99, math.Max(0.01, p))
+}
+
+// Combine returns the probability an email is spam from the probabilities of
+// its tokens, by the interestingTokens furthest from neutral. An email with
+// no known tokens is neutral.
+func Combine(probabilities []float64) float64 {
+	if len(probabilities) == 0 {
+		return 0.5
+	}
+	sorted := append([]float64(nil), probabilities...)
+	sort.Slice(sorted, func(i, j int) bool {
+		return math.Abs(sorted[i]-0.5) > math.Abs(sorted[j]-0.5)
+	})
+	if len(sorted) > interestingTokens {
+		sorted = sorted[:interestingTokens]
+	}
+
+	// Products of many probabilities underflow, so they're summed as logs
+	var logSpam, logHam float64
+	for _, p := range sorted {
+		logSpam += math.Log(p)
+		logHam += math.Log(1 - p)
+	}
+	return 1 / (1 + math.Exp(logHam-logSpam))
+}
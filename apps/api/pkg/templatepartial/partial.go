@@ -0,0 +1,115 @@
+// Package templatepartial loads the partials an org's templates include with
+// {{> name}}. An org defines its own, and header, footer and button are built
+// in: header and footer are the email header and footer of the org's branding,
+// button a bulletproof button in its brand color. Templates that use the layout
+// get the header and footer around their HTML body unless they include them
+// themselves.
+package templatepartial
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/dublyo/mailat/api/pkg/templating"
+)
+
+// Built-in partials
+const (
+	Header = "header"
+	Footer = "footer"
+	Button = "button"
+)
+
+// defaultButtonColor is used when the org has no brand color
+const defaultButtonColor = "#4F46E5"
+
+var hexColor = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// buttonPartial renders {{> button url=... label=...}}, optionally with color=
+func buttonPartial(color string) string {
+	return `<table role="presentation" border="0" cellpadding="0" cellspacing="0" style="margin:16px 0"><tr>` +
+		`<td align="center" bgcolor="{{color | default: "` + color + `"}}" style="border-radius:6px">` +
+		`<a href="{{url}}" target="_blank" style="display:inline-block;padding:12px 24px;font-family:Arial,sans-serif;` +
+		`font-size:16px;font-weight:bold;color:#ffffff;text-decoration:none;border-radius:6px">{{label}}</a>` +
+		`</td></tr></table>`
+}
+
+// BuiltIn returns the built-in partials of an org, from its branding
+func BuiltIn(ctx context.Context, db *sql.DB, orgID int64) (templating.Partials, error) {
+	var header, footer, color string
+	err := db.QueryRowContext(ctx, `
+		SELECT COALESCE(email_header_html, ''), COALESCE(email_footer_html, ''), COALESCE(primary_color, '')
+		FROM tenant_brandings WHERE org_id = $1
+	`, orgID).Scan(&header, &footer, &color)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, fmt.Errorf("failed to load branding: %w", err)
+	}
+	if !hexColor.MatchString(color) {
+		color = defaultButtonColor
+	}
+
+	return templating.Partials{
+		Header: header,
+		Footer: footer,
+		Button: buttonPartial(color),
+	}, nil
+}
+
+// Load returns the partials templates of an org can include. The org's own
+// partials replace built-in ones of the same name.
+func Load(ctx context.Context, db *sql.DB, orgID int64) (templating.Partials, error) {
+	partials, err := BuiltIn(ctx, db, orgID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.QueryContext(ctx, `
+		SELECT name, content FROM template_partials WHERE org_id = $1
+	`, orgID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load partials: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var name, content string
+		if err := rows.Scan(&name, &content); err != nil {
+			continue
+		}
+		partials[name] = content
+	}
+	return partials, nil
+}
+
+var bodyOpenTag = regexp.MustCompile(`(?i)<body[^>]*>`)
+var bodyCloseTag = regexp.MustCompile(`(?i)</body\s*>`)
+
+// WithLayout places the header and footer partials at the start and end of an
+// HTML body, inside its <body> element, unless the body includes them itself or
+// they are empty
+func WithLayout(html string, partials templating.Partials) string {
+	included := map[string]bool{}
+	for _, name := range templating.PartialNames(html) {
+		included[name] = true
+	}
+
+	if strings.TrimSpace(partials[Header]) != "" && !included[Header] {
+		if loc := bodyOpenTag.FindStringIndex(html); loc != nil {
+			html = html[:loc[1]] + "{{> header}}" + html[loc[1]:]
+		} else {
+			html = "{{> header}}" + html
+		}
+	}
+	if strings.TrimSpace(partials[Footer]) != "" && !included[Footer] {
+		if locs := bodyCloseTag.FindAllStringIndex(html, -1); len(locs) > 0 {
+			last := locs[len(locs)-1]
+			html = html[:last[0]] + "{{> footer}}" + html[last[0]:]
+		} else {
+			html += "{{> footer}}"
+		}
+	}
+	return html
+}
@@ -0,0 +1,369 @@
+package templating
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"math"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// filterFunc transforms a value. Filters only see values, never the process.
+type filterFunc func(v any, args []any) (any, error)
+
+var filters map[string]filterFunc
+
+func init() {
+	filters = map[string]filterFunc{
+		"default":    defaultFilter,
+		"upcase":     stringFilter(strings.ToUpper),
+		"downcase":   stringFilter(strings.ToLower),
+		"capitalize": stringFilter(capitalize),
+		"strip":      stringFilter(strings.TrimSpace),
+		"escape":     stringFilter(html.EscapeString),
+		"url_encode": stringFilter(url.QueryEscape),
+		"json":       jsonFilter,
+		"truncate":   truncateFilter,
+		"replace":    replaceFilter,
+		"append":     appendFilter,
+		"prepend":    prependFilter,
+		"join":       joinFilter,
+		"size":       sizeFilter,
+		"first":      firstFilter,
+		"last":       lastFilter,
+		"date":       dateFilter,
+		"round":      roundFilter,
+		"eq":         compareFilter(func(c int) bool { return c == 0 }),
+		"ne":         compareFilter(func(c int) bool { return c != 0 }),
+		"gt":         compareFilter(func(c int) bool { return c > 0 }),
+		"gte":        compareFilter(func(c int) bool { return c >= 0 }),
+		"lt":         compareFilter(func(c int) bool { return c < 0 }),
+		"lte":        compareFilter(func(c int) bool { return c <= 0 }),
+	}
+	filters["upper"] = filters["upcase"]
+	filters["lower"] = filters["downcase"]
+	filters["trim"] = filters["strip"]
+}
+
+func stringFilter(fn func(string) string) filterFunc {
+	return func(v any, args []any) (any, error) {
+		return fn(toString(v)), nil
+	}
+}
+
+func arg(args []any, i int) (any, bool) {
+	if i < len(args) {
+		return args[i], true
+	}
+	return nil, false
+}
+
+// defaultFilter replaces a missing or empty value: {{name | default: "there"}}
+func defaultFilter(v any, args []any) (any, error) {
+	fallback, ok := arg(args, 0)
+	if !ok {
+		return nil, fmt.Errorf("needs a value")
+	}
+	if !truthy(v) {
+		if b, isBool := v.(bool); isBool && !b {
+			return v, nil // false is a value
+		}
+		return fallback, nil
+	}
+	return v, nil
+}
+
+func capitalize(s string) string {
+	r, size := utf8.DecodeRuneInString(s)
+	if r == utf8.RuneError {
+		return s
+	}
+	return string(unicode.ToUpper(r)) + s[size:]
+}
+
+// truncateFilter shortens to n characters, ending with "..." or the given suffix
+func truncateFilter(v any, args []any) (any, error) {
+	s := toString(v)
+	n, err := intArg(args, 0)
+	if err != nil {
+		return nil, err
+	}
+	suffix := "..."
+	if a, ok := arg(args, 1); ok {
+		suffix = toString(a)
+	}
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s, nil
+	}
+	keep := n - utf8.RuneCountInString(suffix)
+	if keep < 0 {
+		keep = 0
+	}
+	return string(runes[:keep]) + suffix, nil
+}
+
+func replaceFilter(v any, args []any) (any, error) {
+	if len(args) != 2 {
+		return nil, fmt.Errorf("needs the text to replace and its replacement")
+	}
+	return strings.ReplaceAll(toString(v), toString(args[0]), toString(args[1])), nil
+}
+
+func appendFilter(v any, args []any) (any, error) {
+	a, ok := arg(args, 0)
+	if !ok {
+		return nil, fmt.Errorf("needs a value")
+	}
+	return toString(v) + toString(a), nil
+}
+
+func prependFilter(v any, args []any) (any, error) {
+	a, ok := arg(args, 0)
+	if !ok {
+		return nil, fmt.Errorf("needs a value")
+	}
+	return toString(a) + toString(v), nil
+}
+
+func joinFilter(v any, args []any) (any, error) {
+	sep := ", "
+	if a, ok := arg(args, 0); ok {
+		sep = toString(a)
+	}
+	switch v := v.(type) {
+	case []string:
+		return strings.Join(v, sep), nil
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = toString(item)
+		}
+		return strings.Join(parts, sep), nil
+	}
+	return toString(v), nil
+}
+
+// jsonFilter encodes a value as JSON, for values inside JSON documents like
+// webhook payloads
+func jsonFilter(v any, args []any) (any, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+func sizeFilter(v any, args []any) (any, error) {
+	switch v := v.(type) {
+	case nil:
+		return float64(0), nil
+	case string:
+		return float64(utf8.RuneCountInString(v)), nil
+	case []any:
+		return float64(len(v)), nil
+	case []string:
+		return float64(len(v)), nil
+	case map[string]any:
+		return float64(len(v)), nil
+	case map[string]string:
+		return float64(len(v)), nil
+	}
+	return float64(len(toString(v))), nil
+}
+
+func firstFilter(v any, args []any) (any, error) {
+	switch v := v.(type) {
+	case []any:
+		if len(v) > 0 {
+			return v[0], nil
+		}
+	case []string:
+		if len(v) > 0 {
+			return v[0], nil
+		}
+	}
+	return nil, nil
+}
+
+func lastFilter(v any, args []any) (any, error) {
+	switch v := v.(type) {
+	case []any:
+		if len(v) > 0 {
+			return v[len(v)-1], nil
+		}
+	case []string:
+		if len(v) > 0 {
+			return v[len(v)-1], nil
+		}
+	}
+	return nil, nil
+}
+
+func roundFilter(v any, args []any) (any, error) {
+	n, ok := toNumber(v)
+	if !ok {
+		return v, nil
+	}
+	places := 0
+	if _, given := arg(args, 0); given {
+		p, err := intArg(args, 0)
+		if err != nil {
+			return nil, err
+		}
+		places = p
+	}
+	if places < 0 || places > 10 {
+		return nil, fmt.Errorf("decimal places must be between 0 and 10")
+	}
+	scale := math.Pow(10, float64(places))
+	return math.Round(n*scale) / scale, nil
+}
+
+// compareFilter compares numbers numerically and anything else as text:
+// {{#if plan | eq: "pro"}}
+func compareFilter(match func(int) bool) filterFunc {
+	return func(v any, args []any) (any, error) {
+		other, ok := arg(args, 0)
+		if !ok {
+			return nil, fmt.Errorf("needs a value to compare with")
+		}
+		a, aNum := toNumber(v)
+		b, bNum := toNumber(other)
+		if aNum && bNum {
+			switch {
+			case a < b:
+				return match(-1), nil
+			case a > b:
+				return match(1), nil
+			}
+			return match(0), nil
+		}
+		return match(strings.Compare(toString(v), toString(other))), nil
+	}
+}
+
+// dateFilter formats a time given as RFC 3339, a YYYY-MM-DD date, Unix seconds or
+// "now". The format is strftime (%Y-%m-%d) or a Go layout (2006-01-02), and an
+// optional second argument is the IANA timezone: {{ts | date: "%b %d, %Y", "Europe/Paris"}}
+func dateFilter(v any, args []any) (any, error) {
+	t, ok := toTime(v)
+	if !ok {
+		return v, nil // Not a time, left as is
+	}
+
+	layout := time.RFC3339
+	if a, given := arg(args, 0); given {
+		layout = toString(a)
+		if strings.Contains(layout, "%") {
+			layout = strftimeLayout(layout)
+		}
+	}
+	if a, given := arg(args, 1); given {
+		loc, err := time.LoadLocation(toString(a))
+		if err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", toString(a))
+		}
+		t = t.In(loc)
+	}
+	return t.Format(layout), nil
+}
+
+func toTime(v any) (time.Time, bool) {
+	switch v := v.(type) {
+	case time.Time:
+		return v, true
+	case float64:
+		return time.Unix(int64(v), 0).UTC(), true
+	case int64:
+		return time.Unix(v, 0).UTC(), true
+	case json.Number:
+		if n, err := v.Int64(); err == nil {
+			return time.Unix(n, 0).UTC(), true
+		}
+	case string:
+		if v == "now" || v == "today" {
+			return time.Now().UTC(), true
+		}
+		for _, layout := range []string{time.RFC3339Nano, "2006-01-02T15:04:05", "2006-01-02 15:04:05", "2006-01-02"} {
+			if t, err := time.Parse(layout, v); err == nil {
+				return t, true
+			}
+		}
+		if n, err := strconv.ParseInt(v, 10, 64); err == nil {
+			return time.Unix(n, 0).UTC(), true
+		}
+	}
+	return time.Time{}, false
+}
+
+var strftimeDirectives = map[byte]string{
+	'Y': "2006", 'y': "06", 'm': "01", 'd': "02", 'e': "_2", 'H': "15", 'I': "03",
+	'M': "04", 'S': "05", 'p': "PM", 'B': "January", 'b': "Jan", 'h': "Jan",
+	'A': "Monday", 'a': "Mon", 'Z': "MST", 'z': "-0700", 'j': "002", '%': "%",
+}
+
+var strftimeUnpadded = map[byte]string{'m': "1", 'd': "2", 'H': "15", 'I': "3", 'M': "4", 'S': "5"}
+
+// strftimeLayout converts a strftime format to a Go layout. Text between
+// directives that would read as a Go layout element is not escaped, as Go layouts
+// have no escaping.
+func strftimeLayout(format string) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 == len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		i++
+		if format[i] == '-' && i+1 < len(format) {
+			if layout, ok := strftimeUnpadded[format[i+1]]; ok {
+				b.WriteString(layout)
+				i++
+				continue
+			}
+		}
+		if layout, ok := strftimeDirectives[format[i]]; ok {
+			b.WriteString(layout)
+		} else {
+			b.WriteByte('%')
+			b.WriteByte(format[i])
+		}
+	}
+	return b.String()
+}
+
+func toNumber(v any) (float64, bool) {
+	switch v := v.(type) {
+	case float64:
+		return v, true
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	case json.Number:
+		n, err := v.Float64()
+		return n, err == nil
+	case string:
+		n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func intArg(args []any, i int) (int, error) {
+	a, ok := arg(args, i)
+	if !ok {
+		return 0, fmt.Errorf("needs a number")
+	}
+	n, ok := toNumber(a)
+	if !ok || n < 0 || n > math.MaxInt32 {
+		return 0, fmt.Errorf("needs a positive number")
+	}
+	return int(n), nil
+}
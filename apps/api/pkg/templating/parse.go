@@ -0,0 +1,624 @@
+package templating
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Templates use Handlebars-style tags with Liquid-style filters:
+//
+//	{{name}}                           a variable, {{user.name}} a nested one
+//	{{name | default: "there"}}        a variable passed through filters
+//	{{#if vip}}...{{else if trial}}...{{else}}...{{/if}}
+//	{{#unless optedOut}}...{{/unless}}
+//	{{#each items}}{{@index}} {{name}}{{else}}no items{{/each}}
+//	{{#with address}}{{city}}{{/with}}
+//	{{> footer}}                       a partial, {{> button url=link label="Go"}} with parameters
+//	{{! comment }}
+//
+// Templates only read the variables they are given and call the built-in filters,
+// so they can't reach anything else in the process.
+
+// Limits that keep a template from using unbounded time or memory
+const (
+	MaxTemplateSize = 1 << 20 // Bytes of template source
+	MaxDepth        = 20      // Nested blocks
+	MaxPartialDepth = 10      // Partials including partials
+)
+
+// Error is a template that doesn't parse or render
+type Error struct {
+	Line    int
+	Message string
+	partial bool // Already names the partial it happened in
+}
+
+func (e *Error) Error() string {
+	if e.Line > 0 {
+		return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+	}
+	return e.Message
+}
+
+func errorf(line int, format string, args ...any) *Error {
+	return &Error{Line: line, Message: fmt.Sprintf(format, args...)}
+}
+
+type tokenKind int
+
+const (
+	tokenText tokenKind = iota
+	tokenOutput
+	tokenOpen
+	tokenElse
+	tokenClose
+	tokenPartial
+)
+
+type token struct {
+	kind tokenKind
+	text string // Text, or the expression of a tag
+	name string // Block name of open and close tags
+	line int
+}
+
+// tokenize splits template source into text and tags
+func tokenize(src string) ([]token, error) {
+	var tokens []token
+	line := 1
+	pos := 0
+	for pos < len(src) {
+		start := strings.Index(src[pos:], "{{")
+		if start < 0 {
+			tokens = append(tokens, token{kind: tokenText, text: src[pos:], line: line})
+			break
+		}
+		if start > 0 {
+			text := src[pos : pos+start]
+			tokens = append(tokens, token{kind: tokenText, text: text, line: line})
+			line += strings.Count(text, "\n")
+			pos += start
+		}
+
+		rest := src[pos:]
+		var body string
+		var end int
+		switch {
+		case strings.HasPrefix(rest, "{{!--"):
+			end = strings.Index(rest, "--}}")
+			if end < 0 {
+				return nil, errorf(line, "unclosed comment")
+			}
+			end += len("--}}")
+		case strings.HasPrefix(rest, "{{!"):
+			end = strings.Index(rest, "}}")
+			if end < 0 {
+				return nil, errorf(line, "unclosed comment")
+			}
+			end += len("}}")
+		case strings.HasPrefix(rest, "{{{"):
+			// Triple braces output unescaped in Handlebars; values are never escaped here
+			end = strings.Index(rest, "}}}")
+			if end < 0 {
+				return nil, errorf(line, "unclosed {{{")
+			}
+			body = rest[3:end]
+			end += len("}}}")
+		default:
+			end = strings.Index(rest, "}}")
+			if end < 0 {
+				return nil, errorf(line, "unclosed {{")
+			}
+			body = rest[2:end]
+			end += len("}}")
+		}
+
+		if body = strings.TrimSpace(body); body != "" {
+			tok, err := tagToken(body, line)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, tok)
+		}
+		line += strings.Count(rest[:end], "\n")
+		pos += end
+	}
+	return tokens, nil
+}
+
+func tagToken(body string, line int) (token, error) {
+	switch {
+	case body[0] == '#':
+		name, args, _ := strings.Cut(strings.TrimSpace(body[1:]), " ")
+		switch name {
+		case "if", "unless", "each", "with":
+		default:
+			return token{}, errorf(line, "unknown block {{#%s}}", name)
+		}
+		if strings.TrimSpace(args) == "" {
+			return token{}, errorf(line, "{{#%s}} needs an expression", name)
+		}
+		return token{kind: tokenOpen, name: name, text: strings.TrimSpace(args), line: line}, nil
+	case body[0] == '/':
+		return token{kind: tokenClose, name: strings.TrimSpace(body[1:]), line: line}, nil
+	case body[0] == '>':
+		args := strings.TrimSpace(body[1:])
+		if args == "" {
+			return token{}, errorf(line, "{{>}} needs a partial name")
+		}
+		return token{kind: tokenPartial, text: args, line: line}, nil
+	case body == "else":
+		return token{kind: tokenElse, line: line}, nil
+	case strings.HasPrefix(body, "else if "):
+		return token{kind: tokenElse, text: strings.TrimSpace(body[len("else if "):]), line: line}, nil
+	}
+	return token{kind: tokenOutput, text: body, line: line}, nil
+}
+
+type node interface{}
+
+type textNode struct {
+	text string
+}
+
+type outputNode struct {
+	expr *expression
+	line int
+}
+
+type ifNode struct {
+	cond   *expression
+	negate bool
+	then   []node
+	els    []node
+	line   int
+}
+
+type eachNode struct {
+	expr *expression
+	body []node
+	els  []node
+	line int
+}
+
+type withNode struct {
+	expr *expression
+	body []node
+	els  []node
+	line int
+}
+
+// partialNode includes a named partial. Its parameters are variables of the
+// partial, which also sees the variables of where it is included.
+type partialNode struct {
+	name   string
+	params []partialParam
+	line   int
+}
+
+type partialParam struct {
+	name  string
+	value operand
+}
+
+type parser struct {
+	tokens []token
+	pos    int
+}
+
+// parseList parses nodes up to an else or close tag, which it returns, or to the
+// end of the template
+func (p *parser) parseList(depth int) ([]node, *token, error) {
+	var nodes []node
+	for p.pos < len(p.tokens) {
+		tok := p.tokens[p.pos]
+		p.pos++
+		switch tok.kind {
+		case tokenText:
+			nodes = append(nodes, &textNode{text: tok.text})
+		case tokenOutput:
+			expr, err := parseExpression(tok.text, tok.line)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, &outputNode{expr: expr, line: tok.line})
+		case tokenPartial:
+			n, err := parsePartial(tok.text, tok.line)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, n)
+		case tokenOpen:
+			if depth >= MaxDepth {
+				return nil, nil, errorf(tok.line, "blocks nested deeper than %d", MaxDepth)
+			}
+			n, err := p.parseBlock(tok.name, tok.text, tok.name, tok.line, depth+1)
+			if err != nil {
+				return nil, nil, err
+			}
+			nodes = append(nodes, n)
+		case tokenElse, tokenClose:
+			return nodes, &tok, nil
+		}
+	}
+	return nodes, nil, nil
+}
+
+// parseBlock parses the body of a block up to its close tag. An {{else if}} opens
+// an if block that shares the close tag of the block it is in.
+func (p *parser) parseBlock(name, args, closeName string, line, depth int) (node, error) {
+	expr, err := parseExpression(args, line)
+	if err != nil {
+		return nil, err
+	}
+
+	body, term, err := p.parseList(depth)
+	if err != nil {
+		return nil, err
+	}
+	var els []node
+	if term != nil && term.kind == tokenElse {
+		if term.text != "" {
+			if name != "if" && name != "unless" {
+				return nil, errorf(term.line, "{{else if}} inside {{#%s}}", name)
+			}
+			// The nested block consumes the close tag
+			nested, err := p.parseBlock("if", term.text, closeName, term.line, depth)
+			if err != nil {
+				return nil, err
+			}
+			els = []node{nested}
+			term = nil
+		} else {
+			els, term, err = p.parseList(depth)
+			if err != nil {
+				return nil, err
+			}
+			if term == nil {
+				return nil, errorf(line, "unclosed {{#%s}}", closeName)
+			}
+		}
+	} else if term == nil {
+		return nil, errorf(line, "unclosed {{#%s}}", closeName)
+	}
+
+	if term != nil {
+		if term.kind == tokenElse {
+			return nil, errorf(term.line, "unexpected {{else}}")
+		}
+		if term.name != closeName {
+			return nil, errorf(term.line, "{{/%s}} closes {{#%s}}", term.name, closeName)
+		}
+	}
+
+	switch name {
+	case "if", "unless":
+		return &ifNode{cond: expr, negate: name == "unless", then: body, els: els, line: line}, nil
+	case "each":
+		return &eachNode{expr: expr, body: body, els: els, line: line}, nil
+	default:
+		return &withNode{expr: expr, body: body, els: els, line: line}, nil
+	}
+}
+
+// parsePartial parses `name key=value key=value`
+func parsePartial(src string, line int) (*partialNode, error) {
+	fields := splitOutsideQuotes(src, ' ')
+	if fields == nil {
+		return nil, errorf(line, "unterminated string in %q", src)
+	}
+
+	n := &partialNode{line: line}
+	for _, field := range fields {
+		if field == "" {
+			continue
+		}
+		if n.name == "" {
+			if !ValidPartialName(field) {
+				return nil, errorf(line, "invalid partial name %q", field)
+			}
+			n.name = field
+			continue
+		}
+		key, value, ok := strings.Cut(field, "=")
+		if !ok || !validSegment(key) || strings.HasPrefix(key, "@") {
+			return nil, errorf(line, "partial parameters are written key=value, got %q", field)
+		}
+		op, err := parseOperand(value, line)
+		if err != nil {
+			return nil, err
+		}
+		n.params = append(n.params, partialParam{name: key, value: op})
+	}
+	return n, nil
+}
+
+// ValidPartialName reports whether a name can be used for a partial: letters,
+// digits, dashes and underscores
+func ValidPartialName(name string) bool {
+	return len(name) <= 100 && validSegment(name) && !strings.HasPrefix(name, "@")
+}
+
+// expression is an operand passed through a chain of filters
+type expression struct {
+	operand operand
+	filters []filterCall
+}
+
+type operand struct {
+	path    []string // Variable path, nil for literals
+	literal any
+}
+
+type filterCall struct {
+	name string
+	fn   filterFunc
+	args []operand
+}
+
+// parseExpression parses `operand | filter: arg, arg | filter`
+func parseExpression(src string, line int) (*expression, error) {
+	parts := splitOutsideQuotes(src, '|')
+	if parts == nil {
+		return nil, errorf(line, "unterminated string in %q", src)
+	}
+
+	op, err := parseOperand(parts[0], line)
+	if err != nil {
+		return nil, err
+	}
+	expr := &expression{operand: op}
+
+	for _, part := range parts[1:] {
+		name, rawArgs, hasArgs := strings.Cut(part, ":")
+		name = strings.TrimSpace(name)
+		fn, ok := filters[name]
+		if !ok {
+			return nil, errorf(line, "unknown filter %q", name)
+		}
+		call := filterCall{name: name, fn: fn}
+		if hasArgs {
+			for _, rawArg := range splitOutsideQuotes(rawArgs, ',') {
+				arg, err := parseOperand(rawArg, line)
+				if err != nil {
+					return nil, err
+				}
+				call.args = append(call.args, arg)
+			}
+		}
+		expr.filters = append(expr.filters, call)
+	}
+	return expr, nil
+}
+
+func parseOperand(src string, line int) (operand, error) {
+	src = strings.TrimSpace(src)
+	if src == "" {
+		return operand{}, errorf(line, "empty expression")
+	}
+
+	if q := src[0]; q == '"' || q == '\'' {
+		if len(src) < 2 || src[len(src)-1] != q {
+			return operand{}, errorf(line, "unterminated string %s", src)
+		}
+		return operand{literal: src[1 : len(src)-1]}, nil
+	}
+	switch src {
+	case "true":
+		return operand{literal: true}, nil
+	case "false":
+		return operand{literal: false}, nil
+	case "null", "nil":
+		return operand{literal: nil}, nil
+	}
+	if n, err := strconv.ParseFloat(src, 64); err == nil {
+		return operand{literal: n}, nil
+	}
+
+	if src == "this" || src == "." {
+		return operand{path: []string{"this"}}, nil
+	}
+	var path []string
+	for strings.HasPrefix(src, "../") {
+		path = append(path, "..")
+		src = src[3:]
+	}
+	for _, segment := range strings.Split(src, ".") {
+		if !validSegment(segment) {
+			return operand{}, errorf(line, "invalid variable %q", src)
+		}
+		path = append(path, segment)
+	}
+	return operand{path: path}, nil
+}
+
+func validSegment(segment string) bool {
+	if segment == "" {
+		return false
+	}
+	for i, r := range segment {
+		switch {
+		case r == '_' || r == '-' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9'):
+		case r == '@' && i == 0:
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// splitOutsideQuotes splits on sep where it is not inside a quoted string. It
+// returns nil for an unterminated string.
+func splitOutsideQuotes(src string, sep byte) []string {
+	var parts []string
+	var quote byte
+	start := 0
+	for i := 0; i < len(src); i++ {
+		c := src[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == sep:
+			parts = append(parts, src[start:i])
+			start = i + 1
+		}
+	}
+	if quote != 0 {
+		return nil
+	}
+	return append(parts, src[start:])
+}
+
+// Template is a parsed template
+type Template struct {
+	nodes []node
+}
+
+// Parse parses template source
+func Parse(src string) (*Template, error) {
+	if len(src) > MaxTemplateSize {
+		return nil, errorf(0, "template is larger than %d bytes", MaxTemplateSize)
+	}
+	tokens, err := tokenize(src)
+	if err != nil {
+		return nil, err
+	}
+
+	p := &parser{tokens: tokens}
+	nodes, term, err := p.parseList(0)
+	if err != nil {
+		return nil, err
+	}
+	if term != nil {
+		if term.kind == tokenElse {
+			return nil, errorf(term.line, "{{else}} outside a block")
+		}
+		return nil, errorf(term.line, "{{/%s}} without a matching block", term.name)
+	}
+	return &Template{nodes: nodes}, nil
+}
+
+// Variables returns the names of the top-level variables a template uses, in order
+// of first use. Variables read inside {{#each}} and {{#with}} blocks are fields of
+// the item and aren't included.
+func Variables(src string) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, path := range references(src) {
+		if !seen[path[0]] {
+			seen[path[0]] = true
+			names = append(names, path[0])
+		}
+	}
+	return names
+}
+
+// Paths returns the full paths of the top-level variables a template uses, like
+// user.name, in order of first use
+func Paths(src string) []string {
+	seen := map[string]bool{}
+	var paths []string
+	for _, path := range references(src) {
+		joined := strings.Join(path, ".")
+		if !seen[joined] {
+			seen[joined] = true
+			paths = append(paths, joined)
+		}
+	}
+	return paths
+}
+
+// references returns the paths of the top-level variables a template reads, in
+// order, or nil when it doesn't parse
+func references(src string) [][]string {
+	t, err := Parse(src)
+	if err != nil {
+		return nil
+	}
+
+	var paths [][]string
+	add := func(op operand) {
+		if len(op.path) == 0 {
+			return
+		}
+		name := op.path[0]
+		if name == "this" || name == ".." || strings.HasPrefix(name, "@") {
+			return
+		}
+		paths = append(paths, op.path)
+	}
+	addExpr := func(expr *expression) {
+		add(expr.operand)
+		for _, f := range expr.filters {
+			for _, arg := range f.args {
+				add(arg)
+			}
+		}
+	}
+
+	var walk func(nodes []node)
+	walk = func(nodes []node) {
+		for _, n := range nodes {
+			switch n := n.(type) {
+			case *outputNode:
+				addExpr(n.expr)
+			case *ifNode:
+				addExpr(n.cond)
+				walk(n.then)
+				walk(n.els)
+			case *eachNode:
+				addExpr(n.expr)
+				walk(n.els)
+			case *withNode:
+				addExpr(n.expr)
+				walk(n.els)
+			case *partialNode:
+				for _, param := range n.params {
+					add(param.value)
+				}
+			}
+		}
+	}
+	walk(t.nodes)
+	return paths
+}
+
+// PartialNames returns the names of the partials a template includes, in order of
+// first use
+func PartialNames(src string) []string {
+	t, err := Parse(src)
+	if err != nil {
+		return nil
+	}
+
+	seen := map[string]bool{}
+	var names []string
+	var walk func(nodes []node)
+	walk = func(nodes []node) {
+		for _, n := range nodes {
+			switch n := n.(type) {
+			case *ifNode:
+				walk(n.then)
+				walk(n.els)
+			case *eachNode:
+				walk(n.body)
+				walk(n.els)
+			case *withNode:
+				walk(n.body)
+				walk(n.els)
+			case *partialNode:
+				if !seen[n.name] {
+					seen[n.name] = true
+					names = append(names, n.name)
+				}
+			}
+		}
+	}
+	walk(t.nodes)
+	return names
+}
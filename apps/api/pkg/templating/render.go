@@ -0,0 +1,397 @@
+package templating
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Render limits
+const (
+	RenderTimeout  = 2 * time.Second
+	MaxOutputSize  = 4 << 20 // Bytes of rendered output
+	MaxIterations  = 10000   // Loop iterations over a whole render
+	checkCtxEvery  = 256     // Nodes rendered between checks of the deadline
+	maxStringBytes = 1 << 20 // Largest string a filter may produce
+)
+
+// Partials maps partial names to their source
+type Partials map[string]string
+
+// frame is the scope of a block: the value it is on and the loop variables
+type frame struct {
+	data   any
+	locals map[string]any
+}
+
+type renderer struct {
+	ctx          context.Context
+	out          strings.Builder
+	frames       []frame
+	iterations   int
+	steps        int
+	partials     Partials
+	parsed       map[string]*Template
+	partialDepth int
+}
+
+// Render renders the template with the variables and the partials it may include.
+// Rendering stops with an error when it runs longer than RenderTimeout or exceeds
+// the output and loop limits.
+func (t *Template) Render(ctx context.Context, vars map[string]any, partials Partials) (string, error) {
+	ctx, cancel := context.WithTimeout(ctx, RenderTimeout)
+	defer cancel()
+
+	r := &renderer{ctx: ctx, frames: []frame{{data: vars}}, partials: partials, parsed: map[string]*Template{}}
+	if err := r.render(t.nodes); err != nil {
+		return "", err
+	}
+	return r.out.String(), nil
+}
+
+// Render parses and renders template source
+func Render(ctx context.Context, src string, vars map[string]any, partials Partials) (string, error) {
+	t, err := Parse(src)
+	if err != nil {
+		return "", err
+	}
+	return t.Render(ctx, vars, partials)
+}
+
+func (r *renderer) render(nodes []node) error {
+	for _, n := range nodes {
+		r.steps++
+		if r.steps%checkCtxEvery == 0 && r.ctx.Err() != nil {
+			return errorf(0, "rendering took longer than %s", RenderTimeout)
+		}
+
+		switch n := n.(type) {
+		case *textNode:
+			r.out.WriteString(n.text)
+		case *outputNode:
+			v, err := r.eval(n.expr, n.line)
+			if err != nil {
+				return err
+			}
+			r.out.WriteString(toString(v))
+		case *ifNode:
+			v, err := r.eval(n.cond, n.line)
+			if err != nil {
+				return err
+			}
+			branch := n.els
+			if truthy(v) != n.negate {
+				branch = n.then
+			}
+			if err := r.render(branch); err != nil {
+				return err
+			}
+		case *eachNode:
+			if err := r.renderEach(n); err != nil {
+				return err
+			}
+		case *withNode:
+			v, err := r.eval(n.expr, n.line)
+			if err != nil {
+				return err
+			}
+			if !truthy(v) {
+				if err := r.render(n.els); err != nil {
+					return err
+				}
+				continue
+			}
+			r.frames = append(r.frames, frame{data: v})
+			err = r.render(n.body)
+			r.frames = r.frames[:len(r.frames)-1]
+			if err != nil {
+				return err
+			}
+		case *partialNode:
+			if err := r.renderPartial(n); err != nil {
+				return err
+			}
+		}
+
+		if r.out.Len() > MaxOutputSize {
+			return errorf(0, "rendered output is larger than %d bytes", MaxOutputSize)
+		}
+	}
+	return nil
+}
+
+func (r *renderer) renderEach(n *eachNode) error {
+	v, err := r.eval(n.expr, n.line)
+	if err != nil {
+		return err
+	}
+
+	type item struct {
+		key   string
+		value any
+	}
+	var items []item
+	switch v := v.(type) {
+	case []any:
+		for i, value := range v {
+			items = append(items, item{key: strconv.Itoa(i), value: value})
+		}
+	case []string:
+		for i, value := range v {
+			items = append(items, item{key: strconv.Itoa(i), value: value})
+		}
+	case []map[string]any:
+		for i, value := range v {
+			items = append(items, item{key: strconv.Itoa(i), value: value})
+		}
+	case map[string]any:
+		for _, key := range sortedKeys(v) {
+			items = append(items, item{key: key, value: v[key]})
+		}
+	case map[string]string:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			items = append(items, item{key: key, value: v[key]})
+		}
+	}
+
+	if len(items) == 0 {
+		return r.render(n.els)
+	}
+
+	for i, it := range items {
+		r.iterations++
+		if r.iterations > MaxIterations {
+			return errorf(n.line, "loops ran more than %d times", MaxIterations)
+		}
+		if r.ctx.Err() != nil {
+			return errorf(n.line, "rendering took longer than %s", RenderTimeout)
+		}
+
+		r.frames = append(r.frames, frame{data: it.value, locals: map[string]any{
+			"@index": float64(i),
+			"@key":   it.key,
+			"@first": i == 0,
+			"@last":  i == len(items)-1,
+		}})
+		err := r.render(n.body)
+		r.frames = r.frames[:len(r.frames)-1]
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// renderPartial renders a partial in a scope of its parameters
+func (r *renderer) renderPartial(n *partialNode) error {
+	if r.partialDepth >= MaxPartialDepth {
+		return errorf(n.line, "partials nested deeper than %d", MaxPartialDepth)
+	}
+	t, ok := r.parsed[n.name]
+	if !ok {
+		src, found := r.partials[n.name]
+		if !found {
+			return errorf(n.line, "unknown partial %q", n.name)
+		}
+		var err error
+		if t, err = Parse(src); err != nil {
+			e := errorf(n.line, "partial %q: %v", n.name, err)
+			e.partial = true
+			return e
+		}
+		r.parsed[n.name] = t
+	}
+
+	params := make(map[string]any, len(n.params))
+	for _, param := range n.params {
+		params[param.name] = r.resolve(param.value)
+	}
+	r.frames = append(r.frames, frame{data: params})
+	r.partialDepth++
+	err := r.render(t.nodes)
+	r.partialDepth--
+	r.frames = r.frames[:len(r.frames)-1]
+	if err != nil {
+		if e, ok := err.(*Error); ok && e.partial {
+			return err
+		}
+		e := errorf(n.line, "partial %q: %v", n.name, err)
+		e.partial = true
+		return e
+	}
+	return nil
+}
+
+// eval evaluates an expression and its filters
+func (r *renderer) eval(expr *expression, line int) (any, error) {
+	v := r.resolve(expr.operand)
+	for _, f := range expr.filters {
+		args := make([]any, len(f.args))
+		for i, arg := range f.args {
+			args[i] = r.resolve(arg)
+		}
+		var err error
+		if v, err = f.fn(v, args); err != nil {
+			return nil, errorf(line, "%s: %v", f.name, err)
+		}
+		if s, ok := v.(string); ok && len(s) > maxStringBytes {
+			return nil, errorf(line, "%s: result is larger than %d bytes", f.name, maxStringBytes)
+		}
+	}
+	return v, nil
+}
+
+// resolve looks a variable up in the current scope and then in the enclosing
+// ones, so top-level variables stay available inside blocks
+func (r *renderer) resolve(op operand) any {
+	if op.path == nil {
+		return op.literal
+	}
+
+	path := op.path
+	level := len(r.frames) - 1
+	for len(path) > 0 && path[0] == ".." {
+		if level > 0 {
+			level--
+		}
+		path = path[1:]
+	}
+	if len(path) == 0 {
+		return r.frames[level].data
+	}
+
+	head := path[0]
+	switch {
+	case head == "this":
+		return lookup(r.frames[level].data, path[1:])
+	case head == "@root":
+		return lookup(r.frames[0].data, path[1:])
+	case strings.HasPrefix(head, "@"):
+		for i := level; i >= 0; i-- {
+			if v, ok := r.frames[i].locals[head]; ok {
+				return lookup(v, path[1:])
+			}
+		}
+		return nil
+	}
+
+	for i := level; i >= 0; i-- {
+		if v, ok := field(r.frames[i].data, head); ok {
+			return lookup(v, path[1:])
+		}
+	}
+	return nil
+}
+
+// lookup follows a path of keys and list indexes into a value
+func lookup(v any, path []string) any {
+	for _, key := range path {
+		var ok bool
+		if v, ok = field(v, key); !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+func field(v any, key string) (any, bool) {
+	switch v := v.(type) {
+	case map[string]any:
+		value, ok := v[key]
+		return value, ok
+	case map[string]string:
+		value, ok := v[key]
+		return value, ok
+	case []any:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(v) {
+			return v[i], true
+		}
+	case []string:
+		if i, err := strconv.Atoi(key); err == nil && i >= 0 && i < len(v) {
+			return v[i], true
+		}
+	}
+	return nil, false
+}
+
+// truthy follows Handlebars: false, null, "", 0 and empty lists are false
+func truthy(v any) bool {
+	switch v := v.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case float64:
+		return v != 0
+	case int:
+		return v != 0
+	case int64:
+		return v != 0
+	case json.Number:
+		n, err := v.Float64()
+		return err != nil || n != 0
+	case []any:
+		return len(v) > 0
+	case []string:
+		return len(v) > 0
+	case map[string]any:
+		return len(v) > 0
+	case map[string]string:
+		return len(v) > 0
+	}
+	return true
+}
+
+// toString formats a value for output
+func toString(v any) string {
+	switch v := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case bool:
+		return strconv.FormatBool(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case int:
+		return strconv.Itoa(v)
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case json.Number:
+		return v.String()
+	case time.Time:
+		return v.Format(time.RFC3339)
+	case []string:
+		return strings.Join(v, ", ")
+	case []any:
+		parts := make([]string, len(v))
+		for i, item := range v {
+			parts[i] = toString(item)
+		}
+		return strings.Join(parts, ", ")
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func sortedKeys(m map[string]any) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,319 @@
+package templating
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/mail"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// Schema describes the variables a template expects, in a subset of JSON Schema:
+// type, properties, required, additionalProperties, items, default, enum, format
+// (email, date, date-time, uri), minLength/maxLength, minimum/maximum and
+// minItems/maxItems.
+type Schema struct {
+	SchemaURI            string             `json:"$schema,omitempty"`
+	Title                string             `json:"title,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+	AdditionalProperties *bool              `json:"additionalProperties,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Default              any                `json:"default,omitempty"`
+	Enum                 []any              `json:"enum,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	MinLength            *int               `json:"minLength,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	MinItems             *int               `json:"minItems,omitempty"`
+	MaxItems             *int               `json:"maxItems,omitempty"`
+}
+
+// maxSchemaDepth bounds nested properties and items
+const maxSchemaDepth = 10
+
+var schemaTypes = map[string]bool{
+	"string": true, "number": true, "integer": true, "boolean": true, "array": true, "object": true,
+}
+
+var schemaFormats = map[string]bool{"email": true, "date": true, "date-time": true, "uri": true}
+
+// VariableError is a variable that doesn't match the schema
+type VariableError struct {
+	Path    string // Dotted path of the variable, with list indexes
+	Rule    string // Schema keyword it failed
+	Message string
+}
+
+// ParseSchema parses and checks a variable schema. The top level describes the
+// variables object.
+func ParseSchema(data []byte) (*Schema, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	dec.UseNumber()
+	var s Schema
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	if s.Type == "" {
+		s.Type = "object"
+	}
+	if s.Type != "object" {
+		return nil, fmt.Errorf("invalid schema: the top level must be of type object")
+	}
+	if err := s.check("", 0); err != nil {
+		return nil, fmt.Errorf("invalid schema: %w", err)
+	}
+	return &s, nil
+}
+
+// check checks the keywords of a schema and of the schemas in it
+func (s *Schema) check(path string, depth int) error {
+	at := func(format string, args ...any) error {
+		if path == "" {
+			return fmt.Errorf(format, args...)
+		}
+		return fmt.Errorf("%s: %s", path, fmt.Sprintf(format, args...))
+	}
+
+	if depth > maxSchemaDepth {
+		return at("nested deeper than %d levels", maxSchemaDepth)
+	}
+	if s.Type != "" && !schemaTypes[s.Type] {
+		return at("unknown type %q", s.Type)
+	}
+	if s.Format != "" && !schemaFormats[s.Format] {
+		return at("unknown format %q", s.Format)
+	}
+	if s.MinLength != nil && s.MaxLength != nil && *s.MinLength > *s.MaxLength {
+		return at("minLength is greater than maxLength")
+	}
+	if s.Minimum != nil && s.Maximum != nil && *s.Minimum > *s.Maximum {
+		return at("minimum is greater than maximum")
+	}
+	if s.MinItems != nil && s.MaxItems != nil && *s.MinItems > *s.MaxItems {
+		return at("minItems is greater than maxItems")
+	}
+
+	for name, prop := range s.Properties {
+		if prop == nil {
+			return at("property %q has no schema", name)
+		}
+		if err := prop.check(joinPath(path, name), depth+1); err != nil {
+			return err
+		}
+	}
+	if s.Items != nil {
+		if err := s.Items.check(path+"[]", depth+1); err != nil {
+			return err
+		}
+	}
+	if s.Default != nil {
+		if errs := s.validate(path, s.Default); len(errs) > 0 {
+			return at("default does not match the schema: %s", errs[0].Message)
+		}
+	}
+	return nil
+}
+
+// Validate checks variables against the schema. It returns the variables with the
+// defaults of missing ones filled in, and every variable that doesn't match,
+// ordered by path.
+func (s *Schema) Validate(vars map[string]any) (map[string]any, []VariableError) {
+	if vars == nil {
+		vars = map[string]any{}
+	}
+	filled, errs := s.validateObject("", vars)
+	sort.SliceStable(errs, func(i, j int) bool { return errs[i].Path < errs[j].Path })
+	return filled, errs
+}
+
+func (s *Schema) validate(path string, v any) []VariableError {
+	fail := func(rule, format string, args ...any) []VariableError {
+		return []VariableError{{Path: path, Rule: rule, Message: fmt.Sprintf(format, args...)}}
+	}
+
+	if s.Type != "" && !hasType(v, s.Type) {
+		return fail("type", "must be %s %s", article(s.Type), s.Type)
+	}
+	if len(s.Enum) > 0 && !inEnum(v, s.Enum) {
+		options := make([]string, len(s.Enum))
+		for i, option := range s.Enum {
+			options[i] = toString(option)
+		}
+		return fail("enum", "must be one of: %s", strings.Join(options, ", "))
+	}
+
+	switch v := v.(type) {
+	case string:
+		n := utf8.RuneCountInString(v)
+		if s.MinLength != nil && n < *s.MinLength {
+			return fail("minLength", "must be at least %d characters", *s.MinLength)
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			return fail("maxLength", "must be at most %d characters", *s.MaxLength)
+		}
+		if s.Format != "" && !validFormat(s.Format, v) {
+			return fail("format", "must be a valid %s", s.Format)
+		}
+	case []any:
+		if s.MinItems != nil && len(v) < *s.MinItems {
+			return fail("minItems", "must have at least %d items", *s.MinItems)
+		}
+		if s.MaxItems != nil && len(v) > *s.MaxItems {
+			return fail("maxItems", "must have at most %d items", *s.MaxItems)
+		}
+		if s.Items != nil {
+			var errs []VariableError
+			for i, item := range v {
+				errs = append(errs, s.Items.validate(joinPath(path, strconv.Itoa(i)), item)...)
+			}
+			return errs
+		}
+	case map[string]any:
+		_, errs := s.validateObject(path, v)
+		return errs
+	default:
+		if n, ok := toNumber(v); ok {
+			if s.Minimum != nil && n < *s.Minimum {
+				return fail("minimum", "must be at least %s", toString(*s.Minimum))
+			}
+			if s.Maximum != nil && n > *s.Maximum {
+				return fail("maximum", "must be at most %s", toString(*s.Maximum))
+			}
+		}
+	}
+	return nil
+}
+
+// validateObject checks the properties of an object, filling in defaults on a copy
+func (s *Schema) validateObject(path string, obj map[string]any) (map[string]any, []VariableError) {
+	var errs []VariableError
+	filled := make(map[string]any, len(obj))
+	for key, value := range obj {
+		filled[key] = value
+	}
+
+	for name, prop := range s.Properties {
+		if v, ok := filled[name]; ok && v != nil {
+			if m, isObject := v.(map[string]any); isObject && prop.Type == "object" {
+				var propErrs []VariableError
+				filled[name], propErrs = prop.validateObject(joinPath(path, name), m)
+				errs = append(errs, propErrs...)
+				continue
+			}
+			errs = append(errs, prop.validate(joinPath(path, name), v)...)
+			continue
+		}
+		if prop.Default != nil {
+			filled[name] = prop.Default
+		}
+	}
+	for _, name := range s.Required {
+		if v, ok := filled[name]; !ok || v == nil {
+			errs = append(errs, VariableError{Path: joinPath(path, name), Rule: "required", Message: "is required"})
+		}
+	}
+	if s.AdditionalProperties != nil && !*s.AdditionalProperties {
+		for key := range obj {
+			if _, known := s.Properties[key]; !known {
+				errs = append(errs, VariableError{Path: joinPath(path, key), Rule: "additionalProperties", Message: "is not a known variable"})
+			}
+		}
+	}
+	return filled, errs
+}
+
+func hasType(v any, typ string) bool {
+	switch typ {
+	case "string":
+		_, ok := v.(string)
+		return ok
+	case "boolean":
+		_, ok := v.(bool)
+		return ok
+	case "array":
+		_, ok := v.([]any)
+		return ok
+	case "object":
+		_, ok := v.(map[string]any)
+		return ok
+	case "number", "integer":
+		if _, isString := v.(string); isString {
+			return false
+		}
+		n, ok := toNumber(v)
+		return ok && (typ == "number" || n == math.Trunc(n))
+	}
+	return false
+}
+
+// inEnum compares strings, booleans and numbers. Lists and objects are never in
+// an enum.
+func inEnum(v any, options []any) bool {
+	switch v.(type) {
+	case string, bool:
+		for _, option := range options {
+			if option == v {
+				return true
+			}
+		}
+		return false
+	}
+
+	n, ok := toNumber(v)
+	if !ok {
+		return false
+	}
+	for _, option := range options {
+		if _, isString := option.(string); isString {
+			continue
+		}
+		if m, ok := toNumber(option); ok && m == n {
+			return true
+		}
+	}
+	return false
+}
+
+func validFormat(format, v string) bool {
+	switch format {
+	case "email":
+		addr, err := mail.ParseAddress(v)
+		return err == nil && addr.Address == v
+	case "date":
+		_, err := time.Parse("2006-01-02", v)
+		return err == nil
+	case "date-time":
+		_, err := time.Parse(time.RFC3339, v)
+		return err == nil
+	case "uri":
+		u, err := url.Parse(v)
+		return err == nil && u.Scheme != "" && (u.Host != "" || u.Opaque != "")
+	}
+	return true
+}
+
+func joinPath(path, name string) string {
+	if path == "" {
+		return name
+	}
+	return path + "." + name
+}
+
+func article(typ string) string {
+	switch typ {
+	case "array", "object", "integer":
+		return "an"
+	}
+	return "a"
+}
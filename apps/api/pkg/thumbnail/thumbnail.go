@@ -0,0 +1,133 @@
+// Package thumbnail renders small JPEG previews of image and PDF attachments.
+package thumbnail
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"regexp"
+	"strings"
+
+	// Decoders for image.Decode
+	_ "image/gif"
+	_ "image/png"
+)
+
+// ContentType is the content type of generated thumbnails
+const ContentType = "image/jpeg"
+
+// MaxSourcePixels is the largest image, in pixels, thumbnails are made of.
+// Decoding allocates the whole image, so bigger ones are refused.
+const MaxSourcePixels = 40_000_000
+
+// ErrUnsupported is returned for attachments no thumbnail can be made of
+var ErrUnsupported = errors.New("thumbnail: unsupported content")
+
+// Supported reports whether thumbnails can be attempted for a content type
+func Supported(contentType string) bool {
+	switch strings.ToLower(contentType) {
+	case "image/jpeg", "image/jpg", "image/png", "image/gif", "application/pdf":
+		return true
+	}
+	return false
+}
+
+// Generate renders a JPEG thumbnail fitting in size x size pixels. Images are
+// scaled down, never up. PDFs are previewed by the first JPEG image embedded
+// in them, which covers scanned documents; text-only PDFs have no thumbnail.
+func Generate(data []byte, contentType string, size int) ([]byte, error) {
+	if size <= 0 {
+		return nil, errors.New("thumbnail: size must be positive")
+	}
+	if strings.EqualFold(contentType, "application/pdf") {
+		var ok bool
+		if data, ok = pdfImage(data); !ok {
+			return nil, ErrUnsupported
+		}
+	} else if !Supported(contentType) {
+		return nil, ErrUnsupported
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.Width*cfg.Height > MaxSourcePixels {
+		return nil, ErrUnsupported
+	}
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrUnsupported
+	}
+
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(src, size), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// scale box-filters src down to fit in size x size, flattening transparency
+// onto white since JPEG has no alpha
+func scale(src image.Image, size int) image.Image {
+	b := src.Bounds()
+	w, h := b.Dx(), b.Dy()
+	tw, th := w, h
+	if w > size || h > size {
+		if w >= h {
+			tw, th = size, max(1, h*size/w)
+		} else {
+			tw, th = max(1, w*size/h), size
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, tw, th))
+	for y := 0; y < th; y++ {
+		y0, y1 := b.Min.Y+y*h/th, b.Min.Y+max((y+1)*h/th, y*h/th+1)
+		for x := 0; x < tw; x++ {
+			x0, x1 := b.Min.X+x*w/tw, b.Min.X+max((x+1)*w/tw, x*w/tw+1)
+			var r, g, bl, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					a := uint64(c.A)
+					// Blend onto white
+					r += (uint64(c.R)*a + 0xffff*(0xffff-a)) / 0xffff
+					g += (uint64(c.G)*a + 0xffff*(0xffff-a)) / 0xffff
+					bl += (uint64(c.B)*a + 0xffff*(0xffff-a)) / 0xffff
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(bl / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
+
+// pdfJPEGStream matches the start of a DCTDecode (JPEG) image stream
+var pdfJPEGStream = regexp.MustCompile(`/Filter\s*(?:\[\s*)?/DCTDecode[^>]*>>\s*stream\r?\n`)
+
+// pdfImage returns the first JPEG image embedded in a PDF
+func pdfImage(pdf []byte) ([]byte, bool) {
+	loc := pdfJPEGStream.FindIndex(pdf)
+	if loc == nil {
+		return nil, false
+	}
+	data := pdf[loc[1]:]
+	end := bytes.Index(data, []byte("endstream"))
+	if end < 0 {
+		return nil, false
+	}
+	data = bytes.TrimRight(data[:end], "\r\n")
+	if !bytes.HasPrefix(data, []byte{0xff, 0xd8}) {
+		return nil, false
+	}
+	return data, true
+}
@@ -0,0 +1,201 @@
+package tracking
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+)
+
+// DefaultBaseURL is used when the API URL isn't configured
+const DefaultBaseURL = "http://localhost:3001"
+
+// ConversionLink marks the tokens of conversion pixels, so the open and click
+// tokens in a recipient's email can't be used to report conversions
+const ConversionLink = "conversion"
+
+// Data is what a tracking token carries
+type Data struct {
+	EmailID    int64  `json:"e"`
+	CampaignID int    `json:"c,omitempty"`
+	ContactID  int64  `json:"ct,omitempty"`
+	LinkID     string `json:"l,omitempty"`
+	TargetURL  string `json:"u,omitempty"`
+	// SentEmail is the UUID of the sent copy of an email composed in the
+	// inbox, which has no row in emails
+	SentEmail string `json:"s,omitempty"`
+}
+
+// Tracker builds and verifies the open and click tracking URLs of emails.
+// Tokens are signed with the secret, so they can't be forged to record events
+// for other emails or to redirect to arbitrary URLs.
+type Tracker struct {
+	baseURL string
+	secret  []byte
+}
+
+// New creates a tracker for URLs under the given API base URL
+func New(baseURL, secret string) *Tracker {
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Tracker{baseURL: strings.TrimRight(baseURL, "/"), secret: []byte(secret)}
+}
+
+// PixelURL returns the open tracking pixel URL of an email
+func (t *Tracker) PixelURL(emailID int64, campaignID int, contactID int64) string {
+	return t.pixelURL(Data{EmailID: emailID, CampaignID: campaignID, ContactID: contactID})
+}
+
+// ClickURL wraps a URL with click tracking
+func (t *Tracker) ClickURL(emailID int64, campaignID int, contactID int64, targetURL, linkID string) string {
+	return t.clickURL(Data{EmailID: emailID, CampaignID: campaignID, ContactID: contactID}, targetURL, linkID)
+}
+
+func (t *Tracker) pixelURL(data Data) string {
+	return fmt.Sprintf("%s/api/v1/tracking/open/%s.gif", t.baseURL, t.Encode(data))
+}
+
+func (t *Tracker) clickURL(data Data, targetURL, linkID string) string {
+	data.LinkID = linkID
+	data.TargetURL = targetURL
+	return fmt.Sprintf("%s/api/v1/tracking/click/%s", t.baseURL, t.Encode(data))
+}
+
+// ConversionURL returns the conversion pixel URL of a campaign. The page it's loaded
+// on adds the email of the customer, and the value of the order when there's one.
+func (t *Tracker) ConversionURL(campaignID int) string {
+	token := t.Encode(Data{CampaignID: campaignID, LinkID: ConversionLink})
+	return fmt.Sprintf("%s/api/v1/tracking/conversion/%s.gif", t.baseURL, token)
+}
+
+// Apply adds the tracking pixel to HTML content and wraps its links with click
+// tracking
+func (t *Tracker) Apply(emailID int64, campaignID int, contactID int64, htmlContent string) string {
+	return t.apply(Data{EmailID: emailID, CampaignID: campaignID, ContactID: contactID}, htmlContent, true, true)
+}
+
+// ApplySent adds open and click tracking, as asked, to the HTML content of an
+// email composed in the inbox, whose sent copy has the given UUID
+func (t *Tracker) ApplySent(sentEmail, htmlContent string, opens, clicks bool) string {
+	return t.apply(Data{SentEmail: sentEmail}, htmlContent, opens, clicks)
+}
+
+func (t *Tracker) apply(data Data, htmlContent string, opens, clicks bool) string {
+	if htmlContent == "" {
+		return htmlContent
+	}
+
+	// Add tracking pixel before closing body tag
+	if opens {
+		trackingPixel := fmt.Sprintf(`<img src="%s" width="1" height="1" style="display:none" alt="" />`, t.pixelURL(data))
+
+		if strings.Contains(htmlContent, "</body>") {
+			htmlContent = strings.Replace(htmlContent, "</body>", trackingPixel+"</body>", 1)
+		} else {
+			htmlContent = htmlContent + trackingPixel
+		}
+	}
+
+	// Wrap all links with click tracking
+	// This is a simplified version - a proper implementation would use HTML parsing
+	if clicks {
+		htmlContent = t.wrapLinks(htmlContent, data)
+	}
+	return htmlContent
+}
+
+// wrapLinks wraps href links with click tracking
+func (t *Tracker) wrapLinks(html string, data Data) string {
+	// Find and replace href attributes
+	// Note: This is a simplified approach. Production code should use proper HTML parsing.
+	result := html
+	linkIndex := 0
+
+	// Find href="..." patterns, searching on from the last one so tracked
+	// URLs aren't wrapped again
+	pos := 0
+	for {
+		hrefStart := strings.Index(result[pos:], `href="`)
+		if hrefStart == -1 {
+			break
+		}
+
+		hrefStart += pos + 6 // Move past href="
+		hrefEnd := strings.Index(result[hrefStart:], `"`)
+		if hrefEnd == -1 {
+			break
+		}
+
+		originalURL := result[hrefStart : hrefStart+hrefEnd]
+
+		// Skip mailto:, tel:, and anchor links
+		if strings.HasPrefix(originalURL, "mailto:") ||
+			strings.HasPrefix(originalURL, "tel:") ||
+			strings.HasPrefix(originalURL, "#") ||
+			strings.HasPrefix(originalURL, "{{") {
+			pos = hrefStart + hrefEnd
+			continue
+		}
+
+		// Generate tracked URL
+		linkID := fmt.Sprintf("link_%d", linkIndex)
+		trackedURL := t.clickURL(data, originalURL, linkID)
+
+		// Replace the URL
+		result = result[:hrefStart] + trackedURL + result[hrefStart+hrefEnd:]
+		pos = hrefStart + len(trackedURL)
+		linkIndex++
+	}
+
+	return result
+}
+
+// Encode encodes tracking data to a signed, URL-safe token
+func (t *Tracker) Encode(data Data) string {
+	jsonData, _ := json.Marshal(data)
+
+	// Sign the data
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write(jsonData)
+	signature := mac.Sum(nil)
+
+	// Combine data + signature
+	combined := append(jsonData, signature[:8]...) // Use first 8 bytes of signature
+
+	return base64.URLEncoding.EncodeToString(combined)
+}
+
+// Decode decodes and verifies a tracking token
+func (t *Tracker) Decode(token string) (*Data, error) {
+	combined, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encoding")
+	}
+
+	if len(combined) < 9 {
+		return nil, fmt.Errorf("token too short")
+	}
+
+	// Split data and signature
+	jsonData := combined[:len(combined)-8]
+	providedSig := combined[len(combined)-8:]
+
+	// Verify signature
+	mac := hmac.New(sha256.New, t.secret)
+	mac.Write(jsonData)
+	expectedSig := mac.Sum(nil)[:8]
+
+	if !hmac.Equal(providedSig, expectedSig) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	var data Data
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return nil, fmt.Errorf("invalid token data")
+	}
+
+	return &data, nil
+}
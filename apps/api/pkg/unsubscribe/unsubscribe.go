@@ -0,0 +1,80 @@
+package unsubscribe
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// Data is what an unsubscribe or preference center token carries
+type Data struct {
+	ContactID int64 `json:"c"`
+	OrgID     int64 `json:"o"`
+	ListID    int   `json:"l,omitempty"`
+	EmailID   int64 `json:"e,omitempty"`
+	TopicID   int   `json:"t,omitempty"` // Set when unsubscribing opts out of the topic only
+}
+
+// Encode returns a token for the data, signed with the secret so it can't be
+// forged to unsubscribe other contacts
+func Encode(secret string, data Data) string {
+	// Add a unique ID to prevent token reuse tracking
+	fullData := struct {
+		Data
+		Nonce string `json:"n"`
+	}{
+		Data:  data,
+		Nonce: uuid.New().String()[:8],
+	}
+
+	jsonData, _ := json.Marshal(fullData)
+
+	// Sign the data
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(jsonData)
+	signature := mac.Sum(nil)
+
+	combined := append(jsonData, signature[:8]...)
+	return base64.URLEncoding.EncodeToString(combined)
+}
+
+// Decode verifies a token and returns its data
+func Decode(secret, token string) (*Data, error) {
+	combined, err := base64.URLEncoding.DecodeString(token)
+	if err != nil {
+		return nil, fmt.Errorf("invalid token encoding")
+	}
+
+	if len(combined) < 9 {
+		return nil, fmt.Errorf("token too short")
+	}
+
+	jsonData := combined[:len(combined)-8]
+	providedSig := combined[len(combined)-8:]
+
+	// Verify signature
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(jsonData)
+	expectedSig := mac.Sum(nil)[:8]
+
+	if !hmac.Equal(providedSig, expectedSig) {
+		return nil, fmt.Errorf("invalid signature")
+	}
+
+	var data Data
+	if err := json.Unmarshal(jsonData, &data); err != nil {
+		return nil, fmt.Errorf("invalid token data")
+	}
+
+	return &data, nil
+}
+
+// URL returns the unsubscribe URL of a token under the given API base URL
+func URL(baseURL, token string) string {
+	return fmt.Sprintf("%s/api/v1/unsubscribe/%s", strings.TrimRight(baseURL, "/"), token)
+}
@@ -0,0 +1,219 @@
+package utm
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// Defaults used when the policy doesn't say
+const (
+	DefaultSource = "newsletter"
+	DefaultMedium = "email"
+)
+
+// maxValueLength bounds each parameter value
+const maxValueLength = 200
+
+// Policy tags the links of campaign emails with UTM parameters, so analytics can
+// attribute the visits they bring. Links that already carry a parameter keep
+// their own value.
+type Policy struct {
+	Enabled  bool   `json:"enabled"`
+	Source   string `json:"source"`            // utm_source
+	Medium   string `json:"medium"`            // utm_medium
+	Campaign string `json:"campaign"`          // utm_campaign, defaults to the campaign's name
+	Content  string `json:"content,omitempty"` // utm_content, usually set per campaign
+}
+
+// Override is a campaign's own take on the org's policy. Empty values keep the
+// org's.
+type Override struct {
+	Enabled  *bool  `json:"enabled,omitempty"`
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Validate checks the parameter values
+func (p Policy) Validate() error {
+	for name, value := range map[string]string{"source": p.Source, "medium": p.Medium, "campaign": p.Campaign, "content": p.Content} {
+		if err := validateValue(name, value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate checks the parameter values
+func (o Override) Validate() error {
+	return Policy{Source: o.Source, Medium: o.Medium, Campaign: o.Campaign, Content: o.Content}.Validate()
+}
+
+// IsZero reports whether the override changes nothing
+func (o Override) IsZero() bool {
+	return o == Override{}
+}
+
+func validateValue(name, value string) error {
+	if len(value) > maxValueLength {
+		return fmt.Errorf("%s must be at most %d characters", name, maxValueLength)
+	}
+	if strings.ContainsFunc(value, func(r rune) bool { return r < 0x20 || r == 0x7f }) {
+		return fmt.Errorf("%s must not contain control characters", name)
+	}
+	return nil
+}
+
+// With returns the policy with a campaign's override applied
+func (p Policy) With(o *Override) Policy {
+	if o == nil {
+		return p
+	}
+	if o.Enabled != nil {
+		p.Enabled = *o.Enabled
+	}
+	if o.Source != "" {
+		p.Source = o.Source
+	}
+	if o.Medium != "" {
+		p.Medium = o.Medium
+	}
+	if o.Campaign != "" {
+		p.Campaign = o.Campaign
+	}
+	if o.Content != "" {
+		p.Content = o.Content
+	}
+	return p
+}
+
+// params returns the parameters to tag links with, in order
+func (p Policy) params(campaignName string) [][2]string {
+	source, medium, campaign := p.Source, p.Medium, p.Campaign
+	if source == "" {
+		source = DefaultSource
+	}
+	if medium == "" {
+		medium = DefaultMedium
+	}
+	if campaign == "" {
+		campaign = Slug(campaignName)
+	}
+	params := [][2]string{{"utm_source", source}, {"utm_medium", medium}}
+	if campaign != "" {
+		params = append(params, [2]string{"utm_campaign", campaign})
+	}
+	if p.Content != "" {
+		params = append(params, [2]string{"utm_content", p.Content})
+	}
+	return params
+}
+
+var nonSlug = regexp.MustCompile(`[^a-z0-9]+`)
+
+// Slug turns a campaign name into a utm_campaign value
+func Slug(name string) string {
+	return strings.Trim(nonSlug.ReplaceAllString(strings.ToLower(name), "-"), "-")
+}
+
+// Apply tags the http(s) links of HTML content. Unsubscribe and preference links
+// are left alone, as are mailto:, tel: and anchor links.
+func (p Policy) Apply(html, campaignName string) string {
+	if !p.Enabled || html == "" {
+		return html
+	}
+	params := p.params(campaignName)
+
+	var out strings.Builder
+	rest := html
+	for {
+		start := strings.Index(rest, `href="`)
+		if start == -1 {
+			break
+		}
+		start += 6 // Move past href="
+		end := strings.Index(rest[start:], `"`)
+		if end == -1 {
+			break
+		}
+		out.WriteString(rest[:start])
+		out.WriteString(tag(rest[start:start+end], params))
+		rest = rest[start+end:]
+	}
+	out.WriteString(rest)
+	return out.String()
+}
+
+// tag adds the parameters a link doesn't have yet
+func tag(link string, params [][2]string) string {
+	lower := strings.ToLower(link)
+	if !strings.HasPrefix(lower, "http://") && !strings.HasPrefix(lower, "https://") {
+		return link
+	}
+	if strings.Contains(lower, "unsubscribe") || strings.Contains(lower, "/preferences") {
+		return link
+	}
+
+	// Links in HTML may escape the ampersands of their query
+	escaped := strings.ReplaceAll(link, "&amp;", "&")
+	parsed, err := url.Parse(escaped)
+	if err != nil {
+		return link
+	}
+	existing := parsed.Query()
+
+	var added []string
+	for _, param := range params {
+		if existing.Get(param[0]) == "" {
+			added = append(added, param[0]+"="+url.QueryEscape(param[1]))
+		}
+	}
+	if len(added) == 0 {
+		return link
+	}
+
+	separator := "&"
+	if escaped != link {
+		separator = "&amp;"
+	}
+	query := strings.Join(added, separator)
+
+	base, fragment, hasFragment := strings.Cut(link, "#")
+	switch {
+	case !strings.Contains(base, "?"):
+		base += "?" + query
+	case strings.HasSuffix(base, "?") || strings.HasSuffix(base, "&") || strings.HasSuffix(base, "&amp;"):
+		base += query
+	default:
+		base += separator + query
+	}
+	if hasFragment {
+		return base + "#" + fragment
+	}
+	return base
+}
+
+// Load reads the org's policy from its settings. Orgs without one don't tag links.
+func Load(ctx context.Context, db *sql.DB, orgID int64) Policy {
+	var policy Policy
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'campaignUtm' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	return policy
+}
@@ -0,0 +1,91 @@
+package warmup
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// Schedules are the daily send limits of a warmup, from its first day on
+var Schedules = map[string][]int{
+	"conservative": {20, 50, 100, 200, 400, 600, 800, 1000, 1200, 1400, 1600, 1800, 2000, 2400, 2800, 3200, 4000, 5000, 6000, 7000, 8000, 9000, 10000, 12000, 14000, 16000, 18000, 20000, 25000, 30000},
+	"moderate":     {50, 100, 300, 600, 1000, 1500, 2000, 3000, 4000, 5000, 6000, 8000, 10000, 12000, 15000, 18000, 22000, 27000, 35000, 45000, 60000},
+	"aggressive":   {100, 500, 1000, 2000, 4000, 7000, 10000, 15000, 20000, 30000, 45000, 60000, 80000, 100000},
+}
+
+// DefaultSchedule is used when no schedule is set or the set one is unknown
+const DefaultSchedule = "conservative"
+
+// MaxNewDomainDays bounds how long a domain counts as new
+const MaxNewDomainDays = 365
+
+// DomainPolicy ramps up the campaign volume of new sending domains. Mailbox
+// providers distrust a domain with no sending history, so a domain verified
+// fewer than NewDomainDays ago sends no more than its day of the schedule allows,
+// and campaigns from it carry the rest over to the following days.
+type DomainPolicy struct {
+	Enabled       bool   `json:"enabled"`
+	NewDomainDays int    `json:"newDomainDays"` // 0 for the length of the schedule
+	Schedule      string `json:"schedule"`      // conservative, moderate or aggressive
+}
+
+// Validate checks the schedule and the number of days
+func (p DomainPolicy) Validate() error {
+	if p.Schedule != "" {
+		if _, ok := Schedules[p.Schedule]; !ok {
+			return fmt.Errorf("schedule must be conservative, moderate or aggressive")
+		}
+	}
+	if p.NewDomainDays < 0 || p.NewDomainDays > MaxNewDomainDays {
+		return fmt.Errorf("newDomainDays must be between 0 and %d", MaxNewDomainDays)
+	}
+	return nil
+}
+
+// DailyLimit returns how many emails a domain verified at verifiedAt may send on
+// the day of now, 0 for no limit. Days past the end of the schedule keep its
+// last limit until the domain is no longer new.
+func (p DomainPolicy) DailyLimit(verifiedAt, now time.Time) int {
+	if !p.Enabled || verifiedAt.IsZero() {
+		return 0
+	}
+	schedule, ok := Schedules[p.Schedule]
+	if !ok {
+		schedule = Schedules[DefaultSchedule]
+	}
+	days := p.NewDomainDays
+	if days == 0 {
+		days = len(schedule)
+	}
+
+	day := int(now.Sub(verifiedAt).Hours() / 24)
+	if day < 0 {
+		day = 0
+	}
+	if day >= days {
+		return 0
+	}
+	return schedule[min(day, len(schedule)-1)]
+}
+
+// LoadDomainPolicy reads the org's domain warmup from its settings. Orgs that
+// didn't set one ramp up new domains on the default schedule.
+func LoadDomainPolicy(ctx context.Context, db *sql.DB, orgID int64) DomainPolicy {
+	policy := DomainPolicy{Enabled: true, Schedule: DefaultSchedule}
+	if db == nil {
+		return policy
+	}
+
+	var raw sql.NullString
+	err := db.QueryRowContext(ctx, `
+		SELECT settings->'domainWarmup' FROM organizations WHERE id = $1
+	`, orgID).Scan(&raw)
+	if err != nil || !raw.Valid || raw.String == "" || raw.String == "null" {
+		return policy
+	}
+
+	json.Unmarshal([]byte(raw.String), &policy)
+	return policy
+}
@@ -0,0 +1,78 @@
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"time"
+)
+
+// What happens to an enrollment whose node failed once its retries are used up
+const (
+	OnFailureStop  = "stop"  // The enrollment ends in error
+	OnFailureSkip  = "skip"  // The contact carries on past the node
+	OnFailurePause = "pause" // The enrollment waits at the node until it's retried
+)
+
+// Error policy limits
+const (
+	MaxRetries = 10
+	MaxBackoff = 24 * time.Hour
+)
+
+// ErrorPolicy is what an automation does when a node fails for a contact: it
+// runs the node again a number of times, waiting longer before each, then
+// stops, skips the node or pauses the enrollment.
+//
+//	{"retries": 3, "backoffMinutes": 5, "onFailure": "skip"}
+type ErrorPolicy struct {
+	Retries        int    `json:"retries"`
+	BackoffMinutes int    `json:"backoffMinutes"` // Wait before the first retry, doubled for each one after
+	OnFailure      string `json:"onFailure"`      // stop, skip or pause
+}
+
+// DefaultErrorPolicy stops enrollments at the first error
+var DefaultErrorPolicy = ErrorPolicy{OnFailure: OnFailureStop}
+
+// ParseErrorPolicy reads an error policy as stored, falling back to
+// DefaultErrorPolicy
+func ParseErrorPolicy(data []byte) ErrorPolicy {
+	policy := DefaultErrorPolicy
+	if len(data) == 0 || string(data) == "null" {
+		return policy
+	}
+	if json.Unmarshal(data, &policy) != nil || policy.Validate() != nil {
+		return DefaultErrorPolicy
+	}
+	return policy
+}
+
+// Validate checks an error policy, defaulting what it leaves out
+func (p *ErrorPolicy) Validate() error {
+	if p.OnFailure == "" {
+		p.OnFailure = OnFailureStop
+	}
+	switch p.OnFailure {
+	case OnFailureStop, OnFailureSkip, OnFailurePause:
+	default:
+		return fmt.Errorf("onFailure must be stop, skip or pause")
+	}
+	if p.Retries < 0 || p.Retries > MaxRetries {
+		return fmt.Errorf("retries must be between 0 and %d", MaxRetries)
+	}
+	if p.BackoffMinutes < 0 || time.Duration(p.BackoffMinutes)*time.Minute > MaxBackoff {
+		return fmt.Errorf("backoffMinutes must be between 0 and %d", int(MaxBackoff.Minutes()))
+	}
+	return nil
+}
+
+// Backoff returns how long to wait before a retry, counted from 1
+func (p ErrorPolicy) Backoff(retry int) time.Duration {
+	wait := time.Duration(p.BackoffMinutes) * time.Minute
+	if wait <= 0 {
+		wait = time.Minute
+	}
+	for i := 1; i < retry && wait < MaxBackoff; i++ {
+		wait *= 2
+	}
+	return min(wait, MaxBackoff)
+}
@@ -0,0 +1,514 @@
+// Package workflow reads automation workflows: the graph of nodes a contact
+// enrolled in an automation goes through, starting at the trigger and following
+// edges, and what each node does.
+package workflow
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dublyo/mailat/api/pkg/contactbulk"
+	"github.com/dublyo/mailat/api/pkg/contactfield"
+	"github.com/dublyo/mailat/api/pkg/segment"
+	"github.com/dublyo/mailat/api/pkg/sendwindow"
+	"github.com/dublyo/mailat/api/pkg/templating"
+)
+
+// Node types
+const (
+	NodeTrigger   = "trigger"
+	NodeEmail     = "email"
+	NodeDelay     = "delay"
+	NodeCondition = "condition"
+	NodeAction    = "action"
+)
+
+// MaxSteps is how many nodes a contact goes through at once, so a workflow
+// that loops can't run forever
+const MaxSteps = 50
+
+// Handles of the edges out of a condition
+const (
+	HandleYes = "yes"
+	HandleNo  = "no"
+)
+
+// Actions of action nodes
+const (
+	ActionAddTag         = "add_tag"
+	ActionRemoveTag      = "remove_tag"
+	ActionAddToList      = "add_to_list"
+	ActionRemoveFromList = "remove_from_list"
+	ActionMoveToList     = "move_to_list" // Out of FromListID into ListID
+	ActionUpdateField    = "update_field"
+	ActionWebhook        = "send_webhook"
+)
+
+// Fields action nodes can update besides custom attributes
+var contactFields = map[string]string{
+	"firstName": "first_name",
+	"lastName":  "last_name",
+}
+
+// Workflow is the graph of an automation, as the workflow builder saves it
+type Workflow struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+type Node struct {
+	ID   string   `json:"id"`
+	Type string   `json:"type"` // The builder's node component; Data.Type is what the node does
+	Data NodeData `json:"data"`
+}
+
+type NodeData struct {
+	Label  string         `json:"label"`
+	Type   string         `json:"type"`
+	Config map[string]any `json:"config,omitempty"`
+}
+
+type Edge struct {
+	ID           string `json:"id"`
+	Source       string `json:"source"`
+	Target       string `json:"target"`
+	SourceHandle string `json:"sourceHandle,omitempty"` // yes or no out of a condition
+}
+
+// Parse reads a workflow as stored
+func Parse(data []byte) (*Workflow, error) {
+	var w Workflow
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &w); err != nil {
+			return nil, fmt.Errorf("invalid workflow: %w", err)
+		}
+	}
+	return &w, nil
+}
+
+// Node returns the node with an ID, or nil
+func (w *Workflow) Node(id string) *Node {
+	for i := range w.Nodes {
+		if w.Nodes[i].ID == id {
+			return &w.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// Start returns the trigger node contacts enter the workflow at, or nil
+func (w *Workflow) Start() *Node {
+	for i := range w.Nodes {
+		if w.Nodes[i].Data.Type == NodeTrigger {
+			return &w.Nodes[i]
+		}
+	}
+	return nil
+}
+
+// Next returns the node an edge out of a node leads to, or nil at the end of
+// the workflow. A handle picks the edge out of a condition, yes or no; without
+// one any edge is followed.
+func (w *Workflow) Next(id, handle string) *Node {
+	for _, e := range w.Edges {
+		if e.Source == id && (handle == "" || e.SourceHandle == handle) {
+			return w.Node(e.Target)
+		}
+	}
+	return nil
+}
+
+// Name returns how a node is called in errors and stats
+func (n *Node) Name() string {
+	if n.Data.Label != "" {
+		return n.Data.Label
+	}
+	return n.ID
+}
+
+func (n *Node) config(key string) any {
+	return n.Data.Config[key]
+}
+
+func (n *Node) configString(key string) string {
+	switch v := n.config(key).(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return fmt.Sprint(v)
+	}
+	return ""
+}
+
+// Delay is how long a delay node holds contacts: for a duration, until the
+// next time of day, optionally on a weekday, or for a duration and then until
+// the next time of day. Times of day are in the contact's timezone unless the
+// node sets one. Business hours move the end of the wait to the next time
+// inside them.
+//
+//	{"duration": 2, "unit": "days"}
+//	{"until": "09:00", "weekday": "tuesday"}
+//	{"duration": 4, "unit": "hours", "businessHours": {"start": "09:00", "end": "17:00", "days": [1, 2, 3, 4, 5]}}
+type Delay struct {
+	Duration      time.Duration
+	Until         string             // HH:MM
+	Weekday       *time.Weekday      // The day Until falls on; nil for the next day it comes
+	Timezone      string             // IANA zone of Until and the business hours; empty for the contact's
+	BusinessHours *sendwindow.Policy // Window the wait ends in
+}
+
+// Delay reads and checks how long a delay node waits
+func (n *Node) Delay() (*Delay, error) {
+	d := &Delay{Until: n.configString("until"), Timezone: n.configString("timezone")}
+
+	duration, _ := n.config("duration").(float64)
+	if duration < 0 || (duration == 0 && d.Until == "") {
+		return nil, fmt.Errorf("duration must be a positive number")
+	}
+	var unit time.Duration
+	switch n.configString("unit") {
+	case "minutes":
+		unit = time.Minute
+	case "hours":
+		unit = time.Hour
+	case "days", "":
+		unit = 24 * time.Hour
+	case "weeks":
+		unit = 7 * 24 * time.Hour
+	default:
+		return nil, fmt.Errorf("unit must be minutes, hours, days or weeks")
+	}
+	d.Duration = time.Duration(duration * float64(unit))
+
+	if d.Until != "" {
+		if _, err := time.Parse("15:04", d.Until); err != nil {
+			return nil, fmt.Errorf("until must be a time of day as HH:MM")
+		}
+	}
+	if weekday := n.configString("weekday"); weekday != "" {
+		day, ok := weekdays[strings.ToLower(weekday)]
+		if !ok {
+			return nil, fmt.Errorf("weekday must be a day of the week, like tuesday")
+		}
+		if d.Until == "" {
+			return nil, fmt.Errorf("weekday needs until, the time of day")
+		}
+		d.Weekday = &day
+	}
+	if d.Timezone == "contact" {
+		d.Timezone = ""
+	}
+	if d.Timezone != "" {
+		if _, err := time.LoadLocation(d.Timezone); err != nil {
+			return nil, fmt.Errorf("unknown timezone %q", d.Timezone)
+		}
+	}
+
+	if hours, ok := n.config("businessHours").(map[string]any); ok {
+		window := &sendwindow.Policy{Enabled: true, Timezone: sendwindow.DefaultTimezone}
+		window.Start, _ = hours["start"].(string)
+		window.End, _ = hours["end"].(string)
+		if days, ok := hours["days"].([]any); ok {
+			for _, day := range days {
+				number, _ := day.(float64)
+				window.Days = append(window.Days, int(number))
+			}
+		}
+		if err := window.Validate(); err != nil {
+			return nil, fmt.Errorf("business hours %w", err)
+		}
+		d.BusinessHours = window
+	}
+	return d, nil
+}
+
+var weekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+// Local reports whether the end of the wait depends on the contact's timezone
+func (d *Delay) Local() bool {
+	return d.Timezone == "" && (d.Until != "" || d.BusinessHours != nil)
+}
+
+// End returns when a wait that starts now ends for a contact in a location
+func (d *Delay) End(now time.Time, loc *time.Location) time.Time {
+	if d.Timezone != "" {
+		if l, err := time.LoadLocation(d.Timezone); err == nil {
+			loc = l
+		}
+	}
+
+	end := now.Add(d.Duration)
+	if d.Until != "" {
+		clock, _ := time.Parse("15:04", d.Until)
+		local := end.In(loc)
+		at := time.Date(local.Year(), local.Month(), local.Day(), clock.Hour(), clock.Minute(), 0, 0, loc)
+		for !at.After(end) || (d.Weekday != nil && at.Weekday() != *d.Weekday) {
+			at = time.Date(at.Year(), at.Month(), at.Day()+1, clock.Hour(), clock.Minute(), 0, 0, loc)
+		}
+		end = at
+	}
+	if d.BusinessHours != nil {
+		end, _ = d.BusinessHours.Next(end, loc.String())
+	}
+	return end
+}
+
+// Rules reads and checks the segment rules a condition node tests the contact
+// against, to follow its yes or no edge. Conditions set their rules, or one
+// test the way the builder sets it:
+//
+//	{"rules": {"match": "all", "conditions": [...]}}
+//	{"field": "email_opened", "operator": "equals", "value": "true"}
+//
+// email_opened and email_clicked test the automation's own emails, tag_exists
+// a tag and engagement_score the contact's score.
+func (n *Node) Rules() (*segment.Rules, error) {
+	var rules *segment.Rules
+	if raw, ok := n.config("rules").(map[string]any); ok {
+		data, _ := json.Marshal(raw)
+		parsed, err := segment.Parse(data)
+		if err != nil {
+			return nil, err
+		}
+		rules = parsed
+	} else {
+		c, err := n.builderCondition()
+		if err != nil {
+			return nil, err
+		}
+		rules = &segment.Rules{Match: "all", Conditions: []segment.Condition{c}}
+	}
+	if err := rules.Validate(0); err != nil {
+		return nil, fmt.Errorf("invalid rules: %w", err)
+	}
+	return rules, nil
+}
+
+// builderCondition returns the segment condition of a condition node set up
+// with the builder's field, operator and value
+func (n *Node) builderCondition() (segment.Condition, error) {
+	operator := n.configString("operator")
+	value := n.configString("value")
+	negated := operator == "not_equals"
+
+	switch field := n.configString("field"); field {
+	case "email_opened", "email_clicked":
+		if value == "false" {
+			negated = !negated
+		}
+		c := segment.Condition{Type: segment.TypeEvent, Event: "opened", Operator: "has", Automation: true}
+		if field == "email_clicked" {
+			c.Event = "clicked"
+		}
+		if negated {
+			c.Operator = "has_not"
+		}
+		return c, nil
+	case "tag_exists":
+		c := segment.Condition{Type: segment.TypeTag, Operator: "has", Value: value}
+		if negated {
+			c.Operator = "has_not"
+		}
+		return c, nil
+	case "engagement_score":
+		score, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return segment.Condition{}, fmt.Errorf("engagement score must be a number")
+		}
+		return segment.Condition{Type: segment.TypeField, Field: "engagement_score", Operator: operator, Value: score}, nil
+	case "":
+		return segment.Condition{}, fmt.Errorf("condition needs rules or a field")
+	default:
+		return segment.Condition{}, fmt.Errorf("unknown condition field %q", field)
+	}
+}
+
+// Action is what an action node does to the contact going through it. Lists
+// are referenced by UUID.
+type Action struct {
+	Type       string
+	Tag        string
+	ListID     string            // The list added to, removed from or moved into
+	FromListID string            // The list moved out of
+	Field      string            // firstName, lastName or attributes.<key>
+	Value      any               // The field's new value; nil clears it
+	URL        string            // Where webhooks are sent
+	Method     string            // POST, PUT or PATCH
+	Headers    map[string]string // Extra webhook request headers
+	Payload    string            // Template of the webhook's JSON body; empty sends the contact
+}
+
+// Action reads and checks what an action node does. The action's value is the
+// tag, the list's UUID or the field's value, as the builder sets it.
+func (n *Node) Action() (*Action, error) {
+	a := &Action{Type: n.configString("action")}
+	switch a.Type {
+	case ActionAddTag, ActionRemoveTag:
+		a.Tag = n.configString("value")
+		if !contactbulk.ValidTag(a.Tag) {
+			return nil, fmt.Errorf("tag must be up to %d letters, digits, spaces or _.:/-", contactbulk.MaxTagLength)
+		}
+	case ActionAddToList, ActionRemoveFromList:
+		a.ListID = n.configString("listId")
+		if a.ListID == "" {
+			a.ListID = n.configString("value")
+		}
+		if a.ListID == "" {
+			return nil, fmt.Errorf("list is required")
+		}
+	case ActionMoveToList:
+		a.ListID = n.configString("listId")
+		a.FromListID = n.configString("fromListId")
+		if a.ListID == "" || a.FromListID == "" {
+			return nil, fmt.Errorf("listId and fromListId are required")
+		}
+		if a.ListID == a.FromListID {
+			return nil, fmt.Errorf("contacts can't be moved to the list they're in")
+		}
+	case ActionUpdateField:
+		a.Field = n.configString("field")
+		a.Value = n.config("value")
+		if _, ok := contactFields[a.Field]; !ok {
+			key, isAttribute := strings.CutPrefix(a.Field, "attributes.")
+			if !isAttribute || !contactfield.ValidKey(key) {
+				return nil, fmt.Errorf("field must be firstName, lastName or attributes.<key>")
+			}
+		}
+	case ActionWebhook:
+		a.URL = n.configString("url")
+		u, err := url.Parse(a.URL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("url must be an http or https URL")
+		}
+		a.Method = strings.ToUpper(n.configString("method"))
+		switch a.Method {
+		case "":
+			a.Method = "POST"
+		case "POST", "PUT", "PATCH":
+		default:
+			return nil, fmt.Errorf("method must be POST, PUT or PATCH")
+		}
+		if headers, ok := n.config("headers").(map[string]any); ok {
+			a.Headers = make(map[string]string, len(headers))
+			for name, value := range headers {
+				a.Headers[name] = fmt.Sprint(value)
+			}
+		}
+		a.Payload, _ = n.config("payload").(string)
+		if a.Payload != "" {
+			if _, err := templating.Parse(a.Payload); err != nil {
+				return nil, fmt.Errorf("invalid payload template: %w", err)
+			}
+		}
+	default:
+		return nil, fmt.Errorf("action must be add_tag, remove_tag, add_to_list, remove_from_list, move_to_list, update_field or send_webhook")
+	}
+	return a, nil
+}
+
+// Column returns the contacts column an update_field action sets, or "" for a
+// custom attribute, with the attribute's key
+func (a *Action) Column() (column, key string) {
+	if column, ok := contactFields[a.Field]; ok {
+		return column, ""
+	}
+	return "", strings.TrimPrefix(a.Field, "attributes.")
+}
+
+// Lists returns the UUIDs of the lists an action changes the members of
+func (a *Action) Lists() []string {
+	switch a.Type {
+	case ActionAddToList, ActionRemoveFromList:
+		return []string{a.ListID}
+	case ActionMoveToList:
+		return []string{a.ListID, a.FromListID}
+	}
+	return nil
+}
+
+// Email is what an email node sends: a transactional template rendered for the
+// contact. The contact's email, names and attributes are the template's
+// variables, along with the ones the node maps from them.
+//
+//	{"templateId": "<uuid>", "identityId": "<uuid>", "variables": {"plan": "attributes.plan"}}
+type Email struct {
+	TemplateID string // UUID of the template
+	Subject    string // Replaces the template's subject when set
+	IdentityID string // UUID of the identity it's sent from
+	FromEmail  string // Sent from this address instead of an identity's
+	FromName   string
+	ReplyTo    string
+	Variables  map[string]string // Template variable to the contact field or trigger data path it's set from
+}
+
+// Email reads and checks what an email node sends
+func (n *Node) Email() (*Email, error) {
+	e := &Email{
+		TemplateID: n.configString("templateId"),
+		Subject:    n.configString("subject"),
+		IdentityID: n.configString("identityId"),
+		FromEmail:  n.configString("fromEmail"),
+		FromName:   n.configString("fromName"),
+		ReplyTo:    n.configString("replyTo"),
+	}
+	if e.TemplateID == "" {
+		return nil, fmt.Errorf("template is required")
+	}
+	if e.IdentityID == "" && e.FromEmail == "" {
+		return nil, fmt.Errorf("identityId or fromEmail is required")
+	}
+	if e.Subject != "" {
+		if _, err := templating.Parse(e.Subject); err != nil {
+			return nil, fmt.Errorf("invalid subject: %w", err)
+		}
+	}
+	if variables, ok := n.config("variables").(map[string]any); ok {
+		e.Variables = make(map[string]string, len(variables))
+		for name, value := range variables {
+			field, _ := value.(string)
+			if _, ok := contactFields[field]; !ok && field != "email" {
+				key, isAttribute := strings.CutPrefix(field, "attributes.")
+				path, isTrigger := strings.CutPrefix(field, "trigger.")
+				if !(isAttribute && contactfield.ValidKey(key)) && !(isTrigger && path != "") {
+					return nil, fmt.Errorf("variable %s must be set from email, firstName, lastName, attributes.<key> or trigger.<path>", name)
+				}
+			}
+			e.Variables[name] = field
+		}
+	}
+	return e, nil
+}
+
+// Validate checks the nodes a workflow runs: its emails, delays, conditions and
+// actions
+func (w *Workflow) Validate() error {
+	for i := range w.Nodes {
+		n := &w.Nodes[i]
+		switch n.Data.Type {
+		case NodeDelay:
+			if _, err := n.Delay(); err != nil {
+				return fmt.Errorf("node %s: %w", n.Name(), err)
+			}
+		case NodeCondition:
+			if _, err := n.Rules(); err != nil {
+				return fmt.Errorf("node %s: %w", n.Name(), err)
+			}
+		case NodeAction:
+			if _, err := n.Action(); err != nil {
+				return fmt.Errorf("node %s: %w", n.Name(), err)
+			}
+		case NodeEmail:
+			if _, err := n.Email(); err != nil {
+				return fmt.Errorf("node %s: %w", n.Name(), err)
+			}
+		}
+	}
+	return nil
+}
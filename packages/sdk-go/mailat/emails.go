@@ -36,10 +36,11 @@ func (s *EmailsService) Send(ctx context.Context, req *SendEmailRequest, opts *S
 	return &resp, nil
 }
 
-// SendBatch sends multiple emails in a batch (up to 100).
+// SendBatch queues multiple emails as a batch (up to 1,000). Use GetBatch for
+// the result of each email.
 func (s *EmailsService) SendBatch(ctx context.Context, emails []SendEmailRequest) (*BatchSendResponse, error) {
-	if len(emails) > 100 {
-		return nil, fmt.Errorf("batch size cannot exceed 100 emails")
+	if len(emails) > 1000 {
+		return nil, fmt.Errorf("batch size cannot exceed 1000 emails")
 	}
 
 	req := BatchSendRequest{Emails: emails}
@@ -56,6 +57,21 @@ func (s *EmailsService) SendBatch(ctx context.Context, emails []SendEmailRequest
 	return &resp, nil
 }
 
+// GetBatch retrieves the progress of a batch and the result of each email.
+func (s *EmailsService) GetBatch(ctx context.Context, batchID string) (*BatchStatusResponse, error) {
+	data, err := s.client.request(ctx, "GET", "/emails/batches/"+batchID, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp BatchStatusResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
 // Get retrieves the status and events for an email.
 func (s *EmailsService) Get(ctx context.Context, emailID string) (*EmailStatusResponse, error) {
 	data, err := s.client.request(ctx, "GET", "/emails/"+emailID, nil, nil)
@@ -78,7 +78,7 @@ func (s *TemplatesService) Delete(ctx context.Context, templateID string) error
 }
 
 // Preview renders a template with variables.
-func (s *TemplatesService) Preview(ctx context.Context, templateID string, variables map[string]string) (*PreviewTemplateResponse, error) {
+func (s *TemplatesService) Preview(ctx context.Context, templateID string, variables map[string]any) (*PreviewTemplateResponse, error) {
 	req := PreviewTemplateRequest{Variables: variables}
 	data, err := s.client.request(ctx, "POST", "/templates/"+templateID+"/preview", req, nil)
 	if err != nil {
@@ -92,3 +92,68 @@ func (s *TemplatesService) Preview(ctx context.Context, templateID string, varia
 
 	return &resp, nil
 }
+
+// TestSend sends a rendered template as test traffic, which is left out of
+// analytics and quotas.
+func (s *TemplatesService) TestSend(ctx context.Context, templateID string, req *TestSendTemplateRequest) (*SendEmailResponse, error) {
+	data, err := s.client.request(ctx, "POST", "/templates/"+templateID+"/test-send", req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp SendEmailResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// RenderDesign renders a drag-and-drop block design to the HTML body a template
+// saved with it gets, without saving it.
+func (s *TemplatesService) RenderDesign(ctx context.Context, design map[string]any) (*RenderDesignResponse, error) {
+	req := map[string]any{"design": design}
+	data, err := s.client.request(ctx, "POST", "/templates/render-design", req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp RenderDesignResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// Export bundles templates and the partials they include. With no IDs, all
+// templates are exported.
+func (s *TemplatesService) Export(ctx context.Context, templateIDs ...string) (*TemplateBundle, error) {
+	req := map[string]any{"templateIds": templateIDs}
+	data, err := s.client.request(ctx, "POST", "/templates/export", req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp TemplateBundle
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
+
+// Import imports a template bundle exported from another organization or environment.
+func (s *TemplatesService) Import(ctx context.Context, req *ImportTemplatesRequest) (*ImportTemplatesResponse, error) {
+	data, err := s.client.request(ctx, "POST", "/templates/import", req, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var resp ImportTemplatesResponse
+	if err := json.Unmarshal(data, &resp); err != nil {
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+
+	return &resp, nil
+}
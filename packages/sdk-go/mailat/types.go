@@ -13,10 +13,13 @@ type SendEmailRequest struct {
 	BCC          []string          `json:"bcc,omitempty"`
 	ReplyTo      string            `json:"replyTo,omitempty"`
 	TemplateID   string            `json:"templateId,omitempty"`
-	Variables    map[string]string `json:"variables,omitempty"`
+	Variables    map[string]any    `json:"variables,omitempty"`
 	Tags         []string          `json:"tags,omitempty"`
 	Metadata     map[string]string `json:"metadata,omitempty"`
 	ScheduledFor *time.Time        `json:"scheduledFor,omitempty"`
+	// DedupeWindowHours rejects recipients that were sent the same template (or
+	// subject) within this many hours.
+	DedupeWindowHours int `json:"dedupeWindowHours,omitempty"`
 }
 
 // SendEmailResponse is returned after sending an email.
@@ -33,17 +36,32 @@ type BatchSendRequest struct {
 
 // BatchEmailResult is the result for a single email in a batch.
 type BatchEmailResult struct {
-	Index   int    `json:"index"`
-	ID      string `json:"id,omitempty"`
-	Status  string `json:"status"`
-	Message string `json:"message,omitempty"`
+	Index     int    `json:"index"`
+	ID        string `json:"id,omitempty"`
+	MessageID string `json:"messageId,omitempty"`
+	Status    string `json:"status"` // pending until the email is sent
+	Error     string `json:"error,omitempty"`
+	ErrorCode string `json:"errorCode,omitempty"`
 }
 
-// BatchSendResponse is returned after sending a batch of emails.
+// BatchSendResponse is returned when a batch is accepted for sending.
 type BatchSendResponse struct {
-	Sent   int                `json:"sent"`
-	Failed int                `json:"failed"`
-	Results []BatchEmailResult `json:"results"`
+	BatchID string `json:"batchId"`
+	Status  string `json:"status"`
+	Total   int    `json:"total"`
+}
+
+// BatchStatusResponse contains the progress of a batch and a result per email.
+type BatchStatusResponse struct {
+	BatchID     string             `json:"batchId"`
+	Status      string             `json:"status"` // queued, processing or completed
+	Total       int                `json:"total"`
+	Accepted    int                `json:"accepted"`
+	Failed      int                `json:"failed"`
+	Pending     int                `json:"pending"`
+	CreatedAt   time.Time          `json:"createdAt"`
+	CompletedAt *time.Time         `json:"completedAt,omitempty"`
+	Results     []BatchEmailResult `json:"results"`
 }
 
 // DeliveryEvent represents an email delivery event.
@@ -68,39 +86,54 @@ type EmailStatusResponse struct {
 
 // Template represents an email template.
 type Template struct {
-	ID          string    `json:"id"`
-	Name        string    `json:"name"`
-	Subject     string    `json:"subject"`
-	HTML        string    `json:"html"`
-	Text        string    `json:"text,omitempty"`
-	Description string    `json:"description,omitempty"`
-	IsActive    bool      `json:"isActive"`
-	CreatedAt   time.Time `json:"createdAt"`
-	UpdatedAt   time.Time `json:"updatedAt"`
+	ID             string         `json:"id"`
+	Name           string         `json:"name"`
+	Subject        string         `json:"subject"`
+	HTML           string         `json:"html"`
+	Text           string         `json:"text,omitempty"`
+	AMP            string         `json:"amp,omitempty"`    // AMP for Email part
+	MJML           string         `json:"mjml,omitempty"`   // Source the HTML is compiled from
+	Design         map[string]any `json:"design,omitempty"` // Block design the HTML is rendered from
+	Description    string         `json:"description,omitempty"`
+	UseLayout      bool           `json:"useLayout"`                // HTML is wrapped in the org's header and footer
+	VariableSchema map[string]any `json:"variableSchema,omitempty"` // JSON schema sends' variables must match
+	IsActive       bool           `json:"isActive"`
+	CreatedAt      time.Time      `json:"createdAt"`
+	UpdatedAt      time.Time      `json:"updatedAt"`
 }
 
 // CreateTemplateRequest is the request to create a template.
 type CreateTemplateRequest struct {
-	Name        string `json:"name"`
-	Subject     string `json:"subject"`
-	HTML        string `json:"html"`
-	Text        string `json:"text,omitempty"`
-	Description string `json:"description,omitempty"`
+	Name           string         `json:"name"`
+	Subject        string         `json:"subject"`
+	HTML           string         `json:"html,omitempty"`
+	MJML           string         `json:"mjml,omitempty"`   // Compiled to the HTML body instead of HTML
+	Design         map[string]any `json:"design,omitempty"` // Block design rendered to the HTML body instead of HTML
+	Text           string         `json:"text,omitempty"`
+	AMP            string         `json:"amp,omitempty"` // AMP for Email part, sent alongside the HTML body
+	Description    string         `json:"description,omitempty"`
+	UseLayout      *bool          `json:"useLayout,omitempty"`      // Defaults to true
+	VariableSchema map[string]any `json:"variableSchema,omitempty"` // JSON schema sends' variables are validated against
 }
 
 // UpdateTemplateRequest is the request to update a template.
 type UpdateTemplateRequest struct {
-	Name        *string `json:"name,omitempty"`
-	Subject     *string `json:"subject,omitempty"`
-	HTML        *string `json:"html,omitempty"`
-	Text        *string `json:"text,omitempty"`
-	Description *string `json:"description,omitempty"`
-	IsActive    *bool   `json:"isActive,omitempty"`
+	Name           *string        `json:"name,omitempty"`
+	Subject        *string        `json:"subject,omitempty"`
+	HTML           *string        `json:"html,omitempty"`
+	MJML           *string        `json:"mjml,omitempty"`
+	Design         map[string]any `json:"design,omitempty"`
+	Text           *string        `json:"text,omitempty"`
+	AMP            *string        `json:"amp,omitempty"` // An empty string removes the AMP part
+	Description    *string        `json:"description,omitempty"`
+	UseLayout      *bool          `json:"useLayout,omitempty"`
+	VariableSchema map[string]any `json:"variableSchema,omitempty"` // An empty schema removes it
+	IsActive       *bool          `json:"isActive,omitempty"`
 }
 
 // PreviewTemplateRequest is the request to preview a template.
 type PreviewTemplateRequest struct {
-	Variables map[string]string `json:"variables,omitempty"`
+	Variables map[string]any `json:"variables,omitempty"`
 }
 
 // PreviewTemplateResponse contains rendered template content.
@@ -108,6 +141,79 @@ type PreviewTemplateResponse struct {
 	Subject string `json:"subject"`
 	HTML    string `json:"html"`
 	Text    string `json:"text,omitempty"`
+	AMP     string `json:"amp,omitempty"`
+}
+
+// RenderDesignResponse contains the HTML body rendered from a block design.
+type RenderDesignResponse struct {
+	HTML string `json:"html"`
+}
+
+// TemplateBundle is a portable copy of templates and the partials they include.
+type TemplateBundle struct {
+	Version    int                      `json:"version"`
+	ExportedAt time.Time                `json:"exportedAt"`
+	Templates  []TemplateBundleTemplate `json:"templates"`
+	Partials   []TemplateBundlePartial  `json:"partials"`
+	Assets     []TemplateBundleAsset    `json:"assets"` // Listed, not copied
+}
+
+// TemplateBundleTemplate is a template in a bundle.
+type TemplateBundleTemplate struct {
+	Name           string         `json:"name"`
+	Description    string         `json:"description,omitempty"`
+	Subject        string         `json:"subject"`
+	HTML           string         `json:"html"`
+	Text           string         `json:"text,omitempty"`
+	AMP            string         `json:"amp,omitempty"`
+	MJML           string         `json:"mjml,omitempty"`
+	Design         map[string]any `json:"design,omitempty"`
+	VariableSchema map[string]any `json:"variableSchema,omitempty"`
+	UseLayout      bool           `json:"useLayout"`
+	IsActive       bool           `json:"isActive"`
+}
+
+// TemplateBundlePartial is a partial in a bundle.
+type TemplateBundlePartial struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Content     string `json:"content"`
+}
+
+// TemplateBundleAsset is an image the bundled templates load.
+type TemplateBundleAsset struct {
+	URL    string   `json:"url"`
+	UsedBy []string `json:"usedBy"`
+}
+
+// ImportTemplatesRequest is the request to import a template bundle.
+type ImportTemplatesRequest struct {
+	Bundle     *TemplateBundle `json:"bundle"`
+	OnConflict string          `json:"onConflict,omitempty"` // skip (default), overwrite or rename
+	DryRun     bool            `json:"dryRun,omitempty"`
+}
+
+// TemplateImportItem is what happened to one template or partial of a bundle.
+type TemplateImportItem struct {
+	Name         string `json:"name"`
+	OriginalName string `json:"originalName,omitempty"` // Name in the bundle, when renamed
+	UUID         string `json:"uuid,omitempty"`
+	Action       string `json:"action"` // created, updated, renamed, skipped or unchanged
+}
+
+// ImportTemplatesResponse reports the result of an import.
+type ImportTemplatesResponse struct {
+	DryRun    bool                 `json:"dryRun"`
+	Templates []TemplateImportItem `json:"templates"`
+	Partials  []TemplateImportItem `json:"partials"`
+}
+
+// TestSendTemplateRequest sends a template to members of the organization or its
+// allowlisted test addresses.
+type TestSendTemplateRequest struct {
+	From      string         `json:"from"`
+	To        []string       `json:"to"`
+	Variables map[string]any `json:"variables,omitempty"`
 }
 
 // Webhook represents a webhook endpoint.
@@ -92,7 +92,8 @@ export class Mailat {
         throw new MailatError(
           data.message || 'Request failed',
           response.status,
-          data.code
+          data.errorCode,
+          data.errors
         );
       }
 
@@ -3,6 +3,7 @@ import type {
   SendEmailResponse,
   BatchSendRequest,
   BatchSendResponse,
+  BatchStatusResponse,
   EmailStatusResponse,
   ApiResponse,
 } from '../types';
@@ -34,12 +35,12 @@ export class Emails {
   }
 
   /**
-   * Send multiple emails in a single batch request (up to 100)
+   * Queue multiple emails as a single batch (up to 1,000). Poll getBatch for results.
    * @param emails - Array of email requests
    */
   async sendBatch(emails: SendEmailRequest[]): Promise<BatchSendResponse> {
-    if (emails.length > 100) {
-      throw new Error('Batch size cannot exceed 100 emails');
+    if (emails.length > 1000) {
+      throw new Error('Batch size cannot exceed 1000 emails');
     }
 
     const response = await this.request<ApiResponse<BatchSendResponse>>(
@@ -50,6 +51,18 @@ export class Emails {
     return response.data;
   }
 
+  /**
+   * Get the progress of a batch and the result of each email
+   * @param id - The batch ID returned by sendBatch
+   */
+  async getBatch(id: string): Promise<BatchStatusResponse> {
+    const response = await this.request<ApiResponse<BatchStatusResponse>>(
+      'GET',
+      `/emails/batches/${id}`
+    );
+    return response.data;
+  }
+
   /**
    * Get the status and delivery events for an email
    * @param id - The email UUID
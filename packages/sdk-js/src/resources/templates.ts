@@ -4,6 +4,13 @@ import type {
   Template,
   PreviewTemplateRequest,
   PreviewTemplateResponse,
+  TestSendTemplateRequest,
+  SendEmailResponse,
+  TemplateDesign,
+  RenderDesignResponse,
+  TemplateBundle,
+  ImportTemplatesRequest,
+  ImportTemplatesResponse,
   ApiResponse,
 } from '../types';
 
@@ -75,7 +82,7 @@ export class Templates {
    */
   async preview(
     uuid: string,
-    variables?: Record<string, string>
+    variables?: Record<string, unknown>
   ): Promise<PreviewTemplateResponse> {
     const response = await this.request<ApiResponse<PreviewTemplateResponse>>(
       'POST',
@@ -84,4 +91,59 @@ export class Templates {
     );
     return response.data;
   }
+
+  /**
+   * Send a rendered template to members of the organization or its allowlisted
+   * test addresses. Test sends are left out of analytics and quotas.
+   * @param uuid - The template UUID
+   * @param data - Sender, recipients and variables
+   */
+  async testSend(uuid: string, data: TestSendTemplateRequest): Promise<SendEmailResponse> {
+    const response = await this.request<ApiResponse<SendEmailResponse>>(
+      'POST',
+      `/templates/${uuid}/test-send`,
+      data
+    );
+    return response.data;
+  }
+
+  /**
+   * Render a drag-and-drop design to the HTML body a template saved with it gets,
+   * without saving it
+   * @param design - The block design
+   */
+  async renderDesign(design: TemplateDesign): Promise<RenderDesignResponse> {
+    const response = await this.request<ApiResponse<RenderDesignResponse>>(
+      'POST',
+      '/templates/render-design',
+      { design }
+    );
+    return response.data;
+  }
+
+  /**
+   * Export templates and the partials they include as a bundle
+   * @param templateIds - UUIDs of the templates to export, all templates when omitted
+   */
+  async export(templateIds?: string[]): Promise<TemplateBundle> {
+    const response = await this.request<ApiResponse<TemplateBundle>>(
+      'POST',
+      '/templates/export',
+      { templateIds }
+    );
+    return response.data;
+  }
+
+  /**
+   * Import a bundle exported from another organization or environment
+   * @param data - The bundle, what to do with names that are taken, and whether to dry run
+   */
+  async import(data: ImportTemplatesRequest): Promise<ImportTemplatesResponse> {
+    const response = await this.request<ApiResponse<ImportTemplatesResponse>>(
+      'POST',
+      '/templates/import',
+      data
+    );
+    return response.data;
+  }
 }
@@ -31,11 +31,16 @@ export interface SendEmailRequest {
   html?: string;
   text?: string;
   templateId?: string;
-  variables?: Record<string, string>;
+  variables?: Record<string, unknown>;
   attachments?: Attachment[];
+  attachmentIds?: string[]; // IDs returned by POST /api/v1/attachments
+  inlineImages?: InlineImageRef[]; // Pre-uploaded images referenced in html as cid:<cid>
+  senderPool?: string; // Rotation pool the sender is picked from at send time
   tags?: string[];
   metadata?: Record<string, string>;
   scheduledFor?: string; // RFC3339 timestamp
+  ignoreSendingWindow?: boolean; // send a scheduled email outside the org's sending window
+  dedupeWindowHours?: number; // reject recipients sent the same template (or subject) within this many hours
 }
 
 export interface Attachment {
@@ -45,11 +50,22 @@ export interface Attachment {
   cid?: string; // Content-ID for inline attachments
 }
 
+export interface InlineImageRef {
+  id: string;
+  cid: string;
+}
+
 export interface SendEmailResponse {
   id: string;
   messageId: string;
   status: EmailStatus;
   acceptedAt: string;
+  contentWarnings?: ContentFinding[];
+}
+
+export interface ContentFinding {
+  check: 'spam_score' | 'broken_link' | 'missing_unsubscribe' | 'image_ratio';
+  detail: string;
 }
 
 export interface BatchSendRequest {
@@ -57,6 +73,20 @@ export interface BatchSendRequest {
 }
 
 export interface BatchSendResponse {
+  batchId: string;
+  status: string;
+  total: number;
+}
+
+export interface BatchStatusResponse {
+  batchId: string;
+  status: 'queued' | 'processing' | 'completed';
+  total: number;
+  accepted: number;
+  failed: number;
+  pending: number;
+  createdAt: string;
+  completedAt?: string;
   results: BatchEmailResult[];
 }
 
@@ -66,6 +96,8 @@ export interface BatchEmailResult {
   messageId?: string;
   status: string;
   error?: string;
+  errorCode?: string;
+  contentFindings?: ContentFinding[];
 }
 
 export interface EmailStatusResponse {
@@ -101,12 +133,49 @@ export interface DeliveryEvent {
 }
 
 // Template types
+export type TemplateBlockType = 'heading' | 'text' | 'image' | 'button' | 'divider' | 'spacer' | 'columns' | 'html';
+
+export interface TemplateBlock {
+  type: TemplateBlockType;
+  text?: string; // heading
+  level?: 1 | 2 | 3; // heading
+  html?: string; // text, html
+  src?: string; // image
+  alt?: string; // image
+  href?: string; // image
+  width?: number; // image, pixels
+  label?: string; // button
+  url?: string; // button
+  color?: string; // heading text, button background, divider line
+  textColor?: string; // button
+  height?: number; // spacer, pixels
+  align?: 'left' | 'center' | 'right';
+  columns?: { blocks: TemplateBlock[] }[]; // columns, 2 to 4
+}
+
+export interface TemplateDesign {
+  settings?: {
+    width?: number;
+    backgroundColor?: string;
+    contentColor?: string;
+    textColor?: string;
+    linkColor?: string;
+    fontFamily?: string;
+  };
+  blocks: TemplateBlock[];
+}
+
 export interface CreateTemplateRequest {
   name: string;
   description?: string;
   subject: string;
-  html: string;
+  html?: string; // either html or mjml is required
+  mjml?: string; // compiled to the HTML body on save
+  design?: TemplateDesign; // rendered to the HTML body on save
   text?: string;
+  amp?: string; // AMP for Email part, sent alongside the HTML body
+  useLayout?: boolean; // wrap the HTML body in the org's header and footer, default true
+  variableSchema?: Record<string, unknown>; // JSON schema sends' variables are validated against
 }
 
 export interface UpdateTemplateRequest {
@@ -114,7 +183,12 @@ export interface UpdateTemplateRequest {
   description?: string;
   subject?: string;
   html?: string;
+  mjml?: string; // replaces the MJML source and recompiles the HTML body
+  design?: TemplateDesign; // replaces the block design and rerenders the HTML body
   text?: string;
+  amp?: string; // replaces the AMP part, "" removes it
+  useLayout?: boolean;
+  variableSchema?: Record<string, unknown>; // {} removes the schema
   isActive?: boolean;
 }
 
@@ -126,20 +200,75 @@ export interface Template {
   subject: string;
   htmlBody: string;
   textBody?: string;
+  amp?: string; // AMP for Email part
+  mjml?: string; // source the HTML body is compiled from
+  design?: TemplateDesign; // block design the HTML body is rendered from
   variables?: string[];
+  variableSchema?: Record<string, unknown>;
+  useLayout: boolean;
   isActive: boolean;
   createdAt: string;
   updatedAt: string;
 }
 
 export interface PreviewTemplateRequest {
-  variables?: Record<string, string>;
+  variables?: Record<string, unknown>;
 }
 
 export interface PreviewTemplateResponse {
   subject: string;
   html: string;
   text: string;
+  amp?: string; // omitted when the template has no AMP part, or it fails validation once rendered
+}
+
+export interface RenderDesignResponse {
+  html: string;
+}
+
+export interface TemplateBundle {
+  version: number;
+  exportedAt: string;
+  templates: {
+    name: string;
+    description?: string;
+    subject: string;
+    html: string;
+    text?: string;
+    amp?: string;
+    mjml?: string;
+    design?: TemplateDesign;
+    variableSchema?: Record<string, unknown>;
+    useLayout: boolean;
+    isActive: boolean;
+  }[];
+  partials: { name: string; description?: string; content: string }[];
+  assets: { url: string; usedBy: string[] }[]; // images the templates load, listed but not copied
+}
+
+export interface ImportTemplatesRequest {
+  bundle: TemplateBundle;
+  onConflict?: 'skip' | 'overwrite' | 'rename'; // when a name is taken, default skip
+  dryRun?: boolean;
+}
+
+export interface TemplateImportItem {
+  name: string;
+  originalName?: string; // name in the bundle, when renamed
+  uuid?: string;
+  action: 'created' | 'updated' | 'renamed' | 'skipped' | 'unchanged';
+}
+
+export interface ImportTemplatesResponse {
+  dryRun: boolean;
+  templates: TemplateImportItem[];
+  partials: TemplateImportItem[];
+}
+
+export interface TestSendTemplateRequest {
+  from: string;
+  to: string[]; // members of the organization or allowlisted test addresses
+  variables?: Record<string, unknown>;
 }
 
 // Webhook types
@@ -180,7 +309,10 @@ export type WebhookEvent =
   | 'email.complained'
   | 'email.opened'
   | 'email.clicked'
-  | 'email.failed';
+  | 'email.failed'
+  | 'email.held'
+  | 'email.released'
+  | 'email.rejected';
 
 export interface WebhookCall {
   id: number;
@@ -261,6 +393,15 @@ export interface CreateApiKeyRequest {
   name: string;
   permissions?: string[];
   expiresAt?: string;
+  allowedDomains?: string[]; // Sender domains the key may send from
+  requiredTagPrefixes?: string[]; // Every tag sent with the key must start with one of these
+  dailySendLimit?: number; // Transactional emails per day (UTC), 0 for no limit
+}
+
+export interface UpdateApiKeyScopeRequest {
+  allowedDomains?: string[];
+  requiredTagPrefixes?: string[];
+  dailySendLimit?: number;
 }
 
 export interface ApiKey {
@@ -270,27 +411,39 @@ export interface ApiKey {
   key?: string; // Only returned on creation
   keyPrefix: string;
   permissions: string[];
+  allowedDomains: string[];
+  requiredTagPrefixes: string[];
+  dailySendLimit: number;
   expiresAt?: string;
   lastUsedAt?: string;
   createdAt: string;
 }
 
 // Error types
+export interface FieldError {
+  field: string;
+  rule?: string;
+  message: string;
+}
+
 export interface ApiError {
-  success: false;
+  code: number;
   message: string;
-  code?: string;
+  errorCode?: string; // e.g. domain_not_verified, recipient_suppressed, quota_exceeded
+  errors?: FieldError[];
 }
 
 export class MailatError extends Error {
   public readonly status: number;
   public readonly code?: string;
+  public readonly errors?: FieldError[];
 
-  constructor(message: string, status: number, code?: string) {
+  constructor(message: string, status: number, code?: string, errors?: FieldError[]) {
     super(message);
     this.name = 'MailatError';
     this.status = status;
     this.code = code;
+    this.errors = errors;
   }
 }
 
@@ -0,0 +1,10 @@
+-- Add canonical (plus-tag/dot stripped) address to suppression tables
+ALTER TABLE "suppression_list" ADD COLUMN IF NOT EXISTS "normalized_email" VARCHAR(255);
+ALTER TABLE "suppressions" ADD COLUMN IF NOT EXISTS "normalized_email" VARCHAR(255);
+
+-- Existing rows are left NULL: the API fills them in at startup under each
+-- organization's normalization rules (emailaddr.BackfillNormalized)
+
+-- Add indexes for normalized lookups
+CREATE INDEX IF NOT EXISTS "suppression_list_org_id_normalized_email_idx" ON "suppression_list" ("org_id", "normalized_email");
+CREATE INDEX IF NOT EXISTS "suppressions_org_id_normalized_email_idx" ON "suppressions" ("org_id", "normalized_email");
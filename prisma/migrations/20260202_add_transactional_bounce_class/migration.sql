@@ -0,0 +1,7 @@
+-- Add bounce classification (hard, soft, block, reputation, full_mailbox) to transactional emails
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "bounce_class" VARCHAR(20);
+
+-- Backfill from the coarse bounce type recorded before classification existed
+UPDATE "transactional_emails" SET "bounce_class" = "bounce_type" WHERE "bounce_class" IS NULL AND "bounce_type" IN ('hard', 'soft');
+
+CREATE INDEX IF NOT EXISTS "transactional_emails_org_id_bounce_class_idx" ON "transactional_emails" ("org_id", "bounce_class");
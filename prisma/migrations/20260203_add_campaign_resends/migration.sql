@@ -0,0 +1,8 @@
+-- Link resend-to-non-openers campaigns back to the campaign they were cloned from
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "parent_campaign_id" INTEGER;
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "resend_settings" JSONB;
+
+ALTER TABLE "campaigns" ADD CONSTRAINT "campaigns_parent_campaign_id_fkey"
+    FOREIGN KEY ("parent_campaign_id") REFERENCES "campaigns"("id") ON DELETE SET NULL ON UPDATE CASCADE;
+
+CREATE INDEX IF NOT EXISTS "campaigns_parent_campaign_id_idx" ON "campaigns" ("parent_campaign_id");
@@ -0,0 +1,2 @@
+-- Support per-template stats breakdowns
+CREATE INDEX IF NOT EXISTS "transactional_emails_org_id_template_id_idx" ON "transactional_emails" ("org_id", "template_id");
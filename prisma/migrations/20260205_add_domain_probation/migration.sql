@@ -0,0 +1,11 @@
+-- Probation for newly verified sending domains
+ALTER TABLE "domains" ADD COLUMN IF NOT EXISTS "probation_sent_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "domains" ADD COLUMN IF NOT EXISTS "probation_cleared_at" TIMESTAMPTZ(6);
+
+-- Domains that were already sending before probation existed are grandfathered
+UPDATE "domains" SET "probation_cleared_at" = NOW() WHERE "status" = 'active' AND "probation_cleared_at" IS NULL;
+
+-- Held transactional emails record why they were held and who reviewed them
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "hold_reason" TEXT;
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "reviewed_at" TIMESTAMPTZ(6);
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "reviewed_by" INTEGER;
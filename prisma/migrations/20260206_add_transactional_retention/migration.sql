@@ -0,0 +1,2 @@
+-- Marks transactional emails whose bodies were stripped by the org retention policy
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "content_archived_at" TIMESTAMPTZ(6);
@@ -0,0 +1,65 @@
+-- Per-recipient delivery state for transactional emails
+CREATE TABLE IF NOT EXISTS "transactional_email_recipients" (
+    "id" BIGSERIAL NOT NULL,
+    "email_id" BIGINT NOT NULL,
+    "email" VARCHAR(255) NOT NULL,
+    "type" VARCHAR(10) NOT NULL DEFAULT 'to',
+    "status" VARCHAR(50) NOT NULL DEFAULT 'queued',
+    "delivered_at" TIMESTAMPTZ(6),
+    "opened_at" TIMESTAMPTZ(6),
+    "clicked_at" TIMESTAMPTZ(6),
+    "bounced_at" TIMESTAMPTZ(6),
+    "bounce_class" VARCHAR(20),
+    "bounce_reason" TEXT,
+    "complained_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "transactional_email_recipients_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "transactional_email_recipients_email_id_fkey" FOREIGN KEY ("email_id") REFERENCES "transactional_emails"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "transactional_email_recipients_email_id_email_type_key" ON "transactional_email_recipients"("email_id", "email", "type");
+CREATE INDEX IF NOT EXISTS "transactional_email_recipients_email_idx" ON "transactional_email_recipients"("email");
+
+-- Backfill from the comma-joined address columns. Per-recipient outcomes of older
+-- multi-recipient sends are unknown, so only single-recipient emails inherit the
+-- email-level bounce/complaint/engagement state.
+WITH addresses AS (
+    SELECT e.id AS email_id, lower(trim(a.addr)) AS email, a.type
+    FROM "transactional_emails" e
+    CROSS JOIN LATERAL (
+        SELECT unnest(string_to_array(e.to_addresses, ',')) AS addr, 'to' AS type
+        UNION ALL
+        SELECT unnest(string_to_array(COALESCE(e.cc_addresses, ''), ',')), 'cc'
+        UNION ALL
+        SELECT unnest(string_to_array(COALESCE(e.bcc_addresses, ''), ',')), 'bcc'
+    ) a
+    WHERE trim(a.addr) <> ''
+),
+counts AS (
+    SELECT email_id, COUNT(*) AS n FROM addresses GROUP BY email_id
+)
+INSERT INTO "transactional_email_recipients" (
+    "email_id", "email", "type", "status", "delivered_at", "opened_at", "clicked_at",
+    "bounced_at", "bounce_class", "bounce_reason", "complained_at", "created_at", "updated_at"
+)
+SELECT a.email_id, a.email, a.type,
+       CASE
+           WHEN c.n = 1 OR e.status IN ('queued', 'held', 'sending', 'sent', 'delivered', 'failed', 'cancelled', 'rejected') THEN e.status
+           WHEN e.delivered_at IS NOT NULL THEN 'delivered'
+           WHEN e.sent_at IS NOT NULL THEN 'sent'
+           ELSE 'queued'
+       END,
+       e.delivered_at,
+       CASE WHEN c.n = 1 THEN e.opened_at END,
+       CASE WHEN c.n = 1 THEN e.clicked_at END,
+       CASE WHEN c.n = 1 THEN e.bounced_at END,
+       CASE WHEN c.n = 1 THEN e.bounce_class END,
+       CASE WHEN c.n = 1 THEN e.bounce_reason END,
+       CASE WHEN c.n = 1 AND e.status = 'complained' THEN e.updated_at END,
+       e.created_at, e.updated_at
+FROM addresses a
+JOIN counts c ON c.email_id = a.email_id
+JOIN "transactional_emails" e ON e.id = a.email_id
+ON CONFLICT ("email_id", "email", "type") DO NOTHING;
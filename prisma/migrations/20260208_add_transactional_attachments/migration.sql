@@ -0,0 +1,32 @@
+-- Pre-uploaded attachments that transactional sends reference by ID
+CREATE TABLE IF NOT EXISTS "transactional_attachments" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "filename" VARCHAR(255) NOT NULL,
+    "content_type" VARCHAR(255) NOT NULL,
+    "size" INTEGER NOT NULL,
+    "checksum" VARCHAR(64) NOT NULL,
+    "storage_key" VARCHAR(500) NOT NULL,
+    "created_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "transactional_attachments_pkey" PRIMARY KEY ("id")
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "transactional_attachments_uuid_key" ON "transactional_attachments"("uuid");
+CREATE UNIQUE INDEX IF NOT EXISTS "transactional_attachments_org_id_checksum_filename_content_type_key" ON "transactional_attachments"("org_id", "checksum", "filename", "content_type");
+
+-- Attachments included in each transactional email, in order
+CREATE TABLE IF NOT EXISTS "transactional_email_attachments" (
+    "id" BIGSERIAL NOT NULL,
+    "email_id" BIGINT NOT NULL,
+    "attachment_id" BIGINT NOT NULL,
+    "position" INTEGER NOT NULL DEFAULT 0,
+
+    CONSTRAINT "transactional_email_attachments_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "transactional_email_attachments_email_id_fkey" FOREIGN KEY ("email_id") REFERENCES "transactional_emails"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "transactional_email_attachments_attachment_id_fkey" FOREIGN KEY ("attachment_id") REFERENCES "transactional_attachments"("id") ON DELETE RESTRICT ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "transactional_email_attachments_email_id_attachment_id_key" ON "transactional_email_attachments"("email_id", "attachment_id");
+CREATE INDEX IF NOT EXISTS "transactional_email_attachments_attachment_id_idx" ON "transactional_email_attachments"("attachment_id");
@@ -0,0 +1,5 @@
+-- Rotation pool the send worker picked the sender from, used for per-identity volume reporting
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "sender_pool" VARCHAR(100);
+
+-- Daily volume per sending identity, checked against rotation caps on every send
+CREATE INDEX IF NOT EXISTS "transactional_emails_org_id_from_address_sent_at_idx" ON "transactional_emails"("org_id", "from_address", "sent_at");
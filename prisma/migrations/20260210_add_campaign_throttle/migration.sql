@@ -0,0 +1,2 @@
+-- Per-campaign send rate profile, enforced by the campaign worker on top of org-wide limits
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "throttle_settings" JSONB;
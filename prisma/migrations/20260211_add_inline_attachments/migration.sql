@@ -0,0 +1,2 @@
+-- Inline images embedded in the HTML body by Content-ID
+ALTER TABLE "transactional_email_attachments" ADD COLUMN IF NOT EXISTS "content_id" VARCHAR(255);
@@ -0,0 +1,26 @@
+-- Encrypted logical backups of each organization's contacts, lists and consent history
+CREATE TABLE IF NOT EXISTS "org_backups" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "trigger" VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "storage_key" VARCHAR(500),
+    "size" BIGINT DEFAULT 0,
+    "checksum" VARCHAR(64),
+    "contact_count" INTEGER DEFAULT 0,
+    "list_count" INTEGER DEFAULT 0,
+    "membership_count" INTEGER DEFAULT 0,
+    "consent_count" INTEGER DEFAULT 0,
+    "error" TEXT,
+    "verified_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "last_restored_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "org_backups_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "org_backups_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "org_backups_uuid_key" ON "org_backups"("uuid");
+CREATE INDEX IF NOT EXISTS "org_backups_org_id_created_at_idx" ON "org_backups"("org_id", "created_at" DESC);
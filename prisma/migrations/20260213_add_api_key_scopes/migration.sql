@@ -0,0 +1,8 @@
+-- Sending restrictions of API keys
+ALTER TABLE "api_keys" ADD COLUMN IF NOT EXISTS "allowed_domains" TEXT[] DEFAULT '{}';
+ALTER TABLE "api_keys" ADD COLUMN IF NOT EXISTS "required_tag_prefixes" TEXT[] DEFAULT '{}';
+ALTER TABLE "api_keys" ADD COLUMN IF NOT EXISTS "daily_send_limit" INTEGER DEFAULT 0;
+
+-- Key each transactional email was sent with, counted against the key's daily limit
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "api_key_id" INTEGER;
+CREATE INDEX IF NOT EXISTS "transactional_emails_api_key_id_created_at_idx" ON "transactional_emails"("api_key_id", "created_at");
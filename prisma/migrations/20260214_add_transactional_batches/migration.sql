@@ -0,0 +1,32 @@
+-- Batch sends are accepted as a whole and sent by a worker job
+CREATE TABLE IF NOT EXISTS "transactional_batches" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "api_key_id" INTEGER,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'queued',
+    "total" INTEGER NOT NULL DEFAULT 0,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "started_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "transactional_batches_pkey" PRIMARY KEY ("id")
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "transactional_batches_uuid_key" ON "transactional_batches"("uuid");
+CREATE INDEX IF NOT EXISTS "transactional_batches_org_id_created_at_idx" ON "transactional_batches"("org_id", "created_at" DESC);
+
+CREATE TABLE IF NOT EXISTS "transactional_batch_items" (
+    "id" BIGSERIAL NOT NULL,
+    "batch_id" BIGINT NOT NULL,
+    "position" INTEGER NOT NULL,
+    "request" JSONB,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "result" JSONB,
+    "processed_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "transactional_batch_items_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "transactional_batch_items_batch_id_fkey" FOREIGN KEY ("batch_id") REFERENCES "transactional_batches"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "transactional_batch_items_batch_id_position_key" ON "transactional_batch_items"("batch_id", "position");
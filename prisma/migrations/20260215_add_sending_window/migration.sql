@@ -0,0 +1,2 @@
+-- Campaigns can opt out of the org sending window (organizations.settings.sendingWindow)
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "ignore_sending_window" BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,28 @@
+-- Exports of delivery events for a date range, as CSV or NDJSON
+CREATE TABLE IF NOT EXISTS "event_exports" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "requested_by" INTEGER,
+    "format" VARCHAR(10) NOT NULL DEFAULT 'csv',
+    "destination" VARCHAR(20) NOT NULL DEFAULT 'download',
+    "date_from" TIMESTAMPTZ(6) NOT NULL,
+    "date_to" TIMESTAMPTZ(6) NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "storage_key" VARCHAR(500),
+    "row_count" INTEGER DEFAULT 0,
+    "size" BIGINT DEFAULT 0,
+    "error" TEXT,
+    "completed_at" TIMESTAMPTZ(6),
+    "expires_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "event_exports_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "event_exports_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "event_exports_uuid_key" ON "event_exports"("uuid");
+CREATE INDEX IF NOT EXISTS "event_exports_org_id_created_at_idx" ON "event_exports"("org_id", "created_at" DESC);
+
+-- Exports read events by date across an organization's emails
+CREATE INDEX IF NOT EXISTS "transactional_delivery_events_created_at_idx" ON "transactional_delivery_events"("created_at");
@@ -0,0 +1,2 @@
+-- Templates keep the MJML source their HTML body is compiled from
+ALTER TABLE "email_templates" ADD COLUMN IF NOT EXISTS "mjml_source" TEXT;
@@ -0,0 +1,2 @@
+-- Template test sends are flagged so analytics and quotas can leave them out
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "is_test" BOOLEAN NOT NULL DEFAULT false;
@@ -0,0 +1,20 @@
+-- Reusable partials templates include with {{> name}}
+CREATE TABLE IF NOT EXISTS "template_partials" (
+    "id" SERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "name" VARCHAR(100) NOT NULL,
+    "description" TEXT,
+    "content" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "template_partials_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "template_partials_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "template_partials_uuid_key" ON "template_partials"("uuid");
+CREATE UNIQUE INDEX IF NOT EXISTS "template_partials_org_id_name_key" ON "template_partials"("org_id", "name");
+
+-- Templates are wrapped in the org's header and footer unless they opt out
+ALTER TABLE "email_templates" ADD COLUMN IF NOT EXISTS "use_layout" BOOLEAN NOT NULL DEFAULT true;
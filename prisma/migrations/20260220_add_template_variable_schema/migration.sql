@@ -0,0 +1,2 @@
+-- JSON schema the variables of sends with a template are validated against
+ALTER TABLE "email_templates" ADD COLUMN IF NOT EXISTS "variable_schema" JSONB;
@@ -0,0 +1,2 @@
+-- Block design of templates built in the drag-and-drop editor
+ALTER TABLE "email_templates" ADD COLUMN IF NOT EXISTS "design" JSONB;
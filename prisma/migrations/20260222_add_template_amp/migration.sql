@@ -0,0 +1,3 @@
+-- AMP for Email part of templates, and of the emails sent with them
+ALTER TABLE "email_templates" ADD COLUMN IF NOT EXISTS "amp_body" TEXT;
+ALTER TABLE "transactional_emails" ADD COLUMN IF NOT EXISTS "amp_body" TEXT;
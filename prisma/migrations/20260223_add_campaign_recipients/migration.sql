@@ -0,0 +1,26 @@
+-- Campaigns snapshot their recipients when they start sending and send them in
+-- batches, keeping the campaign's counters in step with the recipients
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "failed_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "snapshot_at" TIMESTAMPTZ(6);
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "dispatch_run" UUID;
+
+CREATE TABLE IF NOT EXISTS "campaign_recipients" (
+    "id" BIGSERIAL NOT NULL,
+    "campaign_id" INTEGER NOT NULL,
+    "org_id" INTEGER NOT NULL,
+    "contact_id" BIGINT NOT NULL,
+    "email" VARCHAR(255) NOT NULL,
+    "domain" VARCHAR(255) NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "email_id" BIGINT,
+    "error" TEXT,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "sent_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "campaign_recipients_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "campaign_recipients_campaign_id_fkey" FOREIGN KEY ("campaign_id") REFERENCES "campaigns"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "campaign_recipients_campaign_id_contact_id_key" ON "campaign_recipients"("campaign_id", "contact_id");
+CREATE INDEX IF NOT EXISTS "campaign_recipients_campaign_id_status_idx" ON "campaign_recipients"("campaign_id", "status");
+CREATE INDEX IF NOT EXISTS "campaign_recipients_org_id_status_sent_at_idx" ON "campaign_recipients"("org_id", "status", "sent_at");
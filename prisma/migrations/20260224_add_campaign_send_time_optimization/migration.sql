@@ -0,0 +1,4 @@
+-- Campaigns can send each recipient at the hour they have historically opened
+-- email the most, spread over a window after the campaign starts
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "send_time_settings" JSONB;
+ALTER TABLE "campaign_recipients" ADD COLUMN IF NOT EXISTS "send_after" TIMESTAMPTZ(6);
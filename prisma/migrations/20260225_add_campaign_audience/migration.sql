@@ -0,0 +1,3 @@
+-- Campaigns can target several lists and saved segments and exclude lists, on
+-- top of their single list
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "audience" JSONB;
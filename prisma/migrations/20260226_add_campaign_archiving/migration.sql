@@ -0,0 +1,2 @@
+-- Archived campaigns are left out of the default campaign listing
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "archived_at" TIMESTAMPTZ(6);
@@ -0,0 +1,2 @@
+-- Campaigns can override the org's UTM tagging of their links
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "utm_settings" JSONB;
@@ -0,0 +1,2 @@
+-- Campaigns can cap how often contacts get campaigns and suppress segments
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "suppression_settings" JSONB;
@@ -0,0 +1,3 @@
+-- Campaigns record when their next dispatcher run is due, so a dispatcher lost
+-- to a worker restart is noticed and restarted
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "dispatch_due_at" TIMESTAMPTZ(6);
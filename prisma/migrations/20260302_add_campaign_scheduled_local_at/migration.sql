@@ -0,0 +1,2 @@
+-- Campaigns can be scheduled for a time of day in each recipient's timezone
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "scheduled_local_at" TIMESTAMP(6);
@@ -0,0 +1,19 @@
+-- Campaign HTML can be rendered through an external inbox preview service,
+-- keeping a screenshot per campaign and email client
+CREATE TABLE IF NOT EXISTS "campaign_previews" (
+    "id" BIGSERIAL NOT NULL,
+    "campaign_id" INTEGER NOT NULL,
+    "client" VARCHAR(50) NOT NULL,
+    "status" VARCHAR(20) NOT NULL,
+    "image_url" TEXT,
+    "image_data" BYTEA,
+    "content_type" VARCHAR(100),
+    "error" TEXT,
+    "content_hash" VARCHAR(64) NOT NULL,
+    "rendered_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "campaign_previews_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "campaign_previews_campaign_id_fkey" FOREIGN KEY ("campaign_id") REFERENCES "campaigns"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "campaign_previews_campaign_id_client_key" ON "campaign_previews"("campaign_id", "client");
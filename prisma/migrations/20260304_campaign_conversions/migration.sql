@@ -0,0 +1,19 @@
+-- Conversions reported through the API or the conversion pixel, attributed to
+-- a recipient of the campaign
+CREATE TABLE IF NOT EXISTS "campaign_conversions" (
+    "id" BIGSERIAL NOT NULL,
+    "campaign_id" INTEGER NOT NULL,
+    "contact_id" BIGINT NOT NULL,
+    "email_id" BIGINT,
+    "value" DECIMAL(14,2) NOT NULL DEFAULT 0,
+    "currency" VARCHAR(3),
+    "order_id" VARCHAR(255),
+    "source" VARCHAR(20) NOT NULL,
+    "occurred_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "campaign_conversions_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "campaign_conversions_campaign_id_fkey" FOREIGN KEY ("campaign_id") REFERENCES "campaigns"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "campaign_conversions_campaign_id_order_id_key" ON "campaign_conversions"("campaign_id", "order_id");
+CREATE INDEX IF NOT EXISTS "campaign_conversions_campaign_id_contact_id_idx" ON "campaign_conversions"("campaign_id", "contact_id");
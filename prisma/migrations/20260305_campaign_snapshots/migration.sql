@@ -0,0 +1,25 @@
+-- A campaign's content is frozen when it's scheduled or sent, so later edits
+-- can't change what goes out, and each frozen version is kept for audits
+CREATE TABLE IF NOT EXISTS "campaign_snapshots" (
+    "id" BIGSERIAL NOT NULL,
+    "campaign_id" INTEGER NOT NULL,
+    "reason" VARCHAR(20) NOT NULL,
+    "subject" VARCHAR(500) NOT NULL,
+    "html_content" TEXT,
+    "text_content" TEXT,
+    "from_name" VARCHAR(255) NOT NULL,
+    "from_email" VARCHAR(255) NOT NULL,
+    "reply_to" VARCHAR(255),
+    "template_id" INTEGER,
+    "template_name" VARCHAR(255),
+    "template_updated_at" TIMESTAMPTZ(6),
+    "content_hash" VARCHAR(64) NOT NULL,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "campaign_snapshots_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "campaign_snapshots_campaign_id_fkey" FOREIGN KEY ("campaign_id") REFERENCES "campaigns"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "campaign_snapshots_campaign_id_created_at_idx" ON "campaign_snapshots"("campaign_id", "created_at" DESC);
+
+ALTER TABLE "campaigns" ADD COLUMN IF NOT EXISTS "content_snapshot_id" BIGINT;
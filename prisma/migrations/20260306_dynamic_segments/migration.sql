@@ -0,0 +1,5 @@
+-- Dynamic lists are materialized from their segment rules on a schedule and on
+-- demand, and engagement rules look up a contact's emails
+ALTER TABLE "lists" ADD COLUMN IF NOT EXISTS "segment_refreshed_at" TIMESTAMPTZ(6);
+
+CREATE INDEX IF NOT EXISTS "emails_contact_id_idx" ON "emails"("contact_id");
@@ -0,0 +1,21 @@
+-- Orgs define typed custom fields for their contacts' attributes, which contacts
+-- are validated against and segments offer operators for
+CREATE TABLE IF NOT EXISTS "contact_fields" (
+    "id" SERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "key" VARCHAR(100) NOT NULL,
+    "label" VARCHAR(255) NOT NULL,
+    "type" VARCHAR(20) NOT NULL,
+    "options" TEXT[],
+    "required" BOOLEAN NOT NULL DEFAULT false,
+    "description" TEXT,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "contact_fields_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "contact_fields_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "contact_fields_uuid_key" ON "contact_fields"("uuid");
+CREATE UNIQUE INDEX IF NOT EXISTS "contact_fields_org_id_key_key" ON "contact_fields"("org_id", "key");
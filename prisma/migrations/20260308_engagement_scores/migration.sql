@@ -0,0 +1,15 @@
+-- Contacts' engagement scores are recomputed daily from their decaying opens
+-- and clicks, and each change is kept so segments can test past scores
+CREATE TABLE IF NOT EXISTS "contact_engagement_scores" (
+    "id" BIGSERIAL NOT NULL,
+    "contact_id" BIGINT NOT NULL,
+    "org_id" INTEGER NOT NULL,
+    "score" DOUBLE PRECISION NOT NULL,
+    "computed_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "contact_engagement_scores_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "contact_engagement_scores_contact_id_fkey" FOREIGN KEY ("contact_id") REFERENCES "contacts"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "contact_engagement_scores_contact_id_computed_at_idx" ON "contact_engagement_scores"("contact_id", "computed_at" DESC);
+CREATE INDEX IF NOT EXISTS "contact_engagement_scores_org_id_computed_at_idx" ON "contact_engagement_scores"("org_id", "computed_at");
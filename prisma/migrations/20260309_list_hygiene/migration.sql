@@ -0,0 +1,31 @@
+-- Stale contacts' addresses are re-verified by the list hygiene job, which
+-- records each contact's verdict and a report of every run
+ALTER TABLE "contacts" ADD COLUMN IF NOT EXISTS "verification_status" VARCHAR(20);
+ALTER TABLE "contacts" ADD COLUMN IF NOT EXISTS "verification_reasons" TEXT[];
+ALTER TABLE "contacts" ADD COLUMN IF NOT EXISTS "verified_at" TIMESTAMPTZ(6);
+
+CREATE TABLE IF NOT EXISTS "list_hygiene_runs" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "trigger" VARCHAR(20) NOT NULL DEFAULT 'scheduled',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "checked_count" INTEGER DEFAULT 0,
+    "valid_count" INTEGER DEFAULT 0,
+    "risky_count" INTEGER DEFAULT 0,
+    "undeliverable_count" INTEGER DEFAULT 0,
+    "unknown_count" INTEGER DEFAULT 0,
+    "quarantined_count" INTEGER DEFAULT 0,
+    "reasons" JSONB DEFAULT '{}',
+    "flagged" JSONB DEFAULT '[]',
+    "error" TEXT,
+    "started_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "list_hygiene_runs_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "list_hygiene_runs_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "list_hygiene_runs_uuid_key" ON "list_hygiene_runs"("uuid");
+CREATE INDEX IF NOT EXISTS "list_hygiene_runs_org_id_created_at_idx" ON "list_hygiene_runs"("org_id", "created_at" DESC);
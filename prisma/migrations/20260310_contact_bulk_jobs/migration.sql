@@ -0,0 +1,29 @@
+-- Contacts can be tagged, and tagged, moved, set to a status or deleted in
+-- bulk by background jobs that work through a segment or filter in batches
+ALTER TABLE "contacts" ADD COLUMN IF NOT EXISTS "tags" TEXT[] DEFAULT ARRAY[]::TEXT[];
+
+CREATE INDEX IF NOT EXISTS "contacts_tags_idx" ON "contacts" USING GIN ("tags");
+
+CREATE TABLE IF NOT EXISTS "contact_bulk_jobs" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "requested_by" INTEGER,
+    "operation" VARCHAR(30) NOT NULL,
+    "spec" JSONB NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "total" INTEGER DEFAULT 0,
+    "processed" INTEGER DEFAULT 0,
+    "affected" INTEGER DEFAULT 0,
+    "last_contact_id" BIGINT DEFAULT 0,
+    "error" TEXT,
+    "started_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "contact_bulk_jobs_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "contact_bulk_jobs_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "contact_bulk_jobs_uuid_key" ON "contact_bulk_jobs"("uuid");
+CREATE INDEX IF NOT EXISTS "contact_bulk_jobs_org_id_created_at_idx" ON "contact_bulk_jobs"("org_id", "created_at" DESC);
@@ -0,0 +1,21 @@
+-- Custom contact events (a purchase, a login) recorded through the API, which
+-- segment rules test and contact.event automations are triggered by
+CREATE TABLE IF NOT EXISTS "contact_events" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "contact_id" BIGINT NOT NULL,
+    "name" VARCHAR(100) NOT NULL,
+    "properties" JSONB DEFAULT '{}',
+    "api_key_id" INTEGER,
+    "occurred_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "contact_events_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "contact_events_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "contact_events_contact_id_fkey" FOREIGN KEY ("contact_id") REFERENCES "contacts"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "contact_events_uuid_key" ON "contact_events"("uuid");
+CREATE INDEX IF NOT EXISTS "contact_events_contact_id_name_occurred_at_idx" ON "contact_events"("contact_id", "name", "occurred_at" DESC);
+CREATE INDEX IF NOT EXISTS "contact_events_org_id_name_occurred_at_idx" ON "contact_events"("org_id", "name", "occurred_at" DESC);
@@ -0,0 +1,27 @@
+-- Public signup forms that HTML forms post to, creating contacts in the form's
+-- lists with their consent recorded
+CREATE TABLE IF NOT EXISTS "signup_forms" (
+    "id" SERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "name" VARCHAR(255) NOT NULL,
+    "list_ids" INTEGER[] NOT NULL DEFAULT ARRAY[]::INTEGER[],
+    "fields" TEXT[] DEFAULT ARRAY[]::TEXT[],
+    "allowed_origins" TEXT[] DEFAULT ARRAY[]::TEXT[],
+    "honeypot_field" VARCHAR(100),
+    "turnstile_secret" TEXT,
+    "redirect_url" TEXT,
+    "success_message" TEXT,
+    "rate_limit" INTEGER DEFAULT 10,
+    "active" BOOLEAN DEFAULT true,
+    "submission_count" INTEGER DEFAULT 0,
+    "last_submitted_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "signup_forms_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "signup_forms_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "signup_forms_uuid_key" ON "signup_forms"("uuid");
+CREATE INDEX IF NOT EXISTS "signup_forms_org_id_idx" ON "signup_forms"("org_id");
@@ -0,0 +1,26 @@
+-- Contacts are exported by a worker job, filtered by list, status or segment
+-- rules, as CSV or JSON files downloaded through a presigned URL or written to
+-- the organization's bucket
+CREATE TABLE IF NOT EXISTS "contact_exports" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "requested_by" INTEGER,
+    "format" VARCHAR(10) NOT NULL DEFAULT 'csv',
+    "destination" VARCHAR(20) NOT NULL DEFAULT 'download',
+    "filters" JSONB NOT NULL DEFAULT '{}',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "storage_key" VARCHAR(500),
+    "row_count" INTEGER DEFAULT 0,
+    "size" BIGINT DEFAULT 0,
+    "error" TEXT,
+    "completed_at" TIMESTAMPTZ(6),
+    "expires_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "contact_exports_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "contact_exports_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "contact_exports_uuid_key" ON "contact_exports"("uuid");
+CREATE INDEX IF NOT EXISTS "contact_exports_org_id_created_at_idx" ON "contact_exports"("org_id", "created_at" DESC);
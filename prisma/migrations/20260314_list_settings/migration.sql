@@ -0,0 +1,3 @@
+-- Lists' settings for contacts joining them through signup forms and imports:
+-- from identity, double opt-in, welcome automation and language
+ALTER TABLE "lists" ADD COLUMN IF NOT EXISTS "settings" JSONB DEFAULT '{}';
@@ -0,0 +1,33 @@
+-- Subscription topics: contacts opt out of kinds of email, like a newsletter or
+-- billing notices, without unsubscribing from everything. Automations declare
+-- their topic; campaigns declare theirs in their suppression settings.
+CREATE TABLE IF NOT EXISTS "subscription_topics" (
+    "id" SERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "name" VARCHAR(100) NOT NULL,
+    "description" TEXT,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "subscription_topics_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "subscription_topics_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "subscription_topics_uuid_key" ON "subscription_topics"("uuid");
+CREATE UNIQUE INDEX IF NOT EXISTS "subscription_topics_org_id_name_key" ON "subscription_topics"("org_id", "name");
+
+CREATE TABLE IF NOT EXISTS "contact_topic_optouts" (
+    "contact_id" BIGINT NOT NULL,
+    "topic_id" INTEGER NOT NULL,
+    "source" VARCHAR(50),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "contact_topic_optouts_pkey" PRIMARY KEY ("contact_id", "topic_id"),
+    CONSTRAINT "contact_topic_optouts_contact_id_fkey" FOREIGN KEY ("contact_id") REFERENCES "contacts"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "contact_topic_optouts_topic_id_fkey" FOREIGN KEY ("topic_id") REFERENCES "subscription_topics"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "contact_topic_optouts_topic_id_idx" ON "contact_topic_optouts"("topic_id");
+
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "topic_id" INTEGER REFERENCES "subscription_topics"("id") ON DELETE SET NULL;
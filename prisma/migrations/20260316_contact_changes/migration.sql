@@ -0,0 +1,20 @@
+-- History of changes to contacts' fields and custom attributes, with what made
+-- each change: the API, an import, a signup form or a bulk job
+CREATE TABLE IF NOT EXISTS "contact_changes" (
+    "id" BIGSERIAL NOT NULL,
+    "org_id" INTEGER NOT NULL,
+    "contact_id" BIGINT NOT NULL,
+    "field" VARCHAR(255) NOT NULL,
+    "old_value" JSONB,
+    "new_value" JSONB,
+    "source" VARCHAR(30) NOT NULL,
+    "source_id" VARCHAR(100),
+    "user_id" INTEGER,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "contact_changes_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "contact_changes_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "contact_changes_contact_id_fkey" FOREIGN KEY ("contact_id") REFERENCES "contacts"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "contact_changes_contact_id_created_at_idx" ON "contact_changes"("contact_id", "created_at" DESC);
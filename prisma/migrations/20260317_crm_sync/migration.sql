@@ -0,0 +1,53 @@
+-- CRM connections of orgs' HubSpot and Salesforce accounts, with their OAuth
+-- tokens and field mappings, and the runs that sync contacts with them
+CREATE TABLE IF NOT EXISTS "crm_connections" (
+    "id" SERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "provider" VARCHAR(20) NOT NULL,
+    "account_id" VARCHAR(100),
+    "instance_url" VARCHAR(500),
+    "access_token" TEXT NOT NULL,
+    "refresh_token" TEXT NOT NULL,
+    "token_expires_at" TIMESTAMPTZ(6),
+    "field_mappings" JSONB NOT NULL DEFAULT '[]',
+    "push_enabled" BOOLEAN NOT NULL DEFAULT true,
+    "pull_enabled" BOOLEAN NOT NULL DEFAULT true,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'active',
+    "last_error" TEXT,
+    "pushed_until" TIMESTAMPTZ(6),
+    "pulled_until" TIMESTAMPTZ(6),
+    "last_synced_at" TIMESTAMPTZ(6),
+    "connected_by" INTEGER,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "crm_connections_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "crm_connections_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "crm_connections_uuid_key" ON "crm_connections"("uuid");
+CREATE UNIQUE INDEX IF NOT EXISTS "crm_connections_org_id_provider_key" ON "crm_connections"("org_id", "provider");
+
+CREATE TABLE IF NOT EXISTS "crm_sync_runs" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "connection_id" INTEGER NOT NULL,
+    "org_id" INTEGER NOT NULL,
+    "trigger" VARCHAR(20) NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "pushed" INTEGER NOT NULL DEFAULT 0,
+    "pulled" INTEGER NOT NULL DEFAULT 0,
+    "failed" INTEGER NOT NULL DEFAULT 0,
+    "error" TEXT,
+    "started_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "crm_sync_runs_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "crm_sync_runs_connection_id_fkey" FOREIGN KEY ("connection_id") REFERENCES "crm_connections"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "crm_sync_runs_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "crm_sync_runs_uuid_key" ON "crm_sync_runs"("uuid");
+CREATE INDEX IF NOT EXISTS "crm_sync_runs_connection_id_created_at_idx" ON "crm_sync_runs"("connection_id", "created_at" DESC);
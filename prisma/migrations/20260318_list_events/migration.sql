@@ -0,0 +1,19 @@
+-- Events of lists: contacts joining and leaving them, and members who
+-- unsubscribe, bounce or complain, with the source that caused each one
+CREATE TABLE IF NOT EXISTS "list_events" (
+    "id" BIGSERIAL NOT NULL,
+    "org_id" INTEGER NOT NULL,
+    "list_id" INTEGER NOT NULL,
+    "contact_id" BIGINT,
+    "event" VARCHAR(20) NOT NULL,
+    "source" VARCHAR(30) NOT NULL,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "list_events_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "list_events_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "list_events_list_id_fkey" FOREIGN KEY ("list_id") REFERENCES "lists"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "list_events_contact_id_fkey" FOREIGN KEY ("contact_id") REFERENCES "contacts"("id") ON DELETE SET NULL ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "list_events_list_id_created_at_idx" ON "list_events"("list_id", "created_at");
+CREATE INDEX IF NOT EXISTS "list_events_contact_id_idx" ON "list_events"("contact_id");
@@ -0,0 +1,16 @@
+-- Automation runs: enrollments step through their workflow's nodes, and each
+-- node counts how often it ran and failed
+ALTER TABLE "automation_enrollments" ADD COLUMN IF NOT EXISTS "current_node_id" VARCHAR(100);
+
+CREATE TABLE IF NOT EXISTS "automation_node_stats" (
+    "automation_id" INTEGER NOT NULL,
+    "node_id" VARCHAR(100) NOT NULL,
+    "node_type" VARCHAR(50) NOT NULL,
+    "success_count" INTEGER DEFAULT 0,
+    "error_count" INTEGER DEFAULT 0,
+    "last_error" TEXT,
+    "last_run_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "automation_node_stats_pkey" PRIMARY KEY ("automation_id", "node_id"),
+    CONSTRAINT "automation_node_stats_automation_id_fkey" FOREIGN KEY ("automation_id") REFERENCES "automations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
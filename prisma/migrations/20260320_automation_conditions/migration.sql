@@ -0,0 +1,7 @@
+-- Emails an automation sent, so automation conditions can test engagement with
+-- the automation's own emails, and the branches conditions took
+ALTER TABLE "emails" ADD COLUMN IF NOT EXISTS "automation_id" INTEGER;
+ALTER TABLE "automation_node_stats" ADD COLUMN IF NOT EXISTS "yes_count" INTEGER DEFAULT 0;
+ALTER TABLE "automation_node_stats" ADD COLUMN IF NOT EXISTS "no_count" INTEGER DEFAULT 0;
+
+CREATE INDEX IF NOT EXISTS "emails_automation_id_contact_id_idx" ON "emails"("automation_id", "contact_id");
@@ -0,0 +1,3 @@
+-- Date and received-email automation triggers are evaluated by the scheduler,
+-- which records when it last looked at each automation
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "trigger_checked_at" TIMESTAMPTZ(6);
@@ -0,0 +1,5 @@
+-- Automations can have a goal; enrolled contacts who reach it leave the
+-- workflow early and count as conversions
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "goal" JSONB;
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "converted_count" INTEGER DEFAULT 0;
+ALTER TABLE "automation_enrollments" ADD COLUMN IF NOT EXISTS "converted_at" TIMESTAMPTZ(6);
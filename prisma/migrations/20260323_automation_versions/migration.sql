@@ -0,0 +1,24 @@
+-- Automations keep the versions of their workflow: enrollments finish on the
+-- version they started on, new enrollments start on the latest
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "version" INTEGER DEFAULT 1;
+ALTER TABLE "automation_enrollments" ADD COLUMN IF NOT EXISTS "workflow_version" INTEGER;
+
+CREATE TABLE IF NOT EXISTS "automation_versions" (
+    "id" SERIAL NOT NULL,
+    "automation_id" INTEGER NOT NULL,
+    "version" INTEGER NOT NULL,
+    "workflow" JSONB NOT NULL,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "automation_versions_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "automation_versions_automation_id_fkey" FOREIGN KEY ("automation_id") REFERENCES "automations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "automation_versions_automation_id_version_key" ON "automation_versions"("automation_id", "version");
+
+-- Existing workflows are version 1, and enrollments under way are on it
+INSERT INTO "automation_versions" ("automation_id", "version", "workflow")
+SELECT "id", 1, COALESCE("workflow", '{"edges": [], "nodes": []}') FROM "automations"
+ON CONFLICT DO NOTHING;
+UPDATE "automation_enrollments" SET "workflow_version" = 1
+WHERE "workflow_version" IS NULL AND "current_node_id" IS NOT NULL;
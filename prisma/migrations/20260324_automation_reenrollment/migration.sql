@@ -0,0 +1,5 @@
+-- Automations can enroll contacts again once their enrollment is over and a
+-- cooldown passed; enrollments count how often the contact was enrolled
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "allow_reenrollment" BOOLEAN DEFAULT false;
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "reenroll_cooldown_hours" INTEGER DEFAULT 0;
+ALTER TABLE "automation_enrollments" ADD COLUMN IF NOT EXISTS "enrollment_count" INTEGER DEFAULT 1;
@@ -0,0 +1,3 @@
+-- Automations choose what happens when a node fails for a contact: retry it
+-- with backoff, then stop, skip the node or pause the enrollment
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "error_policy" JSONB;
@@ -0,0 +1,3 @@
+-- Webhook-triggered automations are triggered by requests signed with their
+-- own secret
+ALTER TABLE "automations" ADD COLUMN IF NOT EXISTS "webhook_secret" VARCHAR(255);
@@ -0,0 +1,18 @@
+-- Received and sent emails are threaded by their Message-ID, In-Reply-To and
+-- References headers, falling back to their subject without reply and
+-- forward prefixes
+ALTER TABLE "received_emails" ADD COLUMN IF NOT EXISTS "thread_subject" VARCHAR(1000);
+
+CREATE INDEX IF NOT EXISTS "received_emails_identity_id_thread_subject_idx" ON "received_emails"("identity_id", "thread_subject");
+
+UPDATE "received_emails"
+SET "thread_subject" = lower(btrim(regexp_replace(
+	regexp_replace("subject", '^\s*((re|fwd?|aw|sv|wg)(\[\d+\])?\s*:\s*)+', '', 'i'),
+	'\s+', ' ', 'g'
+)))
+WHERE "thread_subject" IS NULL;
+
+-- Emails received before threading start a thread of their own
+UPDATE "received_emails"
+SET "thread_id" = substr(encode(sha256(convert_to("message_id", 'UTF8')), 'hex'), 1, 16)
+WHERE "thread_id" IS NULL OR "thread_id" = '';
@@ -0,0 +1,18 @@
+-- Identities get app passwords for mail apps, one per device, each revocable
+-- on its own
+CREATE TABLE IF NOT EXISTS "identity_app_passwords" (
+    "id" SERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "identity_id" INTEGER NOT NULL,
+    "name" VARCHAR(100) NOT NULL,
+    "password_prefix" VARCHAR(10) NOT NULL,
+    "encrypted_secret" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "revoked_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "identity_app_passwords_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "identity_app_passwords_identity_id_fkey" FOREIGN KEY ("identity_id") REFERENCES "identities"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "identity_app_passwords_uuid_key" ON "identity_app_passwords"("uuid");
+CREATE INDEX IF NOT EXISTS "identity_app_passwords_identity_id_idx" ON "identity_app_passwords"("identity_id");
@@ -0,0 +1,24 @@
+-- Users can have sent emails held for a few seconds, during which sending can
+-- be undone
+ALTER TABLE "user_settings" ADD COLUMN IF NOT EXISTS "undo_send_seconds" INTEGER DEFAULT 0;
+
+CREATE TABLE IF NOT EXISTS "compose_sends" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "user_id" INTEGER NOT NULL,
+    "identity_id" INTEGER NOT NULL,
+    "email" JSONB NOT NULL,
+    "status" VARCHAR(20) DEFAULT 'pending',
+    "send_at" TIMESTAMPTZ(6) NOT NULL,
+    "result" JSONB,
+    "error" TEXT,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "compose_sends_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "compose_sends_identity_id_fkey" FOREIGN KEY ("identity_id") REFERENCES "identities"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "compose_sends_uuid_key" ON "compose_sends"("uuid");
+CREATE INDEX IF NOT EXISTS "compose_sends_user_id_idx" ON "compose_sends"("user_id");
+CREATE INDEX IF NOT EXISTS "compose_sends_identity_id_idx" ON "compose_sends"("identity_id");
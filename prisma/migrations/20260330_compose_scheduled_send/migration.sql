@@ -0,0 +1,2 @@
+-- Emails can be scheduled from compose to be sent later
+ALTER TABLE "compose_sends" ADD COLUMN IF NOT EXISTS "scheduled" BOOLEAN DEFAULT false;
@@ -0,0 +1,3 @@
+-- Identities' signatures are added to what they send, under the reply or at
+-- the very end of replies and forwards
+ALTER TABLE "identities" ADD COLUMN IF NOT EXISTS "signature_position" VARCHAR(20) DEFAULT 'below_reply';
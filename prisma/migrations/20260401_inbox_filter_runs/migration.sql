@@ -0,0 +1,26 @@
+-- Inbox filters can be run against emails already received, in the
+-- background, with their progress tracked per run
+CREATE TABLE IF NOT EXISTS "inbox_filter_runs" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "filter_id" INTEGER NOT NULL,
+    "user_id" INTEGER NOT NULL,
+    "folder" VARCHAR(50),
+    "received_after" TIMESTAMPTZ(6),
+    "received_before" TIMESTAMPTZ(6),
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "total" INTEGER DEFAULT 0,
+    "processed" INTEGER DEFAULT 0,
+    "matched" INTEGER DEFAULT 0,
+    "last_email_id" BIGINT DEFAULT 0,
+    "error" TEXT,
+    "started_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "inbox_filter_runs_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "inbox_filter_runs_filter_id_fkey" FOREIGN KEY ("filter_id") REFERENCES "inbox_filters"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "inbox_filter_runs_uuid_key" ON "inbox_filter_runs"("uuid");
+CREATE INDEX IF NOT EXISTS "inbox_filter_runs_filter_id_created_at_idx" ON "inbox_filter_runs"("filter_id", "created_at" DESC);
@@ -0,0 +1,40 @@
+-- Emails received at a shared mailbox's address can be assigned to its
+-- members, closed and reopened, and carry internal notes
+CREATE TABLE IF NOT EXISTS "shared_mailbox_messages" (
+    "id" BIGSERIAL NOT NULL,
+    "shared_mailbox_id" INTEGER NOT NULL,
+    "received_email_id" BIGINT NOT NULL,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'open',
+    "assigned_to" INTEGER,
+    "assigned_by" INTEGER,
+    "assigned_at" TIMESTAMPTZ(6),
+    "closed_by" INTEGER,
+    "closed_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "shared_mailbox_messages_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "shared_mailbox_messages_shared_mailbox_id_fkey" FOREIGN KEY ("shared_mailbox_id") REFERENCES "shared_mailboxes"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "shared_mailbox_messages_received_email_id_fkey" FOREIGN KEY ("received_email_id") REFERENCES "received_emails"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "shared_mailbox_messages_received_email_id_key" ON "shared_mailbox_messages"("received_email_id");
+CREATE INDEX IF NOT EXISTS "shared_mailbox_messages_shared_mailbox_id_status_assigned_to_idx" ON "shared_mailbox_messages"("shared_mailbox_id", "status", "assigned_to");
+
+CREATE TABLE IF NOT EXISTS "shared_mailbox_notes" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "shared_mailbox_id" INTEGER NOT NULL,
+    "received_email_id" BIGINT NOT NULL,
+    "user_id" INTEGER NOT NULL,
+    "body" TEXT NOT NULL,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "shared_mailbox_notes_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "shared_mailbox_notes_shared_mailbox_id_fkey" FOREIGN KEY ("shared_mailbox_id") REFERENCES "shared_mailboxes"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "shared_mailbox_notes_received_email_id_fkey" FOREIGN KEY ("received_email_id") REFERENCES "received_emails"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "shared_mailbox_notes_uuid_key" ON "shared_mailbox_notes"("uuid");
+CREATE INDEX IF NOT EXISTS "shared_mailbox_notes_received_email_id_created_at_idx" ON "shared_mailbox_notes"("received_email_id", "created_at");
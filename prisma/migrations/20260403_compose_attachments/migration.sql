@@ -0,0 +1,22 @@
+-- Compose attachments are uploaded to Stalwart, or to the attachments bucket
+-- when sending through SES, and recorded by checksum so the same file isn't
+-- uploaded twice
+CREATE TABLE IF NOT EXISTS "compose_attachments" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "user_id" INTEGER NOT NULL,
+    "identity_id" INTEGER NOT NULL,
+    "storage" VARCHAR(10) NOT NULL,
+    "checksum" VARCHAR(64) NOT NULL,
+    "filename" VARCHAR(255) NOT NULL,
+    "content_type" VARCHAR(255) NOT NULL,
+    "size" INTEGER NOT NULL,
+    "blob_id" VARCHAR(500) NOT NULL,
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "compose_attachments_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "compose_attachments_identity_id_fkey" FOREIGN KEY ("identity_id") REFERENCES "identities"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "compose_attachments_uuid_key" ON "compose_attachments"("uuid");
+CREATE INDEX IF NOT EXISTS "compose_attachments_identity_id_storage_checksum_created_at_idx" ON "compose_attachments"("identity_id", "storage", "checksum", "created_at" DESC);
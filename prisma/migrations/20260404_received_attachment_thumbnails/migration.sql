@@ -0,0 +1,4 @@
+-- Received attachments are stored next to the raw email, and image and PDF
+-- ones get a JPEG thumbnail. NULL means no thumbnail was attempted yet, an
+-- empty key that none can be made.
+ALTER TABLE "email_attachments" ADD COLUMN IF NOT EXISTS "thumbnail_s3_key" VARCHAR(500);
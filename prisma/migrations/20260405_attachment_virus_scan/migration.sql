@@ -0,0 +1,4 @@
+-- Attachments of received emails are scanned with ClamAV; infected ones are
+-- kept out of storage and can't be downloaded
+ALTER TABLE "email_attachments" ADD COLUMN IF NOT EXISTS "virus_verdict" VARCHAR(20);
+ALTER TABLE "email_attachments" ADD COLUMN IF NOT EXISTS "virus_name" VARCHAR(255);
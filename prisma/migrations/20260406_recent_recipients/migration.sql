@@ -0,0 +1,23 @@
+-- Whom each user has sent to, ranking the composer's address suggestions.
+-- Seeded from the emails already in sent folders.
+CREATE TABLE IF NOT EXISTS "recent_recipients" (
+    "id" BIGSERIAL NOT NULL,
+    "user_id" INTEGER NOT NULL,
+    "email" VARCHAR(255) NOT NULL,
+    "name" VARCHAR(255),
+    "send_count" INTEGER NOT NULL DEFAULT 0,
+    "last_sent_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "recent_recipients_pkey" PRIMARY KEY ("id")
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "recent_recipients_user_id_email_key" ON "recent_recipients"("user_id", "email");
+
+INSERT INTO "recent_recipients" ("user_id", "email", "send_count", "last_sent_at")
+SELECT i."user_id", LOWER(r."email"), COUNT(*), MAX(re."received_at")
+FROM "received_emails" re
+JOIN "identities" i ON i."id" = re."identity_id"
+CROSS JOIN LATERAL UNNEST(re."to_emails" || re."cc_emails" || re."bcc_emails") AS r("email")
+WHERE re."folder" = 'sent' AND r."email" <> ''
+GROUP BY i."user_id", LOWER(r."email")
+ON CONFLICT ("user_id", "email") DO NOTHING;
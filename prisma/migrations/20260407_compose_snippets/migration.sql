@@ -0,0 +1,25 @@
+-- Canned responses users insert into emails they compose, personal or shared
+-- with the organization.
+CREATE TABLE IF NOT EXISTS "compose_snippets" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "user_id" INTEGER NOT NULL,
+    "scope" VARCHAR(20) NOT NULL DEFAULT 'personal',
+    "name" VARCHAR(100) NOT NULL,
+    "shortcut" VARCHAR(50),
+    "subject" VARCHAR(998),
+    "text_body" TEXT,
+    "html_body" TEXT,
+    "use_count" INTEGER NOT NULL DEFAULT 0,
+    "last_used_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "compose_snippets_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "compose_snippets_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "compose_snippets_uuid_key" ON "compose_snippets"("uuid");
+CREATE INDEX IF NOT EXISTS "compose_snippets_user_id_idx" ON "compose_snippets"("user_id");
+CREATE INDEX IF NOT EXISTS "compose_snippets_org_id_scope_idx" ON "compose_snippets"("org_id", "scope");
@@ -0,0 +1,23 @@
+-- Optional open and click tracking of emails composed in the inbox. Counts and
+-- when the email was first seen are kept on its sent copy, each event in
+-- sent_email_events.
+ALTER TABLE "received_emails" ADD COLUMN IF NOT EXISTS "tracked" BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE "received_emails" ADD COLUMN IF NOT EXISTS "open_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "received_emails" ADD COLUMN IF NOT EXISTS "click_count" INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE "received_emails" ADD COLUMN IF NOT EXISTS "seen_at" TIMESTAMPTZ(6);
+
+CREATE TABLE IF NOT EXISTS "sent_email_events" (
+    "id" BIGSERIAL NOT NULL,
+    "received_email_id" BIGINT NOT NULL,
+    "event_type" VARCHAR(20) NOT NULL,
+    "link_id" VARCHAR(50),
+    "url" TEXT,
+    "ip_address" VARCHAR(45),
+    "user_agent" TEXT,
+    "occurred_at" TIMESTAMPTZ(6) NOT NULL DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "sent_email_events_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "sent_email_events_received_email_id_fkey" FOREIGN KEY ("received_email_id") REFERENCES "received_emails"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS "sent_email_events_received_email_id_occurred_at_idx" ON "sent_email_events"("received_email_id", "occurred_at" DESC);
@@ -0,0 +1,24 @@
+-- Bulk inbox operations over every email matching a filter, worked through in
+-- batches in the background with their progress.
+CREATE TABLE IF NOT EXISTS "inbox_bulk_jobs" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID DEFAULT gen_random_uuid(),
+    "user_id" INTEGER NOT NULL,
+    "action" VARCHAR(20) NOT NULL,
+    "folder" VARCHAR(50),
+    "criteria" JSONB NOT NULL DEFAULT '{}',
+    "max_email_id" BIGINT DEFAULT 0,
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "total" INTEGER DEFAULT 0,
+    "processed" INTEGER DEFAULT 0,
+    "last_email_id" BIGINT DEFAULT 0,
+    "error" TEXT,
+    "started_at" TIMESTAMPTZ(6),
+    "completed_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "inbox_bulk_jobs_pkey" PRIMARY KEY ("id")
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "inbox_bulk_jobs_uuid_key" ON "inbox_bulk_jobs"("uuid");
+CREATE INDEX IF NOT EXISTS "inbox_bulk_jobs_user_id_created_at_idx" ON "inbox_bulk_jobs"("user_id", "created_at" DESC);
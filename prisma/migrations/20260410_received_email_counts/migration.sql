@@ -0,0 +1,18 @@
+-- Folder counts of each identity's received emails, so the counts endpoint
+-- reads one row. The API installs the trigger keeping them at startup, and
+-- counts the existing emails the first time; a nightly job reconciles them.
+CREATE TABLE IF NOT EXISTS "received_email_counts" (
+    "identity_id" INTEGER NOT NULL,
+    "inbox" INTEGER NOT NULL DEFAULT 0,
+    "unread" INTEGER NOT NULL DEFAULT 0,
+    "starred" INTEGER NOT NULL DEFAULT 0,
+    "sent" INTEGER NOT NULL DEFAULT 0,
+    "drafts" INTEGER NOT NULL DEFAULT 0,
+    "spam" INTEGER NOT NULL DEFAULT 0,
+    "trash" INTEGER NOT NULL DEFAULT 0,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+    "reconciled_at" TIMESTAMPTZ(6),
+
+    CONSTRAINT "received_email_counts_pkey" PRIMARY KEY ("identity_id"),
+    CONSTRAINT "received_email_counts_identity_id_fkey" FOREIGN KEY ("identity_id") REFERENCES "identities"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
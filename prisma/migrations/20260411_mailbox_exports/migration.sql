@@ -0,0 +1,27 @@
+-- Mailboxes are exported by a worker job, every email of an identity with its
+-- attachments, as an MBOX file or a zip of EML files downloaded through a
+-- presigned URL or written to the organization's bucket
+CREATE TABLE IF NOT EXISTS "mailbox_exports" (
+    "id" BIGSERIAL NOT NULL,
+    "uuid" UUID NOT NULL DEFAULT gen_random_uuid(),
+    "org_id" INTEGER NOT NULL,
+    "identity_id" INTEGER NOT NULL,
+    "requested_by" INTEGER,
+    "format" VARCHAR(10) NOT NULL DEFAULT 'mbox',
+    "destination" VARCHAR(20) NOT NULL DEFAULT 'download',
+    "status" VARCHAR(20) NOT NULL DEFAULT 'pending',
+    "storage_key" VARCHAR(500),
+    "email_count" INTEGER DEFAULT 0,
+    "size" BIGINT DEFAULT 0,
+    "error" TEXT,
+    "completed_at" TIMESTAMPTZ(6),
+    "expires_at" TIMESTAMPTZ(6),
+    "created_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "mailbox_exports_pkey" PRIMARY KEY ("id"),
+    CONSTRAINT "mailbox_exports_org_id_fkey" FOREIGN KEY ("org_id") REFERENCES "organizations"("id") ON DELETE CASCADE ON UPDATE CASCADE,
+    CONSTRAINT "mailbox_exports_identity_id_fkey" FOREIGN KEY ("identity_id") REFERENCES "identities"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS "mailbox_exports_uuid_key" ON "mailbox_exports"("uuid");
+CREATE INDEX IF NOT EXISTS "mailbox_exports_org_id_created_at_idx" ON "mailbox_exports"("org_id", "created_at" DESC);
@@ -0,0 +1,24 @@
+-- Marking received emails as spam or not spam trains a Bayesian spam filter of
+-- their identity, from how many marked emails had each token. Each email keeps
+-- the verdict it was trained with.
+ALTER TABLE "received_emails" ADD COLUMN IF NOT EXISTS "spam_feedback" VARCHAR(10);
+
+CREATE TABLE IF NOT EXISTS "spam_filter_totals" (
+    "identity_id" INTEGER NOT NULL,
+    "spam_count" INTEGER NOT NULL DEFAULT 0,
+    "ham_count" INTEGER NOT NULL DEFAULT 0,
+    "updated_at" TIMESTAMPTZ(6) DEFAULT CURRENT_TIMESTAMP,
+
+    CONSTRAINT "spam_filter_totals_pkey" PRIMARY KEY ("identity_id"),
+    CONSTRAINT "spam_filter_totals_identity_id_fkey" FOREIGN KEY ("identity_id") REFERENCES "identities"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS "spam_filter_tokens" (
+    "identity_id" INTEGER NOT NULL,
+    "token" VARCHAR(300) NOT NULL,
+    "spam_count" INTEGER NOT NULL DEFAULT 0,
+    "ham_count" INTEGER NOT NULL DEFAULT 0,
+
+    CONSTRAINT "spam_filter_tokens_pkey" PRIMARY KEY ("identity_id", "token"),
+    CONSTRAINT "spam_filter_tokens_identity_id_fkey" FOREIGN KEY ("identity_id") REFERENCES "identities"("id") ON DELETE CASCADE ON UPDATE CASCADE
+);